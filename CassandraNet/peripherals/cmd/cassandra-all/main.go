@@ -0,0 +1,819 @@
+// Command cassandra-all runs every peripheral service in one process on one
+// port, for local development and small deployments. Services keep the
+// gateway's path layout, so clients built with client.NewGateway work
+// against either.
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/admin"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/autoscale"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/dashboard"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/featureflags"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/gateway"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logpipeline"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/messaging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metricscollector"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/netacl"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notification"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/orchestration"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/presence"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ratelimit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/scheduler"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugc"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugcworker"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/webhooks"
+)
+
+var defaultBanned = []string{"spam", "scam"}
+
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "HTTP_ADDR", Usage: "listen address, host:port or unix:///path/to.sock"},
+	{Key: "ADMIN_ADDR", Usage: "listen address for pprof, expvar, and /debug/state; empty disables the admin listener"},
+	{Key: "WORKER_QUEUE_SIZE", Usage: "moderation job queue capacity"},
+	{Key: "WORKERS", Usage: "number of moderation workers"},
+	{Key: "BANNED_TERMS", Usage: "banned phrases"},
+	{Key: "LOGS_QUEUE_SIZE", Usage: "log pipeline event queue capacity"},
+	{Key: "LOGS_MIN_LEVEL", Usage: "minimum severity the log pipeline processes"},
+	{Key: "LOGS_RECENT_CAPACITY", Usage: "history size for recent log events"},
+	{Key: "LOGS_FIELD_TYPES", Usage: "typed log fields parsed and validated at ingest, each \"source:field=type\""},
+	{Key: "MEDIA_WORKERS", Usage: "uploads processed at once for MIME sniffing, image dimensions, and thumbnails"},
+	{Key: "MEDIA_QUEUE", Usage: "uploads waiting for a processor before the rest wait for the next sweep"},
+	{Key: "MEDIA_MAX_BYTES", Usage: "largest upload accepted at /content/{id}/data"},
+	{Key: "MEDIA_THUMBNAIL_SIZE", Usage: "longest side of generated thumbnails, in pixels"},
+	{Key: "MEDIA_SWEEP_INTERVAL", Usage: "how often uploads still awaiting processing are queued again"},
+	{Key: "AUTOSCALE_MIN_WORKERS", Usage: "fewest moderation workers the autoscaler leaves"},
+	{Key: "AUTOSCALE_MAX_WORKERS", Usage: "most moderation workers the autoscaler starts; 0 leaves the workers alone"},
+	{Key: "AUTOSCALE_MIN_LOGS_QUEUE_SIZE", Usage: "smallest log pipeline queue capacity the autoscaler leaves"},
+	{Key: "AUTOSCALE_MAX_LOGS_QUEUE_SIZE", Usage: "largest log pipeline queue capacity the autoscaler grows to; 0 leaves the queue alone"},
+	{Key: "AUTOSCALE_INTERVAL", Usage: "how often queue depth is sampled for autoscaling"},
+	{Key: "AUTOSCALE_WINDOW", Usage: "samples averaged before the autoscaler decides"},
+	{Key: "AUTOSCALE_SCALE_UP_AT", Usage: "average queue utilization, 0 to 1, at which a pool grows"},
+	{Key: "AUTOSCALE_SCALE_DOWN_AT", Usage: "average queue utilization, 0 to 1, at which a pool shrinks"},
+	{Key: "AUTOSCALE_COOLDOWN", Usage: "how long the autoscaler leaves a pool alone after a change"},
+	{Key: "AUTOSCALE_HISTORY", Usage: "autoscaling decisions kept for /autoscale/decisions"},
+	{Key: "NOTIFY_RECENT_CAPACITY", Usage: "history size for recent deliveries"},
+	{Key: "NOTIFY_TRACKING_URL", Usage: "public base URL of /notifications/track/, used to rewrite links in emails and add open pixels; empty sends emails unchanged"},
+	{Key: "CHANNEL_CONCURRENCY", Usage: "most notifications sent at once per channel, each \"channel=sends\"; channels not listed are unlimited"},
+	{Key: "CHANNEL_RATES", Usage: "most notifications started per second per channel, each \"channel=rate\""},
+	{Key: "CHANNEL_QUEUE", Usage: "notifications that may wait for a limited channel before more are refused with 503"},
+	{Key: "EVENT_RECIPIENT", Usage: "recipient notified of content reviews and finished assignments; empty disables event notifications"},
+	{Key: "EVENT_CHANNEL", Usage: "channel event notifications are sent over: email, webhook, or in_app"},
+	{Key: "METRICS_SERIES_IDLE_TTL", Usage: "idle time before a series is evicted"},
+	{Key: "METRICS_MAX_SERIES", Usage: "maximum total series"},
+	{Key: "METRICS_SNAPSHOT_PATH", Usage: "aggregator snapshot file"},
+	{Key: "METRICS_SNAPSHOT_INTERVAL", Usage: "interval between snapshots"},
+	{Key: "METRICS_ALERT_RULES_FILE", Usage: "alert rules file"},
+	{Key: "METRICS_ALERT_EVAL_INTERVAL", Usage: "alert evaluation interval"},
+	{Key: "METRICS_ALERT_CHANNEL", Usage: "notification channel for alerts"},
+	{Key: "METRICS_ALERT_RECIPIENT", Usage: "notification recipient for alerts"},
+	{Key: "METRICS_SCRAPE_TARGETS", Usage: "comma-separated Prometheus endpoints to scrape, each \"name=url\""},
+	{Key: "METRICS_SCRAPE_INTERVAL", Usage: "how often each scrape target is scraped"},
+	{Key: "ORCHESTRATION_QUOTAS", Usage: "per-tenant assignment limits, each \"[tenant:]running=N\" or \"[tenant:]queued=N\"; 0 lifts a limit"},
+	{Key: "MESSAGING_PULL_ACK_DEADLINE", Usage: "how long pulls naming no ack_deadline_seconds lease their messages; 0 opts out, leaving them unleased"},
+	{Key: "MESSAGING_STRICT_TOPICS", Usage: "refuse publishes to topics not created at /topics"},
+	{Key: "MESSAGING_EXPIRE_INTERVAL", Usage: "how often messages past their TTL are removed"},
+	{Key: "MESSAGING_DELIVERY_INTERVAL", Usage: "how often delayed messages that are due are delivered"},
+	{Key: "MESSAGING_STREAM_KEEPALIVE", Usage: "how often idle message streams send a keep-alive comment"},
+	{Key: "MESSAGING_LAG_MAX_UNACKED", Usage: "pulled but unacknowledged messages past which a consumer group is lagging; 0 does not check"},
+	{Key: "MESSAGING_LAG_MAX_UNPULLED", Usage: "messages past a consumer group's position at which it is lagging; 0 does not check"},
+	{Key: "MESSAGING_LAG_MAX_AGE", Usage: "age of a consumer group's oldest pending message past which it is lagging; 0 does not check"},
+	{Key: "MESSAGING_LAG_CHECK_INTERVAL", Usage: "how often consumer groups' lag is checked for alerts"},
+	{Key: "MESSAGING_LAG_CHANNEL", Usage: "notification channel for consumer lag alerts"},
+	{Key: "MESSAGING_LAG_RECIPIENT", Usage: "notification recipient for consumer lag alerts"},
+	{Key: "ORCHESTRATION_TRIGGERS_FILE", Usage: "JSON array of triggers creating assignments from messaging topics; empty disables triggers"},
+	{Key: "ORCHESTRATION_TRIGGERS_POLL_INTERVAL", Usage: "how often each trigger topic is pulled"},
+	{Key: "ORCHESTRATION_TRIGGERS_BATCH_SIZE", Usage: "most messages pulled per trigger topic and poll"},
+	{Key: "SCHEDULER_POLL_INTERVAL", Usage: "how often the scheduler checks for due jobs"},
+	{Key: "SCHEDULER_RUN_TIMEOUT", Usage: "maximum time a scheduled run may take"},
+	{Key: "SCHEDULER_RUN_HISTORY", Usage: "runs kept per scheduled job"},
+	{Key: "SCHEDULER_HTTP_ALLOWED_HOSTS", Usage: "host names scheduled HTTP actions may call, \".example.com\" allowing subdomains; empty allows any"},
+	{Key: "PRESENCE_TTL", Usage: "how long a heartbeat keeps a player or server online when it names no TTL"},
+	{Key: "PRESENCE_MAX_TTL", Usage: "longest TTL a presence heartbeat may ask for"},
+	{Key: "PRESENCE_SWEEP_INTERVAL", Usage: "how often to take players and servers whose heartbeats stopped offline"},
+	{Key: "PRESENCE_STREAM_KEEPALIVE", Usage: "how often idle presence streams send a keep-alive comment"},
+	{Key: "WEBHOOK_TIMEOUT", Usage: "maximum time a webhook delivery attempt may take"},
+	{Key: "WEBHOOK_MAX_ATTEMPTS", Usage: "attempts before a webhook delivery fails and waits for a redrive"},
+	{Key: "WEBHOOK_MAX_BACKOFF", Usage: "longest wait between webhook delivery attempts"},
+	{Key: "WEBHOOK_HISTORY", Usage: "finished webhook deliveries kept per subscription"},
+	{Key: "WEBHOOK_ALLOWED_HOSTS", Usage: "host names webhook URLs may use, \".example.com\" allowing subdomains; empty allows any"},
+	{Key: "METERING_FLUSH_INTERVAL", Usage: "how often recorded usage is added to the stored daily totals"},
+	{Key: "METERING_QUOTAS", Usage: "usage quotas reported at /usage/quotas, each \"[tenant:]meter=limit[/day|/month]\""},
+	{Key: "RETENTION_INTERVAL", Usage: "how often retention policies purge expired records"},
+	{Key: "RETENTION_MAX_AGES", Usage: "per-policy maximum ages, each \"policy=duration\"; 0 disables a policy"},
+	{Key: "RETENTION_DRY_RUN", Usage: "comma-separated policies that only count what they would purge, or * for all"},
+	{Key: "RETENTION_HISTORY", Usage: "retention reports kept per policy"},
+	{Key: "REPLICATION_REGION", Usage: "name of this deployment's region; empty disables replication"},
+	{Key: "REPLICATION_PEER_URL", Usage: "base URL of the same service in the peer region; empty only applies the peer's changes"},
+	{Key: "REPLICATION_INTERVAL", Usage: "how often recorded changes are sent to the peer region"},
+	{Key: "REPLICATION_MAX_BACKOFF", Usage: "longest wait between failed sends to the peer region"},
+	{Key: "REPLICATION_BATCH_SIZE", Usage: "most changes sent to the peer region per request"},
+	{Key: "REPLICATION_TIMEOUT", Usage: "maximum time a send to the peer region may take"},
+	{Key: "CONFIG_POLL_INTERVAL", Usage: "config reload poll interval"},
+	{Key: "STORAGE_URL", Usage: "storage driver URL shared by every service: memory://, file:///path/to/data.db, postgres://..., or redis://..."},
+	{Key: "LOCK_URL", Usage: "lock URL letting one replica at a time run schedules, triggers, retention purges, and lag alerts: memory://, postgres://..., or redis://...; defaults to STORAGE_URL"},
+	{Key: "ENCRYPTION_KEY_FILE", Usage: "file of key-encryption keys, one \"id=base64\" line each, sealing payloads and PII at rest"},
+	{Key: "ENCRYPTION_ACTIVE_KEY", Usage: "ID of the key file's key that wraps new data keys; defaults to the last"},
+	{Key: "ENCRYPTION_VAULT_URL", Usage: "Vault address whose transit engine wraps data keys, instead of a key file"},
+	{Key: "ENCRYPTION_VAULT_TOKEN", Usage: "Vault token allowed to encrypt and decrypt with the transit key"},
+	{Key: "ENCRYPTION_VAULT_MOUNT", Usage: "path the Vault transit engine is mounted at"},
+	{Key: "ENCRYPTION_VAULT_KEY", Usage: "name of the Vault transit key"},
+	{Key: "ENCRYPTION_DATA_KEY_LIFETIME", Usage: "how long one data key seals values before a new one is made"},
+	{Key: "TLS_CERT_FILE", Usage: "PEM certificate to serve HTTPS with"},
+	{Key: "TLS_KEY_FILE", Usage: "PEM private key for the TLS certificate"},
+	{Key: "TLS_RELOAD_INTERVAL", Usage: "how often to check the certificate files for changes"},
+	{Key: "TLS_CLIENT_CA_FILE", Usage: "PEM CAs that client certificates must chain to; enables mutual TLS"},
+	{Key: "TLS_CLIENT_CERT_OPTIONAL", Usage: "accept clients without a certificate when mutual TLS is enabled"},
+	{Key: "TLS_ALLOWED_CLIENT_IDS", Usage: "client certificate identities (SPIFFE ID, DNS name, or common name) allowed to connect"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for other services' certificates"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to other services"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in other services' certificates"},
+	{Key: "H2C", Usage: "also accept HTTP/2 over cleartext connections"},
+	{Key: "REQUEST_TIMEOUT", Usage: "maximum time to handle a request"},
+	{Key: "MAX_BODY_BYTES", Usage: "maximum request body size in bytes"},
+	{Key: "MAX_BODY_ROUTES", Usage: "per-route body limits, each \"[METHOD ]/prefix=bytes\"; 0 lifts the limit on the route"},
+	{Key: "ACCESS_LOG_SAMPLE", Usage: "fraction of requests written to the access log, above 0 and at most 1"},
+	{Key: "ACCESS_LOG_SAMPLE_ROUTES", Usage: "per-route access log sampling, each \"[METHOD ]/prefix=rate\"; server errors are always logged"},
+	{Key: "CAPTURE_DIR", Usage: "directory sampled requests are recorded in for replay; empty disables capture"},
+	{Key: "CAPTURE_ROUTES", Usage: "requests to capture, each \"[METHOD ]/prefix=rate\""},
+	{Key: "CAPTURE_MAX_BODY_BYTES", Usage: "longest request body recorded; longer bodies are left out"},
+	{Key: "CAPTURE_MAX_FILE_BYTES", Usage: "size at which a new capture file is started"},
+	{Key: "CAPTURE_MAX_FILES", Usage: "capture files kept before the oldest is removed"},
+	{Key: "CAPTURE_REDACT_FIELDS", Usage: "comma-separated JSON fields and query parameters replaced in captures"},
+	{Key: "CAPTURE_REDACT_HEADERS", Usage: "comma-separated headers left out of captures besides credentials"},
+	{Key: "RATE_LIMIT", Usage: "requests per second allowed per caller; 0 disables"},
+	{Key: "RATE_BURST", Usage: "requests a caller may burst above the rate"},
+	{Key: "RATE_LIMIT_ROUTES", Usage: "per-route limits, each \"[METHOD ]/prefix=rate[:burst]\"; a rate of 0 exempts the route"},
+	{Key: "RATE_LIMIT_KEY", Usage: "what callers are limited by: subject, tenant, or ip"},
+	{Key: "RATE_LIMIT_REDIS_URL", Usage: "redis:// URL sharing limits between replicas; empty keeps them in memory"},
+	{Key: "IDEMPOTENCY_TTL", Usage: "how long responses to POSTs with an Idempotency-Key are replayed to retries; 0 disables"},
+	{Key: "IDEMPOTENCY_MAX_BODY_BYTES", Usage: "largest response body kept for replay"},
+	{Key: "ACL_ALLOW", Usage: "networks (CIDRs or addresses) allowed to reach administrative endpoints; empty allows all"},
+	{Key: "ACL_DENY", Usage: "networks refused at administrative endpoints even when allowed"},
+	{Key: "ACL_PATHS", Usage: "path prefixes the access lists guard"},
+	{Key: "TRUSTED_PROXIES", Usage: "networks of proxies whose X-Forwarded-For names the client"},
+	{Key: "CORS_ALLOWED_ORIGINS", Usage: "origins allowed to call the service from a browser, or *"},
+	{Key: "CORS_ALLOWED_METHODS", Usage: "methods allowed in cross-origin requests"},
+	{Key: "CORS_ALLOWED_HEADERS", Usage: "request headers allowed in cross-origin requests; empty allows those requested"},
+	{Key: "CORS_ALLOW_CREDENTIALS", Usage: "let browsers send cookies and credentials cross-origin"},
+	{Key: "CORS_MAX_AGE", Usage: "how long browsers may cache preflight responses"},
+	{Key: "AUTH_API_KEYS", Usage: "comma-separated API keys accepted, each \"key\" or \"tenant:key\""},
+	{Key: "AUTH_JWT_SECRET", Usage: "HMAC secret for HS256/384/512 bearer tokens"},
+	{Key: "AUTH_JWT_PUBLIC_KEY_FILE", Usage: "PEM public keys or certificates for RS*/ES* bearer tokens"},
+	{Key: "AUTH_JWT_ISSUER", Usage: "required iss claim of bearer tokens"},
+	{Key: "AUTH_JWT_AUDIENCE", Usage: "required aud claim of bearer tokens"},
+	{Key: "AUTH_JWT_TENANT_CLAIM", Usage: "bearer token claim holding the tenant ID"},
+	{Key: "AUTH_JWT_PROJECT_CLAIM", Usage: "bearer token claim holding the project ID"},
+	{Key: "AUTH_JWT_LEEWAY", Usage: "clock skew tolerated when checking token expiry"},
+	{Key: "AUTH_POLICY_FILE", Usage: "JSON role bindings enforced per route"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent on calls to other services"},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := logging.New("cassandra-all")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("CASSANDRA", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	addr := loader.String("HTTP_ADDR", ":8080")
+	diag := admin.FromConfig(loader)
+	aclPaths := []string{"/notifications/templates/", "/alerts", "/scrape", dashboard.Path}
+	aclPaths = append(aclPaths, netacl.Mount("/messaging", messaging.ManagementPaths...)...)
+	aclPaths = append(aclPaths, netacl.Mount("/orchestration", orchestration.ManagementPaths...)...)
+	acl, err := netacl.FromConfig(loader, aclPaths...)
+	if err != nil {
+		logger.Fatalf("load acl config: %v", err)
+	}
+	authn, err := auth.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load auth config: %v", err)
+	}
+	if !authn.Enabled() {
+		logger.Warn("authentication disabled; set AUTH_API_KEYS, AUTH_JWT_*, or TLS_CLIENT_CA_FILE to require credentials")
+	}
+	checks := health.NewRegistry()
+	group := server.NewRunGroup(5*time.Second, logger)
+	watcher := config.NewWatcher(loader, loader.Duration("CONFIG_POLL_INTERVAL", 5*time.Second), logger)
+
+	// Services announce events to each other directly on one bus.
+	bus := eventbus.New(0, logger)
+	bus.Start()
+	checks.Optional("event bus", bus.Check)
+	diag.State("event bus", func() any { return bus.Stats() })
+
+	// Services keep their records in separate buckets of one driver.
+	db, err := storage.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load storage config: %v", err)
+	}
+	checks.Readiness("storage", db.Check)
+	locker, err := lock.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load lock config: %v", err)
+	}
+
+	// One keyring seals message payloads, notification recipients, and UGC
+	// attributes, with the copies the shared stores keep of them.
+	encryptionConfig, err := encryption.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load encryption config: %v", err)
+	}
+	keyring, err := encryption.New(encryptionConfig, clientTLS, logger.With("component", "encryption"))
+	if err != nil {
+		logger.Fatalf("load encryption keys: %v", err)
+	}
+
+	// One webhooks service delivers every service's events.
+	hookStore := webhooks.NewStorageStore(db)
+	hookStore.SetKeyring(keyring)
+	hooks := webhooks.NewService(hookStore, nil, webhooks.FromConfig(loader, []string{
+		messaging.EventMessagePublished,
+		eventbus.NameContentReviewed,
+		eventbus.NameAssignmentCompleted,
+		eventbus.NameDeliveryFailed,
+		eventbus.NamePresenceChanged,
+	}), nil, logger.With("component", "webhooks"))
+	hooks.SetAudit(audit.New(db, "webhooks", logger))
+	hooks.Subscribe(bus)
+
+	// One meter counts every service's usage.
+	meterConfig, err := metering.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load metering config: %v", err)
+	}
+	meter := metering.New(db, meterConfig, logger.With("component", "metering"))
+
+	// One retention manager purges every service's expired records.
+	retentionConfig, err := retention.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load retention config: %v", err)
+	}
+	retainer := retention.New(retentionConfig, logger.With("component", "retention"))
+	retainer.SetLocker(locker)
+	auditLog := audit.New(db, "cassandra-all", logger)
+	auditLog.SetKeyring(keyring)
+	auditLog.RegisterRetention(retainer)
+
+	// One replicator ships messaging and UGC changes to the peer region's
+	// all-in-one deployment.
+	replicationConfig, err := replication.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load replication config: %v", err)
+	}
+	replicator := replication.New(db, "cassandra-all", replicationConfig, auth.Transport(loader.Secret("AUTH_CLIENT_API_KEY", ""), clientTLS), logger.With("component", "replication"))
+	replicator.SetKeyring(keyring)
+
+	messagingStore := messaging.NewStorageStore(db)
+	messagingStore.SetKeyring(keyring)
+	if _, err := messagingStore.Migrate(ctx); err != nil {
+		logger.Fatalf("migrate messaging store: %v", err)
+	}
+	messagingService := messaging.NewService(messagingStore, nil)
+	messagingService.SetRouteStore(messagingStore)
+	messagingService.SetGroupStore(messagingStore)
+	messagingService.SetTopicKeyStore(messagingStore)
+	messagingService.SetSubscriptionStore(messagingStore)
+	messagingService.SetLeaseStore(messagingStore)
+	messagingService.SetDeadLetterStore(messagingStore)
+	messagingService.SetTopicStore(messagingStore)
+	messagingService.SetStrictTopics(loader.Bool("MESSAGING_STRICT_TOPICS", false))
+	messagingService.SetPullAckDeadline(loader.Duration("MESSAGING_PULL_ACK_DEADLINE", messaging.DefaultAckDeadline))
+	messagingService.SetStreamKeepAlive(loader.Duration("MESSAGING_STREAM_KEEPALIVE", 15*time.Second))
+	lagThresholds := messaging.LagThresholds{
+		MaxUnacked:  loader.Int("MESSAGING_LAG_MAX_UNACKED", 0),
+		MaxUnpulled: loader.Int("MESSAGING_LAG_MAX_UNPULLED", 0),
+		MaxAge:      loader.Duration("MESSAGING_LAG_MAX_AGE", 0),
+	}
+	messagingService.SetLagThresholds(lagThresholds)
+	messagingService.SetAudit(audit.New(db, "messaging-service", logger))
+	messagingService.SetWebhooks(hooks.EmitEvent)
+	messagingService.SetMeter(meter)
+	messagingService.RegisterRetention(retainer)
+	messagingService.SetReplicator(replicator)
+
+	ugcStore := ugc.NewStorageStore(db)
+	ugcStore.SetKeyring(keyring)
+	ugcService := ugc.NewService(ugcStore, nil)
+	ugcService.SetEvents(bus)
+	ugcAudit := audit.New(db, "ugc-service", logger)
+	ugcAudit.SetKeyring(keyring)
+	ugcService.SetAudit(ugcAudit)
+	ugcService.SetMeter(meter)
+	ugcService.RegisterRetention(retainer)
+	ugcService.SetReplicator(replicator)
+	mediaConfig, err := ugc.MediaFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load media config: %v", err)
+	}
+	ugcService.SetMedia(ugcStore, mediaConfig, logger)
+
+	// One admin channel carries every service's topics.
+	admin := adminchannel.New(adminchannel.Config{}, logger)
+
+	orchestrationStore := orchestration.NewStorageStore(db)
+	orchestrationService := orchestration.NewService(orchestrationStore, nil)
+	orchestrationService.SetTemplateStore(orchestrationStore)
+	orchestrationService.SetEvents(bus)
+	orchestrationService.SetAudit(audit.New(db, "orchestrator", logger))
+	orchestrationService.SetAdminChannel(admin)
+	quotas, err := orchestration.ParseQuotas(loader.StringSlice("ORCHESTRATION_QUOTAS", nil))
+	if err != nil {
+		logger.Fatalf("load quotas config: %sORCHESTRATION_QUOTAS: %v", loader.Prefix, err)
+	}
+	orchestrationService.SetQuotas(quotas)
+	var triggers *orchestration.Triggers
+	if triggersFile := loader.String("ORCHESTRATION_TRIGGERS_FILE", ""); triggersFile != "" {
+		defs, err := orchestration.LoadTriggers(triggersFile)
+		if err != nil {
+			logger.Fatalf("load triggers: %v", err)
+		}
+		triggers, err = orchestration.NewTriggers(orchestrationService, triggerSource{messagingService}, defs, orchestration.TriggerConfig{
+			PollInterval: loader.Duration("ORCHESTRATION_TRIGGERS_POLL_INTERVAL", 2*time.Second),
+			BatchSize:    loader.Int("ORCHESTRATION_TRIGGERS_BATCH_SIZE", 50),
+		}, logger.With("component", "triggers"))
+		if err != nil {
+			logger.Fatalf("load triggers: %v", err)
+		}
+		triggers.SetLocker(locker)
+		diag.State("triggers", func() any { return triggers.Stats() })
+	}
+	flagsService := featureflags.NewService(featureflags.NewStorageStore(db), nil)
+	flagsService.SetAudit(audit.New(db, "feature-flags", logger))
+
+	workerLogger := logger.With("component", "ugc-worker")
+	pool := ugcworker.NewWorkerPool(loader.Int("WORKERS", 4), loader.Int("WORKER_QUEUE_SIZE", 256),
+		ugcworker.NewModerationPolicy(loader.StringSlice("BANNED_TERMS", defaultBanned)), workerLogger)
+	pool.Start()
+	watcher.Subscribe(func(l config.Loader) {
+		terms := l.StringSlice("BANNED_TERMS", defaultBanned)
+		pool.SetPolicy(ugcworker.NewModerationPolicy(terms))
+		logger.Printf("banned terms updated (%d terms)", len(terms))
+	}, "BANNED_TERMS")
+	watcher.Subscribe(func(l config.Loader) {
+		pool.Resize(l.Int("WORKERS", 4))
+		logger.Printf("worker pool resized to %d", pool.Workers())
+	}, "WORKERS")
+	workerService := ugcworker.NewService(pool, workerLogger)
+	workerService.SetAdminChannel(admin)
+	checks.Readiness("worker pool", pool.Check)
+	diag.State("worker pool", func() any { return pool.Stats() })
+
+	notifyLogger := logger.With("component", "notification")
+	senders := map[notification.Channel]notification.Sender{
+		notification.ChannelEmail:   notification.NewMemorySender(),
+		notification.ChannelWebhook: notification.NewMemorySender(),
+		notification.ChannelInApp:   notification.NewMemorySender(),
+	}
+	notifyHistory := notification.NewStorageHistory(db, loader.Int("NOTIFY_RECENT_CAPACITY", 200))
+	notifyHistory.SetKeyring(keyring)
+	notifyService := notification.NewService(notification.NewTemplateStore(), senders, notifyHistory, notifyLogger)
+	notifyService.SetEvents(bus)
+	notifyService.SetAudit(audit.New(db, "notification", notifyLogger))
+	notifyService.SetMeter(meter)
+	channelLimits, err := notification.LimitsFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load channel limits: %v", err)
+	}
+	notifyService.SetChannelLimits(channelLimits)
+	diag.State("notification channels", func() any { return notifyService.ChannelStats() })
+	notifyService.RegisterRetention(retainer)
+	trackingURL := ""
+	if u, err := loader.URL("NOTIFY_TRACKING_URL", ""); err != nil {
+		logger.Fatalf("load config: %v", err)
+	} else if u != nil {
+		trackingURL = u.String()
+	}
+	notifyEngagement := notification.NewStorageEngagement(db)
+	notifyEngagement.RegisterRetention(retainer)
+	notifyService.SetEngagement(notifyEngagement, trackingURL)
+	notifyService.SetSuppressions(notification.NewStorageSuppressions(db))
+	janitor := messaging.NewJanitor(messagingService, loader.Duration("MESSAGING_EXPIRE_INTERVAL", messaging.DefaultExpireInterval), logger.With("component", "messaging"))
+	janitor.SetLocker(locker)
+	releaser := messaging.NewReleaser(messagingService, loader.Duration("MESSAGING_DELIVERY_INTERVAL", messaging.DefaultReleaseInterval), logger.With("component", "messaging"))
+	releaser.SetLocker(locker)
+	// Lag alerts go straight to the in-process notification service, so
+	// they only need thresholds to check.
+	var lagAlerts *messaging.LagAlerts
+	if lagThresholds != (messaging.LagThresholds{}) {
+		lagAlerts = messaging.NewLagAlerts(messagingService, lagNotifier{
+			notifications: notifyService,
+			channel:       notification.Channel(loader.String("MESSAGING_LAG_CHANNEL", "webhook")),
+			recipient:     loader.String("MESSAGING_LAG_RECIPIENT", "ops"),
+		}, loader.Duration("MESSAGING_LAG_CHECK_INTERVAL", 30*time.Second), logger.With("component", "messaging"))
+		lagAlerts.SetLocker(locker)
+	}
+	if recipient := loader.String("EVENT_RECIPIENT", ""); recipient != "" {
+		channel := notification.Channel(loader.String("EVENT_CHANNEL", string(notification.ChannelInApp)))
+		if senders[channel] == nil {
+			logger.Fatalf("load events config: unsupported EVENT_CHANNEL %q", channel)
+		}
+		notifyService.Subscribe(bus, channel, recipient)
+	}
+
+	logsLogger := logger.With("component", "log-pipeline")
+	pipeline := logpipeline.NewPipeline(loader.Int("LOGS_QUEUE_SIZE", 256),
+		logpipeline.ParseLevel(loader.String("LOGS_MIN_LEVEL", "INFO")), logsLogger)
+	ring := logpipeline.NewRingBufferSink(loader.Int("LOGS_RECENT_CAPACITY", 200))
+	pipeline.RegisterSink(ring)
+	logTail := logpipeline.NewTailSink()
+	pipeline.RegisterSink(logTail)
+	pipeline.RegisterSink(logpipeline.NewStdoutSink(logsLogger))
+	pipeline.Start()
+	watcher.Subscribe(func(l config.Loader) {
+		level := logpipeline.ParseLevel(l.String("LOGS_MIN_LEVEL", "INFO"))
+		pipeline.SetMinLevel(level)
+		logger.Printf("log pipeline minimum level set to %s", level)
+	}, "LOGS_MIN_LEVEL")
+	logSchema, err := logpipeline.ParseSchema(loader.StringSlice("LOGS_FIELD_TYPES", nil))
+	if err != nil {
+		logger.Fatalf("load field types: %sLOGS_FIELD_TYPES: %v", loader.Prefix, err)
+	}
+	logsService := logpipeline.NewService(pipeline, ring, logsLogger)
+	logsService.SetTail(logTail)
+	logsService.SetMeter(meter)
+	logsService.SetSchema(logSchema)
+	checks.Readiness("log pipeline", pipeline.Check)
+	diag.State("log pipeline", func() any { return pipeline.Stats() })
+
+	// One controller sizes the worker pool and the log pipeline's queue,
+	// each only when its maximum is set.
+	scaleConfig, err := autoscale.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load autoscale config: %v", err)
+	}
+	scaler := autoscale.New(scaleConfig, "cassandra-all", bus, logger.With("component", "autoscale"))
+	if maxWorkers := loader.Int("AUTOSCALE_MAX_WORKERS", 0); maxWorkers > 0 {
+		err := scaler.Add(autoscale.Target{
+			Name:     "ugc-worker.workers",
+			Resource: autoscale.ResourceWorkers,
+			Min:      loader.Int("AUTOSCALE_MIN_WORKERS", 1),
+			Max:      maxWorkers,
+			Depth: func() (int, int) {
+				stats := pool.Stats()
+				return stats.Queued, stats.Capacity
+			},
+			Size:   pool.Workers,
+			Resize: pool.Resize,
+		})
+		if err != nil {
+			logger.Fatalf("load autoscale config: %v", err)
+		}
+	}
+	if maxQueue := loader.Int("AUTOSCALE_MAX_LOGS_QUEUE_SIZE", 0); maxQueue > 0 {
+		err := scaler.Add(autoscale.Target{
+			Name:     "log-pipeline.queue",
+			Resource: autoscale.ResourceBuffer,
+			Min:      loader.Int("AUTOSCALE_MIN_LOGS_QUEUE_SIZE", loader.Int("LOGS_QUEUE_SIZE", 256)),
+			Max:      maxQueue,
+			Depth: func() (int, int) {
+				stats := pipeline.Stats()
+				return stats.Queued, stats.Capacity
+			},
+			Size:   func() int { return pipeline.Stats().Capacity },
+			Resize: pipeline.Resize,
+		})
+		if err != nil {
+			logger.Fatalf("load autoscale config: %v", err)
+		}
+	}
+	diag.State("autoscale", func() any { return scaler.Targets() })
+
+	metricsLogger := logger.With("component", "metrics-collector")
+	aggregator := metricscollector.NewAggregatorWithConfig(metricscollector.AggregatorConfig{
+		IdleTTL:   loader.Duration("METRICS_SERIES_IDLE_TTL", 0),
+		MaxSeries: loader.Int("METRICS_MAX_SERIES", 0),
+	})
+	aggregator.Start()
+	aggregator.RegisterRetention(retainer)
+	var persister *metricscollector.Persister
+	if snapshotPath := loader.String("METRICS_SNAPSHOT_PATH", ""); snapshotPath != "" {
+		persister = metricscollector.NewPersister(aggregator, metricscollector.NewFileSnapshotStore(snapshotPath),
+			loader.Duration("METRICS_SNAPSHOT_INTERVAL", 30*time.Second), metricsLogger)
+		restored, err := persister.Restore(ctx)
+		if err != nil {
+			logger.Printf("restore metrics snapshot: %v", err)
+		} else {
+			logger.Printf("restored %d series from %s", restored, snapshotPath)
+		}
+		persister.Start()
+	}
+	metricsService := metricscollector.NewService(aggregator, metricsLogger)
+	alerts := metricscollector.NewAlertManager(aggregator, alertNotifier{
+		notifications: notifyService,
+		channel:       notification.Channel(loader.String("METRICS_ALERT_CHANNEL", "webhook")),
+		recipient:     loader.String("METRICS_ALERT_RECIPIENT", "ops"),
+	}, loader.Duration("METRICS_ALERT_EVAL_INTERVAL", 15*time.Second), metricsLogger)
+	alerts.SetAudit(audit.New(db, "metrics-collector", metricsLogger))
+	alerts.SetAdminChannel(admin)
+	if rulesFile := loader.String("METRICS_ALERT_RULES_FILE", ""); rulesFile != "" {
+		if err := alerts.LoadRulesFile(rulesFile); err != nil {
+			logger.Printf("load alert rules: %v", err)
+		}
+	}
+	alerts.Start()
+	scraper := metricscollector.NewScraper(aggregator, metricscollector.ScrapeConfig{
+		Interval: loader.Duration("METRICS_SCRAPE_INTERVAL", 15*time.Second),
+	}, metricsLogger)
+	scraper.SetTransport(auth.Transport(loader.Secret("AUTH_CLIENT_API_KEY", ""), clientTLS))
+	scraper.SetAudit(audit.New(db, "metrics-collector", metricsLogger))
+	for _, spec := range loader.StringSlice("METRICS_SCRAPE_TARGETS", nil) {
+		target, err := metricscollector.ParseScrapeTarget(spec)
+		if err != nil {
+			logger.Fatalf("invalid config: %v", err)
+		}
+		if err := scraper.PutTarget(target); err != nil {
+			logger.Fatalf("invalid config: %v", err)
+		}
+	}
+	watcher.Start()
+
+	// Scheduled jobs publish and notify through the in-process services.
+	schedulerService := scheduler.NewService(scheduler.NewStorageStore(db),
+		scheduler.NewActions(nil, schedulePublisher{messagingService}, scheduleNotifier{notifyService}, loader.StringSlice("SCHEDULER_HTTP_ALLOWED_HOSTS", nil)),
+		scheduler.Config{
+			PollInterval: loader.Duration("SCHEDULER_POLL_INTERVAL", 5*time.Second),
+			Timeout:      loader.Duration("SCHEDULER_RUN_TIMEOUT", time.Minute),
+			History:      loader.Int("SCHEDULER_RUN_HISTORY", 100),
+		}, nil, logger.With("component", "scheduler"))
+	schedulerService.SetAudit(audit.New(db, "scheduler", logger))
+	schedulerService.SetLocker(locker)
+	presenceService := presence.NewService(presence.NewStorageStore(db), presence.Config{
+		DefaultTTL:    loader.Duration("PRESENCE_TTL", 30*time.Second),
+		MaxTTL:        loader.Duration("PRESENCE_MAX_TTL", 10*time.Minute),
+		SweepInterval: loader.Duration("PRESENCE_SWEEP_INTERVAL", 5*time.Second),
+		KeepAlive:     loader.Duration("PRESENCE_STREAM_KEEPALIVE", 15*time.Second),
+	}, nil, logger.With("component", "presence"))
+	presenceService.SetEvents(bus)
+
+	// Routes follow cmd/gateway's layout. Services that check permissions
+	// per tenant do so themselves; the rest are guarded here as their own
+	// binaries guard them. Each route serves the API versions its binary
+	// does, whether the prefix comes first (/v2/messaging/...) or after the
+	// service's (/messaging/v2/...).
+	v1 := func(h http.Handler) http.Handler { return apiversion.Mount(h, apiversion.V1) }
+	gw, err := gateway.New([]gateway.Route{
+		{Name: "messaging", Patterns: []string{"/messaging/"}, Strip: "/messaging",
+			Handler: apiversion.Mount(messagingService.Handler(), messaging.APIVersions...)},
+		{Name: "ugc", Patterns: []string{"/ugc/"}, Strip: "/ugc", Handler: v1(ugcService.Handler())},
+		{Name: "orchestration", Patterns: []string{"/orchestration/"}, Strip: "/orchestration", Handler: v1(orchestrationService.Handler())},
+		{Name: "feature-flags", Patterns: []string{"/flags", "/flags/"}, Handler: v1(flagsService.Handler())},
+		{Name: "scheduler", Patterns: []string{"/schedules", "/schedules/"}, Handler: v1(schedulerService.Handler())},
+		{Name: "presence", Patterns: []string{"/presence", "/presence/"}, Handler: v1(presenceService.Handler())},
+		{Name: "webhooks", Patterns: []string{webhooks.Path, webhooks.Path + "/"}, Handler: v1(hooks.Handler())},
+		{Name: "usage", Patterns: []string{metering.Path, metering.Path + "/"}, Handler: v1(meter.Handler())},
+		{Name: "retention", Patterns: []string{retention.Path, retention.Path + "/"}, Handler: v1(retainer.Handler())},
+		{Name: "replication", Patterns: []string{replication.Path, replication.Path + "/"}, Handler: v1(replicator.Handler())},
+		{Name: "encryption", Patterns: []string{encryption.Path, encryption.Path + "/"}, Handler: v1(keyring.Handler())},
+		{Name: "autoscale", Patterns: []string{autoscale.Path, autoscale.Path + "/"}, Handler: v1(scaler.Handler())},
+		{Name: "ugc-worker", Patterns: []string{"/ugc-worker/"}, Strip: "/ugc-worker",
+			Handler: v1(auth.Guard(auth.PermUGCModerate, auth.PermUGCSubmit, workerService.Handler()))},
+		{Name: "notification", Patterns: []string{"/notify", "/notifications/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermNotificationsSend, notifyService.Handler()))},
+		{Name: "notification-templates", Patterns: []string{"/notifications/templates/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermTemplatesManage, notifyService.Handler()))},
+		{Name: "notification-suppressions", Patterns: []string{"/notifications/suppressions", "/notifications/suppressions/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermSuppressionsManage, notifyService.Handler()))},
+		// Recipients' apps mark their own notifications read.
+		{Name: "notification-inbox", Patterns: []string{"/notifications/inbox", "/notifications/inbox/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermNotificationsRead, notifyService.Handler()))},
+		{Name: "logs", Patterns: []string{"/logs", "/logs/"},
+			Handler: v1(auth.Guard(auth.PermLogsRead, auth.PermLogsWrite, logsService.Handler()))},
+		{Name: "metrics", Patterns: []string{"/metrics", "/metrics/", "/v1/metrics"},
+			Handler: apiversion.Mount(auth.Guard(auth.PermMetricsRead, auth.PermMetricsWrite, metricsService.Handler()), apiversion.V1).Passthrough("/v1/metrics")},
+		{Name: "alerts", Patterns: []string{"/alerts", "/alerts/"},
+			Handler: v1(auth.Guard(auth.PermMetricsRead, auth.PermAlertsManage, alerts.Handler()))},
+		{Name: "scrape", Patterns: []string{"/scrape", "/scrape/"},
+			Handler: v1(auth.Guard(auth.PermMetricsRead, auth.PermScrapeManage, scraper.Handler()))},
+		// Every service's entries share the one driver, so a single log
+		// lists them all; ?service= narrows it.
+		{Name: "audit", Patterns: []string{audit.Path}, Handler: auditLog.Handler()},
+	}, nil, logger)
+	if err != nil {
+		logger.Fatalf("build routes: %v", err)
+	}
+
+	limits, err := ratelimit.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load rate limit config: %v", err)
+	}
+	limiter := ratelimit.New(limits)
+	defer limiter.Close()
+	idem := idempotency.New(db, idempotency.FromConfig(loader))
+	idem.SetKeyring(keyring)
+	limiter.RegisterChecks(checks)
+
+	// The metrics collector's /metrics already serves the aggregated series,
+	// so the process's request metrics are appended there.
+	middleware, err := server.MiddlewareFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load middleware config: %v", err)
+	}
+	reloader := server.NewReloader(loader, logger)
+	reloader.Add("rate limits", limiter.Reload)
+	reloader.Add("access lists", acl.Reload)
+	reloader.Add("auth policy", authn.ReloadPolicy)
+	metricsService.Expose(middleware.Metrics)
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(limiter.Middleware(idem.Middleware(gw.Handler()))))
+	mux.Handle(adminchannel.Path, authn.Require(limiter.Middleware(admin.Handler())))
+	// The page carries no data; its script calls the API with credentials.
+	mux.Handle(dashboard.Path, limiter.Middleware(dashboard.Handler()))
+	// Mail clients fetch tracking links without credentials.
+	mux.Handle(notification.TrackPath, limiter.Middleware(notifyService.TrackingHandler()))
+	mux.Handle("/debug/config", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, loader.Handler())))
+	mux.Handle("/debug/loglevel", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, logger.LevelHandler())))
+	mux.Handle("/livez", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: reloader.Standard(logger, middleware, apiversion.Mount(acl.Middleware(mux), apiversion.All...).Passthrough("/v1/metrics")),
+	}
+
+	group.AddHTTP("http server", srv, server.OptionsFromConfig(loader, logger)...)
+	group.Go("config reload", reloader.Run)
+	group.Go("scheduler", schedulerService.Run)
+	group.Go("presence sweep", presenceService.Run)
+	group.Go("webhooks", hooks.Run)
+	group.Go("metering", meter.Run)
+	group.Go("retention", retainer.Run)
+	group.Go("scraper", scraper.Run)
+	group.Go("replication", replicator.Run)
+	group.Go("ugc media", ugcService.RunMedia)
+	group.Go("autoscale", scaler.Run)
+	if triggers != nil {
+		group.Go("triggers", triggers.Run)
+	}
+	group.Go("message expiry", janitor.Run)
+	group.Go("delayed delivery", releaser.Run)
+	if lagAlerts != nil {
+		group.Go("lag alerts", lagAlerts.Run)
+	}
+	if diag != nil {
+		group.AddHTTP("admin server", diag.Server(acl.Require(authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, diag.Handler())))), server.OptionsFromConfig(loader, logger)...)
+		logger.Info("admin listening", "addr", diag.Addr)
+	}
+	group.OnStop("config watcher", watcher.Stop)
+	group.OnStop("alert manager", alerts.Stop)
+	group.OnDrain("worker pool", pool.Stop)
+	group.OnStop("result collector", workerService.Shutdown)
+	group.OnStop("event bus", bus.Stop)
+	group.OnDrain("log pipeline", pipeline.Stop)
+	if persister != nil {
+		group.OnStop("snapshot persister", persister.Stop)
+	}
+	group.OnStop("aggregator", aggregator.Stop)
+	group.OnShutdown("locks", func(context.Context) error { return locker.Close() })
+	group.OnShutdown("storage", func(context.Context) error { return db.Close() })
+
+	logger.Info("listening", "addr", addr)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
+	}
+}
+
+// alertNotifier hands metric alerts straight to the in-process notification
+// service, using the same metric_alert template as
+// metricscollector.NotificationClient.
+type alertNotifier struct {
+	notifications *notification.Service
+	channel       notification.Channel
+	recipient     string
+}
+
+func (n alertNotifier) Notify(ctx context.Context, alert metricscollector.Alert) error {
+	_, err := n.notifications.Send(ctx, notification.Message{
+		Channel:   n.channel,
+		Recipient: n.recipient,
+		Template:  "metric_alert",
+		Data: map[string]any{
+			"Rule":       alert.Rule,
+			"State":      string(alert.State),
+			"Metric":     alert.Metric,
+			"Labels":     alert.Labels,
+			"Value":      alert.Value,
+			"Comparator": string(alert.Comparator),
+			"Threshold":  alert.Threshold,
+		},
+	})
+	return err
+}
+
+// lagNotifier hands consumer lag alerts straight to the in-process
+// notification service, using the same consumer_lag template as
+// messaging.NotificationClient.
+type lagNotifier struct {
+	notifications *notification.Service
+	channel       notification.Channel
+	recipient     string
+}
+
+func (n lagNotifier) Notify(ctx context.Context, alert messaging.LagAlert) error {
+	_, err := n.notifications.Send(ctx, notification.Message{
+		Channel:   n.channel,
+		Recipient: n.recipient,
+		Template:  "consumer_lag",
+		Data:      messaging.LagAlertData(alert),
+	})
+	return err
+}
+
+// schedulePublisher publishes scheduled jobs' messages straight to the
+// in-process messaging service.
+type schedulePublisher struct {
+	messaging *messaging.Service
+}
+
+func (p schedulePublisher) Publish(ctx context.Context, tenantID, projectID string, action scheduler.PublishAction) error {
+	_, err := p.messaging.Publish(ctx, messaging.PublishRequest{
+		TenantID:   tenantID,
+		ProjectID:  projectID,
+		Topic:      action.Topic,
+		Key:        action.Key,
+		Payload:    []byte(action.Payload),
+		Attributes: action.Attributes,
+	})
+	return err
+}
+
+// scheduleNotifier sends scheduled jobs' notifications through the
+// in-process notification service.
+type scheduleNotifier struct {
+	notifications *notification.Service
+}
+
+func (n scheduleNotifier) Notify(ctx context.Context, action scheduler.NotifyAction) error {
+	_, err := n.notifications.Send(ctx, notification.Message{
+		Channel:   notification.Channel(action.Channel),
+		Recipient: action.Recipient,
+		Template:  action.Template,
+		Data:      action.Data,
+	})
+	return err
+}
+
+// triggerSource pulls trigger topics straight from the in-process messaging
+// service.
+type triggerSource struct {
+	messaging *messaging.Service
+}
+
+func (s triggerSource) Pull(ctx context.Context, topic string, limit int) ([]orchestration.TriggerMessage, error) {
+	messages, _, err := s.messaging.Pull(ctx, messaging.PullFilter{Topic: topic}, pagination.Request{Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]orchestration.TriggerMessage, len(messages))
+	for i, m := range messages {
+		out[i] = orchestration.TriggerMessage{
+			MessageID:  m.MessageID,
+			TenantID:   m.TenantID,
+			ProjectID:  m.ProjectID,
+			Topic:      m.Topic,
+			Key:        m.Key,
+			Priority:   string(m.Priority),
+			Attributes: m.Attributes,
+			Payload:    m.Payload,
+		}
+	}
+	return out, nil
+}
+
+func (s triggerSource) Ack(ctx context.Context, topic, messageID string) error {
+	return s.messaging.Ack(ctx, topic, messageID)
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+func runPublish(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("publish", "[flags] <topic>")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID; defaults to the tenant bound to the credentials")
+	key := fs.String("key", "", "message key")
+	priority := fs.String("priority", "", "low, normal, or high")
+	data := fs.String("data", "", "payload text")
+	file := fs.String("file", "", "read the payload from a file, or - for stdin")
+	attrs := pairs{}
+	fs.Var(attrs, "attr", "attribute as key=value (repeatable)")
+	args, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	payload := []byte(*data)
+	if *file != "" {
+		var err error
+		if payload, err = readPayload(*file); err != nil {
+			return err
+		}
+	}
+	msg, err := e.messaging.Publish(ctx, args[0], client.PublishRequest{
+		TenantID:   *tenant,
+		ProjectID:  *project,
+		Key:        *key,
+		Payload:    payload,
+		Priority:   *priority,
+		Attributes: attrs,
+	})
+	if err != nil {
+		return err
+	}
+	return e.print(msg, messageTable([]client.Message{msg}))
+}
+
+func readPayload(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func runPull(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("pull", "[flags] <topic>")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID")
+	limit := fs.Int("limit", 10, "maximum messages to return")
+	ack := fs.Bool("ack", false, "acknowledge each message after printing it")
+	args, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	topic := args[0]
+	messages, err := e.messaging.Pull(ctx, topic, client.PullOptions{TenantID: *tenant, ProjectID: *project, Limit: *limit})
+	if err != nil {
+		return err
+	}
+	if err := e.print(messages, messageTable(messages)); err != nil {
+		return err
+	}
+	if *ack {
+		for _, msg := range messages {
+			if err := e.messaging.Ack(ctx, topic, msg.MessageID); err != nil {
+				return fmt.Errorf("ack %s: %w", msg.MessageID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func runAck(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("ack", "<topic> <message-id>...")
+	args, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		fs.Usage()
+		return errUsage
+	}
+	for _, id := range args[1:] {
+		if err := e.messaging.Ack(ctx, args[0], id); err != nil {
+			return fmt.Errorf("ack %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func messageTable(messages []client.Message) *table {
+	t := &table{header: []string{"ID", "TENANT", "PROJECT", "KEY", "PRIORITY", "PUBLISHED", "PAYLOAD"}}
+	for _, m := range messages {
+		t.add(m.MessageID, m.TenantID, m.ProjectID, m.Key, m.Priority, formatTime(m.PublishedAt), preview(m.Payload))
+	}
+	return t
+}
+
+// preview shortens a payload to fit in a table cell.
+func preview(payload []byte) string {
+	text := strings.Join(strings.Fields(string(payload)), " ")
+	if !printable(text) {
+		return fmt.Sprintf("<%d bytes>", len(payload))
+	}
+	if runes := []rune(text); len(runes) > 48 {
+		return string(runes[:45]) + "..."
+	}
+	return text
+}
+
+func printable(text string) bool {
+	if !utf8.ValidString(text) {
+		return false
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// subcommand dispatches args[0] to one of subs.
+func subcommand(ctx context.Context, e *env, name string, args []string, subs map[string]func(context.Context, *env, []string) error) error {
+	names := make([]string, 0, len(subs))
+	for sub := range subs {
+		names = append(names, sub)
+	}
+	sort.Strings(names)
+	if len(args) == 0 || subs[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: cassctl %s <%s> [flags]\n", name, strings.Join(names, "|"))
+		return errUsage
+	}
+	return subs[args[0]](ctx, e, args[1:])
+}
+
+func runUGC(ctx context.Context, e *env, args []string) error {
+	return subcommand(ctx, e, "ugc", args, map[string]func(context.Context, *env, []string) error{
+		"submit": runUGCSubmit,
+		"list":   runUGCList,
+		"review": runUGCReview,
+	})
+}
+
+func runUGCSubmit(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("ugc submit", "[flags] <content-id> <filename>")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID; defaults to the tenant bound to the credentials")
+	mime := fs.String("mime", "", "MIME type")
+	size := fs.Uint64("size", 0, "size in bytes")
+	labels := pairs{}
+	fs.Var(labels, "label", "label as key=value (repeatable)")
+	args, err := parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	content, err := e.ugc.SubmitContent(ctx, client.SubmitRequest{
+		ContentID: args[0],
+		TenantID:  *tenant,
+		ProjectID: *project,
+		Filename:  args[1],
+		MimeType:  *mime,
+		SizeBytes: *size,
+		Labels:    labels,
+	})
+	if err != nil {
+		return err
+	}
+	return e.print(content, contentTable([]client.Content{content}))
+}
+
+func runUGCList(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("ugc list", "[flags]")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID")
+	state := fs.String("state", "", "pending, approved, rejected, or archived")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	items, err := e.ugc.ListContent(ctx, client.ContentFilter{TenantID: *tenant, ProjectID: *project, State: *state})
+	if err != nil {
+		return err
+	}
+	return e.print(items, contentTable(items))
+}
+
+func runUGCReview(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("ugc review", "[flags] <content-id> <approved|rejected|archived|pending>")
+	reason := fs.String("reason", "", "reason recorded with the decision")
+	args, err := parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	content, err := e.ugc.Review(ctx, args[0], client.ReviewRequest{State: args[1], Reason: *reason})
+	if err != nil {
+		return err
+	}
+	return e.print(content, contentTable([]client.Content{content}))
+}
+
+func contentTable(items []client.Content) *table {
+	t := &table{header: []string{"ID", "TENANT", "PROJECT", "FILENAME", "STATE", "REASON", "UPDATED"}}
+	for _, c := range items {
+		t.add(c.ContentID, c.TenantID, c.ProjectID, c.Filename, c.State, c.Reason, formatTime(c.UpdatedAt))
+	}
+	return t
+}
+
+func runAssignments(ctx context.Context, e *env, args []string) error {
+	return subcommand(ctx, e, "assignments", args, map[string]func(context.Context, *env, []string) error{
+		"create": runAssignmentsCreate,
+		"list":   runAssignmentsList,
+		"update": runAssignmentsUpdate,
+	})
+}
+
+func runAssignmentsCreate(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("assignments create", "[flags] <agent-id> <workload-id>")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID; defaults to the tenant bound to the credentials")
+	metadata := pairs{}
+	fs.Var(metadata, "meta", "metadata as key=value (repeatable)")
+	args, err := parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	assignment, err := e.orchestration.AssignWork(ctx, client.AssignRequest{
+		AgentID:    args[0],
+		WorkloadID: args[1],
+		TenantID:   *tenant,
+		ProjectID:  *project,
+		Metadata:   metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return e.print(assignment, assignmentTable([]client.Assignment{assignment}))
+}
+
+func runAssignmentsList(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("assignments list", "[flags]")
+	agent := fs.String("agent", "", "agent ID")
+	project := fs.String("project", "", "project ID")
+	tenant := fs.String("tenant", "", "tenant ID")
+	status := fs.String("status", "", "assignment status")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	assignments, err := e.orchestration.ListAssignments(ctx, client.AssignmentFilter{AgentID: *agent, TenantID: *tenant, ProjectID: *project, Status: *status})
+	if err != nil {
+		return err
+	}
+	return e.print(assignments, assignmentTable(assignments))
+}
+
+func runAssignmentsUpdate(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("assignments update", "[flags] <assignment-id> <status>")
+	message := fs.String("message", "", "status message")
+	args, err := parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	assignment, err := e.orchestration.UpdateStatus(ctx, args[0], args[1], *message)
+	if err != nil {
+		return err
+	}
+	return e.print(assignment, assignmentTable([]client.Assignment{assignment}))
+}
+
+func assignmentTable(assignments []client.Assignment) *table {
+	t := &table{header: []string{"ID", "AGENT", "WORKLOAD", "TENANT", "PROJECT", "STATUS", "MESSAGE", "UPDATED"}}
+	for _, a := range assignments {
+		t.add(a.AssignmentID, a.AgentID, a.WorkloadID, a.TenantID, a.ProjectID, a.Status, a.StatusMessage, formatTime(a.UpdatedAt))
+	}
+	return t
+}
+
+func runNotify(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("notify", "[flags] <channel> <recipient> <template>")
+	data := pairs{}
+	fs.Var(data, "data", "template data as key=value (repeatable)")
+	args, err := parse(fs, args, 3)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]any, len(data))
+	for k, v := range data {
+		values[k] = v
+	}
+	delivery, err := e.notifications.Notify(ctx, client.Notification{
+		Channel:   args[0],
+		Recipient: args[1],
+		Template:  args[2],
+		Data:      values,
+	})
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"CHANNEL", "RECIPIENT", "SENT", "BODY"}}
+	t.add(delivery.Channel, delivery.Recipient, formatTime(delivery.SentAt), delivery.Body)
+	return e.print(delivery, t)
+}
+
+func runLogs(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("logs", "[flags]")
+	source := fs.String("source", "", "only show events from this source")
+	level := fs.String("level", "", "only show events at this level")
+	lines := fs.Int("n", 20, "number of recent events to show first; 0 shows all")
+	follow := fs.Bool("f", false, "keep polling for new events")
+	interval := fs.Duration("interval", 2*time.Second, "polling interval with -f")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	keep := func(ev client.LogEvent) bool {
+		return (*source == "" || ev.Source == *source) && (*level == "" || strings.EqualFold(ev.Level, *level))
+	}
+
+	var tail logTail
+	events, err := e.logs.Recent(ctx)
+	if err != nil {
+		return err
+	}
+	fresh := tail.next(events, keep)
+	if *lines > 0 && len(fresh) > *lines {
+		fresh = fresh[len(fresh)-*lines:]
+	}
+	e.printLogs(fresh)
+	if !*follow {
+		return nil
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		events, err := e.logs.Recent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			fmt.Fprintf(os.Stderr, "cassctl logs: %v\n", err)
+			continue
+		}
+		e.printLogs(tail.next(events, keep))
+	}
+}
+
+// logTail remembers which events of the pipeline's recent buffer have been
+// printed. The buffer is chronological, so an event is new when it is later
+// than the last one printed, or at the same instant but not yet seen.
+type logTail struct {
+	last time.Time
+	seen map[string]bool
+}
+
+func (t *logTail) next(events []client.LogEvent, keep func(client.LogEvent) bool) []client.LogEvent {
+	var fresh []client.LogEvent
+	for _, ev := range events {
+		key := ev.Source + "\x00" + ev.Level + "\x00" + ev.Message
+		switch {
+		case ev.Timestamp.Before(t.last):
+			continue
+		case ev.Timestamp.After(t.last):
+			t.last = ev.Timestamp
+			t.seen = map[string]bool{}
+		case t.seen[key]:
+			continue
+		}
+		t.seen[key] = true
+		if keep(ev) {
+			fresh = append(fresh, ev)
+		}
+	}
+	return fresh
+}
+
+// printLogs writes one line per event, or one JSON object per line.
+func (e *env) printLogs(events []client.LogEvent) {
+	for _, ev := range events {
+		if e.json {
+			_ = json.NewEncoder(e.out).Encode(ev)
+			continue
+		}
+		keys := make([]string, 0, len(ev.Fields))
+		for k := range ev.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var fields strings.Builder
+		for _, k := range keys {
+			fmt.Fprintf(&fields, " %s=%s", k, strconv.Quote(ev.Fields[k]))
+		}
+		fmt.Fprintf(e.out, "%s %-5s %s: %s%s\n", ev.Timestamp.Local().Format(time.RFC3339), ev.Level, ev.Source, ev.Message, fields.String())
+	}
+}
+
+func runMetrics(ctx context.Context, e *env, args []string) error {
+	return subcommand(ctx, e, "metrics", args, map[string]func(context.Context, *env, []string) error{
+		"query":   runMetricsQuery,
+		"summary": runMetricsSummary,
+	})
+}
+
+func runMetricsQuery(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("metrics query", "[flags] [namespace.name]")
+	var match list
+	fs.Var(&match, "match", "label matcher such as route=~/v1/.* (repeatable)")
+	agg := fs.String("agg", "", "sum or avg to aggregate matching series")
+	by := fs.String("by", "", "comma-separated labels to keep when aggregating")
+	args, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		fs.Usage()
+		return errUsage
+	}
+	q := client.MetricQuery{Match: match, Aggregate: *agg}
+	if *by != "" {
+		q.By = strings.Split(*by, ",")
+	}
+	if len(args) == 1 {
+		metric := args[0]
+		ns, name, ok := strings.Cut(metric, ".")
+		if !ok {
+			return fmt.Errorf("metric %q must be namespace.name", metric)
+		}
+		q.Namespace, q.Name = ns, name
+	}
+	results, err := e.metrics.Query(ctx, q)
+	if err != nil {
+		return err
+	}
+	t := &table{header: []string{"SERIES", "COUNT", "SUM", "MEAN", "MIN", "MAX", "LAST", "VALUE"}}
+	for _, r := range results {
+		value := "-"
+		if r.Series > 0 {
+			value = formatFloat(r.Value)
+		}
+		t.add(seriesName(r.Namespace, r.Name, r.Labels), r.Summary.Count, formatFloat(r.Summary.Sum), formatFloat(r.Summary.Mean),
+			formatFloat(r.Summary.Min), formatFloat(r.Summary.Max), formatFloat(r.Summary.LastValue), value)
+	}
+	return e.print(results, t)
+}
+
+func runMetricsSummary(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("metrics summary", "")
+	if _, err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	summaries, err := e.metrics.Summaries(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(summaries))
+	for k := range summaries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	t := &table{header: []string{"SERIES", "TYPE", "COUNT", "SUM", "MEAN", "LAST", "UPDATED"}}
+	for _, k := range keys {
+		s := summaries[k]
+		t.add(k, s.Type, s.Count, formatFloat(s.Sum), formatFloat(s.Mean), formatFloat(s.LastValue), formatTime(s.Last))
+	}
+	return e.print(summaries, t)
+}
+
+func seriesName(namespace, name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+labels[k])
+	}
+	base := strings.Trim(namespace+"."+name, ".")
+	return base + "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
@@ -0,0 +1,290 @@
+// Command cassctl drives the peripheral service APIs from the command line:
+// publishing and pulling messages, moderating UGC, managing assignments,
+// sending notifications, tailing logs, querying metrics, and replaying
+// captured requests against another deployment.
+//
+//	cassctl [global flags] <command> [subcommand] [flags] [args]
+//
+// Requests go to the gateway at -endpoint unless a per-service URL is set.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+// options lists the global settings; each is also accepted as a flag before
+// the command name, or from a -config file.
+var options = []config.Option{
+	{Key: "ENDPOINT", Usage: "gateway base URL"},
+	{Key: "MESSAGING_URL", Usage: "messaging service base URL, bypassing the gateway"},
+	{Key: "UGC_URL", Usage: "UGC service base URL, bypassing the gateway"},
+	{Key: "ORCHESTRATION_URL", Usage: "orchestrator base URL, bypassing the gateway"},
+	{Key: "NOTIFY_URL", Usage: "notification service base URL, bypassing the gateway"},
+	{Key: "LOGS_URL", Usage: "log pipeline base URL, bypassing the gateway"},
+	{Key: "METRICS_URL", Usage: "metrics collector base URL, bypassing the gateway"},
+	{Key: "API_KEY", Usage: "API key sent in X-API-Key"},
+	{Key: "TOKEN", Usage: "JWT sent as a bearer token"},
+	{Key: "TENANT", Usage: "tenant sent in X-Tenant-ID"},
+	{Key: "PROJECT", Usage: "project sent in X-Project-ID"},
+	{Key: "OUTPUT", Usage: "output format: table or json"},
+	{Key: "TIMEOUT", Usage: "time allowed for each request attempt"},
+	{Key: "RETRIES", Usage: "retries for transient failures"},
+}
+
+// command is one top-level cassctl command.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{"publish", "publish a message to a topic", runPublish},
+	{"pull", "pull pending messages from a topic", runPull},
+	{"ack", "acknowledge a message", runAck},
+	{"ugc", "submit, list, and review UGC (submit|list|review)", runUGC},
+	{"assignments", "create, list, and update assignments (create|list|update)", runAssignments},
+	{"notify", "send a notification", runNotify},
+	{"logs", "print recent logs, optionally following new ones", runLogs},
+	{"metrics", "query metrics (query|summary)", runMetrics},
+	{"replay", "re-send captured requests to another deployment", runReplay},
+}
+
+// errUsage reports a command line mistake; the command has already printed
+// its usage.
+var errUsage = errors.New("usage")
+
+func main() {
+	fs := flag.NewFlagSet("cassctl", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	loader, err := config.ParseArgs("CASSCTL", options, fs, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cassctl: %v\n", err)
+		os.Exit(2)
+	}
+	args := fs.Args()
+	if len(args) == 0 {
+		usage(fs)
+		os.Exit(2)
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "cassctl: unknown command %q\n", args[0])
+		usage(fs)
+		os.Exit(2)
+	}
+
+	e, err := newEnv(loader, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cassctl: %v\n", err)
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := cmd.run(ctx, e, args[1:]); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "cassctl %s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func usage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprintln(out, "usage: cassctl [global flags] <command> [flags] [args]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nglobal flags:")
+	fs.PrintDefaults()
+}
+
+// env carries the clients and output settings shared by every command.
+type env struct {
+	messaging     *client.Messaging
+	ugc           *client.UGC
+	orchestration *client.Orchestration
+	notifications *client.Notifications
+	logs          *client.Logs
+	metrics       *client.Metrics
+	// credentials and timeout are used by replay, which sends recorded
+	// requests itself rather than through a client.
+	credentials http.Header
+	timeout     time.Duration
+	out         io.Writer
+	json        bool
+}
+
+func newEnv(loader config.Loader, out io.Writer) (*env, error) {
+	format := strings.ToLower(loader.String("OUTPUT", "table"))
+	if format != "table" && format != "json" {
+		return nil, fmt.Errorf("output must be table or json, not %q", format)
+	}
+	apiKey, token := loader.Secret("API_KEY", ""), loader.Secret("TOKEN", "")
+	timeout := loader.Duration("TIMEOUT", client.DefaultTimeout)
+	opts := []client.Option{
+		client.WithAPIKey(apiKey),
+		client.WithBearerToken(token),
+		client.WithTenant(loader.String("TENANT", "")),
+		client.WithProject(loader.String("PROJECT", "")),
+		client.WithTimeout(timeout),
+		client.WithRetries(loader.Int("RETRIES", client.DefaultMaxRetries), client.DefaultBackoff),
+		client.WithUserAgent("cassctl"),
+	}
+	gw, err := client.NewGateway(loader.String("ENDPOINT", "http://localhost:8080"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	e := &env{
+		messaging:     gw.Messaging,
+		ugc:           gw.UGC,
+		orchestration: gw.Orchestration,
+		notifications: gw.Notifications,
+		logs:          gw.Logs,
+		metrics:       gw.Metrics,
+		credentials:   make(http.Header),
+		timeout:       timeout,
+		out:           out,
+		json:          format == "json",
+	}
+	if apiKey != "" {
+		e.credentials.Set("X-API-Key", apiKey)
+	}
+	if token != "" {
+		e.credentials.Set("Authorization", "Bearer "+token)
+	}
+	// Per-service URLs talk to the service directly.
+	direct := []struct {
+		key string
+		set func(string) error
+	}{
+		{"MESSAGING_URL", func(u string) (err error) { e.messaging, err = client.NewMessaging(u, opts...); return }},
+		{"UGC_URL", func(u string) (err error) { e.ugc, err = client.NewUGC(u, opts...); return }},
+		{"ORCHESTRATION_URL", func(u string) (err error) { e.orchestration, err = client.NewOrchestration(u, opts...); return }},
+		{"NOTIFY_URL", func(u string) (err error) { e.notifications, err = client.NewNotifications(u, opts...); return }},
+		{"LOGS_URL", func(u string) (err error) { e.logs, err = client.NewLogs(u, opts...); return }},
+		{"METRICS_URL", func(u string) (err error) { e.metrics, err = client.NewMetrics(u, opts...); return }},
+	}
+	for _, d := range direct {
+		if u := loader.String(d.key, ""); u != "" {
+			if err := d.set(u); err != nil {
+				return nil, fmt.Errorf("%s: %w", d.key, err)
+			}
+		}
+	}
+	return e, nil
+}
+
+// newFlags returns a flag set for a command whose usage line is synopsis.
+func newFlags(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet("cassctl "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: cassctl %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args into fs and returns the positional arguments, requiring
+// exactly n of them. Unlike flag.FlagSet.Parse, flags may also follow
+// positional arguments.
+func parse(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	positional, err := parseInterleaved(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != n {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// parseInterleaved parses every flag in args and returns the remaining
+// positional arguments in order. Arguments after "--" are all positional.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// pairs collects repeated key=value flags.
+type pairs map[string]string
+
+func (p pairs) String() string {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+p[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p pairs) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	p[key] = val
+	return nil
+}
+
+// list collects a repeated string flag.
+type list []string
+
+func (l *list) String() string { return strings.Join(*l, ",") }
+
+func (l *list) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/capture"
+)
+
+// replayOutcome counts the replayed requests that share a method, path,
+// recorded status, and result.
+type replayOutcome struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Recorded int    `json:"recorded_status"`
+	Replayed int    `json:"replayed_status,omitempty"`
+	// Result is matched, mismatched, failed (no response), or skipped (the
+	// body was not captured).
+	Result string `json:"result"`
+	Count  int    `json:"count"`
+}
+
+type replaySummary struct {
+	Sent       int             `json:"sent"`
+	Matched    int             `json:"matched"`
+	Mismatched int             `json:"mismatched"`
+	Failed     int             `json:"failed"`
+	Skipped    int             `json:"skipped"`
+	Outcomes   []replayOutcome `json:"outcomes"`
+}
+
+func runReplay(ctx context.Context, e *env, args []string) error {
+	fs := newFlags("replay", "-target <url> [flags] <capture file>...")
+	target := fs.String("target", "", "base URL of the deployment to replay against (required)")
+	rate := fs.Float64("rate", 10, "requests started per second")
+	concurrency := fs.Int("concurrency", 4, "requests in flight at once")
+	method := fs.String("method", "", "only replay requests with this method")
+	prefix := fs.String("path", "", "only replay requests whose path starts with this prefix")
+	limit := fs.Int("n", 0, "replay at most this many requests; 0 replays all")
+	files, err := parseInterleaved(fs, args)
+	if err != nil {
+		return err
+	}
+	if *target == "" || len(files) == 0 {
+		fs.Usage()
+		return errUsage
+	}
+	base, err := url.Parse(*target)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return fmt.Errorf("target %q must be an absolute URL", *target)
+	}
+
+	records := &captureFiles{names: files}
+	defer records.close()
+	keep := func(rec capture.Record) bool {
+		path, _, _ := strings.Cut(rec.URI, "?")
+		return (*method == "" || strings.EqualFold(rec.Method, *method)) && strings.HasPrefix(path, *prefix)
+	}
+	read := 0
+	next := func() (capture.Record, error) {
+		for *limit <= 0 || read < *limit {
+			rec, err := records.next()
+			if err != nil {
+				return capture.Record{}, err
+			}
+			if keep(rec) {
+				read++
+				return rec, nil
+			}
+		}
+		return capture.Record{}, io.EOF
+	}
+
+	summary := replaySummary{Outcomes: []replayOutcome{}}
+	counts := make(map[replayOutcome]int)
+	cfg := capture.ReplayConfig{
+		Target:      base,
+		Rate:        *rate,
+		Concurrency: *concurrency,
+		Header:      e.credentials,
+		Client:      &http.Client{Timeout: e.timeout},
+	}
+	err = capture.Replay(ctx, cfg, next, func(res capture.Result) {
+		path, _, _ := strings.Cut(res.Record.URI, "?")
+		o := replayOutcome{Method: res.Record.Method, Path: path, Recorded: res.Record.Status, Replayed: res.Status}
+		switch {
+		case errors.Is(res.Err, capture.ErrIncomplete):
+			o.Result = "skipped"
+			summary.Skipped++
+		case res.Err != nil:
+			o.Result = "failed"
+			summary.Sent++
+			summary.Failed++
+			fmt.Fprintf(os.Stderr, "cassctl replay: %s %s: %v\n", res.Record.Method, res.Record.URI, res.Err)
+		case res.Matched():
+			o.Result = "matched"
+			summary.Sent++
+			summary.Matched++
+		default:
+			o.Result = "mismatched"
+			summary.Sent++
+			summary.Mismatched++
+		}
+		counts[o]++
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	for o, n := range counts {
+		o.Count = n
+		summary.Outcomes = append(summary.Outcomes, o)
+	}
+	sort.Slice(summary.Outcomes, func(i, j int) bool {
+		a, b := summary.Outcomes[i], summary.Outcomes[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		if a.Recorded != b.Recorded {
+			return a.Recorded < b.Recorded
+		}
+		return a.Replayed < b.Replayed
+	})
+	t := &table{header: []string{"METHOD", "PATH", "RECORDED", "REPLAYED", "RESULT", "COUNT"}}
+	for _, o := range summary.Outcomes {
+		replayed := "-"
+		if o.Replayed != 0 {
+			replayed = fmt.Sprint(o.Replayed)
+		}
+		t.add(o.Method, o.Path, o.Recorded, replayed, o.Result, o.Count)
+	}
+	if err := e.print(summary, t); err != nil {
+		return err
+	}
+	if summary.Mismatched+summary.Failed > 0 {
+		return fmt.Errorf("%d of %d requests were not answered as recorded", summary.Mismatched+summary.Failed, summary.Sent)
+	}
+	return nil
+}
+
+// captureFiles reads the records of several capture files in turn; "-"
+// reads standard input.
+type captureFiles struct {
+	names  []string
+	name   string
+	file   io.ReadCloser
+	reader *capture.Reader
+}
+
+func (c *captureFiles) next() (capture.Record, error) {
+	for {
+		if c.reader == nil {
+			if len(c.names) == 0 {
+				return capture.Record{}, io.EOF
+			}
+			c.name, c.names = c.names[0], c.names[1:]
+			if c.name == "-" {
+				c.file = io.NopCloser(os.Stdin)
+			} else {
+				f, err := os.Open(c.name)
+				if err != nil {
+					return capture.Record{}, err
+				}
+				c.file = f
+			}
+			c.reader = capture.NewReader(c.file)
+		}
+		rec, err := c.reader.Next()
+		if errors.Is(err, io.EOF) {
+			c.close()
+			continue
+		}
+		if err != nil {
+			return capture.Record{}, fmt.Errorf("%s: %w", c.name, err)
+		}
+		return rec, nil
+	}
+}
+
+func (c *captureFiles) close() {
+	if c.file != nil {
+		c.file.Close()
+	}
+	c.file, c.reader = nil, nil
+}
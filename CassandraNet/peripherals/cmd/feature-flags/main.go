@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/admin"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/featureflags"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/netacl"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ratelimit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/registry"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "HTTP_ADDR", Usage: "listen address, host:port or unix:///path/to.sock"},
+	{Key: "ADMIN_ADDR", Usage: "listen address for pprof, expvar, and /debug/state; empty disables the admin listener"},
+	{Key: "STORAGE_URL", Usage: "storage driver URL: memory://, file:///path/to/data.db, postgres://..., or redis://..."},
+	{Key: "LOG_SHIP_URL", Usage: "log pipeline base URL to forward this service's logs to"},
+	{Key: "LOG_SHIP_BUFFER", Usage: "records buffered for log shipping before dropping"},
+	{Key: "REGISTRY_URL", Usage: "service registry base URL to register this instance with; empty disables registration"},
+	{Key: "ADVERTISE_URL", Usage: "base URL other services reach this instance at; defaults to the host name and listen port"},
+	{Key: "REGISTRY_TTL", Usage: "how long a registration lasts without a heartbeat"},
+	{Key: "TLS_CERT_FILE", Usage: "PEM certificate to serve HTTPS with"},
+	{Key: "TLS_KEY_FILE", Usage: "PEM private key for the TLS certificate"},
+	{Key: "TLS_RELOAD_INTERVAL", Usage: "how often to check the certificate files for changes"},
+	{Key: "TLS_CLIENT_CA_FILE", Usage: "PEM CAs that client certificates must chain to; enables mutual TLS"},
+	{Key: "TLS_CLIENT_CERT_OPTIONAL", Usage: "accept clients without a certificate when mutual TLS is enabled"},
+	{Key: "TLS_ALLOWED_CLIENT_IDS", Usage: "client certificate identities (SPIFFE ID, DNS name, or common name) allowed to connect"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for other services' certificates"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to other services"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in other services' certificates"},
+	{Key: "H2C", Usage: "also accept HTTP/2 over cleartext connections"},
+	{Key: "REQUEST_TIMEOUT", Usage: "maximum time to handle a request"},
+	{Key: "MAX_BODY_BYTES", Usage: "maximum request body size in bytes"},
+	{Key: "MAX_BODY_ROUTES", Usage: "per-route body limits, each \"[METHOD ]/prefix=bytes\"; 0 lifts the limit on the route"},
+	{Key: "ACCESS_LOG_SAMPLE", Usage: "fraction of requests written to the access log, above 0 and at most 1"},
+	{Key: "ACCESS_LOG_SAMPLE_ROUTES", Usage: "per-route access log sampling, each \"[METHOD ]/prefix=rate\"; server errors are always logged"},
+	{Key: "CAPTURE_DIR", Usage: "directory sampled requests are recorded in for replay; empty disables capture"},
+	{Key: "CAPTURE_ROUTES", Usage: "requests to capture, each \"[METHOD ]/prefix=rate\""},
+	{Key: "CAPTURE_MAX_BODY_BYTES", Usage: "longest request body recorded; longer bodies are left out"},
+	{Key: "CAPTURE_MAX_FILE_BYTES", Usage: "size at which a new capture file is started"},
+	{Key: "CAPTURE_MAX_FILES", Usage: "capture files kept before the oldest is removed"},
+	{Key: "CAPTURE_REDACT_FIELDS", Usage: "comma-separated JSON fields and query parameters replaced in captures"},
+	{Key: "CAPTURE_REDACT_HEADERS", Usage: "comma-separated headers left out of captures besides credentials"},
+	{Key: "RATE_LIMIT", Usage: "requests per second allowed per caller; 0 disables"},
+	{Key: "RATE_BURST", Usage: "requests a caller may burst above the rate"},
+	{Key: "RATE_LIMIT_ROUTES", Usage: "per-route limits, each \"[METHOD ]/prefix=rate[:burst]\"; a rate of 0 exempts the route"},
+	{Key: "RATE_LIMIT_KEY", Usage: "what callers are limited by: subject, tenant, or ip"},
+	{Key: "RATE_LIMIT_REDIS_URL", Usage: "redis:// URL sharing limits between replicas; empty keeps them in memory"},
+	{Key: "IDEMPOTENCY_TTL", Usage: "how long responses to POSTs with an Idempotency-Key are replayed to retries; 0 disables"},
+	{Key: "IDEMPOTENCY_MAX_BODY_BYTES", Usage: "largest response body kept for replay"},
+	{Key: "ACL_ALLOW", Usage: "networks (CIDRs or addresses) allowed to reach administrative endpoints; empty allows all"},
+	{Key: "ACL_DENY", Usage: "networks refused at administrative endpoints even when allowed"},
+	{Key: "ACL_PATHS", Usage: "path prefixes the access lists guard"},
+	{Key: "TRUSTED_PROXIES", Usage: "networks of proxies whose X-Forwarded-For names the client"},
+	{Key: "CORS_ALLOWED_ORIGINS", Usage: "origins allowed to call the service from a browser, or *"},
+	{Key: "CORS_ALLOWED_METHODS", Usage: "methods allowed in cross-origin requests"},
+	{Key: "CORS_ALLOWED_HEADERS", Usage: "request headers allowed in cross-origin requests; empty allows those requested"},
+	{Key: "CORS_ALLOW_CREDENTIALS", Usage: "let browsers send cookies and credentials cross-origin"},
+	{Key: "CORS_MAX_AGE", Usage: "how long browsers may cache preflight responses"},
+	{Key: "AUTH_API_KEYS", Usage: "comma-separated API keys accepted, each \"key\" or \"tenant:key\""},
+	{Key: "AUTH_JWT_SECRET", Usage: "HMAC secret for HS256/384/512 bearer tokens"},
+	{Key: "AUTH_JWT_PUBLIC_KEY_FILE", Usage: "PEM public keys or certificates for RS*/ES* bearer tokens"},
+	{Key: "AUTH_JWT_ISSUER", Usage: "required iss claim of bearer tokens"},
+	{Key: "AUTH_JWT_AUDIENCE", Usage: "required aud claim of bearer tokens"},
+	{Key: "AUTH_JWT_TENANT_CLAIM", Usage: "bearer token claim holding the tenant ID"},
+	{Key: "AUTH_JWT_PROJECT_CLAIM", Usage: "bearer token claim holding the project ID"},
+	{Key: "AUTH_JWT_LEEWAY", Usage: "clock skew tolerated when checking token expiry"},
+	{Key: "AUTH_POLICY_FILE", Usage: "JSON role bindings enforced per route"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent on calls to other services"},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := logging.New("feature-flags")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("FEATURE_FLAGS", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	clientKey := loader.Secret("AUTH_CLIENT_API_KEY", "")
+	if shipURL, err := loader.URL("LOG_SHIP_URL", ""); err != nil {
+		logger.Fatalf("load config: %v", err)
+	} else if shipURL != nil {
+		defer logger.Ship(shipURL.String(), loader.Int("LOG_SHIP_BUFFER", 1024), auth.Transport(clientKey, clientTLS)).Stop()
+	}
+	addr := loader.String("HTTP_ADDR", ":8096")
+	diag := admin.FromConfig(loader)
+	acl, err := netacl.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load acl config: %v", err)
+	}
+	authn, err := auth.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load auth config: %v", err)
+	}
+	if !authn.Enabled() {
+		logger.Warn("authentication disabled; set AUTH_API_KEYS, AUTH_JWT_*, or TLS_CLIENT_CA_FILE to require credentials")
+	}
+
+	db, err := storage.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load storage config: %v", err)
+	}
+	store := featureflags.NewStorageStore(db)
+	svc := featureflags.NewService(store, nil)
+	auditLog := audit.New(db, "feature-flags", logger)
+	svc.SetAudit(auditLog)
+
+	limits, err := ratelimit.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load rate limit config: %v", err)
+	}
+	limiter := ratelimit.New(limits)
+	defer limiter.Close()
+	idem := idempotency.New(db, idempotency.FromConfig(loader))
+
+	checks := health.NewRegistry()
+	limiter.RegisterChecks(checks)
+	checks.Readiness("storage", db.Check)
+
+	registrar, err := registry.RegistrarFromConfig(loader, "feature-flags", addr, auth.Transport(clientKey, clientTLS), checks, logger)
+	if err != nil {
+		logger.Fatalf("load registry config: %v", err)
+	}
+
+	middleware, err := server.MiddlewareFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load middleware config: %v", err)
+	}
+	reloader := server.NewReloader(loader, logger)
+	reloader.Add("rate limits", limiter.Reload)
+	reloader.Add("access lists", acl.Reload)
+	reloader.Add("auth policy", authn.ReloadPolicy)
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(limiter.Middleware(idem.Middleware(svc.Handler()))))
+	mux.Handle(audit.Path, authn.Require(limiter.Middleware(auditLog.Handler())))
+	mux.Handle("/debug/config", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, loader.Handler())))
+	mux.Handle("/debug/loglevel", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, logger.LevelHandler())))
+	mux.Handle("/metrics", authn.Require(auth.Guard(auth.PermMetricsRead, auth.PermMetricsRead, middleware.Metrics)))
+	mux.Handle("/livez", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: reloader.Standard(logger, middleware, apiversion.Mount(acl.Middleware(mux), apiversion.V1)),
+	}
+
+	group := server.NewRunGroup(5*time.Second, logger)
+	group.AddHTTP("http server", srv, server.OptionsFromConfig(loader, logger)...)
+	group.Go("config reload", reloader.Run)
+	if diag != nil {
+		group.AddHTTP("admin server", diag.Server(acl.Require(authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, diag.Handler())))), server.OptionsFromConfig(loader, logger)...)
+		logger.Info("admin listening", "addr", diag.Addr)
+	}
+	if registrar != nil {
+		group.Go("registry heartbeat", registrar.Run)
+	}
+	group.OnShutdown("storage", func(context.Context) error { return db.Close() })
+
+	logger.Info("listening", "addr", addr)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logagent"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "PIPELINE_URL", Usage: "log pipeline base URL to ship to"},
+	{Key: "FILES", Usage: "comma-separated files to tail; rotated and truncated files are followed"},
+	{Key: "JOURNALD", Usage: "also ship the systemd journal, read through journalctl"},
+	{Key: "SOURCE", Usage: "source recorded on shipped events; defaults to the host name"},
+	{Key: "FROM_START", Usage: "read files without a saved offset from the beginning instead of the end"},
+	{Key: "BATCH_SIZE", Usage: "most events sent in one request, at most 1000"},
+	{Key: "FLUSH_INTERVAL", Usage: "longest a line waits for its batch to fill"},
+	{Key: "POLL_INTERVAL", Usage: "how often files are checked for new lines"},
+	{Key: "BUFFER_DIR", Usage: "directory unsent batches and read offsets are kept in; empty keeps them in memory"},
+	{Key: "BUFFER_MAX_BYTES", Usage: "most bytes of unsent batches kept before the oldest are dropped"},
+	{Key: "MAX_BACKOFF", Usage: "longest wait between attempts to send a batch"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for the pipeline's certificate"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to the pipeline"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in the pipeline's certificate"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent to the pipeline"},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := logging.New("log-agent")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("LOG_AGENT", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	pipelineURL, err := loader.URL("PIPELINE_URL", "")
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	if pipelineURL == nil {
+		logger.Fatalf("load config: LOG_AGENT_PIPELINE_URL is required")
+	}
+	cfg, err := logagent.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load agent config: %v", err)
+	}
+
+	// The agent retries with its own backoff, keeping batches spooled
+	// meanwhile, so the client does not retry.
+	logs, err := client.NewLogs(pipelineURL.String(),
+		client.WithHTTPClient(&http.Client{Transport: clientTLS}),
+		client.WithAPIKey(loader.Secret("AUTH_CLIENT_API_KEY", "")),
+		client.WithUserAgent("cassandra-log-agent"),
+		client.WithRetries(0, 0),
+	)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	agent, err := logagent.New(cfg, logs, logger)
+	if err != nil {
+		logger.Fatalf("start agent: %v", err)
+	}
+
+	group := server.NewRunGroup(5*time.Second, logger)
+	group.Go("log agent", agent.Run)
+
+	logger.Info("shipping", "pipeline", pipelineURL.String(), "files", len(cfg.Files), "journald", cfg.Journald)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
+	}
+	stats := agent.Stats()
+	logger.Info("stopped", "shipped", stats.Shipped, "dropped", stats.Dropped, "spooled", stats.Spooled)
+}
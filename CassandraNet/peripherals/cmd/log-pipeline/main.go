@@ -2,43 +2,280 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/admin"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/autoscale"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logpipeline"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/netacl"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ratelimit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/registry"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
 )
 
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "HTTP_ADDR", Usage: "listen address, host:port or unix:///path/to.sock"},
+	{Key: "ADMIN_ADDR", Usage: "listen address for pprof, expvar, and /debug/state; empty disables the admin listener"},
+	{Key: "STORAGE_URL", Usage: "storage driver URL for usage totals: memory://, file:///path/to/data.db, postgres://..., or redis://..."},
+	{Key: "QUEUE_SIZE", Usage: "event queue capacity"},
+	{Key: "AUTOSCALE_MIN_QUEUE_SIZE", Usage: "smallest event queue capacity the autoscaler leaves"},
+	{Key: "AUTOSCALE_MAX_QUEUE_SIZE", Usage: "largest event queue capacity the autoscaler grows to; 0 disables autoscaling"},
+	{Key: "AUTOSCALE_INTERVAL", Usage: "how often queue depth is sampled for autoscaling"},
+	{Key: "AUTOSCALE_WINDOW", Usage: "samples averaged before the autoscaler decides"},
+	{Key: "AUTOSCALE_SCALE_UP_AT", Usage: "average queue utilization, 0 to 1, at which the queue grows"},
+	{Key: "AUTOSCALE_SCALE_DOWN_AT", Usage: "average queue utilization, 0 to 1, at which the queue shrinks"},
+	{Key: "AUTOSCALE_COOLDOWN", Usage: "how long the autoscaler waits after a change"},
+	{Key: "AUTOSCALE_HISTORY", Usage: "autoscaling decisions kept for /autoscale/decisions"},
+	{Key: "MIN_LEVEL", Usage: "minimum severity to process"},
+	{Key: "RECENT_CAPACITY", Usage: "size of the recent log buffer"},
+	{Key: "FIELD_TYPES", Usage: "typed fields parsed and validated at ingest, each \"source:field=type\" with a type of string, number, boolean, or timestamp"},
+	{Key: "CONFIG_POLL_INTERVAL", Usage: "config reload poll interval"},
+	{Key: "REGISTRY_URL", Usage: "service registry base URL to register this instance with; empty disables registration"},
+	{Key: "ADVERTISE_URL", Usage: "base URL other services reach this instance at; defaults to the host name and listen port"},
+	{Key: "REGISTRY_TTL", Usage: "how long a registration lasts without a heartbeat"},
+	{Key: "EVENTS_URL", Usage: "messaging service base URL to exchange events with other services through; empty keeps events in process"},
+	{Key: "EVENTS_TENANT", Usage: "tenant recorded on bridged events that carry none"},
+	{Key: "EVENTS_PROJECT", Usage: "project recorded on bridged events that carry none"},
+	{Key: "METERING_FLUSH_INTERVAL", Usage: "how often recorded usage is added to the stored daily totals"},
+	{Key: "METERING_QUOTAS", Usage: "usage quotas reported at /usage/quotas, each \"[tenant:]meter=limit[/day|/month]\""},
+	{Key: "TLS_CERT_FILE", Usage: "PEM certificate to serve HTTPS with"},
+	{Key: "TLS_KEY_FILE", Usage: "PEM private key for the TLS certificate"},
+	{Key: "TLS_RELOAD_INTERVAL", Usage: "how often to check the certificate files for changes"},
+	{Key: "TLS_CLIENT_CA_FILE", Usage: "PEM CAs that client certificates must chain to; enables mutual TLS"},
+	{Key: "TLS_CLIENT_CERT_OPTIONAL", Usage: "accept clients without a certificate when mutual TLS is enabled"},
+	{Key: "TLS_ALLOWED_CLIENT_IDS", Usage: "client certificate identities (SPIFFE ID, DNS name, or common name) allowed to connect"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for other services' certificates"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to other services"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in other services' certificates"},
+	{Key: "H2C", Usage: "also accept HTTP/2 over cleartext connections"},
+	{Key: "REQUEST_TIMEOUT", Usage: "maximum time to handle a request"},
+	{Key: "MAX_BODY_BYTES", Usage: "maximum request body size in bytes"},
+	{Key: "MAX_BODY_ROUTES", Usage: "per-route body limits, each \"[METHOD ]/prefix=bytes\"; 0 lifts the limit on the route"},
+	{Key: "ACCESS_LOG_SAMPLE", Usage: "fraction of requests written to the access log, above 0 and at most 1"},
+	{Key: "ACCESS_LOG_SAMPLE_ROUTES", Usage: "per-route access log sampling, each \"[METHOD ]/prefix=rate\"; server errors are always logged"},
+	{Key: "CAPTURE_DIR", Usage: "directory sampled requests are recorded in for replay; empty disables capture"},
+	{Key: "CAPTURE_ROUTES", Usage: "requests to capture, each \"[METHOD ]/prefix=rate\""},
+	{Key: "CAPTURE_MAX_BODY_BYTES", Usage: "longest request body recorded; longer bodies are left out"},
+	{Key: "CAPTURE_MAX_FILE_BYTES", Usage: "size at which a new capture file is started"},
+	{Key: "CAPTURE_MAX_FILES", Usage: "capture files kept before the oldest is removed"},
+	{Key: "CAPTURE_REDACT_FIELDS", Usage: "comma-separated JSON fields and query parameters replaced in captures"},
+	{Key: "CAPTURE_REDACT_HEADERS", Usage: "comma-separated headers left out of captures besides credentials"},
+	{Key: "RATE_LIMIT", Usage: "requests per second allowed per caller; 0 disables"},
+	{Key: "RATE_BURST", Usage: "requests a caller may burst above the rate"},
+	{Key: "RATE_LIMIT_ROUTES", Usage: "per-route limits, each \"[METHOD ]/prefix=rate[:burst]\"; a rate of 0 exempts the route"},
+	{Key: "RATE_LIMIT_KEY", Usage: "what callers are limited by: subject, tenant, or ip"},
+	{Key: "RATE_LIMIT_REDIS_URL", Usage: "redis:// URL sharing limits between replicas; empty keeps them in memory"},
+	{Key: "IDEMPOTENCY_TTL", Usage: "how long responses to POSTs with an Idempotency-Key are replayed to retries; 0 disables"},
+	{Key: "IDEMPOTENCY_MAX_BODY_BYTES", Usage: "largest response body kept for replay"},
+	{Key: "ACL_ALLOW", Usage: "networks (CIDRs or addresses) allowed to reach administrative endpoints; empty allows all"},
+	{Key: "ACL_DENY", Usage: "networks refused at administrative endpoints even when allowed"},
+	{Key: "ACL_PATHS", Usage: "path prefixes the access lists guard"},
+	{Key: "TRUSTED_PROXIES", Usage: "networks of proxies whose X-Forwarded-For names the client"},
+	{Key: "CORS_ALLOWED_ORIGINS", Usage: "origins allowed to call the service from a browser, or *"},
+	{Key: "CORS_ALLOWED_METHODS", Usage: "methods allowed in cross-origin requests"},
+	{Key: "CORS_ALLOWED_HEADERS", Usage: "request headers allowed in cross-origin requests; empty allows those requested"},
+	{Key: "CORS_ALLOW_CREDENTIALS", Usage: "let browsers send cookies and credentials cross-origin"},
+	{Key: "CORS_MAX_AGE", Usage: "how long browsers may cache preflight responses"},
+	{Key: "AUTH_API_KEYS", Usage: "comma-separated API keys accepted, each \"key\" or \"tenant:key\""},
+	{Key: "AUTH_JWT_SECRET", Usage: "HMAC secret for HS256/384/512 bearer tokens"},
+	{Key: "AUTH_JWT_PUBLIC_KEY_FILE", Usage: "PEM public keys or certificates for RS*/ES* bearer tokens"},
+	{Key: "AUTH_JWT_ISSUER", Usage: "required iss claim of bearer tokens"},
+	{Key: "AUTH_JWT_AUDIENCE", Usage: "required aud claim of bearer tokens"},
+	{Key: "AUTH_JWT_TENANT_CLAIM", Usage: "bearer token claim holding the tenant ID"},
+	{Key: "AUTH_JWT_PROJECT_CLAIM", Usage: "bearer token claim holding the project ID"},
+	{Key: "AUTH_JWT_LEEWAY", Usage: "clock skew tolerated when checking token expiry"},
+	{Key: "AUTH_POLICY_FILE", Usage: "JSON role bindings enforced per route"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent on calls to other services"},
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	loader := config.NewLoader("LOG_PIPELINE")
+	logger := logging.New("log-pipeline")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("LOG_PIPELINE", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	clientKey := loader.Secret("AUTH_CLIENT_API_KEY", "")
 	addr := loader.String("HTTP_ADDR", ":8082")
+	diag := admin.FromConfig(loader)
+	acl, err := netacl.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load acl config: %v", err)
+	}
+	authn, err := auth.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load auth config: %v", err)
+	}
+	if !authn.Enabled() {
+		logger.Warn("authentication disabled; set AUTH_API_KEYS, AUTH_JWT_*, or TLS_CLIENT_CA_FILE to require credentials")
+	}
 	buffer := loader.Int("QUEUE_SIZE", 256)
 	minLevel := logpipeline.ParseLevel(loader.String("MIN_LEVEL", "INFO"))
 	recentCapacity := loader.Int("RECENT_CAPACITY", 200)
 
-	logger := logging.New("log-pipeline")
 	pipeline := logpipeline.NewPipeline(buffer, minLevel, logger)
 	ring := logpipeline.NewRingBufferSink(recentCapacity)
 	pipeline.RegisterSink(ring)
+	tail := logpipeline.NewTailSink()
+	pipeline.RegisterSink(tail)
 	pipeline.RegisterSink(logpipeline.NewStdoutSink(logger))
 	pipeline.Start()
-	defer pipeline.Stop()
 
+	watcher := config.NewWatcher(loader, loader.Duration("CONFIG_POLL_INTERVAL", 5*time.Second), logger)
+	watcher.Subscribe(func(l config.Loader) {
+		level := logpipeline.ParseLevel(l.String("MIN_LEVEL", "INFO"))
+		pipeline.SetMinLevel(level)
+		logger.Printf("minimum level set to %s", level)
+	}, "MIN_LEVEL")
+	watcher.Start()
+
+	bus := eventbus.New(0, logger)
+	bus.Start()
+	bridge, err := eventbus.BridgeFromConfig(loader, bus, nil, auth.Transport(clientKey, clientTLS), logger)
+	if err != nil {
+		logger.Fatalf("load events config: %v", err)
+	}
+
+	var scaler *autoscale.Controller
+	if maxQueue := loader.Int("AUTOSCALE_MAX_QUEUE_SIZE", 0); maxQueue > 0 {
+		scaleConfig, err := autoscale.FromConfig(loader)
+		if err != nil {
+			logger.Fatalf("load autoscale config: %v", err)
+		}
+		scaler = autoscale.New(scaleConfig, "log-pipeline", bus, logger)
+		err = scaler.Add(autoscale.Target{
+			Name:     "queue",
+			Resource: autoscale.ResourceBuffer,
+			Min:      loader.Int("AUTOSCALE_MIN_QUEUE_SIZE", buffer),
+			Max:      maxQueue,
+			Depth: func() (int, int) {
+				stats := pipeline.Stats()
+				return stats.Queued, stats.Capacity
+			},
+			Size:   func() int { return pipeline.Stats().Capacity },
+			Resize: pipeline.Resize,
+		})
+		if err != nil {
+			logger.Fatalf("load autoscale config: %v", err)
+		}
+	}
+
+	db, err := storage.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load storage config: %v", err)
+	}
+	meterConfig, err := metering.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load metering config: %v", err)
+	}
+	meter := metering.New(db, meterConfig, logger)
+	schema, err := logpipeline.ParseSchema(loader.StringSlice("FIELD_TYPES", nil))
+	if err != nil {
+		logger.Fatalf("load field types: %sFIELD_TYPES: %v", loader.Prefix, err)
+	}
 	svc := logpipeline.NewService(pipeline, ring, logger)
+	svc.SetTail(tail)
+	svc.SetMeter(meter)
+	svc.SetSchema(schema)
+	limits, err := ratelimit.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load rate limit config: %v", err)
+	}
+	limiter := ratelimit.New(limits)
+	defer limiter.Close()
+	idem := idempotency.New(nil, idempotency.FromConfig(loader))
+
+	checks := health.NewRegistry()
+	limiter.RegisterChecks(checks)
+	checks.Readiness("pipeline", pipeline.Check)
+	checks.Readiness("storage", db.Check)
+	diag.State("pipeline", func() any { return pipeline.Stats() })
+	checks.Optional("event bus", bus.Check)
+	diag.State("event bus", func() any { return bus.Stats() })
+	if scaler != nil {
+		diag.State("autoscale", func() any { return scaler.Targets() })
+	}
+
+	registrar, err := registry.RegistrarFromConfig(loader, "log-pipeline", addr, auth.Transport(clientKey, clientTLS), checks, logger)
+	if err != nil {
+		logger.Fatalf("load registry config: %v", err)
+	}
+
+	middleware, err := server.MiddlewareFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load middleware config: %v", err)
+	}
+	reloader := server.NewReloader(loader, logger)
+	reloader.Add("rate limits", limiter.Reload)
+	reloader.Add("access lists", acl.Reload)
+	reloader.Add("auth policy", authn.ReloadPolicy)
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermLogsRead, auth.PermLogsWrite, svc.Handler())))))
+	mux.Handle(metering.Path, authn.Require(limiter.Middleware(meter.Handler())))
+	mux.Handle(metering.Path+"/", authn.Require(limiter.Middleware(meter.Handler())))
+	mux.Handle("/debug/config", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, loader.Handler())))
+	mux.Handle("/debug/loglevel", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, logger.LevelHandler())))
+	mux.Handle("/metrics", authn.Require(auth.Guard(auth.PermMetricsRead, auth.PermMetricsRead, middleware.Metrics)))
+	if scaler != nil {
+		mux.Handle(autoscale.Path, authn.Require(limiter.Middleware(scaler.Handler())))
+		mux.Handle(autoscale.Path+"/", authn.Require(limiter.Middleware(scaler.Handler())))
+	}
+	mux.Handle("/livez", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: svc.Handler(),
+		Handler: reloader.Standard(logger, middleware, apiversion.Mount(acl.Middleware(mux), apiversion.V1)),
+	}
+
+	group := server.NewRunGroup(5*time.Second, logger)
+	group.AddHTTP("http server", srv, server.OptionsFromConfig(loader, logger)...)
+	group.Go("config reload", reloader.Run)
+	group.Go("metering", meter.Run)
+	if diag != nil {
+		group.AddHTTP("admin server", diag.Server(acl.Require(authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, diag.Handler())))), server.OptionsFromConfig(loader, logger)...)
+		logger.Info("admin listening", "addr", diag.Addr)
+	}
+	if registrar != nil {
+		group.Go("registry heartbeat", registrar.Run)
+	}
+	if bridge != nil {
+		group.Go("event bridge", bridge.Run)
+	}
+	if scaler != nil {
+		group.Go("autoscale", scaler.Run)
 	}
+	group.OnStop("config watcher", watcher.Stop)
+	group.OnDrain("pipeline", pipeline.Stop)
+	group.OnStop("event bus", bus.Stop)
+	group.OnShutdown("storage", func(context.Context) error { return db.Close() })
 
-	logger.Printf("listening on %s", addr)
-	if err := server.Run(ctx, srv, 5*time.Second); err != nil {
-		logger.Printf("server shutdown: %v", err)
+	logger.Info("listening", "addr", addr)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
 	}
 }
@@ -2,35 +2,399 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
+	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/admin"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metricscollector"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/netacl"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ratelimit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/registry"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
 )
 
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "HTTP_ADDR", Usage: "listen address, host:port or unix:///path/to.sock"},
+	{Key: "ADMIN_ADDR", Usage: "listen address for pprof, expvar, and /debug/state; empty disables the admin listener"},
+	{Key: "STORAGE_URL", Usage: "storage driver URL for the audit log: memory://, file:///path/to/data.db, postgres://..., or redis://..."},
+	{Key: "LOCK_URL", Usage: "lock URL letting one replica at a time run retention purges: memory://, postgres://..., or redis://...; defaults to STORAGE_URL"},
+	{Key: "SERIES_IDLE_TTL", Usage: "idle time before a series is evicted"},
+	{Key: "SERIES_SWEEP_INTERVAL", Usage: "interval between idle-series sweeps"},
+	{Key: "MAX_SERIES", Usage: "maximum total series"},
+	{Key: "MAX_SERIES_PER_METRIC", Usage: "maximum series per metric"},
+	{Key: "SERIES_OVERFLOW", Usage: "overflow policy: reject or aggregate"},
+	{Key: "HISTOGRAM_BUCKETS", Usage: "comma-separated histogram bucket bounds"},
+	{Key: "WINDOW_SIZE", Usage: "rolling window size"},
+	{Key: "WINDOW_COUNT", Usage: "rolling windows kept per series"},
+	{Key: "SNAPSHOT_PATH", Usage: "aggregator snapshot file"},
+	{Key: "SNAPSHOT_INTERVAL", Usage: "interval between snapshots"},
+	{Key: "GRAPHITE_ADDR", Usage: "Graphite plaintext listen address"},
+	{Key: "GRAPHITE_MAPPINGS_FILE", Usage: "Graphite path mappings file"},
+	{Key: "ALERT_RULES_FILE", Usage: "alert rules file"},
+	{Key: "ALERT_EVAL_INTERVAL", Usage: "alert evaluation interval"},
+	{Key: "ALERT_NOTIFY_URL", Usage: "notification service base URL"},
+	{Key: "ALERT_CHANNEL", Usage: "notification channel for alerts"},
+	{Key: "ALERT_RECIPIENT", Usage: "notification recipient for alerts"},
+	{Key: "SCRAPE_TARGETS", Usage: "comma-separated Prometheus endpoints to scrape, each \"name=url\""},
+	{Key: "SCRAPE_INTERVAL", Usage: "how often each scrape target is scraped"},
+	{Key: "SCRAPE_TIMEOUT", Usage: "longest a scrape may take"},
+	{Key: "SCRAPE_SAMPLE_LIMIT", Usage: "most samples accepted from one scrape"},
+	{Key: "PEER_URL", Usage: "base URL of the metrics collector paired with this one for high availability; empty runs unpaired"},
+	{Key: "PEER_NAME", Usage: "name identifying this collector to its peer; defaults to the host name"},
+	{Key: "PEER_INTERVAL", Usage: "how often state is sent to the peer"},
+	{Key: "PEER_DOWN_AFTER", Usage: "time without an exchange after which the peer is reported down and this collector takes over"},
+	{Key: "LOG_SHIP_URL", Usage: "log pipeline base URL to forward this service's logs to"},
+	{Key: "LOG_SHIP_BUFFER", Usage: "records buffered for log shipping before dropping"},
+	{Key: "REGISTRY_URL", Usage: "service registry base URL to register this instance with; empty disables registration"},
+	{Key: "ADVERTISE_URL", Usage: "base URL other services reach this instance at; defaults to the host name and listen port"},
+	{Key: "REGISTRY_TTL", Usage: "how long a registration lasts without a heartbeat"},
+	{Key: "RETENTION_INTERVAL", Usage: "how often retention policies purge expired records"},
+	{Key: "RETENTION_MAX_AGES", Usage: "per-policy maximum ages, each \"policy=duration\"; 0 disables a policy"},
+	{Key: "RETENTION_DRY_RUN", Usage: "comma-separated policies that only count what they would purge, or * for all"},
+	{Key: "RETENTION_HISTORY", Usage: "retention reports kept per policy"},
+	{Key: "TLS_CERT_FILE", Usage: "PEM certificate to serve HTTPS with"},
+	{Key: "TLS_KEY_FILE", Usage: "PEM private key for the TLS certificate"},
+	{Key: "TLS_RELOAD_INTERVAL", Usage: "how often to check the certificate files for changes"},
+	{Key: "TLS_CLIENT_CA_FILE", Usage: "PEM CAs that client certificates must chain to; enables mutual TLS"},
+	{Key: "TLS_CLIENT_CERT_OPTIONAL", Usage: "accept clients without a certificate when mutual TLS is enabled"},
+	{Key: "TLS_ALLOWED_CLIENT_IDS", Usage: "client certificate identities (SPIFFE ID, DNS name, or common name) allowed to connect"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for other services' certificates"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to other services"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in other services' certificates"},
+	{Key: "H2C", Usage: "also accept HTTP/2 over cleartext connections"},
+	{Key: "REQUEST_TIMEOUT", Usage: "maximum time to handle a request"},
+	{Key: "MAX_BODY_BYTES", Usage: "maximum request body size in bytes"},
+	{Key: "MAX_BODY_ROUTES", Usage: "per-route body limits, each \"[METHOD ]/prefix=bytes\"; 0 lifts the limit on the route"},
+	{Key: "ACCESS_LOG_SAMPLE", Usage: "fraction of requests written to the access log, above 0 and at most 1"},
+	{Key: "ACCESS_LOG_SAMPLE_ROUTES", Usage: "per-route access log sampling, each \"[METHOD ]/prefix=rate\"; server errors are always logged"},
+	{Key: "CAPTURE_DIR", Usage: "directory sampled requests are recorded in for replay; empty disables capture"},
+	{Key: "CAPTURE_ROUTES", Usage: "requests to capture, each \"[METHOD ]/prefix=rate\""},
+	{Key: "CAPTURE_MAX_BODY_BYTES", Usage: "longest request body recorded; longer bodies are left out"},
+	{Key: "CAPTURE_MAX_FILE_BYTES", Usage: "size at which a new capture file is started"},
+	{Key: "CAPTURE_MAX_FILES", Usage: "capture files kept before the oldest is removed"},
+	{Key: "CAPTURE_REDACT_FIELDS", Usage: "comma-separated JSON fields and query parameters replaced in captures"},
+	{Key: "CAPTURE_REDACT_HEADERS", Usage: "comma-separated headers left out of captures besides credentials"},
+	{Key: "RATE_LIMIT", Usage: "requests per second allowed per caller; 0 disables"},
+	{Key: "RATE_BURST", Usage: "requests a caller may burst above the rate"},
+	{Key: "RATE_LIMIT_ROUTES", Usage: "per-route limits, each \"[METHOD ]/prefix=rate[:burst]\"; a rate of 0 exempts the route"},
+	{Key: "RATE_LIMIT_KEY", Usage: "what callers are limited by: subject, tenant, or ip"},
+	{Key: "RATE_LIMIT_REDIS_URL", Usage: "redis:// URL sharing limits between replicas; empty keeps them in memory"},
+	{Key: "IDEMPOTENCY_TTL", Usage: "how long responses to POSTs with an Idempotency-Key are replayed to retries; 0 disables"},
+	{Key: "IDEMPOTENCY_MAX_BODY_BYTES", Usage: "largest response body kept for replay"},
+	{Key: "ACL_ALLOW", Usage: "networks (CIDRs or addresses) allowed to reach administrative endpoints; empty allows all"},
+	{Key: "ACL_DENY", Usage: "networks refused at administrative endpoints even when allowed"},
+	{Key: "ACL_PATHS", Usage: "path prefixes the access lists guard"},
+	{Key: "TRUSTED_PROXIES", Usage: "networks of proxies whose X-Forwarded-For names the client"},
+	{Key: "CORS_ALLOWED_ORIGINS", Usage: "origins allowed to call the service from a browser, or *"},
+	{Key: "CORS_ALLOWED_METHODS", Usage: "methods allowed in cross-origin requests"},
+	{Key: "CORS_ALLOWED_HEADERS", Usage: "request headers allowed in cross-origin requests; empty allows those requested"},
+	{Key: "CORS_ALLOW_CREDENTIALS", Usage: "let browsers send cookies and credentials cross-origin"},
+	{Key: "CORS_MAX_AGE", Usage: "how long browsers may cache preflight responses"},
+	{Key: "AUTH_API_KEYS", Usage: "comma-separated API keys accepted, each \"key\" or \"tenant:key\""},
+	{Key: "AUTH_JWT_SECRET", Usage: "HMAC secret for HS256/384/512 bearer tokens"},
+	{Key: "AUTH_JWT_PUBLIC_KEY_FILE", Usage: "PEM public keys or certificates for RS*/ES* bearer tokens"},
+	{Key: "AUTH_JWT_ISSUER", Usage: "required iss claim of bearer tokens"},
+	{Key: "AUTH_JWT_AUDIENCE", Usage: "required aud claim of bearer tokens"},
+	{Key: "AUTH_JWT_TENANT_CLAIM", Usage: "bearer token claim holding the tenant ID"},
+	{Key: "AUTH_JWT_PROJECT_CLAIM", Usage: "bearer token claim holding the project ID"},
+	{Key: "AUTH_JWT_LEEWAY", Usage: "clock skew tolerated when checking token expiry"},
+	{Key: "AUTH_POLICY_FILE", Usage: "JSON role bindings enforced per route"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent on calls to other services"},
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	loader := config.NewLoader("METRICS")
+	logger := logging.New("metrics-collector")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("METRICS", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	clientKey := loader.Secret("AUTH_CLIENT_API_KEY", "")
+	if shipURL, err := loader.URL("LOG_SHIP_URL", ""); err != nil {
+		logger.Fatalf("load config: %v", err)
+	} else if shipURL != nil {
+		defer logger.Ship(shipURL.String(), loader.Int("LOG_SHIP_BUFFER", 1024), auth.Transport(clientKey, clientTLS)).Stop()
+	}
 	addr := loader.String("HTTP_ADDR", ":8081")
+	diag := admin.FromConfig(loader)
+	acl, err := netacl.FromConfig(loader, "/alerts", "/scrape", metricscollector.PeerPath)
+	if err != nil {
+		logger.Fatalf("load acl config: %v", err)
+	}
+	authn, err := auth.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load auth config: %v", err)
+	}
+	if !authn.Enabled() {
+		logger.Warn("authentication disabled; set AUTH_API_KEYS, AUTH_JWT_*, or TLS_CLIENT_CA_FILE to require credentials")
+	}
+	idleTTL := loader.Duration("SERIES_IDLE_TTL", 0)
+	sweepInterval := loader.Duration("SERIES_SWEEP_INTERVAL", 0)
+	maxSeries := loader.Int("MAX_SERIES", 0)
+	maxSeriesPerMetric := loader.Int("MAX_SERIES_PER_METRIC", 0)
+	overflowPolicy := loader.String("SERIES_OVERFLOW", "reject")
+	buckets := parseBuckets(loader.String("HISTOGRAM_BUCKETS", ""))
+	windowSize := loader.Duration("WINDOW_SIZE", time.Minute)
+	windowCount := loader.Int("WINDOW_COUNT", 60)
+	snapshotPath := loader.String("SNAPSHOT_PATH", "")
+	snapshotInterval := loader.Duration("SNAPSHOT_INTERVAL", 30*time.Second)
+	graphiteAddr := loader.String("GRAPHITE_ADDR", "")
+	graphiteMappings := loader.String("GRAPHITE_MAPPINGS_FILE", "")
+	alertRulesFile := loader.String("ALERT_RULES_FILE", "")
+	alertInterval := loader.Duration("ALERT_EVAL_INTERVAL", 15*time.Second)
+	alertNotifyURL, err := loader.URL("ALERT_NOTIFY_URL", "")
+	if err != nil {
+		logger.Fatalf("invalid config: %v", err)
+	}
+	alertChannel := loader.String("ALERT_CHANNEL", "webhook")
+	alertRecipient := loader.String("ALERT_RECIPIENT", "ops")
+	var scrapeTargets []metricscollector.ScrapeTarget
+	for _, spec := range loader.StringSlice("SCRAPE_TARGETS", nil) {
+		target, err := metricscollector.ParseScrapeTarget(spec)
+		if err != nil {
+			logger.Fatalf("invalid config: %v", err)
+		}
+		scrapeTargets = append(scrapeTargets, target)
+	}
 
-	logger := logging.New("metrics-collector")
-	aggregator := metricscollector.NewAggregator()
+	overflow, err := metricscollector.ParseOverflowPolicy(overflowPolicy)
+	if err != nil {
+		logger.Printf("invalid METRICS_SERIES_OVERFLOW %q, using reject", overflowPolicy)
+		overflow = metricscollector.OverflowReject
+	}
+	aggregator := metricscollector.NewAggregatorWithConfig(metricscollector.AggregatorConfig{
+		IdleTTL:            idleTTL,
+		SweepInterval:      sweepInterval,
+		MaxSeries:          maxSeries,
+		MaxSeriesPerMetric: maxSeriesPerMetric,
+		Overflow:           overflow,
+		HistogramBuckets:   buckets,
+		WindowSize:         windowSize,
+		WindowCount:        windowCount,
+	})
+	aggregator.Start()
+
+	var persister *metricscollector.Persister
+	if snapshotPath != "" {
+		persister = metricscollector.NewPersister(aggregator, metricscollector.NewFileSnapshotStore(snapshotPath), snapshotInterval, logger)
+		restored, err := persister.Restore(ctx)
+		if err != nil {
+			logger.Printf("restore metrics snapshot: %v", err)
+		} else {
+			logger.Printf("restored %d series from %s", restored, snapshotPath)
+		}
+		persister.Start()
+	}
 	svc := metricscollector.NewService(aggregator, logger)
 
+	db, err := storage.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load storage config: %v", err)
+	}
+	locker, err := lock.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load lock config: %v", err)
+	}
+	auditLog := audit.New(db, "metrics-collector", logger)
+	retentionConfig, err := retention.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load retention config: %v", err)
+	}
+	retainer := retention.New(retentionConfig, logger)
+	retainer.SetLocker(locker)
+	aggregator.RegisterRetention(retainer)
+	auditLog.RegisterRetention(retainer)
+
+	limits, err := ratelimit.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load rate limit config: %v", err)
+	}
+	limiter := ratelimit.New(limits)
+	defer limiter.Close()
+	idem := idempotency.New(db, idempotency.FromConfig(loader))
+
+	checks := health.NewRegistry()
+	limiter.RegisterChecks(checks)
+	checks.Readiness("storage", db.Check)
+
+	var notifier metricscollector.AlertNotifier
+	if alertNotifyURL != nil {
+		client, err := metricscollector.NewNotificationClient(alertNotifyURL.String(), alertChannel, alertRecipient, auth.Transport(clientKey, clientTLS))
+		if err != nil {
+			logger.Fatalf("invalid config: %v", err)
+		}
+		checks.Optional("notification service", client.Check)
+		notifier = client
+	}
+	alerts := metricscollector.NewAlertManager(aggregator, notifier, alertInterval, logger)
+	alerts.SetAudit(auditLog)
+	admin := adminchannel.New(adminchannel.Config{}, logger)
+	alerts.SetAdminChannel(admin)
+	if alertRulesFile != "" {
+		if err := alerts.LoadRulesFile(alertRulesFile); err != nil {
+			logger.Printf("load alert rules: %v", err)
+		}
+	}
+	alerts.Start()
+
+	scraper := metricscollector.NewScraper(aggregator, metricscollector.ScrapeConfig{
+		Interval:    loader.Duration("SCRAPE_INTERVAL", 15*time.Second),
+		Timeout:     loader.Duration("SCRAPE_TIMEOUT", 10*time.Second),
+		SampleLimit: loader.Int("SCRAPE_SAMPLE_LIMIT", 10000),
+	}, logger)
+	scraper.SetTransport(auth.Transport(clientKey, clientTLS))
+	scraper.SetAudit(auditLog)
+	for _, target := range scrapeTargets {
+		if err := scraper.PutTarget(target); err != nil {
+			logger.Fatalf("invalid config: %v", err)
+		}
+	}
+
+	peerURL, err := loader.URL("PEER_URL", "")
+	if err != nil {
+		logger.Fatalf("invalid config: %v", err)
+	}
+	var pairing *metricscollector.Pairing
+	if peerURL != nil {
+		hostname, _ := os.Hostname()
+		peerName := loader.String("PEER_NAME", hostname)
+		if peerName == "" {
+			logger.Fatalf("invalid config: METRICS_PEER_NAME is required with METRICS_PEER_URL")
+		}
+		pairing = metricscollector.NewPairing(aggregator, scraper, metricscollector.PeerConfig{
+			Name:      peerName,
+			URL:       peerURL.String(),
+			Interval:  loader.Duration("PEER_INTERVAL", 5*time.Second),
+			DownAfter: loader.Duration("PEER_DOWN_AFTER", 0),
+		}, logger)
+		pairing.SetTransport(auth.Transport(clientKey, clientTLS))
+		scraper.SetActive(pairing.Active)
+		alerts.SetActive(pairing.Active)
+		checks.Optional("peer", pairing.Check)
+	}
+
+	// The collector's own /metrics already serves the aggregated series, so
+	// its request metrics are appended there.
+	registrar, err := registry.RegistrarFromConfig(loader, "metrics-collector", addr, auth.Transport(clientKey, clientTLS), checks, logger)
+	if err != nil {
+		logger.Fatalf("load registry config: %v", err)
+	}
+
+	middleware, err := server.MiddlewareFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load middleware config: %v", err)
+	}
+	reloader := server.NewReloader(loader, logger)
+	reloader.Add("rate limits", limiter.Reload)
+	reloader.Add("access lists", acl.Reload)
+	reloader.Add("auth policy", authn.ReloadPolicy)
+	svc.Expose(middleware.Metrics)
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermMetricsRead, auth.PermMetricsWrite, svc.Handler())))))
+	mux.Handle("/alerts", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermMetricsRead, auth.PermAlertsManage, alerts.Handler())))))
+	mux.Handle("/alerts/", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermMetricsRead, auth.PermAlertsManage, alerts.Handler())))))
+	mux.Handle("/scrape", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermMetricsRead, auth.PermScrapeManage, scraper.Handler())))))
+	mux.Handle("/scrape/", authn.Require(limiter.Middleware(idem.Middleware(auth.Guard(auth.PermMetricsRead, auth.PermScrapeManage, scraper.Handler())))))
+	if pairing != nil {
+		mux.Handle(metricscollector.PeerPath, authn.Require(limiter.Middleware(auth.Guard(auth.PermReplicationRead, auth.PermReplicationWrite, pairing.Handler()))))
+		mux.Handle(metricscollector.PeerPath+"/", authn.Require(limiter.Middleware(auth.Guard(auth.PermReplicationRead, auth.PermReplicationWrite, pairing.Handler()))))
+	}
+	mux.Handle(audit.Path, authn.Require(limiter.Middleware(auditLog.Handler())))
+	mux.Handle(retention.Path, authn.Require(limiter.Middleware(retainer.Handler())))
+	mux.Handle(retention.Path+"/", authn.Require(limiter.Middleware(retainer.Handler())))
+	mux.Handle(adminchannel.Path, authn.Require(limiter.Middleware(admin.Handler())))
+	mux.Handle("/debug/config", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, loader.Handler())))
+	mux.Handle("/debug/loglevel", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, logger.LevelHandler())))
+	mux.Handle("/livez", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
+
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: svc.Handler(),
+		Handler: reloader.Standard(logger, middleware, apiversion.Mount(acl.Middleware(mux), apiversion.V1).Passthrough("/v1/metrics")),
 	}
 
-	logger.Printf("listening on %s", addr)
-	if err := server.Run(ctx, srv, 5*time.Second); err != nil {
-		logger.Printf("server shutdown: %v", err)
+	group := server.NewRunGroup(5*time.Second, logger)
+	group.AddHTTP("http server", srv, server.OptionsFromConfig(loader, logger)...)
+	group.Go("config reload", reloader.Run)
+	group.Go("retention", retainer.Run)
+	group.Go("scraper", scraper.Run)
+	if pairing != nil {
+		group.Go("peer exchange", pairing.Run)
+	}
+	if diag != nil {
+		group.AddHTTP("admin server", diag.Server(acl.Require(authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, diag.Handler())))), server.OptionsFromConfig(loader, logger)...)
+		logger.Info("admin listening", "addr", diag.Addr)
+	}
+	if registrar != nil {
+		group.Go("registry heartbeat", registrar.Run)
+	}
+	if graphiteAddr != "" {
+		var mapper *metricscollector.GraphiteMapper
+		if graphiteMappings != "" {
+			mapper, err = metricscollector.LoadGraphiteMappings(graphiteMappings)
+			if err != nil {
+				logger.Printf("load graphite mappings: %v", err)
+			}
+		}
+		graphite := metricscollector.NewGraphiteListener(aggregator, mapper, logger)
+		group.Go("graphite listener", func(ctx context.Context) error {
+			logger.Printf("graphite listener on %s", graphiteAddr)
+			return graphite.ListenAndServe(ctx, graphiteAddr)
+		})
+	}
+	group.OnStop("alert manager", alerts.Stop)
+	if persister != nil {
+		group.OnStop("snapshot persister", persister.Stop)
+	}
+	group.OnStop("aggregator", aggregator.Stop)
+	group.OnShutdown("locks", func(context.Context) error { return locker.Close() })
+	group.OnShutdown("storage", func(context.Context) error { return db.Close() })
+
+	logger.Info("listening", "addr", addr)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
+	}
+}
+
+func parseBuckets(raw string) []float64 {
+	if raw == "" {
+		return nil
+	}
+	parts := strings.Split(raw, ",")
+	out := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		if bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64); err == nil {
+			out = append(out, bound)
+		}
 	}
+	return out
 }
@@ -2,35 +2,303 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"net/http"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/admin"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/httpclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/netacl"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ratelimit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/registry"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
 	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugc"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/webhooks"
 )
 
+// options lists the settings this binary reads; each is also accepted as a
+// command-line flag.
+var options = []config.Option{
+	{Key: "HTTP_ADDR", Usage: "listen address, host:port or unix:///path/to.sock"},
+	{Key: "ADMIN_ADDR", Usage: "listen address for pprof, expvar, and /debug/state; empty disables the admin listener"},
+	{Key: "STORAGE_URL", Usage: "storage driver URL: memory://, file:///path/to/data.db, postgres://..., or redis://..."},
+	{Key: "LOCK_URL", Usage: "lock URL letting one replica at a time run retention purges: memory://, postgres://..., or redis://...; defaults to STORAGE_URL"},
+	{Key: "LOG_SHIP_URL", Usage: "log pipeline base URL to forward this service's logs to"},
+	{Key: "LOG_SHIP_BUFFER", Usage: "records buffered for log shipping before dropping"},
+	{Key: "REGISTRY_URL", Usage: "service registry base URL to register this instance with; empty disables registration"},
+	{Key: "ADVERTISE_URL", Usage: "base URL other services reach this instance at; defaults to the host name and listen port"},
+	{Key: "REGISTRY_TTL", Usage: "how long a registration lasts without a heartbeat"},
+	{Key: "EVENTS_URL", Usage: "messaging service base URL to exchange events with other services through; empty keeps events in process"},
+	{Key: "EVENTS_TENANT", Usage: "tenant recorded on bridged events that carry none"},
+	{Key: "EVENTS_PROJECT", Usage: "project recorded on bridged events that carry none"},
+	{Key: "MEDIA_WORKERS", Usage: "uploads processed at once for MIME sniffing, image dimensions, and thumbnails"},
+	{Key: "MEDIA_QUEUE", Usage: "uploads waiting for a processor before the rest wait for the next sweep"},
+	{Key: "MEDIA_MAX_BYTES", Usage: "largest upload accepted at /content/{id}/data"},
+	{Key: "MEDIA_THUMBNAIL_SIZE", Usage: "longest side of generated thumbnails, in pixels"},
+	{Key: "MEDIA_SWEEP_INTERVAL", Usage: "how often uploads still awaiting processing are queued again"},
+	{Key: "WEBHOOK_TIMEOUT", Usage: "maximum time a webhook delivery attempt may take"},
+	{Key: "WEBHOOK_MAX_ATTEMPTS", Usage: "attempts before a webhook delivery fails and waits for a redrive"},
+	{Key: "WEBHOOK_MAX_BACKOFF", Usage: "longest wait between webhook delivery attempts"},
+	{Key: "WEBHOOK_HISTORY", Usage: "finished webhook deliveries kept per subscription"},
+	{Key: "WEBHOOK_ALLOWED_HOSTS", Usage: "host names webhook URLs may use, \".example.com\" allowing subdomains; empty allows any"},
+	{Key: "METERING_FLUSH_INTERVAL", Usage: "how often recorded usage is added to the stored daily totals"},
+	{Key: "METERING_QUOTAS", Usage: "usage quotas reported at /usage/quotas, each \"[tenant:]meter=limit[/day|/month]\""},
+	{Key: "RETENTION_INTERVAL", Usage: "how often retention policies purge expired records"},
+	{Key: "RETENTION_MAX_AGES", Usage: "per-policy maximum ages, each \"policy=duration\"; 0 disables a policy"},
+	{Key: "RETENTION_DRY_RUN", Usage: "comma-separated policies that only count what they would purge, or * for all"},
+	{Key: "RETENTION_HISTORY", Usage: "retention reports kept per policy"},
+	{Key: "REPLICATION_REGION", Usage: "name of this deployment's region; empty disables replication"},
+	{Key: "REPLICATION_PEER_URL", Usage: "base URL of the same service in the peer region; empty only applies the peer's changes"},
+	{Key: "REPLICATION_INTERVAL", Usage: "how often recorded changes are sent to the peer region"},
+	{Key: "REPLICATION_MAX_BACKOFF", Usage: "longest wait between failed sends to the peer region"},
+	{Key: "REPLICATION_BATCH_SIZE", Usage: "most changes sent to the peer region per request"},
+	{Key: "REPLICATION_TIMEOUT", Usage: "maximum time a send to the peer region may take"},
+	{Key: "ENCRYPTION_KEY_FILE", Usage: "file of key-encryption keys, one \"id=base64\" line each, sealing payloads and PII at rest"},
+	{Key: "ENCRYPTION_ACTIVE_KEY", Usage: "ID of the key file's key that wraps new data keys; defaults to the last"},
+	{Key: "ENCRYPTION_VAULT_URL", Usage: "Vault address whose transit engine wraps data keys, instead of a key file"},
+	{Key: "ENCRYPTION_VAULT_TOKEN", Usage: "Vault token allowed to encrypt and decrypt with the transit key"},
+	{Key: "ENCRYPTION_VAULT_MOUNT", Usage: "path the Vault transit engine is mounted at"},
+	{Key: "ENCRYPTION_VAULT_KEY", Usage: "name of the Vault transit key"},
+	{Key: "ENCRYPTION_DATA_KEY_LIFETIME", Usage: "how long one data key seals values before a new one is made"},
+	{Key: "TLS_CERT_FILE", Usage: "PEM certificate to serve HTTPS with"},
+	{Key: "TLS_KEY_FILE", Usage: "PEM private key for the TLS certificate"},
+	{Key: "TLS_RELOAD_INTERVAL", Usage: "how often to check the certificate files for changes"},
+	{Key: "TLS_CLIENT_CA_FILE", Usage: "PEM CAs that client certificates must chain to; enables mutual TLS"},
+	{Key: "TLS_CLIENT_CERT_OPTIONAL", Usage: "accept clients without a certificate when mutual TLS is enabled"},
+	{Key: "TLS_ALLOWED_CLIENT_IDS", Usage: "client certificate identities (SPIFFE ID, DNS name, or common name) allowed to connect"},
+	{Key: "CLIENT_TLS_CA_FILE", Usage: "PEM CAs trusted for other services' certificates"},
+	{Key: "CLIENT_TLS_CERT_FILE", Usage: "PEM client certificate presented to other services"},
+	{Key: "CLIENT_TLS_KEY_FILE", Usage: "PEM private key for the client certificate"},
+	{Key: "CLIENT_TLS_SERVER_NAME", Usage: "server name verified in other services' certificates"},
+	{Key: "H2C", Usage: "also accept HTTP/2 over cleartext connections"},
+	{Key: "REQUEST_TIMEOUT", Usage: "maximum time to handle a request"},
+	{Key: "MAX_BODY_BYTES", Usage: "maximum request body size in bytes"},
+	{Key: "MAX_BODY_ROUTES", Usage: "per-route body limits, each \"[METHOD ]/prefix=bytes\"; 0 lifts the limit on the route"},
+	{Key: "ACCESS_LOG_SAMPLE", Usage: "fraction of requests written to the access log, above 0 and at most 1"},
+	{Key: "ACCESS_LOG_SAMPLE_ROUTES", Usage: "per-route access log sampling, each \"[METHOD ]/prefix=rate\"; server errors are always logged"},
+	{Key: "CAPTURE_DIR", Usage: "directory sampled requests are recorded in for replay; empty disables capture"},
+	{Key: "CAPTURE_ROUTES", Usage: "requests to capture, each \"[METHOD ]/prefix=rate\""},
+	{Key: "CAPTURE_MAX_BODY_BYTES", Usage: "longest request body recorded; longer bodies are left out"},
+	{Key: "CAPTURE_MAX_FILE_BYTES", Usage: "size at which a new capture file is started"},
+	{Key: "CAPTURE_MAX_FILES", Usage: "capture files kept before the oldest is removed"},
+	{Key: "CAPTURE_REDACT_FIELDS", Usage: "comma-separated JSON fields and query parameters replaced in captures"},
+	{Key: "CAPTURE_REDACT_HEADERS", Usage: "comma-separated headers left out of captures besides credentials"},
+	{Key: "RATE_LIMIT", Usage: "requests per second allowed per caller; 0 disables"},
+	{Key: "RATE_BURST", Usage: "requests a caller may burst above the rate"},
+	{Key: "RATE_LIMIT_ROUTES", Usage: "per-route limits, each \"[METHOD ]/prefix=rate[:burst]\"; a rate of 0 exempts the route"},
+	{Key: "RATE_LIMIT_KEY", Usage: "what callers are limited by: subject, tenant, or ip"},
+	{Key: "RATE_LIMIT_REDIS_URL", Usage: "redis:// URL sharing limits between replicas; empty keeps them in memory"},
+	{Key: "IDEMPOTENCY_TTL", Usage: "how long responses to POSTs with an Idempotency-Key are replayed to retries; 0 disables"},
+	{Key: "IDEMPOTENCY_MAX_BODY_BYTES", Usage: "largest response body kept for replay"},
+	{Key: "ACL_ALLOW", Usage: "networks (CIDRs or addresses) allowed to reach administrative endpoints; empty allows all"},
+	{Key: "ACL_DENY", Usage: "networks refused at administrative endpoints even when allowed"},
+	{Key: "ACL_PATHS", Usage: "path prefixes the access lists guard"},
+	{Key: "TRUSTED_PROXIES", Usage: "networks of proxies whose X-Forwarded-For names the client"},
+	{Key: "CORS_ALLOWED_ORIGINS", Usage: "origins allowed to call the service from a browser, or *"},
+	{Key: "CORS_ALLOWED_METHODS", Usage: "methods allowed in cross-origin requests"},
+	{Key: "CORS_ALLOWED_HEADERS", Usage: "request headers allowed in cross-origin requests; empty allows those requested"},
+	{Key: "CORS_ALLOW_CREDENTIALS", Usage: "let browsers send cookies and credentials cross-origin"},
+	{Key: "CORS_MAX_AGE", Usage: "how long browsers may cache preflight responses"},
+	{Key: "AUTH_API_KEYS", Usage: "comma-separated API keys accepted, each \"key\" or \"tenant:key\""},
+	{Key: "AUTH_JWT_SECRET", Usage: "HMAC secret for HS256/384/512 bearer tokens"},
+	{Key: "AUTH_JWT_PUBLIC_KEY_FILE", Usage: "PEM public keys or certificates for RS*/ES* bearer tokens"},
+	{Key: "AUTH_JWT_ISSUER", Usage: "required iss claim of bearer tokens"},
+	{Key: "AUTH_JWT_AUDIENCE", Usage: "required aud claim of bearer tokens"},
+	{Key: "AUTH_JWT_TENANT_CLAIM", Usage: "bearer token claim holding the tenant ID"},
+	{Key: "AUTH_JWT_PROJECT_CLAIM", Usage: "bearer token claim holding the project ID"},
+	{Key: "AUTH_JWT_LEEWAY", Usage: "clock skew tolerated when checking token expiry"},
+	{Key: "AUTH_POLICY_FILE", Usage: "JSON role bindings enforced per route"},
+	{Key: "AUTH_CLIENT_API_KEY", Usage: "API key sent on calls to other services"},
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	loader := config.NewLoader("UGC_SERVICE")
+	logger := logging.New("ugc-service")
+	slog.SetDefault(logger.Slog())
+	loader, err := config.Parse("UGC_SERVICE", options)
+	if err != nil {
+		logger.Fatalf("load config: %v", err)
+	}
+	clientTLS, err := httpclient.New(httpclient.FromConfig(loader), logger)
+	if err != nil {
+		logger.Fatalf("load client tls config: %v", err)
+	}
+	defer clientTLS.Close()
+	clientKey := loader.Secret("AUTH_CLIENT_API_KEY", "")
+	if shipURL, err := loader.URL("LOG_SHIP_URL", ""); err != nil {
+		logger.Fatalf("load config: %v", err)
+	} else if shipURL != nil {
+		defer logger.Ship(shipURL.String(), loader.Int("LOG_SHIP_BUFFER", 1024), auth.Transport(clientKey, clientTLS)).Stop()
+	}
 	addr := loader.String("HTTP_ADDR", ":8091")
+	diag := admin.FromConfig(loader)
+	acl, err := netacl.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load acl config: %v", err)
+	}
+	authn, err := auth.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load auth config: %v", err)
+	}
+	if !authn.Enabled() {
+		logger.Warn("authentication disabled; set AUTH_API_KEYS, AUTH_JWT_*, or TLS_CLIENT_CA_FILE to require credentials")
+	}
 
-	logger := logging.New("ugc-service")
-	store := ugc.NewMemoryStore()
+	db, err := storage.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load storage config: %v", err)
+	}
+	locker, err := lock.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load lock config: %v", err)
+	}
+	encryptionConfig, err := encryption.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load encryption config: %v", err)
+	}
+	keyring, err := encryption.New(encryptionConfig, clientTLS, logger)
+	if err != nil {
+		logger.Fatalf("load encryption keys: %v", err)
+	}
+	store := ugc.NewStorageStore(db)
+	store.SetKeyring(keyring)
 	svc := ugc.NewService(store, nil)
+	auditLog := audit.New(db, "ugc-service", logger)
+	auditLog.SetKeyring(keyring)
+	svc.SetAudit(auditLog)
+
+	bus := eventbus.New(0, logger)
+	bus.Start()
+	svc.SetEvents(bus)
+	hookStore := webhooks.NewStorageStore(db)
+	hookStore.SetKeyring(keyring)
+	hooks := webhooks.NewService(hookStore, nil, webhooks.FromConfig(loader, []string{eventbus.NameContentReviewed}), nil, logger)
+	hooks.SetAudit(auditLog)
+	hooks.Subscribe(bus)
+	meterConfig, err := metering.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load metering config: %v", err)
+	}
+	meter := metering.New(db, meterConfig, logger)
+	svc.SetMeter(meter)
+	retentionConfig, err := retention.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load retention config: %v", err)
+	}
+	retainer := retention.New(retentionConfig, logger)
+	retainer.SetLocker(locker)
+	svc.RegisterRetention(retainer)
+	replicationConfig, err := replication.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load replication config: %v", err)
+	}
+	replicator := replication.New(db, "ugc-service", replicationConfig, auth.Transport(clientKey, clientTLS), logger)
+	replicator.SetKeyring(keyring)
+	svc.SetReplicator(replicator)
+	mediaConfig, err := ugc.MediaFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load media config: %v", err)
+	}
+	svc.SetMedia(store, mediaConfig, logger)
+	auditLog.RegisterRetention(retainer)
+	bridge, err := eventbus.BridgeFromConfig(loader, bus, nil, auth.Transport(clientKey, clientTLS), logger)
+	if err != nil {
+		logger.Fatalf("load events config: %v", err)
+	}
+
+	limits, err := ratelimit.FromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load rate limit config: %v", err)
+	}
+	limiter := ratelimit.New(limits)
+	defer limiter.Close()
+	idem := idempotency.New(db, idempotency.FromConfig(loader))
+	idem.SetKeyring(keyring)
+
+	checks := health.NewRegistry()
+	limiter.RegisterChecks(checks)
+	checks.Readiness("storage", db.Check)
+	checks.Optional("event bus", bus.Check)
+	diag.State("event bus", func() any { return bus.Stats() })
 
+	registrar, err := registry.RegistrarFromConfig(loader, "ugc-service", addr, auth.Transport(clientKey, clientTLS), checks, logger)
+	if err != nil {
+		logger.Fatalf("load registry config: %v", err)
+	}
+
+	middleware, err := server.MiddlewareFromConfig(loader)
+	if err != nil {
+		logger.Fatalf("load middleware config: %v", err)
+	}
+	reloader := server.NewReloader(loader, logger)
+	reloader.Add("rate limits", limiter.Reload)
+	reloader.Add("access lists", acl.Reload)
+	reloader.Add("auth policy", authn.ReloadPolicy)
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(limiter.Middleware(idem.Middleware(svc.Handler()))))
+	mux.Handle(audit.Path, authn.Require(limiter.Middleware(auditLog.Handler())))
+	mux.Handle(webhooks.Path, authn.Require(limiter.Middleware(idem.Middleware(hooks.Handler()))))
+	mux.Handle(webhooks.Path+"/", authn.Require(limiter.Middleware(idem.Middleware(hooks.Handler()))))
+	mux.Handle(metering.Path, authn.Require(limiter.Middleware(meter.Handler())))
+	mux.Handle(metering.Path+"/", authn.Require(limiter.Middleware(meter.Handler())))
+	mux.Handle(retention.Path, authn.Require(limiter.Middleware(retainer.Handler())))
+	mux.Handle(retention.Path+"/", authn.Require(limiter.Middleware(retainer.Handler())))
+	mux.Handle(replication.Path, authn.Require(limiter.Middleware(replicator.Handler())))
+	mux.Handle(replication.Path+"/", authn.Require(limiter.Middleware(replicator.Handler())))
+	mux.Handle(encryption.Path, authn.Require(limiter.Middleware(keyring.Handler())))
+	mux.Handle(encryption.Path+"/", authn.Require(limiter.Middleware(keyring.Handler())))
+	mux.Handle("/debug/config", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, loader.Handler())))
+	mux.Handle("/debug/loglevel", authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, logger.LevelHandler())))
+	mux.Handle("/metrics", authn.Require(auth.Guard(auth.PermMetricsRead, auth.PermMetricsRead, middleware.Metrics)))
+	mux.Handle("/livez", checks.LiveHandler())
+	mux.Handle("/readyz", checks.ReadyHandler())
 	srv := &http.Server{
 		Addr:    addr,
-		Handler: svc.Handler(),
+		Handler: reloader.Standard(logger, middleware, apiversion.Mount(acl.Middleware(mux), apiversion.V1)),
+	}
+
+	group := server.NewRunGroup(5*time.Second, logger)
+	group.AddHTTP("http server", srv, server.OptionsFromConfig(loader, logger)...)
+	group.Go("config reload", reloader.Run)
+	group.Go("webhooks", hooks.Run)
+	group.Go("metering", meter.Run)
+	group.Go("retention", retainer.Run)
+	group.Go("replication", replicator.Run)
+	group.Go("ugc media", svc.RunMedia)
+	if diag != nil {
+		group.AddHTTP("admin server", diag.Server(acl.Require(authn.Require(auth.Guard(auth.PermDebug, auth.PermDebug, diag.Handler())))), server.OptionsFromConfig(loader, logger)...)
+		logger.Info("admin listening", "addr", diag.Addr)
+	}
+	if registrar != nil {
+		group.Go("registry heartbeat", registrar.Run)
+	}
+	if bridge != nil {
+		group.Go("event bridge", bridge.Run)
 	}
+	group.OnStop("event bus", bus.Stop)
+	group.OnShutdown("locks", func(context.Context) error { return locker.Close() })
+	group.OnShutdown("storage", func(context.Context) error { return db.Close() })
 
-	logger.Printf("ugc service listening on %s", addr)
-	if err := server.Run(ctx, srv, 5*time.Second); err != nil {
-		logger.Printf("server shutdown: %v", err)
+	logger.Info("listening", "addr", addr)
+	if err := group.Run(ctx); err != nil {
+		logger.Error("shutdown", "err", err)
 	}
 }
@@ -0,0 +1,160 @@
+// Package admin serves the diagnostics an operator reaches for during an
+// incident — CPU, heap, and goroutine profiles from net/http/pprof, the
+// expvar variables, and a dump of the process's goroutines and queues — on
+// a listener of its own, away from the service's API and its request
+// timeout. Binaries create one with FromConfig, which returns nil unless
+// ADMIN_ADDR is set, and register what their queues look like:
+//
+//	diag := admin.FromConfig(loader)
+//	diag.State("event bus", func() any { return bus.Stats() })
+//	if diag != nil {
+//		group.AddHTTP("admin server", diag.Server(handler), opts...)
+//	}
+//
+// State on a nil Server does nothing, so the registration lines need no
+// guard.
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Paths served by Handler.
+const (
+	PprofPath = "/debug/pprof/"
+	VarsPath  = "/debug/vars"
+	StatePath = "/debug/state"
+)
+
+// Server holds the state reporters behind /debug/state.
+type Server struct {
+	// Addr is the admin listener's address.
+	Addr string
+
+	started time.Time
+
+	mu     sync.RWMutex
+	states map[string]func() any
+}
+
+// New constructs a server for addr.
+func New(addr string) *Server {
+	return &Server{Addr: addr, started: time.Now(), states: make(map[string]func() any)}
+}
+
+// FromConfig reads ADMIN_ADDR from loader and returns a server for it, or
+// nil when it is empty, leaving the endpoints unmounted.
+func FromConfig(loader config.Loader) *Server {
+	addr := loader.String("ADMIN_ADDR", "")
+	if addr == "" {
+		return nil
+	}
+	return New(addr)
+}
+
+// State registers fn to report the named component, such as a queue or
+// worker pool, in /debug/state. fn is called on every request and must be
+// safe to call concurrently with the component's work; its result is
+// rendered as JSON.
+func (s *Server) State(name string, fn func() any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[name] = fn
+}
+
+// Snapshot is the body served by /debug/state.
+type Snapshot struct {
+	GoVersion     string         `json:"go_version"`
+	UptimeSeconds float64        `json:"uptime_seconds"`
+	Goroutines    int            `json:"goroutines"`
+	GOMAXPROCS    int            `json:"gomaxprocs"`
+	Components    map[string]any `json:"components"`
+	// Stacks holds every goroutine's stack, as pprof's goroutine profile
+	// prints it with debug=2; it is only filled when requested.
+	Stacks string `json:"stacks,omitempty"`
+}
+
+// Snapshot calls every registered reporter.
+func (s *Server) Snapshot() Snapshot {
+	s.mu.RLock()
+	states := make(map[string]func() any, len(s.states))
+	for name, fn := range s.states {
+		states[name] = fn
+	}
+	s.mu.RUnlock()
+
+	components := make(map[string]any, len(states))
+	for name, fn := range states {
+		components[name] = fn()
+	}
+	return Snapshot{
+		GoVersion:     runtime.Version(),
+		UptimeSeconds: time.Since(s.started).Seconds(),
+		Goroutines:    runtime.NumGoroutine(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		Components:    components,
+	}
+}
+
+// Handler serves the pprof profiles under /debug/pprof/, the expvar
+// variables at /debug/vars, and the Snapshot at /debug/state;
+// /debug/state?stacks=true adds every goroutine's stack. Importing pprof
+// and expvar also registers them on http.DefaultServeMux, which no binary
+// serves.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PprofPath, pprof.Index)
+	mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+	mux.Handle(VarsPath, expvar.Handler())
+	mux.HandleFunc(StatePath, s.handleState)
+	return mux
+}
+
+func (s *Server) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "debug", http.MethodGet)
+		return
+	}
+	snapshot := s.Snapshot()
+	if raw := r.URL.Query().Get("stacks"); raw != "" {
+		stacks, err := strconv.ParseBool(raw)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, "debug.invalid_request", "stacks must be true or false")
+			return
+		}
+		if stacks {
+			var buf bytes.Buffer
+			_ = runtimepprof.Lookup("goroutine").WriteTo(&buf, 2)
+			snapshot.Stacks = buf.String()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(snapshot)
+}
+
+// Server returns the admin listener serving handler, which is normally
+// Handler wrapped in the binary's authentication. It carries no request
+// timeout, so CPU profiles and execution traces can run for as long as
+// their seconds parameter asks.
+func (s *Server) Server(handler http.Handler) *http.Server {
+	return &http.Server{Addr: s.Addr, Handler: handler}
+}
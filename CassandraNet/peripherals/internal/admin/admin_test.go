@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type queueState struct {
+	Queued int `json:"queued"`
+}
+
+func TestStateReportsComponents(t *testing.T) {
+	s := New("127.0.0.1:0")
+	s.State("event bus", func() any { return queueState{Queued: 3} })
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, StatePath, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var snapshot struct {
+		Goroutines int                   `json:"goroutines"`
+		Components map[string]queueState `json:"components"`
+		Stacks     string                `json:"stacks"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if snapshot.Goroutines == 0 || snapshot.Components["event bus"].Queued != 3 || snapshot.Stacks != "" {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, StatePath+"?stacks=true", nil))
+	if !strings.Contains(rec.Body.String(), "goroutine ") {
+		t.Fatalf("expected goroutine stacks, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, StatePath+"?stacks=maybe", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad stacks flag, got %d", rec.Code)
+	}
+}
+
+func TestHandlerServesProfilesAndVars(t *testing.T) {
+	handler := New("127.0.0.1:0").Handler()
+	for path, want := range map[string]string{
+		PprofPath:                       "goroutine",
+		PprofPath + "goroutine?debug=1": "goroutine profile",
+		VarsPath:                        "memstats",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Fatalf("%s: expected 200 mentioning %q, got %d", path, want, rec.Code)
+		}
+	}
+}
+
+func TestNilServerIgnoresState(t *testing.T) {
+	var s *Server
+	s.State("event bus", func() any { return nil })
+}
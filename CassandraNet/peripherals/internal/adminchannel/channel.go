@@ -0,0 +1,346 @@
+// Package adminchannel pushes state changes to operator dashboards over a
+// WebSocket. A service registers the topics it publishes, each guarded by a
+// permission, and publishes a change whenever one happens; dashboards
+// connect to Path, subscribe to topics, and receive each change as it is
+// published instead of polling the service's list endpoints.
+//
+// Frames are JSON objects with a "type". Clients send
+//
+//	{"type":"subscribe","topic":"assignments","last_event_id":"..."}
+//	{"type":"unsubscribe","topic":"assignments"}
+//
+// and receive "ready" (the topics they may subscribe to), "subscribed",
+// "unsubscribed", "event" (with the topic, an id, the owning tenant and
+// project, and the change as data), and "error" with a stable code. Topics
+// may also be subscribed at connect time with ?topic= query parameters.
+//
+// Changes are fanned out through an sse.Hub, so subscribing with the ID of
+// the last event seen replays what was missed while the replica still
+// holds it, and a connection that falls behind loses that subscription
+// rather than stalling the service.
+package adminchannel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/websocket"
+)
+
+// Path is where binaries mount Handler.
+const Path = "/admin/ws"
+
+// DefaultPingInterval is how often an idle connection is pinged.
+const DefaultPingInterval = 30 * time.Second
+
+// Error codes sent in "error" frames.
+const (
+	CodeInvalidMessage   = "admin.invalid_message"
+	CodeUnknownTopic     = "admin.unknown_topic"
+	CodePermissionDenied = "admin.permission_denied"
+	CodeSlowConsumer     = "admin.slow_consumer"
+)
+
+// Config tunes a Channel. Zero values select the defaults.
+type Config struct {
+	// PingInterval is how often connections are pinged (default 30s). A
+	// connection that sends nothing, not even a pong, for two intervals is
+	// closed.
+	PingInterval time.Duration
+}
+
+// Frame is one message exchanged with a dashboard. Fields unused by a type
+// are omitted.
+type Frame struct {
+	Type        string          `json:"type"`
+	Topic       string          `json:"topic,omitempty"`
+	Topics      []string        `json:"topics,omitempty"`
+	ID          string          `json:"id,omitempty"`
+	LastEventID string          `json:"last_event_id,omitempty"`
+	Resumed     bool            `json:"resumed,omitempty"`
+	TenantID    string          `json:"tenant_id,omitempty"`
+	ProjectID   string          `json:"project_id,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Code        string          `json:"code,omitempty"`
+	Detail      string          `json:"detail,omitempty"`
+}
+
+// change is a published state change.
+type change struct {
+	topic   string
+	tenant  string
+	project string
+	data    json.RawMessage
+}
+
+// Channel is one service's admin channel. The all-in-one binary shares a
+// single Channel between its services.
+type Channel struct {
+	cfg    Config
+	hub    *sse.Hub[change]
+	logger interface {
+		Printf(string, ...any)
+	}
+
+	mu     sync.RWMutex
+	topics map[string]auth.Permission
+}
+
+// New returns a channel without topics.
+func New(cfg Config, logger interface{ Printf(string, ...any) }) *Channel {
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = DefaultPingInterval
+	}
+	return &Channel{
+		cfg:    cfg,
+		hub:    sse.NewHub[change](sse.Config{}),
+		logger: logger,
+		topics: make(map[string]auth.Permission),
+	}
+}
+
+// Register offers topic to subscribers holding perm for the changes'
+// tenant and project. Registering a topic again replaces its permission.
+func (c *Channel) Register(topic string, perm auth.Permission) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics[topic] = perm
+}
+
+// Topics returns the registered topics in order.
+func (c *Channel) Topics() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.topics))
+	for name := range c.topics {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (c *Channel) permission(topic string) (auth.Permission, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	perm, ok := c.topics[topic]
+	return perm, ok
+}
+
+// Publish sends data, encoded as JSON, to the subscribers of topic that may
+// see changes of tenant and project. Changes without a tenant are checked
+// against each subscriber's own tenant, as auth.Guard checks requests. A
+// nil Channel publishes nothing.
+func (c *Channel) Publish(topic, tenant, project string, data any) {
+	if c == nil {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		c.logger.Printf("admin channel: encode %s change: %v", topic, err)
+		return
+	}
+	c.hub.Publish(change{topic: topic, tenant: tenant, project: project, data: payload})
+}
+
+// Handler serves the channel. Authentication is left to the middleware in
+// front of it, as for every other route; each topic's permission is
+// checked when it is subscribed and again for every change.
+func (c *Channel) Handler() http.Handler {
+	return http.HandlerFunc(c.serve)
+}
+
+func (c *Channel) serve(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, "admin", websocket.Options{})
+	if err != nil {
+		return
+	}
+	conn.SetReadTimeout(2 * c.cfg.PingInterval)
+	s := &session{
+		channel: c,
+		conn:    conn,
+		ctx:     r.Context(),
+		subs:    make(map[string]*sse.Subscription[change]),
+	}
+	defer s.close()
+	_ = conn.WriteJSON(Frame{Type: "ready", Topics: s.allowedTopics()})
+	lastEventID := sse.LastEventID(r)
+	for _, topic := range r.URL.Query()["topic"] {
+		s.subscribe(topic, lastEventID)
+	}
+
+	frames := make(chan Frame)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			payload, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			var f Frame
+			if err := json.Unmarshal(payload, &f); err != nil {
+				_ = conn.WriteJSON(Frame{Type: "error", Code: CodeInvalidMessage, Detail: "frames must be JSON objects"})
+				continue
+			}
+			select {
+			case frames <- f:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(c.cfg.PingInterval)
+	defer ticker.Stop()
+	draining := server.Draining(r.Context())
+	for {
+		select {
+		case f := <-frames:
+			s.handle(f)
+		case <-ticker.C:
+			if err := conn.Ping(); err != nil {
+				return
+			}
+		case <-draining:
+			// Hijacked connections are not closed by Shutdown; tell the
+			// dashboard to reconnect elsewhere.
+			_ = conn.Close(websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-readErr:
+			return
+		}
+	}
+}
+
+// session is one dashboard connection.
+type session struct {
+	channel *Channel
+	conn    *websocket.Conn
+	ctx     context.Context
+
+	mu   sync.Mutex
+	subs map[string]*sse.Subscription[change]
+	wg   sync.WaitGroup
+}
+
+func (s *session) handle(f Frame) {
+	switch f.Type {
+	case "subscribe":
+		s.subscribe(f.Topic, f.LastEventID)
+	case "unsubscribe":
+		s.unsubscribe(f.Topic)
+	default:
+		s.fail(f.Topic, CodeInvalidMessage, `type must be "subscribe" or "unsubscribe"`)
+	}
+}
+
+// allowedTopics lists the topics the caller may subscribe to in its own
+// tenant and project.
+func (s *session) allowedTopics() []string {
+	var allowed []string
+	for _, topic := range s.channel.Topics() {
+		if perm, ok := s.channel.permission(topic); ok && s.allowed(perm, "", "") {
+			allowed = append(allowed, topic)
+		}
+	}
+	return allowed
+}
+
+// allowed reports whether the caller may see a change owned by tenant and
+// project; empty IDs stand for the caller's own.
+func (s *session) allowed(perm auth.Permission, tenant, project string) bool {
+	if tenant == "" {
+		tenant = logging.TenantID(s.ctx)
+	}
+	if project == "" {
+		project = logging.ProjectID(s.ctx)
+	}
+	return auth.Authorize(s.ctx, perm, tenant, project) == nil
+}
+
+func (s *session) subscribe(topic, lastEventID string) {
+	perm, ok := s.channel.permission(topic)
+	if !ok {
+		s.fail(topic, CodeUnknownTopic, "no topic named "+topic)
+		return
+	}
+	if !s.allowed(perm, "", "") {
+		s.fail(topic, CodePermissionDenied, "subscribing requires "+string(perm))
+		return
+	}
+	s.mu.Lock()
+	if _, ok := s.subs[topic]; ok {
+		s.mu.Unlock()
+		_ = s.conn.WriteJSON(Frame{Type: "subscribed", Topic: topic})
+		return
+	}
+	sub, resumed := s.channel.hub.Subscribe(func(ch change) bool {
+		return ch.topic == topic && s.allowed(perm, ch.tenant, ch.project)
+	}, lastEventID)
+	s.subs[topic] = sub
+	s.mu.Unlock()
+	// Confirm before relaying, so the dashboard sees "subscribed" before
+	// any replayed events.
+	_ = s.conn.WriteJSON(Frame{Type: "subscribed", Topic: topic, Resumed: resumed})
+	s.wg.Add(1)
+	go s.relay(topic, sub)
+}
+
+// relay writes the changes of sub until it is closed, by unsubscribe or by
+// the hub when the connection fell behind.
+func (s *session) relay(topic string, sub *sse.Subscription[change]) {
+	defer s.wg.Done()
+	for item := range sub.Items() {
+		ch := item.Value
+		err := s.conn.WriteJSON(Frame{Type: "event", Topic: topic, ID: item.ID, TenantID: ch.tenant, ProjectID: ch.project, Data: ch.data})
+		if err != nil {
+			return
+		}
+	}
+	s.mu.Lock()
+	dropped := s.subs[topic] == sub
+	if dropped {
+		delete(s.subs, topic)
+	}
+	s.mu.Unlock()
+	if dropped {
+		s.fail(topic, CodeSlowConsumer, "fell behind; subscribe again with the last event ID to resume")
+	}
+}
+
+func (s *session) unsubscribe(topic string) {
+	s.mu.Lock()
+	sub, ok := s.subs[topic]
+	delete(s.subs, topic)
+	s.mu.Unlock()
+	if ok {
+		sub.Close()
+	}
+	_ = s.conn.WriteJSON(Frame{Type: "unsubscribed", Topic: topic})
+}
+
+func (s *session) fail(topic, code, detail string) {
+	_ = s.conn.WriteJSON(Frame{Type: "error", Topic: topic, Code: code, Detail: detail})
+}
+
+func (s *session) close() {
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+	for _, sub := range subs {
+		sub.Close()
+	}
+	s.wg.Wait()
+	_ = s.conn.Close(websocket.CloseNormal, "")
+}
@@ -0,0 +1,109 @@
+package adminchannel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/websocket"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {
+	// no-op: suppress logging during tests
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) Frame {
+	t.Helper()
+	payload, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var f Frame
+	if err := json.Unmarshal(payload, &f); err != nil {
+		t.Fatalf("decode %s: %v", payload, err)
+	}
+	return f
+}
+
+func TestChannelPushesPermittedChanges(t *testing.T) {
+	ch := New(Config{}, noopLogger{})
+	ch.Register("assignments", auth.PermAssignmentsRead)
+	ch.Register("flagged", auth.PermUGCModerate)
+	authn := auth.New(auth.ParseAPIKeys([]string{"acme:k1"}), auth.JWTConfig{})
+	authn.SetPolicy(&auth.Policy{Bindings: []auth.Binding{
+		{Subject: "*", Roles: []auth.Role{auth.RoleConsumer}},
+	}})
+	srv := httptest.NewServer(authn.Require(ch.Handler()))
+	defer srv.Close()
+	header := http.Header{auth.APIKeyHeader: {"k1"}}
+
+	if _, err := websocket.Dial(context.Background(), srv.URL, nil, websocket.Options{}); err == nil {
+		t.Fatal("expected connecting without credentials to fail")
+	}
+	conn, err := websocket.Dial(context.Background(), srv.URL+"?topic=assignments", header, websocket.Options{})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "ready" || !slices.Equal(f.Topics, []string{"assignments"}) {
+		t.Fatalf("expected only the permitted topic to be offered, got %+v", f)
+	}
+	if f := readFrame(t, conn); f.Type != "subscribed" || f.Topic != "assignments" {
+		t.Fatalf("expected the query's topic to be subscribed, got %+v", f)
+	}
+
+	ch.Publish("assignments", "other", "p1", map[string]string{"assignment_id": "a-0"})
+	ch.Publish("flagged", "acme", "", map[string]string{"content_id": "c-1"})
+	ch.Publish("assignments", "acme", "p1", map[string]string{"assignment_id": "a-1"})
+	first := readFrame(t, conn)
+	if first.Type != "event" || first.Topic != "assignments" || first.TenantID != "acme" || string(first.Data) != `{"assignment_id":"a-1"}` || first.ID == "" {
+		t.Fatalf("expected only acme's assignment, got %+v", first)
+	}
+
+	for _, tc := range []struct {
+		frame string
+		code  string
+	}{
+		{`{"type":"subscribe","topic":"flagged"}`, CodePermissionDenied},
+		{`{"type":"subscribe","topic":"nope"}`, CodeUnknownTopic},
+		{`{"type":"publish","topic":"assignments"}`, CodeInvalidMessage},
+		{`not json`, CodeInvalidMessage},
+	} {
+		if err := conn.WriteText([]byte(tc.frame)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if f := readFrame(t, conn); f.Type != "error" || f.Code != tc.code {
+			t.Fatalf("%s: expected %s, got %+v", tc.frame, tc.code, f)
+		}
+	}
+	if err := conn.WriteText([]byte(`{"type":"unsubscribe","topic":"assignments"}`)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "unsubscribed" {
+		t.Fatalf("expected the unsubscribe to be confirmed, got %+v", f)
+	}
+	_ = conn.Close(websocket.CloseNormal, "")
+
+	// A dashboard reconnecting with the last ID it saw gets what it missed.
+	ch.Publish("assignments", "acme", "p1", map[string]string{"assignment_id": "a-2"})
+	conn, err = websocket.Dial(context.Background(), srv.URL, header, websocket.Options{})
+	if err != nil {
+		t.Fatalf("redial: %v", err)
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+	readFrame(t, conn)
+	if err := conn.WriteJSON(Frame{Type: "subscribe", Topic: "assignments", LastEventID: first.ID}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "subscribed" || !f.Resumed {
+		t.Fatalf("expected a resumed subscription, got %+v", f)
+	}
+	if f := readFrame(t, conn); f.Type != "event" || string(f.Data) != `{"assignment_id":"a-2"}` {
+		t.Fatalf("expected the missed assignment, got %+v", f)
+	}
+}
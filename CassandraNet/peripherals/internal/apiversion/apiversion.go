@@ -0,0 +1,163 @@
+// Package apiversion serves a service's routes under version prefixes, so
+// response shapes can change without breaking game clients already in the
+// field. Mount strips a leading /v1, /v2, ... from the request path, records
+// the version in the request context, and refuses versions the service
+// does not serve. Paths without a prefix are served as V1, which is what
+// every client written before prefixes existed expects:
+//
+//	handler := apiversion.Mount(mux, apiversion.V1, apiversion.V2)
+//	// GET /v2/topics/scores/messages  -> mux sees /topics/scores/messages, version 2
+//	// GET /topics/scores/messages     -> mux sees the same path, version 1
+//	// GET /v3/topics/scores/messages  -> 404 api.unsupported_version
+//
+// Each response carries the version served in the API-Version header.
+//
+// Handlers whose payloads differ between versions read the version with
+// FromContext and decode or encode the matching shape; the rest ignore it.
+package apiversion
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Version is an API version, served under the /v<N> path prefix.
+type Version int
+
+// Versions in use. V1 is the shape every service served before versioning.
+const (
+	V1 Version = 1
+	V2 Version = 2
+)
+
+// Default is the version of requests whose path carries no prefix.
+const Default = V1
+
+// All lists every version some service serves. Routers in front of several
+// services, such as the gateway's, accept all of them and leave each
+// service to refuse the ones it lacks.
+var All = []Version{V1, V2}
+
+// Header is set on every response to the version that was served.
+const Header = "API-Version"
+
+// String returns the path segment for v, such as "v2".
+func (v Version) String() string {
+	return "v" + strconv.Itoa(int(v))
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying v.
+func NewContext(ctx context.Context, v Version) context.Context {
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// FromContext returns the version a request asked for, or Default when its
+// path carried no prefix.
+func FromContext(ctx context.Context) Version {
+	if v, ok := Requested(ctx); ok {
+		return v
+	}
+	return Default
+}
+
+// Requested returns the version named by the request's path prefix, and
+// false when there was none. Proxies use it to pass the prefix on.
+func Requested(ctx context.Context) (Version, bool) {
+	v, ok := ctx.Value(contextKey{}).(Version)
+	return v, ok
+}
+
+// Router is the handler returned by Mount.
+type Router struct {
+	next        http.Handler
+	versions    []Version
+	passthrough []string
+}
+
+// Mount serves next under the prefix of each of versions, and under no
+// prefix as Default. Routers nest: an inner router given a path without a
+// prefix keeps the version an outer one stripped, so "/v2/messaging/topics"
+// through the gateway reaches the messaging service as version 2.
+func Mount(next http.Handler, versions ...Version) *Router {
+	return &Router{next: next, versions: versions}
+}
+
+// Passthrough serves paths that only look versioned, such as OTLP's
+// /v1/metrics, unchanged and as Default.
+func (rt *Router) Passthrough(paths ...string) *Router {
+	rt.passthrough = append(rt.passthrough, paths...)
+	return rt
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if slices.Contains(rt.passthrough, r.URL.Path) {
+		w.Header().Set(Header, Default.String())
+		rt.next.ServeHTTP(w, r)
+		return
+	}
+	v, rest, prefixed := Split(r.URL.Path)
+	if !prefixed {
+		v = FromContext(r.Context())
+	}
+	if !slices.Contains(rt.versions, v) {
+		problem.Write(w, r, http.StatusNotFound, "api.unsupported_version", "API version "+v.String()+" is not served here; use "+rt.list())
+		return
+	}
+	w.Header().Set(Header, v.String())
+	if !prefixed {
+		rt.next.ServeHTTP(w, r)
+		return
+	}
+	// Like http.StripPrefix, hand next a copy so the caller's request,
+	// which middleware outside Mount may still log, keeps its path.
+	r2 := r.Clone(NewContext(r.Context(), v))
+	r2.URL.Path = rest
+	r2.URL.RawPath = ""
+	rt.next.ServeHTTP(w, r2)
+}
+
+func (rt *Router) list() string {
+	names := make([]string, len(rt.versions))
+	for i, v := range rt.versions {
+		names[i] = v.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// Split separates a leading version segment from path: "/v2/topics" is
+// V2 and "/topics". It reports false when path has no version prefix.
+func Split(path string) (Version, string, bool) {
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	digits, ok := strings.CutPrefix(segment, "v")
+	if !ok || digits == "" || digits[0] == '0' || strings.Trim(digits, "0123456789") != "" {
+		return 0, path, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return 0, path, false
+	}
+	return Version(n), "/" + rest, true
+}
+
+// Trim removes the first version segment anywhere in path, so
+// "/ugc/v1/content" becomes "/ugc/content". Rules written against
+// unversioned paths, such as rate limits, use it to match every version.
+func Trim(path string) string {
+	for i := 0; i < len(path); i++ {
+		if path[i] != '/' {
+			continue
+		}
+		if _, rest, ok := Split(path[i:]); ok {
+			return path[:i] + rest
+		}
+	}
+	return path
+}
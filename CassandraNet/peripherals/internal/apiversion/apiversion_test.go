@@ -0,0 +1,69 @@
+package apiversion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		path string
+		v    Version
+		rest string
+		ok   bool
+	}{
+		{"/v1/content", V1, "/content", true},
+		{"/v2", V2, "/", true},
+		{"/v12/topics/a", 12, "/topics/a", true},
+		{"/content", 0, "/content", false},
+		{"/vendors", 0, "/vendors", false},
+		{"/v0/content", 0, "/v0/content", false},
+		{"/v+1/content", 0, "/v+1/content", false},
+	}
+	for _, tc := range cases {
+		v, rest, ok := Split(tc.path)
+		if v != tc.v || rest != tc.rest || ok != tc.ok {
+			t.Errorf("Split(%q) = %v, %q, %v; want %v, %q, %v", tc.path, v, rest, ok, tc.v, tc.rest, tc.ok)
+		}
+	}
+	if got := Trim("/ugc/v1/content"); got != "/ugc/content" {
+		t.Errorf("Trim: got %q", got)
+	}
+}
+
+func TestMount(t *testing.T) {
+	var path string
+	var version Version
+	inner := Mount(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, version = r.URL.Path, FromContext(r.Context())
+	}), V1, V2).Passthrough("/v1/metrics")
+	outer := Mount(http.StripPrefix("/messaging", inner), All...)
+
+	cases := []struct {
+		target  string
+		handler http.Handler
+		path    string
+		version Version
+	}{
+		{"/topics/a/messages", inner, "/topics/a/messages", V1},
+		{"/v2/topics/a/messages", inner, "/topics/a/messages", V2},
+		{"/v1/metrics", inner, "/v1/metrics", V1},
+		{"/v2/messaging/topics/a/messages", outer, "/topics/a/messages", V2},
+		{"/messaging/v2/topics/a/messages", outer, "/topics/a/messages", V2},
+	}
+	for _, tc := range cases {
+		path, version = "", 0
+		rec := httptest.NewRecorder()
+		tc.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if path != tc.path || version != tc.version || rec.Header().Get(Header) != tc.version.String() {
+			t.Errorf("%s: served %q as %v (header %q); want %q as %v", tc.target, path, version, rec.Header().Get(Header), tc.path, tc.version)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Mount(inner, V1).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/topics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unserved version, got %d", rec.Code)
+	}
+}
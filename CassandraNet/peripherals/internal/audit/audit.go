@@ -0,0 +1,355 @@
+// Package audit records privileged actions — moderation reviews, template
+// and configuration changes, assignment cancels, alert policy edits — in an
+// append-only log kept on a storage driver. Each entry names the action,
+// the resource, the authenticated actor, the tenant, and the resource's
+// state before and after the change:
+//
+//	log := audit.New(db, "ugc-service", logger)
+//	log.Record(ctx, audit.Change{
+//		Action:   "ugc.content.review",
+//		Resource: "content/" + id,
+//		TenantID: content.TenantID,
+//		Before:   before,
+//		After:    content,
+//	})
+//
+// Services sharing a driver share one log; entries carry the recording
+// service's name. With a keyring (SetKeyring) the before and after states
+// are sealed at rest. Handler serves the log, filtered and paginated, at
+// /audit.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Buckets used by Log: entries are keyed by a zero-padded sequence number
+// so a scan returns them oldest first. Only key rotation rewrites an entry,
+// re-sealing its states without changing them, and only the retention
+// policy deletes them, oldest first.
+const (
+	entriesBucket = "audit.entries"
+	metaBucket    = "audit.meta"
+	sequenceKey   = "sequence"
+)
+
+// RetentionPolicy names the policy RegisterRetention registers.
+const RetentionPolicy = "audit.entries"
+
+// DefaultRetention is how long entries are kept unless RETENTION_MAX_AGES
+// says otherwise.
+const DefaultRetention = 365 * 24 * time.Hour
+
+// Anonymous is recorded as the actor of requests that carried no
+// credentials.
+const Anonymous = "anonymous"
+
+// Entry is one recorded action.
+type Entry struct {
+	Sequence  uint64    `json:"sequence"`
+	Time      time.Time `json:"time"`
+	Service   string    `json:"service"`
+	Action    string    `json:"action"`
+	Actor     string    `json:"actor"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	ProjectID string    `json:"project_id,omitempty"`
+	Resource  string    `json:"resource"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Before and After hold the resource as JSON; Before is absent for
+	// creations and After for deletions.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+	// Sealed reports that the states were sealed under a key this service
+	// does not have, such as another service's, and are withheld.
+	Sealed bool `json:"sealed,omitempty"`
+}
+
+// storedEntry is an Entry as stored. SealedState holds its states in
+// place of Before and After when the log has a keyring.
+type storedEntry struct {
+	Entry
+	SealedState []byte `json:"sealed_state,omitempty"`
+}
+
+// sealedState is the plaintext of storedEntry.SealedState.
+type sealedState struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// Change describes an action for Record. Actions are named
+// "<service>.<resource>.<verb>", such as "config.document.put".
+type Change struct {
+	Action    string
+	Resource  string
+	TenantID  string
+	ProjectID string
+	Before    any
+	After     any
+}
+
+// Filter narrows List; empty fields match every entry.
+type Filter struct {
+	Service  string
+	Action   string
+	Actor    string
+	TenantID string
+	Resource string
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.Service == "" || e.Service == f.Service) &&
+		(f.Action == "" || e.Action == f.Action) &&
+		(f.Actor == "" || e.Actor == f.Actor) &&
+		(f.TenantID == "" || e.TenantID == f.TenantID) &&
+		(f.Resource == "" || e.Resource == f.Resource)
+}
+
+// Log appends entries for one service to a storage driver.
+type Log struct {
+	db      storage.Driver
+	service string
+	logger  logging.Printer
+	now     func() time.Time
+	keys    *encryption.Keyring
+}
+
+// New returns a log recording service's actions in db.
+func New(db storage.Driver, service string, logger logging.Printer) *Log {
+	return &Log{db: db, service: service, logger: logger, now: func() time.Time { return time.Now().UTC() }}
+}
+
+// SetKeyring seals the states of new entries with k and registers the
+// service's entries with k for rotation. Entries recorded before are read
+// as they are and sealed by the next rotation. Call it before the log is
+// used.
+func (l *Log) SetKeyring(k *encryption.Keyring) {
+	l.keys = k
+	k.Register(encryption.Resealer{Name: l.service + ".audit", Reseal: l.reseal})
+}
+
+// Record appends c, attributed to the principal and request in ctx. The
+// action has already taken effect when Record is called, so a failure to
+// store the entry is logged rather than returned. A nil Log records
+// nothing, letting services treat auditing as optional.
+func (l *Log) Record(ctx context.Context, c Change) {
+	if l == nil {
+		return
+	}
+	if err := l.record(ctx, c); err != nil {
+		logging.For(ctx, l.logger).Printf("audit: record %s on %s: %v", c.Action, c.Resource, err)
+	}
+}
+
+func (l *Log) record(ctx context.Context, c Change) error {
+	entry := Entry{
+		Time:      l.now(),
+		Service:   l.service,
+		Action:    c.Action,
+		Actor:     Anonymous,
+		TenantID:  c.TenantID,
+		ProjectID: c.ProjectID,
+		Resource:  c.Resource,
+		RequestID: logging.RequestID(ctx),
+	}
+	if p, ok := auth.FromContext(ctx); ok && p.Subject != "" {
+		entry.Actor = p.Subject
+	}
+	if entry.TenantID == "" {
+		entry.TenantID = logging.TenantID(ctx)
+	}
+	var err error
+	if entry.Before, err = marshalState(c.Before); err != nil {
+		return err
+	}
+	if entry.After, err = marshalState(c.After); err != nil {
+		return err
+	}
+	stored := storedEntry{Entry: entry}
+	if l.keys.Enabled() {
+		if stored.SealedState, err = l.seal(ctx, entry); err != nil {
+			return err
+		}
+		stored.Before, stored.After = nil, nil
+	}
+	return storage.Update(ctx, l.db, func(tx storage.Tx) error {
+		seq, err := sequence(tx)
+		if err != nil {
+			return err
+		}
+		stored.Sequence = seq + 1
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(metaBucket, sequenceKey, []byte(strconv.FormatUint(stored.Sequence, 10))); err != nil {
+			return err
+		}
+		return tx.Put(entriesBucket, entryKey(stored.Sequence), data)
+	})
+}
+
+// List returns one page of the entries matching filter, oldest first, and
+// the position of the next page. States sealed under a key the log's
+// keyring lacks are withheld and the entry marked Sealed.
+func (l *Log) List(ctx context.Context, filter Filter, page pagination.Request) ([]Entry, string, error) {
+	collector := pagination.NewCollector[Entry](page)
+	err := storage.View(ctx, l.db, func(tx storage.Tx) error {
+		return tx.Scan(entriesBucket, "", func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			var stored storedEntry
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			if !filter.matches(stored.Entry) {
+				return nil
+			}
+			entry, err := l.open(ctx, stored)
+			if err != nil {
+				return err
+			}
+			if !collector.Add(key, entry) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	entries, next := collector.Page()
+	return entries, next, nil
+}
+
+// RegisterRetention registers RetentionPolicy with m, purging entries
+// older than the policy's age. Services sharing a driver share the log, so
+// the policy removes every service's old entries, not only l's.
+func (l *Log) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        RetentionPolicy,
+		Description: "audit entries recorded before the cutoff",
+		MaxAge:      DefaultRetention,
+		Purge:       l.Purge,
+	})
+}
+
+// Purge removes the entries recorded before cutoff and returns how many it
+// removed; with dryRun it only counts them. Sequence numbers are not
+// reused.
+func (l *Log) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	return retention.PurgeBucket(ctx, l.db, entriesBucket, dryRun, func(_ string, value []byte) (bool, error) {
+		var entry Entry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return false, err
+		}
+		if !entry.Time.Before(cutoff) {
+			return false, storage.StopScan
+		}
+		return true, nil
+	}, nil)
+}
+
+// reseal re-seals the states of the service's entries not sealed under
+// the active key. Other services' entries are left to their own keyrings.
+func (l *Log) reseal(ctx context.Context) (int, int, error) {
+	return encryption.ResealBucket(ctx, l.db, entriesBucket, "", func(_ string, value []byte) ([]byte, error) {
+		var stored storedEntry
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return nil, err
+		}
+		if stored.Service != l.service {
+			return nil, nil
+		}
+		var plain []byte
+		if stored.SealedState == nil {
+			var err error
+			if plain, err = json.Marshal(sealedState{Before: stored.Before, After: stored.After}); err != nil {
+				return nil, err
+			}
+		}
+		sealed, err := l.keys.Reseal(ctx, stored.SealedState, plain)
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		stored.Before, stored.After, stored.SealedState = nil, nil, sealed
+		return json.Marshal(stored)
+	})
+}
+
+// seal returns entry's states sealed with the log's keyring.
+func (l *Log) seal(ctx context.Context, entry Entry) ([]byte, error) {
+	plain, err := json.Marshal(sealedState{Before: entry.Before, After: entry.After})
+	if err != nil {
+		return nil, err
+	}
+	return l.keys.Seal(ctx, plain)
+}
+
+// open returns a stored entry with its states opened, or marked Sealed
+// when the log's keyring cannot open them.
+func (l *Log) open(ctx context.Context, stored storedEntry) (Entry, error) {
+	entry := stored.Entry
+	if stored.SealedState == nil {
+		return entry, nil
+	}
+	plain, err := l.keys.Open(ctx, stored.SealedState)
+	if errors.Is(err, encryption.ErrNoKeys) || errors.Is(err, encryption.ErrUnknownKey) {
+		entry.Sealed = true
+		return entry, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	var state sealedState
+	if err := json.Unmarshal(plain, &state); err != nil {
+		return Entry{}, err
+	}
+	entry.Before, entry.After = state.Before, state.After
+	return entry, nil
+}
+
+func marshalState(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode state: %w", err)
+	}
+	return data, nil
+}
+
+// sequence returns the number of the latest entry, zero when none has been
+// recorded.
+func sequence(tx storage.Tx) (uint64, error) {
+	raw, err := tx.Get(metaBucket, sequenceKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("audit: corrupt sequence: %w", err)
+	}
+	return seq, nil
+}
+
+func entryKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
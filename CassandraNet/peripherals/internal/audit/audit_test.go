@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {
+	// no-op: suppress logging during tests
+}
+
+type state struct {
+	State string `json:"state"`
+}
+
+func TestRecordAndList(t *testing.T) {
+	db := storage.NewMemory()
+	ugc := New(db, "ugc-service", noopLogger{})
+	config := New(db, "config-service", noopLogger{})
+
+	ctx := auth.NewContext(context.Background(), auth.Principal{Subject: "moderator-1"})
+	ctx = logging.WithRequestID(ctx, "req-1")
+	ugc.Record(ctx, Change{
+		Action:    "ugc.content.review",
+		Resource:  "content/c-1",
+		TenantID:  "acme",
+		ProjectID: "p1",
+		Before:    state{State: "pending"},
+		After:     state{State: "approved"},
+	})
+	config.Record(context.Background(), Change{Action: "config.document.delete", Resource: "configs/ugc/prod", Before: state{State: "live"}})
+
+	entries, next, err := config.List(context.Background(), Filter{}, pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(entries) != 2 || next != "" {
+		t.Fatalf("expected 2 entries on one page, got %d (next %q)", len(entries), next)
+	}
+	review := entries[0]
+	if review.Sequence != 1 || review.Service != "ugc-service" || review.Actor != "moderator-1" ||
+		review.TenantID != "acme" || review.RequestID != "req-1" || review.Time.IsZero() {
+		t.Fatalf("unexpected review entry %+v", review)
+	}
+	if string(review.Before) != `{"state":"pending"}` || string(review.After) != `{"state":"approved"}` {
+		t.Fatalf("unexpected states %s -> %s", review.Before, review.After)
+	}
+	deletion := entries[1]
+	if deletion.Sequence != 2 || deletion.Actor != Anonymous || deletion.After != nil {
+		t.Fatalf("unexpected delete entry %+v", deletion)
+	}
+
+	entries, _, err = ugc.List(context.Background(), Filter{Service: "config-service"}, pagination.Request{Limit: 10})
+	if err != nil || len(entries) != 1 || entries[0].Action != "config.document.delete" {
+		t.Fatalf("expected only the config entry, got %+v (%v)", entries, err)
+	}
+
+	first, next, err := ugc.List(context.Background(), Filter{}, pagination.Request{Limit: 1})
+	if err != nil || len(first) != 1 || next == "" {
+		t.Fatalf("expected a first page with a cursor, got %d entries, next %q (%v)", len(first), next, err)
+	}
+	second, next, err := ugc.List(context.Background(), Filter{}, pagination.Request{Limit: 1, After: next})
+	if err != nil || len(second) != 1 || second[0].Sequence != 2 || next != "" {
+		t.Fatalf("unexpected second page %+v, next %q (%v)", second, next, err)
+	}
+}
+
+func TestNilLogRecordsNothing(t *testing.T) {
+	var log *Log
+	log.Record(context.Background(), Change{Action: "ugc.content.review"})
+}
+
+func TestHandlerScopesTenants(t *testing.T) {
+	log := New(storage.NewMemory(), "orchestrator", noopLogger{})
+	for _, tenant := range []string{"acme", "globex"} {
+		log.Record(context.Background(), Change{Action: "orchestration.assignment.cancel", Resource: "assignments/" + tenant, TenantID: tenant})
+	}
+
+	get := func(principal *auth.Principal, target string) (*httptest.ResponseRecorder, pagination.Page[Entry]) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if principal != nil {
+			req = req.WithContext(auth.NewContext(req.Context(), *principal))
+		}
+		rec := httptest.NewRecorder()
+		log.Handler().ServeHTTP(rec, req)
+		var page pagination.Page[Entry]
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rec, page
+	}
+
+	rec, page := get(nil, "/audit")
+	if rec.Code != http.StatusOK || len(page.Items) != 2 {
+		t.Fatalf("expected every entry, got %d %+v", rec.Code, page)
+	}
+	rec, page = get(&auth.Principal{Subject: "ops", Tenant: "acme"}, "/audit")
+	if rec.Code != http.StatusOK || len(page.Items) != 1 || page.Items[0].TenantID != "acme" {
+		t.Fatalf("expected acme's entry only, got %d %+v", rec.Code, page)
+	}
+	if rec, _ = get(&auth.Principal{Subject: "ops", Tenant: "acme"}, "/audit?tenant_id=globex"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another tenant, got %d", rec.Code)
+	}
+	if rec, _ = get(nil, "/audit?limit=0"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad limit, got %d", rec.Code)
+	}
+}
+
+func TestHandlerRequiresAuditRead(t *testing.T) {
+	authn := auth.New(auth.ParseAPIKeys([]string{"k1"}), auth.JWTConfig{})
+	authn.SetPolicy(&auth.Policy{Bindings: []auth.Binding{
+		{Subject: "*", Roles: []auth.Role{auth.RoleModerator}},
+	}})
+	handler := authn.Require(New(storage.NewMemory(), "ugc-service", noopLogger{}).Handler())
+
+	req := httptest.NewRequest(http.MethodGet, "/audit", nil)
+	req.Header.Set(auth.APIKeyHeader, "k1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without audit.read, got %d", rec.Code)
+	}
+}
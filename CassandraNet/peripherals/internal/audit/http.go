@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the audit endpoint.
+const (
+	codeInvalidRequest = "audit.invalid_request"
+	codeUnavailable    = "audit.store_unavailable"
+	codeForbidden      = "audit.forbidden_tenant"
+)
+
+// Path is where services mount Handler.
+const Path = "/audit"
+
+// Handler serves GET /audit: one page of entries, filtered by the service,
+// action, actor, tenant_id, and resource query parameters. Callers bound to
+// a tenant only see that tenant's entries; reading requires
+// auth.PermAuditRead.
+func (l *Log) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, "audit", http.MethodGet)
+			return
+		}
+		query := r.URL.Query()
+		requested := query.Get("tenant_id")
+		tenant, ok := auth.ResolveTenant(r.Context(), requested)
+		if !ok {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermAuditRead, tenant, "") {
+			return
+		}
+		page, err := pagination.Parse(r, pagination.DefaultLimit)
+		if err != nil {
+			if !validation.Write(w, r, codeInvalidRequest, err) {
+				problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+			}
+			return
+		}
+		entries, next, err := l.List(r.Context(), Filter{
+			Service:  query.Get("service"),
+			Action:   query.Get("action"),
+			Actor:    query.Get("actor"),
+			TenantID: tenant,
+			Resource: query.Get("resource"),
+		}, page)
+		if err != nil {
+			logging.For(r.Context(), l.logger).Printf("audit: list entries: %v", err)
+			problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+			return
+		}
+		pagination.Write(w, r, entries, next)
+	})
+}
@@ -0,0 +1,303 @@
+// Package auth authenticates requests with static API keys or JWT bearer
+// tokens and carries the resulting principal, including its tenant, in the
+// request context.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request carries no credentials.
+	ErrUnauthenticated = errors.New("auth: credentials required")
+	// ErrInvalidAPIKey is returned for unknown API keys.
+	ErrInvalidAPIKey = errors.New("auth: invalid api key")
+	// ErrInvalidToken is returned for tokens that are malformed, signed with
+	// an unknown key or algorithm, or carry claims that fail validation.
+	ErrInvalidToken = errors.New("auth: invalid token")
+)
+
+// APIKeyHeader carries static API keys.
+const APIKeyHeader = "X-API-Key"
+
+// Authentication methods recorded on a Principal.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+	MethodMTLS   = "mtls"
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string `json:"subject"`
+	Method  string `json:"method"`
+	// Tenant is the tenant the caller is bound to; empty means the caller
+	// may act for any tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Project is the project the caller is bound to within its tenant;
+	// empty means any project.
+	Project string   `json:"project,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal carried by ctx.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// APIKey is a static credential, optionally bound to a tenant and a project
+// within it.
+type APIKey struct {
+	Key     string
+	Tenant  string
+	Project string
+}
+
+// ParseAPIKeys parses entries of the form "key", "tenant:key", or
+// "tenant/project:key".
+func ParseAPIKeys(entries []string) []APIKey {
+	keys := make([]APIKey, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key := APIKey{Key: entry}
+		if scope, secret, ok := strings.Cut(entry, ":"); ok {
+			tenant, project, _ := strings.Cut(scope, "/")
+			key = APIKey{Key: secret, Tenant: tenant, Project: project}
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Authenticator validates API keys and JWT bearer tokens.
+type Authenticator struct {
+	jwt         JWTConfig
+	keys        []apiKey
+	clientCerts bool
+	policy      atomic.Pointer[Policy]
+	public      map[string]bool
+	now         func() time.Time
+}
+
+type apiKey struct {
+	digest  [sha256.Size]byte
+	tenant  string
+	project string
+	label   string
+}
+
+// New constructs an authenticator accepting keys and tokens matching jwt.
+// Requests to /healthz are always allowed.
+func New(keys []APIKey, jwt JWTConfig) *Authenticator {
+	a := &Authenticator{
+		jwt:    jwt,
+		public: map[string]bool{"/healthz": true},
+		now:    time.Now,
+	}
+	for _, k := range keys {
+		a.keys = append(a.keys, apiKey{
+			digest:  sha256.Sum256([]byte(k.Key)),
+			tenant:  k.Tenant,
+			project: k.Project,
+			label:   keyLabel(k.Key),
+		})
+	}
+	return a
+}
+
+// FromConfig reads AUTH_API_KEYS, AUTH_JWT_SECRET, AUTH_JWT_PUBLIC_KEY_FILE,
+// AUTH_JWT_ISSUER, AUTH_JWT_AUDIENCE, AUTH_JWT_TENANT_CLAIM,
+// AUTH_JWT_PROJECT_CLAIM, AUTH_JWT_LEEWAY, and AUTH_POLICY_FILE from loader. Setting
+// TLS_CLIENT_CA_FILE also accepts verified client certificates. With none of
+// the credentials set the authenticator is disabled and lets every request
+// through.
+func FromConfig(loader config.Loader) (*Authenticator, error) {
+	jwt := JWTConfig{
+		Secret:       []byte(loader.Secret("AUTH_JWT_SECRET", "")),
+		Issuer:       loader.String("AUTH_JWT_ISSUER", ""),
+		Audience:     loader.String("AUTH_JWT_AUDIENCE", ""),
+		TenantClaim:  loader.String("AUTH_JWT_TENANT_CLAIM", "tenant_id"),
+		ProjectClaim: loader.String("AUTH_JWT_PROJECT_CLAIM", "project_id"),
+		Leeway:       loader.Duration("AUTH_JWT_LEEWAY", 30*time.Second),
+	}
+	if path := loader.String("AUTH_JWT_PUBLIC_KEY_FILE", ""); path != "" {
+		keys, err := LoadPublicKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		jwt.PublicKeys = keys
+	}
+	keys := ParseAPIKeys(loader.StringSlice("AUTH_API_KEYS", nil))
+	a := New(keys, jwt)
+	a.AcceptClientCertificates(loader.String("TLS_CLIENT_CA_FILE", "") != "")
+	policy, err := a.policyFromConfig(loader)
+	if err != nil {
+		return nil, err
+	}
+	a.SetPolicy(policy)
+	return a, nil
+}
+
+// policyFromConfig loads the policy named by AUTH_POLICY_FILE, or returns
+// nil when none is.
+func (a *Authenticator) policyFromConfig(loader config.Loader) (*Policy, error) {
+	path := loader.String("AUTH_POLICY_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	if !a.Enabled() {
+		return nil, errors.New("auth: AUTH_POLICY_FILE needs API keys or JWT keys to be configured")
+	}
+	return LoadPolicy(path)
+}
+
+// ReloadPolicy prepares the policy named by AUTH_POLICY_FILE for
+// server.Reloader, re-reading the file even when its name is unchanged.
+// Credentials are fixed at startup.
+func (a *Authenticator) ReloadPolicy(loader config.Loader) (func(), error) {
+	policy, err := a.policyFromConfig(loader)
+	if err != nil {
+		return nil, err
+	}
+	return func() { a.SetPolicy(policy) }, nil
+}
+
+// AcceptClientCertificates treats a verified TLS client certificate as a
+// credential, identified by server.PeerIdentity, when a request carries no
+// API key or bearer token.
+func (a *Authenticator) AcceptClientCertificates(accept bool) {
+	a.clientCerts = accept
+}
+
+// SetPolicy enables role checks against policy for requests passing through
+// Require; nil disables them. Requests already authenticated keep the
+// policy they started with.
+func (a *Authenticator) SetPolicy(policy *Policy) {
+	a.policy.Store(policy)
+}
+
+// Enabled reports whether any credentials are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || a.jwt.enabled() || a.clientCerts
+}
+
+// Authenticate identifies the caller of r from an API key, a bearer token,
+// or a verified client certificate, in that order. It returns
+// ErrUnauthenticated when r carries no credentials and ErrInvalidToken or
+// ErrInvalidAPIKey when they do not verify.
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.verifyAPIKey(key)
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		if id, ok := server.ClientIdentity(r); ok && a.clientCerts {
+			return Principal{Subject: id, Method: MethodMTLS}, nil
+		}
+		return Principal{}, ErrUnauthenticated
+	}
+	if !a.jwt.enabled() {
+		// Without JWT keys a bearer credential can only be an API key.
+		return a.verifyAPIKey(token)
+	}
+	return verifyJWT(a.jwt, strings.TrimSpace(token), a.now())
+}
+
+func (a *Authenticator) verifyAPIKey(key string) (Principal, error) {
+	digest := sha256.Sum256([]byte(key))
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(digest[:], k.digest[:]) == 1 {
+			return Principal{Subject: "api-key/" + k.label, Method: MethodAPIKey, Tenant: k.tenant, Project: k.project}, nil
+		}
+	}
+	return Principal{}, ErrInvalidAPIKey
+}
+
+// Require wraps next so that requests must authenticate. The principal, and
+// the policy if one is set, are stored in the request context, and the
+// request then passes through Tenancy. A disabled authenticator only applies
+// Tenancy.
+func (a *Authenticator) Require(next http.Handler) http.Handler {
+	next = Tenancy(next)
+	if !a.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.public[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cassandra"`)
+			code := "auth.invalid_credentials"
+			if err == ErrUnauthenticated {
+				code = "auth.unauthenticated"
+			}
+			problem.Write(w, r, http.StatusUnauthorized, code, err.Error())
+			return
+		}
+		ctx := NewContext(r.Context(), p)
+		logging.AddAccessFields(ctx, "subject", p.Subject)
+		if p.Tenant != "" && logging.TenantID(ctx) == "" {
+			logging.AddAccessFields(ctx, "tenant_id", p.Tenant)
+		}
+		if policy := a.policy.Load(); policy != nil {
+			ctx = withPolicy(ctx, policy)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// keyLabel identifies a key in logs without revealing it.
+func keyLabel(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("%x", sum[:4])
+}
+
+// Transport adds an API key to every outgoing request, for service-to-service
+// calls into endpoints guarded by Require. An empty key returns base.
+func Transport(apiKey string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if apiKey == "" {
+		return base
+	}
+	return roundTripper{key: apiKey, base: base}
+}
+
+type roundTripper struct {
+	key  string
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(APIKeyHeader, t.key)
+	return t.base.RoundTrip(r)
+}
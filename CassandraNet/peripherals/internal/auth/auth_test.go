@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWTHS256(t *testing.T) {
+	secret := []byte("s3cret")
+	now := time.Unix(1_700_000_000, 0)
+	cfg := JWTConfig{Secret: secret, Issuer: "cassandra", Audience: "messaging"}
+	valid := map[string]any{
+		"sub":       "svc-a",
+		"iss":       "cassandra",
+		"aud":       []string{"messaging", "ugc"},
+		"exp":       now.Add(time.Minute).Unix(),
+		"tenant_id": "acme",
+		"roles":     []string{"publisher"},
+		"scope":     "read write",
+	}
+
+	p, err := verifyJWT(cfg, signHS256(t, secret, valid), now)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.Subject != "svc-a" || p.Tenant != "acme" || p.Method != MethodJWT {
+		t.Fatalf("unexpected principal %+v", p)
+	}
+	if len(p.Roles) != 3 || p.Roles[0] != "publisher" || p.Roles[2] != "write" {
+		t.Fatalf("unexpected roles %v", p.Roles)
+	}
+
+	cases := map[string]func(map[string]any){
+		"expired":      func(c map[string]any) { c["exp"] = now.Add(-time.Minute).Unix() },
+		"no exp":       func(c map[string]any) { delete(c, "exp") },
+		"string exp":   func(c map[string]any) { c["exp"] = "tomorrow" },
+		"not yet":      func(c map[string]any) { c["nbf"] = now.Add(time.Minute).Unix() },
+		"wrong issuer": func(c map[string]any) { c["iss"] = "other" },
+		"wrong aud":    func(c map[string]any) { c["aud"] = "ugc" },
+	}
+	for name, mutate := range cases {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		mutate(claims)
+		if _, err := verifyJWT(cfg, signHS256(t, secret, claims), now); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	if _, err := verifyJWT(cfg, signHS256(t, []byte("other"), valid), now); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("wrong secret: expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestVerifyJWTES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signed := encodeSegment(t, map[string]string{"alg": "ES256"}) + "." + encodeSegment(t, map[string]any{"sub": "agent-7", "exp": time.Now().Add(time.Minute).Unix()})
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	cfg := JWTConfig{PublicKeys: []crypto.PublicKey{&key.PublicKey}}
+	p, err := verifyJWT(cfg, token, time.Now())
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if p.Subject != "agent-7" {
+		t.Fatalf("unexpected subject %q", p.Subject)
+	}
+	// An HMAC configuration must not accept the asymmetric token.
+	if _, err := verifyJWT(JWTConfig{Secret: []byte("x")}, token, time.Now()); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	authn := New(ParseAPIKeys([]string{"global-key", "acme:acme-key"}), JWTConfig{})
+	var seen Principal
+	var seenTenant string
+	handler := logging.Middleware(logging.New("test"), authn.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+		seenTenant = logging.TenantID(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	serve := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for k, v := range header {
+			req.Header.Set(k, v[0])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("/topics", nil); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("expected 401 with challenge, got %d", rec.Code)
+	}
+	if rec := serve("/topics", http.Header{APIKeyHeader: {"nope"}}); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown key, got %d", rec.Code)
+	}
+	if rec := serve("/healthz", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected /healthz to stay public, got %d", rec.Code)
+	}
+
+	if rec := serve("/topics", http.Header{"Authorization": {"Bearer acme-key"}}); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected bearer api key to pass, got %d", rec.Code)
+	}
+	if seen.Method != MethodAPIKey || seen.Tenant != "acme" || seenTenant != "acme" {
+		t.Fatalf("unexpected principal %+v tenant %q", seen, seenTenant)
+	}
+
+	if rec := serve("/topics?tenant_id=globex", http.Header{APIKeyHeader: {"acme-key"}}); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for tenant mismatch, got %d", rec.Code)
+	}
+	if rec := serve("/topics?tenant_id=globex", http.Header{APIKeyHeader: {"global-key"}}); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected unbound key to pass, got %d", rec.Code)
+	}
+	if seenTenant != "globex" {
+		t.Fatalf("expected requested tenant to be kept, got %q", seenTenant)
+	}
+}
+
+func TestResolveTenant(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if tenant, ok := ResolveTenant(req.Context(), "acme"); !ok || tenant != "acme" {
+		t.Fatalf("anonymous: got %q %v", tenant, ok)
+	}
+	ctx := NewContext(req.Context(), Principal{Tenant: "acme"})
+	if tenant, ok := ResolveTenant(ctx, ""); !ok || tenant != "acme" {
+		t.Fatalf("default: got %q %v", tenant, ok)
+	}
+	if _, ok := ResolveTenant(ctx, "globex"); ok {
+		t.Fatal("expected other tenant to be refused")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(APIKeyHeader)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: Transport("k1", nil)}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if got != "k1" {
+		t.Fatalf("expected api key header, got %q", got)
+	}
+}
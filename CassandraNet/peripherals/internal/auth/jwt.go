@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTConfig describes which bearer tokens are accepted.
+type JWTConfig struct {
+	// Secret verifies HS256/HS384/HS512 tokens.
+	Secret []byte
+	// PublicKeys verify RS*/ES* tokens. Each key is tried in turn.
+	PublicKeys []crypto.PublicKey
+	// Issuer, when set, must equal the iss claim.
+	Issuer string
+	// Audience, when set, must appear in the aud claim.
+	Audience string
+	// TenantClaim names the claim holding the tenant ID (default
+	// "tenant_id").
+	TenantClaim string
+	// ProjectClaim names the claim holding the project ID (default
+	// "project_id").
+	ProjectClaim string
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+}
+
+func (c JWTConfig) enabled() bool {
+	return len(c.Secret) > 0 || len(c.PublicKeys) > 0
+}
+
+// LoadPublicKeys reads every PEM-encoded RSA or ECDSA public key (PKIX
+// "PUBLIC KEY" blocks or certificates) from path.
+func LoadPublicKeys(path string) ([]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var key any
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "RSA PUBLIC KEY":
+			key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth: parse %s in %s: %w", block.Type, path, err)
+		}
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+			keys = append(keys, key)
+		default:
+			return nil, fmt.Errorf("auth: unsupported key type %T in %s", key, path)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("auth: no public keys found in %s", path)
+	}
+	return keys, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// verifyJWT checks token's signature and standard claims, which must
+// include exp, and returns the resulting principal.
+func verifyJWT(cfg JWTConfig, token string, now time.Time) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if !verifySignature(cfg, header.Alg, parts[0]+"."+parts[1], sig) {
+		return Principal{}, ErrInvalidToken
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if err := validateClaims(cfg, claims, now); err != nil {
+		return Principal{}, err
+	}
+
+	tenantClaim := cfg.TenantClaim
+	if tenantClaim == "" {
+		tenantClaim = "tenant_id"
+	}
+	projectClaim := cfg.ProjectClaim
+	if projectClaim == "" {
+		projectClaim = "project_id"
+	}
+	p := Principal{Method: MethodJWT}
+	p.Subject, _ = claims["sub"].(string)
+	p.Tenant, _ = claims[tenantClaim].(string)
+	p.Project, _ = claims[projectClaim].(string)
+	p.Roles = stringList(claims["roles"])
+	if scope, ok := claims["scope"].(string); ok {
+		p.Roles = append(p.Roles, strings.Fields(scope)...)
+	}
+	return p, nil
+}
+
+func validateClaims(cfg JWTConfig, claims map[string]any, now time.Time) error {
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(cfg.Leeway)) {
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: not yet valid", ErrInvalidToken)
+	}
+	if cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != cfg.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if cfg.Audience != "" && !contains(stringList(claims["aud"]), cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+func verifySignature(cfg JWTConfig, alg, signed string, sig []byte) bool {
+	switch alg {
+	case "HS256", "HS384", "HS512":
+		if len(cfg.Secret) == 0 {
+			return false
+		}
+		mac := hmac.New(hashFor(alg), cfg.Secret)
+		mac.Write([]byte(signed))
+		return hmac.Equal(mac.Sum(nil), sig)
+	case "RS256", "RS384", "RS512":
+		h, digest := digestFor(alg, signed)
+		for _, key := range cfg.PublicKeys {
+			if rsaKey, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(rsaKey, h, digest, sig) == nil {
+				return true
+			}
+		}
+	case "ES256", "ES384", "ES512":
+		_, digest := digestFor(alg, signed)
+		for _, key := range cfg.PublicKeys {
+			ecKey, ok := key.(*ecdsa.PublicKey)
+			if !ok {
+				continue
+			}
+			size := (ecKey.Curve.Params().BitSize + 7) / 8
+			if len(sig) != 2*size {
+				continue
+			}
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			if ecdsa.Verify(ecKey, digest, r, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hashFor(alg string) func() hash.Hash {
+	switch alg[2:] {
+	case "384":
+		return sha512.New384
+	case "512":
+		return sha512.New
+	default:
+		return sha256.New
+	}
+}
+
+func digestFor(alg, signed string) (crypto.Hash, []byte) {
+	h := crypto.SHA256
+	switch alg[2:] {
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	}
+	d := h.New()
+	d.Write([]byte(signed))
+	return h, d.Sum(nil)
+}
+
+func decodeSegment(seg string, out any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func numericDate(v any) (time.Time, bool) {
+	f, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+}
+
+// stringList accepts a JSON string or array of strings.
+func stringList(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
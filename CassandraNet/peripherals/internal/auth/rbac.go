@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// ErrPermissionDenied is returned when a principal lacks the permission a
+// route requires.
+var ErrPermissionDenied = errors.New("auth: permission denied")
+
+// Role names a fixed set of permissions.
+type Role string
+
+// Built-in roles.
+const (
+	RolePublisher Role = "publisher"
+	RoleConsumer  Role = "consumer"
+	RoleModerator Role = "moderator"
+	RoleOperator  Role = "operator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission names an action guarded by a route.
+type Permission string
+
+// Permissions checked by the service APIs.
+const (
+	PermMessagesPublish         Permission = "messages.publish"
+	PermMessagesConsume         Permission = "messages.consume"
+	PermUGCSubmit               Permission = "ugc.submit"
+	PermUGCRead                 Permission = "ugc.read"
+	PermUGCModerate             Permission = "ugc.moderate"
+	PermAssignmentsRead         Permission = "assignments.read"
+	PermAssignmentsWrite        Permission = "assignments.write"
+	PermAssignmentsUpdate       Permission = "assignments.update"
+	PermAgentsManage            Permission = "agents.manage"
+	PermNotificationsSend       Permission = "notifications.send"
+	PermNotificationsRead       Permission = "notifications.read"
+	PermLogsWrite               Permission = "logs.write"
+	PermLogsRead                Permission = "logs.read"
+	PermMetricsWrite            Permission = "metrics.write"
+	PermMetricsRead             Permission = "metrics.read"
+	PermAlertsManage            Permission = "alerts.manage"
+	PermScrapeManage            Permission = "scrape.manage"
+	PermRegistryRead            Permission = "registry.read"
+	PermRegistryWrite           Permission = "registry.write"
+	PermTemplatesManage         Permission = "templates.manage"
+	PermSuppressionsManage      Permission = "suppressions.manage"
+	PermWorkloadTemplatesManage Permission = "workload_templates.manage"
+	PermAuditRead               Permission = "audit.read"
+	PermFlagsRead               Permission = "flags.read"
+	PermFlagsManage             Permission = "flags.manage"
+	PermSchedulesRead           Permission = "schedules.read"
+	PermSchedulesManage         Permission = "schedules.manage"
+	PermWebhooksRead            Permission = "webhooks.read"
+	PermWebhooksManage          Permission = "webhooks.manage"
+	PermUsageRead               Permission = "usage.read"
+	PermRetentionRead           Permission = "retention.read"
+	PermRetentionManage         Permission = "retention.manage"
+	PermReplicationRead         Permission = "replication.read"
+	PermReplicationWrite        Permission = "replication.write"
+	PermEncryptionRead          Permission = "encryption.read"
+	PermEncryptionManage        Permission = "encryption.manage"
+	PermPresenceRead            Permission = "presence.read"
+	PermPresenceWrite           Permission = "presence.write"
+	PermRoutesRead              Permission = "routes.read"
+	PermRoutesManage            Permission = "routes.manage"
+	PermTopicKeysManage         Permission = "topic_keys.manage"
+	PermTopicsRead              Permission = "topics.read"
+	PermTopicsManage            Permission = "topics.manage"
+	PermDebug                   Permission = "debug"
+)
+
+// rolePermissions lists what each role grants; admin grants everything.
+var rolePermissions = map[Role][]Permission{
+	RolePublisher: {PermMessagesPublish, PermTopicsRead, PermUGCSubmit, PermNotificationsSend, PermLogsWrite, PermMetricsWrite, PermRegistryRead, PermRegistryWrite, PermPresenceWrite, PermReplicationWrite},
+	RoleConsumer:  {PermMessagesConsume, PermTopicsRead, PermUGCRead, PermAssignmentsRead, PermAssignmentsUpdate, PermNotificationsRead, PermRegistryRead, PermFlagsRead, PermPresenceRead},
+	RoleModerator: {PermUGCRead, PermUGCModerate},
+	RoleOperator:  {PermAssignmentsRead, PermAssignmentsWrite, PermAgentsManage, PermNotificationsRead, PermLogsRead, PermMetricsRead, PermAlertsManage, PermScrapeManage, PermRegistryRead, PermTemplatesManage, PermSuppressionsManage, PermWorkloadTemplatesManage, PermAuditRead, PermFlagsRead, PermFlagsManage, PermSchedulesRead, PermSchedulesManage, PermWebhooksRead, PermWebhooksManage, PermUsageRead, PermRetentionRead, PermRetentionManage, PermReplicationRead, PermEncryptionRead, PermEncryptionManage, PermPresenceRead, PermRoutesRead, PermRoutesManage, PermTopicKeysManage, PermTopicsRead, PermTopicsManage, PermDebug},
+	RoleAdmin:     nil,
+}
+
+// Grants reports whether role includes perm.
+func (r Role) Grants(perm Permission) bool {
+	if r == RoleAdmin {
+		return true
+	}
+	for _, p := range rolePermissions[r] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+func validRole(r Role) bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Binding grants roles to a subject, optionally limited to one tenant and
+// project. An empty Tenant or Project matches any; Subject "*" matches every
+// authenticated caller.
+type Binding struct {
+	Subject string `json:"subject"`
+	Tenant  string `json:"tenant,omitempty"`
+	Project string `json:"project,omitempty"`
+	Roles   []Role `json:"roles"`
+}
+
+func (b Binding) matches(subject, tenant, project string) bool {
+	if b.Subject != "*" && b.Subject != subject {
+		return false
+	}
+	if b.Tenant != "" && b.Tenant != tenant {
+		return false
+	}
+	return b.Project == "" || b.Project == project
+}
+
+// Policy maps principals to roles. Roles carried by a principal itself (the
+// roles claim of a JWT) apply across its tenant in addition to the bindings.
+type Policy struct {
+	Bindings []Binding `json:"bindings"`
+}
+
+// LoadPolicy reads a JSON policy document from path.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("auth: parse policy %s: %w", path, err)
+	}
+	for i, b := range policy.Bindings {
+		if b.Subject == "" {
+			return nil, fmt.Errorf("auth: policy %s: binding %d has no subject", path, i)
+		}
+		for _, role := range b.Roles {
+			if !validRole(role) {
+				return nil, fmt.Errorf("auth: policy %s: unknown role %q", path, role)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// Allows reports whether p may perform perm on a resource owned by tenant
+// and project.
+func (pol *Policy) Allows(p Principal, perm Permission, tenant, project string) bool {
+	if p.Tenant != "" && tenant != p.Tenant {
+		return false
+	}
+	for _, name := range p.Roles {
+		if role := Role(name); validRole(role) && role.Grants(perm) {
+			return true
+		}
+	}
+	for _, b := range pol.Bindings {
+		if !b.matches(p.Subject, tenant, project) {
+			continue
+		}
+		for _, role := range b.Roles {
+			if role.Grants(perm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type policyKey struct{}
+
+func withPolicy(ctx context.Context, policy *Policy) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// Authorize checks that the caller in ctx may perform perm on a resource
+// owned by tenant and project. Resources of a tenant or project other than
+// the request's (see Tenancy) are refused; beyond that, permissions are
+// only enforced when the authenticator has a policy. Otherwise, requests
+// that did not pass through Require are allowed.
+func Authorize(ctx context.Context, perm Permission, tenant, project string) error {
+	if _, ok := ResolveTenant(ctx, tenant); !ok {
+		return fmt.Errorf("%w: resource belongs to another tenant", ErrPermissionDenied)
+	}
+	if _, ok := ResolveProject(ctx, project); !ok {
+		return fmt.Errorf("%w: resource belongs to another project", ErrPermissionDenied)
+	}
+	p, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	policy, _ := ctx.Value(policyKey{}).(*Policy)
+	if policy == nil || policy.Allows(p, perm, tenant, project) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s requires %s", ErrPermissionDenied, p.Subject, perm)
+}
+
+// Allow calls Authorize and, when it fails, writes a 403 problem with code
+// auth.permission_denied. It reports whether the handler may continue.
+func Allow(w http.ResponseWriter, r *http.Request, perm Permission, tenant, project string) bool {
+	if err := Authorize(r.Context(), perm, tenant, project); err != nil {
+		problem.Write(w, r, http.StatusForbidden, "auth.permission_denied", err.Error())
+		return false
+	}
+	return true
+}
+
+// Guard requires read for GET and HEAD requests and write for every other
+// method, scoped to the request's tenant. It suits services whose resources
+// are not owned by a project; tenant-scoped APIs call Allow from their
+// handlers instead.
+func Guard(read, write Permission, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		perm := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			perm = read
+		}
+		if !Allow(w, r, perm, logging.TenantID(r.Context()), "") {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
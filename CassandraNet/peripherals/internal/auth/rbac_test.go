@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyAllows(t *testing.T) {
+	policy := &Policy{Bindings: []Binding{
+		{Subject: "mod", Tenant: "acme", Project: "p1", Roles: []Role{RoleModerator}},
+		{Subject: "pub", Tenant: "acme", Roles: []Role{RolePublisher}},
+		{Subject: "*", Roles: []Role{RoleConsumer}},
+	}}
+	mod := Principal{Subject: "mod"}
+	pub := Principal{Subject: "pub"}
+
+	cases := []struct {
+		name    string
+		p       Principal
+		perm    Permission
+		tenant  string
+		project string
+		want    bool
+	}{
+		{"moderator in scope", mod, PermUGCModerate, "acme", "p1", true},
+		{"moderator other project", mod, PermUGCModerate, "acme", "p2", false},
+		{"moderator cannot publish", mod, PermMessagesPublish, "acme", "p1", false},
+		{"publisher any project", pub, PermMessagesPublish, "acme", "p9", true},
+		{"publisher other tenant", pub, PermMessagesPublish, "globex", "p1", false},
+		{"wildcard consumer", pub, PermMessagesConsume, "globex", "", true},
+		{"consumer cannot moderate", Principal{Subject: "agent"}, PermUGCModerate, "acme", "p1", false},
+		{"token roles", Principal{Subject: "t", Tenant: "acme", Roles: []string{"admin"}}, PermDebug, "acme", "", true},
+		{"token roles stay in tenant", Principal{Subject: "t", Tenant: "acme", Roles: []string{"admin"}}, PermDebug, "globex", "", false},
+	}
+	for _, tc := range cases {
+		if got := policy.Allows(tc.p, tc.perm, tc.tenant, tc.project); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLoadPolicyRejectsUnknownRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"bindings":[{"subject":"x","roles":["superuser"]}]}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadPolicy(path); err == nil {
+		t.Fatal("expected unknown role to be rejected")
+	}
+}
+
+func TestRequireEnforcesPolicy(t *testing.T) {
+	authn := New(ParseAPIKeys([]string{"mod-key", "pub-key"}), JWTConfig{})
+	authn.SetPolicy(&Policy{Bindings: []Binding{
+		{Subject: "api-key/" + keyLabel("mod-key"), Roles: []Role{RoleModerator}},
+		{Subject: "api-key/" + keyLabel("pub-key"), Roles: []Role{RolePublisher}},
+	}})
+	handler := authn.Require(Guard(PermUGCRead, PermMessagesPublish, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+
+	serve := func(method, key string) int {
+		req := httptest.NewRequest(method, "/topics/t/messages", nil)
+		req.Header.Set(APIKeyHeader, key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve(http.MethodPost, "mod-key"); code != http.StatusForbidden {
+		t.Fatalf("expected moderator publish to be refused, got %d", code)
+	}
+	if code := serve(http.MethodGet, "mod-key"); code != http.StatusNoContent {
+		t.Fatalf("expected moderator read to pass, got %d", code)
+	}
+	if code := serve(http.MethodPost, "pub-key"); code != http.StatusNoContent {
+		t.Fatalf("expected publisher publish to pass, got %d", code)
+	}
+}
+
+func TestAuthorizeWithoutPolicy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := Authorize(req.Context(), PermDebug, "acme", ""); err != nil {
+		t.Fatalf("anonymous request: %v", err)
+	}
+	ctx := NewContext(req.Context(), Principal{Subject: "k", Tenant: "acme"})
+	if err := Authorize(ctx, PermDebug, "acme", ""); err != nil {
+		t.Fatalf("no policy: %v", err)
+	}
+	if err := Authorize(ctx, PermDebug, "globex", ""); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected other tenant to be denied, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Tenancy settles the tenant and project a request acts for, so handlers
+// stop trusting each payload to name them honestly. The request names them
+// in X-Tenant-ID and X-Project-ID, or the tenant_id and project_id query
+// parameters. A caller whose credentials are bound to a tenant or project
+// acts for that one instead, and is refused with 403 when the request names
+// another. The settled values are stored in the context with
+// logging.WithTenantID and logging.WithProjectID, where ResolveTenant,
+// ResolveProject, and Authorize hold payloads and records to them.
+func Tenancy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := FromContext(r.Context())
+		tenant, ok := settle(p.Tenant, logging.Requested(r, logging.TenantIDHeader, "tenant_id"))
+		if !ok {
+			problem.Write(w, r, http.StatusForbidden, "auth.tenant_mismatch", fmt.Sprintf("credentials are not valid for tenant %s", logging.Requested(r, logging.TenantIDHeader, "tenant_id")))
+			return
+		}
+		project, ok := settle(p.Project, logging.Requested(r, logging.ProjectIDHeader, "project_id"))
+		if !ok {
+			problem.Write(w, r, http.StatusForbidden, "auth.project_mismatch", fmt.Sprintf("credentials are not valid for project %s", logging.Requested(r, logging.ProjectIDHeader, "project_id")))
+			return
+		}
+		ctx := r.Context()
+		var kv []any
+		if tenant != logging.TenantID(ctx) {
+			ctx = logging.WithTenantID(ctx, tenant)
+			kv = append(kv, "tenant_id", tenant)
+		}
+		if project != logging.ProjectID(ctx) {
+			ctx = logging.WithProjectID(ctx, project)
+			kv = append(kv, "project_id", project)
+		}
+		if l, ok := logging.FromContext(ctx); ok && len(kv) > 0 {
+			ctx = logging.NewContext(ctx, l.With(kv...))
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ResolveTenant returns the tenant a request may act for when a payload or
+// query names requested. The tenant settled by Tenancy, or the caller's
+// bound tenant, wins: an empty requested takes it and any other value is
+// refused. Without either, requested is returned unchanged.
+func ResolveTenant(ctx context.Context, requested string) (string, bool) {
+	p, _ := FromContext(ctx)
+	if p.Tenant != "" {
+		return settle(p.Tenant, requested)
+	}
+	return settle(logging.TenantID(ctx), requested)
+}
+
+// ResolveProject is ResolveTenant for the project.
+func ResolveProject(ctx context.Context, requested string) (string, bool) {
+	p, _ := FromContext(ctx)
+	if p.Project != "" {
+		return settle(p.Project, requested)
+	}
+	return settle(logging.ProjectID(ctx), requested)
+}
+
+// settle returns bound unless it is empty, and reports whether requested
+// agrees with it.
+func settle(bound, requested string) (string, bool) {
+	if bound == "" {
+		return requested, true
+	}
+	return bound, requested == "" || requested == bound
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+func TestParseAPIKeysWithProject(t *testing.T) {
+	keys := ParseAPIKeys([]string{"k0", "acme:k1", "acme/p1:k2"})
+	want := []APIKey{{Key: "k0"}, {Key: "k1", Tenant: "acme"}, {Key: "k2", Tenant: "acme", Project: "p1"}}
+	for i, key := range keys {
+		if key != want[i] {
+			t.Fatalf("key %d: got %+v want %+v", i, key, want[i])
+		}
+	}
+}
+
+func TestTenancy(t *testing.T) {
+	authn := New(ParseAPIKeys([]string{"global-key", "acme/p1:project-key"}), JWTConfig{})
+	var tenant, project string
+	handler := logging.Middleware(logging.New("test"), authn.Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, project = logging.TenantID(r.Context()), logging.ProjectID(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	serve := func(target, key string, header map[string]string) int {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(APIKeyHeader, key)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := serve("/content", "project-key", nil); code != http.StatusNoContent || tenant != "acme" || project != "p1" {
+		t.Fatalf("expected the key's scope, got %d %q/%q", code, tenant, project)
+	}
+	if code := serve("/content?project_id=p2", "project-key", nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another project, got %d", code)
+	}
+	if code := serve("/content", "project-key", map[string]string{logging.TenantIDHeader: "globex"}); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another tenant, got %d", code)
+	}
+	if code := serve("/content", "global-key", map[string]string{logging.ProjectIDHeader: "p9"}); code != http.StatusNoContent || tenant != "" || project != "p9" {
+		t.Fatalf("expected the requested project, got %d %q/%q", code, tenant, project)
+	}
+}
+
+func TestTenancyWithoutAuthentication(t *testing.T) {
+	var tenant string
+	handler := New(nil, JWTConfig{}).Require(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ = ResolveTenant(r.Context(), "")
+		if _, ok := ResolveTenant(r.Context(), "globex"); ok {
+			t.Error("expected a payload naming another tenant to be refused")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/content", nil)
+	req.Header.Set(logging.TenantIDHeader, "acme")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || tenant != "acme" {
+		t.Fatalf("expected the header's tenant, got %d %q", rec.Code, tenant)
+	}
+}
+
+func TestAuthorizeRefusesOtherScopes(t *testing.T) {
+	ctx := logging.WithProjectID(logging.WithTenantID(context.Background(), "acme"), "p1")
+	if err := Authorize(ctx, PermUGCModerate, "acme", "p1"); err != nil {
+		t.Fatalf("expected the request's own scope to pass, got %v", err)
+	}
+	if err := Authorize(ctx, PermUGCModerate, "globex", "p1"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected another tenant to be refused, got %v", err)
+	}
+	if err := Authorize(ctx, PermUGCModerate, "acme", "p2"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected another project to be refused, got %v", err)
+	}
+}
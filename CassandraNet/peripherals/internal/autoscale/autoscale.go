@@ -0,0 +1,326 @@
+// Package autoscale sizes in-process queues from how full they run. Each
+// Target reports its queue depth and applies a new size, such as the UGC
+// worker pool's worker count or the log pipeline's buffer, and a Controller
+// samples every target on an interval. When a target's average utilization
+// over a window of samples crosses a threshold, the controller grows or
+// shrinks it within the target's bounds:
+//
+//	cfg, err := autoscale.FromConfig(loader)
+//	ctl := autoscale.New(cfg, "ugc-worker", bus, logger)
+//	err = ctl.Add(autoscale.Target{Name: "workers", ...})
+//	group.Go("autoscale", ctl.Run)
+//
+// Every change is kept as a Decision, served by Handler at /autoscale, and
+// published as an eventbus.PoolScaled event.
+package autoscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// Resources a target sizes.
+const (
+	ResourceWorkers = "workers"
+	ResourceBuffer  = "buffer"
+)
+
+// ErrBounds is returned by Controller.Add for a target whose bounds are
+// unusable.
+var ErrBounds = errors.New("autoscale: bounds must satisfy 1 <= min <= max")
+
+// Target is one queue the controller sizes.
+type Target struct {
+	// Name identifies the target within its service, such as "workers".
+	Name string
+	// Resource is what Resize changes: ResourceWorkers or ResourceBuffer.
+	Resource string
+	// Min and Max bound the sizes the controller applies.
+	Min, Max int
+	// Depth reports how many items are queued and how many fit.
+	Depth func() (queued, capacity int)
+	// Size reports the current size, which others may change too, such as
+	// a configuration reload.
+	Size func() int
+	// Resize applies a new size.
+	Resize func(size int)
+}
+
+// Config tunes a Controller. Zero values select the defaults.
+type Config struct {
+	// Interval between samples (default 5s).
+	Interval time.Duration
+	// Window is how many samples are averaged before a decision (default 6).
+	Window int
+	// ScaleUpAt is the average utilization, queued over capacity, at or
+	// above which a target grows (default 0.5).
+	ScaleUpAt float64
+	// ScaleDownAt is the average utilization at or below which a target
+	// shrinks (default 0.1).
+	ScaleDownAt float64
+	// Cooldown is how long a target is left alone after it changes
+	// (default 30s).
+	Cooldown time.Duration
+	// History is how many decisions are kept (default 50).
+	History int
+}
+
+// FromConfig reads AUTOSCALE_INTERVAL (default 5s), AUTOSCALE_WINDOW
+// (default 6), AUTOSCALE_SCALE_UP_AT (default 0.5), AUTOSCALE_SCALE_DOWN_AT
+// (default 0.1), AUTOSCALE_COOLDOWN (default 30s), and AUTOSCALE_HISTORY
+// (default 50). Thresholds that overlap or fall outside 0..1 are reported
+// rather than ignored.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg := Config{
+		Interval:    loader.Duration("AUTOSCALE_INTERVAL", 5*time.Second),
+		Window:      loader.Int("AUTOSCALE_WINDOW", 6),
+		ScaleUpAt:   loader.Float64("AUTOSCALE_SCALE_UP_AT", 0.5),
+		ScaleDownAt: loader.Float64("AUTOSCALE_SCALE_DOWN_AT", 0.1),
+		Cooldown:    loader.Duration("AUTOSCALE_COOLDOWN", 30*time.Second),
+		History:     loader.Int("AUTOSCALE_HISTORY", 50),
+	}
+	if cfg.ScaleDownAt <= 0 || cfg.ScaleDownAt >= cfg.ScaleUpAt || cfg.ScaleUpAt > 1 {
+		return Config{}, fmt.Errorf("%sAUTOSCALE_SCALE_DOWN_AT (%g) and %sAUTOSCALE_SCALE_UP_AT (%g) must satisfy 0 < down < up <= 1",
+			loader.Prefix, cfg.ScaleDownAt, loader.Prefix, cfg.ScaleUpAt)
+	}
+	return cfg, nil
+}
+
+// Decision records one change of a target's size.
+type Decision struct {
+	Target   string `json:"target"`
+	Resource string `json:"resource"`
+	From     int    `json:"from"`
+	To       int    `json:"to"`
+	// Utilization is the average over the window that prompted the change.
+	Utilization float64   `json:"utilization"`
+	Reason      string    `json:"reason"`
+	At          time.Time `json:"at"`
+}
+
+// Status describes a target as last sampled.
+type Status struct {
+	Name     string `json:"name"`
+	Resource string `json:"resource"`
+	Min      int    `json:"min"`
+	Max      int    `json:"max"`
+	Size     int    `json:"size"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	// Utilization averages the samples taken since the last change; a
+	// decision waits for a full window of them.
+	Utilization   float64   `json:"utilization"`
+	Samples       int       `json:"samples"`
+	CooldownUntil time.Time `json:"cooldown_until,omitzero"`
+	LastDecision  *Decision `json:"last_decision,omitempty"`
+}
+
+// target is a registered Target with its recent samples.
+type target struct {
+	Target
+	queued, capacity int
+	samples          []float64 // oldest first, at most Window
+	cooldownUntil    time.Time
+	last             *Decision
+}
+
+func (t *target) average() float64 {
+	if len(t.samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, s := range t.samples {
+		sum += s
+	}
+	return sum / float64(len(t.samples))
+}
+
+// Controller samples its targets and resizes them.
+type Controller struct {
+	cfg     Config
+	service string
+	events  eventbus.Publisher
+	logger  logging.Printer
+	now     func() time.Time
+
+	mu        sync.Mutex
+	targets   []*target
+	decisions []Decision // newest last
+}
+
+// New returns a controller without targets for service, which names it in
+// published events. events may be nil.
+func New(cfg Config, service string, events eventbus.Publisher, logger logging.Printer) *Controller {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 6
+	}
+	if cfg.ScaleUpAt <= 0 {
+		cfg.ScaleUpAt = 0.5
+	}
+	if cfg.ScaleDownAt <= 0 {
+		cfg.ScaleDownAt = 0.1
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = 30 * time.Second
+	}
+	if cfg.History <= 0 {
+		cfg.History = 50
+	}
+	return &Controller{
+		cfg:     cfg,
+		service: service,
+		events:  events,
+		logger:  logger,
+		now:     func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Add registers t. Call it before the controller runs.
+func (c *Controller) Add(t Target) error {
+	if t.Min < 1 || t.Max < t.Min {
+		return fmt.Errorf("%w: %s has min %d and max %d", ErrBounds, t.Name, t.Min, t.Max)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.targets, &target{Target: t})
+	return nil
+}
+
+// Run samples every target each interval until ctx is cancelled.
+func (c *Controller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			c.Tick(ctx)
+		}
+	}
+}
+
+// Tick samples every target once and resizes those whose window of
+// samples calls for it.
+func (c *Controller) Tick(ctx context.Context) {
+	now := c.now()
+	c.mu.Lock()
+	var made []Decision
+	for _, t := range c.targets {
+		if d, ok := c.sample(t, now); ok {
+			made = append(made, d)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, d := range made {
+		c.logger.Printf("autoscale: %s %s %d -> %d (%s)", d.Target, d.Resource, d.From, d.To, d.Reason)
+		if c.events != nil {
+			c.events.Publish(ctx, eventbus.PoolScaled{
+				Service:     c.service,
+				Target:      d.Target,
+				Resource:    d.Resource,
+				From:        d.From,
+				To:          d.To,
+				Utilization: d.Utilization,
+				Reason:      d.Reason,
+				ScaledAt:    d.At,
+			})
+		}
+	}
+}
+
+// sample records t's utilization and resizes it when a full window crosses
+// a threshold outside its cooldown. The caller holds c.mu.
+func (c *Controller) sample(t *target, now time.Time) (Decision, bool) {
+	t.queued, t.capacity = t.Depth()
+	var u float64
+	if t.capacity > 0 {
+		u = float64(t.queued) / float64(t.capacity)
+	}
+	t.samples = append(t.samples, u)
+	if len(t.samples) > c.cfg.Window {
+		t.samples = t.samples[len(t.samples)-c.cfg.Window:]
+	}
+	if len(t.samples) < c.cfg.Window || now.Before(t.cooldownUntil) {
+		return Decision{}, false
+	}
+
+	avg := t.average()
+	from := t.Size()
+	to := from
+	var reason string
+	switch {
+	case avg >= c.cfg.ScaleUpAt:
+		to = from + max(1, from/2)
+		reason = fmt.Sprintf("average utilization %.2f at or above %.2f", avg, c.cfg.ScaleUpAt)
+	case avg <= c.cfg.ScaleDownAt:
+		to = from - max(1, from/4)
+		reason = fmt.Sprintf("average utilization %.2f at or below %.2f", avg, c.cfg.ScaleDownAt)
+	default:
+		return Decision{}, false
+	}
+	to = min(max(to, t.Min), t.Max)
+	if to == from {
+		return Decision{}, false
+	}
+
+	t.Resize(to)
+	d := Decision{Target: t.Name, Resource: t.Resource, From: from, To: to, Utilization: avg, Reason: reason, At: now}
+	t.last = &d
+	t.cooldownUntil = now.Add(c.cfg.Cooldown)
+	// Samples taken at the old size no longer describe the target.
+	t.samples = t.samples[:0]
+	c.decisions = append(c.decisions, d)
+	if len(c.decisions) > c.cfg.History {
+		c.decisions = c.decisions[len(c.decisions)-c.cfg.History:]
+	}
+	return d, true
+}
+
+// Targets describes every target, in the order they were added.
+func (c *Controller) Targets() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Status, 0, len(c.targets))
+	for _, t := range c.targets {
+		s := Status{
+			Name:          t.Name,
+			Resource:      t.Resource,
+			Min:           t.Min,
+			Max:           t.Max,
+			Size:          t.Size(),
+			Queued:        t.queued,
+			Capacity:      t.capacity,
+			Utilization:   t.average(),
+			Samples:       len(t.samples),
+			CooldownUntil: t.cooldownUntil,
+		}
+		if t.last != nil {
+			last := *t.last
+			s.LastDecision = &last
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// Decisions returns the kept decisions, newest first.
+func (c *Controller) Decisions() []Decision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := slices.Clone(c.decisions)
+	slices.Reverse(out)
+	return out
+}
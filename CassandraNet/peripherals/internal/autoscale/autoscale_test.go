@@ -0,0 +1,166 @@
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+type publisher []eventbus.Event
+
+func (p *publisher) Publish(_ context.Context, e eventbus.Event) { *p = append(*p, e) }
+
+// pool is a target whose depth the test sets.
+type pool struct {
+	queued, capacity, size int
+}
+
+func (p *pool) target(name string, min, max int) Target {
+	return Target{
+		Name:     name,
+		Resource: ResourceWorkers,
+		Min:      min,
+		Max:      max,
+		Depth:    func() (int, int) { return p.queued, p.capacity },
+		Size:     func() int { return p.size },
+		Resize:   func(n int) { p.size = n },
+	}
+}
+
+func TestControllerScalesWithinBounds(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var events publisher
+	c := New(Config{Window: 2, Cooldown: time.Minute, History: 2}, "ugc-worker", &events, noopLogger{})
+	c.now = func() time.Time { return now }
+	p := &pool{capacity: 100, size: 4}
+	if err := c.Add(p.target("workers", 2, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(p.target("broken", 3, 2)); !errors.Is(err, ErrBounds) {
+		t.Fatalf("expected ErrBounds, got %v", err)
+	}
+	ctx := context.Background()
+	tick := func(queued int, step time.Duration) {
+		p.queued = queued
+		now = now.Add(step)
+		c.Tick(ctx)
+	}
+
+	tick(90, time.Second)
+	if p.size != 4 {
+		t.Fatalf("expected no change before a full window, got %d", p.size)
+	}
+	tick(70, time.Second)
+	if p.size != 6 {
+		t.Fatalf("expected 4 workers grown by half, got %d", p.size)
+	}
+	tick(90, time.Second)
+	tick(90, time.Second)
+	if p.size != 6 {
+		t.Fatalf("expected no change during the cooldown, got %d", p.size)
+	}
+	tick(90, time.Minute)
+	if p.size != 7 {
+		t.Fatalf("expected growth capped at the maximum, got %d", p.size)
+	}
+	tick(50, time.Minute)
+	tick(0, time.Second)
+	if p.size != 7 {
+		t.Fatalf("expected a middling window to keep the size, got %d", p.size)
+	}
+	tick(0, time.Second)
+	if p.size != 6 {
+		t.Fatalf("expected 7 workers shrunk by a quarter, got %d", p.size)
+	}
+
+	decisions := c.Decisions()
+	if len(decisions) != 2 || decisions[0].From != 7 || decisions[0].To != 6 || decisions[1].To != 7 {
+		t.Fatalf("expected the two newest decisions, newest first, got %+v", decisions)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected an event per decision, got %d", len(events))
+	}
+	last := events[2].(eventbus.PoolScaled)
+	if last.Service != "ugc-worker" || last.Target != "workers" || last.From != 7 || last.To != 6 || last.Utilization != 0 || !last.ScaledAt.Equal(now) {
+		t.Fatalf("unexpected event %+v", last)
+	}
+	status := c.Targets()
+	if len(status) != 1 || status[0].Size != 6 || status[0].Samples != 0 || status[0].LastDecision == nil || !status[0].CooldownUntil.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestFromConfigChecksThresholds(t *testing.T) {
+	t.Setenv("SVC_AUTOSCALE_SCALE_UP_AT", "0.8")
+	t.Setenv("SVC_AUTOSCALE_SCALE_DOWN_AT", "0.2")
+	loader, err := config.Load("SVC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := FromConfig(loader)
+	if err != nil || cfg.ScaleUpAt != 0.8 || cfg.ScaleDownAt != 0.2 || cfg.Window != 6 {
+		t.Fatalf("unexpected config %+v %v", cfg, err)
+	}
+
+	t.Setenv("SVC_AUTOSCALE_SCALE_DOWN_AT", "0.9")
+	if loader, err = config.Load("SVC", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromConfig(loader); err == nil {
+		t.Fatal("expected overlapping thresholds to be rejected")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	c := New(Config{}, "log-pipeline", nil, noopLogger{})
+	p := &pool{queued: 3, capacity: 4, size: 4}
+	if err := c.Add(p.target("buffer", 4, 64)); err != nil {
+		t.Fatal(err)
+	}
+	c.Tick(context.Background())
+	h := c.Handler()
+	serve := func(method, target string, principal auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), principal))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	operator := auth.Principal{Subject: "ops"}
+
+	rec := serve(http.MethodGet, "/autoscale", operator)
+	var list struct {
+		Items []Status `json:"items"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &list) != nil || len(list.Items) != 1 ||
+		list.Items[0].Utilization != 0.75 || list.Items[0].Samples != 1 || list.Items[0].Queued != 3 {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		principal      auth.Principal
+		status         int
+	}{
+		{http.MethodGet, "/autoscale/decisions", operator, http.StatusOK},
+		{http.MethodPost, "/autoscale", operator, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/autoscale/buffer", operator, http.StatusNotFound},
+		{http.MethodGet, "/autoscale", auth.Principal{Subject: "acme", Tenant: "acme"}, http.StatusForbidden},
+	} {
+		if rec := serve(tc.method, tc.target, tc.principal); rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d %s", tc.method, tc.target, tc.status, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package autoscale
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Problem codes returned by the autoscale endpoints.
+const (
+	codeNotFound  = "autoscale.not_found"
+	codeForbidden = "autoscale.forbidden_tenant"
+)
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/autoscale"
+
+// Handler serves the controller's state:
+//
+//	GET /autoscale            every target with its bounds and utilization
+//	GET /autoscale/decisions  the recent decisions, newest first
+//
+// Targets serve every tenant, so callers bound to a tenant are refused;
+// both require auth.PermMetricsRead.
+func (c *Controller) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := auth.FromContext(r.Context()); p.Tenant != "" {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "autoscaled pools serve every tenant; use credentials not bound to one")
+			return
+		}
+		var list func() any
+		switch r.URL.Path {
+		case Path, Path + "/":
+			list = func() any { return c.Targets() }
+		case Path + "/decisions":
+			list = func() any { return c.Decisions() }
+		default:
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, "autoscale", http.MethodGet)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermMetricsRead, "", "") {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"items": list()})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
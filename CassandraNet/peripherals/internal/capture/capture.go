@@ -0,0 +1,296 @@
+// Package capture records sanitized requests to disk and replays them
+// against another deployment, for chasing problems that only production
+// traffic shows and for checking a migration against real requests.
+//
+// server.Capture writes the requests it samples as Records, one JSON object
+// per line, through a Writer that rotates and prunes its files. A Record
+// keeps the method, URI, headers, and body a service received, with
+// credentials and client addresses removed and the configured JSON fields
+// and query parameters replaced by Redacted. Replay reads the files back
+// and sends each request to a target at a fixed rate.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Redacted replaces the value of every redacted field and query parameter.
+// It is also valid base64, so a redacted payload_base64 still decodes.
+const Redacted = "REDACTED"
+
+// Reasons a Record's body was left out.
+const (
+	// OmittedTooLarge means the body was longer than the capture limit.
+	OmittedTooLarge = "too_large"
+	// OmittedNotJSON means the body could not be searched for the
+	// redacted fields because it is not JSON.
+	OmittedNotJSON = "not_json"
+	// OmittedUnreadable means reading the body failed, as when it is
+	// longer than the service accepts.
+	OmittedUnreadable = "unreadable"
+)
+
+// DefaultFields are redacted when no fields are configured: credentials,
+// notification recipients, message payloads, and UGC attributes.
+var DefaultFields = []string{"password", "secret", "token", "api_key", "recipient", "payload_base64", "attributes"}
+
+// droppedHeaders are never recorded: credentials and client addresses,
+// headers describing the body as it was sent rather than as recorded, and
+// hop-by-hop headers. The request ID is kept in Record.RequestID.
+var droppedHeaders = []string{
+	"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key",
+	"Forwarded", "X-Forwarded-For", "X-Real-Ip",
+	"Content-Length", "Content-Encoding", "Transfer-Encoding",
+	"Connection", "Keep-Alive", "Te", "Trailer", "Upgrade",
+	"X-Request-Id",
+}
+
+// Record is one captured request and the status it was answered with.
+type Record struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Method    string    `json:"method"`
+	// URI is the path and query the service received.
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header,omitempty"`
+	// Body holds a JSON body; BodyBase64 holds any other.
+	Body       json.RawMessage `json:"body,omitempty"`
+	BodyBase64 []byte          `json:"body_base64,omitempty"`
+	// BodyOmitted gives the reason a body was left out, such as
+	// OmittedTooLarge. Such records cannot be replayed faithfully.
+	BodyOmitted string  `json:"body_omitted,omitempty"`
+	Status      int     `json:"status"`
+	DurationMS  float64 `json:"duration_ms"`
+}
+
+// Payload returns the recorded body.
+func (r Record) Payload() []byte {
+	if r.Body != nil {
+		return r.Body
+	}
+	return r.BodyBase64
+}
+
+// Redaction decides what a Record leaves out.
+type Redaction struct {
+	// Headers are dropped along with the credential, client address, and
+	// hop-by-hop headers that are always dropped.
+	Headers []string
+	// Fields are JSON object keys and query parameters whose values are
+	// replaced, matched without regard to case. Every string, number, and
+	// boolean under a redacted key is replaced, so objects and arrays keep
+	// their shape. With no fields, bodies are recorded as received.
+	Fields []string
+}
+
+// Record returns a sanitized record of r and body, the first bytes of its
+// body. omitted, when set, gives the reason body is incomplete, and the
+// body is left out.
+func (rd Redaction) Record(r *http.Request, body []byte, omitted string) Record {
+	rec := Record{
+		Method:      r.Method,
+		URI:         rd.uri(r.URL),
+		Header:      r.Header.Clone(),
+		BodyOmitted: omitted,
+	}
+	for _, name := range droppedHeaders {
+		rec.Header.Del(name)
+	}
+	for _, name := range rd.Headers {
+		rec.Header.Del(name)
+	}
+	if len(rec.Header) == 0 {
+		rec.Header = nil
+	}
+	if omitted != "" || len(body) == 0 {
+		return rec
+	}
+	if isJSON(r.Header.Get("Content-Type"), body) {
+		redacted, err := rd.redactJSON(body)
+		if err == nil {
+			rec.Body = redacted
+			return rec
+		}
+	}
+	if len(rd.Fields) > 0 {
+		rec.BodyOmitted = OmittedNotJSON
+		return rec
+	}
+	rec.BodyBase64 = bytes.Clone(body)
+	return rec
+}
+
+func (rd Redaction) redacts(name string) bool {
+	return slices.ContainsFunc(rd.Fields, func(f string) bool { return strings.EqualFold(f, name) })
+}
+
+// uri returns u's path and query with the redacted parameters replaced.
+func (rd Redaction) uri(u *url.URL) string {
+	if u.RawQuery == "" || len(rd.Fields) == 0 {
+		return u.RequestURI()
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		// A query the service could not parse either is kept only by path.
+		return u.EscapedPath()
+	}
+	for name, values := range query {
+		if rd.redacts(name) {
+			for i := range values {
+				values[i] = Redacted
+			}
+		}
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
+func (rd Redaction) redactJSON(body []byte) (json.RawMessage, error) {
+	if len(rd.Fields) == 0 {
+		return json.RawMessage(bytes.Clone(body)), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(rd.redactValue(value, false))
+}
+
+// redactValue replaces every scalar under a redacted key.
+func (rd Redaction) redactValue(value any, redact bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = rd.redactValue(child, redact || rd.redacts(key))
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = rd.redactValue(child, redact)
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		if redact {
+			return Redacted
+		}
+		return v
+	}
+}
+
+// isJSON reports whether a body of contentType is JSON; without a type, it
+// looks at the body itself.
+func isJSON(contentType string, body []byte) bool {
+	if contentType == "" {
+		return json.Valid(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// Writer appends Records to files named capture-<time>-<pid>.jsonl in a
+// directory, starting a new file when one reaches the size limit and
+// removing the oldest capture files in the directory beyond the file limit.
+// Files are created only once something is written.
+type Writer struct {
+	dir          string
+	maxFileBytes int64
+	maxFiles     int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewWriter returns a writer into dir. Files grow to about maxFileBytes,
+// and at most maxFiles are kept.
+func NewWriter(dir string, maxFileBytes int64, maxFiles int) *Writer {
+	return &Writer{dir: dir, maxFileBytes: maxFileBytes, maxFiles: maxFiles}
+}
+
+// Dir returns the directory written to.
+func (w *Writer) Dir() string { return w.dir }
+
+// Write appends rec as one line.
+func (w *Writer) Write(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.file == nil || (w.size > 0 && w.size+int64(len(line)) > w.maxFileBytes) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	return err
+}
+
+// rotate closes the current file, opens a new one, and prunes old ones.
+func (w *Writer) rotate() error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	name := fmt.Sprintf("capture-%s-%d.jsonl", time.Now().UTC().Format("20060102T150405.000000000Z"), os.Getpid())
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+	w.file, w.size = f, 0
+	w.prune()
+	return nil
+}
+
+// prune removes the oldest capture files beyond maxFiles. File names start
+// with their creation time, so they sort oldest first.
+func (w *Writer) prune() {
+	if w.maxFiles <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(w.dir, "capture-*.jsonl"))
+	if err != nil || len(files) <= w.maxFiles {
+		return
+	}
+	slices.Sort(files)
+	for _, name := range files[:len(files)-w.maxFiles] {
+		_ = os.Remove(name)
+	}
+}
+
+// Close closes the current file. Later writes fail.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,138 @@
+package capture
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedactionRecord(t *testing.T) {
+	rd := Redaction{Fields: []string{"token", "recipient", "attributes"}, Headers: []string{"X-Debug"}}
+	req := httptest.NewRequest(http.MethodPost, "/notify/send?token=abc&channel=email", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	body := `{"Recipient":"ops@example.com","attributes":{"name":"map","tags":["a",2]},"count":12345678901234567890,"note":null}`
+
+	rec := rd.Record(req, []byte(body), "")
+	if rec.URI != "/notify/send?channel=email&token=REDACTED" {
+		t.Fatalf("expected the token parameter redacted, got %q", rec.URI)
+	}
+	if len(rec.Header) != 2 || rec.Header.Get("X-Tenant-ID") != "acme" {
+		t.Fatalf("expected only tenant and content type kept, got %v", rec.Header)
+	}
+	want := `{"Recipient":"REDACTED","attributes":{"name":"REDACTED","tags":["REDACTED","REDACTED"]},"count":12345678901234567890,"note":null}`
+	if string(rec.Body) != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, rec.Body)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if rec := rd.Record(req, []byte("raw"), ""); rec.BodyOmitted != OmittedNotJSON || rec.Payload() != nil {
+		t.Fatalf("expected an opaque body left out while redacting, got %+v", rec)
+	}
+	if rec := (Redaction{}).Record(req, []byte("raw"), ""); string(rec.Payload()) != "raw" || rec.Body != nil {
+		t.Fatalf("expected an opaque body kept without redaction, got %+v", rec)
+	}
+}
+
+func TestWriterRotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir, 200, 2)
+	for i := 0; i < 6; i++ {
+		if err := w.Write(Record{Method: http.MethodGet, URI: "/" + strings.Repeat("x", 100), Status: 200}); err != nil {
+			t.Fatal(err)
+		}
+		// File names carry the time they were started.
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(Record{}); err == nil {
+		t.Fatal("expected writes after Close to fail")
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "capture-*.jsonl"))
+	if len(files) != 2 {
+		t.Fatalf("expected two files kept, got %v", files)
+	}
+	for _, name := range files {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 || info.Size() > 200 {
+			t.Fatalf("%s: expected a private file within the limit, got %v %d bytes", name, info.Mode(), info.Size())
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		seen = append(seen, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("X-Request-ID")+" "+r.Header.Get("X-API-Key")+" "+string(body))
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer target.Close()
+
+	dir := t.TempDir()
+	w := NewWriter(dir, 1<<20, 1)
+	for _, rec := range []Record{
+		{RequestID: "r1", Method: http.MethodPost, URI: "/topics/a%2Fb/publish?x=1", Body: []byte(`{"a":1}`), Status: 200},
+		{RequestID: "r2", Method: http.MethodGet, URI: "/content/missing", Status: 200},
+		{RequestID: "r3", Method: http.MethodPost, URI: "/ugc/upload", BodyOmitted: OmittedTooLarge, Status: 201},
+	} {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	files, _ := filepath.Glob(filepath.Join(dir, "capture-*.jsonl"))
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	base, _ := url.Parse(target.URL + "/v1/")
+	results := map[string]Result{}
+	cfg := ReplayConfig{Target: base, Rate: 100, Header: http.Header{"X-Api-Key": {"new-key"}}}
+	if err := Replay(context.Background(), cfg, NewReader(f).Next, func(res Result) { results[res.Record.RequestID] = res }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 3 || !results["r1"].Matched() || results["r2"].Matched() || results["r2"].Status != http.StatusNotFound || results["r3"].Err != ErrIncomplete {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	got := strings.Join(seen, "\n")
+	for _, want := range []string{
+		`POST /v1/topics/a%2Fb/publish?x=1 replay-r1 new-key {"a":1}`,
+		`GET /v1/content/missing replay-r2 new-key `,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q among\n%s", want, got)
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected the incomplete record not sent, got\n%s", got)
+	}
+}
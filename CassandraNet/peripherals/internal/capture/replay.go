@@ -0,0 +1,178 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIncomplete means a record's body was not captured, so it is not
+// replayed.
+var ErrIncomplete = errors.New("capture: body was not captured")
+
+// Reader reads Records written by a Writer.
+type Reader struct {
+	dec *json.Decoder
+}
+
+// NewReader returns a reader of the records in r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next record, or io.EOF after the last.
+func (r *Reader) Next() (Record, error) {
+	var rec Record
+	if err := r.dec.Decode(&rec); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("capture: %w", err)
+	}
+	return rec, nil
+}
+
+// ReplayConfig tunes Replay.
+type ReplayConfig struct {
+	// Target is the base URL records are sent to; each record's URI is
+	// joined onto its path.
+	Target *url.URL
+	// Rate is the number of requests started per second (default 10).
+	Rate float64
+	// Concurrency bounds the requests in flight (default 4).
+	Concurrency int
+	// Header is set on every request, replacing recorded values, such as
+	// the target's credentials.
+	Header http.Header
+	// Client sends the requests (default one with a 30s timeout).
+	Client *http.Client
+}
+
+// Result is the outcome of replaying one record.
+type Result struct {
+	Record   Record
+	Status   int
+	Duration time.Duration
+	// Err is set when no response arrived, or to ErrIncomplete for a
+	// record that was skipped.
+	Err error
+}
+
+// Matched reports whether the target answered with the recorded status.
+func (r Result) Matched() bool {
+	return r.Err == nil && r.Status == r.Record.Status
+}
+
+// Replay sends the records next returns to cfg.Target, at most cfg.Rate a
+// second, until next returns io.EOF or ctx is done, and passes each outcome
+// to report. Records whose body was not captured are reported with
+// ErrIncomplete and not sent. report is called from one goroutine at a
+// time, in the order responses arrive. Each request carries the recorded
+// request ID prefixed with "replay-", so the target's logs can be matched
+// against the capture.
+func Replay(ctx context.Context, cfg ReplayConfig, next func() (Record, error), report func(Result)) error {
+	if cfg.Target == nil {
+		return errors.New("capture: replay needs a target")
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 10
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 4
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+	defer ticker.Stop()
+	slots := make(chan struct{}, cfg.Concurrency)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	emit := func(res Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		report(res)
+	}
+	defer wg.Wait()
+	for first := true; ; first = false {
+		rec, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.BodyOmitted != "" {
+			emit(Result{Record: rec, Err: ErrIncomplete})
+			continue
+		}
+		if !first {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			emit(send(ctx, cfg, rec))
+		}()
+	}
+}
+
+// send replays one record.
+func send(ctx context.Context, cfg ReplayConfig, rec Record) Result {
+	res := Result{Record: rec}
+	target := *cfg.Target
+	path, query, _ := strings.Cut(rec.URI, "?")
+	escaped := strings.TrimSuffix(target.EscapedPath(), "/") + path
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		res.Err = fmt.Errorf("capture: uri %q: %w", rec.URI, err)
+		return res
+	}
+	target.Path, target.RawPath, target.RawQuery = unescaped, escaped, query
+	req, err := http.NewRequestWithContext(ctx, rec.Method, target.String(), bytes.NewReader(rec.Payload()))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req.Header = rec.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	for name, values := range cfg.Header {
+		req.Header[name] = values
+	}
+	if rec.RequestID != "" {
+		req.Header.Set("X-Request-ID", "replay-"+rec.RequestID)
+	}
+	start := time.Now()
+	resp, err := cfg.Client.Do(req)
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	res.Status = resp.StatusCode
+	return res
+}
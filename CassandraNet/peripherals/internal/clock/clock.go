@@ -0,0 +1,66 @@
+// Package clock gives services one way to read the time and to wait on
+// timers and tickers, so tests can drive timestamps, poll loops, and sweeps
+// with a Fake instead of sleeping. Services take a Clock in their
+// constructors or through SetClock, with nil meaning System:
+//
+//	fake := clock.NewFake(start)
+//	svc := messaging.NewService(store, fake)
+//	fake.Advance(time.Minute)
+package clock
+
+import (
+	"time"
+)
+
+// Clock reports the current time and creates timers and tickers that follow
+// it.
+type Clock interface {
+	// Now returns the current time in UTC.
+	Now() time.Time
+	// NewTimer returns a timer that fires once, d from now.
+	NewTimer(d time.Duration) Timer
+	// NewTicker returns a ticker that fires every d, dropping ticks its
+	// reader misses, as time.Ticker does. d must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer behind an interface.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker behind an interface.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// System is the real clock.
+var System Clock = system{}
+
+type system struct{}
+
+func (system) Now() time.Time { return time.Now().UTC() }
+
+func (system) NewTimer(d time.Duration) Timer { return timer{time.NewTimer(d)} }
+
+func (system) NewTicker(d time.Duration) Ticker { return ticker{time.NewTicker(d)} }
+
+type timer struct{ *time.Timer }
+
+func (t timer) C() <-chan time.Time { return t.Timer.C }
+
+type ticker struct{ *time.Ticker }
+
+func (t ticker) C() <-chan time.Time { return t.Ticker.C }
+
+// Or returns c, or System when c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeTimersAndTickers(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	timer := f.NewTimer(10 * time.Second)
+	ticker := f.NewTicker(3 * time.Second)
+	stopped := f.NewTimer(time.Second)
+	if !stopped.Stop() || stopped.Stop() {
+		t.Fatal("expected Stop to report only the first stop of an active timer")
+	}
+	if f.Waiters() != 2 {
+		t.Fatalf("expected two active waiters, got %d", f.Waiters())
+	}
+
+	f.Advance(2 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("expected no tick before the interval")
+	default:
+	}
+	f.Advance(2 * time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(3 * time.Second)) {
+		t.Fatalf("expected the tick at its deadline, got %v", got)
+	}
+
+	// Three more intervals pass unread: one tick is kept, the rest dropped.
+	f.Advance(9 * time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(6 * time.Second)) {
+		t.Fatalf("expected the first missed tick, got %v", got)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("expected later ticks dropped")
+	default:
+	}
+	if got := <-timer.C(); !got.Equal(start.Add(10 * time.Second)) {
+		t.Fatalf("expected the timer at its deadline, got %v", got)
+	}
+	if f.Waiters() != 1 || !f.Now().Equal(start.Add(13*time.Second)) {
+		t.Fatalf("expected only the ticker left at 13s, got %d at %v", f.Waiters(), f.Now())
+	}
+
+	if timer.Reset(time.Second) {
+		t.Fatal("expected Reset of a fired timer to report it inactive")
+	}
+	ticker.Stop()
+	f.Set(start.Add(time.Minute))
+	if got := <-timer.C(); !got.Equal(start.Add(14 * time.Second)) {
+		t.Fatalf("expected the reset timer, got %v", got)
+	}
+	select {
+	case <-ticker.C():
+		t.Fatal("expected a stopped ticker to stay quiet")
+	default:
+	}
+}
+
+func TestSystem(t *testing.T) {
+	if Or(nil) != System || Or(NewFake(time.Time{})) == System {
+		t.Fatal("expected Or to fall back to System only for nil")
+	}
+	if System.Now().Location() != time.UTC {
+		t.Fatal("expected System to report UTC")
+	}
+	timer := System.NewTimer(time.Millisecond)
+	<-timer.C()
+	ticker := System.NewTicker(time.Millisecond)
+	<-ticker.C()
+	ticker.Stop()
+}
@@ -0,0 +1,165 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock that only moves when told to. Its timers and tickers fire
+// as Advance or Set passes their deadlines, delivering on channels of one
+// like the real ones, so a tick nobody reads is dropped.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake returns a fake clock reading start.
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start.UTC()}
+}
+
+// Now returns the fake's time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the fake forward by d, firing every timer and ticker due
+// on the way in deadline order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	target := f.now.Add(d)
+	for {
+		due := f.nextDue(target)
+		if due == nil {
+			break
+		}
+		f.now = due.at
+		due.fire()
+	}
+	f.now = target
+	f.mu.Unlock()
+}
+
+// Set moves the fake to t, firing what comes due; a time before the
+// fake's only changes what Now reads.
+func (f *Fake) Set(t time.Time) {
+	if d := t.Sub(f.Now()); d > 0 {
+		f.Advance(d)
+		return
+	}
+	f.mu.Lock()
+	f.now = t.UTC()
+	f.mu.Unlock()
+}
+
+// Waiters reports how many timers and tickers are active, so a test can
+// wait for a goroutine to start waiting before advancing the fake.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// nextDue returns the active waiter with the earliest deadline at or
+// before target. The caller holds f.mu.
+func (f *Fake) nextDue(target time.Time) *waiter {
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+	if len(f.waiters) == 0 || f.waiters[0].at.After(target) {
+		return nil
+	}
+	return f.waiters[0]
+}
+
+// NewTimer returns a timer that fires when the fake reaches d from now.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &waiter{fake: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return fakeTimer{w}
+}
+
+// NewTicker returns a ticker that fires each time the fake passes another
+// d.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &waiter{fake: f, c: make(chan time.Time, 1), period: d}
+	w.Reset(d)
+	return fakeTicker{w}
+}
+
+// waiter is a fake timer, or with a period a fake ticker.
+type waiter struct {
+	fake   *Fake
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+// fire delivers the fake's time and schedules a ticker's next tick. The
+// caller holds fake.mu.
+func (w *waiter) fire() {
+	select {
+	case w.c <- w.fake.now:
+	default:
+	}
+	if w.period > 0 {
+		w.at = w.at.Add(w.period)
+		return
+	}
+	w.remove()
+}
+
+// remove deactivates w and reports whether it was active. The caller holds
+// fake.mu.
+func (w *waiter) remove() bool {
+	for i, other := range w.fake.waiters {
+		if other == w {
+			w.fake.waiters = append(w.fake.waiters[:i], w.fake.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (w *waiter) Stop() bool {
+	w.fake.mu.Lock()
+	defer w.fake.mu.Unlock()
+	return w.remove()
+}
+
+func (w *waiter) Reset(d time.Duration) bool {
+	w.fake.mu.Lock()
+	defer w.fake.mu.Unlock()
+	active := w.remove()
+	if w.period > 0 {
+		w.period = d
+	}
+	w.at = w.fake.now.Add(d)
+	w.fake.waiters = append(w.fake.waiters, w)
+	if w.period == 0 && d <= 0 {
+		w.fire()
+	}
+	return active
+}
+
+type fakeTimer struct{ *waiter }
+
+func (t fakeTimer) C() <-chan time.Time { return t.c }
+
+type fakeTicker struct{ *waiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.c }
+
+func (t fakeTicker) Stop() { t.waiter.Stop() }
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+	t.waiter.Reset(d)
+}
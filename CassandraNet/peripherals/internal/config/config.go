@@ -10,6 +10,12 @@ import (
 // scoped by a common environment variable prefix (e.g. METRICS_, LOGS_).
 type Loader struct {
 	Prefix string
+
+	file   map[string]string
+	source string
+	remote *remoteSource
+	flags  map[string]string
+	access *accessLog
 }
 
 // NewLoader constructs a loader with the provided prefix. The prefix is
@@ -18,47 +24,97 @@ func NewLoader(prefix string) Loader {
 	if prefix != "" && !hasTrailingUnderscore(prefix) {
 		prefix += "_"
 	}
-	return Loader{Prefix: prefix}
+	return Loader{Prefix: prefix, access: newAccessLog()}
 }
 
 func hasTrailingUnderscore(s string) bool {
 	return len(s) > 0 && s[len(s)-1] == '_'
 }
 
-// String returns the environment variable value or the provided default.
-func (l Loader) String(key, def string) string {
+// Lookup resolves key from command-line flags and the environment, falling
+// back to the central config service and then the config file (when
+// configured). Remote and file values may be written with or without the
+// service prefix.
+func (l Loader) Lookup(key string) (string, bool) {
+	val, _, ok := l.resolve(key)
+	return val, ok
+}
+
+func (l Loader) resolve(key string) (string, string, bool) {
+	if val := l.flags[key]; val != "" {
+		return val, SourceFlag, true
+	}
 	if val := os.Getenv(l.Prefix + key); val != "" {
+		return val, SourceEnv, true
+	}
+	layers := []struct {
+		source string
+		values map[string]string
+	}{
+		{SourceRemote, l.remote.valueMap()},
+		{SourceFile, l.file},
+	}
+	for _, layer := range layers {
+		if val, ok := layer.values[l.Prefix+key]; ok && val != "" {
+			return val, layer.source, true
+		}
+		if val, ok := layer.values[key]; ok && val != "" {
+			return val, layer.source, true
+		}
+	}
+	return "", "", false
+}
+
+// String returns the configured value or the provided default.
+func (l Loader) String(key, def string) string {
+	if val, source, ok := l.resolve(key); ok {
+		l.track(key, val, def, source, false)
 		return val
 	}
+	l.track(key, def, def, SourceDefault, false)
 	return def
 }
 
-// Int returns an integer environment variable or the provided default.
+// Int returns an integer value or the provided default.
 func (l Loader) Int(key string, def int) int {
-	if val := os.Getenv(l.Prefix + key); val != "" {
+	val, source, ok := l.resolve(key)
+	if ok {
 		if parsed, err := strconv.Atoi(val); err == nil {
+			l.track(key, val, strconv.Itoa(def), source, false)
 			return parsed
 		}
 	}
+	l.track(key, strconv.Itoa(def), strconv.Itoa(def), SourceDefault, ok)
 	return def
 }
 
-// Duration returns a duration environment variable (in seconds) or the default.
+// Duration returns a duration value or the default. Plain numbers are read
+// as seconds; anything else is parsed as a Go duration string ("500ms", "2h").
 func (l Loader) Duration(key string, def time.Duration) time.Duration {
-	if val := os.Getenv(l.Prefix + key); val != "" {
+	val, source, ok := l.resolve(key)
+	if ok {
 		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			l.track(key, val, def.String(), source, false)
 			return time.Duration(parsed * float64(time.Second))
 		}
+		if parsed, err := time.ParseDuration(val); err == nil {
+			l.track(key, val, def.String(), source, false)
+			return parsed
+		}
 	}
+	l.track(key, def.String(), def.String(), SourceDefault, ok)
 	return def
 }
 
-// Bool returns a boolean environment variable or the default.
+// Bool returns a boolean value or the default.
 func (l Loader) Bool(key string, def bool) bool {
-	if val := os.Getenv(l.Prefix + key); val != "" {
+	val, source, ok := l.resolve(key)
+	if ok {
 		if parsed, err := strconv.ParseBool(val); err == nil {
+			l.track(key, val, strconv.FormatBool(def), source, false)
 			return parsed
 		}
 	}
+	l.track(key, strconv.FormatBool(def), strconv.FormatBool(def), SourceDefault, ok)
 	return def
 }
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Sources reported for effective settings.
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceRemote  = "remote"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+const redacted = "[redacted]"
+
+// sensitiveMarkers flag keys whose values are redacted even when they were
+// not read through Secret.
+var sensitiveMarkers = []string{"SECRET", "PASSWORD", "PASSWD", "TOKEN", "API_KEY", "PRIVATE_KEY", "CREDENTIAL"}
+
+// Setting describes one configuration key as the process resolved it.
+type Setting struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+	Source  string `json:"source"`
+	// Invalid is set when a configured value failed to parse and the
+	// default was used instead.
+	Invalid bool `json:"invalid,omitempty"`
+	Secret  bool `json:"secret,omitempty"`
+}
+
+// accessLog records every key read through a loader's typed helpers. Copies
+// of a loader (WithFile, Reload, Watcher) share the log, so it always
+// reflects the values the process most recently applied.
+type accessLog struct {
+	mu       sync.Mutex
+	settings map[string]Setting
+	secrets  map[string]bool
+}
+
+func newAccessLog() *accessLog {
+	return &accessLog{settings: make(map[string]Setting), secrets: make(map[string]bool)}
+}
+
+func (l Loader) track(key, value, def, source string, invalid bool) {
+	if l.access == nil {
+		return
+	}
+	l.access.mu.Lock()
+	defer l.access.mu.Unlock()
+	l.access.settings[key] = Setting{
+		Key:     l.Prefix + key,
+		Value:   value,
+		Default: def,
+		Source:  source,
+		Invalid: invalid,
+		Secret:  l.access.secrets[key] || isSensitive(key),
+	}
+}
+
+// Secret reads a string like String but marks the key as secret so its value
+// never appears in Settings or the effective-config handler.
+func (l Loader) Secret(key, def string) string {
+	if l.access != nil {
+		l.access.mu.Lock()
+		l.access.secrets[key] = true
+		l.access.mu.Unlock()
+	}
+	return l.String(key, def)
+}
+
+// Settings returns the keys read so far, sorted by name, with secret values
+// redacted and credentials stripped from URLs.
+func (l Loader) Settings() []Setting {
+	if l.access == nil {
+		return nil
+	}
+	l.access.mu.Lock()
+	settings := make([]Setting, 0, len(l.access.settings))
+	for _, setting := range l.access.settings {
+		settings = append(settings, setting)
+	}
+	l.access.mu.Unlock()
+
+	for i := range settings {
+		settings[i].Value = redact(settings[i].Value, settings[i].Secret)
+		settings[i].Default = redact(settings[i].Default, settings[i].Secret)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+func isSensitive(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range sensitiveMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(value string, secret bool) string {
+	if value == "" {
+		return ""
+	}
+	if secret {
+		return redacted
+	}
+	if strings.Contains(value, "@") && strings.Contains(value, "://") {
+		if parsed, err := url.Parse(value); err == nil && parsed.User != nil {
+			return parsed.Redacted()
+		}
+	}
+	return value
+}
+
+type effectiveConfig struct {
+	Prefix   string    `json:"prefix"`
+	File     string    `json:"file,omitempty"`
+	Remote   string    `json:"remote,omitempty"`
+	Settings []Setting `json:"settings"`
+}
+
+// Handler serves GET requests with the effective configuration: every key
+// the process has read, its value, and where that value came from. Services
+// mount it at /debug/config.
+func (l Loader) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, "debug", http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(effectiveConfig{
+			Prefix:   l.Prefix,
+			File:     l.source,
+			Remote:   l.Remote(),
+			Settings: l.Settings(),
+		})
+	})
+}
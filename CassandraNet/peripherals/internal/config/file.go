@@ -0,0 +1,165 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Load constructs a loader for prefix layered over an optional config file.
+// When path is empty the `<PREFIX>_CONFIG_FILE` environment variable is
+// consulted; if neither is set the loader reads the environment only.
+//
+// When `CONFIG_URL` resolves (from a flag, the environment, or the file)
+// the loader also fetches its document from the central config service; see
+// WithRemote.
+func Load(prefix, path string) (Loader, error) {
+	return load(NewLoader(prefix), path)
+}
+
+func load(l Loader, path string) (Loader, error) {
+	if path == "" {
+		path = os.Getenv(l.Prefix + "CONFIG_FILE")
+	}
+	if path != "" {
+		var err error
+		if l, err = l.WithFile(path); err != nil {
+			return l, err
+		}
+	}
+	baseURL, ok := l.Lookup("CONFIG_URL")
+	if !ok {
+		return l, nil
+	}
+	service := l.String("CONFIG_NAME", defaultServiceName(l.Prefix))
+	environment := l.String("CONFIG_ENV", "default")
+	return l.WithRemote(baseURL, service, environment)
+}
+
+// WithFile returns a copy of the loader that falls back to values read from
+// the JSON, YAML, or TOML file at path (selected by extension) whenever the
+// environment does not define a key.
+//
+// Nested keys are flattened with underscores and upper-cased, so the YAML
+//
+//	series:
+//	  idle_ttl: 300
+//
+// answers Int("SERIES_IDLE_TTL"). Keys may optionally be nested under the
+// service prefix (e.g. a top-level `metrics:` section) so several services
+// can share one file. Lists are joined with commas.
+func (l Loader) WithFile(path string) (Loader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return l, fmt.Errorf("read config file: %w", err)
+	}
+	values, err := ParseFile(filepath.Ext(path), data)
+	if err != nil {
+		return l, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	merged := make(map[string]string, len(l.file)+len(values))
+	for k, v := range l.file {
+		merged[k] = v
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	l.file = merged
+	l.source = path
+	return l, nil
+}
+
+// ParseFile decodes a configuration document into flattened, normalized
+// keys. ext selects the format: .json, .yaml/.yml, or .toml.
+func ParseFile(ext string, data []byte) (map[string]string, error) {
+	var (
+		tree map[string]any
+		err  error
+	)
+	switch strings.ToLower(ext) {
+	case ".json":
+		err = json.Unmarshal(data, &tree)
+	case ".yaml", ".yml":
+		tree, err = parseYAML(string(data))
+	case ".toml":
+		tree, err = parseTOML(string(data))
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string)
+	flatten("", tree, out)
+	return out, nil
+}
+
+func flatten(prefix string, value any, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			name := normalizeKey(key)
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			flatten(name, child, out)
+		}
+	default:
+		if prefix != "" {
+			out[prefix] = scalarString(v)
+		}
+	}
+}
+
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				encoded, _ := json.Marshal(v)
+				return string(encoded)
+			}
+			parts = append(parts, scalarString(item))
+		}
+		return strings.Join(parts, ",")
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+func normalizeKey(key string) string {
+	key = strings.ToUpper(strings.TrimSpace(key))
+	return strings.NewReplacer(".", "_", "-", "_", " ", "_").Replace(key)
+}
+
+// Source reports the config file backing the loader, if any.
+func (l Loader) Source() string {
+	return l.source
+}
+
+// FileKeys lists the normalized keys supplied by the config file.
+func (l Loader) FileKeys() []string {
+	keys := make([]string, 0, len(l.file))
+	for k := range l.file {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
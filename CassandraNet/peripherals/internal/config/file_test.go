@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFileFormats(t *testing.T) {
+	docs := map[string]string{
+		".json": `{"http_addr": ":9000", "series": {"idle_ttl": 30, "overflow": "aggregate"}, "buckets": [1, 2.5]}`,
+		".yaml": `
+# metrics collector
+http_addr: ":9000"
+series:
+  idle_ttl: 30   # seconds
+  overflow: aggregate
+buckets:
+  - 1
+  - 2.5
+`,
+		".toml": `
+http_addr = ":9000"
+buckets = [1, 2.5]
+
+[series]
+idle_ttl = 30
+overflow = "aggregate" # or reject
+`,
+	}
+	for ext, doc := range docs {
+		values, err := ParseFile(ext, []byte(doc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", ext, err)
+		}
+		want := map[string]string{
+			"HTTP_ADDR":       ":9000",
+			"SERIES_IDLE_TTL": "30",
+			"SERIES_OVERFLOW": "aggregate",
+			"BUCKETS":         "1,2.5",
+		}
+		for key, value := range want {
+			if values[key] != value {
+				t.Fatalf("%s: expected %s=%q, got %q", ext, key, value, values[key])
+			}
+		}
+	}
+}
+
+func TestParseFileRejectsMalformed(t *testing.T) {
+	cases := map[string]string{
+		".yaml": "series:\n  idle_ttl: 30\n    overflow: aggregate\n",
+		".toml": "[series\nidle_ttl = 30\n",
+		".json": "{",
+		".ini":  "a=b",
+	}
+	for ext, doc := range cases {
+		if _, err := ParseFile(ext, []byte(doc)); err == nil {
+			t.Fatalf("%s: expected error", ext)
+		}
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.yaml")
+	doc := "metrics:\n  http_addr: \":9000\"\n  snapshot_interval: 15\nseries_idle_ttl: 45\n"
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("METRICS_HTTP_ADDR", ":9100")
+
+	loader, err := Load("METRICS", path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := loader.String("HTTP_ADDR", ":8081"); got != ":9100" {
+		t.Fatalf("expected env override, got %q", got)
+	}
+	if got := loader.Duration("SNAPSHOT_INTERVAL", 0); got != 15*time.Second {
+		t.Fatalf("expected prefixed file value, got %s", got)
+	}
+	if got := loader.Duration("SERIES_IDLE_TTL", 0); got != 45*time.Second {
+		t.Fatalf("expected unprefixed file value, got %s", got)
+	}
+	if got := loader.Int("MAX_SERIES", 7); got != 7 {
+		t.Fatalf("expected default, got %d", got)
+	}
+	if loader.Source() != path {
+		t.Fatalf("unexpected source %q", loader.Source())
+	}
+}
+
+func TestLoadUsesConfigFileEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.json")
+	if err := os.WriteFile(path, []byte(`{"queue_size": 64}`), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("LOGS_CONFIG_FILE", path)
+
+	loader, err := Load("LOGS", "")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := loader.Int("QUEUE_SIZE", 256); got != 64 {
+		t.Fatalf("expected file value, got %d", got)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+// Option declares a configuration key a binary reads, so it can also be set
+// on the command line. The flag name is derived from the key ("HTTP_ADDR"
+// becomes -http-addr); defaults stay with the accessor calls that read them.
+type Option struct {
+	Key   string
+	Usage string
+}
+
+// commonOptions are registered for every binary alongside its own options.
+var commonOptions = []Option{
+	{Key: "CONFIG_URL", Usage: "config service base URL"},
+	{Key: "CONFIG_NAME", Usage: "service name of the config service document"},
+	{Key: "CONFIG_ENV", Usage: "environment of the config service document"},
+}
+
+// FlagName returns the command-line flag that sets key.
+func FlagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// Parse registers -config plus one flag per option on the process command
+// line, parses os.Args, and loads configuration for prefix with the
+// precedence flag > environment > config service > file > default.
+func Parse(prefix string, options []Option) (Loader, error) {
+	return ParseArgs(prefix, options, flag.CommandLine, os.Args[1:])
+}
+
+// ParseArgs is Parse against an explicit flag set and argument list.
+func ParseArgs(prefix string, options []Option, fs *flag.FlagSet, args []string) (Loader, error) {
+	envPrefix := NewLoader(prefix).Prefix
+	options = append(append([]Option(nil), options...), commonOptions...)
+	configPath := fs.String("config", "", "path to a JSON, YAML, or TOML config file (env "+envPrefix+"CONFIG_FILE)")
+	for _, opt := range options {
+		usage := opt.Usage
+		if usage != "" {
+			usage += " "
+		}
+		fs.String(FlagName(opt.Key), "", usage+"(env "+envPrefix+opt.Key+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Loader{}, err
+	}
+
+	byFlag := make(map[string]string, len(options))
+	for _, opt := range options {
+		byFlag[FlagName(opt.Key)] = opt.Key
+	}
+	flags := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := byFlag[f.Name]; ok {
+			flags[key] = f.Value.String()
+		}
+	})
+
+	l := NewLoader(prefix)
+	l.flags = flags
+	return load(l, *configPath)
+}
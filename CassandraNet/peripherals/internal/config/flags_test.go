@@ -0,0 +1,57 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseArgsPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.toml")
+	doc := "http_addr = \":7000\"\nmax_series = 10\nwindow_count = 30\n"
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("METRICS_HTTP_ADDR", ":8000")
+	t.Setenv("METRICS_MAX_SERIES", "20")
+
+	options := []Option{
+		{Key: "HTTP_ADDR", Usage: "listen address"},
+		{Key: "MAX_SERIES"},
+		{Key: "WINDOW_COUNT"},
+		{Key: "WINDOW_SIZE"},
+	}
+	fs := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	loader, err := ParseArgs("METRICS", options, fs, []string{"-config", path, "-http-addr", ":9000"})
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	if got := loader.String("HTTP_ADDR", ":8081"); got != ":9000" {
+		t.Fatalf("expected flag value, got %q", got)
+	}
+	if got := loader.Int("MAX_SERIES", 0); got != 20 {
+		t.Fatalf("expected env value, got %d", got)
+	}
+	if got := loader.Int("WINDOW_COUNT", 60); got != 30 {
+		t.Fatalf("expected file value, got %d", got)
+	}
+	if got := loader.Int("WINDOW_SIZE", 60); got != 60 {
+		t.Fatalf("expected default, got %d", got)
+	}
+	for _, s := range loader.Settings() {
+		if s.Key == "METRICS_HTTP_ADDR" && s.Source != SourceFlag {
+			t.Fatalf("expected flag source, got %q", s.Source)
+		}
+	}
+}
+
+func TestParseArgsRejectsUnknownFlag(t *testing.T) {
+	fs := flag.NewFlagSet("metrics", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, err := ParseArgs("METRICS", []Option{{Key: "HTTP_ADDR"}}, fs, []string{"-http-port", "1"}); err == nil {
+		t.Fatal("expected error for unknown flag")
+	}
+}
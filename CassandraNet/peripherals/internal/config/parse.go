@@ -0,0 +1,279 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The parsers below cover the subset of YAML and TOML used for service
+// configuration: nested maps, scalar values, and lists of scalars. They keep
+// the module free of third-party dependencies; anything more exotic should
+// be expressed as JSON.
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+func parseYAML(doc string) (map[string]any, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(doc, "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		text := stripComment(strings.TrimLeft(raw, " "))
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(raw, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: text})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next != len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].num)
+	}
+	tree, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("top-level document must be a mapping")
+	}
+	return tree, nil
+}
+
+func parseYAMLBlock(lines []yamlLine, idx, indent int) (any, int, error) {
+	if strings.HasPrefix(lines[idx].text, "- ") || lines[idx].text == "-" {
+		var list []any
+		for idx < len(lines) && lines[idx].indent == indent {
+			line := lines[idx]
+			if !strings.HasPrefix(line.text, "- ") && line.text != "-" {
+				return nil, idx, fmt.Errorf("line %d: expected list item", line.num)
+			}
+			item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+			if _, _, isMap := splitYAMLKey(item); isMap && !isQuoted(item) {
+				return nil, idx, fmt.Errorf("line %d: mappings inside lists are not supported", line.num)
+			}
+			list = append(list, parseScalar(item))
+			idx++
+		}
+		return list, idx, nil
+	}
+
+	tree := make(map[string]any)
+	for idx < len(lines) && lines[idx].indent == indent {
+		line := lines[idx]
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, idx, fmt.Errorf("line %d: expected key: value", line.num)
+		}
+		idx++
+		if rest != "" {
+			tree[key] = parseScalar(rest)
+			continue
+		}
+		if idx < len(lines) && lines[idx].indent > indent {
+			child, next, err := parseYAMLBlock(lines, idx, lines[idx].indent)
+			if err != nil {
+				return nil, next, err
+			}
+			tree[key] = child
+			idx = next
+			continue
+		}
+		// A list may sit at the same indentation as its key.
+		if idx < len(lines) && lines[idx].indent == indent && strings.HasPrefix(lines[idx].text, "- ") {
+			child, next, err := parseYAMLBlock(lines, idx, indent)
+			if err != nil {
+				return nil, next, err
+			}
+			tree[key] = child
+			idx = next
+			continue
+		}
+		tree[key] = nil
+	}
+	if idx < len(lines) && lines[idx].indent > indent {
+		return nil, idx, fmt.Errorf("line %d: unexpected indentation", lines[idx].num)
+	}
+	return tree, idx, nil
+}
+
+func splitYAMLKey(text string) (string, string, bool) {
+	idx := strings.Index(text, ":")
+	for idx >= 0 && idx+1 < len(text) && text[idx+1] != ' ' {
+		next := strings.Index(text[idx+1:], ":")
+		if next < 0 {
+			idx = -1
+			break
+		}
+		idx += next + 1
+	}
+	if idx <= 0 {
+		return "", "", false
+	}
+	key := strings.TrimSpace(text[:idx])
+	key = strings.Trim(key, `"'`)
+	return key, strings.TrimSpace(text[idx+1:]), true
+}
+
+func parseTOML(doc string) (map[string]any, error) {
+	root := make(map[string]any)
+	current := root
+	for i, raw := range strings.Split(doc, "\n") {
+		line := stripComment(strings.TrimSpace(raw))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", i+1)
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed table header", i+1)
+			}
+			table, err := tomlTable(root, strings.TrimSpace(line[1:len(line)-1]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			current = table
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		keyPath := strings.TrimSpace(line[:eq])
+		value := strings.TrimSpace(line[eq+1:])
+		if value == "" {
+			return nil, fmt.Errorf("line %d: missing value", i+1)
+		}
+		parts := strings.Split(keyPath, ".")
+		table := current
+		if len(parts) > 1 {
+			var err error
+			table, err = tomlTable(current, strings.Join(parts[:len(parts)-1], "."))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+		}
+		table[strings.Trim(strings.TrimSpace(parts[len(parts)-1]), `"'`)] = parseScalar(value)
+	}
+	return root, nil
+}
+
+func tomlTable(root map[string]any, path string) (map[string]any, error) {
+	table := root
+	for _, part := range strings.Split(path, ".") {
+		part = strings.Trim(strings.TrimSpace(part), `"'`)
+		if part == "" {
+			return nil, fmt.Errorf("empty table name in %q", path)
+		}
+		child, ok := table[part]
+		if !ok {
+			next := make(map[string]any)
+			table[part] = next
+			table = next
+			continue
+		}
+		next, ok := child.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table", part)
+		}
+		table = next
+	}
+	return table, nil
+}
+
+// parseScalar converts a YAML/TOML scalar or inline list into a string or
+// []any. Numbers and booleans are kept as strings since the loader parses
+// them on access.
+func parseScalar(text string) any {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "" || text == "~" || text == "null":
+		return nil
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return []any{}
+		}
+		var items []any
+		for _, part := range splitTopLevel(inner) {
+			if part = strings.TrimSpace(part); part != "" {
+				items = append(items, parseScalar(part))
+			}
+		}
+		return items
+	case isQuoted(text):
+		if text[0] == '"' {
+			if unquoted, err := strconv.Unquote(text); err == nil {
+				return unquoted
+			}
+		}
+		return text[1 : len(text)-1]
+	default:
+		return text
+	}
+}
+
+func isQuoted(text string) bool {
+	return len(text) >= 2 && (text[0] == '"' || text[0] == '\'') && text[len(text)-1] == text[0]
+}
+
+// splitTopLevel splits on commas that are outside quotes and brackets.
+func splitTopLevel(text string) []string {
+	var (
+		parts []string
+		depth int
+		quote byte
+		start int
+	)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// stripComment removes a trailing `#` comment that is not inside quotes.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
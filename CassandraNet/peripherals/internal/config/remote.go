@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// remoteClient is shared by every loader fetching from the config service.
+var remoteClient = &http.Client{Timeout: 5 * time.Second}
+
+// remoteSource records the document a loader fetched from the central
+// config service. It is immutable; refreshing produces a new value.
+type remoteSource struct {
+	url    string
+	etag   string
+	values map[string]string
+}
+
+func (r *remoteSource) valueMap() map[string]string {
+	if r == nil {
+		return nil
+	}
+	return r.values
+}
+
+// WithRemote returns a copy of the loader that reads the document for
+// service/environment from the config service at baseURL. Remote values sit
+// between the environment and the config file: environment variables still
+// win, but fleet-wide settings override whatever a deployment shipped in its
+// local file. The document is fetched immediately; Reload (and therefore
+// Watcher) refreshes it using ETags so unchanged documents cost a 304.
+func (l Loader) WithRemote(baseURL, service, environment string) (Loader, error) {
+	base, err := url.Parse(strings.TrimRight(baseURL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return l, fmt.Errorf("invalid config service url %q", baseURL)
+	}
+	if service == "" || environment == "" {
+		return l, fmt.Errorf("config service requires a service and environment")
+	}
+	src := &remoteSource{
+		url: base.String() + "/configs/" + url.PathEscape(service) + "/" + url.PathEscape(environment),
+	}
+	next, err := src.refresh()
+	if err != nil {
+		return l, err
+	}
+	l.remote = next
+	return l, nil
+}
+
+// Remote reports the config service document URL backing the loader, if any.
+func (l Loader) Remote() string {
+	if l.remote == nil {
+		return ""
+	}
+	return l.remote.url
+}
+
+// refresh fetches the document, returning r unchanged when the service
+// answers 304 Not Modified.
+func (r *remoteSource) refresh() (*remoteSource, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return r, err
+	}
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return r, fmt.Errorf("fetch remote config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return r, nil
+	case http.StatusNotFound:
+		// No document yet: behave as an empty layer until one is published.
+		return &remoteSource{url: r.url}, nil
+	case http.StatusOK:
+	default:
+		return r, fmt.Errorf("fetch remote config: %s returned %s", r.url, resp.Status)
+	}
+
+	var doc struct {
+		Values map[string]string `json:"values"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return r, fmt.Errorf("decode remote config: %w", err)
+	}
+	values := make(map[string]string, len(doc.Values))
+	for k, v := range doc.Values {
+		values[normalizeKey(k)] = v
+	}
+	return &remoteSource{url: r.url, etag: resp.Header.Get("ETag"), values: values}, nil
+}
+
+// defaultServiceName derives the config service document name from a
+// loader prefix, e.g. "LOG_PIPELINE_" becomes "log-pipeline".
+func defaultServiceName(prefix string) string {
+	name := strings.ToLower(strings.TrimSuffix(prefix, "_"))
+	return strings.ReplaceAll(name, "_", "-")
+}
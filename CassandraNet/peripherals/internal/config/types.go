@@ -0,0 +1,77 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// StringSlice returns a list value or the default. Values may be a JSON
+// array (`["a","b"]`) or a comma-separated list; blank entries are dropped.
+// A malformed JSON array yields the default.
+func (l Loader) StringSlice(key string, def []string) []string {
+	val, source, ok := l.resolve(key)
+	if !ok {
+		l.track(key, strings.Join(def, ","), strings.Join(def, ","), SourceDefault, false)
+		return def
+	}
+	var items []string
+	if strings.HasPrefix(strings.TrimSpace(val), "[") {
+		if err := json.Unmarshal([]byte(val), &items); err != nil {
+			l.track(key, strings.Join(def, ","), strings.Join(def, ","), SourceDefault, true)
+			return def
+		}
+	} else {
+		items = strings.Split(val, ",")
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	l.track(key, val, strings.Join(def, ","), source, false)
+	return out
+}
+
+// Float64 returns a floating point value or the default.
+func (l Loader) Float64(key string, def float64) float64 {
+	formatted := strconv.FormatFloat(def, 'g', -1, 64)
+	val, source, ok := l.resolve(key)
+	if ok {
+		if parsed, err := strconv.ParseFloat(val, 64); err == nil {
+			l.track(key, val, formatted, source, false)
+			return parsed
+		}
+	}
+	l.track(key, formatted, formatted, SourceDefault, ok)
+	return def
+}
+
+// URL returns an absolute http(s) URL value or the parsed default. Unlike
+// the scalar helpers a malformed value is reported rather than replaced by
+// the default, since silently falling back usually points traffic at the
+// wrong place. An unset key with an empty default returns nil.
+func (l Loader) URL(key, def string) (*url.URL, error) {
+	val, source, ok := l.resolve(key)
+	if !ok {
+		val, source = def, SourceDefault
+	}
+	l.track(key, val, def, source, false)
+	if val == "" {
+		return nil, nil
+	}
+	parsed, err := url.Parse(val)
+	if err != nil {
+		return nil, fmt.Errorf("%s%s: %w", l.Prefix, key, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("%s%s: scheme must be http or https", l.Prefix, key)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("%s%s: missing host", l.Prefix, key)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStringSlice(t *testing.T) {
+	loader := NewLoader("TYPES")
+	def := []string{"default"}
+
+	cases := []struct {
+		value string
+		want  []string
+	}{
+		{"", def},
+		{"a, b,,c ", []string{"a", "b", "c"}},
+		{`["x", " y ", ""]`, []string{"x", "y"}},
+		{`["unterminated"`, def},
+		{`[1, 2]`, def},
+	}
+	for _, tc := range cases {
+		t.Setenv("TYPES_LIST", tc.value)
+		if got := loader.StringSlice("LIST", def); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%q: expected %v, got %v", tc.value, tc.want, got)
+		}
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	loader := NewLoader("TYPES")
+	t.Setenv("TYPES_RATIO", "0.25")
+	if got := loader.Float64("RATIO", 1); got != 0.25 {
+		t.Fatalf("expected 0.25, got %v", got)
+	}
+	t.Setenv("TYPES_RATIO", "quarter")
+	if got := loader.Float64("RATIO", 1); got != 1 {
+		t.Fatalf("expected default for malformed value, got %v", got)
+	}
+}
+
+func TestDurationFormats(t *testing.T) {
+	loader := NewLoader("TYPES")
+	cases := map[string]time.Duration{
+		"1.5":   1500 * time.Millisecond,
+		"500ms": 500 * time.Millisecond,
+		"2h":    2 * time.Hour,
+		"1h30m": 90 * time.Minute,
+		"soon":  time.Minute,
+		"5 min": time.Minute,
+	}
+	for value, want := range cases {
+		t.Setenv("TYPES_TIMEOUT", value)
+		if got := loader.Duration("TIMEOUT", time.Minute); got != want {
+			t.Fatalf("%q: expected %s, got %s", value, want, got)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	loader := NewLoader("TYPES")
+
+	if u, err := loader.URL("ENDPOINT", ""); err != nil || u != nil {
+		t.Fatalf("expected nil URL for unset key, got %v, %v", u, err)
+	}
+	u, err := loader.URL("ENDPOINT", "http://localhost:8084")
+	if err != nil || u.Host != "localhost:8084" {
+		t.Fatalf("expected default URL, got %v, %v", u, err)
+	}
+
+	t.Setenv("TYPES_ENDPOINT", "https://notify.internal/api")
+	if u, err := loader.URL("ENDPOINT", ""); err != nil || u.Path != "/api" {
+		t.Fatalf("expected configured URL, got %v, %v", u, err)
+	}
+	for _, bad := range []string{"localhost:8084", "ftp://host", "http://", "http://host:port"} {
+		t.Setenv("TYPES_ENDPOINT", bad)
+		if _, err := loader.URL("ENDPOINT", "http://fallback"); err == nil {
+			t.Fatalf("%q: expected validation error", bad)
+		}
+	}
+}
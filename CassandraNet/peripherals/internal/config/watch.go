@@ -0,0 +1,246 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reload re-reads the loader's config file and refreshes its config service
+// document, discarding previously loaded values. Loaders backed by neither
+// are returned unchanged.
+func (l Loader) Reload() (Loader, error) {
+	next := l
+	if l.source != "" {
+		reloaded, err := NewLoader(l.Prefix).WithFile(l.source)
+		if err != nil {
+			return l, err
+		}
+		next.file = reloaded.file
+	}
+	if l.remote != nil {
+		remote, err := l.remote.refresh()
+		if err != nil {
+			return l, err
+		}
+		next.remote = remote
+	}
+	return next, nil
+}
+
+// Watcher keeps a Loader current with its config file and config service
+// document. The file is reloaded when its size or modification time changes,
+// the remote document is polled every interval, and both are refreshed when
+// the process receives SIGHUP. Subscribers are notified about the keys they
+// watch.
+type Watcher struct {
+	interval time.Duration
+	logger   interface {
+		Printf(string, ...any)
+	}
+
+	mu     sync.RWMutex
+	loader Loader
+	stamp  fileStamp
+	subs   map[int]subscription
+	nextID int
+
+	stop      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+type subscription struct {
+	keys []string
+	fn   func(Loader)
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher constructs a watcher around loader, polling its sources every
+// interval (default 5s).
+func NewWatcher(loader Loader, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *Watcher {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	w := &Watcher{
+		interval: interval,
+		logger:   logger,
+		loader:   loader,
+		subs:     make(map[int]subscription),
+		stop:     make(chan struct{}),
+	}
+	w.stamp, _ = statFile(loader.source)
+	return w
+}
+
+// Loader returns the most recently loaded configuration.
+func (w *Watcher) Loader() Loader {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.loader
+}
+
+// Subscribe registers fn to be called with the new loader after a reload
+// changes any of keys, or any file value when no keys are given. The
+// returned function cancels the subscription.
+func (w *Watcher) Subscribe(fn func(Loader), keys ...string) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextID
+	w.nextID++
+	w.subs[id] = subscription{keys: append([]string(nil), keys...), fn: fn}
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Reload re-reads the configuration and notifies subscribers whose keys
+// changed. On error the previous configuration stays in effect.
+func (w *Watcher) Reload() error {
+	_, err := w.reloadChanged()
+	return err
+}
+
+func (w *Watcher) reloadChanged() (bool, error) {
+	w.mu.RLock()
+	current := w.loader
+	w.mu.RUnlock()
+
+	stamp, _ := statFile(current.source)
+	next, err := current.Reload()
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.Lock()
+	w.loader = next
+	w.stamp = stamp
+	var notify []func(Loader)
+	for _, sub := range w.subs {
+		if changed(current, next, sub.keys) {
+			notify = append(notify, sub.fn)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, fn := range notify {
+		fn(next)
+	}
+	return changed(current, next, nil), nil
+}
+
+func changed(prev, next Loader, keys []string) bool {
+	if len(keys) == 0 {
+		return !sameValues(prev.file, next.file) || !sameValues(prev.remote.valueMap(), next.remote.valueMap())
+	}
+	for _, key := range keys {
+		oldVal, _ := prev.Lookup(key)
+		newVal, _ := next.Lookup(key)
+		if oldVal != newVal {
+			return true
+		}
+	}
+	return false
+}
+
+func sameValues(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, ok := b[k]; !ok || other != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Start begins polling and listening for SIGHUP. Loaders without a config
+// file or config service only react to SIGHUP.
+func (w *Watcher) Start() {
+	w.startOnce.Do(func() {
+		sighup := make(chan os.Signal, 1)
+		signal.Notify(sighup, syscall.SIGHUP)
+		ticker := time.NewTicker(w.interval)
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer ticker.Stop()
+			defer signal.Stop(sighup)
+			for {
+				select {
+				case <-ticker.C:
+					if w.fileChanged() {
+						w.reload("file change")
+					} else if w.Loader().remote != nil {
+						w.reload("poll")
+					}
+				case <-sighup:
+					w.reload("SIGHUP")
+				case <-w.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop halts the watcher and waits for the background loop to exit.
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+		w.wg.Wait()
+	})
+}
+
+func (w *Watcher) reload(reason string) {
+	updated, err := w.reloadChanged()
+	if err != nil {
+		w.logger.Printf("config reload (%s) failed: %v", reason, err)
+		return
+	}
+	if updated {
+		w.logger.Printf("config reloaded (%s)", reason)
+	}
+}
+
+func (w *Watcher) fileChanged() bool {
+	w.mu.RLock()
+	source, stamp := w.loader.source, w.stamp
+	w.mu.RUnlock()
+	if source == "" {
+		return false
+	}
+	current, err := statFile(source)
+	if err != nil || (current.size == stamp.size && current.modTime.Equal(stamp.modTime)) {
+		return false
+	}
+	// Record the new stamp up front so a broken file is reported once
+	// rather than on every poll.
+	w.mu.Lock()
+	w.stamp = current
+	w.mu.Unlock()
+	return true
+}
+
+func statFile(path string) (fileStamp, error) {
+	if path == "" {
+		return fileStamp{}, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
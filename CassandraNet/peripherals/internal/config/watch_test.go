@@ -0,0 +1,61 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherNotifiesChangedKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ugc.json")
+	write := func(doc string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+			t.Fatalf("write config: %v", err)
+		}
+	}
+	write(`{"workers": 4, "banned_terms": "spam"}`)
+	loader, err := Load("UGC", path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	watcher := NewWatcher(loader, time.Hour, discardLogger{})
+	var workers, banned, all int
+	watcher.Subscribe(func(l Loader) { workers = l.Int("WORKERS", 0) }, "WORKERS")
+	watcher.Subscribe(func(Loader) { banned++ }, "BANNED_TERMS")
+	cancel := watcher.Subscribe(func(Loader) { all++ })
+
+	write(`{"workers": 8, "banned_terms": "spam"}`)
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if workers != 8 || banned != 0 || all != 1 {
+		t.Fatalf("unexpected notifications: workers=%d banned=%d all=%d", workers, banned, all)
+	}
+	if got := watcher.Loader().Int("WORKERS", 0); got != 8 {
+		t.Fatalf("expected reloaded value, got %d", got)
+	}
+
+	cancel()
+	write(`{"workers": 8, "banned_terms": "spam,scam"}`)
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if banned != 1 || all != 1 {
+		t.Fatalf("unexpected notifications: banned=%d all=%d", banned, all)
+	}
+
+	write(`{"workers": `)
+	if err := watcher.Reload(); err == nil {
+		t.Fatal("expected parse error")
+	}
+	if got := watcher.Loader().String("BANNED_TERMS", ""); got != "spam,scam" {
+		t.Fatalf("expected previous config to remain, got %q", got)
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
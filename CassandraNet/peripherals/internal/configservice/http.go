@@ -0,0 +1,163 @@
+package configservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the config service.
+const (
+	codeInvalidRequest     = "config.invalid_request"
+	codeNotFound           = "config.not_found"
+	codePreconditionFailed = "config.precondition_failed"
+)
+
+const (
+	configsBasePath = "/configs"
+	configsPrefix   = "/configs/"
+
+	maxDocumentBytes = 1 << 20
+)
+
+// Handler returns an HTTP handler for configuration documents.
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(configsBasePath, s.handleList)
+	mux.HandleFunc(configsPrefix, s.handleDocument)
+	return mux
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	infos, err := s.List(r.Context(), r.URL.Query().Get("service"))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (s *Service) handleDocument(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, configsPrefix), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	service, environment := parts[0], parts[1]
+
+	switch r.Method {
+	case http.MethodGet:
+		doc, err := s.Get(r.Context(), service, environment)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", doc.ETag)
+		if etagMatches(r.Header.Get("If-None-Match"), doc.ETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeJSON(w, http.StatusOK, doc)
+	case http.MethodPut:
+		values, err := decodeValues(r)
+		if err != nil {
+			problem.DecodeFailed(w, r, codeInvalidRequest, err.Error(), err)
+			return
+		}
+		doc, err := s.Put(r.Context(), service, environment, values, r.Header.Get("If-Match"))
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", doc.ETag)
+		status := http.StatusOK
+		if doc.Version == 1 {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, doc)
+	case http.MethodDelete:
+		if err := s.Delete(r.Context(), service, environment); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// decodeValues reads a JSON, YAML, or TOML document (chosen by
+// Content-Type, JSON by default) and flattens it the same way config files
+// are flattened, so a service's local file can be published unchanged.
+func decodeValues(r *http.Request) (map[string]string, error) {
+	defer r.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if len(data) > maxDocumentBytes {
+		return nil, validation.Invalid("document", validation.RuleMaxBytes, fmt.Sprintf("must be at most %d bytes", maxDocumentBytes))
+	}
+	ext := ".json"
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		switch mediaType {
+		case "application/yaml", "application/x-yaml", "text/yaml":
+			ext = ".yaml"
+		case "application/toml", "text/toml":
+			ext = ".toml"
+		}
+	}
+	values, err := config.ParseFile(ext, data)
+	if err != nil {
+		return nil, errors.New("invalid document: " + err.Error())
+	}
+	return values, nil
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		problem.Write(w, r, http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
+
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "config", methods...)
+}
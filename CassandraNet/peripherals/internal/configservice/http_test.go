@@ -0,0 +1,155 @@
+package configservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+func put(t *testing.T, url, contentType, body, ifMatch string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	return resp
+}
+
+func TestDocumentETags(t *testing.T) {
+	server := httptest.NewServer(NewService(NewMemoryStore(), nil).Handler())
+	defer server.Close()
+	url := server.URL + "/configs/ugc/prod"
+
+	resp := put(t, url, "application/yaml", "workers: 8\nbanned_terms: [spam, scam]\n", "")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 got %d", resp.StatusCode)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("expected etag")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("If-None-Match", etag)
+	cached, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	_ = cached.Body.Close()
+	if cached.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 got %d", cached.StatusCode)
+	}
+
+	if resp := put(t, url, "application/json", `{"workers": 2}`, `"stale"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 got %d", resp.StatusCode)
+	}
+	if resp := put(t, url, "application/json", `{"workers": 2}`, etag); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+
+	missing, err := http.Get(server.URL + "/configs/ugc/staging")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	_ = missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", missing.StatusCode)
+	}
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {
+	// no-op: suppress logging during tests
+}
+
+func TestChangesAreAudited(t *testing.T) {
+	log := audit.New(storage.NewMemory(), "config-service", noopLogger{})
+	svc := NewService(NewMemoryStore(), nil)
+	svc.SetAudit(log)
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	url := server.URL + "/configs/ugc/prod"
+
+	put(t, url, "application/json", `{"workers": 8}`, "")
+	put(t, url, "application/json", `{"workers": 2}`, `"stale"`)
+	put(t, url, "application/json", `{"workers": 2}`, "")
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	entries, _, err := log.List(context.Background(), audit.Filter{Resource: "configs/ugc/prod"}, pagination.Request{Limit: 10})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	actions := make([]string, len(entries))
+	for i, entry := range entries {
+		actions[i] = entry.Action
+	}
+	if strings.Join(actions, ",") != "config.document.put,config.document.put,config.document.delete" {
+		t.Fatalf("unexpected audit trail %v", actions)
+	}
+	if entries[0].Before != nil || !strings.Contains(string(entries[1].Before), `"WORKERS":"8"`) ||
+		!strings.Contains(string(entries[1].After), `"WORKERS":"2"`) || entries[2].After != nil {
+		t.Fatalf("unexpected states %+v", entries)
+	}
+}
+
+func TestLoaderRefreshesFromService(t *testing.T) {
+	server := httptest.NewServer(NewService(NewMemoryStore(), nil).Handler())
+	defer server.Close()
+	put(t, server.URL+"/configs/ugc/prod", "application/json", `{"workers": 8}`, "")
+
+	t.Setenv("UGC_CONFIG_URL", server.URL)
+	t.Setenv("UGC_CONFIG_ENV", "prod")
+	loader, err := config.Load("UGC", "")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := loader.Int("WORKERS", 4); got != 8 {
+		t.Fatalf("expected remote value, got %d", got)
+	}
+
+	watcher := config.NewWatcher(loader, 0, silentLogger{})
+	var workers int
+	watcher.Subscribe(func(l config.Loader) { workers = l.Int("WORKERS", 4) }, "WORKERS")
+
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if workers != 0 {
+		t.Fatalf("unchanged document should not notify, got %d", workers)
+	}
+	put(t, server.URL+"/configs/ugc/prod", "application/json", `{"workers": 16}`, "")
+	if err := watcher.Reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if workers != 16 {
+		t.Fatalf("expected refreshed value, got %d", workers)
+	}
+
+	t.Setenv("UGC_WORKERS", "3")
+	if got := watcher.Loader().Int("WORKERS", 4); got != 3 {
+		t.Fatalf("expected env override, got %d", got)
+	}
+}
+
+type silentLogger struct{}
+
+func (silentLogger) Printf(string, ...any) {}
@@ -0,0 +1,176 @@
+package configservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// MemoryStore implements Store using an in-memory map.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	docs map[string]Document
+}
+
+// NewMemoryStore constructs an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{docs: make(map[string]Document)}
+}
+
+func docKey(service, environment string) string {
+	return service + "/" + environment
+}
+
+// Get returns the document for service/environment.
+func (m *MemoryStore) Get(_ context.Context, service, environment string) (Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	doc, ok := m.docs[docKey(service, environment)]
+	if !ok {
+		return Document{}, ErrNotFound
+	}
+	doc.Values = cloneValues(doc.Values)
+	return doc, nil
+}
+
+// Put stores doc, assigning the next version. A non-empty ifMatch must equal
+// the stored ETag ("*" only requires that a document exists).
+func (m *MemoryStore) Put(_ context.Context, doc Document, ifMatch string) (Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := docKey(doc.Service, doc.Environment)
+	existing, ok := m.docs[key]
+	if err := checkPrecondition(existing, ok, ifMatch); err != nil {
+		return Document{}, err
+	}
+	doc.Version = existing.Version + 1
+	doc.Values = cloneValues(doc.Values)
+	m.docs[key] = doc
+	doc.Values = cloneValues(doc.Values)
+	return doc, nil
+}
+
+// Delete removes the document for service/environment.
+func (m *MemoryStore) Delete(_ context.Context, service, environment string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := docKey(service, environment)
+	if _, ok := m.docs[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.docs, key)
+	return nil
+}
+
+// List returns every document ordered by service and environment.
+func (m *MemoryStore) List(_ context.Context) ([]Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	docs := make([]Document, 0, len(m.docs))
+	for _, doc := range m.docs {
+		doc.Values = cloneValues(doc.Values)
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool {
+		return docKey(docs[i].Service, docs[i].Environment) < docKey(docs[j].Service, docs[j].Environment)
+	})
+	return docs, nil
+}
+
+func checkPrecondition(existing Document, exists bool, ifMatch string) error {
+	switch {
+	case ifMatch == "":
+		return nil
+	case ifMatch == "*":
+		if !exists {
+			return ErrPreconditionFailed
+		}
+	case !exists || existing.ETag != ifMatch:
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// FileStore is a MemoryStore that rewrites a JSON file after every change,
+// so published documents survive restarts.
+type FileStore struct {
+	*MemoryStore
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore loads documents from path (if it exists) and persists
+// subsequent changes to it.
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return store, nil
+	case err != nil:
+		return nil, fmt.Errorf("read config store: %w", err)
+	}
+	var docs []Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("decode config store: %w", err)
+	}
+	for _, doc := range docs {
+		store.docs[docKey(doc.Service, doc.Environment)] = doc
+	}
+	return store, nil
+}
+
+// Put stores doc and persists the store.
+func (f *FileStore) Put(ctx context.Context, doc Document, ifMatch string) (Document, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.MemoryStore.Put(ctx, doc, ifMatch)
+	if err != nil {
+		return Document{}, err
+	}
+	return stored, f.save(ctx)
+}
+
+// Delete removes a document and persists the store.
+func (f *FileStore) Delete(ctx context.Context, service, environment string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.MemoryStore.Delete(ctx, service, environment); err != nil {
+		return err
+	}
+	return f.save(ctx)
+}
+
+func (f *FileStore) save(ctx context.Context) error {
+	docs, _ := f.MemoryStore.List(ctx)
+	data, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode config store: %w", err)
+	}
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create config store dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create config store: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write config store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write config store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("replace config store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package configservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrNotFound indicates no document exists for the service/environment.
+	ErrNotFound = errors.New("configservice: document not found")
+	// ErrPreconditionFailed indicates an If-Match check did not hold.
+	ErrPreconditionFailed = errors.New("configservice: etag mismatch")
+)
+
+// Store abstracts persistence for configuration documents.
+type Store interface {
+	Get(ctx context.Context, service, environment string) (Document, error)
+	Put(ctx context.Context, doc Document, ifMatch string) (Document, error)
+	Delete(ctx context.Context, service, environment string) error
+	List(ctx context.Context) ([]Document, error)
+}
+
+// Clock allows deterministic timing in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// Service publishes per-service, per-environment configuration documents.
+type Service struct {
+	store Store
+	clock Clock
+	audit *audit.Log
+}
+
+// NewService builds a Service with the provided store.
+func NewService(store Store, clock Clock) *Service {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Service{store: store, clock: clock}
+}
+
+// SetAudit records every publish and delete in log. Call it before the
+// service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// Get returns the document for service/environment.
+func (s *Service) Get(ctx context.Context, service, environment string) (Document, error) {
+	if err := validateName(service, environment); err != nil {
+		return Document{}, err
+	}
+	return s.store.Get(ctx, service, environment)
+}
+
+// Put replaces the values for service/environment. ifMatch, when set, must
+// match the current ETag so concurrent editors do not overwrite each other.
+func (s *Service) Put(ctx context.Context, service, environment string, values map[string]string, ifMatch string) (Document, error) {
+	if err := validateName(service, environment); err != nil {
+		return Document{}, err
+	}
+	before, err := s.previous(ctx, service, environment)
+	if err != nil {
+		return Document{}, err
+	}
+	doc, err := s.store.Put(ctx, Document{
+		Service:     service,
+		Environment: environment,
+		ETag:        computeETag(values),
+		UpdatedAt:   s.clock.Now(),
+		Values:      values,
+	}, ifMatch)
+	if err != nil {
+		return Document{}, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "config.document.put",
+		Resource: documentResource(service, environment),
+		Before:   before,
+		After:    doc,
+	})
+	return doc, nil
+}
+
+// Delete removes the document for service/environment.
+func (s *Service) Delete(ctx context.Context, service, environment string) error {
+	if err := validateName(service, environment); err != nil {
+		return err
+	}
+	before, err := s.previous(ctx, service, environment)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, service, environment); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "config.document.delete",
+		Resource: documentResource(service, environment),
+		Before:   before,
+	})
+	return nil
+}
+
+// List summarises every stored document, optionally limited to one service.
+func (s *Service) List(ctx context.Context, service string) ([]DocumentInfo, error) {
+	docs, err := s.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]DocumentInfo, 0, len(docs))
+	for _, doc := range docs {
+		if service != "" && doc.Service != service {
+			continue
+		}
+		infos = append(infos, doc.info())
+	}
+	return infos, nil
+}
+
+// previous returns the stored document for the audit log's before state,
+// nil when auditing is off or none exists.
+func (s *Service) previous(ctx context.Context, service, environment string) (any, error) {
+	if s.audit == nil {
+		return nil, nil
+	}
+	doc, err := s.store.Get(ctx, service, environment)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func documentResource(service, environment string) string {
+	return "configs/" + service + "/" + environment
+}
+
+func validateName(service, environment string) error {
+	var v validation.Validator
+	v.ID("service", service).Excludes("/")
+	v.ID("environment", environment).Excludes("/")
+	return v.Err()
+}
+
+// computeETag derives a strong ETag from the document values, so publishing
+// identical content leaves clients' cached copies valid.
+func computeETag(values map[string]string) string {
+	encoded, _ := json.Marshal(values)
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
@@ -0,0 +1,44 @@
+package configservice
+
+import "time"
+
+// Document is the configuration published for one service in one
+// environment. Values use the flattened, upper-cased keys understood by
+// config.Loader.
+type Document struct {
+	Service     string            `json:"service"`
+	Environment string            `json:"environment"`
+	Version     int64             `json:"version"`
+	ETag        string            `json:"etag"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Values      map[string]string `json:"values"`
+}
+
+// DocumentInfo summarises a document without its values.
+type DocumentInfo struct {
+	Service     string    `json:"service"`
+	Environment string    `json:"environment"`
+	Version     int64     `json:"version"`
+	ETag        string    `json:"etag"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Keys        int       `json:"keys"`
+}
+
+func (d Document) info() DocumentInfo {
+	return DocumentInfo{
+		Service:     d.Service,
+		Environment: d.Environment,
+		Version:     d.Version,
+		ETag:        d.ETag,
+		UpdatedAt:   d.UpdatedAt,
+		Keys:        len(d.Values),
+	}
+}
+
+func cloneValues(values map[string]string) map[string]string {
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+// Package dashboard serves the operators' web dashboard: a single page,
+// embedded in the binary, that shows queue depths, recent logs, content
+// awaiting review, assignment states, and notification history. The page
+// holds no data of its own. Its script reads everything from the JSON APIs
+// behind the same address, sending the API key or bearer token the
+// operator enters, so every panel is subject to the same authentication
+// and role checks as a hand-written request.
+//
+// Binaries that route every API, the gateway and the all-in-one binary,
+// mount Handler at Path outside their authentication, since the browser
+// cannot send credentials when it loads the page.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Path is where binaries mount Handler.
+const Path = "/dashboard/"
+
+// Problem codes returned by the dashboard.
+const codeNotFound = "dashboard.not_found"
+
+// contentSecurityPolicy confines the page to its own scripts and styles and
+// to requests back to the address that served it.
+const contentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self' data:; base-uri 'none'; form-action 'none'; frame-ancestors 'none'"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the page at Path and its assets below it.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			problem.MethodNotAllowed(w, r, "dashboard", http.MethodGet, http.MethodHead)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(Path, "/"))), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if info, err := fs.Stat(files, name); err != nil || info.IsDir() {
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "no such page")
+			return
+		}
+		w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		// Embedded files carry no modification time to revalidate against,
+		// and a new binary may change them.
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, files, name)
+	})
+}
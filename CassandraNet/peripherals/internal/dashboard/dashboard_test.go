@@ -0,0 +1,55 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerServesPageAndAssets(t *testing.T) {
+	h := Handler()
+	for _, tc := range []struct {
+		path, contentType, contains string
+	}{
+		{Path, "text/html", `<script src="app.js" defer></script>`},
+		{Path + "app.js", "javascript", "/orchestration/assignments"},
+		{Path + "style.css", "text/css", "table"},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tc.path, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.Contains(got, tc.contentType) {
+			t.Fatalf("%s: expected %s, got %q", tc.path, tc.contentType, got)
+		}
+		if !strings.Contains(rec.Header().Get("Content-Security-Policy"), "script-src 'self'") {
+			t.Fatalf("%s: expected a content security policy, got %v", tc.path, rec.Header())
+		}
+		if !strings.Contains(rec.Body.String(), tc.contains) {
+			t.Fatalf("%s: expected body to contain %q", tc.path, tc.contains)
+		}
+	}
+}
+
+func TestHandlerRefusesOtherPaths(t *testing.T) {
+	h := Handler()
+	for _, path := range []string{Path + "missing.js", Path + "../dashboard.go", Path + "static"} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusNotFound || body.Code != codeNotFound {
+			t.Fatalf("%s: expected 404 %s, got %d %s", path, codeNotFound, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, Path, nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") == "" {
+		t.Fatalf("expected 405 with Allow, got %d %v", rec.Code, rec.Header())
+	}
+}
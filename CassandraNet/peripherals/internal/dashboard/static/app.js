@@ -0,0 +1,415 @@
+// CassandraNet dashboard. Every panel reads a JSON API behind the address
+// that served this page, sending the credential entered in the settings
+// form; nothing is cached beyond the browser tab.
+"use strict";
+
+// Lists are read a page at a time, following next_cursor, up to
+// maxPages pages of pageLimit items.
+const pageLimit = 1000;
+const maxPages = 10;
+// Rows shown in the log, notification, and review tables.
+const rows = 50;
+// Terminal assignment states, left out of the active list.
+const finished = new Set(["completed", "failed", "cancelled"]);
+
+const settingsKey = "cassandra.dashboard";
+const secretKey = "cassandra.dashboard.secret";
+
+let settings = loadSettings();
+let timer = null;
+let stream = null;
+
+// loadSettings reads the form's values. The secret lives in sessionStorage,
+// so it is forgotten when the tab closes.
+function loadSettings() {
+  let saved = {};
+  try {
+    saved = JSON.parse(localStorage.getItem(settingsKey)) || {};
+  } catch (e) {
+    saved = {};
+  }
+  return {
+    scheme: saved.scheme || "api-key",
+    tenant: saved.tenant || "",
+    project: saved.project || "",
+    topics: saved.topics || "",
+    refresh: saved.refresh === undefined ? 15 : saved.refresh,
+    secret: sessionStorage.getItem(secretKey) || "",
+  };
+}
+
+function saveSettings() {
+  const { secret, ...rest } = settings;
+  localStorage.setItem(settingsKey, JSON.stringify(rest));
+  sessionStorage.setItem(secretKey, secret);
+}
+
+// APIError carries the problem details of a failed call.
+class APIError extends Error {
+  constructor(status, code, detail) {
+    super(detail ? `${status} ${code}: ${detail}` : `${status} ${code}`);
+    this.status = status;
+    this.code = code;
+  }
+}
+
+function requestHeaders(extra) {
+  const headers = { Accept: "application/json", ...extra };
+  if (settings.secret) {
+    if (settings.scheme === "bearer") {
+      headers.Authorization = "Bearer " + settings.secret;
+    } else {
+      headers["X-API-Key"] = settings.secret;
+    }
+  }
+  return headers;
+}
+
+function url(path, params) {
+  const query = new URLSearchParams();
+  for (const [key, value] of Object.entries(params || {})) {
+    // An empty cursor still asks lists that predate paging, such as
+    // pulls, for the page envelope rather than a bare array.
+    if (value !== undefined && (value !== "" || key === "cursor")) {
+      query.set(key, value);
+    }
+  }
+  const text = query.toString();
+  return text ? `${path}?${text}` : path;
+}
+
+// scope returns the tenant and project filters for APIs that take them.
+function scope() {
+  return { tenant_id: settings.tenant, project_id: settings.project };
+}
+
+async function failure(resp) {
+  let body = {};
+  try {
+    body = await resp.json();
+  } catch (e) {
+    body = {};
+  }
+  return new APIError(resp.status, body.code || resp.statusText, body.detail || "");
+}
+
+async function getJSON(path, params) {
+  const resp = await fetch(url(path, params), { headers: requestHeaders(), cache: "no-store" });
+  if (!resp.ok) {
+    throw await failure(resp);
+  }
+  return resp.json();
+}
+
+// collect reads every page of a list, up to maxPages, keeping the last keep
+// items when keep is set. truncated reports pages left unread.
+async function collect(path, params, keep) {
+  let items = [];
+  let cursor = "";
+  for (let page = 0; page < maxPages; page++) {
+    const body = await getJSON(path, { ...params, limit: pageLimit, cursor });
+    items = items.concat(body.items || []);
+    if (keep && items.length > keep) {
+      items = items.slice(items.length - keep);
+    }
+    cursor = body.next_cursor || "";
+    if (!cursor) {
+      return { items, truncated: false };
+    }
+  }
+  return { items, truncated: true };
+}
+
+// el builds an element. Children are nodes or text, never markup, so values
+// from the APIs cannot inject any.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    node.setAttribute(key, value);
+  }
+  for (const child of children) {
+    node.append(child instanceof Node ? child : String(child ?? ""));
+  }
+  return node;
+}
+
+function table(columns, items, cells) {
+  if (items.length === 0) {
+    return el("p", { class: "muted" }, "Nothing to show.");
+  }
+  return el("table", {},
+    el("thead", {}, el("tr", {}, ...columns.map((c) => el("th", {}, c)))),
+    el("tbody", {}, ...items.map((item) => el("tr", {}, ...cells(item).map((c) => el("td", {}, c))))));
+}
+
+function badge(text) {
+  return el("span", { class: "badge " + String(text).toLowerCase() }, text);
+}
+
+function ago(timestamp) {
+  if (!timestamp) {
+    return "-";
+  }
+  const seconds = Math.max(0, Math.round((Date.now() - Date.parse(timestamp)) / 1000));
+  if (seconds < 60) {
+    return `${seconds}s ago`;
+  }
+  if (seconds < 3600) {
+    return `${Math.floor(seconds / 60)}m ago`;
+  }
+  if (seconds < 86400) {
+    return `${Math.floor(seconds / 3600)}h ago`;
+  }
+  return `${Math.floor(seconds / 86400)}d ago`;
+}
+
+function count(n, truncated) {
+  return truncated ? `${n}+` : String(n);
+}
+
+function show(id, ...nodes) {
+  document.querySelector(`#${id} .body`).replaceChildren(...nodes);
+}
+
+function showError(id, err) {
+  let hint = "";
+  if (err.status === 401) {
+    hint = " Enter a credential above.";
+  } else if (err.status === 403) {
+    hint = " The credential lacks the role this panel needs.";
+  } else if (err.status === 404) {
+    hint = " The service may not be routed through this address.";
+  }
+  show(id, el("p", { class: "error" }, err.message + "." + hint));
+}
+
+async function panel(id, load) {
+  try {
+    show(id, ...[].concat(await load()));
+  } catch (err) {
+    showError(id, err);
+  }
+}
+
+function topics() {
+  return settings.topics.split(",").map((t) => t.trim()).filter((t) => t !== "");
+}
+
+async function loadQueues() {
+  const names = topics();
+  if (names.length === 0) {
+    return el("p", { class: "muted" }, "List the topics to watch in the settings above.");
+  }
+  const depths = await Promise.all(names.map(async (topic) => {
+    try {
+      const { items, truncated } = await collect(`/messaging/topics/${encodeURIComponent(topic)}/messages`, scope());
+      const oldest = items.reduce((min, m) => (!min || Date.parse(m.published_at) < Date.parse(min) ? m.published_at : min), "");
+      return { topic, pending: count(items.length, truncated), oldest: ago(oldest) };
+    } catch (err) {
+      return { topic, pending: "-", oldest: err.message };
+    }
+  }));
+  return table(["Topic", "Pending", "Oldest"], depths, (d) => [d.topic, d.pending, d.oldest]);
+}
+
+async function loadAssignments() {
+  const { items, truncated } = await collect("/orchestration/assignments", scope());
+  const totals = new Map();
+  for (const a of items) {
+    totals.set(a.status, (totals.get(a.status) || 0) + 1);
+  }
+  const active = items
+    .filter((a) => !finished.has(a.status))
+    .sort((a, b) => Date.parse(b.updated_at) - Date.parse(a.updated_at))
+    .slice(0, rows);
+  return [
+    table(["Status", "Assignments"], [...totals.entries()].sort(), ([status, n]) => [badge(status), count(n, truncated)]),
+    el("h3", {}, "Active"),
+    table(["Assignment", "Agent", "Workload", "Status", "Message", "Updated"], active,
+      (a) => [a.assignment_id, a.agent_id, a.workload_id, badge(a.status), a.status_message || "", ago(a.updated_at)]),
+  ];
+}
+
+async function loadReview() {
+  const body = await getJSON("/ugc/content", { ...scope(), state: "pending", limit: rows });
+  const items = body.items || [];
+  return [
+    el("p", {}, `${count(items.length, Boolean(body.next_cursor))} pending`),
+    table(["Content", "Tenant", "File", "Type", "Size", "Submitted"], items,
+      (c) => [c.content_id, c.tenant_id, c.filename, c.mime_type, c.size_bytes, ago(c.submitted_at)]),
+  ];
+}
+
+async function loadLogs() {
+  const { items } = await collect("/logs/recent", {}, rows);
+  return table(["Time", "Level", "Source", "Message"], items.reverse(),
+    (e) => [ago(e.timestamp), badge(e.level || "INFO"), e.source, e.message]);
+}
+
+async function loadNotifications() {
+  const { items } = await collect("/notifications/recent", {}, rows);
+  return table(["Sent", "Channel", "Recipient", "Body"], items.reverse(),
+    (d) => [ago(d.sent_at), d.channel, d.recipient, d.body]);
+}
+
+async function refresh() {
+  clearTimeout(timer);
+  await Promise.all([
+    panel("queues", loadQueues),
+    panel("assignments", loadAssignments),
+    panel("review", loadReview),
+    panel("logs", loadLogs),
+    panel("notifications", loadNotifications),
+  ]);
+  document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  if (settings.refresh > 0) {
+    timer = setTimeout(() => {
+      if (!document.hidden) {
+        refresh();
+      }
+    }, settings.refresh * 1000);
+  }
+}
+
+// FlaggedStream follows the moderation worker's result stream. EventSource
+// cannot send credentials, so the stream is read with fetch and parsed
+// here, reconnecting with the last event's ID after a failure.
+class FlaggedStream {
+  constructor() {
+    this.results = [];
+    this.lastEventID = "";
+    this.abort = new AbortController();
+    this.status = el("p", { class: "muted" }, "Connecting...");
+    this.render();
+    this.run();
+  }
+
+  stop() {
+    this.abort.abort();
+  }
+
+  render() {
+    show("flagged", this.status, table(["Processed", "Content", "Author", "Reason"], this.results,
+      (r) => [ago(r.processed_at), r.job.content_id, r.job.author_id, r.reason]));
+  }
+
+  async run() {
+    let backoff = 1000;
+    while (!this.abort.signal.aborted) {
+      try {
+        await this.read();
+        backoff = 1000;
+      } catch (err) {
+        if (this.abort.signal.aborted) {
+          return;
+        }
+        if (err.status === 404 || err.status === 403 || err.status === 401) {
+          showError("flagged", err);
+          return;
+        }
+        this.status.textContent = `Disconnected (${err.message}); retrying.`;
+        this.render();
+      }
+      await new Promise((resolve) => setTimeout(resolve, backoff));
+      backoff = Math.min(backoff * 2, 30000);
+    }
+  }
+
+  async read() {
+    const extra = { Accept: "text/event-stream" };
+    if (this.lastEventID) {
+      extra["Last-Event-ID"] = this.lastEventID;
+    }
+    const resp = await fetch(url("/ugc-worker/jobs/results/stream", { decision: "flagged" }), {
+      headers: requestHeaders(extra),
+      signal: this.abort.signal,
+      cache: "no-store",
+    });
+    if (!resp.ok) {
+      throw await failure(resp);
+    }
+    this.status.textContent = "Live.";
+    this.render();
+    const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+    let buffer = "";
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) {
+        return;
+      }
+      buffer += value.replace(/\r\n?/g, "\n");
+      let end;
+      while ((end = buffer.indexOf("\n\n")) >= 0) {
+        this.dispatch(buffer.slice(0, end));
+        buffer = buffer.slice(end + 2);
+      }
+    }
+  }
+
+  dispatch(block) {
+    let event = "message";
+    let data = "";
+    for (const line of block.split("\n")) {
+      const colon = line.indexOf(":");
+      if (colon === 0) {
+        continue;
+      }
+      const field = colon < 0 ? line : line.slice(0, colon);
+      const value = colon < 0 ? "" : line.slice(colon + 1).replace(/^ /, "");
+      if (field === "id") {
+        this.lastEventID = value;
+      } else if (field === "event") {
+        event = value;
+      } else if (field === "data") {
+        data += value;
+      }
+    }
+    if (event !== "result" || data === "") {
+      return;
+    }
+    this.results.unshift(JSON.parse(data));
+    this.results.length = Math.min(this.results.length, rows);
+    this.render();
+  }
+}
+
+function restartStream() {
+  if (stream) {
+    stream.stop();
+  }
+  stream = new FlaggedStream();
+}
+
+function fillForm(form) {
+  for (const name of ["scheme", "secret", "tenant", "project", "topics"]) {
+    form.elements[name].value = settings[name];
+  }
+  form.elements.refresh.value = String(settings.refresh);
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  const form = document.getElementById("settings");
+  fillForm(form);
+  form.addEventListener("submit", (event) => {
+    event.preventDefault();
+    settings = {
+      scheme: form.elements.scheme.value,
+      secret: form.elements.secret.value.trim(),
+      tenant: form.elements.tenant.value.trim(),
+      project: form.elements.project.value.trim(),
+      topics: form.elements.topics.value,
+      refresh: Number(form.elements.refresh.value),
+    };
+    saveSettings();
+    restartStream();
+    refresh();
+  });
+  document.getElementById("refresh-now").addEventListener("click", () => refresh());
+  document.addEventListener("visibilitychange", () => {
+    if (!document.hidden && settings.refresh > 0) {
+      refresh();
+    }
+  });
+  restartStream();
+  refresh();
+});
@@ -0,0 +1,343 @@
+// Package encryption seals sensitive fields — message payloads,
+// notification recipients, UGC attributes, and the copies other stores
+// keep of them — before services write them to storage, and opens them
+// again on read, so callers of the API never see the difference. It uses
+// envelope encryption: each value is encrypted with AES-256-GCM under a
+// data key, and the data key is stored beside it, wrapped by a
+// key-encryption key that never leaves its KeyWrapper, a local key file or
+// a Vault transit key:
+//
+//	cfg, err := encryption.FromConfig(loader)
+//	keyring, err := encryption.New(cfg, transport, logger)
+//	store.SetKeyring(keyring)
+//
+// A data key is used for Config.DataKeyLifetime and wrapped once, and
+// unwrapped keys are cached, so the key-encryption key is seldom called.
+// Rotating the key-encryption key — making a new key in the file active,
+// or rotating the Vault key — applies to the next data key. Rotate starts
+// one at once and re-seals every registered store's records under it, so
+// the old key can be retired. A nil Keyring seals nothing.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// Errors returned when opening sealed values.
+var (
+	// ErrNoKeys means a value is sealed but no keys are configured.
+	ErrNoKeys = errors.New("encryption: value is sealed but no keys are configured")
+	// ErrUnknownKey means a value is sealed under a key this deployment
+	// does not have.
+	ErrUnknownKey = errors.New("encryption: unknown key")
+	// ErrCorrupt means a sealed value is malformed or fails
+	// authentication.
+	ErrCorrupt = errors.New("encryption: sealed value is corrupt")
+)
+
+// formatVersion is the first byte of every sealed value:
+//
+//	version(1) | len(keyID)(1) | keyID | len(wrapped)(2) | wrapped | nonce(12) | ciphertext
+const formatVersion = 1
+
+// maxDataKeyUses bounds how many values one data key seals, well under
+// the limit for random GCM nonces.
+const maxDataKeyUses = 1 << 24
+
+// maxOpenedKeys bounds the cache of unwrapped data keys.
+const maxOpenedKeys = 1024
+
+// KeyWrapper protects data keys with a key-encryption key.
+type KeyWrapper interface {
+	// Name describes the provider, such as "file" or "vault".
+	Name() string
+	// Wrap encrypts dek under the active key and returns that key's ID
+	// with the result.
+	Wrap(ctx context.Context, dek []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap decrypts a data key wrapped under keyID, returning
+	// ErrUnknownKey when the key is not available.
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Config selects and tunes a key provider. At most one of KeyFile and
+// Vault.URL may be set; with neither, New returns a nil Keyring.
+type Config struct {
+	// KeyFile holds key-encryption keys, one "id=base64" line each, and
+	// ActiveKey names the one that wraps new data keys (default the last
+	// in the file).
+	KeyFile   string
+	ActiveKey string
+	Vault     VaultConfig
+	// DataKeyLifetime is how long one data key seals values (default 1h).
+	DataKeyLifetime time.Duration
+}
+
+// FromConfig reads ENCRYPTION_KEY_FILE, ENCRYPTION_ACTIVE_KEY,
+// ENCRYPTION_VAULT_URL, ENCRYPTION_VAULT_TOKEN, ENCRYPTION_VAULT_MOUNT
+// (default "transit"), ENCRYPTION_VAULT_KEY, and
+// ENCRYPTION_DATA_KEY_LIFETIME (default 1h). Conflicting or incomplete
+// settings are reported rather than ignored.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg := Config{
+		KeyFile:   loader.String("ENCRYPTION_KEY_FILE", ""),
+		ActiveKey: loader.String("ENCRYPTION_ACTIVE_KEY", ""),
+		Vault: VaultConfig{
+			Token: loader.Secret("ENCRYPTION_VAULT_TOKEN", ""),
+			Mount: loader.String("ENCRYPTION_VAULT_MOUNT", "transit"),
+			Key:   loader.String("ENCRYPTION_VAULT_KEY", ""),
+		},
+		DataKeyLifetime: loader.Duration("ENCRYPTION_DATA_KEY_LIFETIME", time.Hour),
+	}
+	vault, err := loader.URL("ENCRYPTION_VAULT_URL", "")
+	if err != nil {
+		return Config{}, err
+	}
+	if vault != nil {
+		cfg.Vault.URL = vault.String()
+	}
+	switch {
+	case cfg.KeyFile != "" && cfg.Vault.URL != "":
+		return Config{}, fmt.Errorf("%sENCRYPTION_KEY_FILE and %sENCRYPTION_VAULT_URL are exclusive", loader.Prefix, loader.Prefix)
+	case cfg.Vault.URL != "" && (cfg.Vault.Key == "" || cfg.Vault.Token == ""):
+		return Config{}, fmt.Errorf("%sENCRYPTION_VAULT_URL needs %sENCRYPTION_VAULT_KEY and %sENCRYPTION_VAULT_TOKEN", loader.Prefix, loader.Prefix, loader.Prefix)
+	case cfg.ActiveKey != "" && cfg.KeyFile == "":
+		return Config{}, fmt.Errorf("%sENCRYPTION_ACTIVE_KEY needs %sENCRYPTION_KEY_FILE", loader.Prefix, loader.Prefix)
+	}
+	return cfg, nil
+}
+
+// Keyring seals and opens values with data keys protected by a
+// KeyWrapper, and rotates the records of the stores registered with it.
+type Keyring struct {
+	wrapper  KeyWrapper
+	lifetime time.Duration
+	logger   logging.Printer
+	now      func() time.Time
+
+	mu        sync.Mutex
+	current   *dataKey
+	opened    map[string][]byte
+	resealers []Resealer
+	reports   map[string]Report
+
+	// rotating is held for the whole of a Rotate.
+	rotating sync.Mutex
+}
+
+// dataKey is the key sealing new values, with its wrapped form.
+type dataKey struct {
+	aead    cipher.AEAD
+	keyID   string
+	wrapped []byte
+	created time.Time
+	uses    int
+}
+
+// New returns a Keyring for the provider cfg selects, reaching Vault
+// through transport (nil uses http.DefaultTransport), or nil when cfg
+// selects none.
+func New(cfg Config, transport http.RoundTripper, logger logging.Printer) (*Keyring, error) {
+	var wrapper KeyWrapper
+	switch {
+	case cfg.KeyFile != "":
+		keys, err := LoadKeyFile(cfg.KeyFile, cfg.ActiveKey)
+		if err != nil {
+			return nil, err
+		}
+		wrapper = keys
+	case cfg.Vault.URL != "":
+		vault, err := NewVault(cfg.Vault, transport)
+		if err != nil {
+			return nil, err
+		}
+		wrapper = vault
+	default:
+		return nil, nil
+	}
+	return NewKeyring(wrapper, cfg.DataKeyLifetime, logger), nil
+}
+
+// NewKeyring returns a Keyring wrapping data keys with wrapper, each used
+// for lifetime (default 1h).
+func NewKeyring(wrapper KeyWrapper, lifetime time.Duration, logger logging.Printer) *Keyring {
+	if lifetime <= 0 {
+		lifetime = time.Hour
+	}
+	return &Keyring{
+		wrapper:  wrapper,
+		lifetime: lifetime,
+		logger:   logger,
+		now:      func() time.Time { return time.Now().UTC() },
+		opened:   make(map[string][]byte),
+		reports:  make(map[string]Report),
+	}
+}
+
+// Enabled reports whether k seals values; stores keep them in plaintext
+// otherwise.
+func (k *Keyring) Enabled() bool {
+	return k != nil
+}
+
+// Seal encrypts plaintext under the current data key.
+func (k *Keyring) Seal(ctx context.Context, plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoKeys
+	}
+	key, err := k.dataKey(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, 4+len(key.keyID)+len(key.wrapped)+len(nonce)+len(plaintext)+key.aead.Overhead())
+	out = append(out, formatVersion, byte(len(key.keyID)))
+	out = append(out, key.keyID...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(key.wrapped)))
+	out = append(out, key.wrapped...)
+	out = append(out, nonce...)
+	return key.aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+// Open decrypts a value Seal returned.
+func (k *Keyring) Open(ctx context.Context, sealed []byte) ([]byte, error) {
+	if k == nil {
+		return nil, ErrNoKeys
+	}
+	keyID, wrapped, rest, err := parse(sealed)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := k.unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+// Current reports whether sealed was sealed under the key-encryption key
+// wrapping the current data key, so rotating it would change nothing.
+func (k *Keyring) Current(ctx context.Context, sealed []byte) (bool, error) {
+	if k == nil {
+		return false, ErrNoKeys
+	}
+	keyID, _, _, err := parse(sealed)
+	if err != nil {
+		return false, err
+	}
+	key, err := k.dataKey(ctx, false)
+	if err != nil {
+		return false, err
+	}
+	return keyID == key.keyID, nil
+}
+
+// KeyID returns the ID of the key-encryption key that wrapped the data
+// key of a sealed value.
+func KeyID(sealed []byte) (string, error) {
+	keyID, _, _, err := parse(sealed)
+	return keyID, err
+}
+
+// dataKey returns the current data key, starting a new one when it has
+// expired, been used up, or force is set.
+func (k *Keyring) dataKey(ctx context.Context, force bool) (*dataKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.now()
+	if c := k.current; c != nil && !force && now.Sub(c.created) < k.lifetime && c.uses < maxDataKeyUses {
+		c.uses++
+		return c, nil
+	}
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := k.wrapper.Wrap(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: wrap data key: %w", err)
+	}
+	if len(keyID) == 0 || len(keyID) > 255 || len(wrapped) > 0xffff {
+		return nil, fmt.Errorf("encryption: %s returned an unusable key ID or wrapped key", k.wrapper.Name())
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	k.current = &dataKey{aead: aead, keyID: keyID, wrapped: wrapped, created: now, uses: 1}
+	k.cache(string(wrapped), dek)
+	return k.current, nil
+}
+
+// unwrap returns the cipher for a data key, unwrapping it once.
+func (k *Keyring) unwrap(ctx context.Context, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	k.mu.Lock()
+	dek, ok := k.opened[string(wrapped)]
+	k.mu.Unlock()
+	if !ok {
+		var err error
+		if dek, err = k.wrapper.Unwrap(ctx, keyID, wrapped); err != nil {
+			return nil, err
+		}
+		k.mu.Lock()
+		k.cache(string(wrapped), dek)
+		k.mu.Unlock()
+	}
+	return newGCM(dek)
+}
+
+// cache keeps an unwrapped data key, forgetting the others once the cache
+// is full. The caller holds k.mu.
+func (k *Keyring) cache(wrapped string, dek []byte) {
+	if len(k.opened) >= maxOpenedKeys {
+		clear(k.opened)
+	}
+	k.opened[wrapped] = dek
+}
+
+func parse(sealed []byte) (keyID string, wrapped, rest []byte, err error) {
+	if len(sealed) < 2 || sealed[0] != formatVersion {
+		return "", nil, nil, ErrCorrupt
+	}
+	n := int(sealed[1])
+	sealed = sealed[2:]
+	if len(sealed) < n+2 {
+		return "", nil, nil, ErrCorrupt
+	}
+	keyID, sealed = string(sealed[:n]), sealed[n:]
+	m := int(binary.BigEndian.Uint16(sealed))
+	sealed = sealed[2:]
+	if len(sealed) < m {
+		return "", nil, nil, ErrCorrupt
+	}
+	return keyID, sealed[:m], sealed[m:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
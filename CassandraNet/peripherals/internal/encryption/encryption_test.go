@@ -0,0 +1,299 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+func key(c byte) []byte { return bytes.Repeat([]byte{c}, 32) }
+
+func keyring(t *testing.T, keys map[string][]byte, active string) *Keyring {
+	t.Helper()
+	kf, err := NewKeyFile(keys, active)
+	if err != nil {
+		t.Fatalf("new key file: %v", err)
+	}
+	return NewKeyring(kf, 0, noopLogger{})
+}
+
+func TestSealOpen(t *testing.T) {
+	ctx := context.Background()
+	k := keyring(t, map[string][]byte{"k1": key(1)}, "k1")
+	sealed, err := k.Seal(ctx, []byte("player@example.com"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("player@example.com")) {
+		t.Fatal("sealed value holds the plaintext")
+	}
+	if id, err := KeyID(sealed); err != nil || id != "k1" {
+		t.Fatalf("expected k1, got %q %v", id, err)
+	}
+	plain, err := k.Open(ctx, sealed)
+	if err != nil || string(plain) != "player@example.com" {
+		t.Fatalf("open: %q %v", plain, err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := k.Open(ctx, tampered); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt for a tampered value, got %v", err)
+	}
+	if _, err := k.Open(ctx, []byte("plain")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt for an unsealed value, got %v", err)
+	}
+	other := keyring(t, map[string][]byte{"k2": key(2)}, "k2")
+	if _, err := other.Open(ctx, sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+	var none *Keyring
+	if none.Enabled() {
+		t.Fatal("expected a nil Keyring to be disabled")
+	}
+	if _, err := none.Open(ctx, sealed); !errors.Is(err, ErrNoKeys) {
+		t.Fatalf("expected ErrNoKeys, got %v", err)
+	}
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	content := "# retired after the next rotation\nk1=" + base64.StdEncoding.EncodeToString(key(1)) +
+		"\n\nk2 = " + base64.StdEncoding.EncodeToString(key(2)) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kf, err := LoadKeyFile(path, "")
+	if err != nil || kf.active != "k2" || len(kf.KeyIDs()) != 2 {
+		t.Fatalf("expected k2 active of two keys, got %+v %v", kf, err)
+	}
+	if kf, err = LoadKeyFile(path, "k1"); err != nil || kf.active != "k1" {
+		t.Fatalf("expected k1 active, got %+v %v", kf, err)
+	}
+	if _, err := LoadKeyFile(path, "k3"); err == nil {
+		t.Fatal("expected an unknown active key to be rejected")
+	}
+
+	for name, content := range map[string]string{
+		"short":     "k1=" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"duplicate": "k1=" + base64.StdEncoding.EncodeToString(key(1)) + "\nk1=" + base64.StdEncoding.EncodeToString(key(2)),
+		"malformed": "k1",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadKeyFile(path, ""); err == nil {
+			t.Errorf("%s: expected the key file to be rejected", name)
+		}
+	}
+}
+
+func TestRotateResealsUnderTheActiveKey(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewMemory()
+	put := func(k *Keyring, key string, value []byte) {
+		t.Helper()
+		if k != nil {
+			var err error
+			if value, err = k.Seal(ctx, value); err != nil {
+				t.Fatalf("seal: %v", err)
+			}
+		}
+		if err := storage.Update(ctx, db, func(tx storage.Tx) error { return tx.Put("records", key, value) }); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	old := keyring(t, map[string][]byte{"k1": key(1)}, "k1")
+	stranger := keyring(t, map[string][]byte{"x": key(9)}, "x")
+	put(old, "a", []byte("one"))
+	put(old, "b", []byte("two"))
+	put(nil, "c", []byte("three"))
+	put(stranger, "d", []byte("four"))
+
+	k := keyring(t, map[string][]byte{"k1": key(1), "k2": key(2)}, "k2")
+	reseal := func(ctx context.Context) (int, int, error) {
+		return ResealBucket(ctx, db, "records", "", func(_ string, value []byte) ([]byte, error) {
+			if _, err := KeyID(value); err != nil {
+				// Not sealed yet.
+				return k.Reseal(ctx, nil, value)
+			}
+			return k.Reseal(ctx, value, nil)
+		})
+	}
+	k.Register(Resealer{Name: "test.records", Reseal: reseal})
+	reports, err := k.Rotate(ctx)
+	if err != nil || len(reports) != 1 || reports[0].Resealed != 3 || reports[0].Skipped != 1 || reports[0].KeyID != "k2" {
+		t.Fatalf("expected three records resealed under k2 and one skipped, got %+v %v", reports, err)
+	}
+
+	err = storage.View(ctx, db, func(tx storage.Tx) error {
+		for key, want := range map[string]string{"a": "one", "b": "two", "c": "three"} {
+			value, err := tx.Get("records", key)
+			if err != nil {
+				return err
+			}
+			if id, _ := KeyID(value); id != "k2" {
+				t.Errorf("%s: expected k2, got %q", key, id)
+			}
+			if plain, err := k.Open(ctx, value); err != nil || string(plain) != want {
+				t.Errorf("%s: expected %q, got %q %v", key, want, plain, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("view: %v", err)
+	}
+	if reports, err = k.Rotate(ctx); err != nil || reports[0].Resealed != 0 {
+		t.Fatalf("expected nothing left to reseal, got %+v %v", reports, err)
+	}
+	status := k.Status()
+	if status.Provider != "file" || status.ActiveKey != "k2" || len(status.Records) != 1 || status.Records[0].LastReport == nil {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestVault(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/cassandra":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"ciphertext": "vault:v3:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/cassandra":
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v3:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	vault, err := NewVault(VaultConfig{URL: srv.URL, Token: "s.token", Key: "cassandra"}, nil)
+	if err != nil {
+		t.Fatalf("new vault: %v", err)
+	}
+	sealed, err := NewKeyring(vault, 0, noopLogger{}).Seal(ctx, []byte("payload"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if id, _ := KeyID(sealed); id != "cassandra:v3" {
+		t.Fatalf("expected cassandra:v3, got %q", id)
+	}
+	// A fresh keyring has no cached data key, so it asks Vault.
+	if plain, err := NewKeyring(vault, 0, noopLogger{}).Open(ctx, sealed); err != nil || string(plain) != "payload" {
+		t.Fatalf("open: %q %v", plain, err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("expected one encrypt and one decrypt, got %v", calls)
+	}
+
+	denied, err := NewVault(VaultConfig{URL: srv.URL, Token: "wrong", Key: "cassandra"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyring(denied, 0, noopLogger{}).Seal(ctx, []byte("payload")); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected Vault's error, got %v", err)
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	load := func(env map[string]string) (Config, error) {
+		t.Helper()
+		for _, name := range []string{"KEY_FILE", "ACTIVE_KEY", "VAULT_URL", "VAULT_TOKEN", "VAULT_KEY"} {
+			t.Setenv("SVC_ENCRYPTION_"+name, env[name])
+		}
+		loader, err := config.Load("SVC", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return FromConfig(loader)
+	}
+	cfg, err := load(nil)
+	if err != nil {
+		t.Fatalf("from config: %v", err)
+	}
+	if k, err := New(cfg, nil, noopLogger{}); err != nil || k != nil {
+		t.Fatalf("expected no keyring without a provider, got %v %v", k, err)
+	}
+	cfg, err = load(map[string]string{"VAULT_URL": "https://vault:8200", "VAULT_TOKEN": "s.token", "VAULT_KEY": "cassandra"})
+	if err != nil || cfg.Vault.Mount != "transit" || cfg.Vault.Key != "cassandra" {
+		t.Fatalf("unexpected config %+v %v", cfg, err)
+	}
+	for _, env := range []map[string]string{
+		{"KEY_FILE": "/keys", "VAULT_URL": "https://vault:8200", "VAULT_TOKEN": "s.token", "VAULT_KEY": "cassandra"},
+		{"VAULT_URL": "https://vault:8200", "VAULT_KEY": "cassandra"},
+		{"ACTIVE_KEY": "k1"},
+	} {
+		if _, err := load(env); err == nil {
+			t.Errorf("%v: expected the settings to be rejected", env)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	k := keyring(t, map[string][]byte{"k1": key(1)}, "k1")
+	k.Register(Resealer{Name: "test.records", Reseal: func(context.Context) (int, int, error) { return 2, 0, nil }})
+	serve := func(k *Keyring, method, target string, p auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), p))
+		rec := httptest.NewRecorder()
+		k.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	operator := auth.Principal{Subject: "ops"}
+
+	rec := serve(k, http.MethodPost, "/encryption/rotate", operator)
+	var out struct {
+		Items []Report `json:"items"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil || len(out.Items) != 1 || out.Items[0].Resealed != 2 {
+		t.Fatalf("rotate: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(k, http.MethodGet, "/encryption", operator)
+	var status Status
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &status) != nil || status.ActiveKey != "k1" || status.Records[0].LastReport == nil {
+		t.Fatalf("status: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		keyring        *Keyring
+		method, target string
+		principal      auth.Principal
+		status         int
+	}{
+		{nil, http.MethodGet, "/encryption", operator, http.StatusOK},
+		{nil, http.MethodPost, "/encryption/rotate", operator, http.StatusConflict},
+		{k, http.MethodPost, "/encryption", operator, http.StatusMethodNotAllowed},
+		{k, http.MethodGet, "/encryption/rotate", operator, http.StatusMethodNotAllowed},
+		{k, http.MethodGet, "/encryption/keys", operator, http.StatusNotFound},
+		{k, http.MethodGet, "/encryption", auth.Principal{Subject: "acme", Tenant: "acme"}, http.StatusForbidden},
+	} {
+		if rec := serve(tc.keyring, tc.method, tc.target, tc.principal); rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d %s", tc.method, tc.target, tc.status, rec.Code, rec.Body)
+		}
+	}
+}
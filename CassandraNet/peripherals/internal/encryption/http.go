@@ -0,0 +1,90 @@
+package encryption
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Problem codes returned by the encryption endpoints.
+const (
+	codeNotFound     = "encryption.not_found"
+	codeForbidden    = "encryption.forbidden_tenant"
+	codeRotating     = "encryption.already_rotating"
+	codeRotateFailed = "encryption.rotate_failed"
+	codeDisabled     = "encryption.disabled"
+)
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/encryption"
+
+// Handler serves the encryption API:
+//
+//	GET  /encryption         the keyring's Status
+//	POST /encryption/rotate  runs Rotate
+//
+// A rotation answers with its reports, also when one of them failed, and
+// is refused when no keys are configured; a nil Keyring's Handler reports
+// the provider "none". Keys
+// span every tenant, so callers bound to a tenant are refused; reads
+// require auth.PermEncryptionRead and rotations
+// auth.PermEncryptionManage.
+func (k *Keyring) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := auth.FromContext(r.Context()); p.Tenant != "" {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "encryption keys span every tenant; use credentials not bound to one")
+			return
+		}
+		switch r.URL.Path {
+		case Path, Path + "/":
+			k.handleStatus(w, r)
+		case Path + "/rotate":
+			k.handleRotate(w, r)
+		default:
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		}
+	})
+}
+
+func (k *Keyring) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "encryption", http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermEncryptionRead, "", "") {
+		return
+	}
+	writeJSON(w, http.StatusOK, k.Status())
+}
+
+func (k *Keyring) handleRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "encryption", http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermEncryptionManage, "", "") {
+		return
+	}
+	reports, err := k.Rotate(r.Context())
+	switch {
+	case errors.Is(err, ErrRotating):
+		problem.Write(w, r, http.StatusConflict, codeRotating, "a rotation is already running")
+	case errors.Is(err, ErrNoKeys):
+		problem.Write(w, r, http.StatusConflict, codeDisabled, "no encryption keys are configured")
+	case err != nil && reports == nil:
+		logging.For(r.Context(), k.logger).Printf("encryption: rotate: %v", err)
+		problem.Write(w, r, http.StatusBadGateway, codeRotateFailed, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"items": reports})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,234 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeyFile wraps data keys with AES-256 keys held in memory, loaded from a
+// file of "id=base64" lines. Blank lines and lines starting with # are
+// ignored. To rotate, append a new key, make it active, restart, and keep
+// the old key in the file until Rotate has re-sealed every store.
+type KeyFile struct {
+	keys   map[string]cipher.AEAD
+	ids    []string
+	active string
+}
+
+// LoadKeyFile reads the keys in path, with active naming the one that
+// wraps new data keys (default the last in the file).
+func LoadKeyFile(path, active string) (*KeyFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	defer f.Close()
+	keys := make(map[string][]byte)
+	var order []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(text, "=")
+		id = strings.TrimSpace(id)
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if !ok || id == "" || err != nil {
+			return nil, fmt.Errorf("encryption: %s:%d: want id=base64", path, line)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("encryption: %s:%d: key %q appears twice", path, line, id)
+		}
+		keys[id] = key
+		order = append(order, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("encryption: %s: %w", path, err)
+	}
+	if active == "" && len(order) > 0 {
+		active = order[len(order)-1]
+	}
+	return NewKeyFile(keys, active)
+}
+
+// NewKeyFile returns a wrapper over keys, each 32 bytes, wrapping new data
+// keys with the one called active.
+func NewKeyFile(keys map[string][]byte, active string) (*KeyFile, error) {
+	kf := &KeyFile{keys: make(map[string]cipher.AEAD, len(keys)), active: active}
+	for id, key := range keys {
+		if len(id) > 255 {
+			return nil, fmt.Errorf("encryption: key ID %.16q... is longer than 255 bytes", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption: key %q is %d bytes, want 32", id, len(key))
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		kf.keys[id] = aead
+		kf.ids = append(kf.ids, id)
+	}
+	slices.Sort(kf.ids)
+	if _, ok := kf.keys[active]; !ok {
+		return nil, fmt.Errorf("encryption: active key %q is not among the keys", active)
+	}
+	return kf, nil
+}
+
+// Name implements KeyWrapper.
+func (kf *KeyFile) Name() string { return "file" }
+
+// KeyIDs returns the IDs of the loaded keys in order.
+func (kf *KeyFile) KeyIDs() []string { return slices.Clone(kf.ids) }
+
+// Wrap implements KeyWrapper.
+func (kf *KeyFile) Wrap(_ context.Context, dek []byte) (string, []byte, error) {
+	aead := kf.keys[kf.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return kf.active, aead.Seal(nonce, nonce, dek, []byte(kf.active)), nil
+}
+
+// Unwrap implements KeyWrapper.
+func (kf *KeyFile) Unwrap(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := kf.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	dek, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return dek, nil
+}
+
+// VaultConfig locates a HashiCorp Vault transit key.
+type VaultConfig struct {
+	// URL is Vault's address, such as https://vault:8200.
+	URL   string
+	Token string
+	// Mount is the transit engine's path (default "transit").
+	Mount string
+	// Key names the transit key.
+	Key string
+	// Timeout bounds each call (default 10s).
+	Timeout time.Duration
+}
+
+// Vault wraps data keys with a Vault transit key, which never leaves
+// Vault. Key IDs are the key's name and version, such as "cassandra:v2",
+// so rotating the key in Vault moves new data keys to the new version
+// while older ones still unwrap.
+type Vault struct {
+	cfg    VaultConfig
+	base   *url.URL
+	client *http.Client
+}
+
+// NewVault returns a wrapper calling Vault through transport (nil uses
+// http.DefaultTransport).
+func NewVault(cfg VaultConfig, transport http.RoundTripper) (*Vault, error) {
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: vault url: %w", err)
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "transit"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Vault{cfg: cfg, base: base, client: &http.Client{Transport: transport, Timeout: cfg.Timeout}}, nil
+}
+
+// Name implements KeyWrapper.
+func (v *Vault) Name() string { return "vault" }
+
+// Wrap implements KeyWrapper with transit's encrypt endpoint.
+func (v *Vault) Wrap(ctx context.Context, dek []byte) (string, []byte, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := v.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dek)}, &out); err != nil {
+		return "", nil, err
+	}
+	// Ciphertexts look like "vault:v3:...".
+	parts := strings.SplitN(out.Ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return "", nil, fmt.Errorf("encryption: vault returned an unexpected ciphertext")
+	}
+	return v.cfg.Key + ":" + parts[1], []byte(out.Ciphertext), nil
+}
+
+// Unwrap implements KeyWrapper with transit's decrypt endpoint.
+func (v *Vault) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if name, _, _ := strings.Cut(keyID, ":"); name != v.cfg.Key {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := v.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	dek, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: vault returned an unexpected plaintext")
+	}
+	return dek, nil
+}
+
+// call posts body to the transit key's operation and decodes the response's
+// data into out.
+func (v *Vault) call(ctx context.Context, operation string, body any, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	target := v.base.JoinPath("v1", v.cfg.Mount, operation, v.cfg.Key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("encryption: vault %s: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("encryption: vault %s: decode response: %w", operation, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("encryption: vault %s answered %s: %s", operation, resp.Status, strings.Join(envelope.Errors, "; "))
+	}
+	if err := json.Unmarshal(envelope.Data, out); err != nil {
+		return fmt.Errorf("encryption: vault %s: decode response: %w", operation, err)
+	}
+	return nil
+}
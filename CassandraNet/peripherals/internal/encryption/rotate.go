@@ -0,0 +1,220 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// BatchSize bounds how many records ResealBucket rewrites in one storage
+// transaction.
+const BatchSize = 500
+
+// ErrRotating means a rotation is already under way.
+var ErrRotating = errors.New("encryption: rotation already running")
+
+// ResealFunc re-seals a store's records under the current data key —
+// those sealed under another key-encryption key, and any kept in
+// plaintext — and returns how many it rewrote and how many it skipped
+// because their key is not available here.
+type ResealFunc func(ctx context.Context) (resealed, skipped int, err error)
+
+// Resealer is one kind of stored record that Rotate re-seals.
+type Resealer struct {
+	// Name identifies the records as "<service>.<records>", such as
+	// "messaging.messages".
+	Name   string
+	Reseal ResealFunc
+}
+
+// Report is the outcome of re-sealing one kind of record.
+type Report struct {
+	Name       string    `json:"name"`
+	KeyID      string    `json:"key_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Resealed   int       `json:"resealed"`
+	// Skipped counts records sealed under keys this deployment does not
+	// have, such as another service's sharing the driver.
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Register adds r to the records Rotate re-seals. Registering on a nil
+// Keyring does nothing.
+func (k *Keyring) Register(r Resealer) {
+	if k == nil {
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.resealers = append(k.resealers, r)
+	slices.SortFunc(k.resealers, func(a, b Resealer) int { return strings.Compare(a.Name, b.Name) })
+}
+
+// Rotate starts a new data key under the active key-encryption key and
+// re-seals every registered kind of record with it, returning a report
+// for each. It refuses to run while another rotation is under way, and
+// returns ErrNoKeys on a nil Keyring.
+func (k *Keyring) Rotate(ctx context.Context) ([]Report, error) {
+	if k == nil {
+		return nil, ErrNoKeys
+	}
+	if !k.rotating.TryLock() {
+		return nil, ErrRotating
+	}
+	defer k.rotating.Unlock()
+	key, err := k.dataKey(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	k.mu.Lock()
+	resealers := slices.Clone(k.resealers)
+	k.mu.Unlock()
+	reports := make([]Report, 0, len(resealers))
+	var errs []error
+	for _, r := range resealers {
+		report := Report{Name: r.Name, KeyID: key.keyID, StartedAt: k.now()}
+		report.Resealed, report.Skipped, err = r.Reseal(ctx)
+		report.FinishedAt = k.now()
+		if err != nil {
+			report.Error = err.Error()
+			errs = append(errs, err)
+			k.logger.Printf("encryption: reseal %s: %v", r.Name, err)
+		} else {
+			k.logger.Printf("encryption: resealed %d %s under %s, skipped %d", report.Resealed, r.Name, key.keyID, report.Skipped)
+		}
+		k.mu.Lock()
+		k.reports[r.Name] = report
+		k.mu.Unlock()
+		reports = append(reports, report)
+	}
+	return reports, errors.Join(errs...)
+}
+
+// Status describes a Keyring.
+type Status struct {
+	Provider string `json:"provider"`
+	// ActiveKey is the key-encryption key wrapping the current data key,
+	// empty until the first value is sealed.
+	ActiveKey string `json:"active_key,omitempty"`
+	// Keys lists the key file's keys; Vault keeps its own.
+	Keys             []string   `json:"keys,omitempty"`
+	DataKeyCreatedAt *time.Time `json:"data_key_created_at,omitempty"`
+	// Records lists the registered kinds of record with their last
+	// rotation.
+	Records []RecordStatus `json:"records"`
+}
+
+// RecordStatus describes one registered kind of record.
+type RecordStatus struct {
+	Name       string  `json:"name"`
+	LastReport *Report `json:"last_report,omitempty"`
+}
+
+// Status reports the provider, the active key, and the last rotation of
+// each kind of record. A nil Keyring reports the provider "none".
+func (k *Keyring) Status() Status {
+	if k == nil {
+		return Status{Provider: "none", Records: make([]RecordStatus, 0)}
+	}
+	status := Status{Provider: k.wrapper.Name(), Records: make([]RecordStatus, 0)}
+	if kf, ok := k.wrapper.(*KeyFile); ok {
+		status.Keys = kf.KeyIDs()
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if c := k.current; c != nil {
+		created := c.created
+		status.ActiveKey, status.DataKeyCreatedAt = c.keyID, &created
+	}
+	for _, r := range k.resealers {
+		rs := RecordStatus{Name: r.Name}
+		if report, ok := k.reports[r.Name]; ok {
+			rs.LastReport = &report
+		}
+		status.Records = append(status.Records, rs)
+	}
+	return status
+}
+
+// Reseal re-seals one value for a ResealFunc: sealed, the value's sealed
+// form if it has one, or plain, its plaintext if it is not sealed yet. It
+// returns the new sealed form, or nil when the value is already current,
+// and ErrUnknownKey when it is sealed under a key not available here.
+func (k *Keyring) Reseal(ctx context.Context, sealed, plain []byte) ([]byte, error) {
+	if sealed != nil {
+		current, err := k.Current(ctx, sealed)
+		if err != nil || current {
+			return nil, err
+		}
+		if plain, err = k.Open(ctx, sealed); err != nil {
+			return nil, err
+		}
+	}
+	return k.Seal(ctx, plain)
+}
+
+// ResealBucket rewrites the records of bucket under prefix that reseal
+// changes, up to BatchSize per storage transaction. reseal returns a
+// record's new value, or nil to leave it; an ErrUnknownKey from it skips
+// the record.
+func ResealBucket(ctx context.Context, db storage.Driver, bucket, prefix string,
+	reseal func(key string, value []byte) ([]byte, error)) (resealed, skipped int, err error) {
+	after := ""
+	for {
+		type record struct {
+			key   string
+			value []byte
+		}
+		var records []record
+		var last string
+		var batchSkipped int
+		done := true
+		err := storage.Update(ctx, db, func(tx storage.Tx) error {
+			records, last, batchSkipped, done = nil, after, 0, true
+			err := tx.Scan(bucket, prefix, func(key string, value []byte) error {
+				if key <= after {
+					return nil
+				}
+				last = key
+				updated, err := reseal(key, value)
+				switch {
+				case errors.Is(err, ErrUnknownKey):
+					batchSkipped++
+				case err != nil:
+					return err
+				case updated != nil:
+					records = append(records, record{key: key, value: updated})
+				}
+				if len(records) == BatchSize {
+					done = false
+					return storage.StopScan
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, rec := range records {
+				if err := tx.Put(bucket, rec.key, rec.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return resealed, skipped, err
+		}
+		resealed += len(records)
+		skipped += batchSkipped
+		if done {
+			return resealed, skipped, nil
+		}
+		after = last
+	}
+}
@@ -0,0 +1,234 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// TopicPrefix starts the messaging topic of every bridged event; an event
+// named "ugc.content_reviewed" travels on "events.ugc.content_reviewed".
+const TopicPrefix = "events."
+
+// BridgeConfig describes how a bus reaches the messaging service.
+type BridgeConfig struct {
+	// URL is the messaging service base URL.
+	URL string
+	// Tenant and Project scope events that carry no tenant or project of
+	// their own, since every message needs both (defaults "system" and
+	// "events").
+	Tenant  string
+	Project string
+	// Subscribe lists the event names pulled from the messaging service
+	// into the local bus.
+	Subscribe []string
+	// PollInterval is how often subscribed topics are pulled (default 2s).
+	PollInterval time.Duration
+	// BatchSize is the most messages pulled per topic and poll (default 50).
+	BatchSize int
+}
+
+// Bridge connects a Bus to the messaging service. Every event published
+// locally is also published to its topic, and events on the subscribed
+// topics are pulled, published locally, and acknowledged. Events that
+// arrived through the bridge are not sent back out.
+type Bridge struct {
+	cfg     BridgeConfig
+	baseURL *url.URL
+	bus     *Bus
+	client  *http.Client
+	logger  interface {
+		Printf(string, ...any)
+	}
+}
+
+type remoteKey struct{}
+
+// NewBridge connects bus to the messaging service described by cfg and
+// starts forwarding local events. Requests are sent through transport (nil
+// uses http.DefaultTransport). Call Run to pull subscribed events.
+func NewBridge(bus *Bus, cfg BridgeConfig, transport http.RoundTripper, logger interface {
+	Printf(string, ...any)
+}) (*Bridge, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("eventbus: messaging URL %q must be an absolute http(s) URL", cfg.URL)
+	}
+	for _, name := range cfg.Subscribe {
+		if _, ok := decoders[name]; !ok {
+			return nil, fmt.Errorf("eventbus: unknown event %q", name)
+		}
+	}
+	if cfg.Tenant == "" {
+		cfg.Tenant = "system"
+	}
+	if cfg.Project == "" {
+		cfg.Project = "events"
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	br := &Bridge{
+		cfg:     cfg,
+		baseURL: u,
+		bus:     bus,
+		client:  &http.Client{Transport: transport, Timeout: 5 * time.Second},
+		logger:  logger,
+	}
+	bus.SubscribeAll(br.forward)
+	return br, nil
+}
+
+// BridgeFromConfig reads EVENTS_URL, EVENTS_TENANT, EVENTS_PROJECT, and
+// EVENTS_POLL_INTERVAL from loader and bridges bus, pulling the subscribe
+// events. It returns nil when EVENTS_URL is unset.
+func BridgeFromConfig(loader config.Loader, bus *Bus, subscribe []string, transport http.RoundTripper, logger interface {
+	Printf(string, ...any)
+}) (*Bridge, error) {
+	eventsURL, err := loader.URL("EVENTS_URL", "")
+	if err != nil || eventsURL == nil {
+		return nil, err
+	}
+	return NewBridge(bus, BridgeConfig{
+		URL:          eventsURL.String(),
+		Tenant:       loader.String("EVENTS_TENANT", "system"),
+		Project:      loader.String("EVENTS_PROJECT", "events"),
+		Subscribe:    subscribe,
+		PollInterval: loader.Duration("EVENTS_POLL_INTERVAL", 2*time.Second),
+	}, transport, logger)
+}
+
+type publishBody struct {
+	TenantID      string            `json:"tenant_id"`
+	ProjectID     string            `json:"project_id"`
+	Key           string            `json:"key,omitempty"`
+	PayloadBase64 string            `json:"payload_base64"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+}
+
+type pulledMessage struct {
+	MessageID     string `json:"message_id"`
+	PayloadBase64 string `json:"payload_base64"`
+}
+
+// forward publishes a local event to its topic.
+func (br *Bridge) forward(ctx context.Context, event Event) {
+	if ctx.Value(remoteKey{}) != nil {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		br.logger.Printf("encode %s event: %v", event.EventName(), err)
+		return
+	}
+	tenant, project := event.Scope()
+	if tenant == "" {
+		tenant = br.cfg.Tenant
+	}
+	if project == "" {
+		project = br.cfg.Project
+	}
+	body, _ := json.Marshal(publishBody{
+		TenantID:      tenant,
+		ProjectID:     project,
+		PayloadBase64: base64.StdEncoding.EncodeToString(payload),
+		Attributes:    map[string]string{"event": event.EventName()},
+	})
+	ctx, cancel := context.WithTimeout(ctx, br.client.Timeout)
+	defer cancel()
+	if err := br.do(ctx, http.MethodPost, br.topicPath(event.EventName()), body, nil); err != nil {
+		br.logger.Printf("forward %s event to messaging failed: %v", event.EventName(), err)
+	}
+}
+
+// Run pulls the subscribed topics every poll interval until ctx is
+// cancelled. Failures are logged and retried on the next poll. Without
+// subscriptions it returns immediately.
+func (br *Bridge) Run(ctx context.Context) error {
+	if len(br.cfg.Subscribe) == 0 {
+		return nil
+	}
+	ticker := time.NewTicker(br.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, name := range br.cfg.Subscribe {
+			if err := br.Poll(ctx, name); err != nil && ctx.Err() == nil {
+				br.logger.Printf("pull %s events from messaging failed: %v", name, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll pulls one batch of the named event, publishes each event locally,
+// and acknowledges it. Messages that cannot be decoded are acknowledged
+// and dropped so they do not block the topic.
+func (br *Bridge) Poll(ctx context.Context, name string) error {
+	target := br.baseURL.JoinPath(br.topicPath(name))
+	target.RawQuery = url.Values{"limit": {fmt.Sprint(br.cfg.BatchSize)}}.Encode()
+	var messages []pulledMessage
+	if err := br.do(ctx, http.MethodGet, target.String(), nil, &messages); err != nil {
+		return err
+	}
+	remote := context.WithValue(ctx, remoteKey{}, true)
+	for _, msg := range messages {
+		payload, err := base64.StdEncoding.DecodeString(msg.PayloadBase64)
+		var event Event
+		if err == nil {
+			event, err = Decode(name, payload)
+		}
+		if err != nil {
+			br.logger.Printf("dropping undecodable %s message %s: %v", name, msg.MessageID, err)
+		} else {
+			br.bus.Publish(remote, event)
+		}
+		if err := br.do(ctx, http.MethodPost, br.topicPath(name)+"/"+url.PathEscape(msg.MessageID)+"/ack", nil, nil); err != nil {
+			return fmt.Errorf("ack %s: %w", msg.MessageID, err)
+		}
+	}
+	return nil
+}
+
+func (br *Bridge) topicPath(name string) string {
+	return "/topics/" + url.PathEscape(TopicPrefix+name) + "/messages"
+}
+
+func (br *Bridge) do(ctx context.Context, method, target string, body []byte, out any) error {
+	if strings.HasPrefix(target, "/") {
+		target = br.baseURL.JoinPath(target).String()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := br.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("messaging service returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
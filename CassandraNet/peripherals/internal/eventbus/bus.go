@@ -0,0 +1,228 @@
+// Package eventbus lets peripheral services announce what happened, such as
+// a content review or a finished assignment, without knowing who listens.
+// Services publish typed events to a Bus; when they run in one process the
+// bus hands events straight to subscribers, and when they are deployed
+// separately a Bridge carries events between processes through the
+// messaging service.
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Publisher accepts events. Publishing never blocks the caller and never
+// fails it; delivery is best effort.
+type Publisher interface {
+	Publish(ctx context.Context, event Event)
+}
+
+// Bus queues published events and delivers them, in publish order, to the
+// subscribers of each event's name on a single goroutine. Subscribers
+// should return promptly.
+type Bus struct {
+	queue  chan envelope
+	logger interface {
+		Printf(string, ...any)
+	}
+	dropped atomic.Uint64
+
+	mu     sync.RWMutex
+	subs   map[string][]*subscription
+	all    []*subscription
+	nextID int
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+type envelope struct {
+	ctx   context.Context
+	event Event
+}
+
+type subscription struct {
+	id      int
+	handler func(context.Context, Event)
+}
+
+// New constructs a bus holding up to buffer undelivered events (default
+// 1024); events published to a full bus are dropped and logged.
+func New(buffer int, logger interface {
+	Printf(string, ...any)
+}) *Bus {
+	if buffer <= 0 {
+		buffer = 1024
+	}
+	return &Bus{
+		queue:  make(chan envelope, buffer),
+		logger: logger,
+		subs:   make(map[string][]*subscription),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Publish queues event for delivery. Subscribers receive a context carrying
+// ctx's values, such as the request ID, but not its cancellation.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	select {
+	case b.queue <- envelope{ctx: context.WithoutCancel(ctx), event: event}:
+	default:
+		if b.dropped.Add(1) == 1 {
+			b.logger.Printf("event bus full; dropping %s", event.EventName())
+		}
+	}
+}
+
+// Subscribe calls fn for every event of type E until the returned function
+// is called.
+func Subscribe[E Event](b *Bus, fn func(context.Context, E)) (unsubscribe func()) {
+	var zero E
+	name := zero.EventName()
+	return b.subscribe(name, func(ctx context.Context, event Event) {
+		if e, ok := event.(E); ok {
+			fn(ctx, e)
+		}
+	})
+}
+
+// SubscribeAll calls fn for every event until the returned function is
+// called.
+func (b *Bus) SubscribeAll(fn func(context.Context, Event)) (unsubscribe func()) {
+	return b.subscribe("", fn)
+}
+
+func (b *Bus) subscribe(name string, fn func(context.Context, Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.nextID++
+	sub := &subscription{id: b.nextID, handler: fn}
+	if name == "" {
+		b.all = append(b.all, sub)
+	} else {
+		b.subs[name] = append(b.subs[name], sub)
+	}
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if name == "" {
+			b.all = without(b.all, sub.id)
+		} else {
+			b.subs[name] = without(b.subs[name], sub.id)
+		}
+	}
+}
+
+func without(subs []*subscription, id int) []*subscription {
+	out := make([]*subscription, 0, len(subs))
+	for _, s := range subs {
+		if s.id != id {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Start begins delivering events.
+func (b *Bus) Start() {
+	b.startOnce.Do(func() {
+		go b.run()
+	})
+}
+
+// Stop delivers the events already queued and then stops. Events published
+// afterwards stay queued and are never delivered.
+func (b *Bus) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+		b.Start()
+		<-b.done
+	})
+}
+
+func (b *Bus) run() {
+	defer close(b.done)
+	for {
+		select {
+		case env := <-b.queue:
+			b.deliver(env)
+		case <-b.stop:
+			for {
+				select {
+				case env := <-b.queue:
+					b.deliver(env)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Bus) deliver(env envelope) {
+	name := env.event.EventName()
+	b.mu.RLock()
+	subs := make([]*subscription, 0, len(b.subs[name])+len(b.all))
+	subs = append(subs, b.subs[name]...)
+	subs = append(subs, b.all...)
+	b.mu.RUnlock()
+	for _, sub := range subs {
+		b.call(sub, env)
+	}
+}
+
+func (b *Bus) call(sub *subscription, env envelope) {
+	defer func() {
+		if v := recover(); v != nil {
+			b.logger.Printf("event subscriber for %s panicked: %v", env.event.EventName(), v)
+		}
+	}()
+	sub.handler(env.ctx, env.event)
+}
+
+// Dropped returns how many events were dropped because the bus was full.
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// BusStats describes a bus's queue at one moment.
+type BusStats struct {
+	Queued      int    `json:"queued"`
+	Capacity    int    `json:"capacity"`
+	Dropped     uint64 `json:"dropped"`
+	Subscribers int    `json:"subscribers"`
+}
+
+// Stats reports the bus's queue depth, capacity, drops, and subscriber
+// count.
+func (b *Bus) Stats() BusStats {
+	b.mu.RLock()
+	subscribers := len(b.all)
+	for _, subs := range b.subs {
+		subscribers += len(subs)
+	}
+	b.mu.RUnlock()
+	return BusStats{
+		Queued:      len(b.queue),
+		Capacity:    cap(b.queue),
+		Dropped:     b.Dropped(),
+		Subscribers: subscribers,
+	}
+}
+
+// Check reports whether events are being dropped; it fails while the queue
+// is full.
+func (b *Bus) Check(context.Context) error {
+	if len(b.queue) == cap(b.queue) {
+		return fmt.Errorf("%w: %d events queued, %d dropped", errBusFull, len(b.queue), b.Dropped())
+	}
+	return nil
+}
+
+var errBusFull = errors.New("event bus full")
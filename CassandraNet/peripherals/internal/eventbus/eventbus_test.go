@@ -0,0 +1,130 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/messaging"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) add(_ context.Context, e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) list() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func TestBusDeliversTypedAndAllSubscribers(t *testing.T) {
+	bus := New(0, noopLogger{})
+	var reviewed []ContentReviewed
+	Subscribe(bus, func(_ context.Context, e ContentReviewed) {
+		reviewed = append(reviewed, e)
+	})
+	all := &recorder{}
+	unsubscribe := bus.SubscribeAll(all.add)
+	Subscribe(bus, func(context.Context, AssignmentCompleted) {
+		panic("subscriber failure")
+	})
+	bus.Start()
+
+	bus.Publish(context.Background(), ContentReviewed{ContentID: "c-1", State: "approved"})
+	bus.Publish(context.Background(), AssignmentCompleted{AssignmentID: "a-1", Status: "completed"})
+	bus.Stop()
+
+	if len(reviewed) != 1 || reviewed[0].ContentID != "c-1" {
+		t.Fatalf("expected the typed subscriber to see one review, got %+v", reviewed)
+	}
+	if got := all.list(); len(got) != 2 || got[1].EventName() != NameAssignmentCompleted {
+		t.Fatalf("expected every event in publish order, got %+v", got)
+	}
+	unsubscribe()
+	if n := len(bus.subs[NameContentReviewed]) + len(bus.all); n != 1 {
+		t.Fatalf("expected unsubscribe to remove the catch-all subscriber, %d left", n)
+	}
+}
+
+func TestBusDropsWhenFull(t *testing.T) {
+	bus := New(1, noopLogger{})
+	bus.Publish(context.Background(), DeliveryFailed{Channel: "email"})
+	bus.Publish(context.Background(), DeliveryFailed{Channel: "email"})
+	if bus.Dropped() != 1 {
+		t.Fatalf("expected one dropped event, got %d", bus.Dropped())
+	}
+	if err := bus.Check(context.Background()); err == nil {
+		t.Fatal("expected a full bus to fail its check")
+	}
+	bus.Stop()
+	if err := bus.Check(context.Background()); err != nil {
+		t.Fatalf("expected a drained bus to pass its check: %v", err)
+	}
+}
+
+func TestBridgeCarriesEventsThroughMessaging(t *testing.T) {
+	srv := httptest.NewServer(messaging.NewService(messaging.NewMemoryStore(), nil).Handler())
+	defer srv.Close()
+
+	publisher := New(0, noopLogger{})
+	if _, err := NewBridge(publisher, BridgeConfig{URL: srv.URL}, nil, noopLogger{}); err != nil {
+		t.Fatalf("new bridge: %v", err)
+	}
+	subscriber := New(0, noopLogger{})
+	bridge, err := NewBridge(subscriber, BridgeConfig{URL: srv.URL, Subscribe: []string{NameContentReviewed}}, nil, noopLogger{})
+	if err != nil {
+		t.Fatalf("new bridge: %v", err)
+	}
+	received := &recorder{}
+	subscriber.SubscribeAll(received.add)
+
+	publisher.Start()
+	publisher.Publish(context.Background(), ContentReviewed{ContentID: "c-1", TenantID: "t-1", ProjectID: "p-1", State: "rejected", Reason: "spam"})
+	publisher.Stop()
+
+	subscriber.Start()
+	if err := bridge.Poll(context.Background(), NameContentReviewed); err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	subscriber.Stop()
+
+	got := received.list()
+	if len(got) != 1 {
+		t.Fatalf("expected one bridged event, got %+v", got)
+	}
+	if e, ok := got[0].(ContentReviewed); !ok || e.ContentID != "c-1" || e.Reason != "spam" {
+		t.Fatalf("unexpected bridged event %+v", got[0])
+	}
+
+	// The event was acknowledged and not forwarded back out.
+	resp, err := http.Get(srv.URL + "/topics/" + TopicPrefix + NameContentReviewed + "/messages?tenant_id=t-1&project_id=p-1")
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	defer resp.Body.Close()
+	var pending []json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil || len(pending) != 0 {
+		t.Fatalf("expected an empty topic, got %v %s", err, pending)
+	}
+}
+
+func TestNewBridgeRejectsUnknownEvents(t *testing.T) {
+	if _, err := NewBridge(New(0, noopLogger{}), BridgeConfig{URL: "http://messaging:8092", Subscribe: []string{"ugc.unknown"}}, nil, noopLogger{}); err == nil {
+		t.Fatal("expected an unknown event name to be rejected")
+	}
+}
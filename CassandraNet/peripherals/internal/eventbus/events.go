@@ -0,0 +1,149 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a fact one service announces for others to react to. Events are
+// plain values that encode to JSON, so the same types travel in-process and
+// through the messaging service.
+type Event interface {
+	// EventName identifies the event type, such as
+	// "ugc.content_reviewed". It selects subscribers and, when bridged,
+	// the messaging topic.
+	EventName() string
+	// Scope returns the tenant and project the event belongs to, either of
+	// which may be empty.
+	Scope() (tenant, project string)
+}
+
+// Event names.
+const (
+	NameContentReviewed     = "ugc.content_reviewed"
+	NameAssignmentCompleted = "orchestration.assignment_completed"
+	NameDeliveryFailed      = "notification.delivery_failed"
+	NamePresenceChanged     = "presence.changed"
+	NamePoolScaled          = "autoscale.pool_scaled"
+)
+
+// ContentReviewed is published by the UGC service when a moderator sets an
+// item's state.
+type ContentReviewed struct {
+	ContentID  string    `json:"content_id"`
+	TenantID   string    `json:"tenant_id"`
+	ProjectID  string    `json:"project_id"`
+	State      string    `json:"state"`
+	Reason     string    `json:"reason,omitempty"`
+	ReviewedAt time.Time `json:"reviewed_at"`
+}
+
+func (ContentReviewed) EventName() string { return NameContentReviewed }
+
+func (e ContentReviewed) Scope() (string, string) { return e.TenantID, e.ProjectID }
+
+// AssignmentCompleted is published by the orchestrator when an assignment
+// reaches a final status: completed, failed, or cancelled.
+type AssignmentCompleted struct {
+	AssignmentID  string    `json:"assignment_id"`
+	AgentID       string    `json:"agent_id"`
+	WorkloadID    string    `json:"workload_id"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	ProjectID     string    `json:"project_id,omitempty"`
+	Status        string    `json:"status"`
+	StatusMessage string    `json:"status_message,omitempty"`
+	CompletedAt   time.Time `json:"completed_at"`
+}
+
+func (AssignmentCompleted) EventName() string { return NameAssignmentCompleted }
+
+func (e AssignmentCompleted) Scope() (string, string) { return e.TenantID, e.ProjectID }
+
+// DeliveryFailed is published by the notification service when a channel
+// refuses a rendered notification.
+type DeliveryFailed struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Template  string    `json:"template"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	ProjectID string    `json:"project_id,omitempty"`
+	Error     string    `json:"error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+func (DeliveryFailed) EventName() string { return NameDeliveryFailed }
+
+func (e DeliveryFailed) Scope() (string, string) { return e.TenantID, e.ProjectID }
+
+// PresenceChanged is published by the presence service when a player or
+// game server comes online, starts a new session, or goes offline by
+// disconnecting or missing its heartbeats.
+type PresenceChanged struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	ProjectID string    `json:"project_id"`
+	Status    string    `json:"status"`
+	Previous  string    `json:"previous_status"`
+	SessionID string    `json:"session_id,omitempty"`
+	Reason    string    `json:"reason"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func (PresenceChanged) EventName() string { return NamePresenceChanged }
+
+func (e PresenceChanged) Scope() (string, string) { return e.TenantID, e.ProjectID }
+
+// PoolScaled is published by a service's autoscale controller when it
+// changes the size of a worker pool or buffer. Pools serve every tenant, so
+// the event has no scope.
+type PoolScaled struct {
+	Service     string    `json:"service"`
+	Target      string    `json:"target"`
+	Resource    string    `json:"resource"`
+	From        int       `json:"from"`
+	To          int       `json:"to"`
+	Utilization float64   `json:"utilization"`
+	Reason      string    `json:"reason"`
+	ScaledAt    time.Time `json:"scaled_at"`
+}
+
+func (PoolScaled) EventName() string { return NamePoolScaled }
+
+func (PoolScaled) Scope() (string, string) { return "", "" }
+
+// decoders builds an empty value for each known event name.
+var decoders = map[string]func(data []byte) (Event, error){
+	NameContentReviewed:     decodeAs[ContentReviewed],
+	NameAssignmentCompleted: decodeAs[AssignmentCompleted],
+	NameDeliveryFailed:      decodeAs[DeliveryFailed],
+	NamePresenceChanged:     decodeAs[PresenceChanged],
+	NamePoolScaled:          decodeAs[PoolScaled],
+}
+
+func decodeAs[E Event](data []byte) (Event, error) {
+	var event E
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Decode parses the JSON encoding of the event called name.
+func Decode(name string, data []byte) (Event, error) {
+	decode, ok := decoders[name]
+	if !ok {
+		return nil, fmt.Errorf("eventbus: unknown event %q", name)
+	}
+	event, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("eventbus: decode %s: %w", name, err)
+	}
+	return event, nil
+}
+
+// Names returns every known event name.
+func Names() []string {
+	return []string{NameContentReviewed, NameAssignmentCompleted, NameDeliveryFailed, NamePresenceChanged, NamePoolScaled}
+}
@@ -0,0 +1,70 @@
+package featureflags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// Evaluate decides whether f is on for s. A disabled flag is off for
+// everyone. Otherwise the first rule matching s decides with its rollout,
+// and a subject no rule matches gets the flag's own rollout.
+//
+// Rollouts bucket subjects by a hash of the flag key and the user ID (the
+// tenant ID when there is none), so a subject keeps its answer while the
+// percentage grows and different flags pick different subjects. Subjects
+// with neither ID fall in the last bucket, so only a full rollout reaches
+// them.
+func (f Flag) Evaluate(s Subject) Evaluation {
+	eval := Evaluation{Key: f.Key, Version: f.Version}
+	if !f.Enabled {
+		eval.Reason = ReasonDisabled
+		return eval
+	}
+	bucket := Bucket(f.Key, s)
+	for i, rule := range f.Rules {
+		if rule.matches(s) {
+			eval.Enabled = bucket < rule.Rollout
+			eval.Reason = ReasonRuleMatch
+			eval.Rule = i + 1
+			return eval
+		}
+	}
+	eval.Enabled = bucket < f.Rollout
+	eval.Reason = ReasonRollout
+	return eval
+}
+
+// Bucket places s in one of 100 buckets for the flag key. Clients that
+// evaluate locally must compute the same value.
+func Bucket(key string, s Subject) int {
+	id := s.UserID
+	if id == "" {
+		id = s.TenantID
+	}
+	if id == "" {
+		return 99
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + id))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+func (r Rule) matches(s Subject) bool {
+	var value string
+	switch r.Attribute {
+	case AttributeTenantID:
+		value = s.TenantID
+	case AttributeUserID:
+		value = s.UserID
+	default:
+		var ok bool
+		if value, ok = s.Attributes[r.Attribute]; !ok {
+			return false
+		}
+	}
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
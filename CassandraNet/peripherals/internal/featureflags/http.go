@@ -0,0 +1,295 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the feature flag API.
+const (
+	codeInvalidJSON        = "flags.invalid_json"
+	codeInvalidRequest     = "flags.invalid_request"
+	codeNotFound           = "flags.not_found"
+	codeUnavailable        = "flags.store_unavailable"
+	codeForbidden          = "flags.forbidden_tenant"
+	codeForbiddenProject   = "flags.forbidden_project"
+	codePreconditionFailed = "flags.precondition_failed"
+)
+
+const (
+	flagsBasePath = "/flags"
+	flagsPrefix   = "/flags/"
+	evaluatePath  = "/flags/evaluate"
+	snapshotPath  = "/flags/snapshot"
+)
+
+// Handler returns an HTTP handler for the feature flag endpoints.
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(flagsBasePath, s.handleList)
+	mux.HandleFunc(evaluatePath, s.handleEvaluate)
+	mux.HandleFunc(snapshotPath, s.handleSnapshot)
+	mux.HandleFunc(flagsPrefix, s.handleFlag)
+	return mux
+}
+
+type rulePayload struct {
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values"`
+	Rollout   *int     `json:"rollout"`
+}
+
+// putPayload omits the key and scope, which come from the path and query.
+// An omitted rollout means 100.
+type putPayload struct {
+	Description string        `json:"description"`
+	Enabled     bool          `json:"enabled"`
+	Rollout     *int          `json:"rollout"`
+	Rules       []rulePayload `json:"rules"`
+}
+
+type evaluatePayload struct {
+	TenantID   string            `json:"tenant_id"`
+	ProjectID  string            `json:"project_id"`
+	UserID     string            `json:"user_id"`
+	Attributes map[string]string `json:"attributes"`
+	Keys       []string          `json:"keys"`
+}
+
+type evaluateResponse struct {
+	Flags []Evaluation `json:"flags"`
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok || !auth.Allow(w, r, auth.PermFlagsRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	items, next, err := s.ListFlags(r.Context(), scope, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+func (s *Service) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok || !auth.Allow(w, r, auth.PermFlagsRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	snapshot, err := s.Snapshot(r.Context(), scope)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", snapshot.ETag)
+	if etagMatches(r.Header.Get("If-None-Match"), snapshot.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshot)
+}
+
+func (s *Service) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	var payload evaluatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	scope, ok := resolveScope(w, r, payload.TenantID, payload.ProjectID)
+	if !ok || !auth.Allow(w, r, auth.PermFlagsRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	evals, err := s.Evaluate(r.Context(), scope, Subject{UserID: payload.UserID, Attributes: payload.Attributes}, payload.Keys)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, evaluateResponse{Flags: evals})
+}
+
+func (s *Service) handleFlag(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, flagsPrefix)
+	if key == "" || strings.Contains(key, "/") {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermFlagsRead, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		flag, err := s.GetFlag(r.Context(), scope, key)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", versionETag(flag.Version))
+		writeJSON(w, http.StatusOK, flag)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermFlagsManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		s.handlePut(w, r, scope, key)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermFlagsManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.DeleteFlag(r.Context(), scope, key); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Service) handlePut(w http.ResponseWriter, r *http.Request, scope Scope, key string) {
+	defer r.Body.Close()
+	var payload putPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	rules := make([]Rule, len(payload.Rules))
+	for i, rule := range payload.Rules {
+		rules[i] = Rule{Attribute: rule.Attribute, Values: rule.Values, Rollout: percent(rule.Rollout)}
+	}
+	flag, created, err := s.PutFlag(r.Context(), PutRequest{
+		Key:         key,
+		TenantID:    scope.TenantID,
+		ProjectID:   scope.ProjectID,
+		Description: payload.Description,
+		Enabled:     payload.Enabled,
+		Rules:       rules,
+		Rollout:     percent(payload.Rollout),
+		IfVersion:   ifVersion,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(flag.Version))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, flag)
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// requested scope, writing 403 when they contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request, tenantID, projectID string) (Scope, bool) {
+	tenant, ok := auth.ResolveTenant(r.Context(), tenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+tenantID)
+		return Scope{}, false
+	}
+	project, ok := auth.ResolveProject(r.Context(), projectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+projectID)
+		return Scope{}, false
+	}
+	return Scope{TenantID: tenant, ProjectID: project}, true
+}
+
+func percent(p *int) int {
+	if p == nil {
+		return 100
+	}
+	return *p
+}
+
+// versionETag is a flag's ETag, its quoted version.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch reads the version a PUT is conditional on, 0 when the header
+// is absent.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrPreconditionFailed
+	}
+	return version, nil
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrFlagNotFound):
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		problem.Write(w, r, http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+	case errors.Is(err, ErrStore):
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
+
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "flags", methods...)
+}
@@ -0,0 +1,142 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func do(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestEvaluate(t *testing.T) {
+	flag := Flag{
+		Key:     "new-lobby",
+		Enabled: true,
+		Rules: []Rule{
+			{Attribute: AttributeTenantID, Values: []string{"beta-studio"}, Rollout: 100},
+			{Attribute: "platform", Values: []string{"console"}, Rollout: 0},
+		},
+		Rollout: 30,
+	}
+	if eval := flag.Evaluate(Subject{TenantID: "beta-studio", UserID: "u1"}); !eval.Enabled || eval.Reason != ReasonRuleMatch || eval.Rule != 1 {
+		t.Fatalf("tenant rule: %+v", eval)
+	}
+	if eval := flag.Evaluate(Subject{TenantID: "acme", UserID: "u1", Attributes: map[string]string{"platform": "console"}}); eval.Enabled || eval.Rule != 2 {
+		t.Fatalf("attribute rule: %+v", eval)
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		subject := Subject{TenantID: "acme", UserID: fmt.Sprintf("user-%d", i)}
+		eval := flag.Evaluate(subject)
+		if eval.Reason != ReasonRollout {
+			t.Fatalf("expected rollout reason, got %+v", eval)
+		}
+		if eval.Enabled {
+			enabled++
+		}
+		if eval != flag.Evaluate(subject) {
+			t.Fatal("evaluation is not stable")
+		}
+	}
+	if enabled < 250 || enabled > 350 {
+		t.Fatalf("30%% rollout enabled %d of 1000 users", enabled)
+	}
+
+	wider := flag
+	wider.Rollout = 60
+	for i := 0; i < 1000; i++ {
+		subject := Subject{TenantID: "acme", UserID: fmt.Sprintf("user-%d", i)}
+		if flag.Evaluate(subject).Enabled && !wider.Evaluate(subject).Enabled {
+			t.Fatalf("%s lost the flag when the rollout grew", subject.UserID)
+		}
+	}
+
+	flag.Enabled = false
+	if eval := flag.Evaluate(Subject{TenantID: "beta-studio"}); eval.Enabled || eval.Reason != ReasonDisabled {
+		t.Fatalf("disabled flag: %+v", eval)
+	}
+}
+
+func TestFlagAPI(t *testing.T) {
+	server := httptest.NewServer(NewService(NewMemoryStore(), nil).Handler())
+	defer server.Close()
+	project := server.URL + "/flags/new-lobby?project_id=p1"
+	tenant := project + "&tenant_id=acme"
+
+	resp := do(t, http.MethodPut, project, `{"enabled": true, "rollout": 0, "rules": [{"attribute": "user_id", "values": ["tester"]}]}`, nil)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("ETag") != `"1"` {
+		t.Fatalf("create: %d %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := do(t, http.MethodPut, project, `{"enabled": false}`, map[string]string{"If-Match": `"7"`}); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale version, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, server.URL+"/flags/Bad%20Key?project_id=p1", `{}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid key, got %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPut, project, `{"enabled": true, "rollout": 101}`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a rollout above 100, got %d", resp.StatusCode)
+	}
+
+	evaluate := func(body string) []Evaluation {
+		t.Helper()
+		resp := do(t, http.MethodPost, server.URL+"/flags/evaluate", body, nil)
+		var out evaluateResponse
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&out) != nil {
+			t.Fatalf("evaluate: %d", resp.StatusCode)
+		}
+		return out.Flags
+	}
+	evals := evaluate(`{"tenant_id": "acme", "project_id": "p1", "user_id": "tester", "keys": ["new-lobby", "missing"]}`)
+	if len(evals) != 2 || !evals[0].Enabled || evals[0].Reason != ReasonRuleMatch || evals[1].Reason != ReasonNotFound {
+		t.Fatalf("evaluate: %+v", evals)
+	}
+
+	snapshot := do(t, http.MethodGet, server.URL+"/flags/snapshot?project_id=p1&tenant_id=acme", "", nil)
+	etag := snapshot.Header.Get("ETag")
+	if snapshot.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("snapshot: %d %q", snapshot.StatusCode, etag)
+	}
+	if resp := do(t, http.MethodGet, server.URL+"/flags/snapshot?project_id=p1&tenant_id=acme", "", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for a current snapshot, got %d", resp.StatusCode)
+	}
+
+	// The tenant's own flag overrides the project-wide one for that tenant only.
+	if resp := do(t, http.MethodPut, tenant, `{"enabled": false}`, nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("tenant override: %d", resp.StatusCode)
+	}
+	if evals := evaluate(`{"tenant_id": "acme", "project_id": "p1", "user_id": "tester"}`); len(evals) != 1 || evals[0].Reason != ReasonDisabled {
+		t.Fatalf("override not applied: %+v", evals)
+	}
+	if evals := evaluate(`{"tenant_id": "other", "project_id": "p1", "user_id": "tester"}`); len(evals) != 1 || !evals[0].Enabled {
+		t.Fatalf("override leaked to another tenant: %+v", evals)
+	}
+	if resp := do(t, http.MethodGet, server.URL+"/flags/snapshot?project_id=p1&tenant_id=acme", "", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the snapshot to change, got %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodDelete, tenant, "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodGet, tenant, "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+	if evals := evaluate(`{"tenant_id": "acme", "project_id": "p1", "user_id": "tester"}`); len(evals) != 1 || !evals[0].Enabled {
+		t.Fatalf("project-wide flag not uncovered: %+v", evals)
+	}
+}
@@ -0,0 +1,323 @@
+package featureflags
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrFlagNotFound indicates no flag with the key exists in the scope.
+	ErrFlagNotFound = errors.New("featureflags: flag not found")
+	// ErrPreconditionFailed indicates an If-Match version check did not
+	// hold.
+	ErrPreconditionFailed = errors.New("featureflags: version mismatch")
+	// ErrStore wraps failures of the underlying storage driver.
+	ErrStore = errors.New("featureflags: store unavailable")
+)
+
+// Limits of flag definitions.
+const (
+	maxDescriptionLength = 1024
+	maxRules             = 32
+	maxRuleValues        = 256
+	maxEvaluateKeys      = 256
+)
+
+// keyPattern restricts flag keys to characters safe in paths and code.
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// reservedKeys collide with the API's own paths under /flags/.
+var reservedKeys = []string{"evaluate", "snapshot"}
+
+// Store abstracts persistence for flags.
+type Store interface {
+	Get(ctx context.Context, scope Scope, key string) (Flag, error)
+	// Put creates or replaces flag, setting its version one above the
+	// stored one and keeping its creation time. ifVersion, when non-zero,
+	// must equal the stored version. created reports whether the flag is
+	// new.
+	Put(ctx context.Context, flag Flag, ifVersion int64) (stored Flag, created bool, err error)
+	// Delete removes a flag and returns it as it was.
+	Delete(ctx context.Context, scope Scope, key string) (Flag, error)
+	// List returns one page of the scope's own flags in key order and the
+	// position of the next page, empty on the last.
+	List(ctx context.Context, scope Scope, page pagination.Request) ([]Flag, string, error)
+	// All returns every flag of the scope in key order.
+	All(ctx context.Context, scope Scope) ([]Flag, error)
+}
+
+// Clock allows deterministic timing in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// Service manages flags and evaluates them for subjects.
+type Service struct {
+	store Store
+	clock Clock
+	audit *audit.Log
+}
+
+// NewService builds a Service with the provided store.
+func NewService(store Store, clock Clock) *Service {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Service{store: store, clock: clock}
+}
+
+// SetAudit records every flag change in log. Call it before the service
+// handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// PutFlag creates or replaces a flag.
+func (s *Service) PutFlag(ctx context.Context, req PutRequest) (Flag, bool, error) {
+	var v validation.Validator
+	validateKey(&v, req.Key)
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", req.ProjectID)
+	v.String("description", req.Description).MaxLength(maxDescriptionLength)
+	v.Int("rollout", int64(req.Rollout)).Range(0, 100)
+	v.Check(len(req.Rules) <= maxRules, "rules", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxRules))
+	for i, rule := range req.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		v.String(field+".attribute", rule.Attribute).Required().MaxLength(validation.MaxKeyLength)
+		v.Check(len(rule.Values) > 0, field+".values", validation.RuleRequired, "is required")
+		v.Check(len(rule.Values) <= maxRuleValues, field+".values", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxRuleValues))
+		for j, value := range rule.Values {
+			v.String(fmt.Sprintf("%s.values[%d]", field, j), value).MaxLength(validation.MaxValueLength)
+		}
+		v.Int(field+".rollout", int64(rule.Rollout)).Range(0, 100)
+	}
+	if err := v.Err(); err != nil {
+		return Flag{}, false, err
+	}
+	scope := Scope{TenantID: req.TenantID, ProjectID: req.ProjectID}
+	before, err := s.previous(ctx, scope, req.Key)
+	if err != nil {
+		return Flag{}, false, err
+	}
+	now := s.clock.Now()
+	flag, created, err := s.store.Put(ctx, Flag{
+		Key:         req.Key,
+		TenantID:    req.TenantID,
+		ProjectID:   req.ProjectID,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+		Rules:       cloneRules(req.Rules),
+		Rollout:     req.Rollout,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}, req.IfVersion)
+	if err != nil {
+		return Flag{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "featureflags.flag.put",
+		Resource:  "flags/" + flag.Key,
+		TenantID:  flag.TenantID,
+		ProjectID: flag.ProjectID,
+		Before:    before,
+		After:     flag,
+	})
+	return flag, created, nil
+}
+
+// GetFlag returns the scope's own flag with key.
+func (s *Service) GetFlag(ctx context.Context, scope Scope, key string) (Flag, error) {
+	if err := validateScope(scope, key); err != nil {
+		return Flag{}, err
+	}
+	return s.store.Get(ctx, scope, key)
+}
+
+// DeleteFlag removes the scope's own flag with key. Deleting a tenant's
+// flag uncovers the project-wide flag of the same key, if any.
+func (s *Service) DeleteFlag(ctx context.Context, scope Scope, key string) error {
+	if err := validateScope(scope, key); err != nil {
+		return err
+	}
+	flag, err := s.store.Delete(ctx, scope, key)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "featureflags.flag.delete",
+		Resource:  "flags/" + flag.Key,
+		TenantID:  flag.TenantID,
+		ProjectID: flag.ProjectID,
+		Before:    flag,
+	})
+	return nil
+}
+
+// ListFlags lists one page of the scope's own flags, and the position of
+// the next page. Listing a tenant does not include the project-wide flags;
+// Snapshot merges them.
+func (s *Service) ListFlags(ctx context.Context, scope Scope, page pagination.Request) ([]Flag, string, error) {
+	if err := validateScope(scope, ""); err != nil {
+		return nil, "", err
+	}
+	return s.store.List(ctx, scope, page)
+}
+
+// Snapshot returns the flags in effect for the scope's tenant: the
+// project-wide flags, each replaced by the tenant's own flag of the same key.
+// The ETag changes whenever any of them does.
+func (s *Service) Snapshot(ctx context.Context, scope Scope) (Snapshot, error) {
+	if err := validateScope(scope, ""); err != nil {
+		return Snapshot{}, err
+	}
+	flags, err := s.store.All(ctx, Scope{ProjectID: scope.ProjectID})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if scope.TenantID != "" {
+		own, err := s.store.All(ctx, scope)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		flags = merge(flags, own)
+	}
+	if flags == nil {
+		flags = []Flag{}
+	}
+	return Snapshot{
+		TenantID:  scope.TenantID,
+		ProjectID: scope.ProjectID,
+		ETag:      computeETag(flags),
+		Flags:     flags,
+	}, nil
+}
+
+// Evaluate evaluates the flags in effect for the scope's tenant for
+// subject, in key order. keys limits the answer to those flags, reporting
+// ReasonNotFound for unknown ones; empty evaluates every flag. The subject's
+// tenant is the scope's.
+func (s *Service) Evaluate(ctx context.Context, scope Scope, subject Subject, keys []string) ([]Evaluation, error) {
+	var v validation.Validator
+	v.Check(len(keys) <= maxEvaluateKeys, "keys", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxEvaluateKeys))
+	v.String("user_id", subject.UserID).MaxLength(validation.MaxIDLength)
+	v.Map("attributes", subject.Attributes).Limited()
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.Snapshot(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	subject.TenantID = scope.TenantID
+	if len(keys) == 0 {
+		evals := make([]Evaluation, 0, len(snapshot.Flags))
+		for _, flag := range snapshot.Flags {
+			evals = append(evals, flag.Evaluate(subject))
+		}
+		return evals, nil
+	}
+	byKey := make(map[string]Flag, len(snapshot.Flags))
+	for _, flag := range snapshot.Flags {
+		byKey[flag.Key] = flag
+	}
+	evals := make([]Evaluation, 0, len(keys))
+	for _, key := range keys {
+		flag, ok := byKey[key]
+		if !ok {
+			evals = append(evals, Evaluation{Key: key, Reason: ReasonNotFound})
+			continue
+		}
+		evals = append(evals, flag.Evaluate(subject))
+	}
+	return evals, nil
+}
+
+// previous returns the stored flag for the audit log's before state, nil
+// when auditing is off or none exists.
+func (s *Service) previous(ctx context.Context, scope Scope, key string) (any, error) {
+	if s.audit == nil {
+		return nil, nil
+	}
+	flag, err := s.store.Get(ctx, scope, key)
+	if errors.Is(err, ErrFlagNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return flag, nil
+}
+
+func validateKey(v *validation.Validator, key string) {
+	v.String("key", key).Required().MaxLength(validation.MaxIDLength)
+	if key == "" {
+		return
+	}
+	v.Check(keyPattern.MatchString(key), "key", validation.RuleFormat, "must be lower-case letters, digits, '.', '_', or '-', starting with a letter or digit")
+	for _, reserved := range reservedKeys {
+		v.Check(key != reserved, "key", validation.RuleFormat, "is reserved")
+	}
+}
+
+// validateScope checks a scope and, when key is not empty, a flag key.
+func validateScope(scope Scope, key string) error {
+	var v validation.Validator
+	v.String("tenant_id", scope.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", scope.ProjectID)
+	if key != "" {
+		v.String("key", key).MaxLength(validation.MaxIDLength)
+	}
+	return v.Err()
+}
+
+// merge overlays a tenant's flags on the project-wide ones, both in key
+// order, keeping the result in key order.
+func merge(project, tenant []Flag) []Flag {
+	byKey := make(map[string]Flag, len(project)+len(tenant))
+	for _, flag := range project {
+		byKey[flag.Key] = flag
+	}
+	for _, flag := range tenant {
+		byKey[flag.Key] = flag
+	}
+	out := make([]Flag, 0, len(byKey))
+	for _, flag := range byKey {
+		out = append(out, flag)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// computeETag derives a strong ETag from the flags in effect, so clients
+// holding a current snapshot are told nothing changed.
+func computeETag(flags []Flag) string {
+	encoded, _ := json.Marshal(flags)
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+func cloneRules(rules []Rule) []Rule {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := make([]Rule, len(rules))
+	for i, rule := range rules {
+		out[i] = Rule{Attribute: rule.Attribute, Values: append([]string(nil), rule.Values...), Rollout: rule.Rollout}
+	}
+	return out
+}
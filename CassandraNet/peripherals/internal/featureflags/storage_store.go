@@ -0,0 +1,172 @@
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// flagBucket holds flags as JSON keyed by "{project}/{tenant}/{key}", with
+// the IDs path-escaped and the tenant empty for project-wide flags, so one
+// scope's flags share a prefix and scan in key order.
+const flagBucket = "featureflags.flags"
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db storage.Driver
+}
+
+// NewStorageStore returns a store keeping flags in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// Get returns the scope's flag with key.
+func (s *StorageStore) Get(ctx context.Context, scope Scope, key string) (Flag, error) {
+	var flag Flag
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		flag, err = getFlag(tx, scope, key)
+		return err
+	})
+	return flag, storeError(err)
+}
+
+// Put creates or replaces a flag, checking ifVersion against the stored
+// one.
+func (s *StorageStore) Put(ctx context.Context, flag Flag, ifVersion int64) (Flag, bool, error) {
+	var stored Flag
+	var created bool
+	scope := Scope{TenantID: flag.TenantID, ProjectID: flag.ProjectID}
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		stored, created = flag, false
+		existing, err := getFlag(tx, scope, flag.Key)
+		switch {
+		case errors.Is(err, ErrFlagNotFound):
+			if ifVersion != 0 {
+				return ErrPreconditionFailed
+			}
+			created = true
+			stored.Version = 1
+		case err != nil:
+			return err
+		default:
+			if ifVersion != 0 && ifVersion != existing.Version {
+				return ErrPreconditionFailed
+			}
+			stored.Version = existing.Version + 1
+			stored.CreatedAt = existing.CreatedAt
+		}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return err
+		}
+		return tx.Put(flagBucket, flagKey(scope, flag.Key), data)
+	})
+	if err != nil {
+		return Flag{}, false, storeError(err)
+	}
+	return stored, created, nil
+}
+
+// Delete removes the scope's flag with key.
+func (s *StorageStore) Delete(ctx context.Context, scope Scope, key string) (Flag, error) {
+	var flag Flag
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if flag, err = getFlag(tx, scope, key); err != nil {
+			return err
+		}
+		return tx.Delete(flagBucket, flagKey(scope, key))
+	})
+	return flag, storeError(err)
+}
+
+// List returns one page of the scope's flags, ordered by key.
+func (s *StorageStore) List(ctx context.Context, scope Scope, page pagination.Request) ([]Flag, string, error) {
+	collector := pagination.NewCollector[Flag](page)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(flagBucket, scopePrefix(scope), func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			flag, err := decodeFlag(value)
+			if err != nil {
+				return err
+			}
+			if !collector.Add(key, flag) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	items, next := collector.Page()
+	return items, next, nil
+}
+
+// All returns every flag of the scope, ordered by key.
+func (s *StorageStore) All(ctx context.Context, scope Scope) ([]Flag, error) {
+	var flags []Flag
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		flags = nil
+		return tx.Scan(flagBucket, scopePrefix(scope), func(_ string, value []byte) error {
+			flag, err := decodeFlag(value)
+			if err != nil {
+				return err
+			}
+			flags = append(flags, flag)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return flags, nil
+}
+
+func scopePrefix(scope Scope) string {
+	return url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(scope.TenantID) + "/"
+}
+
+func flagKey(scope Scope, key string) string {
+	return scopePrefix(scope) + key
+}
+
+func getFlag(tx storage.Tx, scope Scope, key string) (Flag, error) {
+	data, err := tx.Get(flagBucket, flagKey(scope, key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Flag{}, ErrFlagNotFound
+	}
+	if err != nil {
+		return Flag{}, err
+	}
+	return decodeFlag(data)
+}
+
+func decodeFlag(data []byte) (Flag, error) {
+	var flag Flag
+	err := json.Unmarshal(data, &flag)
+	return flag, err
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrFlagNotFound) || errors.Is(err, ErrPreconditionFailed) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
@@ -0,0 +1,95 @@
+package featureflags
+
+import "time"
+
+// Reason explains the outcome of an evaluation.
+type Reason string
+
+const (
+	// ReasonDisabled means the flag is switched off for everyone.
+	ReasonDisabled Reason = "disabled"
+	// ReasonRuleMatch means a targeting rule matched the subject.
+	ReasonRuleMatch Reason = "rule_match"
+	// ReasonRollout means no rule matched and the flag's rollout decided.
+	ReasonRollout Reason = "rollout"
+	// ReasonNotFound means no flag with the key exists in the scope.
+	ReasonNotFound Reason = "not_found"
+)
+
+// Attributes every subject carries. Rules may also name custom attributes
+// supplied by the caller.
+const (
+	AttributeTenantID = "tenant_id"
+	AttributeUserID   = "user_id"
+)
+
+// Flag is a feature switch for a project. A flag without a tenant applies to
+// every tenant of the project; a tenant's flag with the same key overrides it
+// for that tenant.
+type Flag struct {
+	Key         string    `json:"key"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	ProjectID   string    `json:"project_id"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	Rules       []Rule    `json:"rules,omitempty"`
+	Rollout     int       `json:"rollout"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Rule targets subjects whose attribute holds one of Values. A matching
+// subject gets the flag when it falls within the rule's Rollout percentage.
+type Rule struct {
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values"`
+	Rollout   int      `json:"rollout"`
+}
+
+// Subject is who a flag is evaluated for.
+type Subject struct {
+	TenantID   string            `json:"tenant_id,omitempty"`
+	UserID     string            `json:"user_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Evaluation is the outcome of evaluating a flag for a subject.
+type Evaluation struct {
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+	Reason  Reason `json:"reason"`
+	// Rule is the 1-based position of the matching rule, 0 when none
+	// matched.
+	Rule    int   `json:"rule,omitempty"`
+	Version int64 `json:"version,omitempty"`
+}
+
+// Snapshot is every flag in effect for a tenant of a project, for clients
+// that evaluate locally.
+type Snapshot struct {
+	TenantID  string `json:"tenant_id,omitempty"`
+	ProjectID string `json:"project_id"`
+	ETag      string `json:"etag"`
+	Flags     []Flag `json:"flags"`
+}
+
+// PutRequest creates or replaces a flag.
+type PutRequest struct {
+	Key         string
+	TenantID    string
+	ProjectID   string
+	Description string
+	Enabled     bool
+	Rules       []Rule
+	Rollout     int
+	// IfVersion, when non-zero, must equal the stored flag's version.
+	IfVersion int64
+}
+
+// Scope names the tenant and project a flag belongs to. An empty tenant
+// means the project-wide flags.
+type Scope struct {
+	TenantID  string
+	ProjectID string
+}
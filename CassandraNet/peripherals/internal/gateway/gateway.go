@@ -0,0 +1,219 @@
+// Package gateway routes the public API paths of every peripheral service
+// through a single listener, either to handlers running in the same process
+// or to remote backends over HTTP.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/websocket"
+)
+
+// Route sends requests matching Patterns to one service.
+type Route struct {
+	// Name identifies the service in logs and health checks.
+	Name string
+	// Patterns are http.ServeMux patterns such as "/notify" or "/ugc/".
+	Patterns []string
+	// Strip is removed from the start of the path before forwarding, so
+	// "/ugc/content" reaches the UGC service as "/content".
+	Strip string
+	// Backend is the base URL of a remote service. Exactly one of Backend,
+	// Resolve, and Handler must be set.
+	Backend *url.URL
+	// Resolve looks up a remote instance for each request, for example
+	// from the service registry.
+	Resolve func(ctx context.Context) (*url.URL, error)
+	// Handler serves the route in-process.
+	Handler http.Handler
+}
+
+// Gateway dispatches requests to its routes.
+type Gateway struct {
+	mux    *http.ServeMux
+	routes []Route
+	client *http.Client
+}
+
+// New builds a gateway. Remote backends are called through transport (nil
+// uses http.DefaultTransport); logger reports proxy failures.
+func New(routes []Route, transport http.RoundTripper, logger interface {
+	Printf(string, ...any)
+}) (*Gateway, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	g := &Gateway{
+		mux:    http.NewServeMux(),
+		routes: routes,
+		client: &http.Client{Transport: transport, Timeout: 5 * time.Second},
+	}
+	g.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	g.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		problem.NotFound(w, r, "gateway", "no service is routed at "+r.URL.Path)
+	})
+	for _, route := range routes {
+		set := 0
+		for _, ok := range []bool{route.Backend != nil, route.Resolve != nil, route.Handler != nil} {
+			if ok {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("gateway: route %s needs exactly one of a backend, a resolver, or a handler", route.Name)
+		}
+		handler := route.Handler
+		if handler == nil {
+			handler = newProxy(route, transport, logger)
+		} else if route.Strip != "" {
+			handler = http.StripPrefix(route.Strip, handler)
+		}
+		for _, pattern := range route.Patterns {
+			g.mux.Handle(pattern, handler)
+		}
+	}
+	return g, nil
+}
+
+// Handler returns the routing handler.
+func (g *Gateway) Handler() http.Handler {
+	return g.mux
+}
+
+// RegisterChecks adds an optional readiness check for each remote backend,
+// so one unreachable service degrades the gateway without failing it.
+func (g *Gateway) RegisterChecks(checks *health.Registry) {
+	for _, route := range g.routes {
+		if route.Handler != nil {
+			continue
+		}
+		checks.Optional(route.Name, g.backendCheck(backendResolver(route)))
+	}
+}
+
+// backendResolver returns route.Resolve, or one that always returns
+// route.Backend.
+func backendResolver(route Route) func(context.Context) (*url.URL, error) {
+	if route.Resolve != nil {
+		return route.Resolve
+	}
+	return func(context.Context) (*url.URL, error) { return route.Backend, nil }
+}
+
+func (g *Gateway) backendCheck(resolve func(context.Context) (*url.URL, error)) health.Check {
+	return func(ctx context.Context) error {
+		backend, err := resolve(ctx)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, backend.JoinPath("/healthz").String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := g.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("backend returned %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+type backendKey struct{}
+
+// newProxy forwards to the route's backend, resolved per request, passing
+// the caller's credentials through and carrying the request and tenant IDs
+// assigned at the gateway.
+func newProxy(route Route, transport http.RoundTripper, logger interface {
+	Printf(string, ...any)
+}) http.Handler {
+	resolve := backendResolver(route)
+	proxy := &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if route.Strip != "" {
+				pr.Out.URL.Path = ensureSlash(strings.TrimPrefix(pr.In.URL.Path, route.Strip))
+				pr.Out.URL.RawPath = ""
+			}
+			// A version prefix stripped in front of the routes goes back
+			// in front of the service's own path.
+			if v, ok := apiversion.Requested(pr.In.Context()); ok {
+				pr.Out.URL.Path = "/" + v.String() + pr.Out.URL.Path
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(pr.In.Context().Value(backendKey{}).(*url.URL))
+			pr.SetXForwarded()
+			// CORS is decided here; a backend with its own CORS settings
+			// would otherwise add a second set of headers.
+			pr.Out.Header.Del("Origin")
+			ctx := pr.In.Context()
+			if id := logging.RequestID(ctx); id != "" {
+				pr.Out.Header.Set(logging.RequestIDHeader, id)
+			}
+			if tenant := logging.TenantID(ctx); tenant != "" {
+				pr.Out.Header.Set(logging.TenantIDHeader, tenant)
+			}
+			if project := logging.ProjectID(ctx); project != "" {
+				pr.Out.Header.Set(logging.ProjectIDHeader, project)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			logging.For(r.Context(), logger).Printf("proxy to %s failed: %v", route.Name, err)
+			problem.Write(w, r, http.StatusBadGateway, "gateway.bad_gateway", route.Name+" is unavailable")
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backend, err := resolve(r.Context())
+		if err != nil {
+			logging.For(r.Context(), logger).Printf("resolve %s failed: %v", route.Name, err)
+			problem.Write(w, r, http.StatusBadGateway, "gateway.bad_gateway", route.Name+" is unavailable")
+			return
+		}
+		ctx := context.WithValue(r.Context(), backendKey{}, backend)
+		// Event streams and WebSockets stay open until the client leaves;
+		// end them when the gateway begins shutting down, as the services
+		// end their own.
+		streaming := r.Header.Get("Accept") == "text/event-stream" || websocket.IsUpgrade(r)
+		if draining := server.Draining(ctx); draining != nil && streaming {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithCancel(ctx)
+			defer cancel()
+			go func() {
+				select {
+				case <-draining:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+		}
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func ensureSlash(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
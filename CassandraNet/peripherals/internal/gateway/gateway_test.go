@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %s: %v", raw, err)
+	}
+	return u
+}
+
+func TestGatewayRoutesRemoteAndInProcess(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			t.Errorf("backend received Origin %q", r.Header.Get("Origin"))
+		}
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get(logging.RequestIDHeader)+" "+r.Header.Get(logging.TenantIDHeader))
+	}))
+	defer backend.Close()
+
+	gw, err := New([]Route{
+		{Name: "ugc", Patterns: []string{"/ugc/"}, Strip: "/ugc", Backend: mustParse(t, backend.URL)},
+		{Name: "logs", Patterns: []string{"/logs", "/logs/"}, Backend: mustParse(t, backend.URL)},
+		{Name: "messaging", Patterns: []string{"/messaging/"}, Strip: "/messaging", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "local "+r.URL.Path)
+		})},
+	}, nil, noopLogger{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	handler := logging.Middleware(logging.New("test"), gw.Handler())
+
+	serve := func(target string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set(logging.RequestIDHeader, "req-1")
+		req.Header.Set(logging.TenantIDHeader, "acme")
+		req.Header.Set("Origin", "https://admin.example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, body := serve("/ugc/content?state=pending"); code != http.StatusOK || body != "/content req-1 acme" {
+		t.Fatalf("ugc: %d %q", code, body)
+	}
+	if code, body := serve("/logs/recent"); code != http.StatusOK || body != "/logs/recent req-1 acme" {
+		t.Fatalf("logs: %d %q", code, body)
+	}
+	if code, body := serve("/messaging/topics/t/messages"); code != http.StatusOK || body != "local /topics/t/messages" {
+		t.Fatalf("messaging: %d %q", code, body)
+	}
+	if code, _ := serve("/unknown"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unrouted path, got %d", code)
+	}
+}
+
+func TestGatewayReportsUnavailableBackend(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	target := mustParse(t, backend.URL)
+	backend.Close()
+
+	gw, err := New([]Route{{Name: "metrics", Patterns: []string{"/metrics/"}, Backend: target}}, nil, noopLogger{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	gw.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics/summary", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502, got %d", rec.Code)
+	}
+}
+
+func TestGatewayResolvesBackendPerRequest(t *testing.T) {
+	newBackend := func(name string) *url.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, name+" "+r.URL.Path)
+		}))
+		t.Cleanup(srv.Close)
+		return mustParse(t, srv.URL)
+	}
+	backends := []*url.URL{newBackend("a"), newBackend("b")}
+	calls := 0
+	var resolveErr error
+	gw, err := New([]Route{{Name: "ugc", Patterns: []string{"/ugc/"}, Strip: "/ugc", Resolve: func(context.Context) (*url.URL, error) {
+		calls++
+		return backends[calls%2], resolveErr
+	}}}, nil, noopLogger{})
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	serve := func() (int, string) {
+		rec := httptest.NewRecorder()
+		gw.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ugc/content", nil))
+		return rec.Code, rec.Body.String()
+	}
+	if code, body := serve(); code != http.StatusOK || body != "b /content" {
+		t.Fatalf("first request: %d %q", code, body)
+	}
+	if code, body := serve(); code != http.StatusOK || body != "a /content" {
+		t.Fatalf("second request: %d %q", code, body)
+	}
+
+	checks := health.NewRegistry()
+	gw.RegisterChecks(checks)
+	if report := checks.Ready(context.Background()); report.Status != health.StatusOK {
+		t.Fatalf("expected the resolved backend to pass its check, got %+v", report)
+	}
+	resolveErr = errors.New("no available instance")
+	if code, _ := serve(); code != http.StatusBadGateway {
+		t.Fatalf("expected 502 when resolution fails, got %d", code)
+	}
+	if report := checks.Ready(context.Background()); report.Status != health.StatusDegraded {
+		t.Fatalf("expected a degraded gateway when resolution fails, got %+v", report)
+	}
+}
+
+func TestNewRejectsAmbiguousRoute(t *testing.T) {
+	_, err := New([]Route{{Name: "x", Patterns: []string{"/x/"}}}, nil, noopLogger{})
+	if err == nil {
+		t.Fatal("expected a route without backend or handler to be rejected")
+	}
+	_, err = New([]Route{{Name: "x", Patterns: []string{"/x/"}, Backend: mustParse(t, "http://x"), Resolve: func(context.Context) (*url.URL, error) { return nil, nil }}}, nil, noopLogger{})
+	if err == nil {
+		t.Fatal("expected a route with both a backend and a resolver to be rejected")
+	}
+}
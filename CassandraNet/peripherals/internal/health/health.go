@@ -0,0 +1,209 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Check reports whether a component is healthy. It should honour ctx and
+// return promptly once it expires.
+type Check func(ctx context.Context) error
+
+// Status values reported for individual checks and for the whole response.
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDegraded = "degraded"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	Optional   bool    `json:"optional,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the body served by /livez and /readyz.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Registry holds the checks behind a process's /livez and /readyz
+// endpoints. Liveness checks answer "should this process be restarted" and
+// should only cover in-process state; readiness checks answer "should this
+// instance receive traffic" and cover dependencies such as stores, worker
+// pools, sinks, and downstream services.
+type Registry struct {
+	// Timeout bounds each check (default 2s).
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  map[string]entry
+	readiness map[string]entry
+}
+
+type entry struct {
+	check    Check
+	optional bool
+}
+
+// NewRegistry constructs an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		Timeout:   2 * time.Second,
+		liveness:  make(map[string]entry),
+		readiness: make(map[string]entry),
+	}
+}
+
+// Liveness registers a check reported by /livez.
+func (r *Registry) Liveness(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liveness[name] = entry{check: check}
+}
+
+// Readiness registers a check that must pass for /readyz to succeed.
+func (r *Registry) Readiness(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness[name] = entry{check: check}
+}
+
+// Optional registers a readiness check whose failure marks the instance
+// degraded without taking it out of rotation, for dependencies the service
+// can run without (an alert notifier, say).
+func (r *Registry) Optional(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness[name] = entry{check: check, optional: true}
+}
+
+// Live runs the liveness checks.
+func (r *Registry) Live(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := copyEntries(r.liveness)
+	r.mu.RUnlock()
+	return r.run(ctx, checks)
+}
+
+// Ready runs the readiness checks.
+func (r *Registry) Ready(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := copyEntries(r.readiness)
+	r.mu.RUnlock()
+	return r.run(ctx, checks)
+}
+
+// LiveHandler serves Live, answering 503 when a check fails.
+func (r *Registry) LiveHandler() http.Handler {
+	return reportHandler(r.Live)
+}
+
+// ReadyHandler serves Ready, answering 503 when a required check fails.
+// Optional failures are reported as degraded with 200.
+func (r *Registry) ReadyHandler() http.Handler {
+	return reportHandler(r.Ready)
+}
+
+func reportHandler(run func(context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			problem.MethodNotAllowed(w, req, "health", http.MethodGet, http.MethodHead)
+			return
+		}
+		report := run(req.Context())
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if req.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(report)
+		}
+	})
+}
+
+// run executes checks concurrently, each under the registry timeout.
+func (r *Registry) run(ctx context.Context, checks map[string]entry) Report {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]Result, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, e entry) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, e, timeout)
+		}(i, checks[name])
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(names))}
+	for i, name := range names {
+		res := results[i]
+		report.Checks[name] = res
+		if res.Status != StatusFail {
+			continue
+		}
+		if res.Optional {
+			if report.Status == StatusOK {
+				report.Status = StatusDegraded
+			}
+		} else {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, e entry, timeout time.Duration) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() { errCh <- e.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	res := Result{
+		Status:     StatusOK,
+		Optional:   e.optional,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func copyEntries(src map[string]entry) map[string]entry {
+	out := make(map[string]entry, len(src))
+	for k, v := range src {
+		out[k] = v
+	}
+	return out
+}
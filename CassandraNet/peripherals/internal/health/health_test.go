@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, h http.Handler) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	return rec.Code, report
+}
+
+func TestReadinessAggregatesChecks(t *testing.T) {
+	r := NewRegistry()
+	r.Readiness("store", func(context.Context) error { return nil })
+	r.Optional("notifier", func(context.Context) error { return errors.New("connection refused") })
+
+	code, report := serve(t, r.ReadyHandler())
+	if code != http.StatusOK || report.Status != StatusDegraded {
+		t.Fatalf("expected degraded 200, got %d %+v", code, report)
+	}
+	if got := report.Checks["notifier"]; got.Status != StatusFail || got.Error != "connection refused" || !got.Optional {
+		t.Fatalf("unexpected notifier result: %+v", got)
+	}
+
+	r.Readiness("pool", func(context.Context) error { return errors.New("not running") })
+	code, report = serve(t, r.ReadyHandler())
+	if code != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Fatalf("expected failing 503, got %d %+v", code, report)
+	}
+	if report.Checks["store"].Status != StatusOK {
+		t.Fatalf("expected store ok, got %+v", report.Checks["store"])
+	}
+
+	code, report = serve(t, r.LiveHandler())
+	if code != http.StatusOK || report.Status != StatusOK || len(report.Checks) != 0 {
+		t.Fatalf("expected live with no checks, got %d %+v", code, report)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	r := NewRegistry()
+	r.Timeout = 20 * time.Millisecond
+	r.Liveness("stuck", func(context.Context) error { select {} })
+
+	start := time.Now()
+	report := r.Live(context.Background())
+	if time.Since(start) > time.Second {
+		t.Fatal("stuck check was not abandoned")
+	}
+	if got := report.Checks["stuck"]; got.Status != StatusFail || got.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected deadline failure, got %+v", got)
+	}
+}
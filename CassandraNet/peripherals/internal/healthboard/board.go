@@ -0,0 +1,459 @@
+// Package healthboard polls the health endpoints of the peripheral services,
+// keeps a short history of each service's status and latency, and reports
+// status changes to a Notifier.
+package healthboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+)
+
+// StatusUnknown is reported for a target that has not been polled yet. The
+// other statuses are those of internal/health.
+const StatusUnknown = "unknown"
+
+// Target is a service polled by the board.
+type Target struct {
+	Name string
+	URL  *url.URL
+}
+
+// ParseTargets parses "name=url" entries. Names must be unique.
+func ParseTargets(specs []string) ([]Target, error) {
+	targets := make([]Target, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		name, raw, ok := strings.Cut(spec, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("target %q: expected name=url", spec)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("target %q: duplicate name", name)
+		}
+		seen[name] = true
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", name, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("target %q: url must be absolute http or https", name)
+		}
+		targets = append(targets, Target{Name: name, URL: u})
+	}
+	return targets, nil
+}
+
+// Sample is the outcome of one poll.
+type Sample struct {
+	Time      time.Time `json:"time"`
+	Status    string    `json:"status"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// TargetStatus describes one target. Uptime is the share of samples in the
+// history that were ok or degraded.
+type TargetStatus struct {
+	Name         string                   `json:"name"`
+	URL          string                   `json:"url"`
+	Status       string                   `json:"status"`
+	Since        time.Time                `json:"since,omitzero"`
+	LastCheck    time.Time                `json:"last_check,omitzero"`
+	Error        string                   `json:"error,omitempty"`
+	LatencyMS    float64                  `json:"latency_ms"`
+	AvgLatencyMS float64                  `json:"avg_latency_ms"`
+	P95LatencyMS float64                  `json:"p95_latency_ms"`
+	Uptime       float64                  `json:"uptime"`
+	Samples      int                      `json:"samples"`
+	Checks       map[string]health.Result `json:"checks,omitempty"`
+	History      []Sample                 `json:"history,omitempty"`
+}
+
+// Summary is the consolidated status of every target. Status is the worst
+// target status.
+type Summary struct {
+	Status      string         `json:"status"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Targets     []TargetStatus `json:"targets"`
+}
+
+// Change is a confirmed status transition of a target.
+type Change struct {
+	Target   string    `json:"target"`
+	URL      string    `json:"url"`
+	Previous string    `json:"previous"`
+	Current  string    `json:"current"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier receives status changes.
+type Notifier interface {
+	Notify(ctx context.Context, change Change) error
+}
+
+// Config tunes a Board. Zero values select the defaults.
+type Config struct {
+	// Interval between polls (default 15s).
+	Interval time.Duration
+	// Timeout bounds each probe (default 5s).
+	Timeout time.Duration
+	// History is the number of samples kept per target (default 240).
+	History int
+	// Confirm is how many consecutive samples must agree before a status
+	// change is reported (default 2), so one slow probe does not page
+	// anyone.
+	Confirm int
+}
+
+// Board polls targets and keeps their status.
+type Board struct {
+	cfg      Config
+	client   *http.Client
+	notifier Notifier
+	logger   interface {
+		Printf(string, ...any)
+	}
+	now func() time.Time
+
+	mu     sync.RWMutex
+	states []*targetState
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+type targetState struct {
+	target    Target
+	status    string
+	since     time.Time
+	checks    map[string]health.Result
+	history   []Sample // ring buffer, next holds the oldest once full
+	next      int
+	pending   string
+	pendingN  int
+	lastError string
+}
+
+// New returns a board for targets. transport may be nil, and notifier may be
+// nil to disable notifications.
+func New(targets []Target, cfg Config, transport http.RoundTripper, notifier Notifier, logger interface {
+	Printf(string, ...any)
+}) *Board {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.History <= 0 {
+		cfg.History = 240
+	}
+	if cfg.Confirm <= 0 {
+		cfg.Confirm = 2
+	}
+	b := &Board{
+		cfg:      cfg,
+		client:   &http.Client{Transport: transport},
+		notifier: notifier,
+		logger:   logger,
+		now:      time.Now,
+	}
+	for _, t := range targets {
+		b.states = append(b.states, &targetState{target: t, status: StatusUnknown})
+	}
+	return b
+}
+
+// Interval returns the polling interval.
+func (b *Board) Interval() time.Duration { return b.cfg.Interval }
+
+// Start polls immediately and then every Interval until Stop is called.
+func (b *Board) Start() {
+	b.startOnce.Do(func() {
+		b.stop = make(chan struct{})
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				<-b.stop
+				cancel()
+			}()
+			ticker := time.NewTicker(b.cfg.Interval)
+			defer ticker.Stop()
+			for {
+				b.Poll(ctx)
+				select {
+				case <-b.stop:
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	})
+}
+
+// Stop halts polling and waits for an in-flight poll to finish.
+func (b *Board) Stop() {
+	b.stopOnce.Do(func() {
+		if b.stop == nil {
+			return
+		}
+		close(b.stop)
+		b.wg.Wait()
+	})
+}
+
+// Poll probes every target concurrently, records the samples, and sends
+// notifications for confirmed changes.
+func (b *Board) Poll(ctx context.Context) {
+	b.mu.RLock()
+	states := append([]*targetState(nil), b.states...)
+	b.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, st := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sample, checks := b.probe(ctx, st.target)
+			if ctx.Err() != nil {
+				return
+			}
+			if change, ok := b.record(st, sample, checks); ok {
+				b.notify(ctx, change)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// probe asks the target's /readyz, falling back to /healthz for services
+// that predate it.
+func (b *Board) probe(ctx context.Context, target Target) (Sample, map[string]health.Result) {
+	ctx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+	defer cancel()
+	start := b.now()
+	sample := Sample{Time: start}
+	finish := func(status, errText string) {
+		sample.Status, sample.Error = status, errText
+		sample.LatencyMS = float64(b.now().Sub(start).Microseconds()) / 1000
+	}
+
+	code, body, err := b.get(ctx, target.URL.JoinPath("/readyz").String())
+	if err == nil && code == http.StatusNotFound {
+		code, body, err = b.get(ctx, target.URL.JoinPath("/healthz").String())
+		if err == nil && code == http.StatusOK {
+			finish(health.StatusOK, "")
+			return sample, nil
+		}
+	}
+	if err != nil {
+		finish(health.StatusFail, err.Error())
+		return sample, nil
+	}
+	var report health.Report
+	if json.Unmarshal(body, &report) != nil || report.Status == "" {
+		if code == http.StatusOK {
+			finish(health.StatusOK, "")
+		} else {
+			finish(health.StatusFail, "unexpected status "+statusText(code))
+		}
+		return sample, nil
+	}
+	switch {
+	case code == http.StatusOK && report.Status == health.StatusDegraded:
+		finish(health.StatusDegraded, failingChecks(report))
+	case code == http.StatusOK:
+		finish(health.StatusOK, "")
+	default:
+		finish(health.StatusFail, failingChecks(report))
+	}
+	return sample, report.Checks
+}
+
+func (b *Board) get(ctx context.Context, target string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, body, err
+}
+
+func failingChecks(report health.Report) string {
+	var parts []string
+	for name, res := range report.Checks {
+		if res.Status == health.StatusOK {
+			continue
+		}
+		part := name + ": " + res.Status
+		if res.Error != "" {
+			part = name + ": " + res.Error
+		}
+		parts = append(parts, part)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+func statusText(code int) string {
+	return fmt.Sprintf("%d %s", code, http.StatusText(code))
+}
+
+// record appends sample to the target's history and reports a change once
+// Confirm consecutive samples agree on a new status. Leaving the unknown
+// status for ok is not reported.
+func (b *Board) record(st *targetState, sample Sample, checks map[string]health.Result) (Change, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(st.history) < b.cfg.History {
+		st.history = append(st.history, sample)
+	} else {
+		st.history[st.next] = sample
+		st.next = (st.next + 1) % b.cfg.History
+	}
+	st.checks = checks
+	st.lastError = sample.Error
+
+	if sample.Status == st.status {
+		st.pending, st.pendingN = "", 0
+		return Change{}, false
+	}
+	if sample.Status != st.pending {
+		st.pending, st.pendingN = sample.Status, 0
+	}
+	st.pendingN++
+	if st.pendingN < b.cfg.Confirm && st.status != StatusUnknown {
+		return Change{}, false
+	}
+	change := Change{
+		Target:   st.target.Name,
+		URL:      st.target.URL.String(),
+		Previous: st.status,
+		Current:  sample.Status,
+		Error:    sample.Error,
+		Time:     sample.Time,
+	}
+	st.status, st.since = sample.Status, sample.Time
+	st.pending, st.pendingN = "", 0
+	return change, !(change.Previous == StatusUnknown && change.Current == health.StatusOK)
+}
+
+func (b *Board) notify(ctx context.Context, change Change) {
+	b.logger.Printf("%s is %s (was %s) %s", change.Target, change.Current, change.Previous, change.Error)
+	if b.notifier == nil {
+		return
+	}
+	if err := b.notifier.Notify(ctx, change); err != nil {
+		b.logger.Printf("notify %s status change: %v", change.Target, err)
+	}
+}
+
+// Summary returns the status of every target, in configuration order,
+// without their histories.
+func (b *Board) Summary() Summary {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	summary := Summary{Status: health.StatusOK, GeneratedAt: b.now().UTC()}
+	for _, st := range b.states {
+		ts := st.snapshot(false)
+		summary.Targets = append(summary.Targets, ts)
+		if rank(ts.Status) > rank(summary.Status) {
+			summary.Status = ts.Status
+		}
+	}
+	return summary
+}
+
+// Target returns one target's status including its history, oldest first.
+func (b *Board) Target(name string) (TargetStatus, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, st := range b.states {
+		if st.target.Name == name {
+			return st.snapshot(true), true
+		}
+	}
+	return TargetStatus{}, false
+}
+
+func rank(status string) int {
+	switch status {
+	case health.StatusOK:
+		return 0
+	case StatusUnknown:
+		return 1
+	case health.StatusDegraded:
+		return 2
+	}
+	return 3
+}
+
+// snapshot must be called with the board's lock held.
+func (st *targetState) snapshot(withHistory bool) TargetStatus {
+	ts := TargetStatus{
+		Name:    st.target.Name,
+		URL:     st.target.URL.String(),
+		Status:  st.status,
+		Since:   st.since,
+		Error:   st.lastError,
+		Samples: len(st.history),
+		Checks:  st.checks,
+	}
+	history := st.ordered()
+	if len(history) == 0 {
+		return ts
+	}
+	last := history[len(history)-1]
+	ts.LastCheck, ts.LatencyMS = last.Time, last.LatencyMS
+	latencies := make([]float64, len(history))
+	var up int
+	var total float64
+	for i, s := range history {
+		latencies[i] = s.LatencyMS
+		total += s.LatencyMS
+		if s.Status == health.StatusOK || s.Status == health.StatusDegraded {
+			up++
+		}
+	}
+	sort.Float64s(latencies)
+	ts.AvgLatencyMS = total / float64(len(history))
+	ts.P95LatencyMS = latencies[(len(latencies)*95+99)/100-1]
+	ts.Uptime = float64(up) / float64(len(history))
+	if withHistory {
+		ts.History = history
+	}
+	return ts
+}
+
+func (st *targetState) ordered() []Sample {
+	out := make([]Sample, 0, len(st.history))
+	out = append(out, st.history[st.next:]...)
+	return append(out, st.history[:st.next]...)
+}
@@ -0,0 +1,150 @@
+package healthboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+type recordingNotifier struct {
+	mu      sync.Mutex
+	changes []Change
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, c Change) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.changes = append(n.changes, c)
+	return nil
+}
+
+func readyServer(t *testing.T, failing *atomic.Bool) *httptest.Server {
+	t.Helper()
+	registry := health.NewRegistry()
+	registry.Readiness("store", func(context.Context) error {
+		if failing.Load() {
+			return context.DeadlineExceeded
+		}
+		return nil
+	})
+	registry.Optional("notifier", func(context.Context) error { return nil })
+	mux := http.NewServeMux()
+	mux.Handle("/readyz", registry.ReadyHandler())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestBoardPollsAndReportsChanges(t *testing.T) {
+	var failing atomic.Bool
+	ready := readyServer(t, &failing)
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(legacy.Close)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	targets, err := ParseTargets([]string{"ugc=" + ready.URL, "legacy=" + legacy.URL, "down=" + down.URL})
+	if err != nil {
+		t.Fatalf("parse targets: %v", err)
+	}
+	notifier := &recordingNotifier{}
+	board := New(targets, Config{History: 3}, nil, notifier, noopLogger{})
+	ctx := context.Background()
+
+	board.Poll(ctx)
+	summary := board.Summary()
+	if summary.Status != health.StatusFail {
+		t.Fatalf("expected overall fail, got %s", summary.Status)
+	}
+	got := map[string]string{}
+	for _, ts := range summary.Targets {
+		got[ts.Name] = ts.Status
+	}
+	if got["ugc"] != health.StatusOK || got["legacy"] != health.StatusOK || got["down"] != health.StatusFail {
+		t.Fatalf("unexpected statuses %v", got)
+	}
+	if len(notifier.changes) != 1 || notifier.changes[0].Target != "down" || notifier.changes[0].Previous != StatusUnknown {
+		t.Fatalf("expected only the down target to be reported, got %+v", notifier.changes)
+	}
+
+	failing.Store(true)
+	board.Poll(ctx)
+	if status, _ := board.Target("ugc"); status.Status != health.StatusOK || len(notifier.changes) != 1 {
+		t.Fatalf("expected one failing sample to be unconfirmed, got %s with %d changes", status.Status, len(notifier.changes))
+	}
+	board.Poll(ctx)
+	status, ok := board.Target("ugc")
+	if !ok || status.Status != health.StatusFail || !strings.Contains(status.Error, "store") {
+		t.Fatalf("expected confirmed failure naming the check, got %+v", status)
+	}
+	last := notifier.changes[len(notifier.changes)-1]
+	if last.Target != "ugc" || last.Previous != health.StatusOK || last.Current != health.StatusFail {
+		t.Fatalf("unexpected change %+v", last)
+	}
+	if status.Samples != 3 || len(status.History) != 3 || status.Uptime < 0.33 || status.Uptime > 0.34 {
+		t.Fatalf("unexpected history: samples %d, uptime %f", status.Samples, status.Uptime)
+	}
+	board.Poll(ctx)
+	if status, _ := board.Target("ugc"); status.Samples != 3 || status.Uptime != 0 || status.History[2].Status != health.StatusFail {
+		t.Fatalf("expected history capped at 3 with the oldest dropped, got %+v", status.History)
+	}
+}
+
+func TestBoardHandler(t *testing.T) {
+	var failing atomic.Bool
+	ready := readyServer(t, &failing)
+	targets, _ := ParseTargets([]string{"ugc=" + ready.URL})
+	board := New(targets, Config{}, nil, nil, noopLogger{})
+	board.Poll(context.Background())
+	handler := board.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var summary Summary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil || summary.Status != health.StatusOK || len(summary.Targets) != 1 {
+		t.Fatalf("unexpected summary %d %s", rec.Code, rec.Body.String())
+	}
+	if summary.Targets[0].History != nil || summary.Targets[0].Checks["store"].Status != health.StatusOK {
+		t.Fatalf("expected checks without history, got %+v", summary.Targets[0])
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/ugc", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"history"`) {
+		t.Fatalf("unexpected target response %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown target, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<td class="status ok">ok</td>`) {
+		t.Fatalf("unexpected page %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, bad := range []string{"ugc", "=http://x", "a=ftp://x", "a=http://x,a=http://y"} {
+		if _, err := ParseTargets(strings.Split(bad, ",")); err == nil {
+			t.Errorf("ParseTargets(%q): expected error", bad)
+		}
+	}
+}
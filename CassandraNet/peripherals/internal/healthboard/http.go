@@ -0,0 +1,119 @@
+package healthboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Problem codes returned by the health board API.
+const codeNotFound = "healthboard.not_found"
+
+const statusPathPrefix = "/status/"
+
+// Handler serves the status page at /, the consolidated status at /status,
+// and one target with its history at /status/{name}.
+func (b *Board) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/", b.handlePage)
+	mux.HandleFunc("/status", b.handleStatus)
+	mux.HandleFunc(statusPathPrefix, b.handleTarget)
+	return mux
+}
+
+func (b *Board) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, "healthboard", http.MethodGet, http.MethodHead)
+		return
+	}
+	writeJSON(w, http.StatusOK, b.Summary())
+}
+
+func (b *Board) handleTarget(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, "healthboard", http.MethodGet, http.MethodHead)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, statusPathPrefix)
+	status, ok := b.Target(name)
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "no target named "+name)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (b *Board) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "no such page")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, "healthboard", http.MethodGet, http.MethodHead)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = pageTemplate.Execute(w, struct {
+		Summary
+		Refresh int
+	}{b.Summary(), int(math.Ceil(b.cfg.Interval.Seconds()))})
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+var pageTemplate = template.Must(template.New("page").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.2f%%", v*100) },
+	"ms":      func(v float64) string { return fmt.Sprintf("%.1f ms", v) },
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>CassandraNet health: {{.Status}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2rem; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .4rem .8rem; border-bottom: 1px solid #ddd; }
+.status { font-weight: bold; text-transform: uppercase; }
+.ok { color: #1a7f37; } .degraded { color: #9a6700; } .fail { color: #cf222e; } .unknown { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>CassandraNet health: <span class="status {{.Status}}">{{.Status}}</span></h1>
+<table>
+<tr><th>Service</th><th>Status</th><th>Since</th><th>Uptime</th><th>Latency</th><th>p95</th><th>Last check</th><th>Error</th></tr>
+{{range .Targets}}<tr>
+<td><a href="status/{{.Name}}">{{.Name}}</a></td>
+<td class="status {{.Status}}">{{.Status}}</td>
+<td>{{ago .Since}}</td>
+<td>{{if .Samples}}{{percent .Uptime}}{{else}}-{{end}}</td>
+<td>{{if .Samples}}{{ms .LatencyMS}}{{else}}-{{end}}</td>
+<td>{{if .Samples}}{{ms .P95LatencyMS}}{{else}}-{{end}}</td>
+<td>{{ago .LastCheck}}</td>
+<td>{{.Error}}</td>
+</tr>{{end}}
+</table>
+<p>Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}. <a href="status">JSON</a></p>
+</body>
+</html>
+`))
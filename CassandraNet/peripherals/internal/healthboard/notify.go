@@ -0,0 +1,22 @@
+package healthboard
+
+import (
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notifyclient"
+)
+
+// NewNotificationClient returns a client sending status changes to the
+// notification service at baseURL through transport, delivered to
+// recipient over channel with the service_health template.
+func NewNotificationClient(baseURL, channel, recipient string, transport http.RoundTripper) (*notifyclient.Client[Change], error) {
+	return notifyclient.New(baseURL, transport, func(change Change) notifyclient.Notification {
+		return notifyclient.Notification{Channel: channel, Recipient: recipient, Template: "service_health", Data: map[string]any{
+			"Service":  change.Target,
+			"URL":      change.URL,
+			"State":    change.Current,
+			"Previous": change.Previous,
+			"Error":    change.Error,
+		}}
+	})
+}
@@ -0,0 +1,101 @@
+// Package httpclient builds the HTTP transport services use to call each
+// other, presenting a client certificate for mutual TLS, trusting a
+// private CA, and passing on the caller's request ID.
+package httpclient
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+)
+
+// Config describes the TLS settings for outgoing calls.
+type Config struct {
+	// CAFile holds PEM CAs trusted for server certificates; empty uses the
+	// system roots.
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to servers
+	// that request one. They are reloaded when they change.
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name verified in server certificates, for
+	// example when services are addressed by IP or Unix socket.
+	ServerName string
+	// ReloadInterval is how often the client certificate is checked for
+	// changes (default 30s).
+	ReloadInterval time.Duration
+}
+
+// FromConfig reads CLIENT_TLS_CA_FILE, CLIENT_TLS_CERT_FILE,
+// CLIENT_TLS_KEY_FILE, CLIENT_TLS_SERVER_NAME, and TLS_RELOAD_INTERVAL from
+// loader.
+func FromConfig(loader config.Loader) Config {
+	return Config{
+		CAFile:         loader.String("CLIENT_TLS_CA_FILE", ""),
+		CertFile:       loader.String("CLIENT_TLS_CERT_FILE", ""),
+		KeyFile:        loader.String("CLIENT_TLS_KEY_FILE", ""),
+		ServerName:     loader.String("CLIENT_TLS_SERVER_NAME", ""),
+		ReloadInterval: loader.Duration("TLS_RELOAD_INTERVAL", 30*time.Second),
+	}
+}
+
+// Transport is an http.RoundTripper configured from a Config. Requests
+// whose context carries a request ID send it in X-Request-ID (see
+// logging.Transport).
+type Transport struct {
+	base     *http.Transport
+	next     http.RoundTripper
+	reloader *server.CertReloader
+}
+
+// New builds a transport for cfg. Without any settings it behaves like
+// http.DefaultTransport. Call Close when done to stop certificate reloads.
+func New(cfg Config, logger interface {
+	Printf(string, ...any)
+}) (*Transport, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	t := &Transport{base: base, next: logging.Transport(base)}
+	if cfg.CAFile == "" && cfg.CertFile == "" && cfg.KeyFile == "" && cfg.ServerName == "" {
+		return t, nil
+	}
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: cfg.ServerName}
+	if cfg.CAFile != "" {
+		pool, err := server.LoadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("httpclient: a client certificate needs both a certificate and a key file")
+		}
+		reloader, err := server.NewCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+		if err != nil {
+			return nil, err
+		}
+		reloader.Start(cfg.ReloadInterval)
+		tlsCfg.GetClientCertificate = reloader.GetClientCertificate
+		t.reloader = reloader
+	}
+	base.TLSClientConfig = tlsCfg
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(r)
+}
+
+// Close stops certificate reloads and closes idle connections.
+func (t *Transport) Close() {
+	if t.reloader != nil {
+		t.reloader.Stop()
+	}
+	t.base.CloseIdleConnections()
+}
@@ -0,0 +1,120 @@
+// Package id generates the identifiers services assign to the records they
+// create. Each is a ULID: 48 bits of millisecond timestamp followed by 80
+// random bits, written as 26 characters of Crockford base32, so IDs sort in
+// the order they were made in stores, logs, and listings. A short prefix
+// names the kind of record, such as "msg_01JQ3…", and leaves the order of
+// IDs of one kind unchanged.
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefixes of the records services create.
+const (
+	PrefixMessage      = "msg_"
+	PrefixAssignment   = "asg_"
+	PrefixNotification = "ntf_"
+	PrefixRun          = "run_"
+	PrefixSession      = "ses_"
+	PrefixSilence      = "sil_"
+	PrefixEvent        = "evt_"
+)
+
+// Length is the length of an ID without its prefix.
+const Length = 26
+
+// alphabet is Crockford's base32, which leaves out I, L, O, and U.
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generator makes IDs that increase even when several share a millisecond
+// or the clock steps back: such an ID reuses the last timestamp and adds one
+// to the last random bits.
+type generator struct {
+	mu     sync.Mutex
+	now    func() time.Time
+	ms     uint64
+	hi     uint16 // top 16 of the 80 random bits
+	lo     uint64
+	random func([]byte)
+}
+
+var std = &generator{now: time.Now, random: func(b []byte) { _, _ = rand.Read(b) }}
+
+// New returns a new ID preceded by prefix, which may be empty.
+func New(prefix string) string {
+	return std.next(prefix)
+}
+
+func (g *generator) next(prefix string) string {
+	g.mu.Lock()
+	ms := uint64(g.now().UnixMilli())
+	if ms > g.ms {
+		g.ms = ms
+		g.reseed()
+	} else {
+		g.lo++
+		if g.lo == 0 {
+			g.hi++
+			if g.hi == 0 {
+				// The random bits ran out within one millisecond.
+				g.ms++
+				g.reseed()
+			}
+		}
+	}
+	hi := g.ms<<16 | uint64(g.hi)
+	lo := g.lo
+	g.mu.Unlock()
+	return prefix + encode(hi, lo)
+}
+
+func (g *generator) reseed() {
+	var b [10]byte
+	g.random(b[:])
+	g.hi = binary.BigEndian.Uint16(b[:2])
+	g.lo = binary.BigEndian.Uint64(b[2:])
+}
+
+// encode writes the 128 bits hi:lo as 26 base32 characters, the first of
+// which carries only three bits.
+func encode(hi, lo uint64) string {
+	var out [Length]byte
+	for i := range out {
+		shift := uint(5 * (Length - 1 - i))
+		var v uint64
+		switch {
+		case shift >= 64:
+			v = hi >> (shift - 64)
+		case shift == 0:
+			v = lo
+		default:
+			v = lo>>shift | hi<<(64-shift)
+		}
+		out[i] = alphabet[v&31]
+	}
+	return string(out[:])
+}
+
+// Time returns when id was made, reading the timestamp from its last
+// Length characters, and false if those are not a ULID.
+func Time(id string) (time.Time, bool) {
+	if len(id) < Length {
+		return time.Time{}, false
+	}
+	var ms uint64
+	for i, c := range id[len(id)-Length:] {
+		v := strings.IndexRune(alphabet, c)
+		if v < 0 || (i == 0 && v > 7) {
+			return time.Time{}, false
+		}
+		if i < 10 {
+			ms = ms<<5 | uint64(v)
+		}
+	}
+	return time.UnixMilli(int64(ms)).UTC(), true
+}
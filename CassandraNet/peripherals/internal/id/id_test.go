@@ -0,0 +1,58 @@
+package id
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDsSortInOrderMade(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	seed := byte(0xff)
+	g := &generator{now: func() time.Time { return now }, random: func(b []byte) {
+		for i := range b {
+			b[i] = seed
+		}
+	}}
+
+	var ids []string
+	for _, step := range []time.Duration{0, 0, 0, time.Millisecond, -time.Second, time.Hour} {
+		now = now.Add(step)
+		ids = append(ids, g.next(PrefixMessage))
+		// Later milliseconds draw smaller random bits, which must not
+		// reorder them.
+		seed = 0
+	}
+	for i, s := range ids {
+		if !strings.HasPrefix(s, PrefixMessage) || len(s) != len(PrefixMessage)+Length {
+			t.Fatalf("malformed ID %q", s)
+		}
+		if i > 0 && s <= ids[i-1] {
+			t.Fatalf("expected %q after %q", s, ids[i-1])
+		}
+	}
+	// Every random bit was set, so the second ID within the millisecond
+	// carried into the timestamp.
+	if made, ok := Time(ids[1]); !ok || !made.Equal(time.Date(2026, 3, 1, 12, 0, 0, int(time.Millisecond), time.UTC)) {
+		t.Fatalf("expected the overflow to take the next millisecond, got %v %v", made, ok)
+	}
+	if made, ok := Time(ids[5]); !ok || !made.Equal(now) {
+		t.Fatalf("expected %v, got %v %v", now, made, ok)
+	}
+}
+
+func TestTime(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	made, ok := Time(New(""))
+	if !ok || made.Before(before) || made.After(time.Now()) {
+		t.Fatalf("expected the current time, got %v %v", made, ok)
+	}
+	for _, s := range []string{"", "msg_", "8ZZZZZZZZZZZZZZZZZZZZZZZZZ", "01JQ3V5N8UAAAAAAAAAAAAAAAA"} {
+		if _, ok := Time(s); ok {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+	if made, ok := Time("asg_00000000100000000000000000"); !ok || made.UnixMilli() != 32 {
+		t.Fatalf("expected 32ms after the epoch, got %v %v", made, ok)
+	}
+}
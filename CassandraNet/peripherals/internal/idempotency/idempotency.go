@@ -0,0 +1,416 @@
+// Package idempotency makes retried writes safe. A POST carrying an
+// Idempotency-Key header is handled once; the response's status, headers,
+// and body are kept on a storage driver for a configurable window, and a
+// retry with the same key gets the kept response instead of running the
+// handler again:
+//
+//	cache := idempotency.New(db, idempotency.FromConfig(loader))
+//	mux.Handle("/", authn.Require(limiter.Middleware(cache.Middleware(svc.Handler()))))
+//
+// Keys are scoped to the caller's tenant and the request's method and
+// path, so two tenants, or two endpoints, never share a key. A retry whose
+// body differs from the first request's is refused, as is a retry that
+// arrives while the first request is still running. With a keyring
+// (SetKeyring) kept bodies are sealed at rest.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Header names the request header carrying the key, and ReplayedHeader
+// marks responses served from the cache.
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// MaxKeyLength bounds the length of a key.
+const MaxKeyLength = 255
+
+// Problem codes returned by Middleware.
+const (
+	CodeInvalidKey = "server.idempotency_key_invalid"
+	CodeKeyReused  = "server.idempotency_key_reused"
+	CodeInProgress = "server.idempotency_in_progress"
+)
+
+// responsesBucket holds one record per scoped key, named by the key's
+// SHA-256 so records stay short whatever the tenant, path, and key.
+const responsesBucket = "idempotency.responses"
+
+// lease is how long a claim on a key lasts while its first request runs.
+// A claim outliving its request, because the process died, expires after
+// it rather than blocking the key for the whole window.
+const lease = time.Minute
+
+// sweepEvery is how many claims pass between removals of expired records.
+const sweepEvery = 256
+
+// Config configures a Cache.
+type Config struct {
+	// TTL is how long a response is replayed for retries; zero disables
+	// the middleware.
+	TTL time.Duration
+	// MaxBodyBytes caps the responses kept; zero keeps any size. Larger
+	// responses are sent but not kept, so a retry runs the handler again.
+	MaxBodyBytes int
+}
+
+// FromConfig reads IDEMPOTENCY_TTL (default 24h, 0 disables) and
+// IDEMPOTENCY_MAX_BODY_BYTES (default 1 MiB) from loader.
+func FromConfig(loader config.Loader) Config {
+	return Config{
+		TTL:          loader.Duration("IDEMPOTENCY_TTL", 24*time.Hour),
+		MaxBodyBytes: loader.Int("IDEMPOTENCY_MAX_BODY_BYTES", 1<<20),
+	}
+}
+
+// record is the stored state of a key: a claim while Pending, then the
+// response.
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Expires     time.Time   `json:"expires"`
+	Pending     bool        `json:"pending,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	// SealedBody holds the body in place of Body when the cache has a
+	// keyring.
+	SealedBody []byte `json:"sealed_body,omitempty"`
+}
+
+// Cache keeps responses to keyed requests.
+type Cache struct {
+	db     storage.Driver
+	cfg    Config
+	now    func() time.Time
+	claims atomic.Uint64
+	keys   *encryption.Keyring
+}
+
+// New returns a cache keeping responses in db. Services sharing a driver
+// between replicas share their keys; a nil db keeps them in memory.
+func New(db storage.Driver, cfg Config) *Cache {
+	if db == nil {
+		db = storage.NewMemory()
+	}
+	return &Cache{db: db, cfg: cfg, now: time.Now}
+}
+
+// SetKeyring seals kept response bodies with k. Records are not re-sealed
+// by rotation; they expire within the TTL, so a retired key must stay
+// available that long. Call it before the cache is used.
+func (c *Cache) SetKeyring(k *encryption.Keyring) {
+	c.keys = k
+}
+
+// Enabled reports whether Middleware caches anything.
+func (c *Cache) Enabled() bool {
+	return c.cfg.TTL > 0
+}
+
+// Middleware handles keyed POST requests once per key, replaying the kept
+// response to retries with ReplayedHeader set. Requests without the header,
+// and other methods, pass straight through. Responses that a retry might
+// change are not kept: authentication and permission failures, 408, 409,
+// 429, and server errors. It must run after auth.Authenticator.Require to
+// scope keys by the caller's tenant. When the store fails the request is
+// let through and the error logged. A disabled Cache returns next
+// unchanged.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	if !c.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(Header)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validKey(key) {
+			problem.Write(w, r, http.StatusBadRequest, CodeInvalidKey, Header+" must be 1 to 255 printable ASCII characters")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			problem.DecodeFailed(w, r, "server.invalid_body", "read request body: "+err.Error(), err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		id := scopedKey(r, key)
+
+		ctx := context.WithoutCancel(r.Context())
+		kept, claimed, err := c.claim(ctx, id, fingerprint)
+		if err != nil {
+			c.warn(r, "idempotency store failed; handling request without it", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch {
+		case !claimed && kept.Fingerprint != fingerprint:
+			problem.Write(w, r, http.StatusUnprocessableEntity, CodeKeyReused, Header+" was already used with a different request body")
+		case !claimed && kept.Pending:
+			w.Header().Set("Retry-After", "1")
+			problem.Write(w, r, http.StatusConflict, CodeInProgress, "a request with this "+Header+" is still being handled")
+		case !claimed:
+			replay(w, kept)
+		default:
+			c.serve(ctx, w, r, next, id, fingerprint)
+		}
+	})
+}
+
+// serve runs next for the request holding the claim on id and keeps its
+// response, or releases the claim when the response is not kept or next
+// panics.
+func (c *Cache) serve(ctx context.Context, w http.ResponseWriter, r *http.Request, next http.Handler, id, fingerprint string) {
+	before := w.Header().Clone()
+	rec := &recorder{ResponseWriter: w, limit: c.cfg.MaxBodyBytes}
+	kept := false
+	defer func() {
+		if !kept {
+			if err := c.release(ctx, id); err != nil {
+				c.warn(r, "idempotency store failed to release key", err)
+			}
+		}
+	}()
+	next.ServeHTTP(rec, r)
+
+	status := rec.Status()
+	if rec.overflow || !cacheable(status) {
+		return
+	}
+	header := http.Header{}
+	for name, values := range w.Header() {
+		if !slices.Equal(before[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	err := c.put(ctx, id, record{
+		Fingerprint: fingerprint,
+		Expires:     c.now().Add(c.cfg.TTL),
+		Status:      status,
+		Header:      header,
+		Body:        rec.body.Bytes(),
+	})
+	if err != nil {
+		c.warn(r, "idempotency store failed to keep response", err)
+		return
+	}
+	kept = true
+}
+
+// claim returns the live record for id, or stores a pending one and
+// reports true when there is none.
+func (c *Cache) claim(ctx context.Context, id, fingerprint string) (record, bool, error) {
+	if c.claims.Add(1)%sweepEvery == 0 {
+		if err := c.sweep(ctx); err != nil {
+			return record{}, false, err
+		}
+	}
+	var kept record
+	claimed := false
+	err := storage.Update(ctx, c.db, func(tx storage.Tx) error {
+		now := c.now()
+		kept = record{}
+		data, err := tx.Get(responsesBucket, id)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(data, &kept); err != nil {
+				return err
+			}
+			if now.Before(kept.Expires) {
+				return nil
+			}
+		}
+		kept, claimed = record{Fingerprint: fingerprint, Expires: now.Add(lease), Pending: true}, true
+		data, err = json.Marshal(kept)
+		if err != nil {
+			return err
+		}
+		return tx.Put(responsesBucket, id, data)
+	})
+	if err == nil && !claimed && kept.SealedBody != nil {
+		kept.Body, err = c.keys.Open(ctx, kept.SealedBody)
+	}
+	return kept, claimed, err
+}
+
+func (c *Cache) put(ctx context.Context, id string, rec record) error {
+	if c.keys.Enabled() {
+		sealed, err := c.keys.Seal(ctx, rec.Body)
+		if err != nil {
+			return err
+		}
+		rec.Body, rec.SealedBody = nil, sealed
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return storage.Update(ctx, c.db, func(tx storage.Tx) error {
+		return tx.Put(responsesBucket, id, data)
+	})
+}
+
+func (c *Cache) release(ctx context.Context, id string) error {
+	return storage.Update(ctx, c.db, func(tx storage.Tx) error {
+		return tx.Delete(responsesBucket, id)
+	})
+}
+
+// sweep removes expired records; they are indistinguishable from missing
+// ones.
+func (c *Cache) sweep(ctx context.Context) error {
+	return storage.Update(ctx, c.db, func(tx storage.Tx) error {
+		now := c.now()
+		var expired []string
+		err := tx.Scan(responsesBucket, "", func(key string, value []byte) error {
+			var rec record
+			if err := json.Unmarshal(value, &rec); err != nil || !now.Before(rec.Expires) {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range expired {
+			if err := tx.Delete(responsesBucket, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (c *Cache) warn(r *http.Request, msg string, err error) {
+	if logger, ok := logging.FromContext(r.Context()); ok {
+		logger.Warn(msg, "err", err)
+	}
+}
+
+// scopedKey names key within the caller's tenant and the request's route.
+// Callers without a tenant share one scope, so their keys should be
+// random, such as UUIDs.
+func scopedKey(r *http.Request, key string) string {
+	tenant := logging.TenantID(r.Context())
+	if p, ok := auth.FromContext(r.Context()); ok && p.Tenant != "" {
+		tenant = p.Tenant
+	}
+	sum := sha256.Sum256([]byte(tenant + "\n" + r.Method + " " + r.URL.Path + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+func validKey(key string) bool {
+	if len(key) > MaxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheable reports whether a response with status is replayed to
+// retries rather than letting them run again.
+func cacheable(status int) bool {
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout,
+		http.StatusConflict, http.StatusTooManyRequests:
+		return false
+	}
+	return status < http.StatusInternalServerError
+}
+
+func replay(w http.ResponseWriter, rec record) {
+	for name, values := range rec.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	w.Write(rec.Body)
+}
+
+// recorder passes a response through while keeping a copy of it, up to
+// limit bytes of body when limit is positive.
+type recorder struct {
+	http.ResponseWriter
+	limit       int
+	status      int
+	body        bytes.Buffer
+	overflow    bool
+	wroteHeader bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if !r.overflow {
+		if r.limit > 0 && r.body.Len()+len(p) > r.limit {
+			r.overflow = true
+			r.body = bytes.Buffer{}
+		} else {
+			r.body.Write(p)
+		}
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Status returns the response status, defaulting to 200 when the handler
+// wrote nothing.
+func (r *recorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if !r.wroteHeader {
+			r.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *recorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,115 @@
+package idempotency
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+)
+
+// counter answers each POST with the number of times it has run, failing
+// with status when the body is "fail".
+type counter struct {
+	calls   int
+	status  int
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (h *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if h.block != nil {
+		close(h.started)
+		<-h.block
+	}
+	body, _ := io.ReadAll(r.Body)
+	if string(body) == "fail" {
+		w.WriteHeader(h.status)
+		return
+	}
+	w.Header().Set("Location", "/items/"+strconv.Itoa(h.calls))
+	w.WriteHeader(http.StatusCreated)
+	io.WriteString(w, strconv.Itoa(h.calls))
+}
+
+func post(h http.Handler, tenant, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	if tenant != "" {
+		req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{Subject: tenant, Tenant: tenant}))
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRetriesReplayTheFirstResponse(t *testing.T) {
+	next := &counter{}
+	h := New(nil, Config{TTL: time.Hour}).Middleware(next)
+
+	first := post(h, "acme", "k-1", "item")
+	retry := post(h, "acme", "k-1", "item")
+	if next.calls != 1 || retry.Code != http.StatusCreated || retry.Body.String() != "1" ||
+		retry.Header().Get("Location") != "/items/1" || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("expected the retry to replay %d %q, got %d %q (%d calls)", first.Code, first.Body, retry.Code, retry.Body, next.calls)
+	}
+	if rec := post(h, "globex", "k-1", "item"); rec.Body.String() != "2" {
+		t.Fatalf("expected another tenant's key to run the handler, got %q", rec.Body)
+	}
+	if rec := post(h, "acme", "", "item"); rec.Body.String() != "3" {
+		t.Fatalf("expected an unkeyed request to run the handler, got %q", rec.Body)
+	}
+	if rec := post(h, "acme", "k-1", "other"); rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), CodeKeyReused) {
+		t.Fatalf("expected a reused key to be refused, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := post(h, "acme", strings.Repeat("k", MaxKeyLength+1), "item"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected an overlong key to be refused, got %d", rec.Code)
+	}
+}
+
+func TestFailuresAndExpiredKeysRunAgain(t *testing.T) {
+	next := &counter{status: http.StatusServiceUnavailable}
+	cache := New(nil, Config{TTL: time.Hour})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	h := cache.Middleware(next)
+
+	post(h, "acme", "k-1", "fail")
+	if rec := post(h, "acme", "k-1", "fail"); next.calls != 2 || rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected a server error not to be kept, got %d after %d calls", rec.Code, next.calls)
+	}
+	next.status = http.StatusBadRequest
+	post(h, "acme", "k-2", "fail")
+	if post(h, "acme", "k-2", "fail"); next.calls != 3 {
+		t.Fatalf("expected a client error to be kept, got %d calls", next.calls)
+	}
+
+	post(h, "acme", "k-3", "item")
+	now = now.Add(2 * time.Hour)
+	if rec := post(h, "acme", "k-3", "item"); next.calls != 5 || rec.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("expected an expired key to run the handler, got %d calls", next.calls)
+	}
+}
+
+func TestConcurrentRetryIsRefused(t *testing.T) {
+	next := &counter{started: make(chan struct{}), block: make(chan struct{})}
+	h := New(nil, Config{TTL: time.Hour}).Middleware(next)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- post(h, "acme", "k-1", "item") }()
+	<-next.started
+	if rec := post(h, "acme", "k-1", "item"); rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a retry during the first request to be refused, got %d", rec.Code)
+	}
+	close(next.block)
+	if rec := <-done; rec.Code != http.StatusCreated {
+		t.Fatalf("first request: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,119 @@
+// Package lock provides leased named locks, so that when several replicas
+// of a service share storage only one of them does each piece of
+// background work, such as firing scheduled jobs or purging expired
+// records:
+//
+//	locker, err := lock.FromConfig(loader)
+//	defer locker.Close()
+//	svc.SetLocker(locker)
+//
+// A loop holding a Lease renews it each time it asks whether it holds it,
+// and a replica that stops renewing, or exits, loses it to the next one
+// that asks once it lapses. Leases do not fence: work that must never run
+// twice still guards itself, as the stores' transactions do.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// Locker hands out named locks to owners for a limited time.
+type Locker interface {
+	// Acquire takes name for owner until ttl from now, or extends owner's
+	// hold on it, reporting false when another owner holds it.
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// Release gives up owner's hold on name. Releasing a lock owner does
+	// not hold does nothing.
+	Release(ctx context.Context, name, owner string) error
+	// Close releases the locker's connections. Locks still held lapse.
+	Close() error
+}
+
+// Open returns the locker for rawURL: memory:// or file:// (or empty)
+// locks within this process, redis:// or rediss:// locks with keys that
+// expire, and postgres:// with advisory locks.
+func Open(rawURL string) (Locker, error) {
+	if rawURL == "" {
+		return NewMemory(nil), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "memory", "file":
+		return NewMemory(nil), nil
+	case "redis", "rediss":
+		return NewRedis(rawURL)
+	case "postgres", "postgresql":
+		return NewPostgres(rawURL)
+	}
+	return nil, fmt.Errorf("unsupported lock scheme %q; use memory, redis, or postgres", u.Scheme)
+}
+
+// FromConfig opens the locker named by LOCK_URL, which defaults to
+// STORAGE_URL so replicas sharing storage share locks too.
+func FromConfig(loader config.Loader) (Locker, error) {
+	l, err := Open(loader.Secret("LOCK_URL", loader.Secret("STORAGE_URL", "memory://")))
+	if err != nil {
+		return nil, fmt.Errorf("%sLOCK_URL: %w", loader.Prefix, err)
+	}
+	return l, nil
+}
+
+// Lease is one replica's claim on a named lock for a background loop.
+type Lease struct {
+	locker Locker
+	name   string
+	owner  string
+	ttl    time.Duration
+}
+
+// NewLease returns a lease on name through l that lasts ttl past each
+// renewal, owned by this process. With a nil l it returns nil, which is
+// always held.
+func NewLease(l Locker, name string, ttl time.Duration) *Lease {
+	if l == nil {
+		return nil
+	}
+	return &Lease{locker: l, name: name, owner: Owner(), ttl: ttl}
+}
+
+// Held acquires or renews the lease and reports whether this process
+// holds it. Callers ask before each round of work and skip the round when
+// it does not.
+func (l *Lease) Held(ctx context.Context) (bool, error) {
+	if l == nil {
+		return true, nil
+	}
+	return l.locker.Acquire(ctx, l.name, l.owner, l.ttl)
+}
+
+// Release gives the lease up so another replica can take it without
+// waiting for it to lapse.
+func (l *Lease) Release(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	return l.locker.Release(ctx, l.name, l.owner)
+}
+
+// Owner returns a name unique to this call, made of the host name and a
+// random suffix, that identifies a lock holder in logs.
+func Owner() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	var suffix [6]byte
+	_, _ = rand.Read(suffix[:])
+	return host + "-" + hex.EncodeToString(suffix[:])
+}
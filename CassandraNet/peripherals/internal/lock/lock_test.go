@@ -0,0 +1,90 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+func TestMemoryLeasesLapse(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := NewMemory(clk)
+	ctx := context.Background()
+	acquire := func(owner string) bool {
+		t.Helper()
+		ok, err := m.Acquire(ctx, "retention", owner, time.Minute)
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		return ok
+	}
+	if !acquire("a") || acquire("b") {
+		t.Fatal("expected a to take the lock and b to be refused")
+	}
+	clk.Advance(50 * time.Second)
+	if !acquire("a") {
+		t.Fatal("expected a to renew its lock")
+	}
+	clk.Advance(50 * time.Second)
+	if acquire("b") {
+		t.Fatal("expected the renewed lock to still be held")
+	}
+	clk.Advance(20 * time.Second)
+	if !acquire("b") || acquire("a") {
+		t.Fatal("expected b to take the lapsed lock")
+	}
+	if err := m.Release(ctx, "retention", "a"); err != nil || acquire("a") {
+		t.Fatalf("expected a release by a non-holder to do nothing, got %v", err)
+	}
+	if err := m.Release(ctx, "retention", "b"); err != nil || !acquire("a") {
+		t.Fatalf("expected the released lock free, got %v", err)
+	}
+}
+
+func TestLeases(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory(nil)
+	first, second := NewLease(m, "scheduler", time.Minute), NewLease(m, "scheduler", time.Minute)
+	if held, err := first.Held(ctx); err != nil || !held {
+		t.Fatalf("expected the first lease held, got %v %v", held, err)
+	}
+	if held, _ := second.Held(ctx); held {
+		t.Fatal("expected the second lease refused")
+	}
+	if err := first.Release(ctx); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if held, _ := second.Held(ctx); !held {
+		t.Fatal("expected the second lease held once the first was released")
+	}
+
+	none := NewLease(nil, "scheduler", time.Minute)
+	if held, err := none.Held(ctx); err != nil || !held || none.Release(ctx) != nil {
+		t.Fatal("expected a lease without a locker always held")
+	}
+}
+
+func TestFromConfigFollowsStorage(t *testing.T) {
+	t.Setenv("LOCKTEST_STORAGE_URL", "redis://localhost:6379/2")
+	l, err := FromConfig(config.NewLoader("LOCKTEST"))
+	if err != nil {
+		t.Fatalf("from config: %v", err)
+	}
+	if _, ok := l.(*Redis); !ok {
+		t.Fatalf("expected a redis locker, got %T", l)
+	}
+	t.Setenv("LOCKTEST_LOCK_URL", "memory://")
+	if l, err = FromConfig(config.NewLoader("LOCKTEST")); err != nil {
+		t.Fatalf("from config: %v", err)
+	}
+	if _, ok := l.(*Memory); !ok {
+		t.Fatalf("expected LOCK_URL to win, got %T", l)
+	}
+	t.Setenv("LOCKTEST_LOCK_URL", "zookeeper://localhost")
+	if _, err := FromConfig(config.NewLoader("LOCKTEST")); err == nil {
+		t.Fatal("expected an unsupported scheme refused")
+	}
+}
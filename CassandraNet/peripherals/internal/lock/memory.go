@@ -0,0 +1,56 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+)
+
+// Memory keeps locks in this process, for single-replica deployments and
+// tests.
+type Memory struct {
+	clock clock.Clock
+
+	mu    sync.Mutex
+	locks map[string]memoryLock
+}
+
+type memoryLock struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory reading the time from clk, or the
+// system clock when clk is nil.
+func NewMemory(clk clock.Clock) *Memory {
+	return &Memory{clock: clock.Or(clk), locks: make(map[string]memoryLock)}
+}
+
+// Acquire implements Locker.
+func (m *Memory) Acquire(_ context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	if held, ok := m.locks[name]; ok && held.owner != owner && now.Before(held.expires) {
+		return false, nil
+	}
+	m.locks[name] = memoryLock{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Release implements Locker.
+func (m *Memory) Release(_ context.Context, name, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locks[name].owner == owner {
+		delete(m.locks, name)
+	}
+	return nil
+}
+
+// Close implements Locker.
+func (m *Memory) Close() error {
+	return nil
+}
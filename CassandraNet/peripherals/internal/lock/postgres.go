@@ -0,0 +1,94 @@
+package lock
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Postgres holds each lock as a session-level advisory lock on a
+// connection of its own. The server releases it when the connection
+// drops, so a lock lasts as long as its holder's connection rather than a
+// ttl; renewing it checks that the connection is still up.
+type Postgres struct {
+	db *storage.Postgres
+
+	mu    sync.Mutex
+	locks map[string]*postgresLock
+}
+
+type postgresLock struct {
+	owner string
+	lock  *storage.AdvisoryLock
+}
+
+// NewPostgres parses a postgres:// URL as storage.NewPostgres does. No
+// connection is made until the first lock.
+func NewPostgres(rawURL string) (*Postgres, error) {
+	db, err := storage.NewPostgres(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Postgres{db: db, locks: make(map[string]*postgresLock)}, nil
+}
+
+// Acquire implements Locker. Owners in this process are told apart here,
+// since the server would let one session take its own lock twice.
+func (p *Postgres) Acquire(ctx context.Context, name, owner string, _ time.Duration) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if held, ok := p.locks[name]; ok {
+		if held.owner != owner {
+			return false, nil
+		}
+		if err := held.lock.Check(ctx); err == nil {
+			return true, nil
+		}
+		// The connection dropped and the server released the lock, so
+		// take it again if it is still free.
+		_ = held.lock.Unlock(ctx)
+		delete(p.locks, name)
+	}
+	lock, err := p.db.TryAdvisoryLock(ctx, advisoryKey(name))
+	if err != nil || lock == nil {
+		return false, err
+	}
+	p.locks[name] = &postgresLock{owner: owner, lock: lock}
+	return true, nil
+}
+
+// Release implements Locker.
+func (p *Postgres) Release(ctx context.Context, name, owner string) error {
+	p.mu.Lock()
+	held, ok := p.locks[name]
+	if !ok || held.owner != owner {
+		p.mu.Unlock()
+		return nil
+	}
+	delete(p.locks, name)
+	p.mu.Unlock()
+	return held.lock.Unlock(ctx)
+}
+
+// Close implements Locker, closing the connections of locks still held,
+// which releases them.
+func (p *Postgres) Close() error {
+	p.mu.Lock()
+	locks := p.locks
+	p.locks = make(map[string]*postgresLock)
+	p.mu.Unlock()
+	for _, held := range locks {
+		_ = held.lock.Unlock(context.Background())
+	}
+	return p.db.Close()
+}
+
+// advisoryKey maps a lock name to the 64-bit key Postgres locks.
+func advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(redisKeyPrefix + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,106 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/redisclient"
+)
+
+// redisKeyPrefix namespaces lock keys in a shared Redis.
+const redisKeyPrefix = "cassandra:lock:"
+
+// errUnexpectedReply reports a script reply that is not a count.
+var errUnexpectedReply = errors.New("lock: unexpected reply from redis")
+
+// Scripts comparing the holder before changing a lock, so an owner whose
+// lock lapsed and was taken cannot extend or delete its successor's.
+const (
+	acquireScript = `
+local holder = redis.call('GET', KEYS[1])
+if holder == false or holder == ARGV[1] then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  return 1
+end
+return 0
+`
+	releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+)
+
+var (
+	acquireScriptSHA = scriptSHA(acquireScript)
+	releaseScriptSHA = scriptSHA(releaseScript)
+)
+
+func scriptSHA(script string) string {
+	sum := sha1.Sum([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// Redis keeps each lock in a Redis 5+ key holding its owner, which expires
+// when the lock lapses.
+type Redis struct {
+	client *redisclient.Client
+}
+
+// NewRedis parses a redis:// or rediss:// (TLS) URL of the form
+// redis://[user:password@]host[:port][/db]. No connection is made until the
+// first lock.
+func NewRedis(rawURL string) (*Redis, error) {
+	client, err := redisclient.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+// Acquire implements Locker.
+func (r *Redis) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	ms := max(ttl.Milliseconds(), 1)
+	reply, err := r.eval(ctx, acquireScript, acquireScriptSHA, name, owner, strconv.FormatInt(ms, 10))
+	if err != nil {
+		return false, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, errUnexpectedReply
+	}
+	return n == 1, nil
+}
+
+// Release implements Locker.
+func (r *Redis) Release(ctx context.Context, name, owner string) error {
+	_, err := r.eval(ctx, releaseScript, releaseScriptSHA, name, owner)
+	return err
+}
+
+// Check pings the server.
+func (r *Redis) Check(ctx context.Context) error {
+	return r.client.Check(ctx)
+}
+
+// Close implements Locker.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+func (r *Redis) eval(ctx context.Context, script, sha, name string, args ...string) (any, error) {
+	call := append([]string{sha, "1", redisKeyPrefix + name}, args...)
+	reply, err := r.client.Do(ctx, append([]string{"EVALSHA"}, call...)...)
+	var rerr redisclient.Error
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		call[0] = script
+		reply, err = r.client.Do(ctx, append([]string{"EVAL"}, call...)...)
+	}
+	return reply, err
+}
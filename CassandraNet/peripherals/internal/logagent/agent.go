@@ -0,0 +1,375 @@
+// Package logagent ships a host's logs to the log pipeline: it tails local
+// files and the systemd journal, batches what it reads, and posts the
+// batches to POST /logs/batch, so hosts need no third-party shipper.
+//
+// Batches are spooled before they are sent, on disk when a buffer
+// directory is configured, and read offsets are saved only once the lines
+// they cover are spooled. A restart therefore resumes where the agent
+// left off and resends what was spooled but not yet accepted; delivery is
+// at least once. Failed sends are retried with exponential backoff and
+// jitter. A batch the pipeline finds too large is split in half, and one
+// it refuses as invalid is dropped, so neither blocks the batches behind
+// it.
+package logagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logpipeline"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+// minBackoff is the wait after a batch's first failed send; each further
+// failure doubles it, up to Config.MaxBackoff.
+const minBackoff = 500 * time.Millisecond
+
+// maxMessageBytes bounds a shipped message; longer lines are truncated to
+// stay within what the pipeline accepts.
+const maxMessageBytes = 32 << 10
+
+// Config controls what an Agent reads and how it ships it.
+type Config struct {
+	// Files are the paths tailed. A file that does not exist yet is
+	// picked up once it appears.
+	Files []string
+	// Journald follows the systemd journal through journalctl.
+	Journald bool
+	// Source is recorded on every event, normally the host name.
+	Source string
+	// FromStart reads files the agent has no saved offset for from their
+	// beginning instead of their end.
+	FromStart bool
+	// BatchSize is the most events sent in one request.
+	BatchSize int
+	// FlushInterval is the longest a read line waits for its batch to fill.
+	FlushInterval time.Duration
+	// PollInterval is how often files are checked for new lines.
+	PollInterval time.Duration
+	// BufferDir holds spooled batches and read offsets. Empty keeps both
+	// in memory, so unsent batches are lost at exit and files are read
+	// from their end (or start) again.
+	BufferDir string
+	// BufferMaxBytes bounds the spool; the oldest batches are dropped to
+	// make room.
+	BufferMaxBytes int64
+	// MaxBackoff caps the wait between attempts to send a batch.
+	MaxBackoff time.Duration
+}
+
+// FromConfig reads an agent's settings. At least one of FILES and JOURNALD
+// must be set.
+func FromConfig(loader config.Loader) (Config, error) {
+	host, _ := os.Hostname()
+	cfg := Config{
+		Files:          loader.StringSlice("FILES", nil),
+		Journald:       loader.Bool("JOURNALD", false),
+		Source:         loader.String("SOURCE", host),
+		FromStart:      loader.Bool("FROM_START", false),
+		BatchSize:      loader.Int("BATCH_SIZE", 100),
+		FlushInterval:  loader.Duration("FLUSH_INTERVAL", time.Second),
+		PollInterval:   loader.Duration("POLL_INTERVAL", 250*time.Millisecond),
+		BufferDir:      loader.String("BUFFER_DIR", ""),
+		BufferMaxBytes: int64(loader.Int("BUFFER_MAX_BYTES", 64<<20)),
+		MaxBackoff:     loader.Duration("MAX_BACKOFF", 30*time.Second),
+	}
+	if len(cfg.Files) == 0 && !cfg.Journald {
+		return Config{}, fmt.Errorf("set %sFILES or %sJOURNALD to choose what to ship", loader.Prefix, loader.Prefix)
+	}
+	if cfg.Source == "" {
+		return Config{}, fmt.Errorf("%sSOURCE is required when the host name is unknown", loader.Prefix)
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > logpipeline.MaxBatchEvents {
+		return Config{}, fmt.Errorf("%sBATCH_SIZE must be between 1 and %d", loader.Prefix, logpipeline.MaxBatchEvents)
+	}
+	if cfg.FlushInterval <= 0 || cfg.PollInterval <= 0 || cfg.BufferMaxBytes <= 0 || cfg.MaxBackoff <= 0 {
+		return Config{}, fmt.Errorf("%sFLUSH_INTERVAL, %sPOLL_INTERVAL, %sBUFFER_MAX_BYTES, and %sMAX_BACKOFF must be positive",
+			loader.Prefix, loader.Prefix, loader.Prefix, loader.Prefix)
+	}
+	return cfg, nil
+}
+
+// Stats counts what an Agent has done with the events it read.
+type Stats struct {
+	Shipped uint64 `json:"shipped"`
+	// Dropped counts events the pipeline refused as invalid or that were
+	// evicted from a full spool.
+	Dropped uint64 `json:"dropped"`
+	// Failed counts failed attempts to send a batch.
+	Failed       uint64 `json:"failed"`
+	Spooled      int    `json:"spooled"`
+	SpooledBytes int64  `json:"spooled_bytes"`
+}
+
+// Agent tails its inputs and ships what they read.
+type Agent struct {
+	cfg        Config
+	logs       *client.Logs
+	logger     logging.Printer
+	clock      clock.Clock
+	journalctl string
+
+	spool *spool
+	state *state
+	// wake tells the sender a batch was spooled.
+	wake chan struct{}
+
+	shipped atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// New returns an agent shipping through logs, which should not retry
+// calls itself. Zero fields of cfg take FromConfig's defaults. It loads
+// the spool and offsets left in cfg.BufferDir.
+func New(cfg Config, logs *client.Logs, logger logging.Printer) (*Agent, error) {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 250 * time.Millisecond
+	}
+	if cfg.BufferMaxBytes <= 0 {
+		cfg.BufferMaxBytes = 64 << 20
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 30 * time.Second
+	}
+	a := &Agent{
+		cfg:        cfg,
+		logs:       logs,
+		logger:     logger,
+		clock:      clock.System,
+		journalctl: "journalctl",
+		wake:       make(chan struct{}, 1),
+	}
+	var err error
+	if a.spool, err = openSpool(cfg.BufferDir, cfg.BufferMaxBytes, logger); err != nil {
+		return nil, err
+	}
+	if a.state, err = loadState(cfg.BufferDir); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetClock replaces the clock that stamps events and drives polling,
+// flushing, and backoff. Call it before Run.
+func (a *Agent) SetClock(c clock.Clock) {
+	a.clock = clock.Or(c)
+}
+
+// Stats reports what the agent has shipped, dropped, and still holds.
+func (a *Agent) Stats() Stats {
+	batches, size := a.spool.stats()
+	return Stats{
+		Shipped:      a.shipped.Load(),
+		Dropped:      a.dropped.Load() + a.spool.dropped.Load(),
+		Failed:       a.failed.Load(),
+		Spooled:      batches,
+		SpooledBytes: size,
+	}
+}
+
+// entry is one event read by an input. commit records the input's progress
+// past it once it is spooled. An entry without an event only commits, as
+// a tailer's does when a file is replaced.
+type entry struct {
+	event  *client.LogEvent
+	commit func(*state)
+}
+
+// Run tails the inputs and ships their events until ctx is cancelled. It
+// spools the events read but not yet batched before returning.
+func (a *Agent) Run(ctx context.Context) error {
+	entries := make(chan entry, a.cfg.BatchSize)
+	var inputs, workers sync.WaitGroup
+	for _, path := range a.cfg.Files {
+		inputs.Add(1)
+		go func() {
+			defer inputs.Done()
+			a.tail(ctx, path, entries)
+		}()
+	}
+	if a.cfg.Journald {
+		inputs.Add(1)
+		go func() {
+			defer inputs.Done()
+			a.followJournal(ctx, entries)
+		}()
+	}
+	workers.Add(2)
+	go func() {
+		defer workers.Done()
+		a.send(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		a.collect(entries)
+	}()
+	inputs.Wait()
+	close(entries)
+	workers.Wait()
+	return nil
+}
+
+// collect batches entries, spooling a batch when it is full or has waited
+// a flush interval, until entries is closed.
+func (a *Agent) collect(entries <-chan entry) {
+	ticker := a.clock.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+	var (
+		batch   []client.LogEvent
+		commits []func(*state)
+	)
+	flush := func() {
+		if len(batch) > 0 {
+			if err := a.spool.put(batch); err != nil {
+				// The commits are withheld, so the lines are read again
+				// after a restart.
+				a.logger.Printf("log agent: spool %d events: %v", len(batch), err)
+				batch, commits = nil, nil
+				return
+			}
+			select {
+			case a.wake <- struct{}{}:
+			default:
+			}
+		}
+		if len(commits) > 0 {
+			for _, commit := range commits {
+				commit(a.state)
+			}
+			if err := a.state.save(); err != nil {
+				a.logger.Printf("log agent: save offsets: %v", err)
+			}
+		}
+		batch, commits = nil, nil
+	}
+	for {
+		select {
+		case e, ok := <-entries:
+			if !ok {
+				flush()
+				return
+			}
+			if e.event != nil {
+				batch = append(batch, *e.event)
+			}
+			if e.commit != nil {
+				commits = append(commits, e.commit)
+			}
+			if len(batch) >= a.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C():
+			flush()
+		}
+	}
+}
+
+// send delivers spooled batches, oldest first, until ctx is cancelled.
+func (a *Agent) send(ctx context.Context) {
+	for {
+		id, events, ok := a.spool.oldest()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-a.wake:
+				continue
+			}
+		}
+		if err := a.deliver(ctx, events); err != nil {
+			return
+		}
+		a.spool.remove(id)
+	}
+}
+
+// deliver sends events until the pipeline accepts or refuses them, and
+// returns an error only when ctx is cancelled first. A batch too large for
+// the pipeline is sent in halves.
+func (a *Agent) deliver(ctx context.Context, events []client.LogEvent) error {
+	for attempt := 0; ; attempt++ {
+		err := a.logs.IngestBatch(ctx, events)
+		if err == nil {
+			a.shipped.Add(uint64(len(events)))
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var apiErr *client.Error
+		errors.As(err, &apiErr)
+		switch {
+		case apiErr != nil && apiErr.Status == http.StatusRequestEntityTooLarge && len(events) > 1:
+			half := len(events) / 2
+			if err := a.deliver(ctx, events[:half]); err != nil {
+				return err
+			}
+			return a.deliver(ctx, events[half:])
+		case apiErr != nil && (apiErr.Status == http.StatusBadRequest || apiErr.Status == http.StatusRequestEntityTooLarge):
+			a.dropped.Add(uint64(len(events)))
+			a.logger.Printf("log agent: dropping %d events the pipeline refused: %v", len(events), err)
+			return nil
+		}
+		a.failed.Add(1)
+		wait := a.backoff(attempt)
+		if apiErr != nil && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		a.logger.Printf("log agent: send %d events: %v; retrying in %s", len(events), err, wait.Round(time.Millisecond))
+		timer := a.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// backoff is the wait after a batch's attempt-th failed send, counting
+// from 0: doubling from minBackoff up to MaxBackoff, less up to half as
+// jitter so agents that lost the pipeline together do not return together.
+func (a *Agent) backoff(attempt int) time.Duration {
+	wait := a.cfg.MaxBackoff
+	if attempt < 32 {
+		wait = min(minBackoff<<attempt, a.cfg.MaxBackoff)
+	}
+	return wait - rand.N(wait/2+1)
+}
+
+// event builds an event read now from message, truncated to what the
+// pipeline accepts.
+func (a *Agent) event(level, message string, fields map[string]string) *client.LogEvent {
+	if len(message) > maxMessageBytes {
+		cut := maxMessageBytes
+		for cut > 0 && !utf8.RuneStart(message[cut]) {
+			cut--
+		}
+		message = message[:cut]
+	}
+	return &client.LogEvent{
+		Source:    a.cfg.Source,
+		Level:     level,
+		Message:   message,
+		Fields:    fields,
+		Timestamp: a.clock.Now(),
+	}
+}
@@ -0,0 +1,225 @@
+package logagent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+type silentLogger struct{}
+
+func (silentLogger) Printf(string, ...any) {}
+
+// pipeline is a fake POST /logs/batch endpoint. reject, when set, chooses
+// a status to answer a batch with instead of accepting it.
+type pipeline struct {
+	mu       sync.Mutex
+	messages []string
+	reject   func(call int, events []client.LogEvent) int
+	calls    int
+}
+
+func (p *pipeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Events []client.LogEvent `json:"events"`
+	}
+	if r.URL.Path != "/logs/batch" || json.NewDecoder(r.Body).Decode(&body) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.reject != nil {
+		if status := p.reject(p.calls, body.Events); status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+	}
+	for _, event := range body.Events {
+		p.messages = append(p.messages, event.Message)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (p *pipeline) waitFor(t *testing.T, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		p.mu.Lock()
+		got := slices.Clone(p.messages)
+		p.mu.Unlock()
+		if slices.Equal(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q shipped, got %q", want, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// start runs an agent for cfg against p until the returned stop is called.
+func start(t *testing.T, p *pipeline, cfg Config) (*Agent, func()) {
+	t.Helper()
+	server := httptest.NewServer(p)
+	logs, err := client.NewLogs(server.URL, client.WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+	cfg.Source = "host-1"
+	cfg.PollInterval = 10 * time.Millisecond
+	cfg.FlushInterval = 20 * time.Millisecond
+	agent, err := New(cfg, logs, silentLogger{})
+	if err != nil {
+		t.Fatalf("new agent: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = agent.Run(ctx)
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			server.Close()
+		})
+	}
+	t.Cleanup(stop)
+	return agent, stop
+}
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestAgentTailsFilesAcrossRotationAndRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	buffer := filepath.Join(dir, "buffer")
+	appendFile(t, path, "before the agent\n")
+
+	p := &pipeline{}
+	_, stop := start(t, p, Config{Files: []string{path}, BufferDir: buffer})
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "one\n\ntwo\npart")
+	p.waitFor(t, "one", "two")
+	appendFile(t, path, "ial\nthree\n")
+	p.waitFor(t, "one", "two", "partial", "three")
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	appendFile(t, path, "four\n")
+	p.waitFor(t, "one", "two", "partial", "three", "four")
+	stop()
+
+	// Lines written while the agent is down are shipped after a restart,
+	// and nothing before them is shipped twice.
+	appendFile(t, path, "five\n")
+	start(t, p, Config{Files: []string{path}, BufferDir: buffer})
+	p.waitFor(t, "one", "two", "partial", "three", "four", "five")
+}
+
+func TestAgentSplitsOversizedBatchesAndRetries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "a\nb\nc\nd\ne\n")
+
+	p := &pipeline{reject: func(call int, events []client.LogEvent) int {
+		switch {
+		case call == 1:
+			return http.StatusServiceUnavailable
+		case len(events) > 2:
+			return http.StatusRequestEntityTooLarge
+		case events[0].Message == "bad":
+			return http.StatusBadRequest
+		}
+		return 0
+	}}
+	agent, _ := start(t, p, Config{Files: []string{path}, FromStart: true, BatchSize: 5, MaxBackoff: 10 * time.Millisecond})
+	p.waitFor(t, "a", "b", "c", "d", "e")
+
+	appendFile(t, path, "bad\n")
+	deadline := time.Now().Add(5 * time.Second)
+	for agent.Stats().Dropped != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := agent.Stats()
+	if stats.Shipped != 5 || stats.Dropped != 1 || stats.Failed == 0 || stats.Spooled != 0 {
+		t.Fatalf("expected 5 shipped, 1 dropped, a failed attempt, and nothing spooled, got %+v", stats)
+	}
+}
+
+func TestSpoolDropsOldestAndSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpool(dir, 150, silentLogger{})
+	if err != nil {
+		t.Fatalf("open spool: %v", err)
+	}
+	for _, msg := range []string{"first", "second", "third"} {
+		if err := s.put([]client.LogEvent{{Source: "host-1", Level: "info", Message: msg}}); err != nil {
+			t.Fatalf("put: %v", err)
+		}
+	}
+	if s.dropped.Load() == 0 {
+		t.Fatal("expected the oldest batch dropped to stay within the limit")
+	}
+
+	reopened, err := openSpool(dir, 150, silentLogger{})
+	if err != nil {
+		t.Fatalf("reopen spool: %v", err)
+	}
+	var got []string
+	for {
+		id, events, ok := reopened.oldest()
+		if !ok {
+			break
+		}
+		got = append(got, events[0].Message)
+		reopened.remove(id)
+	}
+	if strings.Join(got, ",") != "second,third" {
+		t.Fatalf("expected the newest batches in order, got %v", got)
+	}
+}
+
+func TestJournalEvent(t *testing.T) {
+	a := &Agent{cfg: Config{Source: "host-1"}, clock: clock.System}
+	line := `{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1767225600000000","PRIORITY":"4","MESSAGE":[104,105],"_SYSTEMD_UNIT":"game.service","_PID":"42"}`
+	event, cursor, err := a.journalEvent([]byte(line))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if cursor != "s=1;i=2" {
+		t.Fatalf("expected the entry's cursor, got %q", cursor)
+	}
+	if event.Message != "hi" || event.Level != "warn" || event.Fields["unit"] != "game.service" || event.Fields["pid"] != "42" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if want := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC); !event.Timestamp.Equal(want) {
+		t.Fatalf("expected the journal's timestamp %v, got %v", want, event.Timestamp)
+	}
+}
@@ -0,0 +1,152 @@
+package logagent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+// journalRestartDelay is the wait before journalctl is started again after
+// it exits.
+const journalRestartDelay = 5 * time.Second
+
+// journalFields maps journal fields to the event fields they are shipped as.
+var journalFields = map[string]string{
+	"_SYSTEMD_UNIT":     "unit",
+	"SYSLOG_IDENTIFIER": "identifier",
+	"_PID":              "pid",
+	"_HOSTNAME":         "hostname",
+}
+
+// followJournal ships journal entries until ctx is cancelled, resuming
+// after the saved cursor or, without one, starting with new entries.
+func (a *Agent) followJournal(ctx context.Context, out chan<- entry) {
+	for {
+		if err := a.readJournal(ctx, out); err != nil && ctx.Err() == nil {
+			a.logger.Printf("log agent: journal: %v", err)
+		}
+		timer := a.clock.NewTimer(journalRestartDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+	}
+}
+
+// readJournal runs journalctl once, sending what it prints.
+func (a *Agent) readJournal(ctx context.Context, out chan<- entry) error {
+	args := []string{"--follow", "--output=json"}
+	if cursor := a.state.cursor(); cursor != "" {
+		args = append(args, "--after-cursor="+cursor)
+	} else {
+		args = append(args, "--lines=0")
+	}
+	cmd := exec.CommandContext(ctx, a.journalctl, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		event, cursor, err := a.journalEvent(scanner.Bytes())
+		if err != nil {
+			a.logger.Printf("log agent: journal: skipping entry: %v", err)
+			continue
+		}
+		e := entry{event: event}
+		if cursor != "" {
+			e.commit = func(st *state) { st.setCursor(cursor) }
+		}
+		if !emit(ctx, out, e) {
+			break
+		}
+	}
+	scanErr := scanner.Err()
+	waitErr := cmd.Wait()
+	if scanErr != nil {
+		return scanErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("journalctl exited: %w", waitErr)
+	}
+	return fmt.Errorf("journalctl exited")
+}
+
+// journalEvent converts one entry of journalctl's JSON output, returning
+// its cursor. The event is nil for an entry without a message.
+func (a *Agent) journalEvent(line []byte) (*client.LogEvent, string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, "", err
+	}
+	cursor := journalString(fields["__CURSOR"])
+	message := journalString(fields["MESSAGE"])
+	if message == "" {
+		return nil, cursor, nil
+	}
+	extra := map[string]string{}
+	for field, name := range journalFields {
+		if value := journalString(fields[field]); value != "" {
+			extra[name] = value
+		}
+	}
+	event := a.event(journalLevel(journalString(fields["PRIORITY"])), message, extra)
+	if usec, err := strconv.ParseInt(journalString(fields["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		event.Timestamp = time.UnixMicro(usec).UTC()
+	}
+	return event, cursor, nil
+}
+
+// journalString returns a journal field's value. journalctl prints fields
+// that are not valid UTF-8 as arrays of bytes, and repeated fields as
+// arrays of values, of which the first is used.
+func journalString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return s
+			}
+		}
+		b := make([]byte, 0, len(v))
+		for _, item := range v {
+			n, ok := item.(float64)
+			if !ok {
+				return ""
+			}
+			b = append(b, byte(n))
+		}
+		return string(b)
+	}
+	return ""
+}
+
+// journalLevel maps a syslog priority to a pipeline level.
+func journalLevel(priority string) string {
+	p, err := strconv.Atoi(priority)
+	switch {
+	case err != nil:
+		return "info"
+	case p <= 3:
+		return "error"
+	case p == 4:
+		return "warn"
+	case p == 7:
+		return "debug"
+	}
+	return "info"
+}
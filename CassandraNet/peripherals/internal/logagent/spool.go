@@ -0,0 +1,268 @@
+package logagent
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+const (
+	batchExt  = ".batch"
+	stateFile = "state.json"
+)
+
+// spooled is one batch waiting to be sent. events is nil for a batch held
+// on disk.
+type spooled struct {
+	id     uint64
+	count  int
+	size   int64
+	events []client.LogEvent
+}
+
+// spool holds batches until they are sent, oldest first, in a directory
+// or, when dir is empty, in memory. Past max bytes it drops the oldest.
+type spool struct {
+	dir    string
+	max    int64
+	logger logging.Printer
+
+	mu      sync.Mutex
+	batches []spooled
+	size    int64
+	next    uint64
+
+	dropped atomic.Uint64
+}
+
+// openSpool loads the batches left in dir, creating it if needed.
+func openSpool(dir string, maxBytes int64, logger logging.Printer) (*spool, error) {
+	s := &spool{dir: dir, max: maxBytes, logger: logger, next: 1}
+	if dir == "" {
+		return s, nil
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("log agent: create buffer dir: %w", err)
+	}
+	names, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("log agent: read buffer dir: %w", err)
+	}
+	for _, name := range names {
+		id, err := strconv.ParseUint(strings.TrimSuffix(name.Name(), batchExt), 10, 64)
+		if !strings.HasSuffix(name.Name(), batchExt) || err != nil {
+			continue
+		}
+		info, err := name.Info()
+		if err != nil {
+			continue
+		}
+		s.batches = append(s.batches, spooled{id: id, size: info.Size()})
+		s.size += info.Size()
+		s.next = max(s.next, id+1)
+	}
+	slices.SortFunc(s.batches, func(a, b spooled) int { return cmp.Compare(a.id, b.id) })
+	return s, nil
+}
+
+func (s *spool) path(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, batchExt))
+}
+
+// put adds a batch, dropping the oldest until it fits.
+func (s *spool) put(events []client.LogEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := spooled{id: s.next, count: len(events), size: int64(len(data))}
+	if s.dir == "" {
+		b.events = events
+	} else if err := writeFile(s.path(b.id), data); err != nil {
+		return err
+	}
+	s.next++
+	for len(s.batches) > 0 && s.size+b.size > s.max {
+		s.evictLocked()
+	}
+	s.batches = append(s.batches, b)
+	s.size += b.size
+	return nil
+}
+
+// evictLocked drops the oldest batch to make room.
+func (s *spool) evictLocked() {
+	oldest := s.batches[0]
+	count := oldest.count
+	if count == 0 {
+		// Batches loaded at startup are counted only when read.
+		if events, err := s.readLocked(oldest); err == nil {
+			count = len(events)
+		}
+	}
+	s.removeLocked(oldest.id)
+	s.dropped.Add(uint64(count))
+	s.logger.Printf("log agent: buffer full; dropped a batch of %d events", count)
+}
+
+// oldest returns the oldest batch. A batch file that cannot be read is
+// removed, since retrying it cannot help.
+func (s *spool) oldest() (uint64, []client.LogEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.batches) > 0 {
+		b := s.batches[0]
+		events, err := s.readLocked(b)
+		if err == nil {
+			return b.id, events, true
+		}
+		s.logger.Printf("log agent: discarding unreadable batch %d: %v", b.id, err)
+		s.removeLocked(b.id)
+	}
+	return 0, nil, false
+}
+
+func (s *spool) readLocked(b spooled) ([]client.LogEvent, error) {
+	if s.dir == "" {
+		return b.events, nil
+	}
+	data, err := os.ReadFile(s.path(b.id))
+	if err != nil {
+		return nil, err
+	}
+	var events []client.LogEvent
+	err = json.Unmarshal(data, &events)
+	return events, err
+}
+
+// remove drops the batch with id, if the spool still holds it.
+func (s *spool) remove(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeLocked(id)
+}
+
+func (s *spool) removeLocked(id uint64) {
+	i := slices.IndexFunc(s.batches, func(b spooled) bool { return b.id == id })
+	if i < 0 {
+		return
+	}
+	s.size -= s.batches[i].size
+	s.batches = slices.Delete(s.batches, i, i+1)
+	if s.dir != "" {
+		if err := os.Remove(s.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Printf("log agent: remove batch %d: %v", id, err)
+		}
+	}
+}
+
+func (s *spool) stats() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches), s.size
+}
+
+// state is how far each input has read: a byte offset per tailed file and
+// the journal cursor. It is kept in dir, or only in memory when dir is
+// empty.
+type state struct {
+	dir string
+
+	mu            sync.Mutex
+	Files         map[string]int64 `json:"files"`
+	JournalCursor string           `json:"journal_cursor,omitempty"`
+}
+
+func loadState(dir string) (*state, error) {
+	st := &state{dir: dir, Files: map[string]int64{}}
+	if dir == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("log agent: read offsets: %w", err)
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("log agent: read offsets: %w", err)
+	}
+	if st.Files == nil {
+		st.Files = map[string]int64{}
+	}
+	return st, nil
+}
+
+// offset returns the saved offset for path.
+func (st *state) offset(path string) (int64, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	off, ok := st.Files[path]
+	return off, ok
+}
+
+func (st *state) setOffset(path string, off int64) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Files[path] = off
+}
+
+func (st *state) cursor() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.JournalCursor
+}
+
+func (st *state) setCursor(cursor string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.JournalCursor = cursor
+}
+
+func (st *state) save() error {
+	if st.dir == "" {
+		return nil
+	}
+	st.mu.Lock()
+	data, err := json.Marshal(st)
+	st.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(st.dir, stateFile), data)
+}
+
+// writeFile replaces path with data so readers never see part of it.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
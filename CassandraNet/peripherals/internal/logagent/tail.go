@@ -0,0 +1,165 @@
+package logagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// tailer follows one file across truncation and rotation.
+type tailer struct {
+	path string
+	file *os.File
+	info os.FileInfo
+	// offset is where the next unread line starts.
+	offset int64
+	// started is set once the file has first been opened; files opened
+	// later, after rotation or creation, are read from the beginning.
+	started bool
+}
+
+// tail polls path for new lines and sends them to out until ctx is
+// cancelled.
+func (a *Agent) tail(ctx context.Context, path string, out chan<- entry) {
+	t := &tailer{path: path}
+	defer t.close()
+	ticker := a.clock.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := a.poll(ctx, t, out); err != nil && ctx.Err() == nil {
+			a.logger.Printf("log agent: tail %s: %v", path, err)
+			t.close()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
+
+// poll opens the file if needed, reads the lines appended since the last
+// poll, and moves to a replacement file once the current one is drained.
+func (a *Agent) poll(ctx context.Context, t *tailer, out chan<- entry) error {
+	for {
+		if t.file == nil {
+			opened, err := a.open(t)
+			if err != nil || !opened {
+				return err
+			}
+		}
+		info, err := t.file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() < t.offset {
+			// Truncated in place, as by copytruncate.
+			t.offset = 0
+		}
+		if err := a.readLines(ctx, t, out); err != nil {
+			return err
+		}
+		current, err := os.Stat(t.path)
+		if err != nil || os.SameFile(current, t.info) {
+			// Moved away with no replacement yet, or not moved at all.
+			return nil
+		}
+		// Rotated: the old file is drained, so continue with the new one,
+		// and say so, since the saved offset belonged to the old file.
+		t.close()
+		if !emit(ctx, out, entry{commit: a.commitOffset(t.path, 0)}) {
+			return nil
+		}
+	}
+}
+
+// open opens the file, reporting false while it does not exist. The first
+// file is read from the saved offset, if it still fits, or else from its
+// end (or start, with FromStart); later ones from their start.
+func (a *Agent) open(t *tailer) (bool, error) {
+	f, err := os.Open(t.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.started = true
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return false, err
+	}
+	t.file, t.info, t.offset = f, info, 0
+	if !t.started {
+		t.started = true
+		if saved, ok := a.state.offset(t.path); ok {
+			if saved <= info.Size() {
+				t.offset = saved
+			}
+		} else if !a.cfg.FromStart {
+			t.offset = info.Size()
+		}
+	}
+	return true, nil
+}
+
+func (t *tailer) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+		t.file, t.info = nil, nil
+	}
+}
+
+// readLines sends each complete line after the offset, skipping blank
+// ones. A final line without its newline is left for a later poll.
+func (a *Agent) readLines(ctx context.Context, t *tailer, out chan<- entry) error {
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(t.file, 64<<10)
+	var line []byte
+	end := t.offset
+	for {
+		chunk, err := r.ReadSlice('\n')
+		end += int64(len(chunk))
+		if room := maxMessageBytes + 1 - len(line); room > 0 {
+			line = append(line, chunk[:min(room, len(chunk))]...)
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+		t.offset = end
+		e := entry{commit: a.commitOffset(t.path, end)}
+		if message := string(bytes.TrimRight(line, "\r\n")); message != "" {
+			e.event = a.event("info", message, map[string]string{"file": t.path})
+		}
+		if !emit(ctx, out, e) {
+			return nil
+		}
+		line = line[:0]
+	}
+}
+
+func (a *Agent) commitOffset(path string, off int64) func(*state) {
+	return func(st *state) { st.setOffset(path, off) }
+}
+
+// emit hands e to the collector, reporting false if ctx is cancelled first.
+func emit(ctx context.Context, out chan<- entry, e entry) bool {
+	select {
+	case out <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,219 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+)
+
+const (
+	// RequestIDHeader carries the correlation ID between services. Incoming
+	// values are reused; otherwise one is generated.
+	RequestIDHeader = "X-Request-ID"
+	// TenantIDHeader identifies the tenant a request acts for.
+	TenantIDHeader = "X-Tenant-ID"
+	// ProjectIDHeader identifies the project a request acts for.
+	ProjectIDHeader = "X-Project-ID"
+	// RequestIDField names the correlation ID in log fields, message
+	// attributes, and queued jobs.
+	RequestIDField = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	tenantIDKey
+	projectIDKey
+	loggerKey
+	accessKey
+)
+
+// Printer is the minimal logging dependency used throughout the services.
+type Printer interface {
+	Printf(string, ...any)
+}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithTenantID returns a context carrying the tenant ID.
+func WithTenantID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantIDKey, id)
+}
+
+// TenantID returns the tenant ID carried by ctx, if any.
+func TenantID(ctx context.Context) string {
+	id, _ := ctx.Value(tenantIDKey).(string)
+	return id
+}
+
+// WithProjectID returns a context carrying the project ID.
+func WithProjectID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, projectIDKey, id)
+}
+
+// ProjectID returns the project ID carried by ctx, if any.
+func ProjectID(ctx context.Context) string {
+	id, _ := ctx.Value(projectIDKey).(string)
+	return id
+}
+
+// NewContext returns a context carrying logger.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger carried by ctx.
+func FromContext(ctx context.Context) (*Logger, bool) {
+	logger, ok := ctx.Value(loggerKey).(*Logger)
+	return logger, ok
+}
+
+// Access collects fields for a request's access log line that are only
+// known inside the handler chain, such as the authenticated subject.
+type Access struct {
+	mu sync.Mutex
+	kv []any
+}
+
+// WithAccess returns a context collecting access log fields, and the
+// collector. The access log middleware installs it before calling the
+// handler and reads Fields once the handler returns.
+func WithAccess(ctx context.Context) (context.Context, *Access) {
+	a := &Access{}
+	return context.WithValue(ctx, accessKey, a), a
+}
+
+// AddAccessFields adds key-value pairs to the access log line of the
+// request carried by ctx. It does nothing when ctx has no collector.
+func AddAccessFields(ctx context.Context, kv ...any) {
+	if a, ok := ctx.Value(accessKey).(*Access); ok {
+		a.mu.Lock()
+		a.kv = append(a.kv, kv...)
+		a.mu.Unlock()
+	}
+}
+
+// Fields returns the fields added so far.
+func (a *Access) Fields() []any {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]any(nil), a.kv...)
+}
+
+// For returns the request-scoped logger carried by ctx, or fallback when
+// ctx has none. Handlers use it so their log lines carry correlation fields
+// while the package keeps its plain Printer dependency.
+func For(ctx context.Context, fallback Printer) Printer {
+	if logger, ok := FromContext(ctx); ok {
+		return logger
+	}
+	return fallback
+}
+
+// Middleware assigns every request a request ID (reusing a well-formed
+// X-Request-ID header), echoes it in the response, records the tenant from
+// X-Tenant-ID or the tenant_id query parameter and the project from
+// X-Project-ID or project_id, and stores a logger derived from logger with
+// those fields in the request context.
+func Middleware(logger *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := WithRequestID(r.Context(), id)
+		kv := []any{RequestIDField, id}
+		if tenant := Requested(r, TenantIDHeader, "tenant_id"); tenant != "" {
+			ctx = WithTenantID(ctx, tenant)
+			kv = append(kv, "tenant_id", tenant)
+		}
+		if project := Requested(r, ProjectIDHeader, "project_id"); project != "" {
+			ctx = WithProjectID(ctx, project)
+			kv = append(kv, "project_id", project)
+		}
+		ctx = NewContext(ctx, logger.With(kv...))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Transport sends the request ID carried by each outgoing request's
+// context in X-Request-ID, unless the request sets one, so calls made
+// while handling a request share its correlation ID. A nil base uses
+// http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return propagator{base: base}
+}
+
+type propagator struct {
+	base http.RoundTripper
+}
+
+func (t propagator) RoundTrip(r *http.Request) (*http.Response, error) {
+	if id := RequestID(r.Context()); id != "" && r.Header.Get(RequestIDHeader) == "" {
+		r = r.Clone(r.Context())
+		r.Header.Set(RequestIDHeader, id)
+	}
+	return t.base.RoundTrip(r)
+}
+
+// Requested returns the value of header, or of the query parameter param
+// when the header is absent.
+func Requested(r *http.Request, header, param string) string {
+	if value := r.Header.Get(header); value != "" {
+		return value
+	}
+	return r.URL.Query().Get(param)
+}
+
+// correlationFields returns the request, tenant, and project IDs carried by
+// ctx.
+func correlationFields(ctx context.Context) []field {
+	var fields []field
+	if id := RequestID(ctx); id != "" {
+		fields = append(fields, field{key: RequestIDField, value: id})
+	}
+	if tenant := TenantID(ctx); tenant != "" {
+		fields = append(fields, field{key: "tenant_id", value: tenant})
+	}
+	if project := ProjectID(ctx); project != "" {
+		fields = append(fields, field{key: "project_id", value: project})
+	}
+	return fields
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns an ID that sorts request IDs, and so log lines
+// grouped by them, in the order requests arrived.
+func newRequestID() string {
+	return id.New("")
+}
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// record is a single log entry ready to be rendered.
+type record struct {
+	time    time.Time
+	level   Level
+	service string
+	message string
+	fields  []field
+}
+
+const textTimeLayout = "2006/01/02 15:04:05.000000"
+
+func (r record) appendText(buf []byte) []byte {
+	buf = append(buf, '[')
+	buf = append(buf, r.service...)
+	buf = append(buf, "] "...)
+	buf = r.time.AppendFormat(buf, textTimeLayout)
+	buf = append(buf, ' ')
+	buf = append(buf, r.level.String()...)
+	buf = append(buf, ' ')
+	buf = append(buf, strings.TrimRight(r.message, "\n")...)
+	for _, f := range r.fields {
+		buf = append(buf, ' ')
+		buf = append(buf, f.key...)
+		buf = append(buf, '=')
+		buf = appendTextValue(buf, formatValue(f.value))
+	}
+	return append(buf, '\n')
+}
+
+func appendTextValue(buf []byte, value string) []byte {
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
+
+// jsonRecord mirrors the log pipeline's LogEvent so JSON output can be
+// posted to /logs or parsed by collectors without translation.
+type jsonRecord struct {
+	Timestamp time.Time         `json:"timestamp"`
+	Level     string            `json:"level"`
+	Source    string            `json:"source"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+func (r record) appendJSON(buf []byte) []byte {
+	out := jsonRecord{
+		Timestamp: r.time,
+		Level:     r.level.String(),
+		Source:    r.service,
+		Message:   strings.TrimRight(r.message, "\n"),
+	}
+	if len(r.fields) > 0 {
+		out.Fields = make(map[string]string, len(r.fields))
+		for _, f := range r.fields {
+			out.Fields[f.key] = formatValue(f.value)
+		}
+	}
+	encoded, err := json.Marshal(out)
+	if err != nil {
+		encoded, _ = json.Marshal(jsonRecord{Timestamp: r.time, Level: out.Level, Source: r.service, Message: out.Message})
+	}
+	buf = append(buf, encoded...)
+	return append(buf, '\n')
+}
+
+// formatValue renders field values as strings: errors by message, times in
+// RFC 3339, durations in Go syntax, everything else via fmt.
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,139 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// levelOverride is a temporary level that reverts to the level in effect
+// before the first override once its timer fires.
+type levelOverride struct {
+	revertTo Level
+	until    time.Time
+	timer    *time.Timer
+}
+
+// LevelStatus describes the current minimum level and any pending revert.
+type LevelStatus struct {
+	Level    string     `json:"level"`
+	RevertTo string     `json:"revert_to,omitempty"`
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// SetLevelFor changes the minimum level like SetLevel. When d is positive the
+// level reverts after d to the level in effect before the first temporary
+// change, so repeated overrides extend the window rather than stacking.
+func (l *Logger) SetLevelFor(level Level, d time.Duration) {
+	if d <= 0 {
+		l.SetLevel(level)
+		return
+	}
+	c := l.core
+	c.overrideMu.Lock()
+	defer c.overrideMu.Unlock()
+
+	revertTo := Level(c.level.Load())
+	if c.override != nil {
+		revertTo = c.override.revertTo
+		c.override.timer.Stop()
+	}
+	o := &levelOverride{revertTo: revertTo, until: c.now().Add(d)}
+	o.timer = time.AfterFunc(d, func() { c.revert(o) })
+	c.override = o
+	c.level.Store(int32(level))
+}
+
+// LevelStatus reports the current minimum level and any pending revert.
+func (l *Logger) LevelStatus() LevelStatus {
+	c := l.core
+	c.overrideMu.Lock()
+	defer c.overrideMu.Unlock()
+	status := LevelStatus{Level: Level(c.level.Load()).String()}
+	if c.override != nil {
+		until := c.override.until
+		status.RevertTo = c.override.revertTo.String()
+		status.RevertAt = &until
+	}
+	return status
+}
+
+// revert restores the level saved by o unless o has since been replaced.
+func (c *core) revert(o *levelOverride) {
+	c.overrideMu.Lock()
+	defer c.overrideMu.Unlock()
+	if c.override != o {
+		return
+	}
+	c.override = nil
+	c.level.Store(int32(o.revertTo))
+}
+
+// clearOverride cancels a pending revert. Callers hold overrideMu.
+func (c *core) clearOverride() {
+	if c.override != nil {
+		c.override.timer.Stop()
+		c.override = nil
+	}
+}
+
+// levelRequest is the body accepted by the level handler. Duration is a Go
+// duration string ("15m"); empty or zero makes the change permanent.
+type levelRequest struct {
+	Level    string `json:"level"`
+	Duration string `json:"duration"`
+}
+
+// LevelHandler serves the logger's level at runtime, typically mounted at
+// /debug/loglevel. GET returns the current LevelStatus; PUT or POST changes
+// it from a JSON levelRequest body or the level and duration query
+// parameters, reverting automatically when a duration is given.
+func (l *Logger) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			req, err := decodeLevelRequest(r)
+			if err != nil {
+				problem.Write(w, r, http.StatusBadRequest, "debug.invalid_request", err.Error())
+				return
+			}
+			level, ok := lookupLevel(req.Level)
+			if !ok {
+				problem.Write(w, r, http.StatusBadRequest, "debug.invalid_level", "unknown level "+req.Level)
+				return
+			}
+			var d time.Duration
+			if req.Duration != "" {
+				d, err = time.ParseDuration(req.Duration)
+				if err != nil || d < 0 {
+					problem.Write(w, r, http.StatusBadRequest, "debug.invalid_duration", "invalid duration "+req.Duration)
+					return
+				}
+			}
+			l.SetLevelFor(level, d)
+			l.Info("log level changed", "level", level, "duration", d)
+		default:
+			problem.MethodNotAllowed(w, r, "debug", http.MethodGet, http.MethodPut, http.MethodPost)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(l.LevelStatus())
+	})
+}
+
+func decodeLevelRequest(r *http.Request) (levelRequest, error) {
+	query := r.URL.Query()
+	req := levelRequest{Level: query.Get("level"), Duration: query.Get("duration")}
+	if req.Level != "" {
+		return req, nil
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 4096)).Decode(&req); err != nil {
+		return req, errors.New("expected a JSON body with level and optional duration")
+	}
+	return req, nil
+}
@@ -1,12 +1,245 @@
 package logging
 
 import (
-	"log"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// New creates a standard library logger with a consistent prefix and flags.
-func New(service string) *log.Logger {
-	prefix := "[" + service + "] "
-	return log.New(os.Stdout, prefix, log.LstdFlags|log.Lmicroseconds|log.LUTC)
+// Level models a log severity.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// String returns the upper-case level name.
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return "INFO"
+	}
+}
+
+// ParseLevel converts a level name into a Level, defaulting to INFO.
+func ParseLevel(value string) Level {
+	level, _ := lookupLevel(value)
+	return level
+}
+
+// lookupLevel converts a level name into a Level, reporting whether the name
+// was recognised.
+func lookupLevel(value string) (Level, bool) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "DEBUG":
+		return LevelDebug, true
+	case "INFO":
+		return LevelInfo, true
+	case "WARN", "WARNING":
+		return LevelWarn, true
+	case "ERROR":
+		return LevelError, true
+	default:
+		return LevelInfo, false
+	}
+}
+
+// Format selects how records are rendered.
+type Format string
+
+const (
+	// FormatText renders `[service] time LEVEL message key=value ...`.
+	FormatText Format = "text"
+	// FormatJSON renders one JSON object per line using the log pipeline's
+	// event schema (timestamp, level, source, message, fields).
+	FormatJSON Format = "json"
+)
+
+// ParseFormat converts a format name into a Format, defaulting to text.
+func ParseFormat(value string) Format {
+	if strings.EqualFold(strings.TrimSpace(value), string(FormatJSON)) {
+		return FormatJSON
+	}
+	return FormatText
+}
+
+// Options configures a Logger.
+type Options struct {
+	Format Format
+	Level  Level
+	// Output defaults to os.Stdout.
+	Output io.Writer
+}
+
+// Logger is a structured, leveled logger. Loggers derived through With
+// share their parent's output and level.
+type Logger struct {
+	core    *core
+	service string
+	fields  []field
+}
+
+type core struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format Format
+	level  atomic.Int32
+	now    func() time.Time
+
+	// override tracks a temporary level set through SetLevelFor.
+	overrideMu sync.Mutex
+	override   *levelOverride
+
+	// shipper, when set, receives a JSON copy of every record.
+	shipper atomic.Pointer[Shipper]
+}
+
+type field struct {
+	key   string
+	value any
+}
+
+// New creates a logger for service. The LOG_FORMAT (`text` or `json`) and
+// LOG_LEVEL environment variables select the output format and minimum level.
+func New(service string) *Logger {
+	return NewWithOptions(service, Options{
+		Format: ParseFormat(os.Getenv("LOG_FORMAT")),
+		Level:  ParseLevel(os.Getenv("LOG_LEVEL")),
+	})
+}
+
+// NewWithOptions creates a logger for service with explicit options.
+func NewWithOptions(service string, opts Options) *Logger {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	if opts.Format == "" {
+		opts.Format = FormatText
+	}
+	c := &core{
+		out:    opts.Output,
+		format: opts.Format,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+	c.level.Store(int32(opts.Level))
+	return &Logger{core: c, service: service}
+}
+
+// With returns a logger that adds the given key/value pairs to every record.
+func (l *Logger) With(kv ...any) *Logger {
+	fields := make([]field, 0, len(l.fields)+len(kv)/2)
+	fields = append(fields, l.fields...)
+	fields = appendPairs(fields, kv)
+	return &Logger{core: l.core, service: l.service, fields: fields}
+}
+
+// SetLevel changes the minimum level for this logger and every logger
+// sharing its output. It cancels any pending revert from SetLevelFor.
+func (l *Logger) SetLevel(level Level) {
+	l.core.overrideMu.Lock()
+	defer l.core.overrideMu.Unlock()
+	l.core.clearOverride()
+	l.core.level.Store(int32(level))
+}
+
+// Level reports the current minimum level.
+func (l *Logger) Level() Level {
+	return Level(l.core.level.Load())
+}
+
+// Enabled reports whether records at level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// Debug logs msg with optional key/value pairs at DEBUG.
+func (l *Logger) Debug(msg string, kv ...any) { l.log(LevelDebug, msg, kv) }
+
+// Info logs msg with optional key/value pairs at INFO.
+func (l *Logger) Info(msg string, kv ...any) { l.log(LevelInfo, msg, kv) }
+
+// Warn logs msg with optional key/value pairs at WARN.
+func (l *Logger) Warn(msg string, kv ...any) { l.log(LevelWarn, msg, kv) }
+
+// Error logs msg with optional key/value pairs at ERROR.
+func (l *Logger) Error(msg string, kv ...any) { l.log(LevelError, msg, kv) }
+
+// Printf logs a formatted message at INFO. It keeps the logger compatible
+// with the `interface{ Printf(string, ...any) }` dependencies used across
+// the services.
+func (l *Logger) Printf(format string, args ...any) {
+	l.log(LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+// Fatalf logs a formatted message at ERROR and exits the process.
+func (l *Logger) Fatalf(format string, args ...any) {
+	l.log(LevelError, fmt.Sprintf(format, args...), nil)
+	os.Exit(1)
+}
+
+func (l *Logger) log(level Level, msg string, kv []any) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = appendPairs(append([]field(nil), l.fields...), kv)
+	}
+	l.core.write(record{
+		time:    l.core.now(),
+		level:   level,
+		service: l.service,
+		message: msg,
+		fields:  fields,
+	})
+}
+
+func (c *core) write(rec record) {
+	var line, encoded []byte
+	if c.format == FormatJSON {
+		encoded = rec.appendJSON(nil)
+		line = encoded
+	} else {
+		line = rec.appendText(nil)
+	}
+	c.mu.Lock()
+	_, _ = c.out.Write(line)
+	c.mu.Unlock()
+
+	if s := c.shipper.Load(); s != nil {
+		if encoded == nil {
+			encoded = rec.appendJSON(nil)
+		}
+		s.enqueue(encoded)
+	}
+}
+
+// appendPairs converts alternating key/value arguments into fields. A
+// trailing value without a key is recorded under "EXTRA".
+func appendPairs(fields []field, kv []any) []field {
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 >= len(kv) {
+			fields = append(fields, field{key: "EXTRA", value: kv[i]})
+			break
+		}
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		fields = append(fields, field{key: key, value: kv[i+1]})
+	}
+	return fields
 }
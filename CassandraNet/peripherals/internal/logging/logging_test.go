@@ -0,0 +1,226 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+)
+
+func fixedLogger(format Format, level Level) (*Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := NewWithOptions("svc", Options{Format: format, Level: level, Output: &buf})
+	logger.core.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return logger, &buf
+}
+
+func TestTextFormat(t *testing.T) {
+	logger, buf := fixedLogger(FormatText, LevelInfo)
+	logger.With("request_id", "r-1").Warn("slow request", "route", "/v1/login", "err", errors.New("timed out"))
+
+	want := `[svc] 2024/05/01 12:00:00.000000 WARN slow request request_id=r-1 route=/v1/login err="timed out"` + "\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONFormatMatchesPipelineSchema(t *testing.T) {
+	logger, buf := fixedLogger(FormatJSON, LevelDebug)
+	logger.Info("queued", "depth", 3, "dangling")
+
+	var event struct {
+		Timestamp time.Time         `json:"timestamp"`
+		Level     string            `json:"level"`
+		Source    string            `json:"source"`
+		Message   string            `json:"message"`
+		Fields    map[string]string `json:"fields"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if event.Level != "INFO" || event.Source != "svc" || event.Message != "queued" {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event.Fields["depth"] != "3" || event.Fields["EXTRA"] != "dangling" {
+		t.Fatalf("unexpected fields %v", event.Fields)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	logger, buf := fixedLogger(FormatText, LevelWarn)
+	child := logger.With("component", "worker")
+	child.Info("hidden")
+	child.Printf("hidden %d", 2)
+	logger.SetLevel(LevelDebug)
+	child.Debug("visible")
+
+	if strings.Count(buf.String(), "\n") != 1 || !strings.Contains(buf.String(), "DEBUG visible component=worker") {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	logger, buf := fixedLogger(FormatText, LevelInfo)
+	slogger := logger.With("service_version", "1.2").Slog()
+
+	slogger.Debug("hidden")
+	slogger.With("tenant", "t1").WithGroup("http").Info("request", "status", 200, slog.Group("client", "ip", "10.0.0.1"))
+
+	out := buf.String()
+	want := "INFO request service_version=1.2 tenant=t1 http.status=200 http.client.ip=10.0.0.1\n"
+	if strings.Count(out, "\n") != 1 || !strings.HasSuffix(out, want) {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
+
+func TestMiddlewareCorrelation(t *testing.T) {
+	logger, buf := fixedLogger(FormatText, LevelInfo)
+	handler := Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		For(r.Context(), nil).Printf("handled %s", r.URL.Path)
+		slog.New(NewHandler(logger)).InfoContext(r.Context(), "via slog")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/content?tenant_id=t-9", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "req-123" {
+		t.Fatalf("expected request id echoed, got %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=req-123 tenant_id=t-9") {
+			t.Fatalf("missing correlation fields: %q", line)
+		}
+	}
+
+	bad := httptest.NewRequest(http.MethodGet, "/", nil)
+	bad.Header.Set(RequestIDHeader, "has spaces")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, bad)
+	if got := rec.Header().Get(RequestIDHeader); got == "has spaces" || len(got) != id.Length {
+		t.Fatalf("expected generated request id, got %q", got)
+	}
+}
+
+func TestLevelHandlerRevertsAfterDuration(t *testing.T) {
+	logger, _ := fixedLogger(FormatText, LevelWarn)
+	handler := logger.LevelHandler()
+
+	req := httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(`{"level":"debug","duration":"50ms"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var status LevelStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+	if status.Level != "DEBUG" || status.RevertTo != "WARN" || status.RevertAt == nil {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+
+	// A second override extends the window but keeps the original level.
+	logger.SetLevelFor(LevelInfo, 50*time.Millisecond)
+	if got := logger.LevelStatus().RevertTo; got != "WARN" {
+		t.Fatalf("expected revert to WARN, got %q", got)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for logger.Level() != LevelWarn {
+		if time.Now().After(deadline) {
+			t.Fatalf("level did not revert, still %s", logger.Level())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if status := logger.LevelStatus(); status.RevertAt != nil {
+		t.Fatalf("expected no pending revert, got %+v", status)
+	}
+
+	bad := httptest.NewRequest(http.MethodPost, "/debug/loglevel?level=verbose", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, bad)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown level, got %d", rec.Code)
+	}
+}
+
+func TestSetLevelCancelsRevert(t *testing.T) {
+	logger, _ := fixedLogger(FormatText, LevelInfo)
+	logger.SetLevelFor(LevelDebug, 20*time.Millisecond)
+	logger.SetLevel(LevelError)
+	time.Sleep(60 * time.Millisecond)
+	if logger.Level() != LevelError {
+		t.Fatalf("expected permanent ERROR level, got %s", logger.Level())
+	}
+}
+
+func TestShipperForwardsRecords(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/logs" || r.Method != http.MethodPost {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var event map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	logger, buf := fixedLogger(FormatText, LevelInfo)
+	shipper := logger.Ship(srv.URL, 8, nil)
+	logger.With("request_id", "r-7").Warn("disk low", "free", "2GB")
+	logger.Debug("filtered")
+	shipper.Stop()
+
+	if !strings.Contains(buf.String(), "WARN disk low") {
+		t.Fatalf("expected local output, got %q", buf.String())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("expected 1 shipped record, got %d", len(received))
+	}
+	event := received[0]
+	if event["source"] != "svc" || event["level"] != "WARN" || event["message"] != "disk low" {
+		t.Fatalf("unexpected event: %v", event)
+	}
+	fields, _ := event["fields"].(map[string]any)
+	if fields["request_id"] != "r-7" || fields["free"] != "2GB" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+	if stats := shipper.Stats(); stats.Shipped != 1 || stats.Dropped != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestShipperDropsWhenFull(t *testing.T) {
+	logger, _ := fixedLogger(FormatJSON, LevelInfo)
+	shipper := NewShipper("http://127.0.0.1:0", 1, nil)
+	logger.ShipTo(shipper)
+	for i := 0; i < 3; i++ {
+		logger.Info("burst")
+	}
+	if got := shipper.Stats().Dropped; got != 2 {
+		t.Fatalf("expected 2 dropped records, got %d", got)
+	}
+}
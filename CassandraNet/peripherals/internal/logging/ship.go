@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	shipTimeout      = 2 * time.Second
+	shipDrainTimeout = 2 * time.Second
+)
+
+// ShipperStats counts what a Shipper has done with the records handed to it.
+type ShipperStats struct {
+	Shipped uint64 `json:"shipped"`
+	Dropped uint64 `json:"dropped"`
+	Failed  uint64 `json:"failed"`
+}
+
+// Shipper forwards log records to the log pipeline's POST /logs endpoint.
+// Records are queued in a bounded buffer and sent by a single goroutine;
+// when the buffer is full, or the pipeline is slow or unreachable, records
+// are dropped rather than blocking the caller. Failures are counted, never
+// logged, so a broken pipeline cannot feed back into the logger.
+type Shipper struct {
+	endpoint string
+	client   *http.Client
+	queue    chan []byte
+
+	shipped atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewShipper creates a shipper posting to the log pipeline at baseURL with
+// room for capacity queued records. A nil transport uses
+// http.DefaultTransport.
+func NewShipper(baseURL string, capacity int, transport http.RoundTripper) *Shipper {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &Shipper{
+		endpoint: strings.TrimRight(baseURL, "/") + "/logs",
+		client:   &http.Client{Timeout: shipTimeout, Transport: transport},
+		queue:    make(chan []byte, capacity),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Ship attaches a shipper for baseURL to the logger's output and starts it,
+// sending through transport (see NewShipper).
+// Every logger sharing the output forwards its records; call Stop on the
+// returned shipper to flush what is queued at shutdown.
+func (l *Logger) Ship(baseURL string, capacity int, transport http.RoundTripper) *Shipper {
+	s := NewShipper(baseURL, capacity, transport)
+	l.ShipTo(s)
+	s.Start()
+	return s
+}
+
+// ShipTo forwards records written through l (and loggers sharing its output)
+// to s. Passing nil detaches the current shipper.
+func (l *Logger) ShipTo(s *Shipper) {
+	l.core.shipper.Store(s)
+}
+
+// Start launches the sending goroutine.
+func (s *Shipper) Start() {
+	s.startOnce.Do(func() {
+		s.wg.Add(1)
+		go s.run()
+	})
+}
+
+// Stop stops accepting records and makes a bounded attempt to send those
+// still queued.
+func (s *Shipper) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+	s.wg.Wait()
+}
+
+// Stats reports how many records were shipped, dropped, or failed to send.
+func (s *Shipper) Stats() ShipperStats {
+	return ShipperStats{
+		Shipped: s.shipped.Load(),
+		Dropped: s.dropped.Load(),
+		Failed:  s.failed.Load(),
+	}
+}
+
+// enqueue queues an encoded record without blocking.
+func (s *Shipper) enqueue(line []byte) {
+	select {
+	case <-s.quit:
+		s.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case s.queue <- line:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+func (s *Shipper) run() {
+	defer s.wg.Done()
+	for {
+		select {
+		case line := <-s.queue:
+			s.send(context.Background(), line)
+		case <-s.quit:
+			s.drain()
+			return
+		}
+	}
+}
+
+func (s *Shipper) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), shipDrainTimeout)
+	defer cancel()
+	for {
+		select {
+		case line := <-s.queue:
+			if ctx.Err() != nil {
+				s.dropped.Add(1)
+				continue
+			}
+			s.send(ctx, line)
+		default:
+			return
+		}
+	}
+}
+
+func (s *Shipper) send(ctx context.Context, line []byte) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(line))
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.failed.Add(1)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		s.failed.Add(1)
+		return
+	}
+	s.shipped.Add(1)
+}
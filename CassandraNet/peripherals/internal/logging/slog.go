@@ -0,0 +1,134 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler is a slog.Handler that renders records through a Logger, so code
+// written against log/slog shares the service's format, level, and output.
+type Handler struct {
+	logger *Logger
+	attrs  []field
+	group  string
+}
+
+// NewHandler returns a slog handler backed by logger. The logger's fields
+// (from With) are included in every record.
+func NewHandler(logger *Logger) *Handler {
+	return &Handler{logger: logger}
+}
+
+// Slog returns a *slog.Logger backed by l.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(NewHandler(l))
+}
+
+// NewSlog creates a logger for service (see New) wrapped as a *slog.Logger.
+func NewSlog(service string) *slog.Logger {
+	return New(service).Slog()
+}
+
+// Enabled reports whether records at level pass the logger's minimum level.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.logger.Enabled(fromSlogLevel(level))
+}
+
+// Handle renders r. Request and tenant IDs carried by ctx are added unless
+// the logger already includes them.
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]field, 0, len(h.logger.fields)+len(h.attrs)+r.NumAttrs()+2)
+	fields = append(fields, h.logger.fields...)
+	if ctx != nil {
+		for _, f := range correlationFields(ctx) {
+			if !hasField(fields, f.key) {
+				fields = append(fields, f)
+			}
+		}
+	}
+	fields = append(fields, h.attrs...)
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.group, attr)
+		return true
+	})
+	ts := r.Time
+	if ts.IsZero() {
+		ts = h.logger.core.now()
+	}
+	h.logger.core.write(record{
+		time:    ts.UTC(),
+		level:   fromSlogLevel(r.Level),
+		service: h.logger.service,
+		message: r.Message,
+		fields:  fields,
+	})
+	return nil
+}
+
+// WithAttrs returns a handler that adds attrs to every record.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]field(nil), h.attrs...)
+	for _, attr := range attrs {
+		next.attrs = appendAttr(next.attrs, h.group, attr)
+	}
+	return &next
+}
+
+// WithGroup returns a handler that qualifies subsequent attribute keys with
+// name, joined by dots ("http.status").
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.group = qualify(h.group, name)
+	return &next
+}
+
+func appendAttr(fields []field, group string, attr slog.Attr) []field {
+	value := attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+	if value.Kind() == slog.KindGroup {
+		prefix := group
+		if attr.Key != "" {
+			prefix = qualify(group, attr.Key)
+		}
+		for _, member := range value.Group() {
+			fields = appendAttr(fields, prefix, member)
+		}
+		return fields
+	}
+	return append(fields, field{key: qualify(group, attr.Key), value: value.Any()})
+}
+
+func hasField(fields []field, key string) bool {
+	for _, f := range fields {
+		if f.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func qualify(group, key string) string {
+	if group == "" {
+		return key
+	}
+	return group + "." + key
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
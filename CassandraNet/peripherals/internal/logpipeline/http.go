@@ -3,15 +3,35 @@ package logpipeline
 import (
 	"encoding/json"
 	"errors"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
+// maxMessageLength bounds an ingested log message, in characters.
+const maxMessageLength = 32 << 10
+
+// MaxBatchEvents bounds the events in one POST /logs/batch.
+const MaxBatchEvents = 1000
+
 // Service exposes HTTP endpoints for the log pipeline.
 type Service struct {
 	pipeline *Pipeline
 	ring     *RingBufferSink
+	tail     *TailSink
+	schema   Schema
+	meter    *metering.Meter
+	clock    clock.Clock
 	logger   interface {
 		Printf(string, ...any)
 	}
@@ -21,7 +41,34 @@ type Service struct {
 func NewService(pipeline *Pipeline, ring *RingBufferSink, logger interface {
 	Printf(string, ...any)
 }) *Service {
-	return &Service{pipeline: pipeline, ring: ring, logger: logger}
+	return &Service{pipeline: pipeline, ring: ring, clock: clock.System, logger: logger}
+}
+
+// SetMeter counts the bytes of each ingested message and its fields as
+// metering.LogBytes for the request's tenant. Call it before the service
+// handles requests.
+func (s *Service) SetMeter(m *metering.Meter) {
+	s.meter = m
+}
+
+// SetClock stamps ingested events that carry no timestamp with c's time
+// instead of the system clock. Call it before the service handles requests.
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = clock.Or(c)
+}
+
+// SetTail streams the events t consumes at /logs/stream. Register t with
+// the pipeline and call SetTail before the service handles requests;
+// without it the stream answers 404.
+func (s *Service) SetTail(t *TailSink) {
+	s.tail = t
+}
+
+// SetSchema parses and checks the fields each source declares in schema
+// as they are ingested, and lets /logs/query compare them by value. Call
+// it before the service handles requests.
+func (s *Service) SetSchema(schema Schema) {
+	s.schema = schema
 }
 
 // Handler returns the HTTP handler for the service.
@@ -29,7 +76,10 @@ func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", s.handleHealth)
 	mux.HandleFunc("/logs", s.handleIngest)
+	mux.HandleFunc("/logs/batch", s.handleBatch)
 	mux.HandleFunc("/logs/recent", s.handleRecent)
+	mux.HandleFunc("/logs/stream", s.handleStream)
+	mux.HandleFunc("/logs/query", s.handleQuery)
 	return mux
 }
 
@@ -39,62 +89,183 @@ func (s *Service) handleHealth(w http.ResponseWriter, _ *http.Request) {
 }
 
 type logPayload struct {
-	Source    string            `json:"source"`
-	Level     string            `json:"level"`
-	Message   string            `json:"message"`
-	Fields    map[string]string `json:"fields"`
-	Timestamp time.Time         `json:"timestamp"`
+	Source    string                     `json:"source"`
+	Level     string                     `json:"level"`
+	Message   string                     `json:"message"`
+	Fields    map[string]json.RawMessage `json:"fields"`
+	Timestamp time.Time                  `json:"timestamp"`
 }
 
 func (s *Service) handleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "logs", http.MethodPost)
 		return
 	}
 	defer r.Body.Close()
 
 	var payload logPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, "logs.invalid_json", "invalid json", err)
 		return
 	}
-	if payload.Source == "" || payload.Message == "" {
-		http.Error(w, "source and message required", http.StatusBadRequest)
+	var v validation.Validator
+	event := s.event(&v, "", payload)
+	if validation.Write(w, r, "logs.invalid_request", v.Err()) {
 		return
 	}
+
+	if err := s.pipeline.Enqueue(event); err != nil {
+		if errors.Is(err, ErrBackpressure) {
+			problem.Write(w, r, http.StatusServiceUnavailable, "logs.backpressure", err.Error())
+			return
+		}
+		problem.Write(w, r, http.StatusInternalServerError, "logs.enqueue_failed", "failed to enqueue log")
+		return
+	}
+	s.meter.Record(r.Context(), "", metering.LogBytes, eventBytes(event))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+type batchPayload struct {
+	Events []logPayload `json:"events"`
+}
+
+// handleBatch ingests up to MaxBatchEvents events at once, all or none, so
+// a shipper can resend a refused batch without duplicating part of it.
+func (s *Service) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "logs", http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+
+	var payload batchPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, "logs.invalid_json", "invalid json", err)
+		return
+	}
+	var v validation.Validator
+	v.Check(len(payload.Events) > 0, "events", validation.RuleRequired, "is required")
+	v.Int("events", int64(len(payload.Events))).Range(0, MaxBatchEvents)
+	events := make([]LogEvent, len(payload.Events))
+	var size int64
+	for i, p := range payload.Events {
+		events[i] = s.event(&v, "events["+strconv.Itoa(i)+"].", p)
+		size += eventBytes(events[i])
+	}
+	if validation.Write(w, r, "logs.invalid_request", v.Err()) {
+		return
+	}
+	if err := s.pipeline.EnqueueBatch(events); err != nil {
+		switch {
+		case errors.Is(err, ErrBackpressure):
+			problem.Write(w, r, http.StatusServiceUnavailable, "logs.backpressure", err.Error())
+		case errors.Is(err, ErrBatchTooLarge):
+			problem.Write(w, r, http.StatusRequestEntityTooLarge, "logs.batch_too_large", err.Error())
+		default:
+			problem.Write(w, r, http.StatusInternalServerError, "logs.enqueue_failed", "failed to enqueue logs")
+		}
+		return
+	}
+	s.meter.Record(r.Context(), "", metering.LogBytes, size)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// event checks payload, naming its fields after prefix, and converts it,
+// typing the fields its source declares and stamping it with the clock's
+// time when it carries none.
+func (s *Service) event(v *validation.Validator, prefix string, payload logPayload) LogEvent {
+	v.String(prefix+"source", payload.Source).Required().MaxLength(validation.MaxIDLength)
+	v.String(prefix+"message", payload.Message).Required().MaxLength(maxMessageLength)
 	event := LogEvent{
 		Source:    payload.Source,
 		Level:     ParseLevel(payload.Level),
 		LevelName: strings.ToUpper(payload.Level),
 		Message:   payload.Message,
-		Fields:    payload.Fields,
+		Timestamp: payload.Timestamp,
+	}
+	if payload.Fields != nil {
+		event.Fields = make(map[string]string, len(payload.Fields))
 	}
-	if payload.Timestamp.IsZero() {
-		event.Timestamp = time.Now().UTC()
-	} else {
-		event.Timestamp = payload.Timestamp
+	types := s.schema[payload.Source]
+	for _, key := range slices.Sorted(maps.Keys(payload.Fields)) {
+		text, value, err := typeField(types[key], payload.Fields[key])
+		if err != nil {
+			v.Check(false, prefix+"fields."+key, validation.RuleFormat, err.Error())
+			continue
+		}
+		event.Fields[key] = text
+		if value != nil {
+			if event.Values == nil {
+				event.Values = make(map[string]any)
+			}
+			event.Values[key] = value
+		}
+	}
+	v.Map(prefix+"fields", event.Fields).Limited()
+	if event.Timestamp.IsZero() {
+		event.Timestamp = s.clock.Now()
 	}
 	if event.LevelName == "" {
 		event.LevelName = event.Level.String()
 	}
+	return event
+}
 
-	if err := s.pipeline.Enqueue(event); err != nil {
-		if errors.Is(err, ErrBackpressure) {
-			http.Error(w, err.Error(), http.StatusServiceUnavailable)
-			return
-		}
-		http.Error(w, "failed to enqueue log", http.StatusInternalServerError)
+func (s *Service) handleRecent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "logs", http.MethodGet)
 		return
 	}
-	w.WriteHeader(http.StatusAccepted)
+	paged := pagination.Requested(r)
+	page, err := pagination.Parse(r, pagination.ListLimit(paged))
+	if validation.Write(w, r, "logs.invalid_request", err) {
+		return
+	}
+	events, next := s.ring.Page(page)
+	pagination.WriteList(w, r, events, next, paged)
 }
 
-func (s *Service) handleRecent(w http.ResponseWriter, r *http.Request) {
+// handleStream sends each processed event from source, or from every
+// source when none is given, at or above level as a "log" event, until the
+// client leaves. A client that reconnects with the ID of the last event it
+// saw first receives the events it missed, while they are still buffered.
+func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "logs", http.MethodGet)
+		return
+	}
+	if s.tail == nil {
+		problem.Write(w, r, http.StatusNotFound, "logs.not_found", "log streaming is not enabled")
 		return
 	}
-	events := s.ring.Recent()
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(events)
+	query := r.URL.Query()
+	source, level := query.Get("source"), query.Get("level")
+	var v validation.Validator
+	v.String("level", strings.ToUpper(level)).OneOf("DEBUG", "INFO", "WARN", "ERROR")
+	if validation.Write(w, r, "logs.invalid_request", v.Err()) {
+		return
+	}
+	minLevel := ParseLevel(level)
+	if level == "" {
+		minLevel = LevelDebug
+	}
+	sub, _ := s.tail.hub.Subscribe(func(event LogEvent) bool {
+		return (source == "" || event.Source == source) && event.Level >= minLevel
+	}, sse.LastEventID(r))
+	defer sub.Close()
+	stream, ok := sse.Open(w, r, "logs")
+	if !ok {
+		return
+	}
+	_ = sse.Relay(r.Context(), stream, sub, "log", 0, nil)
+}
+
+// eventBytes is the metered size of event: its message and field text.
+func eventBytes(event LogEvent) int64 {
+	n := len(event.Message)
+	for k, v := range event.Fields {
+		n += len(k) + len(v)
+	}
+	return int64(n)
 }
@@ -1,12 +1,18 @@
 package logpipeline
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
 )
 
 func TestServiceIngestAndRecent(t *testing.T) {
@@ -15,9 +21,11 @@ func TestServiceIngestAndRecent(t *testing.T) {
 	ring := NewRingBufferSink(10)
 	pipeline.RegisterSink(ring)
 	pipeline.Start()
-	defer pipeline.Stop()
+	defer pipeline.Stop(context.Background())
 
 	svc := NewService(pipeline, ring, logger)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.SetClock(clock.NewFake(now))
 	server := httptest.NewServer(svc.Handler())
 	t.Cleanup(server.Close)
 
@@ -58,4 +66,221 @@ func TestServiceIngestAndRecent(t *testing.T) {
 	if len(recent) == 0 {
 		t.Fatal("expected at least one log event")
 	}
+	if !recent[0].Timestamp.Equal(now) {
+		t.Fatalf("expected the clock's time on an unstamped event, got %v", recent[0].Timestamp)
+	}
+}
+
+func TestServiceIngestBatch(t *testing.T) {
+	logger := noOpLogger{}
+	pipeline := NewPipeline(4, LevelDebug, logger)
+	ring := NewRingBufferSink(10)
+	pipeline.RegisterSink(ring)
+	pipeline.Start()
+	defer pipeline.Stop(context.Background())
+
+	svc := NewService(pipeline, ring, logger)
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	post := func(events ...map[string]any) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"events": events})
+		resp, err := http.Post(server.URL+"/logs/batch", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("batch failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp
+	}
+	line := func(msg string) map[string]any {
+		return map[string]any{"source": "host-1", "level": "info", "message": msg}
+	}
+
+	if resp := post(line("one"), line("two"), line("three")); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 got %d", resp.StatusCode)
+	}
+	if resp := post(line("ok"), line("")); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an event without a message, got %d", resp.StatusCode)
+	}
+	if resp := post(line("a"), line("b"), line("c"), line("d"), line("e")); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for a batch larger than the queue, got %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(ring.Recent()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var got []string
+	for _, event := range ring.Recent() {
+		got = append(got, event.Message)
+	}
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Fatalf("expected only the accepted batch, in order, got %v", got)
+	}
+}
+
+func TestServiceStreamsFilteredLogs(t *testing.T) {
+	logger := noOpLogger{}
+	pipeline := NewPipeline(8, LevelDebug, logger)
+	ring := NewRingBufferSink(10)
+	tail := NewTailSink()
+	pipeline.RegisterSink(ring)
+	pipeline.RegisterSink(tail)
+	pipeline.Start()
+	defer pipeline.Stop(context.Background())
+
+	svc := NewService(pipeline, ring, logger)
+	svc.SetTail(tail)
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	if resp, err := http.Get(server.URL + "/logs/stream?level=loud"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unknown level to be rejected, got %v %v", resp, err)
+	}
+	resp, err := http.Get(server.URL + "/logs/stream?source=svc&level=warn")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream: %v %v", resp, err)
+	}
+	defer resp.Body.Close()
+
+	for _, payload := range []string{
+		`{"source":"svc","level":"info","message":"too quiet"}`,
+		`{"source":"other","level":"error","message":"wrong source"}`,
+		`{"source":"svc","level":"error","message":"disk full"}`,
+	} {
+		ingest, err := http.Post(server.URL+"/logs", "application/json", strings.NewReader(payload))
+		if err != nil || ingest.StatusCode != http.StatusAccepted {
+			t.Fatalf("ingest: %v %v", ingest, err)
+		}
+		_ = ingest.Body.Close()
+	}
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	var event, data string
+	for data == "" {
+		select {
+		case line := <-lines:
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+			}
+			if payload, ok := strings.CutPrefix(line, "data: "); ok {
+				data = payload
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a streamed log")
+		}
+	}
+	var got LogEvent
+	if err := json.Unmarshal([]byte(data), &got); err != nil || event != "log" || got.Message != "disk full" {
+		t.Fatalf("expected the svc error first, got %s %s", event, data)
+	}
+}
+
+func TestServiceTypesFieldsAndQueriesRanges(t *testing.T) {
+	logger := noOpLogger{}
+	pipeline := NewPipeline(8, LevelDebug, logger)
+	ring := NewRingBufferSink(10)
+	pipeline.RegisterSink(ring)
+	pipeline.Start()
+	defer pipeline.Stop(context.Background())
+
+	schema, err := ParseSchema([]string{"gateway:latency_ms=number", "gateway:cached=boolean", "gateway:started_at=Timestamp"})
+	if err != nil {
+		t.Fatalf("parse schema: %v", err)
+	}
+	svc := NewService(pipeline, ring, logger)
+	svc.SetSchema(schema)
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	ingest := func(payload string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/logs", "application/json", strings.NewReader(payload))
+		if err != nil {
+			t.Fatalf("ingest: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, payload := range []string{
+		`{"source":"gateway","message":"fast","fields":{"latency_ms":12,"cached":true,"route":"/a"}}`,
+		`{"source":"gateway","message":"slow","fields":{"latency_ms":"450.50","cached":"false","started_at":"2026-03-01T12:00:00+01:00"}}`,
+		`{"source":"worker","message":"untyped","fields":{"latency_ms":"900"}}`,
+	} {
+		if status := ingest(payload); status != http.StatusAccepted {
+			t.Fatalf("expected 202 for %s, got %d", payload, status)
+		}
+	}
+	for _, payload := range []string{
+		`{"source":"gateway","message":"bad","fields":{"latency_ms":"fast"}}`,
+		`{"source":"gateway","message":"bad","fields":{"started_at":"yesterday"}}`,
+		`{"source":"worker","message":"bad","fields":{"latency_ms":900}}`,
+	} {
+		if status := ingest(payload); status != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", payload, status)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(ring.Recent()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	slow := ring.Recent()[1]
+	if slow.Fields["latency_ms"] != "450.5" || slow.Values["latency_ms"] != 450.5 || slow.Values["cached"] != false || slow.Fields["started_at"] != "2026-03-01T11:00:00Z" {
+		t.Fatalf("expected typed, normalised fields, got %+v %+v", slow.Fields, slow.Values)
+	}
+
+	search := func(query string) []string {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/logs/query?" + query)
+		if err != nil {
+			t.Fatalf("query: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("query %s: status %d", query, resp.StatusCode)
+		}
+		var page pagination.Page[LogEvent]
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		var got []string
+		for _, event := range page.Items {
+			got = append(got, event.Message)
+		}
+		return got
+	}
+	for query, want := range map[string]string{
+		"where=latency_ms%3E%3D100":                                    "slow",
+		"where=latency_ms%3C100&where=cached=true":                     "fast",
+		"where=latency_ms=900":                                         "untyped",
+		"where=started_at%3E2026-03-01T10:00:00Z":                      "slow",
+		"source=gateway&where=route!%3D/b":                             "fast",
+		"where=latency_ms%3E10&where=latency_ms%3C1000&source=gateway": "fast,slow",
+	} {
+		if got := strings.Join(search(query), ","); got != want {
+			t.Fatalf("query %s: expected %q, got %q", query, want, got)
+		}
+	}
+	for _, query := range []string{"where=latency_ms", "where=route%3Eabc", "where=%3D1"} {
+		resp, err := http.Get(server.URL + "/logs/query?" + query)
+		if err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %v %v", query, resp, err)
+		}
+		_ = resp.Body.Close()
+	}
+}
+
+func TestParseSchemaRejectsMalformedEntries(t *testing.T) {
+	for _, entry := range []string{"latency_ms=number", "gateway:latency_ms", "gateway:latency_ms=integer", ":x=number"} {
+		if _, err := ParseSchema([]string{entry}); err == nil {
+			t.Fatalf("expected %q rejected", entry)
+		}
+	}
 }
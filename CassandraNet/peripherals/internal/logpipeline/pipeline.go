@@ -1,15 +1,20 @@
 package logpipeline
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	// ErrBackpressure is returned when the pipeline queue is full.
 	ErrBackpressure = errors.New("log pipeline backpressure: queue full")
+	// ErrBatchTooLarge is returned for a batch the queue could not hold
+	// even when empty.
+	ErrBatchTooLarge = errors.New("log pipeline: batch larger than the queue")
 )
 
 // Level models a log severity.
@@ -43,7 +48,10 @@ type LogEvent struct {
 	LevelName string            `json:"level"`
 	Message   string            `json:"message"`
 	Fields    map[string]string `json:"fields"`
-	Timestamp time.Time         `json:"timestamp"`
+	// Values holds the parsed values of the fields the source's schema
+	// types as numbers (float64), booleans, or timestamps (time.Time).
+	Values    map[string]any `json:"values,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
 }
 
 // Sink receives processed log events.
@@ -57,11 +65,25 @@ type Pipeline struct {
 		Printf(string, ...any)
 	}
 	sinks    []Sink
-	events   chan LogEvent
-	minLevel Level
-	wg       sync.WaitGroup
-	once     sync.Once
-	stopOnce sync.Once
+	minLevel atomic.Int32
+
+	// mu guards events, which Resize replaces, and stopped. Senders hold
+	// the read lock so a replaced channel is closed only once nothing can
+	// send to it.
+	mu      sync.RWMutex
+	events  chan LogEvent
+	stopped bool
+	running atomic.Bool
+	// pending counts the events enqueued and not yet delivered.
+	pending atomic.Int64
+	// abort is closed when Stop gives up waiting, and done once the
+	// dispatch loop has exited after Stop.
+	abort     chan struct{}
+	abortOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+	once      sync.Once
+	stopOnce  sync.Once
 }
 
 // NewPipeline creates a pipeline with the specified buffer and minimum level.
@@ -72,13 +94,26 @@ func NewPipeline(buffer int, minLevel Level, logger interface {
 		buffer = 64
 	}
 	p := &Pipeline{
-		logger:   logger,
-		events:   make(chan LogEvent, buffer),
-		minLevel: minLevel,
+		logger: logger,
+		events: make(chan LogEvent, buffer),
+		abort:  make(chan struct{}),
+		done:   make(chan struct{}),
 	}
+	p.minLevel.Store(int32(minLevel))
 	return p
 }
 
+// SetMinLevel changes the minimum severity accepted by Enqueue. It is safe
+// to call while the pipeline is running.
+func (p *Pipeline) SetMinLevel(level Level) {
+	p.minLevel.Store(int32(level))
+}
+
+// MinLevel reports the minimum severity currently accepted.
+func (p *Pipeline) MinLevel() Level {
+	return Level(p.minLevel.Load())
+}
+
 // RegisterSink registers a sink for processed events. It must be called before Start.
 func (p *Pipeline) RegisterSink(s Sink) {
 	p.sinks = append(p.sinks, s)
@@ -87,37 +122,174 @@ func (p *Pipeline) RegisterSink(s Sink) {
 // Start launches the dispatch loop.
 func (p *Pipeline) Start() {
 	p.once.Do(func() {
+		p.running.Store(true)
 		p.wg.Add(1)
 		go func() {
 			defer p.wg.Done()
-			for event := range p.events {
-				for _, sink := range p.sinks {
-					if err := sink.Consume(event); err != nil {
-						p.logger.Printf("log sink error: %v", err)
+			events := p.queue()
+			for {
+				for event := range events {
+					select {
+					case <-p.abort:
+						// Stop has already counted the rest abandoned.
+						return
+					default:
 					}
+					for _, sink := range p.sinks {
+						if err := sink.Consume(event); err != nil {
+							p.logger.Printf("log sink error: %v", err)
+						}
+					}
+					p.pending.Add(-1)
+				}
+				// A drained channel was either replaced by Resize, and the
+				// events sent after the swap wait in its successor, or
+				// closed by Stop.
+				next := p.queue()
+				if next == events {
+					return
 				}
+				events = next
 			}
 		}()
 	})
 }
 
-// Stop waits for the dispatch loop to drain remaining events.
-func (p *Pipeline) Stop() {
+func (p *Pipeline) queue() chan LogEvent {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.events
+}
+
+// Stop stops accepting events and waits for the dispatch loop to deliver
+// those already queued. If ctx ends first, the loop exits after the event
+// it is delivering and Stop returns ctx's error with the number of events
+// queued or being delivered, which may not reach the sinks; otherwise it
+// returns the events left queued with no loop to deliver them, as in a
+// pipeline that was never started.
+func (p *Pipeline) Stop(ctx context.Context) (abandoned int, err error) {
 	p.stopOnce.Do(func() {
+		p.running.Store(false)
+		p.mu.Lock()
+		p.stopped = true
 		close(p.events)
-		p.wg.Wait()
+		p.mu.Unlock()
+		go func() {
+			p.wg.Wait()
+			close(p.done)
+		}()
 	})
+	select {
+	case <-p.done:
+		return int(p.pending.Load()), nil
+	case <-ctx.Done():
+		p.abortOnce.Do(func() { close(p.abort) })
+		return int(p.pending.Load()), ctx.Err()
+	}
+}
+
+// Resize replaces the queue with one holding buffer events (default 64).
+// Events already queued are delivered first, in order, so for a moment the
+// pipeline holds more than buffer events. It is safe to call while the
+// pipeline is running and does nothing after Stop.
+func (p *Pipeline) Resize(buffer int) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped || cap(p.events) == buffer {
+		return
+	}
+	old := p.events
+	p.events = make(chan LogEvent, buffer)
+	close(old)
+}
+
+// Check reports whether the pipeline can accept events: it must be running
+// and its queue must have room.
+func (p *Pipeline) Check(context.Context) error {
+	if !p.running.Load() {
+		return errors.New("log pipeline: not running")
+	}
+	if events := p.queue(); len(events) == cap(events) {
+		return ErrBackpressure
+	}
+	return nil
+}
+
+// PipelineStats describes a pipeline's queue at one moment.
+type PipelineStats struct {
+	Running  bool   `json:"running"`
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	MinLevel string `json:"min_level"`
 }
 
-// Enqueue submits a log event for processing.
+// Stats reports whether the pipeline is running and how full its queue is.
+func (p *Pipeline) Stats() PipelineStats {
+	events := p.queue()
+	return PipelineStats{
+		Running:  p.running.Load(),
+		Queued:   len(events),
+		Capacity: cap(events),
+		MinLevel: p.MinLevel().String(),
+	}
+}
+
+// Enqueue submits a log event for processing. It returns ErrBackpressure
+// when the queue is full or the pipeline has stopped.
 func (p *Pipeline) Enqueue(event LogEvent) error {
-	if event.Level < p.minLevel {
+	if event.Level < p.MinLevel() {
 		return nil
 	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return ErrBackpressure
+	}
+	// Counting first keeps pending from going negative when the dispatch
+	// loop takes the event at once.
+	p.pending.Add(1)
 	select {
 	case p.events <- event:
 		return nil
 	default:
+		p.pending.Add(-1)
+		return ErrBackpressure
+	}
+}
+
+// EnqueueBatch submits events for processing, all or none. It returns
+// ErrBackpressure when the queue lacks room for the events at or above the
+// minimum level, or the pipeline has stopped, and ErrBatchTooLarge when
+// they outnumber the queue's capacity.
+func (p *Pipeline) EnqueueBatch(events []LogEvent) error {
+	minLevel := p.MinLevel()
+	// The write lock keeps other senders out between the room check and
+	// the sends; the dispatch loop only frees room meanwhile.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
 		return ErrBackpressure
 	}
+	n := 0
+	for _, event := range events {
+		if event.Level >= minLevel {
+			n++
+		}
+	}
+	if n > cap(p.events) {
+		return ErrBatchTooLarge
+	}
+	if n > cap(p.events)-len(p.events) {
+		return ErrBackpressure
+	}
+	p.pending.Add(int64(n))
+	for _, event := range events {
+		if event.Level >= minLevel {
+			p.events <- event
+		}
+	}
+	return nil
 }
@@ -1,10 +1,14 @@
 package logpipeline
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
 )
 
 type captureSink struct {
@@ -37,7 +41,7 @@ func TestPipelineEnqueueAndDispatch(t *testing.T) {
 	sink := &captureSink{}
 	pipeline.RegisterSink(sink)
 	pipeline.Start()
-	defer pipeline.Stop()
+	defer pipeline.Stop(context.Background())
 
 	evt := LogEvent{Source: "svc", Level: LevelInfo, LevelName: "INFO", Message: "hello", Timestamp: time.Now()}
 	if err := pipeline.Enqueue(evt); err != nil {
@@ -57,7 +61,7 @@ func TestPipelineBackpressure(t *testing.T) {
 	sink := &captureSink{}
 	pipeline.RegisterSink(sink)
 	pipeline.Start()
-	defer pipeline.Stop()
+	defer pipeline.Stop(context.Background())
 
 	evt := LogEvent{Source: "svc", Level: LevelInfo, LevelName: "INFO", Message: "hello", Timestamp: time.Now()}
 	if err := pipeline.Enqueue(evt); err != nil {
@@ -68,6 +72,45 @@ func TestPipelineBackpressure(t *testing.T) {
 	}
 }
 
+func TestPipelineEnqueueBatchAllOrNone(t *testing.T) {
+	pipeline := NewPipeline(3, LevelInfo, noOpLogger{})
+	evt := LogEvent{Source: "svc", Level: LevelInfo, LevelName: "INFO", Message: "hello", Timestamp: time.Now()}
+	debug := LogEvent{Source: "svc", Level: LevelDebug, LevelName: "DEBUG", Message: "noise", Timestamp: time.Now()}
+
+	if err := pipeline.EnqueueBatch([]LogEvent{evt, debug, evt}); err != nil {
+		t.Fatalf("enqueue batch failed: %v", err)
+	}
+	if got := pipeline.Stats().Queued; got != 2 {
+		t.Fatalf("expected the two info events queued, got %d", got)
+	}
+	if err := pipeline.EnqueueBatch([]LogEvent{evt, evt}); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("expected backpressure error, got %v", err)
+	}
+	if got := pipeline.Stats().Queued; got != 2 {
+		t.Fatalf("expected a refused batch to queue nothing, got %d queued", got)
+	}
+	if err := pipeline.EnqueueBatch([]LogEvent{evt, evt, evt, evt}); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("expected batch too large error, got %v", err)
+	}
+}
+
+func TestPipelineSetMinLevel(t *testing.T) {
+	pipeline := NewPipeline(4, LevelInfo, noOpLogger{})
+	sink := &captureSink{}
+	pipeline.RegisterSink(sink)
+	pipeline.Start()
+
+	debug := LogEvent{Source: "svc", Level: LevelDebug, LevelName: "DEBUG", Message: "verbose"}
+	_ = pipeline.Enqueue(debug)
+	pipeline.SetMinLevel(LevelDebug)
+	_ = pipeline.Enqueue(debug)
+	pipeline.Stop(context.Background())
+
+	if events := sink.snapshot(); len(events) != 1 {
+		t.Fatalf("expected only the event after lowering the level, got %d", len(events))
+	}
+}
+
 func TestRingBufferCapacity(t *testing.T) {
 	ring := NewRingBufferSink(2)
 	_ = ring.Consume(LogEvent{Message: "first"})
@@ -82,3 +125,137 @@ func TestRingBufferCapacity(t *testing.T) {
 		t.Fatalf("unexpected order: %+v", recent)
 	}
 }
+
+func TestRingBufferPageSurvivesEviction(t *testing.T) {
+	ring := NewRingBufferSink(3)
+	for _, message := range []string{"a", "b", "c"} {
+		_ = ring.Consume(LogEvent{Message: message})
+	}
+	first, next := ring.Page(pagination.Request{Limit: 2})
+	if len(first) != 2 || first[1].Message != "b" || next == "" {
+		t.Fatalf("unexpected first page %+v next %q", first, next)
+	}
+	_ = ring.Consume(LogEvent{Message: "d"})
+	second, next := ring.Page(pagination.Request{Limit: 2, After: next})
+	if len(second) != 2 || second[0].Message != "c" || second[1].Message != "d" || next != "" {
+		t.Fatalf("unexpected second page %+v next %q", second, next)
+	}
+}
+
+func TestPipelineCheck(t *testing.T) {
+	pipeline := NewPipeline(4, LevelInfo, noOpLogger{})
+	if err := pipeline.Check(context.Background()); err == nil {
+		t.Fatal("expected unstarted pipeline to fail its check")
+	}
+	pipeline.Start()
+	if err := pipeline.Check(context.Background()); err != nil {
+		t.Fatalf("expected running pipeline to pass, got %v", err)
+	}
+	pipeline.Stop(context.Background())
+	if err := pipeline.Check(context.Background()); err == nil {
+		t.Fatal("expected stopped pipeline to fail its check")
+	}
+}
+
+// gatedSink holds every event until the gate is closed.
+type gatedSink struct {
+	captureSink
+	gate chan struct{}
+}
+
+func (g *gatedSink) Consume(event LogEvent) error {
+	<-g.gate
+	return g.captureSink.Consume(event)
+}
+
+func TestPipelineResizeKeepsOrder(t *testing.T) {
+	pipeline := NewPipeline(2, LevelInfo, noOpLogger{})
+	sink := &gatedSink{gate: make(chan struct{})}
+	pipeline.RegisterSink(sink)
+	pipeline.Start()
+
+	enqueue := func(msg string) error {
+		return pipeline.Enqueue(LogEvent{Source: "svc", Level: LevelInfo, Message: msg})
+	}
+	// The first event is taken by the blocked dispatcher; two more fill the
+	// queue.
+	var sent []string
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		if err := enqueue(msg); err == nil {
+			sent = append(sent, msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(sent) != 3 {
+		t.Fatalf("expected a full queue after three events, sent %v", sent)
+	}
+
+	pipeline.Resize(8)
+	if stats := pipeline.Stats(); stats.Capacity != 8 || stats.Queued != 0 {
+		t.Fatalf("expected an empty queue of 8, got %+v", stats)
+	}
+	for _, msg := range []string{"e", "f", "g"} {
+		if err := enqueue(msg); err != nil {
+			t.Fatalf("enqueue %s after resize: %v", msg, err)
+		}
+		sent = append(sent, msg)
+	}
+	close(sink.gate)
+	pipeline.Stop(context.Background())
+	pipeline.Resize(16)
+
+	var got []string
+	for _, e := range sink.snapshot() {
+		got = append(got, e.Message)
+	}
+	if strings.Join(got, "") != strings.Join(sent, "") {
+		t.Fatalf("expected %v delivered in order, got %v", sent, got)
+	}
+	if err := enqueue("h"); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("expected a stopped pipeline to refuse events, got %v", err)
+	}
+}
+
+// blockingSink holds each event until release is closed.
+type blockingSink struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSink) Consume(LogEvent) error {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+	<-b.release
+	return nil
+}
+
+func TestPipelineStopAbandonsEventsAtDeadline(t *testing.T) {
+	sink := &blockingSink{started: make(chan struct{}, 1), release: make(chan struct{})}
+	pipeline := NewPipeline(8, LevelInfo, noOpLogger{})
+	pipeline.RegisterSink(sink)
+	pipeline.Start()
+	evt := LogEvent{Source: "svc", Level: LevelInfo, LevelName: "INFO", Message: "hello"}
+	for range 3 {
+		if err := pipeline.Enqueue(evt); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	<-sink.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	abandoned, err := pipeline.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || abandoned != 3 {
+		t.Fatalf("expected 3 events abandoned at the deadline, got %d %v", abandoned, err)
+	}
+	if err := pipeline.Enqueue(evt); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("expected a stopped pipeline to refuse events, got %v", err)
+	}
+	// The event being delivered finishes; the queued ones are dropped.
+	close(sink.release)
+	if abandoned, err := pipeline.Stop(context.Background()); err != nil || abandoned != 2 {
+		t.Fatalf("expected the queued events left undelivered, got %d %v", abandoned, err)
+	}
+}
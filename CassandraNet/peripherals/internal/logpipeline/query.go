@@ -0,0 +1,156 @@
+package logpipeline
+
+import (
+	"cmp"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// maxConditions bounds the where parameters of one query.
+const maxConditions = 16
+
+// operators lists the comparisons a condition may use, longest first so
+// "<=" is not read as "<".
+var operators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// condition compares one field of an event with a value. Fields the
+// event's source types are compared as their type, numbers numerically
+// and timestamps in time order; other fields are compared as text and
+// only for equality.
+type condition struct {
+	field string
+	op    string
+	value string
+
+	number    *float64
+	timestamp *time.Time
+	boolean   *bool
+}
+
+// parseCondition reads a condition such as "latency_ms>=250" or
+// "cached=true".
+func parseCondition(raw string) (condition, bool) {
+	i := strings.IndexAny(raw, "!=<>")
+	if i <= 0 {
+		return condition{}, false
+	}
+	c := condition{field: raw[:i]}
+	for _, op := range operators {
+		if rest, ok := strings.CutPrefix(raw[i:], op); ok {
+			c.op, c.value = op, rest
+			break
+		}
+	}
+	if c.op == "" {
+		return condition{}, false
+	}
+	if n, err := strconv.ParseFloat(c.value, 64); err == nil {
+		c.number = &n
+	}
+	if t, err := time.Parse(time.RFC3339Nano, c.value); err == nil {
+		c.timestamp = &t
+	}
+	if b, err := strconv.ParseBool(c.value); err == nil {
+		c.boolean = &b
+	}
+	ordered := c.op != "=" && c.op != "!="
+	if ordered && c.number == nil && c.timestamp == nil {
+		return condition{}, false
+	}
+	return c, true
+}
+
+// match reports whether event satisfies c. An event without the field
+// matches no condition.
+func (c condition) match(event LogEvent) bool {
+	switch v := event.Values[c.field].(type) {
+	case float64:
+		return c.number != nil && compare(c.op, cmp.Compare(v, *c.number))
+	case time.Time:
+		return c.timestamp != nil && compare(c.op, v.Compare(*c.timestamp))
+	case bool:
+		if c.boolean == nil || (c.op != "=" && c.op != "!=") {
+			return false
+		}
+		return (v == *c.boolean) == (c.op == "=")
+	}
+	text, ok := event.Fields[c.field]
+	if !ok {
+		return false
+	}
+	switch c.op {
+	case "=":
+		return text == c.value
+	case "!=":
+		return text != c.value
+	default:
+		return false
+	}
+}
+
+// compare reports whether a comparison result satisfies op.
+func compare(op string, result int) bool {
+	switch op {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	case ">":
+		return result > 0
+	default:
+		return result >= 0
+	}
+}
+
+// handleQuery pages through the buffered events from source at or above
+// level that satisfy every where condition, oldest first.
+func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "logs", http.MethodGet)
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if validation.Write(w, r, "logs.invalid_request", err) {
+		return
+	}
+	query := r.URL.Query()
+	source, level := query.Get("source"), query.Get("level")
+	var v validation.Validator
+	v.String("level", strings.ToUpper(level)).OneOf("DEBUG", "INFO", "WARN", "ERROR")
+	v.Int("where", int64(len(query["where"]))).Range(0, maxConditions)
+	conditions := make([]condition, 0, len(query["where"]))
+	for _, raw := range query["where"] {
+		c, ok := parseCondition(raw)
+		v.Check(ok, "where", validation.RuleFormat, "must be field, an operator (=, !=, <, <=, >, >=), and a value; <, <=, >, and >= need a number or RFC 3339 timestamp")
+		conditions = append(conditions, c)
+	}
+	if validation.Write(w, r, "logs.invalid_request", v.Err()) {
+		return
+	}
+	minLevel := ParseLevel(level)
+	if level == "" {
+		minLevel = LevelDebug
+	}
+	events, next := s.ring.Query(page, func(event LogEvent) bool {
+		if (source != "" && event.Source != source) || event.Level < minLevel {
+			return false
+		}
+		for _, c := range conditions {
+			if !c.match(event) {
+				return false
+			}
+		}
+		return true
+	})
+	pagination.Write(w, r, events, next)
+}
@@ -1,12 +1,19 @@
 package logpipeline
 
-import "sync"
+import (
+	"fmt"
+	"sync"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
 
 // RingBufferSink keeps the most recent log events in memory for debugging.
 type RingBufferSink struct {
 	mu       sync.RWMutex
 	capacity int
 	entries  []LogEvent
+	// seq numbers the events consumed so far; the last entry is event seq.
+	seq uint64
 }
 
 // NewRingBufferSink constructs a sink with bounded capacity.
@@ -22,6 +29,7 @@ func (r *RingBufferSink) Consume(event LogEvent) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.entries = append(r.entries, event)
+	r.seq++
 	if len(r.entries) > r.capacity {
 		r.entries = r.entries[len(r.entries)-r.capacity:]
 	}
@@ -36,3 +44,29 @@ func (r *RingBufferSink) Recent() []LogEvent {
 	copy(snapshot, r.entries)
 	return snapshot
 }
+
+// Page returns one page of the buffered events in chronological order, and
+// the position of the next page. Positions are event sequence numbers, so
+// a cursor stays valid while newer events evict older ones.
+func (r *RingBufferSink) Page(page pagination.Request) ([]LogEvent, string) {
+	return r.Query(page, nil)
+}
+
+// Query is Page over the buffered events match accepts; a nil match
+// accepts every event.
+func (r *RingBufferSink) Query(page pagination.Request, match func(LogEvent) bool) ([]LogEvent, string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	collector := pagination.NewCollector[LogEvent](page)
+	first := r.seq - uint64(len(r.entries)) + 1
+	for i, event := range r.entries {
+		position := fmt.Sprintf("%020d", first+uint64(i))
+		if collector.Skip(position) || (match != nil && !match(event)) {
+			continue
+		}
+		if !collector.Add(position, event) {
+			break
+		}
+	}
+	return collector.Page()
+}
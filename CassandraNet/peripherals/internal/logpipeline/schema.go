@@ -0,0 +1,91 @@
+package logpipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType is the type a source declares for one of its fields.
+type FieldType string
+
+// Field types. Fields a source does not declare are strings.
+const (
+	FieldString    FieldType = "string"
+	FieldNumber    FieldType = "number"
+	FieldBoolean   FieldType = "boolean"
+	FieldTimestamp FieldType = "timestamp"
+)
+
+// Schema maps each source to the types of its declared fields.
+type Schema map[string]map[string]FieldType
+
+// ParseSchema reads "source:field=type" entries, such as
+// "gateway:latency_ms=number", as FIELD_TYPES lists them.
+func ParseSchema(entries []string) (Schema, error) {
+	schema := make(Schema)
+	for _, spec := range entries {
+		name, raw, ok := strings.Cut(spec, "=")
+		source, field, hasField := strings.Cut(strings.TrimSpace(name), ":")
+		if !ok || !hasField || source == "" || field == "" {
+			return nil, fmt.Errorf("%q must be source:field=type", spec)
+		}
+		typ := FieldType(strings.ToLower(strings.TrimSpace(raw)))
+		switch typ {
+		case FieldString, FieldNumber, FieldBoolean, FieldTimestamp:
+		default:
+			return nil, fmt.Errorf("%q needs a type of string, number, boolean, or timestamp", spec)
+		}
+		if schema[source] == nil {
+			schema[source] = make(map[string]FieldType)
+		}
+		schema[source][field] = typ
+	}
+	return schema, nil
+}
+
+// typeField parses raw, a field's JSON value, as typ. It returns the
+// field's text and, for numbers, booleans, and timestamps, its typed
+// value. Typed fields accept their JSON type or a string holding it, and
+// their text is normalised so equal values read the same; other fields
+// must be strings.
+func typeField(typ FieldType, raw json.RawMessage) (string, any, error) {
+	var text string
+	quoted := json.Unmarshal(raw, &text) == nil
+	switch typ {
+	case FieldNumber:
+		if !quoted {
+			text = string(raw)
+		}
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			return "", nil, errors.New("must be a number")
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), n, nil
+	case FieldBoolean:
+		if !quoted {
+			text = string(raw)
+		}
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return "", nil, errors.New("must be true or false")
+		}
+		return strconv.FormatBool(b), b, nil
+	case FieldTimestamp:
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if !quoted || err != nil {
+			return "", nil, errors.New("must be an RFC 3339 timestamp")
+		}
+		t = t.UTC()
+		return t.Format(time.RFC3339Nano), t, nil
+	default:
+		if !quoted {
+			return "", nil, errors.New("must be a string")
+		}
+		return text, nil, nil
+	}
+}
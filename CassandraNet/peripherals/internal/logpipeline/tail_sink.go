@@ -0,0 +1,19 @@
+package logpipeline
+
+import "github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+
+// TailSink hands processed events to the clients following /logs/stream.
+type TailSink struct {
+	hub *sse.Hub[LogEvent]
+}
+
+// NewTailSink returns a sink with no followers.
+func NewTailSink() *TailSink {
+	return &TailSink{hub: sse.NewHub[LogEvent](sse.Config{})}
+}
+
+// Consume passes the event to every follower whose filter it matches.
+func (t *TailSink) Consume(event LogEvent) error {
+	t.hub.Publish(event)
+	return nil
+}
@@ -0,0 +1,314 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrDeadLetterPolicyNotFound is returned when a topic has no dead-letter
+// policy for the tenant, nor one for every tenant.
+var ErrDeadLetterPolicyNotFound = errors.New("messaging: dead-letter policy not found")
+
+// Attributes marking a message moved to a dead-letter topic: the topic it
+// was pulled from, its ID there, and the subscription that ran out of
+// deliveries when it was one. Replays send it back to that topic.
+const (
+	AttrDeadLetterSourceTopic        = "dead_letter_source_topic"
+	AttrDeadLetterSourceMessageID    = "dead_letter_source_message_id"
+	AttrDeadLetterSourceSubscription = "dead_letter_source_subscription"
+)
+
+// DeadLetterSuffix names the dead-letter topic of a policy that names
+// none: the topic followed by the suffix.
+const DeadLetterSuffix = ".dlq"
+
+// maxDeadLetterDeliveries bounds a policy's deliveries.
+const maxDeadLetterDeliveries = 100
+
+// deadLetterClaim is how long a message that ran out of deliveries is kept
+// from other pulls while it is moved.
+const deadLetterClaim = time.Minute
+
+// DeadLetterPolicy moves a tenant's messages out of a topic once leasing
+// pulls have delivered them MaxDeliveries times without an ack, after the
+// last lease expires or is nacked, to DeadLetterTopic. A subscription
+// delivering a message MaxDeliveries times without an ack sends a copy
+// there instead, once the last ack deadline passes, and leaves the topic's
+// message to the other subscriptions. A policy with an empty TenantID
+// applies to the tenants without their own.
+type DeadLetterPolicy struct {
+	TenantID        string    `json:"tenant_id,omitempty"`
+	Topic           string    `json:"topic"`
+	MaxDeliveries   int       `json:"max_deliveries"`
+	DeadLetterTopic string    `json:"dead_letter_topic"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// DeadLetterStore persists dead-letter policies.
+type DeadLetterStore interface {
+	// PutDeadLetterPolicy creates or replaces the tenant's policy for
+	// policy.Topic, keeping the creation time of the policy it replaces,
+	// and reports whether it created one.
+	PutDeadLetterPolicy(ctx context.Context, policy DeadLetterPolicy) (DeadLetterPolicy, bool, error)
+	GetDeadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error)
+	// DeadLetterPolicies returns every tenant's policy for topic.
+	DeadLetterPolicies(ctx context.Context, topic string) ([]DeadLetterPolicy, error)
+	DeleteDeadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error)
+}
+
+// SetDeadLetterStore applies the dead-letter policies kept in ds to
+// leasing pulls and serves them at /topics/{topic}/dead-letter. Without it,
+// or without SetLeaseStore, messages are redelivered without limit and
+// those paths answer 404. Call it before the service handles requests.
+func (s *Service) SetDeadLetterStore(ds DeadLetterStore) {
+	s.deadLetters = ds
+}
+
+// PutDeadLetterPolicy sets the tenant's dead-letter policy for topic, or
+// the policy of every tenant without one when tenantID is empty, and
+// reports whether it created one. An empty deadLetterTopic means the topic
+// followed by DeadLetterSuffix.
+func (s *Service) PutDeadLetterPolicy(ctx context.Context, tenantID, topic string, maxDeliveries int, deadLetterTopic string) (DeadLetterPolicy, bool, error) {
+	if s.deadLetters == nil {
+		return DeadLetterPolicy{}, false, ErrDeadLetterPolicyNotFound
+	}
+	if deadLetterTopic == "" {
+		deadLetterTopic = topic + DeadLetterSuffix
+	}
+	var v validation.Validator
+	v.String("tenant_id", tenantID).MaxLength(validation.MaxIDLength)
+	v.String("topic", topic).Required().MaxLength(maxTopicLength)
+	v.Int("max_deliveries", int64(maxDeliveries)).Range(1, maxDeadLetterDeliveries)
+	v.String("dead_letter_topic", deadLetterTopic).MaxLength(maxTopicLength)
+	v.Check(deadLetterTopic != topic, "dead_letter_topic", validation.RuleFormat, "must differ from the topic")
+	if err := v.Err(); err != nil {
+		return DeadLetterPolicy{}, false, err
+	}
+	var before any
+	if previous, err := s.deadLetters.GetDeadLetterPolicy(ctx, tenantID, topic); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrDeadLetterPolicyNotFound) {
+		return DeadLetterPolicy{}, false, err
+	}
+	now := s.clock.Now()
+	saved, created, err := s.deadLetters.PutDeadLetterPolicy(ctx, DeadLetterPolicy{
+		TenantID:        tenantID,
+		Topic:           topic,
+		MaxDeliveries:   maxDeliveries,
+		DeadLetterTopic: deadLetterTopic,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	})
+	if err != nil {
+		return DeadLetterPolicy{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.dead_letter_policy.put",
+		Resource: "topics/" + topic + "/dead-letter",
+		TenantID: tenantID,
+		Before:   before,
+		After:    saved,
+	})
+	return saved, created, nil
+}
+
+// GetDeadLetterPolicy returns the tenant's dead-letter policy for topic.
+func (s *Service) GetDeadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error) {
+	if s.deadLetters == nil {
+		return DeadLetterPolicy{}, ErrDeadLetterPolicyNotFound
+	}
+	return s.deadLetters.GetDeadLetterPolicy(ctx, tenantID, topic)
+}
+
+// DeleteDeadLetterPolicy removes the tenant's dead-letter policy for
+// topic. Messages already moved stay in the dead-letter topic.
+func (s *Service) DeleteDeadLetterPolicy(ctx context.Context, tenantID, topic string) error {
+	if s.deadLetters == nil {
+		return ErrDeadLetterPolicyNotFound
+	}
+	policy, err := s.deadLetters.DeleteDeadLetterPolicy(ctx, tenantID, topic)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.dead_letter_policy.delete",
+		Resource: "topics/" + topic + "/dead-letter",
+		TenantID: tenantID,
+		Before:   policy,
+	})
+	return nil
+}
+
+// DeadLetters returns one page of the messages in the scope's dead-letter
+// topic for topic, oldest first, without leasing them.
+func (s *Service) DeadLetters(ctx context.Context, scope Scope, topic string, page pagination.Request) ([]Message, string, error) {
+	policy, err := s.deadLetterPolicy(ctx, scope.TenantID, topic)
+	if err != nil {
+		return nil, "", err
+	}
+	if page.Limit <= 0 {
+		page.Limit = DefaultPullLimit
+	}
+	return s.store.List(ctx, PullFilter{TenantID: scope.TenantID, ProjectID: scope.ProjectID, Topic: policy.DeadLetterTopic}, page)
+}
+
+// ReplayDeadLetters publishes the messages with messageIDs in the scope's
+// dead-letter topic for topic back to topic as new messages, with fresh
+// deliveries, and removes them from the dead-letter topic. With no IDs it
+// replays the oldest pagination.MaxLimit that came from topic. It returns
+// how many it replayed, and replays none when an ID is not in the
+// dead-letter topic.
+func (s *Service) ReplayDeadLetters(ctx context.Context, scope Scope, topic string, messageIDs []string) (int, error) {
+	policy, err := s.deadLetterPolicy(ctx, scope.TenantID, topic)
+	if err != nil {
+		return 0, err
+	}
+	var messages []Message
+	if len(messageIDs) == 0 {
+		listed, _, err := s.store.List(ctx, PullFilter{TenantID: scope.TenantID, ProjectID: scope.ProjectID, Topic: policy.DeadLetterTopic}, pagination.Request{Limit: pagination.MaxLimit})
+		if err != nil {
+			return 0, err
+		}
+		for _, message := range listed {
+			if message.Attributes[AttrDeadLetterSourceTopic] == topic {
+				messages = append(messages, message)
+			}
+		}
+	} else {
+		var v validation.Validator
+		v.Check(len(messageIDs) <= pagination.MaxLimit, "message_ids", validation.RuleMaxEntries, "must list at most 1000 messages")
+		if err := v.Err(); err != nil {
+			return 0, err
+		}
+		for _, messageID := range messageIDs {
+			message, err := s.store.Get(ctx, policy.DeadLetterTopic, messageID)
+			if err != nil {
+				return 0, err
+			}
+			if (scope.TenantID != "" && message.TenantID != scope.TenantID) ||
+				(scope.ProjectID != "" && message.ProjectID != scope.ProjectID) ||
+				message.Attributes[AttrDeadLetterSourceTopic] != topic {
+				return 0, ErrMessageNotFound
+			}
+			messages = append(messages, message)
+		}
+	}
+	replayed := 0
+	for _, dead := range messages {
+		message := dead
+		message.MessageID = id.New(id.PrefixMessage)
+		message.Topic = topic
+		message.PublishedAt = s.clock.Now()
+		message.Attributes = maps.Clone(message.Attributes)
+		delete(message.Attributes, AttrDeadLetterSourceTopic)
+		delete(message.Attributes, AttrDeadLetterSourceMessageID)
+		delete(message.Attributes, AttrDeadLetterSourceSubscription)
+		if _, err := s.save(ctx, message); err != nil {
+			return replayed, err
+		}
+		if err := s.Ack(ctx, policy.DeadLetterTopic, dead.MessageID); err != nil && !errors.Is(err, ErrMessageNotFound) {
+			return replayed, err
+		}
+		replayed++
+	}
+	if replayed > 0 {
+		s.audit.Record(ctx, audit.Change{
+			Action:    "messaging.dead_letter.replay",
+			Resource:  "topics/" + topic + "/dead-letter",
+			TenantID:  scope.TenantID,
+			ProjectID: scope.ProjectID,
+			After:     map[string]int{"replayed": replayed},
+		})
+	}
+	return replayed, nil
+}
+
+// deadLetterPolicy returns the policy for tenantID's messages in topic:
+// its own, or else the one for every tenant.
+func (s *Service) deadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error) {
+	if s.deadLetters == nil {
+		return DeadLetterPolicy{}, ErrDeadLetterPolicyNotFound
+	}
+	policy, err := s.deadLetters.GetDeadLetterPolicy(ctx, tenantID, topic)
+	if errors.Is(err, ErrDeadLetterPolicyNotFound) && tenantID != "" {
+		return s.deadLetters.GetDeadLetterPolicy(ctx, "", topic)
+	}
+	return policy, err
+}
+
+// deadLetterCheck returns the topic's policies by tenant and a check of
+// whether a message has had the deliveries its policy allows, or nil when
+// the topic has none.
+func (s *Service) deadLetterCheck(ctx context.Context, topic string) (func(Message, int) bool, map[string]DeadLetterPolicy, error) {
+	if s.deadLetters == nil {
+		return nil, nil, nil
+	}
+	list, err := s.deadLetters.DeadLetterPolicies(ctx, topic)
+	if err != nil || len(list) == 0 {
+		return nil, nil, err
+	}
+	policies := make(map[string]DeadLetterPolicy, len(list))
+	for _, policy := range list {
+		policies[policy.TenantID] = policy
+	}
+	return func(message Message, deliveries int) bool {
+		policy, ok := policyFor(policies, message.TenantID)
+		return ok && deliveries >= policy.MaxDeliveries
+	}, policies, nil
+}
+
+func policyFor(policies map[string]DeadLetterPolicy, tenantID string) (DeadLetterPolicy, bool) {
+	if policy, ok := policies[tenantID]; ok {
+		return policy, true
+	}
+	policy, ok := policies[""]
+	return policy, ok
+}
+
+// deadLetter moves a message that ran out of deliveries to its policy's
+// dead-letter topic and removes it from its own. If the move fails part
+// way the message is moved again once its claim expires, so the
+// dead-letter topic may hold it twice.
+func (s *Service) deadLetter(ctx context.Context, message Message, policies map[string]DeadLetterPolicy) error {
+	if err := s.moveToDeadLetter(ctx, message, policies, ""); err != nil {
+		return err
+	}
+	if err := s.Ack(ctx, message.Topic, message.MessageID); err != nil && !errors.Is(err, ErrMessageNotFound) {
+		return err
+	}
+	return nil
+}
+
+// moveToDeadLetter saves message to its policy's dead-letter topic as a new
+// message marked with its source, and subscription when a subscription
+// ran out of deliveries, and without its delay or TTL.
+func (s *Service) moveToDeadLetter(ctx context.Context, message Message, policies map[string]DeadLetterPolicy, subscription string) error {
+	policy, ok := policyFor(policies, message.TenantID)
+	if !ok {
+		return nil
+	}
+	moved := message
+	moved.MessageID = id.New(id.PrefixMessage)
+	moved.Topic = policy.DeadLetterTopic
+	moved.PublishedAt = s.clock.Now()
+	moved.DeliverAt, moved.ExpiresAt = time.Time{}, time.Time{}
+	moved.Attributes = maps.Clone(message.Attributes)
+	if moved.Attributes == nil {
+		moved.Attributes = make(map[string]string, 3)
+	}
+	moved.Attributes[AttrDeadLetterSourceTopic] = message.Topic
+	moved.Attributes[AttrDeadLetterSourceMessageID] = message.MessageID
+	if subscription != "" {
+		moved.Attributes[AttrDeadLetterSourceSubscription] = subscription
+	}
+	_, err := s.save(ctx, moved)
+	return err
+}
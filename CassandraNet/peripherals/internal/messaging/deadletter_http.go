@@ -0,0 +1,147 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// deadLetterPayload is the body of PUT /topics/{topic}/dead-letter; the
+// tenant comes from the query.
+type deadLetterPayload struct {
+	MaxDeliveries   int    `json:"max_deliveries"`
+	DeadLetterTopic string `json:"dead_letter_topic"`
+}
+
+// replayPayload is the optional body of POST
+// /topics/{topic}/dead-letter/replay.
+type replayPayload struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+type replayResponse struct {
+	Replayed int `json:"replayed"`
+}
+
+// handleDeadLetter serves a topic's dead-letter policy and messages; rest
+// is the path after /topics/{topic}/dead-letter:
+//
+//	GET, PUT, DELETE     reads, sets, and removes the tenant's policy
+//	GET /messages        lists the scope's dead-lettered messages
+//	POST /replay         publishes them back to the topic
+//
+// Policies need routes.read to read and routes.manage to change, listing
+// needs messages.consume, and replaying both messages.publish and
+// messages.consume.
+func (s *Service) handleDeadLetter(w http.ResponseWriter, r *http.Request, topic string, rest []string) {
+	if s.deadLetters == nil || s.leases == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	switch {
+	case len(rest) == 0:
+		s.handleDeadLetterPolicy(w, r, topic)
+	case len(rest) == 1 && rest[0] == "messages":
+		if r.Method != http.MethodGet {
+			headerAllow(w, r, http.MethodGet)
+			return
+		}
+		scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+		if !ok || !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		page, err := pagination.Parse(r, DefaultPullLimit)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		messages, next, err := s.DeadLetters(r.Context(), scope, topic, page)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		resp := make([]any, 0, len(messages))
+		for _, message := range messages {
+			resp = append(resp, encodeMessage(r.Context(), message))
+		}
+		pagination.Write(w, r, resp, next)
+	case len(rest) == 1 && rest[0] == "replay":
+		if r.Method != http.MethodPost {
+			headerAllow(w, r, http.MethodPost)
+			return
+		}
+		scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+		if !ok || !auth.Allow(w, r, auth.PermMessagesPublish, scope.TenantID, scope.ProjectID) || !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		defer r.Body.Close()
+		var payload replayPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+			return
+		}
+		replayed, err := s.ReplayDeadLetters(r.Context(), scope, topic, payload.MessageIDs)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, replayResponse{Replayed: replayed})
+	default:
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	}
+}
+
+func (s *Service) handleDeadLetterPolicy(w http.ResponseWriter, r *http.Request, topic string) {
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), "")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermRoutesRead, scope.TenantID, "") {
+			return
+		}
+		policy, err := s.GetDeadLetterPolicy(r.Context(), scope.TenantID, topic)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermRoutesManage, scope.TenantID, "") {
+			return
+		}
+		defer r.Body.Close()
+		var payload deadLetterPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+			return
+		}
+		policy, created, err := s.PutDeadLetterPolicy(r.Context(), scope.TenantID, topic, payload.MaxDeliveries, payload.DeadLetterTopic)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, policy)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermRoutesManage, scope.TenantID, "") {
+			return
+		}
+		if err := s.DeleteDeadLetterPolicy(r.Context(), scope.TenantID, topic); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
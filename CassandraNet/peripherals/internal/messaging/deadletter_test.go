@@ -0,0 +1,161 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// deadLetters returns the messages in acme's dead-letter topic for topic.
+func deadLetters(t *testing.T, svc *Service, topic string) []Message {
+	t.Helper()
+	messages, _, err := svc.DeadLetters(context.Background(), Scope{TenantID: "acme"}, topic, pagination.Request{})
+	if err != nil {
+		t.Fatalf("dead letters: %v", err)
+	}
+	return messages
+}
+
+func TestExhaustedMessagesMoveToDeadLetterTopic(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	if _, err := svc.GetDeadLetterPolicy(ctx, "acme", "orders"); !errors.Is(err, ErrDeadLetterPolicyNotFound) {
+		t.Fatalf("expected no policy yet, got %v", err)
+	}
+	policy, created, err := svc.PutDeadLetterPolicy(ctx, "acme", "orders", 2, "")
+	if err != nil || !created || policy.DeadLetterTopic != "orders"+DeadLetterSuffix || policy.MaxDeliveries != 2 {
+		t.Fatalf("put policy = %+v, %v", policy, err)
+	}
+	var invalid validation.Errors
+	if _, _, err := svc.PutDeadLetterPolicy(ctx, "acme", "orders", 2, "orders"); !errors.As(err, &invalid) {
+		t.Fatalf("expected a policy naming its own topic refused, got %v", err)
+	}
+	poison := publish(t, svc, "orders", "poison")
+	if err := svc.Nack(ctx, "orders", poison.MessageID); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected a nack without a lease refused, got %v", err)
+	}
+
+	// Each leasing pull is a delivery; the nack after the second moves it.
+	leasing := PullFilter{Topic: "orders", AckDeadline: time.Minute}
+	for delivery := 1; delivery <= 2; delivery++ {
+		if got := pullKeys(t, svc, leasing, 10); got != "poison" {
+			t.Fatalf("delivery %d = %q", delivery, got)
+		}
+		if err := svc.Nack(ctx, "orders", poison.MessageID); err != nil {
+			t.Fatalf("nack %d: %v", delivery, err)
+		}
+	}
+	if got := pullKeys(t, svc, leasing, 10); got != "" {
+		t.Fatalf("expected the message moved off the topic, got %q", got)
+	}
+	dead := deadLetters(t, svc, "orders")
+	if len(dead) != 1 {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	moved := dead[0]
+	if moved.Key != "poison" || moved.Topic != "orders.dlq" ||
+		moved.Attributes[AttrDeadLetterSourceTopic] != "orders" ||
+		moved.Attributes[AttrDeadLetterSourceMessageID] != poison.MessageID {
+		t.Fatalf("dead letter = %+v", moved)
+	}
+
+	if _, err := svc.ReplayDeadLetters(ctx, Scope{TenantID: "acme"}, "orders", []string{"msg_missing"}); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected an unknown dead letter refused, got %v", err)
+	}
+	replayed, err := svc.ReplayDeadLetters(ctx, Scope{TenantID: "acme"}, "orders", []string{moved.MessageID})
+	if err != nil || replayed != 1 {
+		t.Fatalf("replay = %d, %v", replayed, err)
+	}
+	again, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "orders", AckDeadline: time.Minute}, pagination.Request{Limit: 10})
+	if err != nil || len(again) != 1 || again[0].Key != "poison" || again[0].MessageID == poison.MessageID {
+		t.Fatalf("expected the replay published anew, got %+v %v", again, err)
+	}
+	if _, ok := again[0].Attributes[AttrDeadLetterSourceTopic]; ok {
+		t.Fatalf("expected the dead-letter attributes dropped, got %v", again[0].Attributes)
+	}
+	if dead := deadLetters(t, svc, "orders"); len(dead) != 0 {
+		t.Fatalf("expected the dead-letter topic drained, got %+v", dead)
+	}
+
+	// Leases that expire count as deliveries too, so the replayed message
+	// has one left.
+	clk.Advance(time.Minute)
+	if got := pullKeys(t, svc, leasing, 10); got != "poison" {
+		t.Fatalf("expected the expired lease redelivered, got %q", got)
+	}
+	clk.Advance(time.Minute)
+	if got := pullKeys(t, svc, leasing, 10); got != "" {
+		t.Fatalf("expected the exhausted message moved, got %q", got)
+	}
+	if dead := deadLetters(t, svc, "orders"); len(dead) != 1 {
+		t.Fatalf("expected the replay dead-lettered again, got %+v", dead)
+	}
+
+	if err := svc.DeleteDeadLetterPolicy(ctx, "acme", "orders"); err != nil {
+		t.Fatalf("delete policy: %v", err)
+	}
+	if _, _, err := svc.DeadLetters(ctx, Scope{TenantID: "acme"}, "orders", pagination.Request{}); !errors.Is(err, ErrDeadLetterPolicyNotFound) {
+		t.Fatalf("expected the deleted policy gone, got %v", err)
+	}
+}
+
+func TestSubscriptionsDeadLetterExhaustedMessages(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	if _, _, err := svc.PutDeadLetterPolicy(ctx, "acme", "orders", 2, ""); err != nil {
+		t.Fatalf("put policy: %v", err)
+	}
+	scope := Scope{TenantID: "acme", ProjectID: "p1"}
+	for _, name := range []string{"billing", "shipping"} {
+		if _, _, err := svc.PutSubscription(ctx, scope, "orders", name, time.Second, ""); err != nil {
+			t.Fatalf("put %s subscription: %v", name, err)
+		}
+	}
+	poison := publish(t, svc, "orders", "poison")
+	pull := func(name string) string {
+		t.Helper()
+		messages, err := svc.PullSubscription(ctx, scope, "orders", name, 0)
+		if err != nil {
+			t.Fatalf("pull %s: %v", name, err)
+		}
+		return keys(messages)
+	}
+
+	// billing is delivered the message twice without an ack; the pull after the
+	// second deadline moves it instead of delivering it a third time.
+	if got := pull("billing"); got != "poison" {
+		t.Fatalf("first delivery = %q", got)
+	}
+	clk.Advance(time.Second)
+	if got := pull("billing"); got != "poison" {
+		t.Fatalf("second delivery = %q", got)
+	}
+	clk.Advance(time.Second)
+	if got := pull("billing"); got != "" {
+		t.Fatalf("expected no third delivery, got %q", got)
+	}
+	dead := deadLetters(t, svc, "orders")
+	if len(dead) != 1 {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+	if moved := dead[0]; moved.Key != "poison" ||
+		moved.Attributes[AttrDeadLetterSourceMessageID] != poison.MessageID ||
+		moved.Attributes[AttrDeadLetterSourceSubscription] != "billing" {
+		t.Fatalf("dead letter = %+v", moved)
+	}
+	if sub, err := svc.GetSubscription(ctx, scope, "orders", "billing"); err != nil || sub.InFlight != 0 {
+		t.Fatalf("expected billing to settle the delivery, got %+v %v", sub, err)
+	}
+
+	// The topic keeps the message for the other subscription.
+	if got := pull("shipping"); got != "poison" {
+		t.Fatalf("shipping pull = %q", got)
+	}
+	if err := svc.AckSubscription(ctx, scope, "orders", "shipping", poison.MessageID); err != nil {
+		t.Fatalf("ack shipping: %v", err)
+	}
+}
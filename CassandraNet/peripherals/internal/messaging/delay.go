@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// maxDeliveryDelay bounds how far ahead a message may be delivered. The
+// RetentionPolicy counts a message's age from its publish, so a delayed
+// message is delivered that much older.
+const maxDeliveryDelay = 7 * 24 * time.Hour
+
+// DefaultReleaseInterval is how often a Releaser delivers delayed messages
+// unless told otherwise.
+const DefaultReleaseInterval = time.Second
+
+// releaseBatch bounds the delayed messages one Store.Release delivers.
+const releaseBatch = 500
+
+// Release delivers the delayed messages due by now to their topics,
+// announcing each as if it had just been published, and returns how many
+// it delivered. Released messages replicate as they are delivered, so
+// each region holds only the delayed messages published in it.
+func (s *Service) Release(ctx context.Context) (int, error) {
+	released := 0
+	for {
+		messages, err := s.store.Release(ctx, s.clock.Now(), releaseBatch)
+		for _, message := range messages {
+			s.announce(ctx, message)
+		}
+		released += len(messages)
+		if err != nil || len(messages) < releaseBatch {
+			return released, err
+		}
+	}
+}
+
+// deliver stores message in its topic, or holds it until its DeliverAt.
+func (s *Service) deliver(ctx context.Context, message Message) (Message, error) {
+	if message.DeliverAt.IsZero() {
+		return s.save(ctx, message)
+	}
+	return s.store.Schedule(ctx, message)
+}
+
+// checkDelivery checks a publish's delivery time, given as deliverAt or
+// as delay from now, and returns it, or the zero time when the message is
+// delivered at once.
+func checkDelivery(v *validation.Validator, deliverAt time.Time, delay time.Duration, now time.Time) time.Time {
+	v.Check(deliverAt.IsZero() || delay == 0, "delay_seconds", validation.RuleRange, "must not be set with deliver_at")
+	v.Check(delay >= 0 && delay <= maxDeliveryDelay && delay%time.Second == 0,
+		"delay_seconds", validation.RuleRange, "must be between 0 and 604800")
+	if delay > 0 {
+		deliverAt = now.Add(delay)
+	}
+	v.Check(!deliverAt.After(now.Add(maxDeliveryDelay)), "deliver_at", validation.RuleRange, "must be within 7 days")
+	if !deliverAt.After(now) {
+		return time.Time{}
+	}
+	return deliverAt.UTC()
+}
+
+// deliverable returns when message is, or was, delivered to its topic.
+func deliverable(message Message) time.Time {
+	if message.DeliverAt.IsZero() {
+		return message.PublishedAt
+	}
+	return message.DeliverAt
+}
+
+// Releaser delivers delayed messages on an interval.
+type Releaser struct {
+	svc *Service
+	periodic
+}
+
+// NewReleaser returns a releaser for svc's delayed messages running every
+// interval (default DefaultReleaseInterval).
+func NewReleaser(svc *Service, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *Releaser {
+	return &Releaser{svc: svc, periodic: newPeriodic("messaging.delivery", svc.clock, interval, DefaultReleaseInterval, logger)}
+}
+
+// SetLocker has one replica sharing l deliver delayed messages at a time,
+// so each is delivered once. Call it before Run.
+func (r *Releaser) SetLocker(l lock.Locker) {
+	r.setLocker(l)
+}
+
+// Run delivers the delayed messages due every interval until ctx is
+// cancelled.
+func (r *Releaser) Run(ctx context.Context) error {
+	return r.run(ctx, "release delayed messages", func(ctx context.Context) error {
+		_, err := r.svc.Release(ctx)
+		return err
+	})
+}
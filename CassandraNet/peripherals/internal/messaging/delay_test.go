@@ -0,0 +1,58 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestDelayedMessagesAreHeldUntilDue(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	delayed := publish(t, svc, "jobs", "later", func(r *PublishRequest) { r.Delay, r.TTL = time.Second, time.Minute })
+	if delayed.DeliverAt.Sub(delayed.PublishedAt) != time.Second || delayed.ExpiresAt.Sub(delayed.DeliverAt) != time.Minute {
+		t.Fatalf("publish with a delay = %+v", delayed)
+	}
+	if now := publish(t, svc, "jobs", "now", func(r *PublishRequest) { r.DeliverAt = clk.Now().Add(-time.Minute) }); !now.DeliverAt.IsZero() {
+		t.Fatalf("expected a past deliver_at delivered at once, got %+v", now)
+	}
+	var invalid validation.Errors
+	for name, req := range map[string]PublishRequest{
+		"a delay and a deliver_at":     {Delay: time.Second, DeliverAt: clk.Now().Add(time.Hour)},
+		"a delivery over a week ahead": {DeliverAt: clk.Now().Add(8 * 24 * time.Hour)},
+		"a delay over a week":          {Delay: 8 * 24 * time.Hour},
+		"a negative delay":             {Delay: -time.Second},
+	} {
+		req.TenantID, req.ProjectID, req.Topic = "acme", "p1", "jobs"
+		if _, err := svc.Publish(ctx, req); !errors.As(err, &invalid) {
+			t.Fatalf("expected %s refused, got %v", name, err)
+		}
+	}
+
+	if got := pullKeys(t, svc, PullFilter{Topic: "jobs", AckDeadline: time.Minute}, 10); got != "now" {
+		t.Fatalf("expected only the undelayed message pullable, got %q", got)
+	}
+	if err := svc.Ack(ctx, "jobs", delayed.MessageID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected the delayed message not yet in its topic, got %v", err)
+	}
+	if released, err := svc.Release(ctx); err != nil || released != 0 {
+		t.Fatalf("expected nothing released yet, got %d %v", released, err)
+	}
+	clk.Advance(time.Second)
+	if released, err := svc.Release(ctx); err != nil || released != 1 {
+		t.Fatalf("expected the delayed message released once due, got %d %v", released, err)
+	}
+	if released, err := svc.Release(ctx); err != nil || released != 0 {
+		t.Fatalf("expected a release to deliver once, got %d %v", released, err)
+	}
+	message, err := svc.Get(ctx, "jobs", delayed.MessageID)
+	if err != nil || !message.DeliverAt.Equal(delayed.DeliverAt) || !message.ExpiresAt.Equal(delayed.ExpiresAt) {
+		t.Fatalf("expected the delayed message in its topic once due, got %+v %v", message, err)
+	}
+	if got := pullKeys(t, svc, PullFilter{Topic: "jobs"}, 10); got != "later" {
+		t.Fatalf("expected the delayed message pullable once due, got %q", got)
+	}
+}
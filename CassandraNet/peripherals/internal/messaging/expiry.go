@@ -0,0 +1,59 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// maxMessageTTL bounds the TTL of a message and the default TTL of a
+// topic.
+const maxMessageTTL = 365 * 24 * time.Hour
+
+// DefaultExpireInterval is how often a Janitor removes expired messages
+// unless told otherwise.
+const DefaultExpireInterval = time.Minute
+
+// Expire removes the pending messages whose TTL ran out by now and returns
+// how many it removed. Each region expires its own copies, so removals are
+// not replicated.
+func (s *Service) Expire(ctx context.Context) (int, error) {
+	return s.store.Expire(ctx, s.clock.Now())
+}
+
+// checkTTL checks a TTL of whole seconds up to maxMessageTTL, zero
+// meaning none.
+func checkTTL(v *validation.Validator, field string, ttl time.Duration) {
+	v.Check(ttl >= 0 && ttl <= maxMessageTTL && ttl%time.Second == 0,
+		field, validation.RuleRange, "must be between 0 and 31536000")
+}
+
+// Janitor removes expired messages on an interval.
+type Janitor struct {
+	svc *Service
+	periodic
+}
+
+// NewJanitor returns a janitor for svc's messages running every interval
+// (default DefaultExpireInterval).
+func NewJanitor(svc *Service, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *Janitor {
+	return &Janitor{svc: svc, periodic: newPeriodic("messaging.expiry", svc.clock, interval, DefaultExpireInterval, logger)}
+}
+
+// SetLocker has one replica sharing l expire messages at a time, so
+// replicas sharing storage do not each scan it. Call it before Run.
+func (j *Janitor) SetLocker(l lock.Locker) {
+	j.setLocker(l)
+}
+
+// Run removes expired messages every interval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) error {
+	return j.run(ctx, "expire messages", func(ctx context.Context) error {
+		_, err := j.svc.Expire(ctx)
+		return err
+	})
+}
@@ -0,0 +1,53 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestMessagesExpireAfterTheirTTL(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	if _, _, err := svc.PutTopic(ctx, Topic{Name: "alerts", MessageTTLSeconds: 2}); err != nil {
+		t.Fatalf("put topic: %v", err)
+	}
+	brief := publish(t, svc, "jobs", "brief", func(r *PublishRequest) { r.TTL = time.Second })
+	if brief.ExpiresAt.Sub(brief.PublishedAt) != time.Second {
+		t.Fatalf("publish with a TTL = %+v", brief)
+	}
+	publish(t, svc, "jobs", "lasting")
+	if alert := publish(t, svc, "alerts", "alert"); alert.ExpiresAt.Sub(alert.PublishedAt) != 2*time.Second {
+		t.Fatalf("expected the topic's TTL applied, got %+v", alert)
+	}
+	if own := publish(t, svc, "alerts", "own", func(r *PublishRequest) { r.TTL = time.Hour }); own.ExpiresAt.Sub(own.PublishedAt) != time.Hour {
+		t.Fatalf("expected a named TTL kept, got %+v", own)
+	}
+	var invalid validation.Errors
+	for _, ttl := range []time.Duration{400 * 24 * time.Hour, 1500 * time.Millisecond, -time.Second} {
+		if _, err := svc.Publish(ctx, PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: "jobs", TTL: ttl}); !errors.As(err, &invalid) {
+			t.Fatalf("expected a TTL of %v refused, got %v", ttl, err)
+		}
+	}
+
+	if removed, err := svc.Expire(ctx); err != nil || removed != 0 {
+		t.Fatalf("expected nothing expired yet, got %d %v", removed, err)
+	}
+	clk.Advance(time.Second)
+	if removed, err := svc.Expire(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected the one-second TTL run out, got %d %v", removed, err)
+	}
+	clk.Advance(time.Second)
+	if removed, err := svc.Expire(ctx); err != nil || removed != 1 {
+		t.Fatalf("expected the topic's TTL run out, got %d %v", removed, err)
+	}
+	if got := pullKeys(t, svc, PullFilter{Topic: "jobs"}, 10); got != "lasting" {
+		t.Fatalf("expected only the message without a TTL left, got %q", got)
+	}
+	if got := pullKeys(t, svc, PullFilter{Topic: "alerts"}, 10); got != "own" {
+		t.Fatalf("expected only the message with its own TTL left, got %q", got)
+	}
+}
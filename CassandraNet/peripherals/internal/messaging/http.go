@@ -3,14 +3,43 @@ package messaging
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the messaging API.
+const (
+	codeInvalidJSON      = "messaging.invalid_json"
+	codeInvalidRequest   = "messaging.invalid_request"
+	codeNotFound         = "messaging.not_found"
+	codeUnavailable      = "messaging.store_unavailable"
+	codeForbidden        = "messaging.forbidden_tenant"
+	codeForbiddenProject = "messaging.forbidden_project"
+	codeNotLeased        = "messaging.not_leased"
 )
 
 const topicsPrefix = "/topics/"
 
+// ManagementPaths are the netacl routes of the endpoints that change
+// routing rules, topics, topic keys, and dead-letter policies. The topic
+// routes name their methods, since publishing, pulling, and subscriptions
+// share their paths.
+var ManagementPaths = []string{
+	routesPath,
+	"PUT /topics/*$", "DELETE /topics/*$",
+	"PUT /topics/*/key$", "DELETE /topics/*/key$",
+	"PUT /topics/*/dead-letter$", "DELETE /topics/*/dead-letter$",
+}
+
 // Handler returns the HTTP handler for messaging endpoints.
 func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
@@ -18,7 +47,12 @@ func (s *Service) Handler() http.Handler {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
+	mux.HandleFunc(topicsPath, s.handleTopics)
 	mux.HandleFunc(topicsPrefix, s.handleTopicRoute)
+	mux.HandleFunc(routesPath, s.handleRoutes)
+	mux.HandleFunc(routesEvaluatePath, s.handleEvaluateRoute)
+	mux.HandleFunc(routesPrefix, s.handleRoute)
+	mux.HandleFunc(groupsPrefix, s.handleGroup)
 	return mux
 }
 
@@ -28,6 +62,9 @@ type publishPayload struct {
 	Key           string            `json:"key"`
 	PayloadBase64 string            `json:"payload_base64"`
 	Priority      string            `json:"priority"`
+	DeliverAt     string            `json:"deliver_at"`
+	DelaySeconds  int               `json:"delay_seconds"`
+	TTLSeconds    int               `json:"ttl_seconds"`
 	Attributes    map[string]string `json:"attributes"`
 }
 
@@ -39,34 +76,52 @@ type messageResponse struct {
 	Key           string            `json:"key"`
 	Priority      string            `json:"priority"`
 	PublishedAt   string            `json:"published_at"`
+	DeliverAt     string            `json:"deliver_at,omitempty"`
+	ExpiresAt     string            `json:"expires_at,omitempty"`
 	Attributes    map[string]string `json:"attributes,omitempty"`
 	PayloadBase64 string            `json:"payload_base64"`
 }
 
 func (s *Service) handleTopicRoute(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, topicsPrefix) {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 		return
 	}
 	rest := strings.TrimPrefix(r.URL.Path, topicsPrefix)
 	segments := strings.Split(rest, "/")
-	if len(segments) < 2 {
-		http.NotFound(w, r)
-		return
-	}
 	topic := segments[0]
 	if topic == "" {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	if len(segments) == 1 {
+		s.handleTopic(w, r, topic)
 		return
 	}
 
 	switch {
 	case len(segments) == 2 && segments[1] == "messages":
 		s.handleTopicMessages(w, r, topic)
+	case len(segments) == 2 && (segments[1] == "stream" || segments[1] == "subscribe"):
+		s.handleSubscribe(w, r, topic)
+	case len(segments) == 2 && segments[1] == "export":
+		s.handleExport(w, r, topic)
+	case len(segments) == 2 && segments[1] == "import":
+		s.handleImport(w, r, topic)
+	case len(segments) == 2 && segments[1] == "key":
+		s.handleTopicKey(w, r, topic)
+	case segments[1] == "subscriptions":
+		s.handleSubscriptions(w, r, topic, segments[2:])
 	case len(segments) == 4 && segments[1] == "messages" && segments[3] == "ack":
 		s.handleAck(w, r, topic, segments[2])
+	case len(segments) == 4 && segments[1] == "messages" && segments[3] == "extend":
+		s.handleExtend(w, r, topic, segments[2])
+	case len(segments) == 4 && segments[1] == "messages" && segments[3] == "nack":
+		s.handleNack(w, r, topic, segments[2])
+	case segments[1] == "dead-letter":
+		s.handleDeadLetter(w, r, topic, segments[2:])
 	default:
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 	}
 }
 
@@ -77,85 +132,265 @@ func (s *Service) handleTopicMessages(w http.ResponseWriter, r *http.Request, to
 	case http.MethodGet:
 		s.handlePull(w, r, topic)
 	default:
-		headerAllow(w, http.MethodPost, http.MethodGet)
+		headerAllow(w, r, http.MethodPost, http.MethodGet)
 	}
 }
 
 func (s *Service) handlePublish(w http.ResponseWriter, r *http.Request, topic string) {
 	defer r.Body.Close()
-	var payload publishPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json payload", http.StatusBadRequest)
+	payload, err := decodePublish(r.Context(), r.Body)
+	if err != nil {
+		if !validation.Write(w, r, codeInvalidRequest, err) {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		}
 		return
 	}
 	bytes, err := DecodePayloadBase64(payload.PayloadBase64)
 	if err != nil {
-		http.Error(w, "invalid base64 payload", http.StatusBadRequest)
+		httpError(w, r, validation.Invalid("payload_base64", validation.RuleFormat, "must be valid base64"))
 		return
 	}
 	priority := Priority(payload.Priority)
 	if payload.Priority != "" {
 		parsed, err := ParsePriority(payload.Priority)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err)
 			return
 		}
 		priority = parsed
 	}
-	message, err := s.Publish(r.Context(), PublishRequest{
-		TenantID:   payload.TenantID,
-		ProjectID:  payload.ProjectID,
+	var deliverAt time.Time
+	if payload.DeliverAt != "" {
+		if deliverAt, err = time.Parse(time.RFC3339Nano, payload.DeliverAt); err != nil {
+			httpError(w, r, validation.Invalid("deliver_at", validation.RuleFormat, "must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+	tenant, ok := auth.ResolveTenant(r.Context(), payload.TenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+payload.TenantID)
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), payload.ProjectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+payload.ProjectID)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesPublish, tenant, project) {
+		return
+	}
+	message, route, err := s.publish(r.Context(), PublishRequest{
+		TenantID:   tenant,
+		ProjectID:  project,
 		Topic:      topic,
 		Key:        payload.Key,
 		Payload:    bytes,
 		Priority:   priority,
+		DeliverAt:  deliverAt,
+		Delay:      time.Duration(payload.DelaySeconds) * time.Second,
+		TTL:        time.Duration(payload.TTLSeconds) * time.Second,
 		Attributes: payload.Attributes,
 	})
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
-	resp := toMessageResponse(message)
-	writeJSON(w, http.StatusCreated, resp)
+	status := http.StatusCreated
+	if route.Dropped || !message.DeliverAt.IsZero() {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, encodeMessage(r.Context(), message))
 }
 
 func (s *Service) handlePull(w http.ResponseWriter, r *http.Request, topic string) {
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return
+	}
+	requestedProject := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), requestedProject)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+requestedProject)
+		return
+	}
 	filter := PullFilter{
-		TenantID:  r.URL.Query().Get("tenant_id"),
-		ProjectID: r.URL.Query().Get("project_id"),
+		TenantID:  tenant,
+		ProjectID: project,
 		Topic:     topic,
+		Group:     r.URL.Query().Get("group"),
 	}
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if parsed, err := strconv.Atoi(limitStr); err == nil {
-			filter.Limit = parsed
+	if raw := r.URL.Query().Get("ack_deadline_seconds"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 1 {
+			httpError(w, r, validation.Invalid("ack_deadline_seconds", validation.RuleRange, "must be a positive integer"))
+			return
+		}
+		filter.AckDeadline = time.Duration(seconds) * time.Second
+	}
+	if raw := r.URL.Query().Get("wait_seconds"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 0 {
+			httpError(w, r, validation.Invalid("wait_seconds", validation.RuleRange, "must be between 0 and 20"))
+			return
 		}
+		filter.Wait = time.Duration(seconds) * time.Second
 	}
-	messages, err := s.Pull(r.Context(), filter)
+	if !auth.Allow(w, r, auth.PermMessagesConsume, filter.TenantID, filter.ProjectID) {
+		return
+	}
+	// Pulls took a limit before they were paged, so only a cursor, empty
+	// for the first page, asks for the page envelope.
+	paged := pagination.Requested(r, "cursor")
+	page, err := pagination.Parse(r, DefaultPullLimit)
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
-	resp := make([]messageResponse, 0, len(messages))
+	messages, next, err := s.Pull(r.Context(), filter, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	resp := make([]any, 0, len(messages))
 	for _, message := range messages {
-		resp = append(resp, toMessageResponse(message))
+		resp = append(resp, encodeMessage(r.Context(), message))
+	}
+	pagination.WriteList(w, r, resp, next, paged)
+}
+
+// handleSubscribe sends each message published to topic in the requested
+// scope as a "message" event, and a keep-alive comment when the stream is
+// idle, until the client leaves. It serves /topics/{topic}/stream and the
+// older /topics/{topic}/subscribe. Only this replica's publishes are sent;
+// clients resume, and see other replicas' messages, by pulling.
+func (s *Service) handleSubscribe(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return
+	}
+	requestedProject := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), requestedProject)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+requestedProject)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, tenant, project) {
+		return
+	}
+	sub, err := s.Subscribe(PullFilter{TenantID: tenant, ProjectID: project, Topic: topic}, sse.LastEventID(r))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	defer sub.Close()
+	stream, ok := sse.Open(w, r, "messaging")
+	if !ok {
+		return
+	}
+	_ = sse.Relay(r.Context(), stream, sub, "message", s.streamKeepAlive, func(m Message) any {
+		return encodeMessage(r.Context(), m)
+	})
 }
 
 func (s *Service) handleAck(w http.ResponseWriter, r *http.Request, topic, messageID string) {
 	if r.Method != http.MethodPost {
-		headerAllow(w, http.MethodPost)
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	message, err := s.Get(r.Context(), topic, messageID)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, message.TenantID, message.ProjectID) {
 		return
 	}
 	if err := s.Ack(r.Context(), topic, messageID); err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// extendPayload is the optional body of POST
+// /topics/{topic}/messages/{id}/extend.
+type extendPayload struct {
+	AckDeadlineSeconds int `json:"ack_deadline_seconds"`
+}
+
+type leaseResponse struct {
+	MessageID   string    `json:"message_id"`
+	LeasedUntil time.Time `json:"leased_until"`
+}
+
+// handleExtend extends the lease a pull holds on a message, answering its
+// new deadline.
+func (s *Service) handleExtend(w http.ResponseWriter, r *http.Request, topic, messageID string) {
+	if s.leases == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	var payload extendPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	message, err := s.Get(r.Context(), topic, messageID)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, message.TenantID, message.ProjectID) {
+		return
+	}
+	until, err := s.Extend(r.Context(), topic, messageID, time.Duration(payload.AckDeadlineSeconds)*time.Second)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, leaseResponse{MessageID: messageID, LeasedUntil: until.UTC()})
+}
+
+// handleNack gives up the lease a pull holds on a message.
+func (s *Service) handleNack(w http.ResponseWriter, r *http.Request, topic, messageID string) {
+	if s.leases == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	message, err := s.Get(r.Context(), topic, messageID)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, message.TenantID, message.ProjectID) {
+		return
+	}
+	if err := s.Nack(r.Context(), topic, messageID); err != nil {
+		httpError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func toMessageResponse(message Message) messageResponse {
-	return messageResponse{
+	resp := messageResponse{
 		MessageID:     message.MessageID,
 		TenantID:      message.TenantID,
 		ProjectID:     message.ProjectID,
@@ -166,6 +401,13 @@ func toMessageResponse(message Message) messageResponse {
 		Attributes:    cloneMap(message.Attributes),
 		PayloadBase64: EncodePayloadBase64(message),
 	}
+	if !message.DeliverAt.IsZero() {
+		resp.DeliverAt = message.DeliverAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !message.ExpiresAt.IsZero() {
+		resp.ExpiresAt = message.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return resp
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -174,15 +416,25 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func httpError(w http.ResponseWriter, err error) {
-	if errors.Is(err, ErrMessageNotFound) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrMessageNotFound) || errors.Is(err, ErrRouteNotFound) || errors.Is(err, ErrGroupNotFound) || errors.Is(err, ErrTopicKeyNotFound) || errors.Is(err, ErrSubscriptionNotFound) || errors.Is(err, ErrDeadLetterPolicyNotFound) || errors.Is(err, ErrTopicNotFound) {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, ErrNotLeased) {
+		problem.Write(w, r, http.StatusConflict, codeNotLeased, "the message is not leased; pull it again")
+		return
+	}
+	if errors.Is(err, ErrStore) {
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+		return
+	}
+	if validation.Write(w, r, codeInvalidRequest, err) {
 		return
 	}
-	http.Error(w, err.Error(), http.StatusBadRequest)
+	problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 }
 
-func headerAllow(w http.ResponseWriter, methods ...string) {
-	w.Header().Set("Allow", strings.Join(methods, ", "))
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "messaging", methods...)
 }
@@ -0,0 +1,325 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notifyclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrGroupNotFound is returned when a consumer group has not pulled in the
+// requested scope.
+var ErrGroupNotFound = errors.New("messaging: consumer group not found")
+
+// maxGroupLength bounds consumer group names, in characters.
+const maxGroupLength = 255
+
+// ConsumerGroup names a group of consumers sharing a position in the
+// topics they pull from, within a tenant and project scope.
+type ConsumerGroup struct {
+	TenantID  string
+	ProjectID string
+	Name      string
+}
+
+// groupPosition is a group's stored position in one topic. Pulls take
+// each priority in publish order but the priorities out of it, so Bands
+// holds the storage key of the furthest message the group pulled in each
+// priority band. Position is the furthest key of any band, kept by
+// positions stored before pulls followed priorities, when that order was
+// publish order.
+type groupPosition struct {
+	Topic        string            `json:"topic"`
+	Position     string            `json:"position,omitempty"`
+	Bands        map[string]string `json:"bands,omitempty"`
+	LastPulledAt time.Time         `json:"last_pulled_at"`
+}
+
+// pulled reports whether the group has pulled the message of priority
+// stored under key.
+func (p groupPosition) pulled(key string, priority Priority) bool {
+	return key <= p.Position || key <= p.Bands[priorityBand(priority)]
+}
+
+// advance moves the group's position in priority's band past key.
+func (p *groupPosition) advance(key string, priority Priority) {
+	band := priorityBand(priority)
+	if p.Bands == nil {
+		p.Bands = make(map[string]string, 1)
+	}
+	p.Bands[band] = max(p.Bands[band], key)
+}
+
+// TopicLag is how far a consumer group is behind in one topic. Unacked
+// counts pending messages the group has pulled, Unpulled those past its
+// position, and OldestPublishedAt is when the oldest of either was
+// published, zero when none are pending.
+type TopicLag struct {
+	Topic             string    `json:"topic"`
+	Unacked           int       `json:"unacked"`
+	Unpulled          int       `json:"unpulled"`
+	OldestPublishedAt time.Time `json:"oldest_published_at,omitzero"`
+	OldestAgeSeconds  float64   `json:"oldest_age_seconds"`
+	LastPulledAt      time.Time `json:"last_pulled_at"`
+}
+
+// GroupLag totals a consumer group's lag across its topics. Exceeded
+// names the thresholds the totals are past, and Lagging reports whether
+// there are any.
+type GroupLag struct {
+	Group             string     `json:"group"`
+	TenantID          string     `json:"tenant_id,omitempty"`
+	ProjectID         string     `json:"project_id,omitempty"`
+	Unacked           int        `json:"unacked"`
+	Unpulled          int        `json:"unpulled"`
+	OldestPublishedAt time.Time  `json:"oldest_published_at,omitzero"`
+	OldestAgeSeconds  float64    `json:"oldest_age_seconds"`
+	Lagging           bool       `json:"lagging"`
+	Exceeded          []string   `json:"exceeded,omitempty"`
+	Topics            []TopicLag `json:"topics"`
+}
+
+// LagThresholds is the lag at which a consumer group counts as lagging.
+// Zero fields are not checked.
+type LagThresholds struct {
+	MaxUnacked  int
+	MaxUnpulled int
+	MaxAge      time.Duration
+}
+
+// GroupStore persists consumer groups' positions.
+type GroupStore interface {
+	// Pulled moves the group's position in each priority band of topic
+	// past the messageIDs of that band still pending, unless it is
+	// already past them, and records the time of the pull.
+	Pulled(ctx context.Context, scope Scope, group, topic string, messageIDs []string, at time.Time) error
+	// Lag returns the group's lag in each topic it has pulled from, or
+	// ErrGroupNotFound when it has not pulled.
+	Lag(ctx context.Context, scope Scope, group string) ([]TopicLag, error)
+	// Groups returns every group that has pulled, in no particular order.
+	Groups(ctx context.Context) ([]ConsumerGroup, error)
+	DeleteGroup(ctx context.Context, scope Scope, group string) error
+}
+
+// SetGroupStore tracks the position of consumer groups named by pulls in
+// gs and serves their lag at /groups. Without it pulls ignore the group
+// and /groups answers 404. Call it before the service handles requests.
+func (s *Service) SetGroupStore(gs GroupStore) {
+	s.groups = gs
+}
+
+// SetLagThresholds sets the lag at which GroupLag reports a consumer group
+// as lagging. Call it before the service handles requests.
+func (s *Service) SetLagThresholds(t LagThresholds) {
+	s.lag = t
+}
+
+// GroupLag returns the scope's consumer group's lag in each topic it pulls
+// from and in total.
+func (s *Service) GroupLag(ctx context.Context, scope Scope, group string) (GroupLag, error) {
+	if s.groups == nil {
+		return GroupLag{}, ErrGroupNotFound
+	}
+	topics, err := s.groups.Lag(ctx, scope, group)
+	if err != nil {
+		return GroupLag{}, err
+	}
+	now := s.clock.Now()
+	lag := GroupLag{Group: group, TenantID: scope.TenantID, ProjectID: scope.ProjectID, Topics: topics}
+	for i := range lag.Topics {
+		topic := &lag.Topics[i]
+		topic.OldestAgeSeconds = ageSeconds(now, topic.OldestPublishedAt)
+		lag.Unacked += topic.Unacked
+		lag.Unpulled += topic.Unpulled
+		if !topic.OldestPublishedAt.IsZero() && (lag.OldestPublishedAt.IsZero() || topic.OldestPublishedAt.Before(lag.OldestPublishedAt)) {
+			lag.OldestPublishedAt = topic.OldestPublishedAt
+		}
+	}
+	lag.OldestAgeSeconds = ageSeconds(now, lag.OldestPublishedAt)
+	t := s.lag
+	if t.MaxUnacked > 0 && lag.Unacked > t.MaxUnacked {
+		lag.Exceeded = append(lag.Exceeded, "unacked")
+	}
+	if t.MaxUnpulled > 0 && lag.Unpulled > t.MaxUnpulled {
+		lag.Exceeded = append(lag.Exceeded, "unpulled")
+	}
+	if t.MaxAge > 0 && !lag.OldestPublishedAt.IsZero() && now.Sub(lag.OldestPublishedAt) > t.MaxAge {
+		lag.Exceeded = append(lag.Exceeded, "oldest_age")
+	}
+	lag.Lagging = len(lag.Exceeded) > 0
+	return lag, nil
+}
+
+// ConsumerGroups returns every consumer group that has pulled.
+func (s *Service) ConsumerGroups(ctx context.Context) ([]ConsumerGroup, error) {
+	if s.groups == nil {
+		return nil, nil
+	}
+	return s.groups.Groups(ctx)
+}
+
+// DeleteGroup forgets a consumer group's positions, so it stops being
+// reported until it pulls again.
+func (s *Service) DeleteGroup(ctx context.Context, scope Scope, group string) error {
+	if s.groups == nil {
+		return ErrGroupNotFound
+	}
+	return s.groups.DeleteGroup(ctx, scope, group)
+}
+
+// pulled records a group's pull of messages.
+func (s *Service) pulled(ctx context.Context, filter PullFilter, messages []Message) error {
+	if filter.Group == "" || s.groups == nil {
+		return nil
+	}
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.MessageID
+	}
+	scope := Scope{TenantID: filter.TenantID, ProjectID: filter.ProjectID}
+	return s.groups.Pulled(ctx, scope, filter.Group, filter.Topic, ids, s.clock.Now())
+}
+
+func validateGroup(group string) error {
+	var v validation.Validator
+	v.String("group", group).MaxLength(maxGroupLength)
+	return v.Err()
+}
+
+func ageSeconds(now, published time.Time) float64 {
+	if published.IsZero() {
+		return 0
+	}
+	return now.Sub(published).Seconds()
+}
+
+// Lag alert states.
+const (
+	LagStateLagging = "lagging"
+	LagStateOK      = "ok"
+)
+
+// LagAlert reports a consumer group crossing the lag thresholds, in
+// either direction.
+type LagAlert struct {
+	GroupLag
+	State string `json:"state"`
+}
+
+// LagNotifier delivers lag alerts.
+type LagNotifier interface {
+	Notify(ctx context.Context, alert LagAlert) error
+}
+
+// LagAlerts checks every consumer group's lag on an interval and notifies
+// when a group starts or stops lagging.
+type LagAlerts struct {
+	svc      *Service
+	notifier LagNotifier
+	periodic
+	// lagging holds the groups last reported lagging.
+	lagging map[ConsumerGroup]bool
+}
+
+// NewLagAlerts returns alerts for svc's consumer groups checked every
+// interval (default 30s). The service's lag thresholds decide when a
+// group is lagging.
+func NewLagAlerts(svc *Service, notifier LagNotifier, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *LagAlerts {
+	return &LagAlerts{
+		svc:      svc,
+		notifier: notifier,
+		periodic: newPeriodic("messaging.lag_alerts", svc.clock, interval, 30*time.Second, logger),
+		lagging:  make(map[ConsumerGroup]bool),
+	}
+}
+
+// SetLocker has one replica sharing l check lag at a time, so a lagging
+// group alerts once rather than once per replica. Call it before Run.
+func (a *LagAlerts) SetLocker(l lock.Locker) {
+	a.setLocker(l)
+}
+
+// Run checks lag every interval until ctx is cancelled.
+func (a *LagAlerts) Run(ctx context.Context) error {
+	return a.run(ctx, "check consumer lag", func(ctx context.Context) error {
+		a.Check(ctx)
+		return nil
+	})
+}
+
+// Check notifies for each group whose lagging state changed since the
+// last check. A group that fails to notify is retried on the next check.
+func (a *LagAlerts) Check(ctx context.Context) {
+	groups, err := a.svc.ConsumerGroups(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			a.logger.Printf("list consumer groups: %v", err)
+		}
+		return
+	}
+	seen := make(map[ConsumerGroup]bool, len(groups))
+	for _, group := range groups {
+		seen[group] = true
+		lag, err := a.svc.GroupLag(ctx, Scope{TenantID: group.TenantID, ProjectID: group.ProjectID}, group.Name)
+		if errors.Is(err, ErrGroupNotFound) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logger.Printf("check lag of group %s: %v", group.Name, err)
+			}
+			continue
+		}
+		if lag.Lagging == a.lagging[group] {
+			continue
+		}
+		alert := LagAlert{GroupLag: lag, State: LagStateOK}
+		if lag.Lagging {
+			alert.State = LagStateLagging
+		}
+		if err := a.notifier.Notify(ctx, alert); err != nil {
+			a.logger.Printf("notify lag of group %s: %v", group.Name, err)
+			continue
+		}
+		if lag.Lagging {
+			a.lagging[group] = true
+		} else {
+			delete(a.lagging, group)
+		}
+	}
+	for group := range a.lagging {
+		if !seen[group] {
+			delete(a.lagging, group)
+		}
+	}
+}
+
+// NewNotificationClient returns a client sending lag alerts to the
+// notification service at baseURL through transport, delivered to
+// recipient over channel with the consumer_lag template.
+func NewNotificationClient(baseURL, channel, recipient string, transport http.RoundTripper) (*notifyclient.Client[LagAlert], error) {
+	return notifyclient.New(baseURL, transport, func(alert LagAlert) notifyclient.Notification {
+		return notifyclient.Notification{Channel: channel, Recipient: recipient, Template: "consumer_lag", Data: LagAlertData(alert)}
+	})
+}
+
+// LagAlertData is the consumer_lag template's data for alert.
+func LagAlertData(alert LagAlert) map[string]any {
+	return map[string]any{
+		"Group":     alert.Group,
+		"TenantID":  alert.TenantID,
+		"ProjectID": alert.ProjectID,
+		"State":     alert.State,
+		"Unacked":   alert.Unacked,
+		"Unpulled":  alert.Unpulled,
+		"OldestAge": (time.Duration(alert.OldestAgeSeconds) * time.Second).String(),
+		"Exceeded":  strings.Join(alert.Exceeded, ", "),
+	}
+}
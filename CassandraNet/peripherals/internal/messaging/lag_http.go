@@ -0,0 +1,55 @@
+package messaging
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const groupsPrefix = "/groups/"
+
+// handleGroup serves /groups/{group}/lag and deletes groups at
+// /groups/{group}, in the scope named by tenant_id and project_id.
+func (s *Service) handleGroup(w http.ResponseWriter, r *http.Request) {
+	if s.groups == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, groupsPrefix)
+	group, lag := strings.CutSuffix(rest, "/lag")
+	if group == "" || strings.Contains(group, "/") {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok {
+		return
+	}
+	switch {
+	case lag && r.Method == http.MethodGet:
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		report, err := s.GroupLag(r.Context(), scope, group)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+	case lag:
+		headerAllow(w, r, http.MethodGet)
+	case r.Method == http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.DeleteGroup(r.Context(), scope, group); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodDelete)
+	}
+}
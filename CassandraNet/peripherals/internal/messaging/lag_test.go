@@ -0,0 +1,76 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+// recordingNotifier keeps the lag alerts it is sent.
+type recordingNotifier struct {
+	alerts []LagAlert
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, alert LagAlert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+func TestConsumerGroupLagIsTrackedAndAlerted(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.SetLagThresholds(LagThresholds{MaxUnpulled: 2})
+	ctx := context.Background()
+	acme := Scope{TenantID: "acme"}
+	for range 4 {
+		publish(t, svc, "orders", "order")
+	}
+	publish(t, svc, "orders", "other", func(r *PublishRequest) { r.TenantID = "globex" })
+	pulled, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "orders", Group: "billing"}, pagination.Request{Limit: 1})
+	if err != nil || len(pulled) != 1 {
+		t.Fatalf("pull: %v %v", pulled, err)
+	}
+	lag, err := svc.GroupLag(ctx, acme, "billing")
+	if err != nil {
+		t.Fatalf("lag: %v", err)
+	}
+	if lag.Unacked != 1 || lag.Unpulled != 3 || !lag.Lagging || len(lag.Exceeded) != 1 || lag.Exceeded[0] != "unpulled" ||
+		len(lag.Topics) != 1 || lag.Topics[0].OldestPublishedAt.IsZero() {
+		t.Fatalf("expected one unacked and three unpulled, lagging, got %+v", lag)
+	}
+
+	notifier := &recordingNotifier{}
+	alerts := NewLagAlerts(svc, notifier, time.Minute, logging.New("test"))
+	alerts.Check(ctx)
+	alerts.Check(ctx)
+	if len(notifier.alerts) != 1 || notifier.alerts[0].State != LagStateLagging || notifier.alerts[0].Group != "billing" {
+		t.Fatalf("expected one lagging alert, got %+v", notifier.alerts)
+	}
+
+	if err := svc.Ack(ctx, "orders", pulled[0].MessageID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "orders", Group: "billing"}, pagination.Request{Limit: 10}); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	if lag, err := svc.GroupLag(ctx, acme, "billing"); err != nil || lag.Unacked != 3 || lag.Unpulled != 0 || lag.Lagging {
+		t.Fatalf("expected the group caught up, got %+v %v", lag, err)
+	}
+	alerts.Check(ctx)
+	if len(notifier.alerts) != 2 || notifier.alerts[1].State != LagStateOK {
+		t.Fatalf("expected a recovery alert, got %+v", notifier.alerts)
+	}
+
+	if _, err := svc.GroupLag(ctx, Scope{TenantID: "globex"}, "billing"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("expected the group unknown in another tenant, got %v", err)
+	}
+	if err := svc.DeleteGroup(ctx, acme, "billing"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := svc.GroupLag(ctx, acme, "billing"); !errors.Is(err, ErrGroupNotFound) {
+		t.Fatalf("expected the deleted group gone, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package messaging
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrNotLeased is returned when extending or nacking the lease of a
+// message that no pull holds, because it was never leased or its deadline
+// passed.
+var ErrNotLeased = errors.New("messaging: message not leased")
+
+// LeaseStore keeps the leases pulls take on messages. A leased message is
+// left out of every pull until its deadline, so one consumer works on it
+// at a time, and is pulled again if it is not acknowledged by then. Leases
+// count the deliveries of their message, for dead-letter policies.
+type LeaseStore interface {
+	// Lease returns one page of the topic's matching messages not leased
+	// at now, as Store.List does, and the position of the next, and leases
+	// them until now plus filter.AckDeadline when it is positive. Messages
+	// delivered before for which exhausted, when not nil, reports true
+	// given their deliveries are left out of the page, claimed until now
+	// plus deadLetterClaim, and returned second.
+	Lease(ctx context.Context, filter PullFilter, page pagination.Request, now time.Time, exhausted func(Message, int) bool) ([]Message, []Message, string, error)
+	// Extend moves the deadline of the message's lease to until, or
+	// returns ErrNotLeased when the lease ended by now.
+	Extend(ctx context.Context, topic, messageID string, now, until time.Time) error
+	// Nack ends the message's lease at now, so it is pulled again, or
+	// returns ErrNotLeased when the lease ended by now. When exhausted
+	// reports true it claims the message as Lease does instead, and
+	// reports true.
+	Nack(ctx context.Context, topic, messageID string, now time.Time, exhausted func(Message, int) bool) (Message, bool, error)
+}
+
+// SetLeaseStore keeps the leases of pulls naming an ack deadline in ls
+// and serves /topics/{topic}/messages/{id}/extend and /nack. Without it
+// pulls hand out messages without leasing them and those paths answer
+// 404. Call it before the service handles requests.
+func (s *Service) SetLeaseStore(ls LeaseStore) {
+	s.leases = ls
+}
+
+// SetPullAckDeadline leases the messages of pulls naming no ack deadline
+// for d instead of DefaultAckDeadline; zero leaves them unleased, so a
+// consumer that crashes before acking loses them to the next pull at once.
+// It takes effect with SetLeaseStore. Call it before the service handles
+// requests.
+func (s *Service) SetPullAckDeadline(d time.Duration) {
+	s.pullAckDeadline = d
+}
+
+// Extend moves the deadline of a pulled message's lease to deadline from
+// now (the pull ack deadline, or DefaultAckDeadline, when zero), for a
+// consumer that needs longer to process it, and returns the new deadline.
+func (s *Service) Extend(ctx context.Context, topic, messageID string, deadline time.Duration) (time.Time, error) {
+	if s.leases == nil {
+		return time.Time{}, ErrNotLeased
+	}
+	if deadline == 0 {
+		deadline = cmp.Or(s.pullAckDeadline, DefaultAckDeadline)
+	}
+	var v validation.Validator
+	v.String("topic", topic).Required()
+	v.String("message_id", messageID).Required()
+	checkAckDeadline(&v, deadline)
+	if err := v.Err(); err != nil {
+		return time.Time{}, err
+	}
+	now := s.clock.Now()
+	until := now.Add(deadline)
+	if err := s.leases.Extend(ctx, topic, messageID, now, until); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// Nack gives up the lease a pull took on a message, so it is pulled again
+// at once, or moved to its dead-letter topic when it has been delivered
+// as often as its dead-letter policy allows.
+func (s *Service) Nack(ctx context.Context, topic, messageID string) error {
+	if s.leases == nil {
+		return ErrNotLeased
+	}
+	if err := requireMessage(topic, messageID); err != nil {
+		return err
+	}
+	exhausted, policies, err := s.deadLetterCheck(ctx, topic)
+	if err != nil {
+		return err
+	}
+	message, dead, err := s.leases.Nack(ctx, topic, messageID, s.clock.Now(), exhausted)
+	if err != nil {
+		return err
+	}
+	if !dead {
+		s.arrivals.notify(topic)
+		return nil
+	}
+	return s.deadLetter(ctx, message, policies)
+}
+
+// list returns the page of messages a pull matches, leasing them when the
+// service keeps leases, and moves those that ran out of deliveries to
+// their dead-letter topics.
+func (s *Service) list(ctx context.Context, filter PullFilter, page pagination.Request) ([]Message, string, error) {
+	if s.leases == nil {
+		if filter.AckDeadline > 0 {
+			return nil, "", validation.Invalid("ack_deadline_seconds", validation.RuleRange, "leases are not enabled on this service")
+		}
+		return s.store.List(ctx, filter, page)
+	}
+	if filter.AckDeadline == 0 {
+		filter.AckDeadline = s.pullAckDeadline
+	}
+	exhausted, policies, err := s.deadLetterCheck(ctx, filter.Topic)
+	if err != nil {
+		return nil, "", err
+	}
+	messages, dead, next, err := s.leases.Lease(ctx, filter, page, s.clock.Now(), exhausted)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, message := range dead {
+		if err := s.deadLetter(ctx, message, policies); err != nil {
+			return nil, "", err
+		}
+	}
+	return messages, next, nil
+}
+
+// checkAckDeadline checks an ack deadline of whole seconds up to
+// maxAckDeadline.
+func checkAckDeadline(v *validation.Validator, d time.Duration) {
+	v.Check(d >= time.Second && d <= maxAckDeadline && d%time.Second == 0,
+		"ack_deadline_seconds", validation.RuleRange, "must be between 1 and 3600")
+}
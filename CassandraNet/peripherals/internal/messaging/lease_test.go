@@ -0,0 +1,110 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestPlainPullsLeaseForTheDefaultDeadline(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	svc := NewService(store, clk)
+	svc.SetLeaseStore(store)
+	handler := svc.Handler()
+	ctx := context.Background()
+	if _, err := svc.Publish(ctx, PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: "jobs", Key: "a"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	pull := func(handler http.Handler) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/topics/jobs/messages?tenant_id=acme&limit=10", nil))
+		var messages []json.RawMessage
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &messages) != nil {
+			t.Fatalf("pull: %d %s", rec.Code, rec.Body)
+		}
+		return len(messages)
+	}
+
+	if n := pull(handler); n != 1 {
+		t.Fatalf("expected the message pulled, got %d", n)
+	}
+	if n := pull(handler); n != 0 {
+		t.Fatalf("expected the message leased by a pull naming no deadline, got %d", n)
+	}
+	clk.Advance(DefaultAckDeadline - time.Second)
+	if n := pull(handler); n != 0 {
+		t.Fatalf("expected the lease held until the default deadline, got %d", n)
+	}
+	clk.Advance(time.Second)
+	if n := pull(handler); n != 1 {
+		t.Fatalf("expected the unacknowledged message redelivered after the default deadline, got %d", n)
+	}
+
+	unleased := NewService(store, clk)
+	unleased.SetLeaseStore(store)
+	unleased.SetPullAckDeadline(0)
+	clk.Advance(DefaultAckDeadline)
+	for range 2 {
+		if n := pull(unleased.Handler()); n != 1 {
+			t.Fatalf("expected pulls unleased after opting out, got %d", n)
+		}
+	}
+}
+
+func TestPullLeasesExpireUnlessExtended(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	slow, lost := publish(t, svc, "jobs", "slow"), publish(t, svc, "jobs", "lost")
+	leasing := PullFilter{Topic: "jobs", AckDeadline: time.Second}
+
+	if got := pullKeys(t, svc, leasing, 10); got != "slow,lost" {
+		t.Fatalf("leasing pull = %q", got)
+	}
+	if got := pullKeys(t, svc, PullFilter{Topic: "jobs"}, 10); got != "" {
+		t.Fatalf("expected leased messages hidden from other pulls, got %q", got)
+	}
+	until, err := svc.Extend(ctx, "jobs", slow.MessageID, time.Minute)
+	if err != nil || !until.Equal(clk.Now().Add(time.Minute)) {
+		t.Fatalf("extend = %v, %v", until, err)
+	}
+
+	clk.Advance(time.Second)
+	if got := pullKeys(t, svc, leasing, 10); got != "lost" {
+		t.Fatalf("expected only the unextended lease expired, got %q", got)
+	}
+	if err := svc.Nack(ctx, "jobs", lost.MessageID); err != nil {
+		t.Fatalf("nack: %v", err)
+	}
+	if got := pullKeys(t, svc, leasing, 10); got != "lost" {
+		t.Fatalf("expected a nacked message pulled again at once, got %q", got)
+	}
+	clk.Advance(time.Second)
+	if _, err := svc.Extend(ctx, "jobs", lost.MessageID, 0); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected an expired lease refused, got %v", err)
+	}
+	if err := svc.Nack(ctx, "jobs", lost.MessageID); !errors.Is(err, ErrNotLeased) {
+		t.Fatalf("expected a nack of an expired lease refused, got %v", err)
+	}
+	if err := svc.Ack(ctx, "jobs", slow.MessageID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := svc.Extend(ctx, "jobs", slow.MessageID, 0); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected an acknowledged message gone, got %v", err)
+	}
+	var invalid validation.Errors
+	if _, err := svc.Extend(ctx, "jobs", lost.MessageID, 2*time.Hour); !errors.As(err, &invalid) {
+		t.Fatalf("expected a deadline past an hour refused, got %v", err)
+	}
+	if status, body := serve(t, svc.Handler(), http.MethodGet, "/topics/jobs/messages?tenant_id=acme&ack_deadline_seconds=7200", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected a pull deadline past an hour refused, got %d %s", status, body)
+	}
+}
@@ -0,0 +1,63 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+)
+
+// periodic runs a task every interval on the replica holding its lease.
+// The loops of the messaging service embed one.
+type periodic struct {
+	name     string
+	clock    clock.Clock
+	interval time.Duration
+	lease    *lock.Lease
+	logger   interface {
+		Printf(string, ...any)
+	}
+}
+
+// newPeriodic returns a loop ticking on clk every interval, or every
+// fallback when interval is not positive. name names its lease.
+func newPeriodic(name string, clk clock.Clock, interval, fallback time.Duration, logger interface {
+	Printf(string, ...any)
+}) periodic {
+	if interval <= 0 {
+		interval = fallback
+	}
+	return periodic{name: name, clock: clock.Or(clk), interval: interval, logger: logger}
+}
+
+// setLocker has the loop run only while it holds its lease in l, which
+// lapses three intervals after a holder stops renewing it.
+func (p *periodic) setLocker(l lock.Locker) {
+	p.lease = lock.NewLease(l, p.name, 3*p.interval)
+}
+
+// run calls task at once and then every interval until ctx is cancelled,
+// skipping the ticks on which another replica holds the lease, and logs
+// task's failures as "<what>: <error>". It releases the lease on return.
+func (p *periodic) run(ctx context.Context, what string, task func(context.Context) error) error {
+	ticker := p.clock.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if held, err := p.lease.Held(ctx); err != nil {
+			if ctx.Err() == nil {
+				p.logger.Printf("take %s lease: %v", p.name, err)
+			}
+		} else if held {
+			if err := task(ctx); err != nil && ctx.Err() == nil {
+				p.logger.Printf("%s: %v", what, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			_ = p.lease.Release(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
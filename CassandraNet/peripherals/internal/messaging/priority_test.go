@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+func TestPullsTakeHigherPrioritiesFirst(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	for _, m := range []struct {
+		key      string
+		priority Priority
+	}{
+		{"a", PriorityLow}, {"b", ""}, {"c", PriorityHigh}, {"d", PriorityNormal}, {"e", PriorityHigh},
+	} {
+		publish(t, svc, "jobs", m.key, func(r *PublishRequest) { r.Priority = m.priority })
+	}
+	filter := PullFilter{TenantID: "acme", Topic: "jobs"}
+	first, next, err := svc.Pull(ctx, filter, pagination.Request{Limit: 3})
+	if err != nil || keys(first) != "c,e,b" || next == "" {
+		t.Fatalf("expected high then normal priorities first, got %s %v", keys(first), err)
+	}
+	rest, next, err := svc.Pull(ctx, filter, pagination.Request{Limit: 3, After: next})
+	if err != nil || keys(rest) != "d,a" || next != "" {
+		t.Fatalf("expected the next page to follow the cursor, got %s %v", keys(rest), err)
+	}
+
+	if err := svc.Ack(ctx, "jobs", first[0].MessageID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	for _, m := range append(first[1:], rest...) {
+		if err := svc.Nack(ctx, "jobs", m.MessageID); err != nil {
+			t.Fatalf("nack %s: %v", m.Key, err)
+		}
+	}
+	leasing := PullFilter{Topic: "jobs", AckDeadline: time.Minute}
+	if got := pullKeys(t, svc, leasing, 2); got != "e,b" {
+		t.Fatalf("expected leased pulls in priority order, got %s", got)
+	}
+	if got := pullKeys(t, svc, leasing, 10); got != "d,a" {
+		t.Fatalf("expected the unleased messages in priority order, got %s", got)
+	}
+}
+
+func TestConsumerGroupLagFollowsPriorityOrder(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	acme := Scope{TenantID: "acme"}
+	billing := PullFilter{Topic: "orders", Group: "billing"}
+	lag := func(unacked, unpulled int) bool {
+		t.Helper()
+		lag, err := svc.GroupLag(ctx, acme, "billing")
+		if err != nil {
+			t.Fatalf("lag: %v", err)
+		}
+		return lag.Unacked == unacked && lag.Unpulled == unpulled
+	}
+	publish(t, svc, "orders", "low", func(r *PublishRequest) { r.Priority = PriorityLow })
+	publish(t, svc, "orders", "normal")
+	if got := pullKeys(t, svc, billing, 1); got != "normal" {
+		t.Fatalf("expected the normal message pulled first, got %s", got)
+	}
+	if !lag(1, 1) {
+		t.Fatal("expected the older low message unpulled")
+	}
+	publish(t, svc, "orders", "high", func(r *PublishRequest) { r.Priority = PriorityHigh })
+	if !lag(1, 2) {
+		t.Fatal("expected the low and high messages unpulled")
+	}
+	if got := pullKeys(t, svc, billing, 1); got != "high" {
+		t.Fatalf("expected the high message pulled next, got %s", got)
+	}
+	if !lag(2, 1) {
+		t.Fatal("expected only the low message unpulled")
+	}
+}
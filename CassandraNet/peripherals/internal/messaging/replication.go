@@ -0,0 +1,59 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+)
+
+// Mutation kinds the messaging service replicates.
+const (
+	ReplicatePublish = "messaging.message.publish"
+	ReplicateAck     = "messaging.message.ack"
+)
+
+// ackedMessage is the data of a ReplicateAck mutation.
+type ackedMessage struct {
+	Topic     string `json:"topic"`
+	MessageID string `json:"message_id"`
+}
+
+// applyPublish stores a message published in the peer region unless it is
+// already here, and streams it to this replica's subscribers. Messages do
+// not change once published, so there is nothing to reconcile.
+func (s *Service) applyPublish(ctx context.Context, m replication.Mutation) (bool, error) {
+	message, err := decodeMessage(m.Data)
+	if err != nil {
+		return false, err
+	}
+	_, err = s.store.Get(ctx, message.Topic, message.MessageID)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrMessageNotFound) {
+		return false, err
+	}
+	saved, err := s.store.Save(ctx, message)
+	if err != nil {
+		return false, err
+	}
+	s.live.Publish(saved)
+	s.arrivals.notify(saved.Topic)
+	return true, nil
+}
+
+// applyAck removes a message acknowledged in the peer region. Acks always
+// win, so a message consumed in either region is not delivered again.
+func (s *Service) applyAck(ctx context.Context, m replication.Mutation) (bool, error) {
+	var ack ackedMessage
+	if err := json.Unmarshal(m.Data, &ack); err != nil {
+		return false, err
+	}
+	err := s.store.Delete(ctx, ack.Topic, ack.MessageID)
+	if errors.Is(err, ErrMessageNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,302 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrRouteNotFound is returned when no routing rule has the requested ID in
+// the scope.
+var ErrRouteNotFound = errors.New("messaging: routing rule not found")
+
+// RouteAction is what a matching routing rule does with a message.
+type RouteAction string
+
+const (
+	// RouteRedirect publishes the message to Target instead of its topic.
+	RouteRedirect RouteAction = "redirect"
+	// RouteCopy publishes a copy of the message to Target as well.
+	RouteCopy RouteAction = "copy"
+	// RouteDrop discards the message.
+	RouteDrop RouteAction = "drop"
+)
+
+// MaxRouteOrder bounds a routing rule's Order.
+const MaxRouteOrder = 1_000_000
+
+// RouteMatch selects the messages a rule applies to. Every field set must
+// match: Topic and Key exactly, or by prefix when they end in "*"; Priority
+// exactly; and each attribute exactly, or by presence when its value is "*".
+type RouteMatch struct {
+	Topic      string            `json:"topic,omitempty"`
+	Key        string            `json:"key,omitempty"`
+	Priority   Priority          `json:"priority,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// RouteRule redirects, copies, or drops the messages it matches when they
+// are published. A rule without a tenant applies to every tenant, and one
+// without a project to every project of its tenant.
+type RouteRule struct {
+	ID          string `json:"id"`
+	TenantID    string `json:"tenant_id,omitempty"`
+	ProjectID   string `json:"project_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Order places the rule among those that apply to a message: lower
+	// orders run first, and equal orders run by ID.
+	Order     int         `json:"order"`
+	Match     RouteMatch  `json:"match"`
+	Action    RouteAction `json:"action"`
+	Target    string      `json:"target,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Route is where the routing rules send a message: the topic it is stored
+// in, unless dropped, and the topics that receive copies. Rules lists the
+// IDs of the rules that matched, in the order they ran.
+type Route struct {
+	Topic   string   `json:"topic,omitempty"`
+	Dropped bool     `json:"dropped"`
+	Copies  []string `json:"copies,omitempty"`
+	Rules   []string `json:"rules,omitempty"`
+}
+
+// RouteStore persists routing rules.
+type RouteStore interface {
+	// PutRoute creates or replaces the scope's rule with rule.ID, keeping
+	// the creation time of the rule it replaces, and reports whether it
+	// created one.
+	PutRoute(ctx context.Context, rule RouteRule) (RouteRule, bool, error)
+	GetRoute(ctx context.Context, scope Scope, id string) (RouteRule, error)
+	DeleteRoute(ctx context.Context, scope Scope, id string) (RouteRule, error)
+	// Routes returns every rule of every scope, in no particular order.
+	Routes(ctx context.Context) ([]RouteRule, error)
+}
+
+// SetRouteStore applies the routing rules kept in rs to every published
+// message and serves them at /routes. Without it messages are stored in
+// the topic they were published to and /routes answers 404. Call it before
+// the service handles requests.
+func (s *Service) SetRouteStore(rs RouteStore) {
+	s.routes = rs
+}
+
+// SetAudit records every routing rule change and topic import in log. Call it before the
+// service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// PutRoute validates and creates or replaces a routing rule, reporting
+// whether it created one.
+func (s *Service) PutRoute(ctx context.Context, rule RouteRule) (RouteRule, bool, error) {
+	if s.routes == nil {
+		return RouteRule{}, false, ErrRouteNotFound
+	}
+	if err := validateRoute(rule); err != nil {
+		return RouteRule{}, false, err
+	}
+	scope := Scope{TenantID: rule.TenantID, ProjectID: rule.ProjectID}
+	var before any
+	if previous, err := s.routes.GetRoute(ctx, scope, rule.ID); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrRouteNotFound) {
+		return RouteRule{}, false, err
+	}
+	now := s.clock.Now()
+	rule.Match.Attributes = cloneMap(rule.Match.Attributes)
+	rule.CreatedAt, rule.UpdatedAt = now, now
+	saved, created, err := s.routes.PutRoute(ctx, rule)
+	if err != nil {
+		return RouteRule{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "messaging.route.put",
+		Resource:  "routes/" + saved.ID,
+		TenantID:  saved.TenantID,
+		ProjectID: saved.ProjectID,
+		Before:    before,
+		After:     saved,
+	})
+	return saved, created, nil
+}
+
+// GetRoute returns the scope's routing rule with id.
+func (s *Service) GetRoute(ctx context.Context, scope Scope, id string) (RouteRule, error) {
+	if s.routes == nil {
+		return RouteRule{}, ErrRouteNotFound
+	}
+	return s.routes.GetRoute(ctx, scope, id)
+}
+
+// DeleteRoute removes the scope's routing rule with id.
+func (s *Service) DeleteRoute(ctx context.Context, scope Scope, id string) error {
+	if s.routes == nil {
+		return ErrRouteNotFound
+	}
+	rule, err := s.routes.DeleteRoute(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "messaging.route.delete",
+		Resource:  "routes/" + rule.ID,
+		TenantID:  rule.TenantID,
+		ProjectID: rule.ProjectID,
+		Before:    rule,
+	})
+	return nil
+}
+
+// ListRoutes lists one page of the scope's own routing rules in the order
+// they run, and the position of the next page.
+func (s *Service) ListRoutes(ctx context.Context, scope Scope, page pagination.Request) ([]RouteRule, string, error) {
+	if s.routes == nil {
+		return nil, "", ErrRouteNotFound
+	}
+	rules, err := s.routes.Routes(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	own := rules[:0]
+	for _, rule := range rules {
+		if rule.TenantID == scope.TenantID && rule.ProjectID == scope.ProjectID {
+			own = append(own, rule)
+		}
+	}
+	sortRoutes(own)
+	items, next := pagination.Slice(own, routePosition, page)
+	return items, next, nil
+}
+
+// EvaluateRoute reports where the routing rules would send the message req
+// describes, without publishing it.
+func (s *Service) EvaluateRoute(ctx context.Context, req PublishRequest) (Route, error) {
+	var v validation.Validator
+	v.String("topic", req.Topic).Required().MaxLength(maxTopicLength)
+	v.String("key", req.Key).MaxLength(maxKeyLength)
+	v.Map("attributes", req.Attributes).Limited()
+	if err := v.Err(); err != nil {
+		return Route{}, err
+	}
+	if req.Priority == "" {
+		req.Priority = PriorityNormal
+	}
+	return s.route(ctx, Message{
+		TenantID:   req.TenantID,
+		ProjectID:  req.ProjectID,
+		Topic:      req.Topic,
+		Key:        req.Key,
+		Priority:   req.Priority,
+		Attributes: req.Attributes,
+	})
+}
+
+// route runs the rules that apply to message in order. Copies accumulate;
+// a redirect or a drop settles the route and stops the rules after it.
+// Copies and redirected messages are not routed again.
+func (s *Service) route(ctx context.Context, message Message) (Route, error) {
+	route := Route{Topic: message.Topic}
+	if s.routes == nil {
+		return route, nil
+	}
+	rules, err := s.routes.Routes(ctx)
+	if err != nil {
+		return Route{}, err
+	}
+	sortRoutes(rules)
+	for _, rule := range rules {
+		if !rule.applies(message) {
+			continue
+		}
+		route.Rules = append(route.Rules, rule.ID)
+		switch rule.Action {
+		case RouteCopy:
+			if rule.Target != route.Topic && !slices.Contains(route.Copies, rule.Target) {
+				route.Copies = append(route.Copies, rule.Target)
+			}
+		case RouteRedirect:
+			route.Topic = rule.Target
+			route.Copies = slices.DeleteFunc(route.Copies, func(t string) bool { return t == rule.Target })
+			return route, nil
+		case RouteDrop:
+			route.Topic, route.Dropped = "", true
+			return route, nil
+		}
+	}
+	return route, nil
+}
+
+// applies reports whether r matches message and covers its scope.
+func (r RouteRule) applies(message Message) bool {
+	if (r.TenantID != "" && r.TenantID != message.TenantID) || (r.ProjectID != "" && r.ProjectID != message.ProjectID) {
+		return false
+	}
+	m := r.Match
+	if !matchPattern(m.Topic, message.Topic) || !matchPattern(m.Key, message.Key) {
+		return false
+	}
+	if m.Priority != "" && m.Priority != message.Priority {
+		return false
+	}
+	for name, want := range m.Attributes {
+		got, ok := message.Attributes[name]
+		if !ok || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPattern matches value exactly, or by prefix when pattern ends in
+// "*". An empty pattern matches anything.
+func matchPattern(pattern, value string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(value, prefix)
+	}
+	return pattern == "" || pattern == value
+}
+
+func validateRoute(rule RouteRule) error {
+	var v validation.Validator
+	v.ID("id", rule.ID).Excludes("/")
+	v.Check(rule.ID != "evaluate", "id", validation.RuleFormat, "is reserved")
+	v.String("tenant_id", rule.TenantID).MaxLength(validation.MaxIDLength)
+	v.String("project_id", rule.ProjectID).MaxLength(validation.MaxIDLength)
+	v.Check(rule.ProjectID == "" || rule.TenantID != "", "project_id", validation.RuleRequired, "requires tenant_id")
+	v.Int("order", int64(rule.Order)).Range(0, MaxRouteOrder)
+	v.String("action", string(rule.Action)).Required().OneOf(string(RouteRedirect), string(RouteCopy), string(RouteDrop))
+	v.String("match.topic", rule.Match.Topic).MaxLength(maxTopicLength)
+	v.String("match.key", rule.Match.Key).MaxLength(maxKeyLength)
+	v.String("match.priority", string(rule.Match.Priority)).OneOf(string(PriorityLow), string(PriorityNormal), string(PriorityHigh))
+	v.Map("match.attributes", rule.Match.Attributes).Limited()
+	if rule.Action == RouteDrop {
+		v.Check(rule.Target == "", "target", validation.RuleFormat, "must be empty for drop")
+	} else {
+		v.String("target", rule.Target).Required().MaxLength(maxTopicLength).Excludes("*")
+		v.Check(rule.Target == "" || rule.Target != rule.Match.Topic, "target", validation.RuleFormat, "must differ from match.topic")
+	}
+	return v.Err()
+}
+
+// sortRoutes orders rules as they run.
+func sortRoutes(rules []RouteRule) {
+	sort.Slice(rules, func(i, j int) bool { return routePosition(rules[i]) < routePosition(rules[j]) })
+}
+
+// routePosition is a key that sorts rules as they run, and the pagination
+// position of a listed rule. Rules of different scopes may share an ID, so
+// the scope breaks the remaining ties.
+func routePosition(r RouteRule) string {
+	return fmt.Sprintf("%07d/%s/%s/%s", r.Order, r.ID, r.TenantID, r.ProjectID)
+}
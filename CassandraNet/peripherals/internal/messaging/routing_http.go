@@ -0,0 +1,196 @@
+package messaging
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const (
+	routesPath         = "/routes"
+	routesPrefix       = "/routes/"
+	routesEvaluatePath = "/routes/evaluate"
+)
+
+// routePayload omits the ID and scope, which come from the path and query.
+type routePayload struct {
+	Description string      `json:"description"`
+	Order       int         `json:"order"`
+	Match       RouteMatch  `json:"match"`
+	Action      RouteAction `json:"action"`
+	Target      string      `json:"target"`
+}
+
+type evaluateRoutePayload struct {
+	TenantID   string            `json:"tenant_id"`
+	ProjectID  string            `json:"project_id"`
+	Topic      string            `json:"topic"`
+	Key        string            `json:"key"`
+	Priority   string            `json:"priority"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+func (s *Service) handleRoutes(w http.ResponseWriter, r *http.Request) {
+	if !s.routesEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok || !auth.Allow(w, r, auth.PermRoutesRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	rules, next, err := s.ListRoutes(r.Context(), scope, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, rules, next)
+}
+
+// handleEvaluateRoute answers where the routing rules would send the
+// described message, without publishing it.
+func (s *Service) handleEvaluateRoute(w http.ResponseWriter, r *http.Request) {
+	if !s.routesEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	var payload evaluateRoutePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	priority, err := ParsePriority(payload.Priority)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	scope, ok := resolveScope(w, r, payload.TenantID, payload.ProjectID)
+	if !ok || !auth.Allow(w, r, auth.PermRoutesRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	route, err := s.EvaluateRoute(r.Context(), PublishRequest{
+		TenantID:   scope.TenantID,
+		ProjectID:  scope.ProjectID,
+		Topic:      payload.Topic,
+		Key:        payload.Key,
+		Priority:   priority,
+		Attributes: payload.Attributes,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, route)
+}
+
+func (s *Service) handleRoute(w http.ResponseWriter, r *http.Request) {
+	if !s.routesEnabled(w, r) {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, routesPrefix)
+	if id == "" || strings.Contains(id, "/") {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermRoutesRead, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		rule, err := s.GetRoute(r.Context(), scope, id)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermRoutesManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		s.handlePutRoute(w, r, scope, id)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermRoutesManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.DeleteRoute(r.Context(), scope, id); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Service) handlePutRoute(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	defer r.Body.Close()
+	var payload routePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	rule, created, err := s.PutRoute(r.Context(), RouteRule{
+		ID:          id,
+		TenantID:    scope.TenantID,
+		ProjectID:   scope.ProjectID,
+		Description: payload.Description,
+		Order:       payload.Order,
+		Match:       payload.Match,
+		Action:      payload.Action,
+		Target:      payload.Target,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, rule)
+}
+
+// routesEnabled writes 404 unless the service has a RouteStore.
+func (s *Service) routesEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.routes == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return false
+	}
+	return true
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// requested scope, writing 403 when they contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request, tenantID, projectID string) (Scope, bool) {
+	tenant, ok := auth.ResolveTenant(r.Context(), tenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+tenantID)
+		return Scope{}, false
+	}
+	project, ok := auth.ResolveProject(r.Context(), projectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+projectID)
+		return Scope{}, false
+	}
+	return Scope{TenantID: tenant, ProjectID: project}, true
+}
@@ -0,0 +1,76 @@
+package messaging
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRoutingRulesRedirectCopyAndDrop(t *testing.T) {
+	svc, _ := newTestService(t)
+	h := svc.Handler()
+	put := func(path string, rule map[string]any) {
+		t.Helper()
+		if status, body := serve(t, h, http.MethodPut, path, rule); status != http.StatusCreated {
+			t.Fatalf("put %s: %d %s", path, status, body)
+		}
+	}
+	put("/routes/mirror?tenant_id=acme", map[string]any{
+		"order": 20, "match": map[string]any{"topic": "scores"}, "action": "copy", "target": "scores-audit",
+	})
+	put("/routes/spam?tenant_id=acme", map[string]any{
+		"order": 10, "match": map[string]any{"topic": "chat", "attributes": map[string]string{"spam": "*"}}, "action": "drop",
+	})
+	put("/routes/vip", map[string]any{
+		"order": 1, "match": map[string]any{"topic": "score*", "priority": "high"}, "action": "redirect", "target": "scores-vip",
+	})
+	if status, body := serve(t, h, http.MethodPut, "/routes/loop", map[string]any{
+		"match": map[string]any{"topic": "a"}, "action": "copy", "target": "a",
+	}); status != http.StatusBadRequest || !strings.Contains(string(body), `"target"`) {
+		t.Fatalf("expected a copy onto its own topic refused, got %d %s", status, body)
+	}
+
+	evaluate := func(payload map[string]any) string {
+		t.Helper()
+		status, body := serve(t, h, http.MethodPost, "/routes/evaluate", payload)
+		if status != http.StatusOK {
+			t.Fatalf("evaluate: %d %s", status, body)
+		}
+		return strings.TrimSpace(string(body))
+	}
+	if got := evaluate(map[string]any{"tenant_id": "acme", "topic": "scores", "priority": "high"}); got != `{"topic":"scores-vip","dropped":false,"rules":["vip"]}` {
+		t.Fatalf("unexpected route %s", got)
+	}
+	if got := evaluate(map[string]any{"tenant_id": "acme", "topic": "scores"}); got != `{"topic":"scores","dropped":false,"copies":["scores-audit"],"rules":["mirror"]}` {
+		t.Fatalf("unexpected route %s", got)
+	}
+	if got := evaluate(map[string]any{"tenant_id": "globex", "topic": "chat", "attributes": map[string]string{"spam": "yes"}}); got != `{"topic":"chat","dropped":false}` {
+		t.Fatalf("expected another tenant's rules not to apply, got %s", got)
+	}
+
+	publish(t, svc, "scores", "normal")
+	publish(t, svc, "scores", "high", func(r *PublishRequest) { r.Priority = PriorityHigh })
+	status, body := serve(t, h, http.MethodPost, "/topics/chat/messages", map[string]any{
+		"tenant_id": "acme", "project_id": "p1", "attributes": map[string]string{"spam": "1"},
+	})
+	if status != http.StatusAccepted {
+		t.Fatalf("expected a dropped message to be accepted, got %d %s", status, body)
+	}
+	for topic, want := range map[string]string{"scores": "normal", "scores-audit": "normal", "scores-vip": "high", "chat": ""} {
+		if got := pullKeys(t, svc, PullFilter{Topic: topic}, 10); got != want {
+			t.Errorf("pending on %s = %q, want %q", topic, got, want)
+		}
+	}
+
+	status, body = serve(t, h, http.MethodGet, "/routes?tenant_id=acme", nil)
+	if status != http.StatusOK || strings.Index(string(body), `"id":"spam"`) > strings.Index(string(body), `"id":"mirror"`) ||
+		strings.Contains(string(body), `"id":"vip"`) {
+		t.Fatalf("expected acme's rules in order, got %d %s", status, body)
+	}
+	if status, _ := serve(t, h, http.MethodDelete, "/routes/spam?tenant_id=acme", nil); status != http.StatusNoContent {
+		t.Fatalf("expected the rule deleted, got %d", status)
+	}
+	if status, _ := serve(t, h, http.MethodGet, "/routes/spam?tenant_id=acme", nil); status != http.StatusNotFound {
+		t.Fatalf("expected the deleted rule gone, got %d", status)
+	}
+}
@@ -1,100 +1,391 @@
 package messaging
 
 import (
+	"cmp"
 	"context"
-	"crypto/rand"
 	"encoding/base64"
-	"encoding/hex"
 	"errors"
 	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
 // ErrMessageNotFound is returned when an ack references a non-existent message.
 var ErrMessageNotFound = errors.New("messaging: message not found")
 
+// EventMessagePublished is the webhook event sent for every published
+// message, carrying the message as the API returns it.
+const EventMessagePublished = "messaging.message_published"
+
+// DefaultPullLimit is the page size of a pull that names no limit.
+const DefaultPullLimit = 10
+
+// MaxPayloadBytes bounds a message's decoded payload.
+const MaxPayloadBytes = 1 << 20
+
+// Length limits of topic names and message keys, in characters.
+const (
+	maxTopicLength = 255
+	maxKeyLength   = 255
+)
+
+// ErrStore wraps failures of the underlying storage driver.
+var ErrStore = errors.New("messaging: store unavailable")
+
 // Store abstracts persistence for messaging workloads.
 type Store interface {
 	Save(ctx context.Context, message Message) (Message, error)
-	List(ctx context.Context, filter PullFilter) ([]Message, error)
+	Get(ctx context.Context, topic, messageID string) (Message, error)
+	// List returns one page of a topic's matching messages, high priority
+	// first, then normal, then low, and oldest first within a priority,
+	// and the position of the next page, empty on the last.
+	List(ctx context.Context, filter PullFilter, page pagination.Request) ([]Message, string, error)
 	Delete(ctx context.Context, topic, messageID string) error
+	// Purge removes the messages published before cutoff, or with dryRun
+	// counts them, and returns how many.
+	Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+	// Expire removes the messages whose ExpiresAt is not after now and
+	// returns how many.
+	Expire(ctx context.Context, now time.Time) (int, error)
+	// Schedule holds a message with a DeliverAt out of its topic, and of
+	// Get and List, until Release appends it.
+	Schedule(ctx context.Context, message Message) (Message, error)
+	// Release appends up to limit held messages whose DeliverAt is not
+	// after now to their topics, earliest first, and returns them.
+	Release(ctx context.Context, now time.Time, limit int) ([]Message, error)
 }
 
-// Clock enables deterministic timing in tests.
-type Clock interface {
-	Now() time.Time
-}
+// RetentionPolicy names the policy RegisterRetention registers.
+const RetentionPolicy = "messaging.messages"
 
-type systemClock struct{}
-
-func (systemClock) Now() time.Time { return time.Now().UTC() }
+// DefaultMessageRetention is how long unacknowledged messages are kept
+// unless RETENTION_MAX_AGES says otherwise.
+const DefaultMessageRetention = 7 * 24 * time.Hour
 
 // Service coordinates messaging workflows.
 type Service struct {
-	store Store
-	clock Clock
+	store         Store
+	clock         clock.Clock
+	webhooks      EmitFunc
+	meter         *metering.Meter
+	live          *sse.Hub[Message]
+	replica       *replication.Replicator
+	routes        RouteStore
+	audit         *audit.Log
+	groups        GroupStore
+	lag           LagThresholds
+	topicKeys     TopicKeyStore
+	subscriptions SubscriptionStore
+	leases        LeaseStore
+	deadLetters   DeadLetterStore
+	topics        TopicStore
+	strictTopics  bool
+	arrivals      arrivals
+	// streamKeepAlive is how often idle streams send a comment.
+	streamKeepAlive time.Duration
+	// pullAckDeadline leases pulls naming no ack deadline.
+	pullAckDeadline time.Duration
 }
 
 // NewService constructs a Service.
-func NewService(store Store, clock Clock) *Service {
-	if clock == nil {
-		clock = systemClock{}
+func NewService(store Store, clk clock.Clock) *Service {
+	return &Service{
+		store:           store,
+		clock:           clock.Or(clk),
+		live:            sse.NewHub[Message](sse.Config{}),
+		pullAckDeadline: DefaultAckDeadline,
 	}
-	return &Service{store: store, clock: clock}
 }
 
-// Publish enqueues a message.
+// EmitFunc queues a webhook event, as (*webhooks.Service).EmitEvent does.
+// It takes plain values so that messaging, which the event bus's bridge
+// talks to, does not import the webhooks package and through it the bus.
+type EmitFunc func(ctx context.Context, name, id, tenantID, projectID string, data any)
+
+// SetWebhooks emits EventMessagePublished through emit for every published
+// message. Call it before the service handles requests.
+func (s *Service) SetWebhooks(emit EmitFunc) {
+	s.webhooks = emit
+}
+
+// RegisterRetention registers RetentionPolicy with m, purging messages
+// that were never acknowledged once they are older than the policy's age,
+// or than their topic's retention (see SetTopicStore).
+func (s *Service) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        RetentionPolicy,
+		Description: "messages published before the cutoff, or their topic's retention, that are still pending",
+		MaxAge:      DefaultMessageRetention,
+		Purge:       s.purge,
+	})
+}
+
+// SetReplicator records each published and acknowledged message with r,
+// and applies those the peer region records. Call it before the service
+// handles requests.
+func (s *Service) SetReplicator(r *replication.Replicator) {
+	s.replica = r
+	r.Register(ReplicatePublish, s.applyPublish)
+	r.Register(ReplicateAck, s.applyAck)
+}
+
+// SetMeter counts each published message as metering.MessagesPublished for
+// its tenant. Call it before the service handles requests.
+func (s *Service) SetMeter(m *metering.Meter) {
+	s.meter = m
+}
+
+// Publish enqueues a message in the topic the routing rules send it to,
+// and its copies in theirs. A message the rules drop is returned as it
+// would have been stored, but nothing is stored. The request ID carried by
+// ctx is recorded in the attribute logging.RequestIDField unless the
+// request sets it, so consumers can correlate their work with the
+// publisher's. Payloads are stored encrypted in topics their tenant
+// registered a key for (see SetTopicKeyStore), and the settings of a
+// created topic apply (see SetTopicStore). A delayed message and its
+// copies are held until they are due (see Release).
 func (s *Service) Publish(ctx context.Context, req PublishRequest) (Message, error) {
-	if req.TenantID == "" || req.ProjectID == "" || req.Topic == "" {
-		return Message{}, errors.New("tenant_id, project_id, and topic required")
-	}
-	priority := req.Priority
-	if priority == "" {
-		priority = PriorityNormal
+	message, _, err := s.publish(ctx, req)
+	return message, err
+}
+
+func (s *Service) publish(ctx context.Context, req PublishRequest) (Message, Route, error) {
+	var v validation.Validator
+	v.ID("tenant_id", req.TenantID)
+	v.ID("project_id", req.ProjectID)
+	v.String("topic", req.Topic).Required().MaxLength(maxTopicLength)
+	v.String("key", req.Key).MaxLength(maxKeyLength)
+	v.Bytes("payload_base64", req.Payload).MaxBytes(MaxPayloadBytes)
+	v.Map("attributes", req.Attributes).Limited()
+	checkTTL(&v, "ttl_seconds", req.TTL)
+	now := s.clock.Now()
+	deliverAt := checkDelivery(&v, req.DeliverAt, req.Delay, now)
+	if err := v.Err(); err != nil {
+		return Message{}, Route{}, err
 	}
+	priority := cmp.Or(req.Priority, PriorityNormal)
 	message := Message{
-		MessageID:   newIdentifier(),
+		MessageID:   id.New(id.PrefixMessage),
 		TenantID:    req.TenantID,
 		ProjectID:   req.ProjectID,
 		Topic:       req.Topic,
 		Key:         req.Key,
 		Payload:     append([]byte(nil), req.Payload...),
 		Priority:    priority,
-		PublishedAt: s.clock.Now(),
+		PublishedAt: now,
+		DeliverAt:   deliverAt,
 		Attributes:  cloneMap(req.Attributes),
 	}
+	if req.TTL > 0 {
+		message.ExpiresAt = deliverable(message).Add(req.TTL)
+	}
+	if id := logging.RequestID(ctx); id != "" && message.Attributes[logging.RequestIDField] == "" {
+		if message.Attributes == nil {
+			message.Attributes = make(map[string]string, 1)
+		}
+		message.Attributes[logging.RequestIDField] = id
+	}
+	if err := s.applyTopic(ctx, &message, req.Priority != ""); err != nil {
+		return Message{}, Route{}, err
+	}
+	route, err := s.route(ctx, message)
+	if err != nil {
+		return Message{}, Route{}, err
+	}
+	destinations := route.Copies
+	if !route.Dropped && route.Topic != message.Topic {
+		destinations = append([]string{route.Topic}, destinations...)
+	}
+	for _, topic := range destinations {
+		if err := s.requireTopic(ctx, topic); err != nil {
+			return Message{}, Route{}, err
+		}
+	}
+	// Each copy is encrypted for its own topic, from the plaintext.
+	plain := message
+	if !route.Dropped {
+		message.Topic = route.Topic
+		if err := s.encrypt(ctx, &message); err != nil {
+			return Message{}, Route{}, err
+		}
+		if message, err = s.deliver(ctx, message); err != nil {
+			return Message{}, Route{}, err
+		}
+	}
+	for _, topic := range route.Copies {
+		copied := plain
+		copied.MessageID = id.New(id.PrefixMessage)
+		copied.Topic = topic
+		copied.Attributes = cloneMap(plain.Attributes)
+		if err := s.encrypt(ctx, &copied); err != nil {
+			return Message{}, Route{}, err
+		}
+		if _, err := s.deliver(ctx, copied); err != nil {
+			return Message{}, Route{}, err
+		}
+	}
+	return message, route, nil
+}
+
+// save stores message and announces it to meters, replicas, subscribers,
+// and webhooks.
+func (s *Service) save(ctx context.Context, message Message) (Message, error) {
 	saved, err := s.store.Save(ctx, message)
 	if err != nil {
 		return Message{}, err
 	}
+	s.announce(ctx, saved)
 	return saved, nil
 }
 
-// Pull retrieves messages matching the filter up to the provided limit.
-func (s *Service) Pull(ctx context.Context, filter PullFilter) ([]Message, error) {
+// announce tells meters, replicas, subscribers, and webhooks of a message
+// stored in its topic.
+func (s *Service) announce(ctx context.Context, saved Message) {
+	s.meter.Record(ctx, saved.TenantID, metering.MessagesPublished, 1)
+	s.replica.Record(ctx, ReplicatePublish, topicPrefix(saved.Topic)+saved.MessageID, saved.PublishedAt,
+		storedMessage{Message: saved, Payload: saved.Payload})
+	s.live.Publish(saved)
+	s.arrivals.notify(saved.Topic)
+	if s.webhooks != nil {
+		s.webhooks(ctx, EventMessagePublished, saved.MessageID, saved.TenantID, saved.ProjectID, toMessageResponse(saved))
+	}
+}
+
+// SetStreamKeepAlive has idle /topics/{topic}/stream connections send a
+// keep-alive comment every d, so proxies keep them open; zero uses
+// sse.DefaultKeepAlive. Call it before the service handles requests.
+func (s *Service) SetStreamKeepAlive(d time.Duration) {
+	s.streamKeepAlive = d
+}
+
+// Subscribe streams the messages this replica publishes that match the
+// filter as Pull matches them, after the message with lastEventID when it
+// is still buffered, as described for sse.Hub.Subscribe. Streamed
+// messages stay pending until acknowledged. The caller closes the
+// subscription.
+func (s *Service) Subscribe(filter PullFilter, lastEventID string) (*sse.Subscription[Message], error) {
 	if filter.Topic == "" {
-		return nil, errors.New("topic required")
+		return nil, validation.Invalid("topic", validation.RuleRequired, "is required")
 	}
-	if filter.Limit <= 0 {
-		filter.Limit = 10
+	sub, _ := s.live.Subscribe(func(m Message) bool {
+		return m.Topic == filter.Topic &&
+			(filter.TenantID == "" || m.TenantID == filter.TenantID) &&
+			(filter.ProjectID == "" || m.ProjectID == filter.ProjectID)
+	}, lastEventID)
+	return sub, nil
+}
+
+// Pull retrieves one page of messages matching the filter, highest
+// priority first and in publish order within a priority, and the position
+// of the next page. A pull with a Wait finding no messages waits up to
+// that long for one to arrive. A pull naming a consumer group moves the
+// group's position past the messages returned. With a LeaseStore, messages leased
+// by earlier pulls are left out until their deadline, and a pull naming an
+// ack deadline leases those it returns (see SetLeaseStore).
+func (s *Service) Pull(ctx context.Context, filter PullFilter, page pagination.Request) ([]Message, string, error) {
+	if filter.Topic == "" {
+		return nil, "", validation.Invalid("topic", validation.RuleRequired, "is required")
 	}
-	messages, err := s.store.List(ctx, filter)
-	if err != nil {
-		return nil, err
+	if err := validateGroup(filter.Group); err != nil {
+		return nil, "", err
+	}
+	var v validation.Validator
+	if filter.AckDeadline != 0 {
+		checkAckDeadline(&v, filter.AckDeadline)
+	}
+	checkPullWait(&v, filter.Wait)
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+	if page.Limit <= 0 {
+		page.Limit = DefaultPullLimit
+	}
+	var timeout <-chan time.Time
+	if filter.Wait > 0 {
+		timer := s.clock.NewTimer(filter.Wait)
+		defer timer.Stop()
+		timeout = timer.C()
+	}
+	var (
+		messages []Message
+		next     string
+	)
+	for {
+		// Watch before listing, so a message arriving in between wakes us.
+		var arrived <-chan struct{}
+		unwatch := func() {}
+		if timeout != nil {
+			arrived, unwatch = s.arrivals.watch(filter.Topic)
+		}
+		var err error
+		messages, next, err = s.list(ctx, filter, page)
+		if err != nil {
+			unwatch()
+			return nil, "", err
+		}
+		if len(messages) > 0 || timeout == nil {
+			unwatch()
+			break
+		}
+		recheck := s.clock.NewTimer(pullRecheck)
+		select {
+		case <-arrived:
+		case <-recheck.C():
+		case <-timeout:
+			timeout = nil
+		case <-ctx.Done():
+		}
+		recheck.Stop()
+		unwatch()
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
 	}
 	// Ensure payload slices are not shared with store state.
 	for i := range messages {
 		messages[i].Payload = append([]byte(nil), messages[i].Payload...)
 	}
-	return messages, nil
+	if err := s.pulled(ctx, filter, messages); err != nil {
+		return nil, "", err
+	}
+	return messages, next, nil
+}
+
+// Get returns a single message from topic.
+func (s *Service) Get(ctx context.Context, topic, messageID string) (Message, error) {
+	if err := requireMessage(topic, messageID); err != nil {
+		return Message{}, err
+	}
+	return s.store.Get(ctx, topic, messageID)
 }
 
 // Ack removes a message after successful processing.
 func (s *Service) Ack(ctx context.Context, topic, messageID string) error {
-	if topic == "" || messageID == "" {
-		return errors.New("topic and message_id required")
+	if err := requireMessage(topic, messageID); err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, topic, messageID); err != nil {
+		return err
 	}
-	return s.store.Delete(ctx, topic, messageID)
+	s.replica.Record(ctx, ReplicateAck, topicPrefix(topic)+messageID, s.clock.Now(), ackedMessage{Topic: topic, MessageID: messageID})
+	return nil
+}
+
+func requireMessage(topic, messageID string) error {
+	var v validation.Validator
+	v.String("topic", topic).Required()
+	v.String("message_id", messageID).Required()
+	return v.Err()
 }
 
 // EncodePayloadBase64 creates a base64 representation of message payloads.
@@ -123,7 +414,7 @@ func ParsePriority(value string) (Priority, error) {
 	case "high":
 		return PriorityHigh, nil
 	default:
-		return "", errors.New("unknown priority")
+		return "", validation.Invalid("priority", validation.RuleOneOf, "must be one of low, normal, high")
 	}
 }
 
@@ -137,11 +428,3 @@ func cloneMap(in map[string]string) map[string]string {
 	}
 	return out
 }
-
-func newIdentifier() string {
-	buf := make([]byte, 16)
-	if _, err := rand.Read(buf); err != nil {
-		return hex.EncodeToString([]byte(time.Now().UTC().Format("20060102150405.000")))
-	}
-	return hex.EncodeToString(buf)
-}
@@ -0,0 +1,77 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+// newTestService returns a service with every optional store set on one
+// memory store, running on a fake clock.
+func newTestService(t *testing.T) (*Service, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	if _, err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	svc := NewService(store, clk)
+	svc.SetRouteStore(store)
+	svc.SetGroupStore(store)
+	svc.SetTopicKeyStore(store)
+	svc.SetSubscriptionStore(store)
+	svc.SetLeaseStore(store)
+	svc.SetDeadLetterStore(store)
+	svc.SetTopicStore(store)
+	return svc, clk
+}
+
+// serve sends a request with payload, if any, as its JSON body to h and
+// returns the status and body.
+func serve(t *testing.T, h http.Handler, method, target string, payload any) (int, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, &body))
+	return rec.Code, rec.Body.Bytes()
+}
+
+// publish publishes a message with key on topic for acme/p1.
+func publish(t *testing.T, svc *Service, topic, key string, opts ...func(*PublishRequest)) Message {
+	t.Helper()
+	req := PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: topic, Key: key}
+	for _, opt := range opts {
+		opt(&req)
+	}
+	message, err := svc.Publish(context.Background(), req)
+	if err != nil {
+		t.Fatalf("publish %s: %v", key, err)
+	}
+	return message
+}
+
+// pullKeys pulls up to limit of acme's messages on topic under filter's
+// settings and returns their keys.
+func pullKeys(t *testing.T, svc *Service, filter PullFilter, limit int) string {
+	t.Helper()
+	if filter.TenantID == "" {
+		filter.TenantID = "acme"
+	}
+	messages, _, err := svc.Pull(context.Background(), filter, pagination.Request{Limit: limit})
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	return keys(messages)
+}
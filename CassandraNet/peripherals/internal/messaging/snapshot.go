@@ -0,0 +1,316 @@
+package messaging
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrImportTooLarge is returned when a snapshot holds more than
+// MaxImportMessages messages or MaxImportBytes of uncompressed NDJSON.
+var ErrImportTooLarge = errors.New("messaging: snapshot too large")
+
+// Bounds of one imported snapshot.
+const (
+	MaxImportMessages = 10000
+	MaxImportBytes    = 64 << 20
+)
+
+// maxSnapshotLine bounds one NDJSON line, room for the largest payload in
+// base64 and the message around it.
+const maxSnapshotLine = 2 * MaxPayloadBytes
+
+const codeImportTooLarge = "messaging.import_too_large"
+
+// ImportResult counts the messages ImportTopic stored, and those it left
+// out because the topic already held a message with their ID.
+type ImportResult struct {
+	Topic    string `json:"topic"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+}
+
+// ExportTopic calls fn with each of the topic's pending messages that
+// match filter, in the order Pull returns them, without moving any
+// consumer group.
+func (s *Service) ExportTopic(ctx context.Context, filter PullFilter, fn func(Message) error) error {
+	if filter.Topic == "" {
+		return validation.Invalid("topic", validation.RuleRequired, "is required")
+	}
+	page := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		messages, next, err := s.store.List(ctx, filter, page)
+		if err != nil {
+			return err
+		}
+		for _, message := range messages {
+			if err := fn(message); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		page.After = next
+	}
+}
+
+// ImportTopic appends messages to topic in order, keeping their keys,
+// payloads, priorities, attributes, and publish times. With remap each
+// gets a new ID; otherwise each keeps its own and is skipped when the
+// topic already holds it, so a snapshot can be imported again after a
+// failure part way through. Imported messages bypass the routing rules,
+// are not metered or sent to webhooks, and are streamed to subscribers
+// and replicated like published ones.
+func (s *Service) ImportTopic(ctx context.Context, topic string, messages []Message, remap bool) (ImportResult, error) {
+	result := ImportResult{Topic: topic}
+	var v validation.Validator
+	v.String("topic", topic).Required().MaxLength(maxTopicLength)
+	v.Int("messages", int64(len(messages))).Range(0, MaxImportMessages)
+	for i, message := range messages {
+		prefix := "messages[" + strconv.Itoa(i) + "]."
+		v.ID(prefix+"tenant_id", message.TenantID)
+		v.ID(prefix+"project_id", message.ProjectID)
+		if !remap {
+			v.ID(prefix+"message_id", message.MessageID)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return result, err
+	}
+	for _, message := range messages {
+		message.Topic = topic
+		if remap {
+			message.MessageID = id.New(id.PrefixMessage)
+		} else if _, err := s.store.Get(ctx, topic, message.MessageID); err == nil {
+			result.Skipped++
+			continue
+		} else if !errors.Is(err, ErrMessageNotFound) {
+			return result, err
+		}
+		saved, err := s.store.Save(ctx, message)
+		if err != nil {
+			return result, err
+		}
+		s.replica.Record(ctx, ReplicatePublish, topicPrefix(saved.Topic)+saved.MessageID, saved.PublishedAt,
+			storedMessage{Message: saved, Payload: saved.Payload})
+		s.live.Publish(saved)
+		s.arrivals.notify(saved.Topic)
+		result.Imported++
+	}
+	return result, nil
+}
+
+// handleExport serves GET /topics/{topic}/export, the topic's pending
+// messages in the requested scope as gzip-compressed NDJSON, one message
+// per line in the version 1 response shape. A store failure after the
+// first message can only cut the body short.
+func (s *Service) handleExport(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return
+	}
+	requestedProject := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), requestedProject)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+requestedProject)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, tenant, project) {
+		return
+	}
+	var out *gzip.Writer
+	var enc *json.Encoder
+	start := func() {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+url.PathEscape(topic)+`.ndjson.gz"`)
+		out = gzip.NewWriter(w)
+		enc = json.NewEncoder(out)
+	}
+	err := s.ExportTopic(r.Context(), PullFilter{TenantID: tenant, ProjectID: project, Topic: topic}, func(m Message) error {
+		if out == nil {
+			start()
+		}
+		return enc.Encode(toMessageResponse(m))
+	})
+	if out == nil {
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		start()
+	}
+	_ = out.Close()
+}
+
+// handleImport serves POST /topics/{topic}/import. The body is a snapshot
+// as handleExport writes it, gzip-compressed or not; ids=remap gives the
+// messages new IDs. tenant_id and project_id, when given or bound to the
+// credentials, replace the messages' own. The snapshot is read and
+// checked in full before any message is stored.
+func (s *Service) handleImport(w http.ResponseWriter, r *http.Request, topic string) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	query := r.URL.Query()
+	tenant, ok := auth.ResolveTenant(r.Context(), query.Get("tenant_id"))
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+query.Get("tenant_id"))
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), query.Get("project_id"))
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+query.Get("project_id"))
+		return
+	}
+	ids := query.Get("ids")
+	var v validation.Validator
+	if ids != "" {
+		v.String("ids", ids).OneOf("preserve", "remap")
+	}
+	if err := v.Err(); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	messages, err := readSnapshot(r.Body)
+	if errors.Is(err, ErrImportTooLarge) {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, codeImportTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	scopes := make(map[Scope]bool)
+	for i := range messages {
+		if tenant != "" {
+			messages[i].TenantID = tenant
+		}
+		if project != "" {
+			messages[i].ProjectID = project
+		}
+		scope := Scope{TenantID: messages[i].TenantID, ProjectID: messages[i].ProjectID}
+		if !scopes[scope] {
+			if !auth.Allow(w, r, auth.PermMessagesPublish, scope.TenantID, scope.ProjectID) {
+				return
+			}
+			scopes[scope] = true
+		}
+	}
+	result, err := s.ImportTopic(r.Context(), topic, messages, ids == "remap")
+	if err == nil || result.Imported > 0 {
+		s.audit.Record(r.Context(), audit.Change{
+			Action:    "messaging.topic.import",
+			Resource:  "topics/" + topic,
+			TenantID:  tenant,
+			ProjectID: project,
+			After:     result,
+		})
+	}
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// readSnapshot decodes the NDJSON messages in body, decompressing it
+// first when it starts with a gzip header. Blank lines are skipped.
+func readSnapshot(body io.Reader) ([]Message, error) {
+	buffered := bufio.NewReader(body)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		unzipped, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, validation.Invalid("body", validation.RuleFormat, "must be NDJSON or gzip-compressed NDJSON")
+		}
+		defer unzipped.Close()
+		body = unzipped
+	} else {
+		body = buffered
+	}
+	limited := &io.LimitedReader{R: body, N: MaxImportBytes + 1}
+	lines := bufio.NewScanner(limited)
+	lines.Buffer(make([]byte, 0, 64<<10), maxSnapshotLine)
+	var messages []Message
+	var v validation.Validator
+	for lines.Scan() {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(messages) == MaxImportMessages {
+			return nil, ErrImportTooLarge
+		}
+		prefix := "messages[" + strconv.Itoa(len(messages)) + "]."
+		messages = append(messages, snapshotMessage(&v, prefix, line))
+	}
+	if limited.N <= 0 || errors.Is(lines.Err(), bufio.ErrTooLong) {
+		return nil, ErrImportTooLarge
+	}
+	if err := lines.Err(); err != nil {
+		return nil, validation.Invalid("body", validation.RuleFormat, "must be NDJSON or gzip-compressed NDJSON: "+err.Error())
+	}
+	return messages, v.Err()
+}
+
+// snapshotMessage checks one snapshot line, naming its fields after
+// prefix, and converts it.
+func snapshotMessage(v *validation.Validator, prefix string, line []byte) Message {
+	var payload messageResponse
+	if err := json.Unmarshal(line, &payload); err != nil {
+		v.Check(false, prefix[:len(prefix)-1], validation.RuleFormat, "must be a JSON message")
+		return Message{}
+	}
+	message := Message{
+		MessageID:  payload.MessageID,
+		TenantID:   payload.TenantID,
+		ProjectID:  payload.ProjectID,
+		Key:        payload.Key,
+		Attributes: cloneMap(payload.Attributes),
+	}
+	v.String(prefix+"key", message.Key).MaxLength(maxKeyLength)
+	v.Map(prefix+"attributes", message.Attributes).Limited()
+	var err error
+	message.Payload, err = DecodePayloadBase64(payload.PayloadBase64)
+	v.Check(err == nil, prefix+"payload_base64", validation.RuleFormat, "must be valid base64")
+	v.Bytes(prefix+"payload_base64", message.Payload).MaxBytes(MaxPayloadBytes)
+	message.Priority, err = ParsePriority(payload.Priority)
+	v.Check(err == nil, prefix+"priority", validation.RuleOneOf, "must be one of low, normal, high")
+	published, err := time.Parse(time.RFC3339Nano, payload.PublishedAt)
+	v.Check(err == nil, prefix+"published_at", validation.RuleFormat, "must be an RFC 3339 timestamp")
+	message.PublishedAt = published.UTC()
+	if payload.DeliverAt != "" {
+		deliver, err := time.Parse(time.RFC3339Nano, payload.DeliverAt)
+		v.Check(err == nil, prefix+"deliver_at", validation.RuleFormat, "must be an RFC 3339 timestamp")
+		message.DeliverAt = deliver.UTC()
+	}
+	if payload.ExpiresAt != "" {
+		expires, err := time.Parse(time.RFC3339Nano, payload.ExpiresAt)
+		v.Check(err == nil, prefix+"expires_at", validation.RuleFormat, "must be an RFC 3339 timestamp")
+		message.ExpiresAt = expires.UTC()
+	}
+	return message
+}
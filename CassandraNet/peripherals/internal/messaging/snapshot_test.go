@@ -0,0 +1,97 @@
+package messaging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+func TestTopicSnapshotsExportAndImport(t *testing.T) {
+	svc, _ := newTestService(t)
+	log := audit.New(storage.NewMemory(), "messaging", logging.New("test"))
+	svc.SetAudit(log)
+	h := svc.Handler()
+	publish(t, svc, "orders", "order-1", func(r *PublishRequest) { r.Payload = []byte("1") })
+	publish(t, svc, "orders", "order-2", func(r *PublishRequest) {
+		r.Payload, r.Priority, r.Attributes = []byte("2"), PriorityHigh, map[string]string{"region": "eu"}
+	})
+	publish(t, svc, "orders", "order-3", func(r *PublishRequest) { r.Payload = []byte("3") })
+	pending := func(topic, tenant string) []Message {
+		t.Helper()
+		messages, _, err := svc.Pull(context.Background(), PullFilter{TenantID: tenant, Topic: topic}, pagination.Request{Limit: 100})
+		if err != nil {
+			t.Fatalf("pull %s: %v", topic, err)
+		}
+		return messages
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/topics/orders/export?tenant_id=acme", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("export: %d %s", rec.Code, rec.Body)
+	}
+	snapshot := rec.Body.Bytes()
+	unzipped, err := gzip.NewReader(bytes.NewReader(snapshot))
+	if err != nil {
+		t.Fatalf("export is not gzip: %v", err)
+	}
+	lines, _ := io.ReadAll(unzipped)
+	if n := strings.Count(string(lines), "\n"); n != 3 {
+		t.Fatalf("expected 3 exported messages, got %d: %s", n, lines)
+	}
+
+	importSnapshot := func(query string, body []byte) (int, ImportResult, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/topics/orders-staging/import"+query, bytes.NewReader(body)))
+		var result ImportResult
+		_ = json.Unmarshal(rec.Body.Bytes(), &result)
+		return rec.Code, result, rec.Body.String()
+	}
+	if status, result, raw := importSnapshot("", snapshot); status != http.StatusOK || result.Imported != 3 || result.Skipped != 0 {
+		t.Fatalf("expected 3 imported, got %d %s", status, raw)
+	}
+	original, imported := pending("orders", "acme"), pending("orders-staging", "acme")
+	if len(imported) != 3 {
+		t.Fatalf("expected 3 imported messages, got %d", len(imported))
+	}
+	for i := range original {
+		o, m := original[i], imported[i]
+		if m.MessageID != o.MessageID || m.Key != o.Key || !bytes.Equal(m.Payload, o.Payload) || m.Priority != o.Priority ||
+			!m.PublishedAt.Equal(o.PublishedAt) || m.Attributes["region"] != o.Attributes["region"] {
+			t.Fatalf("message %d: expected %+v kept, got %+v", i, o, m)
+		}
+	}
+	if status, result, raw := importSnapshot("?ids=preserve", snapshot); status != http.StatusOK || result.Imported != 0 || result.Skipped != 3 {
+		t.Fatalf("expected a repeated import skipped, got %d %s", status, raw)
+	}
+	if status, result, raw := importSnapshot("?ids=remap&tenant_id=staging&project_id=s1", snapshot); status != http.StatusOK || result.Imported != 3 {
+		t.Fatalf("expected a remapped import, got %d %s", status, raw)
+	}
+	remapped := pending("orders-staging", "staging")
+	if len(remapped) != 3 || remapped[0].MessageID == original[0].MessageID || remapped[0].Key != "order-2" || remapped[0].ProjectID != "s1" {
+		t.Fatalf("expected new IDs under the staging tenant, got %+v", remapped)
+	}
+
+	if status, _, raw := importSnapshot("", []byte(`{"message_id":"msg_x","tenant_id":"acme","project_id":"p1"}`+"\n")); status != http.StatusBadRequest || !strings.Contains(raw, "messages[0].published_at") {
+		t.Fatalf("expected a message without a publish time refused, got %d %s", status, raw)
+	}
+	if status, _, raw := importSnapshot("?ids=rename", snapshot); status != http.StatusBadRequest {
+		t.Fatalf("expected an unknown ids mode refused, got %d %s", status, raw)
+	}
+	entries, _, err := log.List(context.Background(), audit.Filter{Action: "messaging.topic.import"}, pagination.Request{Limit: 10})
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected every import audited, got %d %v", len(entries), err)
+	}
+}
@@ -0,0 +1,60 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// DefaultSQLTable is the table an SQLStore keeps its rows in unless its
+// DSN names another.
+const DefaultSQLTable = "messaging_store"
+
+// SQLStore is a StorageStore in a SQL database of its own, so messages can
+// be kept apart from the storage driver the service's other records use.
+// Its records are rows of one table, created by the first transaction,
+// which Migrate runs.
+type SQLStore struct {
+	*StorageStore
+	db *storage.Postgres
+}
+
+// OpenSQLStore returns the store in the database dsn names, a postgres://
+// URL as STORAGE_URL takes. SQLite is not supported: its drivers need cgo
+// or a third-party module, and this module uses the standard library only.
+// No connection is made until the store is first used.
+func OpenSQLStore(dsn string) (*SQLStore, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+	case "sqlite", "sqlite3", "file":
+		return nil, errors.New("SQLite is not supported; use a postgres:// URL")
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q; use a postgres:// URL", u.Scheme)
+	}
+	if query := u.Query(); !query.Has("table") {
+		query.Set("table", DefaultSQLTable)
+		u.RawQuery = query.Encode()
+	}
+	db, err := storage.NewPostgres(u.String())
+	if err != nil {
+		return nil, err
+	}
+	return &SQLStore{StorageStore: NewStorageStore(db), db: db}, nil
+}
+
+// Check reports whether the database is reachable.
+func (s *SQLStore) Check(ctx context.Context) error {
+	return s.db.Check(ctx)
+}
+
+// Close closes the store's connections.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,1657 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Buckets used by StorageStore. Keys start with the escaped topic and a
+// slash, so one topic's keys never share a prefix with another's. Messages
+// are keyed by a number from their topic's storage sequence so a scan
+// returns them in publish order, and the ID bucket maps topic and message
+// ID to that key. The sequence bucket holds the counters of releases that
+// numbered messages in a transaction, which Migrate carries over.
+// Routing rules are keyed by their escaped scope and ID, and consumer
+// group positions by their escaped scope, group, and topic. Topic keys
+// are keyed by their escaped tenant and topic, and subscriptions by their
+// escaped scope, topic, and name. Leases are keyed by their message's key,
+// dead-letter policies by their escaped topic and tenant, and topics by
+// their escaped name. Delayed messages are keyed by their delivery time,
+// escaped topic, and ID, so a scan returns the earliest due first. The
+// priority index maps the escaped topic, priority band, and sequence
+// number of each message to its key, so a scan returns a topic's messages
+// in the order pulls take them. The available index holds the same
+// entries for the messages not leased, and the leased index holds the
+// others under their topic, lease deadline, priority band, and sequence
+// number, so a scan returns the earliest lapsed lease first. The schema
+// bucket holds how many migrations the records have had.
+const (
+	schemaBucket       = "messaging.schema"
+	messageBucket      = "messaging.messages"
+	messageIDs         = "messaging.message_ids"
+	sequenceBucket     = "messaging.sequence"
+	routeBucket        = "messaging.routes"
+	groupBucket        = "messaging.groups"
+	topicKeyBucket     = "messaging.topic_keys"
+	subscriptionBucket = "messaging.subscriptions"
+	leaseBucket        = "messaging.leases"
+	deadLetterBucket   = "messaging.dead_letter_policies"
+	topicBucket        = "messaging.topics"
+	delayedBucket      = "messaging.delayed"
+	priorityBucket     = "messaging.priorities"
+	availableBucket    = "messaging.available"
+	leasedBucket       = "messaging.leased"
+)
+
+// storedMessage carries the payload, which Message leaves out of JSON.
+// Sealed holds it instead when the store has a keyring. ReleasedAt is when
+// Release appended a delayed message to its topic, which is when it took
+// its number; other messages take theirs as they are published.
+type storedMessage struct {
+	Message
+	Payload    []byte    `json:"payload"`
+	Sealed     []byte    `json:"sealed,omitempty"`
+	ReleasedAt time.Time `json:"released_at,omitzero"`
+}
+
+// commitWindow bounds how long a publish takes from taking its number to
+// committing. A subscription's position only passes messages numbered
+// longer ago, so it does not skip one that commits after a message with a
+// higher number.
+const commitWindow = 10 * time.Second
+
+// numberedAt returns when the stored message data took its number.
+func numberedAt(data []byte) (time.Time, error) {
+	var stored struct {
+		PublishedAt time.Time `json:"published_at"`
+		ReleasedAt  time.Time `json:"released_at"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return time.Time{}, err
+	}
+	if stored.ReleasedAt.After(stored.PublishedAt) {
+		return stored.ReleasedAt, nil
+	}
+	return stored.PublishedAt, nil
+}
+
+// ResealName names the records SetKeyring registers for rotation.
+const ResealName = "messaging.messages"
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db   storage.Driver
+	keys *encryption.Keyring
+}
+
+// NewStorageStore returns a store keeping messages in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// SetKeyring seals message payloads with k before storing them and
+// registers the stored messages with k for rotation. Messages stored
+// before are opened as they are and sealed by the next rotation. Call it
+// before the store is used.
+func (s *StorageStore) SetKeyring(k *encryption.Keyring) {
+	s.keys = k
+	k.Register(encryption.Resealer{Name: ResealName, Reseal: s.reseal})
+}
+
+// migration is one step bringing stored records up to date.
+type migration struct {
+	name string
+	run  func(context.Context, *StorageStore) error
+}
+
+// migrations run in order; the store's schema version is how many of them
+// it has had. Replicas starting together may both run one, so each must
+// be safe to repeat.
+var migrations = []migration{
+	{"index priorities", func(ctx context.Context, s *StorageStore) error {
+		_, err := s.IndexPriorities(ctx)
+		return err
+	}},
+	{"number messages from storage sequences", func(ctx context.Context, s *StorageStore) error {
+		return s.carrySequences(ctx)
+	}},
+	{"index available messages", func(ctx context.Context, s *StorageStore) error {
+		_, err := s.IndexAvailable(ctx, time.Now())
+		return err
+	}},
+}
+
+// Migrate runs the migrations the store's records have not had and
+// returns how many it ran. Its first transaction creates an SQL store's
+// table. Call it at startup, before the store is used. Records a later
+// release has migrated further are left as they are.
+func (s *StorageStore) Migrate(ctx context.Context) (int, error) {
+	version := 0
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		raw, err := tx.Get(schemaBucket, "version")
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if version, err = strconv.Atoi(string(raw)); err != nil {
+			return fmt.Errorf("messaging: corrupt schema version: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	ran := 0
+	for ; version < len(migrations); version++ {
+		m := migrations[version]
+		if err := m.run(ctx, s); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", version+1, m.name, err)
+		}
+		err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+			return tx.Put(schemaBucket, "version", []byte(strconv.Itoa(version+1)))
+		})
+		if err != nil {
+			return ran, storeError(err)
+		}
+		ran++
+	}
+	return ran, nil
+}
+
+func topicPrefix(topic string) string {
+	return url.PathEscape(topic) + "/"
+}
+
+// sequenceName names the storage sequence numbering topic's messages.
+func sequenceName(topic string) string {
+	return messageBucket + "/" + url.PathEscape(topic)
+}
+
+// Save appends a message to its topic.
+func (s *StorageStore) Save(ctx context.Context, message Message) (Message, error) {
+	data, err := s.encode(ctx, message)
+	if err != nil {
+		return Message{}, err
+	}
+	seq, err := storage.NextSequence(ctx, s.db, sequenceName(message.Topic))
+	if err != nil {
+		return Message{}, storeError(err)
+	}
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		return appendMessage(tx, message, data, seq)
+	})
+	if err != nil {
+		return Message{}, storeError(err)
+	}
+	return s.decode(ctx, data)
+}
+
+// appendMessage stores the encoded message under seq, a number its
+// topic's sequence handed out, and indexes it under its priority. The
+// transaction only writes, so publishes to one topic do not conflict; a
+// publish may commit before one that took a lower number.
+func appendMessage(tx storage.Tx, message Message, data []byte, seq uint64) error {
+	topic := message.Topic
+	key := fmt.Sprintf("%s%020d", topicPrefix(topic), seq)
+	if err := tx.Put(messageBucket, key, data); err != nil {
+		return err
+	}
+	indexKey := priorityKey(key, message.Priority)
+	if err := tx.Put(priorityBucket, indexKey, []byte(key)); err != nil {
+		return err
+	}
+	if err := tx.Put(availableBucket, indexKey, []byte(key)); err != nil {
+		return err
+	}
+	return tx.Put(messageIDs, topicPrefix(topic)+message.MessageID, []byte(key))
+}
+
+// priorityKey returns the priority index key of the message stored under
+// key: its topic prefix, the band of priority, and its sequence number.
+func priorityKey(key string, priority Priority) string {
+	i := strings.LastIndexByte(key, '/')
+	return key[:i+1] + priorityBand(priority) + key[i:]
+}
+
+// priorityBand returns the index band of priority, which sort highest
+// priority first.
+func priorityBand(priority Priority) string {
+	switch priority {
+	case PriorityHigh:
+		return "0"
+	case PriorityLow:
+		return "2"
+	default:
+		return "1"
+	}
+}
+
+// leasedKey returns the leased index key of the message whose priority
+// index key is indexKey, leased until deadline.
+func leasedKey(indexKey string, deadline time.Time) string {
+	i := strings.IndexByte(indexKey, '/')
+	return fmt.Sprintf("%s%020d%s", indexKey[:i+1], deadline.UnixNano(), indexKey[i:])
+}
+
+// leasedIndexKey returns the priority index key of the leased index key
+// leased.
+func leasedIndexKey(leased string) string {
+	i := strings.IndexByte(leased, '/')
+	return leased[:i] + leased[i+21:]
+}
+
+// IndexPriorities adds the messages stored before the priority index
+// existed to it, and returns how many it added. Migrate runs it once per
+// store.
+func (s *StorageStore) IndexPriorities(ctx context.Context) (int, error) {
+	var missing [][2]string
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(messageBucket, "", func(key string, value []byte) error {
+			message, err := decodeMessage(value)
+			if err != nil {
+				return err
+			}
+			indexKey := priorityKey(key, message.Priority)
+			if _, err := tx.Get(priorityBucket, indexKey); !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+			missing = append(missing, [2]string{indexKey, key})
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	return len(missing), s.putEntries(ctx, priorityBucket, missing)
+}
+
+// IndexAvailable adds each message in the priority index to the leased
+// index when its lease lasts past now and to the available index
+// otherwise, and returns how many it added. Migrate runs it once per
+// store.
+func (s *StorageStore) IndexAvailable(ctx context.Context, now time.Time) (int, error) {
+	var available, leased [][2]string
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(priorityBucket, "", func(indexKey string, value []byte) error {
+			lease, err := getLease(tx, string(value))
+			if err != nil {
+				return err
+			}
+			if lease.Deadline.After(now) {
+				leased = append(leased, [2]string{leasedKey(indexKey, lease.Deadline), string(value)})
+			} else {
+				available = append(available, [2]string{indexKey, string(value)})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, storeError(err)
+	}
+	if err := s.putEntries(ctx, availableBucket, available); err != nil {
+		return 0, err
+	}
+	return len(available) + len(leased), s.putEntries(ctx, leasedBucket, leased)
+}
+
+// putEntries puts the key and value pairs entries in bucket, a batch per
+// transaction.
+func (s *StorageStore) putEntries(ctx context.Context, bucket string, entries [][2]string) error {
+	for batch := range slices.Chunk(entries, retention.BatchSize) {
+		err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+			for _, entry := range batch {
+				if err := tx.Put(bucket, entry[0], []byte(entry[1])); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return storeError(err)
+		}
+	}
+	return nil
+}
+
+// carrySequences raises each topic's storage sequence past the number
+// earlier releases kept in the sequence bucket. Those releases number
+// messages from that bucket alone, so they must not publish once it has
+// run.
+func (s *StorageStore) carrySequences(ctx context.Context) error {
+	counters := make(map[string]uint64)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(sequenceBucket, "", func(topic string, value []byte) error {
+			seq, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("messaging: corrupt sequence for topic %q: %w", topic, err)
+			}
+			counters[topic] = seq
+			return nil
+		})
+	})
+	if err != nil {
+		return storeError(err)
+	}
+	for topic, seq := range counters {
+		if _, err := storage.RaiseSequence(ctx, s.db, messageBucket+"/"+topic, seq); err != nil {
+			return storeError(err)
+		}
+	}
+	return nil
+}
+
+// Schedule holds a message apart from its topic until Release appends it
+// at its DeliverAt.
+func (s *StorageStore) Schedule(ctx context.Context, message Message) (Message, error) {
+	data, err := s.encode(ctx, message)
+	if err != nil {
+		return Message{}, err
+	}
+	key := fmt.Sprintf("%020d/%s%s", message.DeliverAt.UnixNano(), topicPrefix(message.Topic), url.PathEscape(message.MessageID))
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Put(delayedBucket, key, data)
+	})
+	if err != nil {
+		return Message{}, storeError(err)
+	}
+	return s.decode(ctx, data)
+}
+
+// Release appends up to limit held messages whose DeliverAt is not after
+// now to their topics, earliest first, and returns them. Messages another
+// replica releases first are left to it.
+func (s *StorageStore) Release(ctx context.Context, now time.Time, limit int) ([]Message, error) {
+	type held struct {
+		key     string
+		data    []byte
+		message Message
+		seq     uint64
+	}
+	var due []held
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(delayedBucket, "", func(key string, value []byte) error {
+			if len(due) == limit {
+				return storage.StopScan
+			}
+			message, err := decodeMessage(value)
+			if err != nil {
+				return err
+			}
+			if message.DeliverAt.After(now) {
+				return storage.StopScan
+			}
+			due = append(due, held{key: key, data: slices.Clone(value), message: message})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	for i := range due {
+		var stored storedMessage
+		if err := json.Unmarshal(due[i].data, &stored); err != nil {
+			return nil, err
+		}
+		stored.ReleasedAt = now
+		if due[i].data, err = json.Marshal(stored); err != nil {
+			return nil, err
+		}
+		if due[i].seq, err = storage.NextSequence(ctx, s.db, sequenceName(due[i].message.Topic)); err != nil {
+			return nil, storeError(err)
+		}
+	}
+	var released []Message
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		released = nil
+		for _, h := range due {
+			if _, err := tx.Get(delayedBucket, h.key); errors.Is(err, storage.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := tx.Delete(delayedBucket, h.key); err != nil {
+				return err
+			}
+			if err := appendMessage(tx, h.message, h.data, h.seq); err != nil {
+				return err
+			}
+			message, err := s.decode(ctx, h.data)
+			if err != nil {
+				return err
+			}
+			released = append(released, message)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return released, nil
+}
+
+// List retrieves one page of messages matching the filter, highest
+// priority first and oldest first within a priority. Positions are
+// priority index keys, so a cursor stays valid after the messages before
+// it are acknowledged.
+func (s *StorageStore) List(ctx context.Context, filter PullFilter, page pagination.Request) ([]Message, string, error) {
+	collector := pagination.NewCollector[Message](page)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return storage.ScanFrom(tx, priorityBucket, topicPrefix(filter.Topic), page.After, func(indexKey string, key []byte) error {
+			if collector.Skip(indexKey) {
+				return nil
+			}
+			message, err := s.indexed(ctx, tx, string(key))
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if filter.TenantID != "" && message.TenantID != filter.TenantID {
+				return nil
+			}
+			if filter.ProjectID != "" && message.ProjectID != filter.ProjectID {
+				return nil
+			}
+			if !collector.Add(indexKey, message) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	results, next := collector.Page()
+	return results, next, nil
+}
+
+// Lease retrieves one page of messages matching the filter and not leased
+// at now, in the order List returns them, leasing them for
+// filter.AckDeadline when it is positive. Those exhausted reports on are
+// claimed for deadLetterClaim and returned apart. It first returns the
+// topic's lapsed leases to the available index and then scans that, so
+// leased messages cost nothing.
+func (s *StorageStore) Lease(ctx context.Context, filter PullFilter, page pagination.Request, now time.Time, exhausted func(Message, int) bool) ([]Message, []Message, string, error) {
+	prefix := topicPrefix(filter.Topic)
+	var (
+		results, dead []Message
+		next          string
+	)
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		dead = nil
+		var lapsed [][2]string
+		err := tx.Scan(leasedBucket, prefix, func(leased string, key []byte) error {
+			if leased >= leasedKey(prefix, now.Add(time.Nanosecond)) {
+				return storage.StopScan
+			}
+			lapsed = append(lapsed, [2]string{leased, string(key)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, entry := range lapsed {
+			if err := tx.Delete(leasedBucket, entry[0]); err != nil {
+				return err
+			}
+			if err := tx.Put(availableBucket, leasedIndexKey(entry[0]), []byte(entry[1])); err != nil {
+				return err
+			}
+		}
+
+		// Leases are taken once the scan is done, since they move
+		// entries out of the bucket it reads.
+		type taken struct {
+			indexKey, key string
+			lease         storedLease
+		}
+		var leases []taken
+		collector := pagination.NewCollector[Message](page)
+		err = storage.ScanFrom(tx, availableBucket, prefix, page.After, func(indexKey string, value []byte) error {
+			if collector.Skip(indexKey) {
+				return nil
+			}
+			key := string(value)
+			lease, err := getLease(tx, key)
+			if err != nil {
+				return err
+			}
+			if lease.Deadline.After(now) {
+				// Left behind by a lease taken elsewhere; move it along.
+				leases = append(leases, taken{indexKey, key, lease})
+				return nil
+			}
+			message, err := s.indexed(ctx, tx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if filter.TenantID != "" && message.TenantID != filter.TenantID {
+				return nil
+			}
+			if filter.ProjectID != "" && message.ProjectID != filter.ProjectID {
+				return nil
+			}
+			if lease.Deliveries > 0 && exhausted != nil && exhausted(message, lease.Deliveries) {
+				dead = append(dead, message)
+				lease.Deadline = now.Add(deadLetterClaim)
+				leases = append(leases, taken{indexKey, key, lease})
+				return nil
+			}
+			if !collector.Add(indexKey, message) {
+				return storage.StopScan
+			}
+			if filter.AckDeadline > 0 {
+				lease.Deadline = now.Add(filter.AckDeadline)
+				lease.Deliveries++
+				leases = append(leases, taken{indexKey, key, lease})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, l := range leases {
+			if err := tx.Delete(availableBucket, l.indexKey); err != nil {
+				return err
+			}
+			if err := tx.Put(leasedBucket, leasedKey(l.indexKey, l.lease.Deadline), []byte(l.key)); err != nil {
+				return err
+			}
+			if err := putLease(tx, l.key, l.lease); err != nil {
+				return err
+			}
+		}
+		results, next = collector.Page()
+		return nil
+	})
+	if err != nil {
+		return nil, nil, "", storeError(err)
+	}
+	return results, dead, next, nil
+}
+
+// Extend moves the deadline of a message's lease that has not ended by now
+// to until.
+func (s *StorageStore) Extend(ctx context.Context, topic, messageID string, now, until time.Time) error {
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		key, indexKey, err := leasedMessage(tx, topic, messageID)
+		if err != nil {
+			return err
+		}
+		lease, err := getLease(tx, key)
+		if err != nil {
+			return err
+		}
+		if !lease.Deadline.After(now) {
+			return ErrNotLeased
+		}
+		if err := tx.Delete(leasedBucket, leasedKey(indexKey, lease.Deadline)); err != nil {
+			return err
+		}
+		if err := tx.Put(leasedBucket, leasedKey(indexKey, until), []byte(key)); err != nil {
+			return err
+		}
+		lease.Deadline = until
+		return putLease(tx, key, lease)
+	})
+	return storeError(err)
+}
+
+// Nack ends a message's lease that has not ended by now, claiming the
+// message for deadLetterClaim instead when exhausted reports on it.
+func (s *StorageStore) Nack(ctx context.Context, topic, messageID string, now time.Time, exhausted func(Message, int) bool) (Message, bool, error) {
+	var (
+		message Message
+		dead    bool
+	)
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		key, indexKey, err := leasedMessage(tx, topic, messageID)
+		if err != nil {
+			return err
+		}
+		lease, err := getLease(tx, key)
+		if err != nil {
+			return err
+		}
+		if !lease.Deadline.After(now) {
+			return ErrNotLeased
+		}
+		data, err := tx.Get(messageBucket, key)
+		if err != nil {
+			return err
+		}
+		if message, err = s.decode(ctx, data); err != nil {
+			return err
+		}
+		if err := tx.Delete(leasedBucket, leasedKey(indexKey, lease.Deadline)); err != nil {
+			return err
+		}
+		dead = exhausted != nil && exhausted(message, lease.Deliveries)
+		lease.Deadline = now
+		if dead {
+			lease.Deadline = now.Add(deadLetterClaim)
+			err = tx.Put(leasedBucket, leasedKey(indexKey, lease.Deadline), []byte(key))
+		} else {
+			err = tx.Put(availableBucket, indexKey, []byte(key))
+		}
+		if err != nil {
+			return err
+		}
+		return putLease(tx, key, lease)
+	})
+	if err != nil {
+		return Message{}, false, storeError(err)
+	}
+	return message, dead, nil
+}
+
+// leasedMessage returns the storage and priority index keys of the message
+// with messageID in topic.
+func leasedMessage(tx storage.Tx, topic, messageID string) (string, string, error) {
+	key, err := messageKey(tx, topic, messageID)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := tx.Get(messageBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", "", ErrMessageNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	message, err := decodeMessage(data)
+	if err != nil {
+		return "", "", err
+	}
+	return key, priorityKey(key, message.Priority), nil
+}
+
+// removeIndexed deletes the index entries and lease of the message stored
+// at key.
+func removeIndexed(tx storage.Tx, key string, message Message) error {
+	indexKey := priorityKey(key, message.Priority)
+	lease, err := getLease(tx, key)
+	if err != nil {
+		return err
+	}
+	if !lease.Deadline.IsZero() {
+		if err := tx.Delete(leasedBucket, leasedKey(indexKey, lease.Deadline)); err != nil {
+			return err
+		}
+	}
+	for _, entry := range [][2]string{{priorityBucket, indexKey}, {availableBucket, indexKey}, {leaseBucket, key}} {
+		if err := tx.Delete(entry[0], entry[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storedLease is a message's lease: its deadline and how many leasing
+// pulls have delivered the message.
+type storedLease struct {
+	Deadline   time.Time `json:"deadline"`
+	Deliveries int       `json:"deliveries"`
+}
+
+// getLease returns the lease on the message stored at key, zero when it
+// has none.
+func getLease(tx storage.Tx, key string) (storedLease, error) {
+	raw, err := tx.Get(leaseBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storedLease{}, nil
+	}
+	if err != nil {
+		return storedLease{}, err
+	}
+	var lease storedLease
+	err = json.Unmarshal(raw, &lease)
+	return lease, err
+}
+
+func putLease(tx storage.Tx, key string, lease storedLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	return tx.Put(leaseBucket, key, data)
+}
+
+// Get returns the message with messageID from topic.
+func (s *StorageStore) Get(ctx context.Context, topic, messageID string) (Message, error) {
+	var message Message
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		key, err := messageKey(tx, topic, messageID)
+		if err != nil {
+			return err
+		}
+		data, err := tx.Get(messageBucket, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		message, err = s.decode(ctx, data)
+		return err
+	})
+	return message, storeError(err)
+}
+
+// Delete removes a message from a topic.
+func (s *StorageStore) Delete(ctx context.Context, topic, messageID string) error {
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		key, err := messageKey(tx, topic, messageID)
+		if err != nil {
+			return err
+		}
+		data, err := tx.Get(messageBucket, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrMessageNotFound
+		}
+		if err != nil {
+			return err
+		}
+		message, err := decodeMessage(data)
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(messageBucket, key); err != nil {
+			return err
+		}
+		if err := removeIndexed(tx, key, message); err != nil {
+			return err
+		}
+		return tx.Delete(messageIDs, topicPrefix(topic)+messageID)
+	})
+	return storeError(err)
+}
+
+// Purge removes the messages published before cutoff, with their ID
+// entries, and returns how many it removed; with dryRun it only counts
+// them.
+func (s *StorageStore) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	return s.PurgeMessages(ctx, func(message Message) bool {
+		return message.PublishedAt.Before(cutoff)
+	}, dryRun)
+}
+
+// Expire removes the messages whose ExpiresAt is not after now, with
+// their ID entries and leases, and returns how many it removed.
+func (s *StorageStore) Expire(ctx context.Context, now time.Time) (int, error) {
+	return s.PurgeMessages(ctx, func(message Message) bool {
+		return !message.ExpiresAt.IsZero() && !message.ExpiresAt.After(now)
+	}, false)
+}
+
+// PurgeMessages removes the messages expired reports true for, with their
+// ID entries, and returns how many it removed; with dryRun it only counts
+// them.
+func (s *StorageStore) PurgeMessages(ctx context.Context, expired func(Message) bool, dryRun bool) (int, error) {
+	removed, err := retention.PurgeBucket(ctx, s.db, messageBucket, dryRun, func(_ string, value []byte) (bool, error) {
+		message, err := decodeMessage(value)
+		return err == nil && expired(message), err
+	}, func(tx storage.Tx, key string, value []byte) error {
+		message, err := decodeMessage(value)
+		if err != nil {
+			return err
+		}
+		if err := removeIndexed(tx, key, message); err != nil {
+			return err
+		}
+		return tx.Delete(messageIDs, topicPrefix(message.Topic)+message.MessageID)
+	})
+	return removed, storeError(err)
+}
+
+// PutRoute creates or replaces the scope's routing rule with rule.ID.
+func (s *StorageStore) PutRoute(ctx context.Context, rule RouteRule) (RouteRule, bool, error) {
+	key := routeKey(Scope{TenantID: rule.TenantID, ProjectID: rule.ProjectID}, rule.ID)
+	created := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		raw, err := tx.Get(routeBucket, key)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			created = true
+		case err != nil:
+			return err
+		default:
+			var previous RouteRule
+			if err := json.Unmarshal(raw, &previous); err != nil {
+				return err
+			}
+			rule.CreatedAt = previous.CreatedAt
+		}
+		data, err := json.Marshal(rule)
+		if err != nil {
+			return err
+		}
+		return tx.Put(routeBucket, key, data)
+	})
+	if err != nil {
+		return RouteRule{}, false, storeError(err)
+	}
+	return rule, created, nil
+}
+
+// GetRoute returns the scope's routing rule with id.
+func (s *StorageStore) GetRoute(ctx context.Context, scope Scope, id string) (RouteRule, error) {
+	var rule RouteRule
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		rule, err = getRoute(tx, scope, id)
+		return err
+	})
+	return rule, storeError(err)
+}
+
+// DeleteRoute removes the scope's routing rule with id, returning it.
+func (s *StorageStore) DeleteRoute(ctx context.Context, scope Scope, id string) (RouteRule, error) {
+	var rule RouteRule
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if rule, err = getRoute(tx, scope, id); err != nil {
+			return err
+		}
+		return tx.Delete(routeBucket, routeKey(scope, id))
+	})
+	return rule, storeError(err)
+}
+
+// Routes returns every routing rule, ordered by key.
+func (s *StorageStore) Routes(ctx context.Context) ([]RouteRule, error) {
+	var rules []RouteRule
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(routeBucket, "", func(_ string, value []byte) error {
+			var rule RouteRule
+			if err := json.Unmarshal(value, &rule); err != nil {
+				return err
+			}
+			rules = append(rules, rule)
+			return nil
+		})
+	})
+	return rules, storeError(err)
+}
+
+// PutTopicKey creates or replaces the tenant's key for key.Topic.
+func (s *StorageStore) PutTopicKey(ctx context.Context, key TopicKey) (TopicKey, bool, error) {
+	storeKey := topicKeyKey(key.TenantID, key.Topic)
+	created := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		previous, err := getTopicKey(tx, key.TenantID, key.Topic)
+		switch {
+		case errors.Is(err, ErrTopicKeyNotFound):
+			created = true
+		case err != nil:
+			return err
+		default:
+			key.CreatedAt = previous.CreatedAt
+		}
+		data, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		return tx.Put(topicKeyBucket, storeKey, data)
+	})
+	if err != nil {
+		return TopicKey{}, false, storeError(err)
+	}
+	return key, created, nil
+}
+
+// GetTopicKey returns the tenant's key for topic.
+func (s *StorageStore) GetTopicKey(ctx context.Context, tenantID, topic string) (TopicKey, error) {
+	var key TopicKey
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		key, err = getTopicKey(tx, tenantID, topic)
+		return err
+	})
+	return key, storeError(err)
+}
+
+// DeleteTopicKey removes the tenant's key for topic, returning it.
+func (s *StorageStore) DeleteTopicKey(ctx context.Context, tenantID, topic string) (TopicKey, error) {
+	var key TopicKey
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if key, err = getTopicKey(tx, tenantID, topic); err != nil {
+			return err
+		}
+		return tx.Delete(topicKeyBucket, topicKeyKey(tenantID, topic))
+	})
+	return key, storeError(err)
+}
+
+// PutTopic creates or replaces the settings of topic.Name.
+func (s *StorageStore) PutTopic(ctx context.Context, topic Topic) (Topic, bool, error) {
+	created := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		created = false
+		previous, err := getTopic(tx, topic.Name)
+		switch {
+		case errors.Is(err, ErrTopicNotFound):
+			created = true
+		case err != nil:
+			return err
+		default:
+			topic.CreatedAt = previous.CreatedAt
+		}
+		data, err := json.Marshal(topic)
+		if err != nil {
+			return err
+		}
+		return tx.Put(topicBucket, url.PathEscape(topic.Name), data)
+	})
+	if err != nil {
+		return Topic{}, false, storeError(err)
+	}
+	return topic, created, nil
+}
+
+// GetTopic returns the settings of the topic name.
+func (s *StorageStore) GetTopic(ctx context.Context, name string) (Topic, error) {
+	var topic Topic
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		topic, err = getTopic(tx, name)
+		return err
+	})
+	return topic, storeError(err)
+}
+
+// Topics returns every topic, ordered by name.
+func (s *StorageStore) Topics(ctx context.Context) ([]Topic, error) {
+	var topics []Topic
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(topicBucket, "", func(_ string, value []byte) error {
+			var topic Topic
+			if err := json.Unmarshal(value, &topic); err != nil {
+				return err
+			}
+			topics = append(topics, topic)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	// Escaping can reorder names, so sort them as they were given.
+	slices.SortFunc(topics, func(a, b Topic) int { return strings.Compare(a.Name, b.Name) })
+	return topics, nil
+}
+
+// DeleteTopic removes the settings of the topic name, returning them.
+func (s *StorageStore) DeleteTopic(ctx context.Context, name string) (Topic, error) {
+	var topic Topic
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if topic, err = getTopic(tx, name); err != nil {
+			return err
+		}
+		return tx.Delete(topicBucket, url.PathEscape(name))
+	})
+	return topic, storeError(err)
+}
+
+func getTopic(tx storage.Tx, name string) (Topic, error) {
+	raw, err := tx.Get(topicBucket, url.PathEscape(name))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Topic{}, ErrTopicNotFound
+	}
+	if err != nil {
+		return Topic{}, err
+	}
+	var topic Topic
+	err = json.Unmarshal(raw, &topic)
+	return topic, err
+}
+
+// PutDeadLetterPolicy creates or replaces the tenant's dead-letter policy
+// for policy.Topic.
+func (s *StorageStore) PutDeadLetterPolicy(ctx context.Context, policy DeadLetterPolicy) (DeadLetterPolicy, bool, error) {
+	created := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		previous, err := getDeadLetterPolicy(tx, policy.TenantID, policy.Topic)
+		switch {
+		case errors.Is(err, ErrDeadLetterPolicyNotFound):
+			created = true
+		case err != nil:
+			return err
+		default:
+			policy.CreatedAt = previous.CreatedAt
+		}
+		data, err := json.Marshal(policy)
+		if err != nil {
+			return err
+		}
+		return tx.Put(deadLetterBucket, deadLetterKey(policy.TenantID, policy.Topic), data)
+	})
+	if err != nil {
+		return DeadLetterPolicy{}, false, storeError(err)
+	}
+	return policy, created, nil
+}
+
+// GetDeadLetterPolicy returns the tenant's dead-letter policy for topic.
+func (s *StorageStore) GetDeadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error) {
+	var policy DeadLetterPolicy
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		policy, err = getDeadLetterPolicy(tx, tenantID, topic)
+		return err
+	})
+	return policy, storeError(err)
+}
+
+// DeadLetterPolicies returns every tenant's dead-letter policy for topic.
+func (s *StorageStore) DeadLetterPolicies(ctx context.Context, topic string) ([]DeadLetterPolicy, error) {
+	var policies []DeadLetterPolicy
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(deadLetterBucket, topicPrefix(topic), func(_ string, value []byte) error {
+			var policy DeadLetterPolicy
+			if err := json.Unmarshal(value, &policy); err != nil {
+				return err
+			}
+			policies = append(policies, policy)
+			return nil
+		})
+	})
+	return policies, storeError(err)
+}
+
+// DeleteDeadLetterPolicy removes the tenant's dead-letter policy for
+// topic, returning it.
+func (s *StorageStore) DeleteDeadLetterPolicy(ctx context.Context, tenantID, topic string) (DeadLetterPolicy, error) {
+	var policy DeadLetterPolicy
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if policy, err = getDeadLetterPolicy(tx, tenantID, topic); err != nil {
+			return err
+		}
+		return tx.Delete(deadLetterBucket, deadLetterKey(tenantID, topic))
+	})
+	return policy, storeError(err)
+}
+
+func deadLetterKey(tenantID, topic string) string {
+	return topicPrefix(topic) + url.PathEscape(tenantID)
+}
+
+func getDeadLetterPolicy(tx storage.Tx, tenantID, topic string) (DeadLetterPolicy, error) {
+	raw, err := tx.Get(deadLetterBucket, deadLetterKey(tenantID, topic))
+	if errors.Is(err, storage.ErrNotFound) {
+		return DeadLetterPolicy{}, ErrDeadLetterPolicyNotFound
+	}
+	if err != nil {
+		return DeadLetterPolicy{}, err
+	}
+	var policy DeadLetterPolicy
+	err = json.Unmarshal(raw, &policy)
+	return policy, err
+}
+
+// Pulled moves the group's position in each priority band of topic past
+// the messageIDs of that band still pending, unless it is already past
+// them, and records the pull.
+func (s *StorageStore) Pulled(ctx context.Context, scope Scope, group, topic string, messageIDs []string, at time.Time) error {
+	key := groupKey(scope, group) + url.PathEscape(topic)
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		position := groupPosition{Topic: topic}
+		raw, err := tx.Get(groupBucket, key)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(raw, &position); err != nil {
+				return err
+			}
+		case !errors.Is(err, storage.ErrNotFound):
+			return err
+		}
+		for _, messageID := range messageIDs {
+			pulled, err := messageKey(tx, topic, messageID)
+			if errors.Is(err, ErrMessageNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			raw, err := tx.Get(messageBucket, pulled)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			message, err := decodeMessage(raw)
+			if err != nil {
+				return err
+			}
+			position.advance(pulled, message.Priority)
+		}
+		position.LastPulledAt = at
+		data, err := json.Marshal(position)
+		if err != nil {
+			return err
+		}
+		return tx.Put(groupBucket, key, data)
+	})
+	return storeError(err)
+}
+
+// Lag counts the pending messages in each topic the scope's group pulls
+// from, split at the group's position in each message's priority band.
+func (s *StorageStore) Lag(ctx context.Context, scope Scope, group string) ([]TopicLag, error) {
+	var lags []TopicLag
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var positions []groupPosition
+		err := tx.Scan(groupBucket, groupKey(scope, group), func(_ string, value []byte) error {
+			var position groupPosition
+			if err := json.Unmarshal(value, &position); err != nil {
+				return err
+			}
+			positions = append(positions, position)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(positions) == 0 {
+			return ErrGroupNotFound
+		}
+		for _, position := range positions {
+			lag := TopicLag{Topic: position.Topic, LastPulledAt: position.LastPulledAt}
+			err := tx.Scan(messageBucket, topicPrefix(position.Topic), func(key string, value []byte) error {
+				message, err := decodeMessage(value)
+				if err != nil {
+					return err
+				}
+				if scope.TenantID != "" && message.TenantID != scope.TenantID {
+					return nil
+				}
+				if scope.ProjectID != "" && message.ProjectID != scope.ProjectID {
+					return nil
+				}
+				if position.pulled(key, message.Priority) {
+					lag.Unacked++
+				} else {
+					lag.Unpulled++
+				}
+				if lag.OldestPublishedAt.IsZero() || message.PublishedAt.Before(lag.OldestPublishedAt) {
+					lag.OldestPublishedAt = message.PublishedAt
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			lags = append(lags, lag)
+		}
+		return nil
+	})
+	return lags, storeError(err)
+}
+
+// Groups returns every consumer group that has pulled, ordered by scope
+// and name.
+func (s *StorageStore) Groups(ctx context.Context) ([]ConsumerGroup, error) {
+	var groups []ConsumerGroup
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(groupBucket, "", func(key string, _ []byte) error {
+			parts := strings.Split(key, "/")
+			if len(parts) != 4 {
+				return fmt.Errorf("messaging: corrupt group key %q", key)
+			}
+			var group ConsumerGroup
+			for i, field := range []*string{&group.TenantID, &group.ProjectID, &group.Name} {
+				value, err := url.PathUnescape(parts[i])
+				if err != nil {
+					return err
+				}
+				*field = value
+			}
+			if n := len(groups); n == 0 || groups[n-1] != group {
+				groups = append(groups, group)
+			}
+			return nil
+		})
+	})
+	return groups, storeError(err)
+}
+
+// DeleteGroup forgets the scope's group's positions.
+func (s *StorageStore) DeleteGroup(ctx context.Context, scope Scope, group string) error {
+	prefix := groupKey(scope, group)
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var keys []string
+		err := tx.Scan(groupBucket, prefix, func(key string, _ []byte) error {
+			keys = append(keys, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return ErrGroupNotFound
+		}
+		for _, key := range keys {
+			if err := tx.Delete(groupBucket, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return storeError(err)
+}
+
+// storedSubscription is a subscription as stored: Position is the storage
+// key of the last message it has passed, and Deliveries those it awaits
+// an ack for, in delivery order.
+type storedSubscription struct {
+	Subscription
+	Position   string     `json:"position"`
+	Deliveries []delivery `json:"deliveries,omitempty"`
+}
+
+// delivery is a message delivered to a subscription and not yet
+// acknowledged, due again after Deadline. A delivery acknowledged before
+// the subscription's position passed its message stays, Acked, until it
+// does, so the message is not delivered again.
+type delivery struct {
+	MessageID string    `json:"message_id"`
+	Key       string    `json:"key"`
+	Deadline  time.Time `json:"deadline"`
+	Attempts  int       `json:"attempts"`
+	Acked     bool      `json:"acked,omitempty"`
+}
+
+// PutSubscription creates sub, positioned at the end of its topic unless
+// earliest is set, or updates the existing one's ack deadline.
+func (s *StorageStore) PutSubscription(ctx context.Context, sub Subscription, earliest bool) (Subscription, bool, error) {
+	scope := Scope{TenantID: sub.TenantID, ProjectID: sub.ProjectID}
+	created := false
+	end := ""
+	if !earliest {
+		seq, err := storage.RaiseSequence(ctx, s.db, sequenceName(sub.Topic), 0)
+		if err != nil {
+			return Subscription{}, false, storeError(err)
+		}
+		if seq > 0 {
+			end = fmt.Sprintf("%s%020d", topicPrefix(sub.Topic), seq)
+		}
+	}
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		stored, err := getSubscription(tx, scope, sub.Topic, sub.Name)
+		switch {
+		case errors.Is(err, ErrSubscriptionNotFound):
+			created = true
+			stored = storedSubscription{Subscription: sub, Position: end}
+		case err != nil:
+			return err
+		default:
+			stored.AckDeadlineSeconds = sub.AckDeadlineSeconds
+			stored.UpdatedAt = sub.UpdatedAt
+		}
+		sub = stored.Subscription
+		return putSubscription(tx, stored)
+	})
+	if err != nil {
+		return Subscription{}, false, storeError(err)
+	}
+	return sub, created, nil
+}
+
+// GetSubscription returns the scope's subscription to topic named name.
+func (s *StorageStore) GetSubscription(ctx context.Context, scope Scope, topic, name string) (Subscription, error) {
+	var stored storedSubscription
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		stored, err = getSubscription(tx, scope, topic, name)
+		return err
+	})
+	return stored.Subscription, storeError(err)
+}
+
+// Subscriptions returns the scope's subscriptions to topic, ordered by
+// name.
+func (s *StorageStore) Subscriptions(ctx context.Context, scope Scope, topic string) ([]Subscription, error) {
+	var subs []Subscription
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(subscriptionBucket, subscriptionPrefix(scope, topic), func(_ string, value []byte) error {
+			var stored storedSubscription
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			subs = append(subs, stored.Subscription)
+			return nil
+		})
+	})
+	return subs, storeError(err)
+}
+
+// DeleteSubscription removes the scope's subscription to topic named name,
+// returning it.
+func (s *StorageStore) DeleteSubscription(ctx context.Context, scope Scope, topic, name string) (Subscription, error) {
+	var stored storedSubscription
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if stored, err = getSubscription(tx, scope, topic, name); err != nil {
+			return err
+		}
+		return tx.Delete(subscriptionBucket, subscriptionPrefix(scope, topic)+url.PathEscape(name))
+	})
+	return stored.Subscription, storeError(err)
+}
+
+// Deliver redelivers the subscription's messages whose ack deadline passed
+// and then delivers those past its position, up to limit in all, while
+// it has fewer than MaxSubscriptionInFlight awaiting an ack. Deliveries
+// of messages since removed from the topic are dropped. Those due again
+// that exhausted reports on are claimed for deadLetterClaim and returned
+// apart. The position only passes messages numbered over commitWindow
+// ago; later ones are delivered and remembered until it passes them.
+func (s *StorageStore) Deliver(ctx context.Context, scope Scope, topic, name string, limit int, now time.Time, exhausted func(Message, int) bool) ([]Message, []Message, error) {
+	var messages, dead []Message
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		messages, dead = nil, nil
+		stored, err := getSubscription(tx, scope, topic, name)
+		if err != nil {
+			return err
+		}
+		deadline := now.Add(time.Duration(stored.AckDeadlineSeconds) * time.Second)
+		pending := make([]delivery, 0, len(stored.Deliveries))
+		delivered := make(map[string]bool, len(stored.Deliveries))
+		for _, d := range stored.Deliveries {
+			delivered[d.Key] = true
+			if d.Acked || len(messages) == limit || d.Deadline.After(now) {
+				pending = append(pending, d)
+				continue
+			}
+			data, err := tx.Get(messageBucket, d.Key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			message, err := s.decode(ctx, data)
+			if err != nil {
+				return err
+			}
+			if exhausted != nil && exhausted(message, d.Attempts) {
+				d.Deadline = now.Add(deadLetterClaim)
+				pending = append(pending, d)
+				dead = append(dead, message)
+				continue
+			}
+			d.Deadline = deadline
+			d.Attempts++
+			pending = append(pending, d)
+			messages = append(messages, message)
+		}
+		room := min(limit-len(messages), MaxSubscriptionInFlight-unacked(pending))
+		if room > 0 {
+			settled := now.Add(-commitWindow)
+			passing := true
+			err := tx.Scan(messageBucket, topicPrefix(topic), func(key string, value []byte) error {
+				if key <= stored.Position {
+					return nil
+				}
+				if room == 0 {
+					return storage.StopScan
+				}
+				if passing {
+					at, err := numberedAt(value)
+					if err != nil {
+						return err
+					}
+					if passing = !at.After(settled); passing {
+						stored.Position = key
+					}
+				}
+				if delivered[key] {
+					return nil
+				}
+				message, err := s.decode(ctx, value)
+				if err != nil {
+					return err
+				}
+				if scope.TenantID != "" && message.TenantID != scope.TenantID {
+					return nil
+				}
+				if scope.ProjectID != "" && message.ProjectID != scope.ProjectID {
+					return nil
+				}
+				pending = append(pending, delivery{MessageID: message.MessageID, Key: key, Deadline: deadline, Attempts: 1})
+				messages = append(messages, message)
+				room--
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		stored.Deliveries = slices.DeleteFunc(pending, func(d delivery) bool {
+			return d.Acked && d.Key <= stored.Position
+		})
+		stored.InFlight = unacked(stored.Deliveries)
+		stored.LastPulledAt = now
+		return putSubscription(tx, stored)
+	})
+	if err != nil {
+		return nil, nil, storeError(err)
+	}
+	return messages, dead, nil
+}
+
+// AckSubscription settles the subscription's delivery of messageID.
+func (s *StorageStore) AckSubscription(ctx context.Context, scope Scope, topic, name, messageID string) error {
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		stored, err := getSubscription(tx, scope, topic, name)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(stored.Deliveries, func(d delivery) bool { return d.MessageID == messageID && !d.Acked })
+		if i < 0 {
+			return ErrMessageNotFound
+		}
+		if stored.Deliveries[i].Key > stored.Position {
+			stored.Deliveries[i].Acked = true
+		} else {
+			stored.Deliveries = slices.Delete(stored.Deliveries, i, i+1)
+		}
+		stored.InFlight = unacked(stored.Deliveries)
+		return putSubscription(tx, stored)
+	})
+	return storeError(err)
+}
+
+// unacked counts the deliveries awaiting an ack.
+func unacked(deliveries []delivery) int {
+	n := 0
+	for _, d := range deliveries {
+		if !d.Acked {
+			n++
+		}
+	}
+	return n
+}
+
+func subscriptionPrefix(scope Scope, topic string) string {
+	return url.PathEscape(scope.TenantID) + "/" + url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(topic) + "/"
+}
+
+func getSubscription(tx storage.Tx, scope Scope, topic, name string) (storedSubscription, error) {
+	raw, err := tx.Get(subscriptionBucket, subscriptionPrefix(scope, topic)+url.PathEscape(name))
+	if errors.Is(err, storage.ErrNotFound) {
+		return storedSubscription{}, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return storedSubscription{}, err
+	}
+	var stored storedSubscription
+	err = json.Unmarshal(raw, &stored)
+	return stored, err
+}
+
+func putSubscription(tx storage.Tx, stored storedSubscription) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	scope := Scope{TenantID: stored.TenantID, ProjectID: stored.ProjectID}
+	return tx.Put(subscriptionBucket, subscriptionPrefix(scope, stored.Topic)+url.PathEscape(stored.Name), data)
+}
+
+func groupKey(scope Scope, group string) string {
+	return url.PathEscape(scope.TenantID) + "/" + url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(group) + "/"
+}
+
+func routeKey(scope Scope, id string) string {
+	return url.PathEscape(scope.TenantID) + "/" + url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(id)
+}
+
+func getRoute(tx storage.Tx, scope Scope, id string) (RouteRule, error) {
+	raw, err := tx.Get(routeBucket, routeKey(scope, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return RouteRule{}, ErrRouteNotFound
+	}
+	if err != nil {
+		return RouteRule{}, err
+	}
+	var rule RouteRule
+	err = json.Unmarshal(raw, &rule)
+	return rule, err
+}
+
+func topicKeyKey(tenantID, topic string) string {
+	return url.PathEscape(tenantID) + "/" + url.PathEscape(topic)
+}
+
+func getTopicKey(tx storage.Tx, tenantID, topic string) (TopicKey, error) {
+	raw, err := tx.Get(topicKeyBucket, topicKeyKey(tenantID, topic))
+	if errors.Is(err, storage.ErrNotFound) {
+		return TopicKey{}, ErrTopicKeyNotFound
+	}
+	if err != nil {
+		return TopicKey{}, err
+	}
+	var key TopicKey
+	err = json.Unmarshal(raw, &key)
+	return key, err
+}
+
+func messageKey(tx storage.Tx, topic, messageID string) (string, error) {
+	key, err := tx.Get(messageIDs, topicPrefix(topic)+messageID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", ErrMessageNotFound
+	}
+	return string(key), err
+}
+
+// reseal re-seals the stored and delayed payloads not sealed under the
+// active key.
+func (s *StorageStore) reseal(ctx context.Context) (int, int, error) {
+	reseal := func(_ string, value []byte) ([]byte, error) {
+		var stored storedMessage
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return nil, err
+		}
+		sealed, err := s.keys.Reseal(ctx, stored.Sealed, stored.Payload)
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		stored.Payload, stored.Sealed = nil, sealed
+		return json.Marshal(stored)
+	}
+	resealed, skipped, err := encryption.ResealBucket(ctx, s.db, messageBucket, "", reseal)
+	if err != nil {
+		return resealed, skipped, storeError(err)
+	}
+	delayed, delayedSkipped, err := encryption.ResealBucket(ctx, s.db, delayedBucket, "", reseal)
+	return resealed + delayed, skipped + delayedSkipped, storeError(err)
+}
+
+// indexed returns the message a priority index entry points to, or
+// storage.ErrNotFound when it is gone.
+func (s *StorageStore) indexed(ctx context.Context, tx storage.Tx, key string) (Message, error) {
+	data, err := tx.Get(messageBucket, key)
+	if err != nil {
+		return Message{}, err
+	}
+	return s.decode(ctx, data)
+}
+
+// encode returns message as stored, its payload sealed when the store has
+// a keyring.
+func (s *StorageStore) encode(ctx context.Context, message Message) ([]byte, error) {
+	stored := storedMessage{Message: message, Payload: message.Payload}
+	if s.keys.Enabled() {
+		sealed, err := s.keys.Seal(ctx, message.Payload)
+		if err != nil {
+			return nil, err
+		}
+		stored.Payload, stored.Sealed = nil, sealed
+	}
+	return json.Marshal(stored)
+}
+
+// decode returns a stored message with its payload opened.
+func (s *StorageStore) decode(ctx context.Context, data []byte) (Message, error) {
+	var stored storedMessage
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Message{}, err
+	}
+	stored.Message.Payload = stored.Payload
+	if stored.Sealed != nil {
+		payload, err := s.keys.Open(ctx, stored.Sealed)
+		if err != nil {
+			return Message{}, err
+		}
+		stored.Message.Payload = payload
+	}
+	return stored.Message, nil
+}
+
+// decodeMessage decodes a stored message without opening a sealed
+// payload, for callers that do not need it.
+func decodeMessage(data []byte) (Message, error) {
+	var stored storedMessage
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Message{}, err
+	}
+	stored.Message.Payload = stored.Payload
+	return stored.Message, nil
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrMessageNotFound) || errors.Is(err, ErrRouteNotFound) || errors.Is(err, ErrGroupNotFound) || errors.Is(err, ErrTopicKeyNotFound) || errors.Is(err, ErrSubscriptionNotFound) || errors.Is(err, ErrNotLeased) || errors.Is(err, ErrDeadLetterPolicyNotFound) || errors.Is(err, ErrTopicNotFound) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
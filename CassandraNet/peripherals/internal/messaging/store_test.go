@@ -0,0 +1,511 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// stores opens each store the service can run on. The SQL store needs
+// STORAGE_TEST_POSTGRES_URL; CI provides one, so it fails there without.
+var stores = []struct {
+	name string
+	open func(t *testing.T) *StorageStore
+}{
+	{"memory", func(t *testing.T) *StorageStore {
+		return NewMemoryStore()
+	}},
+	{"file", func(t *testing.T) *StorageStore {
+		db, err := storage.OpenFile(filepath.Join(t.TempDir(), "messages.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewStorageStore(db)
+	}},
+	{"sql", func(t *testing.T) *StorageStore {
+		dsn := os.Getenv("STORAGE_TEST_POSTGRES_URL")
+		if dsn == "" {
+			if os.Getenv("CI") != "" {
+				t.Fatal("STORAGE_TEST_POSTGRES_URL is not set; CI must run the SQL store tests")
+			}
+			t.Skip("STORAGE_TEST_POSTGRES_URL is not set")
+		}
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		store, err := OpenSQLStore(fmt.Sprintf("%s%stable=messaging_test_%d", dsn, sep, time.Now().UnixNano()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store.StorageStore
+	}},
+}
+
+// eachStore runs test against a new store of every kind.
+func eachStore(t *testing.T, test func(t *testing.T, store *StorageStore)) {
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			store := s.open(t)
+			if _, err := store.Migrate(context.Background()); err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+			test(t, store)
+		})
+	}
+}
+
+func keys(messages []Message) string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Key)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestStoreMigrate(t *testing.T) {
+	for _, s := range stores {
+		t.Run(s.name, func(t *testing.T) {
+			store := s.open(t)
+			ctx := context.Background()
+			if ran, err := store.Migrate(ctx); err != nil || ran != len(migrations) {
+				t.Fatalf("expected a new store given every migration, got %d %v", ran, err)
+			}
+			if ran, err := store.Migrate(ctx); err != nil || ran != 0 {
+				t.Fatalf("expected nothing left to migrate, got %d %v", ran, err)
+			}
+		})
+	}
+}
+
+func TestStoreSavesListsAndPurges(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, m := range []struct{ key, tenant string }{{"a", "acme"}, {"b", "acme"}, {"c", "globex"}, {"d", "acme"}} {
+			_, err := store.Save(ctx, Message{
+				MessageID: "m-" + m.key, TenantID: m.tenant, Topic: "jobs", Key: m.key, Payload: []byte(m.key),
+				PublishedAt: base.Add(time.Duration(i) * time.Second),
+			})
+			if err != nil {
+				t.Fatalf("save %s: %v", m.key, err)
+			}
+		}
+		if m, err := store.Get(ctx, "jobs", "m-b"); err != nil || string(m.Payload) != "b" {
+			t.Fatalf("get: %+v %v", m, err)
+		}
+
+		acme := PullFilter{TenantID: "acme", Topic: "jobs"}
+		first, next, err := store.List(ctx, acme, pagination.Request{Limit: 2})
+		if err != nil || keys(first) != "a,b" || next == "" {
+			t.Fatalf("expected the first page in publish order, got %s %q %v", keys(first), next, err)
+		}
+		rest, next, err := store.List(ctx, acme, pagination.Request{Limit: 2, After: next})
+		if err != nil || keys(rest) != "d" || next != "" {
+			t.Fatalf("expected the last page after the cursor, got %s %q %v", keys(rest), next, err)
+		}
+
+		if err := store.Delete(ctx, "jobs", "m-b"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, err := store.Get(ctx, "jobs", "m-b"); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("expected the deleted message gone, got %v", err)
+		}
+		if purged, err := store.Purge(ctx, base.Add(2*time.Second), true); err != nil || purged != 1 {
+			t.Fatalf("expected a dry run to count a, got %d %v", purged, err)
+		}
+		if purged, err := store.Purge(ctx, base.Add(2*time.Second), false); err != nil || purged != 1 {
+			t.Fatalf("expected a purged, got %d %v", purged, err)
+		}
+		if all, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 10}); err != nil || keys(all) != "c,d" {
+			t.Fatalf("expected c and d left, got %s %v", keys(all), err)
+		}
+	})
+}
+
+func TestStoreLeasesUntilTheDeadline(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, key := range []string{"a", "b", "c"} {
+			_, err := store.Save(ctx, Message{MessageID: "m-" + key, Topic: "jobs", Key: key, PublishedAt: base.Add(time.Duration(i) * time.Second)})
+			if err != nil {
+				t.Fatalf("save %s: %v", key, err)
+			}
+		}
+		filter := PullFilter{Topic: "jobs", AckDeadline: time.Minute}
+		for _, want := range []string{"a,b", "c", ""} {
+			leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 2}, base, nil)
+			if err != nil || keys(leased) != want {
+				t.Fatalf("expected %q leased, got %s %v", want, keys(leased), err)
+			}
+		}
+
+		if _, _, err := store.Nack(ctx, "jobs", "m-b", base, nil); err != nil {
+			t.Fatalf("nack: %v", err)
+		}
+		if _, _, err := store.Nack(ctx, "jobs", "m-b", base, nil); !errors.Is(err, ErrNotLeased) {
+			t.Fatalf("expected a second nack refused, got %v", err)
+		}
+		if err := store.Extend(ctx, "jobs", "m-c", base, base.Add(time.Hour)); err != nil {
+			t.Fatalf("extend: %v", err)
+		}
+		if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, base, nil); err != nil || keys(leased) != "b" {
+			t.Fatalf("expected the nacked message redelivered, got %s %v", keys(leased), err)
+		}
+		if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, base.Add(2*time.Minute), nil); err != nil || keys(leased) != "a,b" {
+			t.Fatalf("expected the expired leases redelivered and the extended one kept, got %s %v", keys(leased), err)
+		}
+
+		exhausted := func(_ Message, deliveries int) bool { return deliveries >= 2 }
+		leased, dead, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, base.Add(4*time.Minute), exhausted)
+		if err != nil || keys(leased) != "" || keys(dead) != "a,b" {
+			t.Fatalf("expected a and b claimed for dead-lettering, got %s %s %v", keys(leased), keys(dead), err)
+		}
+	})
+}
+
+func TestStorePublishesConcurrentlyWithoutConflicts(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		const publishers = 32
+		var wg sync.WaitGroup
+		for i := range publishers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := store.Save(ctx, Message{MessageID: fmt.Sprintf("m-%02d", i), Topic: "jobs", Key: fmt.Sprintf("%02d", i)})
+				if err != nil {
+					t.Errorf("publish %d: %v", i, err)
+				}
+			}()
+		}
+		wg.Wait()
+		all, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 2 * publishers})
+		if err != nil || len(all) != publishers {
+			t.Fatalf("expected every publish stored, got %d %v", len(all), err)
+		}
+	})
+}
+
+func TestStoreCarriesSequencesOfEarlierReleases(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	err := storage.Update(ctx, store.db, func(tx storage.Tx) error {
+		if err := tx.Put(schemaBucket, "version", []byte("1")); err != nil {
+			return err
+		}
+		return tx.Put(sequenceBucket, "jobs", []byte("7"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := store.Migrate(ctx); err != nil || ran != len(migrations)-1 {
+		t.Fatalf("migrate: %d %v", ran, err)
+	}
+	if _, err := store.Save(ctx, Message{MessageID: "m-a", Topic: "jobs", Key: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	err = storage.View(ctx, store.db, func(tx storage.Tx) error {
+		_, err := tx.Get(messageBucket, fmt.Sprintf("jobs/%020d", 8))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("expected the message numbered after the earlier release's last: %v", err)
+	}
+}
+
+func TestStoreSubscriptionsWaitForLateCommits(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		scope := Scope{TenantID: "acme"}
+		sub := Subscription{TenantID: "acme", Topic: "jobs", Name: "s1", AckDeadlineSeconds: 60}
+		if _, _, err := store.PutSubscription(ctx, sub, true); err != nil {
+			t.Fatal(err)
+		}
+		deliver := func(now time.Time) string {
+			t.Helper()
+			messages, _, err := store.Deliver(ctx, scope, "jobs", "s1", 10, now, nil)
+			if err != nil {
+				t.Fatalf("deliver: %v", err)
+			}
+			return keys(messages)
+		}
+
+		// a takes its number first but commits after b.
+		late := Message{MessageID: "m-a", TenantID: "acme", Topic: "jobs", Key: "a", PublishedAt: base}
+		seq, err := storage.NextSequence(ctx, store.db, sequenceName("jobs"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Save(ctx, Message{MessageID: "m-b", TenantID: "acme", Topic: "jobs", Key: "b", PublishedAt: base}); err != nil {
+			t.Fatal(err)
+		}
+		if got := deliver(base); got != "b" {
+			t.Fatalf("expected b delivered, got %q", got)
+		}
+		if err := store.AckSubscription(ctx, scope, "jobs", "s1", "m-b"); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+		data, err := store.encode(ctx, late)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = storage.Update(ctx, store.db, func(tx storage.Tx) error {
+			return appendMessage(tx, late, data, seq)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := deliver(base.Add(time.Second)); got != "a" {
+			t.Fatalf("expected the late commit delivered and b not again, got %q", got)
+		}
+		if err := store.AckSubscription(ctx, scope, "jobs", "s1", "m-a"); err != nil {
+			t.Fatalf("ack: %v", err)
+		}
+		if got := deliver(base.Add(commitWindow + time.Second)); got != "" {
+			t.Fatalf("expected nothing left to deliver, got %q", got)
+		}
+		stored, err := store.GetSubscription(ctx, scope, "jobs", "s1")
+		if err != nil || stored.InFlight != 0 {
+			t.Fatalf("expected nothing in flight, got %+v %v", stored, err)
+		}
+		err = storage.View(ctx, store.db, func(tx storage.Tx) error {
+			stored, err := getSubscription(tx, scope, "jobs", "s1")
+			if err == nil && len(stored.Deliveries) != 0 {
+				err = fmt.Errorf("acknowledged deliveries kept past the position: %+v", stored.Deliveries)
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// count returns how many keys bucket holds under prefix.
+func count(t *testing.T, store *StorageStore, bucket, prefix string) int {
+	t.Helper()
+	n := 0
+	err := storage.View(context.Background(), store.db, func(tx storage.Tx) error {
+		return tx.Scan(bucket, prefix, func(string, []byte) error {
+			n++
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestStoreLeasesMoveMessagesOutOfTheAvailableIndex(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for _, key := range []string{"a", "b", "c"} {
+			if _, err := store.Save(ctx, Message{MessageID: "m-" + key, Topic: "jobs", Key: key, PublishedAt: base}); err != nil {
+				t.Fatalf("save %s: %v", key, err)
+			}
+		}
+		filter := PullFilter{Topic: "jobs", AckDeadline: time.Minute}
+		if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 2}, base, nil); err != nil || keys(leased) != "a,b" {
+			t.Fatalf("lease: %s %v", keys(leased), err)
+		}
+		if available, leased := count(t, store, availableBucket, "jobs/"), count(t, store, leasedBucket, "jobs/"); available != 1 || leased != 2 {
+			t.Fatalf("expected one message available and two leased, got %d and %d", available, leased)
+		}
+
+		if err := store.Extend(ctx, "jobs", "m-a", base, base.Add(time.Hour)); err != nil {
+			t.Fatalf("extend: %v", err)
+		}
+		if err := store.Delete(ctx, "jobs", "m-c"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, base.Add(2*time.Minute), nil); err != nil || keys(leased) != "b" {
+			t.Fatalf("expected only the lapsed lease taken again, got %s %v", keys(leased), err)
+		}
+		if err := store.Delete(ctx, "jobs", "m-a"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if available, leased := count(t, store, availableBucket, "jobs/"), count(t, store, leasedBucket, "jobs/"); available != 0 || leased != 1 {
+			t.Fatalf("expected only b's lease indexed, got %d available and %d leased", available, leased)
+		}
+	})
+}
+
+func TestStoreIndexesAvailableMessagesOnMigrate(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Now()
+	for _, key := range []string{"a", "b"} {
+		if _, err := store.Save(ctx, Message{MessageID: "m-" + key, Topic: "jobs", Key: key, PublishedAt: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Records from a release that kept only the priority index and
+	// leases: a is leased, b is not.
+	err := storage.Update(ctx, store.db, func(tx storage.Tx) error {
+		for _, bucket := range []string{availableBucket, leasedBucket} {
+			err := tx.Scan(bucket, "", func(key string, _ []byte) error {
+				return tx.Delete(bucket, key)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if err := putLease(tx, fmt.Sprintf("jobs/%020d", 1), storedLease{Deadline: now.Add(time.Hour), Deliveries: 1}); err != nil {
+			return err
+		}
+		return tx.Put(schemaBucket, "version", []byte(strconv.Itoa(len(migrations)-1)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := store.Migrate(ctx); err != nil || ran != 1 {
+		t.Fatalf("migrate: %d %v", ran, err)
+	}
+	filter := PullFilter{Topic: "jobs", AckDeadline: time.Minute}
+	if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, now, nil); err != nil || keys(leased) != "b" {
+		t.Fatalf("expected the unleased message available, got %s %v", keys(leased), err)
+	}
+	if leased, _, _, err := store.Lease(ctx, filter, pagination.Request{Limit: 10}, now.Add(2*time.Hour), nil); err != nil || keys(leased) != "a,b" {
+		t.Fatalf("expected both available once their leases lapse, got %s %v", keys(leased), err)
+	}
+}
+
+func TestStoreExpiresMessagesPastTheirTTL(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for _, m := range []Message{
+			{MessageID: "m-a", Topic: "jobs", Key: "a", PublishedAt: base, ExpiresAt: base.Add(time.Minute)},
+			{MessageID: "m-b", Topic: "jobs", Key: "b", PublishedAt: base},
+			{MessageID: "m-c", Topic: "alerts", Key: "c", PublishedAt: base, ExpiresAt: base.Add(time.Hour)},
+		} {
+			if _, err := store.Save(ctx, m); err != nil {
+				t.Fatalf("save %s: %v", m.Key, err)
+			}
+		}
+		if removed, err := store.Expire(ctx, base.Add(time.Minute-time.Second)); err != nil || removed != 0 {
+			t.Fatalf("expected nothing expired yet, got %d %v", removed, err)
+		}
+		if removed, err := store.Expire(ctx, base.Add(time.Minute)); err != nil || removed != 1 {
+			t.Fatalf("expected a expired at its ExpiresAt, got %d %v", removed, err)
+		}
+		if _, err := store.Get(ctx, "jobs", "m-a"); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("expected a removed, got %v", err)
+		}
+		if removed, err := store.Expire(ctx, base.Add(24*time.Hour)); err != nil || removed != 1 {
+			t.Fatalf("expected c expired, got %d %v", removed, err)
+		}
+		if listed, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 10}); err != nil || keys(listed) != "b" {
+			t.Fatalf("expected the message without a TTL kept, got %s %v", keys(listed), err)
+		}
+	})
+}
+
+func TestStoreHoldsScheduledMessagesUntilReleased(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		// Scheduled in another order than they are due.
+		for _, m := range []Message{
+			{MessageID: "m-c", Topic: "jobs", Key: "c", PublishedAt: base, DeliverAt: base.Add(3 * time.Minute)},
+			{MessageID: "m-a", Topic: "jobs", Key: "a", PublishedAt: base, DeliverAt: base.Add(time.Minute)},
+			{MessageID: "m-b", Topic: "jobs", Key: "b", PublishedAt: base, DeliverAt: base.Add(2 * time.Minute)},
+		} {
+			if _, err := store.Schedule(ctx, m); err != nil {
+				t.Fatalf("schedule %s: %v", m.Key, err)
+			}
+		}
+		if _, err := store.Get(ctx, "jobs", "m-a"); !errors.Is(err, ErrMessageNotFound) {
+			t.Fatalf("expected a held message out of its topic, got %v", err)
+		}
+		if listed, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 10}); err != nil || len(listed) != 0 {
+			t.Fatalf("expected held messages left out of lists, got %s %v", keys(listed), err)
+		}
+
+		for _, step := range []struct {
+			at    time.Duration
+			limit int
+			want  string
+		}{
+			{time.Minute - time.Second, 10, ""},
+			{2 * time.Minute, 1, "a"},
+			{2 * time.Minute, 10, "b"},
+			{time.Hour, 10, "c"},
+			{time.Hour, 10, ""},
+		} {
+			released, err := store.Release(ctx, base.Add(step.at), step.limit)
+			if err != nil || keys(released) != step.want {
+				t.Fatalf("release at %v: expected %q, got %s %v", step.at, step.want, keys(released), err)
+			}
+		}
+		if listed, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 10}); err != nil || keys(listed) != "a,b,c" {
+			t.Fatalf("expected released messages in their topic, got %s %v", keys(listed), err)
+		}
+	})
+}
+
+func TestStoreListsByPriorityAcrossPages(t *testing.T) {
+	eachStore(t, func(t *testing.T, store *StorageStore) {
+		ctx := context.Background()
+		base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i, m := range []struct {
+			key      string
+			priority Priority
+		}{
+			{"a", PriorityLow}, {"b", PriorityNormal}, {"c", PriorityHigh}, {"d", PriorityNormal}, {"e", PriorityHigh}, {"f", PriorityLow},
+		} {
+			_, err := store.Save(ctx, Message{MessageID: "m-" + m.key, Topic: "jobs", Key: m.key, Priority: m.priority, PublishedAt: base.Add(time.Duration(i) * time.Second)})
+			if err != nil {
+				t.Fatalf("save %s: %v", m.key, err)
+			}
+		}
+		var pages []string
+		page := pagination.Request{Limit: 2}
+		for {
+			listed, next, err := store.List(ctx, PullFilter{Topic: "jobs"}, page)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			pages = append(pages, keys(listed))
+			if next == "" {
+				break
+			}
+			page.After = next
+		}
+		if got := strings.Join(pages, "|"); got != "c,e|b,d|a,f" {
+			t.Fatalf("expected pages by priority, then age, got %s", got)
+		}
+
+		// A later high priority message lists ahead of older lower ones.
+		if _, err := store.Save(ctx, Message{MessageID: "m-g", Topic: "jobs", Key: "g", Priority: PriorityHigh, PublishedAt: base.Add(time.Minute)}); err != nil {
+			t.Fatalf("save g: %v", err)
+		}
+		first, next, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 3})
+		if err != nil || keys(first) != "c,e,g" {
+			t.Fatalf("expected g with the high messages, got %s %v", keys(first), err)
+		}
+		if rest, _, err := store.List(ctx, PullFilter{Topic: "jobs"}, pagination.Request{Limit: 10, After: next}); err != nil || keys(rest) != "b,d,a,f" {
+			t.Fatalf("expected the rest after the cursor, got %s %v", keys(rest), err)
+		}
+		if indexed, err := store.IndexPriorities(ctx); err != nil || indexed != 0 {
+			t.Fatalf("expected every message indexed on save, got %d %v", indexed, err)
+		}
+	})
+}
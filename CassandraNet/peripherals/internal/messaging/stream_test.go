@@ -0,0 +1,131 @@
+package messaging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+)
+
+// TestStreamsAreReplicaLocal runs two replicas over one store: a stream
+// only carries what its own replica publishes, and a consumer resumes the
+// rest by pulling.
+func TestStreamsAreReplicaLocal(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	local, remote := NewService(store, clk), NewService(store, clk)
+	ctx := context.Background()
+	filter := PullFilter{TenantID: "acme", Topic: "feed"}
+	next := func(sub *sse.Subscription[Message]) (sse.Item[Message], bool) {
+		select {
+		case item := <-sub.Items():
+			return item, true
+		default:
+			return sse.Item[Message]{}, false
+		}
+	}
+
+	sub, err := local.Subscribe(filter, "")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Close()
+	remoteSub, err := remote.Subscribe(filter, "")
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer remoteSub.Close()
+
+	if _, err := local.Publish(ctx, PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: "feed", Key: "local"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := remote.Publish(ctx, PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: "feed", Key: "remote"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	item, ok := next(sub)
+	if !ok || item.Value.Key != "local" {
+		t.Fatalf("expected the local message streamed, got %+v %v", item, ok)
+	}
+	if extra, ok := next(sub); ok {
+		t.Fatalf("expected the other replica's message left off the stream, got %+v", extra)
+	}
+	remoteItem, ok := next(remoteSub)
+	if !ok || remoteItem.Value.Key != "remote" {
+		t.Fatalf("expected the remote message on its own replica's stream, got %+v %v", remoteItem, ok)
+	}
+
+	// An event ID from another replica starts the stream afresh rather
+	// than replaying anything.
+	resumed, err := local.Subscribe(filter, remoteItem.ID)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer resumed.Close()
+	if extra, ok := next(resumed); ok {
+		t.Fatalf("expected a foreign event ID to start afresh, got %+v", extra)
+	}
+
+	messages, _, err := local.Pull(ctx, filter, pagination.Request{Limit: DefaultPullLimit})
+	if err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	keys := map[string]bool{}
+	for _, m := range messages {
+		keys[m.Key] = true
+	}
+	if len(messages) != 2 || !keys["local"] || !keys["remote"] {
+		t.Fatalf("expected a pull to return both replicas' messages, got %+v", messages)
+	}
+}
+
+func TestTopicStreamsPushMessagesWithHeartbeats(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.SetStreamKeepAlive(100 * time.Millisecond)
+	srv := httptest.NewServer(svc.Handler())
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/topics/scores/stream?tenant_id=acme&project_id=p1", nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s %v", resp.Status, resp.Header)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func(prefix string) string {
+		t.Helper()
+		for lines.Scan() {
+			if strings.HasPrefix(lines.Text(), prefix) {
+				return strings.TrimPrefix(lines.Text(), prefix)
+			}
+		}
+		t.Fatalf("stream ended before %q: %v", prefix, lines.Err())
+		return ""
+	}
+	next(": keep-alive")
+
+	for _, scope := range [][2]string{{"globex", "p1"}, {"acme", "p2"}, {"acme", "p1"}} {
+		publish(t, svc, "scores", scope[0]+"/"+scope[1], func(r *PublishRequest) { r.TenantID, r.ProjectID = scope[0], scope[1] })
+	}
+	next("event: message")
+	var message Message
+	if err := json.Unmarshal([]byte(next("data: ")), &message); err != nil || message.Key != "acme/p1" {
+		t.Fatalf("expected only the stream's scope streamed, got %+v %v", message, err)
+	}
+	next(": keep-alive")
+}
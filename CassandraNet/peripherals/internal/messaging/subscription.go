@@ -0,0 +1,221 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrSubscriptionNotFound is returned when a topic has no subscription
+// with the requested name in the scope.
+var ErrSubscriptionNotFound = errors.New("messaging: subscription not found")
+
+// Where a new subscription starts: after the messages already in its
+// topic, or before them.
+const (
+	SubscriptionStartLatest   = "latest"
+	SubscriptionStartEarliest = "earliest"
+)
+
+// Ack deadlines of subscriptions and leases: DefaultAckDeadline applies
+// when a subscription or lease extension names none, and longer ones than
+// maxAckDeadline are refused.
+const (
+	DefaultAckDeadline = 30 * time.Second
+	maxAckDeadline     = time.Hour
+)
+
+// MaxSubscriptionInFlight bounds the messages a subscription has delivered
+// and not yet had acknowledged. A subscription at the bound only
+// redelivers those whose deadline passed until consumers ack some.
+const MaxSubscriptionInFlight = 1000
+
+// maxSubscriptionLength bounds subscription names, in characters.
+const maxSubscriptionLength = 255
+
+// Subscription is a named, durable reader of a topic within a tenant and
+// project scope. It keeps its own position in the topic and its own
+// deliveries awaiting an ack, so every subscription receives each message
+// in its scope, while the consumers pulling one subscription share its
+// messages between them. InFlight counts the deliveries awaiting an ack.
+type Subscription struct {
+	TenantID           string    `json:"tenant_id,omitempty"`
+	ProjectID          string    `json:"project_id,omitempty"`
+	Topic              string    `json:"topic"`
+	Name               string    `json:"name"`
+	AckDeadlineSeconds int       `json:"ack_deadline_seconds"`
+	InFlight           int       `json:"in_flight"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	LastPulledAt       time.Time `json:"last_pulled_at,omitzero"`
+}
+
+// SubscriptionStore persists subscriptions with their positions and
+// deliveries.
+type SubscriptionStore interface {
+	// PutSubscription creates sub, positioned after the messages already
+	// in its topic unless earliest is set, or updates the ack deadline of
+	// the existing one, keeping its position and deliveries. It reports
+	// whether it created one.
+	PutSubscription(ctx context.Context, sub Subscription, earliest bool) (Subscription, bool, error)
+	GetSubscription(ctx context.Context, scope Scope, topic, name string) (Subscription, error)
+	// Subscriptions returns the scope's subscriptions to topic, ordered by
+	// name.
+	Subscriptions(ctx context.Context, scope Scope, topic string) ([]Subscription, error)
+	DeleteSubscription(ctx context.Context, scope Scope, topic, name string) (Subscription, error)
+	// Deliver returns up to limit messages for the subscription at now:
+	// first those whose ack deadline passed, then those in its scope past
+	// its position, which it moves past them. Each is due for an ack
+	// within the subscription's deadline. Messages due again for which
+	// exhausted, when not nil, reports true given their deliveries so far
+	// are not delivered but returned apart, and kept from the
+	// subscription for deadLetterClaim while they are moved.
+	Deliver(ctx context.Context, scope Scope, topic, name string, limit int, now time.Time, exhausted func(Message, int) bool) ([]Message, []Message, error)
+	// AckSubscription settles the subscription's delivery of messageID,
+	// or returns ErrMessageNotFound when it awaits no ack.
+	AckSubscription(ctx context.Context, scope Scope, topic, name, messageID string) error
+}
+
+// SetSubscriptionStore keeps subscriptions in ss and serves them at
+// /topics/{topic}/subscriptions. Without it those paths answer 404. Call
+// it before the service handles requests.
+func (s *Service) SetSubscriptionStore(ss SubscriptionStore) {
+	s.subscriptions = ss
+}
+
+// PutSubscription creates the scope's subscription to topic, starting at
+// start (SubscriptionStartLatest when empty), or updates its ack deadline,
+// and reports whether it created one. A zero ackDeadline means
+// DefaultAckDeadline. The start of an existing subscription is ignored.
+func (s *Service) PutSubscription(ctx context.Context, scope Scope, topic, name string, ackDeadline time.Duration, start string) (Subscription, bool, error) {
+	if s.subscriptions == nil {
+		return Subscription{}, false, ErrSubscriptionNotFound
+	}
+	if ackDeadline == 0 {
+		ackDeadline = DefaultAckDeadline
+	}
+	if start == "" {
+		start = SubscriptionStartLatest
+	}
+	var v validation.Validator
+	v.String("topic", topic).Required().MaxLength(maxTopicLength)
+	v.String("name", name).Required().MaxLength(maxSubscriptionLength).Excludes("/")
+	checkAckDeadline(&v, ackDeadline)
+	v.String("start", start).OneOf(SubscriptionStartLatest, SubscriptionStartEarliest)
+	if err := v.Err(); err != nil {
+		return Subscription{}, false, err
+	}
+	now := s.clock.Now()
+	saved, created, err := s.subscriptions.PutSubscription(ctx, Subscription{
+		TenantID:           scope.TenantID,
+		ProjectID:          scope.ProjectID,
+		Topic:              topic,
+		Name:               name,
+		AckDeadlineSeconds: int(ackDeadline / time.Second),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}, start == SubscriptionStartEarliest)
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	if created {
+		s.audit.Record(ctx, audit.Change{
+			Action:    "messaging.subscription.create",
+			Resource:  subscriptionResource(topic, name),
+			TenantID:  scope.TenantID,
+			ProjectID: scope.ProjectID,
+			After:     saved,
+		})
+	}
+	return saved, created, nil
+}
+
+// GetSubscription returns the scope's subscription to topic named name.
+func (s *Service) GetSubscription(ctx context.Context, scope Scope, topic, name string) (Subscription, error) {
+	if s.subscriptions == nil {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	return s.subscriptions.GetSubscription(ctx, scope, topic, name)
+}
+
+// Subscriptions returns the scope's subscriptions to topic.
+func (s *Service) Subscriptions(ctx context.Context, scope Scope, topic string) ([]Subscription, error) {
+	if s.subscriptions == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	return s.subscriptions.Subscriptions(ctx, scope, topic)
+}
+
+// DeleteSubscription removes the scope's subscription to topic with its
+// position and deliveries. The topic's messages are left as they are.
+func (s *Service) DeleteSubscription(ctx context.Context, scope Scope, topic, name string) error {
+	if s.subscriptions == nil {
+		return ErrSubscriptionNotFound
+	}
+	sub, err := s.subscriptions.DeleteSubscription(ctx, scope, topic, name)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "messaging.subscription.delete",
+		Resource:  subscriptionResource(topic, name),
+		TenantID:  scope.TenantID,
+		ProjectID: scope.ProjectID,
+		Before:    sub,
+	})
+	return nil
+}
+
+// PullSubscription delivers up to limit messages (DefaultPullLimit when
+// zero) to a consumer of the subscription. Messages delivered and not
+// acknowledged within the subscription's ack deadline are delivered again,
+// to whichever consumer pulls next, until the topic's dead-letter policy
+// moves them to its dead-letter topic. The message stays in its topic for
+// the other subscriptions.
+func (s *Service) PullSubscription(ctx context.Context, scope Scope, topic, name string, limit int) ([]Message, error) {
+	if s.subscriptions == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+	if limit <= 0 {
+		limit = DefaultPullLimit
+	}
+	exhausted, policies, err := s.deadLetterCheck(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	messages, dead, err := s.subscriptions.Deliver(ctx, scope, topic, name, limit, s.clock.Now(), exhausted)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range dead {
+		if err := s.moveToDeadLetter(ctx, message, policies, name); err != nil {
+			return nil, err
+		}
+		err := s.subscriptions.AckSubscription(ctx, scope, topic, name, message.MessageID)
+		if err != nil && !errors.Is(err, ErrMessageNotFound) {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// AckSubscription acknowledges the subscription's delivery of messageID,
+// so it is not delivered to the subscription again. The message stays in
+// its topic for other subscriptions and for plain pulls until Ack or
+// retention removes it.
+func (s *Service) AckSubscription(ctx context.Context, scope Scope, topic, name, messageID string) error {
+	if s.subscriptions == nil {
+		return ErrSubscriptionNotFound
+	}
+	if err := requireMessage(topic, messageID); err != nil {
+		return err
+	}
+	return s.subscriptions.AckSubscription(ctx, scope, topic, name, messageID)
+}
+
+func subscriptionResource(topic, name string) string {
+	return "topics/" + topic + "/subscriptions/" + name
+}
@@ -0,0 +1,145 @@
+package messaging
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// subscriptionPayload is the body of PUT
+// /topics/{topic}/subscriptions/{name}; the scope comes from the query.
+type subscriptionPayload struct {
+	AckDeadlineSeconds int    `json:"ack_deadline_seconds"`
+	Start              string `json:"start"`
+}
+
+// handleSubscriptions serves a topic's subscriptions in the scope named by
+// tenant_id and project_id; rest is the path after
+// /topics/{topic}/subscriptions:
+//
+//	GET                          lists them
+//	PUT, GET, DELETE /{name}     creates or updates, reads, and deletes one
+//	GET /{name}/messages         delivers its next messages
+//	POST /{name}/messages/{id}/ack  acknowledges a delivery
+//
+// Every route needs messages.consume.
+func (s *Service) handleSubscriptions(w http.ResponseWriter, r *http.Request, topic string, rest []string) {
+	if s.subscriptions == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	for _, segment := range rest {
+		if segment == "" {
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), r.URL.Query().Get("project_id"))
+	if !ok {
+		return
+	}
+	switch {
+	case len(rest) == 0:
+		if r.Method != http.MethodGet {
+			headerAllow(w, r, http.MethodGet)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		subs, err := s.Subscriptions(r.Context(), scope, topic)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		pagination.Write(w, r, subs, "")
+	case len(rest) == 1:
+		s.handleSubscription(w, r, scope, topic, rest[0])
+	case len(rest) == 2 && rest[1] == "messages":
+		if r.Method != http.MethodGet {
+			headerAllow(w, r, http.MethodGet)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		page, err := pagination.Parse(r, DefaultPullLimit)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		messages, err := s.PullSubscription(r.Context(), scope, topic, rest[0], page.Limit)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		resp := make([]any, 0, len(messages))
+		for _, message := range messages {
+			resp = append(resp, encodeMessage(r.Context(), message))
+		}
+		pagination.Write(w, r, resp, "")
+	case len(rest) == 4 && rest[1] == "messages" && rest[3] == "ack":
+		if r.Method != http.MethodPost {
+			headerAllow(w, r, http.MethodPost)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.AckSubscription(r.Context(), scope, topic, rest[0], rest[2]); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	}
+}
+
+func (s *Service) handleSubscription(w http.ResponseWriter, r *http.Request, scope Scope, topic, name string) {
+	switch r.Method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		sub, err := s.GetSubscription(r.Context(), scope, topic, name)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodPut:
+		defer r.Body.Close()
+		var payload subscriptionPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+			return
+		}
+		sub, created, err := s.PutSubscription(r.Context(), scope, topic, name, time.Duration(payload.AckDeadlineSeconds)*time.Second, payload.Start)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, sub)
+	case http.MethodDelete:
+		if err := s.DeleteSubscription(r.Context(), scope, topic, name); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,87 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+func TestSubscriptionsTrackTheirOwnDeliveries(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	scope := Scope{TenantID: "acme", ProjectID: "p1"}
+	publish(t, svc, "matches", "before")
+
+	latest, created, err := svc.PutSubscription(ctx, scope, "matches", "stats", 0, "")
+	if err != nil || !created || latest.AckDeadlineSeconds != 30 {
+		t.Fatalf("put stats subscription = %+v, %v", latest, err)
+	}
+	if _, _, err := svc.PutSubscription(ctx, scope, "matches", "archive", time.Second, SubscriptionStartEarliest); err != nil {
+		t.Fatalf("put archive subscription: %v", err)
+	}
+	second := publish(t, svc, "matches", "after")
+	pull := func(name string, limit int) string {
+		t.Helper()
+		messages, err := svc.PullSubscription(ctx, scope, "matches", name, limit)
+		if err != nil {
+			t.Fatalf("pull %s: %v", name, err)
+		}
+		return keys(messages)
+	}
+
+	if got := pull("stats", 0); got != "after" {
+		t.Fatalf("expected stats to start after the earlier message, got %q", got)
+	}
+	// Consumers of one subscription share its messages.
+	if got := pull("archive", 1); got != "before" {
+		t.Fatalf("archive pull = %q", got)
+	}
+	if got := pull("archive", 0); got != "after" {
+		t.Fatalf("expected the second archive consumer to get the next message, got %q", got)
+	}
+	if err := svc.AckSubscription(ctx, scope, "matches", "stats", second.MessageID); err != nil {
+		t.Fatalf("ack stats: %v", err)
+	}
+	if err := svc.AckSubscription(ctx, scope, "matches", "stats", second.MessageID); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound on a second ack, got %v", err)
+	}
+	if err := svc.AckSubscription(ctx, scope, "matches", "archive", second.MessageID); err != nil {
+		t.Fatalf("ack archive: %v", err)
+	}
+	pending, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "matches"}, pagination.Request{Limit: 10})
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("expected subscription acks to leave the topic's messages, got %d %v", len(pending), err)
+	}
+
+	if got := pull("archive", 0); got != "" {
+		t.Fatalf("expected the delivery held until its deadline, got %q", got)
+	}
+	clk.Advance(time.Second)
+	if got := pull("archive", 0); got != "before" {
+		t.Fatalf("expected the unacknowledged message redelivered, got %q", got)
+	}
+	sub, err := svc.GetSubscription(ctx, scope, "matches", "archive")
+	if err != nil || sub.InFlight != 1 || sub.AckDeadlineSeconds != 1 || !sub.LastPulledAt.Equal(clk.Now()) {
+		t.Fatalf("archive subscription = %+v, %v", sub, err)
+	}
+	subs, err := svc.Subscriptions(ctx, scope, "matches")
+	if err != nil || len(subs) != 2 || subs[0].Name != "archive" || subs[1].Name != "stats" {
+		t.Fatalf("subscriptions = %+v, %v", subs, err)
+	}
+	if others, err := svc.Subscriptions(ctx, Scope{TenantID: "globex", ProjectID: "p1"}, "matches"); err != nil || len(others) != 0 {
+		t.Fatalf("expected another tenant to see no subscriptions, got %+v %v", others, err)
+	}
+	if err := svc.DeleteSubscription(ctx, scope, "matches", "stats"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := svc.PullSubscription(ctx, scope, "matches", "stats", 0); !errors.Is(err, ErrSubscriptionNotFound) {
+		t.Fatalf("expected the deleted subscription gone, got %v", err)
+	}
+	if status, body := serve(t, svc.Handler(), http.MethodPut, "/topics/matches/subscriptions/bad?tenant_id=acme", map[string]any{"start": "middle"}); status != http.StatusBadRequest {
+		t.Fatalf("expected an unknown start refused, got %d %s", status, body)
+	}
+}
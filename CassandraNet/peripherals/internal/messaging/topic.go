@@ -0,0 +1,215 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrTopicNotFound is returned when a topic was not created, and by
+// publishes to such a topic in strict mode.
+var ErrTopicNotFound = errors.New("messaging: topic not found")
+
+// maxTopicRetention bounds a topic's retention.
+const maxTopicRetention = 365 * 24 * time.Hour
+
+// Topic holds the settings of a created topic, shared by every tenant
+// publishing to it. RetentionSeconds, when positive, replaces the age of
+// the RetentionPolicy for the topic's messages; MaxMessageBytes bounds
+// their payloads; and DefaultPriority and MessageTTLSeconds, when
+// positive, apply to those published without a priority or a TTL.
+type Topic struct {
+	Name              string    `json:"name"`
+	RetentionSeconds  int       `json:"retention_seconds"`
+	MaxMessageBytes   int       `json:"max_message_bytes"`
+	DefaultPriority   Priority  `json:"default_priority"`
+	MessageTTLSeconds int       `json:"message_ttl_seconds"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TopicStore persists topics.
+type TopicStore interface {
+	// PutTopic creates or replaces the settings of topic.Name, keeping the
+	// creation time of those it replaces, and reports whether it created
+	// the topic.
+	PutTopic(ctx context.Context, topic Topic) (Topic, bool, error)
+	GetTopic(ctx context.Context, name string) (Topic, error)
+	// Topics returns every topic, ordered by name.
+	Topics(ctx context.Context) ([]Topic, error)
+	DeleteTopic(ctx context.Context, name string) (Topic, error)
+	// PurgeMessages removes the messages expired reports true for, as
+	// Store.Purge removes those published before its cutoff, and returns
+	// how many; with dryRun it only counts them.
+	PurgeMessages(ctx context.Context, expired func(Message) bool, dryRun bool) (int, error)
+}
+
+// SetTopicStore keeps topics in ts, serves them at /topics and
+// /topics/{topic}, and applies their settings to publishes and to the
+// RetentionPolicy. Without it topics need not be created and those paths
+// answer 404. Call it before the service handles requests.
+func (s *Service) SetTopicStore(ts TopicStore) {
+	s.topics = ts
+}
+
+// SetStrictTopics refuses publishes to topics that were not created, and
+// routing rules' copies and redirects to them, with ErrTopicNotFound. It
+// takes effect with SetTopicStore. Call it before the service handles
+// requests.
+func (s *Service) SetStrictTopics(strict bool) {
+	s.strictTopics = strict
+}
+
+// PutTopic validates and creates topic, or replaces the settings of an
+// existing one, and reports whether it created it. A zero MaxMessageBytes
+// selects MaxPayloadBytes and an empty DefaultPriority PriorityNormal.
+// Messages already stored keep their priority.
+func (s *Service) PutTopic(ctx context.Context, topic Topic) (Topic, bool, error) {
+	if s.topics == nil {
+		return Topic{}, false, ErrTopicNotFound
+	}
+	if topic.MaxMessageBytes == 0 {
+		topic.MaxMessageBytes = MaxPayloadBytes
+	}
+	if topic.DefaultPriority == "" {
+		topic.DefaultPriority = PriorityNormal
+	}
+	var v validation.Validator
+	v.String("name", topic.Name).Required().MaxLength(maxTopicLength)
+	v.Int("retention_seconds", int64(topic.RetentionSeconds)).Range(0, int64(maxTopicRetention/time.Second))
+	v.Int("max_message_bytes", int64(topic.MaxMessageBytes)).Range(1, MaxPayloadBytes)
+	v.String("default_priority", string(topic.DefaultPriority)).OneOf(string(PriorityLow), string(PriorityNormal), string(PriorityHigh))
+	checkTTL(&v, "message_ttl_seconds", time.Duration(topic.MessageTTLSeconds)*time.Second)
+	if err := v.Err(); err != nil {
+		return Topic{}, false, err
+	}
+	var before any
+	if previous, err := s.topics.GetTopic(ctx, topic.Name); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrTopicNotFound) {
+		return Topic{}, false, err
+	}
+	now := s.clock.Now()
+	topic.CreatedAt, topic.UpdatedAt = now, now
+	saved, created, err := s.topics.PutTopic(ctx, topic)
+	if err != nil {
+		return Topic{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.topic.put",
+		Resource: "topics/" + topic.Name,
+		Before:   before,
+		After:    saved,
+	})
+	return saved, created, nil
+}
+
+// GetTopic returns the settings of the topic name.
+func (s *Service) GetTopic(ctx context.Context, name string) (Topic, error) {
+	if s.topics == nil {
+		return Topic{}, ErrTopicNotFound
+	}
+	return s.topics.GetTopic(ctx, name)
+}
+
+// Topics returns one page of the created topics, ordered by name, and the
+// position of the next page.
+func (s *Service) Topics(ctx context.Context, page pagination.Request) ([]Topic, string, error) {
+	if s.topics == nil {
+		return nil, "", ErrTopicNotFound
+	}
+	topics, err := s.topics.Topics(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := pagination.Slice(topics, func(t Topic) string { return t.Name }, page)
+	return items, next, nil
+}
+
+// DeleteTopic removes the topic name's settings. Its pending messages stay
+// until they are acknowledged or expire under the RetentionPolicy's age,
+// and in strict mode later publishes to it are refused.
+func (s *Service) DeleteTopic(ctx context.Context, name string) error {
+	if s.topics == nil {
+		return ErrTopicNotFound
+	}
+	topic, err := s.topics.DeleteTopic(ctx, name)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.topic.delete",
+		Resource: "topics/" + name,
+		Before:   topic,
+	})
+	return nil
+}
+
+// applyTopic checks message against the settings of its topic, when it
+// was created, and gives it the topic's default priority and TTL when the
+// publisher named none. In strict mode a topic not created is refused.
+func (s *Service) applyTopic(ctx context.Context, message *Message, prioritized bool) error {
+	if s.topics == nil {
+		return nil
+	}
+	topic, err := s.topics.GetTopic(ctx, message.Topic)
+	if errors.Is(err, ErrTopicNotFound) && !s.strictTopics {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var v validation.Validator
+	v.Bytes("payload_base64", message.Payload).MaxBytes(topic.MaxMessageBytes)
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if !prioritized {
+		message.Priority = topic.DefaultPriority
+	}
+	if message.ExpiresAt.IsZero() && topic.MessageTTLSeconds > 0 {
+		message.ExpiresAt = deliverable(*message).Add(time.Duration(topic.MessageTTLSeconds) * time.Second)
+	}
+	return nil
+}
+
+// requireTopic refuses, in strict mode, a topic that was not created.
+func (s *Service) requireTopic(ctx context.Context, name string) error {
+	if s.topics == nil || !s.strictTopics {
+		return nil
+	}
+	_, err := s.topics.GetTopic(ctx, name)
+	return err
+}
+
+// purge removes the messages published before cutoff, or before their
+// topic's own retention when it sets one, for the RetentionPolicy.
+func (s *Service) purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	if s.topics == nil {
+		return s.store.Purge(ctx, cutoff, dryRun)
+	}
+	topics, err := s.topics.Topics(ctx)
+	if err != nil {
+		return 0, err
+	}
+	now := s.clock.Now()
+	cutoffs := make(map[string]time.Time)
+	for _, topic := range topics {
+		if topic.RetentionSeconds > 0 {
+			cutoffs[topic.Name] = now.Add(-time.Duration(topic.RetentionSeconds) * time.Second)
+		}
+	}
+	if len(cutoffs) == 0 {
+		return s.store.Purge(ctx, cutoff, dryRun)
+	}
+	return s.topics.PurgeMessages(ctx, func(message Message) bool {
+		if topicCutoff, ok := cutoffs[message.Topic]; ok {
+			return message.PublishedAt.Before(topicCutoff)
+		}
+		return message.PublishedAt.Before(cutoff)
+	}, dryRun)
+}
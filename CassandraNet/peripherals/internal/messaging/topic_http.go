@@ -0,0 +1,105 @@
+package messaging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const topicsPath = "/topics"
+
+// topicPayload is the body of PUT /topics/{topic}.
+type topicPayload struct {
+	RetentionSeconds  int    `json:"retention_seconds"`
+	MaxMessageBytes   int    `json:"max_message_bytes"`
+	DefaultPriority   string `json:"default_priority"`
+	MessageTTLSeconds int    `json:"message_ttl_seconds"`
+}
+
+// handleTopics lists the created topics. It needs topics.read.
+func (s *Service) handleTopics(w http.ResponseWriter, r *http.Request) {
+	if s.topics == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermTopicsRead, "", "") {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	topics, next, err := s.Topics(r.Context(), page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, topics, next)
+}
+
+// handleTopic serves a topic's settings: GET reads them, PUT creates the
+// topic or replaces them, and DELETE removes the topic. Reading needs
+// topics.read and changes topics.manage.
+func (s *Service) handleTopic(w http.ResponseWriter, r *http.Request, name string) {
+	if s.topics == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermTopicsRead, "", "") {
+			return
+		}
+		topic, err := s.GetTopic(r.Context(), name)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, topic)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermTopicsManage, "", "") {
+			return
+		}
+		defer r.Body.Close()
+		var payload topicPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+			return
+		}
+		topic, created, err := s.PutTopic(r.Context(), Topic{
+			Name:              name,
+			RetentionSeconds:  payload.RetentionSeconds,
+			MaxMessageBytes:   payload.MaxMessageBytes,
+			DefaultPriority:   Priority(payload.DefaultPriority),
+			MessageTTLSeconds: payload.MessageTTLSeconds,
+		})
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, topic)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermTopicsManage, "", "") {
+			return
+		}
+		if err := s.DeleteTopic(r.Context(), name); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,84 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestStrictTopicsMustBeCreated(t *testing.T) {
+	svc, clk := newTestService(t)
+	svc.SetStrictTopics(true)
+	ctx := context.Background()
+	publishTo := func(topic string, payload string, priority Priority) (Message, error) {
+		t.Helper()
+		return svc.Publish(ctx, PublishRequest{TenantID: "acme", ProjectID: "p1", Topic: topic, Payload: []byte(payload), Priority: priority})
+	}
+	if _, err := publishTo("scores", "", ""); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("expected a publish to an unknown topic refused, got %v", err)
+	}
+	topic, created, err := svc.PutTopic(ctx, Topic{Name: "scores", RetentionSeconds: 1, MaxMessageBytes: 8, DefaultPriority: PriorityHigh})
+	if err != nil || !created || topic.RetentionSeconds != 1 || topic.MaxMessageBytes != 8 || topic.DefaultPriority != PriorityHigh {
+		t.Fatalf("put topic = %+v, %v", topic, err)
+	}
+	if _, _, err := svc.PutTopic(ctx, Topic{Name: "audit-trail"}); err != nil {
+		t.Fatalf("put audit-trail: %v", err)
+	}
+	var invalid validation.Errors
+	if _, _, err := svc.PutTopic(ctx, Topic{Name: "bad", DefaultPriority: "urgent"}); !errors.As(err, &invalid) {
+		t.Fatalf("expected an unknown priority refused, got %v", err)
+	}
+	topics, _, err := svc.Topics(ctx, pagination.Request{Limit: 10})
+	if err != nil || len(topics) != 2 || topics[0].Name != "audit-trail" || topics[0].MaxMessageBytes != MaxPayloadBytes ||
+		topics[0].DefaultPriority != PriorityNormal || topics[1].Name != "scores" {
+		t.Fatalf("topics = %+v, %v", topics, err)
+	}
+
+	// Routing rules may not send messages to topics that were not created.
+	if _, _, err := svc.PutRoute(ctx, RouteRule{ID: "mirror", TenantID: "acme", Match: RouteMatch{Topic: "audit-trail"}, Action: RouteCopy, Target: "missing"}); err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+	if _, err := publishTo("audit-trail", "", ""); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("expected a copy to an unknown topic refused, got %v", err)
+	}
+	if err := svc.DeleteRoute(ctx, Scope{TenantID: "acme"}, "mirror"); err != nil {
+		t.Fatalf("delete route: %v", err)
+	}
+
+	if _, err := publishTo("scores", "too long a score", ""); !errors.As(err, &invalid) {
+		t.Fatalf("expected a payload over the topic's bound refused, got %v", err)
+	}
+	if defaulted, err := publishTo("scores", "42", ""); err != nil || defaulted.Priority != PriorityHigh {
+		t.Fatalf("expected the topic's default priority, got %+v %v", defaulted, err)
+	}
+	if low, err := publishTo("scores", "", PriorityLow); err != nil || low.Priority != PriorityLow {
+		t.Fatalf("expected a named priority kept, got %+v %v", low, err)
+	}
+	if _, err := publishTo("audit-trail", "", ""); err != nil {
+		t.Fatalf("publish audit-trail: %v", err)
+	}
+
+	// The topic's one-second retention applies before the service's week.
+	clk.Advance(2 * time.Second)
+	purged, err := svc.purge(ctx, clk.Now().Add(-DefaultMessageRetention), false)
+	if err != nil || purged != 2 {
+		t.Fatalf("expected the topic's messages to expire, purged %d %v", purged, err)
+	}
+	if kept, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "audit-trail"}, pagination.Request{Limit: 10}); err != nil || len(kept) != 1 {
+		t.Fatalf("expected other topics' messages kept, got %+v %v", kept, err)
+	}
+
+	if err := svc.DeleteTopic(ctx, "scores"); err != nil {
+		t.Fatalf("delete topic: %v", err)
+	}
+	if _, err := svc.GetTopic(ctx, "scores"); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("expected the topic gone, got %v", err)
+	}
+	if _, err := publishTo("scores", "", ""); !errors.Is(err, ErrTopicNotFound) {
+		t.Fatalf("expected publishes to a deleted topic refused, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package messaging
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrTopicKeyNotFound is returned when a tenant has registered no key for
+// a topic.
+var ErrTopicKeyNotFound = errors.New("messaging: topic key not found")
+
+// Attributes marking a message whose payload was encrypted with its
+// topic's key: the scheme and the KeyID of the key, so consumers holding
+// several private keys know which opens it.
+const (
+	AttrEncryption      = "encryption"
+	AttrEncryptionKeyID = "encryption_key_id"
+)
+
+// TopicKeyAlgorithm is the one encryption scheme of topic keys. Each
+// payload is sealed with AES-256-GCM under a key derived by HKDF-SHA256
+// from an X25519 exchange between a fresh ephemeral key and the topic's
+// public key; the stored payload is the ephemeral public key followed by
+// the ciphertext. The salt is both public keys and the info
+// topicKeyInfo. Every derived key seals one payload, so the nonce is
+// zero.
+const TopicKeyAlgorithm = "x25519-hkdf-sha256-aes256gcm"
+
+const topicKeyInfo = "cassandra messaging topic key"
+
+// TopicKey is a public key a tenant registered for a topic. Messages the
+// tenant publishes to the topic, or that routing rules send there, are
+// stored with their payload encrypted to it, so only the holder of the
+// private key can read them.
+type TopicKey struct {
+	TenantID  string `json:"tenant_id"`
+	Topic     string `json:"topic"`
+	Algorithm string `json:"algorithm"`
+	// PublicKey is the raw 32-byte X25519 public key.
+	PublicKey []byte `json:"public_key"`
+	// KeyID is the first 16 hex digits of the SHA-256 of PublicKey.
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TopicKeyStore persists topic keys.
+type TopicKeyStore interface {
+	// PutTopicKey creates or replaces the tenant's key for key.Topic,
+	// keeping the creation time of the key it replaces, and reports
+	// whether it created one.
+	PutTopicKey(ctx context.Context, key TopicKey) (TopicKey, bool, error)
+	GetTopicKey(ctx context.Context, tenantID, topic string) (TopicKey, error)
+	DeleteTopicKey(ctx context.Context, tenantID, topic string) (TopicKey, error)
+}
+
+// SetTopicKeyStore encrypts published payloads to the topic keys kept in
+// ks and serves them at /topics/{topic}/key. Without it payloads are
+// stored as published and that path answers 404. Call it before the
+// service handles requests.
+func (s *Service) SetTopicKeyStore(ks TopicKeyStore) {
+	s.topicKeys = ks
+}
+
+// PutTopicKey validates and registers publicKey as the tenant's key for
+// topic, replacing any earlier one, and reports whether it created one.
+// Messages already stored keep the encryption they were stored with.
+func (s *Service) PutTopicKey(ctx context.Context, tenantID, topic string, publicKey []byte) (TopicKey, bool, error) {
+	if s.topicKeys == nil {
+		return TopicKey{}, false, ErrTopicKeyNotFound
+	}
+	var v validation.Validator
+	v.ID("tenant_id", tenantID)
+	v.String("topic", topic).Required().MaxLength(maxTopicLength)
+	_, err := ecdh.X25519().NewPublicKey(publicKey)
+	v.Check(err == nil, "public_key", validation.RuleFormat, "must be a 32-byte X25519 public key")
+	if err := v.Err(); err != nil {
+		return TopicKey{}, false, err
+	}
+	var before any
+	if previous, err := s.topicKeys.GetTopicKey(ctx, tenantID, topic); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrTopicKeyNotFound) {
+		return TopicKey{}, false, err
+	}
+	sum := sha256.Sum256(publicKey)
+	now := s.clock.Now()
+	saved, created, err := s.topicKeys.PutTopicKey(ctx, TopicKey{
+		TenantID:  tenantID,
+		Topic:     topic,
+		Algorithm: TopicKeyAlgorithm,
+		PublicKey: append([]byte(nil), publicKey...),
+		KeyID:     hex.EncodeToString(sum[:8]),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return TopicKey{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.topic_key.put",
+		Resource: "topics/" + topic + "/key",
+		TenantID: tenantID,
+		Before:   before,
+		After:    saved,
+	})
+	return saved, created, nil
+}
+
+// GetTopicKey returns the tenant's key for topic.
+func (s *Service) GetTopicKey(ctx context.Context, tenantID, topic string) (TopicKey, error) {
+	if s.topicKeys == nil {
+		return TopicKey{}, ErrTopicKeyNotFound
+	}
+	return s.topicKeys.GetTopicKey(ctx, tenantID, topic)
+}
+
+// DeleteTopicKey removes the tenant's key for topic. Later messages are
+// stored as published; those already stored stay encrypted.
+func (s *Service) DeleteTopicKey(ctx context.Context, tenantID, topic string) error {
+	if s.topicKeys == nil {
+		return ErrTopicKeyNotFound
+	}
+	key, err := s.topicKeys.DeleteTopicKey(ctx, tenantID, topic)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "messaging.topic_key.delete",
+		Resource: "topics/" + topic + "/key",
+		TenantID: tenantID,
+		Before:   key,
+	})
+	return nil
+}
+
+// encrypt replaces message's payload with its encryption to the key its
+// tenant registered for its topic, if any, and marks it with
+// AttrEncryption and AttrEncryptionKeyID.
+func (s *Service) encrypt(ctx context.Context, message *Message) error {
+	if s.topicKeys == nil {
+		return nil
+	}
+	key, err := s.topicKeys.GetTopicKey(ctx, message.TenantID, message.Topic)
+	if errors.Is(err, ErrTopicKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	sealed, err := sealPayload(key.PublicKey, message.Payload)
+	if err != nil {
+		return fmt.Errorf("messaging: encrypt for topic %s: %w", message.Topic, err)
+	}
+	message.Payload = sealed
+	message.Attributes = cloneMap(message.Attributes)
+	if message.Attributes == nil {
+		message.Attributes = make(map[string]string, 2)
+	}
+	message.Attributes[AttrEncryption] = TopicKeyAlgorithm
+	message.Attributes[AttrEncryptionKeyID] = key.KeyID
+	return nil
+}
+
+// sealPayload encrypts plaintext to publicKey as TopicKeyAlgorithm
+// describes.
+func sealPayload(publicKey, plaintext []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	salt := append(append([]byte(nil), ephemeralPublic...), publicKey...)
+	key, err := hkdf.Key(sha256.New, shared, salt, topicKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Seal(ephemeralPublic, nonce, plaintext, nil), nil
+}
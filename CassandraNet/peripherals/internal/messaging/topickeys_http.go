@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// topicKeyPayload is the body of PUT /topics/{topic}/key; the tenant comes
+// from the query.
+type topicKeyPayload struct {
+	Algorithm string `json:"algorithm"`
+	// PublicKey is the base64-encoded X25519 public key.
+	PublicKey []byte `json:"public_key"`
+}
+
+// handleTopicKey serves the tenant's key for topic: GET reads it, PUT
+// registers one, and DELETE removes it. Reading needs messages.consume,
+// so consumers can check the key their messages are encrypted to.
+func (s *Service) handleTopicKey(w http.ResponseWriter, r *http.Request, topic string) {
+	if s.topicKeys == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	scope, ok := resolveScope(w, r, r.URL.Query().Get("tenant_id"), "")
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermMessagesConsume, scope.TenantID, "") {
+			return
+		}
+		key, err := s.GetTopicKey(r.Context(), scope.TenantID, topic)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, key)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermTopicKeysManage, scope.TenantID, "") {
+			return
+		}
+		defer r.Body.Close()
+		var payload topicKeyPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+			return
+		}
+		if payload.Algorithm != "" && payload.Algorithm != TopicKeyAlgorithm {
+			httpError(w, r, validation.Invalid("algorithm", validation.RuleOneOf, "must be "+TopicKeyAlgorithm))
+			return
+		}
+		key, created, err := s.PutTopicKey(r.Context(), scope.TenantID, topic, payload.PublicKey)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, key)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermTopicKeysManage, scope.TenantID, "") {
+			return
+		}
+		if err := s.DeleteTopicKey(r.Context(), scope.TenantID, topic); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,77 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestTopicKeysEncryptPayloadsForConsumers(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	var invalid validation.Errors
+	if _, _, err := svc.PutTopicKey(ctx, "acme", "secrets", []byte("short")); !errors.As(err, &invalid) {
+		t.Fatalf("expected a malformed public key refused, got %v", err)
+	}
+	key, created, err := svc.PutTopicKey(ctx, "acme", "secrets", private.PublicKey().Bytes())
+	if err != nil || !created || len(key.KeyID) != 16 || key.Algorithm != TopicKeyAlgorithm {
+		t.Fatalf("put topic key = %+v %v, %v", key, created, err)
+	}
+	// Copies go to a topic without a key, so they stay readable.
+	if _, _, err := svc.PutRoute(ctx, RouteRule{
+		ID: "mirror", TenantID: "acme", Match: RouteMatch{Topic: "secrets"}, Action: RouteCopy, Target: "secrets-plain",
+	}); err != nil {
+		t.Fatalf("put route: %v", err)
+	}
+	plaintext := []byte("launch codes")
+	publish(t, svc, "secrets", "a", func(r *PublishRequest) { r.Payload = plaintext })
+	publish(t, svc, "secrets", "b", func(r *PublishRequest) { r.TenantID, r.Payload = "globex", plaintext })
+
+	pull := func(tenant, topic string) Message {
+		t.Helper()
+		messages, _, err := svc.Pull(ctx, PullFilter{TenantID: tenant, Topic: topic}, pagination.Request{Limit: 10})
+		if err != nil || len(messages) != 1 {
+			t.Fatalf("pull %s = %d messages, %v", topic, len(messages), err)
+		}
+		return messages[0]
+	}
+	sealed := pull("acme", "secrets")
+	if sealed.Attributes[AttrEncryption] != TopicKeyAlgorithm || sealed.Attributes[AttrEncryptionKeyID] != key.KeyID {
+		t.Fatalf("expected the message marked encrypted, got %v", sealed.Attributes)
+	}
+	// The stored payload is an ephemeral public key, then the ciphertext
+	// and its tag.
+	if bytes.Contains(sealed.Payload, plaintext) || len(sealed.Payload) != 32+len(plaintext)+16 {
+		t.Fatalf("expected the stored payload sealed, got %d bytes", len(sealed.Payload))
+	}
+	if _, err := ecdh.X25519().NewPublicKey(sealed.Payload[:32]); err != nil {
+		t.Fatalf("expected the payload to start with an ephemeral key: %v", err)
+	}
+	if copied := pull("acme", "secrets-plain"); !bytes.Equal(copied.Payload, plaintext) || copied.Attributes[AttrEncryption] != "" {
+		t.Fatalf("expected a plaintext copy, got %+v", copied)
+	}
+	if other := pull("globex", "secrets"); !bytes.Equal(other.Payload, plaintext) {
+		t.Fatalf("expected another tenant's messages left alone, got %+v", other)
+	}
+
+	if err := svc.DeleteTopicKey(ctx, "acme", "secrets"); err != nil {
+		t.Fatalf("delete topic key: %v", err)
+	}
+	if _, err := svc.GetTopicKey(ctx, "acme", "secrets"); !errors.Is(err, ErrTopicKeyNotFound) {
+		t.Fatalf("expected the deleted key gone, got %v", err)
+	}
+	publish(t, svc, "secrets", "c", func(r *PublishRequest) { r.Payload = plaintext })
+	if later := pull("acme", "secrets"); !bytes.Equal(later.Payload, plaintext) || later.Attributes[AttrEncryption] != "" {
+		t.Fatalf("expected later messages stored as published, got %+v", later)
+	}
+}
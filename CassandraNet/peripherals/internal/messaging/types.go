@@ -12,6 +12,9 @@ const (
 )
 
 // Message encapsulates a single event routed through the messaging service.
+// A message with a DeliverAt is held apart from its topic until that time,
+// and one with an ExpiresAt is removed once that time passes, whether or
+// not it was delivered.
 type Message struct {
 	MessageID   string            `json:"message_id"`
 	TenantID    string            `json:"tenant_id"`
@@ -21,10 +24,15 @@ type Message struct {
 	Payload     []byte            `json:"-"`
 	Priority    Priority          `json:"priority"`
 	PublishedAt time.Time         `json:"published_at"`
+	DeliverAt   time.Time         `json:"deliver_at,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
 	Attributes  map[string]string `json:"attributes,omitempty"`
 }
 
-// PublishRequest collects publish properties from clients.
+// PublishRequest collects publish properties from clients. DeliverAt, or
+// Delay from now, holds the message back until then; a DeliverAt already
+// past delivers it at once. TTL, when positive, is how long the message
+// is kept pending once delivered; zero leaves it to its topic.
 type PublishRequest struct {
 	TenantID   string
 	ProjectID  string
@@ -32,13 +40,28 @@ type PublishRequest struct {
 	Key        string
 	Payload    []byte
 	Priority   Priority
+	DeliverAt  time.Time
+	Delay      time.Duration
+	TTL        time.Duration
 	Attributes map[string]string
 }
 
-// PullFilter controls message retrieval.
+// PullFilter controls message retrieval. Group, when set, names the
+// consumer group pulling, AckDeadline, when positive, how long the pulled
+// messages are leased to it, and Wait how long a pull finding none waits
+// for one.
 type PullFilter struct {
+	TenantID    string
+	ProjectID   string
+	Topic       string
+	Group       string
+	AckDeadline time.Duration
+	Wait        time.Duration
+}
+
+// Scope names the tenant and project a routing rule belongs to. Empty
+// fields mean the rule applies across them.
+type Scope struct {
 	TenantID  string
 	ProjectID string
-	Topic     string
-	Limit     int
 }
@@ -0,0 +1,115 @@
+package messaging
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// APIVersions lists the versions Handler serves. v2 changes the message
+// envelope: the tenant and project move into a scope object and the
+// payload states its encoding. Binaries pass the list to apiversion.Mount.
+var APIVersions = []apiversion.Version{apiversion.V1, apiversion.V2}
+
+// Payload encodings accepted in v2 publish requests. Responses always use
+// base64, since payloads are arbitrary bytes.
+const (
+	encodingBase64 = "base64"
+	encodingText   = "text"
+)
+
+type scopeV2 struct {
+	TenantID  string `json:"tenant_id"`
+	ProjectID string `json:"project_id"`
+}
+
+type payloadV2 struct {
+	Encoding string `json:"encoding"`
+	Data     string `json:"data"`
+}
+
+type publishPayloadV2 struct {
+	Scope        scopeV2           `json:"scope"`
+	Key          string            `json:"key"`
+	Priority     string            `json:"priority"`
+	DeliverAt    string            `json:"deliver_at"`
+	DelaySeconds int               `json:"delay_seconds"`
+	TTLSeconds   int               `json:"ttl_seconds"`
+	Attributes   map[string]string `json:"attributes"`
+	Payload      payloadV2         `json:"payload"`
+}
+
+type messageV2 struct {
+	ID          string            `json:"id"`
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key"`
+	Priority    string            `json:"priority"`
+	Scope       scopeV2           `json:"scope"`
+	PublishedAt string            `json:"published_at"`
+	DeliverAt   string            `json:"deliver_at,omitempty"`
+	ExpiresAt   string            `json:"expires_at,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	Payload     payloadV2         `json:"payload"`
+}
+
+// decodePublish reads a publish request in the version the caller asked
+// for. v2 requests are translated to the v1 shape, so validation and
+// publishing are shared.
+func decodePublish(ctx context.Context, body io.Reader) (publishPayload, error) {
+	var payload publishPayload
+	if apiversion.FromContext(ctx) < apiversion.V2 {
+		return payload, json.NewDecoder(body).Decode(&payload)
+	}
+	var v2 publishPayloadV2
+	if err := json.NewDecoder(body).Decode(&v2); err != nil {
+		return payload, err
+	}
+	payload = publishPayload{
+		TenantID:      v2.Scope.TenantID,
+		ProjectID:     v2.Scope.ProjectID,
+		Key:           v2.Key,
+		PayloadBase64: v2.Payload.Data,
+		Priority:      v2.Priority,
+		DeliverAt:     v2.DeliverAt,
+		DelaySeconds:  v2.DelaySeconds,
+		TTLSeconds:    v2.TTLSeconds,
+		Attributes:    v2.Attributes,
+	}
+	switch v2.Payload.Encoding {
+	case "", encodingBase64:
+	case encodingText:
+		payload.PayloadBase64 = base64.StdEncoding.EncodeToString([]byte(v2.Payload.Data))
+	default:
+		return payload, validation.Invalid("payload.encoding", validation.RuleOneOf, "must be base64 or text")
+	}
+	return payload, nil
+}
+
+// encodeMessage renders message in the version the caller asked for.
+func encodeMessage(ctx context.Context, message Message) any {
+	if apiversion.FromContext(ctx) < apiversion.V2 {
+		return toMessageResponse(message)
+	}
+	resp := messageV2{
+		ID:          message.MessageID,
+		Topic:       message.Topic,
+		Key:         message.Key,
+		Priority:    string(message.Priority),
+		Scope:       scopeV2{TenantID: message.TenantID, ProjectID: message.ProjectID},
+		PublishedAt: message.PublishedAt.UTC().Format(time.RFC3339Nano),
+		Attributes:  cloneMap(message.Attributes),
+		Payload:     payloadV2{Encoding: encodingBase64, Data: EncodePayloadBase64(message)},
+	}
+	if !message.DeliverAt.IsZero() {
+		resp.DeliverAt = message.DeliverAt.UTC().Format(time.RFC3339Nano)
+	}
+	if !message.ExpiresAt.IsZero() {
+		resp.ExpiresAt = message.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	return resp
+}
@@ -0,0 +1,72 @@
+package messaging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// maxPullWait bounds how long a pull waits for messages, below the
+// default REQUEST_TIMEOUT.
+const maxPullWait = 20 * time.Second
+
+// pullRecheck is how often a waiting pull looks again without being
+// woken, to find messages published through other replicas and those
+// whose lease lapsed.
+const pullRecheck = time.Second
+
+// arrivals wakes the pulls waiting on a topic when a message becomes
+// pullable in it on this replica. It holds only the topics being waited
+// on. The zero value is ready to use.
+type arrivals struct {
+	mu     sync.Mutex
+	topics map[string]*arrival
+}
+
+// arrival is the channel the pulls waiting on one topic share.
+type arrival struct {
+	ch      chan struct{}
+	waiters int
+}
+
+// watch returns a channel closed at the next notify of topic, and a
+// function the caller calls once it stops waiting on it.
+func (a *arrivals) watch(topic string) (<-chan struct{}, func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.topics == nil {
+		a.topics = make(map[string]*arrival)
+	}
+	e, ok := a.topics[topic]
+	if !ok {
+		e = &arrival{ch: make(chan struct{})}
+		a.topics[topic] = e
+	}
+	e.waiters++
+	return e.ch, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		// After a notify the topic may be watched again through a new
+		// arrival, which is not this waiter's to drop.
+		if e.waiters--; e.waiters == 0 && a.topics[topic] == e {
+			delete(a.topics, topic)
+		}
+	}
+}
+
+// notify wakes every pull waiting on topic.
+func (a *arrivals) notify(topic string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if e, ok := a.topics[topic]; ok {
+		close(e.ch)
+		delete(a.topics, topic)
+	}
+}
+
+// checkPullWait checks a pull's wait of whole seconds up to maxPullWait.
+func checkPullWait(v *validation.Validator, d time.Duration) {
+	v.Check(d >= 0 && d <= maxPullWait && d%time.Second == 0,
+		"wait_seconds", validation.RuleRange, "must be between 0 and 20")
+}
@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestPullsWaitForMessages(t *testing.T) {
+	svc, clk := newTestService(t)
+	ctx := context.Background()
+	type result struct {
+		keys string
+		err  error
+	}
+	waiters := func(n int) {
+		for clk.Waiters() != n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	// wait starts a pull waiting up to d and returns once it is waiting,
+	// on its timeout and its recheck.
+	wait := func(filter PullFilter, d time.Duration) <-chan result {
+		t.Helper()
+		filter.TenantID, filter.Topic, filter.Wait = "acme", "jobs", d
+		done := make(chan result, 1)
+		go func() {
+			messages, _, err := svc.Pull(ctx, filter, pagination.Request{Limit: 10})
+			done <- result{keys(messages), err}
+		}()
+		waiters(2)
+		return done
+	}
+	await := func(done <-chan result) string {
+		t.Helper()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				t.Fatalf("pull: %v", r.err)
+			}
+			return r.keys
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the waiting pull to return")
+			return ""
+		}
+	}
+
+	empty := wait(PullFilter{}, 2*time.Second)
+	clk.Advance(2 * time.Second)
+	if got := await(empty); got != "" {
+		t.Fatalf("expected an empty pull after waiting, got %q", got)
+	}
+	waiters(0)
+
+	woken := wait(PullFilter{AckDeadline: 5 * time.Second}, 10*time.Second)
+	publish(t, svc, "jobs", "late", func(r *PublishRequest) { r.TenantID = "globex" })
+	publish(t, svc, "jobs", "late")
+	if got := await(woken); got != "late" {
+		t.Fatalf("expected the waiting pull woken by the publish, got %q", got)
+	}
+	waiters(0)
+
+	// A lapsed lease wakes no one; the pull finds it when it looks again,
+	// before its wait runs out.
+	leased := wait(PullFilter{}, 10*time.Second)
+	clk.Advance(5 * time.Second)
+	if got := await(leased); got != "late" {
+		t.Fatalf("expected the waiting pull to find the lapsed lease, got %q", got)
+	}
+
+	var invalid validation.Errors
+	if _, _, err := svc.Pull(ctx, PullFilter{TenantID: "acme", Topic: "jobs", Wait: 21 * time.Second}, pagination.Request{}); !errors.As(err, &invalid) {
+		t.Fatalf("expected a wait over 20 seconds refused, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package metering
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the usage endpoints.
+const (
+	codeInvalidRequest = "usage.invalid_request"
+	codeNotFound       = "usage.not_found"
+	codeUnavailable    = "usage.store_unavailable"
+	codeForbidden      = "usage.forbidden_tenant"
+)
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/usage"
+
+// Handler serves the usage API:
+//
+//	GET /usage          daily totals, paginated
+//	GET /usage/quotas   the tenant's usage against its quotas
+//	GET /usage/export   daily totals as CSV, for billing
+//
+// Totals and the export take tenant_id, meter, and from and to days
+// (YYYY-MM-DD, inclusive; the current month by default). Callers bound to
+// a tenant only see that tenant's usage; every route requires
+// auth.PermUsageRead.
+func (m *Meter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var serve func(http.ResponseWriter, *http.Request, string)
+		switch r.URL.Path {
+		case Path, Path + "/":
+			serve = m.handleTotals
+		case Path + "/quotas":
+			serve = m.handleQuotas
+		case Path + "/export":
+			serve = m.handleExport
+		default:
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, "usage", http.MethodGet)
+			return
+		}
+		requested := r.URL.Query().Get("tenant_id")
+		tenant, ok := auth.ResolveTenant(r.Context(), requested)
+		if !ok {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+			return
+		}
+		if !auth.Allow(w, r, auth.PermUsageRead, tenant, "") {
+			return
+		}
+		serve(w, r, tenant)
+	})
+}
+
+func (m *Meter) handleTotals(w http.ResponseWriter, r *http.Request, tenant string) {
+	filter, err := m.parseFilter(r, tenant)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	totals, next, err := m.Totals(r.Context(), filter, page)
+	if err != nil {
+		logging.For(r.Context(), m.logger).Printf("metering: list totals: %v", err)
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, totals, next)
+}
+
+func (m *Meter) handleQuotas(w http.ResponseWriter, r *http.Request, tenant string) {
+	if tenant == "" {
+		httpError(w, r, validation.Invalid("tenant_id", validation.RuleRequired, "is required"))
+		return
+	}
+	statuses, err := m.QuotaStatus(r.Context(), tenant)
+	if err != nil {
+		logging.For(r.Context(), m.logger).Printf("metering: quota status of %s: %v", tenant, err)
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"items": statuses})
+}
+
+// handleExport streams the totals as CSV with a header row. A store
+// failure after the first row can only cut the body short.
+func (m *Meter) handleExport(w http.ResponseWriter, r *http.Request, tenant string) {
+	filter, err := m.parseFilter(r, tenant)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	var out *csv.Writer
+	err = m.Each(r.Context(), filter, func(t Total) error {
+		if out == nil {
+			out = startExport(w, filter)
+		}
+		return out.Write([]string{t.Day, t.TenantID, t.Meter, strconv.FormatInt(t.Quantity, 10)})
+	})
+	if out == nil {
+		if err != nil {
+			logging.For(r.Context(), m.logger).Printf("metering: export totals: %v", err)
+			httpError(w, r, err)
+			return
+		}
+		out = startExport(w, filter)
+	}
+	out.Flush()
+}
+
+func startExport(w http.ResponseWriter, filter Filter) *csv.Writer {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage-`+filter.From+`-`+filter.To+`.csv"`)
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"day", "tenant_id", "meter", "quantity"})
+	return out
+}
+
+// parseFilter reads meter, from, and to, defaulting the range to the
+// current month so far.
+func (m *Meter) parseFilter(r *http.Request, tenant string) (Filter, error) {
+	query := r.URL.Query()
+	now := m.clock.Now()
+	filter := Filter{
+		TenantID: tenant,
+		Meter:    query.Get("meter"),
+		From:     PeriodMonth.start(now).Format(dayLayout),
+		To:       now.Format(dayLayout),
+	}
+	var v validation.Validator
+	if filter.Meter != "" {
+		v.String("meter", filter.Meter).OneOf(Meters...)
+	}
+	parseDay(&v, "from", query.Get("from"), &filter.From)
+	parseDay(&v, "to", query.Get("to"), &filter.To)
+	v.Check(filter.From <= filter.To, "from", validation.RuleRange, "must not be after to")
+	return filter, v.Err()
+}
+
+// parseDay replaces *day with raw when raw is present and a valid day.
+func parseDay(v *validation.Validator, field, raw string, day *string) {
+	if raw == "" {
+		return
+	}
+	if _, err := time.Parse(dayLayout, raw); err != nil {
+		v.Check(false, field, validation.RuleFormat, "must be a date like 2006-01-02")
+		return
+	}
+	*day = raw
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrStore):
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
@@ -0,0 +1,292 @@
+// Package metering records billable usage per tenant and keeps daily
+// totals on a storage driver. Services count usage as it happens:
+//
+//	meter := metering.New(db, metering.FromConfig(loader), logger)
+//	meter.Record(ctx, message.TenantID, metering.MessagesPublished, 1)
+//
+// Counts are buffered in memory and added to the stored totals every
+// flush interval by Run, so recording never waits on storage. Services
+// sharing a driver share the totals. Handler serves them, quota status
+// against the configured limits, and a CSV export for billing, at /usage.
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Meters recorded by the services.
+const (
+	// MessagesPublished counts messages accepted by the messaging service.
+	MessagesPublished = "messages_published"
+	// NotificationsSent counts notifications a channel accepted.
+	NotificationsSent = "notifications_sent"
+	// UGCModerated counts moderation reviews of UGC items.
+	UGCModerated = "ugc_moderated"
+	// LogBytes counts the bytes of ingested log messages and fields.
+	LogBytes = "log_bytes"
+)
+
+// Meters lists every meter, in the order reports use.
+var Meters = []string{MessagesPublished, NotificationsSent, UGCModerated, LogBytes}
+
+// totalsBucket holds one Total per tenant, day, and meter, keyed
+// "tenant/day/meter" so a tenant's totals scan in date order.
+const totalsBucket = "metering.totals"
+
+// dayLayout formats the UTC days totals are kept for.
+const dayLayout = time.DateOnly
+
+// ErrStore indicates the storage backend failed.
+var ErrStore = errors.New("metering: store unavailable")
+
+// Total is a tenant's usage of one meter on one UTC day.
+type Total struct {
+	TenantID string `json:"tenant_id"`
+	Day      string `json:"day"`
+	Meter    string `json:"meter"`
+	Quantity int64  `json:"quantity"`
+}
+
+// Filter narrows Totals. An empty TenantID or Meter matches all; From and
+// To are inclusive days in dayLayout.
+type Filter struct {
+	TenantID string
+	Meter    string
+	From     string
+	To       string
+}
+
+func (f Filter) matches(t Total) bool {
+	return (f.TenantID == "" || t.TenantID == f.TenantID) &&
+		(f.Meter == "" || t.Meter == f.Meter) &&
+		t.Day >= f.From && t.Day <= f.To
+}
+
+// Config tunes a Meter. Zero values select the defaults.
+type Config struct {
+	// FlushInterval between writes of buffered counts (default 10s).
+	FlushInterval time.Duration
+	// Quotas are the limits reported by QuotaStatus.
+	Quotas []Quota
+}
+
+// pendingKey identifies one buffered count.
+type pendingKey struct {
+	tenant, day, meter string
+}
+
+// Meter buffers usage and adds it to the totals in a storage driver.
+type Meter struct {
+	db     storage.Driver
+	cfg    Config
+	logger logging.Printer
+	clock  clock.Clock
+
+	mu      sync.Mutex
+	pending map[pendingKey]int64
+}
+
+// New returns a meter keeping its totals in db.
+func New(db storage.Driver, cfg Config, logger logging.Printer) *Meter {
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Second
+	}
+	return &Meter{
+		db:      db,
+		cfg:     cfg,
+		logger:  logger,
+		clock:   clock.System,
+		pending: make(map[pendingKey]int64),
+	}
+}
+
+// SetClock dates usage and schedules flushes by c instead of the system
+// clock. Call it before the meter records usage or runs.
+func (m *Meter) SetClock(c clock.Clock) {
+	m.clock = clock.Or(c)
+}
+
+// Record counts quantity of meter for tenantID, or for the tenant in ctx
+// when tenantID is empty, on the current UTC day. Usage without a tenant
+// and non-positive quantities are ignored. A nil Meter records nothing,
+// letting services treat metering as optional.
+func (m *Meter) Record(ctx context.Context, tenantID, meter string, quantity int64) {
+	if m == nil || quantity <= 0 {
+		return
+	}
+	if tenantID == "" {
+		tenantID = logging.TenantID(ctx)
+	}
+	if tenantID == "" {
+		return
+	}
+	key := pendingKey{tenant: tenantID, day: m.clock.Now().Format(dayLayout), meter: meter}
+	m.mu.Lock()
+	m.pending[key] += quantity
+	m.mu.Unlock()
+}
+
+// Flush adds the buffered counts to the stored totals. On failure the
+// counts stay buffered for the next flush.
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[pendingKey]int64)
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	err := storage.Update(ctx, m.db, func(tx storage.Tx) error {
+		for key, quantity := range pending {
+			total := Total{TenantID: key.tenant, Day: key.day, Meter: key.meter}
+			raw, err := tx.Get(totalsBucket, totalKey(total))
+			switch {
+			case err == nil:
+				if err := json.Unmarshal(raw, &total); err != nil {
+					return err
+				}
+			case !errors.Is(err, storage.ErrNotFound):
+				return err
+			}
+			total.Quantity += quantity
+			data, err := json.Marshal(total)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(totalsBucket, totalKey(total), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		m.mu.Lock()
+		for key, quantity := range pending {
+			m.pending[key] += quantity
+		}
+		m.mu.Unlock()
+		return storeError(err)
+	}
+	return nil
+}
+
+// Run flushes every flush interval until ctx is cancelled, then flushes
+// once more so counts recorded before shutdown are kept. Failures are
+// logged and retried on the next flush.
+func (m *Meter) Run(ctx context.Context) error {
+	ticker := m.clock.NewTicker(m.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := m.Flush(flushCtx); err != nil {
+				m.logger.Printf("metering: final flush: %v", err)
+			}
+			return nil
+		case <-ticker.C():
+			if err := m.Flush(ctx); err != nil && ctx.Err() == nil {
+				m.logger.Printf("metering: flush: %v", err)
+			}
+		}
+	}
+}
+
+// Totals returns one page of the stored totals matching filter, ordered by
+// tenant, day, and meter, and the position of the next page. Buffered
+// counts are not included until they are flushed.
+func (m *Meter) Totals(ctx context.Context, filter Filter, page pagination.Request) ([]Total, string, error) {
+	collector := pagination.NewCollector[Total](page)
+	prefix := ""
+	if filter.TenantID != "" {
+		prefix = filter.TenantID + "/"
+	}
+	err := storage.View(ctx, m.db, func(tx storage.Tx) error {
+		return tx.Scan(totalsBucket, prefix, func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			var total Total
+			if err := json.Unmarshal(value, &total); err != nil {
+				return err
+			}
+			if !filter.matches(total) {
+				return nil
+			}
+			if !collector.Add(key, total) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	totals, next := collector.Page()
+	return totals, next, nil
+}
+
+// Each calls fn with every stored total matching filter, in the order
+// Totals returns them, stopping at the first error fn returns.
+func (m *Meter) Each(ctx context.Context, filter Filter, fn func(Total) error) error {
+	prefix := ""
+	if filter.TenantID != "" {
+		prefix = filter.TenantID + "/"
+	}
+	var fnErr error
+	err := storage.View(ctx, m.db, func(tx storage.Tx) error {
+		return tx.Scan(totalsBucket, prefix, func(_ string, value []byte) error {
+			var total Total
+			if err := json.Unmarshal(value, &total); err != nil {
+				return err
+			}
+			if !filter.matches(total) {
+				return nil
+			}
+			if fnErr = fn(total); fnErr != nil {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	return storeError(err)
+}
+
+func totalKey(t Total) string {
+	return t.TenantID + "/" + t.Day + "/" + t.Meter
+}
+
+// validMeter reports whether name is one of Meters.
+func validMeter(name string) bool {
+	for _, meter := range Meters {
+		if meter == name {
+			return true
+		}
+	}
+	return false
+}
+
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrStore) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
+
+// meterList is Meters joined for error messages.
+var meterList = strings.Join(Meters, ", ")
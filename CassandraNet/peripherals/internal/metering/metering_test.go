@@ -0,0 +1,163 @@
+package metering
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+func TestMeterFlushesDailyTotals(t *testing.T) {
+	db := storage.NewMemory()
+	fake := clock.NewFake(time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC))
+	m := New(db, Config{}, noopLogger{})
+	m.SetClock(fake)
+	ctx := context.Background()
+
+	m.Record(ctx, "acme", MessagesPublished, 2)
+	m.Record(ctx, "acme", MessagesPublished, 3)
+	m.Record(ctx, "globex", LogBytes, 100)
+	m.Record(ctx, "", MessagesPublished, 1)
+	m.Record(ctx, "acme", NotificationsSent, 0)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	fake.Advance(2 * time.Hour)
+	m.Record(ctx, "acme", MessagesPublished, 1)
+	// A second meter sharing the driver adds to the same totals.
+	other := New(db, Config{}, noopLogger{})
+	other.SetClock(fake)
+	other.Record(ctx, "acme", MessagesPublished, 4)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if err := other.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	totals, next, err := m.Totals(ctx, Filter{TenantID: "acme", From: "2026-03-01", To: "2026-04-30"}, pagination.Request{Limit: 10})
+	if err != nil || next != "" {
+		t.Fatalf("totals: %v %q", err, next)
+	}
+	want := []Total{
+		{TenantID: "acme", Day: "2026-03-31", Meter: MessagesPublished, Quantity: 5},
+		{TenantID: "acme", Day: "2026-04-01", Meter: MessagesPublished, Quantity: 5},
+	}
+	if len(totals) != len(want) || totals[0] != want[0] || totals[1] != want[1] {
+		t.Fatalf("expected %+v, got %+v", want, totals)
+	}
+	all, _, err := m.Totals(ctx, Filter{From: "2026-03-31", To: "2026-03-31"}, pagination.Request{Limit: 10})
+	if err != nil || len(all) != 2 || all[1].TenantID != "globex" {
+		t.Fatalf("expected both tenants' totals for the day, got %+v %v", all, err)
+	}
+}
+
+func TestQuotaStatus(t *testing.T) {
+	quotas := make([]Quota, 0, 3)
+	for _, spec := range []string{"messages_published=10/day", "log_bytes=1000", "acme:messages_published=3/day"} {
+		q, err := ParseQuota(spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", spec, err)
+		}
+		quotas = append(quotas, q)
+	}
+	for _, spec := range []string{"messages_published", "bytes=10", "log_bytes=-1", "log_bytes=10/week"} {
+		if _, err := ParseQuota(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+
+	fake := clock.NewFake(time.Date(2026, 4, 2, 12, 0, 0, 0, time.UTC))
+	m := New(storage.NewMemory(), Config{Quotas: quotas}, noopLogger{})
+	m.SetClock(fake)
+	ctx := context.Background()
+	m.Record(ctx, "acme", MessagesPublished, 7)
+	m.Record(ctx, "acme", LogBytes, 600)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	fake.Advance(24 * time.Hour)
+	m.Record(ctx, "acme", MessagesPublished, 2)
+	m.Record(ctx, "acme", LogBytes, 300)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	statuses, err := m.QuotaStatus(ctx, "acme")
+	if err != nil || len(statuses) != 2 {
+		t.Fatalf("quota status: %+v %v", statuses, err)
+	}
+	if s := statuses[0]; s.Meter != MessagesPublished || s.Limit != 3 || s.Used != 2 || s.Remaining != 1 || s.Exceeded || s.PeriodStart != "2026-04-03" {
+		t.Fatalf("daily quota: %+v", s)
+	}
+	if s := statuses[1]; s.Meter != LogBytes || s.Used != 900 || s.Remaining != 100 || s.PeriodStart != "2026-04-01" {
+		t.Fatalf("monthly quota: %+v", s)
+	}
+	m.Record(ctx, "globex", MessagesPublished, 11)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	statuses, _ = m.QuotaStatus(ctx, "globex")
+	if s := statuses[0]; s.Limit != 10 || !s.Exceeded || s.Remaining != 0 {
+		t.Fatalf("default quota: %+v", s)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	quota, _ := ParseQuota("messages_published=100")
+	m := New(storage.NewMemory(), Config{Quotas: []Quota{quota}}, noopLogger{})
+	m.SetClock(clock.NewFake(time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+	m.Record(ctx, "acme", MessagesPublished, 40)
+	m.Record(ctx, "acme", UGCModerated, 2)
+	if err := m.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/usage?tenant_id=acme&meter=ugc_moderated")
+	var page struct {
+		Items []Total `json:"items"`
+	}
+	if status != http.StatusOK || json.Unmarshal([]byte(body), &page) != nil || len(page.Items) != 1 || page.Items[0].Quantity != 2 {
+		t.Fatalf("totals: %d %s", status, body)
+	}
+	if status, body := get("/usage/quotas?tenant_id=acme"); status != http.StatusOK || !strings.Contains(body, `"used":40`) || !strings.Contains(body, `"remaining":60`) {
+		t.Fatalf("quotas: %d %s", status, body)
+	}
+	status, body = get("/usage/export?from=2026-05-01&to=2026-05-31")
+	if want := "day,tenant_id,meter,quantity\n2026-05-10,acme,messages_published,40\n2026-05-10,acme,ugc_moderated,2\n"; status != http.StatusOK || body != want {
+		t.Fatalf("export: %d %q", status, body)
+	}
+	for _, path := range []string{"/usage?meter=bytes", "/usage?from=May", "/usage?from=2026-05-02&to=2026-05-01", "/usage/quotas"} {
+		if status, body := get(path); status != http.StatusBadRequest || !strings.Contains(body, "usage.invalid_request") {
+			t.Errorf("%s: expected 400, got %d %s", path, status, body)
+		}
+	}
+	if status, _ := get("/usage/other"); status != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", status)
+	}
+}
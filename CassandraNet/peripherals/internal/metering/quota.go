@@ -0,0 +1,156 @@
+package metering
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// Period is the span a quota limits usage over, in UTC.
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+// start returns the first day of the period containing now.
+func (p Period) start(now time.Time) time.Time {
+	year, month, day := now.Date()
+	if p == PeriodMonth {
+		day = 1
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Quota limits a meter's usage over a period, for one tenant or, with an
+// empty TenantID, for every tenant without a quota of its own.
+type Quota struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	Meter    string `json:"meter"`
+	Limit    int64  `json:"limit"`
+	Period   Period `json:"period"`
+}
+
+// ParseQuota parses "[tenant:]meter=limit[/period]", such as
+// "acme:messages_published=100000/day". The period is day or month
+// (the default).
+func ParseQuota(spec string) (Quota, error) {
+	target, limit, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Quota{}, fmt.Errorf("quota %q: expected [tenant:]meter=limit[/period]", spec)
+	}
+	var q Quota
+	target = strings.TrimSpace(target)
+	if tenant, meter, ok := strings.Cut(target, ":"); ok {
+		q.TenantID, target = strings.TrimSpace(tenant), strings.TrimSpace(meter)
+	}
+	q.Meter = target
+	if !validMeter(q.Meter) {
+		return Quota{}, fmt.Errorf("quota %q: meter must be one of %s", spec, meterList)
+	}
+	limit, period, hasPeriod := strings.Cut(strings.TrimSpace(limit), "/")
+	var err error
+	if q.Limit, err = strconv.ParseInt(limit, 10, 64); err != nil || q.Limit < 0 {
+		return Quota{}, fmt.Errorf("quota %q: invalid limit %q", spec, limit)
+	}
+	q.Period = PeriodMonth
+	if hasPeriod {
+		q.Period = Period(strings.ToLower(period))
+		if q.Period != PeriodDay && q.Period != PeriodMonth {
+			return Quota{}, fmt.Errorf("quota %q: period must be day or month", spec)
+		}
+	}
+	return q, nil
+}
+
+// FromConfig reads METERING_FLUSH_INTERVAL and METERING_QUOTAS from
+// loader.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg := Config{FlushInterval: loader.Duration("METERING_FLUSH_INTERVAL", 10*time.Second)}
+	for _, spec := range loader.StringSlice("METERING_QUOTAS", nil) {
+		q, err := ParseQuota(spec)
+		if err != nil {
+			return Config{}, fmt.Errorf("%sMETERING_QUOTAS: %w", loader.Prefix, err)
+		}
+		cfg.Quotas = append(cfg.Quotas, q)
+	}
+	return cfg, nil
+}
+
+// QuotaStatus is a tenant's usage against one quota in the current period.
+type QuotaStatus struct {
+	TenantID    string `json:"tenant_id"`
+	Meter       string `json:"meter"`
+	Period      Period `json:"period"`
+	PeriodStart string `json:"period_start"`
+	Limit       int64  `json:"limit"`
+	Used        int64  `json:"used"`
+	Remaining   int64  `json:"remaining"`
+	Exceeded    bool   `json:"exceeded"`
+}
+
+// quotasFor returns the quotas applying to tenantID: its own, and the
+// defaults for meters it has none for, in Meters order.
+func (m *Meter) quotasFor(tenantID string) []Quota {
+	var out []Quota
+	for _, meter := range Meters {
+		var chosen *Quota
+		for i, q := range m.cfg.Quotas {
+			if q.Meter != meter {
+				continue
+			}
+			if q.TenantID == tenantID {
+				chosen = &m.cfg.Quotas[i]
+				break
+			}
+			if q.TenantID == "" && chosen == nil {
+				chosen = &m.cfg.Quotas[i]
+			}
+		}
+		if chosen != nil {
+			q := *chosen
+			q.TenantID = tenantID
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// QuotaStatus reports tenantID's stored usage against each quota that
+// applies to it, over the period containing the current day.
+func (m *Meter) QuotaStatus(ctx context.Context, tenantID string) ([]QuotaStatus, error) {
+	quotas := m.quotasFor(tenantID)
+	if len(quotas) == 0 {
+		return []QuotaStatus{}, nil
+	}
+	now := m.clock.Now()
+	today := now.Format(dayLayout)
+	from := PeriodMonth.start(now).Format(dayLayout)
+	used := make(map[[2]string]int64)
+	err := m.Each(ctx, Filter{TenantID: tenantID, From: from, To: today}, func(t Total) error {
+		used[[2]string{t.Meter, t.Day}] += t.Quantity
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]QuotaStatus, 0, len(quotas))
+	for _, q := range quotas {
+		start := q.Period.start(now).Format(dayLayout)
+		status := QuotaStatus{TenantID: tenantID, Meter: q.Meter, Period: q.Period, PeriodStart: start, Limit: q.Limit}
+		for key, quantity := range used {
+			if key[0] == q.Meter && key[1] >= start {
+				status.Used += quantity
+			}
+		}
+		status.Remaining = max(0, q.Limit-status.Used)
+		status.Exceeded = status.Used > q.Limit
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -1,54 +1,318 @@
 package metricscollector
 
 import (
+	"errors"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// MetricType classifies the instrument a sample was recorded with.
+type MetricType string
+
+const (
+	MetricTypeGauge     MetricType = "gauge"
+	MetricTypeCounter   MetricType = "counter"
+	MetricTypeHistogram MetricType = "histogram"
 )
 
+// ParseMetricType converts user supplied strings into MetricType values. An
+// empty string defaults to gauge.
+func ParseMetricType(value string) (MetricType, error) {
+	switch strings.ToLower(value) {
+	case "", string(MetricTypeGauge):
+		return MetricTypeGauge, nil
+	case string(MetricTypeCounter):
+		return MetricTypeCounter, nil
+	case string(MetricTypeHistogram):
+		return MetricTypeHistogram, nil
+	default:
+		return "", validation.Invalid("type", validation.RuleOneOf, "must be one of gauge, counter, histogram")
+	}
+}
+
 // MetricEvent represents an incoming metric sample.
 type MetricEvent struct {
 	Namespace string            `json:"namespace"`
 	Name      string            `json:"name"`
+	Type      MetricType        `json:"type,omitempty"`
 	Value     float64           `json:"value"`
 	Labels    map[string]string `json:"labels"`
 	Timestamp time.Time         `json:"timestamp"`
+	// Exemplar optionally links the sample to the trace that produced it.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
 }
 
+// Exemplar references a trace that recorded a particular sample value.
+type Exemplar struct {
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id,omitempty"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Bucket counts histogram samples falling in (previous bound, UpperBound].
+// Samples above the last bound are only reflected in Summary.Count.
+type Bucket struct {
+	UpperBound float64   `json:"le"`
+	Count      uint64    `json:"count"`
+	Exemplar   *Exemplar `json:"exemplar,omitempty"`
+}
+
+// DefaultHistogramBuckets suit millisecond latencies, the most common
+// histogram reported to the collector.
+var DefaultHistogramBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
 // Summary captures roll-up statistics for a set of samples.
 type Summary struct {
-	Count int       `json:"count"`
-	Min   float64   `json:"min"`
-	Max   float64   `json:"max"`
-	Sum   float64   `json:"sum"`
-	Mean  float64   `json:"mean"`
-	Last  time.Time `json:"last"`
+	Type  MetricType `json:"type,omitempty"`
+	Count int        `json:"count"`
+	Min   float64    `json:"min"`
+	Max   float64    `json:"max"`
+	Sum   float64    `json:"sum"`
+	Mean  float64    `json:"mean"`
+	Last  time.Time  `json:"last"`
+	// LastValue is the most recent sample, reported as the gauge value.
+	LastValue float64 `json:"last_value"`
+	// Buckets is populated for histogram series only.
+	Buckets []Bucket `json:"buckets,omitempty"`
+	// Exemplar is the most recent exemplar for non-histogram series or for
+	// histogram samples above the last bucket bound.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+}
+
+// clone returns a deep copy so callers never share bucket or exemplar state
+// with the aggregator.
+func (s Summary) clone() Summary {
+	if s.Buckets != nil {
+		buckets := make([]Bucket, len(s.Buckets))
+		for i, b := range s.Buckets {
+			buckets[i] = b
+			buckets[i].Exemplar = b.Exemplar.clone()
+		}
+		s.Buckets = buckets
+	}
+	s.Exemplar = s.Exemplar.clone()
+	return s
+}
+
+func (e *Exemplar) clone() *Exemplar {
+	if e == nil {
+		return nil
+	}
+	copy := *e
+	return &copy
+}
+
+// AggregatorConfig tunes aggregator behaviour. The zero value keeps every
+// series forever.
+type AggregatorConfig struct {
+	// IdleTTL removes series that have not received a sample for the given
+	// period. Zero disables expiry.
+	IdleTTL time.Duration
+	// SweepInterval controls how often the background sweeper started by
+	// Start looks for idle series. Defaults to half of IdleTTL.
+	SweepInterval time.Duration
+	// MaxSeriesPerMetric caps the unique label combinations tracked for a
+	// single namespace/name pair. Zero means unlimited.
+	MaxSeriesPerMetric int
+	// MaxSeries caps the total number of series. Zero means unlimited.
+	MaxSeries int
+	// Overflow decides what happens to samples that would exceed a limit.
+	// Defaults to OverflowReject.
+	Overflow OverflowPolicy
+	// HistogramBuckets are the ascending upper bounds used for histogram
+	// series. Defaults to DefaultHistogramBuckets.
+	HistogramBuckets []float64
+	// WindowSize is the width of the rolling windows used by top-K and
+	// heatmap queries. Defaults to one minute.
+	WindowSize time.Duration
+	// WindowCount is how many windows are retained per series. Defaults to 60.
+	WindowCount int
+}
+
+// OverflowPolicy controls how samples beyond the cardinality limits are
+// handled.
+type OverflowPolicy string
+
+const (
+	// OverflowReject drops the sample and returns ErrCardinalityLimit.
+	OverflowReject OverflowPolicy = "reject"
+	// OverflowAggregate folds the sample into a per-metric series labelled
+	// OverflowLabel="other".
+	OverflowAggregate OverflowPolicy = "aggregate"
+)
+
+// OverflowLabel is the label set on the per-metric overflow bucket.
+const OverflowLabel = "overflow"
+
+// ErrCardinalityLimit is returned when a sample would create a series beyond
+// the configured limits.
+var ErrCardinalityLimit = errors.New("metrics: series cardinality limit reached")
+
+// ParseOverflowPolicy converts user supplied strings into OverflowPolicy values.
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch strings.ToLower(value) {
+	case "", string(OverflowReject):
+		return OverflowReject, nil
+	case string(OverflowAggregate):
+		return OverflowAggregate, nil
+	default:
+		return "", errors.New("unknown overflow policy")
+	}
+}
+
+// CardinalityStats reports series counts and samples affected by limits.
+type CardinalityStats struct {
+	Series             int            `json:"series"`
+	MaxSeries          int            `json:"max_series,omitempty"`
+	MaxSeriesPerMetric int            `json:"max_series_per_metric,omitempty"`
+	Overflow           OverflowPolicy `json:"overflow"`
+	PerMetric          map[string]int `json:"per_metric"`
+	// RejectedSamples counts samples dropped by OverflowReject.
+	RejectedSamples uint64 `json:"rejected_samples"`
+	// OverflowSamples counts samples folded into overflow buckets.
+	OverflowSamples uint64 `json:"overflow_samples"`
+	// DroppedSeries counts distinct series identities that were refused.
+	DroppedSeries int `json:"dropped_series"`
+}
+
+// series is the internal per-identity state tracked by the aggregator.
+type series struct {
+	namespace string
+	name      string
+	labels    map[string]string
+	summary   Summary
+	// windows is a ring of per-window aggregates indexed by window number
+	// modulo WindowCount; allocated on first sample.
+	windows []window
+	// touched records when the series last received a sample, measured on the
+	// aggregator clock rather than the (client supplied) event timestamp.
+	touched time.Time
+	// local holds the series' own samples once a paired collector has
+	// reported it; until then summary alone holds them. peers holds each
+	// paired collector's summary by its name, and summary is local merged
+	// with all of them. remote marks a series only peers reported.
+	local  *Summary
+	peers  map[string]Summary
+	remote bool
 }
 
 // Aggregator ingest metrics and maintains summaries per namespace/name/label set.
 type Aggregator struct {
 	mu      sync.RWMutex
-	metrics map[string]Summary
+	metrics map[string]*series
+	// perMetric counts series per namespace/name for cardinality limits.
+	perMetric map[string]int
+	// dropped remembers refused series identities, bounded to avoid the very
+	// growth the limits protect against.
+	dropped         map[string]struct{}
+	rejectedSamples uint64
+	overflowSamples uint64
+	// peerGenerations holds the generation of the latest state applied
+	// from each paired collector.
+	peerGenerations map[string]uint64
+	cfg             AggregatorConfig
+	now             func() time.Time
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
 }
 
 // NewAggregator returns a zeroed aggregator instance.
 func NewAggregator() *Aggregator {
-	return &Aggregator{metrics: make(map[string]Summary)}
+	return NewAggregatorWithConfig(AggregatorConfig{})
+}
+
+// NewAggregatorWithConfig returns an aggregator using the provided settings.
+func NewAggregatorWithConfig(cfg AggregatorConfig) *Aggregator {
+	if cfg.IdleTTL < 0 {
+		cfg.IdleTTL = 0
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = cfg.IdleTTL / 2
+	}
+	if cfg.Overflow == "" {
+		cfg.Overflow = OverflowReject
+	}
+	if len(cfg.HistogramBuckets) == 0 {
+		cfg.HistogramBuckets = DefaultHistogramBuckets
+	}
+	cfg.HistogramBuckets = append([]float64(nil), cfg.HistogramBuckets...)
+	if cfg.WindowSize <= 0 {
+		cfg.WindowSize = time.Minute
+	}
+	if cfg.WindowCount <= 0 {
+		cfg.WindowCount = 60
+	}
+	sort.Float64s(cfg.HistogramBuckets)
+	return &Aggregator{
+		metrics:   make(map[string]*series),
+		perMetric: make(map[string]int),
+		dropped:   make(map[string]struct{}),
+		cfg:       cfg,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+
+		peerGenerations: make(map[string]uint64),
+	}
 }
 
-// Ingest adds a new metric event, updating the corresponding summary.
-func (a *Aggregator) Ingest(event MetricEvent) Summary {
+// maxTrackedDropped bounds the set used to count distinct dropped series.
+const maxTrackedDropped = 10000
+
+// Ingest adds a new metric event, updating the corresponding summary. It
+// returns ErrCardinalityLimit when the event would create a series beyond the
+// configured limits and the overflow policy rejects it.
+func (a *Aggregator) Ingest(event MetricEvent) (Summary, error) {
 	key := eventKey(event)
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	summary, ok := a.metrics[key]
+	entry, ok := a.metrics[key]
+	if !ok && a.overLimitLocked(event) {
+		a.recordDroppedLocked(key)
+		if a.cfg.Overflow != OverflowAggregate {
+			a.rejectedSamples++
+			return Summary{}, ErrCardinalityLimit
+		}
+		a.overflowSamples++
+		event.Labels = map[string]string{OverflowLabel: "other"}
+		key = eventKey(event)
+		entry, ok = a.metrics[key]
+	}
 	if !ok {
-		summary = Summary{
-			Min: event.Value,
-			Max: event.Value,
+		a.perMetric[metricKey(event.Namespace, event.Name)]++
+		entry = &series{
+			namespace: event.Namespace,
+			name:      event.Name,
+			labels:    cloneLabels(event.Labels),
 		}
+		a.metrics[key] = entry
+	}
+	a.recordLocked(&entry.summary, event)
+	if entry.local != nil {
+		a.recordLocked(entry.local, event)
+	}
+	entry.remote = false
+	entry.touched = a.now()
+	a.recordWindowLocked(entry, event.Value, entry.touched)
+	return entry.summary.clone(), nil
+}
+
+// recordLocked adds event to summary.
+func (a *Aggregator) recordLocked(summary *Summary, event MetricEvent) {
+	if event.Type != "" {
+		summary.Type = event.Type
+	}
+	if summary.Count == 0 {
+		summary.Min = event.Value
+		summary.Max = event.Value
 	}
 	if event.Value < summary.Min {
 		summary.Min = event.Value
@@ -60,8 +324,100 @@ func (a *Aggregator) Ingest(event MetricEvent) Summary {
 	summary.Sum += event.Value
 	summary.Mean = summary.Sum / float64(summary.Count)
 	summary.Last = event.Timestamp
-	a.metrics[key] = summary
-	return summary
+	summary.LastValue = event.Value
+	a.observeLocked(summary, event)
+}
+
+// observeLocked records histogram buckets and exemplars for the event.
+func (a *Aggregator) observeLocked(summary *Summary, event MetricEvent) {
+	var exemplar *Exemplar
+	if event.Exemplar != nil && event.Exemplar.TraceID != "" {
+		exemplar = event.Exemplar.clone()
+		if exemplar.Value == 0 {
+			exemplar.Value = event.Value
+		}
+		if exemplar.Timestamp.IsZero() {
+			exemplar.Timestamp = event.Timestamp
+		}
+	}
+	if summary.Type != MetricTypeHistogram {
+		if exemplar != nil {
+			summary.Exemplar = exemplar
+		}
+		return
+	}
+	if summary.Buckets == nil {
+		summary.Buckets = make([]Bucket, len(a.cfg.HistogramBuckets))
+		for i, bound := range a.cfg.HistogramBuckets {
+			summary.Buckets[i].UpperBound = bound
+		}
+	}
+	for i := range summary.Buckets {
+		if event.Value <= summary.Buckets[i].UpperBound {
+			summary.Buckets[i].Count++
+			if exemplar != nil {
+				summary.Buckets[i].Exemplar = exemplar
+			}
+			return
+		}
+	}
+	if exemplar != nil {
+		summary.Exemplar = exemplar
+	}
+}
+
+// overLimitLocked reports whether a new series for event would exceed a
+// limit. The overflow bucket itself is always admitted so aggregation keeps
+// working once limits are hit.
+func (a *Aggregator) overLimitLocked(event MetricEvent) bool {
+	if a.cfg.MaxSeries > 0 && len(a.metrics) >= a.cfg.MaxSeries {
+		return true
+	}
+	if a.cfg.MaxSeriesPerMetric > 0 && a.perMetric[metricKey(event.Namespace, event.Name)] >= a.cfg.MaxSeriesPerMetric {
+		return true
+	}
+	return false
+}
+
+func (a *Aggregator) recordDroppedLocked(key string) {
+	if len(a.dropped) < maxTrackedDropped {
+		a.dropped[key] = struct{}{}
+	}
+}
+
+// removeLocked deletes a series and keeps the per-metric counts in sync.
+func (a *Aggregator) removeLocked(key string, entry *series) {
+	delete(a.metrics, key)
+	mk := metricKey(entry.namespace, entry.name)
+	if a.perMetric[mk] <= 1 {
+		delete(a.perMetric, mk)
+	} else {
+		a.perMetric[mk]--
+	}
+}
+
+// Cardinality reports current series counts and limit counters.
+func (a *Aggregator) Cardinality() CardinalityStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	perMetric := make(map[string]int, len(a.perMetric))
+	for k, v := range a.perMetric {
+		perMetric[k] = v
+	}
+	return CardinalityStats{
+		Series:             len(a.metrics),
+		MaxSeries:          a.cfg.MaxSeries,
+		MaxSeriesPerMetric: a.cfg.MaxSeriesPerMetric,
+		Overflow:           a.cfg.Overflow,
+		PerMetric:          perMetric,
+		RejectedSamples:    a.rejectedSamples,
+		OverflowSamples:    a.overflowSamples,
+		DroppedSeries:      len(a.dropped),
+	}
+}
+
+func metricKey(namespace, name string) string {
+	return namespace + "." + name
 }
 
 // Snapshot returns a copy of the current summaries keyed by metric
@@ -72,11 +428,106 @@ func (a *Aggregator) Snapshot() map[string]Summary {
 
 	clone := make(map[string]Summary, len(a.metrics))
 	for k, v := range a.metrics {
-		clone[k] = v
+		clone[k] = v.summary.clone()
 	}
 	return clone
 }
 
+// Delete removes every series selected by q (aggregation settings are
+// ignored) and returns the number of series removed.
+func (a *Aggregator) Delete(q Query) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	removed := 0
+	for key, entry := range a.metrics {
+		if q.selects(entry) {
+			a.removeLocked(key, entry)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Reset clears the statistics of every series selected by q while keeping
+// the series registered, and returns the number of series reset.
+func (a *Aggregator) Reset(q Query) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	reset := 0
+	for _, entry := range a.metrics {
+		if q.selects(entry) {
+			entry.summary = Summary{Type: entry.summary.Type}
+			entry.local, entry.peers = nil, nil
+			entry.windows = nil
+			reset++
+		}
+	}
+	return reset
+}
+
+// Expire removes every series that has been idle for longer than the
+// configured TTL relative to now and returns the number of series removed.
+// It is a no-op when expiry is disabled.
+func (a *Aggregator) Expire(now time.Time) int {
+	if a.cfg.IdleTTL <= 0 {
+		return 0
+	}
+	cutoff := now.Add(-a.cfg.IdleTTL)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	removed := 0
+	for key, entry := range a.metrics {
+		if entry.touched.Before(cutoff) {
+			a.removeLocked(key, entry)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Start launches the background sweeper that expires idle series. It does
+// nothing when expiry is disabled.
+func (a *Aggregator) Start() {
+	if a.cfg.IdleTTL <= 0 {
+		return
+	}
+	a.startOnce.Do(func() {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			ticker := time.NewTicker(a.cfg.SweepInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-a.stop:
+					return
+				case <-ticker.C:
+					a.Expire(a.now())
+				}
+			}
+		}()
+	})
+}
+
+// Stop terminates the background sweeper and waits for it to exit.
+func (a *Aggregator) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+		a.wg.Wait()
+	})
+}
+
+func cloneLabels(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
 func eventKey(event MetricEvent) string {
 	var b strings.Builder
 	b.WriteString(event.Namespace)
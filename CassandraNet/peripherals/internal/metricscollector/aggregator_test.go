@@ -50,3 +50,118 @@ func TestAggregatorIngestAndSnapshot(t *testing.T) {
 		t.Fatal("expected last timestamp to be set")
 	}
 }
+
+func TestAggregatorExpiresIdleSeries(t *testing.T) {
+	agg := NewAggregatorWithConfig(AggregatorConfig{IdleTTL: time.Minute})
+	now := time.Unix(1_700_000_000, 0)
+	agg.now = func() time.Time { return now }
+
+	agg.Ingest(MetricEvent{Namespace: "match", Name: "score", Value: 1, Labels: map[string]string{"match_id": "a"}})
+	now = now.Add(45 * time.Second)
+	agg.Ingest(MetricEvent{Namespace: "match", Name: "score", Value: 1, Labels: map[string]string{"match_id": "b"}})
+
+	if removed := agg.Expire(now.Add(30 * time.Second)); removed != 1 {
+		t.Fatalf("expected 1 expired series, got %d", removed)
+	}
+	snapshot := agg.Snapshot()
+	if _, ok := snapshot["match.score{match_id=b}"]; !ok || len(snapshot) != 1 {
+		t.Fatalf("expected only match b to remain, got %+v", snapshot)
+	}
+}
+
+func TestAggregatorCardinalityLimits(t *testing.T) {
+	reject := NewAggregatorWithConfig(AggregatorConfig{MaxSeriesPerMetric: 2})
+	for _, id := range []string{"a", "b"} {
+		if _, err := reject.Ingest(MetricEvent{Namespace: "match", Name: "score", Labels: map[string]string{"match_id": id}}); err != nil {
+			t.Fatalf("unexpected ingest error: %v", err)
+		}
+	}
+	if _, err := reject.Ingest(MetricEvent{Namespace: "match", Name: "score", Labels: map[string]string{"match_id": "c"}}); err != ErrCardinalityLimit {
+		t.Fatalf("expected ErrCardinalityLimit, got %v", err)
+	}
+	if _, err := reject.Ingest(MetricEvent{Namespace: "match", Name: "score", Labels: map[string]string{"match_id": "a"}}); err != nil {
+		t.Fatalf("existing series should still accept samples: %v", err)
+	}
+	if stats := reject.Cardinality(); stats.RejectedSamples != 1 || stats.DroppedSeries != 1 || stats.PerMetric["match.score"] != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	overflow := NewAggregatorWithConfig(AggregatorConfig{MaxSeries: 1, Overflow: OverflowAggregate})
+	overflow.Ingest(MetricEvent{Namespace: "match", Name: "score", Value: 1, Labels: map[string]string{"match_id": "a"}})
+	overflow.Ingest(MetricEvent{Namespace: "match", Name: "score", Value: 2, Labels: map[string]string{"match_id": "b"}})
+	overflow.Ingest(MetricEvent{Namespace: "match", Name: "score", Value: 3, Labels: map[string]string{"match_id": "c"}})
+	other := overflow.Snapshot()["match.score{overflow=other}"]
+	if other.Count != 2 || other.Sum != 5 {
+		t.Fatalf("expected overflow bucket to aggregate 2 samples, got %+v", other)
+	}
+	if stats := overflow.Cardinality(); stats.OverflowSamples != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAggregatorTopKAndHeatmap(t *testing.T) {
+	agg := NewAggregatorWithConfig(AggregatorConfig{
+		HistogramBuckets: []float64{10, 100},
+		WindowSize:       time.Minute,
+		WindowCount:      10,
+	})
+	now := time.Unix(1_700_000_040, 0)
+	agg.now = func() time.Time { return now }
+
+	ingest := func(route string, values ...float64) {
+		for _, v := range values {
+			agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: v, Labels: map[string]string{"route": route}})
+		}
+	}
+	ingest("/old", 500, 500)
+	now = now.Add(5 * time.Minute)
+	ingest("/a", 5, 50)
+	ingest("/b", 200)
+
+	top := agg.TopK(Query{Name: "latency"}, 2, RankByValue, time.Minute)
+	if len(top) != 2 || top[0].Labels["route"] != "/b" || top[1].Labels["route"] != "/a" {
+		t.Fatalf("unexpected top-k over last minute: %+v", top)
+	}
+	top = agg.TopK(Query{Name: "latency"}, 1, RankByRate, 10*time.Minute)
+	if len(top) != 1 || top[0].Labels["route"] != "/old" || top[0].Score != 1000.0/600 {
+		t.Fatalf("unexpected top-k by rate: %+v", top)
+	}
+
+	heatmap := agg.Heatmap(Query{Name: "latency"}, 6*time.Minute, 3*time.Minute)
+	if len(heatmap.Slots) != 2 || heatmap.Series != 3 {
+		t.Fatalf("unexpected heatmap shape: %+v", heatmap)
+	}
+	if got := heatmap.Slots[0].Counts; got[2] != 2 {
+		t.Fatalf("expected old samples in first slot overflow bucket, got %v", got)
+	}
+	if got := heatmap.Slots[1].Counts; got[0] != 1 || got[1] != 1 || got[2] != 1 {
+		t.Fatalf("unexpected latest slot counts: %v", got)
+	}
+}
+
+func TestAggregatorCompactsIdleWindows(t *testing.T) {
+	agg := NewAggregatorWithConfig(AggregatorConfig{WindowSize: time.Minute, WindowCount: 10})
+	now := time.Unix(1_700_000_040, 0)
+	agg.now = func() time.Time { return now }
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "requests", Type: MetricTypeCounter, Value: 1, Labels: map[string]string{"route": "/old"}})
+	now = now.Add(5 * time.Minute)
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "requests", Type: MetricTypeCounter, Value: 1, Labels: map[string]string{"route": "/new"}})
+
+	cutoff := now.Add(-3 * time.Minute)
+	if n := agg.CompactWindows(cutoff, true); n != 1 {
+		t.Fatalf("dry run: expected one ring, got %d", n)
+	}
+	if n := agg.CompactWindows(cutoff, false); n != 1 {
+		t.Fatalf("expected one ring released, got %d", n)
+	}
+	if n := agg.CompactWindows(cutoff, false); n != 0 {
+		t.Fatalf("expected nothing left to release, got %d", n)
+	}
+	top := agg.TopK(Query{Name: "requests"}, 2, RankByValue, 10*time.Minute)
+	if len(top) != 1 || top[0].Labels["route"] != "/new" {
+		t.Fatalf("expected only /new to keep windows, got %+v", top)
+	}
+	if len(agg.Query(Query{Name: "requests"})) != 2 {
+		t.Fatal("expected both summaries to be kept")
+	}
+}
@@ -0,0 +1,523 @@
+package metricscollector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notifyclient"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Comparator is the relational operator applied between a value and a
+// rule threshold.
+type Comparator string
+
+const (
+	CompareGreater      Comparator = ">"
+	CompareGreaterEqual Comparator = ">="
+	CompareLess         Comparator = "<"
+	CompareLessEqual    Comparator = "<="
+	CompareEqual        Comparator = "=="
+	CompareNotEqual     Comparator = "!="
+)
+
+func (c Comparator) compare(value, threshold float64) (bool, error) {
+	switch c {
+	case CompareGreater:
+		return value > threshold, nil
+	case CompareGreaterEqual:
+		return value >= threshold, nil
+	case CompareLess:
+		return value < threshold, nil
+	case CompareLessEqual:
+		return value <= threshold, nil
+	case CompareEqual:
+		return value == threshold, nil
+	case CompareNotEqual:
+		return value != threshold, nil
+	default:
+		return false, fmt.Errorf("unknown comparator %q", c)
+	}
+}
+
+// AlertRule describes a threshold condition evaluated against query results.
+// Each matching series (or aggregated group) produces its own alert.
+type AlertRule struct {
+	Name      string   `json:"name"`
+	Namespace string   `json:"namespace,omitempty"`
+	Metric    string   `json:"metric"`
+	Match     []string `json:"match,omitempty"`
+	Aggregate string   `json:"aggregate,omitempty"`
+	By        []string `json:"by,omitempty"`
+	// Field selects the summary statistic compared with the threshold: one of
+	// mean, min, max, sum, count, or value (the aggregated value). Defaults
+	// to value for aggregated rules and mean otherwise.
+	Field      string     `json:"field,omitempty"`
+	Comparator Comparator `json:"comparator"`
+	Threshold  float64    `json:"threshold"`
+	// ForSeconds is how long the condition must hold before the alert fires.
+	ForSeconds float64 `json:"for_seconds,omitempty"`
+}
+
+func (r AlertRule) query() (Query, error) {
+	var v validation.Validator
+	v.String("name", r.Name).Required().MaxLength(validation.MaxIDLength)
+	v.String("metric", r.Metric).Required()
+	v.String("comparator", string(r.Comparator)).Required().OneOf(">", ">=", "<", "<=", "==", "!=")
+	v.String("field", r.Field).OneOf("value", "mean", "min", "max", "sum", "count")
+	v.Check(r.ForSeconds >= 0, "for_seconds", validation.RuleRange, "must not be negative")
+	if err := v.Err(); err != nil {
+		return Query{}, err
+	}
+	q := Query{Namespace: r.Namespace, Name: r.Metric, By: r.By}
+	for _, expr := range r.Match {
+		matcher, err := ParseLabelMatcher(expr)
+		if err != nil {
+			return Query{}, err
+		}
+		q.Matchers = append(q.Matchers, matcher)
+	}
+	op, err := ParseAggregateOp(r.Aggregate)
+	if err != nil {
+		return Query{}, err
+	}
+	q.Aggregate = op
+	return q, nil
+}
+
+func (r AlertRule) value(res SeriesResult) (float64, error) {
+	field := r.Field
+	if field == "" {
+		field = "mean"
+		if r.Aggregate != "" {
+			field = "value"
+		}
+	}
+	switch field {
+	case "value":
+		return res.Value, nil
+	case "mean":
+		return res.Summary.Mean, nil
+	case "min":
+		return res.Summary.Min, nil
+	case "max":
+		return res.Summary.Max, nil
+	case "sum":
+		return res.Summary.Sum, nil
+	case "count":
+		return float64(res.Summary.Count), nil
+	default:
+		return 0, fmt.Errorf("unknown alert field %q", field)
+	}
+}
+
+// AlertState is the lifecycle position of an alert.
+type AlertState string
+
+const (
+	AlertPending  AlertState = "pending"
+	AlertFiring   AlertState = "firing"
+	AlertResolved AlertState = "resolved"
+)
+
+// Alert is an active (pending or firing) rule instance for one series.
+type Alert struct {
+	Rule        string            `json:"rule"`
+	Metric      string            `json:"metric"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	State       AlertState        `json:"state"`
+	Value       float64           `json:"value"`
+	Comparator  Comparator        `json:"comparator"`
+	Threshold   float64           `json:"threshold"`
+	ActiveSince time.Time         `json:"active_since"`
+	FiredAt     time.Time         `json:"fired_at,omitempty"`
+	Silenced    bool              `json:"silenced"`
+}
+
+// Silence suppresses notifications for a rule until it expires. An empty
+// Match list silences every alert of the rule.
+type Silence struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`
+	Match     []string  `json:"match,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	matchers []LabelMatcher
+}
+
+func (s Silence) covers(alert Alert, now time.Time) bool {
+	if s.Rule != alert.Rule || !now.Before(s.ExpiresAt) {
+		return false
+	}
+	for _, m := range s.matchers {
+		if !m.Matches(alert.Labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertNotifier delivers alert state changes.
+type AlertNotifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// NewNotificationClient returns a client sending alerts to the
+// notification service at baseURL through transport, delivered to
+// recipient over channel with the metric_alert template.
+func NewNotificationClient(baseURL, channel, recipient string, transport http.RoundTripper) (*notifyclient.Client[Alert], error) {
+	return notifyclient.New(baseURL, transport, func(alert Alert) notifyclient.Notification {
+		return notifyclient.Notification{Channel: channel, Recipient: recipient, Template: "metric_alert", Data: map[string]any{
+			"Rule":       alert.Rule,
+			"State":      string(alert.State),
+			"Metric":     alert.Metric,
+			"Labels":     alert.Labels,
+			"Value":      alert.Value,
+			"Comparator": string(alert.Comparator),
+			"Threshold":  alert.Threshold,
+		}}
+	})
+}
+
+type compiledRule struct {
+	rule  AlertRule
+	query Query
+}
+
+// AdminTopic is the admin channel topic carrying alerts as they fire and
+// resolve.
+const AdminTopic = "alerts"
+
+// AlertManager continuously evaluates alert rules against the aggregator.
+type AlertManager struct {
+	agg      *Aggregator
+	notifier AlertNotifier
+	interval time.Duration
+	logger   interface {
+		Printf(string, ...any)
+	}
+	now func() time.Time
+
+	mu       sync.RWMutex
+	rules    map[string]compiledRule
+	alerts   map[string]*Alert
+	silences map[string]Silence
+	audit    *audit.Log
+	admin    *adminchannel.Channel
+	active   func() bool
+
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewAlertManager constructs an AlertManager. notifier may be nil, in which
+// case state changes are only logged.
+func NewAlertManager(agg *Aggregator, notifier AlertNotifier, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *AlertManager {
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	return &AlertManager{
+		agg:      agg,
+		notifier: notifier,
+		interval: interval,
+		logger:   logger,
+		now:      func() time.Time { return time.Now().UTC() },
+		rules:    make(map[string]compiledRule),
+		alerts:   make(map[string]*Alert),
+		silences: make(map[string]Silence),
+	}
+}
+
+// SetAudit records rule and silence changes made through Handler in log.
+// Call it before the manager handles requests.
+func (m *AlertManager) SetAudit(log *audit.Log) {
+	m.audit = log
+}
+
+// SetAdminChannel publishes each alert that fires or resolves, unless
+// silenced, to ch under AdminTopic, for callers with metrics.read. Call it
+// before the manager starts.
+func (m *AlertManager) SetAdminChannel(ch *adminchannel.Channel) {
+	ch.Register(AdminTopic, auth.PermMetricsRead)
+	m.admin = ch
+}
+
+// SetActive makes the manager send notifications only while active
+// reports true, such as Pairing.Active. Rules are still evaluated, so a
+// manager that becomes active does not notify again of alerts already
+// firing. Call it before the manager starts.
+func (m *AlertManager) SetActive(active func() bool) {
+	m.active = active
+}
+
+// LoadRulesFile reads a JSON array of rules from path and registers them.
+func (m *AlertManager) LoadRulesFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read alert rules: %w", err)
+	}
+	var rules []AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("decode alert rules: %w", err)
+	}
+	for _, rule := range rules {
+		if err := m.PutRule(rule); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// PutRule validates and registers (or replaces) a rule.
+func (m *AlertManager) PutRule(rule AlertRule) error {
+	q, err := rule.query()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules[rule.Name] = compiledRule{rule: rule, query: q}
+	return nil
+}
+
+// DeleteRule removes a rule and any alerts it produced, returning the rule.
+func (m *AlertManager) DeleteRule(name string) (AlertRule, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	compiled, ok := m.rules[name]
+	if !ok {
+		return AlertRule{}, false
+	}
+	delete(m.rules, name)
+	for key, alert := range m.alerts {
+		if alert.Rule == name {
+			delete(m.alerts, key)
+		}
+	}
+	return compiled.rule, true
+}
+
+// Rule returns the rule called name.
+func (m *AlertManager) Rule(name string) (AlertRule, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	compiled, ok := m.rules[name]
+	return compiled.rule, ok
+}
+
+// Rules lists registered rules ordered by name.
+func (m *AlertManager) Rules() []AlertRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]AlertRule, 0, len(m.rules))
+	for _, compiled := range m.rules {
+		out = append(out, compiled.rule)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Alerts lists pending and firing alerts ordered by rule and labels.
+func (m *AlertManager) Alerts() []Alert {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := m.now()
+	out := make([]Alert, 0, len(m.alerts))
+	for _, alert := range m.alerts {
+		copy := *alert
+		copy.Labels = cloneLabels(alert.Labels)
+		copy.Silenced = m.silencedLocked(copy, now)
+		out = append(out, copy)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rule != out[j].Rule {
+			return out[i].Rule < out[j].Rule
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	return out
+}
+
+// AddSilence registers a silence lasting for the given duration.
+func (m *AlertManager) AddSilence(rule string, match []string, duration time.Duration, comment string) (Silence, error) {
+	var v validation.Validator
+	v.String("rule", rule).Required()
+	v.Check(duration > 0, "duration_seconds", validation.RuleRange, "must be positive")
+	v.String("comment", comment).MaxLength(validation.MaxValueLength)
+	if err := v.Err(); err != nil {
+		return Silence{}, err
+	}
+	silence := Silence{Rule: rule, Match: match, Comment: comment}
+	for _, expr := range match {
+		matcher, err := ParseLabelMatcher(expr)
+		if err != nil {
+			return Silence{}, err
+		}
+		silence.matchers = append(silence.matchers, matcher)
+	}
+	now := m.now()
+	silence.ID = id.New(id.PrefixSilence)
+	silence.CreatedAt = now
+	silence.ExpiresAt = now.Add(duration)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.silences[silence.ID] = silence
+	return silence, nil
+}
+
+// DeleteSilence expires a silence immediately, returning it.
+func (m *AlertManager) DeleteSilence(id string) (Silence, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	silence, ok := m.silences[id]
+	if !ok {
+		return Silence{}, false
+	}
+	delete(m.silences, id)
+	return silence, true
+}
+
+// Silences lists silences that have not yet expired.
+func (m *AlertManager) Silences() []Silence {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := m.now()
+	out := make([]Silence, 0, len(m.silences))
+	for _, silence := range m.silences {
+		if now.Before(silence.ExpiresAt) {
+			out = append(out, silence)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+func (m *AlertManager) silencedLocked(alert Alert, now time.Time) bool {
+	for _, silence := range m.silences {
+		if silence.covers(alert, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate runs every rule once and dispatches notifications for alerts
+// that started firing or resolved.
+func (m *AlertManager) Evaluate(ctx context.Context) {
+	now := m.now()
+	var notify []Alert
+
+	m.mu.Lock()
+	for id, silence := range m.silences {
+		if !now.Before(silence.ExpiresAt) {
+			delete(m.silences, id)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, compiled := range m.rules {
+		rule := compiled.rule
+		for _, res := range m.agg.Query(compiled.query) {
+			value, _ := rule.value(res)
+			active, _ := rule.Comparator.compare(value, rule.Threshold)
+			metric := resultKey(res)
+			key := rule.Name + "|" + metric
+			alert, exists := m.alerts[key]
+			if !active {
+				continue
+			}
+			seen[key] = true
+			if !exists {
+				alert = &Alert{
+					Rule:        rule.Name,
+					Metric:      metric,
+					Labels:      cloneLabels(res.Labels),
+					State:       AlertPending,
+					Comparator:  rule.Comparator,
+					Threshold:   rule.Threshold,
+					ActiveSince: now,
+				}
+				m.alerts[key] = alert
+			}
+			alert.Value = value
+			holdFor := time.Duration(rule.ForSeconds * float64(time.Second))
+			if alert.State == AlertPending && now.Sub(alert.ActiveSince) >= holdFor {
+				alert.State = AlertFiring
+				alert.FiredAt = now
+				if !m.silencedLocked(*alert, now) {
+					notify = append(notify, *alert)
+				}
+			}
+		}
+	}
+	for key, alert := range m.alerts {
+		if seen[key] {
+			continue
+		}
+		if alert.State == AlertFiring && !m.silencedLocked(*alert, now) {
+			resolved := *alert
+			resolved.State = AlertResolved
+			notify = append(notify, resolved)
+		}
+		delete(m.alerts, key)
+	}
+	m.mu.Unlock()
+
+	for _, alert := range notify {
+		m.logger.Printf("alert %s %s for %s (value=%.2f)", alert.Rule, alert.State, alert.Metric, alert.Value)
+		m.admin.Publish(AdminTopic, "", "", alert)
+		if m.notifier == nil || (m.active != nil && !m.active()) {
+			continue
+		}
+		if err := m.notifier.Notify(ctx, alert); err != nil {
+			m.logger.Printf("alert notification for %s failed: %v", alert.Rule, err)
+		}
+	}
+}
+
+// Start launches the periodic evaluation loop.
+func (m *AlertManager) Start() {
+	m.startOnce.Do(func() {
+		m.stop = make(chan struct{})
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			ticker := time.NewTicker(m.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-m.stop:
+					return
+				case <-ticker.C:
+					m.Evaluate(context.Background())
+				}
+			}
+		}()
+	})
+}
+
+// Stop terminates the evaluation loop.
+func (m *AlertManager) Stop() {
+	m.stopOnce.Do(func() {
+		if m.stop == nil {
+			return
+		}
+		close(m.stop)
+		m.wg.Wait()
+	})
+}
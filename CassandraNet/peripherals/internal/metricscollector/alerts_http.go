@@ -0,0 +1,164 @@
+package metricscollector
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const (
+	alertsPath         = "/alerts"
+	alertRulesPrefix   = "/alerts/rules/"
+	alertSilencePrefix = "/alerts/silences/"
+)
+
+// Handler exposes alert state, rule management, and silencing endpoints.
+func (m *AlertManager) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(alertsPath, m.handleAlerts)
+	mux.HandleFunc("/alerts/rules", m.handleRules)
+	mux.HandleFunc(alertRulesPrefix, m.handleRuleByName)
+	mux.HandleFunc("/alerts/silences", m.handleSilences)
+	mux.HandleFunc(alertSilencePrefix, m.handleSilenceByID)
+	return mux
+}
+
+func (m *AlertManager) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	alerts := m.Alerts()
+	if state := r.URL.Query().Get("state"); state != "" {
+		filtered := alerts[:0]
+		for _, alert := range alerts {
+			if string(alert.State) == state {
+				filtered = append(filtered, alert)
+			}
+		}
+		alerts = filtered
+	}
+	writeAlertJSON(w, http.StatusOK, alerts)
+}
+
+func (m *AlertManager) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAlertJSON(w, http.StatusOK, m.Rules())
+	case http.MethodPost:
+		defer r.Body.Close()
+		var rule AlertRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
+			return
+		}
+		var before any
+		if previous, ok := m.Rule(rule.Name); ok {
+			before = previous
+		}
+		if err := m.PutRule(rule); err != nil {
+			invalidRequest(w, r, err)
+			return
+		}
+		m.audit.Record(r.Context(), audit.Change{
+			Action:   "metrics.alert_rule.put",
+			Resource: "alerts/rules/" + rule.Name,
+			Before:   before,
+			After:    rule,
+		})
+		writeAlertJSON(w, http.StatusCreated, rule)
+	default:
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet, http.MethodPost)
+	}
+}
+
+func (m *AlertManager) handleRuleByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, alertRulesPrefix)
+	if name == "" || strings.Contains(name, "/") {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodDelete)
+		return
+	}
+	rule, ok := m.DeleteRule(name)
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "alert rule not found")
+		return
+	}
+	m.audit.Record(r.Context(), audit.Change{
+		Action:   "metrics.alert_rule.delete",
+		Resource: "alerts/rules/" + name,
+		Before:   rule,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type silencePayload struct {
+	Rule            string   `json:"rule"`
+	Match           []string `json:"match"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Comment         string   `json:"comment"`
+}
+
+func (m *AlertManager) handleSilences(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAlertJSON(w, http.StatusOK, m.Silences())
+	case http.MethodPost:
+		defer r.Body.Close()
+		var payload silencePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
+			return
+		}
+		duration := time.Duration(payload.DurationSeconds * float64(time.Second))
+		silence, err := m.AddSilence(payload.Rule, payload.Match, duration, payload.Comment)
+		if err != nil {
+			invalidRequest(w, r, err)
+			return
+		}
+		m.audit.Record(r.Context(), audit.Change{
+			Action:   "metrics.silence.add",
+			Resource: "alerts/silences/" + silence.ID,
+			After:    silence,
+		})
+		writeAlertJSON(w, http.StatusCreated, silence)
+	default:
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet, http.MethodPost)
+	}
+}
+
+func (m *AlertManager) handleSilenceByID(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, alertSilencePrefix)
+	if id == "" || strings.Contains(id, "/") {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		return
+	}
+	if r.Method != http.MethodDelete {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodDelete)
+		return
+	}
+	silence, ok := m.DeleteSilence(id)
+	if !ok {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "silence not found")
+		return
+	}
+	m.audit.Record(r.Context(), audit.Change{
+		Action:   "metrics.silence.delete",
+		Resource: "alerts/silences/" + id,
+		Before:   silence,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeAlertJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
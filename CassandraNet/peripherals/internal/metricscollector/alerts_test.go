@@ -0,0 +1,77 @@
+package metricscollector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (r *recordingNotifier) Notify(_ context.Context, alert Alert) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, alert)
+	return nil
+}
+
+func TestAlertManagerLifecycle(t *testing.T) {
+	agg := NewAggregator()
+	notifier := &recordingNotifier{}
+	manager := NewAlertManager(agg, notifier, time.Second, testLogger{})
+	now := time.Unix(1_700_000_000, 0).UTC()
+	manager.now = func() time.Time { return now }
+
+	if err := manager.PutRule(AlertRule{
+		Name:       "slow",
+		Namespace:  "api",
+		Metric:     "latency",
+		Field:      "max",
+		Comparator: CompareGreater,
+		Threshold:  100,
+		ForSeconds: 30,
+	}); err != nil {
+		t.Fatalf("put rule failed: %v", err)
+	}
+
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Value: 150, Labels: map[string]string{"route": "/a"}})
+	manager.Evaluate(context.Background())
+	if alerts := manager.Alerts(); len(alerts) != 1 || alerts[0].State != AlertPending {
+		t.Fatalf("expected pending alert, got %+v", alerts)
+	}
+
+	now = now.Add(31 * time.Second)
+	manager.Evaluate(context.Background())
+	if alerts := manager.Alerts(); len(alerts) != 1 || alerts[0].State != AlertFiring {
+		t.Fatalf("expected firing alert, got %+v", alerts)
+	}
+	if len(notifier.alerts) != 1 || notifier.alerts[0].State != AlertFiring {
+		t.Fatalf("expected firing notification, got %+v", notifier.alerts)
+	}
+
+	if _, err := manager.AddSilence("slow", []string{"route=/a"}, time.Hour, "investigating"); err != nil {
+		t.Fatalf("add silence failed: %v", err)
+	}
+	if alerts := manager.Alerts(); !alerts[0].Silenced {
+		t.Fatalf("expected alert to be silenced, got %+v", alerts[0])
+	}
+
+	manager.DeleteRule("slow")
+	if alerts := manager.Alerts(); len(alerts) != 0 {
+		t.Fatalf("expected alerts cleared with rule, got %+v", alerts)
+	}
+}
+
+func TestAlertRuleValidation(t *testing.T) {
+	manager := NewAlertManager(NewAggregator(), nil, 0, testLogger{})
+	if err := manager.PutRule(AlertRule{Name: "bad", Metric: "m", Comparator: "~"}); err == nil {
+		t.Fatal("expected comparator validation error")
+	}
+	if err := manager.PutRule(AlertRule{Name: "bad", Metric: "m", Comparator: ">", Field: "p99"}); err == nil {
+		t.Fatal("expected field validation error")
+	}
+}
@@ -0,0 +1,280 @@
+package metricscollector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphiteMapping translates a dot-separated Graphite path into a metric
+// identity. Match is a dot pattern where `*` matches exactly one path
+// segment; captured segments may be referenced as $1, $2, ... in Namespace,
+// Name, and label values.
+type GraphiteMapping struct {
+	Match     string            `json:"match"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Type      MetricType        `json:"type,omitempty"`
+
+	segments []string
+}
+
+// GraphiteMapper resolves Graphite paths using an ordered list of mappings.
+// Paths that match no mapping fall back to the first segment as namespace
+// and the remaining segments joined with underscores as name.
+type GraphiteMapper struct {
+	mappings []GraphiteMapping
+}
+
+// NewGraphiteMapper validates the mappings and returns a mapper.
+func NewGraphiteMapper(mappings []GraphiteMapping) (*GraphiteMapper, error) {
+	compiled := make([]GraphiteMapping, 0, len(mappings))
+	for _, m := range mappings {
+		if m.Match == "" || m.Name == "" {
+			return nil, errors.New("graphite mapping requires match and name")
+		}
+		if m.Type != "" {
+			parsed, err := ParseMetricType(string(m.Type))
+			if err != nil {
+				return nil, fmt.Errorf("graphite mapping %s: %w", m.Match, err)
+			}
+			m.Type = parsed
+		}
+		m.segments = strings.Split(m.Match, ".")
+		compiled = append(compiled, m)
+	}
+	return &GraphiteMapper{mappings: compiled}, nil
+}
+
+// LoadGraphiteMappings reads a JSON array of mappings from path.
+func LoadGraphiteMappings(path string) (*GraphiteMapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read graphite mappings: %w", err)
+	}
+	var mappings []GraphiteMapping
+	if err := json.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("decode graphite mappings: %w", err)
+	}
+	return NewGraphiteMapper(mappings)
+}
+
+// Map converts a Graphite path into an event skeleton (without value or
+// timestamp).
+func (g *GraphiteMapper) Map(path string) (MetricEvent, bool) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return MetricEvent{}, false
+		}
+	}
+	if g != nil {
+		for _, m := range g.mappings {
+			captures, ok := matchGraphite(m.segments, segments)
+			if !ok {
+				continue
+			}
+			event := MetricEvent{
+				Namespace: expandCaptures(m.Namespace, captures),
+				Name:      expandCaptures(m.Name, captures),
+				Type:      m.Type,
+			}
+			if event.Namespace == "" {
+				event.Namespace = "graphite"
+			}
+			if len(m.Labels) > 0 {
+				event.Labels = make(map[string]string, len(m.Labels))
+				for k, v := range m.Labels {
+					event.Labels[k] = expandCaptures(v, captures)
+				}
+			}
+			return event, true
+		}
+	}
+	if len(segments) < 2 {
+		return MetricEvent{Namespace: "graphite", Name: segments[0]}, true
+	}
+	return MetricEvent{Namespace: segments[0], Name: strings.Join(segments[1:], "_")}, true
+}
+
+func matchGraphite(pattern, segments []string) ([]string, bool) {
+	if len(pattern) != len(segments) {
+		return nil, false
+	}
+	var captures []string
+	for i, p := range pattern {
+		switch p {
+		case "*":
+			captures = append(captures, segments[i])
+		default:
+			if p != segments[i] {
+				return nil, false
+			}
+		}
+	}
+	return captures, true
+}
+
+func expandCaptures(template string, captures []string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	// Replace higher indexes first so $10 is not consumed by $1.
+	for i := len(captures); i >= 1; i-- {
+		template = strings.ReplaceAll(template, "$"+strconv.Itoa(i), captures[i-1])
+	}
+	return template
+}
+
+// ParseGraphiteLine parses `path value [timestamp]`. A missing or negative
+// timestamp (Graphite clients send -1 to mean "now") uses now.
+func ParseGraphiteLine(line string, now time.Time) (string, float64, time.Time, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return "", 0, time.Time{}, fmt.Errorf("invalid graphite line %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return "", 0, time.Time{}, fmt.Errorf("invalid graphite value %q", fields[1])
+	}
+	ts := now
+	if len(fields) == 3 {
+		seconds, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return "", 0, time.Time{}, fmt.Errorf("invalid graphite timestamp %q", fields[2])
+		}
+		if seconds > 0 {
+			ts = time.Unix(0, int64(seconds*float64(time.Second))).UTC()
+		}
+	}
+	return fields[0], value, ts, nil
+}
+
+// GraphiteListener accepts the Graphite plaintext protocol over TCP and
+// feeds samples into an aggregator.
+type GraphiteListener struct {
+	agg    *Aggregator
+	mapper *GraphiteMapper
+	logger interface {
+		Printf(string, ...any)
+	}
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewGraphiteListener constructs a listener. mapper may be nil to use only
+// the default path mapping.
+func NewGraphiteListener(agg *Aggregator, mapper *GraphiteMapper, logger interface {
+	Printf(string, ...any)
+}) *GraphiteListener {
+	return &GraphiteListener{
+		agg:    agg,
+		mapper: mapper,
+		logger: logger,
+		conns:  make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on addr and serves until ctx is cancelled.
+func (g *GraphiteListener) ListenAndServe(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return g.Serve(ctx, ln)
+}
+
+// Serve accepts connections from ln until ctx is cancelled, then closes open
+// connections and waits for their handlers to return.
+func (g *GraphiteListener) Serve(ctx context.Context, ln net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ln.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			g.closeConns()
+			g.wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		g.mu.Lock()
+		g.conns[conn] = struct{}{}
+		g.mu.Unlock()
+		g.wg.Add(1)
+		go g.handleConn(conn)
+	}
+}
+
+func (g *GraphiteListener) closeConns() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for conn := range g.conns {
+		_ = conn.Close()
+	}
+}
+
+func (g *GraphiteListener) handleConn(conn net.Conn) {
+	defer g.wg.Done()
+	defer func() {
+		g.mu.Lock()
+		delete(g.conns, conn)
+		g.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	accepted, rejected := 0, 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := g.ingestLine(line); err != nil {
+			rejected++
+			continue
+		}
+		accepted++
+	}
+	if rejected > 0 {
+		g.logger.Printf("graphite connection from %s: %d accepted, %d rejected", conn.RemoteAddr(), accepted, rejected)
+	}
+}
+
+func (g *GraphiteListener) ingestLine(line string) error {
+	path, value, ts, err := ParseGraphiteLine(line, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	event, ok := g.mapper.Map(path)
+	if !ok {
+		return fmt.Errorf("invalid graphite path %q", path)
+	}
+	event.Value = value
+	event.Timestamp = ts
+	if event.Type == "" {
+		event.Type = MetricTypeGauge
+	}
+	_, err = g.agg.Ingest(event)
+	return err
+}
@@ -0,0 +1,70 @@
+package metricscollector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGraphiteMapper(t *testing.T) {
+	mapper, err := NewGraphiteMapper([]GraphiteMapping{{
+		Match:     "game.*.matches.*",
+		Namespace: "game",
+		Name:      "matches",
+		Labels:    map[string]string{"region": "$1", "mode": "$2"},
+		Type:      MetricTypeCounter,
+	}})
+	if err != nil {
+		t.Fatalf("mapper failed: %v", err)
+	}
+	event, ok := mapper.Map("game.eu.matches.ranked")
+	if !ok || event.Name != "matches" || event.Labels["region"] != "eu" || event.Labels["mode"] != "ranked" || event.Type != MetricTypeCounter {
+		t.Fatalf("unexpected mapped event: %+v", event)
+	}
+	event, ok = mapper.Map("legacy.cpu.load")
+	if !ok || event.Namespace != "legacy" || event.Name != "cpu_load" {
+		t.Fatalf("unexpected fallback event: %+v", event)
+	}
+	if _, ok := mapper.Map("broken..path"); ok {
+		t.Fatal("expected empty segment to be rejected")
+	}
+}
+
+func TestGraphiteListenerIngests(t *testing.T) {
+	agg := NewAggregator()
+	listener := NewGraphiteListener(agg, nil, testLogger{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- listener.Serve(ctx, ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	fmt.Fprintf(conn, "servers.web1.load 0.5 %d\nnot a metric\nservers.web1.load 1.5 -1\n", time.Now().Unix())
+	_ = conn.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for agg.Snapshot()["servers.web1_load{}"].Count < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for samples, got %v", agg.Snapshot())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serve returned error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listener did not stop")
+	}
+}
@@ -2,13 +2,25 @@ package metricscollector
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
+const metricsPrefix = "/metrics/"
+
 // Service wires HTTP handlers to the underlying aggregator.
 type Service struct {
 	agg    *Aggregator
+	extra  []Exposer
 	logger interface {
 		Printf(string, ...any)
 	}
@@ -25,8 +37,15 @@ func NewService(agg *Aggregator, logger interface {
 func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", s.handleHealth)
+	mux.HandleFunc("/metrics", s.handlePrometheus)
 	mux.HandleFunc("/metrics/ingest", s.handleIngest)
 	mux.HandleFunc("/metrics/summary", s.handleSummary)
+	mux.HandleFunc("/metrics/query", s.handleQuery)
+	mux.HandleFunc("/metrics/cardinality", s.handleCardinality)
+	mux.HandleFunc("/metrics/topk", s.handleTopK)
+	mux.HandleFunc("/metrics/heatmap", s.handleHeatmap)
+	mux.HandleFunc(metricsPrefix, s.handleMetricByName)
+	mux.HandleFunc(otlpMetricsPath, s.handleOTLP)
 	return mux
 }
 
@@ -37,25 +56,43 @@ func (s *Service) handleHealth(w http.ResponseWriter, _ *http.Request) {
 
 func (s *Service) handleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodPost)
 		return
 	}
 	defer r.Body.Close()
 
 	var payload MetricEvent
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
 		return
 	}
-	if payload.Namespace == "" || payload.Name == "" {
-		http.Error(w, "namespace and name required", http.StatusBadRequest)
+	var v validation.Validator
+	v.String("namespace", payload.Namespace).Required().MaxLength(validation.MaxIDLength)
+	v.String("name", payload.Name).Required().MaxLength(validation.MaxIDLength)
+	v.Map("labels", payload.Labels).Limited()
+	if err := v.Err(); err != nil {
+		invalidRequest(w, r, err)
 		return
 	}
+	metricType, err := ParseMetricType(string(payload.Type))
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	payload.Type = metricType
 	if payload.Timestamp.IsZero() {
 		payload.Timestamp = time.Now().UTC()
 	}
-	summary := s.agg.Ingest(payload)
-	s.logger.Printf("ingested metric %s.%s value=%.2f", payload.Namespace, payload.Name, payload.Value)
+	summary, err := s.agg.Ingest(payload)
+	if err != nil {
+		if errors.Is(err, ErrCardinalityLimit) {
+			problem.Write(w, r, http.StatusUnprocessableEntity, "metrics.series_limit", err.Error())
+			return
+		}
+		problem.Write(w, r, http.StatusInternalServerError, "metrics.ingest_failed", "failed to ingest metric")
+		return
+	}
+	logging.For(r.Context(), s.logger).Printf("ingested metric %s.%s value=%.2f", payload.Namespace, payload.Name, payload.Value)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -64,10 +101,214 @@ func (s *Service) handleIngest(w http.ResponseWriter, r *http.Request) {
 
 func (s *Service) handleSummary(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
 		return
 	}
 	snapshot := s.agg.Snapshot()
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(snapshot)
 }
+
+func (s *Service) handleCardinality(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.agg.Cardinality())
+}
+
+// handleMetricByName serves DELETE /metrics/{namespace}/{name} and
+// POST /metrics/{namespace}/{name}/reset. Both accept repeated match
+// parameters to scope the operation to a subset of label combinations.
+func (s *Service) handleMetricByName(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, metricsPrefix), "/")
+	if len(segments) < 2 || len(segments) > 3 || segments[0] == "" || segments[1] == "" {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		return
+	}
+	query := Query{Namespace: segments[0], Name: segments[1]}
+	for _, expr := range r.URL.Query()["match"] {
+		matcher, err := ParseLabelMatcher(expr)
+		if err != nil {
+			invalidRequest(w, r, err)
+			return
+		}
+		query.Matchers = append(query.Matchers, matcher)
+	}
+
+	var affected int
+	switch {
+	case len(segments) == 2:
+		if r.Method != http.MethodDelete {
+			problem.MethodNotAllowed(w, r, "metrics", http.MethodDelete)
+			return
+		}
+		affected = s.agg.Delete(query)
+		logging.For(r.Context(), s.logger).Printf("deleted %d series of %s.%s", affected, query.Namespace, query.Name)
+	case segments[2] == "reset":
+		if r.Method != http.MethodPost {
+			problem.MethodNotAllowed(w, r, "metrics", http.MethodPost)
+			return
+		}
+		affected = s.agg.Reset(query)
+		logging.For(r.Context(), s.logger).Printf("reset %d series of %s.%s", affected, query.Namespace, query.Name)
+	default:
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		return
+	}
+	if affected == 0 {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "no matching series")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"series": affected})
+}
+
+// handleQuery serves GET /metrics/query. Supported parameters:
+//
+//	namespace, name  exact metric selection (optional)
+//	match            repeated label matchers, e.g. match=route=~/v1/.*
+//	agg              sum or avg to aggregate matching series
+//	by               comma separated labels to keep when aggregating
+//	limit, cursor    page through the results, see internal/pagination
+func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	params := r.URL.Query()
+	query, err := parseSelector(params)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	op, err := ParseAggregateOp(params.Get("agg"))
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	query.Aggregate = op
+	if by := params.Get("by"); by != "" {
+		if op == AggregateNone {
+			invalidRequest(w, r, validation.Invalid("agg", validation.RuleRequired, "is required with by"))
+			return
+		}
+		for _, label := range strings.Split(by, ",") {
+			if label = strings.TrimSpace(label); label != "" {
+				query.By = append(query.By, label)
+			}
+		}
+	}
+
+	paged := pagination.Requested(r)
+	page, err := pagination.Parse(r, pagination.ListLimit(paged))
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	results, next := pagination.Slice(s.agg.Query(query), resultKey, page)
+	pagination.WriteList(w, r, results, next, paged)
+}
+
+// invalidRequest answers 400 with code metrics.invalid_request, listing the
+// failing fields when err names them.
+func invalidRequest(w http.ResponseWriter, r *http.Request, err error) {
+	if !validation.Write(w, r, "metrics.invalid_request", err) {
+		problem.Write(w, r, http.StatusBadRequest, "metrics.invalid_request", err.Error())
+	}
+}
+
+// parseSelector reads the namespace, name, and repeated match parameters
+// shared by the query endpoints.
+func parseSelector(params url.Values) (Query, error) {
+	query := Query{
+		Namespace: params.Get("namespace"),
+		Name:      params.Get("name"),
+	}
+	for _, expr := range params["match"] {
+		matcher, err := ParseLabelMatcher(expr)
+		if err != nil {
+			return Query{}, err
+		}
+		query.Matchers = append(query.Matchers, matcher)
+	}
+	return query, nil
+}
+
+// secondsParam parses an optional duration expressed in seconds.
+func secondsParam(params url.Values, key string, def time.Duration) (time.Duration, error) {
+	raw := params.Get(key)
+	if raw == "" {
+		return def, nil
+	}
+	seconds, err := strconv.ParseFloat(raw, 64)
+	if err != nil || seconds <= 0 {
+		return 0, validation.Invalid(key, validation.RuleRange, "must be a positive number of seconds")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// handleTopK serves GET /metrics/topk?name=latency&k=10&by=rate&window=300.
+func (s *Service) handleTopK(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	params := r.URL.Query()
+	query, err := parseSelector(params)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	k := 10
+	if raw := params.Get("k"); raw != "" {
+		k, err = strconv.Atoi(raw)
+		if err != nil || k <= 0 {
+			invalidRequest(w, r, validation.Invalid("k", validation.RuleRange, "must be a positive integer"))
+			return
+		}
+	}
+	by, err := ParseRankBy(params.Get("by"))
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	lookback, err := secondsParam(params, "window", 5*time.Minute)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.agg.TopK(query, k, by, lookback))
+}
+
+// handleHeatmap serves GET /metrics/heatmap?name=latency&window=3600&step=60.
+func (s *Service) handleHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	params := r.URL.Query()
+	query, err := parseSelector(params)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	if query.Name == "" {
+		invalidRequest(w, r, validation.Invalid("name", validation.RuleRequired, "is required"))
+		return
+	}
+	lookback, err := secondsParam(params, "window", time.Hour)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	step, err := secondsParam(params, "step", 0)
+	if err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.agg.Heatmap(query, lookback, step))
+}
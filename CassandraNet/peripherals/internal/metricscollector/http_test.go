@@ -7,6 +7,8 @@ import (
 	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
 )
 
 type testLogger struct{}
@@ -58,3 +60,112 @@ func TestServiceIngestAndSummary(t *testing.T) {
 		t.Fatalf("expected 1 summary, got %d", len(snapshot))
 	}
 }
+
+func TestServiceQueryWithMatchersAndAggregation(t *testing.T) {
+	agg := NewAggregator()
+	for _, sample := range []struct {
+		route, region string
+		value         float64
+	}{
+		{"/v1/login", "eu", 10},
+		{"/v1/login", "us", 30},
+		{"/v1/match", "eu", 50},
+		{"/v2/match", "eu", 70},
+	} {
+		agg.Ingest(MetricEvent{
+			Namespace: "api",
+			Name:      "latency",
+			Value:     sample.value,
+			Labels:    map[string]string{"route": sample.route, "region": sample.region},
+		})
+	}
+	svc := NewService(agg, testLogger{})
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	var results []SeriesResult
+	getJSON(t, server.URL+"/metrics/query?namespace=api&name=latency&match=route%3D~/v1/.*&match=region%3Deu", &results)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 matching series, got %+v", results)
+	}
+
+	getJSON(t, server.URL+"/metrics/query?name=latency&agg=avg&by=region", &results)
+	if len(results) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", results)
+	}
+	if eu := results[0]; eu.Labels["region"] != "eu" || eu.Series != 3 || eu.Value != 130.0/3 {
+		t.Fatalf("unexpected eu group: %+v", eu)
+	}
+
+	var first, second pagination.Page[SeriesResult]
+	getJSON(t, server.URL+"/metrics/query?name=latency&limit=3", &first)
+	if len(first.Items) != 3 || first.NextCursor == "" {
+		t.Fatalf("expected a full first page, got %+v", first)
+	}
+	getJSON(t, server.URL+"/metrics/query?name=latency&limit=3&cursor="+first.NextCursor, &second)
+	if len(second.Items) != 1 || second.NextCursor != "" || second.Items[0].Labels["region"] != "us" {
+		t.Fatalf("expected the last series on the second page, got %+v", second)
+	}
+
+	resp, err := http.Get(server.URL + "/metrics/query?match=route")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", resp.StatusCode)
+	}
+}
+
+func getJSON(t *testing.T, url string, out any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+}
+
+func TestServiceDeleteAndResetSeries(t *testing.T) {
+	agg := NewAggregator()
+	for _, route := range []string{"/a", "/b", "/debug"} {
+		agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Value: 5, Labels: map[string]string{"route": route}})
+	}
+	svc := NewService(agg, testLogger{})
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/metrics/api/latency?match=route%3D/debug", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+	if len(agg.Snapshot()) != 2 {
+		t.Fatalf("expected 2 remaining series, got %v", agg.Snapshot())
+	}
+
+	resp, err = http.Post(server.URL+"/metrics/api/latency/reset?match=route%3D/a", "application/json", nil)
+	if err != nil {
+		t.Fatalf("reset failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+	if summary := agg.Snapshot()["api.latency{route=/a}"]; summary.Count != 0 {
+		t.Fatalf("expected reset summary, got %+v", summary)
+	}
+	if summary, _ := agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Value: 9, Labels: map[string]string{"route": "/a"}}); summary.Min != 9 || summary.Count != 1 {
+		t.Fatalf("expected fresh statistics after reset, got %+v", summary)
+	}
+}
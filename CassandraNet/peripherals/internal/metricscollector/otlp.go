@@ -0,0 +1,320 @@
+package metricscollector
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// otlpMetricsPath is the standard OTLP/HTTP metrics export path.
+const otlpMetricsPath = "/v1/metrics"
+
+// The types below model the subset of the OTLP ExportMetricsServiceRequest
+// JSON encoding the collector understands. Field names follow the protobuf
+// JSON mapping (lowerCamelCase, 64-bit integers encoded as strings).
+
+type otlpExportRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Gauge     *otlpNumberSet `json:"gauge,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+	Summary   *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpNumberSet struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints  []otlpNumberDataPoint `json:"dataPoints"`
+	IsMonotonic bool                  `json:"isMonotonic"`
+}
+
+type otlpHistogram struct {
+	DataPoints []otlpHistogramDataPoint `json:"dataPoints"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpHistogramDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes"`
+	TimeUnixNano otlpInt64      `json:"timeUnixNano"`
+	AsDouble     *float64       `json:"asDouble,omitempty"`
+	AsInt        *otlpInt64     `json:"asInt,omitempty"`
+}
+
+// otlpHistogramDataPoint covers both histogram and summary points; only the
+// aggregate count and sum are used.
+type otlpHistogramDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes"`
+	TimeUnixNano otlpInt64      `json:"timeUnixNano"`
+	Count        otlpInt64      `json:"count"`
+	Sum          *float64       `json:"sum,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string    `json:"stringValue,omitempty"`
+	BoolValue   *bool      `json:"boolValue,omitempty"`
+	IntValue    *otlpInt64 `json:"intValue,omitempty"`
+	DoubleValue *float64   `json:"doubleValue,omitempty"`
+}
+
+// otlpInt64 accepts 64-bit integers encoded either as JSON strings (the
+// canonical protobuf mapping) or as bare numbers.
+type otlpInt64 int64
+
+func (v *otlpInt64) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*v = 0
+		return nil
+	}
+	parsed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid int64 %q", raw)
+	}
+	*v = otlpInt64(parsed)
+	return nil
+}
+
+func (v otlpAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+type otlpExportResponse struct {
+	PartialSuccess *otlpPartialSuccess `json:"partialSuccess,omitempty"`
+}
+
+type otlpPartialSuccess struct {
+	RejectedDataPoints int64  `json:"rejectedDataPoints,string"`
+	ErrorMessage       string `json:"errorMessage,omitempty"`
+}
+
+// convertOTLP maps an OTLP export request to metric events. Resource
+// attributes become labels (overridden by data point attributes), the
+// `service.name` resource attribute selects the namespace (falling back to
+// the instrumentation scope name, then "otel"), and instrument kinds map to
+// metric types: gauges and non-monotonic sums to gauge, monotonic sums to
+// counter, histograms and summaries to histogram using the mean of each
+// point. It returns the number of data points that could not be mapped.
+func convertOTLP(req otlpExportRequest, now time.Time) ([]MetricEvent, int) {
+	var (
+		events   []MetricEvent
+		rejected int
+	)
+	for _, rm := range req.ResourceMetrics {
+		resourceLabels := otlpAttributes(rm.Resource.Attributes, nil)
+		serviceName := resourceLabels["service.name"]
+		for _, sm := range rm.ScopeMetrics {
+			namespace := serviceName
+			if namespace == "" {
+				namespace = sm.Scope.Name
+			}
+			if namespace == "" {
+				namespace = "otel"
+			}
+			for _, metric := range sm.Metrics {
+				if metric.Name == "" {
+					rejected += metric.pointCount()
+					continue
+				}
+				base := MetricEvent{Namespace: namespace, Name: metric.Name}
+				switch {
+				case metric.Gauge != nil:
+					for _, dp := range metric.Gauge.DataPoints {
+						event, ok := dp.event(base, MetricTypeGauge, resourceLabels, now)
+						if !ok {
+							rejected++
+							continue
+						}
+						events = append(events, event)
+					}
+				case metric.Sum != nil:
+					metricType := MetricTypeGauge
+					if metric.Sum.IsMonotonic {
+						metricType = MetricTypeCounter
+					}
+					for _, dp := range metric.Sum.DataPoints {
+						event, ok := dp.event(base, metricType, resourceLabels, now)
+						if !ok {
+							rejected++
+							continue
+						}
+						events = append(events, event)
+					}
+				case metric.Histogram != nil:
+					for _, dp := range metric.Histogram.DataPoints {
+						event, ok := dp.event(base, resourceLabels, now)
+						if !ok {
+							rejected++
+							continue
+						}
+						events = append(events, event)
+					}
+				case metric.Summary != nil:
+					for _, dp := range metric.Summary.DataPoints {
+						event, ok := dp.event(base, resourceLabels, now)
+						if !ok {
+							rejected++
+							continue
+						}
+						events = append(events, event)
+					}
+				}
+			}
+		}
+	}
+	return events, rejected
+}
+
+func (m otlpMetric) pointCount() int {
+	switch {
+	case m.Gauge != nil:
+		return len(m.Gauge.DataPoints)
+	case m.Sum != nil:
+		return len(m.Sum.DataPoints)
+	case m.Histogram != nil:
+		return len(m.Histogram.DataPoints)
+	case m.Summary != nil:
+		return len(m.Summary.DataPoints)
+	default:
+		return 0
+	}
+}
+
+func (dp otlpNumberDataPoint) event(base MetricEvent, metricType MetricType, resource map[string]string, now time.Time) (MetricEvent, bool) {
+	switch {
+	case dp.AsDouble != nil:
+		base.Value = *dp.AsDouble
+	case dp.AsInt != nil:
+		base.Value = float64(*dp.AsInt)
+	default:
+		return MetricEvent{}, false
+	}
+	base.Type = metricType
+	base.Labels = otlpAttributes(dp.Attributes, resource)
+	base.Timestamp = otlpTimestamp(dp.TimeUnixNano, now)
+	return base, true
+}
+
+func (dp otlpHistogramDataPoint) event(base MetricEvent, resource map[string]string, now time.Time) (MetricEvent, bool) {
+	if dp.Count <= 0 || dp.Sum == nil {
+		return MetricEvent{}, false
+	}
+	base.Type = MetricTypeHistogram
+	base.Value = *dp.Sum / float64(dp.Count)
+	base.Labels = otlpAttributes(dp.Attributes, resource)
+	base.Timestamp = otlpTimestamp(dp.TimeUnixNano, now)
+	return base, true
+}
+
+func otlpAttributes(attrs []otlpKeyValue, base map[string]string) map[string]string {
+	if len(attrs) == 0 && len(base) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for _, attr := range attrs {
+		if attr.Key == "" {
+			continue
+		}
+		labels[attr.Key] = attr.Value.String()
+	}
+	return labels
+}
+
+func otlpTimestamp(nanos otlpInt64, now time.Time) time.Time {
+	if nanos <= 0 {
+		return now
+	}
+	return time.Unix(0, int64(nanos)).UTC()
+}
+
+func (s *Service) handleOTLP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		problem.Write(w, r, http.StatusUnsupportedMediaType, "metrics.unsupported_media_type", "only application/json OTLP payloads are supported")
+		return
+	}
+	var payload otlpExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
+		return
+	}
+	events, rejected := convertOTLP(payload, time.Now().UTC())
+	limited := 0
+	for _, event := range events {
+		if _, err := s.agg.Ingest(event); err != nil {
+			limited++
+		}
+	}
+	logging.For(r.Context(), s.logger).Printf("ingested %d otlp data points (%d rejected)", len(events)-limited, rejected+limited)
+
+	var resp otlpExportResponse
+	if rejected > 0 || limited > 0 {
+		message := "data points without a value or metric name were dropped"
+		if limited > 0 {
+			message = "data points exceeding series cardinality limits were dropped"
+		}
+		resp.PartialSuccess = &otlpPartialSuccess{
+			RejectedDataPoints: int64(rejected + limited),
+			ErrorMessage:       message,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,68 @@
+package metricscollector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const otlpFixture = `{
+  "resourceMetrics": [{
+    "resource": {"attributes": [
+      {"key": "service.name", "value": {"stringValue": "matchmaker"}},
+      {"key": "region", "value": {"stringValue": "eu"}}
+    ]},
+    "scopeMetrics": [{
+      "scope": {"name": "io.opentelemetry.runtime"},
+      "metrics": [
+        {"name": "queue_depth", "gauge": {"dataPoints": [{"asDouble": 4.5, "timeUnixNano": "1700000000000000000"}]}},
+        {"name": "matches_started", "sum": {"isMonotonic": true, "dataPoints": [{"asInt": "12", "attributes": [{"key": "region", "value": {"stringValue": "us"}}]}]}},
+        {"name": "tick_ms", "histogram": {"dataPoints": [{"count": "4", "sum": 20}]}},
+        {"name": "broken", "gauge": {"dataPoints": [{}]}}
+      ]
+    }]
+  }]
+}`
+
+func TestServiceOTLPIngest(t *testing.T) {
+	agg := NewAggregator()
+	svc := NewService(agg, testLogger{})
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	resp, err := http.Post(server.URL+"/v1/metrics", "application/json", strings.NewReader(otlpFixture))
+	if err != nil {
+		t.Fatalf("otlp request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+
+	snapshot := agg.Snapshot()
+	gauge, ok := snapshot["matchmaker.queue_depth{region=eu,service.name=matchmaker}"]
+	if !ok || gauge.Type != MetricTypeGauge || gauge.Last.Year() != 2023 {
+		t.Fatalf("unexpected gauge summary: %+v (snapshot %v)", gauge, snapshot)
+	}
+	counter, ok := snapshot["matchmaker.matches_started{region=us,service.name=matchmaker}"]
+	if !ok || counter.Type != MetricTypeCounter || counter.Sum != 12 {
+		t.Fatalf("unexpected counter summary: %+v", counter)
+	}
+	histogram := snapshot["matchmaker.tick_ms{region=eu,service.name=matchmaker}"]
+	if histogram.Type != MetricTypeHistogram || histogram.Mean != 5 {
+		t.Fatalf("unexpected histogram summary: %+v", histogram)
+	}
+	if len(snapshot) != 3 {
+		t.Fatalf("expected 3 series, got %d", len(snapshot))
+	}
+
+	resp, err = http.Post(server.URL+"/v1/metrics", "application/x-protobuf", strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("otlp request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,378 @@
+package metricscollector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PeerPath is where a paired collector serves Pairing.Handler, for both
+// PeerPath and PeerPath + "/".
+const PeerPath = "/peer"
+
+// maxPeerStateBytes bounds a peer's state body.
+const maxPeerStateBytes = 64 << 20
+
+// PeerState is what a paired collector sends its peer: its own samples of
+// every series and its scrape targets. Each state replaces the previous
+// one from the same origin.
+type PeerState struct {
+	Origin string `json:"origin"`
+	// Generation increases with every state an origin sends, across
+	// restarts, so a state delivered late or twice is ignored.
+	Generation uint64           `json:"generation"`
+	Series     []SeriesSnapshot `json:"series"`
+	Targets    []ScrapeTarget   `json:"targets"`
+	// TargetsChanged is when the origin's targets last changed.
+	TargetsChanged time.Time `json:"targets_changed,omitzero"`
+}
+
+// MergePeer applies a paired collector's state: each series it lists
+// reports summary as the origin's share, replacing its previous share, and
+// series it no longer lists lose theirs. A series' summary is then its own
+// samples merged with every peer's share, so two collectors exchanging
+// states converge on the same summaries in whatever order the states
+// arrive. It reports false, changing nothing, for a generation no later
+// than one already applied from origin. Cardinality limits are not
+// enforced on peers' series, as on restore.
+func (a *Aggregator) MergePeer(origin string, generation uint64, snapshots []SeriesSnapshot) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if generation <= a.peerGenerations[origin] {
+		return false
+	}
+	a.peerGenerations[origin] = generation
+	now := a.now()
+	incoming := make(map[string]SeriesSnapshot, len(snapshots))
+	for _, snap := range snapshots {
+		incoming[eventKey(MetricEvent{Namespace: snap.Namespace, Name: snap.Name, Labels: snap.Labels})] = snap
+	}
+	for key, entry := range a.metrics {
+		if _, ok := entry.peers[origin]; !ok {
+			continue
+		}
+		if _, ok := incoming[key]; ok {
+			continue
+		}
+		delete(entry.peers, origin)
+		if entry.remote && len(entry.peers) == 0 {
+			a.removeLocked(key, entry)
+			continue
+		}
+		entry.mergeLocked()
+	}
+	for key, snap := range incoming {
+		entry, ok := a.metrics[key]
+		if !ok {
+			a.perMetric[metricKey(snap.Namespace, snap.Name)]++
+			entry = &series{
+				namespace: snap.Namespace,
+				name:      snap.Name,
+				labels:    cloneLabels(snap.Labels),
+				remote:    true,
+			}
+			a.metrics[key] = entry
+		}
+		if entry.local == nil {
+			local := entry.summary.clone()
+			entry.local = &local
+			entry.peers = make(map[string]Summary)
+		}
+		previous, had := entry.peers[origin]
+		entry.peers[origin] = snap.Summary.clone()
+		entry.mergeLocked()
+		if !had || previous.Count != snap.Summary.Count || !previous.Last.Equal(snap.Summary.Last) {
+			entry.touched = now
+		}
+	}
+	return true
+}
+
+// mergeLocked recomputes the series' summary from its own samples and its
+// peers' shares.
+func (s *series) mergeLocked() {
+	merged := s.local.clone()
+	for _, origin := range slices.Sorted(maps.Keys(s.peers)) {
+		mergeSummary(&merged, s.peers[origin])
+	}
+	s.summary = merged
+}
+
+// PeerHealth is what a collector knows of its peer.
+type PeerHealth string
+
+const (
+	// PeerUnknown means the peer has not been reached since start, for up
+	// to PeerConfig.DownAfter.
+	PeerUnknown PeerHealth = "unknown"
+	PeerUp      PeerHealth = "up"
+	PeerDown    PeerHealth = "down"
+)
+
+// PeerConfig pairs a collector with another.
+type PeerConfig struct {
+	// Name identifies this collector to its peer; the two must differ.
+	Name string
+	// URL is the peer's base URL.
+	URL string
+	// Interval is how often the state is sent to the peer. Defaults to 5
+	// seconds.
+	Interval time.Duration
+	// DownAfter is how long the peer may go without an exchange in either
+	// direction before it is reported down. Defaults to three intervals.
+	DownAfter time.Duration
+}
+
+// PeerStatus reports a collector's pairing.
+type PeerStatus struct {
+	Name string `json:"name"`
+	// Peer is the peer's name, once it has been reached.
+	Peer   string     `json:"peer,omitempty"`
+	URL    string     `json:"url"`
+	Health PeerHealth `json:"health"`
+	// Active reports whether this collector scrapes targets and sends
+	// alert notifications.
+	Active       bool      `json:"active"`
+	LastSent     time.Time `json:"last_sent,omitzero"`
+	LastReceived time.Time `json:"last_received,omitzero"`
+	LastError    string    `json:"last_error,omitempty"`
+	// Failures counts sends failed since the last that succeeded.
+	Failures int `json:"failures"`
+	// PeerSeries counts the series in the peer's latest state, and
+	// Generation is that state's generation.
+	PeerSeries int    `json:"peer_series"`
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+// Pairing keeps two collectors' aggregators and scrape targets in step so
+// that either can serve queries, scrape, and alert when the other fails.
+// Each sends its own samples and targets to the other every interval;
+// summaries are merged as MergePeer describes, and the targets changed
+// last replace the other's. While both are up, only the collector whose
+// name sorts first is active: it alone scrapes targets, so their samples
+// are not counted twice, and sends alert notifications. A collector whose
+// peer is down becomes active.
+//
+// Top-K and heatmap queries read rolling windows, which are not exchanged,
+// and so cover the samples a collector received itself. Deletes and resets
+// act on the collector they are sent to, and a series the peer still holds
+// returns with its share at the next exchange; send them to both.
+type Pairing struct {
+	agg     *Aggregator
+	scraper *Scraper
+	cfg     PeerConfig
+	client  *http.Client
+	logger  interface {
+		Printf(string, ...any)
+	}
+	now        func() time.Time
+	started    time.Time
+	generation atomic.Uint64
+
+	mu     sync.Mutex
+	status PeerStatus
+}
+
+// NewPairing returns a pairing exchanging agg's series, and scraper's
+// targets unless scraper is nil, with the peer at cfg.URL.
+func NewPairing(agg *Aggregator, scraper *Scraper, cfg PeerConfig, logger interface {
+	Printf(string, ...any)
+}) *Pairing {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.DownAfter <= 0 {
+		cfg.DownAfter = 3 * cfg.Interval
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	p := &Pairing{
+		agg:     agg,
+		scraper: scraper,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Interval},
+		logger:  logger,
+		now:     func() time.Time { return time.Now().UTC() },
+		status:  PeerStatus{Name: cfg.Name, URL: cfg.URL},
+	}
+	p.started = p.now()
+	// Seeded from the clock so a restarted collector's states supersede
+	// those it sent before.
+	p.generation.Store(uint64(p.started.UnixNano()))
+	return p
+}
+
+// SetTransport sends states through rt, for example one presenting a
+// client certificate and API key to the peer.
+func (p *Pairing) SetTransport(rt http.RoundTripper) {
+	p.client.Transport = rt
+}
+
+// Status reports the pairing.
+func (p *Pairing) Status() PeerStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status
+	status.Health = p.healthLocked()
+	status.Active = p.activeLocked(status.Health)
+	return status
+}
+
+// Active reports whether this collector should scrape targets and send
+// alert notifications: when its peer is down, or is up and named after
+// it. Pass it to Scraper.SetActive and AlertManager.SetActive.
+func (p *Pairing) Active() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.activeLocked(p.healthLocked())
+}
+
+// Check fails while the peer is down, for an optional readiness check.
+func (p *Pairing) Check(context.Context) error {
+	if status := p.Status(); status.Health == PeerDown {
+		return fmt.Errorf("peer %s unreachable since %s", p.cfg.URL, p.lastContact(status).Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (p *Pairing) lastContact(status PeerStatus) time.Time {
+	last := p.started
+	if status.LastReceived.After(last) {
+		last = status.LastReceived
+	}
+	if status.Failures == 0 && status.LastSent.After(last) {
+		last = status.LastSent
+	}
+	return last
+}
+
+func (p *Pairing) healthLocked() PeerHealth {
+	last := p.lastContact(p.status)
+	if p.now().Sub(last) > p.cfg.DownAfter {
+		return PeerDown
+	}
+	if p.status.Peer == "" {
+		return PeerUnknown
+	}
+	return PeerUp
+}
+
+func (p *Pairing) activeLocked(health PeerHealth) bool {
+	switch health {
+	case PeerDown:
+		return true
+	case PeerUp:
+		return p.cfg.Name < p.status.Peer
+	default:
+		return false
+	}
+}
+
+// Run sends the state to the peer every interval until ctx is cancelled.
+func (p *Pairing) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Send(ctx); err != nil && ctx.Err() == nil {
+			p.logger.Printf("send state to peer %s: %v", p.cfg.URL, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// peerReply is the peer's answer to a state.
+type peerReply struct {
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+}
+
+// Send sends the current state to the peer once.
+func (p *Pairing) Send(ctx context.Context) error {
+	state := PeerState{
+		Origin:     p.cfg.Name,
+		Generation: p.generation.Add(1),
+		Series:     p.agg.Export(),
+	}
+	if p.scraper != nil {
+		state.Targets, state.TargetsChanged = p.scraper.Config()
+	}
+	reply, err := p.post(ctx, state)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.LastSent = p.now()
+	if err != nil {
+		p.status.Failures++
+		p.status.LastError = err.Error()
+		return err
+	}
+	p.status.Failures = 0
+	p.status.LastError = ""
+	p.status.Peer = reply.Name
+	return nil
+}
+
+func (p *Pairing) post(ctx context.Context, state PeerState) (peerReply, error) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return peerReply{}, fmt.Errorf("encode state: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.URL+PeerPath+"/state", bytes.NewReader(body))
+	if err != nil {
+		return peerReply{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return peerReply{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return peerReply{}, fmt.Errorf("peer returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var reply peerReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return peerReply{}, fmt.Errorf("decode reply: %w", err)
+	}
+	if reply.Name == p.cfg.Name {
+		return peerReply{}, errPeerLoop
+	}
+	return reply, nil
+}
+
+// errPeerLoop is returned for a state naming the collector receiving it.
+var errPeerLoop = errors.New("peer has this collector's name")
+
+// Apply merges a state received from the peer and reports whether it was
+// newer than the last applied.
+func (p *Pairing) Apply(state PeerState) (bool, error) {
+	if state.Origin == p.cfg.Name {
+		return false, errPeerLoop
+	}
+	applied := p.agg.MergePeer(state.Origin, state.Generation, state.Series)
+	if applied && p.scraper != nil {
+		p.scraper.SyncTargets(state.Targets, state.TargetsChanged)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.LastReceived = p.now()
+	p.status.Peer = state.Origin
+	if applied {
+		p.status.PeerSeries = len(state.Series)
+		p.status.Generation = state.Generation
+	}
+	return applied, nil
+}
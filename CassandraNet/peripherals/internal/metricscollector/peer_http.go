@@ -0,0 +1,65 @@
+package metricscollector
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Handler serves the pairing endpoints:
+//
+//	GET  /peer        this collector's PeerStatus
+//	POST /peer/state  applies a PeerState from the peer
+//
+// A state answers {"name": ..., "applied": ...} with this collector's
+// name. Pairing spans every tenant, so callers bound to a tenant are
+// refused.
+func (p *Pairing) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, _ := auth.FromContext(r.Context()); principal.Tenant != "" {
+			problem.Write(w, r, http.StatusForbidden, "metrics.forbidden_tenant", "pairing spans every tenant; use credentials not bound to one")
+			return
+		}
+		switch r.URL.Path {
+		case PeerPath, PeerPath + "/":
+			if r.Method != http.MethodGet {
+				problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+				return
+			}
+			writeAlertJSON(w, http.StatusOK, p.Status())
+		case PeerPath + "/state":
+			p.handleState(w, r)
+		default:
+			problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		}
+	})
+}
+
+func (p *Pairing) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodPost)
+		return
+	}
+	var state PeerState
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPeerStateBytes)).Decode(&state); err != nil {
+		problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
+		return
+	}
+	var v validation.Validator
+	v.ID("origin", state.Origin)
+	v.Check(state.Generation > 0, "generation", validation.RuleRange, "must be positive")
+	if err := v.Err(); err != nil {
+		invalidRequest(w, r, err)
+		return
+	}
+	applied, err := p.Apply(state)
+	if errors.Is(err, errPeerLoop) {
+		problem.Write(w, r, http.StatusConflict, "metrics.peer_loop", "the state comes from a collector named "+state.Origin+", like this one")
+		return
+	}
+	writeAlertJSON(w, http.StatusOK, peerReply{Name: p.cfg.Name, Applied: applied})
+}
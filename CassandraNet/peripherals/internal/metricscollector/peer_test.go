@@ -0,0 +1,77 @@
+package metricscollector
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPairingConvergesAndFailsOver(t *testing.T) {
+	ctx := context.Background()
+	labels := map[string]string{"route": "/v1"}
+	newMember := func(name string) (*Aggregator, *Scraper, *Pairing, *httptest.Server) {
+		agg := NewAggregator()
+		scraper := NewScraper(agg, ScrapeConfig{}, testLogger{})
+		pairing := NewPairing(agg, scraper, PeerConfig{Name: name, Interval: time.Second}, testLogger{})
+		return agg, scraper, pairing, httptest.NewServer(pairing.Handler())
+	}
+	aggA, scraperA, a, serverA := newMember("collector-a")
+	defer serverA.Close()
+	aggB, scraperB, b, serverB := newMember("collector-b")
+	a.cfg.URL, b.cfg.URL = serverB.URL, serverA.URL
+
+	aggA.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: 20, Labels: labels, Timestamp: time.Unix(10, 0)})
+	aggA.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: 700, Labels: labels, Timestamp: time.Unix(20, 0)})
+	aggB.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: 3, Labels: labels, Timestamp: time.Unix(15, 0)})
+	aggB.Ingest(MetricEvent{Namespace: "api", Name: "errors", Type: MetricTypeCounter, Value: 1})
+	if err := scraperA.PutTarget(ScrapeTarget{Name: "ugc", URL: "http://ugc:8091/metrics"}); err != nil {
+		t.Fatalf("put target: %v", err)
+	}
+	for _, p := range []*Pairing{a, b, a} {
+		if err := p.Send(ctx); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+
+	key := "api.latency{route=/v1}"
+	for name, agg := range map[string]*Aggregator{"a": aggA, "b": aggB} {
+		snapshot := agg.Snapshot()
+		got := snapshot[key]
+		if len(snapshot) != 2 || got.Count != 3 || got.Sum != 723 || got.Min != 3 || got.Max != 700 || got.LastValue != 700 || got.Buckets[0].Count != 1 || got.Buckets[2].Count != 1 || got.Buckets[7].Count != 1 || snapshot["api.errors{}"].LastValue != 1 {
+			t.Fatalf("collector %s: unexpected merged state %+v", name, snapshot)
+		}
+	}
+	if summary, _ := aggA.Ingest(MetricEvent{Namespace: "api", Name: "latency", Value: 1, Labels: labels, Timestamp: time.Unix(30, 0)}); summary.Count != 4 {
+		t.Fatalf("expected local samples merged with the peer's, got %+v", summary)
+	}
+	if exported := aggA.Export(); len(exported) != 1 || exported[0].Summary.Count != 3 {
+		t.Fatalf("expected only local samples exported, got %+v", exported)
+	}
+	if aggB.MergePeer("collector-a", 1, nil) {
+		t.Fatalf("expected a stale generation ignored")
+	}
+	if targets, _ := scraperB.Config(); len(targets) != 1 || targets[0].Name != "ugc" {
+		t.Fatalf("expected the target synced, got %+v", targets)
+	}
+
+	if status := a.Status(); status.Health != PeerUp || !status.Active || status.Peer != "collector-b" || status.PeerSeries != 2 {
+		t.Fatalf("unexpected status of a: %+v", status)
+	}
+	if b.Active() {
+		t.Fatalf("expected only the first name active")
+	}
+	serverB.Close()
+	if err := a.Send(ctx); err == nil {
+		t.Fatalf("expected a send to a stopped peer to fail")
+	}
+	later := time.Now().Add(time.Minute)
+	a.now = func() time.Time { return later }
+	if status := a.Status(); status.Health != PeerDown || !status.Active || status.Failures != 1 || a.Check(ctx) == nil {
+		t.Fatalf("unexpected status with the peer down: %+v", status)
+	}
+	b.now = func() time.Time { return later }
+	if !b.Active() {
+		t.Fatalf("expected the second collector to take over when its peer is down")
+	}
+}
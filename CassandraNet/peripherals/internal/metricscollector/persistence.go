@@ -0,0 +1,215 @@
+package metricscollector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SeriesSnapshot is the persisted form of a single aggregated series.
+type SeriesSnapshot struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Summary   Summary           `json:"summary"`
+}
+
+// SnapshotStore persists aggregator state between restarts.
+type SnapshotStore interface {
+	Save(ctx context.Context, series []SeriesSnapshot) error
+	// Load returns the most recently saved state. A store that has never been
+	// written returns an empty slice and no error.
+	Load(ctx context.Context) ([]SeriesSnapshot, error)
+}
+
+// Export returns the full aggregator state for persistence. It holds the
+// aggregator's own samples only: what a paired collector reported is left
+// for the peer to persist and send again.
+func (a *Aggregator) Export() []SeriesSnapshot {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	out := make([]SeriesSnapshot, 0, len(a.metrics))
+	for _, entry := range a.metrics {
+		if entry.remote {
+			continue
+		}
+		summary := entry.summary
+		if entry.local != nil {
+			summary = *entry.local
+		}
+		out = append(out, SeriesSnapshot{
+			Namespace: entry.namespace,
+			Name:      entry.name,
+			Labels:    cloneLabels(entry.labels),
+			Summary:   summary.clone(),
+		})
+	}
+	return out
+}
+
+// Restore replaces series with the supplied state. Restored series are
+// treated as freshly touched so idle expiry starts counting from the restore.
+// Cardinality limits are not enforced on restore so no persisted data is lost.
+func (a *Aggregator) Restore(snapshots []SeriesSnapshot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	for _, snap := range snapshots {
+		key := eventKey(MetricEvent{Namespace: snap.Namespace, Name: snap.Name, Labels: snap.Labels})
+		if existing, ok := a.metrics[key]; ok {
+			a.removeLocked(key, existing)
+		}
+		a.perMetric[metricKey(snap.Namespace, snap.Name)]++
+		a.metrics[key] = &series{
+			namespace: snap.Namespace,
+			name:      snap.Name,
+			labels:    cloneLabels(snap.Labels),
+			summary:   snap.Summary.clone(),
+			touched:   now,
+		}
+	}
+}
+
+// FileSnapshotStore keeps snapshots as a JSON document on local disk.
+type FileSnapshotStore struct {
+	path string
+}
+
+// NewFileSnapshotStore returns a store writing to path.
+func NewFileSnapshotStore(path string) *FileSnapshotStore {
+	return &FileSnapshotStore{path: path}
+}
+
+type snapshotFile struct {
+	SavedAt time.Time        `json:"saved_at"`
+	Series  []SeriesSnapshot `json:"series"`
+}
+
+// Save writes the snapshot atomically by renaming a temporary file into place.
+func (f *FileSnapshotStore) Save(_ context.Context, series []SeriesSnapshot) error {
+	data, err := json.Marshal(snapshotFile{SavedAt: time.Now().UTC(), Series: series})
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+	dir := filepath.Dir(f.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create snapshot dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+	return nil
+}
+
+// Load reads the snapshot file, returning no series if it does not exist.
+func (f *FileSnapshotStore) Load(_ context.Context) ([]SeriesSnapshot, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	var file snapshotFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("decode snapshot: %w", err)
+	}
+	return file.Series, nil
+}
+
+// Persister periodically saves aggregator state to a SnapshotStore.
+type Persister struct {
+	agg      *Aggregator
+	store    SnapshotStore
+	interval time.Duration
+	logger   interface {
+		Printf(string, ...any)
+	}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	stop      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewPersister constructs a Persister saving every interval.
+func NewPersister(agg *Aggregator, store SnapshotStore, interval time.Duration, logger interface {
+	Printf(string, ...any)
+}) *Persister {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &Persister{
+		agg:      agg,
+		store:    store,
+		interval: interval,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Restore loads the last saved state into the aggregator.
+func (p *Persister) Restore(ctx context.Context) (int, error) {
+	snapshots, err := p.store.Load(ctx)
+	if err != nil {
+		return 0, err
+	}
+	p.agg.Restore(snapshots)
+	return len(snapshots), nil
+}
+
+// Save writes the current aggregator state.
+func (p *Persister) Save(ctx context.Context) error {
+	return p.store.Save(ctx, p.agg.Export())
+}
+
+// Start launches the periodic save loop.
+func (p *Persister) Start() {
+	p.startOnce.Do(func() {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			ticker := time.NewTicker(p.interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-p.stop:
+					return
+				case <-ticker.C:
+					if err := p.Save(context.Background()); err != nil {
+						p.logger.Printf("metrics snapshot failed: %v", err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stop halts the save loop and writes a final snapshot.
+func (p *Persister) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+		p.wg.Wait()
+		if err := p.Save(context.Background()); err != nil {
+			p.logger.Printf("final metrics snapshot failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package metricscollector
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestPersisterRoundTrip(t *testing.T) {
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "state", "metrics.json"))
+
+	agg := NewAggregator()
+	agg.Ingest(MetricEvent{Namespace: "core", Name: "requests", Type: MetricTypeCounter, Value: 3, Labels: map[string]string{"status": "200"}})
+	agg.Ingest(MetricEvent{Namespace: "core", Name: "requests", Type: MetricTypeCounter, Value: 4, Labels: map[string]string{"status": "200"}})
+	if err := NewPersister(agg, store, 0, testLogger{}).Save(context.Background()); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	restored := NewAggregator()
+	n, err := NewPersister(restored, store, 0, testLogger{}).Restore(context.Background())
+	if err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 restored series, got %d", n)
+	}
+	summary, err := restored.Ingest(MetricEvent{Namespace: "core", Name: "requests", Value: 1, Labels: map[string]string{"status": "200"}})
+	if err != nil {
+		t.Fatalf("ingest failed: %v", err)
+	}
+	if summary.Count != 3 || summary.Sum != 8 || summary.Type != MetricTypeCounter {
+		t.Fatalf("unexpected summary after restore: %+v", summary)
+	}
+}
+
+func TestFileSnapshotStoreMissingFile(t *testing.T) {
+	store := NewFileSnapshotStore(filepath.Join(t.TempDir(), "missing.json"))
+	series, err := store.Load(context.Background())
+	if err != nil || len(series) != 0 {
+		t.Fatalf("expected empty load, got %v, %v", series, err)
+	}
+}
@@ -0,0 +1,196 @@
+package metricscollector
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const (
+	prometheusTextType  = "text/plain; version=0.0.4; charset=utf-8"
+	openMetricsTextType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Exposer writes metric families that the collector does not aggregate, such
+// as its own request metrics, into the /metrics exposition.
+type Exposer interface {
+	WritePrometheus(w io.Writer, openMetrics bool)
+}
+
+// Expose appends e's families to every /metrics response.
+func (s *Service) Expose(e Exposer) {
+	s.extra = append(s.extra, e)
+}
+
+// handlePrometheus serves GET /metrics in the Prometheus text exposition
+// format. Clients advertising application/openmetrics-text receive the
+// OpenMetrics format instead, which is the only one able to carry exemplars.
+func (s *Service) handlePrometheus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet)
+		return
+	}
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsTextType)
+	} else {
+		w.Header().Set("Content-Type", prometheusTextType)
+	}
+	writeExposition(w, s.agg.Query(Query{}), openMetrics, s.extra...)
+}
+
+func writeExposition(w io.Writer, results []SeriesResult, openMetrics bool, extra ...Exposer) {
+	families := make(map[string][]SeriesResult)
+	for _, res := range results {
+		family := promName(res.Namespace + "_" + res.Name)
+		families[family] = append(families[family], res)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, family := range names {
+		series := families[family]
+		metricType := series[0].Summary.Type
+		if metricType == "" {
+			metricType = MetricTypeGauge
+		}
+		switch metricType {
+		case MetricTypeCounter:
+			if openMetrics {
+				fmt.Fprintf(w, "# TYPE %s counter\n", family)
+			} else {
+				fmt.Fprintf(w, "# TYPE %s_total counter\n", family)
+			}
+			for _, res := range series {
+				writeSample(w, family+"_total", res.Labels, "", "", res.Summary.Sum, exemplarIf(openMetrics, res.Summary.Exemplar))
+			}
+		case MetricTypeHistogram:
+			fmt.Fprintf(w, "# TYPE %s histogram\n", family)
+			for _, res := range series {
+				var cumulative uint64
+				for _, bucket := range res.Summary.Buckets {
+					cumulative += bucket.Count
+					writeSample(w, family+"_bucket", res.Labels, "le", formatFloat(bucket.UpperBound), float64(cumulative), exemplarIf(openMetrics, bucket.Exemplar))
+				}
+				writeSample(w, family+"_bucket", res.Labels, "le", "+Inf", float64(res.Summary.Count), exemplarIf(openMetrics, res.Summary.Exemplar))
+				writeSample(w, family+"_sum", res.Labels, "", "", res.Summary.Sum, nil)
+				writeSample(w, family+"_count", res.Labels, "", "", float64(res.Summary.Count), nil)
+			}
+		default:
+			fmt.Fprintf(w, "# TYPE %s gauge\n", family)
+			for _, res := range series {
+				writeSample(w, family, res.Labels, "", "", res.Summary.LastValue, nil)
+			}
+		}
+	}
+	for _, e := range extra {
+		e.WritePrometheus(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+func exemplarIf(enabled bool, exemplar *Exemplar) *Exemplar {
+	if !enabled {
+		return nil
+	}
+	return exemplar
+}
+
+func writeSample(w io.Writer, name string, labels map[string]string, extraKey, extraValue string, value float64, exemplar *Exemplar) {
+	var b strings.Builder
+	b.WriteString(name)
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 || extraKey != "" {
+		b.WriteString("{")
+		first := true
+		for _, k := range keys {
+			if !first {
+				b.WriteString(",")
+			}
+			first = false
+			writeLabel(&b, promName(k), labels[k])
+		}
+		if extraKey != "" {
+			if !first {
+				b.WriteString(",")
+			}
+			writeLabel(&b, extraKey, extraValue)
+		}
+		b.WriteString("}")
+	}
+	b.WriteString(" ")
+	b.WriteString(formatFloat(value))
+	if exemplar != nil {
+		b.WriteString(" # {")
+		writeLabel(&b, "trace_id", exemplar.TraceID)
+		if exemplar.SpanID != "" {
+			b.WriteString(",")
+			writeLabel(&b, "span_id", exemplar.SpanID)
+		}
+		b.WriteString("} ")
+		b.WriteString(formatFloat(exemplar.Value))
+		if !exemplar.Timestamp.IsZero() {
+			b.WriteString(" ")
+			b.WriteString(strconv.FormatFloat(float64(exemplar.Timestamp.UnixNano())/1e9, 'f', 3, 64))
+		}
+	}
+	b.WriteString("\n")
+	_, _ = io.WriteString(w, b.String())
+}
+
+func writeLabel(b *strings.Builder, name, value string) {
+	b.WriteString(name)
+	b.WriteString(`="`)
+	b.WriteString(labelValueEscaper.Replace(value))
+	b.WriteString(`"`)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// promName maps arbitrary identifiers onto the Prometheus metric and label
+// name alphabet.
+func promName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
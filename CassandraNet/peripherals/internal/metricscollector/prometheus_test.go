@@ -0,0 +1,59 @@
+package metricscollector
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServicePrometheusExemplars(t *testing.T) {
+	agg := NewAggregatorWithConfig(AggregatorConfig{HistogramBuckets: []float64{100, 500}})
+	ts := time.Unix(1_700_000_000, 0).UTC()
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: 80, Labels: map[string]string{"route": "/v1"}, Timestamp: ts})
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "latency", Type: MetricTypeHistogram, Value: 420, Labels: map[string]string{"route": "/v1"}, Timestamp: ts,
+		Exemplar: &Exemplar{TraceID: "abc123"}})
+	agg.Ingest(MetricEvent{Namespace: "api", Name: "requests", Type: MetricTypeCounter, Value: 2})
+
+	svc := NewService(agg, testLogger{})
+	svc.Expose(exposerFunc(func(w io.Writer, _ bool) { _, _ = io.WriteString(w, "process_up 1\n") }))
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	for _, want := range []string{
+		`api_latency_bucket{route="/v1",le="100"} 1` + "\n",
+		`api_latency_bucket{route="/v1",le="500"} 2 # {trace_id="abc123"} 420 1700000000.000`,
+		`api_latency_bucket{route="/v1",le="+Inf"} 2`,
+		`api_requests_total 2`,
+		"process_up 1\n# EOF",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected exposition to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if strings.Contains(string(body), "trace_id") {
+		t.Fatalf("classic text format must not carry exemplars:\n%s", body)
+	}
+}
+
+type exposerFunc func(w io.Writer, openMetrics bool)
+
+func (f exposerFunc) WritePrometheus(w io.Writer, openMetrics bool) { f(w, openMetrics) }
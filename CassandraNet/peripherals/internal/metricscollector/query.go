@@ -0,0 +1,274 @@
+package metricscollector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// MatchOp selects how a LabelMatcher compares label values.
+type MatchOp string
+
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// LabelMatcher filters series on a single label. A missing label is treated
+// as the empty string, mirroring Prometheus selector semantics.
+type LabelMatcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp
+}
+
+// NewLabelMatcher validates and compiles a matcher.
+func NewLabelMatcher(name string, op MatchOp, value string) (LabelMatcher, error) {
+	if name == "" {
+		return LabelMatcher{}, errors.New("label matcher requires a label name")
+	}
+	m := LabelMatcher{Name: name, Op: op, Value: value}
+	switch op {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return LabelMatcher{}, fmt.Errorf("invalid regexp for label %s: %w", name, err)
+		}
+		m.re = re
+	default:
+		return LabelMatcher{}, fmt.Errorf("unknown match operator %q", op)
+	}
+	return m, nil
+}
+
+// ParseLabelMatcher parses expressions such as `route=/v1`, `status!=500`,
+// `route=~/v1/.*`, or `region!~eu-.*`.
+func ParseLabelMatcher(expr string) (LabelMatcher, error) {
+	idx := strings.IndexAny(expr, "=!")
+	if idx <= 0 {
+		return LabelMatcher{}, validation.Invalid("match", validation.RuleFormat, fmt.Sprintf("must be name=value, name!=value, name=~regexp, or name!~regexp, not %q", expr))
+	}
+	name, rest := expr[:idx], expr[idx:]
+	for _, op := range []MatchOp{MatchRegexp, MatchNotRegexp, MatchNotEqual, MatchEqual} {
+		if strings.HasPrefix(rest, string(op)) {
+			return NewLabelMatcher(name, op, strings.TrimPrefix(rest, string(op)))
+		}
+	}
+	return LabelMatcher{}, fmt.Errorf("invalid label matcher %q", expr)
+}
+
+// Matches reports whether the label set satisfies the matcher.
+func (m LabelMatcher) Matches(labels map[string]string) bool {
+	value := labels[m.Name]
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+// AggregateOp combines the matching series of a query.
+type AggregateOp string
+
+const (
+	AggregateNone AggregateOp = ""
+	AggregateSum  AggregateOp = "sum"
+	AggregateAvg  AggregateOp = "avg"
+)
+
+// ParseAggregateOp converts user supplied strings into AggregateOp values.
+func ParseAggregateOp(value string) (AggregateOp, error) {
+	switch strings.ToLower(value) {
+	case "", "none":
+		return AggregateNone, nil
+	case string(AggregateSum):
+		return AggregateSum, nil
+	case string(AggregateAvg):
+		return AggregateAvg, nil
+	default:
+		return "", validation.Invalid("agg", validation.RuleOneOf, "must be one of none, sum, avg")
+	}
+}
+
+// Query selects series from the aggregator.
+type Query struct {
+	Namespace string
+	Name      string
+	Matchers  []LabelMatcher
+	// Aggregate collapses the matching series into one result per distinct
+	// combination of the By labels.
+	Aggregate AggregateOp
+	By        []string
+}
+
+// SeriesResult is a single series (or aggregated group) returned by Query.
+type SeriesResult struct {
+	Namespace string            `json:"namespace,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Summary   Summary           `json:"summary"`
+	// Series and Value are only populated for aggregated results. Value is
+	// the sum of the series sums (sum) or the mean of the series means (avg).
+	Series int     `json:"series,omitempty"`
+	Value  float64 `json:"value,omitempty"`
+}
+
+// Query returns the series matching q, optionally aggregated. Results are
+// ordered by namespace, name, and label set.
+func (a *Aggregator) Query(q Query) []SeriesResult {
+	a.mu.RLock()
+	var matched []SeriesResult
+	for _, entry := range a.metrics {
+		if !q.selects(entry) {
+			continue
+		}
+		matched = append(matched, SeriesResult{
+			Namespace: entry.namespace,
+			Name:      entry.name,
+			Labels:    cloneLabels(entry.labels),
+			Summary:   entry.summary.clone(),
+		})
+	}
+	a.mu.RUnlock()
+
+	if q.Aggregate != AggregateNone {
+		matched = aggregateSeries(matched, q.Aggregate, q.By)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return resultKey(matched[i]) < resultKey(matched[j])
+	})
+	return matched
+}
+
+func (q Query) selects(entry *series) bool {
+	if q.Namespace != "" && entry.namespace != q.Namespace {
+		return false
+	}
+	if q.Name != "" && entry.name != q.Name {
+		return false
+	}
+	for _, m := range q.Matchers {
+		if !m.Matches(entry.labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func aggregateSeries(in []SeriesResult, op AggregateOp, by []string) []SeriesResult {
+	groups := make(map[string]*SeriesResult)
+	for _, res := range in {
+		var labels map[string]string
+		if len(by) > 0 {
+			labels = make(map[string]string, len(by))
+			for _, name := range by {
+				if v, ok := res.Labels[name]; ok {
+					labels[name] = v
+				}
+			}
+		}
+		group := SeriesResult{Namespace: res.Namespace, Name: res.Name, Labels: labels}
+		key := resultKey(group)
+		existing, ok := groups[key]
+		if !ok {
+			group.Summary = Summary{Type: res.Summary.Type, Min: res.Summary.Min, Max: res.Summary.Max}
+			existing = &group
+			groups[key] = existing
+		}
+		mergeSummary(&existing.Summary, res.Summary)
+		existing.Series++
+		switch op {
+		case AggregateSum:
+			existing.Value += res.Summary.Sum
+		case AggregateAvg:
+			existing.Value += res.Summary.Mean
+		}
+	}
+	out := make([]SeriesResult, 0, len(groups))
+	for _, group := range groups {
+		if op == AggregateAvg && group.Series > 0 {
+			group.Value /= float64(group.Series)
+		}
+		out = append(out, *group)
+	}
+	return out
+}
+
+// mergeSummary adds src's samples to dst: counts, sums, and bucket counts
+// add up, the extremes are kept, and the latest sample and exemplars win.
+func mergeSummary(dst *Summary, src Summary) {
+	if dst.Type == "" {
+		dst.Type = src.Type
+	}
+	if src.Count == 0 {
+		return
+	}
+	if dst.Count == 0 {
+		dst.Min, dst.Max = src.Min, src.Max
+		dst.Last, dst.LastValue = src.Last, src.LastValue
+	}
+	if src.Min < dst.Min {
+		dst.Min = src.Min
+	}
+	if src.Max > dst.Max {
+		dst.Max = src.Max
+	}
+	dst.Count += src.Count
+	dst.Sum += src.Sum
+	if dst.Count > 0 {
+		dst.Mean = dst.Sum / float64(dst.Count)
+	}
+	if src.Last.After(dst.Last) {
+		dst.Last = src.Last
+		dst.LastValue = src.LastValue
+	}
+	dst.Buckets = mergeBuckets(dst.Buckets, src.Buckets)
+	if src.Exemplar != nil && (dst.Exemplar == nil || src.Exemplar.Timestamp.After(dst.Exemplar.Timestamp)) {
+		dst.Exemplar = src.Exemplar
+	}
+}
+
+// mergeBuckets adds src bucket counts into dst when both use the same
+// bounds, keeping the newest exemplar per bucket.
+func mergeBuckets(dst, src []Bucket) []Bucket {
+	if len(src) == 0 {
+		return dst
+	}
+	if len(dst) == 0 {
+		return append([]Bucket(nil), src...)
+	}
+	if len(dst) != len(src) {
+		return dst
+	}
+	for i := range dst {
+		if dst[i].UpperBound != src[i].UpperBound {
+			return dst
+		}
+	}
+	for i := range dst {
+		dst[i].Count += src[i].Count
+		if ex := src[i].Exemplar; ex != nil && (dst[i].Exemplar == nil || ex.Timestamp.After(dst[i].Exemplar.Timestamp)) {
+			dst[i].Exemplar = ex
+		}
+	}
+	return dst
+}
+
+func resultKey(res SeriesResult) string {
+	return eventKey(MetricEvent{Namespace: res.Namespace, Name: res.Name, Labels: res.Labels})
+}
@@ -0,0 +1,661 @@
+package metricscollector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+const (
+	// scrapeTick is how often the scraper looks for targets that are due.
+	scrapeTick = time.Second
+	// maxScrapeBytes bounds a target's response body.
+	maxScrapeBytes = 16 << 20
+	// ScrapeNamespace holds the up, duration_seconds, and samples series
+	// recorded for every scrape, labelled with the target's name.
+	ScrapeNamespace = "scrape"
+)
+
+// ErrTargetNotFound is returned for a scrape target that does not exist.
+var ErrTargetNotFound = errors.New("scrape target not found")
+
+// ScrapeTarget is an endpoint serving the Prometheus text format, such as
+// another peripheral's /metrics, that the collector pulls from.
+type ScrapeTarget struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Namespace receives the target's series. Defaults to Name.
+	Namespace string `json:"namespace,omitempty"`
+	// IntervalSeconds overrides the scraper's interval for this target.
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+	// Labels are added to every series scraped from the target, replacing
+	// labels of the same name.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ParseScrapeTarget parses "name=url", such as
+// "ugc=http://ugc-service:8091/metrics".
+func ParseScrapeTarget(spec string) (ScrapeTarget, error) {
+	name, rawURL, ok := strings.Cut(spec, "=")
+	if !ok {
+		return ScrapeTarget{}, fmt.Errorf("scrape target %q: expected name=url", spec)
+	}
+	target := ScrapeTarget{Name: strings.TrimSpace(name), URL: strings.TrimSpace(rawURL)}
+	if err := target.validate(); err != nil {
+		return ScrapeTarget{}, fmt.Errorf("scrape target %q: %w", spec, err)
+	}
+	return target, nil
+}
+
+func (t ScrapeTarget) validate() error {
+	var v validation.Validator
+	v.ID("name", t.Name)
+	v.String("url", t.URL).Required()
+	if t.URL != "" {
+		u, err := url.Parse(t.URL)
+		v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", validation.RuleFormat, "must be an absolute http(s) URL")
+	}
+	v.String("namespace", t.Namespace).MaxLength(validation.MaxIDLength)
+	v.Check(t.IntervalSeconds == 0 || t.IntervalSeconds >= 1, "interval_seconds", validation.RuleRange, "must be at least 1")
+	v.Map("labels", t.Labels).Limited()
+	return v.Err()
+}
+
+// ScrapeHealth is the outcome of a target's latest scrape.
+type ScrapeHealth string
+
+const (
+	ScrapeUnknown ScrapeHealth = "unknown"
+	ScrapeUp      ScrapeHealth = "up"
+	ScrapeDown    ScrapeHealth = "down"
+)
+
+// TargetStatus is a target and the outcome of its latest scrape.
+type TargetStatus struct {
+	ScrapeTarget
+	Health     ScrapeHealth `json:"health"`
+	LastScrape time.Time    `json:"last_scrape,omitzero"`
+	// LastDurationMS is how long the latest scrape took.
+	LastDurationMS float64 `json:"last_duration_ms"`
+	LastError      string  `json:"last_error,omitempty"`
+	// Samples counts the samples ingested by the latest scrape.
+	Samples int `json:"samples"`
+	// Failures counts scrapes failed since the last that succeeded.
+	Failures int `json:"failures"`
+}
+
+// ScrapeConfig tunes a Scraper.
+type ScrapeConfig struct {
+	// Interval is how often each target is scraped unless it sets its own.
+	// Defaults to 15 seconds.
+	Interval time.Duration
+	// Timeout bounds one scrape. Defaults to 10 seconds.
+	Timeout time.Duration
+	// SampleLimit fails scrapes returning more samples. Zero means 10000.
+	SampleLimit int
+}
+
+type scrapeState struct {
+	target  ScrapeTarget
+	status  TargetStatus
+	next    time.Time
+	running bool
+	// counters holds each counter's last scraped value, keyed by series,
+	// so the increase since the previous scrape can be recorded.
+	counters map[string]float64
+}
+
+// Scraper pulls Prometheus-format metrics from its targets on an interval
+// and ingests them into an aggregator. Gauges are recorded as scraped.
+// Counters, and the _sum and _count of histograms and summaries, are
+// recorded as their increase since the previous scrape, starting from 0,
+// so that they accumulate in the aggregator the way pushed counters do.
+// Summary quantiles are recorded as gauges; histogram buckets, which the
+// aggregator cannot rebuild from cumulative counts, are skipped.
+type Scraper struct {
+	agg    *Aggregator
+	cfg    ScrapeConfig
+	client *http.Client
+	logger interface {
+		Printf(string, ...any)
+	}
+	now func() time.Time
+
+	mu      sync.Mutex
+	targets map[string]*scrapeState
+	// changed is when targets were last added, replaced, or removed.
+	changed time.Time
+	audit   *audit.Log
+	wake    chan struct{}
+	active  func() bool
+}
+
+// NewScraper returns a scraper feeding agg. Zero fields of cfg take their
+// defaults.
+func NewScraper(agg *Aggregator, cfg ScrapeConfig, logger interface {
+	Printf(string, ...any)
+}) *Scraper {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.SampleLimit <= 0 {
+		cfg.SampleLimit = 10000
+	}
+	return &Scraper{
+		agg:     agg,
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		logger:  logger,
+		now:     func() time.Time { return time.Now().UTC() },
+		targets: make(map[string]*scrapeState),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// SetTransport sends scrapes through rt, for example one presenting a
+// client certificate and API key to the peripherals being scraped.
+func (s *Scraper) SetTransport(rt http.RoundTripper) {
+	s.client.Transport = rt
+}
+
+// SetAudit records target changes made through Handler in log. Call it
+// before the scraper handles requests.
+func (s *Scraper) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// SetActive makes the scraper scrape on schedule only while active reports
+// true, such as Pairing.Active. Scrapes requested through Scrape still run.
+// Call it before Run.
+func (s *Scraper) SetActive(active func() bool) {
+	s.active = active
+}
+
+// PutTarget adds target, or replaces the target with its name, and
+// schedules it to be scraped at once.
+func (s *Scraper) PutTarget(target ScrapeTarget) error {
+	if err := target.validate(); err != nil {
+		return err
+	}
+	target.Labels = cloneLabels(target.Labels)
+	s.mu.Lock()
+	s.targets[target.Name] = &scrapeState{
+		target: target,
+		status: TargetStatus{ScrapeTarget: target, Health: ScrapeUnknown},
+	}
+	s.changed = s.now()
+	s.mu.Unlock()
+	s.wakeRun()
+	return nil
+}
+
+func (s *Scraper) wakeRun() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// DeleteTarget removes the named target, reporting the removed target.
+func (s *Scraper) DeleteTarget(name string) (ScrapeTarget, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.targets[name]
+	if !ok {
+		return ScrapeTarget{}, false
+	}
+	delete(s.targets, name)
+	s.changed = s.now()
+	return state.target, true
+}
+
+// Config returns the targets, ordered by name, and when they last changed.
+func (s *Scraper) Config() ([]ScrapeTarget, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]ScrapeTarget, 0, len(s.targets))
+	for _, state := range s.targets {
+		target := state.target
+		target.Labels = cloneLabels(target.Labels)
+		out = append(out, target)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, s.changed
+}
+
+// SyncTargets replaces the targets with targets when changed is later than
+// the scraper's own last change, as reported by Config, and reports
+// whether it did. Targets left as they were keep their status; invalid
+// ones are skipped.
+func (s *Scraper) SyncTargets(targets []ScrapeTarget, changed time.Time) bool {
+	s.mu.Lock()
+	if !changed.After(s.changed) {
+		s.mu.Unlock()
+		return false
+	}
+	synced := make(map[string]*scrapeState, len(targets))
+	for _, target := range targets {
+		if target.validate() != nil {
+			continue
+		}
+		if state, ok := s.targets[target.Name]; ok && sameTarget(state.target, target) {
+			synced[target.Name] = state
+			continue
+		}
+		target.Labels = cloneLabels(target.Labels)
+		synced[target.Name] = &scrapeState{
+			target: target,
+			status: TargetStatus{ScrapeTarget: target, Health: ScrapeUnknown},
+		}
+	}
+	s.targets = synced
+	s.changed = changed
+	s.mu.Unlock()
+	s.wakeRun()
+	return true
+}
+
+func sameTarget(a, b ScrapeTarget) bool {
+	return a.Name == b.Name && a.URL == b.URL && a.Namespace == b.Namespace &&
+		a.IntervalSeconds == b.IntervalSeconds && maps.Equal(a.Labels, b.Labels)
+}
+
+// Target returns the named target's status.
+func (s *Scraper) Target(name string) (TargetStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.targets[name]
+	if !ok {
+		return TargetStatus{}, false
+	}
+	return state.statusLocked(), true
+}
+
+// Targets returns every target's status, ordered by name.
+func (s *Scraper) Targets() []TargetStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]TargetStatus, 0, len(s.targets))
+	for _, state := range s.targets {
+		out = append(out, state.statusLocked())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (st *scrapeState) statusLocked() TargetStatus {
+	status := st.status
+	status.Labels = cloneLabels(status.Labels)
+	return status
+}
+
+// Scrape scrapes the named target now and returns its status. It fails
+// with ErrTargetNotFound for an unknown target; a failed scrape is
+// reported in the status rather than as an error.
+func (s *Scraper) Scrape(ctx context.Context, name string) (TargetStatus, error) {
+	s.mu.Lock()
+	state, ok := s.targets[name]
+	s.mu.Unlock()
+	if !ok {
+		return TargetStatus{}, ErrTargetNotFound
+	}
+	s.scrape(ctx, state)
+	status, _ := s.Target(name)
+	return status, nil
+}
+
+// Run scrapes each target when it is due until ctx is cancelled, then
+// waits for scrapes in flight. While the scraper is not active it scrapes
+// nothing, and once active again it records counters' increases from the
+// first scrape, since its earlier values are out of date.
+func (s *Scraper) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(scrapeTick)
+	defer ticker.Stop()
+	standby := false
+	for {
+		if s.active != nil && !s.active() {
+			standby = true
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			case <-s.wake:
+			}
+			continue
+		}
+		now := s.now()
+		s.mu.Lock()
+		for _, state := range s.targets {
+			if standby {
+				state.counters = nil
+			}
+			if state.running || now.Before(state.next) {
+				continue
+			}
+			state.running = true
+			state.next = now.Add(s.interval(state.target))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.scrape(ctx, state)
+				s.mu.Lock()
+				state.running = false
+				s.mu.Unlock()
+			}()
+		}
+		standby = false
+		s.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Scraper) interval(target ScrapeTarget) time.Duration {
+	if target.IntervalSeconds > 0 {
+		return time.Duration(target.IntervalSeconds * float64(time.Second))
+	}
+	return s.cfg.Interval
+}
+
+// scrape fetches and ingests one target, recording the outcome in its
+// status and in the ScrapeNamespace series.
+func (s *Scraper) scrape(ctx context.Context, state *scrapeState) {
+	s.mu.Lock()
+	target, previous := state.target, state.counters
+	s.mu.Unlock()
+
+	start := s.now()
+	samples, err := s.fetch(ctx, target)
+	var counters map[string]float64
+	ingested := 0
+	if err == nil {
+		counters = make(map[string]float64)
+		ingested = s.ingest(target, samples, previous, counters, start)
+	}
+	elapsed := s.now().Sub(start)
+
+	s.mu.Lock()
+	if current, ok := s.targets[target.Name]; !ok || current != state {
+		// Deleted or replaced while it was scraped.
+		s.mu.Unlock()
+		return
+	}
+	status := &state.status
+	status.LastScrape = start
+	status.LastDurationMS = float64(elapsed) / float64(time.Millisecond)
+	status.Samples = ingested
+	if err != nil {
+		if status.Failures == 0 {
+			s.logger.Printf("scrape %s: %v", target.Name, err)
+		}
+		status.Health = ScrapeDown
+		status.LastError = err.Error()
+		status.Failures++
+	} else {
+		status.Health = ScrapeUp
+		status.LastError = ""
+		status.Failures = 0
+		state.counters = counters
+	}
+	s.mu.Unlock()
+
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	labels := map[string]string{"target": target.Name}
+	for name, value := range map[string]float64{"up": up, "duration_seconds": elapsed.Seconds(), "samples": float64(ingested)} {
+		_, _ = s.agg.Ingest(MetricEvent{Namespace: ScrapeNamespace, Name: name, Type: MetricTypeGauge, Value: value, Labels: labels, Timestamp: start})
+	}
+}
+
+func (s *Scraper) fetch(ctx context.Context, target ScrapeTarget) ([]promSample, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", prometheusTextType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxScrapeBytes {
+		return nil, fmt.Errorf("response larger than %d bytes", maxScrapeBytes)
+	}
+	samples, err := parsePrometheusText(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if len(samples) > s.cfg.SampleLimit {
+		return nil, fmt.Errorf("%d samples exceed the limit of %d", len(samples), s.cfg.SampleLimit)
+	}
+	return samples, nil
+}
+
+// ingest records samples for target, remembering counter values in
+// counters, and returns how many the aggregator accepted.
+func (s *Scraper) ingest(target ScrapeTarget, samples []promSample, previous, counters map[string]float64, now time.Time) int {
+	namespace := target.Namespace
+	if namespace == "" {
+		namespace = target.Name
+	}
+	ingested := 0
+	for _, sample := range samples {
+		if sample.kind == promSkip || math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+			continue
+		}
+		labels := sample.labels
+		if len(target.Labels) > 0 {
+			labels = cloneLabels(labels)
+			if labels == nil {
+				labels = make(map[string]string, len(target.Labels))
+			}
+			for k, v := range target.Labels {
+				labels[k] = v
+			}
+		}
+		event := MetricEvent{Namespace: namespace, Name: sample.name, Type: MetricTypeGauge, Value: sample.value, Labels: labels, Timestamp: now}
+		if sample.kind == promCounter {
+			key := eventKey(event)
+			counters[key] = sample.value
+			event.Type = MetricTypeCounter
+			last, seen := previous[key]
+			switch {
+			case !seen:
+				event.Value = 0
+			case sample.value >= last:
+				event.Value = sample.value - last
+			}
+			// A value below the last means the target restarted and its
+			// counter began again from 0, so all of it is new.
+		}
+		if _, err := s.agg.Ingest(event); err == nil {
+			ingested++
+		}
+	}
+	return ingested
+}
+
+// promKind is how a scraped sample is recorded.
+type promKind int
+
+const (
+	promGauge promKind = iota
+	promCounter
+	promSkip
+)
+
+type promSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+	kind   promKind
+}
+
+// parsePrometheusText parses the Prometheus text exposition format (and
+// the OpenMetrics text format, which differs only in ways it ignores).
+// Timestamps are dropped: samples are recorded at the time of the scrape.
+func parsePrometheusText(text string) ([]promSample, error) {
+	types := make(map[string]string)
+	var samples []promSample
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		sample.name, sample.kind = classify(sample.name, sample.labels, types)
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
+// classify decides how a sample is recorded from its family's declared
+// type, returning the name it is recorded under.
+func classify(name string, labels map[string]string, types map[string]string) (string, promKind) {
+	if typ, ok := types[name]; ok {
+		// A sample named for its family is a counter's value in the 0.0.4
+		// format, a summary's quantile, or a gauge.
+		if typ == "counter" {
+			return strings.TrimSuffix(name, "_total"), promCounter
+		}
+		return name, promGauge
+	}
+	for _, suffix := range []string{"_total", "_bucket", "_sum", "_count", "_created"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		switch types[family] {
+		case "counter":
+			if suffix == "_total" {
+				return family, promCounter
+			}
+			return name, promSkip
+		case "histogram", "summary":
+			switch suffix {
+			case "_sum", "_count":
+				return name, promCounter
+			}
+			return name, promSkip
+		}
+	}
+	if _, ok := labels["le"]; ok && strings.HasSuffix(name, "_bucket") {
+		return name, promSkip
+	}
+	return name, promGauge
+}
+
+// parseSample parses `name{label="value",...} value [timestamp]`.
+func parseSample(line string) (promSample, error) {
+	var sample promSample
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, errors.New("expected a metric name and value")
+	}
+	sample.name, line = line[:end], line[end:]
+	if strings.HasPrefix(line, "{") {
+		labels, rest, err := parseLabels(line[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.labels, line = labels, rest
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("metric %s has no value", sample.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("metric %s: invalid value %q", sample.name, fields[0])
+	}
+	sample.value = value
+	return sample, nil
+}
+
+// parseLabels parses label pairs up to the closing brace, returning what
+// follows it.
+func parseLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || len(s) < eq+2 || s[eq+1] != '"' {
+			return nil, "", errors.New("malformed label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+		var b strings.Builder
+		closed := false
+		for i := 0; i < len(s); i++ {
+			c := s[i]
+			if c == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				default:
+					b.WriteByte(s[i])
+				}
+				continue
+			}
+			if c == '"' {
+				s, closed = s[i+1:], true
+				break
+			}
+			b.WriteByte(c)
+		}
+		if !closed {
+			return nil, "", errors.New("unterminated label value")
+		}
+		labels[name] = b.String()
+		s = strings.TrimLeft(s, " \t")
+		s = strings.TrimPrefix(s, ",")
+	}
+}
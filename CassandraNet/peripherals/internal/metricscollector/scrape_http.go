@@ -0,0 +1,111 @@
+package metricscollector
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const (
+	scrapeTargetsPath   = "/scrape/targets"
+	scrapeTargetsPrefix = "/scrape/targets/"
+)
+
+// Handler exposes scrape target management and health endpoints.
+func (s *Scraper) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(scrapeTargetsPath, s.handleTargets)
+	mux.HandleFunc(scrapeTargetsPrefix, s.handleTargetByName)
+	return mux
+}
+
+func (s *Scraper) handleTargets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		targets := s.Targets()
+		if health := r.URL.Query().Get("health"); health != "" {
+			filtered := targets[:0]
+			for _, target := range targets {
+				if string(target.Health) == health {
+					filtered = append(filtered, target)
+				}
+			}
+			targets = filtered
+		}
+		writeAlertJSON(w, http.StatusOK, targets)
+	case http.MethodPost:
+		defer r.Body.Close()
+		var target ScrapeTarget
+		if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+			problem.DecodeFailed(w, r, "metrics.invalid_json", "invalid json", err)
+			return
+		}
+		var before any
+		if previous, ok := s.Target(target.Name); ok {
+			before = previous.ScrapeTarget
+		}
+		if err := s.PutTarget(target); err != nil {
+			invalidRequest(w, r, err)
+			return
+		}
+		s.audit.Record(r.Context(), audit.Change{
+			Action:   "metrics.scrape_target.put",
+			Resource: "scrape/targets/" + target.Name,
+			Before:   before,
+			After:    target,
+		})
+		writeAlertJSON(w, http.StatusCreated, target)
+	default:
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleTargetByName serves /scrape/targets/{name}, and
+// /scrape/targets/{name}/scrape to scrape the target at once.
+func (s *Scraper) handleTargetByName(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, scrapeTargetsPrefix)
+	name, action, _ := strings.Cut(name, "/")
+	if name == "" || (action != "" && action != "scrape") {
+		problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "resource not found")
+		return
+	}
+	if action == "scrape" {
+		if r.Method != http.MethodPost {
+			problem.MethodNotAllowed(w, r, "metrics", http.MethodPost)
+			return
+		}
+		status, err := s.Scrape(r.Context(), name)
+		if err != nil {
+			problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "scrape target not found")
+			return
+		}
+		writeAlertJSON(w, http.StatusOK, status)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		status, ok := s.Target(name)
+		if !ok {
+			problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "scrape target not found")
+			return
+		}
+		writeAlertJSON(w, http.StatusOK, status)
+	case http.MethodDelete:
+		target, ok := s.DeleteTarget(name)
+		if !ok {
+			problem.Write(w, r, http.StatusNotFound, "metrics.not_found", "scrape target not found")
+			return
+		}
+		s.audit.Record(r.Context(), audit.Change{
+			Action:   "metrics.scrape_target.delete",
+			Resource: "scrape/targets/" + name,
+			Before:   target,
+		})
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		problem.MethodNotAllowed(w, r, "metrics", http.MethodGet, http.MethodDelete)
+	}
+}
@@ -0,0 +1,221 @@
+package metricscollector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// promTarget serves body as a Prometheus exposition, or fails with status
+// when it is set.
+type promTarget struct {
+	mu     sync.Mutex
+	body   string
+	status int
+}
+
+func (p *promTarget) set(body string, status int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.body, p.status = body, status
+}
+
+func (p *promTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status != 0 {
+		w.WriteHeader(p.status)
+		return
+	}
+	w.Header().Set("Content-Type", prometheusTextType)
+	_, _ = w.Write([]byte(p.body))
+}
+
+func querySum(t *testing.T, agg *Aggregator, namespace, name string, labels map[string]string) Summary {
+	t.Helper()
+	for _, series := range agg.Query(Query{Namespace: namespace, Name: name}) {
+		if len(series.Labels) != len(labels) {
+			continue
+		}
+		match := true
+		for k, v := range labels {
+			match = match && series.Labels[k] == v
+		}
+		if match {
+			return series.Summary
+		}
+	}
+	t.Fatalf("no series %s/%s%v", namespace, name, labels)
+	return Summary{}
+}
+
+func TestScraperIngestsCountersAsIncreases(t *testing.T) {
+	target := &promTarget{}
+	server := httptest.NewServer(target)
+	t.Cleanup(server.Close)
+	agg := NewAggregator()
+	scraper := NewScraper(agg, ScrapeConfig{}, testLogger{})
+	if err := scraper.PutTarget(ScrapeTarget{Name: "ugc", URL: server.URL, Labels: map[string]string{"env": "test"}}); err != nil {
+		t.Fatalf("put target: %v", err)
+	}
+
+	target.set(`# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{route="/a",env="prod"} 10
+# TYPE queue_depth gauge
+queue_depth 4
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 3
+latency_seconds_bucket{le="+Inf"} 5
+latency_seconds_sum 1.5
+latency_seconds_count 5
+untyped_value{path="a\"b"} 7 1700000000000
+nan_value NaN
+`, 0)
+	status, err := scraper.Scrape(context.Background(), "ugc")
+	if err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	if status.Health != ScrapeUp || status.Samples != 5 {
+		t.Fatalf("expected a healthy scrape of 5 samples, got %+v", status)
+	}
+	requests := map[string]string{"route": "/a", "env": "test"}
+	if got := querySum(t, agg, "ugc", "http_requests", requests); got.Type != MetricTypeCounter || got.Sum != 0 {
+		t.Fatalf("expected the first scrape to record no increase, got %+v", got)
+	}
+	if got := querySum(t, agg, "ugc", "queue_depth", map[string]string{"env": "test"}); got.LastValue != 4 {
+		t.Fatalf("expected the gauge as scraped, got %+v", got)
+	}
+	if got := querySum(t, agg, "ugc", "untyped_value", map[string]string{"env": "test", "path": `a"b`}); got.LastValue != 7 {
+		t.Fatalf("expected the untyped sample as a gauge, got %+v", got)
+	}
+	if series := agg.Query(Query{Namespace: "ugc", Name: "latency_seconds_bucket"}); len(series) != 0 {
+		t.Fatalf("expected histogram buckets skipped, got %+v", series)
+	}
+
+	target.set("# TYPE http_requests_total counter\nhttp_requests_total{route=\"/a\"} 25\n# TYPE latency_seconds histogram\nlatency_seconds_count 8\n", 0)
+	if _, err := scraper.Scrape(context.Background(), "ugc"); err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	// Restarted: the counter began again from 0.
+	target.set("# TYPE http_requests_total counter\nhttp_requests_total{route=\"/a\"} 2\n", 0)
+	if _, err := scraper.Scrape(context.Background(), "ugc"); err != nil {
+		t.Fatalf("scrape: %v", err)
+	}
+	if got := querySum(t, agg, "ugc", "http_requests", requests); got.Sum != 17 {
+		t.Fatalf("expected increases of 15 and 2, got %+v", got)
+	}
+	if got := querySum(t, agg, "ugc", "latency_seconds_count", map[string]string{"env": "test"}); got.Sum != 3 {
+		t.Fatalf("expected the histogram count's increase, got %+v", got)
+	}
+	if got := querySum(t, agg, ScrapeNamespace, "up", map[string]string{"target": "ugc"}); got.LastValue != 1 {
+		t.Fatalf("expected the target up, got %+v", got)
+	}
+}
+
+func TestScraperReportsFailedScrapes(t *testing.T) {
+	target := &promTarget{}
+	server := httptest.NewServer(target)
+	t.Cleanup(server.Close)
+	agg := NewAggregator()
+	scraper := NewScraper(agg, ScrapeConfig{SampleLimit: 1}, testLogger{})
+	if err := scraper.PutTarget(ScrapeTarget{Name: "ugc", URL: server.URL}); err != nil {
+		t.Fatalf("put target: %v", err)
+	}
+
+	target.set("", http.StatusInternalServerError)
+	scraper.Scrape(context.Background(), "ugc")
+	target.set("a 1\nb 2\n", 0)
+	status, _ := scraper.Scrape(context.Background(), "ugc")
+	if status.Health != ScrapeDown || status.Failures != 2 || status.LastError == "" {
+		t.Fatalf("expected two failures, the last over the sample limit, got %+v", status)
+	}
+	if got := querySum(t, agg, ScrapeNamespace, "up", map[string]string{"target": "ugc"}); got.LastValue != 0 {
+		t.Fatalf("expected the target down, got %+v", got)
+	}
+
+	target.set("garbage{ 1\n", 0)
+	if status, _ := scraper.Scrape(context.Background(), "ugc"); status.Health != ScrapeDown {
+		t.Fatalf("expected a malformed exposition to fail, got %+v", status)
+	}
+	if _, err := scraper.Scrape(context.Background(), "missing"); err != ErrTargetNotFound {
+		t.Fatalf("expected ErrTargetNotFound, got %v", err)
+	}
+}
+
+func TestScraperHandler(t *testing.T) {
+	target := &promTarget{}
+	target.set("# TYPE up_total counter\nup_total 1\n", 0)
+	upstream := httptest.NewServer(target)
+	t.Cleanup(upstream.Close)
+	scraper := NewScraper(NewAggregator(), ScrapeConfig{}, testLogger{})
+	server := httptest.NewServer(scraper.Handler())
+	t.Cleanup(server.Close)
+
+	post := func(path string, body any) *http.Response {
+		t.Helper()
+		payload, _ := json.Marshal(body)
+		resp, err := http.Post(server.URL+path, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := post("/scrape/targets", ScrapeTarget{Name: "bad", URL: "ftp://example.com"}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-http URL, got %d", resp.StatusCode)
+	}
+	if resp := post("/scrape/targets", ScrapeTarget{Name: "ugc", URL: upstream.URL}); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	if resp := post("/scrape/targets/ugc/scrape", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 scraping, got %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(server.URL + "/scrape/targets?health=up")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	var targets []TargetStatus
+	if err := json.NewDecoder(resp.Body).Decode(&targets); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	if len(targets) != 1 || targets[0].Name != "ugc" || targets[0].Samples != 1 {
+		t.Fatalf("expected the healthy target, got %+v", targets)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/scrape/targets/ugc", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	resp, err = http.Get(server.URL + "/scrape/targets/ugc")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 after delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestParseScrapeTarget(t *testing.T) {
+	target, err := ParseScrapeTarget("ugc=http://ugc-service:8091/metrics")
+	if err != nil || target.Name != "ugc" || target.URL != "http://ugc-service:8091/metrics" {
+		t.Fatalf("unexpected target %+v, %v", target, err)
+	}
+	for _, spec := range []string{"ugc", "=http://x/metrics", "ugc=/metrics"} {
+		if _, err := ParseScrapeTarget(spec); err == nil {
+			t.Fatalf("expected %q rejected", spec)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package metricscollector
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// window aggregates the samples a series received during one WindowSize
+// interval. Bucket counts are kept for histogram series only.
+type window struct {
+	index   int64
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+func (a *Aggregator) recordWindowLocked(entry *series, value float64, at time.Time) {
+	if entry.windows == nil {
+		entry.windows = make([]window, a.cfg.WindowCount)
+	}
+	index := at.UnixNano() / int64(a.cfg.WindowSize)
+	slot := &entry.windows[index%int64(len(entry.windows))]
+	if slot.index != index {
+		*slot = window{index: index}
+	}
+	slot.count++
+	slot.sum += value
+	if entry.summary.Type != MetricTypeHistogram {
+		return
+	}
+	if slot.buckets == nil {
+		slot.buckets = make([]uint64, len(a.cfg.HistogramBuckets)+1)
+	}
+	idx := sort.SearchFloat64s(a.cfg.HistogramBuckets, value)
+	slot.buckets[idx]++
+}
+
+// RetentionPolicy names the policy RegisterRetention registers.
+const RetentionPolicy = "metrics.windows"
+
+// CompactWindows releases the window rings of series whose newest window
+// ended before cutoff, keeping their summaries, and returns how many rings
+// it released; with dryRun it only counts them. Windows that old fall
+// outside every top-K and heatmap lookback once cutoff is a full ring
+// back, so the rings of series that stopped receiving samples are dead
+// weight.
+func (a *Aggregator) CompactWindows(cutoff time.Time, dryRun bool) int {
+	last := cutoff.UnixNano() / int64(a.cfg.WindowSize)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	compacted := 0
+	for _, entry := range a.metrics {
+		if entry.windows == nil {
+			continue
+		}
+		newest := int64(math.MinInt64)
+		for _, w := range entry.windows {
+			if w.count > 0 && w.index > newest {
+				newest = w.index
+			}
+		}
+		if newest >= last {
+			continue
+		}
+		compacted++
+		if !dryRun {
+			entry.windows = nil
+		}
+	}
+	return compacted
+}
+
+// RegisterRetention registers RetentionPolicy with m, compacting windows
+// once they are a full ring (WindowSize × WindowCount) old unless
+// RETENTION_MAX_AGES says otherwise.
+func (a *Aggregator) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        RetentionPolicy,
+		Description: "rolling windows of series that received no sample since the cutoff",
+		MaxAge:      a.cfg.WindowSize * time.Duration(a.cfg.WindowCount),
+		Purge: func(_ context.Context, cutoff time.Time, dryRun bool) (int, error) {
+			return a.CompactWindows(cutoff, dryRun), nil
+		},
+	})
+}
+
+// windowRange converts a lookback duration into the inclusive range of
+// window indexes ending at now, clamped to the retained windows.
+func (a *Aggregator) windowRange(now time.Time, lookback time.Duration) (int64, int64) {
+	last := now.UnixNano() / int64(a.cfg.WindowSize)
+	n := int64(lookback / a.cfg.WindowSize)
+	if lookback%a.cfg.WindowSize != 0 {
+		n++
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if n > int64(a.cfg.WindowCount) {
+		n = int64(a.cfg.WindowCount)
+	}
+	return last - n + 1, last
+}
+
+// RankBy selects the statistic used to order top-K results.
+type RankBy string
+
+const (
+	// RankByValue orders by the mean sample value within the lookback.
+	RankByValue RankBy = "value"
+	// RankByRate orders by the per-second sum of samples within the lookback.
+	RankByRate RankBy = "rate"
+)
+
+// ParseRankBy converts user supplied strings into RankBy values.
+func ParseRankBy(value string) (RankBy, error) {
+	switch strings.ToLower(value) {
+	case "", string(RankByValue):
+		return RankByValue, nil
+	case string(RankByRate):
+		return RankByRate, nil
+	default:
+		return "", validation.Invalid("by", validation.RuleOneOf, "must be one of value, rate")
+	}
+}
+
+// RankedSeries is a single entry of a top-K result.
+type RankedSeries struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Score     float64           `json:"score"`
+	Count     uint64            `json:"count"`
+	Sum       float64           `json:"sum"`
+}
+
+// TopK returns up to k series selected by q ranked by the given statistic
+// over the trailing lookback period. Series without samples in the period
+// are skipped.
+func (a *Aggregator) TopK(q Query, k int, by RankBy, lookback time.Duration) []RankedSeries {
+	now := a.now()
+	first, last := a.windowRange(now, lookback)
+	seconds := float64(last-first+1) * a.cfg.WindowSize.Seconds()
+
+	a.mu.RLock()
+	var ranked []RankedSeries
+	for _, entry := range a.metrics {
+		if !q.selects(entry) {
+			continue
+		}
+		var count uint64
+		var sum float64
+		for _, w := range entry.windows {
+			if w.count > 0 && w.index >= first && w.index <= last {
+				count += w.count
+				sum += w.sum
+			}
+		}
+		if count == 0 {
+			continue
+		}
+		res := RankedSeries{
+			Namespace: entry.namespace,
+			Name:      entry.name,
+			Labels:    cloneLabels(entry.labels),
+			Count:     count,
+			Sum:       sum,
+		}
+		switch by {
+		case RankByRate:
+			res.Score = sum / seconds
+		default:
+			res.Score = sum / float64(count)
+		}
+		ranked = append(ranked, res)
+	}
+	a.mu.RUnlock()
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return eventKey(MetricEvent{Namespace: ranked[i].Namespace, Name: ranked[i].Name, Labels: ranked[i].Labels}) <
+			eventKey(MetricEvent{Namespace: ranked[j].Namespace, Name: ranked[j].Name, Labels: ranked[j].Labels})
+	})
+	if k > 0 && len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	return ranked
+}
+
+// Heatmap is a time × bucket matrix of histogram sample counts.
+type Heatmap struct {
+	// Bounds are the bucket upper bounds; the final count in every slot
+	// covers samples above the last bound.
+	Bounds      []float64     `json:"bounds"`
+	StepSeconds float64       `json:"step_seconds"`
+	Series      int           `json:"series"`
+	Slots       []HeatmapSlot `json:"slots"`
+}
+
+// HeatmapSlot holds the bucket counts for one time step.
+type HeatmapSlot struct {
+	Start  time.Time `json:"start"`
+	Counts []uint64  `json:"counts"`
+}
+
+// Heatmap sums the windowed bucket counts of every histogram series selected
+// by q over the trailing lookback period. step is rounded up to a multiple of
+// the window size; slots are returned oldest first, including empty ones.
+func (a *Aggregator) Heatmap(q Query, lookback, step time.Duration) Heatmap {
+	now := a.now()
+	first, last := a.windowRange(now, lookback)
+	perStep := int64(step / a.cfg.WindowSize)
+	if step%a.cfg.WindowSize != 0 || perStep == 0 {
+		perStep++
+	}
+	slotCount := (last - first + perStep) / perStep
+	width := len(a.cfg.HistogramBuckets) + 1
+
+	heatmap := Heatmap{
+		Bounds:      append([]float64(nil), a.cfg.HistogramBuckets...),
+		StepSeconds: (time.Duration(perStep) * a.cfg.WindowSize).Seconds(),
+		Slots:       make([]HeatmapSlot, slotCount),
+	}
+	// Align slots to the newest window so the last slot always ends now.
+	base := last - slotCount*perStep + 1
+	for i := range heatmap.Slots {
+		heatmap.Slots[i] = HeatmapSlot{
+			Start:  time.Unix(0, (base+int64(i)*perStep)*int64(a.cfg.WindowSize)).UTC(),
+			Counts: make([]uint64, width),
+		}
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, entry := range a.metrics {
+		if entry.summary.Type != MetricTypeHistogram || !q.selects(entry) {
+			continue
+		}
+		heatmap.Series++
+		for _, w := range entry.windows {
+			if w.buckets == nil || w.index < first || w.index > last || w.index < base {
+				continue
+			}
+			slot := heatmap.Slots[(w.index-base)/perStep]
+			for i, c := range w.buckets {
+				slot.Counts[i] += c
+			}
+		}
+	}
+	return heatmap
+}
@@ -0,0 +1,311 @@
+// Package netacl restricts administrative endpoints by client address. An
+// ACL holds CIDR allow and deny lists and the paths they guard; requests to
+// those paths from a denied address, or from one outside a non-empty allow
+// list, are refused before authentication runs, so credentials leaked to
+// the wrong network are useless there:
+//
+//	acl, err := netacl.FromConfig(loader, "/debug/", "/audit", "/notifications/templates/")
+//	handler := acl.Middleware(mux)
+//
+// Behind load balancers or the gateway the connecting address is a proxy's.
+// Addresses listed as trusted proxies are skipped when reading
+// X-Forwarded-For, so the client is the last address a trusted proxy saw.
+package netacl
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// CodeForbidden is the problem code of refused requests.
+const CodeForbidden = "server.ip_forbidden"
+
+// DefaultPaths are guarded by every binary: runtime debugging and the audit
+// log.
+var DefaultPaths = []string{"/debug/", "/audit"}
+
+// Config configures an ACL.
+type Config struct {
+	// Allow, when not empty, lists the only networks admitted.
+	Allow []netip.Prefix
+	// Deny lists networks refused even when Allow admits them.
+	Deny []netip.Prefix
+	// TrustedProxies lists networks whose X-Forwarded-For is believed.
+	TrustedProxies []netip.Prefix
+	// Paths are the routes Middleware guards, each "[METHOD ]/prefix". A
+	// "*" segment matches any one segment, and a trailing "$" matches
+	// the path only in full.
+	Paths []string
+}
+
+// FromConfig reads ACL_ALLOW, ACL_DENY, and TRUSTED_PROXIES (CIDRs or bare
+// addresses) and ACL_PATHS from loader. ACL_PATHS defaults to DefaultPaths
+// followed by paths, the binary's own administrative routes. Malformed
+// networks are reported rather than ignored.
+func FromConfig(loader config.Loader, paths ...string) (*ACL, error) {
+	a := &ACL{paths: append(append([]string(nil), DefaultPaths...), paths...)}
+	cfg, err := a.configFrom(loader)
+	if err != nil {
+		return nil, err
+	}
+	a.cfg.Store(&cfg)
+	return a, nil
+}
+
+func (a *ACL) configFrom(loader config.Loader) (Config, error) {
+	var cfg Config
+	var err error
+	if cfg.Allow, err = parsePrefixes(loader, "ACL_ALLOW"); err != nil {
+		return Config{}, err
+	}
+	if cfg.Deny, err = parsePrefixes(loader, "ACL_DENY"); err != nil {
+		return Config{}, err
+	}
+	if cfg.TrustedProxies, err = parsePrefixes(loader, "TRUSTED_PROXIES"); err != nil {
+		return Config{}, err
+	}
+	cfg.Paths = loader.StringSlice("ACL_PATHS", a.paths)
+	for _, path := range cfg.Paths {
+		if _, pattern := splitMethod(path); !strings.HasPrefix(pattern, "/") {
+			return Config{}, fmt.Errorf("ACL_PATHS: %q must start with /", path)
+		}
+	}
+	return cfg, nil
+}
+
+func parsePrefixes(loader config.Loader, key string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, spec := range loader.StringSlice(key, nil) {
+		prefix, err := ParsePrefix(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s%s: %w", loader.Prefix, key, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// ParsePrefix parses a CIDR such as "10.0.0.0/8", or a bare address, which
+// stands for itself alone.
+func ParsePrefix(spec string) (netip.Prefix, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid network %q", spec)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(spec)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q", spec)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// ACL enforces a Config.
+type ACL struct {
+	cfg   atomic.Pointer[Config]
+	paths []string
+}
+
+// New returns an ACL for cfg.
+func New(cfg Config) *ACL {
+	a := &ACL{paths: cfg.Paths}
+	a.cfg.Store(&cfg)
+	return a
+}
+
+// Reload prepares the lists and paths from loader for server.Reloader.
+// ACL_PATHS falls back to the paths the ACL was created with.
+func (a *ACL) Reload(loader config.Loader) (func(), error) {
+	cfg, err := a.configFrom(loader)
+	if err != nil {
+		return nil, err
+	}
+	return func() { a.cfg.Store(&cfg) }, nil
+}
+
+// Enabled reports whether any address can be refused.
+func (a *ACL) Enabled() bool {
+	return a.cfg.Load().enabled()
+}
+
+func (cfg *Config) enabled() bool {
+	return len(cfg.Allow) > 0 || len(cfg.Deny) > 0
+}
+
+// Allowed reports whether addr may reach guarded paths. Invalid addresses
+// are only allowed when the ACL is disabled.
+func (a *ACL) Allowed(addr netip.Addr) bool {
+	return a.cfg.Load().allowed(addr)
+}
+
+func (cfg *Config) allowed(addr netip.Addr) bool {
+	if !cfg.enabled() {
+		return true
+	}
+	if !addr.IsValid() || contains(cfg.Deny, addr) {
+		return false
+	}
+	return len(cfg.Allow) == 0 || contains(cfg.Allow, addr)
+}
+
+// ClientIP returns the address r came from: the connecting address, or,
+// when that is a trusted proxy, the rightmost X-Forwarded-For entry that is
+// not one.
+func (a *ACL) ClientIP(r *http.Request) netip.Addr {
+	return a.cfg.Load().clientIP(r)
+}
+
+func (cfg *Config) clientIP(r *http.Request) netip.Addr {
+	addr := parseAddr(r.RemoteAddr)
+	if !contains(cfg.TrustedProxies, addr) {
+		return addr
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := parseAddr(strings.TrimSpace(forwarded[i]))
+		if !hop.IsValid() {
+			return addr
+		}
+		addr = hop
+		if !contains(cfg.TrustedProxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// Middleware refuses requests to guarded paths from addresses the ACL
+// does not allow with 403 Forbidden. Paths match as sent or with their API
+// version segment removed. Each request uses the configuration current
+// when it arrives.
+func (a *ACL) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.cfg.Load()
+		if !cfg.enabled() || !cfg.guards(r.Method, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cfg.check(w, r, next)
+	})
+}
+
+// Require refuses every request from addresses the ACL does not allow,
+// for listeners that only serve administrative endpoints.
+func (a *ACL) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.cfg.Load().check(w, r, next)
+	})
+}
+
+func (cfg *Config) check(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	addr := cfg.clientIP(r)
+	if cfg.allowed(addr) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	if logger, ok := logging.FromContext(r.Context()); ok {
+		logger.Warn("refused request from address outside the access list", "client_ip", addr.String(), "path", r.URL.Path)
+	}
+	problem.Write(w, r, http.StatusForbidden, CodeForbidden, "this endpoint is not reachable from "+addr.String())
+}
+
+func (cfg *Config) guards(method, path string) bool {
+	unversioned := apiversion.Trim(path)
+	for _, route := range cfg.Paths {
+		routeMethod, pattern := splitMethod(route)
+		if routeMethod != "" && routeMethod != method {
+			continue
+		}
+		if matchPath(pattern, path) || matchPath(pattern, unversioned) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mount returns paths as guarded under prefix, where a gateway mounts the
+// service serving them.
+func Mount(prefix string, paths ...string) []string {
+	mounted := make([]string, len(paths))
+	for i, path := range paths {
+		method, pattern := splitMethod(path)
+		mounted[i] = strings.TrimSpace(method + " " + prefix + pattern)
+	}
+	return mounted
+}
+
+// splitMethod splits "[METHOD ]/pattern" into its method, empty when
+// there is none, and pattern.
+func splitMethod(route string) (string, string) {
+	route = strings.TrimSpace(route)
+	if method, pattern, ok := strings.Cut(route, " "); ok {
+		return strings.ToUpper(method), strings.TrimSpace(pattern)
+	}
+	return "", route
+}
+
+// matchPath reports whether path starts with pattern, whose "*" segments
+// match any one non-empty segment, or equals it when pattern ends in "$".
+func matchPath(pattern, path string) bool {
+	pattern, anchored := strings.CutSuffix(pattern, "$")
+	if !strings.Contains(pattern, "*") {
+		if anchored {
+			return path == pattern
+		}
+		return strings.HasPrefix(path, pattern)
+	}
+	want, got := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(got) < len(want) || anchored && len(got) != len(want) {
+		return false
+	}
+	for i, segment := range want {
+		switch {
+		case segment == "*":
+			if got[i] == "" {
+				return false
+			}
+		case i == len(want)-1 && !anchored:
+			if !strings.HasPrefix(got[i], segment) {
+				return false
+			}
+		case got[i] != segment:
+			return false
+		}
+	}
+	return true
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr reads an address with or without a port, returning the zero
+// Addr for anything else, such as the "@" of Unix socket connections.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
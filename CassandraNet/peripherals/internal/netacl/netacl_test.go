@@ -0,0 +1,205 @@
+package netacl
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+func prefixes(t *testing.T, specs ...string) []netip.Prefix {
+	t.Helper()
+	var out []netip.Prefix
+	for _, spec := range specs {
+		prefix, err := ParsePrefix(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, prefix)
+	}
+	return out
+}
+
+func TestParsePrefix(t *testing.T) {
+	cases := map[string]string{
+		"10.1.2.3/8":       "10.0.0.0/8",
+		" 192.168.0.7 ":    "192.168.0.7/32",
+		"::ffff:127.0.0.1": "127.0.0.1/32",
+		"2001:db8::/32":    "2001:db8::/32",
+	}
+	for spec, want := range cases {
+		prefix, err := ParsePrefix(spec)
+		if err != nil || prefix.String() != want {
+			t.Errorf("ParsePrefix(%q) = %v, %v; want %s", spec, prefix, err, want)
+		}
+	}
+	for _, spec := range []string{"", "10.0.0.0/33", "example.com", "10.0.0/8"} {
+		if _, err := ParsePrefix(spec); err == nil {
+			t.Errorf("ParsePrefix(%q): expected an error", spec)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	acl := New(Config{TrustedProxies: prefixes(t, "10.0.0.0/8")})
+	cases := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+	}{
+		{"direct", "203.0.113.5:4000", nil, "203.0.113.5"},
+		{"untrusted peer ignores header", "203.0.113.5:4000", []string{"198.51.100.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed left entries", "10.0.0.2:4000", []string{"127.0.0.1, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"repeated headers", "10.0.0.2:4000", []string{"127.0.0.1", "198.51.100.1"}, "198.51.100.1"},
+		{"malformed hop", "10.0.0.2:4000", []string{"198.51.100.1, bogus"}, "10.0.0.2"},
+		{"only proxies", "10.0.0.2:4000", []string{"10.0.0.9"}, "10.0.0.9"},
+		{"ipv6 peer", "[2001:db8::1]:4000", nil, "2001:db8::1"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		for _, v := range tc.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		if got := acl.ClientIP(req).String(); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	acl := New(Config{
+		Allow: prefixes(t, "10.0.0.0/8", "192.0.2.7"),
+		Deny:  prefixes(t, "10.9.0.0/16"),
+		Paths: []string{"/debug/", "/notifications/templates/", "/routes", "PUT /topics/*$", "DELETE /topics/*/key"},
+	})
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := acl.Middleware(ok)
+
+	cases := []struct {
+		remote string
+		path   string
+		status int
+	}{
+		{"203.0.113.5:1", "/notifications/send", http.StatusOK},
+		{"203.0.113.5:1", "/notifications/templates/welcome", http.StatusForbidden},
+		{"203.0.113.5:1", "/v1/notifications/templates/welcome", http.StatusForbidden},
+		{"203.0.113.5:1", "/routes/acme/r1", http.StatusForbidden},
+		{"203.0.113.5:1", "/topics/jobs", http.StatusOK},
+		{"203.0.113.5:1", "/topics/jobs/messages", http.StatusOK},
+		{"10.1.2.3:1", "/debug/config", http.StatusOK},
+		{"192.0.2.7:1", "/debug/config", http.StatusOK},
+		{"10.9.1.1:1", "/debug/config", http.StatusForbidden},
+		{"@", "/debug/config", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: got %d, want %d", tc.remote, tc.path, rec.Code, tc.status)
+		}
+		if tc.status == http.StatusForbidden && !strings.Contains(rec.Body.String(), CodeForbidden) {
+			t.Errorf("%s %s: body %s lacks %s", tc.remote, tc.path, rec.Body, CodeForbidden)
+		}
+	}
+
+	// Routes naming a method guard only it.
+	for _, tc := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodPut, "/topics/jobs", http.StatusForbidden},
+		{http.MethodPut, "/v1/topics/jobs", http.StatusForbidden},
+		{http.MethodPut, "/topics/jobs/subscriptions/s1", http.StatusOK},
+		{http.MethodDelete, "/topics/jobs/key", http.StatusForbidden},
+		{http.MethodGet, "/topics/jobs/key", http.StatusOK},
+		{http.MethodDelete, "/topics//key", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.RemoteAddr = "203.0.113.5:1"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: got %d, want %d", tc.method, tc.path, rec.Code, tc.status)
+		}
+	}
+
+	if got := Mount("/messaging", "/routes", "PUT /topics/*$"); strings.Join(got, ",") != "/messaging/routes,PUT /messaging/topics/*$" {
+		t.Errorf("Mount: got %q", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/anything", nil)
+	req.RemoteAddr = "203.0.113.5:1"
+	rec := httptest.NewRecorder()
+	acl.Require(ok).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Require: got %d, want 403", rec.Code)
+	}
+}
+
+func TestDisabledPassesThrough(t *testing.T) {
+	acl := New(Config{Paths: DefaultPaths, TrustedProxies: prefixes(t, "10.0.0.0/8")})
+	if acl.Enabled() {
+		t.Fatal("ACL without allow or deny lists reports enabled")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/debug/config", nil)
+	req.RemoteAddr = "@"
+	rec := httptest.NewRecorder()
+	acl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("got %d, want 200", rec.Code)
+	}
+}
+
+func TestReload(t *testing.T) {
+	loader, err := config.Load("SVC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl, err := FromConfig(loader, "/alerts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := acl.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "203.0.113.5:1"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := serve("/alerts"); code != http.StatusOK {
+		t.Fatalf("expected a disabled ACL to pass, got %d", code)
+	}
+
+	path := filepath.Join(t.TempDir(), "svc.json")
+	if err := os.WriteFile(path, []byte(`{"acl_allow": "10.0.0.0/8"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if loader, err = config.Load("SVC", path); err != nil {
+		t.Fatal(err)
+	}
+	install, err := acl.Reload(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	install()
+	if code := serve("/alerts"); code != http.StatusForbidden {
+		t.Fatalf("expected the reloaded allow list to guard /alerts, got %d", code)
+	}
+	if code := serve("/debug/config"); code != http.StatusForbidden {
+		t.Fatalf("expected the default paths kept, got %d", code)
+	}
+	if code := serve("/items"); code != http.StatusOK {
+		t.Fatalf("expected unguarded paths to pass, got %d", code)
+	}
+}
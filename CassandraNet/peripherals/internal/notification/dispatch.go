@@ -0,0 +1,206 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// ErrChannelBusy is returned by Send when a channel's queue is full, or
+// the caller gave up while waiting for a turn.
+var ErrChannelBusy = errors.New("notification: channel busy")
+
+// ChannelLimits caps how one channel's sender is called, so a slow
+// provider holds up only its own channel's sends. Zero fields leave that
+// limit off.
+type ChannelLimits struct {
+	// Concurrency is the most sends in progress at once.
+	Concurrency int `json:"concurrency"`
+	// Rate is the most sends started per second.
+	Rate float64 `json:"rate"`
+	// Queue is the most sends waiting for a turn; further sends fail with
+	// ErrChannelBusy.
+	Queue int `json:"queue"`
+}
+
+// DefaultChannelConcurrency bounds email and webhook sends unless
+// CHANNEL_CONCURRENCY says otherwise. In-app sends are unbounded.
+var DefaultChannelConcurrency = []string{"email=5", "webhook=50"}
+
+// DefaultChannelQueue is how many sends may wait per limited channel
+// unless CHANNEL_QUEUE says otherwise.
+const DefaultChannelQueue = 100
+
+// LimitsFromConfig reads CHANNEL_CONCURRENCY ("channel=sends" entries,
+// default DefaultChannelConcurrency), CHANNEL_RATES ("channel=sends per
+// second" entries), and CHANNEL_QUEUE (default DefaultChannelQueue, for
+// every limited channel). Malformed entries are reported rather than
+// ignored.
+func LimitsFromConfig(loader config.Loader) (map[Channel]ChannelLimits, error) {
+	limits := make(map[Channel]ChannelLimits)
+	queue := loader.Int("CHANNEL_QUEUE", DefaultChannelQueue)
+	err := parseChannelEntries(loader, "CHANNEL_CONCURRENCY", DefaultChannelConcurrency, "a number of sends such as 5", func(channel Channel, raw string) bool {
+		n, err := strconv.Atoi(raw)
+		l := limits[channel]
+		l.Concurrency, l.Queue = n, queue
+		limits[channel] = l
+		return err == nil && n >= 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = parseChannelEntries(loader, "CHANNEL_RATES", nil, "sends per second such as 10 or 0.5", func(channel Channel, raw string) bool {
+		rate, err := strconv.ParseFloat(raw, 64)
+		l := limits[channel]
+		l.Rate, l.Queue = rate, queue
+		limits[channel] = l
+		return err == nil && rate >= 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return limits, nil
+}
+
+// parseChannelEntries calls parse with each "channel=value" entry of key,
+// which reports whether value was valid.
+func parseChannelEntries(loader config.Loader, key string, fallback []string, want string, parse func(Channel, string) bool) error {
+	for _, spec := range loader.StringSlice(key, fallback) {
+		name, raw, ok := strings.Cut(spec, "=")
+		name, raw = strings.TrimSpace(name), strings.TrimSpace(raw)
+		channel := Channel(name)
+		if !ok || !slices.Contains(channels, channel) {
+			return fmt.Errorf("%s%s: %q must be channel=value with a channel of email, webhook, or in_app", loader.Prefix, key, spec)
+		}
+		if !parse(channel, raw) {
+			return fmt.Errorf("%s%s: %q needs %s", loader.Prefix, key, spec, want)
+		}
+	}
+	return nil
+}
+
+// channels lists every delivery channel.
+var channels = []Channel{ChannelEmail, ChannelWebhook, ChannelInApp}
+
+// ChannelStats reports one channel's limits and the sends in progress and
+// waiting on it.
+type ChannelStats struct {
+	Channel Channel `json:"channel"`
+	ChannelLimits
+	InFlight int    `json:"in_flight"`
+	Queued   int    `json:"queued"`
+	Sent     uint64 `json:"sent"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// dispatcher holds one channel's sends to its limits.
+type dispatcher struct {
+	limits ChannelLimits
+	// slots holds a token per send in progress when concurrency is
+	// limited.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// next is when the rate next lets a send start.
+	next     time.Time
+	inFlight int
+	queued   int
+	sent     uint64
+	rejected uint64
+}
+
+func newDispatcher(limits ChannelLimits) *dispatcher {
+	d := &dispatcher{limits: limits}
+	if limits.Concurrency > 0 {
+		d.slots = make(chan struct{}, limits.Concurrency)
+	}
+	return d
+}
+
+// acquire waits for a turn to send and returns the function that ends
+// it. It fails with ErrChannelBusy when the queue is full or ctx ends
+// first.
+func (d *dispatcher) acquire(ctx context.Context, clk clock.Clock) (func(), error) {
+	d.mu.Lock()
+	if d.limits.Queue > 0 && d.queued >= d.limits.Queue {
+		d.rejected++
+		d.mu.Unlock()
+		return nil, ErrChannelBusy
+	}
+	d.queued++
+	d.mu.Unlock()
+	release, err := d.wait(ctx, clk)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queued--
+	if err != nil {
+		d.rejected++
+		return nil, fmt.Errorf("%w: %w", ErrChannelBusy, err)
+	}
+	d.inFlight++
+	return release, nil
+}
+
+func (d *dispatcher) wait(ctx context.Context, clk clock.Clock) (func(), error) {
+	if d.slots != nil {
+		select {
+		case d.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		d.mu.Lock()
+		d.inFlight--
+		d.sent++
+		d.mu.Unlock()
+		if d.slots != nil {
+			<-d.slots
+		}
+	}
+	if d.limits.Rate <= 0 {
+		return release, nil
+	}
+	d.mu.Lock()
+	now := clk.Now()
+	start := now
+	if d.next.After(now) {
+		start = d.next
+	}
+	d.next = start.Add(time.Duration(float64(time.Second) / d.limits.Rate))
+	d.mu.Unlock()
+	if wait := start.Sub(now); wait > 0 {
+		timer := clk.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			if d.slots != nil {
+				<-d.slots
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+func (d *dispatcher) stats(channel Channel) ChannelStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return ChannelStats{
+		Channel:       channel,
+		ChannelLimits: d.limits,
+		InFlight:      d.inFlight,
+		Queued:        d.queued,
+		Sent:          d.sent,
+		Rejected:      d.rejected,
+	}
+}
@@ -0,0 +1,125 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// blockingSender holds each send until release is closed.
+type blockingSender struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b blockingSender) Send(Delivery) error {
+	b.started <- struct{}{}
+	<-b.release
+	return nil
+}
+
+func TestChannelLimitsKeepASlowChannelFromBlockingOthers(t *testing.T) {
+	slow := blockingSender{started: make(chan struct{}, 4), release: make(chan struct{})}
+	webhooks := NewMemorySender()
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{ChannelEmail: slow, ChannelWebhook: webhooks}, NewHistory(10), noopLogger{})
+	svc.SetChannelLimits(map[Channel]ChannelLimits{ChannelEmail: {Concurrency: 1, Queue: 1}})
+
+	ctx := context.Background()
+	email := Message{Channel: ChannelEmail, Recipient: "grace@example.com", Template: "welcome_email", Data: map[string]any{"Name": "Grace"}}
+	done := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := svc.Send(ctx, email)
+			done <- err
+		}()
+	}
+	<-slow.started
+	for svc.ChannelStats()[0].Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := svc.Send(ctx, email); !errors.Is(err, ErrChannelBusy) {
+		t.Fatalf("expected ErrChannelBusy with the queue full, got %v", err)
+	}
+	webhook := Message{Channel: ChannelWebhook, Recipient: "https://hooks.example.com", Template: "welcome_email", Data: map[string]any{"Name": "Ada"}}
+	if _, err := svc.Send(ctx, webhook); err != nil || len(webhooks.Deliveries()) != 1 {
+		t.Fatalf("expected the webhook sent while email waits, got %v", err)
+	}
+
+	close(slow.release)
+	for range 2 {
+		if err := <-done; err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	stats := svc.ChannelStats()
+	want := ChannelStats{Channel: ChannelEmail, ChannelLimits: ChannelLimits{Concurrency: 1, Queue: 1}, Sent: 2, Rejected: 1}
+	if len(stats) != 1 || stats[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestChannelRateSpacesSends(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	sender := NewMemorySender()
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{ChannelEmail: sender}, NewHistory(10), noopLogger{})
+	svc.SetClock(fake)
+	svc.SetChannelLimits(map[Channel]ChannelLimits{ChannelEmail: {Rate: 2}})
+
+	ctx := context.Background()
+	email := Message{Channel: ChannelEmail, Recipient: "grace@example.com", Template: "welcome_email", Data: map[string]any{"Name": "Grace"}}
+	if _, err := svc.Send(ctx, email); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := svc.Send(ctx, email)
+		done <- err
+	}()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := len(sender.Deliveries()); n != 1 {
+		t.Fatalf("expected the second send held, got %d sent", n)
+	}
+	fake.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil || len(sender.Deliveries()) != 2 {
+		t.Fatalf("expected the second send after half a second, got %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	go func() {
+		for fake.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if _, err := svc.Send(cancelled, email); !errors.Is(err, ErrChannelBusy) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a busy channel when the caller gives up, got %v", err)
+	}
+}
+
+func TestLimitsFromConfig(t *testing.T) {
+	limits, err := LimitsFromConfig(config.NewLoader("NOTIFY"))
+	if err != nil || len(limits) != 2 || limits[ChannelEmail] != (ChannelLimits{Concurrency: 5, Queue: DefaultChannelQueue}) || limits[ChannelWebhook].Concurrency != 50 {
+		t.Fatalf("expected the default limits, got %+v %v", limits, err)
+	}
+
+	t.Setenv("NOTIFY_CHANNEL_CONCURRENCY", "email=2")
+	t.Setenv("NOTIFY_CHANNEL_RATES", "webhook=0.5")
+	t.Setenv("NOTIFY_CHANNEL_QUEUE", "10")
+	limits, err = LimitsFromConfig(config.NewLoader("NOTIFY"))
+	if err != nil || limits[ChannelEmail] != (ChannelLimits{Concurrency: 2, Queue: 10}) || limits[ChannelWebhook] != (ChannelLimits{Rate: 0.5, Queue: 10}) {
+		t.Fatalf("unexpected limits %+v %v", limits, err)
+	}
+
+	for _, bad := range []string{"sms=5", "email", "email=many", "email=-1"} {
+		t.Setenv("NOTIFY_CHANNEL_CONCURRENCY", bad)
+		if _, err := LimitsFromConfig(config.NewLoader("NOTIFY")); err == nil {
+			t.Fatalf("expected %q rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package notification
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// ErrNotTracked is returned for deliveries, links, and templates without
+// recorded engagement.
+var ErrNotTracked = errors.New("notification: engagement not tracked")
+
+// Buckets used by Engagement: deliveries are keyed by ID, which sorts by
+// the time they were sent, and template totals by template name.
+const (
+	engagementBucket      = "notification.engagement"
+	engagementStatsBucket = "notification.engagement_stats"
+)
+
+// EngagementRetentionPolicy names the policy Engagement.RegisterRetention
+// registers.
+const EngagementRetentionPolicy = "notification.engagement"
+
+// maxTrackedLinks bounds the links rewritten in one email; later ones are
+// sent as they are.
+const maxTrackedLinks = 100
+
+// EngagementStats totals how recipients engaged with one template's
+// deliveries.
+type EngagementStats struct {
+	Template string `json:"template"`
+	// Sent counts the template's deliveries over every channel.
+	Sent   int `json:"sent"`
+	Emails int `json:"emails"`
+	// Opened and Clicked count the emails opened, or with a link followed,
+	// at least once; Opens and Clicks count every time. Following a link
+	// also marks an email opened, since many clients block the pixel.
+	Opened  int `json:"opened"`
+	Clicked int `json:"clicked"`
+	Opens   int `json:"opens"`
+	Clicks  int `json:"clicks"`
+	InApp   int `json:"in_app"`
+	Read    int `json:"read"`
+	// OpenRate and ClickRate are fractions of Emails; ReadRate of InApp.
+	OpenRate  float64 `json:"open_rate"`
+	ClickRate float64 `json:"click_rate"`
+	ReadRate  float64 `json:"read_rate"`
+}
+
+func (s EngagementStats) withRates() EngagementStats {
+	rate := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return float64(n) / float64(of)
+	}
+	s.OpenRate = rate(s.Opened, s.Emails)
+	s.ClickRate = rate(s.Clicked, s.Emails)
+	s.ReadRate = rate(s.Read, s.InApp)
+	return s
+}
+
+// trackedDelivery is the engagement record of one delivery.
+type trackedDelivery struct {
+	ID       string  `json:"id"`
+	Template string  `json:"template"`
+	Channel  Channel `json:"channel"`
+	// RecipientDigest identifies the recipient without storing its
+	// address.
+	RecipientDigest string `json:"recipient_digest"`
+	// Links holds the targets of an email's rewritten links, by index.
+	Links     []string  `json:"links,omitempty"`
+	SentAt    time.Time `json:"sent_at"`
+	OpenedAt  time.Time `json:"opened_at,omitzero"`
+	ClickedAt time.Time `json:"clicked_at,omitzero"`
+	ReadAt    time.Time `json:"read_at,omitzero"`
+}
+
+// Engagement records on a storage driver when recipients open emails,
+// follow their links, and read in-app notifications, and totals them per
+// template.
+type Engagement struct {
+	db storage.Driver
+}
+
+// NewStorageEngagement returns an engagement log in db.
+func NewStorageEngagement(db storage.Driver) *Engagement {
+	return &Engagement{db: db}
+}
+
+// NewEngagement returns an engagement log backed by an in-process memory
+// driver.
+func NewEngagement() *Engagement {
+	return NewStorageEngagement(storage.NewMemory())
+}
+
+// RegisterRetention registers EngagementRetentionPolicy with m, purging the
+// records of deliveries sent before the policy's age. Template totals are
+// kept.
+func (e *Engagement) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        EngagementRetentionPolicy,
+		Description: "engagement records of deliveries sent before the cutoff; template totals are kept",
+		MaxAge:      DefaultHistoryRetention,
+		Purge:       e.Purge,
+	})
+}
+
+// Stats returns template's totals.
+func (e *Engagement) Stats(ctx context.Context, template string) (EngagementStats, error) {
+	var stats EngagementStats
+	err := storage.View(ctx, e.db, func(tx storage.Tx) error {
+		var err error
+		stats, err = getStats(tx, template)
+		return err
+	})
+	if err == nil && stats.Sent == 0 {
+		err = fmt.Errorf("%w: no deliveries of template %s", ErrNotTracked, template)
+	}
+	return stats.withRates(), err
+}
+
+// AllStats returns every template's totals, ordered by template.
+func (e *Engagement) AllStats(ctx context.Context) ([]EngagementStats, error) {
+	var all []EngagementStats
+	err := storage.View(ctx, e.db, func(tx storage.Tx) error {
+		return tx.Scan(engagementStatsBucket, "", func(_ string, value []byte) error {
+			var stats EngagementStats
+			if err := json.Unmarshal(value, &stats); err != nil {
+				return err
+			}
+			all = append(all, stats.withRates())
+			return nil
+		})
+	})
+	sort.Slice(all, func(i, j int) bool { return all[i].Template < all[j].Template })
+	return all, err
+}
+
+// Purge removes the records of deliveries sent before cutoff and returns
+// how many it removed; with dryRun it only counts them.
+func (e *Engagement) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	return retention.PurgeBucket(ctx, e.db, engagementBucket, dryRun, func(_ string, value []byte) (bool, error) {
+		var tracked trackedDelivery
+		if err := json.Unmarshal(value, &tracked); err != nil {
+			return false, err
+		}
+		if !tracked.SentAt.Before(cutoff) {
+			return false, storage.StopScan
+		}
+		return true, nil
+	}, nil)
+}
+
+// track records a sent delivery and counts it in its template's totals.
+func (e *Engagement) track(ctx context.Context, tracked trackedDelivery) error {
+	data, err := json.Marshal(tracked)
+	if err != nil {
+		return err
+	}
+	return storage.Update(ctx, e.db, func(tx storage.Tx) error {
+		stats, err := getStats(tx, tracked.Template)
+		if err != nil {
+			return err
+		}
+		stats.Sent++
+		switch tracked.Channel {
+		case ChannelEmail:
+			stats.Emails++
+		case ChannelInApp:
+			stats.InApp++
+		}
+		if err := tx.Put(engagementBucket, tracked.ID, data); err != nil {
+			return err
+		}
+		return putStats(tx, stats)
+	})
+}
+
+// open records that the email id was opened.
+func (e *Engagement) open(ctx context.Context, id string, at time.Time) error {
+	return e.update(ctx, id, func(tracked *trackedDelivery, stats *EngagementStats) error {
+		if tracked.Channel != ChannelEmail {
+			return fmt.Errorf("%w: %s is not an email", ErrNotTracked, id)
+		}
+		stats.Opens++
+		if tracked.OpenedAt.IsZero() {
+			tracked.OpenedAt = at
+			stats.Opened++
+		}
+		return nil
+	})
+}
+
+// click records that link n of the email id was followed and returns its
+// target.
+func (e *Engagement) click(ctx context.Context, id string, n int, at time.Time) (string, error) {
+	var target string
+	err := e.update(ctx, id, func(tracked *trackedDelivery, stats *EngagementStats) error {
+		if n < 0 || n >= len(tracked.Links) {
+			return fmt.Errorf("%w: %s has no link %d", ErrNotTracked, id, n)
+		}
+		target = tracked.Links[n]
+		stats.Clicks++
+		if tracked.ClickedAt.IsZero() {
+			tracked.ClickedAt = at
+			stats.Clicked++
+		}
+		if tracked.OpenedAt.IsZero() {
+			tracked.OpenedAt = at
+			stats.Opened++
+		}
+		return nil
+	})
+	return target, err
+}
+
+// markRead marks recipient's in-app deliveries ids read and returns how
+// many were unread. Deliveries that are not in-app notifications to
+// recipient are skipped.
+func (e *Engagement) markRead(ctx context.Context, recipient string, ids []string, at time.Time) (int, error) {
+	digest := recipientDigest(recipient)
+	marked := 0
+	for _, id := range ids {
+		err := e.update(ctx, id, func(tracked *trackedDelivery, stats *EngagementStats) error {
+			if tracked.Channel != ChannelInApp || tracked.RecipientDigest != digest {
+				return fmt.Errorf("%w: %s is not an in-app notification to the recipient", ErrNotTracked, id)
+			}
+			if tracked.ReadAt.IsZero() {
+				tracked.ReadAt = at
+				stats.Read++
+				marked++
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrNotTracked) {
+			return marked, err
+		}
+	}
+	return marked, nil
+}
+
+// readTimes returns when each of the deliveries ids that has been read
+// was first read.
+func (e *Engagement) readTimes(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	read := make(map[string]time.Time)
+	err := storage.View(ctx, e.db, func(tx storage.Tx) error {
+		for _, id := range ids {
+			tracked, err := getTracked(tx, id)
+			if errors.Is(err, ErrNotTracked) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !tracked.ReadAt.IsZero() {
+				read[id] = tracked.ReadAt
+			}
+		}
+		return nil
+	})
+	return read, err
+}
+
+// update applies fn to delivery id's record and its template's totals in
+// one transaction, storing both unless fn fails.
+func (e *Engagement) update(ctx context.Context, id string, fn func(*trackedDelivery, *EngagementStats) error) error {
+	return storage.Update(ctx, e.db, func(tx storage.Tx) error {
+		tracked, err := getTracked(tx, id)
+		if err != nil {
+			return err
+		}
+		stats, err := getStats(tx, tracked.Template)
+		if err != nil {
+			return err
+		}
+		if err := fn(&tracked, &stats); err != nil {
+			return err
+		}
+		data, err := json.Marshal(tracked)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(engagementBucket, id, data); err != nil {
+			return err
+		}
+		return putStats(tx, stats)
+	})
+}
+
+func getTracked(tx storage.Tx, id string) (trackedDelivery, error) {
+	data, err := tx.Get(engagementBucket, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return trackedDelivery{}, fmt.Errorf("%w: delivery %s", ErrNotTracked, id)
+	}
+	if err != nil {
+		return trackedDelivery{}, err
+	}
+	var tracked trackedDelivery
+	err = json.Unmarshal(data, &tracked)
+	return tracked, err
+}
+
+// getStats returns template's totals, zero before its first delivery.
+func getStats(tx storage.Tx, template string) (EngagementStats, error) {
+	data, err := tx.Get(engagementStatsBucket, template)
+	if errors.Is(err, storage.ErrNotFound) {
+		return EngagementStats{Template: template}, nil
+	}
+	if err != nil {
+		return EngagementStats{}, err
+	}
+	var stats EngagementStats
+	err = json.Unmarshal(data, &stats)
+	return stats, err
+}
+
+func putStats(tx storage.Tx, stats EngagementStats) error {
+	stats.OpenRate, stats.ClickRate, stats.ReadRate = 0, 0, 0
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	return tx.Put(engagementStatsBucket, stats.Template, data)
+}
+
+func recipientDigest(recipient string) string {
+	sum := sha256.Sum256([]byte(recipient))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	// hrefPattern matches the absolute http(s) targets of HTML links.
+	hrefPattern = regexp.MustCompile(`(?i)(\bhref\s*=\s*["'])(https?://[^"']+)`)
+	// urlPattern matches the http(s) URLs in plain text.
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+	// htmlPattern recognizes HTML email bodies.
+	htmlPattern = regexp.MustCompile(`(?i)<(html|body)[\s>]`)
+)
+
+// instrument rewrites the links of an email body to pass through the
+// click tracker at trackingURL, returning the new body and the original
+// targets by index. HTML bodies also get a pixel that reports opens.
+func instrument(body, trackingURL, id string) (string, []string) {
+	base := strings.TrimSuffix(trackingURL, "/") + TrackPath
+	var links []string
+	rewrite := func(target string) (string, bool) {
+		if len(links) == maxTrackedLinks {
+			return "", false
+		}
+		links = append(links, target)
+		return base + "click/" + id + "/" + strconv.Itoa(len(links)-1), true
+	}
+	if !htmlPattern.MatchString(body) {
+		return urlPattern.ReplaceAllStringFunc(body, func(match string) string {
+			// Punctuation ending a sentence is not part of the URL.
+			target := strings.TrimRight(match, ".,;:!?)")
+			if tracked, ok := rewrite(target); ok {
+				return tracked + match[len(target):]
+			}
+			return match
+		}), links
+	}
+	body = hrefPattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := hrefPattern.FindStringSubmatch(match)
+		if tracked, ok := rewrite(html.UnescapeString(parts[2])); ok {
+			return parts[1] + tracked
+		}
+		return match
+	})
+	pixel := `<img src="` + base + "open/" + id + `" width="1" height="1" alt="">`
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + pixel + body[i:], links
+	}
+	return body + pixel, links
+}
@@ -0,0 +1,218 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// TrackPath prefixes the endpoints TrackingHandler serves. Mail clients
+// and browsers reach them without credentials, so binaries mount them
+// beside authentication rather than behind it.
+const TrackPath = "/notifications/track/"
+
+const (
+	inboxPath      = "/notifications/inbox"
+	engagementPath = "/notifications/engagement"
+)
+
+// maxReadIDs bounds the deliveries one inbox read request marks.
+const maxReadIDs = 100
+
+// pixel is a transparent 1x1 GIF.
+const pixel = "GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;"
+
+// InboxItem is an in-app notification and when its recipient read it.
+type InboxItem struct {
+	Delivery
+	ReadAt time.Time `json:"read_at,omitzero"`
+}
+
+// TrackingHandler serves the open pixel at TrackPath+"open/{id}" and
+// redirects TrackPath+"click/{id}/{n}" to link n of email id, recording
+// each in the service's Engagement. Without one it answers 404.
+func (s *Service) TrackingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(TrackPath+"open/", s.handleOpen)
+	mux.HandleFunc(TrackPath+"click/", s.handleClick)
+	return mux
+}
+
+// handleOpen answers with the pixel whether or not id is tracked, so mail
+// clients show no broken image.
+func (s *Service) handleOpen(w http.ResponseWriter, r *http.Request) {
+	if !s.engagementEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet, http.MethodHead)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, TrackPath+"open/")
+	if err := s.engagement.open(r.Context(), id, s.clock.Now()); err != nil && !errors.Is(err, ErrNotTracked) {
+		logging.For(r.Context(), s.logger).Printf("record open of %s: %v", id, err)
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(pixel))
+}
+
+func (s *Service) handleClick(w http.ResponseWriter, r *http.Request) {
+	if !s.engagementEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet, http.MethodHead)
+		return
+	}
+	id, index, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, TrackPath+"click/"), "/")
+	n, err := strconv.Atoi(index)
+	if err != nil {
+		problem.Write(w, r, http.StatusNotFound, "notification.not_tracked", "unknown link")
+		return
+	}
+	target, err := s.engagement.click(r.Context(), id, n, s.clock.Now())
+	if err != nil {
+		s.engagementError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleInbox lists one page of the in-app notifications still in the
+// history for the recipient, with when each was read.
+func (s *Service) handleInbox(w http.ResponseWriter, r *http.Request) {
+	if !s.engagementEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet)
+		return
+	}
+	recipient := r.URL.Query().Get("recipient")
+	var v validation.Validator
+	v.String("recipient", recipient).Required().MaxLength(maxRecipientLength)
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if validation.Write(w, r, "notification.invalid_request", err) {
+		return
+	}
+	deliveries, next, err := s.history.ForRecipient(r.Context(), ChannelInApp, recipient, page)
+	if err != nil {
+		logging.For(r.Context(), s.logger).Printf("load inbox: %v", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, "notification.history_unavailable", "notification history unavailable")
+		return
+	}
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.ID
+	}
+	read, err := s.engagement.readTimes(r.Context(), ids)
+	if err != nil {
+		s.engagementError(w, r, err)
+		return
+	}
+	items := make([]InboxItem, len(deliveries))
+	for i, d := range deliveries {
+		items[i] = InboxItem{Delivery: d, ReadAt: read[d.ID]}
+	}
+	pagination.Write(w, r, items, next)
+}
+
+// handleInboxRead marks in-app notifications read and reports how many
+// were unread. IDs that are not in-app notifications to the recipient are
+// ignored.
+func (s *Service) handleInboxRead(w http.ResponseWriter, r *http.Request) {
+	if !s.engagementEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	var payload struct {
+		Recipient string   `json:"recipient"`
+		IDs       []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, "notification.invalid_json", "invalid json", err)
+		return
+	}
+	var v validation.Validator
+	v.String("recipient", payload.Recipient).Required().MaxLength(maxRecipientLength)
+	v.Check(len(payload.IDs) > 0, "ids", validation.RuleRequired, "is required")
+	v.Check(len(payload.IDs) <= maxReadIDs, "ids", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxReadIDs))
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+		return
+	}
+	marked, err := s.engagement.markRead(r.Context(), payload.Recipient, payload.IDs, s.clock.Now())
+	if err != nil {
+		s.engagementError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"read": marked})
+}
+
+// handleEngagement lists one page of every template's engagement totals at
+// engagementPath, and returns one template's below it.
+func (s *Service) handleEngagement(w http.ResponseWriter, r *http.Request) {
+	if !s.engagementEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet)
+		return
+	}
+	if template, ok := strings.CutPrefix(r.URL.Path, engagementPath+"/"); ok {
+		stats, err := s.engagement.Stats(r.Context(), template)
+		if err != nil {
+			s.engagementError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if validation.Write(w, r, "notification.invalid_request", err) {
+		return
+	}
+	all, err := s.engagement.AllStats(r.Context())
+	if err != nil {
+		s.engagementError(w, r, err)
+		return
+	}
+	items, next := pagination.Slice(all, func(stats EngagementStats) string { return stats.Template }, page)
+	pagination.Write(w, r, items, next)
+}
+
+// engagementEnabled writes 404 unless the service has an Engagement.
+func (s *Service) engagementEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.engagement == nil {
+		problem.Write(w, r, http.StatusNotFound, "notification.not_tracked", "engagement tracking is not enabled")
+		return false
+	}
+	return true
+}
+
+func (s *Service) engagementError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNotTracked) {
+		problem.Write(w, r, http.StatusNotFound, "notification.not_tracked", err.Error())
+		return
+	}
+	logging.For(r.Context(), s.logger).Printf("engagement: %v", err)
+	problem.Write(w, r, http.StatusServiceUnavailable, "notification.engagement_unavailable", "engagement records unavailable")
+}
@@ -0,0 +1,181 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+func TestEngagementTracksEmailOpensAndClicks(t *testing.T) {
+	templates := NewTemplateStore()
+	if err := templates.Register("digest", `<html><body><a href="https://example.com/a?x=1&amp;y=2">A</a> <a href='http://example.com/b'>B</a></body></html>`); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	sender := NewMemorySender()
+	svc := NewService(templates, map[Channel]Sender{ChannelEmail: sender}, NewHistory(10), noopLogger{})
+	engagement := NewEngagement()
+	tracker := httptest.NewServer(svc.TrackingHandler())
+	t.Cleanup(tracker.Close)
+	svc.SetEngagement(engagement, tracker.URL)
+
+	ctx := context.Background()
+	delivery, err := svc.Send(ctx, Message{Channel: ChannelEmail, Recipient: "grace@example.com", Template: "digest"})
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, err := svc.Send(ctx, Message{Channel: ChannelEmail, Recipient: "ada@example.com", Template: "digest"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	links := regexp.MustCompile(`href=["']([^"']+)`).FindAllStringSubmatch(delivery.Body, -1)
+	if len(links) != 2 || !strings.HasPrefix(links[0][1], tracker.URL+TrackPath+"click/"+delivery.ID+"/") {
+		t.Fatalf("expected links rewritten through the tracker, got %s", delivery.Body)
+	}
+	if !strings.Contains(delivery.Body, `<img src="`+tracker.URL+TrackPath+"open/"+delivery.ID+`"`) || !strings.HasSuffix(delivery.Body, "</body></html>") {
+		t.Fatalf("expected a pixel inside the body, got %s", delivery.Body)
+	}
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for range 2 {
+		resp, err := noRedirect.Get(links[0][1])
+		if err != nil {
+			t.Fatalf("click: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "https://example.com/a?x=1&y=2" {
+			t.Fatalf("expected a redirect to the unescaped link, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	resp, err := http.Get(tracker.URL + TrackPath + "open/" + delivery.ID)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := gif.Decode(resp.Body); err != nil || resp.Header.Get("Content-Type") != "image/gif" {
+		t.Fatalf("expected a GIF pixel, got %q %v", resp.Header.Get("Content-Type"), err)
+	}
+	resp.Body.Close()
+	resp, err = noRedirect.Get(tracker.URL + TrackPath + "click/" + delivery.ID + "/7")
+	if err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown link, got %d", resp.StatusCode)
+	}
+
+	stats, err := engagement.Stats(ctx, "digest")
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	want := EngagementStats{Template: "digest", Sent: 2, Emails: 2, Opened: 1, Clicked: 1, Opens: 1, Clicks: 2, OpenRate: 0.5, ClickRate: 0.5}
+	if stats != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestEngagementRewritesPlainTextLinks(t *testing.T) {
+	body, links := instrument("Reset at https://example.com/reset?code=1. Thanks!", "https://track.example.com/", "n1")
+	if len(links) != 1 || links[0] != "https://example.com/reset?code=1" {
+		t.Fatalf("unexpected links %q", links)
+	}
+	if body != "Reset at https://track.example.com"+TrackPath+"click/n1/0. Thanks!" || strings.Contains(body, "<img") {
+		t.Fatalf("expected the URL rewritten and no pixel, got %q", body)
+	}
+}
+
+func TestInboxMarksInAppNotificationsRead(t *testing.T) {
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{ChannelInApp: NewMemorySender()}, NewHistory(10), noopLogger{})
+	svc.SetEngagement(NewEngagement(), "")
+	server := httptest.NewServer(svc.Handler())
+	t.Cleanup(server.Close)
+
+	ctx := context.Background()
+	var ids []string
+	for _, recipient := range []string{"grace", "grace", "ada"} {
+		delivery, err := svc.Send(ctx, Message{Channel: ChannelInApp, Recipient: recipient, Template: "welcome_email", Data: map[string]any{"Name": recipient}})
+		if err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		ids = append(ids, delivery.ID)
+	}
+	markRead := func(recipient string, ids ...string) int {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"recipient": recipient, "ids": ids})
+		resp, err := http.Post(server.URL+"/notifications/inbox/read", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("mark read: %v", err)
+		}
+		defer resp.Body.Close()
+		var out struct {
+			Read int `json:"read"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("mark read: %d %v", resp.StatusCode, err)
+		}
+		return out.Read
+	}
+	// ada's notification is not grace's to read.
+	if n := markRead("grace", ids[0], ids[2], "missing"); n != 1 {
+		t.Fatalf("expected one notification marked, got %d", n)
+	}
+	if n := markRead("grace", ids[0]); n != 0 {
+		t.Fatalf("expected a second read not counted, got %d", n)
+	}
+
+	resp, err := http.Get(server.URL + "/notifications/inbox?recipient=grace")
+	if err != nil {
+		t.Fatalf("inbox: %v", err)
+	}
+	var inbox pagination.Page[InboxItem]
+	if err := json.NewDecoder(resp.Body).Decode(&inbox); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	if len(inbox.Items) != 2 || inbox.Items[0].ReadAt.IsZero() || !inbox.Items[1].ReadAt.IsZero() || inbox.Items[1].Template != "welcome_email" {
+		t.Fatalf("expected grace's two notifications, the first read, got %+v", inbox.Items)
+	}
+
+	resp, err = http.Get(server.URL + "/notifications/engagement/welcome_email")
+	if err != nil {
+		t.Fatalf("engagement: %v", err)
+	}
+	var stats EngagementStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	resp.Body.Close()
+	if stats.InApp != 3 || stats.Read != 1 || stats.ReadRate < 0.33 || stats.ReadRate > 0.34 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestEngagementPurgeKeepsTotals(t *testing.T) {
+	db := storage.NewMemory()
+	engagement := NewStorageEngagement(db)
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, id := range []string{"n1", "n2", "n3"} {
+		tracked := trackedDelivery{ID: id, Template: "digest", Channel: ChannelInApp, RecipientDigest: recipientDigest("grace"), SentAt: start.Add(time.Duration(i) * time.Hour)}
+		if err := engagement.track(ctx, tracked); err != nil {
+			t.Fatalf("track: %v", err)
+		}
+	}
+	if n, err := engagement.Purge(ctx, start.Add(90*time.Minute), false); err != nil || n != 2 {
+		t.Fatalf("expected two records purged, got %d %v", n, err)
+	}
+	if n, err := engagement.markRead(ctx, "grace", []string{"n1", "n3"}, start); err != nil || n != 1 {
+		t.Fatalf("expected only the kept record marked, got %d %v", n, err)
+	}
+	if stats, err := engagement.Stats(ctx, "digest"); err != nil || stats.Sent != 3 || stats.Read != 1 {
+		t.Fatalf("expected totals kept, got %+v %v", stats, err)
+	}
+}
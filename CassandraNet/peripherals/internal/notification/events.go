@@ -0,0 +1,39 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// Subscribe sends recipient a notification over channel for every content
+// review and finished assignment published on bus, using the
+// content_reviewed and assignment_completed templates.
+func (s *Service) Subscribe(bus *eventbus.Bus, channel Channel, recipient string) {
+	eventbus.Subscribe(bus, func(ctx context.Context, e eventbus.ContentReviewed) {
+		s.sendEvent(ctx, channel, recipient, "content_reviewed", map[string]any{
+			"ContentID": e.ContentID,
+			"TenantID":  e.TenantID,
+			"ProjectID": e.ProjectID,
+			"State":     e.State,
+			"Reason":    e.Reason,
+		})
+	})
+	eventbus.Subscribe(bus, func(ctx context.Context, e eventbus.AssignmentCompleted) {
+		s.sendEvent(ctx, channel, recipient, "assignment_completed", map[string]any{
+			"AssignmentID":  e.AssignmentID,
+			"AgentID":       e.AgentID,
+			"WorkloadID":    e.WorkloadID,
+			"Status":        e.Status,
+			"StatusMessage": e.StatusMessage,
+		})
+	})
+}
+
+func (s *Service) sendEvent(ctx context.Context, channel Channel, recipient, template string, data map[string]any) {
+	_, err := s.Send(ctx, Message{Channel: channel, Recipient: recipient, Template: template, Data: data})
+	if err != nil {
+		logging.For(ctx, s.logger).Printf("notify %s of %s failed: %v", recipient, template, err)
+	}
+}
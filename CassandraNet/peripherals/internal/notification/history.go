@@ -1,37 +1,242 @@
 package notification
 
-import "sync"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
-// History keeps a bounded list of recent deliveries.
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// HistoryStore records recent deliveries.
+type HistoryStore interface {
+	Add(ctx context.Context, delivery Delivery) error
+	// Recent returns one page of the stored deliveries in chronological
+	// order and the position of the next page, empty on the last.
+	Recent(ctx context.Context, page pagination.Request) ([]Delivery, string, error)
+	// ForRecipient is Recent narrowed to the deliveries sent to recipient
+	// over channel.
+	ForRecipient(ctx context.Context, channel Channel, recipient string, page pagination.Request) ([]Delivery, string, error)
+	// Purge removes the deliveries sent before cutoff, or with dryRun
+	// counts them, and returns how many.
+	Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+}
+
+// Buckets used by History: deliveries are keyed by a zero-padded sequence
+// number so a scan returns them oldest first.
+const (
+	historyBucket = "notification.history"
+	historyMeta   = "notification.history_meta"
+	sequenceKey   = "sequence"
+)
+
+// ResealName names the records SetKeyring registers for rotation.
+const ResealName = "notification.history"
+
+// storedDelivery is a delivery as stored. SealedRecipient holds the
+// recipient address in place of Recipient when the history has a keyring.
+type storedDelivery struct {
+	Delivery
+	SealedRecipient []byte `json:"sealed_recipient,omitempty"`
+}
+
+// History keeps a bounded list of recent deliveries on a storage driver.
 type History struct {
-	mu       sync.RWMutex
+	db       storage.Driver
 	capacity int
-	entries  []Delivery
+	keys     *encryption.Keyring
 }
 
-// NewHistory constructs a history with the provided capacity.
-func NewHistory(capacity int) *History {
+// NewStorageHistory returns a history in db holding up to capacity
+// deliveries.
+func NewStorageHistory(db storage.Driver, capacity int) *History {
 	if capacity <= 0 {
 		capacity = 100
 	}
-	return &History{capacity: capacity}
+	return &History{db: db, capacity: capacity}
+}
+
+// NewHistory constructs an in-memory history with the provided capacity.
+func NewHistory(capacity int) *History {
+	return NewStorageHistory(storage.NewMemory(), capacity)
+}
+
+// SetKeyring seals recipient addresses with k before storing them and
+// registers the history with k for rotation. Deliveries recorded before
+// are read as they are and sealed by the next rotation. Call it before the
+// history is used.
+func (h *History) SetKeyring(k *encryption.Keyring) {
+	h.keys = k
+	k.Register(encryption.Resealer{Name: ResealName, Reseal: h.reseal})
+}
+
+// Add records a delivery, dropping the oldest once the history is full.
+func (h *History) Add(ctx context.Context, delivery Delivery) error {
+	stored := storedDelivery{Delivery: delivery}
+	if h.keys.Enabled() {
+		sealed, err := h.keys.Seal(ctx, []byte(delivery.Recipient))
+		if err != nil {
+			return err
+		}
+		stored.Recipient, stored.SealedRecipient = "", sealed
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return storage.Update(ctx, h.db, func(tx storage.Tx) error {
+		seq, err := h.sequence(tx)
+		if err != nil {
+			return err
+		}
+		seq++
+		if err := tx.Put(historyMeta, sequenceKey, []byte(strconv.FormatUint(seq, 10))); err != nil {
+			return err
+		}
+		if err := tx.Put(historyBucket, historyKey(seq), data); err != nil {
+			return err
+		}
+		if seq > uint64(h.capacity) {
+			return tx.Delete(historyBucket, historyKey(seq-uint64(h.capacity)))
+		}
+		return nil
+	})
+}
+
+// Recent returns one page of the stored deliveries in chronological order,
+// and the position of the next page.
+func (h *History) Recent(ctx context.Context, page pagination.Request) ([]Delivery, string, error) {
+	return h.find(ctx, page, nil)
+}
+
+// ForRecipient returns one page of the stored deliveries sent to recipient
+// over channel in chronological order, and the position of the next page.
+func (h *History) ForRecipient(ctx context.Context, channel Channel, recipient string, page pagination.Request) ([]Delivery, string, error) {
+	return h.find(ctx, page, func(d Delivery) bool {
+		return d.Channel == channel && d.Recipient == recipient
+	})
+}
+
+// find returns one page of the stored deliveries that keep, when set,
+// reports true for.
+func (h *History) find(ctx context.Context, page pagination.Request, keep func(Delivery) bool) ([]Delivery, string, error) {
+	collector := pagination.NewCollector[Delivery](page)
+	err := storage.View(ctx, h.db, func(tx storage.Tx) error {
+		seq, err := h.sequence(tx)
+		if err != nil {
+			return err
+		}
+		// Deliveries kept under a larger capacity in an earlier run are
+		// left in place but not reported.
+		oldest := ""
+		if seq > uint64(h.capacity) {
+			oldest = historyKey(seq - uint64(h.capacity))
+		}
+		return tx.Scan(historyBucket, "", func(key string, value []byte) error {
+			if key <= oldest || collector.Skip(key) {
+				return nil
+			}
+			var stored storedDelivery
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			delivery := stored.Delivery
+			if stored.SealedRecipient != nil {
+				recipient, err := h.keys.Open(ctx, stored.SealedRecipient)
+				if err != nil {
+					return err
+				}
+				delivery.Recipient = string(recipient)
+			}
+			if keep != nil && !keep(delivery) {
+				return nil
+			}
+			if !collector.Add(key, delivery) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	deliveries, next := collector.Page()
+	return deliveries, next, nil
 }
 
-// Add records a delivery.
-func (h *History) Add(delivery Delivery) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.entries = append(h.entries, delivery)
-	if len(h.entries) > h.capacity {
-		h.entries = h.entries[len(h.entries)-h.capacity:]
+// Purge removes the deliveries sent before cutoff and returns how many it
+// removed; with dryRun it only counts them. It also compacts away the
+// deliveries Recent no longer reports, left behind by a larger capacity in
+// an earlier run.
+func (h *History) Purge(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	var seq uint64
+	err := storage.View(ctx, h.db, func(tx storage.Tx) error {
+		var err error
+		seq, err = h.sequence(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	oldest := ""
+	if seq > uint64(h.capacity) {
+		oldest = historyKey(seq - uint64(h.capacity))
+	}
+	return retention.PurgeBucket(ctx, h.db, historyBucket, dryRun, func(key string, value []byte) (bool, error) {
+		if key <= oldest {
+			return true, nil
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(value, &delivery); err != nil {
+			return false, err
+		}
+		if !delivery.SentAt.Before(cutoff) {
+			// Deliveries are kept in the order they were sent.
+			return false, storage.StopScan
+		}
+		return true, nil
+	}, nil)
+}
+
+// reseal re-seals the stored recipients not sealed under the active key.
+func (h *History) reseal(ctx context.Context) (int, int, error) {
+	return encryption.ResealBucket(ctx, h.db, historyBucket, "", func(_ string, value []byte) ([]byte, error) {
+		var stored storedDelivery
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return nil, err
+		}
+		sealed, err := h.keys.Reseal(ctx, stored.SealedRecipient, []byte(stored.Recipient))
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		stored.Recipient, stored.SealedRecipient = "", sealed
+		return json.Marshal(stored)
+	})
+}
+
+// sequence returns the number of the latest delivery, zero when none has
+// been added.
+func (h *History) sequence(tx storage.Tx) (uint64, error) {
+	raw, err := tx.Get(historyMeta, sequenceKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("notification: corrupt history sequence: %w", err)
 	}
+	return seq, nil
 }
 
-// Recent returns the stored deliveries in chronological order.
-func (h *History) Recent() []Delivery {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	snapshot := make([]Delivery, len(h.entries))
-	copy(snapshot, h.entries)
-	return snapshot
+func historyKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
 }
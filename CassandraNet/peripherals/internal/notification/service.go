@@ -1,40 +1,278 @@
 package notification
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Errors returned by Send.
+var (
+	ErrUnsupportedChannel = errors.New("notification: unsupported channel")
+	ErrTemplate           = errors.New("notification: template error")
+	ErrDispatchFailed     = errors.New("notification: dispatch failed")
+)
+
+// ErrTemplateNotFound is returned for templates that are not registered.
+var ErrTemplateNotFound = errors.New("notification: template not found")
+
+// Length limits of request fields, in characters.
+const (
+	maxRecipientLength    = 320
+	maxTemplateBodyLength = 16 << 10
 )
 
+const templatesPrefix = "/notifications/templates/"
+
 // Service exposes HTTP endpoints for dispatching notifications.
 type Service struct {
 	templates *TemplateStore
 	senders   map[Channel]Sender
-	history   *History
-	logger    interface {
+	history   HistoryStore
+	events    eventbus.Publisher
+	audit     *audit.Log
+	meter     *metering.Meter
+	inApp     *sse.Hub[Delivery]
+	// engagement, when set, records engagement with each delivery, and
+	// trackingURL is the public base URL of TrackingHandler.
+	engagement  *Engagement
+	trackingURL string
+	// suppressions, when set, lists the recipients Send refuses.
+	suppressions *Suppressions
+	// dispatchers hold the sends of channels with limits to them.
+	dispatchers map[Channel]*dispatcher
+	clock       clock.Clock
+	logger      interface {
 		Printf(string, ...any)
 	}
 }
 
 // NewService constructs a Service instance.
-func NewService(templates *TemplateStore, senders map[Channel]Sender, history *History, logger interface {
+func NewService(templates *TemplateStore, senders map[Channel]Sender, history HistoryStore, logger interface {
 	Printf(string, ...any)
 }) *Service {
 	return &Service{
 		templates: templates,
 		senders:   senders,
 		history:   history,
+		inApp:     sse.NewHub[Delivery](sse.Config{}),
+		clock:     clock.System,
 		logger:    logger,
 	}
 }
 
+// SetEvents publishes an eventbus.DeliveryFailed to p whenever a sender
+// refuses a notification. Call it before the service handles requests.
+func (s *Service) SetEvents(p eventbus.Publisher) {
+	s.events = p
+}
+
+// SetClock stamps deliveries with c's time instead of the system clock.
+// Call it before the service handles requests.
+func (s *Service) SetClock(c clock.Clock) {
+	s.clock = clock.Or(c)
+}
+
+// SetAudit records every template change in log. Call it before the
+// service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// RetentionPolicy names the policy RegisterRetention registers.
+const RetentionPolicy = "notification.history"
+
+// DefaultHistoryRetention is how long delivery history is kept unless
+// RETENTION_MAX_AGES says otherwise.
+const DefaultHistoryRetention = 30 * 24 * time.Hour
+
+// RegisterRetention registers RetentionPolicy with m, purging delivery
+// history older than the policy's age.
+func (s *Service) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        RetentionPolicy,
+		Description: "deliveries sent before the cutoff, and those beyond the history's capacity",
+		MaxAge:      DefaultHistoryRetention,
+		Purge:       s.history.Purge,
+	})
+}
+
+// SetEngagement records in e each delivery and how its recipient engages
+// with it, served with per-template totals at /notifications/engagement
+// and, for in-app notifications, at /notifications/inbox. When
+// trackingURL, the public base URL TrackingHandler is reachable at, is
+// set, links in emails are rewritten to pass through it and HTML emails
+// get a pixel that reports opens. Call it before the service handles
+// requests.
+func (s *Service) SetEngagement(e *Engagement, trackingURL string) {
+	s.engagement = e
+	s.trackingURL = trackingURL
+}
+
+// SetMeter counts each sent notification as metering.NotificationsSent
+// for the request's tenant. Call it before the service handles requests.
+func (s *Service) SetMeter(m *metering.Meter) {
+	s.meter = m
+}
+
+// SetChannelLimits holds each channel's sends to its limits; channels
+// without an entry are unlimited. Call it before the service handles
+// requests.
+func (s *Service) SetChannelLimits(limits map[Channel]ChannelLimits) {
+	s.dispatchers = make(map[Channel]*dispatcher, len(limits))
+	for channel, l := range limits {
+		s.dispatchers[channel] = newDispatcher(l)
+	}
+}
+
+// ChannelStats reports, in channel order, the limited channels' sends in
+// progress and waiting.
+func (s *Service) ChannelStats() []ChannelStats {
+	var out []ChannelStats
+	for _, channel := range channels {
+		if d, ok := s.dispatchers[channel]; ok {
+			out = append(out, d.stats(channel))
+		}
+	}
+	return out
+}
+
+// Template returns the registered template called name.
+func (s *Service) Template(name string) (Template, error) {
+	body, ok := s.templates.Raw(name)
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return Template{Name: name, Body: body}, nil
+}
+
+// PutTemplate registers or replaces a template and reports whether it was
+// new. Templates changed this way last until the service restarts.
+func (s *Service) PutTemplate(ctx context.Context, tmpl Template) (bool, error) {
+	var v validation.Validator
+	v.ID("name", tmpl.Name).Excludes("/")
+	v.String("body", tmpl.Body).Required().MaxLength(maxTemplateBodyLength)
+	if err := v.Err(); err != nil {
+		return false, err
+	}
+	var before any
+	previous, existed := s.templates.Raw(tmpl.Name)
+	if existed {
+		before = Template{Name: tmpl.Name, Body: previous}
+	}
+	if err := s.templates.Register(tmpl.Name, tmpl.Body); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrTemplate, err)
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "notification.template.put",
+		Resource: "templates/" + tmpl.Name,
+		Before:   before,
+		After:    tmpl,
+	})
+	return !existed, nil
+}
+
+// Send renders msg's template and delivers it over msg's channel, unless
+// its recipient is suppressed.
+func (s *Service) Send(ctx context.Context, msg Message) (Delivery, error) {
+	sender, ok := s.senders[msg.Channel]
+	if !ok {
+		return Delivery{}, fmt.Errorf("%w %s", ErrUnsupportedChannel, msg.Channel)
+	}
+	if err := s.checkSuppressed(ctx, msg); err != nil {
+		return Delivery{}, err
+	}
+	body, err := s.templates.Render(msg.Template, msg.Data)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("%w: %w", ErrTemplate, err)
+	}
+	delivery := Delivery{
+		ID:        id.New(id.PrefixNotification),
+		Channel:   msg.Channel,
+		Recipient: msg.Recipient,
+		Template:  msg.Template,
+		Body:      body,
+		SentAt:    s.clock.Now(),
+	}
+	var links []string
+	if s.engagement != nil && s.trackingURL != "" && msg.Channel == ChannelEmail {
+		delivery.Body, links = instrument(delivery.Body, s.trackingURL, delivery.ID)
+	}
+	if d, ok := s.dispatchers[msg.Channel]; ok {
+		release, err := d.acquire(ctx, s.clock)
+		if err != nil {
+			return Delivery{}, err
+		}
+		defer release()
+	}
+	if err := sender.Send(delivery); err != nil {
+		if s.events != nil {
+			s.events.Publish(ctx, eventbus.DeliveryFailed{
+				Channel:   string(msg.Channel),
+				Recipient: msg.Recipient,
+				Template:  msg.Template,
+				TenantID:  logging.TenantID(ctx),
+				ProjectID: logging.ProjectID(ctx),
+				Error:     err.Error(),
+				FailedAt:  delivery.SentAt,
+			})
+		}
+		return Delivery{}, fmt.Errorf("%w: %w", ErrDispatchFailed, err)
+	}
+	s.meter.Record(ctx, "", metering.NotificationsSent, 1)
+	if msg.Channel == ChannelInApp {
+		s.inApp.Publish(delivery)
+	}
+	if err := s.history.Add(ctx, delivery); err != nil {
+		logging.For(ctx, s.logger).Printf("record %s notification to %s: %v", msg.Channel, msg.Recipient, err)
+	}
+	if s.engagement != nil {
+		err := s.engagement.track(ctx, trackedDelivery{
+			ID:              delivery.ID,
+			Template:        msg.Template,
+			Channel:         msg.Channel,
+			RecipientDigest: recipientDigest(msg.Recipient),
+			Links:           links,
+			SentAt:          delivery.SentAt,
+		})
+		if err != nil {
+			logging.For(ctx, s.logger).Printf("track %s notification to %s: %v", msg.Channel, msg.Recipient, err)
+		}
+	}
+	logging.For(ctx, s.logger).Printf("sent %s notification to %s via template %s", msg.Channel, msg.Recipient, msg.Template)
+	return delivery, nil
+}
+
 // Handler returns the HTTP handler.
 func (s *Service) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", s.handleHealth)
 	mux.HandleFunc("/notify", s.handleNotify)
 	mux.HandleFunc("/notifications/recent", s.handleRecent)
+	mux.HandleFunc("/notifications/stream", s.handleStream)
+	mux.HandleFunc(templatesPrefix, s.handleTemplate)
+	mux.HandleFunc(inboxPath, s.handleInbox)
+	mux.HandleFunc(inboxPath+"/read", s.handleInboxRead)
+	mux.HandleFunc(engagementPath, s.handleEngagement)
+	mux.HandleFunc(engagementPath+"/", s.handleEngagement)
+	mux.HandleFunc(suppressionsPath, s.handleSuppressions)
+	mux.HandleFunc(suppressionsPath+"/", s.handleSuppressionFile)
 	return mux
 }
 
@@ -45,57 +283,131 @@ func (s *Service) handleHealth(w http.ResponseWriter, _ *http.Request) {
 
 func (s *Service) handleNotify(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "notification", http.MethodPost)
 		return
 	}
 	defer r.Body.Close()
 
 	var msg Message
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, "notification.invalid_json", "invalid json", err)
 		return
 	}
-	if msg.Channel == "" || msg.Recipient == "" || msg.Template == "" {
-		http.Error(w, "channel, recipient, and template required", http.StatusBadRequest)
+	var v validation.Validator
+	v.String("channel", string(msg.Channel)).Required()
+	v.String("recipient", msg.Recipient).Required().MaxLength(maxRecipientLength)
+	v.String("template", msg.Template).Required().MaxLength(validation.MaxIDLength)
+	v.Check(len(msg.Data) <= validation.MaxMapEntries, "data", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", validation.MaxMapEntries))
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
 		return
 	}
 
-	sender, ok := s.senders[msg.Channel]
-	if !ok {
-		http.Error(w, fmt.Sprintf("unsupported channel %s", msg.Channel), http.StatusBadRequest)
+	delivery, err := s.Send(r.Context(), msg)
+	switch {
+	case errors.Is(err, ErrUnsupportedChannel):
+		problem.Write(w, r, http.StatusBadRequest, "notification.unsupported_channel", fmt.Sprintf("unsupported channel %s", msg.Channel))
+		return
+	case errors.Is(err, ErrTemplate):
+		problem.Write(w, r, http.StatusBadRequest, "notification.template_error", strings.TrimPrefix(err.Error(), ErrTemplate.Error()+": "))
+		return
+	case errors.Is(err, ErrSuppressed):
+		problem.Write(w, r, http.StatusConflict, "notification.recipient_suppressed", fmt.Sprintf("%s recipient %s is on the suppression list", msg.Channel, msg.Recipient))
+		return
+	case errors.Is(err, ErrChannelBusy):
+		w.Header().Set("Retry-After", "1")
+		problem.Write(w, r, http.StatusServiceUnavailable, "notification.channel_busy", fmt.Sprintf("too many %s notifications waiting to be sent", msg.Channel))
+		return
+	case err != nil:
+		problem.Write(w, r, http.StatusInternalServerError, "notification.dispatch_failed", "failed to dispatch notification")
 		return
 	}
 
-	body, err := s.templates.Render(msg.Template, msg.Data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+func (s *Service) handleRecent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet)
 		return
 	}
-
-	delivery := Delivery{
-		Channel:   msg.Channel,
-		Recipient: msg.Recipient,
-		Body:      body,
-		SentAt:    time.Now().UTC(),
+	paged := pagination.Requested(r)
+	page, err := pagination.Parse(r, pagination.ListLimit(paged))
+	if validation.Write(w, r, "notification.invalid_request", err) {
+		return
 	}
-	if err := sender.Send(delivery); err != nil {
-		http.Error(w, "failed to dispatch notification", http.StatusInternalServerError)
+	recent, next, err := s.history.Recent(r.Context(), page)
+	if err != nil {
+		logging.For(r.Context(), s.logger).Printf("load recent notifications: %v", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, "notification.history_unavailable", "notification history unavailable")
 		return
 	}
-	s.history.Add(delivery)
-	s.logger.Printf("sent %s notification to %s via template %s", msg.Channel, msg.Recipient, msg.Template)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(delivery)
+	pagination.WriteList(w, r, recent, next, paged)
 }
 
-func (s *Service) handleRecent(w http.ResponseWriter, r *http.Request) {
+// handleStream pushes each in-app notification sent to the recipient as a
+// "notification" event until the client leaves. A client that reconnects
+// with the ID of the last notification it saw first receives the ones it
+// missed, while they are still buffered.
+func (s *Service) handleStream(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet)
+		return
+	}
+	recipient := r.URL.Query().Get("recipient")
+	var v validation.Validator
+	v.String("recipient", recipient).Required().MaxLength(maxRecipientLength)
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+		return
+	}
+	sub, _ := s.inApp.Subscribe(func(d Delivery) bool { return d.Recipient == recipient }, sse.LastEventID(r))
+	defer sub.Close()
+	stream, ok := sse.Open(w, r, "notification")
+	if !ok {
 		return
 	}
-	recent := s.history.Recent()
+	_ = sse.Relay(r.Context(), stream, sub, "notification", 0, nil)
+}
+
+func (s *Service) handleTemplate(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, templatesPrefix)
+	switch r.Method {
+	case http.MethodGet:
+		tmpl, err := s.Template(name)
+		if err != nil {
+			problem.Write(w, r, http.StatusNotFound, "notification.template_not_found", err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, tmpl)
+	case http.MethodPut:
+		defer r.Body.Close()
+		var payload struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			problem.DecodeFailed(w, r, "notification.invalid_json", "invalid json", err)
+			return
+		}
+		tmpl := Template{Name: name, Body: payload.Body}
+		created, err := s.PutTemplate(r.Context(), tmpl)
+		switch {
+		case validation.Write(w, r, "notification.invalid_request", err):
+			return
+		case err != nil:
+			problem.Write(w, r, http.StatusBadRequest, "notification.template_error", strings.TrimPrefix(err.Error(), ErrTemplate.Error()+": "))
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, tmpl)
+	default:
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet, http.MethodPut)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(recent)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
 }
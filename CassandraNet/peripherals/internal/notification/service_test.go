@@ -1,11 +1,21 @@
 package notification
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
 )
 
 type noopLogger struct{}
@@ -66,3 +76,202 @@ func TestServiceNotifyAndRecent(t *testing.T) {
 		t.Fatalf("expected 1 delivery, got %d", len(recents))
 	}
 }
+
+func TestHistoryPagesWithinCapacity(t *testing.T) {
+	ctx := context.Background()
+	history := NewHistory(3)
+	for _, recipient := range []string{"a", "b", "c", "d", "e"} {
+		if err := history.Add(ctx, Delivery{Recipient: recipient}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	var got []string
+	page := pagination.Request{Limit: 2}
+	for {
+		deliveries, next, err := history.Recent(ctx, page)
+		if err != nil {
+			t.Fatalf("recent: %v", err)
+		}
+		for _, delivery := range deliveries {
+			got = append(got, delivery.Recipient)
+		}
+		if next == "" {
+			break
+		}
+		page.After = next
+	}
+	if strings.Join(got, ",") != "c,d,e" {
+		t.Fatalf("expected the last three deliveries, got %v", got)
+	}
+}
+
+func TestHistoryPurgeCompactsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	db := storage.NewMemory()
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	wide := NewStorageHistory(db, 5)
+	for i, recipient := range []string{"a", "b", "c", "d", "e"} {
+		if err := wide.Add(ctx, Delivery{Recipient: recipient, SentAt: start.Add(time.Duration(i) * time.Hour)}); err != nil {
+			t.Fatalf("add: %v", err)
+		}
+	}
+	// a to c lie beyond the smaller capacity; d is past the cutoff.
+	history := NewStorageHistory(db, 2)
+	cutoff := start.Add(4 * time.Hour)
+	if n, err := history.Purge(ctx, cutoff, true); err != nil || n != 4 {
+		t.Fatalf("dry run: expected 4, got %d %v", n, err)
+	}
+	if n, err := history.Purge(ctx, cutoff, false); err != nil || n != 4 {
+		t.Fatalf("purge: expected 4, got %d %v", n, err)
+	}
+	deliveries, _, err := wide.Recent(ctx, pagination.Request{Limit: 10})
+	if err != nil || len(deliveries) != 1 || deliveries[0].Recipient != "e" {
+		t.Fatalf("expected only e left, got %+v %v", deliveries, err)
+	}
+}
+
+type failingSender struct{}
+
+func (failingSender) Send(Delivery) error { return errors.New("smtp unavailable") }
+
+func TestServiceNotifiesOnEvents(t *testing.T) {
+	inApp := NewMemorySender()
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{
+		ChannelInApp: inApp,
+		ChannelEmail: failingSender{},
+	}, NewHistory(10), noopLogger{})
+	bus := eventbus.New(0, noopLogger{})
+	svc.SetEvents(bus)
+	svc.Subscribe(bus, ChannelInApp, "moderators")
+	var failed []eventbus.DeliveryFailed
+	eventbus.Subscribe(bus, func(_ context.Context, e eventbus.DeliveryFailed) {
+		failed = append(failed, e)
+	})
+	bus.Start()
+
+	bus.Publish(context.Background(), eventbus.ContentReviewed{ContentID: "c-1", State: "rejected", Reason: "spam"})
+	bus.Publish(context.Background(), eventbus.AssignmentCompleted{AssignmentID: "a-1", AgentID: "agent-1", Status: "failed"})
+	_, err := svc.Send(context.Background(), Message{Channel: ChannelEmail, Recipient: "ops@example.com", Template: "welcome_email", Data: map[string]any{"Name": "Ops"}})
+	if !errors.Is(err, ErrDispatchFailed) {
+		t.Fatalf("expected a dispatch failure, got %v", err)
+	}
+	bus.Stop()
+
+	deliveries := inApp.Deliveries()
+	if len(deliveries) != 2 {
+		t.Fatalf("expected two event notifications, got %+v", deliveries)
+	}
+	if deliveries[0].Body != "Content c-1 was rejected: spam." || deliveries[1].Body != "Assignment a-1 for agent agent-1 is failed." {
+		t.Fatalf("unexpected notification bodies %q and %q", deliveries[0].Body, deliveries[1].Body)
+	}
+	if len(failed) != 1 || failed[0].Recipient != "ops@example.com" || failed[0].Template != "welcome_email" {
+		t.Fatalf("expected a delivery failure event, got %+v", failed)
+	}
+}
+
+func TestTemplatesAreReplacedAndAudited(t *testing.T) {
+	log := audit.New(storage.NewMemory(), "notification", noopLogger{})
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{ChannelEmail: NewMemorySender()}, NewHistory(10), noopLogger{})
+	svc.SetAudit(log)
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+
+	put := func(name, body string) int {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]string{"body": body})
+		req, _ := http.NewRequest(http.MethodPut, server.URL+"/notifications/templates/"+name, bytes.NewReader(payload))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("put template: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := put("welcome_email", "Hi {{.Name}}!"); status != http.StatusOK {
+		t.Fatalf("expected 200 replacing a template, got %d", status)
+	}
+	if status := put("digest", "{{.Count}} updates"); status != http.StatusCreated {
+		t.Fatalf("expected 201 for a new template, got %d", status)
+	}
+	if status := put("broken", "{{.Name"); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unparsable template, got %d", status)
+	}
+
+	delivery, err := svc.Send(context.Background(), Message{Channel: ChannelEmail, Recipient: "a@example.com", Template: "welcome_email", Data: map[string]any{"Name": "Ada"}})
+	if err != nil || delivery.Body != "Hi Ada!" {
+		t.Fatalf("expected the replaced template, got %q (%v)", delivery.Body, err)
+	}
+
+	entries, _, err := log.List(context.Background(), audit.Filter{Action: "notification.template.put"}, pagination.Request{Limit: 10})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 audit entries, got %+v (%v)", entries, err)
+	}
+	if entries[0].Resource != "templates/welcome_email" || !strings.Contains(string(entries[0].Before), "welcome to CassandraNet") ||
+		entries[1].Before != nil {
+		t.Fatalf("unexpected audit entries %+v", entries)
+	}
+}
+
+func TestServiceStreamsInAppNotifications(t *testing.T) {
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{
+		ChannelInApp: NewMemorySender(),
+		ChannelEmail: NewMemorySender(),
+	}, NewHistory(10), noopLogger{})
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/notifications/stream")
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a recipient, got %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/notifications/stream?recipient=player-1", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	send := func(channel Channel, recipient, name string) {
+		t.Helper()
+		msg := Message{Channel: channel, Recipient: recipient, Template: "welcome_email", Data: map[string]any{"Name": name}}
+		if _, err := svc.Send(context.Background(), msg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	send(ChannelInApp, "player-2", "Other")
+	send(ChannelEmail, "player-1", "Mail")
+	send(ChannelInApp, "player-1", "Ada")
+
+	scanner := bufio.NewScanner(resp.Body)
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			event = name
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var delivery Delivery
+		if err := json.Unmarshal([]byte(data), &delivery); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		if event != "notification" || delivery.Channel != ChannelInApp || delivery.Recipient != "player-1" ||
+			delivery.Body != "Hello Ada, welcome to CassandraNet!" {
+			t.Fatalf("expected only player-1's in-app notification, got %s %+v", event, delivery)
+		}
+		return
+	}
+	t.Fatalf("stream ended without an event: %v", scanner.Err())
+}
@@ -0,0 +1,454 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Errors returned for suppressions.
+var (
+	// ErrSuppressed is returned by Send for a recipient on the suppression
+	// list of the message's channel.
+	ErrSuppressed = errors.New("notification: recipient suppressed")
+	// ErrSuppressionNotFound is returned for recipients not on the list.
+	ErrSuppressionNotFound = errors.New("notification: suppression not found")
+	// ErrImportTooLarge is returned when an imported list holds more than
+	// MaxImportEntries entries or MaxImportBytes.
+	ErrImportTooLarge = errors.New("notification: suppression list too large")
+)
+
+// suppressionBucket holds suppressions as JSON keyed by channel and
+// normalised recipient.
+const suppressionBucket = "notification.suppressions"
+
+// Bounds of one imported suppression list.
+const (
+	MaxImportEntries = 100000
+	MaxImportBytes   = 32 << 20
+)
+
+// Suppression limits.
+const (
+	// maxReasonLength bounds a suppression's reason, in characters.
+	maxReasonLength = 1024
+	// maxReportedChanges bounds the changes an ImportReport lists; its
+	// counts cover every change.
+	maxReportedChanges = 1000
+)
+
+// Suppression keeps notifications on Channel from reaching Recipient, for
+// example after a bounce, a complaint, or an unsubscribe.
+type Suppression struct {
+	Channel   Channel   `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SuppressionChange is one change an import makes, or would make in a dry
+// run: "add", "update" (a new reason), or "remove".
+type SuppressionChange struct {
+	Action string `json:"action"`
+	Suppression
+	PreviousReason string `json:"previous_reason,omitempty"`
+}
+
+// ImportReport counts what an import of a suppression list changed. Changes
+// lists the first maxReportedChanges of them, and Truncated is set when
+// there were more.
+type ImportReport struct {
+	DryRun    bool                `json:"dry_run"`
+	Added     int                 `json:"added"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Removed   int                 `json:"removed"`
+	Changes   []SuppressionChange `json:"changes"`
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+func (r *ImportReport) record(change SuppressionChange) {
+	switch change.Action {
+	case "add":
+		r.Added++
+	case "update":
+		r.Updated++
+	case "remove":
+		r.Removed++
+	}
+	if len(r.Changes) == maxReportedChanges {
+		r.Truncated = true
+		return
+	}
+	r.Changes = append(r.Changes, change)
+}
+
+// ImportOptions controls ImportSuppressions. Channel, when set, is the one
+// channel every entry must be on. Replace removes the entries the import
+// does not list, within Channel when it is set; DryRun reports the changes
+// without making them.
+type ImportOptions struct {
+	Channel Channel
+	Replace bool
+	DryRun  bool
+}
+
+// Suppressions keeps the suppression list on a storage driver.
+type Suppressions struct {
+	db storage.Driver
+}
+
+// NewStorageSuppressions returns a suppression list in db.
+func NewStorageSuppressions(db storage.Driver) *Suppressions {
+	return &Suppressions{db: db}
+}
+
+// NewSuppressions returns a suppression list backed by an in-process memory
+// driver.
+func NewSuppressions() *Suppressions {
+	return NewStorageSuppressions(storage.NewMemory())
+}
+
+// normalizeRecipient returns the form recipients on channel are compared
+// in: trimmed, and email addresses in lower case.
+func normalizeRecipient(channel Channel, recipient string) string {
+	recipient = strings.TrimSpace(recipient)
+	if channel == ChannelEmail {
+		recipient = strings.ToLower(recipient)
+	}
+	return recipient
+}
+
+func suppressionKey(channel Channel, recipient string) string {
+	return string(channel) + "/" + normalizeRecipient(channel, recipient)
+}
+
+// Get returns the suppression of recipient on channel, or
+// ErrSuppressionNotFound.
+func (l *Suppressions) Get(ctx context.Context, channel Channel, recipient string) (Suppression, error) {
+	var out Suppression
+	err := storage.View(ctx, l.db, func(tx storage.Tx) error {
+		var err error
+		out, err = getSuppression(tx, suppressionKey(channel, recipient))
+		return err
+	})
+	return out, err
+}
+
+// Put adds sup to the list, or sets the reason of an existing entry, and
+// reports whether it added one.
+func (l *Suppressions) Put(ctx context.Context, sup Suppression) (Suppression, bool, error) {
+	sup.Recipient = normalizeRecipient(sup.Channel, sup.Recipient)
+	created := false
+	err := storage.Update(ctx, l.db, func(tx storage.Tx) error {
+		key := suppressionKey(sup.Channel, sup.Recipient)
+		existing, err := getSuppression(tx, key)
+		created = errors.Is(err, ErrSuppressionNotFound)
+		if err != nil && !created {
+			return err
+		}
+		if !created {
+			sup.CreatedAt = existing.CreatedAt
+		}
+		return putSuppression(tx, key, sup)
+	})
+	return sup, created, err
+}
+
+// Delete removes recipient's suppression on channel and returns it.
+func (l *Suppressions) Delete(ctx context.Context, channel Channel, recipient string) (Suppression, error) {
+	var out Suppression
+	err := storage.Update(ctx, l.db, func(tx storage.Tx) error {
+		key := suppressionKey(channel, recipient)
+		var err error
+		if out, err = getSuppression(tx, key); err != nil {
+			return err
+		}
+		return tx.Delete(suppressionBucket, key)
+	})
+	return out, err
+}
+
+// List returns one page of the suppressions on channel, or on every
+// channel when it is empty, ordered by channel and recipient.
+func (l *Suppressions) List(ctx context.Context, channel Channel, page pagination.Request) ([]Suppression, string, error) {
+	collector := pagination.NewCollector[Suppression](page)
+	err := l.Each(ctx, channel, func(key string, sup Suppression) error {
+		if collector.Skip(key) {
+			return nil
+		}
+		if !collector.Add(key, sup) {
+			return storage.StopScan
+		}
+		return nil
+	})
+	items, next := collector.Page()
+	return items, next, err
+}
+
+// Each calls fn with each suppression on channel, or on every channel when
+// it is empty, and its key, ordered by channel and recipient.
+func (l *Suppressions) Each(ctx context.Context, channel Channel, fn func(key string, sup Suppression) error) error {
+	prefix := ""
+	if channel != "" {
+		prefix = string(channel) + "/"
+	}
+	return storage.View(ctx, l.db, func(tx storage.Tx) error {
+		return tx.Scan(suppressionBucket, prefix, func(key string, value []byte) error {
+			var sup Suppression
+			if err := json.Unmarshal(value, &sup); err != nil {
+				return err
+			}
+			return fn(key, sup)
+		})
+	})
+}
+
+// Import applies entries to the list in one transaction, as opts says,
+// and reports the changes. Later entries for a recipient replace earlier
+// ones. Entries keep the creation time of the suppression they update.
+func (l *Suppressions) Import(ctx context.Context, entries []Suppression, opts ImportOptions) (ImportReport, error) {
+	apply := func(tx storage.Tx) (ImportReport, error) {
+		report := ImportReport{DryRun: opts.DryRun, Changes: []SuppressionChange{}}
+		listed := make(map[string]Suppression, len(entries))
+		var order []string
+		for _, sup := range entries {
+			key := suppressionKey(sup.Channel, sup.Recipient)
+			if _, ok := listed[key]; !ok {
+				order = append(order, key)
+			}
+			sup.Recipient = normalizeRecipient(sup.Channel, sup.Recipient)
+			listed[key] = sup
+		}
+		if opts.Replace {
+			prefix := ""
+			if opts.Channel != "" {
+				prefix = string(opts.Channel) + "/"
+			}
+			var removed []Suppression
+			err := tx.Scan(suppressionBucket, prefix, func(key string, value []byte) error {
+				if _, ok := listed[key]; ok {
+					return nil
+				}
+				var sup Suppression
+				if err := json.Unmarshal(value, &sup); err != nil {
+					return err
+				}
+				removed = append(removed, sup)
+				return nil
+			})
+			if err != nil {
+				return report, err
+			}
+			for _, sup := range removed {
+				report.record(SuppressionChange{Action: "remove", Suppression: sup})
+				if !opts.DryRun {
+					if err := tx.Delete(suppressionBucket, suppressionKey(sup.Channel, sup.Recipient)); err != nil {
+						return report, err
+					}
+				}
+			}
+		}
+		for _, key := range order {
+			sup := listed[key]
+			existing, err := getSuppression(tx, key)
+			switch {
+			case errors.Is(err, ErrSuppressionNotFound):
+				report.record(SuppressionChange{Action: "add", Suppression: sup})
+			case err != nil:
+				return report, err
+			case existing.Reason == sup.Reason:
+				report.Unchanged++
+				continue
+			default:
+				sup.CreatedAt = existing.CreatedAt
+				report.record(SuppressionChange{Action: "update", Suppression: sup, PreviousReason: existing.Reason})
+			}
+			if !opts.DryRun {
+				if err := putSuppression(tx, key, sup); err != nil {
+					return report, err
+				}
+			}
+		}
+		return report, nil
+	}
+	var report ImportReport
+	run := storage.Update
+	if opts.DryRun {
+		run = storage.View
+	}
+	err := run(ctx, l.db, func(tx storage.Tx) error {
+		var err error
+		report, err = apply(tx)
+		return err
+	})
+	return report, err
+}
+
+func getSuppression(tx storage.Tx, key string) (Suppression, error) {
+	data, err := tx.Get(suppressionBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Suppression{}, ErrSuppressionNotFound
+	}
+	if err != nil {
+		return Suppression{}, err
+	}
+	var sup Suppression
+	err = json.Unmarshal(data, &sup)
+	return sup, err
+}
+
+func putSuppression(tx storage.Tx, key string, sup Suppression) error {
+	data, err := json.Marshal(sup)
+	if err != nil {
+		return err
+	}
+	return tx.Put(suppressionBucket, key, data)
+}
+
+// SetSuppressions refuses to send to the recipients on l's list with
+// ErrSuppressed, and serves the list at /notifications/suppressions.
+// Call it before the service handles requests.
+func (s *Service) SetSuppressions(l *Suppressions) {
+	s.suppressions = l
+}
+
+// checkSuppressed returns ErrSuppressed when msg's recipient is on the
+// suppression list. A list that cannot be read refuses the send too.
+func (s *Service) checkSuppressed(ctx context.Context, msg Message) error {
+	if s.suppressions == nil {
+		return nil
+	}
+	_, err := s.suppressions.Get(ctx, msg.Channel, msg.Recipient)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: %s recipient %s", ErrSuppressed, msg.Channel, msg.Recipient)
+	case errors.Is(err, ErrSuppressionNotFound):
+		return nil
+	default:
+		return fmt.Errorf("%w: check suppressions: %w", ErrDispatchFailed, err)
+	}
+}
+
+// Suppress adds sup to the suppression list, or updates its reason, and
+// reports whether it added it.
+func (s *Service) Suppress(ctx context.Context, sup Suppression) (Suppression, bool, error) {
+	if s.suppressions == nil {
+		return Suppression{}, false, ErrSuppressionNotFound
+	}
+	var v validation.Validator
+	validateSuppression(&v, "", sup)
+	if err := v.Err(); err != nil {
+		return Suppression{}, false, err
+	}
+	var before any
+	if previous, err := s.suppressions.Get(ctx, sup.Channel, sup.Recipient); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrSuppressionNotFound) {
+		return Suppression{}, false, err
+	}
+	sup.CreatedAt = s.clock.Now()
+	saved, created, err := s.suppressions.Put(ctx, sup)
+	if err != nil {
+		return Suppression{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "notification.suppression.put",
+		Resource: "suppressions/" + suppressionKey(saved.Channel, saved.Recipient),
+		Before:   before,
+		After:    saved,
+	})
+	return saved, created, nil
+}
+
+// Unsuppress removes recipient's suppression on channel.
+func (s *Service) Unsuppress(ctx context.Context, channel Channel, recipient string) error {
+	if s.suppressions == nil {
+		return ErrSuppressionNotFound
+	}
+	sup, err := s.suppressions.Delete(ctx, channel, recipient)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "notification.suppression.delete",
+		Resource: "suppressions/" + suppressionKey(sup.Channel, sup.Recipient),
+		Before:   sup,
+	})
+	return nil
+}
+
+// ImportSuppressions checks every entry, then applies them to the
+// suppression list as opts says. Entries without a creation time get the
+// current one.
+func (s *Service) ImportSuppressions(ctx context.Context, entries []Suppression, opts ImportOptions) (ImportReport, error) {
+	if s.suppressions == nil {
+		return ImportReport{}, ErrSuppressionNotFound
+	}
+	if len(entries) > MaxImportEntries {
+		return ImportReport{}, ErrImportTooLarge
+	}
+	var v validation.Validator
+	if opts.Channel != "" {
+		v.String("channel", string(opts.Channel)).OneOf(channelNames()...)
+	}
+	now := s.clock.Now()
+	for i := range entries {
+		prefix := "entries[" + strconv.Itoa(i) + "]."
+		validateSuppression(&v, prefix, entries[i])
+		if opts.Channel != "" {
+			v.Check(entries[i].Channel == opts.Channel, prefix+"channel", validation.RuleOneOf, "must be "+string(opts.Channel)+", the import's channel")
+		}
+		if entries[i].CreatedAt.IsZero() {
+			entries[i].CreatedAt = now
+		}
+	}
+	if err := v.Err(); err != nil {
+		return ImportReport{}, err
+	}
+	report, err := s.suppressions.Import(ctx, entries, opts)
+	if err != nil || opts.DryRun {
+		return report, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "notification.suppression.import",
+		Resource: "suppressions",
+		After: map[string]any{
+			"channel": opts.Channel, "replace": opts.Replace,
+			"added": report.Added, "updated": report.Updated, "unchanged": report.Unchanged, "removed": report.Removed,
+		},
+	})
+	return report, nil
+}
+
+// ListSuppressions returns one page of the suppressions on channel, or on
+// every channel when it is empty, and the position of the next page.
+func (s *Service) ListSuppressions(ctx context.Context, channel Channel, page pagination.Request) ([]Suppression, string, error) {
+	if s.suppressions == nil {
+		return nil, "", ErrSuppressionNotFound
+	}
+	return s.suppressions.List(ctx, channel, page)
+}
+
+func validateSuppression(v *validation.Validator, prefix string, sup Suppression) {
+	v.String(prefix+"channel", string(sup.Channel)).Required().OneOf(channelNames()...)
+	v.String(prefix+"recipient", strings.TrimSpace(sup.Recipient)).Required().MaxLength(maxRecipientLength)
+	v.String(prefix+"reason", sup.Reason).MaxLength(maxReasonLength)
+}
+
+func channelNames() []string {
+	names := make([]string, len(channels))
+	for i, c := range channels {
+		names[i] = string(c)
+	}
+	return names
+}
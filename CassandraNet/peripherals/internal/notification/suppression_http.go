@@ -0,0 +1,362 @@
+package notification
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+const suppressionsPath = "/notifications/suppressions"
+
+// Formats of imported and exported suppression lists.
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+// suppressionHeader is the header row of exported CSV lists.
+var suppressionHeader = []string{"channel", "recipient", "reason", "created_at"}
+
+// handleSuppressions lists the suppression list, filtered by channel and
+// recipient, adds or updates an entry with POST, and removes one with
+// DELETE ?channel=&recipient=.
+func (s *Service) handleSuppressions(w http.ResponseWriter, r *http.Request) {
+	if !s.suppressionsEnabled(w, r) {
+		return
+	}
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		channel := Channel(query.Get("channel"))
+		var v validation.Validator
+		v.String("channel", string(channel)).OneOf(channelNames()...)
+		if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+			return
+		}
+		if recipient := query.Get("recipient"); recipient != "" {
+			// A recipient lists its suppressions on the one channel, or
+			// on each.
+			s.writeRecipientSuppressions(w, r, channel, recipient)
+			return
+		}
+		page, err := pagination.Parse(r, pagination.DefaultLimit)
+		if validation.Write(w, r, "notification.invalid_request", err) {
+			return
+		}
+		items, next, err := s.ListSuppressions(r.Context(), channel, page)
+		if err != nil {
+			s.suppressionError(w, r, err)
+			return
+		}
+		pagination.Write(w, r, items, next)
+	case http.MethodPost:
+		defer r.Body.Close()
+		var sup Suppression
+		if err := json.NewDecoder(r.Body).Decode(&sup); err != nil {
+			problem.DecodeFailed(w, r, "notification.invalid_json", "invalid json", err)
+			return
+		}
+		saved, created, err := s.Suppress(r.Context(), Suppression{Channel: sup.Channel, Recipient: sup.Recipient, Reason: sup.Reason})
+		if err != nil {
+			s.suppressionError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, saved)
+	case http.MethodDelete:
+		channel, recipient := Channel(query.Get("channel")), query.Get("recipient")
+		var v validation.Validator
+		v.String("channel", string(channel)).Required()
+		v.String("recipient", recipient).Required()
+		if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+			return
+		}
+		if err := s.Unsuppress(r.Context(), channel, recipient); err != nil {
+			s.suppressionError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		problem.MethodNotAllowed(w, r, "notification", http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (s *Service) writeRecipientSuppressions(w http.ResponseWriter, r *http.Request, channel Channel, recipient string) {
+	lookup := channels
+	if channel != "" {
+		lookup = []Channel{channel}
+	}
+	items := []Suppression{}
+	for _, c := range lookup {
+		sup, err := s.suppressions.Get(r.Context(), c, recipient)
+		if errors.Is(err, ErrSuppressionNotFound) {
+			continue
+		}
+		if err != nil {
+			s.suppressionError(w, r, err)
+			return
+		}
+		items = append(items, sup)
+	}
+	pagination.Write(w, r, items, "")
+}
+
+// handleSuppressionFile serves GET /notifications/suppressions/export and
+// POST /notifications/suppressions/import.
+func (s *Service) handleSuppressionFile(w http.ResponseWriter, r *http.Request) {
+	if !s.suppressionsEnabled(w, r) {
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, suppressionsPath+"/") {
+	case "export":
+		if r.Method != http.MethodGet {
+			problem.MethodNotAllowed(w, r, "notification", http.MethodGet)
+			return
+		}
+		s.handleExportSuppressions(w, r)
+	case "import":
+		if r.Method != http.MethodPost {
+			problem.MethodNotAllowed(w, r, "notification", http.MethodPost)
+			return
+		}
+		s.handleImportSuppressions(w, r)
+	default:
+		problem.Write(w, r, http.StatusNotFound, "notification.not_found", "resource not found")
+	}
+}
+
+// handleExportSuppressions streams the list, or one channel's part of it,
+// as NDJSON or, with format=csv, as CSV with a header row. A store failure
+// after the first entry can only cut the body short.
+func (s *Service) handleExportSuppressions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	channel, format := Channel(query.Get("channel")), query.Get("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+	var v validation.Validator
+	v.String("channel", string(channel)).OneOf(channelNames()...)
+	v.String("format", format).OneOf(formatCSV, formatNDJSON)
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+		return
+	}
+	var write func(Suppression) error
+	var flush func()
+	start := func() {
+		w.Header().Set("Content-Disposition", `attachment; filename="suppressions.`+format+`"`)
+		if format == formatCSV {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			out := csv.NewWriter(w)
+			_ = out.Write(suppressionHeader)
+			write = func(sup Suppression) error {
+				return out.Write([]string{string(sup.Channel), sup.Recipient, sup.Reason, sup.CreatedAt.Format(time.RFC3339Nano)})
+			}
+			flush = out.Flush
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		write = func(sup Suppression) error { return enc.Encode(sup) }
+		flush = func() {}
+	}
+	err := s.suppressions.Each(r.Context(), channel, func(_ string, sup Suppression) error {
+		if write == nil {
+			start()
+		}
+		return write(sup)
+	})
+	if write == nil {
+		if err != nil {
+			s.suppressionError(w, r, err)
+			return
+		}
+		start()
+	}
+	flush()
+}
+
+// handleImportSuppressions reads a CSV or NDJSON list, as Content-Type or
+// format says, and applies it with ImportSuppressions. channel is the
+// channel of CSV rows without one and, when set, the only one allowed;
+// replace=true removes the entries the list lacks, and dry_run=true
+// reports the changes without making them. The list is read and checked in
+// full before anything changes.
+func (s *Service) handleImportSuppressions(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	query := r.URL.Query()
+	opts := ImportOptions{Channel: Channel(query.Get("channel"))}
+	format := query.Get("format")
+	if format == "" {
+		format = formatNDJSON
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			format = formatCSV
+		}
+	}
+	var v validation.Validator
+	v.String("format", format).OneOf(formatCSV, formatNDJSON)
+	opts.Replace = parseBool(&v, "replace", query.Get("replace"))
+	opts.DryRun = parseBool(&v, "dry_run", query.Get("dry_run"))
+	if validation.Write(w, r, "notification.invalid_request", v.Err()) {
+		return
+	}
+	limited := &io.LimitedReader{R: r.Body, N: MaxImportBytes + 1}
+	var entries []Suppression
+	var err error
+	if format == formatCSV {
+		entries, err = readSuppressionCSV(limited, opts.Channel)
+	} else {
+		entries, err = readSuppressionNDJSON(limited)
+	}
+	if limited.N <= 0 {
+		err = ErrImportTooLarge
+	}
+	var report ImportReport
+	if err == nil {
+		report, err = s.ImportSuppressions(r.Context(), entries, opts)
+	}
+	if err != nil {
+		s.suppressionError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// readSuppressionCSV reads a CSV list with a header row naming its columns:
+// recipient (or email), and optionally channel, reason, and created_at.
+// Other columns, as other providers' exports carry, are ignored. Rows
+// without a channel take channel, or email.
+func readSuppressionCSV(body io.Reader, channel Channel) ([]Suppression, error) {
+	if channel == "" {
+		channel = ChannelEmail
+	}
+	rows := csv.NewReader(body)
+	rows.FieldsPerRecord = -1
+	rows.ReuseRecord = true
+	header, err := rows.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, validation.Invalid("body", validation.RuleFormat, "must be CSV: "+err.Error())
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "email" {
+			name = "recipient"
+		}
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["recipient"]; !ok {
+		return nil, validation.Invalid("body", validation.RuleRequired, "needs a header row with a recipient or email column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var entries []Suppression
+	var v validation.Validator
+	for {
+		record, err := rows.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, validation.Invalid("body", validation.RuleFormat, "must be CSV: "+err.Error())
+		}
+		if len(entries) == MaxImportEntries {
+			return nil, ErrImportTooLarge
+		}
+		sup := Suppression{
+			Channel:   Channel(field(record, "channel")),
+			Recipient: field(record, "recipient"),
+			Reason:    field(record, "reason"),
+		}
+		if sup.Channel == "" {
+			sup.Channel = channel
+		}
+		if raw := field(record, "created_at"); raw != "" {
+			var err error
+			sup.CreatedAt, err = time.Parse(time.RFC3339Nano, raw)
+			v.Check(err == nil, "entries["+strconv.Itoa(len(entries))+"].created_at", validation.RuleFormat, "must be an RFC 3339 timestamp")
+		}
+		entries = append(entries, sup)
+	}
+	return entries, v.Err()
+}
+
+// readSuppressionNDJSON reads one JSON suppression per line, skipping
+// blank lines.
+func readSuppressionNDJSON(body io.Reader) ([]Suppression, error) {
+	lines := bufio.NewScanner(body)
+	var entries []Suppression
+	var v validation.Validator
+	for lines.Scan() {
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(entries) == MaxImportEntries {
+			return nil, ErrImportTooLarge
+		}
+		var sup Suppression
+		v.Check(json.Unmarshal(line, &sup) == nil, "entries["+strconv.Itoa(len(entries))+"]", validation.RuleFormat, "must be a JSON suppression")
+		entries = append(entries, sup)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, validation.Invalid("body", validation.RuleFormat, "must be NDJSON: "+err.Error())
+	}
+	return entries, v.Err()
+}
+
+// parseBool reads an optional boolean query parameter.
+func parseBool(v *validation.Validator, field, raw string) bool {
+	if raw == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(raw)
+	v.Check(err == nil, field, validation.RuleFormat, "must be true or false")
+	return b
+}
+
+// suppressionsEnabled writes 404 unless the service has Suppressions.
+func (s *Service) suppressionsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.suppressions == nil {
+		problem.Write(w, r, http.StatusNotFound, "notification.not_found", "the suppression list is not enabled")
+		return false
+	}
+	return true
+}
+
+func (s *Service) suppressionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrSuppressionNotFound):
+		problem.Write(w, r, http.StatusNotFound, "notification.suppression_not_found", err.Error())
+	case errors.Is(err, ErrImportTooLarge):
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, "notification.import_too_large", err.Error())
+	case validation.Write(w, r, "notification.invalid_request", err):
+	default:
+		logging.For(r.Context(), s.logger).Printf("suppressions: %v", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, "notification.suppressions_unavailable", "suppression list unavailable")
+	}
+}
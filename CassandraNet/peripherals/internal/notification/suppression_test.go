@@ -0,0 +1,91 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSuppressionsImportDiffsAndBlocksSends(t *testing.T) {
+	svc := NewService(NewTemplateStore(), map[Channel]Sender{ChannelEmail: NewMemorySender()}, NewHistory(10), noopLogger{})
+	svc.SetSuppressions(NewSuppressions())
+	ctx := context.Background()
+	if _, _, err := svc.Suppress(ctx, Suppression{Channel: ChannelEmail, Recipient: "Kept@Example.com", Reason: "bounce"}); err != nil {
+		t.Fatalf("suppress: %v", err)
+	}
+	if _, _, err := svc.Suppress(ctx, Suppression{Channel: ChannelEmail, Recipient: "stale@example.com"}); err != nil {
+		t.Fatalf("suppress: %v", err)
+	}
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	post := func(query, contentType, body string) (int, ImportReport) {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/notifications/suppressions/import?"+query, contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("import: %v", err)
+		}
+		defer resp.Body.Close()
+		var report ImportReport
+		_ = json.NewDecoder(resp.Body).Decode(&report)
+		return resp.StatusCode, report
+	}
+	// A previous provider's export, with its own columns.
+	list := "Email,Reason,Provider ID\nkept@example.com,complaint,1\nnew@example.com,,2\nkept@example.com,complaint,3\n"
+
+	status, report := post("replace=true&dry_run=true", "text/csv", list)
+	if status != http.StatusOK || !report.DryRun || report.Added != 1 || report.Updated != 1 || report.Removed != 1 || report.Unchanged != 0 || len(report.Changes) != 3 {
+		t.Fatalf("unexpected dry run %d %+v", status, report)
+	}
+	if _, err := svc.suppressions.Get(ctx, ChannelEmail, "new@example.com"); !errors.Is(err, ErrSuppressionNotFound) {
+		t.Fatalf("expected the dry run to change nothing, got %v", err)
+	}
+
+	if status, report = post("replace=true", "text/csv", list); status != http.StatusOK || report.Added != 1 || report.Updated != 1 || report.Removed != 1 {
+		t.Fatalf("unexpected import %d %+v", status, report)
+	}
+	if sup, err := svc.suppressions.Get(ctx, ChannelEmail, "KEPT@example.com"); err != nil || sup.Reason != "complaint" {
+		t.Fatalf("expected the reason updated, got %+v %v", sup, err)
+	}
+	if _, err := svc.suppressions.Get(ctx, ChannelEmail, "stale@example.com"); !errors.Is(err, ErrSuppressionNotFound) {
+		t.Fatalf("expected the unlisted entry removed, got %v", err)
+	}
+	if _, err := svc.Send(ctx, Message{Channel: ChannelEmail, Recipient: "New@Example.com", Template: "welcome_email"}); !errors.Is(err, ErrSuppressed) {
+		t.Fatalf("expected sends to a suppressed recipient refused, got %v", err)
+	}
+
+	ndjson := `{"channel":"email","recipient":"ok@example.com"}` + "\n\n" + `{"channel":"sms","recipient":""}` + "\n"
+	resp, err := http.Post(server.URL+"/notifications/suppressions/import", "application/x-ndjson", strings.NewReader(ndjson))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || !bytes.Contains(body, []byte(`"entries[1].channel"`)) || !bytes.Contains(body, []byte(`"entries[1].recipient"`)) {
+		t.Fatalf("expected the invalid entry reported, got %d %s", resp.StatusCode, body)
+	}
+	if _, err := svc.suppressions.Get(ctx, ChannelEmail, "ok@example.com"); !errors.Is(err, ErrSuppressionNotFound) {
+		t.Fatalf("expected an invalid list to change nothing, got %v", err)
+	}
+
+	resp, err = http.Get(server.URL + "/notifications/suppressions/export?format=csv")
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	_ = resp.Body.Close()
+	if err != nil || len(rows) != 3 || rows[1][1] != "kept@example.com" || rows[2][1] != "new@example.com" || rows[1][2] != "complaint" {
+		t.Fatalf("unexpected export %v %v", rows, err)
+	}
+	var exported bytes.Buffer
+	_ = csv.NewWriter(&exported).WriteAll(rows)
+	if status, report = post("replace=true&dry_run=true", "text/csv", exported.String()); status != http.StatusOK || report.Unchanged != 2 || len(report.Changes) != 0 {
+		t.Fatalf("expected an export to import unchanged, got %d %+v", status, report)
+	}
+}
@@ -24,6 +24,11 @@ func NewTemplateStore() *TemplateStore {
 	_ = store.Register("welcome_email", "Hello {{.Name}}, welcome to CassandraNet!")
 	_ = store.Register("password_reset", "Hi {{.Name}}, use code {{.Code}} to reset your password.")
 	_ = store.Register("moderation_alert", "Content {{.ContentID}} was flagged for review.")
+	_ = store.Register("metric_alert", "Alert {{.Rule}} is {{.State}}: {{.Metric}} = {{.Value}} ({{.Comparator}} {{.Threshold}}).")
+	_ = store.Register("service_health", "Service {{.Service}} is {{.State}} (was {{.Previous}}){{if .Error}}: {{.Error}}{{end}}.")
+	_ = store.Register("consumer_lag", "Consumer group {{.Group}} is {{.State}}: {{.Unacked}} unacked and {{.Unpulled}} unpulled messages, the oldest {{.OldestAge}} old{{if .Exceeded}} (over {{.Exceeded}}){{end}}.")
+	_ = store.Register("content_reviewed", "Content {{.ContentID}} was {{.State}}{{if .Reason}}: {{.Reason}}{{end}}.")
+	_ = store.Register("assignment_completed", "Assignment {{.AssignmentID}} for agent {{.AgentID}} is {{.Status}}{{if .StatusMessage}}: {{.StatusMessage}}{{end}}.")
 	return store
 }
 
@@ -21,8 +21,20 @@ type Message struct {
 
 // Delivery is the concrete payload delivered to a recipient.
 type Delivery struct {
-	Channel   Channel   `json:"channel"`
-	Recipient string    `json:"recipient"`
-	Body      string    `json:"body"`
-	SentAt    time.Time `json:"sent_at"`
+	// ID is assigned by Send; deliveries recorded before IDs were
+	// introduced have none.
+	ID        string  `json:"id,omitempty"`
+	Channel   Channel `json:"channel"`
+	Recipient string  `json:"recipient"`
+	// Template names the template the body was rendered from; deliveries
+	// recorded before it was introduced have none.
+	Template string    `json:"template,omitempty"`
+	Body     string    `json:"body"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Template is a named message template.
+type Template struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
 }
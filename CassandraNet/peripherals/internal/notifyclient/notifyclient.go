@@ -0,0 +1,99 @@
+// Package notifyclient is how services send their own notifications, such
+// as metric alerts, consumer lag, service health changes, and scheduled
+// notify actions, through the notification service's /notify endpoint. A
+// Client turns each of the caller's values into a Notification and posts
+// it, and offers the health check services register for the dependency:
+//
+//	notifier, err := notifyclient.New(url, transport, func(a Alert) notifyclient.Notification {
+//		return notifyclient.Notification{Channel: "webhook", Recipient: "ops", Template: "metric_alert", Data: ...}
+//	})
+//	checks.Optional("notification service", notifier.Check)
+//
+// It does not use pkg/client, whose tests run the services that import it.
+package notifyclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Timeout bounds each call to the notification service.
+const Timeout = 5 * time.Second
+
+// Notification asks the notification service to render Template with Data
+// and deliver it to Recipient over Channel.
+type Notification struct {
+	Channel   string         `json:"channel"`
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Client sends values of type T as notifications.
+type Client[T any] struct {
+	baseURL string
+	client  *http.Client
+	render  func(T) Notification
+}
+
+// New returns a client for the notification service at baseURL, an
+// absolute http(s) URL, calling it through transport, or
+// http.DefaultTransport when nil, that sends each value as render
+// describes it.
+func New[T any](baseURL string, transport http.RoundTripper, render func(T) Notification) (*Client[T], error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("notification service URL %q must be an absolute http(s) URL", baseURL)
+	}
+	return &Client[T]{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: Timeout, Transport: transport},
+		render:  render,
+	}, nil
+}
+
+// Notify sends v. It is not retried, so recipients are not notified twice;
+// callers decide whether a failure is worth another attempt.
+func (c *Client[T]) Notify(ctx context.Context, v T) error {
+	body, err := json.Marshal(c.render(v))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/notify", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification service returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Check reports whether the notification service answers its health check.
+func (c *Client[T]) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("notification service returned %s", resp.Status)
+	}
+	return nil
+}
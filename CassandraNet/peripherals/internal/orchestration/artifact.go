@@ -0,0 +1,109 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrArtifactNotFound is returned when an assignment has no artifact
+	// of the requested name.
+	ErrArtifactNotFound = errors.New("orchestration: artifact not found")
+	// ErrTooManyArtifacts is returned for a new artifact on an assignment
+	// that already holds MaxArtifacts.
+	ErrTooManyArtifacts = fmt.Errorf("orchestration: an assignment holds at most %d artifacts", MaxArtifacts)
+)
+
+// Artifact limits. Larger outputs belong in a blob store, referenced by
+// URI.
+const (
+	// MaxArtifacts bounds the artifacts one assignment holds.
+	MaxArtifacts = 32
+	// MaxInlineResultBytes bounds an artifact's inline Result.
+	MaxInlineResultBytes = 64 << 10
+	// maxArtifactURILength bounds an artifact's URI, in characters.
+	maxArtifactURILength = 2048
+	// maxContentTypeLength bounds an artifact's ContentType, in characters.
+	maxContentTypeLength = 255
+)
+
+// Artifact is an output an agent attached to an assignment: either a small
+// JSON Result stored inline, or a reference by URI to a blob the agent
+// stored elsewhere, with its ContentType, Size, and SHA256 digest when
+// known. Names are unique within an assignment.
+type Artifact struct {
+	Name        string          `json:"name"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	URI         string          `json:"uri,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	SHA256      string          `json:"sha256,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// AttachArtifact validates artifact and stores it with assignment id,
+// replacing the assignment's artifact of the same name, and reports
+// whether it added one. Artifacts may be attached in any status, so agents
+// can report outputs after completing their work.
+func (s *Service) AttachArtifact(ctx context.Context, id string, artifact Artifact) (Assignment, bool, error) {
+	if string(artifact.Result) == "null" {
+		artifact.Result = nil
+	}
+	var v validation.Validator
+	v.ID("assignment_id", id)
+	v.ID("name", artifact.Name)
+	hasResult, hasURI := len(artifact.Result) > 0, artifact.URI != ""
+	v.Check(hasResult != hasURI, "result", validation.RuleRequired, "exactly one of result and uri is required")
+	if hasResult {
+		v.Check(json.Valid(artifact.Result), "result", validation.RuleFormat, "must be valid JSON")
+		v.Check(len(artifact.Result) <= MaxInlineResultBytes, "result", validation.RuleMaxBytes,
+			fmt.Sprintf("must be at most %d bytes; store larger results elsewhere and attach their uri", MaxInlineResultBytes))
+	}
+	if hasURI {
+		v.String("uri", artifact.URI).MaxLength(maxArtifactURILength)
+		parsed, err := url.Parse(artifact.URI)
+		v.Check(err == nil && parsed.Scheme != "" && (parsed.Host != "" || parsed.Opaque != "" || parsed.Path != ""),
+			"uri", validation.RuleFormat, "must be an absolute URI")
+	}
+	v.String("content_type", artifact.ContentType).MaxLength(maxContentTypeLength)
+	v.Check(artifact.Size >= 0, "size", validation.RuleRange, "must not be negative")
+	if artifact.SHA256 != "" {
+		digest, err := hex.DecodeString(artifact.SHA256)
+		v.Check(err == nil && len(digest) == 32, "sha256", validation.RuleFormat, "must be 64 hex digits")
+	}
+	if err := v.Err(); err != nil {
+		return Assignment{}, false, err
+	}
+	artifact.CreatedAt = s.clock.Now()
+	updated, added, err := s.store.PutArtifact(ctx, id, artifact)
+	if err != nil {
+		return Assignment{}, false, err
+	}
+	s.admin.Publish(AdminTopic, updated.TenantID, updated.ProjectID, updated)
+	return updated, added, nil
+}
+
+// Artifact returns assignment id's artifact with name.
+func (s *Service) Artifact(ctx context.Context, id, name string) (Artifact, error) {
+	assignment, err := s.GetAssignment(ctx, id)
+	if err != nil {
+		return Artifact{}, err
+	}
+	return findArtifact(assignment, name)
+}
+
+func findArtifact(assignment Assignment, name string) (Artifact, error) {
+	for _, artifact := range assignment.Artifacts {
+		if artifact.Name == name {
+			return artifact, nil
+		}
+	}
+	return Artifact{}, ErrArtifactNotFound
+}
@@ -0,0 +1,92 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+type artifactPayload struct {
+	Name        string          `json:"name"`
+	Result      json.RawMessage `json:"result"`
+	URI         string          `json:"uri"`
+	ContentType string          `json:"content_type"`
+	Size        int64           `json:"size"`
+	SHA256      string          `json:"sha256"`
+}
+
+// handleArtifacts serves /assignments/{id}/artifacts, where rest is the
+// path after the ID: GET lists the assignment's artifacts and POST
+// attaches one, needing assignments.update like status updates, and
+// /assignments/{id}/artifacts/{name} returns one. Both checks use the
+// assignment's own tenant and project.
+func (s *Service) handleArtifacts(w http.ResponseWriter, r *http.Request, id, rest string) {
+	name, named := strings.CutPrefix(rest, "artifacts/")
+	if rest != "artifacts" && (!named || name == "" || strings.Contains(name, "/")) {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet, r.Method == http.MethodPost && !named:
+	case named:
+		headerAllow(w, r, http.MethodGet)
+		return
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPost)
+		return
+	}
+	assignment, err := s.GetAssignment(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if r.Method == http.MethodGet {
+		if !auth.Allow(w, r, auth.PermAssignmentsRead, assignment.TenantID, assignment.ProjectID) {
+			return
+		}
+		if !named {
+			artifacts := assignment.Artifacts
+			if artifacts == nil {
+				artifacts = []Artifact{}
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"items": artifacts})
+			return
+		}
+		artifact, err := findArtifact(assignment, name)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, artifact)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsUpdate, assignment.TenantID, assignment.ProjectID) {
+		return
+	}
+	defer r.Body.Close()
+	var payload artifactPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	updated, added, err := s.AttachArtifact(r.Context(), id, Artifact{
+		Name:        payload.Name,
+		Result:      payload.Result,
+		URI:         payload.URI,
+		ContentType: payload.ContentType,
+		Size:        payload.Size,
+		SHA256:      payload.SHA256,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, updated)
+}
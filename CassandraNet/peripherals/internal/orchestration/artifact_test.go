@@ -0,0 +1,75 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAgentsAttachArtifactsToAssignments(t *testing.T) {
+	svc, _ := newTestService(t)
+	h := svc.Handler()
+	ctx := context.Background()
+	assignment, err := assign(t, svc, "acme", "agent-1", "build")
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if _, err := setStatus(t, svc, assignment.AssignmentID, StatusCompleted); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	id := assignment.AssignmentID
+	if _, added, err := svc.AttachArtifact(ctx, id, Artifact{Name: "summary", Result: json.RawMessage(`{"tests":12,"failed":0}`)}); err != nil || !added {
+		t.Fatalf("attach summary: %v %v", added, err)
+	}
+	digest := strings.Repeat("ab", 32)
+	if _, _, err := svc.AttachArtifact(ctx, id, Artifact{
+		Name: "bundle", URI: "s3://builds/acme/bundle.tar.gz", ContentType: "application/gzip", Size: 4096, SHA256: digest,
+	}); err != nil {
+		t.Fatalf("attach bundle: %v", err)
+	}
+	// Attaching a name again replaces the artifact.
+	updated, added, err := svc.AttachArtifact(ctx, id, Artifact{Name: "summary", Result: json.RawMessage(`{"tests":12,"failed":1}`)})
+	if err != nil || added || len(updated.Artifacts) != 2 || updated.Status != StatusCompleted {
+		t.Fatalf("replace summary = %+v %v, %v", updated, added, err)
+	}
+
+	got, err := svc.GetAssignment(ctx, id)
+	if err != nil || len(got.Artifacts) != 2 || got.Artifacts[0].Name != "summary" || string(got.Artifacts[0].Result) != `{"tests":12,"failed":1}` {
+		t.Fatalf("expected the artifacts stored with the assignment, got %+v %v", got.Artifacts, err)
+	}
+	bundle, err := svc.Artifact(ctx, id, "bundle")
+	if err != nil || bundle.URI != "s3://builds/acme/bundle.tar.gz" || bundle.SHA256 != digest || bundle.Size != 4096 {
+		t.Fatalf("artifact = %+v, %v", bundle, err)
+	}
+	if _, err := svc.Artifact(ctx, id, "missing"); !errors.Is(err, ErrArtifactNotFound) {
+		t.Fatalf("expected ErrArtifactNotFound, got %v", err)
+	}
+	if _, _, err := svc.AttachArtifact(ctx, "missing", Artifact{Name: "summary", Result: json.RawMessage(`{}`)}); !errors.Is(err, ErrAssignmentNotFound) {
+		t.Fatalf("expected ErrAssignmentNotFound, got %v", err)
+	}
+	for i := len(got.Artifacts); i < MaxArtifacts; i++ {
+		if _, _, err := svc.AttachArtifact(ctx, id, Artifact{Name: fmt.Sprintf("part-%d", i), Result: json.RawMessage(`{}`)}); err != nil {
+			t.Fatalf("attach part %d: %v", i, err)
+		}
+	}
+	if _, _, err := svc.AttachArtifact(ctx, id, Artifact{Name: "extra", Result: json.RawMessage(`{}`)}); !errors.Is(err, ErrTooManyArtifacts) {
+		t.Fatalf("expected ErrTooManyArtifacts, got %v", err)
+	}
+	if _, _, err := svc.AttachArtifact(ctx, id, Artifact{Name: "summary", Result: json.RawMessage(`{}`)}); err != nil {
+		t.Fatalf("expected a full assignment to still replace artifacts, got %v", err)
+	}
+
+	if status, body := serve(t, h, http.MethodGet, "/assignments/"+id+"/artifacts/missing", nil); status != http.StatusNotFound {
+		t.Fatalf("missing artifact: %d %s", status, body)
+	}
+	status, body := serve(t, h, http.MethodPost, "/assignments/"+id+"/artifacts", map[string]any{
+		"name": "both", "result": map[string]int{"n": 1}, "uri": "https://example.com/out", "sha256": "xyz",
+	})
+	if status != http.StatusBadRequest || !strings.Contains(string(body), `"result"`) || !strings.Contains(string(body), `"sha256"`) {
+		t.Fatalf("expected an invalid artifact refused, got %d %s", status, body)
+	}
+}
@@ -0,0 +1,151 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrAgentDraining is returned when work is assigned to, or started on, an
+// agent that is being drained.
+var ErrAgentDraining = errors.New("orchestration: agent is draining")
+
+// ErrAgentNotDraining is returned when ending the drain of an agent that is
+// not being drained.
+var ErrAgentNotDraining = errors.New("orchestration: agent is not draining")
+
+// maxReassignTargets bounds the agents a drain moves pending work to.
+const maxReassignTargets = 32
+
+// AgentDrain takes an agent out of scheduling, for example while its host
+// is maintained. While it lasts, assignments cannot be created for the
+// agent and its pending assignments cannot be started; those already
+// assigned or in progress run to completion.
+type AgentDrain struct {
+	AgentID string `json:"agent_id"`
+	Reason  string `json:"reason,omitempty"`
+	// ReassignTo lists the agents the drained agent's pending assignments
+	// are moved to, in turn. Draining agents among them are skipped; with
+	// none, pending assignments wait for the drain to end.
+	ReassignTo []string  `json:"reassign_to,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	// Reassigned counts the pending assignments moved elsewhere since the
+	// drain started.
+	Reassigned int `json:"reassigned"`
+}
+
+// DrainStatus reports an agent's drain and its progress.
+type DrainStatus struct {
+	AgentDrain
+	Draining bool `json:"draining"`
+	// Pending and Running count the agent's assignments that are pending,
+	// and assigned or in progress.
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+	// Drained is set once a draining agent has no pending or running
+	// assignments left, so its host can be taken down.
+	Drained bool `json:"drained"`
+}
+
+// DrainRequest starts, or updates, an agent's drain.
+type DrainRequest struct {
+	AgentID    string
+	Reason     string
+	ReassignTo []string
+}
+
+// DrainAgent stops new work going to an agent and moves its pending
+// assignments to req.ReassignTo, if any. Draining an agent again updates
+// its reason and targets and moves what is still pending.
+func (s *Service) DrainAgent(ctx context.Context, req DrainRequest) (DrainStatus, error) {
+	var v validation.Validator
+	v.ID("agent_id", req.AgentID)
+	v.String("reason", req.Reason).MaxLength(maxStatusMessageLength)
+	v.Check(len(req.ReassignTo) <= maxReassignTargets, "reassign_to", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxReassignTargets))
+	for i, target := range req.ReassignTo {
+		field := fmt.Sprintf("reassign_to[%d]", i)
+		v.ID(field, target)
+		v.Check(target != req.AgentID, field, validation.RuleFormat, "must differ from the drained agent")
+	}
+	if err := v.Err(); err != nil {
+		return DrainStatus{}, err
+	}
+	var before any
+	if previous, err := s.store.GetDrain(ctx, req.AgentID); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrAgentNotDraining) {
+		return DrainStatus{}, err
+	}
+	drain, reassigned, err := s.store.DrainAgent(ctx, AgentDrain{
+		AgentID:    req.AgentID,
+		Reason:     req.Reason,
+		ReassignTo: slices.Clone(req.ReassignTo),
+		StartedAt:  s.clock.Now(),
+	})
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "orchestration.agent.drain",
+		Resource: "agents/" + drain.AgentID,
+		Before:   before,
+		After:    drain,
+	})
+	for _, assignment := range reassigned {
+		s.admin.Publish(AdminTopic, assignment.TenantID, assignment.ProjectID, assignment)
+	}
+	return s.drainStatus(ctx, drain, true)
+}
+
+// UndrainAgent ends an agent's drain, so work can be assigned to it again.
+func (s *Service) UndrainAgent(ctx context.Context, agentID string) error {
+	if agentID == "" {
+		return validation.Invalid("agent_id", validation.RuleRequired, "is required")
+	}
+	drain, err := s.store.UndrainAgent(ctx, agentID)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:   "orchestration.agent.undrain",
+		Resource: "agents/" + agentID,
+		Before:   drain,
+	})
+	return nil
+}
+
+// DrainStatus reports whether an agent is draining and how much of its
+// work remains.
+func (s *Service) DrainStatus(ctx context.Context, agentID string) (DrainStatus, error) {
+	if agentID == "" {
+		return DrainStatus{}, validation.Invalid("agent_id", validation.RuleRequired, "is required")
+	}
+	drain, err := s.store.GetDrain(ctx, agentID)
+	draining := err == nil
+	if errors.Is(err, ErrAgentNotDraining) {
+		drain, err = AgentDrain{AgentID: agentID}, nil
+	}
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	return s.drainStatus(ctx, drain, draining)
+}
+
+func (s *Service) drainStatus(ctx context.Context, drain AgentDrain, draining bool) (DrainStatus, error) {
+	usage, err := s.store.AgentUsage(ctx, drain.AgentID)
+	if err != nil {
+		return DrainStatus{}, err
+	}
+	return DrainStatus{
+		AgentDrain: drain,
+		Draining:   draining,
+		Pending:    usage.Queued,
+		Running:    usage.Running,
+		Drained:    draining && usage.Queued == 0 && usage.Running == 0,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const agentsPrefix = "/agents/"
+
+type drainPayload struct {
+	Reason     string   `json:"reason"`
+	ReassignTo []string `json:"reassign_to"`
+}
+
+// handleAgent serves /agents/{id}/drain. Agents serve every tenant, so
+// draining one needs agents.manage across all of them.
+func (s *Service) handleAgent(w http.ResponseWriter, r *http.Request) {
+	agentID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, agentsPrefix), "/drain")
+	if !ok || agentID == "" || strings.Contains(agentID, "/") {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermAssignmentsRead, "", "") {
+			return
+		}
+		status, err := s.DrainStatus(r.Context(), agentID)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, status)
+	case http.MethodPost:
+		if !auth.Allow(w, r, auth.PermAgentsManage, "", "") {
+			return
+		}
+		s.handleDrain(w, r, agentID)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermAgentsManage, "", "") {
+			return
+		}
+		if err := s.UndrainAgent(r.Context(), agentID); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+func (s *Service) handleDrain(w http.ResponseWriter, r *http.Request, agentID string) {
+	defer r.Body.Close()
+	// The body is optional: an empty one drains without reassigning.
+	var payload drainPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	status, err := s.DrainAgent(r.Context(), DrainRequest{
+		AgentID:    agentID,
+		Reason:     payload.Reason,
+		ReassignTo: payload.ReassignTo,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
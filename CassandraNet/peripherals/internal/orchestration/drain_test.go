@@ -0,0 +1,64 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestAgentDrainReassignsPendingWork(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	build := func(agent string) Assignment {
+		t.Helper()
+		assignment, err := assign(t, svc, "acme", agent, "build")
+		if err != nil {
+			t.Fatalf("assign to %s: %v", agent, err)
+		}
+		return assignment
+	}
+	running := build("agent-1")
+	if _, err := setStatus(t, svc, running.AssignmentID, StatusRunning); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	first, second := build("agent-1"), build("agent-1")
+
+	var invalid validation.Errors
+	if _, err := svc.DrainAgent(ctx, DrainRequest{AgentID: "agent-1", ReassignTo: []string{"agent-1"}}); !errors.As(err, &invalid) {
+		t.Fatalf("expected draining onto itself refused, got %v", err)
+	}
+	status, err := svc.DrainAgent(ctx, DrainRequest{AgentID: "agent-1", Reason: "kernel upgrade", ReassignTo: []string{"agent-2", "agent-3"}})
+	if err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if !status.Draining || status.Reassigned != 2 || status.Pending != 0 || status.Running != 1 || status.Drained {
+		t.Fatalf("expected pending work moved and the running assignment left, got %+v", status)
+	}
+	for id, agent := range map[string]string{first.AssignmentID: "agent-2", second.AssignmentID: "agent-3"} {
+		if got, err := svc.GetAssignment(ctx, id); err != nil || got.AgentID != agent || got.Status != StatusPending {
+			t.Fatalf("expected %s reassigned to %s, got %+v %v", id, agent, got, err)
+		}
+	}
+	if _, err := assign(t, svc, "acme", "agent-1", "build"); !errors.Is(err, ErrAgentDraining) {
+		t.Fatalf("expected no new work for a draining agent, got %v", err)
+	}
+
+	if _, err := setStatus(t, svc, running.AssignmentID, StatusCompleted); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if status, err := svc.DrainStatus(ctx, "agent-1"); err != nil || !status.Drained || status.Reason != "kernel upgrade" {
+		t.Fatalf("expected the agent drained, got %+v %v", status, err)
+	}
+	if err := svc.UndrainAgent(ctx, "agent-1"); err != nil {
+		t.Fatalf("undrain: %v", err)
+	}
+	if status, err := svc.DrainStatus(ctx, "agent-1"); err != nil || status.Draining {
+		t.Fatalf("expected the drain ended, got %+v %v", status, err)
+	}
+	build("agent-1")
+	if err := svc.UndrainAgent(ctx, "agent-1"); !errors.Is(err, ErrAgentNotDraining) {
+		t.Fatalf("expected ending a drain twice refused, got %v", err)
+	}
+}
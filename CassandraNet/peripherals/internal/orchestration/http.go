@@ -5,6 +5,24 @@ import (
 	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the orchestration API.
+const (
+	codeInvalidJSON      = "orchestration.invalid_json"
+	codeInvalidRequest   = "orchestration.invalid_request"
+	codeNotFound         = "orchestration.not_found"
+	codeUnavailable      = "orchestration.store_unavailable"
+	codeForbidden        = "orchestration.forbidden_tenant"
+	codeForbiddenProject = "orchestration.forbidden_project"
+	codeQuotaExceeded    = "orchestration.quota_exceeded"
+	codeAgentDraining    = "orchestration.agent_draining"
+	codeTooManyArtifacts = "orchestration.too_many_artifacts"
 )
 
 const assignmentsPathPrefix = "/assignments/"
@@ -18,6 +36,11 @@ func (s *Service) Handler() http.Handler {
 	})
 	mux.HandleFunc("/assignments", s.handleAssignments)
 	mux.HandleFunc(assignmentsPathPrefix, s.handleAssignmentByID)
+	mux.HandleFunc("/assignments/simulate", s.handleSimulate)
+	mux.HandleFunc("/quotas", s.handleQuotas)
+	mux.HandleFunc(templatesPath, s.handleTemplates)
+	mux.HandleFunc(templatesPrefix, s.handleTemplate)
+	mux.HandleFunc(agentsPrefix, s.handleAgent)
 	return mux
 }
 
@@ -26,9 +49,16 @@ type assignPayload struct {
 	WorkloadID string            `json:"workload_id"`
 	TenantID   string            `json:"tenant_id"`
 	ProjectID  string            `json:"project_id"`
+	Template   string            `json:"template"`
 	Metadata   map[string]string `json:"metadata"`
 }
 
+type simulatePayload struct {
+	assignPayload
+	Agents []string `json:"agents"`
+	Count  int      `json:"count"`
+}
+
 type updatePayload struct {
 	Status        string `json:"status"`
 	StatusMessage string `json:"status_message"`
@@ -41,7 +71,7 @@ func (s *Service) handleAssignments(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		s.handleList(w, r)
 	default:
-		headerAllow(w, http.MethodPost, http.MethodGet)
+		headerAllow(w, r, http.MethodPost, http.MethodGet)
 	}
 }
 
@@ -49,73 +79,195 @@ func (s *Service) handleAssign(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var payload assignPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	tenant, ok := auth.ResolveTenant(r.Context(), payload.TenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+payload.TenantID)
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), payload.ProjectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+payload.ProjectID)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsWrite, tenant, project) {
 		return
 	}
 	assignment, err := s.AssignWork(r.Context(), AssignRequest{
 		AgentID:    payload.AgentID,
 		WorkloadID: payload.WorkloadID,
-		TenantID:   payload.TenantID,
-		ProjectID:  payload.ProjectID,
+		TenantID:   tenant,
+		ProjectID:  project,
+		Template:   payload.Template,
 		Metadata:   payload.Metadata,
 	})
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, assignment)
 }
 
+// handleSimulate serves POST /assignments/simulate, which plans the
+// assignments in the body without creating any, so only needs
+// assignments.read.
+func (s *Service) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	defer r.Body.Close()
+	var payload simulatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	tenant, ok := auth.ResolveTenant(r.Context(), payload.TenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+payload.TenantID)
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), payload.ProjectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+payload.ProjectID)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsRead, tenant, project) {
+		return
+	}
+	simulation, err := s.Simulate(r.Context(), SimulateRequest{
+		AssignRequest: AssignRequest{
+			AgentID:    payload.AgentID,
+			WorkloadID: payload.WorkloadID,
+			TenantID:   tenant,
+			ProjectID:  project,
+			Template:   payload.Template,
+			Metadata:   payload.Metadata,
+		},
+		Agents: payload.Agents,
+		Count:  payload.Count,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, simulation)
+}
+
 func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	tenant, project, ok := resolveScope(w, r)
+	if !ok {
+		return
+	}
 	filter := ListAssignmentsFilter{
 		AgentID:   r.URL.Query().Get("agent_id"),
-		TenantID:  r.URL.Query().Get("tenant_id"),
-		ProjectID: r.URL.Query().Get("project_id"),
+		TenantID:  tenant,
+		ProjectID: project,
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsRead, filter.TenantID, filter.ProjectID) {
+		return
 	}
 	if status := r.URL.Query().Get("status"); status != "" {
 		parsed, err := ParseStatus(status)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err)
 			return
 		}
 		filter.Status = parsed
 	}
-	assignments, err := s.ListAssignments(r.Context(), filter)
+	paged := pagination.Requested(r)
+	page, err := pagination.Parse(r, pagination.ListLimit(paged))
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, assignments)
+	assignments, next, err := s.ListAssignments(r.Context(), filter, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.WriteList(w, r, assignments, next, paged)
 }
 
 func (s *Service) handleAssignmentByID(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, assignmentsPathPrefix) {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, assignmentsPathPrefix)
 	if id == "" {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	if id, rest, ok := strings.Cut(id, "/"); ok {
+		s.handleArtifacts(w, r, id, rest)
 		return
 	}
 	switch r.Method {
+	case http.MethodGet:
+		s.handleGet(w, r, id)
 	case http.MethodPatch:
 		s.handleUpdate(w, r, id)
 	default:
-		headerAllow(w, http.MethodPatch)
+		headerAllow(w, r, http.MethodGet, http.MethodPatch)
+	}
+}
+
+func (s *Service) handleGet(w http.ResponseWriter, r *http.Request, id string) {
+	assignment, err := s.GetAssignment(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsRead, assignment.TenantID, assignment.ProjectID) {
+		return
+	}
+	writeJSON(w, http.StatusOK, assignment)
+}
+
+// handleQuotas reports a tenant's usage against its quotas.
+func (s *Service) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsRead, tenant, "") {
+		return
 	}
+	status, err := s.QuotaStatus(r.Context(), tenant)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
 }
 
 func (s *Service) handleUpdate(w http.ResponseWriter, r *http.Request, id string) {
 	defer r.Body.Close()
+	existing, err := s.GetAssignment(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermAssignmentsUpdate, existing.TenantID, existing.ProjectID) {
+		return
+	}
 	var payload updatePayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
 		return
 	}
 	status, err := ParseStatus(payload.Status)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err)
 		return
 	}
 	assignment, err := s.UpdateStatus(r.Context(), UpdateStatusRequest{
@@ -124,7 +276,7 @@ func (s *Service) handleUpdate(w http.ResponseWriter, r *http.Request, id string
 		StatusMessage: payload.StatusMessage,
 	})
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, assignment)
@@ -133,20 +285,20 @@ func (s *Service) handleUpdate(w http.ResponseWriter, r *http.Request, id string
 // ParseStatus parses a string into a Status value.
 func ParseStatus(status string) (Status, error) {
 	switch strings.ToLower(status) {
-	case string(StatusPending), "pending":
+	case string(StatusPending):
 		return StatusPending, nil
-	case string(StatusAssigned), "assigned":
+	case string(StatusAssigned):
 		return StatusAssigned, nil
-	case string(StatusRunning), "in_progress", "running":
+	case string(StatusRunning), "running":
 		return StatusRunning, nil
-	case string(StatusCompleted), "completed":
+	case string(StatusCompleted):
 		return StatusCompleted, nil
-	case string(StatusFailed), "failed":
+	case string(StatusFailed):
 		return StatusFailed, nil
-	case string(StatusCancelled), "cancelled", "canceled":
+	case string(StatusCancelled), "canceled":
 		return StatusCancelled, nil
 	default:
-		return "", errors.New("unknown status")
+		return "", validation.Invalid("status", validation.RuleOneOf, "must be one of pending, assigned, in_progress, completed, failed, cancelled")
 	}
 }
 
@@ -156,15 +308,33 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func httpError(w http.ResponseWriter, err error) {
-	if errors.Is(err, ErrAssignmentNotFound) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrAssignmentNotFound) || errors.Is(err, ErrTemplateNotFound) || errors.Is(err, ErrAgentNotDraining) || errors.Is(err, ErrArtifactNotFound) {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		problem.Write(w, r, http.StatusConflict, codeQuotaExceeded, err.Error())
+		return
+	}
+	if errors.Is(err, ErrAgentDraining) {
+		problem.Write(w, r, http.StatusConflict, codeAgentDraining, err.Error())
+		return
+	}
+	if errors.Is(err, ErrTooManyArtifacts) {
+		problem.Write(w, r, http.StatusConflict, codeTooManyArtifacts, err.Error())
+		return
+	}
+	if errors.Is(err, ErrStore) {
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+		return
+	}
+	if validation.Write(w, r, codeInvalidRequest, err) {
 		return
 	}
-	http.Error(w, err.Error(), http.StatusBadRequest)
+	problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 }
 
-func headerAllow(w http.ResponseWriter, methods ...string) {
-	w.Header().Set("Allow", strings.Join(methods, ", "))
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "orchestration", methods...)
 }
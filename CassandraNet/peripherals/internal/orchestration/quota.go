@@ -0,0 +1,171 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrQuotaExceeded is returned when an assignment would take its tenant
+// past a Quota.
+var ErrQuotaExceeded = errors.New("orchestration: tenant quota exceeded")
+
+// QuotaResource is what a Quota limits.
+type QuotaResource string
+
+const (
+	// QuotaRunning limits a tenant's assignments that are assigned or in
+	// progress. Moving a pending assignment to either fails while the
+	// tenant is at the limit, so it stays queued.
+	QuotaRunning QuotaResource = "running"
+	// QuotaQueued limits a tenant's pending assignments. Creating one fails
+	// while the tenant is at the limit.
+	QuotaQueued QuotaResource = "queued"
+)
+
+// Quota limits a tenant's assignments, for one tenant or, with an empty
+// TenantID, for every tenant without a quota of its own. A Limit of 0
+// lifts the limit.
+type Quota struct {
+	TenantID string        `json:"tenant_id,omitempty"`
+	Resource QuotaResource `json:"resource"`
+	Limit    int           `json:"limit"`
+}
+
+// ParseQuota parses "[tenant:]resource=limit", such as "acme:running=4".
+// The resource is running or queued.
+func ParseQuota(spec string) (Quota, error) {
+	target, limit, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Quota{}, fmt.Errorf("quota %q: expected [tenant:]resource=limit", spec)
+	}
+	var q Quota
+	target = strings.TrimSpace(target)
+	if tenant, resource, ok := strings.Cut(target, ":"); ok {
+		q.TenantID, target = strings.TrimSpace(tenant), strings.TrimSpace(resource)
+	}
+	q.Resource = QuotaResource(strings.ToLower(target))
+	if q.Resource != QuotaRunning && q.Resource != QuotaQueued {
+		return Quota{}, fmt.Errorf("quota %q: resource must be running or queued", spec)
+	}
+	var err error
+	if q.Limit, err = strconv.Atoi(strings.TrimSpace(limit)); err != nil || q.Limit < 0 {
+		return Quota{}, fmt.Errorf("quota %q: invalid limit %q", spec, limit)
+	}
+	return q, nil
+}
+
+// ParseQuotas parses each of specs with ParseQuota.
+func ParseQuotas(specs []string) ([]Quota, error) {
+	quotas := make([]Quota, 0, len(specs))
+	for _, spec := range specs {
+		q, err := ParseQuota(spec)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// Usage counts a tenant's assignments that hold or wait for an agent.
+type Usage struct {
+	// Running counts assigned and in-progress assignments.
+	Running int `json:"running"`
+	// Queued counts pending assignments.
+	Queued int `json:"queued"`
+}
+
+// add counts an assignment in status s.
+func (u *Usage) add(s Status) {
+	switch s {
+	case StatusPending:
+		u.Queued++
+	case StatusAssigned, StatusRunning:
+		u.Running++
+	}
+}
+
+// QuotaStatus is a tenant's usage against its limits; a limit of 0 means
+// none applies.
+type QuotaStatus struct {
+	TenantID   string `json:"tenant_id"`
+	Running    int    `json:"running"`
+	MaxRunning int    `json:"max_running"`
+	Queued     int    `json:"queued"`
+	MaxQueued  int    `json:"max_queued"`
+}
+
+// SetQuotas enforces quotas when assignments are created and started.
+// Call it before the service handles requests.
+func (s *Service) SetQuotas(quotas []Quota) {
+	s.quotas = quotas
+}
+
+// limit returns tenantID's limit on resource: its own quota's, or else the
+// default's, or 0.
+func (s *Service) limit(tenantID string, resource QuotaResource) int {
+	limit := 0
+	for _, q := range s.quotas {
+		if q.Resource != resource {
+			continue
+		}
+		if q.TenantID == tenantID {
+			return q.Limit
+		}
+		if q.TenantID == "" {
+			limit = q.Limit
+		}
+	}
+	return limit
+}
+
+// QuotaStatus reports tenantID's usage against its quotas.
+func (s *Service) QuotaStatus(ctx context.Context, tenantID string) (QuotaStatus, error) {
+	usage, err := s.store.Usage(ctx, tenantID)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+	return QuotaStatus{
+		TenantID:   tenantID,
+		Running:    usage.Running,
+		MaxRunning: s.limit(tenantID, QuotaRunning),
+		Queued:     usage.Queued,
+		MaxQueued:  s.limit(tenantID, QuotaQueued),
+	}, nil
+}
+
+// admitQueued fails when tenantID has as many pending assignments as its
+// queued quota allows.
+func (s *Service) admitQueued(tenantID string) func(Usage) error {
+	limit := s.limit(tenantID, QuotaQueued)
+	if limit == 0 {
+		return nil
+	}
+	return func(usage Usage) error {
+		if usage.Queued >= limit {
+			return fmt.Errorf("%w: tenant %q has %d queued assignments, the most allowed", ErrQuotaExceeded, tenantID, usage.Queued)
+		}
+		return nil
+	}
+}
+
+// admitStart fails when a pending assignment would start while its tenant
+// has as many running assignments as its running quota allows.
+func (s *Service) admitStart(status Status) func(Assignment, Usage) error {
+	if status != StatusAssigned && status != StatusRunning {
+		return nil
+	}
+	return func(current Assignment, usage Usage) error {
+		if current.Status != StatusPending {
+			return nil
+		}
+		limit := s.limit(current.TenantID, QuotaRunning)
+		if limit > 0 && usage.Running >= limit {
+			return fmt.Errorf("%w: tenant %q has %d running assignments, the most allowed", ErrQuotaExceeded, current.TenantID, usage.Running)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,51 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAssignmentQuotasQueueAndLimitTenants(t *testing.T) {
+	svc, _ := newTestService(t)
+	svc.SetQuotas([]Quota{
+		{Resource: QuotaQueued, Limit: 2},
+		{TenantID: "acme", Resource: QuotaRunning, Limit: 1},
+	})
+	ctx := context.Background()
+	first, err := assign(t, svc, "acme", "agent-1", "w-1")
+	if err != nil || first.QueuePosition != 1 {
+		t.Fatalf("first assignment: %+v %v", first, err)
+	}
+	second, err := assign(t, svc, "acme", "agent-1", "w-2")
+	if err != nil || second.QueuePosition != 2 {
+		t.Fatalf("second assignment: %+v %v", second, err)
+	}
+	if _, err := assign(t, svc, "acme", "agent-1", "w-3"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected the full queue to refuse, got %v", err)
+	}
+	if other, err := assign(t, svc, "globex", "agent-1", "w-1"); err != nil || other.QueuePosition != 1 {
+		t.Fatalf("expected another tenant's queue unaffected, got %+v %v", other, err)
+	}
+
+	if _, err := setStatus(t, svc, first.AssignmentID, StatusRunning); err != nil {
+		t.Fatalf("start first: %v", err)
+	}
+	if _, err := setStatus(t, svc, second.AssignmentID, StatusAssigned); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected the running limit to hold the second back, got %v", err)
+	}
+	if got, err := svc.GetAssignment(ctx, second.AssignmentID); err != nil || got.Status != StatusPending || got.QueuePosition != 1 {
+		t.Fatalf("expected the second first in line, got %+v %v", got, err)
+	}
+	quota, err := svc.QuotaStatus(ctx, "acme")
+	if err != nil || quota != (QuotaStatus{TenantID: "acme", Running: 1, MaxRunning: 1, Queued: 1, MaxQueued: 2}) {
+		t.Fatalf("unexpected quota %+v %v", quota, err)
+	}
+
+	if _, err := setStatus(t, svc, first.AssignmentID, StatusCompleted); err != nil {
+		t.Fatalf("complete first: %v", err)
+	}
+	if got, err := setStatus(t, svc, second.AssignmentID, StatusAssigned); err != nil || got.QueuePosition != 0 {
+		t.Fatalf("start second: %+v %v", got, err)
+	}
+}
@@ -2,92 +2,215 @@ package orchestration
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
 // ErrAssignmentNotFound indicates the requested assignment is not present in the store.
 var ErrAssignmentNotFound = errors.New("orchestration: assignment not found")
 
-// Store encapsulates persistence for assignments.
-type Store interface {
-	CreateAssignment(ctx context.Context, assignment Assignment) (Assignment, error)
-	UpdateAssignment(ctx context.Context, id string, status Status, message string, updatedAt time.Time) (Assignment, error)
-	ListAssignments(ctx context.Context, filter ListAssignmentsFilter) ([]Assignment, error)
-}
+// ErrStore wraps failures of the underlying storage driver.
+var ErrStore = errors.New("orchestration: store unavailable")
 
-// Clock provides time keeping; overridable for tests.
-type Clock interface {
-	Now() time.Time
-}
+// AdminTopic is the admin channel topic carrying every created or updated
+// assignment.
+const AdminTopic = "assignments"
 
-type systemClock struct{}
+// maxStatusMessageLength bounds an assignment's status message, in
+// characters.
+const maxStatusMessageLength = 1024
 
-func (systemClock) Now() time.Time { return time.Now().UTC() }
+// Store encapsulates persistence for assignments and agent drains.
+// Assignments it returns carry their QueuePosition.
+type Store interface {
+	// CreateAssignment stores assignment. A non-nil admit is called with
+	// its tenant's usage in the same transaction, and an error from it
+	// stores nothing. It fails with ErrAgentDraining while the
+	// assignment's agent is draining.
+	CreateAssignment(ctx context.Context, assignment Assignment, admit func(Usage) error) (Assignment, error)
+	GetAssignment(ctx context.Context, id string) (Assignment, error)
+	// UpdateAssignment sets the status of assignment id. A non-nil admit
+	// is called with the assignment as stored and its tenant's usage in
+	// the same transaction, and an error from it changes nothing. Moving
+	// a pending assignment to assigned or in progress fails with
+	// ErrAgentDraining while its agent is draining.
+	UpdateAssignment(ctx context.Context, id string, status Status, message string, updatedAt time.Time, admit func(Assignment, Usage) error) (Assignment, error)
+	// ListAssignments returns one page of matching assignments in ID order
+	// and the position of the next page, empty on the last.
+	ListAssignments(ctx context.Context, filter ListAssignmentsFilter, page pagination.Request) ([]Assignment, string, error)
+	// Usage counts tenantID's running and queued assignments.
+	Usage(ctx context.Context, tenantID string) (Usage, error)
+	// DrainAgent starts or updates drain, keeping the start time and
+	// reassigned count of a drain in progress, and in the same
+	// transaction moves the agent's pending assignments to the targets
+	// in drain.ReassignTo that are not draining, returning them.
+	DrainAgent(ctx context.Context, drain AgentDrain) (AgentDrain, []Assignment, error)
+	// GetDrain returns agentID's drain, or ErrAgentNotDraining.
+	GetDrain(ctx context.Context, agentID string) (AgentDrain, error)
+	// UndrainAgent ends agentID's drain, returning it.
+	UndrainAgent(ctx context.Context, agentID string) (AgentDrain, error)
+	// AgentUsage counts agentID's running and queued assignments.
+	AgentUsage(ctx context.Context, agentID string) (Usage, error)
+	// AgentLoads returns the load of every agent holding an assignment or
+	// draining, ordered by agent ID, with assignments that reached a final
+	// status at or after since counted as finished.
+	AgentLoads(ctx context.Context, since time.Time) ([]AgentLoad, error)
+	// PutArtifact adds artifact to assignment id, or replaces its artifact
+	// of the same name, reporting whether it added one. It fails with
+	// ErrTooManyArtifacts for a new artifact past MaxArtifacts.
+	PutArtifact(ctx context.Context, id string, artifact Artifact) (Assignment, bool, error)
+}
 
 // Service performs orchestration tasks backed by a Store.
 type Service struct {
-	store Store
-	clock Clock
+	store     Store
+	clock     clock.Clock
+	events    eventbus.Publisher
+	audit     *audit.Log
+	admin     *adminchannel.Channel
+	quotas    []Quota
+	templates TemplateStore
 }
 
 // NewService constructs a Service instance.
-func NewService(store Store, clock Clock) *Service {
-	if clock == nil {
-		clock = systemClock{}
-	}
-	return &Service{store: store, clock: clock}
+func NewService(store Store, clk clock.Clock) *Service {
+	return &Service{store: store, clock: clock.Or(clk)}
+}
+
+// SetEvents publishes an eventbus.AssignmentCompleted to p whenever an
+// assignment's status is set to a final one. Call it before the service handles
+// requests.
+func (s *Service) SetEvents(p eventbus.Publisher) {
+	s.events = p
 }
 
-// AssignWork creates a new assignment for the provided agent/workload pair.
+// SetAudit records each cancellation, template change, and agent drain in
+// log. Call it before the service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// SetAdminChannel publishes each created or updated assignment to ch under
+// AdminTopic, for callers with assignments.read. Call it before the service
+// handles requests.
+func (s *Service) SetAdminChannel(ch *adminchannel.Channel) {
+	ch.Register(AdminTopic, auth.PermAssignmentsRead)
+	s.admin = ch
+}
+
+// AssignWork creates a new pending assignment for the provided
+// agent/workload pair, or the workload template it names, unless its
+// tenant's queue is full.
 func (s *Service) AssignWork(ctx context.Context, req AssignRequest) (Assignment, error) {
-	if req.AgentID == "" || req.WorkloadID == "" {
-		return Assignment{}, errors.New("agent_id and workload_id required")
+	var assignment Assignment
+	if req.Template != "" {
+		var v validation.Validator
+		v.ID("template", req.Template)
+		if err := v.Err(); err != nil {
+			return Assignment{}, err
+		}
+		if err := s.applyTemplate(ctx, &req, &assignment); err != nil {
+			return Assignment{}, err
+		}
 	}
-	assignment := Assignment{
-		AssignmentID:  newIdentifier(),
-		AgentID:       req.AgentID,
-		WorkloadID:    req.WorkloadID,
-		TenantID:      req.TenantID,
-		ProjectID:     req.ProjectID,
-		Status:        StatusPending,
-		StatusMessage: "queued",
-		Metadata:      cloneMetadata(req.Metadata),
+	var v validation.Validator
+	v.ID("agent_id", req.AgentID)
+	v.ID("workload_id", req.WorkloadID)
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.String("project_id", req.ProjectID).MaxLength(validation.MaxIDLength)
+	v.Map("metadata", req.Metadata).Limited()
+	if err := v.Err(); err != nil {
+		return Assignment{}, err
 	}
+	assignment.AssignmentID = id.New(id.PrefixAssignment)
+	assignment.AgentID = req.AgentID
+	assignment.WorkloadID = req.WorkloadID
+	assignment.TenantID = req.TenantID
+	assignment.ProjectID = req.ProjectID
+	assignment.Status = StatusPending
+	assignment.StatusMessage = "queued"
+	assignment.Metadata = cloneMetadata(req.Metadata)
 	now := s.clock.Now()
 	assignment.CreatedAt = now
 	assignment.UpdatedAt = now
-	created, err := s.store.CreateAssignment(ctx, assignment)
+	created, err := s.store.CreateAssignment(ctx, assignment, s.admitQueued(assignment.TenantID))
 	if err != nil {
 		return Assignment{}, err
 	}
+	s.admin.Publish(AdminTopic, created.TenantID, created.ProjectID, created)
 	return created, nil
 }
 
-// UpdateStatus applies a status transition on an assignment.
+// UpdateStatus applies a status transition on an assignment. Starting a
+// pending assignment fails while its tenant runs as many as its quota
+// allows.
 func (s *Service) UpdateStatus(ctx context.Context, req UpdateStatusRequest) (Assignment, error) {
-	if req.AssignmentID == "" {
-		return Assignment{}, errors.New("assignment_id required")
+	var v validation.Validator
+	v.ID("assignment_id", req.AssignmentID)
+	v.String("status", string(req.Status)).Required()
+	v.String("status_message", req.StatusMessage).MaxLength(maxStatusMessageLength)
+	if err := v.Err(); err != nil {
+		return Assignment{}, err
 	}
-	if req.Status == "" {
-		return Assignment{}, errors.New("status required")
+	var before Assignment
+	audited := s.audit != nil && req.Status == StatusCancelled
+	if audited {
+		var err error
+		if before, err = s.store.GetAssignment(ctx, req.AssignmentID); err != nil {
+			return Assignment{}, err
+		}
 	}
-	updated, err := s.store.UpdateAssignment(ctx, req.AssignmentID, req.Status, req.StatusMessage, s.clock.Now())
+	updated, err := s.store.UpdateAssignment(ctx, req.AssignmentID, req.Status, req.StatusMessage, s.clock.Now(), s.admitStart(req.Status))
 	if err != nil {
 		return Assignment{}, err
 	}
+	if audited {
+		s.audit.Record(ctx, audit.Change{
+			Action:    "orchestration.assignment.cancel",
+			Resource:  "assignments/" + updated.AssignmentID,
+			TenantID:  updated.TenantID,
+			ProjectID: updated.ProjectID,
+			Before:    before,
+			After:     updated,
+		})
+	}
+	s.admin.Publish(AdminTopic, updated.TenantID, updated.ProjectID, updated)
+	if s.events != nil && updated.Status.Final() {
+		s.events.Publish(ctx, eventbus.AssignmentCompleted{
+			AssignmentID:  updated.AssignmentID,
+			AgentID:       updated.AgentID,
+			WorkloadID:    updated.WorkloadID,
+			TenantID:      updated.TenantID,
+			ProjectID:     updated.ProjectID,
+			Status:        string(updated.Status),
+			StatusMessage: updated.StatusMessage,
+			CompletedAt:   updated.UpdatedAt,
+		})
+	}
 	return updated, nil
 }
 
-// ListAssignments returns assignments matching the filter.
-func (s *Service) ListAssignments(ctx context.Context, filter ListAssignmentsFilter) ([]Assignment, error) {
-	assignments, err := s.store.ListAssignments(ctx, filter)
-	if err != nil {
-		return nil, err
+// GetAssignment returns a single assignment.
+func (s *Service) GetAssignment(ctx context.Context, id string) (Assignment, error) {
+	if id == "" {
+		return Assignment{}, validation.Invalid("assignment_id", validation.RuleRequired, "is required")
 	}
-	return assignments, nil
+	return s.store.GetAssignment(ctx, id)
+}
+
+// ListAssignments returns one page of assignments matching the filter, and
+// the position of the next page.
+func (s *Service) ListAssignments(ctx context.Context, filter ListAssignmentsFilter, page pagination.Request) ([]Assignment, string, error) {
+	return s.store.ListAssignments(ctx, filter, page)
 }
 
 func cloneMetadata(in map[string]string) map[string]string {
@@ -100,11 +223,3 @@ func cloneMetadata(in map[string]string) map[string]string {
 	}
 	return out
 }
-
-func newIdentifier() string {
-	buf := make([]byte, 16)
-	if _, err := rand.Read(buf); err != nil {
-		return hex.EncodeToString([]byte(time.Now().UTC().Format("20060102150405.000")))
-	}
-	return hex.EncodeToString(buf)
-}
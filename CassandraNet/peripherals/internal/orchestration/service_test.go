@@ -0,0 +1,52 @@
+package orchestration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+)
+
+// newTestService returns a service on a memory store, with templates, on
+// a fake clock.
+func newTestService(t *testing.T) (*Service, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	svc := NewService(store, clk)
+	svc.SetTemplateStore(store)
+	return svc, clk
+}
+
+// assign creates an assignment of workload to agent for tenant's project
+// p1.
+func assign(t *testing.T, svc *Service, tenant, agent, workload string) (Assignment, error) {
+	t.Helper()
+	return svc.AssignWork(context.Background(), AssignRequest{AgentID: agent, WorkloadID: workload, TenantID: tenant, ProjectID: "p1"})
+}
+
+// setStatus moves assignment id to status.
+func setStatus(t *testing.T, svc *Service, id string, status Status) (Assignment, error) {
+	t.Helper()
+	return svc.UpdateStatus(context.Background(), UpdateStatusRequest{AssignmentID: id, Status: status})
+}
+
+// serve sends a request with payload, if any, as its JSON body to h and
+// returns the status and body.
+func serve(t *testing.T, h http.Handler, method, target string, payload any) (int, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, target, &body))
+	return rec.Code, rec.Body.Bytes()
+}
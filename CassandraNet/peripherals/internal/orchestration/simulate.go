@@ -0,0 +1,236 @@
+package orchestration
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Simulation limits.
+const (
+	// throughputWindow is how far back finished assignments are counted to
+	// estimate an agent's throughput.
+	throughputWindow = time.Hour
+	// maxSimulatedAgents bounds the agents a simulation names.
+	maxSimulatedAgents = 32
+	// maxSimulatedCount bounds the assignments a simulation plans.
+	maxSimulatedCount = 10000
+)
+
+// AgentLoad is an agent's current work and recent throughput.
+type AgentLoad struct {
+	AgentID  string
+	Pending  int
+	Running  int
+	Finished int
+	Draining bool
+	// tenants holds the tenants the agent has held assignments for.
+	tenants map[string]bool
+}
+
+// SimulateRequest describes assignments to plan without creating them:
+// Count of them (1 by default) for the workload in AssignRequest. AgentID
+// and Agents name the candidate agents; with neither, every agent that has
+// held an assignment of the tenant is a candidate.
+type SimulateRequest struct {
+	AssignRequest
+	Agents []string
+	Count  int
+}
+
+// AgentEstimate is one candidate agent's part in a Simulation.
+type AgentEstimate struct {
+	AgentID string `json:"agent_id"`
+	// Eligible is false for agents that would refuse the work, with Reason
+	// saying why.
+	Eligible bool   `json:"eligible"`
+	Reason   string `json:"reason,omitempty"`
+	Pending  int    `json:"pending"`
+	Running  int    `json:"running"`
+	// ThroughputPerHour counts the agent's assignments that reached a
+	// final status in the last hour.
+	ThroughputPerHour int `json:"throughput_per_hour"`
+	// EstimatedStartAt is when the first of the planned assignments would
+	// start on the agent, after its pending and running work at its
+	// throughput, and LastStartAt when the last would. Both are omitted
+	// when the agent has work ahead but finished none in the last hour.
+	EstimatedStartAt time.Time `json:"estimated_start_at,omitzero"`
+	LastStartAt      time.Time `json:"last_start_at,omitzero"`
+}
+
+// Simulation reports what AssignWork would do with a SimulateRequest.
+type Simulation struct {
+	TenantID             string   `json:"tenant_id"`
+	ProjectID            string   `json:"project_id"`
+	WorkloadID           string   `json:"workload_id"`
+	Template             string   `json:"template,omitempty"`
+	RequiredCapabilities []string `json:"required_capabilities,omitempty"`
+	Priority             int      `json:"priority,omitempty"`
+	Count                int      `json:"count"`
+	// QueuePosition is the place the first planned assignment would take
+	// in its tenant's queue. Admitted counts those the tenant's queued
+	// quota would accept; the rest would fail with ErrQuotaExceeded.
+	QueuePosition int         `json:"queue_position"`
+	Admitted      int         `json:"admitted"`
+	Quota         QuotaStatus `json:"quota"`
+	// Agents lists the candidates, eligible ones first and then by
+	// estimated start, unknown last.
+	Agents []AgentEstimate `json:"agents"`
+	// EstimatedStartAt is the earliest estimate among eligible agents.
+	EstimatedStartAt time.Time `json:"estimated_start_at,omitzero"`
+}
+
+// Simulate reports which agents could take the work in req, where it
+// would queue, and when it would start, from the current assignments and
+// each agent's throughput over the last hour. It creates nothing. The
+// orchestrator does not know agents' capabilities, so
+// RequiredCapabilities are reported but not matched, as for assignments.
+func (s *Service) Simulate(ctx context.Context, req SimulateRequest) (Simulation, error) {
+	if req.Count == 0 {
+		req.Count = 1
+	}
+	var assignment Assignment
+	if req.Template != "" {
+		var v validation.Validator
+		v.ID("template", req.Template)
+		if err := v.Err(); err != nil {
+			return Simulation{}, err
+		}
+		if err := s.applyTemplate(ctx, &req.AssignRequest, &assignment); err != nil {
+			return Simulation{}, err
+		}
+	}
+	var v validation.Validator
+	if req.AgentID != "" {
+		v.ID("agent_id", req.AgentID)
+	}
+	v.ID("workload_id", req.WorkloadID)
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.String("project_id", req.ProjectID).MaxLength(validation.MaxIDLength)
+	v.Map("metadata", req.Metadata).Limited()
+	v.Int("count", int64(req.Count)).Range(1, maxSimulatedCount)
+	v.Check(len(req.Agents) <= maxSimulatedAgents, "agents", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxSimulatedAgents))
+	for i, agent := range req.Agents {
+		v.ID(fmt.Sprintf("agents[%d]", i), agent)
+	}
+	if err := v.Err(); err != nil {
+		return Simulation{}, err
+	}
+	quota, err := s.QuotaStatus(ctx, req.TenantID)
+	if err != nil {
+		return Simulation{}, err
+	}
+	now := s.clock.Now()
+	loads, err := s.store.AgentLoads(ctx, now.Add(-throughputWindow))
+	if err != nil {
+		return Simulation{}, err
+	}
+	admitted := req.Count
+	if quota.MaxQueued > 0 {
+		admitted = min(req.Count, max(quota.MaxQueued-quota.Queued, 0))
+	}
+	sim := Simulation{
+		TenantID:             req.TenantID,
+		ProjectID:            req.ProjectID,
+		WorkloadID:           req.WorkloadID,
+		Template:             assignment.Template,
+		RequiredCapabilities: assignment.RequiredCapabilities,
+		Priority:             assignment.Priority,
+		Count:                req.Count,
+		QueuePosition:        quota.Queued + 1,
+		Admitted:             admitted,
+		Quota:                quota,
+		Agents:               []AgentEstimate{},
+	}
+	for _, load := range candidates(req, loads) {
+		estimate := estimateAgent(load, req.Count, now)
+		if estimate.Eligible && !estimate.EstimatedStartAt.IsZero() &&
+			(sim.EstimatedStartAt.IsZero() || estimate.EstimatedStartAt.Before(sim.EstimatedStartAt)) {
+			sim.EstimatedStartAt = estimate.EstimatedStartAt
+		}
+		sim.Agents = append(sim.Agents, estimate)
+	}
+	slices.SortStableFunc(sim.Agents, func(a, b AgentEstimate) int {
+		if a.Eligible != b.Eligible {
+			if a.Eligible {
+				return -1
+			}
+			return 1
+		}
+		if a.EstimatedStartAt.IsZero() != b.EstimatedStartAt.IsZero() {
+			if a.EstimatedStartAt.IsZero() {
+				return 1
+			}
+			return -1
+		}
+		return a.EstimatedStartAt.Compare(b.EstimatedStartAt)
+	})
+	return sim, nil
+}
+
+// candidates returns the loads of the agents req names, in order and
+// without repeats, or else of every agent that has held an assignment of
+// its tenant. Named agents without assignments have no load.
+func candidates(req SimulateRequest, loads []AgentLoad) []AgentLoad {
+	named := req.Agents
+	if req.AgentID != "" {
+		named = append([]string{req.AgentID}, named...)
+	}
+	if len(named) == 0 {
+		var out []AgentLoad
+		for _, load := range loads {
+			if load.tenants[req.TenantID] {
+				out = append(out, load)
+			}
+		}
+		return out
+	}
+	out := make([]AgentLoad, 0, len(named))
+	seen := make(map[string]bool, len(named))
+	for _, agentID := range named {
+		if seen[agentID] {
+			continue
+		}
+		seen[agentID] = true
+		i := slices.IndexFunc(loads, func(l AgentLoad) bool { return l.AgentID == agentID })
+		if i < 0 {
+			out = append(out, AgentLoad{AgentID: agentID})
+			continue
+		}
+		out = append(out, loads[i])
+	}
+	return out
+}
+
+// estimateAgent estimates when count assignments queued behind load's
+// pending and running work would start, taking the agent to finish work
+// at the rate it did over throughputWindow.
+func estimateAgent(load AgentLoad, count int, now time.Time) AgentEstimate {
+	estimate := AgentEstimate{
+		AgentID:           load.AgentID,
+		Eligible:          !load.Draining,
+		Pending:           load.Pending,
+		Running:           load.Running,
+		ThroughputPerHour: load.Finished,
+	}
+	if load.Draining {
+		estimate.Reason = "draining"
+		return estimate
+	}
+	ahead := load.Pending + load.Running
+	startAfter := func(n int) time.Time {
+		if n == 0 {
+			return now
+		}
+		if load.Finished == 0 {
+			return time.Time{}
+		}
+		return now.Add(time.Duration(n) * throughputWindow / time.Duration(load.Finished))
+	}
+	estimate.EstimatedStartAt = startAfter(ahead)
+	estimate.LastStartAt = startAfter(ahead + count - 1)
+	return estimate
+}
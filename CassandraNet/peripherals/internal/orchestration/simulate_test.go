@@ -0,0 +1,87 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestSimulateAssignmentsEstimatesAgents(t *testing.T) {
+	svc, clk := newTestService(t)
+	svc.SetQuotas([]Quota{{Resource: QuotaQueued, Limit: 3}})
+	ctx := context.Background()
+	build := func(tenant, agent string, status Status) {
+		t.Helper()
+		assignment, err := assign(t, svc, tenant, agent, "build")
+		if err != nil {
+			t.Fatalf("assign to %s: %v", agent, err)
+		}
+		if status == StatusPending {
+			return
+		}
+		if _, err := setStatus(t, svc, assignment.AssignmentID, status); err != nil {
+			t.Fatalf("move to %s: %v", status, err)
+		}
+	}
+	build("acme", "agent-1", StatusCompleted)
+	build("acme", "agent-1", StatusFailed)
+	build("acme", "agent-1", StatusRunning)
+	build("acme", "agent-1", StatusPending)
+	build("acme", "agent-2", StatusCompleted)
+	build("acme", "agent-3", StatusCompleted)
+	build("globex", "agent-4", StatusPending)
+	if _, err := svc.DrainAgent(ctx, DrainRequest{AgentID: "agent-3"}); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+
+	now := clk.Now()
+	sim, err := svc.Simulate(ctx, SimulateRequest{AssignRequest: AssignRequest{WorkloadID: "build", TenantID: "acme"}, Count: 5})
+	if err != nil {
+		t.Fatalf("simulate: %v", err)
+	}
+	if sim.Count != 5 || sim.QueuePosition != 2 || sim.Admitted != 2 || sim.Quota.MaxQueued != 3 || len(sim.Agents) != 3 {
+		t.Fatalf("unexpected simulation %+v", sim)
+	}
+	idle, busy, drained := sim.Agents[0], sim.Agents[1], sim.Agents[2]
+	if idle.AgentID != "agent-2" || !idle.Eligible || !idle.EstimatedStartAt.Equal(now) {
+		t.Fatalf("expected agent-2 free now, got %+v", idle)
+	}
+	if !sim.EstimatedStartAt.Equal(idle.EstimatedStartAt) || !idle.LastStartAt.After(idle.EstimatedStartAt) {
+		t.Fatalf("expected the idle agent's estimates to lead, got %+v", sim)
+	}
+	if busy.AgentID != "agent-1" || busy.Pending != 1 || busy.Running != 1 || busy.ThroughputPerHour != 2 ||
+		!busy.EstimatedStartAt.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected agent-1 free in an hour, got %+v", busy)
+	}
+	if drained.AgentID != "agent-3" || drained.Eligible || drained.Reason != "draining" || !drained.EstimatedStartAt.IsZero() {
+		t.Fatalf("expected agent-3 ineligible, got %+v", drained)
+	}
+	pending, _, err := svc.ListAssignments(ctx, ListAssignmentsFilter{TenantID: "acme", Status: StatusPending}, pagination.Request{Limit: 10})
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("expected the simulation to create nothing, got %d assignments, %v", len(pending), err)
+	}
+
+	// Throughput only counts the last hour, so once agent-1's finished
+	// work is older than that it has no estimate.
+	clk.Advance(time.Hour + time.Second)
+	later, err := svc.Simulate(ctx, SimulateRequest{AssignRequest: AssignRequest{WorkloadID: "build", TenantID: "acme"}, Agents: []string{"agent-1"}})
+	if err != nil || len(later.Agents) != 1 || later.Agents[0].ThroughputPerHour != 0 || !later.Agents[0].EstimatedStartAt.IsZero() {
+		t.Fatalf("expected no estimate without recent throughput, got %+v %v", later, err)
+	}
+
+	named, err := svc.Simulate(ctx, SimulateRequest{
+		AssignRequest: AssignRequest{AgentID: "agent-new", WorkloadID: "build", TenantID: "acme"},
+		Agents:        []string{"agent-3", "agent-new"},
+	})
+	if err != nil || named.Count != 1 || len(named.Agents) != 2 || named.Agents[0].AgentID != "agent-new" || !named.Agents[0].Eligible {
+		t.Fatalf("expected the named agents only, got %+v %v", named, err)
+	}
+	var invalid validation.Errors
+	if _, err := svc.Simulate(ctx, SimulateRequest{AssignRequest: AssignRequest{WorkloadID: "build", TenantID: "acme"}, Count: 10001}); !errors.As(err, &invalid) {
+		t.Fatalf("expected too large a batch refused, got %v", err)
+	}
+}
@@ -0,0 +1,542 @@
+package orchestration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+const (
+	// assignmentBucket holds assignments as JSON keyed by assignment ID.
+	assignmentBucket = "orchestration.assignments"
+	// templateBucket holds workload templates as JSON keyed by scope and
+	// name.
+	templateBucket = "orchestration.workload_templates"
+	// drainBucket holds agent drains as JSON keyed by agent ID.
+	drainBucket = "orchestration.agent_drains"
+)
+
+// StorageStore implements Store and TemplateStore on a storage driver.
+type StorageStore struct {
+	db storage.Driver
+}
+
+// NewStorageStore returns a store keeping assignments in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// CreateAssignment inserts a new assignment record, after admit accepts
+// its tenant's usage, unless its agent is draining.
+func (s *StorageStore) CreateAssignment(ctx context.Context, assignment Assignment, admit func(Usage) error) (Assignment, error) {
+	assignment.QueuePosition = 0
+	data, err := json.Marshal(assignment)
+	if err != nil {
+		return Assignment{}, err
+	}
+	position := 0
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		if err := checkNotDraining(tx, assignment.AgentID); err != nil {
+			return err
+		}
+		usage, ahead, err := tenantUsage(tx, assignment.TenantID, assignment.AssignmentID)
+		if err != nil {
+			return err
+		}
+		if admit != nil {
+			if err := admit(usage); err != nil {
+				return err
+			}
+		}
+		position = ahead + 1
+		return tx.Put(assignmentBucket, assignment.AssignmentID, data)
+	})
+	if err != nil {
+		return Assignment{}, storeError(err)
+	}
+	created, err := decodeAssignment(data)
+	if created.Status == StatusPending {
+		created.QueuePosition = position
+	}
+	return created, err
+}
+
+// GetAssignment returns the assignment with id.
+func (s *StorageStore) GetAssignment(ctx context.Context, id string) (Assignment, error) {
+	var assignment Assignment
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if assignment, err = getAssignment(tx, id); err != nil {
+			return err
+		}
+		return setQueuePosition(tx, &assignment)
+	})
+	return assignment, storeError(err)
+}
+
+// UpdateAssignment updates status metadata for a given assignment, after
+// admit accepts it and its tenant's usage. A pending assignment is not
+// started while its agent is draining.
+func (s *StorageStore) UpdateAssignment(ctx context.Context, id string, status Status, message string, updatedAt time.Time, admit func(Assignment, Usage) error) (Assignment, error) {
+	var assignment Assignment
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if assignment, err = getAssignment(tx, id); err != nil {
+			return err
+		}
+		if assignment.Status == StatusPending && (status == StatusAssigned || status == StatusRunning) {
+			if err := checkNotDraining(tx, assignment.AgentID); err != nil {
+				return err
+			}
+		}
+		if admit != nil {
+			usage, _, err := tenantUsage(tx, assignment.TenantID, id)
+			if err != nil {
+				return err
+			}
+			if err := admit(assignment, usage); err != nil {
+				return err
+			}
+		}
+		assignment.Status = status
+		assignment.StatusMessage = message
+		assignment.UpdatedAt = updatedAt
+		data, err := json.Marshal(assignment)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(assignmentBucket, id, data); err != nil {
+			return err
+		}
+		return setQueuePosition(tx, &assignment)
+	})
+	return assignment, storeError(err)
+}
+
+// PutArtifact adds artifact to assignment id, or replaces its artifact of
+// the same name, and reports whether it added one.
+func (s *StorageStore) PutArtifact(ctx context.Context, id string, artifact Artifact) (Assignment, bool, error) {
+	var assignment Assignment
+	added := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if assignment, err = getAssignment(tx, id); err != nil {
+			return err
+		}
+		i := slices.IndexFunc(assignment.Artifacts, func(a Artifact) bool { return a.Name == artifact.Name })
+		switch {
+		case i >= 0:
+			assignment.Artifacts[i] = artifact
+		case len(assignment.Artifacts) >= MaxArtifacts:
+			return ErrTooManyArtifacts
+		default:
+			assignment.Artifacts = append(assignment.Artifacts, artifact)
+			added = true
+		}
+		data, err := json.Marshal(assignment)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(assignmentBucket, id, data); err != nil {
+			return err
+		}
+		return setQueuePosition(tx, &assignment)
+	})
+	return assignment, added, storeError(err)
+}
+
+// ListAssignments returns one page of assignments matching the provided
+// filter, ordered by ID.
+func (s *StorageStore) ListAssignments(ctx context.Context, filter ListAssignmentsFilter, page pagination.Request) ([]Assignment, string, error) {
+	collector := pagination.NewCollector[Assignment](page)
+	// queued counts each tenant's pending assignments scanned so far,
+	// which in ID order are the ones ahead of the next.
+	queued := make(map[string]int)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(assignmentBucket, "", func(key string, value []byte) error {
+			assignment, err := decodeAssignment(value)
+			if err != nil {
+				return err
+			}
+			if assignment.Status == StatusPending {
+				queued[assignment.TenantID]++
+				assignment.QueuePosition = queued[assignment.TenantID]
+			}
+			if collector.Skip(key) {
+				return nil
+			}
+			if filter.AgentID != "" && assignment.AgentID != filter.AgentID {
+				return nil
+			}
+			if filter.TenantID != "" && assignment.TenantID != filter.TenantID {
+				return nil
+			}
+			if filter.ProjectID != "" && assignment.ProjectID != filter.ProjectID {
+				return nil
+			}
+			if filter.Status != "" && assignment.Status != filter.Status {
+				return nil
+			}
+			if !collector.Add(key, assignment) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	results, next := collector.Page()
+	return results, next, nil
+}
+
+// Usage counts tenantID's running and queued assignments.
+func (s *StorageStore) Usage(ctx context.Context, tenantID string) (Usage, error) {
+	var usage Usage
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		usage, _, err = tenantUsage(tx, tenantID, "")
+		return err
+	})
+	return usage, storeError(err)
+}
+
+// AgentUsage counts agentID's running and queued assignments.
+func (s *StorageStore) AgentUsage(ctx context.Context, agentID string) (Usage, error) {
+	var usage Usage
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(assignmentBucket, "", func(_ string, value []byte) error {
+			assignment, err := decodeAssignment(value)
+			if err == nil && assignment.AgentID == agentID {
+				usage.add(assignment.Status)
+			}
+			return err
+		})
+	})
+	return usage, storeError(err)
+}
+
+// AgentLoads returns the load of every agent that holds an assignment or
+// is draining, counting assignments that reached a final status at or
+// after since as finished.
+func (s *StorageStore) AgentLoads(ctx context.Context, since time.Time) ([]AgentLoad, error) {
+	loads := make(map[string]*AgentLoad)
+	load := func(agentID string) *AgentLoad {
+		if loads[agentID] == nil {
+			loads[agentID] = &AgentLoad{AgentID: agentID, tenants: make(map[string]bool)}
+		}
+		return loads[agentID]
+	}
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		err := tx.Scan(assignmentBucket, "", func(_ string, value []byte) error {
+			assignment, err := decodeAssignment(value)
+			if err != nil {
+				return err
+			}
+			l := load(assignment.AgentID)
+			l.tenants[assignment.TenantID] = true
+			switch {
+			case assignment.Status == StatusPending:
+				l.Pending++
+			case assignment.Status == StatusAssigned || assignment.Status == StatusRunning:
+				l.Running++
+			case assignment.Status.Final() && !assignment.UpdatedAt.Before(since):
+				l.Finished++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Scan(drainBucket, "", func(key string, _ []byte) error {
+			load(key).Draining = true
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	out := make([]AgentLoad, 0, len(loads))
+	for _, l := range loads {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AgentID < out[j].AgentID })
+	return out, nil
+}
+
+// DrainAgent starts or updates drain and moves the agent's pending
+// assignments, in ID order, to each of the targets that is not draining in
+// turn.
+func (s *StorageStore) DrainAgent(ctx context.Context, drain AgentDrain) (AgentDrain, []Assignment, error) {
+	var moved []Assignment
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		if previous, err := getDrain(tx, drain.AgentID); err == nil {
+			drain.StartedAt = previous.StartedAt
+			drain.Reassigned = previous.Reassigned
+		} else if !errors.Is(err, ErrAgentNotDraining) {
+			return err
+		}
+		var targets []string
+		for _, target := range drain.ReassignTo {
+			if err := checkNotDraining(tx, target); errors.Is(err, ErrAgentDraining) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			targets = append(targets, target)
+		}
+		var pending []Assignment
+		if len(targets) > 0 {
+			err := tx.Scan(assignmentBucket, "", func(_ string, value []byte) error {
+				assignment, err := decodeAssignment(value)
+				if err == nil && assignment.AgentID == drain.AgentID && assignment.Status == StatusPending {
+					pending = append(pending, assignment)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for i, assignment := range pending {
+			assignment.AgentID = targets[i%len(targets)]
+			assignment.StatusMessage = fmt.Sprintf("reassigned from %s (draining)", drain.AgentID)
+			assignment.UpdatedAt = drain.StartedAt
+			data, err := json.Marshal(assignment)
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(assignmentBucket, assignment.AssignmentID, data); err != nil {
+				return err
+			}
+			moved = append(moved, assignment)
+		}
+		drain.Reassigned += len(moved)
+		data, err := json.Marshal(drain)
+		if err != nil {
+			return err
+		}
+		if err := tx.Put(drainBucket, drain.AgentID, data); err != nil {
+			return err
+		}
+		for i := range moved {
+			if err := setQueuePosition(tx, &moved[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return AgentDrain{}, nil, storeError(err)
+	}
+	return drain, moved, nil
+}
+
+// GetDrain returns agentID's drain.
+func (s *StorageStore) GetDrain(ctx context.Context, agentID string) (AgentDrain, error) {
+	var drain AgentDrain
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		drain, err = getDrain(tx, agentID)
+		return err
+	})
+	return drain, storeError(err)
+}
+
+// UndrainAgent ends agentID's drain, returning it.
+func (s *StorageStore) UndrainAgent(ctx context.Context, agentID string) (AgentDrain, error) {
+	var drain AgentDrain
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if drain, err = getDrain(tx, agentID); err != nil {
+			return err
+		}
+		return tx.Delete(drainBucket, agentID)
+	})
+	return drain, storeError(err)
+}
+
+func getDrain(tx storage.Tx, agentID string) (AgentDrain, error) {
+	data, err := tx.Get(drainBucket, agentID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return AgentDrain{}, ErrAgentNotDraining
+	}
+	if err != nil {
+		return AgentDrain{}, err
+	}
+	var drain AgentDrain
+	err = json.Unmarshal(data, &drain)
+	return drain, err
+}
+
+// checkNotDraining fails with ErrAgentDraining while agentID is draining.
+func checkNotDraining(tx storage.Tx, agentID string) error {
+	_, err := tx.Get(drainBucket, agentID)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: agent %q takes no new work", ErrAgentDraining, agentID)
+	case errors.Is(err, storage.ErrNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// PutTemplate creates or replaces the scope's workload template with
+// tmpl.Name.
+func (s *StorageStore) PutTemplate(ctx context.Context, tmpl WorkloadTemplate) (WorkloadTemplate, bool, error) {
+	key := templateKey(tmpl.TenantID, tmpl.ProjectID, tmpl.Name)
+	created := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		previous, err := getTemplate(tx, key)
+		switch {
+		case errors.Is(err, ErrTemplateNotFound):
+			created = true
+		case err != nil:
+			return err
+		default:
+			tmpl.CreatedAt = previous.CreatedAt
+		}
+		data, err := json.Marshal(tmpl)
+		if err != nil {
+			return err
+		}
+		return tx.Put(templateBucket, key, data)
+	})
+	if err != nil {
+		return WorkloadTemplate{}, false, storeError(err)
+	}
+	return tmpl, created, nil
+}
+
+// GetTemplate returns the scope's own workload template name.
+func (s *StorageStore) GetTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error) {
+	var tmpl WorkloadTemplate
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		tmpl, err = getTemplate(tx, templateKey(tenantID, projectID, name))
+		return err
+	})
+	return tmpl, storeError(err)
+}
+
+// DeleteTemplate removes the scope's own workload template name, returning
+// it.
+func (s *StorageStore) DeleteTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error) {
+	key := templateKey(tenantID, projectID, name)
+	var tmpl WorkloadTemplate
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if tmpl, err = getTemplate(tx, key); err != nil {
+			return err
+		}
+		return tx.Delete(templateBucket, key)
+	})
+	return tmpl, storeError(err)
+}
+
+// Templates returns the scope's own workload templates ordered by name.
+func (s *StorageStore) Templates(ctx context.Context, tenantID, projectID string) ([]WorkloadTemplate, error) {
+	var templates []WorkloadTemplate
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(templateBucket, templatePrefix(tenantID, projectID), func(_ string, value []byte) error {
+			var tmpl WorkloadTemplate
+			if err := json.Unmarshal(value, &tmpl); err != nil {
+				return err
+			}
+			templates = append(templates, tmpl)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	// Keys hold escaped names, which can sort differently.
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func getTemplate(tx storage.Tx, key string) (WorkloadTemplate, error) {
+	data, err := tx.Get(templateBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return WorkloadTemplate{}, ErrTemplateNotFound
+	}
+	if err != nil {
+		return WorkloadTemplate{}, err
+	}
+	var tmpl WorkloadTemplate
+	err = json.Unmarshal(data, &tmpl)
+	return tmpl, err
+}
+
+// tenantUsage counts tenantID's assignments other than id, and how many of
+// its pending ones sort before id. Assignment IDs sort by creation time, so
+// those are the ones queued ahead of it.
+func tenantUsage(tx storage.Tx, tenantID, id string) (Usage, int, error) {
+	var usage Usage
+	ahead := 0
+	err := tx.Scan(assignmentBucket, "", func(key string, value []byte) error {
+		if key == id {
+			return nil
+		}
+		assignment, err := decodeAssignment(value)
+		if err != nil || assignment.TenantID != tenantID {
+			return err
+		}
+		usage.add(assignment.Status)
+		if assignment.Status == StatusPending && key < id {
+			ahead++
+		}
+		return nil
+	})
+	return usage, ahead, err
+}
+
+// setQueuePosition sets a pending assignment's QueuePosition.
+func setQueuePosition(tx storage.Tx, assignment *Assignment) error {
+	if assignment.Status != StatusPending {
+		return nil
+	}
+	_, ahead, err := tenantUsage(tx, assignment.TenantID, assignment.AssignmentID)
+	assignment.QueuePosition = ahead + 1
+	return err
+}
+
+func getAssignment(tx storage.Tx, id string) (Assignment, error) {
+	data, err := tx.Get(assignmentBucket, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Assignment{}, ErrAssignmentNotFound
+	}
+	if err != nil {
+		return Assignment{}, err
+	}
+	return decodeAssignment(data)
+}
+
+func decodeAssignment(data []byte) (Assignment, error) {
+	var assignment Assignment
+	err := json.Unmarshal(data, &assignment)
+	return assignment, err
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrAssignmentNotFound) || errors.Is(err, ErrTemplateNotFound) || errors.Is(err, ErrQuotaExceeded) ||
+		errors.Is(err, ErrAgentDraining) || errors.Is(err, ErrAgentNotDraining) || errors.Is(err, ErrTooManyArtifacts) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
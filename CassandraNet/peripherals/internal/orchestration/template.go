@@ -0,0 +1,247 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrTemplateNotFound is returned when no workload template has the
+// requested name in the scope.
+var ErrTemplateNotFound = errors.New("orchestration: workload template not found")
+
+// Workload template limits.
+const (
+	// MaxPriority bounds a workload template's Priority.
+	MaxPriority = 100
+	// maxCapabilities bounds a workload template's RequiredCapabilities.
+	maxCapabilities = 32
+	// maxRetryAttempts bounds a retry policy's MaxAttempts.
+	maxRetryAttempts = 100
+	// maxRetryBackoffSeconds bounds a retry policy's BackoffSeconds.
+	maxRetryBackoffSeconds = 24 * 60 * 60
+	// maxDescriptionLength bounds a workload template's description, in
+	// characters.
+	maxDescriptionLength = 1024
+)
+
+// RetryPolicy says how often, and how far apart, an agent should attempt
+// an assignment before reporting it failed.
+type RetryPolicy struct {
+	MaxAttempts    int     `json:"max_attempts"`
+	BackoffSeconds float64 `json:"backoff_seconds,omitempty"`
+}
+
+// WorkloadTemplate is a reusable workload definition that AssignRequest
+// names instead of repeating its fields. A template without a tenant is
+// offered to every tenant, and one without a project to every project of
+// its tenant; a template in a narrower scope hides one of the same name in
+// a wider one.
+type WorkloadTemplate struct {
+	Name        string `json:"name"`
+	TenantID    string `json:"tenant_id,omitempty"`
+	ProjectID   string `json:"project_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	// WorkloadID is given to assignments that name no workload of their
+	// own. Defaults to Name.
+	WorkloadID string `json:"workload_id,omitempty"`
+	// Metadata is merged under the assignment's own metadata, which wins
+	// for keys set in both.
+	Metadata             map[string]string `json:"metadata,omitempty"`
+	RequiredCapabilities []string          `json:"required_capabilities,omitempty"`
+	RetryPolicy          *RetryPolicy      `json:"retry_policy,omitempty"`
+	// Priority is from 0 to MaxPriority; higher is more urgent.
+	Priority  int       `json:"priority,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TemplateStore persists workload templates.
+type TemplateStore interface {
+	// PutTemplate creates or replaces the scope's template with tmpl.Name,
+	// keeping the creation time of the template it replaces, and reports
+	// whether it created one.
+	PutTemplate(ctx context.Context, tmpl WorkloadTemplate) (WorkloadTemplate, bool, error)
+	GetTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error)
+	DeleteTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error)
+	// Templates returns the scope's own templates ordered by name.
+	Templates(ctx context.Context, tenantID, projectID string) ([]WorkloadTemplate, error)
+}
+
+// SetTemplateStore serves the workload templates kept in ts at
+// /workload-templates and lets assignments name them. Without it
+// /workload-templates answers 404 and naming a template is invalid. Call
+// it before the service handles requests.
+func (s *Service) SetTemplateStore(ts TemplateStore) {
+	s.templates = ts
+}
+
+// PutWorkloadTemplate validates and creates or replaces a workload
+// template, reporting whether it created one. Assignments already made
+// from the template keep the values they were given.
+func (s *Service) PutWorkloadTemplate(ctx context.Context, tmpl WorkloadTemplate) (WorkloadTemplate, bool, error) {
+	if s.templates == nil {
+		return WorkloadTemplate{}, false, ErrTemplateNotFound
+	}
+	if err := validateTemplate(tmpl); err != nil {
+		return WorkloadTemplate{}, false, err
+	}
+	var before any
+	if previous, err := s.templates.GetTemplate(ctx, tmpl.TenantID, tmpl.ProjectID, tmpl.Name); err == nil {
+		before = previous
+	} else if !errors.Is(err, ErrTemplateNotFound) {
+		return WorkloadTemplate{}, false, err
+	}
+	now := s.clock.Now()
+	tmpl.Metadata = cloneMetadata(tmpl.Metadata)
+	tmpl.RequiredCapabilities = slices.Clone(tmpl.RequiredCapabilities)
+	if tmpl.RetryPolicy != nil {
+		policy := *tmpl.RetryPolicy
+		tmpl.RetryPolicy = &policy
+	}
+	tmpl.CreatedAt, tmpl.UpdatedAt = now, now
+	saved, created, err := s.templates.PutTemplate(ctx, tmpl)
+	if err != nil {
+		return WorkloadTemplate{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "orchestration.workload_template.put",
+		Resource:  "workload-templates/" + saved.Name,
+		TenantID:  saved.TenantID,
+		ProjectID: saved.ProjectID,
+		Before:    before,
+		After:     saved,
+	})
+	return saved, created, nil
+}
+
+// GetWorkloadTemplate returns the scope's own workload template name.
+func (s *Service) GetWorkloadTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error) {
+	if s.templates == nil {
+		return WorkloadTemplate{}, ErrTemplateNotFound
+	}
+	return s.templates.GetTemplate(ctx, tenantID, projectID, name)
+}
+
+// DeleteWorkloadTemplate removes the scope's own workload template name.
+func (s *Service) DeleteWorkloadTemplate(ctx context.Context, tenantID, projectID, name string) error {
+	if s.templates == nil {
+		return ErrTemplateNotFound
+	}
+	tmpl, err := s.templates.DeleteTemplate(ctx, tenantID, projectID, name)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "orchestration.workload_template.delete",
+		Resource:  "workload-templates/" + tmpl.Name,
+		TenantID:  tmpl.TenantID,
+		ProjectID: tmpl.ProjectID,
+		Before:    tmpl,
+	})
+	return nil
+}
+
+// ListWorkloadTemplates lists one page of the scope's own workload
+// templates by name, and the position of the next page.
+func (s *Service) ListWorkloadTemplates(ctx context.Context, tenantID, projectID string, page pagination.Request) ([]WorkloadTemplate, string, error) {
+	if s.templates == nil {
+		return nil, "", ErrTemplateNotFound
+	}
+	templates, err := s.templates.Templates(ctx, tenantID, projectID)
+	if err != nil {
+		return nil, "", err
+	}
+	items, next := pagination.Slice(templates, func(t WorkloadTemplate) string { return t.Name }, page)
+	return items, next, nil
+}
+
+// resolveTemplate returns the template name offered to the project: the
+// project's own, or else its tenant's, or else the one for every tenant.
+func (s *Service) resolveTemplate(ctx context.Context, tenantID, projectID, name string) (WorkloadTemplate, error) {
+	if s.templates == nil {
+		return WorkloadTemplate{}, ErrTemplateNotFound
+	}
+	scopes := [][2]string{{tenantID, projectID}}
+	if projectID != "" {
+		scopes = append(scopes, [2]string{tenantID, ""})
+	}
+	if tenantID != "" {
+		scopes = append(scopes, [2]string{"", ""})
+	}
+	for _, scope := range scopes {
+		tmpl, err := s.templates.GetTemplate(ctx, scope[0], scope[1], name)
+		if !errors.Is(err, ErrTemplateNotFound) {
+			return tmpl, err
+		}
+	}
+	return WorkloadTemplate{}, ErrTemplateNotFound
+}
+
+// applyTemplate fills req's missing workload and metadata from the template
+// it names, and sets the fields only templates provide on assignment.
+func (s *Service) applyTemplate(ctx context.Context, req *AssignRequest, assignment *Assignment) error {
+	tmpl, err := s.resolveTemplate(ctx, req.TenantID, req.ProjectID, req.Template)
+	if errors.Is(err, ErrTemplateNotFound) {
+		return validation.Invalid("template", validation.RuleFormat, fmt.Sprintf("names no workload template %q", req.Template))
+	}
+	if err != nil {
+		return err
+	}
+	if req.WorkloadID == "" {
+		req.WorkloadID = tmpl.WorkloadID
+		if req.WorkloadID == "" {
+			req.WorkloadID = tmpl.Name
+		}
+	}
+	if len(tmpl.Metadata) > 0 {
+		metadata := cloneMetadata(tmpl.Metadata)
+		for k, v := range req.Metadata {
+			metadata[k] = v
+		}
+		req.Metadata = metadata
+	}
+	assignment.Template = tmpl.Name
+	assignment.Priority = tmpl.Priority
+	assignment.RequiredCapabilities = slices.Clone(tmpl.RequiredCapabilities)
+	assignment.RetryPolicy = tmpl.RetryPolicy
+	return nil
+}
+
+func validateTemplate(tmpl WorkloadTemplate) error {
+	var v validation.Validator
+	v.ID("name", tmpl.Name).Excludes("/")
+	v.String("tenant_id", tmpl.TenantID).MaxLength(validation.MaxIDLength)
+	v.String("project_id", tmpl.ProjectID).MaxLength(validation.MaxIDLength)
+	v.Check(tmpl.ProjectID == "" || tmpl.TenantID != "", "project_id", validation.RuleRequired, "requires tenant_id")
+	v.String("description", tmpl.Description).MaxLength(maxDescriptionLength)
+	v.String("workload_id", tmpl.WorkloadID).MaxLength(validation.MaxIDLength)
+	v.Map("metadata", tmpl.Metadata).Limited()
+	v.Check(len(tmpl.RequiredCapabilities) <= maxCapabilities, "required_capabilities", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxCapabilities))
+	for i, capability := range tmpl.RequiredCapabilities {
+		v.ID(fmt.Sprintf("required_capabilities[%d]", i), capability)
+	}
+	if tmpl.RetryPolicy != nil {
+		v.Int("retry_policy.max_attempts", int64(tmpl.RetryPolicy.MaxAttempts)).Range(1, maxRetryAttempts)
+		v.Check(tmpl.RetryPolicy.BackoffSeconds >= 0 && tmpl.RetryPolicy.BackoffSeconds <= maxRetryBackoffSeconds,
+			"retry_policy.backoff_seconds", validation.RuleRange, fmt.Sprintf("must be between 0 and %d", maxRetryBackoffSeconds))
+	}
+	v.Int("priority", int64(tmpl.Priority)).Range(0, MaxPriority)
+	return v.Err()
+}
+
+func templateKey(tenantID, projectID, name string) string {
+	return templatePrefix(tenantID, projectID) + url.PathEscape(name)
+}
+
+// templatePrefix is the key prefix of a scope's own templates.
+func templatePrefix(tenantID, projectID string) string {
+	return url.PathEscape(tenantID) + "/" + url.PathEscape(projectID) + "/"
+}
@@ -0,0 +1,156 @@
+package orchestration
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+const (
+	templatesPath   = "/workload-templates"
+	templatesPrefix = "/workload-templates/"
+)
+
+// ManagementPaths are the netacl routes of the workload template
+// endpoints.
+var ManagementPaths = []string{templatesPath}
+
+// templatePayload omits the name and scope, which come from the path and
+// query.
+type templatePayload struct {
+	Description          string            `json:"description"`
+	WorkloadID           string            `json:"workload_id"`
+	Metadata             map[string]string `json:"metadata"`
+	RequiredCapabilities []string          `json:"required_capabilities"`
+	RetryPolicy          *RetryPolicy      `json:"retry_policy"`
+	Priority             int               `json:"priority"`
+}
+
+func (s *Service) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if !s.templatesEnabled(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	tenant, project, ok := resolveScope(w, r)
+	if !ok || !auth.Allow(w, r, auth.PermAssignmentsRead, tenant, project) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	templates, next, err := s.ListWorkloadTemplates(r.Context(), tenant, project, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, templates, next)
+}
+
+func (s *Service) handleTemplate(w http.ResponseWriter, r *http.Request) {
+	if !s.templatesEnabled(w, r) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, templatesPrefix)
+	if name == "" || strings.Contains(name, "/") {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	tenant, project, ok := resolveScope(w, r)
+	if !ok {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermAssignmentsRead, tenant, project) {
+			return
+		}
+		tmpl, err := s.GetWorkloadTemplate(r.Context(), tenant, project, name)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, tmpl)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermWorkloadTemplatesManage, tenant, project) {
+			return
+		}
+		s.handlePutTemplate(w, r, tenant, project, name)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermWorkloadTemplatesManage, tenant, project) {
+			return
+		}
+		if err := s.DeleteWorkloadTemplate(r.Context(), tenant, project, name); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Service) handlePutTemplate(w http.ResponseWriter, r *http.Request, tenant, project, name string) {
+	defer r.Body.Close()
+	var payload templatePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	tmpl, created, err := s.PutWorkloadTemplate(r.Context(), WorkloadTemplate{
+		Name:                 name,
+		TenantID:             tenant,
+		ProjectID:            project,
+		Description:          payload.Description,
+		WorkloadID:           payload.WorkloadID,
+		Metadata:             payload.Metadata,
+		RequiredCapabilities: payload.RequiredCapabilities,
+		RetryPolicy:          payload.RetryPolicy,
+		Priority:             payload.Priority,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, tmpl)
+}
+
+// templatesEnabled writes 404 unless the service has a TemplateStore.
+func (s *Service) templatesEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.templates == nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return false
+	}
+	return true
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// tenant_id and project_id query parameters, writing 403 when they
+// contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return "", "", false
+	}
+	requestedProject := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), requestedProject)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+requestedProject)
+		return "", "", false
+	}
+	return tenant, project, true
+}
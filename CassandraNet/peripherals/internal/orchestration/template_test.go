@@ -0,0 +1,68 @@
+package orchestration
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestWorkloadTemplatesFillAssignments(t *testing.T) {
+	svc, _ := newTestService(t)
+	h := svc.Handler()
+	ctx := context.Background()
+	put := func(path string, tmpl map[string]any) {
+		t.Helper()
+		if status, body := serve(t, h, http.MethodPut, path, tmpl); status != http.StatusCreated {
+			t.Fatalf("put %s: %d %s", path, status, body)
+		}
+	}
+	put("/workload-templates/build", map[string]any{
+		"workload_id": "ci-build", "metadata": map[string]string{"image": "builder:1", "arch": "amd64"}, "priority": 10,
+	})
+	put("/workload-templates/build?tenant_id=acme", map[string]any{
+		"workload_id": "acme-build", "metadata": map[string]string{"image": "builder:2", "arch": "amd64"},
+		"required_capabilities": []string{"gpu"}, "retry_policy": map[string]any{"max_attempts": 3, "backoff_seconds": 30}, "priority": 80,
+	})
+	if status, body := serve(t, h, http.MethodPut, "/workload-templates/bad", map[string]any{"priority": 101}); status != http.StatusBadRequest || !strings.Contains(string(body), `"priority"`) {
+		t.Fatalf("expected an out-of-range priority refused, got %d %s", status, body)
+	}
+
+	assignment, err := svc.AssignWork(ctx, AssignRequest{
+		AgentID: "agent-1", TenantID: "acme", ProjectID: "p1", Template: "build", Metadata: map[string]string{"arch": "arm64"},
+	})
+	if err != nil {
+		t.Fatalf("assign from acme's template: %v", err)
+	}
+	if assignment.WorkloadID != "acme-build" || assignment.Template != "build" || assignment.Priority != 80 ||
+		assignment.Metadata["image"] != "builder:2" || assignment.Metadata["arch"] != "arm64" ||
+		len(assignment.RequiredCapabilities) != 1 || assignment.RetryPolicy == nil || assignment.RetryPolicy.MaxAttempts != 3 {
+		t.Fatalf("expected acme's template applied beneath the request, got %+v", assignment)
+	}
+	other, err := svc.AssignWork(ctx, AssignRequest{AgentID: "agent-1", TenantID: "globex", Template: "build", WorkloadID: "own"})
+	if err != nil || other.WorkloadID != "own" || other.Priority != 10 || other.Metadata["image"] != "builder:1" {
+		t.Fatalf("expected the shared template for another tenant, got %+v %v", other, err)
+	}
+	var invalid validation.Errors
+	if _, err := svc.AssignWork(ctx, AssignRequest{AgentID: "agent-1", TenantID: "acme", Template: "missing"}); !errors.As(err, &invalid) {
+		t.Fatalf("expected an unknown template refused, got %v", err)
+	}
+
+	status, body := serve(t, h, http.MethodGet, "/workload-templates?tenant_id=acme", nil)
+	if status != http.StatusOK || !strings.Contains(string(body), `"workload_id":"acme-build"`) || strings.Contains(string(body), `"workload_id":"ci-build"`) {
+		t.Fatalf("expected only acme's own templates listed, got %d %s", status, body)
+	}
+	if err := svc.DeleteWorkloadTemplate(ctx, "acme", "", "build"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	fallback, err := svc.AssignWork(ctx, AssignRequest{AgentID: "agent-1", TenantID: "acme", Template: "build"})
+	if err != nil || fallback.WorkloadID != "ci-build" {
+		t.Fatalf("expected the shared template once acme's is gone, got %+v %v", fallback, err)
+	}
+	if got, err := svc.GetAssignment(ctx, assignment.AssignmentID); err != nil || got.WorkloadID != "acme-build" || got.Priority != 80 {
+		t.Fatalf("expected the earlier assignment to keep its values, got %+v %v", got, err)
+	}
+}
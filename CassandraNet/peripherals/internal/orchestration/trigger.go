@@ -0,0 +1,568 @@
+package orchestration
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Metadata keys set on every assignment a trigger creates, naming the
+// message it came from.
+const (
+	MetadataTriggerTopic     = "trigger_topic"
+	MetadataTriggerMessageID = "trigger_message_id"
+)
+
+// TriggerMessage is a message pulled from a trigger's topic.
+type TriggerMessage struct {
+	MessageID  string
+	TenantID   string
+	ProjectID  string
+	Topic      string
+	Key        string
+	Priority   string
+	Attributes map[string]string
+	Payload    []byte
+}
+
+// MessageSource pulls and acknowledges the messages of a topic.
+type MessageSource interface {
+	// Pull returns up to limit of topic's pending messages, oldest first.
+	Pull(ctx context.Context, topic string, limit int) ([]TriggerMessage, error)
+	Ack(ctx context.Context, topic, messageID string) error
+}
+
+// Trigger maps the messages of a topic to assignments. AgentID, WorkloadID,
+// and the Metadata values are templates: ${message_id}, ${key},
+// ${topic}, ${tenant_id}, ${project_id}, and ${priority} stand for the
+// message's fields, ${attributes.NAME} for one of its attributes, and
+// ${payload.a.b} for a value in its JSON payload, read through nested
+// objects. A message missing a referenced value is not mapped.
+type Trigger struct {
+	// Name identifies the trigger in logs and stats (default Topic).
+	Name  string `json:"name,omitempty"`
+	Topic string `json:"topic"`
+	// TenantID, ProjectID, and Attributes, when set, must equal the
+	// message's for the trigger to apply.
+	TenantID   string            `json:"tenant_id,omitempty"`
+	ProjectID  string            `json:"project_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	AgentID    string            `json:"agent_id"`
+	WorkloadID string            `json:"workload_id"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// LoadTriggers reads a JSON array of triggers from path.
+func LoadTriggers(path string) ([]Trigger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read triggers: %w", err)
+	}
+	var triggers []Trigger
+	if err := json.Unmarshal(data, &triggers); err != nil {
+		return nil, fmt.Errorf("decode triggers: %w", err)
+	}
+	return triggers, nil
+}
+
+// TriggerConfig tunes how Triggers polls.
+type TriggerConfig struct {
+	// PollInterval is how often each topic is pulled (default 2s).
+	PollInterval time.Duration
+	// BatchSize is the most messages pulled per topic and poll (default 50).
+	BatchSize int
+}
+
+// TriggerStats counts what a trigger has done since startup.
+type TriggerStats struct {
+	Topic     string    `json:"topic"`
+	Created   uint64    `json:"created"`
+	Failed    uint64    `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+	LastAt    time.Time `json:"last_at,omitzero"`
+}
+
+// Triggers creates assignments from the messages on the topics of its
+// triggers. Each message is handled by the first trigger, in file order,
+// that matches it, and is then acknowledged. Messages no trigger matches,
+// and messages a trigger cannot map to a valid assignment, are
+// acknowledged and dropped so they do not block the topic; a storage
+// failure leaves the message for the next poll. Messages are not leased
+// while they are handled, so only one orchestrator should run triggers.
+type Triggers struct {
+	svc      *Service
+	source   MessageSource
+	cfg      TriggerConfig
+	triggers []compiledTrigger
+	topics   []string
+	lease    *lock.Lease
+	logger   interface {
+		Printf(string, ...any)
+	}
+
+	mu        sync.Mutex
+	stats     map[string]*TriggerStats
+	unmatched map[string]uint64
+	// unacked holds the messages whose assignment was created but whose
+	// acknowledgement failed, so a retry does not create it again.
+	unacked map[string]bool
+}
+
+type compiledTrigger struct {
+	Trigger
+	agent    template
+	workload template
+	metadata map[string]template
+}
+
+// NewTriggers validates triggers and returns a runner creating assignments
+// through svc from the messages source pulls. Call Run to start polling.
+func NewTriggers(svc *Service, source MessageSource, triggers []Trigger, cfg TriggerConfig, logger interface {
+	Printf(string, ...any)
+}) (*Triggers, error) {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	t := &Triggers{
+		svc:       svc,
+		source:    source,
+		cfg:       cfg,
+		logger:    logger,
+		stats:     make(map[string]*TriggerStats),
+		unmatched: make(map[string]uint64),
+		unacked:   make(map[string]bool),
+	}
+	for i, tr := range triggers {
+		if tr.Name == "" {
+			tr.Name = tr.Topic
+		}
+		if tr.Topic == "" || tr.AgentID == "" || tr.WorkloadID == "" {
+			return nil, fmt.Errorf("trigger %d: topic, agent_id, and workload_id are required", i)
+		}
+		if _, ok := t.stats[tr.Name]; ok {
+			return nil, fmt.Errorf("trigger %q: name is used twice; name triggers that share a topic", tr.Name)
+		}
+		c := compiledTrigger{Trigger: tr, metadata: make(map[string]template, len(tr.Metadata))}
+		var err error
+		if c.agent, err = parseTemplate(tr.AgentID); err != nil {
+			return nil, fmt.Errorf("trigger %q: agent_id: %w", tr.Name, err)
+		}
+		if c.workload, err = parseTemplate(tr.WorkloadID); err != nil {
+			return nil, fmt.Errorf("trigger %q: workload_id: %w", tr.Name, err)
+		}
+		for k, v := range tr.Metadata {
+			if c.metadata[k], err = parseTemplate(v); err != nil {
+				return nil, fmt.Errorf("trigger %q: metadata %s: %w", tr.Name, k, err)
+			}
+		}
+		t.triggers = append(t.triggers, c)
+		t.stats[tr.Name] = &TriggerStats{Topic: tr.Topic}
+		if _, ok := t.unmatched[tr.Topic]; !ok {
+			t.unmatched[tr.Topic] = 0
+			t.topics = append(t.topics, tr.Topic)
+		}
+	}
+	return t, nil
+}
+
+// SetLocker has one replica sharing l poll the trigger topics at a time;
+// the others skip their polls until its lease lapses or it stops. Call it
+// before Run.
+func (t *Triggers) SetLocker(l lock.Locker) {
+	t.lease = lock.NewLease(l, "orchestration.triggers", 3*t.cfg.PollInterval)
+}
+
+// Run polls every trigger topic each poll interval until ctx is cancelled.
+// Failures are logged and retried on the next poll.
+func (t *Triggers) Run(ctx context.Context) error {
+	if len(t.topics) == 0 {
+		return nil
+	}
+	ticker := t.svc.clock.NewTicker(t.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if held, err := t.lease.Held(ctx); err != nil {
+			if ctx.Err() == nil {
+				t.logger.Printf("take triggers lease: %v", err)
+			}
+		} else if held {
+			for _, topic := range t.topics {
+				if err := t.Poll(ctx, topic); err != nil && ctx.Err() == nil {
+					t.logger.Printf("trigger topic %s: %v", topic, err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			_ = t.lease.Release(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Poll pulls one batch of topic and handles each message. It stops at the
+// first message that must be retried.
+func (t *Triggers) Poll(ctx context.Context, topic string) error {
+	messages, err := t.source.Pull(ctx, topic, t.cfg.BatchSize)
+	if err != nil {
+		return fmt.Errorf("pull: %w", err)
+	}
+	for _, msg := range messages {
+		if err := t.handle(ctx, topic, msg); err != nil {
+			return fmt.Errorf("message %s: %w", msg.MessageID, err)
+		}
+	}
+	return nil
+}
+
+// handle creates msg's assignment, if a trigger matches, and acknowledges
+// it. The work carries the publisher's request ID when the message
+// recorded one.
+func (t *Triggers) handle(ctx context.Context, topic string, msg TriggerMessage) error {
+	if id := msg.Attributes[logging.RequestIDField]; id != "" {
+		ctx = logging.WithRequestID(ctx, id)
+	}
+	unackedKey := topic + "\x00" + msg.MessageID
+	t.mu.Lock()
+	created := t.unacked[unackedKey]
+	t.mu.Unlock()
+	if !created {
+		tr, ok := t.match(topic, msg)
+		if !ok {
+			t.mu.Lock()
+			t.unmatched[topic]++
+			t.mu.Unlock()
+		} else if err := t.assign(ctx, tr, msg); err != nil {
+			if !errors.Is(err, errUnmappable) {
+				return err
+			}
+			t.logger.Printf("trigger %s: dropping message %s: %v", tr.Name, msg.MessageID, err)
+		}
+	}
+	if err := t.source.Ack(ctx, topic, msg.MessageID); err != nil {
+		t.mu.Lock()
+		t.unacked[unackedKey] = true
+		t.mu.Unlock()
+		return fmt.Errorf("ack: %w", err)
+	}
+	t.mu.Lock()
+	delete(t.unacked, unackedKey)
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *Triggers) match(topic string, msg TriggerMessage) (*compiledTrigger, bool) {
+	for i := range t.triggers {
+		tr := &t.triggers[i]
+		if tr.Topic != topic {
+			continue
+		}
+		if (tr.TenantID != "" && tr.TenantID != msg.TenantID) || (tr.ProjectID != "" && tr.ProjectID != msg.ProjectID) {
+			continue
+		}
+		matched := true
+		for k, v := range tr.Attributes {
+			if msg.Attributes[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return tr, true
+		}
+	}
+	return nil, false
+}
+
+// errUnmappable marks a message that can never become an assignment.
+var errUnmappable = errors.New("cannot be mapped")
+
+// assign creates tr's assignment for msg, returning an error wrapping
+// errUnmappable when msg lacks a referenced value or the result is invalid.
+func (t *Triggers) assign(ctx context.Context, tr *compiledTrigger, msg TriggerMessage) error {
+	req, err := tr.request(msg)
+	if err == nil {
+		_, err = t.svc.AssignWork(ctx, req)
+		var invalid validation.Errors
+		if errors.As(err, &invalid) {
+			err = fmt.Errorf("%w: %v", errUnmappable, err)
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats[tr.Name]
+	stats.LastAt = t.svc.clock.Now()
+	if err != nil {
+		stats.Failed++
+		stats.LastError = err.Error()
+		return err
+	}
+	stats.Created++
+	return nil
+}
+
+func (tr *compiledTrigger) request(msg TriggerMessage) (AssignRequest, error) {
+	var payload any
+	if len(msg.Payload) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(msg.Payload))
+		dec.UseNumber()
+		if dec.Decode(&payload) != nil {
+			payload = nil
+		}
+	}
+	render := func(field string, tmpl template) (string, error) {
+		s, err := tmpl.render(msg, payload)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s: %v", errUnmappable, field, err)
+		}
+		return s, nil
+	}
+	req := AssignRequest{
+		TenantID:  msg.TenantID,
+		ProjectID: msg.ProjectID,
+		Metadata:  make(map[string]string, len(tr.metadata)+2),
+	}
+	var err error
+	if req.AgentID, err = render("agent_id", tr.agent); err != nil {
+		return AssignRequest{}, err
+	}
+	if req.WorkloadID, err = render("workload_id", tr.workload); err != nil {
+		return AssignRequest{}, err
+	}
+	for k, tmpl := range tr.metadata {
+		if req.Metadata[k], err = render("metadata "+k, tmpl); err != nil {
+			return AssignRequest{}, err
+		}
+	}
+	req.Metadata[MetadataTriggerTopic] = tr.Topic
+	req.Metadata[MetadataTriggerMessageID] = msg.MessageID
+	return req, nil
+}
+
+// TriggersStats describes what every trigger has done since startup.
+type TriggersStats struct {
+	// Triggers holds each trigger's counts by name.
+	Triggers map[string]TriggerStats `json:"triggers"`
+	// Unmatched counts, per topic, the messages no trigger matched.
+	Unmatched map[string]uint64 `json:"unmatched"`
+}
+
+// Stats reports each trigger's counts and the unmatched messages per topic.
+func (t *Triggers) Stats() TriggersStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := TriggersStats{
+		Triggers:  make(map[string]TriggerStats, len(t.stats)),
+		Unmatched: make(map[string]uint64, len(t.unmatched)),
+	}
+	for name, s := range t.stats {
+		out.Triggers[name] = *s
+	}
+	for topic, n := range t.unmatched {
+		out.Unmatched[topic] = n
+	}
+	return out
+}
+
+// template is a string with ${...} references to a message's values.
+type template []templatePart
+
+type templatePart struct {
+	literal string
+	ref     string
+}
+
+func parseTemplate(s string) (template, error) {
+	var t template
+	for s != "" {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			t = append(t, templatePart{literal: s})
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed reference in %q", s)
+		}
+		ref := s[start+2 : start+end]
+		switch {
+		case ref == "message_id", ref == "key", ref == "topic", ref == "tenant_id", ref == "project_id", ref == "priority":
+		case strings.HasPrefix(ref, "attributes.") && len(ref) > len("attributes."):
+		case strings.HasPrefix(ref, "payload.") && len(ref) > len("payload."):
+		default:
+			return nil, fmt.Errorf("unknown reference ${%s}", ref)
+		}
+		if start > 0 {
+			t = append(t, templatePart{literal: s[:start]})
+		}
+		t = append(t, templatePart{ref: ref})
+		s = s[start+end+1:]
+	}
+	return t, nil
+}
+
+// render expands t for msg, whose payload has been decoded as JSON into
+// payload (nil when it is not JSON).
+func (t template) render(msg TriggerMessage, payload any) (string, error) {
+	var b strings.Builder
+	for _, part := range t {
+		if part.ref == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		value, ok := lookup(part.ref, msg, payload)
+		if !ok || value == "" {
+			return "", fmt.Errorf("${%s} is missing", part.ref)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func lookup(ref string, msg TriggerMessage, payload any) (string, bool) {
+	switch ref {
+	case "message_id":
+		return msg.MessageID, true
+	case "key":
+		return msg.Key, true
+	case "topic":
+		return msg.Topic, true
+	case "tenant_id":
+		return msg.TenantID, true
+	case "project_id":
+		return msg.ProjectID, true
+	case "priority":
+		return msg.Priority, true
+	}
+	if name, ok := strings.CutPrefix(ref, "attributes."); ok {
+		value, ok := msg.Attributes[name]
+		return value, ok
+	}
+	path, _ := strings.CutPrefix(ref, "payload.")
+	value := payload
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[name]; !ok {
+			return "", false
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprint(v), true
+	default:
+		encoded, err := json.Marshal(v)
+		return string(encoded), err == nil
+	}
+}
+
+// MessagingClient pulls and acknowledges messages through the messaging
+// service's /topics/{topic}/messages endpoints.
+type MessagingClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewMessagingClient constructs a client for the messaging service at
+// baseURL.
+func NewMessagingClient(baseURL string, transport http.RoundTripper) *MessagingClient {
+	return &MessagingClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// Pull returns up to limit of topic's pending messages in every tenant the
+// client's credentials reach.
+func (c *MessagingClient) Pull(ctx context.Context, topic string, limit int) ([]TriggerMessage, error) {
+	target := c.topicURL(topic) + "?" + url.Values{"limit": {fmt.Sprint(limit)}}.Encode()
+	var items []struct {
+		MessageID     string            `json:"message_id"`
+		TenantID      string            `json:"tenant_id"`
+		ProjectID     string            `json:"project_id"`
+		Topic         string            `json:"topic"`
+		Key           string            `json:"key"`
+		Priority      string            `json:"priority"`
+		Attributes    map[string]string `json:"attributes"`
+		PayloadBase64 string            `json:"payload_base64"`
+	}
+	if err := c.do(ctx, http.MethodGet, target, &items); err != nil {
+		return nil, err
+	}
+	messages := make([]TriggerMessage, 0, len(items))
+	for _, item := range items {
+		payload, err := base64.StdEncoding.DecodeString(item.PayloadBase64)
+		if err != nil {
+			return nil, fmt.Errorf("message %s: payload: %w", item.MessageID, err)
+		}
+		messages = append(messages, TriggerMessage{
+			MessageID:  item.MessageID,
+			TenantID:   item.TenantID,
+			ProjectID:  item.ProjectID,
+			Topic:      item.Topic,
+			Key:        item.Key,
+			Priority:   item.Priority,
+			Attributes: item.Attributes,
+			Payload:    payload,
+		})
+	}
+	return messages, nil
+}
+
+// Ack acknowledges a message so it is not pulled again.
+func (c *MessagingClient) Ack(ctx context.Context, topic, messageID string) error {
+	return c.do(ctx, http.MethodPost, c.topicURL(topic)+"/"+url.PathEscape(messageID)+"/ack", nil)
+}
+
+// Check reports whether the messaging service answers its health check.
+func (c *MessagingClient) Check(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.baseURL+"/healthz", nil)
+}
+
+func (c *MessagingClient) topicURL(topic string) string {
+	return c.baseURL + "/topics/" + url.PathEscape(topic) + "/messages"
+}
+
+func (c *MessagingClient) do(ctx context.Context, method, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("messaging service returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
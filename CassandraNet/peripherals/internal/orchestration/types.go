@@ -14,6 +14,11 @@ const (
 	StatusCancelled Status = "cancelled"
 )
 
+// Final reports whether s ends an assignment's lifecycle.
+func (s Status) Final() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
 // Assignment models a unit of work targeting an agent.
 type Assignment struct {
 	AssignmentID  string            `json:"assignment_id"`
@@ -26,14 +31,31 @@ type Assignment struct {
 	CreatedAt     time.Time         `json:"created_at"`
 	UpdatedAt     time.Time         `json:"updated_at"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
+	// Template names the workload template the assignment was made from.
+	// RequiredCapabilities, RetryPolicy, and Priority are copied from it
+	// for the agent; the orchestrator does not act on them.
+	Template             string       `json:"template,omitempty"`
+	RequiredCapabilities []string     `json:"required_capabilities,omitempty"`
+	RetryPolicy          *RetryPolicy `json:"retry_policy,omitempty"`
+	Priority             int          `json:"priority,omitempty"`
+	// Artifacts holds the outputs the agent attached, in the order they
+	// were first attached.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// QueuePosition is a pending assignment's place among its tenant's
+	// pending assignments, oldest first, starting at 1. It is computed when
+	// the assignment is read, not stored.
+	QueuePosition int `json:"queue_position,omitempty"`
 }
 
-// AssignRequest is the payload required to create an assignment.
+// AssignRequest is the payload required to create an assignment. Template,
+// when set, names a WorkloadTemplate that supplies WorkloadID when it is
+// empty and metadata beneath Metadata.
 type AssignRequest struct {
 	AgentID    string
 	WorkloadID string
 	TenantID   string
 	ProjectID  string
+	Template   string
 	Metadata   map[string]string
 }
 
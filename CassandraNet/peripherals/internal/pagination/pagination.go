@@ -0,0 +1,236 @@
+// Package pagination gives list endpoints one way to page results. A
+// request names a page with ?limit= and ?cursor=; the response is a
+// Page envelope whose next_cursor, also sent as a Link header with
+// rel="next", fetches the following page and is absent on the last one.
+//
+// Endpoints that answered with a bare JSON array before they were paged
+// keep doing so for requests that name no page; see WriteList.
+//
+// A cursor is an opaque encoding of the position the next page starts
+// after: a store key, a sequence number, or whatever orders the list.
+// Positions are compared, not counted, so items added or removed between
+// requests do not shift later pages.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Page sizes: DefaultLimit applies when a request names none, and larger
+// limits than MaxLimit are clamped to it.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// cursorPrefix versions the cursor encoding.
+const cursorPrefix = "c1:"
+
+// ErrInvalidCursor is returned by Decode for a cursor this package did not
+// issue.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Request is one page request.
+type Request struct {
+	// Limit is the most items to return, between 1 and MaxLimit.
+	Limit int
+	// After is the decoded cursor, the position the page starts after;
+	// empty for the first page.
+	After string
+}
+
+// Page is the response envelope of every list endpoint.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Parse reads the limit and cursor query parameters. A missing limit
+// means defaultLimit. Errors are validation.Errors naming the offending
+// parameter.
+func Parse(r *http.Request, defaultLimit int) (Request, error) {
+	query := r.URL.Query()
+	req := Request{Limit: defaultLimit}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return Request{}, validation.Invalid("limit", validation.RuleRange, "must be a positive integer")
+		}
+		req.Limit = limit
+	}
+	req.Limit = Clamp(req.Limit)
+	if raw := query.Get("cursor"); raw != "" {
+		after, err := Decode(raw)
+		if err != nil {
+			return Request{}, validation.Invalid("cursor", validation.RuleFormat, "is not a valid cursor")
+		}
+		req.After = after
+	}
+	return req, nil
+}
+
+// Clamp bounds limit to between 1 and MaxLimit.
+func Clamp(limit int) int {
+	return min(max(limit, 1), MaxLimit)
+}
+
+// Encode returns the cursor for a page starting after position after.
+func Encode(after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + after))
+}
+
+// Decode returns the position encoded in cursor.
+func Decode(cursor string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), cursorPrefix) {
+		return "", ErrInvalidCursor
+	}
+	return strings.TrimPrefix(string(raw), cursorPrefix), nil
+}
+
+// Write sends items as a Page. A non-empty next is the position the
+// following page starts after; it is encoded into next_cursor and a Link
+// header repeating the request with the new cursor. The link keeps the
+// path the client sent, before a gateway or version prefix was stripped.
+func Write[T any](w http.ResponseWriter, r *http.Request, items []T, next string) {
+	page := Page[T]{Items: items}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	page.NextCursor = setLink(w, r, next)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// Requested reports whether r names a page with any of params, limit and
+// cursor when none are given. An empty value counts, so ?cursor= asks for
+// the first page.
+func Requested(r *http.Request, params ...string) bool {
+	if len(params) == 0 {
+		params = []string{"limit", "cursor"}
+	}
+	query := r.URL.Query()
+	for _, param := range params {
+		if query.Has(param) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListLimit is the default page size of an endpoint that answered with a
+// bare JSON array before it was paged: DefaultLimit when the request is
+// paged, and MaxLimit when it is not, so such clients keep receiving
+// whole lists up to that size.
+func ListLimit(paged bool) int {
+	if paged {
+		return DefaultLimit
+	}
+	return MaxLimit
+}
+
+// WriteList is Write for an endpoint that answered with a bare JSON array
+// before it was paged. A paged request, see Requested, gets the Page
+// envelope; any other gets items as that array, with the Link header
+// still naming the following page.
+func WriteList[T any](w http.ResponseWriter, r *http.Request, items []T, next string, paged bool) {
+	if paged {
+		Write(w, r, items, next)
+		return
+	}
+	if items == nil {
+		items = []T{}
+	}
+	setLink(w, r, next)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(items)
+}
+
+// setLink sets the Link header naming the page after next and returns its
+// cursor, or does nothing and returns "" when next is empty.
+func setLink(w http.ResponseWriter, r *http.Request, next string) string {
+	if next == "" {
+		return ""
+	}
+	cursor := Encode(next)
+	link := *r.URL
+	if sent, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		link.Path, link.RawPath = sent.Path, sent.RawPath
+	}
+	query := link.Query()
+	query.Set("cursor", cursor)
+	link.RawQuery = query.Encode()
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, link.RequestURI()))
+	return cursor
+}
+
+// Slice pages items already sorted by ascending key: it returns up to
+// req.Limit items whose key follows req.After, and the position of the
+// next page, empty when no items remain.
+func Slice[T any](items []T, key func(T) string, req Request) ([]T, string) {
+	start := 0
+	if req.After != "" {
+		for start < len(items) && key(items[start]) <= req.After {
+			start++
+		}
+	}
+	items = items[start:]
+	if len(items) <= req.Limit {
+		return items, ""
+	}
+	items = items[:req.Limit]
+	return items, key(items[len(items)-1])
+}
+
+// Collector gathers one page from items visited in ascending position
+// order, such as a storage scan. Add each item that passes the endpoint's
+// filters; once Add returns false the page is full and the visit can stop.
+type Collector[T any] struct {
+	req   Request
+	items []T
+	last  string
+	more  bool
+}
+
+// NewCollector returns a collector for req.
+func NewCollector[T any](req Request) *Collector[T] {
+	return &Collector[T]{req: req}
+}
+
+// Skip reports whether position falls at or before the cursor, so the
+// item belongs to an earlier page.
+func (c *Collector[T]) Skip(position string) bool {
+	return c.req.After != "" && position <= c.req.After
+}
+
+// Add appends item at position. It reports false when the page was
+// already full, which shows a further page exists.
+func (c *Collector[T]) Add(position string, item T) bool {
+	if len(c.items) >= c.req.Limit {
+		c.more = true
+		return false
+	}
+	c.items = append(c.items, item)
+	c.last = position
+	return true
+}
+
+// Page returns the collected items and the position of the next page,
+// empty when the visit ended without overflowing the page.
+func (c *Collector[T]) Page() ([]T, string) {
+	if !c.more {
+		return c.items, ""
+	}
+	return c.items, c.last
+}
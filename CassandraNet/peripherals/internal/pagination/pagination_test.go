@@ -0,0 +1,169 @@
+package pagination
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		query   string
+		want    Request
+		wantErr bool
+	}{
+		{"", Request{Limit: 25}, false},
+		{"limit=5", Request{Limit: 5}, false},
+		{"limit=5000", Request{Limit: MaxLimit}, false},
+		{"limit=0", Request{}, true},
+		{"limit=-1", Request{}, true},
+		{"limit=ten", Request{}, true},
+		{"cursor=" + Encode("k-7"), Request{Limit: 25, After: "k-7"}, false},
+		{"cursor=k-7", Request{}, true},
+		{"cursor=" + "%21%21", Request{}, true},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items?"+tc.query, nil)
+		got, err := Parse(r, 25)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("Parse(%q) = %+v, %v", tc.query, got, err)
+		}
+	}
+}
+
+func TestWriteLinksNextPage(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/items?tenant_id=acme&limit=2", nil)
+	w := httptest.NewRecorder()
+	Write(w, r, []string{"a", "b"}, "b")
+
+	var page Page[string]
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(page.Items) != 2 || page.NextCursor != Encode("b") {
+		t.Fatalf("unexpected page %+v", page)
+	}
+	link := w.Header().Get("Link")
+	if !strings.HasPrefix(link, "</items?") || !strings.HasSuffix(link, `>; rel="next"`) ||
+		!strings.Contains(link, "tenant_id=acme") || !strings.Contains(link, "cursor="+page.NextCursor) {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+}
+
+func TestWriteLastPage(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	w := httptest.NewRecorder()
+	Write[string](w, r, nil, "")
+
+	if body := strings.TrimSpace(w.Body.String()); body != `{"items":[]}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+	if link := w.Header().Get("Link"); link != "" {
+		t.Fatalf("expected no Link header, got %q", link)
+	}
+}
+
+func TestRequested(t *testing.T) {
+	cases := []struct {
+		query  string
+		params []string
+		want   bool
+	}{
+		{"", nil, false},
+		{"tenant_id=acme", nil, false},
+		{"limit=5", nil, true},
+		{"cursor=", nil, true},
+		{"limit=5", []string{"cursor"}, false},
+		{"limit=5&cursor=", []string{"cursor"}, true},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/items?"+tc.query, nil)
+		if got := Requested(r, tc.params...); got != tc.want {
+			t.Errorf("Requested(%q, %v) = %v, want %v", tc.query, tc.params, got, tc.want)
+		}
+	}
+}
+
+func TestWriteListKeepsBareArrays(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	w := httptest.NewRecorder()
+	WriteList(w, r, []string{"a", "b"}, "b", false)
+
+	if body := strings.TrimSpace(w.Body.String()); body != `["a","b"]` {
+		t.Fatalf("unexpected body %s", body)
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, "cursor="+Encode("b")) {
+		t.Fatalf("unexpected Link header %q", link)
+	}
+
+	w = httptest.NewRecorder()
+	WriteList[string](w, r, nil, "", false)
+	if body := strings.TrimSpace(w.Body.String()); body != `[]` {
+		t.Fatalf("unexpected body %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	WriteList(w, r, []string{"a"}, "", true)
+	if body := strings.TrimSpace(w.Body.String()); body != `{"items":["a"]}` {
+		t.Fatalf("unexpected body %s", body)
+	}
+}
+
+func TestSlice(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	key := func(s string) string { return s }
+
+	var got []string
+	req := Request{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > len(items) {
+			t.Fatal("paging did not terminate")
+		}
+		page, next := Slice(items, key, req)
+		got = append(got, page...)
+		if next == "" {
+			break
+		}
+		req.After = next
+	}
+	if strings.Join(got, "") != "abcde" {
+		t.Fatalf("expected every item once, got %v", got)
+	}
+
+	// A cursor whose item was removed resumes at the following one.
+	page, next := Slice([]string{"a", "c", "d"}, key, Request{Limit: 5, After: "b"})
+	if strings.Join(page, "") != "cd" || next != "" {
+		t.Fatalf("unexpected page %v next %q", page, next)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	positions := []string{"01", "02", "03", "04"}
+	collect := func(req Request) ([]string, string) {
+		c := NewCollector[string](req)
+		for _, position := range positions {
+			if c.Skip(position) {
+				continue
+			}
+			if !c.Add(position, "item-"+position) {
+				break
+			}
+		}
+		return c.Page()
+	}
+
+	items, next := collect(Request{Limit: 3})
+	if len(items) != 3 || next != "03" {
+		t.Fatalf("unexpected first page %v next %q", items, next)
+	}
+	items, next = collect(Request{Limit: 3, After: next})
+	if len(items) != 1 || items[0] != "item-04" || next != "" {
+		t.Fatalf("unexpected last page %v next %q", items, next)
+	}
+	// A page that is exactly full has no next page.
+	if items, next := collect(Request{Limit: 4}); len(items) != 4 || next != "" {
+		t.Fatalf("unexpected exact page %v next %q", items, next)
+	}
+}
@@ -0,0 +1,277 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the presence API.
+const (
+	codeInvalidJSON      = "presence.invalid_json"
+	codeInvalidRequest   = "presence.invalid_request"
+	codeNotFound         = "presence.not_found"
+	codeUnavailable      = "presence.store_unavailable"
+	codeForbidden        = "presence.forbidden_tenant"
+	codeForbiddenProject = "presence.forbidden_project"
+)
+
+const (
+	presenceBasePath = "/presence"
+	presencePrefix   = "/presence/"
+)
+
+// pathKinds maps the collection segment of a record's path to its kind.
+var pathKinds = map[string]Kind{"players": KindPlayer, "servers": KindServer}
+
+// Handler returns an HTTP handler for the presence endpoints:
+//
+//	GET    /presence                          list records
+//	POST   /presence/query                    read many records of a kind
+//	GET    /presence/stream                   stream changes as server-sent events
+//	GET    /presence/{players|servers}/{id}   read a record
+//	DELETE /presence/{players|servers}/{id}   disconnect
+//	POST   /presence/{players|servers}/{id}/heartbeat
+//
+// Every route takes tenant_id and project_id query parameters. Heartbeats
+// and disconnects require auth.PermPresenceWrite and the rest
+// auth.PermPresenceRead.
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(presenceBasePath, s.handleList)
+	mux.HandleFunc(presencePrefix, s.handleRoute)
+	return mux
+}
+
+// heartbeatPayload omits the kind, ID, and scope, which come from the path
+// and query.
+type heartbeatPayload struct {
+	SessionID  string            `json:"session_id"`
+	TTLSeconds int64             `json:"ttl_seconds"`
+	Metadata   map[string]string `json:"metadata"`
+}
+
+type queryPayload struct {
+	Kind Kind     `json:"kind"`
+	IDs  []string `json:"ids"`
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r)
+	if !ok || !auth.Allow(w, r, auth.PermPresenceRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	items, next, err := s.List(r.Context(), scope, Kind(r.URL.Query().Get("kind")), page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+func (s *Service) handleRoute(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, presencePrefix), "/")
+	scope, ok := resolveScope(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case len(segments) == 1 && segments[0] == "query":
+		s.handleQuery(w, r, scope)
+	case len(segments) == 1 && segments[0] == "stream":
+		s.handleStream(w, r, scope)
+	case len(segments) < 2 || len(segments) > 3 || segments[1] == "" || pathKinds[segments[0]] == "":
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	case len(segments) == 2:
+		s.handleRecord(w, r, scope, pathKinds[segments[0]], segments[1])
+	case segments[2] == "heartbeat":
+		s.handleHeartbeat(w, r, scope, pathKinds[segments[0]], segments[1])
+	default:
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	}
+}
+
+func (s *Service) handleRecord(w http.ResponseWriter, r *http.Request, scope Scope, kind Kind, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermPresenceRead, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		p, err := s.Get(r.Context(), scope, kind, id)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermPresenceWrite, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		p, err := s.Disconnect(r.Context(), scope, kind, id)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodDelete)
+	}
+}
+
+func (s *Service) handleHeartbeat(w http.ResponseWriter, r *http.Request, scope Scope, kind Kind, id string) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermPresenceWrite, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	defer r.Body.Close()
+	var payload heartbeatPayload
+	// An empty body is a heartbeat with the defaults.
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	p, err := s.Heartbeat(r.Context(), HeartbeatRequest{
+		Kind:      kind,
+		ID:        id,
+		TenantID:  scope.TenantID,
+		ProjectID: scope.ProjectID,
+		SessionID: payload.SessionID,
+		TTL:       time.Duration(payload.TTLSeconds) * time.Second,
+		Metadata:  payload.Metadata,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *Service) handleQuery(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermPresenceRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	defer r.Body.Close()
+	var payload queryPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	items, err := s.Query(r.Context(), scope, payload.Kind, payload.IDs)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// handleStream sends the current state of the watched IDs as "presence"
+// events, then each change as a "change" event, until the client leaves.
+// A client that reconnects with the ID of the last change it saw receives
+// the changes it missed instead of the snapshot, when this replica still
+// has them. A client that falls too far behind is disconnected and should
+// reconnect.
+func (s *Service) handleStream(w http.ResponseWriter, r *http.Request, scope Scope) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermPresenceRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	query := r.URL.Query()
+	kind, ids := Kind(query.Get("kind")), query["id"]
+	sub, resumed, err := s.Watch(scope, kind, ids, sse.LastEventID(r))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	defer sub.Close()
+	// Watch first, so no change between the snapshot and the stream is
+	// lost; a change may then repeat the snapshot.
+	var snapshot []Presence
+	if len(ids) > 0 && !resumed {
+		if snapshot, err = s.Query(r.Context(), scope, kind, ids); err != nil {
+			httpError(w, r, err)
+			return
+		}
+	}
+	stream, ok := sse.Open(w, r, "presence")
+	if !ok {
+		return
+	}
+	for _, p := range snapshot {
+		if stream.Send("", "presence", p) != nil {
+			return
+		}
+	}
+	_ = sse.Relay(r.Context(), stream, sub, "change", s.cfg.KeepAlive, nil)
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// requested scope, writing 403 when they contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request) (Scope, bool) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), tenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+tenantID)
+		return Scope{}, false
+	}
+	projectID := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), projectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+projectID)
+		return Scope{}, false
+	}
+	return Scope{TenantID: tenant, ProjectID: project}, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, ErrStore):
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
+
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "presence", methods...)
+}
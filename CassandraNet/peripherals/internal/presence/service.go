@@ -0,0 +1,411 @@
+// Package presence tracks whether players and game servers are online.
+// Clients send heartbeats that keep their record online for a TTL; a record
+// whose heartbeats stop goes offline when the TTL lapses, and owners may
+// disconnect explicitly. Every change is announced on the event bus as an
+// eventbus.PresenceChanged, which the bridge forwards to the messaging
+// service, and streamed to watchers over server-sent events.
+package presence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrNotFound indicates no record of the kind and ID exists in the
+	// scope.
+	ErrNotFound = errors.New("presence: not found")
+	// ErrStore wraps failures of the underlying storage driver.
+	ErrStore = errors.New("presence: store unavailable")
+
+	// errUnchanged means an update found nothing to do, such as a record
+	// another replica already expired.
+	errUnchanged = errors.New("presence: unchanged")
+)
+
+// maxQueryIDs bounds the IDs of one bulk query or stream.
+const maxQueryIDs = 100
+
+// Store abstracts persistence for presence records.
+type Store interface {
+	Get(ctx context.Context, scope Scope, kind Kind, id string) (Presence, error)
+	// GetMany returns the records with the given IDs, keyed by ID, leaving
+	// out IDs without one.
+	GetMany(ctx context.Context, scope Scope, kind Kind, ids []string) (map[string]Presence, error)
+	// Update applies fn to a record, or to an empty one with found false,
+	// and stores the result atomically with its version incremented. fn
+	// may run more than once and must not have side effects; an error
+	// from it stores nothing.
+	Update(ctx context.Context, scope Scope, kind Kind, id string, fn func(p *Presence, found bool) error) (Presence, error)
+	// List returns one page of the scope's records of kind, or of every
+	// kind when kind is empty, and the position of the next page.
+	List(ctx context.Context, scope Scope, kind Kind, page pagination.Request) ([]Presence, string, error)
+	// Expired returns every online record, in any scope, whose TTL lapsed
+	// at or before now.
+	Expired(ctx context.Context, now time.Time) ([]Presence, error)
+}
+
+// Config tunes a Service. Zero values select the defaults.
+type Config struct {
+	// DefaultTTL keeps a record online after a heartbeat that names no
+	// TTL (default 30s).
+	DefaultTTL time.Duration
+	// MaxTTL is the longest TTL a heartbeat may ask for (default 10m).
+	MaxTTL time.Duration
+	// SweepInterval between checks for lapsed records (default 5s).
+	// Records go offline up to one interval after their TTL; reads report
+	// them offline as soon as it lapses.
+	SweepInterval time.Duration
+	// KeepAlive is how often an idle stream sends a comment so proxies
+	// keep it open (default 15s).
+	KeepAlive time.Duration
+}
+
+// Service tracks presence records and announces their changes. Replicas
+// sharing a store each sweep it, and each lapsed record is expired by
+// exactly one of them. Watchers see the changes made by the replica they
+// are connected to; consumers that need every change read the events from
+// the messaging service instead.
+type Service struct {
+	store  Store
+	cfg    Config
+	clock  clock.Clock
+	events eventbus.Publisher
+	logger interface {
+		Printf(string, ...any)
+	}
+	changes *sse.Hub[Change]
+}
+
+// NewService builds a Service. clk and logger may be nil.
+func NewService(store Store, cfg Config, clk clock.Clock, logger interface {
+	Printf(string, ...any)
+}) *Service {
+	if cfg.DefaultTTL <= 0 {
+		cfg.DefaultTTL = 30 * time.Second
+	}
+	if cfg.MaxTTL <= 0 {
+		cfg.MaxTTL = 10 * time.Minute
+	}
+	cfg.MaxTTL = max(cfg.MaxTTL, cfg.DefaultTTL)
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = 5 * time.Second
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = sse.DefaultKeepAlive
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	return &Service{store: store, cfg: cfg, clock: clock.Or(clk), logger: logger, changes: sse.NewHub[Change](sse.Config{})}
+}
+
+// SetEvents publishes an eventbus.PresenceChanged to p for every change.
+// Call it before the service handles requests.
+func (s *Service) SetEvents(p eventbus.Publisher) {
+	s.events = p
+}
+
+// Heartbeat marks a player or game server online until its TTL lapses. A
+// record that was offline, or a heartbeat naming a different session,
+// starts a new session and is announced as a change.
+func (s *Service) Heartbeat(ctx context.Context, req HeartbeatRequest) (Presence, error) {
+	if err := s.validateHeartbeat(req); err != nil {
+		return Presence{}, err
+	}
+	ttl := req.TTL
+	if ttl == 0 {
+		ttl = s.cfg.DefaultTTL
+	}
+	scope := Scope{TenantID: req.TenantID, ProjectID: req.ProjectID}
+	now := s.clock.Now()
+	var change *Change
+	p, err := s.store.Update(ctx, scope, req.Kind, req.ID, func(p *Presence, _ bool) error {
+		change = nil
+		online := p.Status == StatusOnline && !p.lapsed(now)
+		if !online || (req.SessionID != "" && req.SessionID != p.SessionID) {
+			previous := StatusOffline
+			if online {
+				previous = StatusOnline
+			}
+			change = &Change{Previous: previous, Reason: ReasonHeartbeat}
+			p.SessionID = req.SessionID
+			if p.SessionID == "" {
+				p.SessionID = id.New(id.PrefixSession)
+			}
+			p.OnlineSince = now
+		}
+		p.Status = StatusOnline
+		p.LastSeen = now
+		p.ExpiresAt = now.Add(ttl)
+		if req.Metadata != nil {
+			p.Metadata = req.Metadata
+		}
+		return nil
+	})
+	if err != nil {
+		return Presence{}, err
+	}
+	if change != nil {
+		change.Presence = p
+		s.notify(ctx, *change)
+	}
+	return p, nil
+}
+
+// Disconnect marks the scope's record of kind with id offline now, ending
+// its session. Disconnecting a record that is already offline changes
+// nothing.
+func (s *Service) Disconnect(ctx context.Context, scope Scope, kind Kind, id string) (Presence, error) {
+	if err := validateRecord(scope, kind, id); err != nil {
+		return Presence{}, err
+	}
+	now := s.clock.Now()
+	var change Change
+	p, err := s.store.Update(ctx, scope, kind, id, func(p *Presence, found bool) error {
+		switch {
+		case !found:
+			return ErrNotFound
+		case p.Status != StatusOnline:
+			return errUnchanged
+		case p.lapsed(now):
+			change = Change{Previous: StatusOnline, Reason: ReasonExpired}
+		default:
+			change = Change{Previous: StatusOnline, Reason: ReasonDisconnect}
+			p.LastSeen = now
+		}
+		p.Status = StatusOffline
+		p.ExpiresAt = time.Time{}
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return s.store.Get(ctx, scope, kind, id)
+	}
+	if err != nil {
+		return Presence{}, err
+	}
+	change.Presence = p
+	s.notify(ctx, change)
+	return p, nil
+}
+
+// Get returns the scope's record of kind with id. A record whose TTL
+// lapsed is reported offline even before the sweep stores it so.
+func (s *Service) Get(ctx context.Context, scope Scope, kind Kind, id string) (Presence, error) {
+	if err := validateRecord(scope, kind, id); err != nil {
+		return Presence{}, err
+	}
+	p, err := s.store.Get(ctx, scope, kind, id)
+	if err != nil {
+		return Presence{}, err
+	}
+	return p.at(s.clock.Now()), nil
+}
+
+// Query returns the presence of every ID of kind, in the order given.
+// IDs never seen are reported offline with version 0, so a friends list
+// can be shown in one call.
+func (s *Service) Query(ctx context.Context, scope Scope, kind Kind, ids []string) ([]Presence, error) {
+	if err := validateQuery(scope, kind, ids, true); err != nil {
+		return nil, err
+	}
+	found, err := s.store.GetMany(ctx, scope, kind, ids)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	out := make([]Presence, 0, len(ids))
+	for _, id := range ids {
+		p, ok := found[id]
+		if !ok {
+			p = Presence{Kind: kind, ID: id, TenantID: scope.TenantID, ProjectID: scope.ProjectID, Status: StatusOffline}
+		}
+		out = append(out, p.at(now))
+	}
+	return out, nil
+}
+
+// List lists one page of the scope's records of kind, or of every kind
+// when kind is empty, and the position of the next page.
+func (s *Service) List(ctx context.Context, scope Scope, kind Kind, page pagination.Request) ([]Presence, string, error) {
+	if err := validateQuery(scope, kind, nil, false); err != nil {
+		return nil, "", err
+	}
+	items, next, err := s.store.List(ctx, scope, kind, page)
+	if err != nil {
+		return nil, "", err
+	}
+	now := s.clock.Now()
+	for i := range items {
+		items[i] = items[i].at(now)
+	}
+	return items, next, nil
+}
+
+// Run expires lapsed records every sweep interval until ctx is cancelled.
+// Failures are logged and retried on the next sweep.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := s.clock.NewTicker(s.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Sweep(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Printf("expire lapsed presence failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Sweep takes every record whose TTL lapsed offline and announces it.
+func (s *Service) Sweep(ctx context.Context) error {
+	now := s.clock.Now()
+	expired, err := s.store.Expired(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, lapsed := range expired {
+		scope := Scope{TenantID: lapsed.TenantID, ProjectID: lapsed.ProjectID}
+		p, err := s.store.Update(ctx, scope, lapsed.Kind, lapsed.ID, func(p *Presence, found bool) error {
+			if !found {
+				return ErrNotFound
+			}
+			if !p.lapsed(now) {
+				return errUnchanged
+			}
+			p.Status = StatusOffline
+			p.ExpiresAt = time.Time{}
+			return nil
+		})
+		switch {
+		case errors.Is(err, ErrNotFound) || errors.Is(err, errUnchanged):
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil
+			}
+			s.logger.Printf("expire %s %s: %v", lapsed.Kind, lapsed.ID, err)
+		default:
+			s.notify(ctx, Change{Presence: p, Previous: StatusOnline, Reason: ReasonExpired})
+		}
+	}
+	return nil
+}
+
+// notify publishes change on the event bus and hands it to the watchers.
+func (s *Service) notify(ctx context.Context, change Change) {
+	p := change.Presence
+	if s.events != nil {
+		s.events.Publish(ctx, eventbus.PresenceChanged{
+			Kind:      string(p.Kind),
+			ID:        p.ID,
+			TenantID:  p.TenantID,
+			ProjectID: p.ProjectID,
+			Status:    string(p.Status),
+			Previous:  string(change.Previous),
+			SessionID: p.SessionID,
+			Reason:    string(change.Reason),
+			ChangedAt: s.clock.Now(),
+		})
+	}
+	s.changes.Publish(change)
+}
+
+// Watch subscribes to the changes this replica makes to the scope's
+// records of kind with the given IDs; an empty kind or no IDs match all.
+// When lastEventID names a change still in the replica's history, the
+// matching changes since are delivered first and resumed is true. The
+// caller closes the subscription.
+func (s *Service) Watch(scope Scope, kind Kind, ids []string, lastEventID string) (sub *sse.Subscription[Change], resumed bool, err error) {
+	if err := validateQuery(scope, kind, ids, false); err != nil {
+		return nil, false, err
+	}
+	var watched map[string]bool
+	if len(ids) > 0 {
+		watched = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			watched[id] = true
+		}
+	}
+	sub, resumed = s.changes.Subscribe(func(change Change) bool {
+		p := change.Presence
+		return p.TenantID == scope.TenantID && p.ProjectID == scope.ProjectID &&
+			(kind == "" || p.Kind == kind) &&
+			(len(watched) == 0 || watched[p.ID])
+	}, lastEventID)
+	return sub, resumed, nil
+}
+
+// lapsed reports whether an online record's TTL ran out by now.
+func (p Presence) lapsed(now time.Time) bool {
+	return p.Status == StatusOnline && !p.ExpiresAt.After(now)
+}
+
+// at returns the record as it stands at now, offline once its TTL lapsed.
+func (p Presence) at(now time.Time) Presence {
+	if p.lapsed(now) {
+		p.Status = StatusOffline
+		p.ExpiresAt = time.Time{}
+	}
+	return p
+}
+
+func (s *Service) validateHeartbeat(req HeartbeatRequest) error {
+	var v validation.Validator
+	validateKind(&v, req.Kind, true)
+	v.ID("id", req.ID)
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", req.ProjectID)
+	v.String("session_id", req.SessionID).MaxLength(validation.MaxIDLength)
+	v.Check(req.TTL >= 0 && req.TTL <= s.cfg.MaxTTL, "ttl_seconds", validation.RuleRange, fmt.Sprintf("must not be negative or above %d", int(s.cfg.MaxTTL/time.Second)))
+	v.Map("metadata", req.Metadata).Limited()
+	return v.Err()
+}
+
+// validateRecord checks a scope, kind, and ID naming one record.
+func validateRecord(scope Scope, kind Kind, id string) error {
+	var v validation.Validator
+	validateScope(&v, scope)
+	validateKind(&v, kind, true)
+	v.ID("id", id)
+	return v.Err()
+}
+
+// validateQuery checks a scope, a kind, which IDs require, and at most
+// maxQueryIDs IDs.
+func validateQuery(scope Scope, kind Kind, ids []string, idsRequired bool) error {
+	var v validation.Validator
+	validateScope(&v, scope)
+	validateKind(&v, kind, len(ids) > 0 || idsRequired)
+	v.Check(!idsRequired || len(ids) > 0, "ids", validation.RuleRequired, "is required")
+	v.Check(len(ids) <= maxQueryIDs, "ids", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxQueryIDs))
+	for i, id := range ids {
+		v.ID(fmt.Sprintf("ids[%d]", i), id)
+	}
+	return v.Err()
+}
+
+func validateScope(v *validation.Validator, scope Scope) {
+	v.String("tenant_id", scope.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", scope.ProjectID)
+}
+
+func validateKind(v *validation.Validator, kind Kind, required bool) {
+	rules := v.String("kind", string(kind))
+	if required {
+		rules.Required()
+	}
+	rules.OneOf(string(KindPlayer), string(KindServer))
+}
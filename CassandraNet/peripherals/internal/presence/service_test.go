@@ -0,0 +1,219 @@
+package presence
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+type recordedEvents struct {
+	mu     sync.Mutex
+	events []eventbus.PresenceChanged
+}
+
+func (r *recordedEvents) Publish(_ context.Context, event eventbus.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event.(eventbus.PresenceChanged))
+}
+
+func (r *recordedEvents) reasons() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0, len(r.events))
+	for _, e := range r.events {
+		out = append(out, e.ID+":"+e.Previous+">"+e.Status+":"+e.Reason)
+	}
+	return out
+}
+
+func TestHeartbeatsExpiryAndDisconnect(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	svc := NewService(NewMemoryStore(), Config{DefaultTTL: 30 * time.Second}, fake, nil)
+	events := &recordedEvents{}
+	svc.SetEvents(events)
+	ctx := context.Background()
+	scope := Scope{TenantID: "acme", ProjectID: "p1"}
+	beat := func(id, session string, ttl time.Duration) Presence {
+		t.Helper()
+		p, err := svc.Heartbeat(ctx, HeartbeatRequest{Kind: KindPlayer, ID: id, TenantID: "acme", ProjectID: "p1", SessionID: session, TTL: ttl})
+		if err != nil {
+			t.Fatalf("heartbeat %s: %v", id, err)
+		}
+		return p
+	}
+
+	first := beat("alice", "", 0)
+	if first.Status != StatusOnline || first.SessionID == "" || !first.ExpiresAt.Equal(fake.Now().Add(30*time.Second)) {
+		t.Fatalf("unexpected first heartbeat: %+v", first)
+	}
+	fake.Advance(20 * time.Second)
+	if again := beat("alice", "", 0); again.SessionID != first.SessionID || !again.OnlineSince.Equal(first.OnlineSince) {
+		t.Fatalf("a heartbeat within the TTL should keep the session: %+v", again)
+	}
+	beat("alice", "match-2", 0)
+	beat("bob", "", time.Minute)
+
+	// alice lapses; reads report her offline before the sweep stores it.
+	fake.Advance(31 * time.Second)
+	if p, _ := svc.Get(ctx, scope, KindPlayer, "alice"); p.Status != StatusOffline {
+		t.Fatalf("expected a lapsed record to read offline, got %+v", p)
+	}
+	if err := svc.Sweep(ctx); err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if err := svc.Sweep(ctx); err != nil {
+		t.Fatalf("second sweep: %v", err)
+	}
+	if p, err := svc.Disconnect(ctx, scope, KindPlayer, "bob"); err != nil || p.Status != StatusOffline {
+		t.Fatalf("disconnect: %+v %v", p, err)
+	}
+	if _, err := svc.Disconnect(ctx, scope, KindPlayer, "carol"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	want := []string{
+		"alice:offline>online:heartbeat",
+		"alice:online>online:heartbeat",
+		"bob:offline>online:heartbeat",
+		"alice:online>offline:expired",
+		"bob:online>offline:disconnect",
+	}
+	if got := events.reasons(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+
+	items, err := svc.Query(ctx, scope, KindPlayer, []string{"bob", "dave", "alice"})
+	if err != nil || len(items) != 3 {
+		t.Fatalf("query: %+v %v", items, err)
+	}
+	if items[0].ID != "bob" || items[1].ID != "dave" || items[1].Status != StatusOffline || items[1].Version != 0 || items[2].SessionID != "match-2" {
+		t.Fatalf("unexpected query result: %+v", items)
+	}
+	if _, err := svc.Heartbeat(ctx, HeartbeatRequest{Kind: "npc", ID: "x", ProjectID: "p1", TTL: time.Hour}); err == nil {
+		t.Fatal("expected an invalid kind and TTL to be rejected")
+	}
+	if list, _, err := svc.List(ctx, Scope{ProjectID: "p1"}, "", pagination.Request{Limit: 10}); err != nil || len(list) != 0 {
+		t.Fatalf("expected the project-wide scope to hold no records, got %+v %v", list, err)
+	}
+}
+
+func TestPresenceAPIAndStream(t *testing.T) {
+	svc := NewService(NewMemoryStore(), Config{}, nil, nil)
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	post := func(path, body string) *http.Response {
+		t.Helper()
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	resp := post("/presence/servers/eu-1/heartbeat?project_id=p1", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("heartbeat: %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/presence/stream?project_id=p1&kind=server&id=eu-1&id=us-1", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer stream.Body.Close()
+	if ct := stream.Header.Get("Content-Type"); stream.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("stream: %d %s", stream.StatusCode, ct)
+	}
+	events := make(chan string, 8)
+	go func() {
+		scanner := bufio.NewScanner(stream.Body)
+		var event string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				events <- event + " " + strings.TrimPrefix(line, "data: ")
+			}
+		}
+		close(events)
+	}()
+	next := func() (string, map[string]any) {
+		t.Helper()
+		select {
+		case line, ok := <-events:
+			if !ok {
+				t.Fatal("stream ended")
+			}
+			name, data, _ := strings.Cut(line, " ")
+			var body map[string]any
+			_ = json.Unmarshal([]byte(data), &body)
+			return name, body
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for an event")
+		}
+		return "", nil
+	}
+	if name, body := next(); name != "presence" || body["id"] != "eu-1" || body["status"] != "online" {
+		t.Fatalf("expected eu-1 online in the snapshot, got %s %v", name, body)
+	}
+	if name, body := next(); name != "presence" || body["id"] != "us-1" || body["status"] != "offline" {
+		t.Fatalf("expected us-1 offline in the snapshot, got %s %v", name, body)
+	}
+
+	// Changes to other records are not streamed.
+	post("/presence/players/alice/heartbeat?project_id=p1", "")
+	post("/presence/servers/us-1/heartbeat?project_id=p1", `{"ttl_seconds":60,"metadata":{"region":"us"}}`)
+	name, body := next()
+	presence, _ := body["presence"].(map[string]any)
+	if name != "change" || presence["id"] != "us-1" || body["previous_status"] != "offline" || body["reason"] != "heartbeat" {
+		t.Fatalf("expected us-1 to come online, got %s %v", name, body)
+	}
+	del, _ := http.NewRequest(http.MethodDelete, server.URL+"/presence/servers/eu-1?project_id=p1", nil)
+	if resp, err := http.DefaultClient.Do(del); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("disconnect: %v %v", resp, err)
+	}
+	if name, body := next(); name != "change" || body["reason"] != "disconnect" {
+		t.Fatalf("expected eu-1 to disconnect, got %s %v", name, body)
+	}
+
+	resp = post("/presence/query?project_id=p1", `{"kind":"player","ids":["alice","bob"]}`)
+	var page struct {
+		Items []Presence `json:"items"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&page) != nil || len(page.Items) != 2 || page.Items[0].Status != StatusOnline || page.Items[1].Status != StatusOffline {
+		t.Fatalf("query: %d %+v", resp.StatusCode, page.Items)
+	}
+	for path, status := range map[string]int{
+		"/presence/query?project_id=p1":                  http.StatusBadRequest,
+		"/presence/players/alice/heartbeat":              http.StatusBadRequest,
+		"/presence/npcs/x/heartbeat?project_id=p1":       http.StatusNotFound,
+		"/presence/players/alice/ping?project_id=p1":     http.StatusNotFound,
+		"/presence/players/alice/heartbeat?project_id=p": http.StatusOK,
+	} {
+		body := `{"ids":["alice"]}`
+		if strings.Contains(path, "heartbeat") {
+			body = `{"ttl_seconds":-1}`
+			if status == http.StatusOK {
+				body = ""
+			}
+		}
+		if resp := post(path, body); resp.StatusCode != status {
+			t.Errorf("POST %s: expected %d, got %d", path, status, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// presenceBucket holds presence records as JSON, keyed by
+// "{project}/{tenant}/{kind}/{id}" with each part path-escaped and the
+// tenant empty for project-wide records.
+const presenceBucket = "presence.records"
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db storage.Driver
+}
+
+// NewStorageStore returns a store keeping presence records in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// Get returns the scope's record of kind with id.
+func (s *StorageStore) Get(ctx context.Context, scope Scope, kind Kind, id string) (Presence, error) {
+	var p Presence
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		p, err = getPresence(tx, scope, kind, id)
+		return err
+	})
+	return p, storeError(err)
+}
+
+// GetMany returns the scope's records of kind with the given IDs, read in
+// one transaction. IDs without a record are left out.
+func (s *StorageStore) GetMany(ctx context.Context, scope Scope, kind Kind, ids []string) (map[string]Presence, error) {
+	var found map[string]Presence
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		found = make(map[string]Presence, len(ids))
+		for _, id := range ids {
+			p, err := getPresence(tx, scope, kind, id)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			found[id] = p
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return found, nil
+}
+
+// Update applies fn to the scope's record of kind with id, or to an empty
+// record when none exists, and stores the result with its version
+// incremented, in one transaction. An error from fn leaves the record
+// unchanged.
+func (s *StorageStore) Update(ctx context.Context, scope Scope, kind Kind, id string, fn func(p *Presence, found bool) error) (Presence, error) {
+	var p Presence
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		found := true
+		p, err = getPresence(tx, scope, kind, id)
+		if errors.Is(err, ErrNotFound) {
+			found = false
+			p = Presence{Kind: kind, ID: id, TenantID: scope.TenantID, ProjectID: scope.ProjectID}
+		} else if err != nil {
+			return err
+		}
+		if err := fn(&p, found); err != nil {
+			return err
+		}
+		p.Version++
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		return tx.Put(presenceBucket, presenceKey(scope, kind, id), data)
+	})
+	if err != nil {
+		return Presence{}, storeError(err)
+	}
+	return p, nil
+}
+
+// List returns one page of the scope's records of kind, or of every kind
+// when kind is empty, ordered by kind and ID.
+func (s *StorageStore) List(ctx context.Context, scope Scope, kind Kind, page pagination.Request) ([]Presence, string, error) {
+	prefix := scopePrefix(scope)
+	if kind != "" {
+		prefix = kindPrefix(scope, kind)
+	}
+	collector := pagination.NewCollector[Presence](page)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(presenceBucket, prefix, func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			var p Presence
+			if err := json.Unmarshal(value, &p); err != nil {
+				return err
+			}
+			if !collector.Add(key, p) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	items, next := collector.Page()
+	return items, next, nil
+}
+
+// Expired returns every online record, in any scope, whose heartbeats
+// lapsed at or before now.
+func (s *StorageStore) Expired(ctx context.Context, now time.Time) ([]Presence, error) {
+	var expired []Presence
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		expired = nil
+		return tx.Scan(presenceBucket, "", func(_ string, value []byte) error {
+			var p Presence
+			if err := json.Unmarshal(value, &p); err != nil {
+				return err
+			}
+			if p.lapsed(now) {
+				expired = append(expired, p)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return expired, nil
+}
+
+func scopePrefix(scope Scope) string {
+	return url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(scope.TenantID) + "/"
+}
+
+func kindPrefix(scope Scope, kind Kind) string {
+	return scopePrefix(scope) + url.PathEscape(string(kind)) + "/"
+}
+
+func presenceKey(scope Scope, kind Kind, id string) string {
+	return kindPrefix(scope, kind) + url.PathEscape(id)
+}
+
+func getPresence(tx storage.Tx, scope Scope, kind Kind, id string) (Presence, error) {
+	data, err := tx.Get(presenceBucket, presenceKey(scope, kind, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Presence{}, ErrNotFound
+	}
+	if err != nil {
+		return Presence{}, err
+	}
+	var p Presence
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests and the service's own outcomes.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, errUnchanged) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
@@ -0,0 +1,85 @@
+package presence
+
+import "time"
+
+// Kind names what a presence record tracks.
+type Kind string
+
+const (
+	// KindPlayer tracks a player's client.
+	KindPlayer Kind = "player"
+	// KindServer tracks a game server.
+	KindServer Kind = "server"
+)
+
+// Status is whether a player or server is online.
+type Status string
+
+const (
+	StatusOnline  Status = "online"
+	StatusOffline Status = "offline"
+)
+
+// Reason records why a presence changed.
+type Reason string
+
+const (
+	// ReasonHeartbeat marks a heartbeat that brought a record online or
+	// started a new session.
+	ReasonHeartbeat Reason = "heartbeat"
+	// ReasonDisconnect marks a record taken offline by its owner.
+	ReasonDisconnect Reason = "disconnect"
+	// ReasonExpired marks a record that missed its heartbeats.
+	ReasonExpired Reason = "expired"
+)
+
+// Presence is the last known state of a player or game server, owned by a
+// project or one tenant of it.
+type Presence struct {
+	Kind      Kind   `json:"kind"`
+	ID        string `json:"id"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	ProjectID string `json:"project_id"`
+	Status    Status `json:"status"`
+	// SessionID identifies the current, or last, online stretch. A
+	// heartbeat that comes online without one is given a new ID.
+	SessionID string            `json:"session_id,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// OnlineSince is when the session started.
+	OnlineSince time.Time `json:"online_since,omitzero"`
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+	// ExpiresAt is when an online record goes offline without another
+	// heartbeat, zero while offline.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+	Version   int64     `json:"version"`
+}
+
+// Change is one presence going online, starting a new session, or going
+// offline, as streamed to watchers.
+type Change struct {
+	Presence Presence `json:"presence"`
+	Previous Status   `json:"previous_status"`
+	Reason   Reason   `json:"reason"`
+}
+
+// HeartbeatRequest reports a player or game server as alive.
+type HeartbeatRequest struct {
+	Kind      Kind
+	ID        string
+	TenantID  string
+	ProjectID string
+	// SessionID, when set and different from the current session, starts
+	// a new one.
+	SessionID string
+	// TTL is how long the record stays online without another heartbeat;
+	// zero uses the service default.
+	TTL time.Duration
+	// Metadata, when non-nil, replaces the stored metadata.
+	Metadata map[string]string
+}
+
+// Scope names a project and optionally one tenant of it.
+type Scope struct {
+	TenantID  string
+	ProjectID string
+}
@@ -0,0 +1,100 @@
+// Package problem renders HTTP errors as RFC 7807 problem details
+// (application/problem+json) so every service reports failures in one shape.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// requestIDHeader matches logging.RequestIDHeader; the request ID middleware
+// sets it on the response before handlers run.
+const requestIDHeader = "X-Request-ID"
+
+// Problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier of the form "<service>.<reason>" (for example
+// "messaging.not_found") that clients can switch on; Detail is a
+// human-readable explanation that may change between releases.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// InvalidParams lists the request fields that failed validation.
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam is one request field that failed validation. Rule is a
+// stable identifier of the broken rule, such as "required" or
+// "max_length"; Reason completes a sentence starting with the field name.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+// Write responds with status and a problem identified by code. The
+// instance is the request path and the request ID, when the request ID
+// middleware assigned one, is echoed so clients can quote it.
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	write(w, r, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// WriteInvalid responds 400 with code and the fields that failed
+// validation.
+func WriteInvalid(w http.ResponseWriter, r *http.Request, code, detail string, params []InvalidParam) {
+	write(w, r, Problem{Status: http.StatusBadRequest, Code: code, Detail: detail, InvalidParams: params})
+}
+
+func write(w http.ResponseWriter, r *http.Request, p Problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.RequestID = w.Header().Get(requestIDHeader)
+	if r != nil {
+		p.Instance = r.URL.Path
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(p.Status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// MethodNotAllowed responds 405 with code "<service>.method_not_allowed"
+// and an Allow header listing methods.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request, service string, methods ...string) {
+	if len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+	}
+	Write(w, r, http.StatusMethodNotAllowed, service+".method_not_allowed", "method not allowed")
+}
+
+// NotFound responds 404 with code "<service>.not_found".
+func NotFound(w http.ResponseWriter, r *http.Request, service, detail string) {
+	Write(w, r, http.StatusNotFound, service+".not_found", detail)
+}
+
+// CodeBodyTooLarge is the code of 413 responses to bodies over the size the
+// route accepts.
+const CodeBodyTooLarge = "server.body_too_large"
+
+// DecodeFailed responds to a request body that could not be decoded: 413
+// with CodeBodyTooLarge when err is the *http.MaxBytesError of a capped
+// body, otherwise 400 with code and detail.
+func DecodeFailed(w http.ResponseWriter, r *http.Request, code, detail string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		Write(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, "request body exceeds "+strconv.FormatInt(tooLarge.Limit, 10)+" bytes")
+		return
+	}
+	Write(w, r, http.StatusBadRequest, code, detail)
+}
@@ -0,0 +1,73 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-42")
+	req := httptest.NewRequest(http.MethodGet, "/messages/abc", nil)
+	Write(rec, req, http.StatusNotFound, "messaging.not_found", "messaging: message not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Not Found",
+		Status:    http.StatusNotFound,
+		Code:      "messaging.not_found",
+		Detail:    "messaging: message not found",
+		Instance:  "/messages/abc",
+		RequestID: "req-42",
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Fatalf("unexpected problem:\n%+v\nwant:\n%+v", p, want)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	MethodNotAllowed(rec, httptest.NewRequest(http.MethodPatch, "/content", nil), "ugc", http.MethodGet, http.MethodPost)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "GET, POST" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Code != "ugc.method_not_allowed" {
+		t.Fatalf("unexpected code %q", p.Code)
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	rec := httptest.NewRecorder()
+	params := []InvalidParam{{Name: "filename", Rule: "required", Reason: "is required"}}
+	WriteInvalid(rec, httptest.NewRequest(http.MethodPost, "/content", nil), "ugc.invalid_request", "filename is required", params)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if p.Code != "ugc.invalid_request" || !reflect.DeepEqual(p.InvalidParams, params) {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+}
@@ -0,0 +1,339 @@
+// Package ratelimit limits request rates per caller with token buckets. A
+// Limiter picks the limit for each request from per-route rules, keys the
+// bucket by subject, tenant, or client IP, and keeps the buckets in a Store:
+// in memory for a single replica, or in Redis to share limits between
+// replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Limit is a token bucket refilling at Rate tokens per second up to Burst.
+// A zero Rate means unlimited.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited reports whether l lets every request through.
+func (l Limit) Unlimited() bool { return l.Rate <= 0 }
+
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(l.Rate, 'g', -1, 64) + "/s burst " + strconv.Itoa(l.Burst)
+}
+
+// Result is the outcome of taking a token.
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left after this request.
+	Remaining int
+	// RetryAfter is how long until a token is available when the request
+	// was refused.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps token buckets. Take consumes one token from the bucket for
+// key, creating it full when it does not exist.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Rule applies Limit to requests whose path starts with Prefix and, when
+// Method is set, whose method matches.
+type Rule struct {
+	Method string
+	Prefix string
+	Limit  Limit
+}
+
+// ParseRule parses "[METHOD ]/prefix=rate[:burst]", for example
+// "POST /topics/=5:10". A missing burst defaults to the rate rounded up, and
+// a rate of 0 exempts the route.
+func ParseRule(spec string) (Rule, error) {
+	target, limit, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Rule{}, fmt.Errorf("rate limit rule %q: expected [METHOD ]/prefix=rate[:burst]", spec)
+	}
+	var rule Rule
+	target = strings.TrimSpace(target)
+	if method, prefix, ok := strings.Cut(target, " "); ok {
+		rule.Method, target = strings.ToUpper(method), strings.TrimSpace(prefix)
+	}
+	if !strings.HasPrefix(target, "/") {
+		return Rule{}, fmt.Errorf("rate limit rule %q: path must start with /", spec)
+	}
+	rule.Prefix = target
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(limit), ":")
+	var err error
+	if rule.Limit.Rate, err = strconv.ParseFloat(rate, 64); err != nil || rule.Limit.Rate < 0 || math.IsInf(rule.Limit.Rate, 0) {
+		return Rule{}, fmt.Errorf("rate limit rule %q: invalid rate %q", spec, rate)
+	}
+	rule.Limit.Burst = defaultBurst(rule.Limit.Rate)
+	if hasBurst {
+		if rule.Limit.Burst, err = strconv.Atoi(burst); err != nil || rule.Limit.Burst < 1 {
+			return Rule{}, fmt.Errorf("rate limit rule %q: invalid burst %q", spec, burst)
+		}
+	}
+	return rule, nil
+}
+
+func defaultBurst(rate float64) int {
+	return max(1, int(math.Ceil(rate)))
+}
+
+// Key selects what a bucket is shared by.
+type Key string
+
+const (
+	// KeySubject keys authenticated callers by subject (an API key label,
+	// token subject, or client certificate identity) and anonymous ones by
+	// client IP.
+	KeySubject Key = "subject"
+	// KeyTenant keys callers by tenant, falling back to KeySubject for
+	// callers that name none.
+	KeyTenant Key = "tenant"
+	// KeyIP keys every caller by client IP.
+	KeyIP Key = "ip"
+)
+
+// Config configures a Limiter.
+type Config struct {
+	// Default applies to requests no rule matches.
+	Default Limit
+	// Rules override Default for matching routes. The longest matching
+	// prefix wins, and a rule naming the method beats one that does not.
+	Rules []Rule
+	// Key selects the bucket key; empty means KeySubject.
+	Key Key
+	// Store keeps the buckets; nil means a new MemoryStore.
+	Store Store
+	// Code is the problem code of 429 responses; empty means
+	// "server.rate_limited".
+	Code string
+}
+
+// FromConfig reads RATE_LIMIT (requests per second, 0 disables),
+// RATE_BURST (default: the rate rounded up), RATE_LIMIT_ROUTES,
+// RATE_LIMIT_KEY, and RATE_LIMIT_REDIS_URL from loader. Malformed rules,
+// keys, or URLs are reported rather than ignored.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg, err := limitsFromConfig(loader)
+	if err != nil {
+		return Config{}, err
+	}
+	if redisURL := loader.Secret("RATE_LIMIT_REDIS_URL", ""); redisURL != "" {
+		store, err := NewRedisStore(redisURL)
+		if err != nil {
+			return Config{}, fmt.Errorf("%sRATE_LIMIT_REDIS_URL: %w", loader.Prefix, err)
+		}
+		cfg.Store = store
+	}
+	return cfg, nil
+}
+
+// limitsFromConfig reads every setting FromConfig does but the store.
+func limitsFromConfig(loader config.Loader) (Config, error) {
+	rate := loader.Float64("RATE_LIMIT", 0)
+	cfg := Config{
+		Default: Limit{Rate: rate, Burst: loader.Int("RATE_BURST", defaultBurst(rate))},
+		Key:     Key(strings.ToLower(loader.String("RATE_LIMIT_KEY", string(KeySubject)))),
+	}
+	if cfg.Default.Burst < 1 {
+		cfg.Default.Burst = 1
+	}
+	switch cfg.Key {
+	case KeySubject, KeyTenant, KeyIP:
+	default:
+		return Config{}, fmt.Errorf("%sRATE_LIMIT_KEY: must be subject, tenant, or ip", loader.Prefix)
+	}
+	for _, spec := range loader.StringSlice("RATE_LIMIT_ROUTES", nil) {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			return Config{}, fmt.Errorf("%sRATE_LIMIT_ROUTES: %w", loader.Prefix, err)
+		}
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	return cfg, nil
+}
+
+// Limiter enforces a Config.
+type Limiter struct {
+	cfg atomic.Pointer[Config]
+}
+
+// New returns a Limiter for cfg.
+func New(cfg Config) *Limiter {
+	if cfg.Key == "" {
+		cfg.Key = KeySubject
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	if cfg.Code == "" {
+		cfg.Code = "server.rate_limited"
+	}
+	l := &Limiter{}
+	l.cfg.Store(&cfg)
+	return l
+}
+
+// Reload prepares the limits, rules, and key from loader for
+// server.Reloader. The store and problem code stay as they are, so buckets
+// survive the reload; changing RATE_LIMIT_REDIS_URL needs a restart.
+func (l *Limiter) Reload(loader config.Loader) (func(), error) {
+	next, err := limitsFromConfig(loader)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		current := l.cfg.Load()
+		next.Store, next.Code = current.Store, current.Code
+		l.cfg.Store(&next)
+	}, nil
+}
+
+// Enabled reports whether any request can be limited.
+func (l *Limiter) Enabled() bool {
+	return l.cfg.Load().enabled()
+}
+
+func (cfg *Config) enabled() bool {
+	if !cfg.Default.Unlimited() {
+		return true
+	}
+	for _, rule := range cfg.Rules {
+		if !rule.Limit.Unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware rejects callers over their limit with 429 Too Many Requests
+// and Retry-After. Every limited response carries RateLimit-Limit,
+// RateLimit-Remaining, and RateLimit-Reset, plus their X-RateLimit-*
+// equivalents. It must run after auth.Authenticator.Require to key by
+// subject or tenant. When the store fails the request is let through and
+// the error logged, so an outage of a shared store does not take the API
+// down with it. Each request uses the configuration current when it
+// arrives.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := l.cfg.Load()
+		rule, limit := cfg.match(r)
+		if limit.Unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := rule + "|" + cfg.callerKey(r)
+		res, err := cfg.Store.Take(r.Context(), key, limit)
+		if err != nil {
+			if logger, ok := logging.FromContext(r.Context()); ok {
+				logger.Warn("rate limit store failed; allowing request", "err", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		reset := strconv.Itoa(int(math.Ceil(res.Reset.Seconds())))
+		for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+			w.Header().Set(prefix+"Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set(prefix+"Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set(prefix+"Reset", reset)
+		}
+		if !res.Allowed {
+			seconds := max(1, int(math.Ceil(res.RetryAfter.Seconds())))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			problem.Write(w, r, http.StatusTooManyRequests, cfg.Code, "rate limit exceeded; retry in "+strconv.Itoa(seconds)+"s")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match returns the rule applying to r, named so buckets of different rules
+// stay apart, and its limit. A rule matches the path as sent or with its
+// API version segment removed, so "/ugc/content" also limits
+// "/ugc/v1/content".
+func (cfg *Config) match(r *http.Request) (string, Limit) {
+	best := -1
+	unversioned := apiversion.Trim(r.URL.Path)
+	for i, rule := range cfg.Rules {
+		if rule.Method != "" && rule.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, rule.Prefix) && !strings.HasPrefix(unversioned, rule.Prefix) {
+			continue
+		}
+		if best >= 0 {
+			cur := cfg.Rules[best]
+			if len(rule.Prefix) < len(cur.Prefix) || (len(rule.Prefix) == len(cur.Prefix) && (rule.Method == "" || cur.Method != "")) {
+				continue
+			}
+		}
+		best = i
+	}
+	if best < 0 {
+		return "*", cfg.Default
+	}
+	rule := cfg.Rules[best]
+	return strings.TrimSpace(rule.Method + " " + rule.Prefix), rule.Limit
+}
+
+func (cfg *Config) callerKey(r *http.Request) string {
+	p, authenticated := auth.FromContext(r.Context())
+	if cfg.Key == KeyTenant {
+		if p.Tenant != "" {
+			return "tenant:" + p.Tenant
+		}
+		if tenant := logging.TenantID(r.Context()); tenant != "" {
+			return "tenant:" + tenant
+		}
+	}
+	if cfg.Key != KeyIP && authenticated && p.Subject != "" {
+		return "subject:" + p.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RegisterChecks adds an optional readiness check for stores that can be
+// probed, such as RedisStore; an unreachable store only degrades readiness
+// because requests are let through while it is down.
+func (l *Limiter) RegisterChecks(checks *health.Registry) {
+	if c, ok := l.cfg.Load().Store.(interface{ Check(context.Context) error }); ok && l.Enabled() {
+		checks.Optional("rate limit store", c.Check)
+	}
+}
+
+// Close releases the store's connections, if it holds any.
+func (l *Limiter) Close() error {
+	if c, ok := l.cfg.Load().Store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+func TestLimiterTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Unix(0, 0)
+	store.now = func() time.Time { return now }
+	handler := New(Config{Default: Limit{Rate: 1, Burst: 2}, Store: store}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remote
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := serve("10.0.0.1:1000"); rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected pass, got %d", i, rec.Code)
+		}
+	}
+	rec := serve("10.0.0.1:1001")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After 1, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "server.rate_limited") {
+		t.Fatalf("expected problem code, got %s", rec.Body.String())
+	}
+	for header, want := range map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0", "RateLimit-Reset": "2", "X-RateLimit-Remaining": "0"} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if rec := serve("10.0.0.2:1000"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected other caller to pass, got %d", rec.Code)
+	}
+	now = now.Add(time.Second)
+	if rec := serve("10.0.0.1:1000"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected refill after a second, got %d", rec.Code)
+	}
+}
+
+func TestLimiterRulesAndKeys(t *testing.T) {
+	var rules []Rule
+	for _, spec := range []string{"/topics/=10:1", "POST /topics/=1:1", "/topics/internal/=0", "/content/=10:1"} {
+		rule, err := ParseRule(spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", spec, err)
+		}
+		rules = append(rules, rule)
+	}
+	limiter := New(Config{Rules: rules, Key: KeyTenant})
+	if !limiter.Enabled() {
+		t.Fatal("expected rules to enable the limiter")
+	}
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method, path, tenant string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{Subject: "api-key/" + tenant, Tenant: tenant}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	cases := []struct {
+		name                 string
+		method, path, tenant string
+		want                 int
+	}{
+		{"first post", http.MethodPost, "/topics/a/messages", "acme", http.StatusNoContent},
+		{"method rule wins", http.MethodPost, "/topics/b/messages", "acme", http.StatusTooManyRequests},
+		{"separate bucket per rule", http.MethodGet, "/topics/a/messages", "acme", http.StatusNoContent},
+		{"separate bucket per tenant", http.MethodPost, "/topics/a/messages", "globex", http.StatusNoContent},
+		{"longer prefix exempts", http.MethodPost, "/topics/internal/x", "acme", http.StatusNoContent},
+		{"exempt stays exempt", http.MethodPost, "/topics/internal/x", "acme", http.StatusNoContent},
+		{"no default limit", http.MethodGet, "/healthz", "acme", http.StatusNoContent},
+		{"no default limit again", http.MethodGet, "/healthz", "acme", http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		if got := serve(tc.method, tc.path, tc.tenant); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"/topics", "topics/=1", "/topics/=-1", "/topics/=1:0", "/topics/=x"} {
+		if _, err := ParseRule(bad); err == nil {
+			t.Errorf("ParseRule(%q): expected error", bad)
+		}
+	}
+	if New(Config{}).Enabled() {
+		t.Fatal("expected an empty config to be disabled")
+	}
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Result, error) {
+	return Result{}, errors.New("unavailable")
+}
+
+func TestLimiterFailsOpen(t *testing.T) {
+	handler := New(Config{Default: Limit{Rate: 1, Burst: 1}, Store: failingStore{}}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected pass while the store is down, got %d", i, rec.Code)
+		}
+	}
+}
+
+// fakeRedis answers the commands RedisStore sends. The script is reported
+// missing until loaded with EVAL, and every bucket allows one request.
+func fakeRedis(t *testing.T, password string) (addr string, commands chan []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	commands = make(chan []string, 64)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeRedis(conn, password, commands)
+		}
+	}()
+	return ln.Addr().String(), commands
+}
+
+func serveFakeRedis(conn net.Conn, password string, commands chan<- []string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	loaded := false
+	taken := map[string]bool{}
+	authed := password == ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			size, _ := r.ReadString('\n')
+			length, _ := strconv.Atoi(strings.TrimSpace(size[1:]))
+			buf := make([]byte, length+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:length])
+		}
+		commands <- args
+		switch {
+		case args[0] == "AUTH":
+			authed = args[len(args)-1] == password
+			if !authed {
+				_, _ = io.WriteString(conn, "-WRONGPASS invalid password\r\n")
+				continue
+			}
+			_, _ = io.WriteString(conn, "+OK\r\n")
+		case !authed:
+			_, _ = io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "PING":
+			_, _ = io.WriteString(conn, "+PONG\r\n")
+		case args[0] == "EVALSHA" && !loaded:
+			_, _ = io.WriteString(conn, "-NOSCRIPT No matching script.\r\n")
+		case args[0] == "EVAL" || args[0] == "EVALSHA":
+			loaded = true
+			if taken[args[3]] {
+				_, _ = io.WriteString(conn, "*2\r\n:0\r\n$4\r\n0.25\r\n")
+				continue
+			}
+			taken[args[3]] = true
+			_, _ = io.WriteString(conn, "*2\r\n:1\r\n$1\r\n4\r\n")
+		default:
+			_, _ = io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	addr, commands := fakeRedis(t, "secret")
+	store, err := NewRedisStore("redis://:secret@" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	ctx := context.Background()
+	limit := Limit{Rate: 1, Burst: 5}
+
+	res, err := store.Take(ctx, "*|ip:10.0.0.1", limit)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if !res.Allowed || res.Remaining != 4 || res.Reset != time.Second {
+		t.Fatalf("unexpected first result %+v", res)
+	}
+	res, err = store.Take(ctx, "*|ip:10.0.0.1", limit)
+	if err != nil {
+		t.Fatalf("take: %v", err)
+	}
+	if res.Allowed || res.RetryAfter != 750*time.Millisecond {
+		t.Fatalf("unexpected second result %+v", res)
+	}
+	if err := store.Check(ctx); err != nil {
+		t.Fatalf("check: %v", err)
+	}
+
+	var names []string
+	for len(commands) > 0 {
+		cmd := <-commands
+		names = append(names, cmd[0])
+		if cmd[0] == "EVAL" && cmd[3] != redisKeyPrefix+"*|ip:10.0.0.1" {
+			t.Fatalf("unexpected key %q", cmd[3])
+		}
+	}
+	if got := strings.Join(names, ","); got != "AUTH,EVALSHA,EVAL,EVALSHA,PING" {
+		t.Fatalf("unexpected commands %s", got)
+	}
+
+	wrong, _ := NewRedisStore("redis://:nope@" + addr)
+	if _, err := wrong.Take(ctx, "k", limit); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("expected auth failure, got %v", err)
+	}
+	for _, bad := range []string{"http://localhost", "redis://", "redis://localhost/x"} {
+		if _, err := NewRedisStore(bad); err == nil {
+			t.Errorf("NewRedisStore(%q): expected error", bad)
+		}
+	}
+}
+
+func TestLimiterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.json")
+	loader, err := config.Load("SVC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := FromConfig(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter := New(cfg)
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func() int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+	if code := serve(); code != http.StatusNoContent {
+		t.Fatalf("expected a disabled limiter to pass, got %d", code)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rate_limit": 0.001, "rate_burst": 1, "rate_limit_key": "everyone"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if loader, err = config.Load("SVC", path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := limiter.Reload(loader); err == nil {
+		t.Fatal("expected an invalid key to be reported")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"rate_limit": 0.001, "rate_burst": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if loader, err = config.Load("SVC", path); err != nil {
+		t.Fatal(err)
+	}
+	install, err := limiter.Reload(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(); code != http.StatusNoContent || limiter.Enabled() {
+		t.Fatalf("limits applied before install: %d", code)
+	}
+	install()
+	if first, second := serve(), serve(); first != http.StatusNoContent || second != http.StatusTooManyRequests {
+		t.Fatalf("expected the reloaded limit to apply, got %d then %d", first, second)
+	}
+}
@@ -0,0 +1,103 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/redisclient"
+)
+
+// takeScript refills and takes from a bucket stored as a hash of tokens and
+// the time they were counted, using the server clock so replicas with
+// skewed clocks share one view. Calling TIME before writing needs effect
+// replication, the default since Redis 5.
+const takeScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`
+
+var takeScriptSHA = func() string {
+	sum := sha1.Sum([]byte(takeScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// redisKeyPrefix namespaces bucket keys in a shared Redis.
+const redisKeyPrefix = "cassandra:ratelimit:"
+
+// RedisStore keeps buckets in Redis 5 or later so every replica shares the
+// same limits. Each Take is one script call; buckets expire once they would
+// have refilled.
+type RedisStore struct {
+	client *redisclient.Client
+}
+
+// NewRedisStore parses a redis:// or rediss:// (TLS) URL of the form
+// redis://[user:password@]host[:port][/db]. No connection is made until the
+// first request.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	client, err := redisclient.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Take implements Store.
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	rate := strconv.FormatFloat(limit.Rate, 'g', -1, 64)
+	burst := strconv.Itoa(limit.Burst)
+	reply, err := s.client.Do(ctx, "EVALSHA", takeScriptSHA, "1", redisKeyPrefix+key, rate, burst)
+	var rerr redisclient.Error
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		reply, err = s.client.Do(ctx, "EVAL", takeScript, "1", redisKeyPrefix+key, rate, burst)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != 2 {
+		return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	allowed, _ := items[0].(int64)
+	text, _ := items[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("redis: unexpected token count %q", text)
+	}
+	res := Result{Allowed: allowed == 1, Remaining: int(tokens)}
+	if !res.Allowed {
+		res.RetryAfter = seconds((1 - tokens) / limit.Rate)
+	}
+	res.Reset = seconds((float64(limit.Burst) - tokens) / limit.Rate)
+	return res, nil
+}
+
+// Check pings the server.
+func (s *RedisStore) Check(ctx context.Context) error {
+	return s.client.Check(ctx)
+}
+
+// Close closes idle connections; connections in use are closed when
+// returned.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,281 @@
+// Package redisclient is a small Redis 5+ client speaking RESP2 over a pool
+// of connections, enough for the rate limiter's shared buckets and the
+// storage layer's Redis driver.
+package redisclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxIdleConns bounds the connections a Client keeps open between
+// commands.
+const maxIdleConns = 8
+
+// Error is an error reply from the server, such as "NOSCRIPT ..." or
+// "WRONGTYPE ...".
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Client sends commands to one Redis server.
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	// Timeout bounds each command when the context has no earlier
+	// deadline.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	idle   []*Conn
+	closed bool
+}
+
+// New parses a redis:// or rediss:// (TLS) URL of the form
+// redis://[user:password@]host[:port][/db]. No connection is made until the
+// first command.
+func New(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{Timeout: time.Second}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	default:
+		return nil, errors.New("scheme must be redis or rediss")
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("missing host")
+	}
+	c.addr = u.Host
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Do runs one command on a pooled connection. Replies are decoded as
+// described on Conn.Do.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	conn, err := c.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Do(ctx, args...)
+}
+
+// Check pings the server.
+func (c *Client) Check(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes idle connections; connections in use are closed when
+// released.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle, c.closed = nil, true
+	c.mu.Unlock()
+	for _, conn := range idle {
+		_ = conn.conn.Close()
+	}
+	return nil
+}
+
+// Conn takes a connection from the pool for commands that must share one,
+// such as WATCH and MULTI/EXEC. Close returns it.
+func (c *Client) Conn(ctx context.Context) (*Conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errors.New("redis: client closed")
+	}
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(conn *Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdleConns {
+		_ = conn.conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+func (c *Client) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+func (c *Client) dial(ctx context.Context) (*Conn, error) {
+	ctx, cancel := context.WithDeadline(ctx, c.deadline(ctx))
+	defer cancel()
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+	if c.tls != nil {
+		tc := tls.Client(nc, c.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		nc = tc
+	}
+	conn := &Conn{client: c, conn: nc, r: bufio.NewReader(nc)}
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, cmd := range setup {
+		if _, err := conn.Do(ctx, cmd...); err != nil {
+			_ = nc.Close()
+			return nil, fmt.Errorf("redis %s: %w", cmd[0], err)
+		}
+	}
+	return conn, nil
+}
+
+// Conn is one connection taken from a Client's pool.
+type Conn struct {
+	client *Client
+	conn   net.Conn
+	r      *bufio.Reader
+	broken bool
+}
+
+// Do sends one command and reads its reply: simple strings and bulk
+// strings become string, integers int64, arrays []any, nulls nil, and error
+// replies an Error. Any other failure leaves the connection unusable, and
+// Close discards it.
+func (c *Conn) Do(ctx context.Context, args ...string) (any, error) {
+	reply, err := c.do(c.client.deadline(ctx), args...)
+	var rerr Error
+	if err != nil && !errors.As(err, &rerr) {
+		c.broken = true
+	}
+	return reply, err
+}
+
+// Close returns the connection to the pool, or closes it if a command
+// failed on it.
+func (c *Conn) Close() {
+	if c.broken {
+		_ = c.conn.Close()
+		return
+	}
+	c.client.put(c)
+}
+
+func (c *Conn) do(deadline time.Time, args ...string) (any, error) {
+	if c.broken {
+		return nil, errors.New("redis: connection broken")
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *Conn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, Error(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// Error replies nested in an array are kept as values so the
+		// rest of the array is still consumed.
+		items := make([]any, n)
+		for i := range items {
+			items[i], err = c.read()
+			var rerr Error
+			if errors.As(err, &rerr) {
+				items[i], err = rerr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
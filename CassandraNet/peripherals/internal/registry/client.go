@@ -0,0 +1,328 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+)
+
+// ErrNoInstances is returned by Resolver when a service has no instance
+// able to take traffic.
+var ErrNoInstances = errors.New("registry: no available instance")
+
+// Client calls a registry over HTTP.
+type Client struct {
+	baseURL *url.URL
+	client  *http.Client
+}
+
+// NewClient constructs a client for the registry at baseURL. Requests are
+// sent through transport (nil uses http.DefaultTransport).
+func NewClient(baseURL string, transport http.RoundTripper) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("registry: base URL %q must be an absolute http(s) URL", baseURL)
+	}
+	return &Client{baseURL: u, client: &http.Client{Transport: transport, Timeout: 5 * time.Second}}, nil
+}
+
+// Register adds or renews inst for ttl and returns the stored entry.
+func (c *Client) Register(ctx context.Context, inst Instance, ttl time.Duration) (Instance, error) {
+	body, err := json.Marshal(registration{URL: inst.URL, Status: inst.Status, Metadata: inst.Metadata, TTLSeconds: ttl.Seconds()})
+	if err != nil {
+		return Instance{}, err
+	}
+	var out Instance
+	err = c.do(ctx, http.MethodPut, c.instancePath(inst.Service, inst.ID), body, &out)
+	return out, err
+}
+
+// Deregister removes an instance. An instance that is already gone is not
+// an error.
+func (c *Client) Deregister(ctx context.Context, service, id string) error {
+	err := c.do(ctx, http.MethodDelete, c.instancePath(service, id), nil, nil)
+	var status statusError
+	if errors.As(err, &status) && status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// Instances returns the live instances of service.
+func (c *Client) Instances(ctx context.Context, service string) ([]Instance, error) {
+	var out []Instance
+	err := c.do(ctx, http.MethodGet, c.baseURL.JoinPath(servicesPrefix, service).String(), nil, &out)
+	return out, err
+}
+
+// Check reports whether the registry is reachable.
+func (c *Client) Check(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, c.baseURL.JoinPath("/healthz").String(), nil, nil)
+}
+
+func (c *Client) instancePath(service, id string) string {
+	return c.baseURL.JoinPath(servicesPrefix, service, "instances", id).String()
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("registry returned %d %s", int(e), http.StatusText(int(e)))
+}
+
+func (c *Client) do(ctx context.Context, method, target string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return statusError(resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Registrar keeps one instance registered for as long as its process runs.
+type Registrar struct {
+	client   *Client
+	instance Instance
+	ttl      time.Duration
+	checks   *health.Registry
+	logger   interface {
+		Printf(string, ...any)
+	}
+}
+
+// NewRegistrar constructs a registrar that registers inst with client and
+// renews it every third of ttl. When checks is non-nil, each heartbeat
+// reports the instance's readiness so callers can route around it.
+func NewRegistrar(client *Client, inst Instance, ttl time.Duration, checks *health.Registry, logger interface {
+	Printf(string, ...any)
+}) *Registrar {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Registrar{client: client, instance: inst, ttl: ttl, checks: checks, logger: logger}
+}
+
+// RegistrarFromConfig reads REGISTRY_URL, ADVERTISE_URL, and REGISTRY_TTL
+// from loader and builds a registrar for service listening on addr. It
+// returns nil when REGISTRY_URL is unset. ADVERTISE_URL defaults to the
+// host name and addr's port, over https when TLS_CERT_FILE is set.
+func RegistrarFromConfig(loader config.Loader, service, addr string, transport http.RoundTripper, checks *health.Registry, logger interface {
+	Printf(string, ...any)
+}) (*Registrar, error) {
+	registryURL, err := loader.URL("REGISTRY_URL", "")
+	if err != nil || registryURL == nil {
+		return nil, err
+	}
+	client, err := NewClient(registryURL.String(), transport)
+	if err != nil {
+		return nil, err
+	}
+	advertise, err := loader.URL("ADVERTISE_URL", "")
+	if err != nil {
+		return nil, err
+	}
+	if advertise == nil {
+		scheme := "http"
+		if loader.String("TLS_CERT_FILE", "") != "" {
+			scheme = "https"
+		}
+		if advertise, err = defaultAdvertiseURL(scheme, addr); err != nil {
+			return nil, err
+		}
+	}
+	inst := Instance{Service: service, ID: advertise.Host, URL: advertise.String()}
+	return NewRegistrar(client, inst, loader.Duration("REGISTRY_TTL", DefaultTTL), checks, logger), nil
+}
+
+func defaultAdvertiseURL(scheme, addr string) (*url.URL, error) {
+	if strings.HasPrefix(addr, "unix://") {
+		return nil, fmt.Errorf("registry: set ADVERTISE_URL when listening on %s", addr)
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("registry: listen address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		if host, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("registry: set ADVERTISE_URL: %w", err)
+		}
+	}
+	return &url.URL{Scheme: scheme, Host: net.JoinHostPort(host, port)}, nil
+}
+
+// Instance returns the entry the registrar maintains.
+func (r *Registrar) Instance() Instance {
+	return r.instance
+}
+
+// Run registers the instance, heartbeats until ctx is cancelled, and then
+// deregisters it. Registry failures are logged and retried on the next
+// heartbeat, so Run only returns once ctx is done.
+func (r *Registrar) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	failing := false
+	for {
+		err := r.heartbeat(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil && !failing:
+			r.logger.Printf("register %s with the registry failed: %v", r.instance.ID, err)
+			failing = true
+		case err == nil && failing:
+			r.logger.Printf("registered %s with the registry", r.instance.ID)
+			failing = false
+		}
+		select {
+		case <-ctx.Done():
+			deregisterCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := r.client.Deregister(deregisterCtx, r.instance.Service, r.instance.ID); err != nil {
+				r.logger.Printf("deregister %s from the registry failed: %v", r.instance.ID, err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Registrar) heartbeat(ctx context.Context) error {
+	inst := r.instance
+	inst.Status = health.StatusOK
+	if r.checks != nil {
+		inst.Status = r.checks.Ready(ctx).Status
+	}
+	_, err := r.client.Register(ctx, inst, r.ttl)
+	return err
+}
+
+// Resolver picks an instance of one service for each call, refreshing its
+// view of the registry at most once per refresh interval, or once a second
+// while it knows of no usable instance. Healthy instances are used in turn;
+// degraded ones only when none is healthy, and failing ones never. If the
+// registry cannot be reached the last known instances are kept.
+type Resolver struct {
+	client  *Client
+	service string
+	refresh time.Duration
+	next    atomic.Uint64
+
+	mu         sync.Mutex
+	instances  []Instance
+	fetched    time.Time
+	refreshing bool
+}
+
+// Resolver returns a resolver for service that refreshes every refresh
+// interval (default 5s).
+func (c *Client) Resolver(service string, refresh time.Duration) *Resolver {
+	if refresh <= 0 {
+		refresh = 5 * time.Second
+	}
+	return &Resolver{client: c, service: service, refresh: refresh}
+}
+
+// Resolve returns the base URL of an instance able to take a request.
+func (r *Resolver) Resolve(ctx context.Context) (*url.URL, error) {
+	instances, err := r.lookup(ctx, r.refresh)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", r.service, err)
+	}
+	candidates := usable(instances)
+	if len(candidates) == 0 {
+		// An instance may have registered since the last refresh, for
+		// example while services start together; look again sooner than
+		// the refresh interval.
+		if instances, err = r.lookup(ctx, min(missRefresh, r.refresh)); err == nil {
+			candidates = usable(instances)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("resolve %s: %w", r.service, ErrNoInstances)
+	}
+	inst := candidates[(r.next.Add(1)-1)%uint64(len(candidates))]
+	return url.Parse(inst.URL)
+}
+
+// missRefresh bounds how long a resolver keeps a list without any usable
+// instance.
+const missRefresh = time.Second
+
+// usable returns the healthy instances, or the degraded ones when none is
+// healthy.
+func usable(instances []Instance) []Instance {
+	for _, want := range []string{health.StatusOK, health.StatusDegraded} {
+		var candidates []Instance
+		for _, inst := range instances {
+			if inst.Status == want {
+				candidates = append(candidates, inst)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates
+		}
+	}
+	return nil
+}
+
+// Instances returns the service's instances as last seen in the registry.
+func (r *Resolver) Instances(ctx context.Context) ([]Instance, error) {
+	return r.lookup(ctx, r.refresh)
+}
+
+// lookup returns the cached list, refreshing it first when it is older
+// than maxAge.
+func (r *Resolver) lookup(ctx context.Context, maxAge time.Duration) ([]Instance, error) {
+	r.mu.Lock()
+	haveCache := !r.fetched.IsZero()
+	if haveCache && (r.refreshing || time.Since(r.fetched) < maxAge) {
+		instances := r.instances
+		r.mu.Unlock()
+		return instances, nil
+	}
+	r.refreshing = true
+	r.mu.Unlock()
+
+	instances, err := r.client.Instances(ctx, r.service)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshing = false
+	if err != nil {
+		if !haveCache {
+			return nil, err
+		}
+		// Serve the stale list and wait a full interval before trying
+		// the registry again.
+		r.fetched = time.Now()
+		return r.instances, nil
+	}
+	r.instances = instances
+	r.fetched = time.Now()
+	return instances, nil
+}
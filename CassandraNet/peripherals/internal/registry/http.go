@@ -0,0 +1,124 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the registry API.
+const (
+	codeInvalidRequest = "registry.invalid_request"
+	codeNotFound       = "registry.not_found"
+)
+
+const (
+	servicesBasePath = "/services"
+	servicesPrefix   = "/services/"
+
+	maxRegistrationBytes = 64 << 10
+)
+
+// registration is the body of PUT /services/{service}/instances/{id}.
+type registration struct {
+	URL        string            `json:"url"`
+	Status     string            `json:"status"`
+	Metadata   map[string]string `json:"metadata"`
+	TTLSeconds float64           `json:"ttl_seconds"`
+}
+
+// Handler serves the registry API: GET /services lists every live instance
+// by service, GET /services/{service} lists one service, and
+// PUT and DELETE /services/{service}/instances/{id} register, heartbeat, and
+// deregister an instance.
+func (r *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(servicesBasePath, r.handleServices)
+	mux.HandleFunc(servicesPrefix, r.handleService)
+	return mux
+}
+
+func (r *Registry) handleServices(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		problem.MethodNotAllowed(w, req, "registry", http.MethodGet, http.MethodHead)
+		return
+	}
+	writeJSON(w, http.StatusOK, r.Services())
+}
+
+func (r *Registry) handleService(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, servicesPrefix), "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			problem.MethodNotAllowed(w, req, "registry", http.MethodGet, http.MethodHead)
+			return
+		}
+		writeJSON(w, http.StatusOK, r.Instances(parts[0]))
+	case len(parts) == 3 && parts[0] != "" && parts[1] == "instances" && parts[2] != "":
+		r.handleInstance(w, req, parts[0], parts[2])
+	default:
+		problem.Write(w, req, http.StatusNotFound, codeNotFound, "resource not found")
+	}
+}
+
+func (r *Registry) handleInstance(w http.ResponseWriter, req *http.Request, service, id string) {
+	switch req.Method {
+	case http.MethodPut:
+		body, err := decodeRegistration(req)
+		if err != nil {
+			if !validation.Write(w, req, codeInvalidRequest, err) {
+				problem.DecodeFailed(w, req, codeInvalidRequest, err.Error(), err)
+			}
+			return
+		}
+		inst, err := r.Register(Instance{
+			Service:  service,
+			ID:       id,
+			URL:      body.URL,
+			Status:   body.Status,
+			Metadata: body.Metadata,
+		}, time.Duration(body.TTLSeconds*float64(time.Second)))
+		if validation.Write(w, req, codeInvalidRequest, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, inst)
+	case http.MethodDelete:
+		if !r.Deregister(service, id) {
+			problem.Write(w, req, http.StatusNotFound, codeNotFound, "no instance "+id+" of "+service)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		problem.MethodNotAllowed(w, req, "registry", http.MethodPut, http.MethodDelete)
+	}
+}
+
+func decodeRegistration(req *http.Request) (registration, error) {
+	defer req.Body.Close()
+	var body registration
+	dec := json.NewDecoder(io.LimitReader(req.Body, maxRegistrationBytes))
+	if err := dec.Decode(&body); err != nil {
+		return body, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	if body.TTLSeconds < 0 {
+		return body, validation.Invalid("ttl_seconds", validation.RuleRange, "must not be negative")
+	}
+	return body, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
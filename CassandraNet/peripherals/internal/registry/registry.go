@@ -0,0 +1,187 @@
+// Package registry tracks where each peripheral service instance is running.
+// Instances register their base URL and readiness on startup and renew the
+// entry with heartbeats; an entry whose TTL lapses without a heartbeat is
+// dropped, so crashed instances disappear without deregistering. Resolver
+// lets inter-service callers look up a live instance instead of reading a
+// fixed URL from the environment.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Registration limits.
+const (
+	DefaultTTL = 30 * time.Second
+	MinTTL     = time.Second
+	MaxTTL     = 10 * time.Minute
+)
+
+// ErrInvalidInstance is returned when a registration is missing a field or
+// carries a malformed URL or status.
+var ErrInvalidInstance = errors.New("registry: invalid instance")
+
+// Instance is one running copy of a service.
+type Instance struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+	// URL is the base URL other services call the instance at.
+	URL string `json:"url"`
+	// Status is the instance's own readiness: ok, degraded, or fail.
+	Status        string            `json:"status"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	TTLSeconds    float64           `json:"ttl_seconds"`
+	RegisteredAt  time.Time         `json:"registered_at"`
+	LastHeartbeat time.Time         `json:"last_heartbeat"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+}
+
+// Validate checks the fields an instance must carry to be registered.
+// Failures wrap both ErrInvalidInstance and validation.Errors.
+func (i Instance) Validate() error {
+	var v validation.Validator
+	v.ID("service", i.Service).Excludes("/")
+	v.ID("id", i.ID).Excludes("/")
+	u, err := url.Parse(i.URL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", validation.RuleFormat, "must be an absolute http(s) URL")
+	v.String("status", string(i.Status)).Required().OneOf(string(health.StatusOK), string(health.StatusDegraded), string(health.StatusFail))
+	v.Map("metadata", i.Metadata).Limited()
+	if err := v.Err(); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInstance, err)
+	}
+	return nil
+}
+
+// Registry is an in-memory set of instances keyed by service and ID. It is
+// safe for concurrent use.
+type Registry struct {
+	mu        sync.Mutex
+	services  map[string]map[string]Instance
+	now       func() time.Time
+	registers int
+}
+
+// New constructs an empty registry.
+func New() *Registry {
+	return &Registry{services: make(map[string]map[string]Instance), now: time.Now}
+}
+
+// Register adds inst or renews an existing entry with the same service and
+// ID, keeping it for ttl (clamped to MinTTL..MaxTTL; 0 uses DefaultTTL). An
+// empty status is taken as ok. It returns the stored entry.
+func (r *Registry) Register(inst Instance, ttl time.Duration) (Instance, error) {
+	if inst.Status == "" {
+		inst.Status = health.StatusOK
+	}
+	if err := inst.Validate(); err != nil {
+		return Instance{}, err
+	}
+	switch {
+	case ttl == 0:
+		ttl = DefaultTTL
+	case ttl < MinTTL:
+		ttl = MinTTL
+	case ttl > MaxTTL:
+		ttl = MaxTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	instances := r.services[inst.Service]
+	if instances == nil {
+		instances = make(map[string]Instance)
+		r.services[inst.Service] = instances
+	}
+	inst.RegisteredAt = now
+	if prev, ok := instances[inst.ID]; ok && prev.ExpiresAt.After(now) {
+		inst.RegisteredAt = prev.RegisteredAt
+	}
+	inst.TTLSeconds = ttl.Seconds()
+	inst.LastHeartbeat = now
+	inst.ExpiresAt = now.Add(ttl)
+	instances[inst.ID] = inst
+	// Expired entries are otherwise only dropped when their service is
+	// read, so sweep every service now and then.
+	if r.registers++; r.registers%256 == 0 {
+		r.sweepLocked(now)
+	}
+	return inst, nil
+}
+
+// Deregister removes an instance and reports whether it was registered.
+func (r *Registry) Deregister(service, id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	instances := r.services[service]
+	inst, ok := instances[id]
+	if !ok {
+		return false
+	}
+	delete(instances, id)
+	if len(instances) == 0 {
+		delete(r.services, service)
+	}
+	return inst.ExpiresAt.After(r.now())
+}
+
+// Instances returns the live instances of service ordered by ID.
+func (r *Registry) Instances(service string) []Instance {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	instances := r.services[service]
+	out := make([]Instance, 0, len(instances))
+	for id, inst := range instances {
+		if !inst.ExpiresAt.After(now) {
+			delete(instances, id)
+			continue
+		}
+		out = append(out, inst)
+	}
+	if len(instances) == 0 {
+		delete(r.services, service)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// Services returns the live instances of every service, keyed by service.
+func (r *Registry) Services() map[string][]Instance {
+	r.mu.Lock()
+	r.sweepLocked(r.now())
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	r.mu.Unlock()
+
+	out := make(map[string][]Instance, len(names))
+	for _, name := range names {
+		if instances := r.Instances(name); len(instances) > 0 {
+			out[name] = instances
+		}
+	}
+	return out
+}
+
+func (r *Registry) sweepLocked(now time.Time) {
+	for service, instances := range r.services {
+		for id, inst := range instances {
+			if !inst.ExpiresAt.After(now) {
+				delete(instances, id)
+			}
+		}
+		if len(instances) == 0 {
+			delete(r.services, service)
+		}
+	}
+}
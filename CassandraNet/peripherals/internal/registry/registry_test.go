@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/health"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRegistryExpiresInstances(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	reg := New()
+	reg.now = clock.Now
+
+	first, err := reg.Register(Instance{Service: "ugc-service", ID: "b:8091", URL: "http://b:8091"}, 10*time.Second)
+	if err != nil || first.Status != health.StatusOK || first.TTLSeconds != 10 {
+		t.Fatalf("register: %v %+v", err, first)
+	}
+	if _, err := reg.Register(Instance{Service: "ugc-service", ID: "a:8091", URL: "http://a:8091", Status: health.StatusDegraded}, time.Minute); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if got := reg.Instances("ugc-service"); len(got) != 2 || got[0].ID != "a:8091" {
+		t.Fatalf("expected both instances ordered by ID, got %+v", got)
+	}
+
+	clock.Advance(8 * time.Second)
+	renewed, _ := reg.Register(Instance{Service: "ugc-service", ID: "b:8091", URL: "http://b:8091"}, 10*time.Second)
+	if !renewed.RegisteredAt.Equal(first.RegisteredAt) || !renewed.LastHeartbeat.Equal(clock.Now()) {
+		t.Fatalf("expected a heartbeat to keep the registration time, got %+v", renewed)
+	}
+	clock.Advance(15 * time.Second)
+	if got := reg.Instances("ugc-service"); len(got) != 1 || got[0].ID != "a:8091" {
+		t.Fatalf("expected the lapsed instance to be dropped, got %+v", got)
+	}
+	clock.Advance(time.Minute)
+	if got := reg.Services(); len(got) != 0 {
+		t.Fatalf("expected no live services, got %+v", got)
+	}
+
+	for _, bad := range []Instance{
+		{ID: "x", URL: "http://x"},
+		{Service: "s", ID: "x", URL: "ftp://x"},
+		{Service: "s", ID: "x", URL: "http://x", Status: "sleepy"},
+	} {
+		if _, err := reg.Register(bad, 0); !errors.Is(err, ErrInvalidInstance) {
+			t.Errorf("Register(%+v): expected ErrInvalidInstance, got %v", bad, err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	handler := New().Handler()
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := serve(http.MethodPut, "/services/notification/instances/n1", `{"url":"http://n1:8084","ttl_seconds":20,"metadata":{"zone":"a"}}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ttl_seconds":20`) {
+		t.Fatalf("register: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPut, "/services/notification/instances/n2", `{"url":"n2"}`); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "registry.invalid_request") {
+		t.Fatalf("expected an invalid URL to be refused, got %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodGet, "/services", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"notification":[{`) {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodPost, "/services/notification", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodDelete, "/services/notification/instances/n1", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("deregister: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(http.MethodDelete, "/services/notification/instances/n1", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a second deregister, got %d", rec.Code)
+	}
+	if rec := serve(http.MethodGet, "/services/notification", ""); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Fatalf("expected an empty list, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRegistrarAndResolver(t *testing.T) {
+	reg := New()
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+	client, err := NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("client: %v", err)
+	}
+
+	checks := health.NewRegistry()
+	checks.Optional("sink", func(context.Context) error { return errors.New("unreachable") })
+	registrar := NewRegistrar(client, Instance{Service: "log-pipeline", ID: "a:8082", URL: "http://a:8082"}, time.Minute, checks, noopLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- registrar.Run(ctx) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(reg.Instances("log-pipeline")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := reg.Instances("log-pipeline"); len(got) != 1 || got[0].Status != health.StatusDegraded {
+		t.Fatalf("expected a degraded registration, got %+v", got)
+	}
+	if _, err := reg.Register(Instance{Service: "log-pipeline", ID: "b:8082", URL: "http://b:8082"}, time.Minute); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if _, err := reg.Register(Instance{Service: "log-pipeline", ID: "c:8082", URL: "http://c:8082", Status: health.StatusFail}, time.Minute); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	resolver := client.Resolver("log-pipeline", time.Hour)
+	for i := 0; i < 3; i++ {
+		u, err := resolver.Resolve(context.Background())
+		if err != nil || u.Host != "b:8082" {
+			t.Fatalf("expected the only healthy instance, got %v %v", u, err)
+		}
+	}
+	srv.Close()
+	if u, err := resolver.Resolve(context.Background()); err != nil || u.Host != "b:8082" {
+		t.Fatalf("expected the cached instance while the registry is down, got %v %v", u, err)
+	}
+	if _, err := client.Resolver("metrics-collector", time.Hour).Resolve(context.Background()); err == nil {
+		t.Fatal("expected an error with no cache and no registry")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	empty := New()
+	srv2 := httptest.NewServer(empty.Handler())
+	defer srv2.Close()
+	client2, _ := NewClient(srv2.URL, nil)
+	if _, err := client2.Resolver("ugc-service", 0).Resolve(context.Background()); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("expected ErrNoInstances, got %v", err)
+	}
+}
+
+func TestDefaultAdvertiseURL(t *testing.T) {
+	u, err := defaultAdvertiseURL("https", "10.0.0.5:8091")
+	if err != nil || u.String() != "https://10.0.0.5:8091" {
+		t.Fatalf("unexpected URL %v %v", u, err)
+	}
+	if u, err := defaultAdvertiseURL("http", ":8091"); err != nil || u.Port() != "8091" || u.Hostname() == "" {
+		t.Fatalf("expected the host name with the listen port, got %v %v", u, err)
+	}
+	if _, err := defaultAdvertiseURL("http", "unix:///run/ugc.sock"); err == nil {
+		t.Fatal("expected an error for a Unix socket")
+	}
+}
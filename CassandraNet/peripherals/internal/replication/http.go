@@ -0,0 +1,119 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the replication endpoints.
+const (
+	codeInvalidRequest = "replication.invalid_request"
+	codeNotFound       = "replication.not_found"
+	codeForbidden      = "replication.forbidden_tenant"
+	codeDisabled       = "replication.disabled"
+	codeLoop           = "replication.loop"
+	codeUnknownKind    = "replication.unknown_kind"
+	codeApplyFailed    = "replication.apply_failed"
+	codeStore          = "replication.store_unavailable"
+)
+
+// maxBatchBytes bounds a batch body.
+const maxBatchBytes = 32 << 20
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/replication"
+
+// Handler serves the replication API:
+//
+//	GET  /replication        this deployment's Status
+//	POST /replication/apply  applies a Batch from the peer
+//
+// An applied batch answers {"applied": seq}, the sequence number of the
+// last mutation applied from its origin. Replication spans every tenant,
+// so callers bound to a tenant are refused; reads require
+// auth.PermReplicationRead and batches auth.PermReplicationWrite.
+func (r *Replicator) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p, _ := auth.FromContext(req.Context()); p.Tenant != "" {
+			problem.Write(w, req, http.StatusForbidden, codeForbidden, "replication spans every tenant; use credentials not bound to one")
+			return
+		}
+		switch req.URL.Path {
+		case Path, Path + "/":
+			r.handleStatus(w, req)
+		case Path + "/apply":
+			r.handleApply(w, req)
+		default:
+			problem.Write(w, req, http.StatusNotFound, codeNotFound, "resource not found")
+		}
+	})
+}
+
+func (r *Replicator) handleStatus(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, req, "replication", http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, req, auth.PermReplicationRead, "", "") {
+		return
+	}
+	status, err := r.Status(req.Context())
+	if err != nil {
+		logging.For(req.Context(), r.logger).Printf("replication: status: %v", err)
+		problem.Write(w, req, http.StatusServiceUnavailable, codeStore, "replication state is unavailable")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (r *Replicator) handleApply(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, req, "replication", http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, req, auth.PermReplicationWrite, "", "") {
+		return
+	}
+	var batch Batch
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBatchBytes)).Decode(&batch); err != nil {
+		validation.Write(w, req, codeInvalidRequest, validation.Invalid("body", validation.RuleFormat, "must be a JSON batch"))
+		return
+	}
+	var v validation.Validator
+	v.ID("origin", batch.Origin)
+	if err := v.Err(); err != nil {
+		validation.Write(w, req, codeInvalidRequest, err)
+		return
+	}
+	if strings.Contains(batch.Origin, "/") {
+		validation.Write(w, req, codeInvalidRequest, validation.Invalid("origin", validation.RuleFormat, "must not contain a slash"))
+		return
+	}
+	applied, err := r.Apply(req.Context(), batch)
+	switch {
+	case errors.Is(err, ErrDisabled):
+		problem.Write(w, req, http.StatusConflict, codeDisabled, "this deployment has no replication region configured")
+	case errors.Is(err, ErrLoop):
+		problem.Write(w, req, http.StatusConflict, codeLoop, "the batch comes from this deployment's own region "+batch.Origin)
+	case errors.Is(err, ErrUnknownKind):
+		problem.Write(w, req, http.StatusUnprocessableEntity, codeUnknownKind, err.Error())
+	case err != nil:
+		logging.For(req.Context(), r.logger).Printf("replication: apply batch from %s: %v", batch.Origin, err)
+		problem.Write(w, req, http.StatusInternalServerError, codeApplyFailed, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, appliedResponse{Applied: applied})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
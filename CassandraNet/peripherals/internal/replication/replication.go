@@ -0,0 +1,530 @@
+// Package replication ships a service's store mutations to the same
+// service in a peer deployment, usually in another region, so a regional
+// outage does not strand its queues or moderation work. A service records
+// each change it makes through Record, which appends a Mutation to an
+// outbox in the service's storage; Run sends the outbox to the peer in
+// order, and the peer's Handler hands each mutation to the function the
+// service registered for its kind:
+//
+//	cfg, err := replication.FromConfig(loader)
+//	r := replication.New(db, "messaging-service", cfg, transport, logger)
+//	svc.SetReplicator(r)
+//	group.Go("replication", r.Run)
+//
+// Replication is asynchronous: a mutation reaches the peer one poll
+// interval after it is recorded at best, and whatever is still in the
+// outbox when a region fails is delivered once it returns. Each origin's
+// mutations are applied in the order recorded, and those delivered again
+// are skipped. Concurrent changes to the same record in both regions are
+// settled by Mutation.Supersedes: the later version wins, and a tie goes
+// to the region whose name sorts first, so both sides converge.
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Buckets used by a Replicator. Keys start with the service name and a
+// slash, so services sharing a driver keep separate outboxes: outbox
+// entries are keyed by a zero-padded sequence number, the meta bucket
+// holds the latest one, and the peers bucket the progress of each origin
+// whose mutations were applied here.
+const (
+	outboxBucket = "replication.outbox"
+	metaBucket   = "replication.meta"
+	peersBucket  = "replication.peers"
+	sequenceKey  = "sequence"
+)
+
+// Errors returned by Replicator.Apply.
+var (
+	// ErrDisabled means no region is configured, so mutations cannot be
+	// told apart from this deployment's own.
+	ErrDisabled = errors.New("replication: no region configured")
+	// ErrLoop means a batch claims to come from this deployment's region.
+	ErrLoop = errors.New("replication: mutations originate in this region")
+	// ErrUnknownKind means a mutation's kind has no registered function.
+	ErrUnknownKind = errors.New("replication: unknown mutation kind")
+)
+
+// Mutation is one recorded change to a service's records.
+type Mutation struct {
+	// Seq orders the origin's mutations; it is unique per service and
+	// origin.
+	Seq uint64 `json:"seq"`
+	// Kind names the change, as "<service>.<record>.<verb>", and selects
+	// the function that applies it.
+	Kind string `json:"kind"`
+	// Key identifies the record changed.
+	Key string `json:"key"`
+	// Version is the record's modification time after the change, compared
+	// by Supersedes.
+	Version    time.Time       `json:"version"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Data       json.RawMessage `json:"data,omitempty"`
+
+	// Origin is the region that recorded the mutation, and region the one
+	// applying it; both are set by the receiver.
+	Origin string `json:"-"`
+	region string
+}
+
+// storedMutation is a Mutation in the outbox. Sealed holds its data in
+// place of Data when the Replicator has a keyring.
+type storedMutation struct {
+	Mutation
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// Supersedes reports whether m should replace a local record last changed
+// at current: when m's version is later, or equal and m's origin sorts
+// before the local region.
+func (m Mutation) Supersedes(current time.Time) bool {
+	if !m.Version.Equal(current) {
+		return m.Version.After(current)
+	}
+	return m.Origin < m.region
+}
+
+// ApplyFunc applies a replicated mutation to the local store and reports
+// whether it changed anything; false means the local record won a conflict
+// or already reflected the change. It must be safe to call again with the
+// same mutation.
+type ApplyFunc func(ctx context.Context, m Mutation) (bool, error)
+
+// Batch is the body a Replicator sends its peer.
+type Batch struct {
+	Origin    string     `json:"origin"`
+	Mutations []Mutation `json:"mutations"`
+}
+
+// Config tunes a Replicator. Zero values select the defaults.
+type Config struct {
+	// Region names this deployment. Empty disables replication: nothing is
+	// recorded and the peer's batches are refused.
+	Region string
+	// PeerURL is the base URL of the same service in the peer deployment.
+	// Empty records nothing but still applies the peer's batches, for a
+	// standby that only receives.
+	PeerURL string
+	// Interval between checks of the outbox (default 1s), and the first
+	// wait after a failed send, doubled after each further one up to
+	// MaxBackoff (default 1m).
+	Interval   time.Duration
+	MaxBackoff time.Duration
+	// BatchSize is the most mutations sent per request (default 100).
+	BatchSize int
+	// Timeout bounds each request to the peer (default 10s).
+	Timeout time.Duration
+}
+
+// FromConfig reads REPLICATION_REGION, REPLICATION_PEER_URL,
+// REPLICATION_INTERVAL (default 1s), REPLICATION_MAX_BACKOFF (default 1m),
+// REPLICATION_BATCH_SIZE (default 100), and REPLICATION_TIMEOUT (default
+// 10s). A peer without a region is reported rather than ignored.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg := Config{
+		Region:     loader.String("REPLICATION_REGION", ""),
+		Interval:   loader.Duration("REPLICATION_INTERVAL", time.Second),
+		MaxBackoff: loader.Duration("REPLICATION_MAX_BACKOFF", time.Minute),
+		BatchSize:  loader.Int("REPLICATION_BATCH_SIZE", 100),
+		Timeout:    loader.Duration("REPLICATION_TIMEOUT", 10*time.Second),
+	}
+	if strings.Contains(cfg.Region, "/") {
+		return Config{}, fmt.Errorf("%sREPLICATION_REGION: %q may not contain a slash", loader.Prefix, cfg.Region)
+	}
+	peer, err := loader.URL("REPLICATION_PEER_URL", "")
+	if err != nil {
+		return Config{}, err
+	}
+	if peer != nil {
+		if cfg.Region == "" {
+			return Config{}, fmt.Errorf("%sREPLICATION_PEER_URL needs %sREPLICATION_REGION", loader.Prefix, loader.Prefix)
+		}
+		cfg.PeerURL = peer.String()
+	}
+	return cfg, nil
+}
+
+// Replicator records a service's mutations, ships them to the peer, and
+// applies the peer's. Replicas sharing a driver share the outbox; each of
+// them ships it, and the peer drops the duplicates.
+type Replicator struct {
+	db      storage.Driver
+	service string
+	cfg     Config
+	client  *http.Client
+	logger  logging.Printer
+	now     func() time.Time
+
+	// applying serializes Apply, so a batch sent by two of the peer's
+	// replicas at once is applied once.
+	applying sync.Mutex
+
+	keys *encryption.Keyring
+
+	mu             sync.Mutex
+	appliers       map[string]ApplyFunc
+	shipped        shipState
+	recordFailures int64
+}
+
+// shipState is this replica's view of its sends to the peer.
+type shipState struct {
+	lastSeq  uint64
+	lastAt   time.Time
+	lastErr  string
+	failures int
+}
+
+// peerState is the progress of one origin's mutations, stored under
+// "<service>/<origin>" in the peers bucket.
+type peerState struct {
+	LastSeq        uint64    `json:"last_seq"`
+	LastRecordedAt time.Time `json:"last_recorded_at"`
+	LastAppliedAt  time.Time `json:"last_applied_at"`
+	Applied        int64     `json:"applied"`
+	Conflicts      int64     `json:"conflicts"`
+}
+
+// New returns a Replicator for service keeping its outbox in db and
+// sending to the peer through transport (nil uses
+// http.DefaultTransport), which should carry this deployment's
+// credentials.
+func New(db storage.Driver, service string, cfg Config, transport http.RoundTripper, logger logging.Printer) *Replicator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.MaxBackoff < cfg.Interval {
+		cfg.MaxBackoff = max(time.Minute, cfg.Interval)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Replicator{
+		db:       db,
+		service:  service,
+		cfg:      cfg,
+		client:   &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		logger:   logger,
+		now:      func() time.Time { return time.Now().UTC() },
+		appliers: make(map[string]ApplyFunc),
+	}
+}
+
+// Region returns the configured region, empty when replication is
+// disabled.
+func (r *Replicator) Region() string {
+	return r.cfg.Region
+}
+
+// Register applies the peer's mutations of kind with apply. Call it before
+// the service handles requests.
+func (r *Replicator) Register(kind string, apply ApplyFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.appliers[kind] = apply
+}
+
+// SetKeyring seals the data of recorded mutations with k while they wait
+// in the outbox, opening it before a batch is sent, and registers the
+// outbox with k for rotation. Call it before the service handles
+// requests.
+func (r *Replicator) SetKeyring(k *encryption.Keyring) {
+	r.keys = k
+	k.Register(encryption.Resealer{Name: r.service + ".replication_outbox", Reseal: r.reseal})
+}
+
+// Record appends a mutation of kind to the outbox, with value encoded as
+// its data. It records nothing on a nil Replicator or without a peer. A
+// storage failure is logged rather than returned, since the change has
+// already taken effect locally; the peer misses it until the record is
+// next changed.
+func (r *Replicator) Record(ctx context.Context, kind, key string, version time.Time, value any) {
+	if r == nil || r.cfg.PeerURL == "" {
+		return
+	}
+	data, err := json.Marshal(value)
+	entry := storedMutation{Mutation: Mutation{Kind: kind, Key: key, Version: version, Data: data}}
+	if err == nil && r.keys.Enabled() {
+		entry.Data = nil
+		entry.Sealed, err = r.keys.Seal(ctx, data)
+	}
+	if err == nil {
+		err = storage.Update(ctx, r.db, func(tx storage.Tx) error {
+			seq, err := r.sequence(tx)
+			if err != nil {
+				return err
+			}
+			seq++
+			if err := tx.Put(metaBucket, r.service+"/"+sequenceKey, []byte(strconv.FormatUint(seq, 10))); err != nil {
+				return err
+			}
+			entry.Seq, entry.RecordedAt = seq, r.now()
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			return tx.Put(outboxBucket, r.outboxKey(seq), value)
+		})
+	}
+	if err != nil {
+		r.mu.Lock()
+		r.recordFailures++
+		r.mu.Unlock()
+		logging.For(ctx, r.logger).Printf("replication: record %s %s: %v", kind, key, err)
+	}
+}
+
+// reseal re-seals the data of this service's outbox entries not sealed
+// under the active key.
+func (r *Replicator) reseal(ctx context.Context) (int, int, error) {
+	return encryption.ResealBucket(ctx, r.db, outboxBucket, r.service+"/", func(_ string, value []byte) ([]byte, error) {
+		var entry storedMutation
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, err
+		}
+		sealed, err := r.keys.Reseal(ctx, entry.Sealed, entry.Data)
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		entry.Data, entry.Sealed = nil, sealed
+		return json.Marshal(entry)
+	})
+}
+
+// Apply applies the origin's mutations in order, skipping those already
+// applied, and returns the sequence number of the last one applied. The
+// progress made before a failure is kept, so a retried batch resumes after
+// it.
+func (r *Replicator) Apply(ctx context.Context, batch Batch) (uint64, error) {
+	switch {
+	case r.cfg.Region == "":
+		return 0, ErrDisabled
+	case batch.Origin == r.cfg.Region:
+		return 0, ErrLoop
+	case batch.Origin == "" || strings.Contains(batch.Origin, "/"):
+		return 0, fmt.Errorf("replication: invalid origin %q", batch.Origin)
+	}
+	r.applying.Lock()
+	defer r.applying.Unlock()
+	state, err := r.peer(ctx, batch.Origin)
+	if err != nil {
+		return 0, err
+	}
+	start := state
+	for _, m := range batch.Mutations {
+		if m.Seq <= state.LastSeq {
+			continue
+		}
+		r.mu.Lock()
+		apply, ok := r.appliers[m.Kind]
+		r.mu.Unlock()
+		if !ok {
+			err = fmt.Errorf("%w %q", ErrUnknownKind, m.Kind)
+			break
+		}
+		m.Origin, m.region = batch.Origin, r.cfg.Region
+		applied, applyErr := apply(ctx, m)
+		if applyErr != nil {
+			err = fmt.Errorf("replication: apply %s %s: %w", m.Kind, m.Key, applyErr)
+			break
+		}
+		if applied {
+			state.Applied++
+		} else {
+			state.Conflicts++
+		}
+		state.LastSeq = m.Seq
+		state.LastRecordedAt = m.RecordedAt
+		state.LastAppliedAt = r.now()
+	}
+	if state != start {
+		if saveErr := r.savePeer(ctx, batch.Origin, state); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+	return state.LastSeq, err
+}
+
+// Status describes replication to and from this deployment.
+type Status struct {
+	Service string `json:"service"`
+	Region  string `json:"region"`
+	PeerURL string `json:"peer_url,omitempty"`
+	// Kinds lists the mutations this service applies.
+	Kinds  []string     `json:"kinds"`
+	Outbox OutboxStatus `json:"outbox"`
+	// Peers lists each origin whose mutations were applied here.
+	Peers []PeerStatus `json:"peers"`
+}
+
+// OutboxStatus describes the mutations waiting for the peer. The shipping
+// fields describe this replica's own sends.
+type OutboxStatus struct {
+	Pending int `json:"pending"`
+	// LagSeconds is the age of the oldest pending mutation, zero when the
+	// outbox is empty.
+	LagSeconds       float64    `json:"lag_seconds"`
+	OldestRecordedAt *time.Time `json:"oldest_recorded_at,omitempty"`
+	LastShippedSeq   uint64     `json:"last_shipped_seq"`
+	LastShippedAt    *time.Time `json:"last_shipped_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	// Failures counts consecutive failed sends.
+	Failures int `json:"failures"`
+	// RecordFailures counts mutations that could not be recorded.
+	RecordFailures int64 `json:"record_failures"`
+}
+
+// PeerStatus describes the mutations applied from one origin.
+type PeerStatus struct {
+	Origin         string    `json:"origin"`
+	LastSeq        uint64    `json:"last_seq"`
+	LastRecordedAt time.Time `json:"last_recorded_at"`
+	LastAppliedAt  time.Time `json:"last_applied_at"`
+	// LagSeconds is how long the last mutation took to arrive.
+	LagSeconds float64 `json:"lag_seconds"`
+	Applied    int64   `json:"applied"`
+	// Conflicts counts mutations the local record won, or that changed
+	// nothing.
+	Conflicts int64 `json:"conflicts"`
+}
+
+// Status reports the outbox and each origin's progress.
+func (r *Replicator) Status(ctx context.Context) (Status, error) {
+	status := Status{Service: r.service, Region: r.cfg.Region, PeerURL: r.cfg.PeerURL, Kinds: r.kinds(), Peers: make([]PeerStatus, 0)}
+	err := storage.View(ctx, r.db, func(tx storage.Tx) error {
+		err := tx.Scan(outboxBucket, r.service+"/", func(_ string, value []byte) error {
+			if status.Outbox.Pending == 0 {
+				var m Mutation
+				if err := json.Unmarshal(value, &m); err != nil {
+					return err
+				}
+				status.Outbox.OldestRecordedAt = &m.RecordedAt
+			}
+			status.Outbox.Pending++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Scan(peersBucket, r.service+"/", func(key string, value []byte) error {
+			var state peerState
+			if err := json.Unmarshal(value, &state); err != nil {
+				return err
+			}
+			status.Peers = append(status.Peers, PeerStatus{
+				Origin:         strings.TrimPrefix(key, r.service+"/"),
+				LastSeq:        state.LastSeq,
+				LastRecordedAt: state.LastRecordedAt,
+				LastAppliedAt:  state.LastAppliedAt,
+				LagSeconds:     state.LastAppliedAt.Sub(state.LastRecordedAt).Seconds(),
+				Applied:        state.Applied,
+				Conflicts:      state.Conflicts,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return Status{}, err
+	}
+	if oldest := status.Outbox.OldestRecordedAt; oldest != nil {
+		status.Outbox.LagSeconds = r.now().Sub(*oldest).Seconds()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status.Outbox.LastShippedSeq = r.shipped.lastSeq
+	if !r.shipped.lastAt.IsZero() {
+		at := r.shipped.lastAt
+		status.Outbox.LastShippedAt = &at
+	}
+	status.Outbox.LastError = r.shipped.lastErr
+	status.Outbox.Failures = r.shipped.failures
+	status.Outbox.RecordFailures = r.recordFailures
+	return status, nil
+}
+
+// kinds returns the registered kinds in order.
+func (r *Replicator) kinds() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kinds := make([]string, 0, len(r.appliers))
+	for kind := range r.appliers {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
+
+func (r *Replicator) outboxKey(seq uint64) string {
+	return fmt.Sprintf("%s/%020d", r.service, seq)
+}
+
+// sequence returns the number of the latest recorded mutation, zero when
+// none has been.
+func (r *Replicator) sequence(tx storage.Tx) (uint64, error) {
+	raw, err := tx.Get(metaBucket, r.service+"/"+sequenceKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseUint(string(raw), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("replication: corrupt sequence: %w", err)
+	}
+	return seq, nil
+}
+
+func (r *Replicator) peer(ctx context.Context, origin string) (peerState, error) {
+	var state peerState
+	err := storage.View(ctx, r.db, func(tx storage.Tx) error {
+		raw, err := tx.Get(peersBucket, r.service+"/"+origin)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, &state)
+	})
+	return state, err
+}
+
+func (r *Replicator) savePeer(ctx context.Context, origin string, state peerState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return storage.Update(ctx, r.db, func(tx storage.Tx) error {
+		return tx.Put(peersBucket, r.service+"/"+origin, data)
+	})
+}
+
+// applyURL is where the peer's Handler accepts batches.
+func (r *Replicator) applyURL() (string, error) {
+	u, err := url.Parse(r.cfg.PeerURL)
+	if err != nil {
+		return "", err
+	}
+	return u.JoinPath(Path, "apply").String(), nil
+}
@@ -0,0 +1,237 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+// record is what the tests replicate: a value stamped with its version.
+type record struct {
+	Value   string    `json:"value"`
+	Version time.Time `json:"version"`
+}
+
+// peerServer runs r's Handler as the peer would mount it.
+func peerServer(t *testing.T, r *Replicator) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(r.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// applyInto returns an ApplyFunc keeping records in store by key, with
+// last-writer-wins conflicts.
+func applyInto(store map[string]record) ApplyFunc {
+	return func(_ context.Context, m Mutation) (bool, error) {
+		var rec record
+		if err := json.Unmarshal(m.Data, &rec); err != nil {
+			return false, err
+		}
+		if current, ok := store[m.Key]; ok && !m.Supersedes(current.Version) {
+			return false, nil
+		}
+		store[m.Key] = rec
+		return true, nil
+	}
+}
+
+func TestShipAppliesInOrderAndSkipsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	standby := New(storage.NewMemory(), "svc", Config{Region: "eu-west"}, nil, noopLogger{})
+	received := make(map[string]record)
+	standby.Register("svc.record.put", applyInto(received))
+	srv := peerServer(t, standby)
+
+	primaryDB := storage.NewMemory()
+	primary := New(primaryDB, "svc", Config{Region: "us-east", PeerURL: srv.URL, BatchSize: 2}, nil, noopLogger{})
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, value := range []string{"a", "b", "c"} {
+		version := at.Add(time.Duration(i) * time.Second)
+		primary.Record(ctx, "svc.record.put", "k", version, record{Value: value, Version: version})
+	}
+	// A replica sharing the driver ships the same outbox.
+	twin := New(primaryDB, "svc", Config{Region: "us-east", PeerURL: srv.URL}, nil, noopLogger{})
+	if n, err := twin.Ship(ctx); err != nil || n != 3 {
+		t.Fatalf("twin ship: %d %v", n, err)
+	}
+	if err := storage.Update(ctx, primaryDB, func(tx storage.Tx) error {
+		// Put the first two back, as if the twin's delete had not run.
+		for seq := uint64(1); seq <= 2; seq++ {
+			data, _ := json.Marshal(Mutation{Seq: seq, Kind: "svc.record.put", Key: "k", Version: at, Data: json.RawMessage(`{"value":"stale"}`)})
+			if err := tx.Put(outboxBucket, primary.outboxKey(seq), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := primary.Ship(ctx); err != nil || n != 2 {
+		t.Fatalf("primary ship: %d %v", n, err)
+	}
+	if received["k"].Value != "c" {
+		t.Fatalf("expected the latest value to stay, got %+v", received)
+	}
+
+	status, err := standby.Status(ctx)
+	if err != nil || len(status.Peers) != 1 || status.Peers[0].Origin != "us-east" || status.Peers[0].LastSeq != 3 || status.Peers[0].Applied != 3 {
+		t.Fatalf("unexpected standby status %+v %v", status, err)
+	}
+	status, err = primary.Status(ctx)
+	if err != nil || status.Outbox.Pending != 0 || status.Outbox.LastShippedSeq != 3 || status.Outbox.Failures != 0 {
+		t.Fatalf("unexpected primary status %+v %v", status, err)
+	}
+}
+
+func TestShipKeepsRefusedMutations(t *testing.T) {
+	ctx := context.Background()
+	standby := New(storage.NewMemory(), "svc", Config{Region: "eu-west"}, nil, noopLogger{})
+	standby.Register("svc.record.put", applyInto(make(map[string]record)))
+	srv := peerServer(t, standby)
+	primary := New(storage.NewMemory(), "svc", Config{Region: "us-east", PeerURL: srv.URL}, nil, noopLogger{})
+	now := time.Now()
+	primary.Record(ctx, "svc.record.put", "a", now, record{Value: "a"})
+	primary.Record(ctx, "svc.record.delete", "a", now, nil)
+	primary.Record(ctx, "svc.record.put", "b", now, record{Value: "b"})
+
+	if _, err := primary.Ship(ctx); err == nil || !strings.Contains(err.Error(), "422") {
+		t.Fatalf("expected the unknown kind to be refused, got %v", err)
+	}
+	status, err := primary.Status(ctx)
+	if err != nil || status.Outbox.Pending != 3 || status.Outbox.Failures != 1 || status.Outbox.LastError == "" || status.Outbox.OldestRecordedAt == nil {
+		t.Fatalf("expected the outbox kept, got %+v %v", status, err)
+	}
+	// The mutation before the refused one was applied and is not sent again.
+	standby.Register("svc.record.delete", func(context.Context, Mutation) (bool, error) { return true, nil })
+	if n, err := primary.Ship(ctx); err != nil || n != 3 {
+		t.Fatalf("retry: %d %v", n, err)
+	}
+	if status, _ := standby.Status(ctx); status.Peers[0].Applied != 3 || status.Peers[0].Conflicts != 0 {
+		t.Fatalf("expected each mutation applied once, got %+v", status.Peers)
+	}
+}
+
+func TestApplyRefusesLoopsAndDisabledRegions(t *testing.T) {
+	ctx := context.Background()
+	batch := Batch{Origin: "us-east", Mutations: []Mutation{{Seq: 1, Kind: "svc.record.put"}}}
+	if _, err := New(storage.NewMemory(), "svc", Config{}, nil, noopLogger{}).Apply(ctx, batch); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+	if _, err := New(storage.NewMemory(), "svc", Config{Region: "us-east"}, nil, noopLogger{}).Apply(ctx, batch); !errors.Is(err, ErrLoop) {
+		t.Fatalf("expected ErrLoop, got %v", err)
+	}
+}
+
+func TestRecordWithoutPeerIsNoop(t *testing.T) {
+	ctx := context.Background()
+	r := New(storage.NewMemory(), "svc", Config{Region: "eu-west"}, nil, noopLogger{})
+	r.Record(ctx, "svc.record.put", "k", time.Now(), record{})
+	var nilReplicator *Replicator
+	nilReplicator.Record(ctx, "svc.record.put", "k", time.Now(), record{})
+	if status, err := r.Status(ctx); err != nil || status.Outbox.Pending != 0 {
+		t.Fatalf("expected nothing recorded, got %+v %v", status, err)
+	}
+}
+
+func TestSupersedesBreaksTiesByRegion(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		version        time.Time
+		origin, region string
+		want           bool
+	}{
+		{at.Add(time.Second), "us-east", "eu-west", true},
+		{at.Add(-time.Second), "eu-west", "us-east", false},
+		{at, "eu-west", "us-east", true},
+		{at, "us-east", "eu-west", false},
+	} {
+		m := Mutation{Version: tc.version, Origin: tc.origin, region: tc.region}
+		if got := m.Supersedes(at); got != tc.want {
+			t.Errorf("%s from %s into %s: expected %v, got %v", tc.version, tc.origin, tc.region, tc.want, got)
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	t.Setenv("SVC_REPLICATION_REGION", "us-east")
+	t.Setenv("SVC_REPLICATION_PEER_URL", "https://eu.example.com/messaging")
+	t.Setenv("SVC_REPLICATION_BATCH_SIZE", "10")
+	loader, err := config.Load("SVC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := FromConfig(loader)
+	if err != nil || cfg.Region != "us-east" || cfg.BatchSize != 10 || cfg.Interval != time.Second {
+		t.Fatalf("unexpected config %+v %v", cfg, err)
+	}
+	if target, err := New(nil, "svc", cfg, nil, noopLogger{}).applyURL(); err != nil || target != "https://eu.example.com/messaging/replication/apply" {
+		t.Fatalf("unexpected apply URL %q %v", target, err)
+	}
+
+	t.Setenv("SVC_REPLICATION_REGION", "")
+	if loader, err = config.Load("SVC", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromConfig(loader); err == nil {
+		t.Fatal("expected a peer without a region to be rejected")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := New(storage.NewMemory(), "svc", Config{Region: "eu-west"}, nil, noopLogger{})
+	r.Register("svc.record.put", applyInto(make(map[string]record)))
+	h := r.Handler()
+	serve := func(method, target, body string, p auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req = req.WithContext(auth.NewContext(req.Context(), p))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	peer := auth.Principal{Subject: "us-east"}
+
+	rec := serve(http.MethodPost, "/replication/apply", `{"origin":"us-east","mutations":[{"seq":4,"kind":"svc.record.put","key":"k","data":{"value":"a"}}]}`, peer)
+	var applied appliedResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &applied) != nil || applied.Applied != 4 {
+		t.Fatalf("apply: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(http.MethodGet, "/replication", "", peer)
+	var status Status
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &status) != nil || len(status.Kinds) != 1 || len(status.Peers) != 1 {
+		t.Fatalf("status: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		method, target, body string
+		principal            auth.Principal
+		status               int
+	}{
+		{http.MethodPost, "/replication/apply", `{"origin":"eu-west"}`, peer, http.StatusConflict},
+		{http.MethodPost, "/replication/apply", `{"origin":"us/east"}`, peer, http.StatusBadRequest},
+		{http.MethodPost, "/replication/apply", `{"origin":""}`, peer, http.StatusBadRequest},
+		{http.MethodPost, "/replication/apply", `[`, peer, http.StatusBadRequest},
+		{http.MethodPost, "/replication/apply", `{"origin":"us-east","mutations":[{"seq":5,"kind":"svc.other"}]}`, peer, http.StatusUnprocessableEntity},
+		{http.MethodGet, "/replication/apply", "", peer, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/replication", "", peer, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/replication/other", "", peer, http.StatusNotFound},
+		{http.MethodGet, "/replication", "", auth.Principal{Subject: "acme", Tenant: "acme"}, http.StatusForbidden},
+	} {
+		if rec := serve(tc.method, tc.target, tc.body, tc.principal); rec.Code != tc.status {
+			t.Errorf("%s %s %s: expected %d, got %d %s", tc.method, tc.target, tc.body, tc.status, rec.Code, rec.Body)
+		}
+	}
+}
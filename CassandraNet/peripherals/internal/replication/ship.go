@@ -0,0 +1,144 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// maxErrorBody bounds how much of a refused batch's response is kept in
+// the error.
+const maxErrorBody = 512
+
+// appliedResponse is the peer's answer to a batch.
+type appliedResponse struct {
+	Applied uint64 `json:"applied"`
+}
+
+// Run ships the outbox to the peer until ctx is cancelled, backing off
+// after failures. Without a peer it only waits for ctx.
+func (r *Replicator) Run(ctx context.Context) error {
+	if r.cfg.PeerURL == "" {
+		<-ctx.Done()
+		return nil
+	}
+	wait := r.cfg.Interval
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		sent, err := r.Ship(ctx)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil
+			}
+			r.logger.Printf("replication: ship to %s: %v", r.cfg.PeerURL, err)
+			wait = min(wait*2, r.cfg.MaxBackoff)
+		case sent == r.cfg.BatchSize:
+			// More may be waiting; send it without pausing.
+			wait = 0
+		default:
+			wait = r.cfg.Interval
+		}
+		timer.Reset(wait)
+	}
+}
+
+// Ship sends the oldest batch of the outbox to the peer and removes what
+// the peer applied, returning how many mutations it sent.
+func (r *Replicator) Ship(ctx context.Context) (int, error) {
+	batch := Batch{Origin: r.cfg.Region}
+	err := storage.View(ctx, r.db, func(tx storage.Tx) error {
+		return tx.Scan(outboxBucket, r.service+"/", func(_ string, value []byte) error {
+			var entry storedMutation
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			if entry.Sealed != nil {
+				data, err := r.keys.Open(ctx, entry.Sealed)
+				if err != nil {
+					return fmt.Errorf("open mutation %d: %w", entry.Seq, err)
+				}
+				entry.Data = data
+			}
+			batch.Mutations = append(batch.Mutations, entry.Mutation)
+			if len(batch.Mutations) == r.cfg.BatchSize {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil || len(batch.Mutations) == 0 {
+		return 0, err
+	}
+	applied, err := r.send(ctx, batch)
+	if err == nil {
+		err = storage.Update(ctx, r.db, func(tx storage.Tx) error {
+			for _, m := range batch.Mutations {
+				if m.Seq > applied {
+					break
+				}
+				if err := tx.Delete(outboxBucket, r.outboxKey(m.Seq)); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.shipped.lastErr = err.Error()
+		r.shipped.failures++
+		return 0, err
+	}
+	r.shipped.lastSeq = applied
+	r.shipped.lastAt = r.now()
+	r.shipped.lastErr = ""
+	r.shipped.failures = 0
+	return len(batch.Mutations), nil
+}
+
+// send posts batch to the peer and returns the sequence number of the last
+// mutation it applied.
+func (r *Replicator) send(ctx context.Context, batch Batch) (uint64, error) {
+	target, err := r.applyURL()
+	if err != nil {
+		return 0, err
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return 0, fmt.Errorf("peer answered %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var out appliedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, fmt.Errorf("decode peer response: %w", err)
+	}
+	return out.Applied, nil
+}
@@ -0,0 +1,127 @@
+package retention
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the retention endpoints.
+const (
+	codeInvalidRequest = "retention.invalid_request"
+	codeNotFound       = "retention.not_found"
+	codeForbidden      = "retention.forbidden_tenant"
+	codeDisabled       = "retention.disabled"
+	codeRunning        = "retention.already_running"
+	codePurgeFailed    = "retention.purge_failed"
+)
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/retention"
+
+// Handler serves the retention API:
+//
+//	GET  /retention                 every policy with its last report
+//	GET  /retention/{name}/reports  the policy's recent reports
+//	POST /retention/{name}/run      runs the policy now
+//
+// A run takes dry_run=true or false, defaulting to the policy's configured
+// mode, and answers with its report. Policies span every tenant, so
+// callers bound to a tenant are refused; reads require
+// auth.PermRetentionRead and runs auth.PermRetentionManage.
+func (m *Manager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, _ := auth.FromContext(r.Context()); p.Tenant != "" {
+			problem.Write(w, r, http.StatusForbidden, codeForbidden, "retention policies span every tenant; use credentials not bound to one")
+			return
+		}
+		if r.URL.Path == Path || r.URL.Path == Path+"/" {
+			m.handleList(w, r)
+			return
+		}
+		name, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, Path+"/"), "/")
+		if _, known := m.lookup(name); !ok || !known {
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+		switch action {
+		case "reports":
+			m.handleReports(w, r, name)
+		case "run":
+			m.handleRun(w, r, name)
+		default:
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		}
+	})
+}
+
+func (m *Manager) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "retention", http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermRetentionRead, "", "") {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": m.Policies()})
+}
+
+func (m *Manager) handleReports(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "retention", http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermRetentionRead, "", "") {
+		return
+	}
+	reports, err := m.Reports(name)
+	if err != nil {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"items": reports})
+}
+
+func (m *Manager) handleRun(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		problem.MethodNotAllowed(w, r, "retention", http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermRetentionManage, "", "") {
+		return
+	}
+	var dryRun *bool
+	if raw := r.URL.Query().Get("dry_run"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			validation.Write(w, r, codeInvalidRequest, validation.Invalid("dry_run", validation.RuleFormat, "must be true or false"))
+			return
+		}
+		dryRun = &parsed
+	}
+	report, err := m.Apply(r.Context(), name, dryRun, TriggerManual)
+	switch {
+	case errors.Is(err, ErrDisabled):
+		problem.Write(w, r, http.StatusConflict, codeDisabled, name+" has no maximum age configured")
+	case errors.Is(err, ErrRunning):
+		problem.Write(w, r, http.StatusConflict, codeRunning, name+" is already running")
+	case err != nil:
+		logging.For(r.Context(), m.logger).Printf("retention: run %s: %v", name, err)
+		problem.Write(w, r, http.StatusInternalServerError, codePurgeFailed, name+" failed after "+strconv.Itoa(report.Records)+" records: "+err.Error())
+	default:
+		writeJSON(w, http.StatusOK, report)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,418 @@
+// Package retention purges records that services keep longer than they
+// are needed. Each service registers a Policy for every kind of record it
+// accumulates — messages, notification history, audit entries, metrics
+// windows, archived UGC — with a function that removes the records older
+// than a cutoff, and a Manager runs every policy on an interval:
+//
+//	cfg, err := retention.FromConfig(loader)
+//	manager := retention.New(cfg, logger)
+//	svc.RegisterRetention(manager)
+//	group.Go("retention", manager.Run)
+//
+// A policy in dry-run mode only counts what it would remove. Every run,
+// scheduled or requested through Handler at /retention, leaves a Report,
+// so operators can check a policy's effect before enabling it.
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// BatchSize bounds how many records a purge function removes in one
+// storage transaction, so a large backlog does not become one huge write.
+const BatchSize = 500
+
+// Triggers recorded in reports.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Errors returned by Manager.Apply.
+var (
+	ErrUnknownPolicy = errors.New("retention: no such policy")
+	ErrDisabled      = errors.New("retention: policy is disabled")
+	ErrRunning       = errors.New("retention: policy is already running")
+)
+
+// PurgeFunc removes the records last changed before cutoff and returns how
+// many it removed. With dryRun it removes nothing and returns how many it
+// would have removed.
+type PurgeFunc func(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+
+// Policy is one kind of record and how long it is kept.
+type Policy struct {
+	// Name identifies the policy as "<service>.<records>", such as
+	// "messaging.messages".
+	Name string
+	// Description says which records the policy removes.
+	Description string
+	// MaxAge is how long records are kept unless the configuration says
+	// otherwise. Zero keeps them until a configured age enables the policy.
+	MaxAge time.Duration
+	// Purge removes the expired records.
+	Purge PurgeFunc
+}
+
+// Config tunes a Manager. Zero values select the defaults.
+type Config struct {
+	// Interval between scheduled runs of every policy (default 1h).
+	Interval time.Duration
+	// MaxAges override the registered policies' ages by name; zero
+	// disables a policy.
+	MaxAges map[string]time.Duration
+	// DryRun lists the policies that only report what they would remove;
+	// "*" selects every policy.
+	DryRun []string
+	// History is how many reports are kept per policy (default 20).
+	History int
+}
+
+// FromConfig reads RETENTION_INTERVAL (default 1h), RETENTION_MAX_AGES
+// ("name=duration" entries, such as "messaging.messages=72h"; "0" disables
+// a policy), RETENTION_DRY_RUN (policy names, or "*"), and
+// RETENTION_HISTORY (default 20). Malformed ages are reported rather than
+// ignored.
+func FromConfig(loader config.Loader) (Config, error) {
+	cfg := Config{
+		Interval: loader.Duration("RETENTION_INTERVAL", time.Hour),
+		DryRun:   loader.StringSlice("RETENTION_DRY_RUN", nil),
+		History:  loader.Int("RETENTION_HISTORY", 20),
+	}
+	for _, spec := range loader.StringSlice("RETENTION_MAX_AGES", nil) {
+		name, raw, ok := strings.Cut(spec, "=")
+		name, raw = strings.TrimSpace(name), strings.TrimSpace(raw)
+		if !ok || name == "" {
+			return Config{}, fmt.Errorf("%sRETENTION_MAX_AGES: %q must be name=duration", loader.Prefix, spec)
+		}
+		age, err := time.ParseDuration(raw)
+		if err != nil || age < 0 {
+			return Config{}, fmt.Errorf("%sRETENTION_MAX_AGES: %q needs a duration such as 720h", loader.Prefix, spec)
+		}
+		if cfg.MaxAges == nil {
+			cfg.MaxAges = make(map[string]time.Duration)
+		}
+		cfg.MaxAges[name] = age
+	}
+	return cfg, nil
+}
+
+// Report is the outcome of one run of a policy.
+type Report struct {
+	Policy     string    `json:"policy"`
+	Trigger    string    `json:"trigger"`
+	DryRun     bool      `json:"dry_run"`
+	Cutoff     time.Time `json:"cutoff"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Records counts the records removed, or on a dry run the records
+	// that would have been.
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Status describes a registered policy.
+type Status struct {
+	Name          string  `json:"name"`
+	Description   string  `json:"description"`
+	MaxAgeSeconds int64   `json:"max_age_seconds"`
+	Enabled       bool    `json:"enabled"`
+	DryRun        bool    `json:"dry_run"`
+	LastReport    *Report `json:"last_report,omitempty"`
+}
+
+// entry is a registered policy with its reports.
+type entry struct {
+	policy  Policy
+	running sync.Mutex
+	reports []Report // newest last
+}
+
+// Manager runs the registered policies.
+type Manager struct {
+	cfg    Config
+	logger logging.Printer
+	clock  clock.Clock
+	locker lock.Locker
+
+	mu       sync.Mutex
+	policies map[string]*entry
+}
+
+// New returns a manager without policies.
+func New(cfg Config, logger logging.Printer) *Manager {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.History <= 0 {
+		cfg.History = 20
+	}
+	return &Manager{
+		cfg:      cfg,
+		logger:   logger,
+		clock:    clock.System,
+		policies: make(map[string]*entry),
+	}
+}
+
+// SetLocker has one replica sharing l run the scheduled purges of this
+// manager's policies at a time; the others skip their runs until its
+// lease lapses or it stops. Call it before Run.
+func (m *Manager) SetLocker(l lock.Locker) {
+	m.locker = l
+}
+
+// SetClock times runs and schedules them by c instead of the system
+// clock. Call it before Run.
+func (m *Manager) SetClock(c clock.Clock) {
+	m.clock = clock.Or(c)
+}
+
+// Register adds p, replacing any policy with the same name. Call it before
+// the manager runs.
+func (m *Manager) Register(p Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policies[p.Name] = &entry{policy: p}
+}
+
+// maxAge returns the age p keeps records for, zero when it is disabled.
+func (m *Manager) maxAge(p Policy) time.Duration {
+	if age, ok := m.cfg.MaxAges[p.Name]; ok {
+		return age
+	}
+	return p.MaxAge
+}
+
+func (m *Manager) dryRun(name string) bool {
+	return slices.Contains(m.cfg.DryRun, name) || slices.Contains(m.cfg.DryRun, "*")
+}
+
+func (m *Manager) lookup(name string) (*entry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.policies[name]
+	return e, ok
+}
+
+// names returns the registered policies' names in order.
+func (m *Manager) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.policies))
+	for name := range m.policies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Policies describes every registered policy, ordered by name.
+func (m *Manager) Policies() []Status {
+	out := make([]Status, 0)
+	for _, name := range m.names() {
+		e, _ := m.lookup(name)
+		age := m.maxAge(e.policy)
+		status := Status{
+			Name:          name,
+			Description:   e.policy.Description,
+			MaxAgeSeconds: int64(age / time.Second),
+			Enabled:       age > 0,
+			DryRun:        m.dryRun(name),
+		}
+		m.mu.Lock()
+		if n := len(e.reports); n > 0 {
+			last := e.reports[n-1]
+			status.LastReport = &last
+		}
+		m.mu.Unlock()
+		out = append(out, status)
+	}
+	return out
+}
+
+// Reports returns the policy's kept reports, newest first.
+func (m *Manager) Reports(name string) ([]Report, error) {
+	e, ok := m.lookup(name)
+	if !ok {
+		return nil, ErrUnknownPolicy
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Report, len(e.reports))
+	for i, report := range e.reports {
+		out[len(out)-1-i] = report
+	}
+	return out, nil
+}
+
+// Apply runs the named policy now. dryRun, when set, overrides the
+// configured mode. A purge failure is returned and recorded in the report;
+// a policy that is disabled or already running is not run.
+func (m *Manager) Apply(ctx context.Context, name string, dryRun *bool, trigger string) (Report, error) {
+	e, ok := m.lookup(name)
+	if !ok {
+		return Report{}, ErrUnknownPolicy
+	}
+	age := m.maxAge(e.policy)
+	if age <= 0 {
+		return Report{}, ErrDisabled
+	}
+	if !e.running.TryLock() {
+		return Report{}, ErrRunning
+	}
+	defer e.running.Unlock()
+
+	report := Report{Policy: name, Trigger: trigger, DryRun: m.dryRun(name), StartedAt: m.clock.Now()}
+	if dryRun != nil {
+		report.DryRun = *dryRun
+	}
+	report.Cutoff = report.StartedAt.Add(-age)
+	records, err := e.policy.Purge(ctx, report.Cutoff, report.DryRun)
+	report.Records = records
+	report.FinishedAt = m.clock.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	m.mu.Lock()
+	e.reports = append(e.reports, report)
+	if over := len(e.reports) - m.cfg.History; over > 0 {
+		e.reports = slices.Delete(e.reports, 0, over)
+	}
+	m.mu.Unlock()
+
+	switch {
+	case err != nil:
+		m.logger.Printf("retention: %s failed after %d records: %v", name, records, err)
+		return report, err
+	case report.DryRun:
+		m.logger.Printf("retention: %s would purge %d records older than %s", name, records, report.Cutoff.Format(time.RFC3339))
+	case records > 0:
+		m.logger.Printf("retention: %s purged %d records older than %s", name, records, report.Cutoff.Format(time.RFC3339))
+	}
+	return report, nil
+}
+
+// RunOnce applies every enabled policy in name order. Failures are logged
+// and reported, and do not stop the remaining policies.
+func (m *Manager) RunOnce(ctx context.Context) {
+	for _, name := range m.names() {
+		if ctx.Err() != nil {
+			return
+		}
+		if _, err := m.Apply(ctx, name, nil, TriggerSchedule); errors.Is(err, ErrRunning) {
+			m.logger.Printf("retention: skipped %s: a manual run is in progress", name)
+		}
+	}
+}
+
+// Run applies every policy each interval until ctx is cancelled. The first
+// run happens one interval after start, so restarts do not purge in a
+// burst.
+func (m *Manager) Run(ctx context.Context) error {
+	for name := range m.cfg.MaxAges {
+		if _, ok := m.lookup(name); !ok {
+			m.logger.Printf("retention: RETENTION_MAX_AGES names unknown policy %q", name)
+		}
+	}
+	// Services sharing storage register different policies, so the lease
+	// is named after them.
+	lease := lock.NewLease(m.locker, "retention."+strings.Join(m.names(), ","), 2*m.cfg.Interval)
+	ticker := m.clock.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			_ = lease.Release(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C():
+			held, err := lease.Held(ctx)
+			if err != nil && ctx.Err() == nil {
+				m.logger.Printf("retention: take lease: %v", err)
+			}
+			if held {
+				m.RunOnce(ctx)
+			}
+		}
+	}
+}
+
+// PurgeBucket is a PurgeFunc body for stores on a storage driver. It
+// removes the records of bucket that expired reports true for, BatchSize
+// per transaction, calling remove, when set, in the same transaction to
+// drop whatever else refers to each one, such as index entries. expired
+// may return storage.StopScan to end a scan early, as stores keyed in time
+// order do at their first live record. With dryRun it only counts.
+func PurgeBucket(ctx context.Context, db storage.Driver, bucket string, dryRun bool,
+	expired func(key string, value []byte) (bool, error),
+	remove func(tx storage.Tx, key string, value []byte) error) (int, error) {
+	if dryRun {
+		count := 0
+		err := storage.View(ctx, db, func(tx storage.Tx) error {
+			return tx.Scan(bucket, "", func(key string, value []byte) error {
+				ok, err := expired(key, value)
+				if ok {
+					count++
+				}
+				return err
+			})
+		})
+		return count, err
+	}
+	removed := 0
+	for {
+		batch := 0
+		err := storage.Update(ctx, db, func(tx storage.Tx) error {
+			type record struct {
+				key   string
+				value []byte
+			}
+			var records []record
+			err := tx.Scan(bucket, "", func(key string, value []byte) error {
+				ok, err := expired(key, value)
+				if ok {
+					records = append(records, record{key: key, value: slices.Clone(value)})
+				}
+				if err == nil && len(records) == BatchSize {
+					err = storage.StopScan
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			for _, rec := range records {
+				if err := tx.Delete(bucket, rec.key); err != nil {
+					return err
+				}
+				if remove != nil {
+					if err := remove(tx, rec.key, rec.value); err != nil {
+						return err
+					}
+				}
+			}
+			batch = len(records)
+			return nil
+		})
+		if err != nil {
+			return removed, err
+		}
+		removed += batch
+		if batch < BatchSize {
+			return removed, nil
+		}
+	}
+}
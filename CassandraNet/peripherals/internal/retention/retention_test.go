@@ -0,0 +1,268 @@
+package retention
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+func TestApplyHonoursAgesAndDryRuns(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := New(Config{MaxAges: map[string]time.Duration{"b.records": time.Hour, "c.records": 0}, DryRun: []string{"a.records"}, History: 2}, noopLogger{})
+	m.SetClock(clock.NewFake(now))
+	var dryRuns []bool
+	purge := func(_ context.Context, _ time.Time, dryRun bool) (int, error) {
+		dryRuns = append(dryRuns, dryRun)
+		return 3, nil
+	}
+	for _, name := range []string{"a.records", "b.records", "c.records"} {
+		m.Register(Policy{Name: name, MaxAge: 24 * time.Hour, Purge: purge})
+	}
+	ctx := context.Background()
+
+	report, err := m.Apply(ctx, "a.records", nil, TriggerManual)
+	if err != nil || !report.DryRun || report.Records != 3 || !report.Cutoff.Equal(now.Add(-24*time.Hour)) {
+		t.Fatalf("expected a configured dry run a day back, got %+v %v", report, err)
+	}
+	wet := false
+	if report, err = m.Apply(ctx, "a.records", &wet, TriggerManual); err != nil || report.DryRun {
+		t.Fatalf("expected the override to purge, got %+v %v", report, err)
+	}
+	if report, err = m.Apply(ctx, "b.records", nil, TriggerSchedule); err != nil || !report.Cutoff.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("expected the configured age, got %+v %v", report, err)
+	}
+	if _, err := m.Apply(ctx, "c.records", nil, TriggerManual); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected ErrDisabled, got %v", err)
+	}
+	if _, err := m.Apply(ctx, "missing", nil, TriggerManual); !errors.Is(err, ErrUnknownPolicy) {
+		t.Fatalf("expected ErrUnknownPolicy, got %v", err)
+	}
+	if len(dryRuns) != 3 || !dryRuns[0] || dryRuns[1] || dryRuns[2] {
+		t.Fatalf("unexpected purge calls %v", dryRuns)
+	}
+
+	m.RunOnce(ctx)
+	reports, err := m.Reports("a.records")
+	if err != nil || len(reports) != 2 || reports[0].Trigger != TriggerSchedule || !reports[0].DryRun || reports[1].DryRun {
+		t.Fatalf("expected the two newest reports, got %+v %v", reports, err)
+	}
+	policies := m.Policies()
+	if len(policies) != 3 || policies[2].Enabled || !policies[0].DryRun || policies[1].MaxAgeSeconds != 3600 || policies[1].LastReport == nil {
+		t.Fatalf("unexpected policies %+v", policies)
+	}
+}
+
+func TestRunSweepsEachInterval(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	m := New(Config{Interval: time.Hour}, noopLogger{})
+	m.SetClock(fake)
+	cutoffs := make(chan time.Time, 4)
+	m.Register(Policy{Name: "a.records", MaxAge: 24 * time.Hour, Purge: func(_ context.Context, cutoff time.Time, _ bool) (int, error) {
+		cutoffs <- cutoff
+		return 0, nil
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	for fake.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	fake.Advance(59 * time.Minute)
+	select {
+	case cutoff := <-cutoffs:
+		t.Fatalf("expected no sweep before the interval, got one with cutoff %v", cutoff)
+	case <-time.After(20 * time.Millisecond):
+	}
+	for i, step := range []time.Duration{time.Minute, time.Hour} {
+		fake.Advance(step)
+		select {
+		case cutoff := <-cutoffs:
+			if want := start.Add(time.Duration(i+1)*time.Hour - 24*time.Hour); !cutoff.Equal(want) {
+				t.Fatalf("expected sweep %d to cut off at %v, got %v", i+1, want, cutoff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected sweep %d after the interval", i+1)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected Run to stop cleanly, got %v", err)
+	}
+}
+
+func TestApplyRecordsFailures(t *testing.T) {
+	m := New(Config{}, noopLogger{})
+	boom := errors.New("boom")
+	m.Register(Policy{Name: "a.records", MaxAge: time.Hour, Purge: func(context.Context, time.Time, bool) (int, error) {
+		return 2, boom
+	}})
+	report, err := m.Apply(context.Background(), "a.records", nil, TriggerManual)
+	if !errors.Is(err, boom) || report.Records != 2 || report.Error != "boom" {
+		t.Fatalf("expected the failure to be reported, got %+v %v", report, err)
+	}
+	if reports, _ := m.Reports("a.records"); len(reports) != 1 || reports[0].Error != "boom" {
+		t.Fatalf("expected the failure to be kept, got %+v", reports)
+	}
+}
+
+func TestApplyRefusesConcurrentRuns(t *testing.T) {
+	m := New(Config{}, noopLogger{})
+	started, release := make(chan struct{}), make(chan struct{})
+	m.Register(Policy{Name: "a.records", MaxAge: time.Hour, Purge: func(context.Context, time.Time, bool) (int, error) {
+		close(started)
+		<-release
+		return 0, nil
+	}})
+	done := make(chan error)
+	go func() {
+		_, err := m.Apply(context.Background(), "a.records", nil, TriggerSchedule)
+		done <- err
+	}()
+	<-started
+	if _, err := m.Apply(context.Background(), "a.records", nil, TriggerManual); !errors.Is(err, ErrRunning) {
+		t.Fatalf("expected ErrRunning, got %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+}
+
+func TestFromConfigParsesMaxAges(t *testing.T) {
+	t.Setenv("SVC_RETENTION_MAX_AGES", "messaging.messages=72h, audit.entries=0")
+	t.Setenv("SVC_RETENTION_DRY_RUN", "*")
+	loader, err := config.Load("SVC", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := FromConfig(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxAges["messaging.messages"] != 72*time.Hour || cfg.MaxAges["audit.entries"] != 0 || len(cfg.DryRun) != 1 {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	t.Setenv("SVC_RETENTION_MAX_AGES", "messaging.messages=soon")
+	if loader, err = config.Load("SVC", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromConfig(loader); err == nil {
+		t.Fatal("expected a malformed age to be rejected")
+	}
+}
+
+func TestPurgeBucketRemovesInBatches(t *testing.T) {
+	db := storage.NewMemory()
+	ctx := context.Background()
+	total := BatchSize + 10
+	if err := storage.Update(ctx, db, func(tx storage.Tx) error {
+		for i := range total + 5 {
+			key := strconv.Itoa(100000 + i)
+			if err := tx.Put("records", key, []byte(key)); err != nil {
+				return err
+			}
+			if err := tx.Put("index", key, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Keys are in insertion order, so the first live one ends the scan.
+	expired := func(key string, _ []byte) (bool, error) {
+		if n, _ := strconv.Atoi(key); n >= 100000+total {
+			return false, storage.StopScan
+		}
+		return true, nil
+	}
+	unindex := func(tx storage.Tx, key string, _ []byte) error { return tx.Delete("index", key) }
+
+	if n, err := PurgeBucket(ctx, db, "records", true, expired, unindex); err != nil || n != total {
+		t.Fatalf("dry run: expected %d, got %d %v", total, n, err)
+	}
+	if n, err := PurgeBucket(ctx, db, "records", false, expired, unindex); err != nil || n != total {
+		t.Fatalf("purge: expected %d, got %d %v", total, n, err)
+	}
+	for _, bucket := range []string{"records", "index"} {
+		left := 0
+		_ = storage.View(ctx, db, func(tx storage.Tx) error {
+			return tx.Scan(bucket, "", func(string, []byte) error { left++; return nil })
+		})
+		if left != 5 {
+			t.Fatalf("expected 5 %s left, got %d", bucket, left)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := New(Config{MaxAges: map[string]time.Duration{"b.records": 0}}, noopLogger{})
+	m.Register(Policy{Name: "a.records", Description: "old records", MaxAge: time.Hour, Purge: func(context.Context, time.Time, bool) (int, error) {
+		return 4, nil
+	}})
+	m.Register(Policy{Name: "b.records", MaxAge: time.Hour, Purge: func(context.Context, time.Time, bool) (int, error) { return 0, nil }})
+	h := m.Handler()
+	serve := func(method, target string, p auth.Principal) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req = req.WithContext(auth.NewContext(req.Context(), p))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	operator := auth.Principal{Subject: "ops"}
+
+	rec := serve(http.MethodPost, "/retention/a.records/run?dry_run=true", operator)
+	var report Report
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &report) != nil || !report.DryRun || report.Records != 4 {
+		t.Fatalf("run: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(http.MethodGet, "/retention", operator)
+	var list struct {
+		Items []Status `json:"items"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &list) != nil || len(list.Items) != 2 || list.Items[0].LastReport == nil {
+		t.Fatalf("list: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(http.MethodGet, "/retention/a.records/reports", operator)
+	var reports struct {
+		Items []Report `json:"items"`
+	}
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &reports) != nil || len(reports.Items) != 1 {
+		t.Fatalf("reports: %d %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		principal      auth.Principal
+		status         int
+	}{
+		{http.MethodPost, "/retention/b.records/run", operator, http.StatusConflict},
+		{http.MethodPost, "/retention/a.records/run?dry_run=maybe", operator, http.StatusBadRequest},
+		{http.MethodGet, "/retention/a.records/run", operator, http.StatusMethodNotAllowed},
+		{http.MethodGet, "/retention/missing/reports", operator, http.StatusNotFound},
+		{http.MethodGet, "/retention/a.records", operator, http.StatusNotFound},
+		{http.MethodGet, "/retention", auth.Principal{Subject: "acme", Tenant: "acme"}, http.StatusForbidden},
+	} {
+		if rec := serve(tc.method, tc.target, tc.principal); rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d %s", tc.method, tc.target, tc.status, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notifyclient"
+)
+
+// ErrActionUnavailable indicates the action's backend is not configured.
+var ErrActionUnavailable = errors.New("scheduler: action not configured")
+
+// Executor performs job actions.
+type Executor interface {
+	// Execute fires job's action, returning a short description of the
+	// outcome.
+	Execute(ctx context.Context, job Job) (detail string, err error)
+}
+
+// Publisher publishes messages for publish actions.
+type Publisher interface {
+	Publish(ctx context.Context, tenantID, projectID string, action PublishAction) error
+}
+
+// Notifier sends notifications for notify actions.
+type Notifier interface {
+	Notify(ctx context.Context, action NotifyAction) error
+}
+
+// Actions executes jobs' actions: HTTP calls directly, publishes through a
+// Publisher, and notifications through a Notifier.
+type Actions struct {
+	client       *http.Client
+	publisher    Publisher
+	notifier     Notifier
+	allowedHosts []string
+}
+
+// NewActions returns an executor. transport carries HTTP actions and should
+// not attach this service's credentials, since jobs choose the URL. A nil
+// publisher or notifier fails runs of that action. allowedHosts, when not
+// empty, limits HTTP actions to those host names; an entry starting with
+// "." also allows its subdomains.
+func NewActions(transport http.RoundTripper, publisher Publisher, notifier Notifier, allowedHosts []string) *Actions {
+	hosts := make([]string, len(allowedHosts))
+	for i, host := range allowedHosts {
+		hosts[i] = strings.ToLower(host)
+	}
+	return &Actions{
+		client: &http.Client{
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		publisher:    publisher,
+		notifier:     notifier,
+		allowedHosts: hosts,
+	}
+}
+
+// Execute fires job's action.
+func (a *Actions) Execute(ctx context.Context, job Job) (string, error) {
+	switch job.Action.Type {
+	case ActionHTTP:
+		return a.call(ctx, *job.Action.HTTP)
+	case ActionPublish:
+		if a.publisher == nil {
+			return "", fmt.Errorf("%w: publish", ErrActionUnavailable)
+		}
+		if err := a.publisher.Publish(ctx, job.TenantID, job.ProjectID, *job.Action.Publish); err != nil {
+			return "", err
+		}
+		return "published to " + job.Action.Publish.Topic, nil
+	case ActionNotify:
+		if a.notifier == nil {
+			return "", fmt.Errorf("%w: notify", ErrActionUnavailable)
+		}
+		if err := a.notifier.Notify(ctx, *job.Action.Notify); err != nil {
+			return "", err
+		}
+		return "notified " + job.Action.Notify.Recipient, nil
+	default:
+		return "", fmt.Errorf("unknown action type %q", job.Action.Type)
+	}
+}
+
+func (a *Actions) call(ctx context.Context, action HTTPAction) (string, error) {
+	target, err := url.Parse(action.URL)
+	if err != nil {
+		return "", err
+	}
+	if !a.hostAllowed(target.Hostname()) {
+		return "", fmt.Errorf("host %s is not allowed", target.Hostname())
+	}
+	method := action.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, action.URL, strings.NewReader(action.Body))
+	if err != nil {
+		return "", err
+	}
+	for k, v := range action.Headers {
+		req.Header.Set(k, v)
+	}
+	if action.Body != "" && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	detail := "HTTP " + resp.Status
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return detail, fmt.Errorf("%s returned %s", target.Redacted(), resp.Status)
+	}
+	return detail, nil
+}
+
+func (a *Actions) hostAllowed(host string) bool {
+	if len(a.allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	if slices.Contains(a.allowedHosts, host) {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	for _, allowed := range a.allowedHosts {
+		if strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// MessagingClient publishes to the messaging service's
+// /topics/{topic}/messages endpoint.
+type MessagingClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewMessagingClient constructs a client for the messaging service at
+// baseURL.
+func NewMessagingClient(baseURL string, transport http.RoundTripper) *MessagingClient {
+	return &MessagingClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// Publish publishes action's payload to its topic.
+func (c *MessagingClient) Publish(ctx context.Context, tenantID, projectID string, action PublishAction) error {
+	body, err := json.Marshal(map[string]any{
+		"tenant_id":      tenantID,
+		"project_id":     projectID,
+		"key":            action.Key,
+		"payload_base64": base64.StdEncoding.EncodeToString([]byte(action.Payload)),
+		"attributes":     action.Attributes,
+	})
+	if err != nil {
+		return err
+	}
+	return post(ctx, c.client, c.baseURL+"/topics/"+url.PathEscape(action.Topic)+"/messages", body, "messaging service")
+}
+
+// Check reports whether the messaging service answers its health check.
+func (c *MessagingClient) Check(ctx context.Context) error {
+	return check(ctx, c.client, c.baseURL, "messaging service")
+}
+
+// NewNotificationClient returns a client sending notify actions through
+// the notification service at baseURL.
+func NewNotificationClient(baseURL string, transport http.RoundTripper) (*notifyclient.Client[NotifyAction], error) {
+	return notifyclient.New(baseURL, transport, func(action NotifyAction) notifyclient.Notification {
+		return notifyclient.Notification(action)
+	})
+}
+
+func post(ctx context.Context, client *http.Client, target string, body []byte, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", name, resp.Status)
+	}
+	return nil
+}
+
+func check(ctx context.Context, client *http.Client, baseURL, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", name, resp.Status)
+	}
+	return nil
+}
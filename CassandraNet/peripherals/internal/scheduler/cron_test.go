@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, timezone, from, want string
+	}{
+		{"*/15 * * * *", "", "2026-10-18 10:07", "2026-10-18 10:15"},
+		{"*/15 * * * *", "", "2026-10-18 10:15", "2026-10-18 10:30"},
+		{"0 9 * * mon-fri", "", "2026-10-17 12:00", "2026-10-19 09:00"},
+		{"30 8 * * 7", "", "2026-10-18 09:00", "2026-10-25 08:30"},
+		{"@monthly", "", "2026-01-31 12:00", "2026-02-01 00:00"},
+		{"0 0 29 feb *", "", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"0 12 1,15 * *", "", "2026-10-02 00:00", "2026-10-15 12:00"},
+		// Restricting both days fires on either.
+		{"0 0 1 * mon", "", "2026-10-18 00:00", "2026-10-19 00:00"},
+		{"10-20/5 3 * * *", "", "2026-10-18 03:16", "2026-10-18 03:20"},
+		// 09:00 in Tokyo is 00:00 UTC.
+		{"0 9 * * *", "Asia/Tokyo", "2026-10-18 01:00", "2026-10-19 00:00"},
+		// India is offset by half an hour.
+		{"0 * * * *", "Asia/Kolkata", "2026-10-18 10:00", "2026-10-18 10:30"},
+	}
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.expr, tt.timezone)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.expr, err)
+		}
+		if got := schedule.Next(at(tt.from)).UTC(); !got.Equal(at(tt.want)) {
+			t.Errorf("%q in %q after %s: got %s, want %s", tt.expr, tt.timezone, tt.from, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+}
+
+func TestParseScheduleRejects(t *testing.T) {
+	for _, tt := range []struct{ expr, timezone string }{
+		{"* * *", ""},
+		{"60 * * * *", ""},
+		{"5-1 * * * *", ""},
+		{"*/0 * * * *", ""},
+		{"0 0 * * funday", ""},
+		{"0 0 30 2 *", ""},
+		{"@often", ""},
+		{"0 0 * * *", "Mars/Olympus_Mons"},
+	} {
+		if _, err := ParseSchedule(tt.expr, tt.timezone); err == nil {
+			t.Errorf("%q in %q: expected an error", tt.expr, tt.timezone)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the scheduler API.
+const (
+	codeInvalidJSON        = "schedules.invalid_json"
+	codeInvalidRequest     = "schedules.invalid_request"
+	codeNotFound           = "schedules.not_found"
+	codeUnavailable        = "schedules.store_unavailable"
+	codeForbidden          = "schedules.forbidden_tenant"
+	codeForbiddenProject   = "schedules.forbidden_project"
+	codePreconditionFailed = "schedules.precondition_failed"
+	codeRunInProgress      = "schedules.run_in_progress"
+)
+
+const (
+	schedulesBasePath = "/schedules"
+	schedulesPrefix   = "/schedules/"
+)
+
+// Handler returns an HTTP handler for the scheduler endpoints.
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc(schedulesBasePath, s.handleList)
+	mux.HandleFunc(schedulesPrefix, s.handleJobRoute)
+	return mux
+}
+
+// putPayload omits the ID and scope, which come from the path and query.
+type putPayload struct {
+	Name     string  `json:"name"`
+	Schedule string  `json:"schedule"`
+	Timezone string  `json:"timezone"`
+	Action   Action  `json:"action"`
+	Overlap  Overlap `json:"overlap"`
+	Paused   bool    `json:"paused"`
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r)
+	if !ok || !auth.Allow(w, r, auth.PermSchedulesRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	items, next, err := s.ListJobs(r.Context(), scope, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+func (s *Service) handleJobRoute(w http.ResponseWriter, r *http.Request) {
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, schedulesPrefix), "/")
+	if segments[0] == "" || len(segments) > 2 {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		return
+	}
+	id := segments[0]
+	scope, ok := resolveScope(w, r)
+	if !ok {
+		return
+	}
+	switch {
+	case len(segments) == 1:
+		s.handleJob(w, r, scope, id)
+	case segments[1] == "trigger":
+		s.handleTrigger(w, r, scope, id)
+	case segments[1] == "runs":
+		s.handleRuns(w, r, scope, id)
+	default:
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+	}
+}
+
+func (s *Service) handleJob(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermSchedulesRead, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		job, err := s.GetJob(r.Context(), scope, id)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", versionETag(job.Version))
+		writeJSON(w, http.StatusOK, job)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermSchedulesManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		s.handlePut(w, r, scope, id)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermSchedulesManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.DeleteJob(r.Context(), scope, id); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Service) handlePut(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	defer r.Body.Close()
+	var payload putPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	job, created, err := s.PutJob(r.Context(), JobRequest{
+		ID:        id,
+		TenantID:  scope.TenantID,
+		ProjectID: scope.ProjectID,
+		Name:      payload.Name,
+		Schedule:  payload.Schedule,
+		Timezone:  payload.Timezone,
+		Action:    payload.Action,
+		Overlap:   payload.Overlap,
+		Paused:    payload.Paused,
+		IfVersion: ifVersion,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(job.Version))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, job)
+}
+
+func (s *Service) handleTrigger(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermSchedulesManage, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	run, err := s.Trigger(r.Context(), scope, id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Service) handleRuns(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermSchedulesRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	items, next, err := s.Runs(r.Context(), scope, id, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// requested scope, writing 403 when they contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request) (Scope, bool) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), tenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+tenantID)
+		return Scope{}, false
+	}
+	projectID := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), projectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+projectID)
+		return Scope{}, false
+	}
+	return Scope{TenantID: tenant, ProjectID: project}, true
+}
+
+// versionETag is a job's ETag, its quoted version.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch reads the version a PUT is conditional on, 0 when the header
+// is absent.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrPreconditionFailed
+	}
+	return version, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		problem.Write(w, r, http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+	case errors.Is(err, ErrRunInProgress):
+		problem.Write(w, r, http.StatusConflict, codeRunInProgress, err.Error())
+	case errors.Is(err, ErrStore):
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
+
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "schedules", methods...)
+}
@@ -0,0 +1,515 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/lock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrJobNotFound indicates no job with the ID exists in the scope.
+	ErrJobNotFound = errors.New("scheduler: job not found")
+	// ErrPreconditionFailed indicates an If-Match version check did not
+	// hold.
+	ErrPreconditionFailed = errors.New("scheduler: version mismatch")
+	// ErrRunInProgress indicates a job that skips overlapping runs is
+	// still running.
+	ErrRunInProgress = errors.New("scheduler: previous run still in progress")
+	// ErrStore wraps failures of the underlying storage driver.
+	ErrStore = errors.New("scheduler: store unavailable")
+
+	// errNotDue means another replica fired the job first.
+	errNotDue = errors.New("scheduler: job not due")
+)
+
+// Limits of job definitions.
+const (
+	maxNameLength     = 256
+	maxScheduleLength = 256
+	maxURLLength      = 2048
+	maxBodyLength     = 64 << 10
+	maxTopicLength    = 255
+	maxDataEntries    = 64
+)
+
+// idPattern restricts job IDs to characters safe in paths.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+var httpMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// Store abstracts persistence for jobs and their runs.
+type Store interface {
+	Get(ctx context.Context, scope Scope, id string) (Job, error)
+	// Put creates or replaces job's definition, setting its version one
+	// above the stored one and keeping its creation time and run state.
+	// ifVersion, when non-zero, must equal the stored version. created
+	// reports whether the job is new.
+	Put(ctx context.Context, job Job, ifVersion int64) (stored Job, created bool, err error)
+	// Delete removes a job and its runs and returns the job as it was.
+	Delete(ctx context.Context, scope Scope, id string) (Job, error)
+	// List returns one page of the scope's jobs in ID order and the
+	// position of the next page, empty on the last.
+	List(ctx context.Context, scope Scope, page pagination.Request) ([]Job, string, error)
+	// Due returns every unpaused job, in any scope, due at or before now.
+	Due(ctx context.Context, now time.Time) ([]Job, error)
+	// Update applies fn to a job and stores the result atomically, so
+	// replicas racing to fire a job cannot both win. fn may run more than
+	// once and must not have side effects.
+	Update(ctx context.Context, scope Scope, id string, fn func(*Job) error) (Job, error)
+	// PutRun creates or replaces a run.
+	PutRun(ctx context.Context, run Run) error
+	// Runs returns one page of a job's runs, newest first.
+	Runs(ctx context.Context, scope Scope, jobID string, page pagination.Request) ([]Run, string, error)
+	// PruneRuns deletes all but a job's keep newest runs.
+	PruneRuns(ctx context.Context, scope Scope, jobID string, keep int) error
+}
+
+// Config tunes a Service. Zero values select the defaults.
+type Config struct {
+	// PollInterval between checks for due jobs (default 5s). Jobs fire
+	// up to one interval after they are due.
+	PollInterval time.Duration
+	// Timeout bounds each run (default 1m).
+	Timeout time.Duration
+	// History is the number of runs kept per job (default 100).
+	History int
+}
+
+// Service stores jobs and fires them when they are due. Replicas sharing a
+// store each poll it, and each due run is claimed by exactly one of them.
+type Service struct {
+	store  Store
+	exec   Executor
+	cfg    Config
+	clock  clock.Clock
+	audit  *audit.Log
+	lease  *lock.Lease
+	logger interface {
+		Printf(string, ...any)
+	}
+
+	// ctx parents every run and is cancelled when Run returns.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService builds a Service firing jobs through exec. clk and logger
+// may be nil.
+func NewService(store Store, exec Executor, cfg Config, clk clock.Clock, logger interface {
+	Printf(string, ...any)
+}) *Service {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.History <= 0 {
+		cfg.History = 100
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{store: store, exec: exec, cfg: cfg, clock: clock.Or(clk), logger: logger, ctx: ctx, cancel: cancel}
+}
+
+// SetAudit records every job change and manual trigger in log. Call it
+// before the service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// SetLocker has one replica sharing l fire due jobs at a time; the others
+// skip their polls until its lease lapses or it stops. Call it before Run.
+func (s *Service) SetLocker(l lock.Locker) {
+	s.lease = lock.NewLease(l, "scheduler.tick", 3*s.cfg.PollInterval)
+}
+
+// PutJob creates or replaces a job. Saving a job schedules its next run
+// from now.
+func (s *Service) PutJob(ctx context.Context, req JobRequest) (Job, bool, error) {
+	schedule, err := validateJob(req)
+	if err != nil {
+		return Job{}, false, err
+	}
+	scope := Scope{TenantID: req.TenantID, ProjectID: req.ProjectID}
+	before, err := s.previous(ctx, scope, req.ID)
+	if err != nil {
+		return Job{}, false, err
+	}
+	overlap := req.Overlap
+	if overlap == "" {
+		overlap = OverlapSkip
+	}
+	now := s.clock.Now()
+	job := Job{
+		ID:        req.ID,
+		TenantID:  req.TenantID,
+		ProjectID: req.ProjectID,
+		Name:      req.Name,
+		Schedule:  req.Schedule,
+		Timezone:  req.Timezone,
+		Action:    req.Action,
+		Overlap:   overlap,
+		Paused:    req.Paused,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !req.Paused {
+		job.NextRunAt = schedule.Next(now).UTC()
+	}
+	job, created, err := s.store.Put(ctx, job, req.IfVersion)
+	if err != nil {
+		return Job{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "scheduler.job.put",
+		Resource:  "schedules/" + job.ID,
+		TenantID:  job.TenantID,
+		ProjectID: job.ProjectID,
+		Before:    before,
+		After:     job,
+	})
+	return job, created, nil
+}
+
+// GetJob returns the scope's job with id.
+func (s *Service) GetJob(ctx context.Context, scope Scope, id string) (Job, error) {
+	if err := validateScope(scope, id); err != nil {
+		return Job{}, err
+	}
+	return s.store.Get(ctx, scope, id)
+}
+
+// DeleteJob removes the scope's job with id and its run history. Runs
+// already going finish but are not recorded.
+func (s *Service) DeleteJob(ctx context.Context, scope Scope, id string) error {
+	if err := validateScope(scope, id); err != nil {
+		return err
+	}
+	job, err := s.store.Delete(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "scheduler.job.delete",
+		Resource:  "schedules/" + job.ID,
+		TenantID:  job.TenantID,
+		ProjectID: job.ProjectID,
+		Before:    job,
+	})
+	return nil
+}
+
+// ListJobs lists one page of the scope's jobs, and the position of the next
+// page.
+func (s *Service) ListJobs(ctx context.Context, scope Scope, page pagination.Request) ([]Job, string, error) {
+	if err := validateScope(scope, ""); err != nil {
+		return nil, "", err
+	}
+	return s.store.List(ctx, scope, page)
+}
+
+// Runs lists one page of a job's runs, newest first.
+func (s *Service) Runs(ctx context.Context, scope Scope, id string, page pagination.Request) ([]Run, string, error) {
+	if _, err := s.GetJob(ctx, scope, id); err != nil {
+		return nil, "", err
+	}
+	return s.store.Runs(ctx, scope, id, page)
+}
+
+// Trigger starts a run of the job now, whatever its schedule and even while
+// it is paused. A job that skips overlapping runs fails with
+// ErrRunInProgress while its previous run is going. The run continues
+// after Trigger returns it.
+func (s *Service) Trigger(ctx context.Context, scope Scope, jobID string) (Run, error) {
+	if err := validateScope(scope, jobID); err != nil {
+		return Run{}, err
+	}
+	now := s.clock.Now()
+	run := Run{ID: id.New(id.PrefixRun), JobID: jobID, TenantID: scope.TenantID, ProjectID: scope.ProjectID, Trigger: TriggerManual, Status: RunRunning, StartedAt: now}
+	job, err := s.store.Update(ctx, scope, jobID, func(job *Job) error {
+		if job.Overlap == OverlapSkip && busy(job, now) {
+			return ErrRunInProgress
+		}
+		s.claim(job, run)
+		return nil
+	})
+	if err != nil {
+		return Run{}, err
+	}
+	if err := s.start(ctx, job, run); err != nil {
+		return Run{}, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "scheduler.job.trigger",
+		Resource:  "schedules/" + job.ID,
+		TenantID:  job.TenantID,
+		ProjectID: job.ProjectID,
+		After:     run,
+	})
+	return run, nil
+}
+
+// Run fires due jobs every poll interval until ctx is cancelled, then
+// cancels the runs still going, records them as failed, and returns.
+// Failures are logged and retried on the next poll.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := s.clock.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if held, err := s.lease.Held(ctx); err != nil {
+			if ctx.Err() == nil {
+				s.logger.Printf("take scheduler lease: %v", err)
+			}
+		} else if held {
+			if err := s.Tick(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Printf("check for due jobs failed: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			s.cancel()
+			s.wg.Wait()
+			_ = s.lease.Release(context.WithoutCancel(ctx))
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// Tick fires every job due now. A job missed while no replica was running
+// fires once, not once per missed time.
+func (s *Service) Tick(ctx context.Context) error {
+	now := s.clock.Now()
+	jobs, err := s.store.Due(ctx, now)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := s.fire(ctx, job, now); err != nil && ctx.Err() == nil {
+			s.logger.Printf("fire job %s: %v", job.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) fire(ctx context.Context, due Job, now time.Time) error {
+	scope := Scope{TenantID: due.TenantID, ProjectID: due.ProjectID}
+	run := Run{ID: id.New(id.PrefixRun), JobID: due.ID, TenantID: due.TenantID, ProjectID: due.ProjectID, Trigger: TriggerSchedule, StartedAt: now}
+	var skipped bool
+	job, err := s.store.Update(ctx, scope, due.ID, func(job *Job) error {
+		if job.Paused || job.NextRunAt.IsZero() || job.NextRunAt.After(now) {
+			return errNotDue
+		}
+		run.ScheduledAt = job.NextRunAt
+		job.NextRunAt = time.Time{}
+		if schedule, err := ParseSchedule(job.Schedule, job.Timezone); err == nil {
+			job.NextRunAt = schedule.Next(now).UTC()
+		}
+		skipped = job.Overlap == OverlapSkip && busy(job, now)
+		if !skipped {
+			s.claim(job, run)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errNotDue) || errors.Is(err, ErrJobNotFound):
+		return nil
+	case err != nil:
+		return err
+	case skipped:
+		run.Status = RunSkipped
+		run.FinishedAt = now
+		run.Detail = "run " + job.ActiveRun + " still in progress"
+		if err := s.store.PutRun(ctx, run); err != nil {
+			return err
+		}
+		return s.store.PruneRuns(ctx, scope, job.ID, s.cfg.History)
+	default:
+		run.Status = RunRunning
+		return s.start(ctx, job, run)
+	}
+}
+
+// claim marks run as the job's latest and, unless the job allows overlapping
+// runs, as the one later runs wait on.
+func (s *Service) claim(job *Job, run Run) {
+	job.LastRunAt = run.StartedAt
+	job.LastStatus = RunRunning
+	if job.Overlap != OverlapAllow {
+		job.ActiveRun = run.ID
+		job.ActiveUntil = run.StartedAt.Add(s.cfg.Timeout + s.cfg.PollInterval)
+	}
+}
+
+// start records run and executes it in the background.
+func (s *Service) start(ctx context.Context, job Job, run Run) error {
+	if err := s.store.PutRun(ctx, run); err != nil {
+		return err
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.execute(job, run)
+	}()
+	return nil
+}
+
+func (s *Service) execute(job Job, run Run) {
+	ctx, cancel := context.WithTimeout(s.ctx, s.cfg.Timeout)
+	detail, err := s.exec.Execute(ctx, job)
+	cancel()
+	run.FinishedAt = s.clock.Now()
+	run.Detail = detail
+	run.Status = RunSucceeded
+	if err != nil {
+		run.Status = RunFailed
+		run.Error = err.Error()
+		s.logger.Printf("job %s run %s failed: %v", job.ID, run.ID, err)
+	}
+
+	// Record the outcome even when shutdown cancelled the run.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	scope := Scope{TenantID: job.TenantID, ProjectID: job.ProjectID}
+	_, err = s.store.Update(ctx, scope, job.ID, func(job *Job) error {
+		if job.ActiveRun == run.ID {
+			job.ActiveRun = ""
+			job.ActiveUntil = time.Time{}
+		}
+		if job.LastRunAt.Equal(run.StartedAt) {
+			job.LastStatus = run.Status
+		}
+		return nil
+	})
+	if errors.Is(err, ErrJobNotFound) {
+		return
+	}
+	if err == nil {
+		err = s.store.PutRun(ctx, run)
+	}
+	if err == nil {
+		err = s.store.PruneRuns(ctx, scope, job.ID, s.cfg.History)
+	}
+	if err != nil {
+		s.logger.Printf("record job %s run %s: %v", job.ID, run.ID, err)
+	}
+}
+
+// busy reports whether the job's previous run still holds it.
+func busy(job *Job, now time.Time) bool {
+	return job.ActiveRun != "" && now.Before(job.ActiveUntil)
+}
+
+// previous returns the stored job for the audit log's before state, nil
+// when auditing is off or none exists.
+func (s *Service) previous(ctx context.Context, scope Scope, id string) (any, error) {
+	if s.audit == nil {
+		return nil, nil
+	}
+	job, err := s.store.Get(ctx, scope, id)
+	if errors.Is(err, ErrJobNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// validateJob checks a job definition and returns its parsed schedule.
+func validateJob(req JobRequest) (*Schedule, error) {
+	var v validation.Validator
+	v.String("id", req.ID).Required().MaxLength(validation.MaxIDLength)
+	if req.ID != "" {
+		v.Check(idPattern.MatchString(req.ID), "id", validation.RuleFormat, "must be lower-case letters, digits, '.', '_', or '-', starting with a letter or digit")
+	}
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", req.ProjectID)
+	v.String("name", req.Name).MaxLength(maxNameLength)
+	v.String("schedule", req.Schedule).Required().MaxLength(maxScheduleLength)
+	v.String("overlap", string(req.Overlap)).OneOf(string(OverlapSkip), string(OverlapAllow))
+	schedule, err := ParseSchedule(req.Schedule, req.Timezone)
+	if req.Schedule != "" && err != nil {
+		field := "schedule"
+		if req.Timezone != "" {
+			if _, zoneErr := time.LoadLocation(req.Timezone); zoneErr != nil {
+				field = "timezone"
+			}
+		}
+		v.Check(false, field, validation.RuleFormat, err.Error())
+	}
+	validateAction(&v, req.Action)
+	return schedule, v.Err()
+}
+
+func validateAction(v *validation.Validator, action Action) {
+	v.String("action.type", string(action.Type)).Required().OneOf(string(ActionHTTP), string(ActionPublish), string(ActionNotify))
+	set := 0
+	for _, present := range []bool{action.HTTP != nil, action.Publish != nil, action.Notify != nil} {
+		if present {
+			set++
+		}
+	}
+	v.Check(set <= 1, "action", validation.RuleFormat, "must set only the field matching its type")
+	switch action.Type {
+	case ActionHTTP:
+		if action.HTTP == nil {
+			v.Check(false, "action.http", validation.RuleRequired, "is required")
+			return
+		}
+		v.String("action.http.method", action.HTTP.Method).OneOf(httpMethods...)
+		v.String("action.http.url", action.HTTP.URL).Required().MaxLength(maxURLLength)
+		if action.HTTP.URL != "" {
+			target, err := url.Parse(action.HTTP.URL)
+			v.Check(err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != "", "action.http.url", validation.RuleFormat, "must be an absolute http or https URL")
+		}
+		v.Map("action.http.headers", action.HTTP.Headers).Limited()
+		v.String("action.http.body", action.HTTP.Body).MaxLength(maxBodyLength)
+	case ActionPublish:
+		if action.Publish == nil {
+			v.Check(false, "action.publish", validation.RuleRequired, "is required")
+			return
+		}
+		v.String("action.publish.topic", action.Publish.Topic).Required().MaxLength(maxTopicLength)
+		v.String("action.publish.key", action.Publish.Key).MaxLength(validation.MaxKeyLength)
+		v.String("action.publish.payload", action.Publish.Payload).MaxLength(maxBodyLength)
+		v.Map("action.publish.attributes", action.Publish.Attributes).Limited()
+	case ActionNotify:
+		if action.Notify == nil {
+			v.Check(false, "action.notify", validation.RuleRequired, "is required")
+			return
+		}
+		v.String("action.notify.channel", action.Notify.Channel).Required().MaxLength(validation.MaxKeyLength)
+		v.String("action.notify.recipient", action.Notify.Recipient).Required().MaxLength(validation.MaxValueLength)
+		v.String("action.notify.template", action.Notify.Template).Required().MaxLength(validation.MaxKeyLength)
+		v.Check(len(action.Notify.Data) <= maxDataEntries, "action.notify.data", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxDataEntries))
+	}
+}
+
+// validateScope checks a scope and, when id is not empty, a job ID.
+func validateScope(scope Scope, id string) error {
+	var v validation.Validator
+	v.String("tenant_id", scope.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", scope.ProjectID)
+	if id != "" {
+		v.String("id", id).MaxLength(validation.MaxIDLength)
+	}
+	return v.Err()
+}
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+)
+
+// rfc3339 parses a test timestamp.
+func rfc3339(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func do(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestScheduleAPI(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			<-release
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer target.Close()
+
+	fake := clock.NewFake(rfc3339("2026-01-01T00:01:00Z"))
+	svc := NewService(NewMemoryStore(), NewActions(nil, nil, nil, nil), Config{Timeout: 10 * time.Minute}, fake, nil)
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	job := server.URL + "/schedules/cleanup?project_id=p1"
+	tick := func(at string) {
+		t.Helper()
+		fake.Set(rfc3339(at))
+		if err := svc.Tick(context.Background()); err != nil {
+			t.Fatalf("tick at %s: %v", at, err)
+		}
+	}
+	runs := func() []Run {
+		t.Helper()
+		svc.wg.Wait()
+		resp := do(t, http.MethodGet, job[:strings.Index(job, "?")]+"/runs?project_id=p1", "")
+		var page struct {
+			Items []Run `json:"items"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&page) != nil {
+			t.Fatalf("runs: %d", resp.StatusCode)
+		}
+		return page.Items
+	}
+
+	for _, body := range []string{
+		`{"schedule": "every minute", "action": {"type": "http", "http": {"url": "` + target.URL + `"}}}`,
+		`{"schedule": "* * * * *", "timezone": "Nowhere/Special", "action": {"type": "http", "http": {"url": "` + target.URL + `"}}}`,
+		`{"schedule": "* * * * *", "action": {"type": "http"}}`,
+		`{"schedule": "* * * * *", "action": {"type": "http", "http": {"url": "ftp://example.com"}}}`,
+		`{"schedule": "* * * * *", "overlap": "queue", "action": {"type": "notify", "notify": {"channel": "email", "recipient": "ops", "template": "t"}}}`,
+	} {
+		if resp := do(t, http.MethodPut, job, body); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	resp := do(t, http.MethodPut, job, `{"schedule": "*/5 * * * *", "action": {"type": "http", "http": {"url": "`+target.URL+`/cleanup"}}}`)
+	var created Job
+	if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&created) != nil {
+		t.Fatalf("create: %d", resp.StatusCode)
+	}
+	if created.Overlap != OverlapSkip || created.NextRunAt.Format(time.RFC3339) != "2026-01-01T00:05:00Z" {
+		t.Fatalf("created job: %+v", created)
+	}
+
+	tick("2026-01-01T00:04:00Z")
+	if len(runs()) != 0 {
+		t.Fatal("job fired early")
+	}
+	tick("2026-01-01T00:05:30Z")
+	if got := runs(); len(got) != 1 || got[0].Status != RunSucceeded || got[0].Trigger != TriggerSchedule || got[0].Detail != "HTTP 200 OK" {
+		t.Fatalf("first run: %+v", got)
+	}
+
+	// The second call blocks, so the next due run and a manual trigger
+	// overlap it.
+	tick("2026-01-01T00:10:00Z")
+	tick("2026-01-01T00:15:00Z")
+	if resp := do(t, http.MethodPost, server.URL+"/schedules/cleanup/trigger?project_id=p1", ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 for an overlapping trigger, got %d", resp.StatusCode)
+	}
+	close(release)
+	got := runs()
+	if len(got) != 3 || got[0].Status != RunSkipped || got[1].Status != RunSucceeded || !got[1].ScheduledAt.Equal(created.NextRunAt.Add(5*time.Minute)) {
+		t.Fatalf("overlapping runs: %+v", got)
+	}
+
+	resp = do(t, http.MethodPut, job, `{"schedule": "0 0 1 1 *", "overlap": "allow", "action": {"type": "http", "http": {"url": "`+target.URL+`/fail"}}}`)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != `"2"` {
+		t.Fatalf("replace: %d %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	fake.Set(rfc3339("2026-01-01T00:16:00Z"))
+	resp = do(t, http.MethodPost, server.URL+"/schedules/cleanup/trigger?project_id=p1", "")
+	var triggered Run
+	if resp.StatusCode != http.StatusAccepted || json.NewDecoder(resp.Body).Decode(&triggered) != nil || triggered.Trigger != TriggerManual {
+		t.Fatalf("trigger: %d %+v", resp.StatusCode, triggered)
+	}
+	if got := runs(); got[0].ID != triggered.ID || got[0].Status != RunFailed || got[0].Error == "" {
+		t.Fatalf("failed run: %+v", got[0])
+	}
+	stored, _ := svc.GetJob(context.Background(), Scope{ProjectID: "p1"}, "cleanup")
+	if stored.LastStatus != RunFailed || stored.ActiveRun != "" {
+		t.Fatalf("job after failed run: %+v", stored)
+	}
+
+	if resp := do(t, http.MethodDelete, job, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodGet, server.URL+"/schedules/cleanup/runs?project_id=p1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted job's runs, got %d", resp.StatusCode)
+	}
+}
+
+type countingExecutor struct{ calls atomic.Int32 }
+
+func (e *countingExecutor) Execute(context.Context, Job) (string, error) {
+	e.calls.Add(1)
+	return "", nil
+}
+
+func TestReplicasFireOnce(t *testing.T) {
+	store := NewMemoryStore()
+	fake := clock.NewFake(rfc3339("2026-01-01T00:00:30Z"))
+	exec := &countingExecutor{}
+	replicas := []*Service{
+		NewService(store, exec, Config{}, fake, nil),
+		NewService(store, exec, Config{}, fake, nil),
+		NewService(store, exec, Config{}, fake, nil),
+	}
+	_, _, err := replicas[0].PutJob(context.Background(), JobRequest{
+		ID:        "report",
+		ProjectID: "p1",
+		Schedule:  "* * * * *",
+		Action:    Action{Type: ActionNotify, Notify: &NotifyAction{Channel: "email", Recipient: "ops", Template: "daily"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Missed times fire once, not once per minute missed.
+	fake.Set(rfc3339("2026-01-01T00:05:10Z"))
+	var wg sync.WaitGroup
+	for _, svc := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.Tick(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, svc := range replicas {
+		svc.wg.Wait()
+	}
+	if n := exec.calls.Load(); n != 1 {
+		t.Fatalf("expected one run across replicas, got %d", n)
+	}
+	runs, _, err := store.Runs(context.Background(), Scope{ProjectID: "p1"}, "report", pagination.Request{Limit: 10})
+	if err != nil || len(runs) != 1 || runs[0].Status != RunSucceeded {
+		t.Fatalf("runs: %+v %v", runs, err)
+	}
+	job, _ := store.Get(context.Background(), Scope{ProjectID: "p1"}, "report")
+	if job.NextRunAt.Format(time.RFC3339) != "2026-01-01T00:06:00Z" {
+		t.Fatalf("next run at %s", job.NextRunAt)
+	}
+}
@@ -0,0 +1,269 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Buckets holding jobs and runs as JSON. Jobs are keyed by
+// "{project}/{tenant}/{id}", with the IDs path-escaped and the tenant empty
+// for project-wide jobs. Runs are keyed by "{project}/{tenant}/{job}/" and a
+// suffix that sorts newest first, so a job's history scans most recent run
+// first.
+const (
+	jobBucket = "scheduler.jobs"
+	runBucket = "scheduler.runs"
+)
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db storage.Driver
+}
+
+// NewStorageStore returns a store keeping jobs and runs in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// Get returns the scope's job with id.
+func (s *StorageStore) Get(ctx context.Context, scope Scope, id string) (Job, error) {
+	var job Job
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		job, err = getJob(tx, scope, id)
+		return err
+	})
+	return job, storeError(err)
+}
+
+// Put creates or replaces a job's definition, checking ifVersion against
+// the stored one. The stored job's run state carries over.
+func (s *StorageStore) Put(ctx context.Context, job Job, ifVersion int64) (Job, bool, error) {
+	var stored Job
+	var created bool
+	scope := Scope{TenantID: job.TenantID, ProjectID: job.ProjectID}
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		stored, created = job, false
+		existing, err := getJob(tx, scope, job.ID)
+		switch {
+		case errors.Is(err, ErrJobNotFound):
+			if ifVersion != 0 {
+				return ErrPreconditionFailed
+			}
+			created = true
+			stored.Version = 1
+		case err != nil:
+			return err
+		default:
+			if ifVersion != 0 && ifVersion != existing.Version {
+				return ErrPreconditionFailed
+			}
+			stored.Version = existing.Version + 1
+			stored.CreatedAt = existing.CreatedAt
+			stored.LastRunAt = existing.LastRunAt
+			stored.LastStatus = existing.LastStatus
+			stored.ActiveRun = existing.ActiveRun
+			stored.ActiveUntil = existing.ActiveUntil
+		}
+		return putJob(tx, stored)
+	})
+	if err != nil {
+		return Job{}, false, storeError(err)
+	}
+	return stored, created, nil
+}
+
+// Delete removes the scope's job with id and its runs.
+func (s *StorageStore) Delete(ctx context.Context, scope Scope, id string) (Job, error) {
+	var job Job
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if job, err = getJob(tx, scope, id); err != nil {
+			return err
+		}
+		var runs []string
+		err = tx.Scan(runBucket, runPrefix(scope, id), func(key string, _ []byte) error {
+			runs = append(runs, key)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range runs {
+			if err := tx.Delete(runBucket, key); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(jobBucket, jobKey(scope, id))
+	})
+	return job, storeError(err)
+}
+
+// List returns one page of the scope's jobs, ordered by ID.
+func (s *StorageStore) List(ctx context.Context, scope Scope, page pagination.Request) ([]Job, string, error) {
+	return scanPage[Job](ctx, s.db, jobBucket, scopePrefix(scope), page)
+}
+
+// Due returns every unpaused job, in any scope, due at or before now.
+func (s *StorageStore) Due(ctx context.Context, now time.Time) ([]Job, error) {
+	var jobs []Job
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		jobs = nil
+		return tx.Scan(jobBucket, "", func(_ string, value []byte) error {
+			var job Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			if !job.Paused && !job.NextRunAt.IsZero() && !job.NextRunAt.After(now) {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return jobs, nil
+}
+
+// Update applies fn to the scope's job with id and stores the result, in
+// one transaction. An error from fn leaves the job unchanged.
+func (s *StorageStore) Update(ctx context.Context, scope Scope, id string, fn func(*Job) error) (Job, error) {
+	var job Job
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if job, err = getJob(tx, scope, id); err != nil {
+			return err
+		}
+		if err := fn(&job); err != nil {
+			return err
+		}
+		return putJob(tx, job)
+	})
+	return job, storeError(err)
+}
+
+// PutRun creates or replaces a run.
+func (s *StorageStore) PutRun(ctx context.Context, run Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	return storeError(storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Put(runBucket, runKey(run), data)
+	}))
+}
+
+// Runs returns one page of a job's runs, newest first.
+func (s *StorageStore) Runs(ctx context.Context, scope Scope, jobID string, page pagination.Request) ([]Run, string, error) {
+	return scanPage[Run](ctx, s.db, runBucket, runPrefix(scope, jobID), page)
+}
+
+// PruneRuns deletes all but a job's keep newest runs.
+func (s *StorageStore) PruneRuns(ctx context.Context, scope Scope, jobID string, keep int) error {
+	return storeError(storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var stale []string
+		seen := 0
+		err := tx.Scan(runBucket, runPrefix(scope, jobID), func(key string, _ []byte) error {
+			if seen++; seen > keep {
+				stale = append(stale, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range stale {
+			if err := tx.Delete(runBucket, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func scanPage[T any](ctx context.Context, db storage.Driver, bucket, prefix string, page pagination.Request) ([]T, string, error) {
+	collector := pagination.NewCollector[T](page)
+	err := storage.View(ctx, db, func(tx storage.Tx) error {
+		return tx.Scan(bucket, prefix, func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			var item T
+			if err := json.Unmarshal(value, &item); err != nil {
+				return err
+			}
+			if !collector.Add(key, item) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	items, next := collector.Page()
+	return items, next, nil
+}
+
+func scopePrefix(scope Scope) string {
+	return url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(scope.TenantID) + "/"
+}
+
+func jobKey(scope Scope, id string) string {
+	return scopePrefix(scope) + id
+}
+
+func runPrefix(scope Scope, jobID string) string {
+	return jobKey(scope, jobID) + "/"
+}
+
+// runKey orders a job's runs newest first by counting the start time down
+// from the largest timestamp.
+func runKey(run Run) string {
+	scope := Scope{TenantID: run.TenantID, ProjectID: run.ProjectID}
+	return fmt.Sprintf("%s%016x-%s", runPrefix(scope, run.JobID), uint64(math.MaxInt64-run.StartedAt.UnixNano()), run.ID)
+}
+
+func getJob(tx storage.Tx, scope Scope, id string) (Job, error) {
+	data, err := tx.Get(jobBucket, jobKey(scope, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	var job Job
+	err = json.Unmarshal(data, &job)
+	return job, err
+}
+
+func putJob(tx storage.Tx, job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Put(jobBucket, jobKey(Scope{TenantID: job.TenantID, ProjectID: job.ProjectID}, job.ID), data)
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests and the scheduler's own outcomes.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrJobNotFound) || errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrRunInProgress) || errors.Is(err, errNotDue) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import "time"
+
+// ActionType names what a job does when it fires.
+type ActionType string
+
+const (
+	// ActionHTTP calls a URL.
+	ActionHTTP ActionType = "http"
+	// ActionPublish publishes a message to a messaging topic.
+	ActionPublish ActionType = "publish"
+	// ActionNotify sends a notification.
+	ActionNotify ActionType = "notify"
+)
+
+// Overlap decides what happens when a job is due while its previous run is
+// still going.
+type Overlap string
+
+const (
+	// OverlapSkip records the due run as skipped. It is the default.
+	OverlapSkip Overlap = "skip"
+	// OverlapAllow starts the run alongside the previous one.
+	OverlapAllow Overlap = "allow"
+)
+
+// Trigger records why a run started.
+type Trigger string
+
+const (
+	// TriggerSchedule marks runs started because the job was due.
+	TriggerSchedule Trigger = "schedule"
+	// TriggerManual marks runs started through the trigger endpoint.
+	TriggerManual Trigger = "manual"
+)
+
+// RunStatus is the state of a run.
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+	RunSkipped   RunStatus = "skipped"
+)
+
+// Job is a schedule and the action fired on it, owned by a project or one
+// tenant of it.
+type Job struct {
+	ID        string `json:"id"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	ProjectID string `json:"project_id"`
+	Name      string `json:"name,omitempty"`
+	// Schedule is a five-field cron expression or a macro such as @hourly.
+	Schedule string `json:"schedule"`
+	// Timezone is the IANA zone the schedule is read in, UTC when empty.
+	Timezone string  `json:"timezone,omitempty"`
+	Action   Action  `json:"action"`
+	Overlap  Overlap `json:"overlap"`
+	Paused   bool    `json:"paused"`
+	// NextRunAt is when the job is next due, zero while paused.
+	NextRunAt  time.Time `json:"next_run_at,omitzero"`
+	LastRunAt  time.Time `json:"last_run_at,omitzero"`
+	LastStatus RunStatus `json:"last_status,omitempty"`
+	// ActiveRun is the run a job with OverlapSkip waits on. It stops
+	// counting at ActiveUntil, so a run lost with its replica does not
+	// block the job forever.
+	ActiveRun   string    `json:"active_run,omitempty"`
+	ActiveUntil time.Time `json:"active_until,omitzero"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Action is what a job does. Exactly the field matching Type is set.
+type Action struct {
+	Type    ActionType     `json:"type"`
+	HTTP    *HTTPAction    `json:"http,omitempty"`
+	Publish *PublishAction `json:"publish,omitempty"`
+	Notify  *NotifyAction  `json:"notify,omitempty"`
+}
+
+// HTTPAction calls URL. Responses outside 2xx fail the run.
+type HTTPAction struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// PublishAction publishes Payload to Topic in the job's tenant and project.
+type PublishAction struct {
+	Topic      string            `json:"topic"`
+	Key        string            `json:"key,omitempty"`
+	Payload    string            `json:"payload,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// NotifyAction sends Template rendered with Data to Recipient over Channel.
+type NotifyAction struct {
+	Channel   string         `json:"channel"`
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Run is one firing of a job.
+type Run struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"job_id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	ProjectID string    `json:"project_id"`
+	Trigger   Trigger   `json:"trigger"`
+	Status    RunStatus `json:"status"`
+	// ScheduledAt is when the job was due; manual runs leave it zero.
+	ScheduledAt time.Time `json:"scheduled_at,omitzero"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+	// Detail summarises the outcome, such as the HTTP status returned.
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// JobRequest defines a job.
+type JobRequest struct {
+	ID        string
+	TenantID  string
+	ProjectID string
+	Name      string
+	Schedule  string
+	Timezone  string
+	Action    Action
+	Overlap   Overlap
+	Paused    bool
+	// IfVersion, when non-zero, must equal the stored job's version.
+	IfVersion int64
+}
+
+// Scope names a project and optionally one tenant of it.
+type Scope struct {
+	TenantID  string
+	ProjectID string
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// AccessLogConfig samples the access log on busy routes. The zero value
+// logs every request.
+type AccessLogConfig struct {
+	// Sample is the fraction of requests logged on routes no rule
+	// matches; zero means every request.
+	Sample float64
+	// Routes override Sample for matching routes, chosen like BodyLimits.
+	Routes []SampleRule
+}
+
+// SampleRule logs Rate of the requests whose path starts with Prefix and,
+// when Method is set, whose method matches. A Rate of zero logs only
+// server errors.
+type SampleRule struct {
+	Method string
+	Prefix string
+	Rate   float64
+}
+
+// ParseSampleRule parses "[METHOD ]/prefix=rate" with rate between 0 and 1,
+// for example "POST /metrics/ingest=0.01".
+func ParseSampleRule(spec string) (SampleRule, error) {
+	target, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return SampleRule{}, fmt.Errorf("sample rule %q: expected [METHOD ]/prefix=rate", spec)
+	}
+	var rule SampleRule
+	target = strings.TrimSpace(target)
+	if method, prefix, ok := strings.Cut(target, " "); ok {
+		rule.Method, target = strings.ToUpper(method), strings.TrimSpace(prefix)
+	}
+	if !strings.HasPrefix(target, "/") {
+		return SampleRule{}, fmt.Errorf("sample rule %q: path must start with /", spec)
+	}
+	rule.Prefix = target
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return SampleRule{}, fmt.Errorf("sample rule %q: rate %q must be between 0 and 1", spec, value)
+	}
+	rule.Rate = rate
+	return rule, nil
+}
+
+// rate returns the fraction of requests like r that are logged.
+func (c AccessLogConfig) rate(r *http.Request) float64 {
+	if i := matchRoute(r, len(c.Routes), func(i int) (string, string) { return c.Routes[i].Method, c.Routes[i].Prefix }); i >= 0 {
+		return c.Routes[i].Rate
+	}
+	if c.Sample <= 0 {
+		return 1
+	}
+	return c.Sample
+}
+
+// AccessLog logs one line per request with its method, path, route
+// template, status, bytes written, and duration. The request-scoped logger
+// adds the request and tenant IDs, and handlers deeper in the chain add
+// fields through logging.AddAccessFields; auth.Authenticator.Require adds
+// the subject, and the tenant when the request named none. Health probes
+// and metrics scrapes are logged at DEBUG to keep them out of the default
+// output.
+//
+// Requests on sampled routes are logged when a hash of their request ID
+// falls under the route's rate, so every service a request passes through
+// makes the same choice, and the line carries sample_rate. Server errors
+// are always logged.
+func AccessLog(logger *logging.Logger, cfg AccessLogConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rate := cfg.rate(r)
+			ctx, access := logging.WithAccess(r.Context())
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r.WithContext(ctx))
+
+			status := rec.Status()
+			if status < http.StatusInternalServerError && !sampled(logging.RequestID(ctx), rate) {
+				return
+			}
+			l, ok := logging.FromContext(ctx)
+			if !ok {
+				l = logger
+			}
+			kv := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", routeTemplate(r.URL.Path),
+				"status", status,
+				"bytes", rec.bytes,
+				"duration", time.Since(start),
+			}
+			kv = append(kv, access.Fields()...)
+			if rate < 1 {
+				kv = append(kv, "sample_rate", rate)
+			}
+			if isProbe(r.URL.Path) {
+				l.Debug("request", kv...)
+				return
+			}
+			l.Info("request", kv...)
+		})
+	}
+}
+
+// sampled reports whether the request with id falls within rate.
+func sampled(id string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(id))
+	return float64(binary.BigEndian.Uint64(sum[:8])) < rate*math.MaxUint64
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+func TestAccessLogFields(t *testing.T) {
+	logger, buf := bufferLogger()
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.AddAccessFields(r.Context(), "subject", "svc-key")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}), RequestID(logger), AccessLog(logger, AccessLogConfig{}))
+
+	req := httptest.NewRequest(http.MethodPost, "/content/c-42/review", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	req.Header.Set(logging.TenantIDHeader, "acme")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := buf.String()
+	for _, want := range []string{"request_id=req-1", "tenant_id=acme", "route=/content/{id}/review", "status=201", "bytes=2", "subject=svc-key"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in %q", want, out)
+		}
+	}
+	if strings.Contains(out, "sample_rate") {
+		t.Errorf("expected no sample rate on an unsampled route, got %q", out)
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	logger, buf := bufferLogger()
+	status := http.StatusOK
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}), RequestID(logger), AccessLog(logger, AccessLogConfig{Routes: []SampleRule{
+		{Method: http.MethodPost, Prefix: "/metrics/ingest", Rate: 0.1},
+		{Prefix: "/logs", Rate: 0},
+	}}))
+	serve := func(method, path string, n int) int {
+		buf.Reset()
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set(logging.RequestIDHeader, fmt.Sprintf("req-%d", i))
+			h.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		return strings.Count(buf.String(), "INFO request")
+	}
+
+	if n := serve(http.MethodPost, "/metrics/ingest", 1000); n < 50 || n > 150 || !strings.Contains(buf.String(), "sample_rate=0.1") {
+		t.Fatalf("expected about a tenth of ingests logged with their rate, got %d", n)
+	}
+	if n := serve(http.MethodGet, "/metrics/ingest", 10); n != 10 {
+		t.Fatalf("expected other methods to be logged, got %d", n)
+	}
+	if n := serve(http.MethodPost, "/v1/logs", 10); n != 0 {
+		t.Fatalf("expected versioned /logs to be dropped, got %d", n)
+	}
+	status = http.StatusBadGateway
+	if n := serve(http.MethodPost, "/logs", 10); n != 10 {
+		t.Fatalf("expected server errors to be logged, got %d", n)
+	}
+}
+
+func TestParseSampleRule(t *testing.T) {
+	rule, err := ParseSampleRule("post /metrics/ingest=0.25")
+	if err != nil || rule != (SampleRule{Method: "POST", Prefix: "/metrics/ingest", Rate: 0.25}) {
+		t.Fatalf("got %+v, %v", rule, err)
+	}
+	for _, spec := range []string{"/logs", "logs=0.5", "/logs=2", "/logs=-0.1"} {
+		if _, err := ParseSampleRule(spec); err == nil {
+			t.Errorf("ParseSampleRule(%q): expected an error", spec)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// BodyLimit caps request bodies at Max bytes on routes whose path starts
+// with Prefix and, when Method is set, whose method matches. A Max of zero
+// leaves the route unlimited.
+type BodyLimit struct {
+	Method string
+	Prefix string
+	Max    int64
+}
+
+// ParseBodyLimit parses "[METHOD ]/prefix=bytes", for example
+// "POST /content=65536".
+func ParseBodyLimit(spec string) (BodyLimit, error) {
+	target, size, ok := strings.Cut(spec, "=")
+	if !ok {
+		return BodyLimit{}, fmt.Errorf("body limit %q: expected [METHOD ]/prefix=bytes", spec)
+	}
+	var limit BodyLimit
+	target = strings.TrimSpace(target)
+	if method, prefix, ok := strings.Cut(target, " "); ok {
+		limit.Method, target = strings.ToUpper(method), strings.TrimSpace(prefix)
+	}
+	if !strings.HasPrefix(target, "/") {
+		return BodyLimit{}, fmt.Errorf("body limit %q: path must start with /", spec)
+	}
+	limit.Prefix = target
+	n, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+	if err != nil || n < 0 {
+		return BodyLimit{}, fmt.Errorf("body limit %q: invalid size %q", spec, size)
+	}
+	limit.Max = n
+	return limit, nil
+}
+
+// LimitBodies caps request bodies at the size of the route's BodyLimit, or
+// at fallback when none matches; zero leaves them unlimited. The longest
+// matching prefix wins, a limit naming the method beats one that does not,
+// and prefixes also match paths with their API version segment removed.
+// Bodies declaring a larger Content-Length are refused with 413 Request
+// Entity Too Large; reads past the cap fail with *http.MaxBytesError, which
+// handlers report through problem.DecodeFailed.
+//
+// Bodies sent with Content-Encoding: gzip are decompressed for the handler.
+// The cap applies to the compressed bytes read and again to the bytes
+// decompressed, so a small body cannot expand past it. Whatever the cap,
+// even on routes without one, the decompressed bytes may not outgrow
+// maxInflateRatio times the compressed bytes read plus inflateAllowance;
+// reads past that fail with *http.MaxBytesError as well. Other encodings
+// are refused with 415 Unsupported Media Type.
+func LimitBodies(fallback int64, routes []BodyLimit) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := bodyLimit(r, fallback, routes)
+			if n > 0 && r.ContentLength > n {
+				problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "request body exceeds "+strconv.FormatInt(n, 10)+" bytes")
+				return
+			}
+			if n > 0 {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+			switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+			case "", "identity":
+			case "gzip", "x-gzip":
+				compressed := &countingReader{ReadCloser: r.Body}
+				zr, err := gzip.NewReader(compressed)
+				if err != nil {
+					var tooLarge *http.MaxBytesError
+					if errors.As(err, &tooLarge) {
+						problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "request body exceeds "+strconv.FormatInt(n, 10)+" bytes")
+						return
+					}
+					problem.Write(w, r, http.StatusBadRequest, "server.invalid_encoding", "request body is not valid gzip: "+err.Error())
+					return
+				}
+				var body io.ReadCloser = &inflated{Reader: zr, compressed: compressed}
+				if n > 0 {
+					body = http.MaxBytesReader(w, body, n)
+				}
+				r.Body = body
+				r.ContentLength = -1
+				r.Header.Del("Content-Encoding")
+				r.Header.Del("Content-Length")
+			default:
+				problem.Write(w, r, http.StatusUnsupportedMediaType, "server.unsupported_encoding", "unsupported Content-Encoding "+strconv.Quote(encoding)+"; send identity or gzip")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Decompressed bodies may expand to maxInflateRatio times the compressed
+// bytes read, plus inflateAllowance. JSON compresses five to twenty times;
+// a gzip bomb expands a thousand.
+const (
+	maxInflateRatio  = 100
+	inflateAllowance = 1 << 20
+)
+
+// bodyLimit returns the cap applying to r.
+func bodyLimit(r *http.Request, fallback int64, routes []BodyLimit) int64 {
+	best := matchRoute(r, len(routes), func(i int) (string, string) { return routes[i].Method, routes[i].Prefix })
+	if best < 0 {
+		return fallback
+	}
+	return routes[best].Max
+}
+
+// matchRoute returns the index of the rule, out of n described by rule,
+// that applies to r, or -1 when none does. A rule matches when r's path, as
+// sent or with its API version segment removed, starts with its prefix and,
+// if it names a method, r's method is the same. The longest prefix wins,
+// and a rule naming the method beats one that does not.
+func matchRoute(r *http.Request, n int, rule func(i int) (method, prefix string)) int {
+	best, bestMethod, bestPrefix := -1, "", ""
+	unversioned := apiversion.Trim(r.URL.Path)
+	for i := 0; i < n; i++ {
+		method, prefix := rule(i)
+		if method != "" && method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, prefix) && !strings.HasPrefix(unversioned, prefix) {
+			continue
+		}
+		if best >= 0 && (len(prefix) < len(bestPrefix) || (len(prefix) == len(bestPrefix) && (method == "" || bestMethod != ""))) {
+			continue
+		}
+		best, bestMethod, bestPrefix = i, method, prefix
+	}
+	return best
+}
+
+// inflated reads a decompressed body, failing once it outgrows the
+// compressed bytes read by maxInflateRatio, and closes the compressed one.
+type inflated struct {
+	*gzip.Reader
+	compressed *countingReader
+	n          int64
+	err        error
+}
+
+func (b *inflated) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	n, err := b.Reader.Read(p)
+	b.n += int64(n)
+	if limit := b.compressed.n*maxInflateRatio + inflateAllowance; b.n > limit {
+		b.err = &http.MaxBytesError{Limit: limit}
+		return 0, b.err
+	}
+	return n, err
+}
+
+func (b *inflated) Close() error {
+	b.Reader.Close()
+	return b.compressed.Close()
+}
+
+// countingReader counts the bytes read from a body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
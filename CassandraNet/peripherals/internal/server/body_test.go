@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+func TestParseBodyLimit(t *testing.T) {
+	limit, err := ParseBodyLimit("post /content=65536")
+	if err != nil || limit != (BodyLimit{Method: "POST", Prefix: "/content", Max: 65536}) {
+		t.Fatalf("got %+v, %v", limit, err)
+	}
+	for _, spec := range []string{"/content", "content=10", "/content=-1", "/content=1k"} {
+		if _, err := ParseBodyLimit(spec); err == nil {
+			t.Errorf("ParseBodyLimit(%q): expected an error", spec)
+		}
+	}
+}
+
+// echo decodes a JSON string and writes it back, reporting decode failures
+// the way service handlers do.
+var echo = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	var s string
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		problem.DecodeFailed(w, r, "test.invalid_json", "invalid json", err)
+		return
+	}
+	io.WriteString(w, s)
+})
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLimitBodies(t *testing.T) {
+	h := LimitBodies(64, []BodyLimit{
+		{Prefix: "/uploads", Max: 1024},
+		{Method: http.MethodPost, Prefix: "/uploads/small", Max: 8},
+		{Prefix: "/bulk", Max: 0},
+	})(echo)
+	long := `"` + strings.Repeat("a", 100) + `"`
+	bomb := gzipped(t, `"`+strings.Repeat("a", 1<<20)+`"`)
+	bigBomb := gzipped(t, `"`+strings.Repeat("a", 16<<20)+`"`)
+
+	cases := []struct {
+		name     string
+		path     string
+		body     []byte
+		encoding string
+		status   int
+		code     string
+	}{
+		{"default", "/items", []byte(`"ok"`), "", http.StatusOK, ""},
+		{"over default", "/items", []byte(long), "", http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge},
+		{"route override", "/uploads/a", []byte(long), "", http.StatusOK, ""},
+		{"versioned route", "/v1/uploads/a", []byte(long), "", http.StatusOK, ""},
+		{"method override", "/uploads/small", []byte(long), "", http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge},
+		{"gzip", "/items", gzipped(t, `"ok"`), "gzip", http.StatusOK, ""},
+		{"gzip bomb", "/items", bomb, "gzip", http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge},
+		{"gzip on an unlimited route", "/bulk", bomb, "gzip", http.StatusOK, ""},
+		{"gzip bomb on an unlimited route", "/bulk", bigBomb, "gzip", http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge},
+		{"corrupt gzip", "/items", []byte("not gzip"), "gzip", http.StatusBadRequest, "server.invalid_encoding"},
+		{"unknown encoding", "/items", []byte(`"ok"`), "br", http.StatusUnsupportedMediaType, "server.unsupported_encoding"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, io.NopCloser(bytes.NewReader(tc.body)))
+		req.ContentLength = -1
+		if tc.encoding != "" {
+			req.Header.Set("Content-Encoding", tc.encoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status || !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: got %d %s", tc.name, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/capture"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// CaptureConfig records sampled requests for replay. Nothing is recorded
+// without a Writer and at least one route.
+type CaptureConfig struct {
+	Writer *capture.Writer
+	// Routes pick the requests recorded and the fraction of them, chosen
+	// like BodyLimits. Requests no rule matches are not recorded.
+	Routes []SampleRule
+	// MaxBodyBytes bounds the body recorded; longer bodies are left out.
+	MaxBodyBytes int64
+	Redaction    capture.Redaction
+}
+
+// Capture records the requests cfg.Routes select, with the status they were
+// answered with, through cfg.Writer. The choice is made from the request
+// ID, as for the access log, so a request is captured by every service it
+// passes through or by none. Recorded bodies are read before the handler
+// runs and handed to it unchanged; a failed write is logged and the request
+// is served regardless.
+func Capture(cfg CaptureConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		if cfg.Writer == nil || len(cfg.Routes) == 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			i := matchRoute(r, len(cfg.Routes), func(i int) (string, string) { return cfg.Routes[i].Method, cfg.Routes[i].Prefix })
+			id := logging.RequestID(r.Context())
+			if i < 0 || !sampled(id, cfg.Routes[i].Rate) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			start := time.Now()
+			r, body, omitted := captureBody(r, cfg.MaxBodyBytes)
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			record := cfg.Redaction.Record(r, body, omitted)
+			record.Time = start.UTC()
+			record.RequestID = id
+			record.Status = rec.Status()
+			record.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+			if err := cfg.Writer.Write(record); err != nil {
+				if l, ok := logging.FromContext(r.Context()); ok {
+					l.Warn("capture failed", "err", err)
+				}
+			}
+		})
+	}
+}
+
+// captureBody reads up to max bytes of r's body and returns a copy of r
+// whose body replays them, with the bytes read or the reason they are not
+// kept.
+func captureBody(r *http.Request, max int64) (*http.Request, []byte, string) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return r, nil, ""
+	}
+	buf, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+	r = r.WithContext(r.Context())
+	switch {
+	case err != nil:
+		r.Body = replayed{Reader: io.MultiReader(bytes.NewReader(buf), errorReader{err}), body: r.Body}
+		return r, nil, capture.OmittedUnreadable
+	case int64(len(buf)) > max:
+		r.Body = replayed{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), body: r.Body}
+		return r, nil, capture.OmittedTooLarge
+	}
+	r.Body = replayed{Reader: bytes.NewReader(buf), body: r.Body}
+	return r, buf, ""
+}
+
+// replayed reads the bytes already taken from a body, then the rest of it,
+// and closes the original.
+type replayed struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b replayed) Close() error { return b.body.Close() }
+
+// errorReader fails every read with err, so a handler sees the error its
+// body produced while it was being captured.
+type errorReader struct{ err error }
+
+func (e errorReader) Read([]byte) (int, error) { return 0, e.err }
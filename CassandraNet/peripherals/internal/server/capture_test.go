@@ -0,0 +1,80 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/capture"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+func TestCaptureRecordsSelectedRoutes(t *testing.T) {
+	logger, _ := bufferLogger()
+	dir := t.TempDir()
+	w := capture.NewWriter(dir, 1<<20, 2)
+	var seen []string
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, string(body))
+		w.WriteHeader(http.StatusAccepted)
+	}), RequestID(logger), Capture(CaptureConfig{
+		Writer:       w,
+		Routes:       []SampleRule{{Method: http.MethodPost, Prefix: "/topics", Rate: 1}},
+		MaxBodyBytes: 64,
+		Redaction:    capture.Redaction{Fields: capture.DefaultFields},
+	}))
+	serve := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(logging.RequestIDHeader, "req-"+method)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "secret-key")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve(http.MethodPost, "/topics/match/publish", `{"payload_base64":"aGk=","priority":"high"}`)
+	serve(http.MethodGet, "/topics/match/pull", "")
+	serve(http.MethodPost, "/topics/match/publish", strings.Repeat("x", 100))
+	w.Close()
+
+	if len(seen) != 3 || seen[0] != `{"payload_base64":"aGk=","priority":"high"}` || len(seen[2]) != 100 {
+		t.Fatalf("expected handlers to read the bodies unchanged, got %q", seen)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "capture-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("expected one capture file, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := capture.NewReader(f)
+	first, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RequestID != "req-POST" || first.Status != http.StatusAccepted || first.URI != "/topics/match/publish" {
+		t.Fatalf("unexpected record %+v", first)
+	}
+	if first.Header.Get("X-API-Key") != "" || first.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected credentials dropped and other headers kept, got %v", first.Header)
+	}
+	if string(first.Body) != `{"payload_base64":"REDACTED","priority":"high"}` {
+		t.Fatalf("expected the payload redacted, got %s", first.Body)
+	}
+	second, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.BodyOmitted != capture.OmittedTooLarge || second.Payload() != nil {
+		t.Fatalf("expected the long body left out, got %+v", second)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("expected the GET not captured, got %v", err)
+	}
+}
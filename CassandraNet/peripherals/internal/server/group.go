@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RunGroup supervises a process's long-running components (HTTP servers,
+// TCP/UDP listeners, background loops) and its shutdown hooks. Run starts
+// every component, and when the context is cancelled or any component fails
+// it cancels the rest, waits for them to return, and then runs the hooks in
+// the order they were registered. main.go therefore lists shutdown steps
+// top to bottom instead of relying on defer ordering.
+type RunGroup struct {
+	shutdownTimeout time.Duration
+	logger          interface {
+		Printf(string, ...any)
+	}
+
+	runners []namedRunner
+	hooks   []namedHook
+}
+
+type namedRunner struct {
+	name string
+	run  func(context.Context) error
+}
+
+type namedHook struct {
+	name string
+	fn   func(context.Context) error
+	// prompt hooks return once their context ends, so they are waited
+	// for rather than abandoned and their results are not lost.
+	prompt bool
+}
+
+// NewRunGroup constructs a group whose components and hooks together get
+// shutdownTimeout (default 5s) to finish once shutdown begins.
+func NewRunGroup(shutdownTimeout time.Duration, logger interface {
+	Printf(string, ...any)
+}) *RunGroup {
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 5 * time.Second
+	}
+	if logger == nil {
+		logger = discardLogger{}
+	}
+	return &RunGroup{shutdownTimeout: shutdownTimeout, logger: logger}
+}
+
+// Go adds a component. run must block until ctx is cancelled and then
+// return promptly. Returning an error triggers shutdown of the whole group;
+// returning nil early only ends that component.
+func (g *RunGroup) Go(name string, run func(ctx context.Context) error) {
+	g.runners = append(g.runners, namedRunner{name: name, run: run})
+}
+
+// AddHTTP adds srv, served with Run and opts.
+func (g *RunGroup) AddHTTP(name string, srv *http.Server, opts ...Option) {
+	g.Go(name, func(ctx context.Context) error {
+		return Run(ctx, srv, g.shutdownTimeout, opts...)
+	})
+}
+
+// OnShutdown registers a hook to run after every component has returned.
+// The hook's context expires with the group's shutdown deadline.
+func (g *RunGroup) OnShutdown(name string, fn func(ctx context.Context) error) {
+	g.hooks = append(g.hooks, namedHook{name: name, fn: fn})
+}
+
+// OnStop registers a hook for a Stop-style method such as pool.Stop.
+func (g *RunGroup) OnStop(name string, fn func()) {
+	g.OnShutdown(name, func(context.Context) error {
+		fn()
+		return nil
+	})
+}
+
+// OnDrain registers a hook for a Stop-style method that finishes queued
+// work until the shutdown deadline, such as pool.Stop, and logs how many
+// items it abandoned. fn must return promptly once ctx ends.
+func (g *RunGroup) OnDrain(name string, fn func(ctx context.Context) (abandoned int, err error)) {
+	g.hooks = append(g.hooks, namedHook{name: name, prompt: true, fn: func(ctx context.Context) error {
+		abandoned, err := fn(ctx)
+		if abandoned > 0 {
+			g.logger.Printf("shutdown %s: abandoned %d items", name, abandoned)
+		}
+		return err
+	}})
+}
+
+// Run starts every component and blocks until the group has shut down. It
+// returns the first component error joined with any hook failures; a clean
+// shutdown after ctx is cancelled returns nil.
+func (g *RunGroup) Run(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(g.runners))
+	var wg sync.WaitGroup
+	for _, r := range g.runners {
+		r := r
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- result{name: r.name, err: r.run(runCtx)}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var errs []error
+	pending := len(g.runners)
+	for pending > 0 && runCtx.Err() == nil {
+		select {
+		case res := <-results:
+			pending--
+			if res.err != nil {
+				g.logger.Printf("%s failed: %v", res.name, res.err)
+				errs = append(errs, fmt.Errorf("%s: %w", res.name, res.err))
+				cancel()
+			}
+		case <-runCtx.Done():
+		}
+	}
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), g.shutdownTimeout)
+	defer cancelShutdown()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		g.logger.Printf("components did not stop within %s", g.shutdownTimeout)
+	}
+	// Collect results from components that stopped during shutdown; any
+	// still running past the deadline are abandoned.
+	for collecting := true; collecting; {
+		select {
+		case res := <-results:
+			if res.err != nil && !errors.Is(res.err, context.Canceled) {
+				errs = append(errs, fmt.Errorf("%s: %w", res.name, res.err))
+			}
+		default:
+			collecting = false
+		}
+	}
+
+	for _, h := range g.hooks {
+		if err := runHook(shutdownCtx, h); err != nil {
+			g.logger.Printf("shutdown %s: %v", h.name, err)
+			errs = append(errs, fmt.Errorf("shutdown %s: %w", h.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runHook runs h, abandoning it if ctx expires first so a stuck Stop cannot
+// hold the process open. Prompt hooks are left to honour ctx themselves.
+func runHook(ctx context.Context, h namedHook) error {
+	if h.prompt {
+		return h.fn(ctx)
+	}
+	errCh := make(chan error, 1)
+	go func() { errCh <- h.fn(ctx) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
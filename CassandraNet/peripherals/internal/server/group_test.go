@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunGroupShutdownOrder(t *testing.T) {
+	var mu sync.Mutex
+	var steps []string
+	record := func(step string) {
+		mu.Lock()
+		steps = append(steps, step)
+		mu.Unlock()
+	}
+
+	g := NewRunGroup(time.Second, nil)
+	g.Go("listener", func(ctx context.Context) error {
+		<-ctx.Done()
+		record("listener")
+		return nil
+	})
+	g.OnStop("pool", func() { record("pool") })
+	g.OnShutdown("service", func(context.Context) error {
+		record("service")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- g.Run(ctx) }()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+	if got := strings.Join(steps, ","); got != "listener,pool,service" {
+		t.Fatalf("unexpected shutdown order %s", got)
+	}
+}
+
+func TestRunGroupFailureStopsOthers(t *testing.T) {
+	boom := errors.New("bind failed")
+	stopped := make(chan struct{})
+	hookErr := errors.New("flush failed")
+
+	g := NewRunGroup(time.Second, nil)
+	g.Go("graphite", func(context.Context) error { return boom })
+	g.Go("http", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+	g.OnShutdown("snapshot", func(context.Context) error { return hookErr })
+
+	err := g.Run(context.Background())
+	select {
+	case <-stopped:
+	default:
+		t.Fatal("expected the remaining component to be stopped")
+	}
+	if !errors.Is(err, boom) || !errors.Is(err, hookErr) {
+		t.Fatalf("expected component and hook errors, got %v", err)
+	}
+}
+
+func TestRunGroupAbandonsStuckHooks(t *testing.T) {
+	g := NewRunGroup(20*time.Millisecond, nil)
+	g.OnStop("stuck", func() { select {} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	err := g.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("stuck hook held up shutdown")
+	}
+}
+
+type lineLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *lineLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+
+func TestRunGroupReportsAbandonedItems(t *testing.T) {
+	logger := &lineLogger{}
+	g := NewRunGroup(20*time.Millisecond, logger)
+	g.OnDrain("pool", func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 3, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if !slices.Contains(logger.lines, "shutdown pool: abandoned 3 items") {
+		t.Fatalf("expected the abandoned items logged, got %q", logger.lines)
+	}
+}
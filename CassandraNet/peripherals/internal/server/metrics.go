@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the request
+// duration histogram; they match the Prometheus client defaults.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// maxRoutes caps the distinct route labels; further routes are recorded
+// as "other".
+const maxRoutes = 256
+
+// HTTPMetrics records request counts, durations, and in-flight requests per
+// route and serves them in the Prometheus text format.
+//
+// Routes are path templates: segments that look like identifiers (they
+// contain a digit, except version segments such as "v1", or are over 32
+// bytes) become "{id}", so "/content/c-42/review" is "/content/{id}/review".
+// A path first seen on a 404 or 405 response is recorded as "unmatched"
+// until it succeeds once, so scanners cannot fill the route set.
+type HTTPMetrics struct {
+	buckets  []float64
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	routes   map[string]bool
+	requests map[requestKey]uint64
+	latency  map[latencyKey]*histogram
+}
+
+type requestKey struct {
+	method, route string
+	code          int
+}
+
+type latencyKey struct {
+	method, route string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHTTPMetrics returns an empty recorder using DefaultDurationBuckets.
+func NewHTTPMetrics() *HTTPMetrics {
+	return &HTTPMetrics{
+		buckets:  DefaultDurationBuckets,
+		routes:   make(map[string]bool),
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[latencyKey]*histogram),
+	}
+}
+
+// Middleware records every request passing through it. Place it outside
+// Recover and Timeout so their 500 and 503 responses are counted.
+func (m *HTTPMetrics) Middleware() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.inFlight.Add(1)
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			defer func() {
+				m.inFlight.Add(-1)
+				m.observe(r.Method, r.URL.Path, rec.Status(), time.Since(start))
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+func (m *HTTPMetrics) observe(method, path string, code int, elapsed time.Duration) {
+	method = methodLabel(method)
+	template := routeTemplate(path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	route := template
+	if !m.routes[template] {
+		switch {
+		case code == http.StatusNotFound || code == http.StatusMethodNotAllowed:
+			route = "unmatched"
+		case len(m.routes) >= maxRoutes:
+			route = "other"
+		default:
+			m.routes[template] = true
+		}
+	}
+	m.requests[requestKey{method, route, code}]++
+	key := latencyKey{method, route}
+	h, ok := m.latency[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.latency[key] = h
+	}
+	seconds := elapsed.Seconds()
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+func routeTemplate(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if looksLikeID(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+func looksLikeID(segment string) bool {
+	if len(segment) > 32 {
+		return true
+	}
+	if len(segment) > 1 && segment[0] == 'v' && strings.Trim(segment[1:], "0123456789") == "" {
+		return false
+	}
+	return strings.ContainsAny(segment, "0123456789")
+}
+
+// ServeHTTP serves GET /metrics in the Prometheus text format, or OpenMetrics
+// when the scraper asks for it.
+func (m *HTTPMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "server", http.MethodGet)
+		return
+	}
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	}
+	m.WritePrometheus(w, openMetrics)
+	if openMetrics {
+		_, _ = io.WriteString(w, "# EOF\n")
+	}
+}
+
+// WritePrometheus writes the metric families without the OpenMetrics "# EOF"
+// terminator, so they can be appended to another exposition.
+func (m *HTTPMetrics) WritePrometheus(w io.Writer, openMetrics bool) {
+	m.mu.Lock()
+	requests := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		requests = append(requests, k)
+	}
+	counts := make(map[requestKey]uint64, len(m.requests))
+	for k, v := range m.requests {
+		counts[k] = v
+	}
+	latencies := make([]latencyKey, 0, len(m.latency))
+	hists := make(map[latencyKey]histogram, len(m.latency))
+	for k, h := range m.latency {
+		latencies = append(latencies, k)
+		hists[k] = histogram{counts: append([]uint64(nil), h.counts...), count: h.count, sum: h.sum}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	sort.Slice(latencies, func(i, j int) bool {
+		a, b := latencies[i], latencies[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.method < b.method
+	})
+
+	fmt.Fprintln(w, "# HELP http_requests_in_flight Requests currently being served.")
+	fmt.Fprintln(w, "# TYPE http_requests_in_flight gauge")
+	fmt.Fprintf(w, "http_requests_in_flight %d\n", m.inFlight.Load())
+
+	if openMetrics {
+		fmt.Fprintln(w, "# HELP http_requests Requests served, by method, route, and status code.")
+		fmt.Fprintln(w, "# TYPE http_requests counter")
+	} else {
+		fmt.Fprintln(w, "# HELP http_requests_total Requests served, by method, route, and status code.")
+		fmt.Fprintln(w, "# TYPE http_requests_total counter")
+	}
+	for _, k := range requests {
+		fmt.Fprintf(w, "http_requests_total{method=%q,route=%s,code=\"%d\"} %d\n", k.method, quoteLabel(k.route), k.code, counts[k])
+	}
+
+	fmt.Fprintln(w, "# HELP http_request_duration_seconds Time to serve requests, by method and route.")
+	fmt.Fprintln(w, "# TYPE http_request_duration_seconds histogram")
+	for _, k := range latencies {
+		h := hists[k]
+		labels := fmt.Sprintf("method=%q,route=%s", k.method, quoteLabel(k.route))
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, formatBound(bound), cumulative)
+		}
+		fmt.Fprintf(w, "http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		fmt.Fprintf(w, "http_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "http_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+}
+
+// quoteLabel quotes a label value with the exposition format's escapes.
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value) + `"`
+}
+
+func formatBound(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
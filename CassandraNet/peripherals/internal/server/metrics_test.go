@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHTTPMetricsRecordsRoutes(t *testing.T) {
+	metrics := NewHTTPMetrics()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/content/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	logger, _ := bufferLogger()
+	handler := Chain(mux, Standard(logger, MiddlewareConfig{Metrics: metrics})...)
+
+	for _, path := range []string{"/content/c-1/review", "/content/c-2/review", "/wp-admin.php", "/panic", "/content/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/content/abc", nil))
+
+	rec := httptest.NewRecorder()
+	metrics.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`http_requests_in_flight 0`,
+		`# TYPE http_requests_total counter`,
+		`http_requests_total{method="POST",route="/content/{id}/review",code="201"} 2`,
+		`http_requests_total{method="POST",route="unmatched",code="404"} 2`,
+		`http_requests_total{method="POST",route="/panic",code="500"} 1`,
+		`http_requests_total{method="OTHER",route="/content/abc",code="201"} 1`,
+		`http_request_duration_seconds_bucket{method="POST",route="/content/{id}/review",le="+Inf"} 2`,
+		`http_request_duration_seconds_count{method="POST",route="/content/{id}/review"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("exposition missing %q:\n%s", want, body)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	metrics.ServeHTTP(rec, req)
+	if body := rec.Body.String(); !strings.Contains(body, "# TYPE http_requests counter") || !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("unexpected OpenMetrics exposition:\n%s", body)
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	cases := map[string]string{
+		"/":                       "/",
+		"/topics/events/messages": "/topics/events/messages",
+		"/topics/events/messages/9b3adf5985bcb4281f3fd108d2b670b2/ack": "/topics/events/messages/{id}/ack",
+		"/v1/metrics":       "/v1/metrics",
+		"/assignments/42":   "/assignments/{id}",
+		"/configs/ugc/prod": "/configs/ugc/prod",
+	}
+	for path, want := range cases {
+		if got := routeTemplate(path); got != want {
+			t.Errorf("routeTemplate(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
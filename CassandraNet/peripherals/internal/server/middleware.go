@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/capture"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Middleware wraps a handler with cross-cutting behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with mws. The first middleware is the outermost, so it sees
+// the request first and the response last.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// MiddlewareConfig tunes the standard middleware stack. Zero values disable
+// the corresponding limit.
+type MiddlewareConfig struct {
+	// Timeout bounds how long a handler may run before the client receives
+	// 503 Service Unavailable.
+	Timeout time.Duration
+	// MaxBodyBytes caps request bodies; reads past the cap fail and the
+	// handler's decode error becomes the response.
+	MaxBodyBytes int64
+	// BodyLimits override MaxBodyBytes on matching routes.
+	BodyLimits []BodyLimit
+	// Metrics, when set, records every request; binaries serve it at
+	// /metrics.
+	Metrics *HTTPMetrics
+	// CORS lets browsers on the allowed origins call the service.
+	CORS CORSConfig
+	// AccessLog samples the access log.
+	AccessLog AccessLogConfig
+	// Capture records sampled requests for replay.
+	Capture CaptureConfig
+}
+
+// MiddlewareFromConfig reads REQUEST_TIMEOUT (default 30s),
+// MAX_BODY_BYTES (default 10 MiB), MAX_BODY_ROUTES, the CORS_* settings,
+// ACCESS_LOG_SAMPLE (default 1), ACCESS_LOG_SAMPLE_ROUTES, and the
+// CAPTURE_* settings from loader, and creates the HTTP metrics recorder.
+// Capture files are written to CAPTURE_DIR (empty disables capture) for the
+// CAPTURE_ROUTES, keeping CAPTURE_MAX_BODY_BYTES (default 64 KiB) of each
+// body in files of CAPTURE_MAX_FILE_BYTES (default 64 MiB), at most
+// CAPTURE_MAX_FILES (default 8) of them, and redacting CAPTURE_REDACT_FIELDS
+// (default capture.DefaultFields) and CAPTURE_REDACT_HEADERS. Malformed body
+// limits and sample rates are reported rather than ignored.
+func MiddlewareFromConfig(loader config.Loader) (MiddlewareConfig, error) {
+	cfg := MiddlewareConfig{
+		Timeout:      loader.Duration("REQUEST_TIMEOUT", 30*time.Second),
+		MaxBodyBytes: int64(loader.Int("MAX_BODY_BYTES", 10<<20)),
+		Metrics:      NewHTTPMetrics(),
+		CORS: CORSConfig{
+			AllowedOrigins:   loader.StringSlice("CORS_ALLOWED_ORIGINS", nil),
+			AllowedMethods:   loader.StringSlice("CORS_ALLOWED_METHODS", nil),
+			AllowedHeaders:   loader.StringSlice("CORS_ALLOWED_HEADERS", nil),
+			AllowCredentials: loader.Bool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           loader.Duration("CORS_MAX_AGE", 10*time.Minute),
+		},
+	}
+	for _, spec := range loader.StringSlice("MAX_BODY_ROUTES", nil) {
+		limit, err := ParseBodyLimit(spec)
+		if err != nil {
+			return MiddlewareConfig{}, fmt.Errorf("%sMAX_BODY_ROUTES: %w", loader.Prefix, err)
+		}
+		cfg.BodyLimits = append(cfg.BodyLimits, limit)
+	}
+	cfg.AccessLog.Sample = loader.Float64("ACCESS_LOG_SAMPLE", 1)
+	if cfg.AccessLog.Sample <= 0 || cfg.AccessLog.Sample > 1 {
+		return MiddlewareConfig{}, fmt.Errorf("%sACCESS_LOG_SAMPLE: must be above 0 and at most 1", loader.Prefix)
+	}
+	for _, spec := range loader.StringSlice("ACCESS_LOG_SAMPLE_ROUTES", nil) {
+		rule, err := ParseSampleRule(spec)
+		if err != nil {
+			return MiddlewareConfig{}, fmt.Errorf("%sACCESS_LOG_SAMPLE_ROUTES: %w", loader.Prefix, err)
+		}
+		cfg.AccessLog.Routes = append(cfg.AccessLog.Routes, rule)
+	}
+	if dir := loader.String("CAPTURE_DIR", ""); dir != "" {
+		cfg.Capture.Writer = capture.NewWriter(dir, int64(loader.Int("CAPTURE_MAX_FILE_BYTES", 64<<20)), loader.Int("CAPTURE_MAX_FILES", 8))
+	}
+	for _, spec := range loader.StringSlice("CAPTURE_ROUTES", nil) {
+		rule, err := ParseSampleRule(spec)
+		if err != nil {
+			return MiddlewareConfig{}, fmt.Errorf("%sCAPTURE_ROUTES: %w", loader.Prefix, err)
+		}
+		cfg.Capture.Routes = append(cfg.Capture.Routes, rule)
+	}
+	cfg.Capture.MaxBodyBytes = int64(loader.Int("CAPTURE_MAX_BODY_BYTES", 64<<10))
+	cfg.Capture.Redaction = capture.Redaction{
+		Fields:  loader.StringSlice("CAPTURE_REDACT_FIELDS", capture.DefaultFields),
+		Headers: loader.StringSlice("CAPTURE_REDACT_HEADERS", nil),
+	}
+	return cfg, nil
+}
+
+// Standard returns the middleware every service wraps its handler with:
+// request IDs, request metrics (when cfg.Metrics is set), sampled access
+// logging, panic recovery, CORS, body size limits and decompression,
+// request capture, and timeout.
+func Standard(logger *logging.Logger, cfg MiddlewareConfig) []Middleware {
+	mws := []Middleware{RequestID(logger)}
+	if cfg.Metrics != nil {
+		mws = append(mws, cfg.Metrics.Middleware())
+	}
+	return append(mws,
+		AccessLog(logger, cfg.AccessLog),
+		Recover(logger),
+		CORS(cfg.CORS),
+		LimitBodies(cfg.MaxBodyBytes, cfg.BodyLimits),
+		Capture(cfg.Capture),
+		Timeout(cfg.Timeout),
+	)
+}
+
+// RequestID assigns correlation IDs and a request-scoped logger; see
+// logging.Middleware.
+func RequestID(logger *logging.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return logging.Middleware(logger, next)
+	}
+}
+
+func isProbe(path string) bool {
+	switch path {
+	case "/healthz", "/livez", "/readyz", "/metrics":
+		return true
+	}
+	return false
+}
+
+// Recover turns a handler panic into 500 Internal Server Error (when no
+// response has been started) and logs the panic with its stack.
+// http.ErrAbortHandler is re-raised so the server aborts the response as
+// intended.
+func Recover(logger *logging.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rec := newResponseRecorder(w)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(v)
+				}
+				l, ok := logging.FromContext(r.Context())
+				if !ok {
+					l = logger
+				}
+				l.Error("panic serving request", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+				if !rec.wroteHeader {
+					problem.Write(rec, r, http.StatusInternalServerError, "server.internal_error", "internal server error")
+				}
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// MaxBody limits request bodies to n bytes. n <= 0 leaves bodies unlimited.
+// It is LimitBodies without per-route limits.
+func MaxBody(n int64) Middleware {
+	return LimitBodies(n, nil)
+}
+
+// Timeout answers 503 Service Unavailable when a handler runs longer than d
+// and cancels the request context so the handler can stop early. d <= 0
+// disables the limit. Requests accepting only text/event-stream are
+// exempt: streams stay open until the client leaves, and the timeout
+// handler buffers responses, which would hold their events back. WebSocket
+// handshakes are exempt for the same reason, and because the timeout
+// handler's writer cannot be hijacked.
+func Timeout(d time.Duration) Middleware {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+		limited := http.TimeoutHandler(next, d, "request timed out")
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Accept") == "text/event-stream" || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	}
+}
+
+// responseRecorder captures the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Status returns the response status, defaulting to 200 when the handler
+// wrote nothing.
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		if !r.wroteHeader {
+			r.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does. A
+// hijacked connection is recorded as 101 Switching Protocols, since the
+// handler answers on the raw connection.
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("server: response writer does not support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && !r.wroteHeader {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
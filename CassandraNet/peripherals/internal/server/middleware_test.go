@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+func bufferLogger() (*logging.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return logging.NewWithOptions("svc", logging.Options{Output: &buf}), &buf
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}), mark("outer"), mark("inner"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "outer,inner,handler" {
+		t.Fatalf("unexpected order %s", got)
+	}
+}
+
+func TestStandardRecoversAndLogs(t *testing.T) {
+	logger, buf := bufferLogger()
+	h := Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}), Standard(logger, MiddlewareConfig{})...)
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "ERROR panic serving request request_id=req-1") || !strings.Contains(out, "panic=boom") {
+		t.Fatalf("expected panic log with request id, got %q", out)
+	}
+	if !strings.Contains(out, "INFO request request_id=req-1 method=GET path=/items route=/items status=500") {
+		t.Fatalf("expected access log with 500 status, got %q", out)
+	}
+}
+
+func TestMaxBodyRejectsLargeBodies(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), MaxBody(4))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long")))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for declared length, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("too long")))
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for streamed body, got %d", rec.Code)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}), Timeout(20*time.Millisecond))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+
+	stream := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(40 * time.Millisecond)
+		w.(http.Flusher).Flush()
+	}), Timeout(20*time.Millisecond))
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	stream.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !rec.Flushed {
+		t.Fatalf("expected the stream to outlive the timeout, got %d", rec.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	handler := CORS(CORSConfig{AllowedOrigins: []string{"https://admin.example.com"}, MaxAge: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/ugc/content", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "X-API-Key, Content-Type")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected preflight to be answered, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://admin.example.com" {
+		t.Fatalf("unexpected allow origin %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Headers"); got != "X-API-Key, Content-Type" {
+		t.Fatalf("unexpected allow headers %q", got)
+	}
+	if got := rec.Header().Get("Access-Control-Max-Age"); got != "60" {
+		t.Fatalf("unexpected max age %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ugc/content", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("expected no CORS headers for a disallowed origin")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ugc/content", nil)
+	req.Header.Set("Origin", "https://admin.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("Access-Control-Expose-Headers"), "RateLimit-Remaining") {
+		t.Fatalf("expected the request to reach the handler with exposed headers, got %d %q", rec.Code, rec.Header().Get("Access-Control-Expose-Headers"))
+	}
+
+	rec = httptest.NewRecorder()
+	CORS(CORSConfig{})(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Header().Get("Vary") != "" || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("expected CORS without allowed origins to add no headers")
+	}
+}
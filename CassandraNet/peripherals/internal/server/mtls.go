@@ -0,0 +1,82 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// LoadCertPool reads every PEM certificate in path into a pool.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("server: no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// PeerIdentity names the holder of cert: its SPIFFE ID (a spiffe:// URI
+// SAN) when present, otherwise its first DNS SAN, otherwise its common name.
+func PeerIdentity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// ClientIdentity returns the identity of the verified client certificate
+// presented on r's connection, if any.
+func ClientIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return PeerIdentity(r.TLS.VerifiedChains[0][0]), true
+}
+
+// applyClientAuth configures cfg to verify client certificates when a
+// client CA is set.
+func (c TLSConfig) applyClientAuth(cfg *tls.Config) error {
+	if c.ClientCAFile == "" {
+		if len(c.AllowedClientIDs) > 0 {
+			return errors.New("server: allowed client IDs need a client CA file")
+		}
+		return nil
+	}
+	pool, err := LoadCertPool(c.ClientCAFile)
+	if err != nil {
+		return err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if c.ClientCertOptional {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if len(c.AllowedClientIDs) > 0 {
+		allowed := make(map[string]bool, len(c.AllowedClientIDs))
+		for _, id := range c.AllowedClientIDs {
+			allowed[id] = true
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return nil
+			}
+			if id := PeerIdentity(cs.PeerCertificates[0]); !allowed[id] {
+				return fmt.Errorf("server: client %q is not allowed", id)
+			}
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert writes a self-signed client certificate carrying spiffeID
+// as a URI SAN; the certificate file doubles as its own CA bundle.
+func writeClientCert(t *testing.T, dir, spiffeID string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	id, err := url.Parse(spiffeID)
+	if err != nil {
+		t.Fatalf("parse id: %v", err)
+	}
+	writeCertFrom(t, certFile, keyFile, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		URIs:        []*url.URL{id},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return certFile, keyFile
+}
+
+func TestRunRequiresClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeCert(t, certFile, keyFile, "server")
+	clientCert, clientKey := writeClientCert(t, t.TempDir(), "spiffe://cassandra/ugc-service")
+
+	for _, tc := range []struct {
+		name    string
+		allowed []string
+		present bool
+		wantOK  bool
+	}{
+		{"verified client", nil, true, true},
+		{"allowed identity", []string{"spiffe://cassandra/ugc-service"}, true, true},
+		{"identity not allowed", []string{"spiffe://cassandra/other"}, true, false},
+		{"no certificate", nil, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := freeAddr(t)
+			srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id, _ := ClientIdentity(r)
+				_, _ = w.Write([]byte(id))
+			}), ErrorLog: log.New(io.Discard, "", 0)}
+			startServer(t, srv, WithTLS(TLSConfig{
+				CertFile:         certFile,
+				KeyFile:          keyFile,
+				ClientCAFile:     clientCert,
+				AllowedClientIDs: tc.allowed,
+			}))
+
+			cfg := &tls.Config{InsecureSkipVerify: true}
+			if tc.present {
+				pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+				if err != nil {
+					t.Fatalf("load client pair: %v", err)
+				}
+				cfg.Certificates = []tls.Certificate{pair}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+			waitForTCP(t, addr)
+
+			resp, err := client.Get("https://" + addr)
+			if !tc.wantOK {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("expected the handshake to fail, got %s", resp.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != "spiffe://cassandra/ugc-service" {
+				t.Fatalf("unexpected client identity %q", body)
+			}
+		})
+	}
+}
+
+// waitForTCP blocks until addr accepts connections.
+func waitForTCP(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("dial %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// ReloadFunc prepares a component from loader without disturbing the one in
+// use, returning a function that installs it. Preparing does the work that
+// can fail, such as parsing rules or reading files; installing must not
+// fail.
+type ReloadFunc func(loader config.Loader) (install func(), err error)
+
+// Reloader rebuilds components from fresh configuration when the process
+// receives SIGHUP. A reload re-reads the config file and the config service
+// document, prepares every component, and installs them together only when
+// all were prepared, so a mistake in one setting leaves the previous
+// configuration in effect everywhere. Components swap in atomically:
+// requests already being served finish with the version they started with.
+//
+// Settings from the environment and flags are fixed at startup, as are
+// listeners, TLS files (see CertReloader), and storage.
+type Reloader struct {
+	logger interface {
+		Printf(string, ...any)
+	}
+
+	mu         sync.Mutex
+	loader     config.Loader
+	components []component
+}
+
+type component struct {
+	name   string
+	reload ReloadFunc
+}
+
+// NewReloader returns a Reloader starting from loader.
+func NewReloader(loader config.Loader, logger interface {
+	Printf(string, ...any)
+}) *Reloader {
+	return &Reloader{loader: loader, logger: logger}
+}
+
+// Add registers a component, named in errors, rebuilt by reload.
+func (r *Reloader) Add(name string, reload ReloadFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.components = append(r.components, component{name: name, reload: reload})
+}
+
+// Loader returns the configuration last installed.
+func (r *Reloader) Loader() config.Loader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.loader
+}
+
+// Reload re-reads the configuration and rebuilds every component. On error
+// no component changes.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next, err := r.loader.Reload()
+	if err != nil {
+		return err
+	}
+	installs := make([]func(), 0, len(r.components))
+	for _, c := range r.components {
+		install, err := c.reload(next)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.name, err)
+		}
+		installs = append(installs, install)
+	}
+	for _, install := range installs {
+		install()
+	}
+	r.loader = next
+	return nil
+}
+
+// Run reloads on every SIGHUP until ctx is done, logging the outcome. Add it
+// to a RunGroup with Go.
+func (r *Reloader) Run(ctx context.Context) error {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+	for {
+		select {
+		case <-sighup:
+			if err := r.Reload(); err != nil {
+				r.logger.Printf("reload failed; keeping the previous configuration: %v", err)
+				continue
+			}
+			r.logger.Printf("configuration reloaded")
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Standard wraps h with the Standard middleware for cfg and rebuilds the
+// chain from MiddlewareFromConfig on reload, so timeouts, body limits,
+// CORS, access log sampling, and request capture follow the configuration.
+// The HTTP metrics recorder is kept across reloads, as is the capture
+// writer while CAPTURE_DIR stays the same; a writer that is replaced is
+// closed.
+func (r *Reloader) Standard(logger *logging.Logger, cfg MiddlewareConfig, h http.Handler) http.Handler {
+	swap := NewSwap(Chain(h, Standard(logger, cfg)...))
+	writer := cfg.Capture.Writer
+	r.Add("middleware", func(loader config.Loader) (func(), error) {
+		next, err := MiddlewareFromConfig(loader)
+		if err != nil {
+			return nil, err
+		}
+		next.Metrics = cfg.Metrics
+		if writer != nil && next.Capture.Writer != nil && writer.Dir() == next.Capture.Writer.Dir() {
+			next.Capture.Writer = writer
+		}
+		chain := Chain(h, Standard(logger, next)...)
+		return func() {
+			swap.Store(chain)
+			if writer != nil && writer != next.Capture.Writer {
+				_ = writer.Close()
+			}
+			writer = next.Capture.Writer
+		}, nil
+	})
+	return swap
+}
+
+// Swap serves the handler stored last. Requests read it once on arrival, so
+// storing a new one never interrupts requests in flight.
+type Swap struct {
+	h atomic.Pointer[http.Handler]
+}
+
+// NewSwap returns a Swap serving h.
+func NewSwap(h http.Handler) *Swap {
+	s := &Swap{}
+	s.Store(h)
+	return s
+}
+
+// Store replaces the handler for requests arriving from now on.
+func (s *Swap) Store(h http.Handler) {
+	s.h.Store(&h)
+}
+
+func (s *Swap) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.h.Load()).ServeHTTP(w, r)
+}
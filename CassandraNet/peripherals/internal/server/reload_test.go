@@ -0,0 +1,97 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+func writeConfig(t *testing.T, path, doc string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestReloaderInstallsAllOrNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.json")
+	writeConfig(t, path, `{"workers": 4, "mode": "fast"}`)
+	loader, err := config.Load("SVC", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workers, mode := 4, "fast"
+	r := NewReloader(loader, discardLogger{})
+	r.Add("workers", func(l config.Loader) (func(), error) {
+		n := l.Int("WORKERS", 0)
+		return func() { workers = n }, nil
+	})
+	r.Add("mode", func(l config.Loader) (func(), error) {
+		m := l.String("MODE", "")
+		if m != "fast" && m != "safe" {
+			return nil, errors.New("unknown mode " + m)
+		}
+		return func() { mode = m }, nil
+	})
+
+	writeConfig(t, path, `{"workers": 8, "mode": "reckless"}`)
+	if err := r.Reload(); err == nil || !strings.Contains(err.Error(), "mode: unknown mode") {
+		t.Fatalf("expected the mode error, got %v", err)
+	}
+	if workers != 4 || mode != "fast" || r.Loader().Int("WORKERS", 0) != 4 {
+		t.Fatalf("failed reload changed components: workers=%d mode=%s", workers, mode)
+	}
+
+	writeConfig(t, path, `{"workers": 8, "mode": "safe"}`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if workers != 8 || mode != "safe" || r.Loader().Int("WORKERS", 0) != 8 {
+		t.Fatalf("reload not installed: workers=%d mode=%s", workers, mode)
+	}
+}
+
+func TestReloaderStandard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.json")
+	writeConfig(t, path, `{"max_body_bytes": 4}`)
+	loader, err := config.Load("SVC", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := MiddlewareFromConfig(loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReloader(loader, discardLogger{})
+	logger, _ := bufferLogger()
+	h := r.Standard(logger, cfg, echo)
+
+	post := func() int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`"hello"`)))
+		return rec.Code
+	}
+	if code := post(); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 before reload, got %d", code)
+	}
+
+	writeConfig(t, path, `{"max_body_bytes": 64}`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if code := post(); code != http.StatusOK {
+		t.Fatalf("expected 200 after reload, got %d", code)
+	}
+	var metrics strings.Builder
+	cfg.Metrics.WritePrometheus(&metrics, false)
+	if !strings.Contains(metrics.String(), `code="413"`) || !strings.Contains(metrics.String(), `code="200"`) {
+		t.Fatalf("expected metrics kept across the reload, got\n%s", metrics.String())
+	}
+}
@@ -2,21 +2,129 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
 )
 
+// Option customises how Run serves.
+type Option func(*runOptions)
+
+type runOptions struct {
+	tls    TLSConfig
+	h2c    bool
+	logger interface {
+		Printf(string, ...any)
+	}
+}
+
+// WithTLS serves HTTPS using cfg. A config without certificate and key files
+// leaves the server on plain HTTP, so binaries can pass TLSFromConfig
+// unconditionally.
+func WithTLS(cfg TLSConfig) Option {
+	return func(o *runOptions) { o.tls = cfg }
+}
+
+// WithH2C additionally accepts HTTP/2 over cleartext connections (prior
+// knowledge, as sent by sidecar proxies) alongside HTTP/1.1. It has no effect
+// on TLS listeners, which negotiate HTTP/2 through ALPN.
+func WithH2C(enabled bool) Option {
+	return func(o *runOptions) { o.h2c = enabled }
+}
+
+// WithLogger sets the logger used for certificate reloads.
+func WithLogger(logger interface {
+	Printf(string, ...any)
+}) Option {
+	return func(o *runOptions) { o.logger = logger }
+}
+
+// OptionsFromConfig returns the listener options each binary reads from its
+// loader: TLS (see TLSFromConfig) and H2C, logging through logger.
+func OptionsFromConfig(loader config.Loader, logger interface {
+	Printf(string, ...any)
+}) []Option {
+	return []Option{
+		WithTLS(TLSFromConfig(loader)),
+		WithH2C(loader.Bool("H2C", false)),
+		WithLogger(logger),
+	}
+}
+
 // Run starts the HTTP server and blocks until the provided context is cancelled.
-// It performs a graceful shutdown with a configurable timeout.
-func Run(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration) error {
+// It performs a graceful shutdown with a configurable timeout. srv.Addr is a
+// TCP address or a Unix socket path written as "unix:///var/run/svc.sock".
+func Run(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration, opts ...Option) error {
+	o := runOptions{logger: discardLogger{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	if !o.tls.Enabled() && o.tls.ClientCAFile != "" {
+		return errors.New("server: client certificate verification needs a server certificate and key")
+	}
+	var reloader *CertReloader
+	if o.tls.Enabled() {
+		var err error
+		reloader, err = NewCertReloader(o.tls.CertFile, o.tls.KeyFile, o.logger)
+		if err != nil {
+			return err
+		}
+		cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+		if srv.TLSConfig != nil {
+			cfg = srv.TLSConfig.Clone()
+		}
+		cfg.GetCertificate = reloader.GetCertificate
+		if err := o.tls.applyClientAuth(cfg); err != nil {
+			reloader.Stop()
+			return err
+		}
+		srv.TLSConfig = cfg
+		if srv.Addr == "" {
+			addr = ":https"
+		}
+	}
+	if o.h2c && reloader == nil {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetUnencryptedHTTP2(true)
+		srv.Protocols = protocols
+	}
+	ln, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+	drainOnShutdown(srv)
+
 	errCh := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if reloader != nil {
+			err = srv.ServeTLS(ln, "", "")
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 		close(errCh)
 	}()
 
+	if reloader != nil {
+		reloader.Start(o.tls.ReloadInterval)
+		defer reloader.Stop()
+	}
+
 	select {
 	case <-ctx.Done():
 		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
@@ -26,3 +134,56 @@ func Run(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration) e
 		return err
 	}
 }
+
+// drainingKey carries the channel Draining returns.
+type drainingKey struct{}
+
+// drainOnShutdown gives srv's requests a channel that closes when its
+// graceful shutdown begins. Shutdown waits for active requests, so
+// responses that stay open, such as event streams, watch the channel and
+// end instead of holding the server until the timeout.
+func drainOnShutdown(srv *http.Server) {
+	draining := make(chan struct{})
+	base := srv.BaseContext
+	srv.BaseContext = func(ln net.Listener) context.Context {
+		ctx := context.Background()
+		if base != nil {
+			ctx = base(ln)
+		}
+		return context.WithValue(ctx, drainingKey{}, (<-chan struct{})(draining))
+	}
+	srv.RegisterOnShutdown(func() { close(draining) })
+}
+
+// Draining returns a channel that is closed once the server handling the
+// request begins a graceful shutdown. Requests not served through Run get
+// a nil channel, which never closes.
+func Draining(ctx context.Context) <-chan struct{} {
+	draining, _ := ctx.Value(drainingKey{}).(<-chan struct{})
+	return draining
+}
+
+// Listen opens a listener for addr: a Unix domain socket when addr has the
+// unix:// scheme, TCP otherwise. A stale socket file left by a previous run
+// is removed first; the socket is removed again when the listener closes.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixScheme)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if path == "" {
+		return nil, errors.New("server: unix socket address needs a path")
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+const unixScheme = "unix://"
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
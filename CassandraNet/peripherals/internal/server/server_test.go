@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startServer runs srv with opts until the test ends.
+func startServer(t *testing.T, srv *http.Server, opts ...Option) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, srv, time.Second, opts...) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run: %v", err)
+		}
+	})
+}
+
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// get retries until the server is accepting connections.
+func get(t *testing.T, client *http.Client, url string) *http.Response {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			return resp
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("get %s: %v", url, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func protoHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	})
+}
+
+func TestRunServesUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.sock")
+	startServer(t, &http.Server{Addr: "unix://" + path, Handler: protoHandler()})
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp := get(t, client, "http://svc/healthz")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 over unix socket, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunServesH2C(t *testing.T) {
+	addr := freeAddr(t)
+	startServer(t, &http.Server{Addr: addr, Handler: protoHandler()}, WithH2C(true))
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp := get(t, client, "http://"+addr+"/")
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+	}
+
+	// Plain HTTP/1.1 clients keep working.
+	resp = get(t, http.DefaultClient, "http://"+addr+"/")
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Fatalf("expected HTTP/1.1, got %s", resp.Proto)
+	}
+}
+
+func TestRunEndsOpenResponsesOnShutdown(t *testing.T) {
+	addr := freeAddr(t)
+	opened := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			close(opened)
+			select {
+			case <-Draining(r.Context()):
+			case <-r.Context().Done():
+			}
+		})}, 10*time.Second)
+	}()
+	resp := get(t, http.DefaultClient, "http://"+addr+"/")
+	defer resp.Body.Close()
+	<-opened
+
+	start := time.Now()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the open response to end with the shutdown, took %v", elapsed)
+	}
+}
+
+func TestListenRejectsEmptySocketPath(t *testing.T) {
+	if _, err := Listen("unix://"); err == nil {
+		t.Fatal("expected error for empty socket path")
+	}
+}
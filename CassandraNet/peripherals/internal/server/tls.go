@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+)
+
+// TLSConfig locates the certificate served by Run. Both files are PEM
+// encoded; the certificate file may carry intermediates after the leaf.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ReloadInterval is how often the files are checked for changes
+	// (default 30s).
+	ReloadInterval time.Duration
+	// ClientCAFile, when set, enables mutual TLS: clients must present a
+	// certificate signed by one of the PEM CAs in the file.
+	ClientCAFile string
+	// ClientCertOptional accepts clients without a certificate, still
+	// verifying those that present one.
+	ClientCertOptional bool
+	// AllowedClientIDs, when set, limits clients to these identities (see
+	// PeerIdentity).
+	AllowedClientIDs []string
+}
+
+// Enabled reports whether TLS is configured.
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// TLSFromConfig reads TLS_CERT_FILE, TLS_KEY_FILE, TLS_RELOAD_INTERVAL,
+// TLS_CLIENT_CA_FILE, TLS_CLIENT_CERT_OPTIONAL, and TLS_ALLOWED_CLIENT_IDS
+// from loader.
+func TLSFromConfig(loader config.Loader) TLSConfig {
+	return TLSConfig{
+		CertFile:           loader.String("TLS_CERT_FILE", ""),
+		KeyFile:            loader.String("TLS_KEY_FILE", ""),
+		ReloadInterval:     loader.Duration("TLS_RELOAD_INTERVAL", 30*time.Second),
+		ClientCAFile:       loader.String("TLS_CLIENT_CA_FILE", ""),
+		ClientCertOptional: loader.Bool("TLS_CLIENT_CERT_OPTIONAL", false),
+		AllowedClientIDs:   loader.StringSlice("TLS_ALLOWED_CLIENT_IDS", nil),
+	}
+}
+
+// CertReloader serves a certificate pair from disk and swaps in a new pair
+// when either file changes. Established connections keep the certificate
+// they negotiated; only new handshakes see the replacement. A pair that
+// fails to load is logged and the previous certificate stays in use.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	logger   interface {
+		Printf(string, ...any)
+	}
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	certStamp fileStamp
+	keyStamp  fileStamp
+
+	stop      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+	wg        sync.WaitGroup
+}
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// NewCertReloader loads the pair at certFile and keyFile.
+func NewCertReloader(certFile, keyFile string, logger interface {
+	Printf(string, ...any)
+}) (*CertReloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("server: TLS requires both a certificate and a key file")
+	}
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+		stop:     make(chan struct{}),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate; it is meant for
+// tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// GetClientCertificate returns the current certificate; it is meant for
+// tls.Config.GetClientCertificate.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.GetCertificate(nil)
+}
+
+// Reload reads the pair from disk and replaces the served certificate.
+func (r *CertReloader) Reload() error {
+	certStamp, err := statFile(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyStamp, err := statFile(r.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.certStamp = certStamp
+	r.keyStamp = keyStamp
+	r.mu.Unlock()
+	return nil
+}
+
+// Start polls the files every interval (default 30s) and reloads the pair
+// when either changes.
+func (r *CertReloader) Start(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	r.startOnce.Do(func() {
+		ticker := time.NewTicker(interval)
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if !r.changed() {
+						continue
+					}
+					if err := r.Reload(); err != nil {
+						r.logger.Printf("tls certificate reload failed: %v", err)
+						continue
+					}
+					r.logger.Printf("tls certificate reloaded from %s", r.certFile)
+				case <-r.stop:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Stop halts polling and waits for the background loop to exit.
+func (r *CertReloader) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		r.wg.Wait()
+	})
+}
+
+// changed reports whether either file differs from the last stamps seen.
+// Files mid-rotation (missing) are treated as unchanged until they settle.
+// The new stamps are recorded up front so a broken pair is reported once
+// rather than on every poll.
+func (r *CertReloader) changed() bool {
+	certStamp, err := statFile(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyStamp, err := statFile(r.keyFile)
+	if err != nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if certStamp.equal(r.certStamp) && keyStamp.equal(r.keyStamp) {
+		return false
+	}
+	r.certStamp, r.keyStamp = certStamp, keyStamp
+	return true
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
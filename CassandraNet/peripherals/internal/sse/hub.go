@@ -0,0 +1,180 @@
+// Package sse serves server-sent event streams. A Hub fans values out to
+// subscribers, each with a buffer of its own, and keeps the most recent
+// values so a client that reconnects with the ID of the last event it saw
+// receives what it missed. A Stream writes events to one response, and
+// Relay pumps a subscription into a stream with keep-alive comments until
+// the client leaves.
+//
+// Event IDs name the hub that issued them, so an ID from another replica,
+// or from before a restart, is recognised as one the hub cannot resume
+// from rather than mistaken for a position in its own history.
+package sse
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Config.
+const (
+	DefaultBuffer    = 64
+	DefaultHistory   = 256
+	DefaultKeepAlive = 15 * time.Second
+)
+
+// Config tunes a Hub. Zero values select the defaults.
+type Config struct {
+	// Buffer is the values held for a subscriber before it is dropped as
+	// too slow (default 64).
+	Buffer int
+	// History is the most recent values kept for resuming subscribers
+	// (default 256); a negative value keeps none.
+	History int
+}
+
+// Item is one value published to a Hub and the event ID it is sent under.
+type Item[T any] struct {
+	ID    string
+	Value T
+}
+
+// Hub fans published values out to its subscribers. Publishing never
+// blocks: a subscriber whose buffer is full is closed instead, and its
+// client is expected to reconnect and resume.
+type Hub[T any] struct {
+	buffer  int
+	history int
+	epoch   string
+
+	mu     sync.Mutex
+	seq    uint64
+	recent []entry[T]
+	subs   map[*Subscription[T]]struct{}
+}
+
+// entry is an item kept in a hub's history with its sequence number.
+type entry[T any] struct {
+	seq  uint64
+	item Item[T]
+}
+
+// NewHub returns an empty hub.
+func NewHub[T any](cfg Config) *Hub[T] {
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultBuffer
+	}
+	if cfg.History == 0 {
+		cfg.History = DefaultHistory
+	}
+	return &Hub[T]{
+		buffer:  cfg.Buffer,
+		history: max(cfg.History, 0),
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		subs:    make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Publish hands v to every subscriber it matches and returns its event ID.
+func (h *Hub[T]) Publish(v T) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	item := Item[T]{ID: h.epoch + "-" + strconv.FormatUint(h.seq, 10), Value: v}
+	if h.history > 0 {
+		if len(h.recent) == h.history {
+			h.recent = append(h.recent[:0], h.recent[1:]...)
+		}
+		h.recent = append(h.recent, entry[T]{seq: h.seq, item: item})
+	}
+	for sub := range h.subs {
+		if sub.match != nil && !sub.match(v) {
+			continue
+		}
+		select {
+		case sub.ch <- item:
+		default:
+			h.dropLocked(sub)
+		}
+	}
+	return item.ID
+}
+
+// Subscribe registers a subscriber for the values match accepts, or for
+// every value when match is nil. When lastEventID names an event still in
+// the hub's history, the matching values published after it are queued
+// first and resumed is true; otherwise the subscriber starts with the next
+// value and the caller should send the client the current state.
+func (h *Hub[T]) Subscribe(match func(T) bool, lastEventID string) (sub *Subscription[T], resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var missed []Item[T]
+	if after, ok := h.position(lastEventID); ok {
+		resumed = true
+		for _, e := range h.recent {
+			if e.seq > after && (match == nil || match(e.item.Value)) {
+				missed = append(missed, e.item)
+			}
+		}
+	}
+	sub = &Subscription[T]{hub: h, match: match, ch: make(chan Item[T], h.buffer+len(missed))}
+	for _, item := range missed {
+		sub.ch <- item
+	}
+	h.subs[sub] = struct{}{}
+	return sub, resumed
+}
+
+// Subscribers reports how many subscribers are connected.
+func (h *Hub[T]) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// position returns the sequence number of id when the hub can resume from
+// it: it was issued by this hub and nothing published since has left the
+// history.
+func (h *Hub[T]) position(id string) (uint64, bool) {
+	epoch, raw, ok := strings.Cut(id, "-")
+	if !ok || epoch != h.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || seq > h.seq {
+		return 0, false
+	}
+	oldest := h.seq + 1
+	if len(h.recent) > 0 {
+		oldest = h.recent[0].seq
+	}
+	return seq, seq+1 >= oldest
+}
+
+func (h *Hub[T]) dropLocked(sub *Subscription[T]) {
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// Subscription receives the values of a Hub that match it.
+type Subscription[T any] struct {
+	hub   *Hub[T]
+	match func(T) bool
+	ch    chan Item[T]
+}
+
+// Items returns the subscription's values. The channel is closed by Close,
+// or by the hub when the subscriber falls too far behind.
+func (s *Subscription[T]) Items() <-chan Item[T] {
+	return s.ch
+}
+
+// Close unregisters the subscriber. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.dropLocked(s)
+}
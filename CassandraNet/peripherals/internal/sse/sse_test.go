@@ -0,0 +1,162 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func values[T any](t *testing.T, sub *Subscription[T], n int) []T {
+	t.Helper()
+	out := make([]T, 0, n)
+	for range n {
+		select {
+		case item := <-sub.Items():
+			out = append(out, item.Value)
+		default:
+			t.Fatalf("expected %d queued values, got %v", n, out)
+		}
+	}
+	return out
+}
+
+func TestHubResumesFromLastEventID(t *testing.T) {
+	hub := NewHub[int](Config{History: 3})
+	even := func(v int) bool { return v%2 == 0 }
+	first := hub.Publish(1)
+	hub.Publish(2)
+	third := hub.Publish(3)
+	hub.Publish(4)
+
+	sub, resumed := hub.Subscribe(even, third)
+	defer sub.Close()
+	if got := values(t, sub, 1); !resumed || got[0] != 4 {
+		t.Fatalf("expected to resume with 4, got %v resumed=%v", got, resumed)
+	}
+	hub.Publish(5)
+	hub.Publish(6)
+	if got := values(t, sub, 1); got[0] != 6 {
+		t.Fatalf("expected 6 after resuming, got %v", got)
+	}
+
+	// The first event has left the history, and IDs from other hubs or
+	// never issued cannot be resumed from.
+	for _, id := range []string{first, "", "other-1", hub.epoch + "-99", "garbage"} {
+		sub, resumed := hub.Subscribe(nil, id)
+		if resumed || len(sub.Items()) != 0 {
+			t.Errorf("Subscribe(%q): expected a fresh subscription, got resumed=%v queued=%d", id, resumed, len(sub.Items()))
+		}
+		sub.Close()
+	}
+	latest := hub.Publish(7)
+	sub, resumed = hub.Subscribe(nil, latest)
+	if !resumed || len(sub.Items()) != 0 {
+		t.Fatalf("expected the newest ID to resume with nothing missed, got resumed=%v", resumed)
+	}
+	sub.Close()
+	sub.Close()
+	if n := hub.Subscribers(); n != 1 {
+		t.Fatalf("expected one subscriber left, got %d", n)
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub[int](Config{Buffer: 2, History: -1})
+	slow, _ := hub.Subscribe(nil, "")
+	fast, _ := hub.Subscribe(nil, "")
+	for i := range 3 {
+		hub.Publish(i)
+		if i < 2 {
+			<-fast.Items()
+		}
+	}
+	values(t, slow, 2)
+	if _, ok := <-slow.Items(); ok {
+		t.Fatal("expected the slow subscriber to be closed")
+	}
+	if got := values(t, fast, 1); got[0] != 2 {
+		t.Fatalf("expected the fast subscriber to keep receiving, got %v", got)
+	}
+	if id := hub.Publish(3); id == "" {
+		t.Fatal("expected an event ID")
+	}
+	if _, resumed := hub.Subscribe(nil, hub.epoch+"-1"); resumed {
+		t.Fatal("expected no resume without a history")
+	}
+}
+
+// flushRecorder signals each flush so the test can wait for relayed events.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed chan struct{}
+}
+
+func (r *flushRecorder) Flush() {
+	r.ResponseRecorder.Flush()
+	select {
+	case r.flushed <- struct{}{}:
+	default:
+	}
+}
+
+func TestRelayStreamsEventsAndKeepAlives(t *testing.T) {
+	hub := NewHub[string](Config{})
+	sub, _ := hub.Subscribe(nil, "")
+	defer sub.Close()
+	rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder(), flushed: make(chan struct{}, 16)}
+	req := httptest.NewRequest(http.MethodGet, "/stream?last_event_id=abc-1", nil)
+	if id := LastEventID(req); id != "abc-1" {
+		t.Fatalf("expected the query's last event ID, got %q", id)
+	}
+	req.Header.Set("Last-Event-ID", "abc-2")
+	if id := LastEventID(req); id != "abc-2" {
+		t.Fatalf("expected the header to win, got %q", id)
+	}
+	stream, ok := Open(rec, req, "test")
+	if !ok {
+		t.Fatal("expected the recorder to support streaming")
+	}
+	<-rec.flushed
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Relay(ctx, stream, sub, "greeting", 10*time.Millisecond, func(v string) any {
+			return map[string]string{"text": v}
+		})
+	}()
+	id := hub.Publish("hello")
+	<-rec.flushed
+	<-rec.flushed // at least one keep-alive
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" ||
+		!strings.Contains(body, "id: "+id+"\nevent: greeting\ndata: {\"text\":\"hello\"}\n\n") ||
+		!strings.Contains(body, ": keep-alive\n\n") {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+
+	sub.Close()
+	if err := Relay(context.Background(), stream, sub, "greeting", 0, nil); !errors.Is(err, ErrSlow) {
+		t.Fatalf("expected ErrSlow from a closed subscription, got %v", err)
+	}
+}
+
+type plainWriter struct{ http.ResponseWriter }
+
+func TestOpenRejectsWritersThatCannotFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, ok := Open(plainWriter{rec}, httptest.NewRequest(http.MethodGet, "/", nil), "test"); ok {
+		t.Fatal("expected Open to fail without a Flusher")
+	}
+	if rec.Code != http.StatusNotImplemented || !strings.Contains(rec.Body.String(), "test.streaming_unsupported") {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,124 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+)
+
+// ErrSlow is returned by Relay when the hub dropped the subscription for
+// falling too far behind.
+var ErrSlow = errors.New("sse: subscriber fell behind")
+
+// Stream writes server-sent events to one response.
+type Stream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// Open starts an event stream on w. When w cannot flush, as behind a
+// buffering wrapper, Open writes 501 with the code
+// "<service>.streaming_unsupported" and returns false.
+func Open(w http.ResponseWriter, r *http.Request, service string) (*Stream, bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		problem.Write(w, r, http.StatusNotImplemented, service+".streaming_unsupported", "streaming is not supported on this connection")
+		return nil, false
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Ask nginx-style proxies not to buffer the stream.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &Stream{w: w, flusher: flusher}, true
+}
+
+// Send writes one event with data encoded as JSON and flushes it. An empty
+// id or event leaves that field out.
+func (s *Stream) Send(id, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", payload)
+	if _, err := fmt.Fprint(s.w, b.String()); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Comment writes a comment line, which clients ignore, and flushes it.
+func (s *Stream) Comment(text string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// LastEventID returns the ID of the last event a reconnecting client saw:
+// the Last-Event-ID header browsers send, or the last_event_id query
+// parameter for clients that cannot set headers.
+func LastEventID(r *http.Request) string {
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("last_event_id")
+}
+
+// Relay sends each item of sub to stream as an event named event, with
+// the item's value passed through encode, or as is when encode is nil. It
+// writes a keep-alive comment whenever keepAlive (default
+// DefaultKeepAlive) passes without an event, so proxies keep the
+// connection open. Relay returns nil once ctx is done or the server begins
+// shutting down (see server.Draining), ErrSlow when the hub dropped sub, or
+// the error of a failed write; clients reconnect in each case. The caller
+// closes sub.
+func Relay[T any](ctx context.Context, stream *Stream, sub *Subscription[T], event string, keepAlive time.Duration, encode func(T) any) error {
+	if keepAlive <= 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	draining := server.Draining(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-draining:
+			return nil
+		case item, ok := <-sub.Items():
+			if !ok {
+				return ErrSlow
+			}
+			var data any = item.Value
+			if encode != nil {
+				data = encode(item.Value)
+			}
+			if err := stream.Send(item.ID, event, data); err != nil {
+				return err
+			}
+			ticker.Reset(keepAlive)
+		case <-ticker.C:
+			if err := stream.Comment("keep-alive"); err != nil {
+				return err
+			}
+		}
+	}
+}
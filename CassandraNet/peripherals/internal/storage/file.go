@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// fileMagic starts every file written by the file driver.
+const fileMagic = "CNSTORE1"
+
+// compactMin is how many transactions a file holds before it is worth
+// compacting.
+const compactMin = 1024
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord reports a final record cut short by a crash.
+var errTornRecord = errors.New("torn record")
+
+// File is an embedded store in a single file, for deployments without a
+// database server. Data is held in memory, as with Memory, and every
+// committed transaction is appended to the file as one checksummed record
+// and synced before Commit returns, so a crash loses at most the
+// transaction being written. Opening replays the file, dropping a torn
+// final record but failing on a damaged one before it, and the file is
+// rewritten compactly, one record per key, once it mostly holds
+// overwritten data. Only one process may open a file at a time.
+type File struct {
+	*Memory
+	path    string
+	f       *os.File
+	records int
+}
+
+// OpenFile opens or creates the store at path.
+func OpenFile(path string) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	fs := &File{Memory: NewMemory(), path: path, f: f}
+	if err := fs.load(); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if fs.records > 1 && fs.records > fs.keys() {
+		if err := fs.compact(); err != nil {
+			_ = fs.f.Close()
+			return nil, fmt.Errorf("%s: compact: %w", path, err)
+		}
+	}
+	fs.Memory.persist = fs.append
+	return fs, nil
+}
+
+// load replays the file into memory and leaves it positioned for appends.
+func (fs *File) load() error {
+	info, err := fs.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := fs.f.WriteString(fileMagic); err != nil {
+			return err
+		}
+		return fs.f.Sync()
+	}
+	r := bufio.NewReader(fs.f)
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != fileMagic {
+		return errors.New("not a storage file")
+	}
+	offset := int64(len(fileMagic))
+	for offset < info.Size() {
+		writes, n, err := readRecord(r, info.Size()-offset)
+		if errors.Is(err, errTornRecord) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+		fs.Memory.apply(writes)
+		fs.records++
+		offset += n
+	}
+	// Anything after the last whole record is a write cut short by a crash.
+	if offset < info.Size() {
+		if err := fs.f.Truncate(offset); err != nil {
+			return err
+		}
+	}
+	_, err = fs.f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// readRecord reads the record at the start of the remaining bytes of the
+// file. It returns errTornRecord for one that does not fit in them, or
+// whose checksum fails when it ends the file, as a crash mid-write leaves.
+func readRecord(r io.Reader, remaining int64) ([]write, int64, error) {
+	var header [8]byte
+	if remaining < int64(len(header)) {
+		return nil, 0, errTornRecord
+	}
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	n := int64(len(header)) + size
+	if n > remaining {
+		return nil, 0, errTornRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+		if n == remaining {
+			return nil, 0, errTornRecord
+		}
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	var writes []write
+	if err := json.Unmarshal(payload, &writes); err != nil {
+		return nil, 0, err
+	}
+	return writes, n, nil
+}
+
+func encodeRecord(writes []write) ([]byte, error) {
+	payload, err := json.Marshal(writes)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > math.MaxUint32 {
+		return nil, fmt.Errorf("record of %d bytes is too large", len(payload))
+	}
+	record := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+	return append(record, payload...), nil
+}
+
+// append durably records one transaction. It runs with the write lock held.
+func (fs *File) append(writes []write) error {
+	record, err := encodeRecord(writes)
+	if err != nil {
+		return err
+	}
+	if _, err := fs.f.Write(record); err != nil {
+		return err
+	}
+	if err := fs.f.Sync(); err != nil {
+		return err
+	}
+	fs.records++
+	if fs.records >= compactMin && fs.records > 2*fs.keys() {
+		// The transaction is already durable; a failed compaction only
+		// leaves the file larger than it needs to be.
+		_ = fs.compactWith(writes)
+	}
+	return nil
+}
+
+func (fs *File) keys() int {
+	n := 0
+	for _, bucket := range fs.Memory.buckets {
+		n += len(bucket)
+	}
+	return n
+}
+
+func (fs *File) compact() error {
+	return fs.compactWith(nil)
+}
+
+// compactWith rewrites the file as one record per key of the current data,
+// followed by pending, the transaction not yet applied to memory, as it
+// was recorded. A record's length is 32 bits, so data of any size fits.
+func (fs *File) compactWith(pending []write) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	records := 0
+	put := func(writes []write) error {
+		record, err := encodeRecord(writes)
+		if err != nil {
+			return err
+		}
+		records++
+		_, err = w.Write(record)
+		return err
+	}
+	err = func() error {
+		if _, err := w.WriteString(fileMagic); err != nil {
+			return err
+		}
+		for name, bucket := range fs.Memory.buckets {
+			for key, value := range bucket {
+				if err := put([]write{{Bucket: name, Key: key, Value: value}}); err != nil {
+					return err
+				}
+			}
+		}
+		if len(pending) > 0 {
+			if err := put(pending); err != nil {
+				return err
+			}
+		}
+		return w.Flush()
+	}()
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fs.path); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(fs.path)); err == nil {
+		_ = dir.Sync()
+		_ = dir.Close()
+	}
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	_ = fs.f.Close()
+	fs.f = tmp
+	fs.records = records
+	return nil
+}
+
+// Close implements Driver. It waits for open transactions to finish.
+func (fs *File) Close() error {
+	fs.Memory.mu.Lock()
+	defer fs.Memory.mu.Unlock()
+	if fs.Memory.closed {
+		return nil
+	}
+	fs.Memory.closed = true
+	return fs.f.Close()
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory keeps buckets in process memory. Writable transactions run one at
+// a time and read-only ones alongside each other, so transactions never
+// conflict; a goroutine holding a transaction must not begin another.
+type Memory struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+	closed  bool
+	// persist, when set, durably records a transaction's writes before
+	// they are applied; it runs with mu held for writing.
+	persist func(writes []write) error
+}
+
+// NewMemory returns an empty memory driver.
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]map[string][]byte)}
+}
+
+// write is one Put or Delete.
+type write struct {
+	Bucket string `json:"b"`
+	Key    string `json:"k"`
+	Value  []byte `json:"v,omitempty"`
+	Delete bool   `json:"d,omitempty"`
+}
+
+// Begin implements Driver.
+func (m *Memory) Begin(_ context.Context, writable bool) (Tx, error) {
+	if writable {
+		m.mu.Lock()
+	} else {
+		m.mu.RLock()
+	}
+	if m.closed {
+		m.unlock(writable)
+		return nil, ErrClosed
+	}
+	return &memoryTx{db: m, writable: writable}, nil
+}
+
+func (m *Memory) unlock(writable bool) {
+	if writable {
+		m.mu.Unlock()
+	} else {
+		m.mu.RUnlock()
+	}
+}
+
+// Check implements Driver.
+func (m *Memory) Check(context.Context) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Close implements Driver. It waits for open transactions to finish.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+func (m *Memory) apply(writes []write) {
+	for _, w := range writes {
+		bucket := m.buckets[w.Bucket]
+		if w.Delete {
+			delete(bucket, w.Key)
+			if len(bucket) == 0 {
+				delete(m.buckets, w.Bucket)
+			}
+			continue
+		}
+		if bucket == nil {
+			bucket = make(map[string][]byte)
+			m.buckets[w.Bucket] = bucket
+		}
+		bucket[w.Key] = w.Value
+	}
+}
+
+// memoryTx holds the driver's lock for its lifetime and buffers writes
+// until Commit.
+type memoryTx struct {
+	db       *Memory
+	writable bool
+	done     bool
+	writes   []write
+	// pending maps bucket and key to the latest buffered write's index.
+	pending map[string]map[string]int
+}
+
+func (tx *memoryTx) Get(bucket, key string) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	value, ok := tx.lookup(bucket, key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// lookup returns the stored value without copying it.
+func (tx *memoryTx) lookup(bucket, key string) ([]byte, bool) {
+	if i, ok := tx.pending[bucket][key]; ok {
+		return tx.writes[i].Value, !tx.writes[i].Delete
+	}
+	value, ok := tx.db.buckets[bucket][key]
+	return value, ok
+}
+
+func (tx *memoryTx) Put(bucket, key string, value []byte) error {
+	return tx.buffer(write{Bucket: bucket, Key: key, Value: append([]byte{}, value...)})
+}
+
+func (tx *memoryTx) Delete(bucket, key string) error {
+	return tx.buffer(write{Bucket: bucket, Key: key, Delete: true})
+}
+
+func (tx *memoryTx) buffer(w write) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if !tx.writable {
+		return ErrReadOnly
+	}
+	if tx.pending == nil {
+		tx.pending = make(map[string]map[string]int)
+	}
+	if tx.pending[w.Bucket] == nil {
+		tx.pending[w.Bucket] = make(map[string]int)
+	}
+	tx.pending[w.Bucket][w.Key] = len(tx.writes)
+	tx.writes = append(tx.writes, w)
+	return nil
+}
+
+func (tx *memoryTx) Scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	return tx.scanFrom(bucket, prefix, "", fn)
+}
+
+// scanFrom implements ScanFrom, sorting only the keys from from onwards.
+func (tx *memoryTx) scanFrom(bucket, prefix, from string, fn func(key string, value []byte) error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	var keys []string
+	for key := range tx.db.buckets[bucket] {
+		if _, ok := tx.pending[bucket][key]; !ok && key >= from && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key, i := range tx.pending[bucket] {
+		if !tx.writes[i].Delete && key >= from && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := tx.lookup(bucket, key)
+		if err := fn(key, value); err != nil {
+			if errors.Is(err, StopScan) {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *memoryTx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	defer tx.finish()
+	if len(tx.writes) == 0 {
+		return nil
+	}
+	if tx.db.persist != nil {
+		if err := tx.db.persist(tx.writes); err != nil {
+			return err
+		}
+	}
+	tx.db.apply(tx.writes)
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	if !tx.done {
+		tx.finish()
+	}
+	return nil
+}
+
+func (tx *memoryTx) finish() {
+	tx.done = true
+	tx.writes, tx.pending = nil, nil
+	tx.db.unlock(tx.writable)
+}
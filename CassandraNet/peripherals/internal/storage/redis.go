@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/redisclient"
+)
+
+// redisKeyPrefix namespaces the driver's keys in a shared Redis.
+const redisKeyPrefix = "cassandra:storage:"
+
+// redisLayout marks a Redis whose buckets are in the layout below, so
+// hashes left by releases that kept each bucket in one are converted once.
+const (
+	redisLayoutKey = redisKeyPrefix + "layout"
+	redisLayout    = "2"
+)
+
+// redisScanBatch is how many keys Scan reads per round trip.
+const redisScanBatch = 256
+
+// Redis keeps each record of a bucket in a string key of its own and the
+// bucket's keys in a sorted set whose members all score zero, so scans
+// walk keys in byte order with ZRANGEBYLEX and read only as far as their
+// callback goes. Writable transactions use optimistic locking: each key
+// is watched before it is first read, a scan also watches the bucket's
+// key set, writes are buffered, and Commit applies them in one MULTI/EXEC
+// that fails with ErrConflict if a watched key changed meanwhile. Blind
+// writes watch nothing, so transactions touching different keys do not
+// conflict. Read-only transactions read the latest committed values
+// without a snapshot. Redis 5 or later is required.
+type Redis struct {
+	client *redisclient.Client
+
+	mu       sync.Mutex
+	upgraded bool
+}
+
+// NewRedis parses a redis:// or rediss:// URL of the form
+// redis://[user:password@]host[:port][/db]. No connection is made until the
+// first transaction.
+func NewRedis(rawURL string) (*Redis, error) {
+	client, err := redisclient.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func redisDataKey(bucket, key string) string {
+	return redisKeyPrefix + "data:" + bucket + ":" + key
+}
+
+func redisIndexKey(bucket string) string {
+	return redisKeyPrefix + "keys:" + bucket
+}
+
+// Begin implements Driver.
+func (r *Redis) Begin(ctx context.Context, writable bool) (Tx, error) {
+	if err := r.upgrade(ctx); err != nil {
+		return nil, err
+	}
+	tx := &redisTx{ctx: ctx, client: r.client, writable: writable}
+	if writable {
+		conn, err := r.client.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx.conn = conn
+		tx.watched = make(map[string]bool)
+	}
+	return tx, nil
+}
+
+// upgrade converts the bucket hashes of earlier releases to the current
+// layout before the first transaction. Values already written in the
+// current layout win, so a replica converting alongside another does not
+// undo its writes.
+func (r *Redis) upgrade(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.upgraded {
+		return nil
+	}
+	layout, err := r.client.Do(ctx, "GET", redisLayoutKey)
+	if err != nil {
+		return err
+	}
+	if layout != redisLayout {
+		cursor := "0"
+		for {
+			reply, err := r.client.Do(ctx, "SCAN", cursor, "MATCH", redisKeyPrefix+"*", "COUNT", "100")
+			if err != nil {
+				return err
+			}
+			page, ok := reply.([]any)
+			if !ok || len(page) != 2 {
+				return fmt.Errorf("redis: unexpected SCAN reply %v", reply)
+			}
+			cursor, _ = page[0].(string)
+			keys, _ := page[1].([]any)
+			for _, k := range keys {
+				name, _ := k.(string)
+				if err := r.convertHash(ctx, name); err != nil {
+					return err
+				}
+			}
+			if cursor == "0" {
+				break
+			}
+		}
+		if _, err := r.client.Do(ctx, "SET", redisLayoutKey, redisLayout); err != nil {
+			return err
+		}
+	}
+	r.upgraded = true
+	return nil
+}
+
+// convertHash moves the fields of the bucket hash name, if it is one, to
+// keys of their own and deletes it.
+func (r *Redis) convertHash(ctx context.Context, name string) error {
+	kind, err := r.client.Do(ctx, "TYPE", name)
+	if err != nil || kind != "hash" {
+		return err
+	}
+	bucket := strings.TrimPrefix(name, redisKeyPrefix)
+	reply, err := r.client.Do(ctx, "HGETALL", name)
+	if err != nil {
+		return err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items)%2 != 0 {
+		return fmt.Errorf("redis: unexpected HGETALL reply %v", reply)
+	}
+	for i := 0; i < len(items); i += 2 {
+		key, _ := items[i].(string)
+		value, _ := items[i+1].(string)
+		if _, err := r.client.Do(ctx, "SETNX", redisDataKey(bucket, key), value); err != nil {
+			return err
+		}
+		if _, err := r.client.Do(ctx, "ZADD", redisIndexKey(bucket), "0", key); err != nil {
+			return err
+		}
+	}
+	_, err = r.client.Do(ctx, "DEL", name)
+	return err
+}
+
+// Check implements Driver.
+func (r *Redis) Check(ctx context.Context) error {
+	return r.client.Check(ctx)
+}
+
+// Close implements Driver.
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
+
+// nextSequence implements NextSequence with INCR, which never conflicts.
+func (r *Redis) nextSequence(ctx context.Context, name string) (uint64, error) {
+	if err := r.upgrade(ctx); err != nil {
+		return 0, err
+	}
+	conn, err := r.client.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	for _, args := range [][]string{
+		{"MULTI"},
+		{"INCR", redisDataKey(sequenceBucket, name)},
+		{"ZADD", redisIndexKey(sequenceBucket), "0", name},
+	} {
+		if _, err := conn.Do(ctx, args...); err != nil {
+			_, _ = conn.Do(ctx, "DISCARD")
+			return 0, err
+		}
+	}
+	reply, err := conn.Do(ctx, "EXEC")
+	if err != nil {
+		return 0, err
+	}
+	results, ok := reply.([]any)
+	if !ok || len(results) != 2 {
+		return 0, fmt.Errorf("redis: unexpected EXEC reply %v", reply)
+	}
+	value, ok := results[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: INCR %s: %v", name, results[0])
+	}
+	return uint64(value), nil
+}
+
+type redisTx struct {
+	ctx      context.Context
+	client   *redisclient.Client
+	writable bool
+	done     bool
+	// conn, watched, and the write buffer belong to writable transactions.
+	conn    *redisclient.Conn
+	watched map[string]bool
+	writes  []write
+	pending map[string]map[string]int
+}
+
+// do runs a command on the transaction's connection, or on any pooled
+// connection for a read-only transaction.
+func (tx *redisTx) do(args ...string) (any, error) {
+	if tx.conn != nil {
+		return tx.conn.Do(tx.ctx, args...)
+	}
+	return tx.client.Do(tx.ctx, args...)
+}
+
+// watch watches the keys not yet watched before they are read, so Commit
+// notices concurrent changes to anything the transaction looked at.
+func (tx *redisTx) watch(keys ...string) error {
+	if !tx.writable {
+		return nil
+	}
+	args := []string{"WATCH"}
+	for _, key := range keys {
+		if !tx.watched[key] {
+			args = append(args, key)
+		}
+	}
+	if len(args) == 1 {
+		return nil
+	}
+	if _, err := tx.do(args...); err != nil {
+		return err
+	}
+	for _, key := range args[1:] {
+		tx.watched[key] = true
+	}
+	return nil
+}
+
+func (tx *redisTx) Get(bucket, key string) ([]byte, error) {
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if i, ok := tx.pending[bucket][key]; ok {
+		if tx.writes[i].Delete {
+			return nil, ErrNotFound
+		}
+		return append([]byte(nil), tx.writes[i].Value...), nil
+	}
+	dataKey := redisDataKey(bucket, key)
+	if err := tx.watch(dataKey); err != nil {
+		return nil, err
+	}
+	reply, err := tx.do("GET", dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrNotFound
+	}
+	value, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return []byte(value), nil
+}
+
+func (tx *redisTx) Put(bucket, key string, value []byte) error {
+	return tx.buffer(write{Bucket: bucket, Key: key, Value: append([]byte{}, value...)})
+}
+
+func (tx *redisTx) Delete(bucket, key string) error {
+	return tx.buffer(write{Bucket: bucket, Key: key, Delete: true})
+}
+
+func (tx *redisTx) buffer(w write) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if !tx.writable {
+		return ErrReadOnly
+	}
+	if tx.pending == nil {
+		tx.pending = make(map[string]map[string]int)
+	}
+	if tx.pending[w.Bucket] == nil {
+		tx.pending[w.Bucket] = make(map[string]int)
+	}
+	tx.pending[w.Bucket][w.Key] = len(tx.writes)
+	tx.writes = append(tx.writes, w)
+	return nil
+}
+
+// Scan reads keys in batches of redisScanBatch from the first one at or
+// after prefix and ends at the first key without it. Keys the
+// transaction has written are merged in order.
+func (tx *redisTx) Scan(bucket, prefix string, fn func(key string, value []byte) error) error {
+	return tx.scanFrom(bucket, prefix, "", fn)
+}
+
+// scanFrom implements ScanFrom by starting the first batch at from.
+func (tx *redisTx) scanFrom(bucket, prefix, from string, fn func(key string, value []byte) error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	from = max(prefix, from)
+	err := tx.scan(bucket, prefix, from, fn)
+	if errors.Is(err, StopScan) {
+		return nil
+	}
+	return err
+}
+
+func (tx *redisTx) scan(bucket, prefix, from string, fn func(key string, value []byte) error) error {
+	if err := tx.watch(redisIndexKey(bucket)); err != nil {
+		return err
+	}
+	var pending []string
+	for key := range tx.pending[bucket] {
+		if key >= from && strings.HasPrefix(key, prefix) {
+			pending = append(pending, key)
+		}
+	}
+	slices.Sort(pending)
+	start, done := "["+from, false
+	for !done {
+		keys, values, err := tx.batch(bucket, start)
+		if err != nil {
+			return err
+		}
+		done = len(keys) < redisScanBatch
+		for i, key := range keys {
+			if !strings.HasPrefix(key, prefix) {
+				keys, values, done = keys[:i], values[:i], true
+				break
+			}
+		}
+		if len(keys) > 0 {
+			start = "(" + keys[len(keys)-1]
+		}
+		for i, key := range keys {
+			// Buffered writes to keys before this one come first.
+			for len(pending) > 0 && pending[0] <= key {
+				if err := tx.visitPending(bucket, pending[0], fn); err != nil {
+					return err
+				}
+				if pending[0] == key {
+					values[i] = nil
+				}
+				pending = pending[1:]
+			}
+			if values[i] == nil {
+				continue
+			}
+			if err := fn(key, values[i]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range pending {
+		if err := tx.visitPending(bucket, key, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visitPending calls fn for the buffered write to key unless it deletes
+// it.
+func (tx *redisTx) visitPending(bucket, key string, fn func(key string, value []byte) error) error {
+	w := tx.writes[tx.pending[bucket][key]]
+	if w.Delete {
+		return nil
+	}
+	return fn(key, w.Value)
+}
+
+// batch returns up to redisScanBatch keys of bucket from start, a
+// ZRANGEBYLEX bound, with their values; a key whose value is gone has a
+// nil one.
+func (tx *redisTx) batch(bucket, start string) ([]string, [][]byte, error) {
+	reply, err := tx.do("ZRANGEBYLEX", redisIndexKey(bucket), start, "+", "LIMIT", "0", strconv.Itoa(redisScanBatch))
+	if err != nil {
+		return nil, nil, err
+	}
+	members, ok := reply.([]any)
+	if !ok {
+		return nil, nil, fmt.Errorf("redis: unexpected ZRANGEBYLEX reply %v", reply)
+	}
+	if len(members) == 0 {
+		return nil, nil, nil
+	}
+	keys := make([]string, len(members))
+	args := make([]string, 0, len(members)+1)
+	args = append(args, "MGET")
+	for i, member := range members {
+		keys[i], _ = member.(string)
+		args = append(args, redisDataKey(bucket, keys[i]))
+	}
+	if err := tx.watch(args[1:]...); err != nil {
+		return nil, nil, err
+	}
+	reply, err = tx.do(args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != len(keys) {
+		return nil, nil, fmt.Errorf("redis: unexpected MGET reply %v", reply)
+	}
+	values := make([][]byte, len(keys))
+	for i, item := range items {
+		if value, ok := item.(string); ok {
+			values[i] = []byte(value)
+		}
+	}
+	return keys, values, nil
+}
+
+func (tx *redisTx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if len(tx.writes) == 0 {
+		return tx.Rollback()
+	}
+	defer tx.finish()
+	if _, err := tx.do("MULTI"); err != nil {
+		return err
+	}
+	for _, w := range tx.writes {
+		commands := [][]string{
+			{"SET", redisDataKey(w.Bucket, w.Key), string(w.Value)},
+			{"ZADD", redisIndexKey(w.Bucket), "0", w.Key},
+		}
+		if w.Delete {
+			commands = [][]string{
+				{"DEL", redisDataKey(w.Bucket, w.Key)},
+				{"ZREM", redisIndexKey(w.Bucket), w.Key},
+			}
+		}
+		for _, args := range commands {
+			if _, err := tx.do(args...); err != nil {
+				_, _ = tx.do("DISCARD")
+				return err
+			}
+		}
+	}
+	reply, err := tx.do("EXEC")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return ErrConflict
+	}
+	if results, ok := reply.([]any); ok {
+		for _, result := range results {
+			if rerr, ok := result.(redisclient.Error); ok {
+				return rerr
+			}
+		}
+	}
+	return nil
+}
+
+func (tx *redisTx) Rollback() error {
+	if tx.done {
+		return nil
+	}
+	if tx.conn != nil && len(tx.watched) > 0 {
+		_, _ = tx.do("UNWATCH")
+	}
+	tx.finish()
+	return nil
+}
+
+func (tx *redisTx) finish() {
+	tx.done = true
+	tx.writes, tx.pending = nil, nil
+	if tx.conn != nil {
+		tx.conn.Close()
+		tx.conn = nil
+	}
+}
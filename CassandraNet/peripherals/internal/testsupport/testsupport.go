@@ -0,0 +1,582 @@
+// Package testsupport runs every peripheral service in the test's process
+// for cross-service tests. Start wires the services the way
+// cmd/cassandra-all does — in-memory storage, one event bus, the gateway's
+// routes — and serves them on an ephemeral port, so a test can drive a
+// whole flow through the public API and check what came out the other end:
+//
+//	c := testsupport.Start(t, testsupport.Config{BannedTerms: []string{"spam"}})
+//	api := c.Client(t)
+//	api.UGC.SubmitContent(ctx, client.SubmitRequest{...})
+//	c.EnqueueModeration(t, ugcworker.Job{ContentID: "c-1", AuthorID: "u-1", Body: "buy spam"})
+//	result := c.NextModerationResult(t)
+//	api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateRejected, Reason: result.Reason})
+//	c.WaitForDeliveries(t, notification.ChannelInApp, 1)
+//
+// Everything is stopped when the test ends.
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/apiversion"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/dashboard"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/featureflags"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/gateway"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/idempotency"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logpipeline"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/messaging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metricscollector"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notification"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/orchestration"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/presence"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/scheduler"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/server"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugc"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugcworker"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/webhooks"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+// Config tunes a cluster. The zero value runs without authentication, with
+// the all-in-one binary's defaults.
+type Config struct {
+	// APIKeys are accepted as in AUTH_API_KEYS ("key", "tenant:key", or
+	// "tenant/project:key"); empty leaves authentication off.
+	APIKeys []string
+	// Policy, when set, enforces role bindings as AUTH_POLICY_FILE does.
+	Policy *auth.Policy
+	// ClientAPIKey is sent on calls between services, such as alert
+	// notifications, and by the cluster's own helpers. It must be one of
+	// APIKeys when those are set.
+	ClientAPIKey string
+	// BannedTerms are flagged by the moderation workers (default "spam"
+	// and "scam").
+	BannedTerms []string
+	// EventRecipient receives a notification for every content review and
+	// finished assignment (default "moderators"), over EventChannel
+	// (default in-app).
+	EventRecipient string
+	EventChannel   notification.Channel
+	// AlertRecipient receives metric alerts (default "ops") over the
+	// webhook channel; alert rules are evaluated every AlertInterval
+	// (default 50ms).
+	AlertRecipient string
+	AlertInterval  time.Duration
+	// SchedulerInterval is how often due jobs are checked for (default
+	// 50ms).
+	SchedulerInterval time.Duration
+	// WebhookInterval is how often due webhook deliveries are checked
+	// for, and the backoff after a failed attempt (default 50ms).
+	WebhookInterval time.Duration
+	// Quotas are reported at /usage/quotas, as METERING_QUOTAS sets them.
+	Quotas []metering.Quota
+	// AssignmentQuotas limit each tenant's running and queued assignments,
+	// as ORCHESTRATION_QUOTAS sets them.
+	AssignmentQuotas []orchestration.Quota
+	// RetentionMaxAges override the policies' default maximum ages, as
+	// RETENTION_MAX_AGES sets them.
+	RetentionMaxAges map[string]time.Duration
+	// StrictTopics refuses publishes to topics not created at /topics, as
+	// MESSAGING_STRICT_TOPICS does.
+	StrictTopics bool
+	// StreamKeepAlive is how often idle message streams send a keep-alive
+	// comment, as MESSAGING_STREAM_KEEPALIVE sets it.
+	StreamKeepAlive time.Duration
+	// Region names the cluster's region; empty disables replication.
+	// Messaging and UGC changes are sent to the cluster at ReplicationPeer,
+	// such as another cluster's URL, every ReplicationInterval (default
+	// 50ms).
+	Region              string
+	ReplicationPeer     string
+	ReplicationInterval time.Duration
+	// Triggers create assignments from messages, as TRIGGERS_FILE does,
+	// pulling their topics through the gateway every 50ms.
+	Triggers []orchestration.Trigger
+	// Keyring, when set, seals message payloads, notification recipients,
+	// and UGC attributes at rest, as ENCRYPTION_KEY_FILE does.
+	Keyring *encryption.Keyring
+	// WaitTimeout bounds the cluster's waiting helpers (default 5s).
+	WaitTimeout time.Duration
+}
+
+func (c *Config) setDefaults() {
+	if c.BannedTerms == nil {
+		c.BannedTerms = []string{"spam", "scam"}
+	}
+	if c.EventRecipient == "" {
+		c.EventRecipient = "moderators"
+	}
+	if c.EventChannel == "" {
+		c.EventChannel = notification.ChannelInApp
+	}
+	if c.AlertRecipient == "" {
+		c.AlertRecipient = "ops"
+	}
+	if c.AlertInterval <= 0 {
+		c.AlertInterval = 50 * time.Millisecond
+	}
+	if c.SchedulerInterval <= 0 {
+		c.SchedulerInterval = 50 * time.Millisecond
+	}
+	if c.WebhookInterval <= 0 {
+		c.WebhookInterval = 50 * time.Millisecond
+	}
+	if c.ReplicationInterval <= 0 {
+		c.ReplicationInterval = 50 * time.Millisecond
+	}
+	if c.WaitTimeout <= 0 {
+		c.WaitTimeout = 5 * time.Second
+	}
+}
+
+// Cluster is a running set of services. The exported fields give tests
+// direct access to each service's internals; requests should normally go
+// through URL, as a deployed caller's would.
+type Cluster struct {
+	// URL is the gateway's base address, with cmd/gateway's path prefixes.
+	URL string
+
+	DB            storage.Driver
+	Bus           *eventbus.Bus
+	Messaging     *messaging.Service
+	UGC           *ugc.Service
+	Orchestration *orchestration.Service
+	Flags         *featureflags.Service
+	Workers       *ugcworker.WorkerPool
+	Notifications *notification.Service
+	Logs          *logpipeline.Pipeline
+	Metrics       *metricscollector.Aggregator
+	Alerts        *metricscollector.AlertManager
+	Scheduler     *scheduler.Service
+	Presence      *presence.Service
+	Webhooks      *webhooks.Service
+	Meter         *metering.Meter
+	Retention     *retention.Manager
+	Replication   *replication.Replicator
+	Audit         *audit.Log
+	Admin         *adminchannel.Channel
+
+	cfg     Config
+	senders map[notification.Channel]*notification.MemorySender
+}
+
+// Start runs a cluster for the duration of t.
+func Start(t testing.TB, cfg Config) *Cluster {
+	t.Helper()
+	cfg.setDefaults()
+	out := &testWriter{t: t}
+	logger := logging.NewWithOptions("testsupport", logging.Options{Output: out})
+
+	// The listener exists before the services so the alert manager can
+	// reach the notification service through it, as it would when
+	// deployed.
+	srv := httptest.NewUnstartedServer(nil)
+	c := &Cluster{
+		URL:     "http://" + srv.Listener.Addr().String(),
+		DB:      storage.NewMemory(),
+		Bus:     eventbus.New(0, logger),
+		cfg:     cfg,
+		senders: make(map[notification.Channel]*notification.MemorySender),
+	}
+	c.Bus.Start()
+
+	// Usage is flushed by the tests that read it, through FlushUsage.
+	c.Meter = metering.New(c.DB, metering.Config{Quotas: cfg.Quotas}, logger)
+	// Policies run only when a test asks, through the API or c.Retention.
+	c.Retention = retention.New(retention.Config{MaxAges: cfg.RetentionMaxAges}, logger)
+	c.Replication = replication.New(c.DB, "testsupport", replication.Config{
+		Region:     cfg.Region,
+		PeerURL:    cfg.ReplicationPeer,
+		Interval:   cfg.ReplicationInterval,
+		MaxBackoff: cfg.ReplicationInterval,
+	}, auth.Transport(cfg.ClientAPIKey, nil), logger)
+	c.Replication.SetKeyring(cfg.Keyring)
+
+	// Tests expire and release messages themselves, through
+	// c.Messaging.Expire and c.Messaging.Release.
+	messagingStore := messaging.NewStorageStore(c.DB)
+	messagingStore.SetKeyring(cfg.Keyring)
+	c.Messaging = messaging.NewService(messagingStore, nil)
+	c.Messaging.SetRouteStore(messagingStore)
+	c.Messaging.SetGroupStore(messagingStore)
+	c.Messaging.SetTopicKeyStore(messagingStore)
+	c.Messaging.SetSubscriptionStore(messagingStore)
+	c.Messaging.SetLeaseStore(messagingStore)
+	c.Messaging.SetDeadLetterStore(messagingStore)
+	c.Messaging.SetTopicStore(messagingStore)
+	c.Messaging.SetStrictTopics(cfg.StrictTopics)
+	c.Messaging.SetStreamKeepAlive(cfg.StreamKeepAlive)
+	c.Messaging.SetMeter(c.Meter)
+	c.Messaging.RegisterRetention(c.Retention)
+	c.Messaging.SetReplicator(c.Replication)
+	c.Messaging.SetAudit(audit.New(c.DB, "messaging-service", logger))
+
+	ugcStore := ugc.NewStorageStore(c.DB)
+	ugcStore.SetKeyring(cfg.Keyring)
+	c.UGC = ugc.NewService(ugcStore, nil)
+	c.UGC.SetEvents(c.Bus)
+	ugcAudit := audit.New(c.DB, "ugc-service", logger)
+	ugcAudit.SetKeyring(cfg.Keyring)
+	c.UGC.SetAudit(ugcAudit)
+	c.UGC.SetMeter(c.Meter)
+	c.UGC.RegisterRetention(c.Retention)
+	c.UGC.SetReplicator(c.Replication)
+	c.UGC.SetMedia(ugcStore, ugc.MediaConfig{SweepInterval: 50 * time.Millisecond}, logger)
+	mediaCtx, stopMedia := context.WithCancel(context.Background())
+	mediaDone := make(chan struct{})
+	go func() {
+		defer close(mediaDone)
+		_ = c.UGC.RunMedia(mediaCtx)
+	}()
+
+	// One admin channel carries every service's topics, as in
+	// cmd/cassandra-all.
+	c.Admin = adminchannel.New(adminchannel.Config{}, logger)
+
+	orchestrationStore := orchestration.NewStorageStore(c.DB)
+	c.Orchestration = orchestration.NewService(orchestrationStore, nil)
+	c.Orchestration.SetTemplateStore(orchestrationStore)
+	c.Orchestration.SetEvents(c.Bus)
+	c.Orchestration.SetAudit(audit.New(c.DB, "orchestrator", logger))
+	c.Orchestration.SetAdminChannel(c.Admin)
+	c.Orchestration.SetQuotas(cfg.AssignmentQuotas)
+	c.Flags = featureflags.NewService(featureflags.NewStorageStore(c.DB), nil)
+	c.Flags.SetAudit(audit.New(c.DB, "feature-flags", logger))
+
+	c.Workers = ugcworker.NewWorkerPool(2, 64, ugcworker.NewModerationPolicy(cfg.BannedTerms), logger)
+	c.Workers.Start()
+	workerService := ugcworker.NewService(c.Workers, logger)
+	workerService.SetAdminChannel(c.Admin)
+
+	senders := make(map[notification.Channel]notification.Sender)
+	for _, channel := range []notification.Channel{notification.ChannelEmail, notification.ChannelWebhook, notification.ChannelInApp} {
+		c.senders[channel] = notification.NewMemorySender()
+		senders[channel] = c.senders[channel]
+	}
+	history := notification.NewStorageHistory(c.DB, 200)
+	history.SetKeyring(cfg.Keyring)
+	c.Notifications = notification.NewService(notification.NewTemplateStore(), senders, history, logger)
+	c.Notifications.SetEvents(c.Bus)
+	c.Notifications.SetAudit(audit.New(c.DB, "notification", logger))
+	c.Notifications.SetMeter(c.Meter)
+	c.Notifications.RegisterRetention(c.Retention)
+	engagement := notification.NewStorageEngagement(c.DB)
+	engagement.RegisterRetention(c.Retention)
+	c.Notifications.SetEngagement(engagement, c.URL)
+	c.Notifications.SetSuppressions(notification.NewStorageSuppressions(c.DB))
+	c.Notifications.Subscribe(c.Bus, cfg.EventChannel, cfg.EventRecipient)
+
+	c.Logs = logpipeline.NewPipeline(256, logpipeline.LevelDebug, logger)
+	ring := logpipeline.NewRingBufferSink(200)
+	c.Logs.RegisterSink(ring)
+	tail := logpipeline.NewTailSink()
+	c.Logs.RegisterSink(tail)
+	c.Logs.Start()
+	logsService := logpipeline.NewService(c.Logs, ring, logger)
+	logsService.SetTail(tail)
+	logsService.SetMeter(c.Meter)
+
+	c.Metrics = metricscollector.NewAggregator()
+	c.Metrics.Start()
+	c.Metrics.RegisterRetention(c.Retention)
+	metricsService := metricscollector.NewService(c.Metrics, logger)
+	// Clients of other services call them through the gateway.
+	transport := auth.Transport(cfg.ClientAPIKey, nil)
+	notifier, err := metricscollector.NewNotificationClient(c.URL, string(notification.ChannelWebhook), cfg.AlertRecipient, transport)
+	if err != nil {
+		t.Fatalf("testsupport: alert notifier: %v", err)
+	}
+	c.Alerts = metricscollector.NewAlertManager(c.Metrics, notifier, cfg.AlertInterval, logger)
+	c.Alerts.SetAudit(audit.New(c.DB, "metrics-collector", logger))
+	c.Alerts.SetAdminChannel(c.Admin)
+	c.Alerts.Start()
+
+	// Scheduled jobs publish and notify through the gateway too.
+	scheduledNotifier, err := scheduler.NewNotificationClient(c.URL, transport)
+	if err != nil {
+		t.Fatalf("testsupport: scheduler notifier: %v", err)
+	}
+	c.Scheduler = scheduler.NewService(scheduler.NewStorageStore(c.DB),
+		scheduler.NewActions(nil, scheduler.NewMessagingClient(c.URL+"/messaging", transport), scheduledNotifier, nil),
+		scheduler.Config{PollInterval: cfg.SchedulerInterval}, nil, logger)
+	c.Scheduler.SetAudit(audit.New(c.DB, "scheduler", logger))
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	schedulerDone := make(chan struct{})
+	go func() {
+		defer close(schedulerDone)
+		_ = c.Scheduler.Run(schedulerCtx)
+	}()
+
+	// Triggers pull through the gateway as the scheduler publishes.
+	triggers, err := orchestration.NewTriggers(c.Orchestration, orchestration.NewMessagingClient(c.URL+"/messaging", transport),
+		cfg.Triggers, orchestration.TriggerConfig{PollInterval: 50 * time.Millisecond}, logger)
+	if err != nil {
+		t.Fatalf("triggers: %v", err)
+	}
+	triggersCtx, stopTriggers := context.WithCancel(context.Background())
+	triggersDone := make(chan struct{})
+	go func() {
+		defer close(triggersDone)
+		_ = triggers.Run(triggersCtx)
+	}()
+
+	// Tests sweep lapsed presence themselves, through c.Presence.Sweep.
+	c.Presence = presence.NewService(presence.NewStorageStore(c.DB), presence.Config{}, nil, logger)
+	c.Presence.SetEvents(c.Bus)
+
+	hookStore := webhooks.NewStorageStore(c.DB)
+	hookStore.SetKeyring(cfg.Keyring)
+	c.Webhooks = webhooks.NewService(hookStore, nil, webhooks.Config{
+		Events: []string{eventbus.NameContentReviewed, eventbus.NameAssignmentCompleted,
+			eventbus.NameDeliveryFailed, eventbus.NamePresenceChanged, messaging.EventMessagePublished},
+		PollInterval: cfg.WebhookInterval,
+		MinBackoff:   cfg.WebhookInterval,
+	}, nil, logger)
+	c.Webhooks.SetAudit(audit.New(c.DB, "webhooks", logger))
+	c.Webhooks.Subscribe(c.Bus)
+	c.Messaging.SetWebhooks(c.Webhooks.EmitEvent)
+	webhooksCtx, stopWebhooks := context.WithCancel(context.Background())
+	webhooksDone := make(chan struct{})
+	go func() {
+		defer close(webhooksDone)
+		_ = c.Webhooks.Run(webhooksCtx)
+	}()
+	replicationCtx, stopReplication := context.WithCancel(context.Background())
+	replicationDone := make(chan struct{})
+	go func() {
+		defer close(replicationDone)
+		_ = c.Replication.Run(replicationCtx)
+	}()
+
+	c.Audit = audit.New(c.DB, "testsupport", logger)
+	c.Audit.SetKeyring(cfg.Keyring)
+	c.Audit.RegisterRetention(c.Retention)
+	v1 := func(h http.Handler) http.Handler { return apiversion.Mount(h, apiversion.V1) }
+	gw, err := gateway.New([]gateway.Route{
+		{Name: "messaging", Patterns: []string{"/messaging/"}, Strip: "/messaging",
+			Handler: apiversion.Mount(c.Messaging.Handler(), messaging.APIVersions...)},
+		{Name: "ugc", Patterns: []string{"/ugc/"}, Strip: "/ugc", Handler: v1(c.UGC.Handler())},
+		{Name: "orchestration", Patterns: []string{"/orchestration/"}, Strip: "/orchestration", Handler: v1(c.Orchestration.Handler())},
+		{Name: "feature-flags", Patterns: []string{"/flags", "/flags/"}, Handler: v1(c.Flags.Handler())},
+		{Name: "scheduler", Patterns: []string{"/schedules", "/schedules/"}, Handler: v1(c.Scheduler.Handler())},
+		{Name: "presence", Patterns: []string{"/presence", "/presence/"}, Handler: v1(c.Presence.Handler())},
+		{Name: "webhooks", Patterns: []string{webhooks.Path, webhooks.Path + "/"}, Handler: v1(c.Webhooks.Handler())},
+		{Name: "usage", Patterns: []string{metering.Path, metering.Path + "/"}, Handler: v1(c.Meter.Handler())},
+		{Name: "retention", Patterns: []string{retention.Path, retention.Path + "/"}, Handler: v1(c.Retention.Handler())},
+		{Name: "replication", Patterns: []string{replication.Path, replication.Path + "/"}, Handler: v1(c.Replication.Handler())},
+		{Name: "encryption", Patterns: []string{encryption.Path, encryption.Path + "/"}, Handler: v1(cfg.Keyring.Handler())},
+		{Name: "ugc-worker", Patterns: []string{"/ugc-worker/"}, Strip: "/ugc-worker",
+			Handler: v1(auth.Guard(auth.PermUGCModerate, auth.PermUGCSubmit, workerService.Handler()))},
+		{Name: "notification", Patterns: []string{"/notify", "/notifications/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermNotificationsSend, c.Notifications.Handler()))},
+		{Name: "notification-templates", Patterns: []string{"/notifications/templates/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermTemplatesManage, c.Notifications.Handler()))},
+		{Name: "notification-suppressions", Patterns: []string{"/notifications/suppressions", "/notifications/suppressions/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermSuppressionsManage, c.Notifications.Handler()))},
+		{Name: "notification-inbox", Patterns: []string{"/notifications/inbox", "/notifications/inbox/"},
+			Handler: v1(auth.Guard(auth.PermNotificationsRead, auth.PermNotificationsRead, c.Notifications.Handler()))},
+		{Name: "logs", Patterns: []string{"/logs", "/logs/"},
+			Handler: v1(auth.Guard(auth.PermLogsRead, auth.PermLogsWrite, logsService.Handler()))},
+		{Name: "metrics", Patterns: []string{"/metrics", "/metrics/", "/v1/metrics"},
+			Handler: apiversion.Mount(auth.Guard(auth.PermMetricsRead, auth.PermMetricsWrite, metricsService.Handler()), apiversion.V1).Passthrough("/v1/metrics")},
+		{Name: "alerts", Patterns: []string{"/alerts", "/alerts/"},
+			Handler: v1(auth.Guard(auth.PermMetricsRead, auth.PermAlertsManage, c.Alerts.Handler()))},
+		{Name: "audit", Patterns: []string{audit.Path}, Handler: c.Audit.Handler()},
+		{Name: "admin", Patterns: []string{adminchannel.Path}, Handler: c.Admin.Handler()},
+	}, nil, logger)
+	if err != nil {
+		t.Fatalf("testsupport: build routes: %v", err)
+	}
+	authn := auth.New(auth.ParseAPIKeys(cfg.APIKeys), auth.JWTConfig{})
+	if cfg.Policy != nil {
+		authn.SetPolicy(cfg.Policy)
+	}
+	idem := idempotency.New(c.DB, idempotency.Config{TTL: time.Hour})
+	mux := http.NewServeMux()
+	mux.Handle("/", authn.Require(idem.Middleware(gw.Handler())))
+	mux.Handle(dashboard.Path, dashboard.Handler())
+	mux.Handle(notification.TrackPath, c.Notifications.TrackingHandler())
+	versioned := apiversion.Mount(mux, apiversion.All...).Passthrough("/v1/metrics")
+	srv.Config.Handler = server.Chain(versioned, server.Standard(logger, server.MiddlewareConfig{})...)
+	srv.Start()
+
+	t.Cleanup(func() {
+		stopScheduler()
+		<-schedulerDone
+		stopTriggers()
+		<-triggersDone
+		stopWebhooks()
+		<-webhooksDone
+		stopReplication()
+		<-replicationDone
+		stopMedia()
+		<-mediaDone
+		srv.Close()
+		c.Alerts.Stop()
+		_, _ = c.Workers.Stop(context.Background())
+		workerService.Shutdown()
+		c.Bus.Stop()
+		_, _ = c.Logs.Stop(context.Background())
+		c.Metrics.Stop()
+		_ = c.DB.Close()
+		out.close()
+	})
+	return c
+}
+
+// Client returns a client for every service, reaching them through the
+// gateway with opts, such as client.WithAPIKey.
+func (c *Cluster) Client(t testing.TB, opts ...client.Option) *client.Gateway {
+	t.Helper()
+	api, err := client.NewGateway(c.URL, opts...)
+	if err != nil {
+		t.Fatalf("testsupport: build client: %v", err)
+	}
+	return api
+}
+
+// EnqueueModeration submits job to the moderation workers.
+func (c *Cluster) EnqueueModeration(t testing.TB, job ugcworker.Job) {
+	t.Helper()
+	if status, body := c.Do(t, http.MethodPost, "/ugc-worker/jobs", job); status != http.StatusAccepted {
+		t.Fatalf("testsupport: enqueue moderation job %s: %d %s", job.ContentID, status, body)
+	}
+}
+
+// NextModerationResult waits for the workers' next verdict.
+func (c *Cluster) NextModerationResult(t testing.TB) ugcworker.Result {
+	t.Helper()
+	var result ugcworker.Result
+	c.Eventually(t, "a moderation result", func() bool {
+		status, body := c.Do(t, http.MethodGet, "/ugc-worker/jobs/next", nil)
+		if status != http.StatusOK {
+			return false
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("testsupport: decode moderation result: %v", err)
+		}
+		return true
+	})
+	return result
+}
+
+// Deliveries returns what has been sent over channel so far.
+func (c *Cluster) Deliveries(channel notification.Channel) []notification.Delivery {
+	sender := c.senders[channel]
+	if sender == nil {
+		return nil
+	}
+	return sender.Deliveries()
+}
+
+// WaitForDeliveries waits until at least n notifications have been sent
+// over channel and returns them all.
+func (c *Cluster) WaitForDeliveries(t testing.TB, channel notification.Channel, n int) []notification.Delivery {
+	t.Helper()
+	var deliveries []notification.Delivery
+	c.Eventually(t, "notifications over "+string(channel), func() bool {
+		deliveries = c.Deliveries(channel)
+		return len(deliveries) >= n
+	})
+	return deliveries
+}
+
+// FlushUsage adds the usage recorded so far to the totals /usage reports,
+// which the cluster otherwise leaves buffered.
+func (c *Cluster) FlushUsage(t testing.TB) {
+	t.Helper()
+	if err := c.Meter.Flush(context.Background()); err != nil {
+		t.Fatalf("testsupport: flush usage: %v", err)
+	}
+}
+
+// Eventually polls cond until it holds, failing t after the configured
+// WaitTimeout. Services react to events and queued jobs on their own
+// goroutines, so effects in another service are checked this way.
+func (c *Cluster) Eventually(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(c.cfg.WaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("testsupport: timed out after %s waiting for %s", c.cfg.WaitTimeout, what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Do sends a request to the gateway path with ClientAPIKey, encoding
+// payload as JSON unless it is nil, and returns the status and body. It
+// reaches routes pkg/client does not cover.
+func (c *Cluster) Do(t testing.TB, method, path string, payload any) (int, []byte) {
+	t.Helper()
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			t.Fatalf("testsupport: encode %s %s: %v", method, path, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), method, c.URL+path, body)
+	if err != nil {
+		t.Fatalf("testsupport: build %s %s: %v", method, path, err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.cfg.ClientAPIKey != "" {
+		req.Header.Set(auth.APIKeyHeader, c.cfg.ClientAPIKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("testsupport: %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("testsupport: read %s %s: %v", method, path, err)
+	}
+	return resp.StatusCode, data
+}
+
+// testWriter sends the services' logs to the test's log, and drops those
+// written after the cluster has stopped, when t may no longer be used.
+type testWriter struct {
+	mu     sync.Mutex
+	t      testing.TB
+	closed bool
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
+	return len(p), nil
+}
+
+func (w *testWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+}
@@ -0,0 +1,776 @@
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/messaging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metricscollector"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/notification"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/orchestration"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugcworker"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/websocket"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/pkg/client"
+)
+
+func TestFlaggedContentNotifiesModerators(t *testing.T) {
+	c := Start(t, Config{})
+	ctx := context.Background()
+	api := c.Client(t)
+
+	if _, err := api.UGC.SubmitContent(ctx, client.SubmitRequest{
+		ContentID: "c-1", TenantID: "acme", ProjectID: "p1", Filename: "post.txt", MimeType: "text/plain",
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	c.EnqueueModeration(t, ugcworker.Job{ContentID: "c-1", AuthorID: "u-1", Body: "cheap spam here"})
+	result := c.NextModerationResult(t)
+	if result.Decision != ugcworker.DecisionFlagged || result.Job.ContentID != "c-1" {
+		t.Fatalf("expected c-1 to be flagged, got %+v", result)
+	}
+	if _, err := api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateRejected, Reason: result.Reason}); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+
+	deliveries := c.WaitForDeliveries(t, notification.ChannelInApp, 1)
+	if deliveries[0].Recipient != "moderators" || !strings.Contains(deliveries[0].Body, "c-1 was rejected") {
+		t.Fatalf("unexpected delivery %+v", deliveries[0])
+	}
+	if status, body := c.Do(t, http.MethodGet, "/audit?action=ugc.content.review", nil); status != http.StatusOK || !strings.Contains(string(body), "content/c-1") {
+		t.Fatalf("expected the review in the audit log, got %d %s", status, body)
+	}
+}
+
+func TestAlertsReachNotificationsOverHTTP(t *testing.T) {
+	c := Start(t, Config{
+		APIKeys:      []string{"service-key", "acme:tenant-key"},
+		ClientAPIKey: "service-key",
+	})
+	if err := c.Alerts.PutRule(metricscollector.AlertRule{
+		Name: "queue_depth_high", Metric: "queue_depth", Comparator: metricscollector.CompareGreater, Threshold: 10,
+	}); err != nil {
+		t.Fatalf("put rule: %v", err)
+	}
+	api := c.Client(t, client.WithAPIKey("service-key"))
+	if _, err := api.Metrics.IngestMetric(context.Background(), client.MetricSample{Namespace: "worker", Name: "queue_depth", Value: 42}); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	deliveries := c.WaitForDeliveries(t, notification.ChannelWebhook, 1)
+	if deliveries[0].Recipient != "ops" || !strings.Contains(deliveries[0].Body, "queue_depth_high is firing") {
+		t.Fatalf("unexpected delivery %+v", deliveries[0])
+	}
+
+	_, err := c.Client(t, client.WithAPIKey("tenant-key")).UGC.SubmitContent(context.Background(), client.SubmitRequest{
+		ContentID: "c-2", TenantID: "globex", ProjectID: "p1", Filename: "post.txt",
+	})
+	if !client.IsCode(err, "ugc.forbidden_tenant") {
+		t.Fatalf("expected another tenant to be refused, got %v", err)
+	}
+}
+
+func TestMessagingServesV2Envelope(t *testing.T) {
+	c := Start(t, Config{})
+	publish := map[string]any{
+		"scope":   map[string]string{"tenant_id": "acme", "project_id": "p1"},
+		"payload": map[string]string{"encoding": "text", "data": "hello"},
+	}
+	for _, path := range []string{"/v2/messaging/topics/scores/messages", "/messaging/v2/topics/scores/messages"} {
+		status, body := c.Do(t, http.MethodPost, path, publish)
+		if status != http.StatusCreated || !strings.Contains(string(body), `"scope":{"tenant_id":"acme","project_id":"p1"}`) ||
+			!strings.Contains(string(body), `"data":"aGVsbG8="`) {
+			t.Fatalf("%s: expected a v2 message, got %d %s", path, status, body)
+		}
+	}
+	if status, body := c.Do(t, http.MethodGet, "/v2/ugc/content?tenant_id=acme", nil); status != http.StatusNotFound || !strings.Contains(string(body), "api.unsupported_version") {
+		t.Fatalf("expected ugc to refuse v2, got %d %s", status, body)
+	}
+}
+
+func TestScheduledJobsReachServicesOverHTTP(t *testing.T) {
+	c := Start(t, Config{
+		APIKeys:      []string{"service-key"},
+		ClientAPIKey: "service-key",
+	})
+	ctx := context.Background()
+	api := c.Client(t, client.WithAPIKey("service-key"))
+	scope := client.ScheduleScope{TenantID: "acme", ProjectID: "p1"}
+
+	if _, err := api.Scheduler.PutSchedule(ctx, scope, "nightly-report", client.ScheduleRequest{
+		Schedule: "0 3 * * *",
+		Timezone: "Europe/Berlin",
+		Action: client.ScheduleAction{Type: client.ScheduleActionNotify, Notify: &client.ScheduleNotifyAction{
+			Channel: "email", Recipient: "ops@example.com", Template: "service_health",
+			Data: map[string]any{"Service": "reports", "State": "up", "Previous": "down"},
+		}},
+	}); err != nil {
+		t.Fatalf("put schedule: %v", err)
+	}
+	run, err := api.Scheduler.Trigger(ctx, scope, "nightly-report")
+	if err != nil || run.Trigger != "manual" {
+		t.Fatalf("trigger: %+v %v", run, err)
+	}
+	deliveries := c.WaitForDeliveries(t, notification.ChannelEmail, 1)
+	if deliveries[0].Recipient != "ops@example.com" || !strings.Contains(deliveries[0].Body, "Service reports is up") {
+		t.Fatalf("unexpected delivery %+v", deliveries[0])
+	}
+	c.Eventually(t, "the run to be recorded", func() bool {
+		runs, err := api.Scheduler.Runs(ctx, scope, "nightly-report")
+		return err == nil && len(runs) == 1 && runs[0].Status == client.ScheduleRunSucceeded
+	})
+
+	if _, err := api.Scheduler.PutSchedule(ctx, scope, "tick", client.ScheduleRequest{
+		Schedule: "* * * * *",
+		Action: client.ScheduleAction{Type: client.ScheduleActionPublish, Publish: &client.SchedulePublishAction{
+			Topic: "ticks", Payload: "tick",
+		}},
+	}); err != nil {
+		t.Fatalf("put schedule: %v", err)
+	}
+	if _, err := api.Scheduler.Trigger(ctx, scope, "tick"); err != nil {
+		t.Fatalf("trigger: %v", err)
+	}
+	c.Eventually(t, "the scheduled message", func() bool {
+		messages, err := api.Messaging.Pull(ctx, "ticks", client.PullOptions{TenantID: "acme"})
+		return err == nil && len(messages) == 1 && string(messages[0].Payload) == "tick"
+	})
+	if _, err := api.Scheduler.GetSchedule(ctx, scope, "missing"); !client.IsCode(err, "schedules.not_found") {
+		t.Fatalf("expected schedules.not_found, got %v", err)
+	}
+}
+
+func TestWebhooksDeliverSignedEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []map[string]any
+	failures := 1
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event map[string]any
+		if client.VerifyWebhook("whsec_0123456789abcdef", r.Header, body, time.Minute) != nil || json.Unmarshal(body, &event) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		events = append(events, event)
+	}))
+	defer receiver.Close()
+
+	c := Start(t, Config{})
+	ctx := context.Background()
+	api := c.Client(t)
+	hooks, err := client.NewWebhooks(c.URL)
+	if err != nil {
+		t.Fatalf("new webhooks client: %v", err)
+	}
+	scope := client.WebhookScope{ProjectID: "p1"}
+	if _, err := hooks.PutWebhook(ctx, scope, "reviews", client.WebhookRequest{
+		URL: receiver.URL, Events: []string{"ugc.content_reviewed"}, Secret: "whsec_0123456789abcdef",
+	}); err != nil {
+		t.Fatalf("put webhook: %v", err)
+	}
+
+	if _, err := api.UGC.SubmitContent(ctx, client.SubmitRequest{
+		ContentID: "c-1", TenantID: "acme", ProjectID: "p1", Filename: "post.txt", MimeType: "text/plain",
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateApproved}); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+	c.Eventually(t, "the delivery to succeed", func() bool {
+		deliveries, err := hooks.Deliveries(ctx, scope, "reviews", client.WebhookDeliverySucceeded)
+		return err == nil && len(deliveries) == 1 && deliveries[0].Attempts == 2
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0]["event"] != "ugc.content_reviewed" || events[0]["tenant_id"] != "acme" {
+		t.Fatalf("unexpected events %v", events)
+	}
+	if _, err := hooks.GetWebhook(ctx, scope, "missing"); !client.IsCode(err, "webhooks.not_found") {
+		t.Fatalf("expected webhooks.not_found, got %v", err)
+	}
+}
+
+func TestUsageIsMeteredPerTenant(t *testing.T) {
+	c := Start(t, Config{Quotas: []metering.Quota{{Meter: metering.MessagesPublished, Limit: 1, Period: metering.PeriodDay}}})
+	ctx := context.Background()
+	api := c.Client(t)
+	for range 2 {
+		if _, err := api.Messaging.Publish(ctx, "scores", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("hi")}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	c.FlushUsage(t)
+
+	meter, err := client.NewUsage(c.URL)
+	if err != nil {
+		t.Fatalf("new usage client: %v", err)
+	}
+	usage, err := meter.Totals(ctx, client.UsageQuery{TenantID: "acme", Meter: metering.MessagesPublished})
+	if err != nil || len(usage) != 1 || usage[0].Quantity != 2 {
+		t.Fatalf("expected two published messages, got %+v %v", usage, err)
+	}
+	quotas, err := meter.Quotas(ctx, "acme")
+	if err != nil || len(quotas) != 1 || !quotas[0].Exceeded || quotas[0].Used != 2 {
+		t.Fatalf("expected the daily quota to be exceeded, got %+v %v", quotas, err)
+	}
+	if status, body := c.Do(t, http.MethodGet, "/usage/export?tenant_id=acme", nil); status != http.StatusOK || !strings.Contains(string(body), ",acme,messages_published,2") {
+		t.Fatalf("export: %d %s", status, body)
+	}
+}
+
+func TestRetentionPurgesArchivedContent(t *testing.T) {
+	c := Start(t, Config{RetentionMaxAges: map[string]time.Duration{"ugc.archived": time.Nanosecond, "messaging.messages": 0}})
+	ctx := context.Background()
+	api := c.Client(t)
+	for _, id := range []string{"c-1", "c-2"} {
+		if _, err := api.UGC.SubmitContent(ctx, client.SubmitRequest{
+			ContentID: id, TenantID: "acme", ProjectID: "p1", Filename: "post.txt", MimeType: "text/plain",
+		}); err != nil {
+			t.Fatalf("submit %s: %v", id, err)
+		}
+	}
+	if _, err := api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateArchived}); err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+
+	ret, err := client.NewRetention(c.URL)
+	if err != nil {
+		t.Fatalf("new retention client: %v", err)
+	}
+	dryRun := true
+	report, err := ret.Run(ctx, "ugc.archived", &dryRun)
+	if err != nil || !report.DryRun || report.Records != 1 {
+		t.Fatalf("expected a dry run to count one record, got %+v %v", report, err)
+	}
+	if content, err := api.UGC.ListContent(ctx, client.ContentFilter{TenantID: "acme"}); err != nil || len(content) != 2 {
+		t.Fatalf("expected the dry run to keep both records, got %+v %v", content, err)
+	}
+	if report, err = ret.Run(ctx, "ugc.archived", nil); err != nil || report.DryRun || report.Records != 1 {
+		t.Fatalf("expected one record purged, got %+v %v", report, err)
+	}
+	content, err := api.UGC.ListContent(ctx, client.ContentFilter{TenantID: "acme"})
+	if err != nil || len(content) != 1 || content[0].ContentID != "c-2" {
+		t.Fatalf("expected only c-2 left, got %+v %v", content, err)
+	}
+
+	reports, err := ret.Reports(ctx, "ugc.archived")
+	if err != nil || len(reports) != 2 || reports[0].DryRun || !reports[1].DryRun {
+		t.Fatalf("expected both reports newest first, got %+v %v", reports, err)
+	}
+	policies, err := ret.Policies(ctx)
+	if err != nil || len(policies) != 6 {
+		t.Fatalf("expected every service's policy, got %+v %v", policies, err)
+	}
+	if _, err := ret.Run(ctx, "messaging.messages", nil); !client.IsCode(err, "retention.disabled") {
+		t.Fatalf("expected retention.disabled, got %v", err)
+	}
+}
+
+func TestReplicationReachesThePeerRegion(t *testing.T) {
+	standby := Start(t, Config{Region: "eu-west"})
+	primary := Start(t, Config{Region: "us-east", ReplicationPeer: standby.URL})
+	ctx := context.Background()
+	api, peer := primary.Client(t), standby.Client(t)
+
+	first, err := api.Messaging.Publish(ctx, "scores", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("one")})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := api.Messaging.Publish(ctx, "scores", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("two")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := api.Messaging.Ack(ctx, "scores", first.MessageID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if _, err := api.UGC.SubmitContent(ctx, client.SubmitRequest{
+		ContentID: "c-1", TenantID: "acme", ProjectID: "p1", Filename: "post.txt", MimeType: "text/plain",
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateApproved}); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+
+	standby.Eventually(t, "the review in the peer region", func() bool {
+		content, err := peer.UGC.ListContent(ctx, client.ContentFilter{TenantID: "acme"})
+		return err == nil && len(content) == 1 && content[0].State == client.StateApproved
+	})
+	messages, err := peer.Messaging.Pull(ctx, "scores", client.PullOptions{})
+	if err != nil || len(messages) != 1 || string(messages[0].Payload) != "two" {
+		t.Fatalf("expected only the unacknowledged message, got %+v %v", messages, err)
+	}
+
+	repl, err := client.NewReplication(standby.URL)
+	if err != nil {
+		t.Fatalf("new replication client: %v", err)
+	}
+	status, err := repl.Status(ctx)
+	if err != nil || status.Region != "eu-west" || len(status.Peers) != 1 || status.Peers[0].Origin != "us-east" || status.Peers[0].Applied != 5 {
+		t.Fatalf("expected five mutations applied from us-east, got %+v %v", status, err)
+	}
+	if repl, err = client.NewReplication(primary.URL); err != nil {
+		t.Fatalf("new replication client: %v", err)
+	}
+	if status, err = repl.Status(ctx); err != nil || status.Outbox.Pending != 0 || status.Outbox.LastShippedSeq != 5 {
+		t.Fatalf("expected an empty outbox, got %+v %v", status, err)
+	}
+}
+
+func TestEncryptionSealsPayloadsAndPII(t *testing.T) {
+	keys, err := encryption.NewKeyFile(map[string][]byte{"k1": []byte(strings.Repeat("k", 32))}, "k1")
+	if err != nil {
+		t.Fatalf("new key file: %v", err)
+	}
+	keyring := encryption.NewKeyring(keys, 0, logging.NewWithOptions("encryption", logging.Options{Output: io.Discard}))
+	c := Start(t, Config{Keyring: keyring, EventRecipient: "mods@example.com"})
+	ctx := context.Background()
+	api := c.Client(t)
+
+	if _, err := api.Messaging.Publish(ctx, "scores", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("secret-score")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := api.UGC.SubmitContent(ctx, client.SubmitRequest{
+		ContentID: "c-1", TenantID: "acme", ProjectID: "p1", Filename: "post.txt", MimeType: "text/plain",
+		Attributes: map[string]string{"email": "author@example.com"},
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if _, err := api.UGC.Review(ctx, "c-1", client.ReviewRequest{State: client.StateApproved}); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+	c.WaitForDeliveries(t, notification.ChannelInApp, 1)
+
+	err = storage.View(ctx, c.DB, func(tx storage.Tx) error {
+		for _, bucket := range []string{"messaging.messages", "ugc.content", "notification.history", "audit.entries"} {
+			err := tx.Scan(bucket, "", func(key string, value []byte) error {
+				for _, secret := range []string{"secret-score", "author@example.com", "mods@example.com"} {
+					if strings.Contains(string(value), secret) {
+						t.Errorf("%s/%s holds %q in plaintext", bucket, key, secret)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan storage: %v", err)
+	}
+
+	messages, err := api.Messaging.Pull(ctx, "scores", client.PullOptions{})
+	if err != nil || len(messages) != 1 || string(messages[0].Payload) != "secret-score" {
+		t.Fatalf("expected the payload opened, got %+v %v", messages, err)
+	}
+	content, err := api.UGC.ListContent(ctx, client.ContentFilter{TenantID: "acme"})
+	if err != nil || len(content) != 1 || content[0].Attributes["email"] != "author@example.com" {
+		t.Fatalf("expected the attributes opened, got %+v %v", content, err)
+	}
+	recent, err := api.Notifications.Recent(ctx)
+	if err != nil || len(recent) != 1 || recent[0].Recipient != "mods@example.com" {
+		t.Fatalf("expected the recipient opened, got %+v %v", recent, err)
+	}
+
+	enc, err := client.NewEncryption(c.URL)
+	if err != nil {
+		t.Fatalf("new encryption client: %v", err)
+	}
+	status, err := enc.Status(ctx)
+	if err != nil || status.Provider != "file" || status.ActiveKey != "k1" || len(status.Records) == 0 {
+		t.Fatalf("expected the key file's status, got %+v %v", status, err)
+	}
+	reports, err := enc.Rotate(ctx)
+	if err != nil || len(reports) != len(status.Records) {
+		t.Fatalf("expected a report per kind of record, got %+v %v", reports, err)
+	}
+	for _, report := range reports {
+		if report.KeyID != "k1" || report.Resealed != 0 || report.Error != "" {
+			t.Fatalf("expected records already under k1 to be left, got %+v", report)
+		}
+	}
+}
+
+func TestPresenceStreamsThroughTheStack(t *testing.T) {
+	c := Start(t, Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	presence, err := client.NewPresence(c.URL)
+	if err != nil {
+		t.Fatalf("new presence client: %v", err)
+	}
+	scope := client.PresenceScope{TenantID: "acme", ProjectID: "p1"}
+
+	changes := make(chan client.PresenceChange, 8)
+	go func() {
+		_ = presence.Watch(ctx, scope, client.PresencePlayer, []string{"alice"}, func(change client.PresenceChange) error {
+			changes <- change
+			return nil
+		})
+	}()
+	next := func() client.PresenceChange {
+		t.Helper()
+		select {
+		case change := <-changes:
+			return change
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for a presence change")
+		}
+		return client.PresenceChange{}
+	}
+	if snapshot := next(); snapshot.Reason != "" || snapshot.Presence.Status != client.PresenceOffline {
+		t.Fatalf("expected an offline snapshot, got %+v", snapshot)
+	}
+
+	if _, err := presence.Heartbeat(ctx, scope, client.PresencePlayer, "alice", client.HeartbeatRequest{TTL: time.Minute}); err != nil {
+		t.Fatalf("heartbeat: %v", err)
+	}
+	if change := next(); change.Reason != client.PresenceReasonHeartbeat || change.Presence.Status != client.PresenceOnline {
+		t.Fatalf("expected alice online, got %+v", change)
+	}
+	items, err := presence.Query(ctx, scope, client.PresencePlayer, []string{"alice", "bob"})
+	if err != nil || len(items) != 2 || items[0].Status != client.PresenceOnline || items[1].Status != client.PresenceOffline {
+		t.Fatalf("query: %+v %v", items, err)
+	}
+	if _, err := presence.Disconnect(ctx, scope, client.PresencePlayer, "alice"); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	if change := next(); change.Reason != client.PresenceReasonDisconnect || change.Previous != client.PresenceOnline {
+		t.Fatalf("expected alice to disconnect, got %+v", change)
+	}
+	if _, err := presence.Get(ctx, scope, client.PresencePlayer, "carol"); !client.IsCode(err, "presence.not_found") {
+		t.Fatalf("expected presence.not_found, got %v", err)
+	}
+}
+
+func TestAdminChannelPushesChangesThroughTheStack(t *testing.T) {
+	c := Start(t, Config{
+		APIKeys:      []string{"service-key", "acme:tenant-key"},
+		ClientAPIKey: "service-key",
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, c.URL+adminchannel.Path+"?topic=assignments&topic=flagged&topic=alerts",
+		http.Header{auth.APIKeyHeader: {"tenant-key"}}, websocket.Options{})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+	next := func() adminchannel.Frame {
+		t.Helper()
+		payload, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var f adminchannel.Frame
+		if err := json.Unmarshal(payload, &f); err != nil {
+			t.Fatalf("decode %s: %v", payload, err)
+		}
+		return f
+	}
+	for range 4 {
+		if f := next(); f.Type != "ready" && f.Type != "subscribed" {
+			t.Fatalf("expected the subscriptions to be confirmed, got %+v", f)
+		}
+	}
+
+	api := c.Client(t, client.WithAPIKey("service-key"))
+	for _, tenant := range []string{"globex", "acme"} {
+		if _, err := api.Orchestration.AssignWork(ctx, client.AssignRequest{AgentID: "agent-1", WorkloadID: "w-1", TenantID: tenant, ProjectID: "p1"}); err != nil {
+			t.Fatalf("assign: %v", err)
+		}
+	}
+	c.EnqueueModeration(t, ugcworker.Job{ContentID: "c-1", AuthorID: "u-1", Body: "cheap spam here"})
+	if err := c.Alerts.PutRule(metricscollector.AlertRule{
+		Name: "queue_depth_high", Metric: "queue_depth", Comparator: metricscollector.CompareGreater, Threshold: 10,
+	}); err != nil {
+		t.Fatalf("put rule: %v", err)
+	}
+	if _, err := api.Metrics.IngestMetric(ctx, client.MetricSample{Namespace: "worker", Name: "queue_depth", Value: 42}); err != nil {
+		t.Fatalf("ingest: %v", err)
+	}
+
+	seen := make(map[string]string)
+	for len(seen) < 3 {
+		f := next()
+		if f.Type != "event" {
+			t.Fatalf("expected an event, got %+v", f)
+		}
+		if f.Topic == orchestration.AdminTopic && f.TenantID != "acme" {
+			t.Fatalf("expected only acme's assignment, got %+v", f)
+		}
+		seen[f.Topic] = string(f.Data)
+	}
+	if !strings.Contains(seen[ugcworker.AdminTopic], `"content_id":"c-1"`) || !strings.Contains(seen[metricscollector.AdminTopic], "queue_depth_high") {
+		t.Fatalf("unexpected events %v", seen)
+	}
+}
+
+func TestDashboardReadsTheAPIs(t *testing.T) {
+	c := Start(t, Config{APIKeys: []string{"operator-key"}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	get := func(path, key string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL+path, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// The page loads without credentials; the APIs it calls do not.
+	if resp := get("/dashboard/", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the page, got %s", resp.Status)
+	}
+	if resp := get("/logs/recent", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %s", resp.Status)
+	}
+	for _, path := range []string{
+		"/messaging/topics/live-feed/messages?limit=1000&cursor=",
+		"/orchestration/assignments?limit=1000&cursor=",
+		"/ugc/content?state=pending&limit=50",
+		"/logs/recent?limit=1000&cursor=",
+		"/notifications/recent?limit=1000&cursor=",
+	} {
+		resp := get(path, "operator-key")
+		var body struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != http.StatusOK || body.Items == nil {
+			t.Fatalf("%s: expected a page of items, got %s %v", path, resp.Status, err)
+		}
+	}
+	if resp := get("/ugc-worker/jobs/results/stream?decision=flagged", "operator-key"); resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected the flagged results stream, got %s %v", resp.Status, resp.Header)
+	}
+}
+
+func TestTriggersCreateAssignmentsFromMessages(t *testing.T) {
+	c := Start(t, Config{
+		APIKeys:      []string{"service-key"},
+		ClientAPIKey: "service-key",
+		Triggers: []orchestration.Trigger{
+			{Name: "eu-builds", Topic: "builds", Attributes: map[string]string{"region": "eu"},
+				AgentID: "builder-eu", WorkloadID: "build-${payload.build.id}", Metadata: map[string]string{"commit": "${payload.commit}"}},
+			{Name: "builds", Topic: "builds", AgentID: "builder-${attributes.region}", WorkloadID: "build-${payload.build.id}"},
+		},
+	})
+	ctx := context.Background()
+	api := c.Client(t, client.WithAPIKey("service-key"))
+	publish := func(payload string, attributes map[string]string) {
+		t.Helper()
+		if _, err := api.Messaging.Publish(ctx, "builds", client.PublishRequest{
+			TenantID: "acme", ProjectID: "p1", Payload: []byte(payload), Attributes: attributes,
+		}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	publish(`{"build":{"id":42},"commit":"abc123"}`, map[string]string{"region": "eu"})
+	publish(`{"build":{"id":43}}`, map[string]string{"region": "us"})
+	publish(`{"build":{}}`, map[string]string{"region": "us"})
+
+	var assignments []client.Assignment
+	c.Eventually(t, "two assignments", func() bool {
+		var err error
+		assignments, err = api.Orchestration.ListAssignments(ctx, client.AssignmentFilter{TenantID: "acme"})
+		return err == nil && len(assignments) == 2
+	})
+	got := map[string]client.Assignment{}
+	for _, a := range assignments {
+		got[a.AgentID] = a
+	}
+	eu, us := got["builder-eu"], got["builder-us"]
+	if eu.WorkloadID != "build-42" || eu.ProjectID != "p1" || eu.Metadata["commit"] != "abc123" || eu.Metadata[orchestration.MetadataTriggerTopic] != "builds" {
+		t.Fatalf("unexpected eu assignment %+v", eu)
+	}
+	if us.WorkloadID != "build-43" || us.Metadata[orchestration.MetadataTriggerMessageID] == "" {
+		t.Fatalf("unexpected us assignment %+v", us)
+	}
+	c.Eventually(t, "every message to be acknowledged", func() bool {
+		messages, err := api.Messaging.Pull(ctx, "builds", client.PullOptions{TenantID: "acme"})
+		return err == nil && len(messages) == 0
+	})
+}
+
+func TestPublishedMessagesCarryTheRequestID(t *testing.T) {
+	c := Start(t, Config{})
+	ctx := client.WithRequestID(context.Background(), "req-publish-1")
+	api := c.Client(t)
+	if _, err := api.Messaging.Publish(ctx, "traced", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("a")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if _, err := api.Messaging.Publish(ctx, "traced", client.PublishRequest{
+		TenantID: "acme", ProjectID: "p1", Payload: []byte("b"), Attributes: map[string]string{"request_id": "upstream"},
+	}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	messages, err := api.Messaging.Pull(context.Background(), "traced", client.PullOptions{TenantID: "acme"})
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("pull = %d messages, %v", len(messages), err)
+	}
+	if got := messages[0].Attributes["request_id"]; got != "req-publish-1" {
+		t.Fatalf("request_id attribute = %q, want req-publish-1", got)
+	}
+	if got := messages[1].Attributes["request_id"]; got != "upstream" {
+		t.Fatalf("publisher's request_id attribute = %q, want upstream", got)
+	}
+}
+
+func TestNotificationEngagementIsTracked(t *testing.T) {
+	c := Start(t, Config{APIKeys: []string{"service-key"}, ClientAPIKey: "service-key"})
+	ctx := context.Background()
+	api := c.Client(t, client.WithAPIKey("service-key"))
+	if status, body := c.Do(t, http.MethodPut, "/notifications/templates/sale", map[string]string{"body": "Hi {{.Name}}, see https://shop.example.com/sale."}); status != http.StatusCreated {
+		t.Fatalf("put template: %d %s", status, body)
+	}
+	email, err := api.Notifications.Notify(ctx, client.Notification{Channel: client.ChannelEmail, Recipient: "grace@example.com", Template: "sale", Data: map[string]any{"Name": "Grace"}})
+	if err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	link := c.URL + notification.TrackPath + "click/" + email.ID + "/0"
+	if email.Template != "sale" || email.Body != "Hi Grace, see "+link+"." {
+		t.Fatalf("expected the link rewritten, got %+v", email)
+	}
+	// Mail clients follow links without credentials.
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := noRedirect.Get(link)
+	if err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "https://shop.example.com/sale" {
+		t.Fatalf("expected a redirect to the sale, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if status, _ := c.Do(t, http.MethodGet, "/notifications/inbox?recipient=grace", nil); status != http.StatusOK {
+		t.Fatalf("expected the inbox with credentials, got %d", status)
+	}
+	resp, err = http.Get(c.URL + "/notifications/inbox?recipient=grace")
+	if err != nil {
+		t.Fatalf("inbox: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the inbox to need credentials, got %d", resp.StatusCode)
+	}
+
+	inApp, err := api.Notifications.Notify(ctx, client.Notification{Channel: client.ChannelInApp, Recipient: "grace", Template: "sale", Data: map[string]any{"Name": "Grace"}})
+	if err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	if n, err := api.Notifications.MarkRead(ctx, "grace", inApp.ID, email.ID); err != nil || n != 1 {
+		t.Fatalf("expected the in-app notification marked read, got %d %v", n, err)
+	}
+	inbox, err := api.Notifications.Inbox(ctx, "grace")
+	if err != nil || len(inbox) != 1 || inbox[0].ID != inApp.ID || inbox[0].ReadAt.IsZero() {
+		t.Fatalf("expected the read notification in grace's inbox, got %+v %v", inbox, err)
+	}
+	stats, err := api.Notifications.TemplateEngagement(ctx, "sale")
+	if err != nil || stats.Sent != 2 || stats.Opened != 1 || stats.Clicked != 1 || stats.Read != 1 || stats.ReadRate != 1 {
+		t.Fatalf("unexpected engagement %+v %v", stats, err)
+	}
+	if _, err := api.Notifications.TemplateEngagement(ctx, "unsent"); !client.IsCode(err, "notification.not_tracked") {
+		t.Fatalf("expected notification.not_tracked, got %v", err)
+	}
+}
+
+func TestConsumerGroupLagIsAlerted(t *testing.T) {
+	c := Start(t, Config{})
+	c.Messaging.SetLagThresholds(messaging.LagThresholds{MaxUnpulled: 2})
+	api := c.Client(t)
+	ctx := context.Background()
+	for range 4 {
+		if _, err := api.Messaging.Publish(ctx, "orders", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("order")}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	pulled, err := api.Messaging.Pull(ctx, "orders", client.PullOptions{TenantID: "acme", Group: "billing", Limit: 1})
+	if err != nil || len(pulled) != 1 {
+		t.Fatalf("pull: %v %v", pulled, err)
+	}
+
+	notifier, err := messaging.NewNotificationClient(c.URL, string(notification.ChannelWebhook), "ops", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alerts := messaging.NewLagAlerts(c.Messaging, notifier, time.Minute, logging.New("test"))
+	alerts.Check(ctx)
+	deliveries := c.WaitForDeliveries(t, notification.ChannelWebhook, 1)
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Body, "Consumer group billing is lagging: 1 unacked and 3 unpulled") {
+		t.Fatalf("expected one lagging alert, got %+v", deliveries)
+	}
+
+	if _, err := api.Messaging.Pull(ctx, "orders", client.PullOptions{TenantID: "acme", Group: "billing"}); err != nil {
+		t.Fatalf("pull: %v", err)
+	}
+	alerts.Check(ctx)
+	deliveries = c.WaitForDeliveries(t, notification.ChannelWebhook, 2)
+	if !strings.Contains(deliveries[1].Body, "Consumer group billing is ok") {
+		t.Fatalf("expected a recovery alert, got %+v", deliveries[1])
+	}
+}
+
+func TestClientsOpenTopicKeyPayloads(t *testing.T) {
+	c := Start(t, Config{})
+	ctx := context.Background()
+	api := c.Client(t)
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	key, err := api.Messaging.PutTopicKey(ctx, "secrets", "acme", private.PublicKey())
+	if err != nil || key.KeyID == "" || key.Algorithm != client.TopicKeyAlgorithm {
+		t.Fatalf("put topic key = %+v, %v", key, err)
+	}
+	if _, err := api.Messaging.Publish(ctx, "secrets", client.PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("launch codes")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	messages, err := api.Messaging.Pull(ctx, "secrets", client.PullOptions{TenantID: "acme"})
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("pull = %d messages, %v", len(messages), err)
+	}
+	sealed := messages[0]
+	if sealed.Attributes[client.AttrEncryptionKeyID] != key.KeyID || bytes.Contains(sealed.Payload, []byte("launch codes")) {
+		t.Fatalf("expected the payload sealed to the key, got %+v", sealed)
+	}
+	if plain, err := client.OpenPayload(private, sealed); err != nil || string(plain) != "launch codes" {
+		t.Fatalf("open payload = %q, %v", plain, err)
+	}
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	if _, err := client.OpenPayload(other, sealed); err == nil {
+		t.Fatal("expected another key to fail to open the payload")
+	}
+}
@@ -3,8 +3,26 @@ package ugc
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the UGC API.
+const (
+	codeInvalidJSON      = "ugc.invalid_json"
+	codeInvalidRequest   = "ugc.invalid_request"
+	codeNotFound         = "ugc.not_found"
+	codeUnavailable      = "ugc.store_unavailable"
+	codeForbidden        = "ugc.forbidden_tenant"
+	codeForbiddenProject = "ugc.forbidden_project"
+	codeNotPending       = "ugc.not_pending"
 )
 
 const (
@@ -20,6 +38,7 @@ func (s *Service) Handler() http.Handler {
 		_, _ = w.Write([]byte("ok"))
 	})
 	mux.HandleFunc(contentBasePath, s.handleContent)
+	mux.HandleFunc(contentStatsPath, s.handleStats)
 	mux.HandleFunc(contentByIDPrefix, s.handleContentByID)
 	return mux
 }
@@ -47,7 +66,7 @@ func (s *Service) handleContent(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		s.handleList(w, r)
 	default:
-		headerAllow(w, http.MethodPost, http.MethodGet)
+		headerAllow(w, r, http.MethodPost, http.MethodGet)
 	}
 }
 
@@ -55,13 +74,26 @@ func (s *Service) handleSubmit(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	var payload submitPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	tenant, ok := auth.ResolveTenant(r.Context(), payload.TenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+payload.TenantID)
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), payload.ProjectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+payload.ProjectID)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermUGCSubmit, tenant, project) {
 		return
 	}
 	content, err := s.SubmitContent(r.Context(), SubmitRequest{
 		ContentID:  payload.ContentID,
-		TenantID:   payload.TenantID,
-		ProjectID:  payload.ProjectID,
+		TenantID:   tenant,
+		ProjectID:  project,
 		Filename:   payload.Filename,
 		MimeType:   payload.MimeType,
 		SizeBytes:  payload.SizeBytes,
@@ -69,69 +101,171 @@ func (s *Service) handleSubmit(w http.ResponseWriter, r *http.Request) {
 		Attributes: payload.Attributes,
 	})
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusCreated, content)
 }
 
 func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	requested := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), requested)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+requested)
+		return
+	}
+	requestedProject := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), requestedProject)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+requestedProject)
+		return
+	}
 	filter := ListFilter{
-		TenantID:  r.URL.Query().Get("tenant_id"),
-		ProjectID: r.URL.Query().Get("project_id"),
+		TenantID:  tenant,
+		ProjectID: project,
+	}
+	if !auth.Allow(w, r, auth.PermUGCRead, filter.TenantID, filter.ProjectID) {
+		return
 	}
 	if state := r.URL.Query().Get("state"); state != "" {
 		parsed, err := ParseState(state)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			httpError(w, r, err)
 			return
 		}
 		filter.State = parsed
 	}
-	items, err := s.ListContent(r.Context(), filter)
+	paged := pagination.Requested(r)
+	page, err := pagination.Parse(r, pagination.ListLimit(paged))
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, items)
+	items, next, err := s.ListContent(r.Context(), filter, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.WriteList(w, r, items, next, paged)
 }
 
 func (s *Service) handleContentByID(w http.ResponseWriter, r *http.Request) {
 	if !strings.HasPrefix(r.URL.Path, contentByIDPrefix) {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 		return
 	}
 	id := strings.TrimPrefix(r.URL.Path, contentByIDPrefix)
 	if id == "" {
-		http.NotFound(w, r)
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 		return
 	}
 	if strings.HasSuffix(id, "/review") {
 		contentID := strings.TrimSuffix(id, "/review")
 		if contentID == "" || strings.Contains(contentID, "/") {
-			http.NotFound(w, r)
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
 			return
 		}
 		if r.Method != http.MethodPost {
-			headerAllow(w, http.MethodPost)
+			headerAllow(w, r, http.MethodPost)
 			return
 		}
 		s.handleReview(w, r, contentID)
 		return
 	}
-	http.NotFound(w, r)
+	if contentID, ok := strings.CutSuffix(id, "/data"); ok && s.media != nil && contentID != "" && !strings.Contains(contentID, "/") {
+		switch r.Method {
+		case http.MethodPut:
+			s.handleUpload(w, r, contentID)
+		case http.MethodGet:
+			s.handleBlob(w, r, contentID, false)
+		default:
+			headerAllow(w, r, http.MethodPut, http.MethodGet)
+		}
+		return
+	}
+	if contentID, ok := strings.CutSuffix(id, "/thumbnail"); ok && s.media != nil && contentID != "" && !strings.Contains(contentID, "/") {
+		if r.Method != http.MethodGet {
+			headerAllow(w, r, http.MethodGet)
+			return
+		}
+		s.handleBlob(w, r, contentID, true)
+		return
+	}
+	problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+}
+
+// handleUpload stores the request body as the content's bytes and answers
+// 202 with the content, whose media is processed afterwards.
+func (s *Service) handleUpload(w http.ResponseWriter, r *http.Request, id string) {
+	defer r.Body.Close()
+	existing, err := s.GetContent(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermUGCSubmit, existing.TenantID, existing.ProjectID) {
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.mediaConfig.MaxBytes))
+	if err != nil {
+		problem.DecodeFailed(w, r, codeInvalidRequest, "could not read request body", err)
+		return
+	}
+	content, err := s.UploadData(r.Context(), id, data)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, content)
+}
+
+// handleBlob serves the content's PNG thumbnail, or its uploaded bytes as
+// the type the processor detected.
+func (s *Service) handleBlob(w http.ResponseWriter, r *http.Request, id string, thumbnail bool) {
+	existing, err := s.GetContent(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermUGCRead, existing.TenantID, existing.ProjectID) {
+		return
+	}
+	read, contentType := s.Data, "application/octet-stream"
+	if thumbnail {
+		read, contentType = s.Thumbnail, "image/png"
+	} else if existing.Media != nil && existing.Media.DetectedType != "" {
+		contentType = existing.Media.DetectedType
+	}
+	data, err := read(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
 }
 
 func (s *Service) handleReview(w http.ResponseWriter, r *http.Request, id string) {
 	defer r.Body.Close()
+	existing, err := s.GetContent(r.Context(), id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermUGCModerate, existing.TenantID, existing.ProjectID) {
+		return
+	}
 	var payload reviewPayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json payload", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
 		return
 	}
 	state, err := ParseState(payload.State)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		httpError(w, r, err)
 		return
 	}
 	content, err := s.ReviewContent(r.Context(), ReviewRequest{
@@ -140,7 +274,7 @@ func (s *Service) handleReview(w http.ResponseWriter, r *http.Request, id string
 		Reason:    payload.Reason,
 	})
 	if err != nil {
-		httpError(w, err)
+		httpError(w, r, err)
 		return
 	}
 	writeJSON(w, http.StatusOK, content)
@@ -149,16 +283,16 @@ func (s *Service) handleReview(w http.ResponseWriter, r *http.Request, id string
 // ParseState converts string representations into a State value.
 func ParseState(value string) (State, error) {
 	switch strings.ToLower(value) {
-	case string(StatePending), "pending":
+	case string(StatePending):
 		return StatePending, nil
-	case string(StateApproved), "approved":
+	case string(StateApproved):
 		return StateApproved, nil
-	case string(StateRejected), "rejected":
+	case string(StateRejected):
 		return StateRejected, nil
-	case string(StateArchived), "archived":
+	case string(StateArchived):
 		return StateArchived, nil
 	default:
-		return "", errors.New("unknown state")
+		return "", validation.Invalid("state", validation.RuleOneOf, "must be one of pending, approved, rejected, archived")
 	}
 }
 
@@ -168,15 +302,29 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func httpError(w http.ResponseWriter, err error) {
-	if errors.Is(err, ErrContentNotFound) {
-		http.Error(w, err.Error(), http.StatusNotFound)
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrContentNotFound) || errors.Is(err, ErrNoData) {
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, ErrNotPending) {
+		problem.Write(w, r, http.StatusConflict, codeNotPending, err.Error())
+		return
+	}
+	if errors.Is(err, ErrTooLarge) {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, err.Error())
+		return
+	}
+	if errors.Is(err, ErrStore) {
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+		return
+	}
+	if validation.Write(w, r, codeInvalidRequest, err) {
 		return
 	}
-	http.Error(w, err.Error(), http.StatusBadRequest)
+	problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
 }
 
-func headerAllow(w http.ResponseWriter, methods ...string) {
-	w.Header().Set("Allow", strings.Join(methods, ", "))
-	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "ugc", methods...)
 }
@@ -0,0 +1,390 @@
+package ugc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // GIF and JPEG register with image.Decode
+	_ "image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// ErrNoData is returned when content has no uploaded bytes, or no
+// thumbnail, to read.
+var ErrNoData = errors.New("ugc: content has no uploaded data")
+
+// ErrTooLarge is returned when an upload exceeds MediaConfig.MaxBytes.
+var ErrTooLarge = errors.New("ugc: upload too large")
+
+// ErrNotPending is returned when data is uploaded for content that has
+// already been reviewed.
+var ErrNotPending = errors.New("ugc: content is no longer pending")
+
+// MediaStatus is how far processing of uploaded data has got.
+type MediaStatus string
+
+const (
+	MediaPending   MediaStatus = "pending"
+	MediaProcessed MediaStatus = "processed"
+	MediaFailed    MediaStatus = "failed"
+)
+
+// Media describes the bytes uploaded for a content item, as the processor
+// found them.
+type Media struct {
+	Status    MediaStatus `json:"status"`
+	SizeBytes uint64      `json:"size_bytes"`
+	// DetectedType is the MIME type sniffed from the bytes, which may
+	// differ from the one the submission declared.
+	DetectedType string `json:"detected_type,omitempty"`
+	Width        int    `json:"width,omitempty"`
+	Height       int    `json:"height,omitempty"`
+	Thumbnail    bool   `json:"thumbnail,omitempty"`
+	// Error says why processing failed.
+	Error       string    `json:"error,omitempty"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	ProcessedAt time.Time `json:"processed_at,omitzero"`
+}
+
+// MediaStore persists uploaded bytes and thumbnails.
+type MediaStore interface {
+	// PutData stores data for content id, replacing any earlier upload
+	// and its thumbnail, and records media on the content as updated at
+	// media.UploadedAt.
+	PutData(ctx context.Context, id string, data []byte, media Media) (Content, error)
+	Data(ctx context.Context, id string) ([]byte, error)
+	Thumbnail(ctx context.Context, id string) ([]byte, error)
+	// PutMedia records the result of processing the upload made at
+	// media.UploadedAt, with its thumbnail if any, as updated at
+	// media.ProcessedAt, and reports false without storing it when a later
+	// upload replaced that one.
+	PutMedia(ctx context.Context, id string, media Media, thumbnail []byte) (Content, bool, error)
+	// PendingMedia returns the IDs of content whose upload is stored here
+	// and awaits processing.
+	PendingMedia(ctx context.Context) ([]string, error)
+}
+
+// MediaConfig tunes upload processing.
+type MediaConfig struct {
+	// Workers process uploads concurrently.
+	Workers int
+	// Queue bounds the uploads waiting for a worker. Uploads that find it
+	// full wait for the next sweep.
+	Queue int
+	// MaxBytes bounds an upload.
+	MaxBytes int64
+	// ThumbnailSize bounds a thumbnail's longer side, in pixels.
+	ThumbnailSize int
+	// SweepInterval is how often uploads still pending, such as those made
+	// before a restart, are queued again.
+	SweepInterval time.Duration
+}
+
+// maxImagePixels bounds the images decoded for thumbnails.
+const maxImagePixels = 64 << 20
+
+// MediaFromConfig reads MEDIA_WORKERS (default 2), MEDIA_QUEUE (default
+// 64), MEDIA_MAX_BYTES (default 8 MiB), MEDIA_THUMBNAIL_SIZE (default 256),
+// and MEDIA_SWEEP_INTERVAL (default 1m).
+func MediaFromConfig(loader config.Loader) (MediaConfig, error) {
+	cfg := MediaConfig{
+		Workers:       loader.Int("MEDIA_WORKERS", 2),
+		Queue:         loader.Int("MEDIA_QUEUE", 64),
+		MaxBytes:      int64(loader.Int("MEDIA_MAX_BYTES", 8<<20)),
+		ThumbnailSize: loader.Int("MEDIA_THUMBNAIL_SIZE", 256),
+		SweepInterval: loader.Duration("MEDIA_SWEEP_INTERVAL", time.Minute),
+	}
+	if cfg.Workers <= 0 || cfg.Queue <= 0 || cfg.MaxBytes <= 0 || cfg.ThumbnailSize <= 0 || cfg.SweepInterval <= 0 {
+		return MediaConfig{}, fmt.Errorf("%sMEDIA_WORKERS, %sMEDIA_QUEUE, %sMEDIA_MAX_BYTES, %sMEDIA_THUMBNAIL_SIZE, and %sMEDIA_SWEEP_INTERVAL must be positive",
+			loader.Prefix, loader.Prefix, loader.Prefix, loader.Prefix, loader.Prefix)
+	}
+	return cfg, nil
+}
+
+// SetMedia accepts uploads at /content/{id}/data, kept in store, and
+// processes them when RunMedia runs: the processor sniffs each upload's
+// MIME type, reads image dimensions, stores a PNG thumbnail, and rejects
+// content whose declared type the bytes contradict. Without it those
+// routes answer 404. Zero fields of cfg take MediaFromConfig's defaults.
+// Call it before the service handles requests.
+func (s *Service) SetMedia(store MediaStore, cfg MediaConfig, logger logging.Printer) {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 2
+	}
+	if cfg.Queue <= 0 {
+		cfg.Queue = 64
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 8 << 20
+	}
+	if cfg.ThumbnailSize <= 0 {
+		cfg.ThumbnailSize = 256
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = time.Minute
+	}
+	s.media = store
+	s.mediaConfig = cfg
+	s.mediaQueue = make(chan string, cfg.Queue)
+	s.logger = logger
+}
+
+// UploadData stores data as content id's bytes and queues it for
+// processing. Only pending content accepts uploads.
+func (s *Service) UploadData(ctx context.Context, id string, data []byte) (Content, error) {
+	if s.media == nil {
+		return Content{}, ErrNoData
+	}
+	if int64(len(data)) > s.mediaConfig.MaxBytes {
+		return Content{}, ErrTooLarge
+	}
+	var v validation.Validator
+	v.ID("content_id", id)
+	v.Check(len(data) > 0, "data", validation.RuleRequired, "is required")
+	if err := v.Err(); err != nil {
+		return Content{}, err
+	}
+	existing, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Content{}, err
+	}
+	if existing.State != StatePending {
+		return Content{}, ErrNotPending
+	}
+	content, err := s.media.PutData(ctx, id, data, Media{
+		Status:     MediaPending,
+		SizeBytes:  uint64(len(data)),
+		UploadedAt: s.clock.Now(),
+	})
+	if err != nil {
+		return Content{}, err
+	}
+	s.replica.Record(ctx, ReplicateContent, content.ContentID, content.UpdatedAt, content)
+	s.enqueueMedia(id)
+	return content, nil
+}
+
+// Data returns content id's uploaded bytes.
+func (s *Service) Data(ctx context.Context, id string) ([]byte, error) {
+	if s.media == nil {
+		return nil, ErrNoData
+	}
+	return s.media.Data(ctx, id)
+}
+
+// Thumbnail returns content id's PNG thumbnail.
+func (s *Service) Thumbnail(ctx context.Context, id string) ([]byte, error) {
+	if s.media == nil {
+		return nil, ErrNoData
+	}
+	return s.media.Thumbnail(ctx, id)
+}
+
+// RunMedia processes uploads with MediaConfig.Workers workers, and queues
+// those still pending every SweepInterval, until ctx is cancelled. It
+// returns at once without SetMedia.
+func (s *Service) RunMedia(ctx context.Context) error {
+	if s.media == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	for range s.mediaConfig.Workers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-s.mediaQueue:
+					if err := s.ProcessMedia(ctx, id); err != nil && ctx.Err() == nil {
+						s.logger.Printf("process upload for content %s: %v", id, err)
+					}
+				}
+			}
+		}()
+	}
+	ticker := s.clock.NewTicker(s.mediaConfig.SweepInterval)
+	defer ticker.Stop()
+	for {
+		s.sweepMedia(ctx)
+		select {
+		case <-ctx.Done():
+			for range s.mediaConfig.Workers {
+				<-done
+			}
+			return nil
+		case <-ticker.C():
+		}
+	}
+}
+
+// ProcessMedia processes content id's upload now, unless it has been
+// processed already. RunMedia's workers call it for each queued upload.
+func (s *Service) ProcessMedia(ctx context.Context, id string) error {
+	content, err := s.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if content.Media == nil || content.Media.Status != MediaPending {
+		return nil
+	}
+	data, err := s.media.Data(ctx, id)
+	if err != nil {
+		return err
+	}
+	media, thumbnail := analyze(data, s.mediaConfig.ThumbnailSize)
+	media.SizeBytes = content.Media.SizeBytes
+	media.UploadedAt = content.Media.UploadedAt
+	media.ProcessedAt = s.clock.Now()
+	updated, stored, err := s.media.PutMedia(ctx, id, media, thumbnail)
+	if err != nil || !stored {
+		return err
+	}
+	s.replica.Record(ctx, ReplicateContent, updated.ContentID, updated.UpdatedAt, updated)
+	declared := baseType(updated.MimeType)
+	if media.Status != MediaProcessed || updated.State != StatePending || typesAgree(declared, media.DetectedType) {
+		return nil
+	}
+	_, err = s.ReviewContent(ctx, ReviewRequest{
+		ContentID: id,
+		State:     StateRejected,
+		Reason:    fmt.Sprintf("declared type %s does not match detected type %s", declared, media.DetectedType),
+	})
+	return err
+}
+
+// enqueueMedia queues id for a worker unless the queue is full, in which
+// case the next sweep finds it.
+func (s *Service) enqueueMedia(id string) {
+	select {
+	case s.mediaQueue <- id:
+	default:
+	}
+}
+
+func (s *Service) sweepMedia(ctx context.Context) {
+	ids, err := s.media.PendingMedia(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Printf("list pending uploads: %v", err)
+		}
+		return
+	}
+	for _, id := range ids {
+		s.enqueueMedia(id)
+	}
+}
+
+// analyze sniffs data's MIME type and, for images the standard library
+// decodes, reads their dimensions and renders a PNG thumbnail whose longer
+// side is at most size pixels.
+func analyze(data []byte, size int) (Media, []byte) {
+	media := Media{Status: MediaProcessed, DetectedType: baseType(http.DetectContentType(data))}
+	switch media.DetectedType {
+	case "image/png", "image/jpeg", "image/gif":
+	default:
+		return media, nil
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		media.Status, media.Error = MediaFailed, "read image: "+err.Error()
+		return media, nil
+	}
+	media.Width, media.Height = cfg.Width, cfg.Height
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return media, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		media.Status, media.Error = MediaFailed, "decode image: "+err.Error()
+		return media, nil
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, thumbnail(img, size)); err != nil {
+		media.Status, media.Error = MediaFailed, "encode thumbnail: "+err.Error()
+		return media, nil
+	}
+	media.Thumbnail = true
+	return media, out.Bytes()
+}
+
+// thumbnail scales src to fit within size×size, averaging the source
+// pixels each thumbnail pixel covers. Images already small enough keep
+// their size.
+func thumbnail(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, tw, th))
+	for y := range th {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := range tw {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// typeAliases maps common nonstandard MIME types to the ones the sniffer
+// reports.
+var typeAliases = map[string]string{
+	"image/jpg":   "image/jpeg",
+	"image/pjpeg": "image/jpeg",
+	"image/x-png": "image/png",
+}
+
+// baseType returns t without parameters, lowercased, with aliases
+// resolved.
+func baseType(t string) string {
+	base, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		base, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(t)), ";")
+	}
+	if alias, ok := typeAliases[base]; ok {
+		return alias
+	}
+	return base
+}
+
+// typesAgree reports whether bytes sniffed as detected may be of the
+// declared type. The sniffer cannot tell binary formats it does not know
+// from one another, nor text formats apart, so those only contradict a
+// declared image, audio, video, or font type.
+func typesAgree(declared, detected string) bool {
+	switch {
+	case declared == "" || declared == detected:
+		return true
+	case detected == "application/octet-stream":
+		return true
+	case detected == "text/plain":
+		family, _, _ := strings.Cut(declared, "/")
+		return family != "image" && family != "audio" && family != "video" && family != "font"
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package ugc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+)
+
+// newTestService returns a service on a memory store and a fake clock,
+// accepting uploads.
+func newTestService(t *testing.T) (*Service, *clock.Fake) {
+	t.Helper()
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	svc := NewService(store, clk)
+	svc.SetMedia(store, MediaConfig{}, logging.New("test"))
+	return svc, clk
+}
+
+func TestUploadedImagesAreProcessed(t *testing.T) {
+	svc, _ := newTestService(t)
+	ctx := context.Background()
+	img := image.NewNRGBA(image.Rect(0, 0, 600, 300))
+	for y := range 300 {
+		for x := range 600 {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	for _, req := range []SubmitRequest{
+		{ContentID: "c-png", TenantID: "acme", ProjectID: "p1", Filename: "map.png", MimeType: "image/png"},
+		{ContentID: "c-fake", TenantID: "acme", ProjectID: "p1", Filename: "map.jpg", MimeType: "image/jpeg"},
+	} {
+		if _, err := svc.SubmitContent(ctx, req); err != nil {
+			t.Fatalf("submit %s: %v", req.ContentID, err)
+		}
+		uploaded, err := svc.UploadData(ctx, req.ContentID, encoded.Bytes())
+		if err != nil || uploaded.Media == nil || uploaded.Media.Status != MediaPending {
+			t.Fatalf("upload %s: %+v %v", req.ContentID, uploaded.Media, err)
+		}
+		if err := svc.ProcessMedia(ctx, req.ContentID); err != nil {
+			t.Fatalf("process %s: %v", req.ContentID, err)
+		}
+	}
+
+	processed, err := svc.GetContent(ctx, "c-png")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if m := processed.Media; m == nil || m.Status != MediaProcessed || m.DetectedType != "image/png" ||
+		m.Width != 600 || m.Height != 300 || !m.Thumbnail || processed.State != StatePending {
+		t.Fatalf("unexpected media %+v in state %s", m, processed.State)
+	}
+	thumb, err := svc.Thumbnail(ctx, "c-png")
+	if err != nil {
+		t.Fatalf("thumbnail: %v", err)
+	}
+	if cfg, err := png.DecodeConfig(bytes.NewReader(thumb)); err != nil || cfg.Width != 256 || cfg.Height != 128 {
+		t.Fatalf("expected a 256x128 thumbnail, got %+v %v", cfg, err)
+	}
+	if data, err := svc.Data(ctx, "c-png"); err != nil || !bytes.Equal(data, encoded.Bytes()) {
+		t.Fatalf("expected the uploaded bytes back, got %d bytes %v", len(data), err)
+	}
+
+	fake, err := svc.GetContent(ctx, "c-fake")
+	if err != nil || fake.State != StateRejected || !strings.Contains(fake.Reason, "image/png") {
+		t.Fatalf("expected the mislabelled upload rejected, got %+v %v", fake, err)
+	}
+	if _, err := svc.UploadData(ctx, "c-fake", []byte("again")); !errors.Is(err, ErrNotPending) {
+		t.Fatalf("expected ErrNotPending, got %v", err)
+	}
+	if _, err := svc.Thumbnail(ctx, "missing"); !errors.Is(err, ErrNoData) {
+		t.Fatalf("expected ErrNoData, got %v", err)
+	}
+}
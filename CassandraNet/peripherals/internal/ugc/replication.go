@@ -0,0 +1,23 @@
+package ugc
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+)
+
+// ReplicateContent is the mutation kind the UGC service replicates: the
+// whole content record after a submission or review.
+const ReplicateContent = "ugc.content.put"
+
+// applyContent stores a content record changed in the peer region unless
+// this region changed it later; see replication.Mutation.Supersedes.
+// Reviews applied this way are not audited, metered, or announced again.
+func (s *Service) applyContent(ctx context.Context, m replication.Mutation) (bool, error) {
+	var content Content
+	if err := json.Unmarshal(m.Data, &content); err != nil {
+		return false, err
+	}
+	return s.store.Merge(ctx, content, m.Supersedes)
+}
@@ -4,45 +4,124 @@ import (
 	"context"
 	"errors"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/clock"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metering"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/replication"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
 // ErrContentNotFound indicates the content does not exist.
 var ErrContentNotFound = errors.New("ugc: content not found")
 
+// ErrStore wraps failures of the underlying storage driver.
+var ErrStore = errors.New("ugc: store unavailable")
+
+// Length limits of submission and review fields, in characters.
+const (
+	maxFilenameLength = 255
+	maxMimeTypeLength = 127
+	maxReasonLength   = 1024
+)
+
 // Store abstracts persistence for UGC submissions.
 type Store interface {
 	Create(ctx context.Context, content Content) (Content, error)
+	Get(ctx context.Context, id string) (Content, error)
 	UpdateState(ctx context.Context, id string, state State, reason string, updatedAt time.Time) (Content, error)
-	List(ctx context.Context, filter ListFilter) ([]Content, error)
-}
-
-// Clock allows deterministic timing in tests.
-type Clock interface {
-	Now() time.Time
+	// List returns one page of matching content in ID order and the
+	// position of the next page, empty on the last.
+	List(ctx context.Context, filter ListFilter, page pagination.Request) ([]Content, string, error)
+	// PurgeArchived removes the archived content last updated before
+	// cutoff, or with dryRun counts it, and returns how many records.
+	PurgeArchived(ctx context.Context, cutoff time.Time, dryRun bool) (int, error)
+	// Merge stores content unless supersedes rejects the update time of
+	// the record already stored under its ID, and reports whether it
+	// stored it.
+	Merge(ctx context.Context, content Content, supersedes func(updatedAt time.Time) bool) (bool, error)
 }
 
-type systemClock struct{}
+// RetentionPolicy names the policy RegisterRetention registers.
+const RetentionPolicy = "ugc.archived"
 
-func (systemClock) Now() time.Time { return time.Now().UTC() }
+// DefaultArchiveRetention is how long archived content records are kept
+// unless RETENTION_MAX_AGES says otherwise.
+const DefaultArchiveRetention = 90 * 24 * time.Hour
 
 // Service orchestrates moderation actions.
 type Service struct {
-	store Store
-	clock Clock
+	store   Store
+	clock   clock.Clock
+	events  eventbus.Publisher
+	audit   *audit.Log
+	meter   *metering.Meter
+	replica *replication.Replicator
+
+	media       MediaStore
+	mediaConfig MediaConfig
+	mediaQueue  chan string
+	logger      logging.Printer
 }
 
 // NewService builds a Service with the provided store.
-func NewService(store Store, clock Clock) *Service {
-	if clock == nil {
-		clock = systemClock{}
-	}
-	return &Service{store: store, clock: clock}
+func NewService(store Store, clk clock.Clock) *Service {
+	return &Service{store: store, clock: clock.Or(clk)}
+}
+
+// SetEvents publishes an eventbus.ContentReviewed to p after each review.
+// Call it before the service handles requests.
+func (s *Service) SetEvents(p eventbus.Publisher) {
+	s.events = p
+}
+
+// SetAudit records each review in log. Call it before the service handles
+// requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// RegisterRetention registers RetentionPolicy with m, purging content
+// records that have stayed archived for longer than the policy's age.
+func (s *Service) RegisterRetention(m *retention.Manager) {
+	m.Register(retention.Policy{
+		Name:        RetentionPolicy,
+		Description: "content records archived before the cutoff",
+		MaxAge:      DefaultArchiveRetention,
+		Purge:       s.store.PurgeArchived,
+	})
+}
+
+// SetMeter counts each review as metering.UGCModerated for the content's
+// tenant. Call it before the service handles requests.
+func (s *Service) SetMeter(m *metering.Meter) {
+	s.meter = m
+}
+
+// SetReplicator records each submission and review with r, and applies
+// those the peer region records. Call it before the service handles
+// requests.
+func (s *Service) SetReplicator(r *replication.Replicator) {
+	s.replica = r
+	r.Register(ReplicateContent, s.applyContent)
 }
 
 // SubmitContent stores a new submission and returns its metadata.
 func (s *Service) SubmitContent(ctx context.Context, req SubmitRequest) (Content, error) {
-	if req.ContentID == "" || req.TenantID == "" || req.ProjectID == "" || req.Filename == "" {
-		return Content{}, errors.New("content_id, tenant_id, project_id, and filename required")
+	var v validation.Validator
+	v.ID("content_id", req.ContentID)
+	v.ID("tenant_id", req.TenantID)
+	v.ID("project_id", req.ProjectID)
+	v.String("filename", req.Filename).Required().MaxLength(maxFilenameLength)
+	v.String("mime_type", req.MimeType).MaxLength(maxMimeTypeLength)
+	v.Map("labels", req.Labels).Limited()
+	v.Map("attributes", req.Attributes).Limited()
+	if err := v.Err(); err != nil {
+		return Content{}, err
 	}
 	content := Content{
 		ContentID:  req.ContentID,
@@ -62,31 +141,65 @@ func (s *Service) SubmitContent(ctx context.Context, req SubmitRequest) (Content
 	if err != nil {
 		return Content{}, err
 	}
+	s.replica.Record(ctx, ReplicateContent, created.ContentID, created.UpdatedAt, created)
 	return created, nil
 }
 
 // ReviewContent updates the moderation state for an item.
 func (s *Service) ReviewContent(ctx context.Context, req ReviewRequest) (Content, error) {
-	if req.ContentID == "" {
-		return Content{}, errors.New("content_id required")
+	var v validation.Validator
+	v.ID("content_id", req.ContentID)
+	v.String("state", string(req.State)).Required()
+	v.String("reason", req.Reason).MaxLength(maxReasonLength)
+	if err := v.Err(); err != nil {
+		return Content{}, err
 	}
-	if req.State == "" {
-		return Content{}, errors.New("state required")
+	var before Content
+	if s.audit != nil {
+		var err error
+		if before, err = s.store.Get(ctx, req.ContentID); err != nil {
+			return Content{}, err
+		}
 	}
 	updated, err := s.store.UpdateState(ctx, req.ContentID, req.State, req.Reason, s.clock.Now())
 	if err != nil {
 		return Content{}, err
 	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "ugc.content.review",
+		Resource:  "content/" + updated.ContentID,
+		TenantID:  updated.TenantID,
+		ProjectID: updated.ProjectID,
+		Before:    before,
+		After:     updated,
+	})
+	s.meter.Record(ctx, updated.TenantID, metering.UGCModerated, 1)
+	s.replica.Record(ctx, ReplicateContent, updated.ContentID, updated.UpdatedAt, updated)
+	if s.events != nil {
+		s.events.Publish(ctx, eventbus.ContentReviewed{
+			ContentID:  updated.ContentID,
+			TenantID:   updated.TenantID,
+			ProjectID:  updated.ProjectID,
+			State:      string(updated.State),
+			Reason:     updated.Reason,
+			ReviewedAt: updated.UpdatedAt,
+		})
+	}
 	return updated, nil
 }
 
-// ListContent lists content records using provided filter.
-func (s *Service) ListContent(ctx context.Context, filter ListFilter) ([]Content, error) {
-	items, err := s.store.List(ctx, filter)
-	if err != nil {
-		return nil, err
+// GetContent returns a single content record.
+func (s *Service) GetContent(ctx context.Context, id string) (Content, error) {
+	if id == "" {
+		return Content{}, validation.Invalid("content_id", validation.RuleRequired, "is required")
 	}
-	return items, nil
+	return s.store.Get(ctx, id)
+}
+
+// ListContent lists one page of content records matching filter, and the
+// position of the next page.
+func (s *Service) ListContent(ctx context.Context, filter ListFilter, page pagination.Request) ([]Content, string, error) {
+	return s.store.List(ctx, filter, page)
 }
 
 func cloneMap(in map[string]string) map[string]string {
@@ -0,0 +1,251 @@
+package ugc
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+const contentStatsPath = "/content/stats"
+
+// reviewAction is the audit action ReviewContent records.
+const reviewAction = "ugc.content.review"
+
+// dayLayout is the format of the days bounding a stats range.
+const dayLayout = "2006-01-02"
+
+// defaultStatsDays is how many days, ending today, a stats range covers
+// when the request names none.
+const defaultStatsDays = 7
+
+// StatsFilter selects the content and reviews ModerationStats counts.
+// From and To are UTC days; the range covers both in full.
+type StatsFilter struct {
+	TenantID  string
+	ProjectID string
+	From      time.Time
+	To        time.Time
+}
+
+// ModerationStats reports moderation activity over a range of days.
+type ModerationStats struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Total   TenantStats   `json:"total"`
+	Tenants []TenantStats `json:"tenants"`
+}
+
+// TenantStats counts one tenant's moderation activity, or every tenant's
+// in ModerationStats.Total. Submitted and States count the content
+// submitted in the range by its current state. Approved and Rejected
+// count the decisions made in the range, whenever the content was
+// submitted, and the rates are their shares of those decisions.
+// AverageReviewSeconds is the mean time from submission to the first
+// decision for content decided in the range.
+type TenantStats struct {
+	TenantID             string        `json:"tenant_id,omitempty"`
+	Submitted            int           `json:"submitted"`
+	States               map[State]int `json:"states"`
+	Approved             int           `json:"approved"`
+	Rejected             int           `json:"rejected"`
+	ApprovalRate         float64       `json:"approval_rate"`
+	RejectionRate        float64       `json:"rejection_rate"`
+	AverageReviewSeconds float64       `json:"average_review_seconds"`
+
+	reviewed    int
+	reviewTotal time.Duration
+}
+
+// ModerationStats counts the content submitted and the review decisions
+// made between filter's days. Decisions and review times come from the
+// audit log set with SetAudit; without one only submissions are counted.
+func (s *Service) ModerationStats(ctx context.Context, filter StatsFilter) (ModerationStats, error) {
+	start := filter.From.UTC().Truncate(24 * time.Hour)
+	end := filter.To.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+	if !start.Before(end) {
+		return ModerationStats{}, validation.Invalid("from", validation.RuleRange, "must not be after to")
+	}
+	inRange := func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+
+	tenants := make(map[string]*TenantStats)
+	tenant := func(id string) *TenantStats {
+		stats, ok := tenants[id]
+		if !ok {
+			stats = newTenantStats(id)
+			tenants[id] = stats
+		}
+		return stats
+	}
+	page := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		items, next, err := s.store.List(ctx, ListFilter{TenantID: filter.TenantID, ProjectID: filter.ProjectID}, page)
+		if err != nil {
+			return ModerationStats{}, err
+		}
+		for _, content := range items {
+			if inRange(content.SubmittedAt) {
+				stats := tenant(content.TenantID)
+				stats.Submitted++
+				stats.States[content.State]++
+			}
+		}
+		if next == "" {
+			break
+		}
+		page.After = next
+	}
+	if err := s.countReviews(ctx, filter, inRange, tenant); err != nil {
+		return ModerationStats{}, err
+	}
+
+	report := ModerationStats{
+		From:    start.Format(dayLayout),
+		To:      end.Add(-24 * time.Hour).Format(dayLayout),
+		Total:   *newTenantStats(""),
+		Tenants: make([]TenantStats, 0, len(tenants)),
+	}
+	for _, id := range slices.Sorted(maps.Keys(tenants)) {
+		stats := tenants[id]
+		report.Total.add(stats)
+		stats.finish()
+		report.Tenants = append(report.Tenants, *stats)
+	}
+	report.Total.finish()
+	return report, nil
+}
+
+// countReviews adds the approvals and rejections recorded in the audit
+// log within the range. Entries whose states are sealed under a key this
+// service lacks are skipped.
+func (s *Service) countReviews(ctx context.Context, filter StatsFilter, inRange func(time.Time) bool, tenant func(string) *TenantStats) error {
+	if s.audit == nil {
+		return nil
+	}
+	page := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		entries, next, err := s.audit.List(ctx, audit.Filter{Action: reviewAction, TenantID: filter.TenantID}, page)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if filter.ProjectID != "" && entry.ProjectID != filter.ProjectID {
+				continue
+			}
+			var before, after Content
+			if entry.Sealed || json.Unmarshal(entry.Before, &before) != nil || json.Unmarshal(entry.After, &after) != nil {
+				continue
+			}
+			if !inRange(after.UpdatedAt) {
+				continue
+			}
+			stats := tenant(after.TenantID)
+			switch after.State {
+			case StateApproved:
+				stats.Approved++
+			case StateRejected:
+				stats.Rejected++
+			default:
+				continue
+			}
+			if before.State == StatePending {
+				stats.reviewed++
+				stats.reviewTotal += after.UpdatedAt.Sub(before.SubmittedAt)
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		page.After = next
+	}
+}
+
+func newTenantStats(id string) *TenantStats {
+	return &TenantStats{
+		TenantID: id,
+		States:   map[State]int{StatePending: 0, StateApproved: 0, StateRejected: 0, StateArchived: 0},
+	}
+}
+
+// add accumulates o's counts into t.
+func (t *TenantStats) add(o *TenantStats) {
+	t.Submitted += o.Submitted
+	for state, n := range o.States {
+		t.States[state] += n
+	}
+	t.Approved += o.Approved
+	t.Rejected += o.Rejected
+	t.reviewed += o.reviewed
+	t.reviewTotal += o.reviewTotal
+}
+
+// finish derives the rates and the average review time from the counts.
+func (t *TenantStats) finish() {
+	if decided := t.Approved + t.Rejected; decided > 0 {
+		t.ApprovalRate = float64(t.Approved) / float64(decided)
+		t.RejectionRate = float64(t.Rejected) / float64(decided)
+	}
+	if t.reviewed > 0 {
+		t.AverageReviewSeconds = (t.reviewTotal / time.Duration(t.reviewed)).Seconds()
+	}
+}
+
+// handleStats serves GET /content/stats for the tenant and project in
+// tenant_id and project_id, over the days from and to (default the last
+// seven days).
+func (s *Service) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	query := r.URL.Query()
+	tenant, ok := auth.ResolveTenant(r.Context(), query.Get("tenant_id"))
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+query.Get("tenant_id"))
+		return
+	}
+	project, ok := auth.ResolveProject(r.Context(), query.Get("project_id"))
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+query.Get("project_id"))
+		return
+	}
+	if !auth.Allow(w, r, auth.PermUGCRead, tenant, project) {
+		return
+	}
+	today := s.clock.Now().UTC()
+	filter := StatsFilter{TenantID: tenant, ProjectID: project, From: today.AddDate(0, 0, 1-defaultStatsDays), To: today}
+	var v validation.Validator
+	parseDay(&v, "from", query.Get("from"), &filter.From)
+	parseDay(&v, "to", query.Get("to"), &filter.To)
+	if err := v.Err(); err != nil {
+		httpError(w, r, err)
+		return
+	}
+	report, err := s.ModerationStats(r.Context(), filter)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// parseDay replaces *day with raw when raw is present and a valid day.
+func parseDay(v *validation.Validator, field, raw string, day *time.Time) {
+	if raw == "" {
+		return
+	}
+	parsed, err := time.Parse(dayLayout, raw)
+	if err != nil {
+		v.Check(false, field, validation.RuleFormat, "must be a date like 2006-01-02")
+		return
+	}
+	*day = parsed
+}
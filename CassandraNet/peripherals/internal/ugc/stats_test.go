@@ -0,0 +1,75 @@
+package ugc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+func TestModerationStatsCountReviews(t *testing.T) {
+	svc, clk := newTestService(t)
+	svc.SetAudit(audit.New(storage.NewMemory(), "ugc", logging.New("test")))
+	ctx := context.Background()
+	for _, req := range []SubmitRequest{
+		{ContentID: "c-1", TenantID: "acme", ProjectID: "p1", Filename: "a.txt"},
+		{ContentID: "c-2", TenantID: "acme", ProjectID: "p1", Filename: "b.txt"},
+		{ContentID: "c-3", TenantID: "acme", ProjectID: "p2", Filename: "c.txt"},
+		{ContentID: "c-4", TenantID: "globex", ProjectID: "p1", Filename: "d.txt"},
+	} {
+		if _, err := svc.SubmitContent(ctx, req); err != nil {
+			t.Fatalf("submit %s: %v", req.ContentID, err)
+		}
+	}
+	review := func(id string, state State) {
+		t.Helper()
+		if _, err := svc.ReviewContent(ctx, ReviewRequest{ContentID: id, State: state}); err != nil {
+			t.Fatalf("review %s: %v", id, err)
+		}
+	}
+	clk.Advance(time.Hour)
+	review("c-1", StateApproved)
+	review("c-2", StateRejected)
+	review("c-4", StateApproved)
+	// A later decision on reviewed content counts, but not towards review time.
+	clk.Advance(time.Hour)
+	review("c-2", StateApproved)
+
+	today := clk.Now()
+	stats, err := svc.ModerationStats(ctx, StatsFilter{From: today, To: today})
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.From != "2026-01-01" || stats.To != "2026-01-01" || len(stats.Tenants) != 2 ||
+		stats.Tenants[0].TenantID != "acme" || stats.Tenants[1].TenantID != "globex" {
+		t.Fatalf("expected both tenants on the day, got %+v", stats)
+	}
+	acme := stats.Tenants[0]
+	if acme.Submitted != 3 || acme.States[StatePending] != 1 || acme.States[StateApproved] != 2 || acme.States[StateRejected] != 0 {
+		t.Fatalf("unexpected acme states %+v", acme)
+	}
+	if acme.Approved != 2 || acme.Rejected != 1 || acme.ApprovalRate < 0.66 || acme.ApprovalRate > 0.67 || acme.AverageReviewSeconds != 3600 {
+		t.Fatalf("unexpected acme decisions %+v", acme)
+	}
+	if stats.Total.Submitted != 4 || stats.Total.Approved != 3 || stats.Total.Rejected != 1 || stats.Total.RejectionRate != 0.25 {
+		t.Fatalf("unexpected total %+v", stats.Total)
+	}
+
+	project, err := svc.ModerationStats(ctx, StatsFilter{TenantID: "acme", ProjectID: "p2", From: today, To: today})
+	if err != nil || len(project.Tenants) != 1 || project.Total.Submitted != 1 || project.Total.Approved != 0 {
+		t.Fatalf("expected only acme's p2 content, got %+v %v", project, err)
+	}
+	earlier, err := svc.ModerationStats(ctx, StatsFilter{From: today.AddDate(0, 0, -7), To: today.AddDate(0, 0, -1)})
+	if err != nil || len(earlier.Tenants) != 0 || earlier.Total.Submitted != 0 || earlier.Total.Approved != 0 {
+		t.Fatalf("expected nothing in the week before, got %+v %v", earlier, err)
+	}
+	var invalid validation.Errors
+	if _, err := svc.ModerationStats(ctx, StatsFilter{From: today, To: today.AddDate(0, 0, -1)}); !errors.As(err, &invalid) {
+		t.Fatalf("expected a reversed range refused, got %v", err)
+	}
+}
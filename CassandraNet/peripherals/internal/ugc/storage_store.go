@@ -0,0 +1,389 @@
+package ugc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/retention"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// contentBucket holds content records as JSON keyed by content ID.
+const contentBucket = "ugc.content"
+
+// dataBucket and thumbnailBucket hold uploaded bytes and PNG thumbnails
+// keyed by content ID.
+const (
+	dataBucket      = "ugc.data"
+	thumbnailBucket = "ugc.thumbnails"
+)
+
+// ResealName names the records SetKeyring registers for rotation.
+const ResealName = "ugc.content"
+
+// storedContent is a content record as stored. SealedAttributes holds the
+// attributes in place of Attributes when the store has a keyring.
+type storedContent struct {
+	Content
+	SealedAttributes []byte `json:"sealed_attributes,omitempty"`
+}
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db   storage.Driver
+	keys *encryption.Keyring
+}
+
+// NewStorageStore returns a store keeping content in db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// SetKeyring seals content attributes with k before storing them and
+// registers the stored content with k for rotation. Records stored before
+// are read as they are and sealed by the next rotation. Call it before the
+// store is used.
+func (s *StorageStore) SetKeyring(k *encryption.Keyring) {
+	s.keys = k
+	k.Register(encryption.Resealer{Name: ResealName, Reseal: s.reseal})
+}
+
+// Create inserts a new content record.
+func (s *StorageStore) Create(ctx context.Context, content Content) (Content, error) {
+	data, err := s.encode(ctx, content)
+	if err != nil {
+		return Content{}, err
+	}
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Put(contentBucket, content.ContentID, data)
+	})
+	if err != nil {
+		return Content{}, storeError(err)
+	}
+	var stored storedContent
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Content{}, err
+	}
+	return s.open(ctx, stored)
+}
+
+// Get returns the content record with id.
+func (s *StorageStore) Get(ctx context.Context, id string) (Content, error) {
+	var stored storedContent
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		stored, err = getContent(tx, id)
+		return err
+	})
+	if err != nil {
+		return Content{}, storeError(err)
+	}
+	return s.open(ctx, stored)
+}
+
+// UpdateState updates the moderation state for content.
+func (s *StorageStore) UpdateState(ctx context.Context, id string, state State, reason string, updatedAt time.Time) (Content, error) {
+	var stored storedContent
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if stored, err = getContent(tx, id); err != nil {
+			return err
+		}
+		stored.State = state
+		stored.Reason = reason
+		stored.UpdatedAt = updatedAt
+		return putContent(tx, stored)
+	})
+	if err != nil {
+		return Content{}, storeError(err)
+	}
+	return s.open(ctx, stored)
+}
+
+// Merge stores content unless the record with its ID has an update time
+// supersedes rejects.
+func (s *StorageStore) Merge(ctx context.Context, content Content, supersedes func(updatedAt time.Time) bool) (bool, error) {
+	data, err := s.encode(ctx, content)
+	if err != nil {
+		return false, err
+	}
+	stored := false
+	err = storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		current, err := getContent(tx, content.ContentID)
+		switch {
+		case errors.Is(err, ErrContentNotFound):
+		case err != nil:
+			return err
+		case !supersedes(current.UpdatedAt):
+			return nil
+		}
+		stored = true
+		return tx.Put(contentBucket, content.ContentID, data)
+	})
+	return stored, storeError(err)
+}
+
+// List returns one page of content records matching filter options,
+// ordered by ID.
+func (s *StorageStore) List(ctx context.Context, filter ListFilter, page pagination.Request) ([]Content, string, error) {
+	collector := pagination.NewCollector[Content](page)
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(contentBucket, "", func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			var stored storedContent
+			if err := json.Unmarshal(value, &stored); err != nil {
+				return err
+			}
+			if filter.TenantID != "" && stored.TenantID != filter.TenantID {
+				return nil
+			}
+			if filter.ProjectID != "" && stored.ProjectID != filter.ProjectID {
+				return nil
+			}
+			if filter.State != "" && stored.State != filter.State {
+				return nil
+			}
+			content, err := s.open(ctx, stored)
+			if err != nil {
+				return err
+			}
+			if !collector.Add(key, content) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	items, next := collector.Page()
+	return items, next, nil
+}
+
+// PurgeArchived removes the archived content last updated before cutoff,
+// with its uploaded bytes and thumbnail, and returns how many records it
+// removed; with dryRun it only counts them.
+func (s *StorageStore) PurgeArchived(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	removed, err := retention.PurgeBucket(ctx, s.db, contentBucket, dryRun, func(_ string, value []byte) (bool, error) {
+		content, err := decodeContent(value)
+		return err == nil && content.State == StateArchived && content.UpdatedAt.Before(cutoff), err
+	}, func(tx storage.Tx, key string, _ []byte) error {
+		if err := tx.Delete(dataBucket, key); err != nil {
+			return err
+		}
+		return tx.Delete(thumbnailBucket, key)
+	})
+	return removed, storeError(err)
+}
+
+// PutData stores data for content id and records media on it.
+func (s *StorageStore) PutData(ctx context.Context, id string, data []byte, media Media) (Content, error) {
+	var stored storedContent
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if stored, err = getContent(tx, id); err != nil {
+			return err
+		}
+		stored.Media = &media
+		stored.UpdatedAt = media.UploadedAt
+		if err := putContent(tx, stored); err != nil {
+			return err
+		}
+		if err := tx.Delete(thumbnailBucket, id); err != nil {
+			return err
+		}
+		return tx.Put(dataBucket, id, data)
+	})
+	if err != nil {
+		return Content{}, storeError(err)
+	}
+	return s.open(ctx, stored)
+}
+
+// Data returns the bytes uploaded for content id.
+func (s *StorageStore) Data(ctx context.Context, id string) ([]byte, error) {
+	return s.blob(ctx, dataBucket, id)
+}
+
+// Thumbnail returns the thumbnail of content id.
+func (s *StorageStore) Thumbnail(ctx context.Context, id string) ([]byte, error) {
+	return s.blob(ctx, thumbnailBucket, id)
+}
+
+// PutMedia records media on content id, with its thumbnail, unless the
+// stored upload is not the one media describes.
+func (s *StorageStore) PutMedia(ctx context.Context, id string, media Media, thumbnail []byte) (Content, bool, error) {
+	var stored storedContent
+	applied := false
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if stored, err = getContent(tx, id); err != nil {
+			return err
+		}
+		if stored.Media == nil || !stored.Media.UploadedAt.Equal(media.UploadedAt) {
+			return nil
+		}
+		applied = true
+		stored.Media = &media
+		stored.UpdatedAt = media.ProcessedAt
+		if err := putContent(tx, stored); err != nil {
+			return err
+		}
+		if thumbnail == nil {
+			return nil
+		}
+		return tx.Put(thumbnailBucket, id, thumbnail)
+	})
+	if err != nil {
+		return Content{}, false, storeError(err)
+	}
+	if !applied {
+		return Content{}, false, nil
+	}
+	content, err := s.open(ctx, stored)
+	return content, true, err
+}
+
+// PendingMedia returns, in ID order, the content whose upload is stored
+// here and awaits processing. Records replicated from a peer region may
+// describe uploads kept only there.
+func (s *StorageStore) PendingMedia(ctx context.Context) ([]string, error) {
+	var ids []string
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		return tx.Scan(contentBucket, "", func(key string, value []byte) error {
+			content, err := decodeContent(value)
+			if err != nil || content.Media == nil || content.Media.Status != MediaPending {
+				return err
+			}
+			if _, err := tx.Get(dataBucket, key); errors.Is(err, storage.ErrNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			ids = append(ids, key)
+			return nil
+		})
+	})
+	return ids, storeError(err)
+}
+
+func (s *StorageStore) blob(ctx context.Context, bucket, id string) ([]byte, error) {
+	var data []byte
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		value, err := tx.Get(bucket, id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrNoData
+		}
+		data = slices.Clone(value)
+		return err
+	})
+	return data, storeError(err)
+}
+
+// reseal re-seals the stored attributes not sealed under the active key.
+func (s *StorageStore) reseal(ctx context.Context) (int, int, error) {
+	resealed, skipped, err := encryption.ResealBucket(ctx, s.db, contentBucket, "", func(_ string, value []byte) ([]byte, error) {
+		var stored storedContent
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return nil, err
+		}
+		var plain []byte
+		if stored.SealedAttributes == nil {
+			var err error
+			if plain, err = json.Marshal(stored.Attributes); err != nil {
+				return nil, err
+			}
+		}
+		sealed, err := s.keys.Reseal(ctx, stored.SealedAttributes, plain)
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		stored.Attributes, stored.SealedAttributes = nil, sealed
+		return json.Marshal(stored)
+	})
+	return resealed, skipped, storeError(err)
+}
+
+// encode returns content as stored, its attributes sealed when the store
+// has a keyring.
+func (s *StorageStore) encode(ctx context.Context, content Content) ([]byte, error) {
+	stored := storedContent{Content: content}
+	if s.keys.Enabled() {
+		plain, err := json.Marshal(content.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		if stored.SealedAttributes, err = s.keys.Seal(ctx, plain); err != nil {
+			return nil, err
+		}
+		stored.Attributes = nil
+	}
+	return json.Marshal(stored)
+}
+
+// open returns a stored record with its attributes opened.
+func (s *StorageStore) open(ctx context.Context, stored storedContent) (Content, error) {
+	content := stored.Content
+	if stored.SealedAttributes != nil {
+		plain, err := s.keys.Open(ctx, stored.SealedAttributes)
+		if err != nil {
+			return Content{}, err
+		}
+		if err := json.Unmarshal(plain, &content.Attributes); err != nil {
+			return Content{}, err
+		}
+	}
+	return content, nil
+}
+
+// getContent returns the stored record with id, its attributes still
+// sealed.
+func getContent(tx storage.Tx, id string) (storedContent, error) {
+	data, err := tx.Get(contentBucket, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return storedContent{}, ErrContentNotFound
+	}
+	if err != nil {
+		return storedContent{}, err
+	}
+	var stored storedContent
+	err = json.Unmarshal(data, &stored)
+	return stored, err
+}
+
+// putContent stores a record as it was read, its attributes still sealed.
+func putContent(tx storage.Tx, stored storedContent) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return tx.Put(contentBucket, stored.ContentID, data)
+}
+
+func decodeContent(data []byte) (Content, error) {
+	var content Content
+	err := json.Unmarshal(data, &content)
+	return content, err
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrContentNotFound) || errors.Is(err, ErrNoData) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
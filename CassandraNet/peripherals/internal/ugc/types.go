@@ -26,6 +26,8 @@ type Content struct {
 	UpdatedAt   time.Time         `json:"updated_at"`
 	Labels      map[string]string `json:"labels,omitempty"`
 	Attributes  map[string]string `json:"attributes,omitempty"`
+	// Media describes the uploaded bytes, if any.
+	Media *Media `json:"media,omitempty"`
 }
 
 // SubmitRequest carries submission metadata.
@@ -6,12 +6,27 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/adminchannel"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/sse"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
 )
 
+// AdminTopic is the admin channel topic carrying every flagged result.
+const AdminTopic = "flagged"
+
+// maxBodyLength bounds the text of a moderation job, in characters.
+const maxBodyLength = 64 << 10
+
 // Service exposes HTTP endpoints for managing UGC moderation jobs.
 type Service struct {
 	pool    *WorkerPool
 	results *resultStore
+	stream  *sse.Hub[Result]
+	admin   *adminchannel.Channel
 	logger  interface {
 		Printf(string, ...any)
 	}
@@ -25,6 +40,7 @@ func NewService(pool *WorkerPool, logger interface {
 	svc := &Service{
 		pool:    pool,
 		results: &resultStore{},
+		stream:  sse.NewHub[Result](sse.Config{}),
 		logger:  logger,
 	}
 	svc.collectorWg.Add(1)
@@ -36,9 +52,20 @@ func (s *Service) collectResults() {
 	defer s.collectorWg.Done()
 	for result := range s.pool.Results() {
 		s.results.push(result)
+		s.stream.Publish(result)
+		if result.Decision == DecisionFlagged {
+			s.admin.Publish(AdminTopic, "", "", result)
+		}
 	}
 }
 
+// SetAdminChannel publishes each flagged result to ch under AdminTopic, for
+// callers with ugc.moderate. Call it before the service handles requests.
+func (s *Service) SetAdminChannel(ch *adminchannel.Channel) {
+	ch.Register(AdminTopic, auth.PermUGCModerate)
+	s.admin = ch
+}
+
 // Shutdown waits for the result collector to finish.
 func (s *Service) Shutdown() {
 	s.collectorWg.Wait()
@@ -50,6 +77,7 @@ func (s *Service) Handler() http.Handler {
 	mux.HandleFunc("/healthz", s.handleHealth)
 	mux.HandleFunc("/jobs", s.handleEnqueue)
 	mux.HandleFunc("/jobs/next", s.handleNext)
+	mux.HandleFunc("/jobs/results/stream", s.handleResultStream)
 	return mux
 }
 
@@ -66,18 +94,21 @@ type enqueuePayload struct {
 
 func (s *Service) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "ugc_worker", http.MethodPost)
 		return
 	}
 	defer r.Body.Close()
 
 	var payload enqueuePayload
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		problem.DecodeFailed(w, r, "ugc_worker.invalid_json", "invalid json", err)
 		return
 	}
-	if payload.ContentID == "" || payload.AuthorID == "" || payload.Body == "" {
-		http.Error(w, "content_id, author_id, and body required", http.StatusBadRequest)
+	var v validation.Validator
+	v.ID("content_id", payload.ContentID)
+	v.ID("author_id", payload.AuthorID)
+	v.String("body", payload.Body).Required().MaxLength(maxBodyLength)
+	if validation.Write(w, r, "ugc_worker.invalid_request", v.Err()) {
 		return
 	}
 	job := Job{
@@ -85,13 +116,14 @@ func (s *Service) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 		AuthorID:  payload.AuthorID,
 		Body:      payload.Body,
 		Submitted: time.Now().UTC(),
+		RequestID: logging.RequestID(r.Context()),
 	}
 	if err := s.pool.Enqueue(job); err != nil {
 		if errors.Is(err, ErrQueueFull) {
-			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			problem.Write(w, r, http.StatusServiceUnavailable, "ugc_worker.queue_full", err.Error())
 			return
 		}
-		http.Error(w, "failed to enqueue job", http.StatusInternalServerError)
+		problem.Write(w, r, http.StatusInternalServerError, "ugc_worker.enqueue_failed", "failed to enqueue job")
 		return
 	}
 	w.WriteHeader(http.StatusAccepted)
@@ -99,7 +131,7 @@ func (s *Service) handleEnqueue(w http.ResponseWriter, r *http.Request) {
 
 func (s *Service) handleNext(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.MethodNotAllowed(w, r, "ugc_worker", http.MethodGet)
 		return
 	}
 	if result, ok := s.results.pop(); ok {
@@ -110,6 +142,33 @@ func (s *Service) handleNext(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleResultStream sends each moderation result, or each with the given
+// decision, as a "result" event until the client leaves. Streamed results
+// are still queued for /jobs/next. A client that reconnects with the ID of
+// the last result it saw first receives the results it missed, while they
+// are still buffered.
+func (s *Service) handleResultStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, "ugc_worker", http.MethodGet)
+		return
+	}
+	decision := Decision(r.URL.Query().Get("decision"))
+	var v validation.Validator
+	v.String("decision", string(decision)).OneOf(string(DecisionApproved), string(DecisionFlagged))
+	if validation.Write(w, r, "ugc_worker.invalid_request", v.Err()) {
+		return
+	}
+	sub, _ := s.stream.Subscribe(func(result Result) bool {
+		return decision == "" || result.Decision == decision
+	}, sse.LastEventID(r))
+	defer sub.Close()
+	stream, ok := sse.Open(w, r, "ugc_worker")
+	if !ok {
+		return
+	}
+	_ = sse.Relay(r.Context(), stream, sub, "result", 0, nil)
+}
+
 type resultStore struct {
 	mu     sync.Mutex
 	queued []Result
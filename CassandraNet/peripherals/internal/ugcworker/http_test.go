@@ -1,10 +1,13 @@
 package ugcworker
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -17,7 +20,7 @@ func TestServiceWorkflow(t *testing.T) {
 	server := httptest.NewServer(svc.Handler())
 	defer server.Close()
 	defer func() {
-		pool.Stop()
+		pool.Stop(context.Background())
 		svc.Shutdown()
 	}()
 
@@ -65,3 +68,97 @@ func TestServiceWorkflow(t *testing.T) {
 		t.Fatalf("expected flagged decision, got %s", result.Decision)
 	}
 }
+
+// streamedResult is one event read from the result stream.
+type streamedResult struct {
+	id     string
+	result Result
+}
+
+// readResult returns the next event of a result stream.
+func readResult(t *testing.T, scanner *bufio.Scanner) streamedResult {
+	t.Helper()
+	var event streamedResult
+	for scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			event.id = id
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &event.result); err != nil {
+				t.Fatalf("decode result: %v", err)
+			}
+			return event
+		}
+	}
+	t.Fatalf("stream ended: %v", scanner.Err())
+	return event
+}
+
+func TestServiceStreamsResults(t *testing.T) {
+	pool := NewWorkerPool(1, 4, NewModerationPolicy([]string{"ban"}), silentLogger{})
+	pool.Start()
+	svc := NewService(pool, silentLogger{})
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	defer func() {
+		pool.Stop(context.Background())
+		svc.Shutdown()
+	}()
+	enqueue := func(id, body string) {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]string{"content_id": id, "author_id": "user", "body": body})
+		resp, err := http.Post(server.URL+"/jobs", "application/json", bytes.NewReader(payload))
+		if err != nil || resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("enqueue %s: %v %v", id, resp, err)
+		}
+		_ = resp.Body.Close()
+	}
+	open := func(lastEventID string) (*http.Response, *bufio.Scanner) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/jobs/results/stream?decision=flagged", nil)
+		req.Header.Set("Last-Event-ID", lastEventID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("stream: %v %v", resp, err)
+		}
+		return resp, bufio.NewScanner(resp.Body)
+	}
+
+	resp, scanner := open("")
+	enqueue("1", "fine")
+	enqueue("2", "contains ban term")
+	first := readResult(t, scanner)
+	if first.id == "" || first.result.Job.ContentID != "2" || first.result.Decision != DecisionFlagged {
+		t.Fatalf("expected the flagged job, got %+v", first)
+	}
+	_ = resp.Body.Close()
+
+	// Results decided while disconnected arrive on reconnecting.
+	enqueue("3", "ban again")
+	deadline := time.Now().Add(time.Second)
+	for {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the third result")
+		}
+		var next Result
+		r, err := http.Get(server.URL + "/jobs/next")
+		if err != nil {
+			t.Fatalf("next request failed: %v", err)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&next)
+		_ = r.Body.Close()
+		if next.Job.ContentID == "3" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, scanner = open(first.id)
+	defer resp.Body.Close()
+	if missed := readResult(t, scanner); missed.result.Job.ContentID != "3" {
+		t.Fatalf("expected the missed result on resuming, got %+v", missed)
+	}
+	if resp, err := http.Get(server.URL + "/jobs/results/stream?decision=maybe"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an unknown decision to be rejected, got %v %v", resp, err)
+	}
+}
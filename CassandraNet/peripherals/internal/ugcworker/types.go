@@ -8,6 +8,9 @@ type Job struct {
 	AuthorID  string    `json:"author_id"`
 	Body      string    `json:"body"`
 	Submitted time.Time `json:"submitted"`
+	// RequestID is the correlation ID of the request that enqueued the
+	// job, carried into its result.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Decision captures the moderation outcome.
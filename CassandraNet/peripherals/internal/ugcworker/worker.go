@@ -1,8 +1,10 @@
 package ugcworker
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,16 +15,29 @@ var (
 
 // WorkerPool processes moderation jobs concurrently.
 type WorkerPool struct {
-	policy  ModerationPolicy
 	jobs    chan Job
 	results chan Result
-	workers int
 	logger  interface {
 		Printf(string, ...any)
 	}
-	startOnce sync.Once
-	stopOnce  sync.Once
-	wg        sync.WaitGroup
+
+	mu      sync.RWMutex
+	policy  ModerationPolicy
+	workers int
+	quit    []chan struct{}
+	started bool
+	stopped bool
+
+	// pending counts the jobs enqueued and not yet processed.
+	pending atomic.Int64
+	// abort is closed when Stop gives up waiting, and done once every
+	// worker has exited after Stop.
+	abort     chan struct{}
+	abortOnce sync.Once
+	done      chan struct{}
+
+	stopOnce sync.Once
+	wg       sync.WaitGroup
 }
 
 // NewWorkerPool constructs a worker pool.
@@ -41,49 +56,187 @@ func NewWorkerPool(workers, queueSize int, policy ModerationPolicy, logger inter
 		results: make(chan Result, queueSize),
 		workers: workers,
 		logger:  logger,
+		abort:   make(chan struct{}),
+		done:    make(chan struct{}),
 	}
 }
 
 // Start launches worker goroutines.
 func (p *WorkerPool) Start() {
-	p.startOnce.Do(func() {
-		for i := 0; i < p.workers; i++ {
-			p.wg.Add(1)
-			go p.workerLoop()
-		}
-	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started || p.stopped {
+		return
+	}
+	p.started = true
+	p.scaleLocked(p.workers)
+}
+
+// SetPolicy replaces the moderation policy applied to subsequent jobs.
+func (p *WorkerPool) SetPolicy(policy ModerationPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policy = policy
+}
+
+// Resize changes the number of worker goroutines. Shrinking lets the
+// removed workers finish their current job before exiting.
+func (p *WorkerPool) Resize(workers int) {
+	if workers <= 0 {
+		workers = 2
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers = workers
+	if p.started && !p.stopped {
+		p.scaleLocked(workers)
+	}
+}
+
+// Workers reports the configured number of workers.
+func (p *WorkerPool) Workers() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.workers
+}
+
+func (p *WorkerPool) scaleLocked(workers int) {
+	for len(p.quit) < workers {
+		quit := make(chan struct{})
+		p.quit = append(p.quit, quit)
+		p.wg.Add(1)
+		go p.workerLoop(quit)
+	}
+	for len(p.quit) > workers {
+		last := len(p.quit) - 1
+		close(p.quit[last])
+		p.quit = p.quit[:last]
+	}
 }
 
-func (p *WorkerPool) workerLoop() {
+func (p *WorkerPool) workerLoop(quit <-chan struct{}) {
 	defer p.wg.Done()
-	for job := range p.jobs {
-		if job.Submitted.IsZero() {
-			job.Submitted = time.Now().UTC()
-		}
-		result := p.policy.Evaluate(job)
+	for {
 		select {
-		case p.results <- result:
-		default:
-			p.logger.Printf("dropping UGC result for %s: results channel full", job.ContentID)
+		case <-quit:
+			return
+		case <-p.abort:
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			select {
+			case <-p.abort:
+				// Stop has already counted the job abandoned.
+				return
+			default:
+			}
+			p.process(job)
+			p.pending.Add(-1)
 		}
 	}
 }
 
-// Stop drains workers and closes the results channel.
-func (p *WorkerPool) Stop() {
+func (p *WorkerPool) process(job Job) {
+	if job.Submitted.IsZero() {
+		job.Submitted = time.Now().UTC()
+	}
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+	result := policy.Evaluate(job)
+	select {
+	case p.results <- result:
+	default:
+		p.logger.Printf("dropping UGC result for %s: results channel full", job.ContentID)
+	}
+}
+
+// Stop stops accepting jobs and waits for the workers to process those
+// already queued, then closes the results channel. If ctx ends first, the
+// workers exit after their current job and Stop returns ctx's error with the
+// number of jobs queued or in progress, which may not be processed;
+// otherwise it returns the jobs that were queued without a worker to take
+// them, as in a pool that was never started. The results channel is closed
+// once every worker has exited.
+func (p *WorkerPool) Stop(ctx context.Context) (abandoned int, err error) {
 	p.stopOnce.Do(func() {
+		p.mu.Lock()
+		p.stopped = true
 		close(p.jobs)
-		p.wg.Wait()
-		close(p.results)
+		p.mu.Unlock()
+		go func() {
+			p.wg.Wait()
+			close(p.results)
+			close(p.done)
+		}()
 	})
+	select {
+	case <-p.done:
+		return int(p.pending.Load()), nil
+	case <-ctx.Done():
+		p.abortOnce.Do(func() { close(p.abort) })
+		return int(p.pending.Load()), ctx.Err()
+	}
 }
 
-// Enqueue submits a job for moderation.
+// Check reports whether the pool can accept jobs: it must be started, not
+// stopped, have at least one worker, and have room in its queue.
+func (p *WorkerPool) Check(context.Context) error {
+	p.mu.RLock()
+	started, stopped, workers := p.started, p.stopped, p.workers
+	p.mu.RUnlock()
+	switch {
+	case !started || stopped:
+		return errors.New("worker pool: not running")
+	case workers == 0:
+		return errors.New("worker pool: no workers")
+	case len(p.jobs) == cap(p.jobs):
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// PoolStats describes a worker pool's queues at one moment.
+type PoolStats struct {
+	Running        bool `json:"running"`
+	Workers        int  `json:"workers"`
+	Queued         int  `json:"queued"`
+	Capacity       int  `json:"capacity"`
+	PendingResults int  `json:"pending_results"`
+}
+
+// Stats reports the pool's workers, the jobs waiting for one, and the
+// results not yet consumed.
+func (p *WorkerPool) Stats() PoolStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return PoolStats{
+		Running:        p.started && !p.stopped,
+		Workers:        p.workers,
+		Queued:         len(p.jobs),
+		Capacity:       cap(p.jobs),
+		PendingResults: len(p.results),
+	}
+}
+
+// Enqueue submits a job for moderation. It returns ErrQueueFull when the
+// queue is full or the pool has stopped.
 func (p *WorkerPool) Enqueue(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return ErrQueueFull
+	}
+	// Counting first keeps pending from going negative when a worker
+	// takes the job at once.
+	p.pending.Add(1)
 	select {
 	case p.jobs <- job:
 		return nil
 	default:
+		p.pending.Add(-1)
 		return ErrQueueFull
 	}
 }
@@ -1,6 +1,7 @@
 package ugcworker
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -13,7 +14,7 @@ func TestWorkerPoolProcessesJobs(t *testing.T) {
 	policy := NewModerationPolicy([]string{"banned"})
 	pool := NewWorkerPool(1, 2, policy, silentLogger{})
 	pool.Start()
-	defer pool.Stop()
+	defer pool.Stop(context.Background())
 
 	job := Job{ContentID: "1", AuthorID: "user", Body: "clean content"}
 	if err := pool.Enqueue(job); err != nil {
@@ -34,7 +35,7 @@ func TestWorkerPoolQueueFull(t *testing.T) {
 	policy := NewModerationPolicy(nil)
 	pool := NewWorkerPool(1, 1, policy, silentLogger{})
 	pool.Start()
-	defer pool.Stop()
+	defer pool.Stop(context.Background())
 
 	job := Job{ContentID: "1", AuthorID: "user", Body: "clean"}
 	if err := pool.Enqueue(job); err != nil {
@@ -44,3 +45,74 @@ func TestWorkerPoolQueueFull(t *testing.T) {
 		t.Fatalf("expected ErrQueueFull, got %v", err)
 	}
 }
+
+func TestWorkerPoolReconfigure(t *testing.T) {
+	pool := NewWorkerPool(1, 4, NewModerationPolicy(nil), silentLogger{})
+	pool.Start()
+	defer pool.Stop(context.Background())
+
+	pool.Resize(3)
+	if got := pool.Workers(); got != 3 {
+		t.Fatalf("expected 3 workers, got %d", got)
+	}
+	pool.Resize(1)
+	pool.SetPolicy(NewModerationPolicy([]string{"scam"}))
+
+	if err := pool.Enqueue(Job{ContentID: "1", AuthorID: "user", Body: "a scam"}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	select {
+	case result := <-pool.Results():
+		if result.Decision != DecisionFlagged {
+			t.Fatalf("expected updated policy to flag, got %s", result.Decision)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for result")
+	}
+}
+
+func TestWorkerPoolCheck(t *testing.T) {
+	pool := NewWorkerPool(1, 4, NewModerationPolicy(nil), silentLogger{})
+	if err := pool.Check(context.Background()); err == nil {
+		t.Fatal("expected unstarted pool to fail its check")
+	}
+	pool.Start()
+	if err := pool.Check(context.Background()); err != nil {
+		t.Fatalf("expected running pool to pass, got %v", err)
+	}
+	pool.Stop(context.Background())
+	if err := pool.Check(context.Background()); err == nil {
+		t.Fatal("expected stopped pool to fail its check")
+	}
+}
+
+func TestWorkerPoolStopDrainsQueuedJobs(t *testing.T) {
+	pool := NewWorkerPool(2, 8, NewModerationPolicy(nil), silentLogger{})
+	pool.Start()
+	for range 5 {
+		if err := pool.Enqueue(Job{ContentID: "1", AuthorID: "user", Body: "clean"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+	abandoned, err := pool.Stop(context.Background())
+	if err != nil || abandoned != 0 {
+		t.Fatalf("expected every job processed, got %d %v", abandoned, err)
+	}
+	results := 0
+	for range pool.Results() {
+		results++
+	}
+	if results != 5 {
+		t.Fatalf("expected 5 results before the channel closed, got %d", results)
+	}
+	if err := pool.Enqueue(Job{ContentID: "late"}); err != ErrQueueFull {
+		t.Fatalf("expected a stopped pool to refuse jobs, got %v", err)
+	}
+
+	idle := NewWorkerPool(1, 8, NewModerationPolicy(nil), silentLogger{})
+	_ = idle.Enqueue(Job{ContentID: "1"})
+	_ = idle.Enqueue(Job{ContentID: "2"})
+	if abandoned, err := idle.Stop(context.Background()); err != nil || abandoned != 2 {
+		t.Fatalf("expected an unstarted pool's jobs abandoned, got %d %v", abandoned, err)
+	}
+}
@@ -0,0 +1,269 @@
+// Package validation checks request fields and reports every failure at
+// once, field by field. A Validator collects failures from rule builders:
+//
+//	var v validation.Validator
+//	v.String("content_id", req.ContentID).Required().MaxLength(128)
+//	v.String("channel", req.Channel).Required().OneOf("email", "webhook")
+//	v.Map("labels", req.Labels).MaxEntries(32).MaxKeyLength(64)
+//	return v.Err()
+//
+// Each field reports at most its first failed rule. Err returns the
+// failures as Errors, which handlers pass to Write to answer 400 with one
+// problem.InvalidParam per field.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Rules reported in FieldError.Rule.
+const (
+	RuleRequired   = "required"
+	RuleMinLength  = "min_length"
+	RuleMaxLength  = "max_length"
+	RuleOneOf      = "one_of"
+	RuleMaxEntries = "max_entries"
+	RuleMaxBytes   = "max_bytes"
+	RuleRange      = "range"
+	RuleFormat     = "format"
+)
+
+// Limits shared by the services' request fields.
+const (
+	// MaxIDLength bounds identifiers such as tenant, project, and record IDs.
+	MaxIDLength = 128
+	// MaxMapEntries, MaxKeyLength, and MaxValueLength bound labels,
+	// attributes, and metadata maps.
+	MaxMapEntries  = 64
+	MaxKeyLength   = 128
+	MaxValueLength = 1024
+)
+
+// FieldError is one field that failed validation.
+type FieldError struct {
+	Field string
+	Rule  string
+	// Reason completes a sentence starting with the field name, such as
+	// "is required".
+	Reason string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Reason
+}
+
+// Errors lists the fields that failed validation, in the order they were
+// checked.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Params converts e to the problem response's invalid_params.
+func (e Errors) Params() []problem.InvalidParam {
+	params := make([]problem.InvalidParam, len(e))
+	for i, fe := range e {
+		params[i] = problem.InvalidParam{Name: fe.Field, Rule: fe.Rule, Reason: fe.Reason}
+	}
+	return params
+}
+
+// Invalid returns Errors holding the single failure of rule on field, for
+// checks made outside a Validator.
+func Invalid(field, rule, reason string) error {
+	return Errors{{Field: field, Rule: rule, Reason: reason}}
+}
+
+// Write answers 400 with code and the field errors in err, and reports
+// whether err held any. Other errors are left to the caller.
+func Write(w http.ResponseWriter, r *http.Request, code string, err error) bool {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	problem.WriteInvalid(w, r, code, errs.Error(), errs.Params())
+	return true
+}
+
+// Validator collects field errors. The zero value is ready to use.
+type Validator struct {
+	errs   Errors
+	failed map[string]bool
+}
+
+// Err returns the collected failures as Errors, or nil when every rule
+// passed.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Check records a failure of rule on field unless ok holds, for rules the
+// builders do not cover.
+func (v *Validator) Check(ok bool, field, rule, reason string) {
+	if ok || v.failed[field] {
+		return
+	}
+	if v.failed == nil {
+		v.failed = make(map[string]bool)
+	}
+	v.failed[field] = true
+	v.errs = append(v.errs, FieldError{Field: field, Rule: rule, Reason: reason})
+}
+
+// ID checks a required identifier of at most MaxIDLength characters.
+func (v *Validator) ID(field, value string) *StringRules {
+	return v.String(field, value).Required().MaxLength(MaxIDLength)
+}
+
+// String starts the rules for a string field.
+func (v *Validator) String(field, value string) *StringRules {
+	return &StringRules{v: v, field: field, value: value}
+}
+
+// Map starts the rules for a string map field.
+func (v *Validator) Map(field string, value map[string]string) *MapRules {
+	return &MapRules{v: v, field: field, value: value}
+}
+
+// Bytes starts the rules for a binary field.
+func (v *Validator) Bytes(field string, value []byte) *BytesRules {
+	return &BytesRules{v: v, field: field, value: value}
+}
+
+// Int starts the rules for an integer field.
+func (v *Validator) Int(field string, value int64) *IntRules {
+	return &IntRules{v: v, field: field, value: value}
+}
+
+// StringRules checks one string field. Lengths count characters, not
+// bytes.
+type StringRules struct {
+	v     *Validator
+	field string
+	value string
+}
+
+// Required fails on an empty value.
+func (r *StringRules) Required() *StringRules {
+	r.v.Check(r.value != "", r.field, RuleRequired, "is required")
+	return r
+}
+
+// MinLength fails on a non-empty value shorter than n characters; pair it
+// with Required to reject empty values too.
+func (r *StringRules) MinLength(n int) *StringRules {
+	r.v.Check(r.value == "" || utf8.RuneCountInString(r.value) >= n, r.field, RuleMinLength, fmt.Sprintf("must be at least %d characters", n))
+	return r
+}
+
+// MaxLength fails on a value longer than n characters.
+func (r *StringRules) MaxLength(n int) *StringRules {
+	r.v.Check(utf8.RuneCountInString(r.value) <= n, r.field, RuleMaxLength, fmt.Sprintf("must be at most %d characters", n))
+	return r
+}
+
+// OneOf fails on a non-empty value outside allowed.
+func (r *StringRules) OneOf(allowed ...string) *StringRules {
+	ok := r.value == ""
+	for _, a := range allowed {
+		ok = ok || r.value == a
+	}
+	r.v.Check(ok, r.field, RuleOneOf, "must be one of "+strings.Join(allowed, ", "))
+	return r
+}
+
+// Excludes fails on a value containing any of chars.
+func (r *StringRules) Excludes(chars string) *StringRules {
+	r.v.Check(!strings.ContainsAny(r.value, chars), r.field, RuleFormat, fmt.Sprintf("must not contain %q", chars))
+	return r
+}
+
+// MapRules checks one string map field.
+type MapRules struct {
+	v     *Validator
+	field string
+	value map[string]string
+}
+
+// Limited applies MaxMapEntries, MaxKeyLength, and MaxValueLength.
+func (r *MapRules) Limited() *MapRules {
+	return r.MaxEntries(MaxMapEntries).MaxKeyLength(MaxKeyLength).MaxValueLength(MaxValueLength)
+}
+
+// MaxEntries fails on a map with more than n entries.
+func (r *MapRules) MaxEntries(n int) *MapRules {
+	r.v.Check(len(r.value) <= n, r.field, RuleMaxEntries, fmt.Sprintf("must have at most %d entries", n))
+	return r
+}
+
+// MaxKeyLength fails when any key is empty or longer than n characters.
+func (r *MapRules) MaxKeyLength(n int) *MapRules {
+	ok := true
+	for k := range r.value {
+		ok = ok && k != "" && utf8.RuneCountInString(k) <= n
+	}
+	r.v.Check(ok, r.field, RuleMaxLength, fmt.Sprintf("keys must be 1 to %d characters", n))
+	return r
+}
+
+// MaxValueLength fails when any value is longer than n characters.
+func (r *MapRules) MaxValueLength(n int) *MapRules {
+	ok := true
+	for _, val := range r.value {
+		ok = ok && utf8.RuneCountInString(val) <= n
+	}
+	r.v.Check(ok, r.field, RuleMaxLength, fmt.Sprintf("values must be at most %d characters", n))
+	return r
+}
+
+// BytesRules checks one binary field.
+type BytesRules struct {
+	v     *Validator
+	field string
+	value []byte
+}
+
+// Required fails on an empty value.
+func (r *BytesRules) Required() *BytesRules {
+	r.v.Check(len(r.value) > 0, r.field, RuleRequired, "is required")
+	return r
+}
+
+// MaxBytes fails on a value longer than n bytes.
+func (r *BytesRules) MaxBytes(n int) *BytesRules {
+	r.v.Check(len(r.value) <= n, r.field, RuleMaxBytes, fmt.Sprintf("must be at most %d bytes", n))
+	return r
+}
+
+// IntRules checks one integer field.
+type IntRules struct {
+	v     *Validator
+	field string
+	value int64
+}
+
+// Range fails on a value outside [lo, hi].
+func (r *IntRules) Range(lo, hi int64) *IntRules {
+	r.v.Check(r.value >= lo && r.value <= hi, r.field, RuleRange, fmt.Sprintf("must be between %d and %d", lo, hi))
+	return r
+}
+
+// Min fails on a value below lo.
+func (r *IntRules) Min(lo int64) *IntRules {
+	r.v.Check(r.value >= lo, r.field, RuleRange, fmt.Sprintf("must be at least %d", lo))
+	return r
+}
@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+func TestValidatorCollectsFieldErrors(t *testing.T) {
+	var v Validator
+	v.ID("content_id", "c-1")
+	v.ID("tenant_id", "")
+	v.String("filename", strings.Repeat("é", 11)).Required().MaxLength(10)
+	v.String("state", "lost").OneOf("pending", "approved")
+	v.String("reason", "").OneOf("spam")
+	v.Map("labels", map[string]string{"a": "1", "b": "2", "c": "3"}).MaxEntries(2)
+	v.Map("attributes", map[string]string{"": "x"}).Limited()
+	v.Bytes("payload", make([]byte, 5)).MaxBytes(4)
+	v.Int("size", -1).Min(0)
+
+	var errs Errors
+	if err := v.Err(); !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+	want := Errors{
+		{Field: "tenant_id", Rule: RuleRequired, Reason: "is required"},
+		{Field: "filename", Rule: RuleMaxLength, Reason: "must be at most 10 characters"},
+		{Field: "state", Rule: RuleOneOf, Reason: "must be one of pending, approved"},
+		{Field: "labels", Rule: RuleMaxEntries, Reason: "must have at most 2 entries"},
+		{Field: "attributes", Rule: RuleMaxLength, Reason: fmt.Sprintf("keys must be 1 to %d characters", MaxKeyLength)},
+		{Field: "payload", Rule: RuleMaxBytes, Reason: "must be at most 4 bytes"},
+		{Field: "size", Rule: RuleRange, Reason: "must be at least 0"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("unexpected errors:\n%+v\nwant:\n%+v", errs, want)
+	}
+	if got := errs.Error(); !strings.HasPrefix(got, "tenant_id is required; filename must be at most 10 characters") {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestValidatorReportsFirstFailurePerField(t *testing.T) {
+	var v Validator
+	v.String("topic", "").Required().MaxLength(0).OneOf("a")
+	v.Check(false, "topic", RuleFormat, "is malformed")
+	errs := v.Err().(Errors)
+	if len(errs) != 1 || errs[0].Rule != RuleRequired {
+		t.Fatalf("expected only the required failure, got %+v", errs)
+	}
+}
+
+func TestValidatorPasses(t *testing.T) {
+	var v Validator
+	v.ID("tenant_id", "acme")
+	v.String("mime_type", "").MaxLength(10).MinLength(3)
+	v.Map("labels", nil).Limited()
+	if err := v.Err(); err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/content", nil)
+	err := fmt.Errorf("wrapped: %w", Invalid("filename", RuleRequired, "is required"))
+	if !Write(rec, r, "ugc.invalid_request", err) {
+		t.Fatal("expected Write to handle a wrapped Errors")
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []problem.InvalidParam{{Name: "filename", Rule: RuleRequired, Reason: "is required"}}
+	if rec.Code != http.StatusBadRequest || p.Detail != "filename is required" || !reflect.DeepEqual(p.InvalidParams, want) {
+		t.Fatalf("unexpected response %d %+v", rec.Code, p)
+	}
+
+	if Write(httptest.NewRecorder(), r, "ugc.invalid_request", errors.New("other")) || Write(httptest.NewRecorder(), r, "ugc.invalid_request", nil) {
+		t.Fatal("expected Write to leave other errors to the caller")
+	}
+}
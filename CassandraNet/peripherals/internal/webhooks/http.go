@@ -0,0 +1,308 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/auth"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+// Problem codes returned by the webhooks API.
+const (
+	codeInvalidJSON        = "webhooks.invalid_json"
+	codeInvalidRequest     = "webhooks.invalid_request"
+	codeNotFound           = "webhooks.not_found"
+	codeUnavailable        = "webhooks.store_unavailable"
+	codeForbidden          = "webhooks.forbidden_tenant"
+	codeForbiddenProject   = "webhooks.forbidden_project"
+	codePreconditionFailed = "webhooks.precondition_failed"
+	codeNotFailed          = "webhooks.not_failed"
+)
+
+// Path is where services mount Handler, for both Path and Path + "/".
+const Path = "/webhooks"
+
+const pathPrefix = Path + "/"
+
+// Handler serves the webhooks API:
+//
+//	GET    /webhooks                                  list subscriptions
+//	GET    /webhooks/{id}                             read a subscription
+//	PUT    /webhooks/{id}                             create or replace one
+//	DELETE /webhooks/{id}                             delete one
+//	POST   /webhooks/{id}/redrive                     redrive failed deliveries
+//	GET    /webhooks/{id}/deliveries                  list deliveries
+//	GET    /webhooks/{id}/deliveries/{delivery}       read a delivery
+//	POST   /webhooks/{id}/deliveries/{delivery}/redrive
+//
+// Every route takes tenant_id and project_id query parameters. Reads
+// require auth.PermWebhooksRead and the rest auth.PermWebhooksManage.
+func (s *Service) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == Path {
+			s.handleList(w, r)
+			return
+		}
+		segments := strings.Split(strings.TrimPrefix(r.URL.Path, pathPrefix), "/")
+		if !strings.HasPrefix(r.URL.Path, pathPrefix) || segments[0] == "" || len(segments) > 4 {
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+			return
+		}
+		id := segments[0]
+		scope, ok := resolveScope(w, r)
+		if !ok {
+			return
+		}
+		switch {
+		case len(segments) == 1:
+			s.handleSubscription(w, r, scope, id)
+		case len(segments) == 2 && segments[1] == "redrive":
+			s.handleRedriveFailed(w, r, scope, id)
+		case len(segments) == 2 && segments[1] == "deliveries":
+			s.handleDeliveries(w, r, scope, id)
+		case len(segments) == 3 && segments[1] == "deliveries":
+			s.handleDelivery(w, r, scope, id, segments[2])
+		case len(segments) == 4 && segments[1] == "deliveries" && segments[3] == "redrive":
+			s.handleRedrive(w, r, scope, id, segments[2])
+		default:
+			problem.Write(w, r, http.StatusNotFound, codeNotFound, "resource not found")
+		}
+	})
+}
+
+// putPayload omits the ID and scope, which come from the path and query.
+type putPayload struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Secret      string   `json:"secret"`
+	Disabled    bool     `json:"disabled"`
+}
+
+func (s *Service) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	scope, ok := resolveScope(w, r)
+	if !ok || !auth.Allow(w, r, auth.PermWebhooksRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	items, next, err := s.ListSubscriptions(r.Context(), scope, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+func (s *Service) handleSubscription(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !auth.Allow(w, r, auth.PermWebhooksRead, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		sub, err := s.GetSubscription(r.Context(), scope, id)
+		if err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", versionETag(sub.Version))
+		writeJSON(w, http.StatusOK, sub)
+	case http.MethodPut:
+		if !auth.Allow(w, r, auth.PermWebhooksManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		s.handlePut(w, r, scope, id)
+	case http.MethodDelete:
+		if !auth.Allow(w, r, auth.PermWebhooksManage, scope.TenantID, scope.ProjectID) {
+			return
+		}
+		if err := s.DeleteSubscription(r.Context(), scope, id); err != nil {
+			httpError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		headerAllow(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Service) handlePut(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	defer r.Body.Close()
+	var payload putPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		problem.DecodeFailed(w, r, codeInvalidJSON, "invalid json payload", err)
+		return
+	}
+	ifVersion, err := parseIfMatch(r.Header.Get("If-Match"))
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	sub, created, err := s.PutSubscription(r.Context(), SubscriptionRequest{
+		ID:          id,
+		TenantID:    scope.TenantID,
+		ProjectID:   scope.ProjectID,
+		URL:         payload.URL,
+		Events:      payload.Events,
+		Description: payload.Description,
+		Secret:      payload.Secret,
+		Disabled:    payload.Disabled,
+		IfVersion:   ifVersion,
+	})
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(sub.Version))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, sub)
+}
+
+func (s *Service) handleRedriveFailed(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermWebhooksManage, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	count, err := s.RedriveFailed(r.Context(), scope, id)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]int{"redriven": count})
+}
+
+func (s *Service) handleDeliveries(w http.ResponseWriter, r *http.Request, scope Scope, id string) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermWebhooksRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	page, err := pagination.Parse(r, pagination.DefaultLimit)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	status := DeliveryStatus(r.URL.Query().Get("status"))
+	items, next, err := s.Deliveries(r.Context(), scope, id, status, page)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	pagination.Write(w, r, items, next)
+}
+
+func (s *Service) handleDelivery(w http.ResponseWriter, r *http.Request, scope Scope, id, deliveryID string) {
+	if r.Method != http.MethodGet {
+		headerAllow(w, r, http.MethodGet)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermWebhooksRead, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	d, err := s.GetDelivery(r.Context(), scope, id, deliveryID)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Service) handleRedrive(w http.ResponseWriter, r *http.Request, scope Scope, id, deliveryID string) {
+	if r.Method != http.MethodPost {
+		headerAllow(w, r, http.MethodPost)
+		return
+	}
+	if !auth.Allow(w, r, auth.PermWebhooksManage, scope.TenantID, scope.ProjectID) {
+		return
+	}
+	d, err := s.Redrive(r.Context(), scope, id, deliveryID)
+	if err != nil {
+		httpError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
+
+// resolveScope applies the caller's tenant and project binding to the
+// requested scope, writing 403 when they contradict it.
+func resolveScope(w http.ResponseWriter, r *http.Request) (Scope, bool) {
+	tenantID := r.URL.Query().Get("tenant_id")
+	tenant, ok := auth.ResolveTenant(r.Context(), tenantID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbidden, "credentials are not valid for tenant "+tenantID)
+		return Scope{}, false
+	}
+	projectID := r.URL.Query().Get("project_id")
+	project, ok := auth.ResolveProject(r.Context(), projectID)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, codeForbiddenProject, "credentials are not valid for project "+projectID)
+		return Scope{}, false
+	}
+	return Scope{TenantID: tenant, ProjectID: project}, true
+}
+
+// versionETag is a subscription's ETag, its quoted version.
+func versionETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// parseIfMatch reads the version a PUT is conditional on, 0 when the header
+// is absent.
+func parseIfMatch(header string) (int64, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(strings.Trim(header, `"`), 10, 64)
+	if err != nil || version <= 0 {
+		return 0, ErrPreconditionFailed
+	}
+	return version, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, payload any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func httpError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrSubscriptionNotFound), errors.Is(err, ErrDeliveryNotFound):
+		problem.Write(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, ErrPreconditionFailed):
+		problem.Write(w, r, http.StatusPreconditionFailed, codePreconditionFailed, err.Error())
+	case errors.Is(err, ErrNotFailed):
+		problem.Write(w, r, http.StatusConflict, codeNotFailed, err.Error())
+	case errors.Is(err, ErrStore):
+		problem.Write(w, r, http.StatusServiceUnavailable, codeUnavailable, "store unavailable")
+	case validation.Write(w, r, codeInvalidRequest, err):
+	default:
+		problem.Write(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	}
+}
+
+func headerAllow(w http.ResponseWriter, r *http.Request, methods ...string) {
+	problem.MethodNotAllowed(w, r, "webhooks", methods...)
+}
@@ -0,0 +1,754 @@
+// Package webhooks delivers services' events to URLs their users
+// subscribe. A service hands each event to Emit, or forwards it from its
+// event bus with Subscribe; Emit stores one delivery per matching
+// subscription, and Run sends them, signed with the subscription's secret,
+// retrying failures with exponential backoff. Deliveries that run out of
+// attempts stay in the delivery log as failed until they are redriven.
+//
+// Subscriptions and deliveries live in shared storage buckets, so every
+// service using the package, and every replica, serves the same
+// subscriptions and shares the delivery work.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/audit"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/config"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/eventbus"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/id"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/logging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/validation"
+)
+
+var (
+	// ErrSubscriptionNotFound indicates no subscription with the ID exists
+	// in the scope.
+	ErrSubscriptionNotFound = errors.New("webhooks: subscription not found")
+	// ErrDeliveryNotFound indicates the subscription has no delivery with
+	// the ID.
+	ErrDeliveryNotFound = errors.New("webhooks: delivery not found")
+	// ErrPreconditionFailed indicates an If-Match version check did not
+	// hold.
+	ErrPreconditionFailed = errors.New("webhooks: version mismatch")
+	// ErrNotFailed indicates a redrive of a delivery that has not failed.
+	ErrNotFailed = errors.New("webhooks: delivery has not failed")
+	// ErrStore wraps failures of the underlying storage driver.
+	ErrStore = errors.New("webhooks: store unavailable")
+
+	// errNotDue means another replica claimed the delivery first.
+	errNotDue = errors.New("webhooks: delivery not due")
+)
+
+// AllEvents in a subscription's events selects every event the service
+// offers.
+const AllEvents = "*"
+
+// Limits of subscriptions and delivery logs.
+const (
+	maxURLLength         = 2048
+	maxDescriptionLength = 256
+	maxEvents            = 64
+	minSecretLength      = 16
+	maxSecretLength      = 256
+	// maxHistory bounds the attempts kept on each delivery.
+	maxHistory = 10
+)
+
+// idPattern restricts subscription IDs to characters safe in paths.
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Store abstracts persistence for subscriptions and deliveries.
+type Store interface {
+	GetSubscription(ctx context.Context, scope Scope, id string) (Subscription, error)
+	// PutSubscription creates or replaces sub, setting its version one
+	// above the stored one and keeping its creation time. When sub has no
+	// secret the stored one is kept, or a new subscription gets one from
+	// NewSecret. ifVersion, when non-zero, must equal the stored
+	// version. created reports whether the subscription is new.
+	PutSubscription(ctx context.Context, sub Subscription, ifVersion int64) (stored Subscription, created bool, err error)
+	// DeleteSubscription removes a subscription and its deliveries and
+	// returns the subscription as it was.
+	DeleteSubscription(ctx context.Context, scope Scope, id string) (Subscription, error)
+	// ListSubscriptions returns one page of the scope's subscriptions in
+	// ID order and the position of the next page, empty on the last.
+	ListSubscriptions(ctx context.Context, scope Scope, page pagination.Request) ([]Subscription, string, error)
+	// Subscribers returns the tenant's subscriptions in the project and
+	// the project-wide ones.
+	Subscribers(ctx context.Context, tenantID, projectID string) ([]Subscription, error)
+	// Enqueue stores new pending deliveries.
+	Enqueue(ctx context.Context, deliveries []Delivery) error
+	// Due returns up to limit pending deliveries, in any scope, whose next
+	// attempt is at or before now.
+	Due(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	GetDelivery(ctx context.Context, scope Scope, subscriptionID, id string) (Delivery, error)
+	// UpdateDelivery applies fn to a delivery and stores the result
+	// atomically, so replicas racing to claim it cannot both win. fn may
+	// run more than once and must not have side effects.
+	UpdateDelivery(ctx context.Context, scope Scope, subscriptionID, id string, fn func(*Delivery) error) (Delivery, error)
+	// Deliveries returns one page of a subscription's deliveries, newest
+	// first, limited to status when it is not empty.
+	Deliveries(ctx context.Context, scope Scope, subscriptionID string, status DeliveryStatus, page pagination.Request) ([]Delivery, string, error)
+	// PruneDeliveries deletes a subscription's finished deliveries beyond
+	// its keep newest ones.
+	PruneDeliveries(ctx context.Context, scope Scope, subscriptionID string, keep int) error
+}
+
+// Clock allows deterministic timing in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now().UTC() }
+
+// Config tunes a Service. Zero values select the defaults.
+type Config struct {
+	// Events lists the event names subscriptions may select. Events with
+	// other names are not delivered.
+	Events []string
+	// PollInterval between checks for due deliveries (default 1s).
+	PollInterval time.Duration
+	// Timeout bounds each attempt (default 10s).
+	Timeout time.Duration
+	// MaxAttempts before a delivery fails (default 8).
+	MaxAttempts int
+	// MinBackoff is the wait after the first failed attempt, doubled
+	// after each further one (default 10s), up to MaxBackoff (default 1h).
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// History is the number of finished deliveries kept per subscription
+	// (default 200).
+	History int
+	// BatchSize is the most deliveries attempted per poll (default 100).
+	BatchSize int
+	// AllowedHosts, when not empty, limits subscription URLs to those host
+	// names; an entry starting with "." also allows its subdomains.
+	AllowedHosts []string
+}
+
+// FromConfig reads WEBHOOK_TIMEOUT, WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_MAX_BACKOFF, WEBHOOK_HISTORY, and WEBHOOK_ALLOWED_HOSTS from
+// loader for a service offering events.
+func FromConfig(loader config.Loader, events []string) Config {
+	return Config{
+		Events:       events,
+		Timeout:      loader.Duration("WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxAttempts:  loader.Int("WEBHOOK_MAX_ATTEMPTS", 8),
+		MaxBackoff:   loader.Duration("WEBHOOK_MAX_BACKOFF", time.Hour),
+		History:      loader.Int("WEBHOOK_HISTORY", 200),
+		AllowedHosts: loader.StringSlice("WEBHOOK_ALLOWED_HOSTS", nil),
+	}
+}
+
+// Service stores subscriptions and delivers events to them. Replicas
+// sharing a store each poll it, and each attempt is claimed by exactly one
+// of them.
+type Service struct {
+	store  Store
+	cfg    Config
+	client *http.Client
+	clock  Clock
+	audit  *audit.Log
+	logger interface {
+		Printf(string, ...any)
+	}
+}
+
+// NewService builds a Service sending deliveries through transport, which
+// should not attach this service's credentials since subscribers choose
+// the URL. transport, clock, and logger may be nil.
+func NewService(store Store, transport http.RoundTripper, cfg Config, clock Clock, logger interface {
+	Printf(string, ...any)
+}) *Service {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(time.Hour, cfg.MinBackoff)
+	}
+	if cfg.History <= 0 {
+		cfg.History = 200
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	hosts := make([]string, len(cfg.AllowedHosts))
+	for i, host := range cfg.AllowedHosts {
+		hosts[i] = strings.ToLower(host)
+	}
+	cfg.AllowedHosts = hosts
+	if clock == nil {
+		clock = systemClock{}
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	return &Service{
+		store: store,
+		cfg:   cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		clock:  clock,
+		logger: logger,
+	}
+}
+
+// SetAudit records every subscription change and redrive in log. Call it
+// before the service handles requests.
+func (s *Service) SetAudit(log *audit.Log) {
+	s.audit = log
+}
+
+// Events returns the event names subscriptions may select.
+func (s *Service) Events() []string {
+	return slices.Clone(s.cfg.Events)
+}
+
+// PutSubscription creates or replaces a subscription. The result carries
+// the signing secret, generated when a new subscription names none.
+func (s *Service) PutSubscription(ctx context.Context, req SubscriptionRequest) (Subscription, bool, error) {
+	if err := s.validateSubscription(req); err != nil {
+		return Subscription{}, false, err
+	}
+	scope := Scope{TenantID: req.TenantID, ProjectID: req.ProjectID}
+	before, err := s.previous(ctx, scope, req.ID)
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	now := s.clock.Now()
+	sub := Subscription{
+		ID:          req.ID,
+		TenantID:    req.TenantID,
+		ProjectID:   req.ProjectID,
+		URL:         req.URL,
+		Events:      slices.Compact(slices.Sorted(slices.Values(req.Events))),
+		Description: req.Description,
+		Secret:      req.Secret,
+		Disabled:    req.Disabled,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	sub, created, err := s.store.PutSubscription(ctx, sub, req.IfVersion)
+	if err != nil {
+		return Subscription{}, false, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "webhooks.subscription.put",
+		Resource:  "webhooks/" + sub.ID,
+		TenantID:  sub.TenantID,
+		ProjectID: sub.ProjectID,
+		Before:    before,
+		After:     redact(sub),
+	})
+	return sub, created, nil
+}
+
+// GetSubscription returns the scope's subscription with id, without its
+// secret.
+func (s *Service) GetSubscription(ctx context.Context, scope Scope, id string) (Subscription, error) {
+	if err := validateScope(scope, id); err != nil {
+		return Subscription{}, err
+	}
+	sub, err := s.store.GetSubscription(ctx, scope, id)
+	if err != nil {
+		return Subscription{}, err
+	}
+	return redact(sub), nil
+}
+
+// DeleteSubscription removes the scope's subscription with id and its
+// deliveries. Attempts already under way finish but are not recorded.
+func (s *Service) DeleteSubscription(ctx context.Context, scope Scope, id string) error {
+	if err := validateScope(scope, id); err != nil {
+		return err
+	}
+	sub, err := s.store.DeleteSubscription(ctx, scope, id)
+	if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "webhooks.subscription.delete",
+		Resource:  "webhooks/" + sub.ID,
+		TenantID:  sub.TenantID,
+		ProjectID: sub.ProjectID,
+		Before:    redact(sub),
+	})
+	return nil
+}
+
+// ListSubscriptions lists one page of the scope's subscriptions, without
+// their secrets, and the position of the next page.
+func (s *Service) ListSubscriptions(ctx context.Context, scope Scope, page pagination.Request) ([]Subscription, string, error) {
+	if err := validateScope(scope, ""); err != nil {
+		return nil, "", err
+	}
+	subs, next, err := s.store.ListSubscriptions(ctx, scope, page)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range subs {
+		subs[i] = redact(subs[i])
+	}
+	return subs, next, nil
+}
+
+// Deliveries lists one page of a subscription's deliveries, newest first,
+// limited to status when it is not empty.
+func (s *Service) Deliveries(ctx context.Context, scope Scope, id string, status DeliveryStatus, page pagination.Request) ([]Delivery, string, error) {
+	var v validation.Validator
+	v.String("status", string(status)).OneOf(string(DeliveryPending), string(DeliverySucceeded), string(DeliveryFailed))
+	if err := v.Err(); err != nil {
+		return nil, "", err
+	}
+	if _, err := s.GetSubscription(ctx, scope, id); err != nil {
+		return nil, "", err
+	}
+	return s.store.Deliveries(ctx, scope, id, status, page)
+}
+
+// GetDelivery returns a subscription's delivery.
+func (s *Service) GetDelivery(ctx context.Context, scope Scope, id, deliveryID string) (Delivery, error) {
+	if err := validateScope(scope, id); err != nil {
+		return Delivery{}, err
+	}
+	return s.store.GetDelivery(ctx, scope, id, deliveryID)
+}
+
+// Redrive queues a failed delivery for another round of attempts, starting
+// now. Deliveries that have not failed return ErrNotFailed.
+func (s *Service) Redrive(ctx context.Context, scope Scope, id, deliveryID string) (Delivery, error) {
+	if err := validateScope(scope, id); err != nil {
+		return Delivery{}, err
+	}
+	d, err := s.redrive(ctx, scope, id, deliveryID)
+	if err != nil {
+		return Delivery{}, err
+	}
+	s.audit.Record(ctx, audit.Change{
+		Action:    "webhooks.delivery.redrive",
+		Resource:  "webhooks/" + id + "/deliveries/" + d.ID,
+		TenantID:  d.TenantID,
+		ProjectID: d.ProjectID,
+	})
+	return d, nil
+}
+
+// RedriveFailed queues every failed delivery of a subscription for another
+// round of attempts and returns how many there were.
+func (s *Service) RedriveFailed(ctx context.Context, scope Scope, id string) (int, error) {
+	if _, err := s.GetSubscription(ctx, scope, id); err != nil {
+		return 0, err
+	}
+	count := 0
+	page := pagination.Request{Limit: pagination.MaxLimit}
+	for {
+		failed, next, err := s.store.Deliveries(ctx, scope, id, DeliveryFailed, page)
+		if err != nil {
+			return count, err
+		}
+		for _, d := range failed {
+			_, err := s.redrive(ctx, scope, id, d.ID)
+			if errors.Is(err, ErrNotFailed) || errors.Is(err, ErrDeliveryNotFound) {
+				continue
+			}
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+		if next == "" {
+			break
+		}
+		page.After = next
+	}
+	if count > 0 {
+		s.audit.Record(ctx, audit.Change{
+			Action:    "webhooks.subscription.redrive",
+			Resource:  "webhooks/" + id,
+			TenantID:  scope.TenantID,
+			ProjectID: scope.ProjectID,
+			After:     map[string]int{"redriven": count},
+		})
+	}
+	return count, nil
+}
+
+func (s *Service) redrive(ctx context.Context, scope Scope, id, deliveryID string) (Delivery, error) {
+	now := s.clock.Now()
+	return s.store.UpdateDelivery(ctx, scope, id, deliveryID, func(d *Delivery) error {
+		if d.Status != DeliveryFailed {
+			return ErrNotFailed
+		}
+		d.Status = DeliveryPending
+		d.Attempts = 0
+		d.NextAttemptAt = now
+		d.UpdatedAt = now
+		return nil
+	})
+}
+
+// Emit stores a delivery of event for each enabled subscription in its
+// scope that selects it. Events the service does not offer, and events
+// without a project, are dropped. Failures are logged.
+func (s *Service) Emit(ctx context.Context, event Event) {
+	if event.ProjectID == "" || !slices.Contains(s.cfg.Events, event.Name) {
+		return
+	}
+	if err := s.emit(ctx, event); err != nil {
+		logging.For(ctx, s.logger).Printf("queue webhooks for %s event: %v", event.Name, err)
+	}
+}
+
+// EmitEvent is Emit for callers that cannot import this package, such as
+// messaging; see messaging.EmitFunc.
+func (s *Service) EmitEvent(ctx context.Context, name, id, tenantID, projectID string, data any) {
+	s.Emit(ctx, Event{ID: id, Name: name, TenantID: tenantID, ProjectID: projectID, Data: data})
+}
+
+func (s *Service) emit(ctx context.Context, event Event) error {
+	subs, err := s.store.Subscribers(ctx, event.TenantID, event.ProjectID)
+	if err != nil {
+		return err
+	}
+	subs = slices.DeleteFunc(subs, func(sub Subscription) bool {
+		return sub.Disabled || !selects(sub, event.Name)
+	})
+	if len(subs) == 0 {
+		return nil
+	}
+	now := s.clock.Now()
+	if event.ID == "" {
+		event.ID = id.New(id.PrefixEvent)
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = now
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]Delivery, len(subs))
+	for i, sub := range subs {
+		deliveries[i] = Delivery{
+			ID:             newDeliveryID(now),
+			SubscriptionID: sub.ID,
+			TenantID:       sub.TenantID,
+			ProjectID:      sub.ProjectID,
+			EventID:        event.ID,
+			Event:          event.Name,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+	}
+	return s.store.Enqueue(ctx, deliveries)
+}
+
+// Subscribe emits every event published on bus that the service offers.
+// Subscribers of the bus should return promptly, and Emit writes to the
+// store, so a slow store delays the bus's other subscribers.
+func (s *Service) Subscribe(bus *eventbus.Bus) (unsubscribe func()) {
+	return bus.SubscribeAll(func(ctx context.Context, e eventbus.Event) {
+		tenant, project := e.Scope()
+		s.Emit(ctx, Event{Name: e.EventName(), TenantID: tenant, ProjectID: project, Data: e})
+	})
+}
+
+// Run attempts due deliveries every poll interval until ctx is cancelled.
+// Failures are logged and retried on the next poll.
+func (s *Service) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Tick(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Printf("check for due webhook deliveries failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick attempts every delivery due now, up to the batch size, and returns
+// when the attempts are done.
+func (s *Service) Tick(ctx context.Context) error {
+	now := s.clock.Now()
+	due, err := s.store.Due(ctx, now, s.cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, d := range due {
+		claimed, err := s.claim(ctx, d, now)
+		if errors.Is(err, errNotDue) || errors.Is(err, ErrDeliveryNotFound) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Printf("claim webhook delivery %s: %v", d.ID, err)
+			}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.attempt(ctx, claimed)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// claim leases a due delivery to this replica by pushing its next attempt
+// past the attempt's timeout, so another replica retries it only if this
+// one is lost.
+func (s *Service) claim(ctx context.Context, due Delivery, now time.Time) (Delivery, error) {
+	scope := Scope{TenantID: due.TenantID, ProjectID: due.ProjectID}
+	return s.store.UpdateDelivery(ctx, scope, due.SubscriptionID, due.ID, func(d *Delivery) error {
+		if d.Status != DeliveryPending || d.NextAttemptAt.After(now) {
+			return errNotDue
+		}
+		d.NextAttemptAt = now.Add(s.cfg.Timeout + s.cfg.PollInterval)
+		return nil
+	})
+}
+
+func (s *Service) attempt(ctx context.Context, d Delivery) {
+	scope := Scope{TenantID: d.TenantID, ProjectID: d.ProjectID}
+	sub, err := s.store.GetSubscription(ctx, scope, d.SubscriptionID)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return
+	}
+	if err != nil {
+		s.logger.Printf("load webhook subscription %s: %v", d.SubscriptionID, err)
+		return
+	}
+	started := s.clock.Now()
+	result := Attempt{At: started}
+	if sub.Disabled {
+		result.Error = "subscription disabled"
+	} else {
+		result.StatusCode, err = s.send(ctx, sub, d)
+		if err != nil {
+			result.Error = err.Error()
+		}
+	}
+	if ctx.Err() != nil {
+		// Shutting down; the lease expires and the attempt is retried.
+		return
+	}
+	now := s.clock.Now()
+	result.DurationMS = now.Sub(started).Milliseconds()
+	_, err = s.store.UpdateDelivery(ctx, scope, d.SubscriptionID, d.ID, func(d *Delivery) error {
+		d.Attempts++
+		d.History = append(d.History, result)
+		if len(d.History) > maxHistory {
+			d.History = d.History[len(d.History)-maxHistory:]
+		}
+		d.Error = result.Error
+		d.UpdatedAt = now
+		d.NextAttemptAt = time.Time{}
+		switch {
+		case result.Error == "":
+			d.Status = DeliverySucceeded
+		case sub.Disabled || d.Attempts >= s.cfg.MaxAttempts:
+			d.Status = DeliveryFailed
+		default:
+			d.Status = DeliveryPending
+			d.NextAttemptAt = now.Add(s.backoff(d.Attempts))
+		}
+		return nil
+	})
+	if errors.Is(err, ErrDeliveryNotFound) {
+		return
+	}
+	if err == nil {
+		err = s.store.PruneDeliveries(ctx, scope, d.SubscriptionID, s.cfg.History)
+	}
+	if err != nil {
+		s.logger.Printf("record webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+// send posts the delivery's payload to the subscription's URL and returns
+// the response status. Statuses outside 2xx are errors.
+func (s *Service) send(ctx context.Context, sub Subscription, d Delivery) (int, error) {
+	target, err := url.Parse(sub.URL)
+	if err != nil {
+		return 0, err
+	}
+	if !s.hostAllowed(target.Hostname()) {
+		return 0, fmt.Errorf("host %s is not allowed", target.Hostname())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := s.clock.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderID, d.ID)
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, d.Payload))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%s returned %s", target.Redacted(), resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff is the wait after a delivery's attempts-th failed attempt.
+func (s *Service) backoff(attempts int) time.Duration {
+	wait := float64(s.cfg.MinBackoff) * math.Pow(2, float64(attempts-1))
+	if wait > float64(s.cfg.MaxBackoff) {
+		return s.cfg.MaxBackoff
+	}
+	return time.Duration(wait)
+}
+
+func (s *Service) hostAllowed(host string) bool {
+	if len(s.cfg.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	if slices.Contains(s.cfg.AllowedHosts, host) {
+		return true
+	}
+	if net.ParseIP(host) != nil {
+		return false
+	}
+	for _, allowed := range s.cfg.AllowedHosts {
+		if strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// previous returns the stored subscription for the audit log's before
+// state, nil when auditing is off or none exists.
+func (s *Service) previous(ctx context.Context, scope Scope, id string) (any, error) {
+	if s.audit == nil {
+		return nil, nil
+	}
+	sub, err := s.store.GetSubscription(ctx, scope, id)
+	if errors.Is(err, ErrSubscriptionNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return redact(sub), nil
+}
+
+func (s *Service) validateSubscription(req SubscriptionRequest) error {
+	var v validation.Validator
+	v.String("id", req.ID).Required().MaxLength(validation.MaxIDLength)
+	if req.ID != "" {
+		v.Check(idPattern.MatchString(req.ID), "id", validation.RuleFormat, "must be lower-case letters, digits, '.', '_', or '-', starting with a letter or digit")
+	}
+	v.String("tenant_id", req.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", req.ProjectID)
+	v.String("url", req.URL).Required().MaxLength(maxURLLength)
+	if req.URL != "" {
+		target, err := url.Parse(req.URL)
+		valid := err == nil && (target.Scheme == "http" || target.Scheme == "https") && target.Host != ""
+		v.Check(valid, "url", validation.RuleFormat, "must be an absolute http or https URL")
+		if valid {
+			v.Check(s.hostAllowed(target.Hostname()), "url", validation.RuleFormat, "host "+target.Hostname()+" is not allowed")
+		}
+	}
+	v.Check(len(req.Events) > 0, "events", validation.RuleRequired, "is required")
+	v.Check(len(req.Events) <= maxEvents, "events", validation.RuleMaxEntries, fmt.Sprintf("must have at most %d entries", maxEvents))
+	for _, name := range req.Events {
+		v.Check(name == AllEvents || slices.Contains(s.cfg.Events, name), "events", validation.RuleOneOf, fmt.Sprintf("%q is not an event; must be %s or one of %s", name, AllEvents, strings.Join(s.cfg.Events, ", ")))
+	}
+	v.String("description", req.Description).MaxLength(maxDescriptionLength)
+	if req.Secret != "" {
+		v.Check(len(req.Secret) >= minSecretLength, "secret", validation.RuleFormat, fmt.Sprintf("must be at least %d characters", minSecretLength))
+		v.String("secret", req.Secret).MaxLength(maxSecretLength)
+	}
+	return v.Err()
+}
+
+// validateScope checks a scope and, when id is not empty, a subscription
+// ID.
+func validateScope(scope Scope, id string) error {
+	var v validation.Validator
+	v.String("tenant_id", scope.TenantID).MaxLength(validation.MaxIDLength)
+	v.ID("project_id", scope.ProjectID)
+	if id != "" {
+		v.String("id", id).MaxLength(validation.MaxIDLength)
+	}
+	return v.Err()
+}
+
+// selects reports whether sub receives events called name.
+func selects(sub Subscription, name string) bool {
+	return slices.Contains(sub.Events, AllEvents) || slices.Contains(sub.Events, name)
+}
+
+// redact drops a subscription's secret.
+func redact(sub Subscription) Subscription {
+	sub.Secret = ""
+	return sub
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("webhooks: read random secret: %v", err))
+	}
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// newDeliveryID returns an ID that sorts deliveries created at now before
+// older ones, followed by the random half of a new ID.
+func newDeliveryID(now time.Time) string {
+	return fmt.Sprintf("%016x%s", uint64(math.MaxInt64-now.UnixNano()), id.New("")[10:])
+}
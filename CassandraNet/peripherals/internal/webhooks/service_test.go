@@ -0,0 +1,204 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now, _ = time.Parse(time.RFC3339, s)
+}
+
+func do(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	var got []received
+	failures := map[string]int{"/flaky": 2, "/down": 1 << 30}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, received{header: r.Header.Clone(), body: body})
+		if failures[r.URL.Path] > 0 {
+			failures[r.URL.Path]--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	clock := &fakeClock{}
+	clock.Set("2026-01-01T00:00:00Z")
+	svc := NewService(NewMemoryStore(), nil, Config{
+		Events:      []string{"ugc.content_reviewed", "orchestration.assignment_completed"},
+		MaxAttempts: 3,
+		MinBackoff:  time.Minute,
+	}, clock, nil)
+	server := httptest.NewServer(svc.Handler())
+	defer server.Close()
+	hook := server.URL + "/webhooks/reviews?project_id=p1"
+	tick := func(at string) {
+		t.Helper()
+		clock.Set(at)
+		if err := svc.Tick(context.Background()); err != nil {
+			t.Fatalf("tick at %s: %v", at, err)
+		}
+	}
+	deliveries := func(id, status string) []Delivery {
+		t.Helper()
+		resp := do(t, http.MethodGet, server.URL+"/webhooks/"+id+"/deliveries?project_id=p1&status="+status, "")
+		var page struct {
+			Items []Delivery `json:"items"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&page) != nil {
+			t.Fatalf("deliveries of %s: %d", id, resp.StatusCode)
+		}
+		return page.Items
+	}
+
+	for _, body := range []string{
+		`{"url": "ftp://example.com", "events": ["ugc.content_reviewed"]}`,
+		`{"url": "` + receiver.URL + `", "events": []}`,
+		`{"url": "` + receiver.URL + `", "events": ["ugc.content_deleted"]}`,
+		`{"url": "` + receiver.URL + `", "events": ["*"], "secret": "short"}`,
+	} {
+		if resp := do(t, http.MethodPut, hook, body); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+
+	const secret = "0123456789abcdef"
+	resp := do(t, http.MethodPut, hook, `{"url": "`+receiver.URL+`/flaky", "events": ["ugc.content_reviewed"], "secret": "`+secret+`"}`)
+	var created Subscription
+	if resp.StatusCode != http.StatusCreated || json.NewDecoder(resp.Body).Decode(&created) != nil || created.Secret != secret {
+		t.Fatalf("create: %d %+v", resp.StatusCode, created)
+	}
+	resp = do(t, http.MethodGet, hook, "")
+	var read Subscription
+	if json.NewDecoder(resp.Body).Decode(&read) != nil || read.Secret != "" || read.Version != 1 {
+		t.Fatalf("read back: %+v", read)
+	}
+
+	ctx := context.Background()
+	svc.Emit(ctx, Event{ID: "e1", Name: "ugc.content_reviewed", TenantID: "t1", ProjectID: "p1", Data: map[string]string{"content_id": "c1"}})
+	// Not selected, not offered, and out of scope.
+	svc.Emit(ctx, Event{Name: "orchestration.assignment_completed", ProjectID: "p1"})
+	svc.Emit(ctx, Event{Name: "ugc.content_deleted", ProjectID: "p1"})
+	svc.Emit(ctx, Event{Name: "ugc.content_reviewed", ProjectID: "p2"})
+
+	// Two failures back off one and then two minutes before the third
+	// attempt succeeds.
+	tick("2026-01-01T00:00:00Z")
+	tick("2026-01-01T00:00:30Z")
+	tick("2026-01-01T00:01:00Z")
+	tick("2026-01-01T00:02:00Z")
+	if len(got) != 2 {
+		t.Fatalf("expected 2 attempts before the backoff ends, got %d", len(got))
+	}
+	tick("2026-01-01T00:03:00Z")
+	if len(got) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(got))
+	}
+	last := got[2]
+	if err := Verify(secret, last.header, last.body, clock.Now(), 5*time.Minute); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if last.header.Get(HeaderEvent) != "ugc.content_reviewed" || last.header.Get(HeaderID) != got[0].header.Get(HeaderID) {
+		t.Fatalf("headers: %v", last.header)
+	}
+	var event Event
+	if json.Unmarshal(last.body, &event) != nil || event.ID != "e1" || event.TenantID != "t1" {
+		t.Fatalf("payload: %s", last.body)
+	}
+	logged := deliveries("reviews", "")
+	if len(logged) != 1 || logged[0].Status != DeliverySucceeded || logged[0].Attempts != 3 || len(logged[0].History) != 3 || logged[0].History[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("delivery log: %+v", logged)
+	}
+
+	// A delivery that runs out of attempts waits for a redrive.
+	do(t, http.MethodPut, server.URL+"/webhooks/down?project_id=p1", `{"url": "`+receiver.URL+`/down", "events": ["*"]}`)
+	svc.Emit(ctx, Event{Name: "orchestration.assignment_completed", ProjectID: "p1"})
+	tick("2026-01-01T01:00:00Z")
+	tick("2026-01-01T01:01:00Z")
+	tick("2026-01-01T01:03:00Z")
+	tick("2026-01-01T02:00:00Z")
+	failed := deliveries("down", string(DeliveryFailed))
+	if len(failed) != 1 || failed[0].Attempts != 3 || failed[0].Error == "" {
+		t.Fatalf("failed deliveries: %+v", failed)
+	}
+	redrive := server.URL + "/webhooks/down/deliveries/" + failed[0].ID + "/redrive?project_id=p1"
+	if resp := do(t, http.MethodPost, redrive, ""); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("redrive: %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodPost, redrive, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 redriving a pending delivery, got %d", resp.StatusCode)
+	}
+	mu.Lock()
+	failures["/down"] = 0
+	mu.Unlock()
+	tick("2026-01-01T02:00:00Z")
+	if logged := deliveries("down", ""); logged[0].Status != DeliverySucceeded || logged[0].Attempts != 1 || len(logged[0].History) != 4 {
+		t.Fatalf("redriven delivery: %+v", logged[0])
+	}
+
+	if resp := do(t, http.MethodDelete, hook, ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	if resp := do(t, http.MethodGet, server.URL+"/webhooks/reviews/deliveries?project_id=p1", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a deleted subscription's deliveries, got %d", resp.StatusCode)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	body := []byte(`{"id":"e1"}`)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1800000000")
+	header.Set(HeaderSignature, "v1=stale, "+Sign("secret-one-234567", now.Unix(), body))
+	if err := Verify("secret-one-234567", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	for name, check := range map[string]func() error{
+		"wrong secret": func() error { return Verify("secret-two-234567", header, body, now, 0) },
+		"altered body": func() error { return Verify("secret-one-234567", header, []byte(`{"id":"e2"}`), now, 0) },
+		"replayed":     func() error { return Verify("secret-one-234567", header, body, now.Add(time.Hour), 5*time.Minute) },
+	} {
+		if err := check(); err != ErrInvalidSignature {
+			t.Errorf("%s: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+}
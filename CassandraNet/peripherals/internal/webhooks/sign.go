@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every delivery. The ID stays the same across a
+// delivery's attempts.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// signatureVersion prefixes signatures so the scheme can change without
+// breaking receivers.
+const signatureVersion = "v1="
+
+// ErrInvalidSignature is returned by Verify for a delivery that was not
+// signed with the secret or whose timestamp is too old.
+var ErrInvalidSignature = errors.New("webhooks: invalid signature")
+
+// Sign returns the Webhook-Signature of body sent at timestamp (Unix
+// seconds): "v1=" and the hex HMAC-SHA256, keyed by secret, of the
+// timestamp, ".", and the body.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a received delivery's signature against secret. The
+// signature header may hold several comma-separated signatures, any of
+// which may match. When tolerance is positive, deliveries timestamped
+// further than it from now are rejected, which stops replays.
+func Verify(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		skew := now.Sub(time.Unix(timestamp, 0))
+		if skew > tolerance || skew < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+	want := Sign(secret, timestamp, body)
+	for _, got := range strings.Split(header.Get(HeaderSignature), ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(got)), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
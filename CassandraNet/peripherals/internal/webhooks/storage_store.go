@@ -0,0 +1,468 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/encryption"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/pagination"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/storage"
+)
+
+// Buckets holding subscriptions and deliveries as JSON. Subscriptions are
+// keyed by "{project}/{tenant}/{id}", with the IDs path-escaped and the
+// tenant empty for project-wide subscriptions, and deliveries by the
+// subscription's key, "/", and the delivery ID. The queue indexes pending
+// deliveries by their next attempt, "{unix nanos as hex}/{delivery key}",
+// so due deliveries are one ordered scan.
+const (
+	subscriptionBucket = "webhooks.subscriptions"
+	deliveryBucket     = "webhooks.deliveries"
+	queueBucket        = "webhooks.queue"
+)
+
+// ResealName names the records SetKeyring registers for rotation.
+const ResealName = "webhooks.deliveries"
+
+// storedDelivery is a Delivery as stored. SealedPayload holds the payload
+// in place of Payload when the store has a keyring.
+type storedDelivery struct {
+	Delivery
+	SealedPayload []byte `json:"sealed_payload,omitempty"`
+}
+
+// StorageStore implements Store on a storage driver.
+type StorageStore struct {
+	db   storage.Driver
+	keys *encryption.Keyring
+}
+
+// NewStorageStore returns a store keeping subscriptions and deliveries in
+// db.
+func NewStorageStore(db storage.Driver) *StorageStore {
+	return &StorageStore{db: db}
+}
+
+// NewMemoryStore returns a store backed by an in-process memory driver.
+func NewMemoryStore() *StorageStore {
+	return NewStorageStore(storage.NewMemory())
+}
+
+// SetKeyring seals delivery payloads with k before storing them and
+// registers the deliveries with k for rotation. Deliveries stored before
+// are read as they are and sealed by the next rotation. Call it before the
+// store is used.
+func (s *StorageStore) SetKeyring(k *encryption.Keyring) {
+	s.keys = k
+	k.Register(encryption.Resealer{Name: ResealName, Reseal: s.reseal})
+}
+
+// GetSubscription returns the scope's subscription with id.
+func (s *StorageStore) GetSubscription(ctx context.Context, scope Scope, id string) (Subscription, error) {
+	var sub Subscription
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		sub, err = getSubscription(tx, scope, id)
+		return err
+	})
+	return sub, storeError(err)
+}
+
+// PutSubscription creates or replaces a subscription, checking ifVersion
+// against the stored one. An empty secret keeps the stored secret, or
+// generates one for a new subscription.
+func (s *StorageStore) PutSubscription(ctx context.Context, sub Subscription, ifVersion int64) (Subscription, bool, error) {
+	var stored Subscription
+	var created bool
+	scope := Scope{TenantID: sub.TenantID, ProjectID: sub.ProjectID}
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		stored, created = sub, false
+		existing, err := getSubscription(tx, scope, sub.ID)
+		switch {
+		case errors.Is(err, ErrSubscriptionNotFound):
+			if ifVersion != 0 {
+				return ErrPreconditionFailed
+			}
+			created = true
+			stored.Version = 1
+			if stored.Secret == "" {
+				stored.Secret = NewSecret()
+			}
+		case err != nil:
+			return err
+		default:
+			if ifVersion != 0 && ifVersion != existing.Version {
+				return ErrPreconditionFailed
+			}
+			stored.Version = existing.Version + 1
+			stored.CreatedAt = existing.CreatedAt
+			if stored.Secret == "" {
+				stored.Secret = existing.Secret
+			}
+		}
+		return putJSON(tx, subscriptionBucket, subscriptionKey(scope, sub.ID), stored)
+	})
+	if err != nil {
+		return Subscription{}, false, storeError(err)
+	}
+	return stored, created, nil
+}
+
+// DeleteSubscription removes the scope's subscription with id and its
+// deliveries.
+func (s *StorageStore) DeleteSubscription(ctx context.Context, scope Scope, id string) (Subscription, error) {
+	var sub Subscription
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if sub, err = getSubscription(tx, scope, id); err != nil {
+			return err
+		}
+		var deliveries []Delivery
+		err = tx.Scan(deliveryBucket, subscriptionKey(scope, id)+"/", func(_ string, value []byte) error {
+			var d Delivery
+			if err := json.Unmarshal(value, &d); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			if err := deleteDelivery(tx, d); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(subscriptionBucket, subscriptionKey(scope, id))
+	})
+	return sub, storeError(err)
+}
+
+// ListSubscriptions returns one page of the scope's subscriptions, ordered
+// by ID.
+func (s *StorageStore) ListSubscriptions(ctx context.Context, scope Scope, page pagination.Request) ([]Subscription, string, error) {
+	return scanPage(ctx, s.db, subscriptionBucket, scopePrefix(scope), page, decodeJSON[Subscription], nil)
+}
+
+// Subscribers returns the tenant's subscriptions in the project and the
+// project-wide ones.
+func (s *StorageStore) Subscribers(ctx context.Context, tenantID, projectID string) ([]Subscription, error) {
+	scopes := []Scope{{ProjectID: projectID}}
+	if tenantID != "" {
+		scopes = append(scopes, Scope{TenantID: tenantID, ProjectID: projectID})
+	}
+	var subs []Subscription
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		subs = nil
+		for _, scope := range scopes {
+			err := tx.Scan(subscriptionBucket, scopePrefix(scope), func(_ string, value []byte) error {
+				var sub Subscription
+				if err := json.Unmarshal(value, &sub); err != nil {
+					return err
+				}
+				subs = append(subs, sub)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return subs, nil
+}
+
+// Enqueue stores new deliveries and queues them for their first attempt.
+func (s *StorageStore) Enqueue(ctx context.Context, deliveries []Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return storeError(storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		for _, d := range deliveries {
+			if err := s.putDelivery(ctx, tx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// Due returns up to limit pending deliveries, in any scope, whose next
+// attempt is at or before now, earliest first.
+func (s *StorageStore) Due(ctx context.Context, now time.Time, limit int) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		deliveries = nil
+		var keys []string
+		err := tx.Scan(queueBucket, "", func(key string, value []byte) error {
+			at, err := strconv.ParseUint(key[:16], 16, 64)
+			if err != nil {
+				return fmt.Errorf("webhooks: malformed queue key %q", key)
+			}
+			if int64(at) > now.UnixNano() || len(keys) == limit {
+				return storage.StopScan
+			}
+			keys = append(keys, string(value))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			data, err := tx.Get(deliveryBucket, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			d, err := s.decodeDelivery(ctx, data)
+			if err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return deliveries, nil
+}
+
+// GetDelivery returns a subscription's delivery with id.
+func (s *StorageStore) GetDelivery(ctx context.Context, scope Scope, subscriptionID, id string) (Delivery, error) {
+	var d Delivery
+	err := storage.View(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		d, err = s.getDelivery(ctx, tx, scope, subscriptionID, id)
+		return err
+	})
+	return d, storeError(err)
+}
+
+// UpdateDelivery applies fn to a delivery and stores the result, moving it
+// in the queue to match its status and next attempt, in one transaction.
+// An error from fn leaves the delivery unchanged.
+func (s *StorageStore) UpdateDelivery(ctx context.Context, scope Scope, subscriptionID, id string, fn func(*Delivery) error) (Delivery, error) {
+	var d Delivery
+	err := storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var err error
+		if d, err = s.getDelivery(ctx, tx, scope, subscriptionID, id); err != nil {
+			return err
+		}
+		if d.Status == DeliveryPending {
+			if err := tx.Delete(queueBucket, queueKey(d)); err != nil {
+				return err
+			}
+		}
+		if err := fn(&d); err != nil {
+			return err
+		}
+		return s.putDelivery(ctx, tx, d)
+	})
+	return d, storeError(err)
+}
+
+// Deliveries returns one page of a subscription's deliveries, newest first,
+// limited to status when it is not empty.
+func (s *StorageStore) Deliveries(ctx context.Context, scope Scope, subscriptionID string, status DeliveryStatus, page pagination.Request) ([]Delivery, string, error) {
+	var keep func(Delivery) bool
+	if status != "" {
+		keep = func(d Delivery) bool { return d.Status == status }
+	}
+	decode := func(data []byte) (Delivery, error) { return s.decodeDelivery(ctx, data) }
+	return scanPage(ctx, s.db, deliveryBucket, subscriptionKey(scope, subscriptionID)+"/", page, decode, keep)
+}
+
+// PruneDeliveries deletes a subscription's finished deliveries beyond its
+// keep newest ones. Pending deliveries are kept.
+func (s *StorageStore) PruneDeliveries(ctx context.Context, scope Scope, subscriptionID string, keep int) error {
+	return storeError(storage.Update(ctx, s.db, func(tx storage.Tx) error {
+		var stale []Delivery
+		seen := 0
+		err := tx.Scan(deliveryBucket, subscriptionKey(scope, subscriptionID)+"/", func(_ string, value []byte) error {
+			if seen++; seen <= keep {
+				return nil
+			}
+			var d Delivery
+			if err := json.Unmarshal(value, &d); err != nil {
+				return err
+			}
+			if d.Status != DeliveryPending {
+				stale = append(stale, d)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, d := range stale {
+			if err := deleteDelivery(tx, d); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func scanPage[T any](ctx context.Context, db storage.Driver, bucket, prefix string, page pagination.Request, decode func([]byte) (T, error), keep func(T) bool) ([]T, string, error) {
+	collector := pagination.NewCollector[T](page)
+	err := storage.View(ctx, db, func(tx storage.Tx) error {
+		return tx.Scan(bucket, prefix, func(key string, value []byte) error {
+			if collector.Skip(key) {
+				return nil
+			}
+			item, err := decode(value)
+			if err != nil {
+				return err
+			}
+			if keep != nil && !keep(item) {
+				return nil
+			}
+			if !collector.Add(key, item) {
+				return storage.StopScan
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, "", storeError(err)
+	}
+	items, next := collector.Page()
+	return items, next, nil
+}
+
+func decodeJSON[T any](data []byte) (T, error) {
+	var item T
+	err := json.Unmarshal(data, &item)
+	return item, err
+}
+
+func scopePrefix(scope Scope) string {
+	return url.PathEscape(scope.ProjectID) + "/" + url.PathEscape(scope.TenantID) + "/"
+}
+
+func subscriptionKey(scope Scope, id string) string {
+	return scopePrefix(scope) + id
+}
+
+func deliveryKey(d Delivery) string {
+	return subscriptionKey(Scope{TenantID: d.TenantID, ProjectID: d.ProjectID}, d.SubscriptionID) + "/" + d.ID
+}
+
+func queueKey(d Delivery) string {
+	return fmt.Sprintf("%016x/%s", uint64(d.NextAttemptAt.UnixNano()), deliveryKey(d))
+}
+
+func getSubscription(tx storage.Tx, scope Scope, id string) (Subscription, error) {
+	data, err := tx.Get(subscriptionBucket, subscriptionKey(scope, id))
+	if errors.Is(err, storage.ErrNotFound) {
+		return Subscription{}, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return Subscription{}, err
+	}
+	var sub Subscription
+	err = json.Unmarshal(data, &sub)
+	return sub, err
+}
+
+func (s *StorageStore) getDelivery(ctx context.Context, tx storage.Tx, scope Scope, subscriptionID, id string) (Delivery, error) {
+	data, err := tx.Get(deliveryBucket, subscriptionKey(scope, subscriptionID)+"/"+id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+	return s.decodeDelivery(ctx, data)
+}
+
+// decodeDelivery decodes a stored delivery, opening its payload.
+func (s *StorageStore) decodeDelivery(ctx context.Context, data []byte) (Delivery, error) {
+	var stored storedDelivery
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return Delivery{}, err
+	}
+	if stored.SealedPayload != nil {
+		payload, err := s.keys.Open(ctx, stored.SealedPayload)
+		if err != nil {
+			return Delivery{}, err
+		}
+		stored.Payload = payload
+	}
+	return stored.Delivery, nil
+}
+
+// putDelivery stores d, its payload sealed when the store has a keyring,
+// and, while it is pending, its queue entry.
+func (s *StorageStore) putDelivery(ctx context.Context, tx storage.Tx, d Delivery) error {
+	stored := storedDelivery{Delivery: d}
+	if s.keys.Enabled() {
+		sealed, err := s.keys.Seal(ctx, d.Payload)
+		if err != nil {
+			return err
+		}
+		stored.Payload, stored.SealedPayload = nil, sealed
+	}
+	if err := putJSON(tx, deliveryBucket, deliveryKey(d), stored); err != nil {
+		return err
+	}
+	if d.Status != DeliveryPending {
+		return nil
+	}
+	return tx.Put(queueBucket, queueKey(d), []byte(deliveryKey(d)))
+}
+
+// reseal re-seals the stored payloads not sealed under the active key.
+func (s *StorageStore) reseal(ctx context.Context) (int, int, error) {
+	resealed, skipped, err := encryption.ResealBucket(ctx, s.db, deliveryBucket, "", func(_ string, value []byte) ([]byte, error) {
+		var stored storedDelivery
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return nil, err
+		}
+		sealed, err := s.keys.Reseal(ctx, stored.SealedPayload, stored.Payload)
+		if sealed == nil || err != nil {
+			return nil, err
+		}
+		stored.Payload, stored.SealedPayload = nil, sealed
+		return json.Marshal(stored)
+	})
+	return resealed, skipped, storeError(err)
+}
+
+func deleteDelivery(tx storage.Tx, d Delivery) error {
+	if d.Status == DeliveryPending {
+		if err := tx.Delete(queueBucket, queueKey(d)); err != nil {
+			return err
+		}
+	}
+	return tx.Delete(deliveryBucket, deliveryKey(d))
+}
+
+func putJSON(tx storage.Tx, bucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tx.Put(bucket, key, data)
+}
+
+// storeError marks driver failures so handlers can tell them from bad
+// requests and the package's own outcomes.
+func storeError(err error) error {
+	if err == nil || errors.Is(err, ErrSubscriptionNotFound) || errors.Is(err, ErrDeliveryNotFound) || errors.Is(err, ErrPreconditionFailed) || errors.Is(err, ErrNotFailed) || errors.Is(err, errNotDue) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrStore, err)
+}
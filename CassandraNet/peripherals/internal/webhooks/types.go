@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is something a service reports to webhook subscribers.
+type Event struct {
+	// ID identifies the event; receivers use it to drop duplicates.
+	// Emit generates one when it is empty.
+	ID string `json:"id"`
+	// Name is the event type, such as "ugc.content_reviewed".
+	Name string `json:"event"`
+	// TenantID and ProjectID select the subscriptions notified. Events
+	// without a project reach none.
+	TenantID   string    `json:"tenant_id,omitempty"`
+	ProjectID  string    `json:"project_id,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Data is the event's JSON body.
+	Data any `json:"data"`
+}
+
+// Subscription sends a project's, or one tenant's, events to a URL.
+type Subscription struct {
+	ID        string `json:"id"`
+	TenantID  string `json:"tenant_id,omitempty"`
+	ProjectID string `json:"project_id"`
+	URL       string `json:"url"`
+	// Events lists the event names delivered; "*" selects every event the
+	// service offers.
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	// Secret signs deliveries. It is returned when the subscription is
+	// saved and never read back.
+	Secret    string    `json:"secret,omitempty"`
+	Disabled  bool      `json:"disabled"`
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeliveryStatus is the state of a delivery.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries wait for their next attempt.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliverySucceeded deliveries were answered with a 2xx status.
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryFailed deliveries ran out of attempts, or their subscription
+	// was disabled, and wait for a redrive.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Delivery is one event on its way to one subscription, with a log of the
+// attempts made.
+type Delivery struct {
+	// ID sorts a subscription's deliveries newest first.
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	TenantID       string          `json:"tenant_id,omitempty"`
+	ProjectID      string          `json:"project_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	// Attempts counts the tries since the delivery was created or last
+	// redriven.
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at,omitzero"`
+	// History holds the most recent attempts, oldest first.
+	History   []Attempt `json:"history,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Attempt records one try at a delivery.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// SubscriptionRequest defines a subscription.
+type SubscriptionRequest struct {
+	ID          string
+	TenantID    string
+	ProjectID   string
+	URL         string
+	Events      []string
+	Description string
+	// Secret replaces the signing secret. An empty secret keeps the stored
+	// one, or generates one for a new subscription.
+	Secret   string
+	Disabled bool
+	// IfVersion, when non-zero, must equal the stored subscription's
+	// version.
+	IfVersion int64
+}
+
+// Scope names a project and optionally one tenant of it.
+type Scope struct {
+	TenantID  string
+	ProjectID string
+}
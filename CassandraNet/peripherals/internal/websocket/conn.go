@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxControlPayload is the largest payload a control frame may carry.
+const maxControlPayload = 125
+
+// transport is the connection under a Conn: a hijacked net.Conn on the
+// server, or the body of a 101 response on the client.
+type transport interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// streamConn adapts a connection without deadlines.
+type streamConn struct {
+	io.ReadWriteCloser
+}
+
+func (streamConn) SetReadDeadline(time.Time) error  { return nil }
+func (streamConn) SetWriteDeadline(time.Time) error { return nil }
+
+// Conn is an open WebSocket connection.
+type Conn struct {
+	conn   transport
+	br     *bufio.Reader
+	client bool
+	opts   Options
+
+	readTimeout time.Duration
+
+	wmu    sync.Mutex
+	bw     *bufio.Writer
+	closed bool
+}
+
+func newConn(conn transport, br *bufio.Reader, client bool, opts Options) *Conn {
+	return &Conn{conn: conn, br: br, client: client, opts: opts, bw: bufio.NewWriter(conn)}
+}
+
+// SetReadTimeout makes ReadMessage fail when no frame, pongs included,
+// arrives within d of the previous one; zero waits forever. Pair it with
+// periodic Pings so an idle but healthy peer keeps the connection open.
+// Call it before reading.
+func (c *Conn) SetReadTimeout(d time.Duration) {
+	c.readTimeout = d
+}
+
+// ReadMessage returns the next text or binary message. It answers pings
+// and the closing handshake on the way: when the peer closes, or breaks
+// the protocol, ReadMessage closes the connection and returns a
+// *CloseError. Text messages are checked to be valid UTF-8.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	var text, started bool
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, c.fail(err)
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return nil, c.closeFromPeer(payload)
+		case opText, opBinary:
+			if started {
+				return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "new message before the previous one ended"})
+			}
+			started, text = true, op == opText
+		case opContinuation:
+			if !started {
+				return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: "continuation without a message"})
+			}
+		default:
+			return nil, c.fail(&CloseError{Code: CloseProtocolError, Reason: fmt.Sprintf("unknown opcode %d", op)})
+		}
+		if int64(len(message)+len(payload)) > c.opts.MaxMessageBytes {
+			return nil, c.fail(&CloseError{Code: CloseTooBig, Reason: "message too big"})
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+		if text && !utf8.Valid(message) {
+			return nil, c.fail(&CloseError{Code: CloseInvalidPayload, Reason: "text message is not valid UTF-8"})
+		}
+		return message, nil
+	}
+}
+
+// readFrame reads one frame and unmasks its payload.
+func (c *Conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0f
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "reserved bits set without an extension"}
+	}
+	masked := head[1]&0x80 != 0
+	if masked == c.client {
+		// Clients must mask every frame and servers must not.
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "frame masking is wrong for this side"}
+	}
+	size := uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (!fin || size > maxControlPayload) {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "control frames must be whole and short"}
+	}
+	if size > uint64(c.opts.MaxMessageBytes) {
+		return false, 0, nil, &CloseError{Code: CloseTooBig, Reason: "message too big"}
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// closeFromPeer answers a close frame with the same code and closes the
+// connection.
+func (c *Conn) closeFromPeer(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNormal}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+	_ = c.Close(closeErr.Code, "")
+	return closeErr
+}
+
+// fail closes the connection after a read error, telling the peer why
+// when it broke the protocol.
+func (c *Conn) fail(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		_ = c.Close(closeErr.Code, closeErr.Reason)
+		return err
+	}
+	_ = c.closeTransport()
+	return err
+}
+
+// WriteText sends p as one text message.
+func (c *Conn) WriteText(p []byte) error {
+	return c.writeFrame(opText, p)
+}
+
+// WriteJSON sends v encoded as JSON in one text message.
+func (c *Conn) WriteJSON(v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, payload)
+}
+
+// Ping sends a ping, which the peer answers with a pong that ReadMessage
+// consumes.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with code and reason, then closes the
+// connection without waiting for the peer's reply. It is safe to call more
+// than once; later calls do nothing.
+func (c *Conn) Close(code int, reason string) error {
+	if len(reason) > maxControlPayload-2 {
+		reason = reason[:maxControlPayload-2]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	if err := c.writeFrame(opClose, payload); err != nil && !errors.Is(err, ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (c *Conn) closeTransport() error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// writeFrame writes one whole frame, masked on the client.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	header := []byte{0x80 | op, 0}
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n <= maxControlPayload:
+		header[1] = maskBit | byte(n)
+	case n <= 0xffff:
+		header[1] = maskBit | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = maskBit | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if c.client {
+		var mask [4]byte
+		_, _ = rand.Read(mask[:])
+		header = append(header, mask[:]...)
+		masked := make([]byte, len(payload))
+		for i, b := range payload {
+			masked[i] = b ^ mask[i%4]
+		}
+		payload = masked
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	_, _ = c.bw.Write(header)
+	_, _ = c.bw.Write(payload)
+	err := c.bw.Flush()
+	if err != nil || op == opClose {
+		// A failed write leaves the stream unusable, and nothing may
+		// follow a close frame.
+		c.closed = true
+		if closeErr := c.conn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
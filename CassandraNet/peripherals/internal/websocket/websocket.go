@@ -0,0 +1,243 @@
+// Package websocket implements the WebSocket protocol (RFC 6455) on top of
+// net/http, enough for services to push JSON messages to dashboards and
+// read small commands back: the opening handshake, text and binary
+// messages split across frames, pings, and the closing handshake.
+// Extensions and subprotocols are not negotiated.
+//
+// Upgrade turns a request into a server Conn. Dial opens a client Conn,
+// used by tests and tools. A Conn may be written from several goroutines
+// but read from one.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+)
+
+// Close codes sent in close frames.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseTooBig          = 1009
+	CloseInternalError   = 1011
+)
+
+// Defaults of Options.
+const (
+	DefaultMaxMessageBytes = 64 << 10
+	DefaultWriteTimeout    = 10 * time.Second
+)
+
+// acceptGUID is appended to the client's key to derive Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// ErrClosed is returned by writes after the connection was closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by ReadMessage when the peer closed the
+// connection, or when the connection was closed for breaking the protocol.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket: closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket: closed with code %d: %s", e.Code, e.Reason)
+}
+
+// Options tunes a Conn. Zero values select the defaults.
+type Options struct {
+	// CheckOrigin approves the Origin header of a browser's handshake. The
+	// default accepts handshakes without one and those whose origin names
+	// the request's own host, so pages on other sites cannot connect with
+	// a visitor's ambient credentials.
+	CheckOrigin func(r *http.Request) bool
+	// MaxMessageBytes bounds a received message; a larger one closes the
+	// connection with CloseTooBig (default 64 KiB).
+	MaxMessageBytes int64
+	// WriteTimeout bounds each write, so a peer that stops reading cannot
+	// block the writer forever (default 10s).
+	WriteTimeout time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.CheckOrigin == nil {
+		o.CheckOrigin = sameOrigin
+	}
+	if o.MaxMessageBytes <= 0 {
+		o.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = DefaultWriteTimeout
+	}
+	return o
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// IsUpgrade reports whether r asks to switch to the WebSocket protocol.
+func IsUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && headerHasToken(r.Header, "Upgrade", "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the opening handshake of r and returns the connection.
+// When the handshake cannot complete, Upgrade writes a problem with a code
+// under service and returns an error: 405 for methods other than GET, 426
+// with code "<service>.upgrade_required" for requests that are not a
+// WebSocket handshake, 403 with "<service>.origin_forbidden" for a refused
+// Origin, and 501 with "<service>.websocket_unsupported" when w cannot be
+// hijacked, as on HTTP/2 connections.
+func Upgrade(w http.ResponseWriter, r *http.Request, service string, opts Options) (*Conn, error) {
+	opts = opts.withDefaults()
+	if r.Method != http.MethodGet {
+		problem.MethodNotAllowed(w, r, service, http.MethodGet)
+		return nil, errors.New("websocket: handshake must use GET")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !IsUpgrade(r) || r.Header.Get("Sec-WebSocket-Version") != "13" || !validKey(key) {
+		w.Header().Set("Upgrade", "websocket")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		problem.Write(w, r, http.StatusUpgradeRequired, service+".upgrade_required", "this endpoint only speaks WebSocket (version 13)")
+		return nil, errors.New("websocket: not a handshake")
+	}
+	if !opts.CheckOrigin(r) {
+		problem.Write(w, r, http.StatusForbidden, service+".origin_forbidden", "origin "+r.Header.Get("Origin")+" is not allowed")
+		return nil, errors.New("websocket: origin not allowed")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		problem.Write(w, r, http.StatusNotImplemented, service+".websocket_unsupported", "WebSocket is not supported on this connection")
+		return nil, errors.New("websocket: response writer cannot be hijacked")
+	}
+	netConn, rw, err := hijacker.Hijack()
+	if err != nil {
+		problem.Write(w, r, http.StatusNotImplemented, service+".websocket_unsupported", "WebSocket is not supported on this connection")
+		return nil, fmt.Errorf("websocket: hijack: %w", err)
+	}
+	// The server may have set deadlines for the request; the connection
+	// now outlives it.
+	_ = netConn.SetDeadline(time.Time{})
+	c := newConn(netConn, rw.Reader, false, opts)
+	_ = netConn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+	_, err = fmt.Fprintf(c.bw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err == nil {
+		err = c.bw.Flush()
+	}
+	if err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("websocket: write handshake: %w", err)
+	}
+	return c, nil
+}
+
+func validKey(key string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	return err == nil && len(decoded) == 16
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Dial opens a client connection to rawURL (ws://, wss://, http://, or
+// https://), sending header with the handshake. A refused handshake
+// returns an error carrying the response status.
+func Dial(ctx context.Context, rawURL string, header http.Header, opts Options) (*Conn, error) {
+	opts = opts.withDefaults()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: invalid URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	keyBytes := make([]byte, 16)
+	_, _ = rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	// HTTP/2 has no Upgrade, so the handshake is sent over HTTP/1.1; the
+	// transport then returns the connection as the body of the 101.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: dial: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("websocket: handshake refused with %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		_ = resp.Body.Close()
+		return nil, errors.New("websocket: handshake returned a wrong Sec-WebSocket-Accept")
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		_ = resp.Body.Close()
+		return nil, errors.New("websocket: transport did not hand over the connection")
+	}
+	return newConn(streamConn{rwc}, bufio.NewReader(rwc), true, opts), nil
+}
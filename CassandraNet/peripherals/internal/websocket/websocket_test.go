@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoServer upgrades every request and echoes text messages until the
+// client closes, reporting how the connection ended.
+func echoServer(t *testing.T, opts Options) (*httptest.Server, <-chan error) {
+	t.Helper()
+	ended := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, "test", opts)
+		if err != nil {
+			return
+		}
+		for {
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				ended <- err
+				return
+			}
+			if err := conn.Ping(); err != nil {
+				ended <- err
+				return
+			}
+			if err := conn.WriteText(msg); err != nil {
+				ended <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, ended
+}
+
+func TestConnEchoesAndCloses(t *testing.T) {
+	// Allow a message long enough to need the 64-bit length encoding.
+	opts := Options{MaxMessageBytes: 1 << 20}
+	srv, ended := echoServer(t, opts)
+	conn, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil, opts)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	long := strings.Repeat("x", 70000)
+	for _, text := range []string{"hello", strings.Repeat("é", 100), long} {
+		if err := conn.WriteText([]byte(text)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		// The server's ping is answered inside ReadMessage.
+		got, err := conn.ReadMessage()
+		if err != nil || string(got) != text {
+			t.Fatalf("expected the echo of %d bytes, got %d bytes (%v)", len(text), len(got), err)
+		}
+	}
+	if err := conn.Close(CloseNormal, "bye"); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	var closeErr *CloseError
+	if err := <-ended; !errors.As(err, &closeErr) || closeErr.Code != CloseNormal || closeErr.Reason != "bye" {
+		t.Fatalf("expected the server to see a normal close, got %v", err)
+	}
+	if err := conn.WriteText([]byte("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after closing, got %v", err)
+	}
+}
+
+func TestConnClosesOnOversizedMessages(t *testing.T) {
+	srv, ended := echoServer(t, Options{MaxMessageBytes: 8})
+	conn, err := Dial(context.Background(), srv.URL, nil, Options{})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	if err := conn.WriteText([]byte("far too long")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var closeErr *CloseError
+	if err := <-ended; !errors.As(err, &closeErr) || closeErr.Code != CloseTooBig {
+		t.Fatalf("expected the server to close with CloseTooBig, got %v", err)
+	}
+	if _, err := conn.ReadMessage(); !errors.As(err, &closeErr) || closeErr.Code != CloseTooBig {
+		t.Fatalf("expected the client to be told why, got %v", err)
+	}
+}
+
+func TestUpgradeRejectsOtherRequests(t *testing.T) {
+	srv, _ := echoServer(t, Options{})
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUpgradeRequired || resp.Header.Get("Sec-WebSocket-Version") != "13" {
+		t.Fatalf("expected 426 for a plain request, got %d", resp.StatusCode)
+	}
+
+	header := http.Header{"Origin": {"https://evil.example.com"}}
+	if _, err := Dial(context.Background(), srv.URL, header, Options{}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected a foreign origin to be refused, got %v", err)
+	}
+	header.Set("Origin", srv.URL)
+	conn, err := Dial(context.Background(), srv.URL, header, Options{})
+	if err != nil {
+		t.Fatalf("expected the page's own origin to be accepted: %v", err)
+	}
+	_ = conn.Close(CloseNormal, "")
+}
@@ -0,0 +1,400 @@
+// Package client provides typed Go clients for the peripheral service APIs.
+//
+// Each service has its own client, constructed from the service's base URL:
+//
+//	msgs, err := client.NewMessaging("http://localhost:8092", client.WithAPIKey(key))
+//	msg, err := msgs.Publish(ctx, "matches", client.PublishRequest{Payload: body})
+//
+// NewGateway builds all of them against a single cmd/gateway address. Calls
+// take a context, are bounded by a per-attempt timeout, and are retried with
+// exponential backoff when the failure is transient and retrying is safe.
+// Error responses are returned as *Error carrying the service's stable
+// problem code.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default settings applied by every constructor.
+const (
+	DefaultTimeout    = 10 * time.Second
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 200 * time.Millisecond
+	maxBackoff        = 5 * time.Second
+)
+
+// Option configures a client.
+type Option func(*settings)
+
+type settings struct {
+	httpClient *http.Client
+	apiKey     string
+	token      string
+	tenant     string
+	project    string
+	userAgent  string
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+}
+
+// WithHTTPClient sends requests through c, for example one whose transport
+// presents a client certificate. Its Timeout, if any, also applies.
+func WithHTTPClient(c *http.Client) Option {
+	return func(s *settings) { s.httpClient = c }
+}
+
+// WithAPIKey sends key in the X-API-Key header.
+func WithAPIKey(key string) Option {
+	return func(s *settings) { s.apiKey = key }
+}
+
+// WithBearerToken sends token as an Authorization: Bearer credential.
+func WithBearerToken(token string) Option {
+	return func(s *settings) { s.token = token }
+}
+
+// WithTenant sends tenant in the X-Tenant-ID header. Services act for that
+// tenant: requests omitting tenant_id get it, and requests or records
+// naming another are refused.
+func WithTenant(tenant string) Option {
+	return func(s *settings) { s.tenant = tenant }
+}
+
+// WithProject sends project in the X-Project-ID header, scoping requests
+// the way WithTenant does.
+func WithProject(project string) Option {
+	return func(s *settings) { s.project = project }
+}
+
+// WithUserAgent overrides the User-Agent header.
+func WithUserAgent(agent string) Option {
+	return func(s *settings) { s.userAgent = agent }
+}
+
+// WithTimeout bounds each attempt of a call; 0 leaves attempts bounded only
+// by the caller's context.
+func WithTimeout(d time.Duration) Option {
+	return func(s *settings) { s.timeout = d }
+}
+
+// WithRetries sets how many times a failed call is retried and the delay
+// before the first retry, which doubles on each further attempt. max 0
+// disables retries.
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(s *settings) {
+		s.maxRetries = max
+		s.backoff = backoff
+	}
+}
+
+// Error is a failed call's RFC 7807 problem response.
+type Error struct {
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+	// Code is the stable <service>.<reason> code, such as
+	// "messaging.not_found". It is empty when the response was not a
+	// problem document, for example from a proxy.
+	Code      string `json:"code"`
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	RequestID string `json:"request_id"`
+	// InvalidParams lists the request fields that failed validation, for
+	// "<service>.invalid_request" responses.
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+	// RetryAfter is the server's requested delay for 429 and 503 responses.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// InvalidParam is one request field that failed validation. Rule is stable,
+// such as "required", "max_length", or "one_of"; Reason is for humans and
+// completes a sentence starting with the field name.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	if msg == "" {
+		msg = http.StatusText(e.Status)
+	}
+	if e.Code != "" {
+		return fmt.Sprintf("%s (%d %s)", msg, e.Status, e.Code)
+	}
+	return fmt.Sprintf("%s (%d)", msg, e.Status)
+}
+
+// IsCode reports whether err is an *Error with the given problem code.
+func IsCode(err error, code string) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Code == code
+}
+
+// base holds what every typed client shares: where to send requests and how.
+type base struct {
+	url    *url.URL
+	prefix string
+	settings
+}
+
+func newBase(baseURL, prefix string, opts []Option) (*base, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http(s) URL", baseURL)
+	}
+	b := &base{
+		url:    u,
+		prefix: prefix,
+		settings: settings{
+			httpClient: http.DefaultClient,
+			userAgent:  "cassandra-peripherals-go",
+			timeout:    DefaultTimeout,
+			maxRetries: DefaultMaxRetries,
+			backoff:    DefaultBackoff,
+		},
+	}
+	for _, opt := range opts {
+		opt(&b.settings)
+	}
+	return b, nil
+}
+
+// call describes one API call.
+type call struct {
+	method string
+	path   string
+	query  url.Values
+	body   any
+	// raw is sent as the body, as application/octet-stream, in place of
+	// body.
+	raw []byte
+	// header is added to the request, for conditional requests.
+	header http.Header
+	// idempotent calls are also retried after network errors and 502/504,
+	// where the request may have been processed.
+	idempotent bool
+	// hold is how long the service may hold the request open before
+	// answering, added to each attempt's timeout.
+	hold time.Duration
+}
+
+// do runs c, retrying transient failures, and decodes a successful JSON
+// response into out when out is non-nil. An out of type *[]byte receives
+// the response body as it is.
+func (b *base) do(ctx context.Context, c call, out any) error {
+	var payload []byte
+	if c.raw != nil {
+		payload = c.raw
+		c.header = c.header.Clone()
+		if c.header == nil {
+			c.header = http.Header{}
+		}
+		c.header.Set("Content-Type", "application/octet-stream")
+	} else if c.body != nil {
+		var err error
+		if payload, err = json.Marshal(c.body); err != nil {
+			return fmt.Errorf("client: encode request: %w", err)
+		}
+	}
+	target := b.url.JoinPath(b.prefix, c.path)
+	if len(c.query) > 0 {
+		target.RawQuery = c.query.Encode()
+	}
+	ctx = ensureRequestID(ctx)
+
+	delay := b.backoff
+	for attempt := 0; ; attempt++ {
+		err := b.attempt(ctx, c.method, target.String(), c.header, payload, c.hold, out)
+		if err == nil || attempt >= b.maxRetries || !retryable(err, c.idempotent) || ctx.Err() != nil {
+			return err
+		}
+		wait := delay + rand.N(delay/2+1)
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+func (b *base) attempt(ctx context.Context, method, target string, header http.Header, payload []byte, hold time.Duration, out any) error {
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout+hold)
+		defer cancel()
+	}
+	req, err := b.newRequest(ctx, method, target, payload)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		if *raw, err = io.ReadAll(resp.Body); err != nil {
+			return fmt.Errorf("client: read %s response: %w", req.URL.Path, err)
+		}
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("client: decode %s response: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// newRequest builds a request to target carrying the client's credentials,
+// scope headers, the request ID in ctx, and payload as JSON.
+func (b *base) newRequest(ctx context.Context, method, target string, payload []byte) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("client: build request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", b.userAgent)
+	if b.apiKey != "" {
+		req.Header.Set("X-API-Key", b.apiKey)
+	}
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	if b.tenant != "" {
+		req.Header.Set("X-Tenant-ID", b.tenant)
+	}
+	if b.project != "" {
+		req.Header.Set("X-Project-ID", b.project)
+	}
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return req, nil
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		_ = json.Unmarshal(data, apiErr)
+		apiErr.Status = resp.StatusCode
+	} else {
+		apiErr.Detail = strings.TrimSpace(string(data))
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// retryable reports whether a call that failed with err may be sent again.
+// 429 and 503 mean the server declined the request, so any call is retried;
+// other failures may have reached the server and are retried only when the
+// call is idempotent.
+func retryable(err error, idempotent bool) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Status {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return true
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			return idempotent
+		}
+		return false
+	}
+	return idempotent
+}
+
+// Gateway holds a client for every service, all sent through one
+// cmd/gateway address.
+type Gateway struct {
+	Messaging     *Messaging
+	UGC           *UGC
+	Orchestration *Orchestration
+	Notifications *Notifications
+	Logs          *Logs
+	Metrics       *Metrics
+	FeatureFlags  *FeatureFlags
+	Scheduler     *Scheduler
+	Presence      *Presence
+}
+
+// NewGateway builds clients that reach every service through the gateway at
+// baseURL, using the gateway's path prefixes.
+func NewGateway(baseURL string, opts ...Option) (*Gateway, error) {
+	g := &Gateway{}
+	var err error
+	if g.Messaging, err = newMessaging(baseURL, "/messaging", opts); err != nil {
+		return nil, err
+	}
+	if g.UGC, err = newUGC(baseURL, "/ugc", opts); err != nil {
+		return nil, err
+	}
+	if g.Orchestration, err = newOrchestration(baseURL, "/orchestration", opts); err != nil {
+		return nil, err
+	}
+	if g.Notifications, err = NewNotifications(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	if g.Logs, err = NewLogs(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	if g.Metrics, err = NewMetrics(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	if g.FeatureFlags, err = NewFeatureFlags(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	if g.Scheduler, err = NewScheduler(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	if g.Presence, err = NewPresence(baseURL, opts...); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
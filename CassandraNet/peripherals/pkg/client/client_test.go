@@ -0,0 +1,437 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/featureflags"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/gateway"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/messaging"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/metricscollector"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/orchestration"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/problem"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/registry"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/ugc"
+	"github.com/WatchDogStudios/CassandraNet/peripherals/internal/webhooks"
+)
+
+type noopLogger struct{}
+
+func (noopLogger) Printf(string, ...any) {}
+
+// newTestGateway serves the real service handlers behind the gateway's
+// routes, so the tests exercise the same wire format clients see.
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+	metrics := metricscollector.NewService(metricscollector.NewAggregator(), noopLogger{}).Handler()
+	gw, err := gateway.New([]gateway.Route{
+		{Name: "messaging", Patterns: []string{"/messaging/"}, Strip: "/messaging", Handler: messaging.NewService(messaging.NewMemoryStore(), nil).Handler()},
+		{Name: "ugc", Patterns: []string{"/ugc/"}, Strip: "/ugc", Handler: ugc.NewService(ugc.NewMemoryStore(), nil).Handler()},
+		{Name: "orchestration", Patterns: []string{"/orchestration/"}, Strip: "/orchestration", Handler: orchestration.NewService(orchestration.NewMemoryStore(), nil).Handler()},
+		{Name: "metrics", Patterns: []string{"/metrics/"}, Handler: metrics},
+		{Name: "feature-flags", Patterns: []string{"/flags", "/flags/"}, Handler: featureflags.NewService(featureflags.NewMemoryStore(), nil).Handler()},
+	}, nil, noopLogger{})
+	if err != nil {
+		t.Fatalf("gateway: %v", err)
+	}
+	srv := httptest.NewServer(gw.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGatewayClients(t *testing.T) {
+	srv := newTestGateway(t)
+	c, err := NewGateway(srv.URL, WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("new gateway client: %v", err)
+	}
+	ctx := context.Background()
+
+	published, err := c.Messaging.Publish(ctx, "match events", PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte("hello"), Priority: PriorityHigh})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	pulled, err := c.Messaging.Pull(ctx, "match events", PullOptions{TenantID: "acme"})
+	if err != nil || len(pulled) != 1 || string(pulled[0].Payload) != "hello" || pulled[0].MessageID != published.MessageID {
+		t.Fatalf("pull: %v %+v", err, pulled)
+	}
+	if err := c.Messaging.Ack(ctx, "match events", published.MessageID); err != nil {
+		t.Fatalf("ack: %v", err)
+	}
+	if err := c.Messaging.Ack(ctx, "match events", published.MessageID); !IsCode(err, "messaging.not_found") {
+		t.Fatalf("expected messaging.not_found on second ack, got %v", err)
+	}
+
+	if _, err := c.UGC.SubmitContent(ctx, SubmitRequest{ContentID: "c1", TenantID: "acme", ProjectID: "p1", Filename: "map.png"}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	reviewed, err := c.UGC.Review(ctx, "c1", ReviewRequest{State: StateApproved})
+	if err != nil || reviewed.State != StateApproved {
+		t.Fatalf("review: %v %+v", err, reviewed)
+	}
+	_, err = c.UGC.SubmitContent(ctx, SubmitRequest{ContentID: "c9", TenantID: "acme"})
+	var invalid *Error
+	if !errors.As(err, &invalid) || len(invalid.InvalidParams) != 2 || invalid.InvalidParams[0] != (InvalidParam{Name: "project_id", Rule: "required", Reason: "is required"}) || invalid.InvalidParams[1].Name != "filename" {
+		t.Fatalf("expected project_id and filename to be reported, got %v", err)
+	}
+	if items, err := c.UGC.ListContent(ctx, ContentFilter{State: StateApproved}); err != nil || len(items) != 1 {
+		t.Fatalf("list content: %v %+v", err, items)
+	}
+	for _, id := range []string{"c2", "c3"} {
+		if _, err := c.UGC.SubmitContent(ctx, SubmitRequest{ContentID: id, TenantID: "acme", ProjectID: "p1", Filename: "map.png"}); err != nil {
+			t.Fatalf("submit %s: %v", id, err)
+		}
+	}
+	first, err := c.UGC.ListContentPage(ctx, ContentFilter{TenantID: "acme"}, PageOptions{Limit: 2})
+	if err != nil || len(first.Items) != 2 || first.NextCursor == "" {
+		t.Fatalf("list content page: %v %+v", err, first)
+	}
+	second, err := c.UGC.ListContentPage(ctx, ContentFilter{TenantID: "acme"}, PageOptions{Limit: 2, Cursor: first.NextCursor})
+	if err != nil || len(second.Items) != 1 || second.Items[0].ContentID != "c3" || second.NextCursor != "" {
+		t.Fatalf("list content second page: %v %+v", err, second)
+	}
+
+	assignment, err := c.Orchestration.AssignWork(ctx, AssignRequest{AgentID: "agent-1", WorkloadID: "w1", TenantID: "acme", ProjectID: "p1"})
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	updated, err := c.Orchestration.UpdateStatus(ctx, assignment.AssignmentID, StatusInProgress, "started")
+	if err != nil || updated.Status != StatusInProgress {
+		t.Fatalf("update: %v %+v", err, updated)
+	}
+
+	summary, err := c.Metrics.IngestMetric(ctx, MetricSample{Namespace: "match", Name: "duration", Value: 42, Labels: map[string]string{"map": "dust"}})
+	if err != nil || summary.Count != 1 {
+		t.Fatalf("ingest metric: %v %+v", err, summary)
+	}
+	results, err := c.Metrics.Query(ctx, MetricQuery{Namespace: "match", Match: []string{"map=dust"}})
+	if err != nil || len(results) != 1 || results[0].Summary.Sum != 42 {
+		t.Fatalf("query: %v %+v", err, results)
+	}
+}
+
+func TestFlagCache(t *testing.T) {
+	srv := newTestGateway(t)
+	c, err := NewGateway(srv.URL, WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("new gateway client: %v", err)
+	}
+	ctx := context.Background()
+	project := FlagScope{ProjectID: "p1"}
+	acme := FlagScope{TenantID: "acme", ProjectID: "p1"}
+
+	cache := NewFlagCache(c.FeatureFlags, acme)
+	if cache.Enabled("new-lobby", FlagSubject{UserID: "u1"}) {
+		t.Fatal("expected flags off before the first refresh")
+	}
+	if _, err := c.FeatureFlags.PutFlag(ctx, project, "new-lobby", FlagRequest{
+		Enabled: true,
+		Rollout: 25,
+		Rules: []FlagRule{
+			{Attribute: "platform", Values: []string{"console"}, Rollout: 0},
+			{Attribute: FlagAttributeTenantID, Values: []string{"beta-studio"}, Rollout: 100},
+		},
+	}); err != nil {
+		t.Fatalf("put flag: %v", err)
+	}
+	flag, err := c.FeatureFlags.PutFlag(ctx, acme, "shop", FlagRequest{Enabled: true, Rollout: 100})
+	if err != nil || flag.Version != 1 {
+		t.Fatalf("put tenant flag: %v %+v", err, flag)
+	}
+	if _, err := c.FeatureFlags.PutFlag(ctx, acme, "shop", FlagRequest{IfVersion: 9}); !IsCode(err, "flags.precondition_failed") {
+		t.Fatalf("expected flags.precondition_failed, got %v", err)
+	}
+	if err := cache.Refresh(ctx); err != nil || len(cache.Flags()) != 2 {
+		t.Fatalf("refresh: %v %+v", err, cache.Flags())
+	}
+	if err := cache.Refresh(ctx); err != nil || len(cache.Flags()) != 2 {
+		t.Fatalf("unchanged refresh: %v %+v", err, cache.Flags())
+	}
+
+	// Local answers must match the service's for every subject.
+	for i := 0; i < 200; i++ {
+		subject := FlagSubject{UserID: fmt.Sprintf("user-%d", i)}
+		if i%5 == 0 {
+			subject.Attributes = map[string]string{"platform": "console"}
+		}
+		remote, err := c.FeatureFlags.Evaluate(ctx, acme, subject)
+		if err != nil || len(remote) != 2 {
+			t.Fatalf("evaluate: %v %+v", err, remote)
+		}
+		for _, want := range remote {
+			if got := cache.Evaluate(want.Key, subject); got != want {
+				t.Fatalf("%s for %+v: local %+v, service %+v", want.Key, subject, got, want)
+			}
+		}
+	}
+	if eval := cache.Evaluate("missing", FlagSubject{}); eval.Reason != FlagReasonNotFound || eval.Enabled {
+		t.Fatalf("unknown flag: %+v", eval)
+	}
+
+	if err := c.FeatureFlags.DeleteFlag(ctx, acme, "shop"); err != nil {
+		t.Fatalf("delete flag: %v", err)
+	}
+	if err := cache.Refresh(ctx); err != nil || cache.Enabled("shop", FlagSubject{UserID: "u1"}) {
+		t.Fatalf("expected the deleted flag gone after refresh: %v", err)
+	}
+	if flags, err := c.FeatureFlags.ListFlags(ctx, project); err != nil || len(flags) != 1 || flags[0].Key != "new-lobby" {
+		t.Fatalf("list flags: %v %+v", err, flags)
+	}
+}
+
+func TestListFollowsCursors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("cursor") == "" {
+			_, _ = w.Write([]byte(`{"items":[{"message":"first"}],"next_cursor":"abc"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"message":"second"}]}`))
+	}))
+	defer srv.Close()
+	c, err := NewLogs(srv.URL)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	events, err := c.Recent(context.Background())
+	if err != nil || len(events) != 2 || events[0].Message != "first" || events[1].Message != "second" {
+		t.Fatalf("expected both pages, got %v %+v", err, events)
+	}
+}
+
+func TestSubscribeResumesFromLastEventID(t *testing.T) {
+	srv := newTestGateway(t)
+	c, err := NewGateway(srv.URL, WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("new gateway client: %v", err)
+	}
+	ctx := context.Background()
+	publish := func(payload string) {
+		t.Helper()
+		if _, err := c.Messaging.Publish(ctx, "lobby", PublishRequest{TenantID: "acme", ProjectID: "p1", Payload: []byte(payload)}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	errStop := errors.New("stop")
+
+	// Messages published before the subscription starts are not streamed,
+	// so keep publishing until the first one arrives.
+	first := make(chan Event[Message], 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Messaging.Subscribe(ctx, "lobby", SubscribeOptions{TenantID: "acme"}, func(e Event[Message]) error {
+			first <- e
+			return errStop
+		})
+	}()
+	var seen Event[Message]
+	for seen.ID == "" {
+		publish("before")
+		select {
+		case seen = <-first:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := <-done; !errors.Is(err, errStop) {
+		t.Fatalf("expected the callback's error, got %v", err)
+	}
+	if string(seen.Value.Payload) != "before" || seen.Value.Topic != "lobby" {
+		t.Fatalf("unexpected first message %+v", seen.Value)
+	}
+
+	publish("missed")
+	var resumed []string
+	err = c.Messaging.Subscribe(ctx, "lobby", SubscribeOptions{TenantID: "acme", LastEventID: seen.ID}, func(e Event[Message]) error {
+		resumed = append(resumed, string(e.Value.Payload))
+		if string(e.Value.Payload) == "missed" {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) || resumed[len(resumed)-1] != "missed" {
+		t.Fatalf("expected to resume with the missed message, got %v %v", err, resumed)
+	}
+
+}
+
+func TestErrorDecodesProblem(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusBadRequest, "ugc.invalid_request", "filename required")
+	}))
+	defer srv.Close()
+	c, err := NewUGC(srv.URL)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	_, err = c.SubmitContent(context.Background(), SubmitRequest{ContentID: "c1"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if apiErr.Status != http.StatusBadRequest || apiErr.Code != "ugc.invalid_request" || apiErr.Detail != "filename required" || apiErr.Instance != "/content" {
+		t.Fatalf("unexpected error %+v", apiErr)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		status   int
+		call     func(context.Context, *Logs) error
+		attempts int32
+	}{
+		{"declined post is retried", http.StatusServiceUnavailable, func(ctx context.Context, c *Logs) error {
+			return c.IngestLog(ctx, LogEvent{Source: "test", Message: "hi"})
+		}, 3},
+		{"bad gateway post is not retried", http.StatusBadGateway, func(ctx context.Context, c *Logs) error {
+			return c.IngestLog(ctx, LogEvent{Source: "test", Message: "hi"})
+		}, 1},
+		{"bad gateway get is retried", http.StatusBadGateway, func(ctx context.Context, c *Logs) error {
+			_, err := c.Recent(ctx)
+			return err
+		}, 3},
+		{"client errors are not retried", http.StatusBadRequest, func(ctx context.Context, c *Logs) error {
+			_, err := c.Recent(ctx)
+			return err
+		}, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) < 3 {
+					problem.Write(w, r, tc.status, "logs.test", "failing")
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"items":[]}`))
+			}))
+			defer srv.Close()
+			c, err := NewLogs(srv.URL, WithRetries(3, time.Millisecond))
+			if err != nil {
+				t.Fatalf("new: %v", err)
+			}
+			err = tc.call(context.Background(), c)
+			if got := attempts.Load(); got != tc.attempts {
+				t.Fatalf("expected %d attempts, got %d (err %v)", tc.attempts, got, err)
+			}
+			if (tc.attempts == 3) != (err == nil) {
+				t.Fatalf("unexpected result %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		problem.Write(w, r, http.StatusTooManyRequests, "gateway.rate_limited", "slow down")
+	}))
+	defer srv.Close()
+	c, err := NewNotifications(srv.URL, WithAPIKey("k"))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.Notify(ctx, Notification{Channel: ChannelEmail, Recipient: "a@example.com", Template: "welcome"})
+	if !IsCode(err, "gateway.rate_limited") {
+		t.Fatalf("expected the last problem to be returned, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("retry ignored the context deadline (%s)", elapsed)
+	}
+}
+
+func TestRequestIDIsKeptAcrossRetries(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get(RequestIDHeader))
+		mu.Unlock()
+		w.Header().Set(RequestIDHeader, r.Header.Get(RequestIDHeader))
+		problem.Write(w, r, http.StatusServiceUnavailable, "logs.backpressure", "queue full")
+	}))
+	defer srv.Close()
+	c, err := NewLogs(srv.URL, WithRetries(2, time.Millisecond))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	err = c.IngestLog(context.Background(), LogEvent{Source: "test", Message: "hi"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || len(seen) != 3 || seen[0] == "" || seen[1] != seen[0] || seen[2] != seen[0] || apiErr.RequestID != seen[0] {
+		t.Fatalf("expected one generated ID for every attempt and the error, got %q and %v", seen, err)
+	}
+
+	seen = nil
+	_ = c.IngestLog(WithRequestID(context.Background(), "req-42"), LogEvent{Source: "test", Message: "hi"})
+	_ = c.IngestLog(context.Background(), LogEvent{Source: "test", Message: "hi"})
+	if len(seen) != 6 || seen[0] != "req-42" || seen[3] == "" || seen[3] == "req-42" {
+		t.Fatalf("expected the context's ID, then a fresh one, got %q", seen)
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	reg := registry.New()
+	srv := httptest.NewServer(reg.Handler())
+	defer srv.Close()
+	for _, inst := range []registry.Instance{
+		{Service: ServiceUGC, ID: "a", URL: "http://a:8091", Status: "degraded"},
+		{Service: ServiceUGC, ID: "b", URL: "http://b:8091"},
+		{Service: ServiceLogs, ID: "c", URL: "http://c:8082", Status: "fail"},
+	} {
+		if _, err := reg.Register(inst, time.Minute); err != nil {
+			t.Fatalf("register: %v", err)
+		}
+	}
+	c, err := NewRegistry(srv.URL, WithRetries(0, 0))
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	ctx := context.Background()
+	if base, err := c.Resolve(ctx, ServiceUGC); err != nil || base != "http://b:8091" {
+		t.Fatalf("expected the healthy instance, got %q %v", base, err)
+	}
+	if _, err := c.Resolve(ctx, ServiceLogs); !errors.Is(err, ErrNoInstances) {
+		t.Fatalf("expected ErrNoInstances for a failing service, got %v", err)
+	}
+	services, err := c.Services(ctx)
+	if err != nil || len(services[ServiceUGC]) != 2 || len(services) != 2 {
+		t.Fatalf("unexpected services %v %+v", err, services)
+	}
+}
+
+func TestNewRejectsRelativeURL(t *testing.T) {
+	if _, err := NewMetrics("localhost:8081"); err == nil {
+		t.Fatal("expected an error for a URL without a scheme")
+	}
+}
+
+func TestVerifyWebhookMatchesSigner(t *testing.T) {
+	body := []byte(`{"id":"e1","event":"ugc.content_reviewed"}`)
+	now := time.Now().Unix()
+	header := http.Header{}
+	header.Set(WebhookHeaderTimestamp, strconv.FormatInt(now, 10))
+	header.Set(WebhookHeaderSignature, webhooks.Sign("whsec_0123456789abcdef", now, body))
+	if err := VerifyWebhook("whsec_0123456789abcdef", header, body, 5*time.Minute); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := VerifyWebhook("whsec_fedcba9876543210", header, body, 5*time.Minute); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Fatalf("expected a wrong secret to be rejected, got %v", err)
+	}
+	header.Set(WebhookHeaderTimestamp, strconv.FormatInt(now-3600, 10))
+	header.Set(WebhookHeaderSignature, webhooks.Sign("whsec_0123456789abcdef", now-3600, body))
+	if err := VerifyWebhook("whsec_0123456789abcdef", header, body, 5*time.Minute); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Fatalf("expected a stale delivery to be rejected, got %v", err)
+	}
+}
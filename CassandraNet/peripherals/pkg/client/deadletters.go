@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Attributes the service sets on a message it moved to a dead-letter
+// topic: the topic it was pulled from, its ID there, and the subscription
+// that ran out of deliveries when it was one.
+const (
+	AttrDeadLetterSourceTopic        = "dead_letter_source_topic"
+	AttrDeadLetterSourceMessageID    = "dead_letter_source_message_id"
+	AttrDeadLetterSourceSubscription = "dead_letter_source_subscription"
+)
+
+// DeadLetterPolicy moves a tenant's messages out of Topic once leasing
+// pulls have delivered them MaxDeliveries times without an ack, to
+// DeadLetterTopic. A subscription delivering a message that often sends a
+// copy there and stops delivering it, leaving the message to the other
+// subscriptions. A policy with an empty TenantID applies to the tenants
+// without their own.
+type DeadLetterPolicy struct {
+	TenantID        string    `json:"tenant_id,omitempty"`
+	Topic           string    `json:"topic"`
+	MaxDeliveries   int       `json:"max_deliveries"`
+	DeadLetterTopic string    `json:"dead_letter_topic"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func deadLetterPath(topic string, rest ...string) string {
+	path := "/topics/" + url.PathEscape(topic) + "/dead-letter"
+	for _, segment := range rest {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+// PutDeadLetterPolicy sets the dead-letter policy for tenantID's messages
+// in topic, or for every tenant's when tenantID is empty. An empty
+// deadLetterTopic names topic followed by ".dlq".
+func (c *Messaging) PutDeadLetterPolicy(ctx context.Context, topic, tenantID string, maxDeliveries int, deadLetterTopic string) (DeadLetterPolicy, error) {
+	var out DeadLetterPolicy
+	err := c.b.do(ctx, call{
+		method: http.MethodPut,
+		path:   deadLetterPath(topic),
+		query:  scopeQuery(tenantID, ""),
+		body: struct {
+			MaxDeliveries   int    `json:"max_deliveries"`
+			DeadLetterTopic string `json:"dead_letter_topic,omitempty"`
+		}{maxDeliveries, deadLetterTopic},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// DeadLetterPolicy returns the dead-letter policy applying to tenantID's
+// messages in topic. A topic without one returns an error with code
+// "messaging.not_found".
+func (c *Messaging) DeadLetterPolicy(ctx context.Context, topic, tenantID string) (DeadLetterPolicy, error) {
+	var out DeadLetterPolicy
+	err := c.b.do(ctx, call{method: http.MethodGet, path: deadLetterPath(topic), query: scopeQuery(tenantID, ""), idempotent: true}, &out)
+	return out, err
+}
+
+// DeleteDeadLetterPolicy removes tenantID's dead-letter policy for topic.
+// Messages already moved stay in the dead-letter topic.
+func (c *Messaging) DeleteDeadLetterPolicy(ctx context.Context, topic, tenantID string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: deadLetterPath(topic), query: scopeQuery(tenantID, "")}, nil)
+}
+
+// DeadLetters returns the page of messages in the dead-letter topic of
+// topic selected by opts, oldest first. Listing them does not lease them.
+func (c *Messaging) DeadLetters(ctx context.Context, topic string, opts PullOptions) (Page[Message], error) {
+	out, err := page[messageWire](ctx, c.b, call{method: http.MethodGet, path: deadLetterPath(topic, "messages"), query: scopeQuery(opts.TenantID, opts.ProjectID), idempotent: true}, PageOptions{Limit: opts.Limit, Cursor: opts.Cursor})
+	if err != nil {
+		return Page[Message]{}, err
+	}
+	messages := make([]Message, 0, len(out.Items))
+	for _, wire := range out.Items {
+		message, err := wire.message()
+		if err != nil {
+			return Page[Message]{}, err
+		}
+		messages = append(messages, message)
+	}
+	return Page[Message]{Items: messages, NextCursor: out.NextCursor}, nil
+}
+
+// ReplayDeadLetters publishes the dead-lettered messages with messageIDs
+// back to topic as new messages and removes them from the dead-letter
+// topic; with no IDs it replays up to 1000 of the scope's. It returns how
+// many it replayed. Like publishing, a replay is only retried when the
+// service declined it.
+func (c *Messaging) ReplayDeadLetters(ctx context.Context, topic, tenantID, projectID string, messageIDs ...string) (int, error) {
+	var out struct {
+		Replayed int `json:"replayed"`
+	}
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   deadLetterPath(topic, "replay"),
+		query:  scopeQuery(tenantID, projectID),
+		body: struct {
+			MessageIDs []string `json:"message_ids,omitempty"`
+		}{messageIDs},
+	}, &out)
+	return out.Replayed, err
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// EncryptionStatus describes a service's encryption at rest.
+type EncryptionStatus struct {
+	// Provider is "file", "vault", or "none" when nothing is sealed.
+	Provider string `json:"provider"`
+	// ActiveKey is the key-encryption key wrapping the current data key.
+	ActiveKey string `json:"active_key,omitempty"`
+	// Keys lists the key file's keys.
+	Keys             []string   `json:"keys,omitempty"`
+	DataKeyCreatedAt *time.Time `json:"data_key_created_at,omitempty"`
+	// Records lists the sealed kinds of record with their last rotation.
+	Records []EncryptionRecords `json:"records"`
+}
+
+// EncryptionRecords describes one kind of sealed record.
+type EncryptionRecords struct {
+	Name       string            `json:"name"`
+	LastReport *EncryptionReport `json:"last_report,omitempty"`
+}
+
+// EncryptionReport is the outcome of re-sealing one kind of record.
+type EncryptionReport struct {
+	Name       string    `json:"name"`
+	KeyID      string    `json:"key_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Resealed   int       `json:"resealed"`
+	// Skipped counts records sealed under keys the service does not have.
+	Skipped int    `json:"skipped"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Encryption reads and rotates a service's encryption keys.
+type Encryption struct {
+	b *base
+}
+
+// NewEncryption returns a client for the encryption API at baseURL.
+func NewEncryption(baseURL string, opts ...Option) (*Encryption, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Encryption{b: b}, nil
+}
+
+// Status returns the key provider, the active key, and the sealed records.
+func (c *Encryption) Status(ctx context.Context) (EncryptionStatus, error) {
+	var out EncryptionStatus
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/encryption", idempotent: true}, &out)
+	return out, err
+}
+
+// Rotate starts a new data key under the active key-encryption key and
+// re-seals every kind of record with it, returning a report for each.
+func (c *Encryption) Rotate(ctx context.Context) ([]EncryptionReport, error) {
+	var out struct {
+		Items []EncryptionReport `json:"items"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/encryption/rotate"}, &out)
+	return out.Items, err
+}
@@ -0,0 +1,328 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Reasons reported in FlagEvaluation.Reason.
+const (
+	FlagReasonDisabled  = "disabled"
+	FlagReasonRuleMatch = "rule_match"
+	FlagReasonRollout   = "rollout"
+	FlagReasonNotFound  = "not_found"
+)
+
+// Attributes every flag subject carries; rules may also name custom ones.
+const (
+	FlagAttributeTenantID = "tenant_id"
+	FlagAttributeUserID   = "user_id"
+)
+
+// Flag is a feature switch for a project, or for one tenant of it when
+// TenantID is set.
+type Flag struct {
+	Key         string     `json:"key"`
+	TenantID    string     `json:"tenant_id,omitempty"`
+	ProjectID   string     `json:"project_id"`
+	Description string     `json:"description,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	Rules       []FlagRule `json:"rules,omitempty"`
+	Rollout     int        `json:"rollout"`
+	Version     int64      `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// FlagRule targets subjects whose Attribute holds one of Values, giving the
+// flag to Rollout percent of them.
+type FlagRule struct {
+	Attribute string   `json:"attribute"`
+	Values    []string `json:"values"`
+	Rollout   int      `json:"rollout"`
+}
+
+// FlagRequest defines a flag. Rollout is the percentage of subjects no rule
+// matches that get the flag: 100 turns an enabled flag on for everyone, 0
+// leaves it to the rules.
+type FlagRequest struct {
+	Description string     `json:"description,omitempty"`
+	Enabled     bool       `json:"enabled"`
+	Rollout     int        `json:"rollout"`
+	Rules       []FlagRule `json:"rules,omitempty"`
+	// IfVersion, when non-zero, makes the change fail with
+	// "flags.precondition_failed" unless the stored flag has that version.
+	IfVersion int64 `json:"-"`
+}
+
+// FlagScope names a project and optionally one tenant of it. An empty
+// TenantID uses the tenant bound to the caller's credentials, or the
+// project-wide flags for callers bound to none.
+type FlagScope struct {
+	TenantID  string
+	ProjectID string
+}
+
+func (s FlagScope) query() url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", s.TenantID)
+	setIf(query, "project_id", s.ProjectID)
+	return query
+}
+
+// FlagSubject is who a flag is evaluated for. Its tenant is the scope's.
+type FlagSubject struct {
+	UserID     string            `json:"user_id,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// FlagEvaluation is a flag's answer for a subject.
+type FlagEvaluation struct {
+	Key     string `json:"key"`
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+	// Rule is the 1-based position of the matching rule, 0 when none did.
+	Rule    int   `json:"rule,omitempty"`
+	Version int64 `json:"version,omitempty"`
+}
+
+// FlagSnapshot is every flag in effect for a tenant: the project-wide flags,
+// each replaced by the tenant's own flag of the same key.
+type FlagSnapshot struct {
+	TenantID  string `json:"tenant_id,omitempty"`
+	ProjectID string `json:"project_id"`
+	ETag      string `json:"etag"`
+	Flags     []Flag `json:"flags"`
+}
+
+// FeatureFlags calls the feature flag service. Use a FlagCache to evaluate
+// flags without a call per check.
+type FeatureFlags struct {
+	b *base
+}
+
+// NewFeatureFlags returns a client for the feature flag service at baseURL.
+func NewFeatureFlags(baseURL string, opts ...Option) (*FeatureFlags, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &FeatureFlags{b: b}, nil
+}
+
+// PutFlag creates or replaces the scope's flag with key.
+func (c *FeatureFlags) PutFlag(ctx context.Context, scope FlagScope, key string, req FlagRequest) (Flag, error) {
+	var header http.Header
+	if req.IfVersion != 0 {
+		header = http.Header{"If-Match": {`"` + strconv.FormatInt(req.IfVersion, 10) + `"`}}
+	}
+	var out Flag
+	err := c.b.do(ctx, call{
+		method:     http.MethodPut,
+		path:       "/flags/" + url.PathEscape(key),
+		query:      scope.query(),
+		body:       req,
+		header:     header,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// GetFlag returns the scope's own flag with key.
+func (c *FeatureFlags) GetFlag(ctx context.Context, scope FlagScope, key string) (Flag, error) {
+	var out Flag
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/flags/" + url.PathEscape(key), query: scope.query(), idempotent: true}, &out)
+	return out, err
+}
+
+// DeleteFlag removes the scope's own flag with key.
+func (c *FeatureFlags) DeleteFlag(ctx context.Context, scope FlagScope, key string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: "/flags/" + url.PathEscape(key), query: scope.query(), idempotent: true}, nil)
+}
+
+// ListFlags returns the scope's own flags, fetching every page.
+func (c *FeatureFlags) ListFlags(ctx context.Context, scope FlagScope) ([]Flag, error) {
+	return all[Flag](ctx, c.b, call{method: http.MethodGet, path: "/flags", query: scope.query(), idempotent: true})
+}
+
+// ListFlagsPage returns one page of the scope's own flags.
+func (c *FeatureFlags) ListFlagsPage(ctx context.Context, scope FlagScope, opts PageOptions) (Page[Flag], error) {
+	return page[Flag](ctx, c.b, call{method: http.MethodGet, path: "/flags", query: scope.query(), idempotent: true}, opts)
+}
+
+// Evaluate asks the service for the flags in keys, or every flag when keys
+// is empty, for subject.
+func (c *FeatureFlags) Evaluate(ctx context.Context, scope FlagScope, subject FlagSubject, keys ...string) ([]FlagEvaluation, error) {
+	var out struct {
+		Flags []FlagEvaluation `json:"flags"`
+	}
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   "/flags/evaluate",
+		body: struct {
+			TenantID  string `json:"tenant_id,omitempty"`
+			ProjectID string `json:"project_id,omitempty"`
+			FlagSubject
+			Keys []string `json:"keys,omitempty"`
+		}{scope.TenantID, scope.ProjectID, subject, keys},
+		idempotent: true,
+	}, &out)
+	return out.Flags, err
+}
+
+// Snapshot returns the flags in effect for the scope. When etag is the
+// current snapshot's, it returns modified false and no flags.
+func (c *FeatureFlags) Snapshot(ctx context.Context, scope FlagScope, etag string) (snapshot FlagSnapshot, modified bool, err error) {
+	var header http.Header
+	if etag != "" {
+		header = http.Header{"If-None-Match": {etag}}
+	}
+	err = c.b.do(ctx, call{method: http.MethodGet, path: "/flags/snapshot", query: scope.query(), header: header, idempotent: true}, &snapshot)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotModified {
+		return FlagSnapshot{}, false, nil
+	}
+	return snapshot, err == nil, err
+}
+
+// FlagCache keeps a scope's flag definitions and evaluates them locally, so
+// checking a flag costs no call. Refresh or Run keep it current; until the
+// first successful refresh every flag is off.
+//
+//	flags := client.NewFlagCache(gw.FeatureFlags, client.FlagScope{ProjectID: "p1"})
+//	go flags.Run(ctx, 30*time.Second)
+//	if flags.Enabled("new-lobby", client.FlagSubject{UserID: player}) { ... }
+type FlagCache struct {
+	client *FeatureFlags
+	scope  FlagScope
+
+	mu       sync.RWMutex
+	snapshot FlagSnapshot
+	flags    map[string]Flag
+	err      error
+}
+
+// NewFlagCache returns an empty cache of scope's flags fetched through c.
+func NewFlagCache(c *FeatureFlags, scope FlagScope) *FlagCache {
+	return &FlagCache{client: c, scope: scope}
+}
+
+// Refresh fetches the flags if they changed since the last refresh. On
+// error the cache keeps the flags it has.
+func (fc *FlagCache) Refresh(ctx context.Context) error {
+	fc.mu.RLock()
+	etag := fc.snapshot.ETag
+	fc.mu.RUnlock()
+	snapshot, modified, err := fc.client.Snapshot(ctx, fc.scope, etag)
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.err = err
+	if err != nil || !modified {
+		return err
+	}
+	fc.snapshot = snapshot
+	fc.flags = make(map[string]Flag, len(snapshot.Flags))
+	for _, flag := range snapshot.Flags {
+		fc.flags[flag.Key] = flag
+	}
+	return nil
+}
+
+// Run refreshes the cache now and then every interval until ctx is done.
+// Failed refreshes keep the previous flags and are reported by Err.
+func (fc *FlagCache) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_ = fc.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Err returns the last refresh's error, nil once a refresh succeeds.
+func (fc *FlagCache) Err() error {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	return fc.err
+}
+
+// Flags returns the cached flags in key order.
+func (fc *FlagCache) Flags() []Flag {
+	fc.mu.RLock()
+	defer fc.mu.RUnlock()
+	return append([]Flag(nil), fc.snapshot.Flags...)
+}
+
+// Enabled reports whether the flag with key is on for subject; unknown
+// flags are off.
+func (fc *FlagCache) Enabled(key string, subject FlagSubject) bool {
+	return fc.Evaluate(key, subject).Enabled
+}
+
+// Evaluate evaluates the flag with key for subject the way the service does.
+func (fc *FlagCache) Evaluate(key string, subject FlagSubject) FlagEvaluation {
+	fc.mu.RLock()
+	flag, ok := fc.flags[key]
+	tenant := fc.snapshot.TenantID
+	fc.mu.RUnlock()
+	if !ok {
+		return FlagEvaluation{Key: key, Reason: FlagReasonNotFound}
+	}
+	return evaluateFlag(flag, tenant, subject)
+}
+
+// evaluateFlag mirrors the service's evaluation: a disabled flag is off, the
+// first matching rule decides with its rollout, and otherwise the flag's
+// rollout does. Subjects are bucketed by a hash of the key and the user ID,
+// or the tenant ID without one, and subjects with neither get only full
+// rollouts.
+func evaluateFlag(flag Flag, tenant string, subject FlagSubject) FlagEvaluation {
+	eval := FlagEvaluation{Key: flag.Key, Version: flag.Version}
+	if !flag.Enabled {
+		eval.Reason = FlagReasonDisabled
+		return eval
+	}
+	id := subject.UserID
+	if id == "" {
+		id = tenant
+	}
+	bucket := 99
+	if id != "" {
+		sum := sha256.Sum256([]byte(flag.Key + "\x00" + id))
+		bucket = int(binary.BigEndian.Uint64(sum[:8]) % 100)
+	}
+	for i, rule := range flag.Rules {
+		var value string
+		var ok bool
+		switch rule.Attribute {
+		case FlagAttributeTenantID:
+			value, ok = tenant, true
+		case FlagAttributeUserID:
+			value, ok = subject.UserID, true
+		default:
+			value, ok = subject.Attributes[rule.Attribute]
+		}
+		if !ok || !slices.Contains(rule.Values, value) {
+			continue
+		}
+		eval.Enabled = bucket < rule.Rollout
+		eval.Reason = FlagReasonRuleMatch
+		eval.Rule = i + 1
+		return eval
+	}
+	eval.Enabled = bucket < flag.Rollout
+	eval.Reason = FlagReasonRollout
+	return eval
+}
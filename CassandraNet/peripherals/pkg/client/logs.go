@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// LogEvent is a structured log record in the log pipeline's schema.
+type LogEvent struct {
+	Source  string            `json:"source"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	// Values holds the parsed value of each field the pipeline's schema
+	// types: a float64, bool, or RFC 3339 string. It is ignored on ingest.
+	Values map[string]any `json:"values,omitempty"`
+	// Timestamp defaults to the time the pipeline receives the event.
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// Logs calls the log pipeline.
+type Logs struct {
+	b *base
+}
+
+// NewLogs returns a client for the log pipeline at baseURL.
+func NewLogs(baseURL string, opts ...Option) (*Logs, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Logs{b: b}, nil
+}
+
+// IngestLog submits one event. When the pipeline's queue is full it answers
+// 503 with code "logs.backpressure", which is retried with backoff.
+func (c *Logs) IngestLog(ctx context.Context, event LogEvent) error {
+	return c.b.do(ctx, call{method: http.MethodPost, path: "/logs", body: event}, nil)
+}
+
+// IngestBatch submits up to 1000 events, all or none. A batch larger than
+// the pipeline's queue answers 413 with code "logs.batch_too_large"; a
+// full queue answers 503, which is retried with backoff.
+func (c *Logs) IngestBatch(ctx context.Context, events []LogEvent) error {
+	body := struct {
+		Events []LogEvent `json:"events"`
+	}{events}
+	return c.b.do(ctx, call{method: http.MethodPost, path: "/logs/batch", body: body}, nil)
+}
+
+var recentLogsCall = call{method: http.MethodGet, path: "/logs/recent", idempotent: true}
+
+// Recent returns the events most recently processed by the pipeline, oldest
+// first, fetching every page.
+func (c *Logs) Recent(ctx context.Context) ([]LogEvent, error) {
+	return all[LogEvent](ctx, c.b, recentLogsCall)
+}
+
+// RecentPage returns one page of the events most recently processed by the
+// pipeline, oldest first.
+func (c *Logs) RecentPage(ctx context.Context, opts PageOptions) (Page[LogEvent], error) {
+	return page[LogEvent](ctx, c.b, recentLogsCall, opts)
+}
+
+// LogQuery selects buffered events for Query. Where holds conditions such
+// as "latency_ms>=250" or "cached=true"; <, <=, >, and >= compare the
+// fields the pipeline's schema types as numbers or timestamps.
+type LogQuery struct {
+	Source string
+	Level  string
+	Where  []string
+}
+
+// Query returns the buffered events selected by q, oldest first, fetching
+// every page.
+func (c *Logs) Query(ctx context.Context, q LogQuery) ([]LogEvent, error) {
+	return all[LogEvent](ctx, c.b, logQueryCall(q))
+}
+
+// QueryPage returns one page of the buffered events selected by q.
+func (c *Logs) QueryPage(ctx context.Context, q LogQuery, opts PageOptions) (Page[LogEvent], error) {
+	return page[LogEvent](ctx, c.b, logQueryCall(q), opts)
+}
+
+func logQueryCall(q LogQuery) call {
+	query := url.Values{}
+	setIf(query, "source", q.Source)
+	setIf(query, "level", q.Level)
+	for _, where := range q.Where {
+		query.Add("where", where)
+	}
+	return call{method: http.MethodGet, path: "/logs/query", query: query, idempotent: true}
+}
+
+// TailOptions filters tailed events. Source matches exactly; Level is the
+// least severe level streamed (DEBUG by default).
+type TailOptions struct {
+	Source string
+	Level  string
+	// LastEventID resumes after the event with this ID.
+	LastEventID string
+}
+
+// Tail streams events as the pipeline processes them, calling fn with each
+// until ctx is cancelled, fn returns an error, or the pipeline ends the
+// stream, as it does for tails that fall behind.
+func (c *Logs) Tail(ctx context.Context, opts TailOptions, fn func(Event[LogEvent]) error) error {
+	query := url.Values{}
+	setIf(query, "source", opts.Source)
+	setIf(query, "level", opts.Level)
+	return streamValues(ctx, c.b, "/logs/stream", query, opts.LastEventID, "log", fn)
+}
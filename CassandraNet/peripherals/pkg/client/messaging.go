@@ -0,0 +1,352 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Message priorities accepted by the messaging service.
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+)
+
+// Message is a message published to a topic. DeliverAt, when set, is when
+// a delayed message becomes pullable, and ExpiresAt when the service
+// removes it if it is still pending.
+type Message struct {
+	MessageID   string            `json:"message_id"`
+	TenantID    string            `json:"tenant_id"`
+	ProjectID   string            `json:"project_id"`
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key"`
+	Payload     []byte            `json:"payload"`
+	Priority    string            `json:"priority"`
+	PublishedAt time.Time         `json:"published_at"`
+	DeliverAt   time.Time         `json:"deliver_at,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+// PublishRequest describes a message to publish. An empty TenantID uses the
+// tenant bound to the caller's credentials. DeliverAt, or Delay in whole
+// seconds, holds the message back until then, up to seven days ahead. A
+// positive TTL, in whole seconds, removes the message once it has been
+// pending that long after its delivery; zero leaves it to the topic's
+// default.
+type PublishRequest struct {
+	TenantID   string
+	ProjectID  string
+	Key        string
+	Payload    []byte
+	Priority   string
+	DeliverAt  time.Time
+	Delay      time.Duration
+	TTL        time.Duration
+	Attributes map[string]string
+}
+
+// PullOptions filters pulled messages and selects the page: up to Limit
+// messages (10 by default) following Cursor. Group names the consumer
+// group pulling, whose position the pull advances. A positive AckDeadline,
+// in whole seconds, leases the pulled messages: other pulls leave them out
+// until it passes, and they are pulled again unless acknowledged by then.
+// A positive Wait, in whole seconds up to 20, has the service hold a pull
+// that finds no messages until one arrives or Wait passes.
+type PullOptions struct {
+	TenantID    string
+	ProjectID   string
+	Group       string
+	Limit       int
+	Cursor      string
+	AckDeadline time.Duration
+	Wait        time.Duration
+}
+
+// TopicLag is how far a consumer group is behind in one topic: pending
+// messages it has pulled but not acknowledged, and those past its
+// position.
+type TopicLag struct {
+	Topic             string    `json:"topic"`
+	Unacked           int       `json:"unacked"`
+	Unpulled          int       `json:"unpulled"`
+	OldestPublishedAt time.Time `json:"oldest_published_at"`
+	OldestAgeSeconds  float64   `json:"oldest_age_seconds"`
+	LastPulledAt      time.Time `json:"last_pulled_at"`
+}
+
+// GroupLag is a consumer group's lag across its topics. Exceeded names the
+// service's lag thresholds the totals are past.
+type GroupLag struct {
+	Group             string     `json:"group"`
+	TenantID          string     `json:"tenant_id"`
+	ProjectID         string     `json:"project_id"`
+	Unacked           int        `json:"unacked"`
+	Unpulled          int        `json:"unpulled"`
+	OldestPublishedAt time.Time  `json:"oldest_published_at"`
+	OldestAgeSeconds  float64    `json:"oldest_age_seconds"`
+	Lagging           bool       `json:"lagging"`
+	Exceeded          []string   `json:"exceeded"`
+	Topics            []TopicLag `json:"topics"`
+}
+
+// SubscribeOptions selects the scope of a subscription. An empty TenantID
+// uses the tenant bound to the caller's credentials.
+type SubscribeOptions struct {
+	TenantID  string
+	ProjectID string
+	// LastEventID resumes after the event with this ID.
+	LastEventID string
+}
+
+// Messaging calls the messaging service.
+type Messaging struct {
+	b *base
+}
+
+// NewMessaging returns a client for the messaging service at baseURL.
+func NewMessaging(baseURL string, opts ...Option) (*Messaging, error) {
+	return newMessaging(baseURL, "", opts)
+}
+
+func newMessaging(baseURL, prefix string, opts []Option) (*Messaging, error) {
+	b, err := newBase(baseURL, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Messaging{b: b}, nil
+}
+
+type messageWire struct {
+	MessageID     string            `json:"message_id,omitempty"`
+	TenantID      string            `json:"tenant_id"`
+	ProjectID     string            `json:"project_id"`
+	Topic         string            `json:"topic,omitempty"`
+	Key           string            `json:"key"`
+	Priority      string            `json:"priority,omitempty"`
+	PublishedAt   time.Time         `json:"published_at,omitzero"`
+	DeliverAt     time.Time         `json:"deliver_at,omitzero"`
+	DelaySeconds  int               `json:"delay_seconds,omitempty"`
+	ExpiresAt     time.Time         `json:"expires_at,omitzero"`
+	TTLSeconds    int               `json:"ttl_seconds,omitempty"`
+	Attributes    map[string]string `json:"attributes,omitempty"`
+	PayloadBase64 string            `json:"payload_base64"`
+}
+
+func (m messageWire) message() (Message, error) {
+	payload, err := base64.StdEncoding.DecodeString(m.PayloadBase64)
+	if err != nil {
+		return Message{}, fmt.Errorf("client: message %s has an invalid payload: %w", m.MessageID, err)
+	}
+	return Message{
+		MessageID:   m.MessageID,
+		TenantID:    m.TenantID,
+		ProjectID:   m.ProjectID,
+		Topic:       m.Topic,
+		Key:         m.Key,
+		Payload:     payload,
+		Priority:    m.Priority,
+		PublishedAt: m.PublishedAt,
+		DeliverAt:   m.DeliverAt,
+		ExpiresAt:   m.ExpiresAt,
+		Attributes:  m.Attributes,
+	}, nil
+}
+
+func topicPath(topic string, rest ...string) string {
+	path := "/topics/" + url.PathEscape(topic) + "/messages"
+	for _, segment := range rest {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+// Publish sends a message to topic. Publishing is not idempotent, so it is
+// only retried when the service declined it outright (429 or 503).
+func (c *Messaging) Publish(ctx context.Context, topic string, req PublishRequest) (Message, error) {
+	var out messageWire
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   topicPath(topic),
+		body: messageWire{
+			TenantID:      req.TenantID,
+			ProjectID:     req.ProjectID,
+			Key:           req.Key,
+			Priority:      req.Priority,
+			DeliverAt:     req.DeliverAt,
+			DelaySeconds:  int(req.Delay / time.Second),
+			TTLSeconds:    int(req.TTL / time.Second),
+			Attributes:    req.Attributes,
+			PayloadBase64: base64.StdEncoding.EncodeToString(req.Payload),
+		},
+	}, &out)
+	if err != nil {
+		return Message{}, err
+	}
+	return out.message()
+}
+
+// Pull returns the first page of pending messages on topic. Messages stay
+// pending until acknowledged, so after acking a page, pulling again returns
+// the next one.
+func (c *Messaging) Pull(ctx context.Context, topic string, opts PullOptions) ([]Message, error) {
+	p, err := c.PullPage(ctx, topic, opts)
+	return p.Items, err
+}
+
+// PullPage returns the page of pending messages on topic selected by opts,
+// for reading past messages that are not acknowledged yet.
+func (c *Messaging) PullPage(ctx context.Context, topic string, opts PullOptions) (Page[Message], error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", opts.TenantID)
+	setIf(query, "project_id", opts.ProjectID)
+	setIf(query, "group", opts.Group)
+	if opts.AckDeadline > 0 {
+		query.Set("ack_deadline_seconds", strconv.Itoa(int(opts.AckDeadline/time.Second)))
+	}
+	if opts.Wait > 0 {
+		query.Set("wait_seconds", strconv.Itoa(int(opts.Wait/time.Second)))
+	}
+	// A retried leasing pull would leave the lost response's messages
+	// leased, so it is only retried when the service declined it.
+	out, err := page[messageWire](ctx, c.b, call{method: http.MethodGet, path: topicPath(topic), query: query, idempotent: opts.AckDeadline <= 0, hold: opts.Wait}, PageOptions{Limit: opts.Limit, Cursor: opts.Cursor})
+	if err != nil {
+		return Page[Message]{}, err
+	}
+	messages := make([]Message, 0, len(out.Items))
+	for _, wire := range out.Items {
+		message, err := wire.message()
+		if err != nil {
+			return Page[Message]{}, err
+		}
+		messages = append(messages, message)
+	}
+	return Page[Message]{Items: messages, NextCursor: out.NextCursor}, nil
+}
+
+// Ack removes a processed message from topic. If a retried ack finds the
+// message already gone, it returns an error with code "messaging.not_found".
+func (c *Messaging) Ack(ctx context.Context, topic, messageID string) error {
+	return c.b.do(ctx, call{method: http.MethodPost, path: topicPath(topic, messageID, "ack"), idempotent: true}, nil)
+}
+
+// Extend moves the deadline of the lease a pull took on messageID to
+// deadline from now, or to the service's default when deadline is zero,
+// and returns the new deadline. A lease that already ended returns an
+// error with code "messaging.not_leased"; pull the message again.
+func (c *Messaging) Extend(ctx context.Context, topic, messageID string, deadline time.Duration) (time.Time, error) {
+	var out struct {
+		LeasedUntil time.Time `json:"leased_until"`
+	}
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   topicPath(topic, messageID, "extend"),
+		body: struct {
+			AckDeadlineSeconds int `json:"ack_deadline_seconds,omitempty"`
+		}{int(deadline / time.Second)},
+		idempotent: true,
+	}, &out)
+	return out.LeasedUntil, err
+}
+
+// Nack gives up the lease a pull took on messageID, so the message is
+// pulled again at once, or moved to the topic's dead-letter topic when it
+// has been delivered as often as the dead-letter policy allows. A message
+// not leased returns an error with code "messaging.not_leased"; since a
+// retried nack would, a nack is only retried when the service declined it.
+func (c *Messaging) Nack(ctx context.Context, topic, messageID string) error {
+	return c.b.do(ctx, call{method: http.MethodPost, path: topicPath(topic, messageID, "nack")}, nil)
+}
+
+// GroupLag returns the lag of the consumer group in the scope of tenantID
+// and projectID, which may be empty as for pulls. A group that has not
+// pulled returns an error with code "messaging.not_found".
+func (c *Messaging) GroupLag(ctx context.Context, group, tenantID, projectID string) (GroupLag, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	setIf(query, "project_id", projectID)
+	var out GroupLag
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/groups/" + url.PathEscape(group) + "/lag", query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// ImportOptions controls ImportTopic. RemapIDs gives the imported messages
+// new IDs; TenantID and ProjectID, when set, replace the messages' own.
+type ImportOptions struct {
+	TenantID  string
+	ProjectID string
+	RemapIDs  bool
+}
+
+// ImportResult counts the messages an import stored, and those skipped
+// because the topic already held their IDs.
+type ImportResult struct {
+	Topic    string `json:"topic"`
+	Imported int    `json:"imported"`
+	Skipped  int    `json:"skipped"`
+}
+
+// ExportTopic returns the pending messages of topic in the scope of
+// tenantID and projectID as a gzip-compressed NDJSON snapshot, without
+// moving any consumer group.
+func (c *Messaging) ExportTopic(ctx context.Context, topic, tenantID, projectID string) ([]byte, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	setIf(query, "project_id", projectID)
+	var out []byte
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/topics/" + url.PathEscape(topic) + "/export", query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// ImportTopic appends the messages of a snapshot from ExportTopic to
+// topic, all or none unless the store fails part way. Imports keeping
+// their IDs skip messages already present, so only they are retried after
+// network errors.
+func (c *Messaging) ImportTopic(ctx context.Context, topic string, snapshot []byte, opts ImportOptions) (ImportResult, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", opts.TenantID)
+	setIf(query, "project_id", opts.ProjectID)
+	if opts.RemapIDs {
+		query.Set("ids", "remap")
+	}
+	var out ImportResult
+	err := c.b.do(ctx, call{
+		method:     http.MethodPost,
+		path:       "/topics/" + url.PathEscape(topic) + "/import",
+		query:      query,
+		raw:        snapshot,
+		idempotent: !opts.RemapIDs,
+	}, &out)
+	return out, err
+}
+
+// Subscribe streams messages as they are published to topic, calling fn
+// with each until ctx is cancelled, fn returns an error, or the service
+// ends the stream, as it does for subscribers that fall behind. Streamed
+// messages stay pending, so consumers that must not miss any still pull
+// and ack them.
+func (c *Messaging) Subscribe(ctx context.Context, topic string, opts SubscribeOptions, fn func(Event[Message]) error) error {
+	query := url.Values{}
+	setIf(query, "tenant_id", opts.TenantID)
+	setIf(query, "project_id", opts.ProjectID)
+	path := "/topics/" + url.PathEscape(topic) + "/stream"
+	return streamValues(ctx, c.b, path, query, opts.LastEventID, "message", func(e Event[messageWire]) error {
+		message, err := e.Value.message()
+		if err != nil {
+			return err
+		}
+		return fn(Event[Message]{ID: e.ID, Value: message})
+	})
+}
+
+func setIf(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Metric types accepted by the metrics collector.
+const (
+	MetricGauge     = "gauge"
+	MetricCounter   = "counter"
+	MetricHistogram = "histogram"
+)
+
+// MetricSample is one observation of a metric series.
+type MetricSample struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type,omitempty"`
+	Value     float64           `json:"value"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// Timestamp defaults to the time the collector receives the sample.
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	// Exemplar optionally links the sample to the trace that produced it.
+	Exemplar *Exemplar `json:"exemplar,omitempty"`
+}
+
+// Exemplar references a trace that recorded a sample.
+type Exemplar struct {
+	TraceID   string    `json:"trace_id"`
+	SpanID    string    `json:"span_id,omitempty"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// Summary is the roll-up of a series' samples.
+type Summary struct {
+	Type      string    `json:"type,omitempty"`
+	Count     int       `json:"count"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Sum       float64   `json:"sum"`
+	Mean      float64   `json:"mean"`
+	Last      time.Time `json:"last"`
+	LastValue float64   `json:"last_value"`
+	Buckets   []Bucket  `json:"buckets,omitempty"`
+	Exemplar  *Exemplar `json:"exemplar,omitempty"`
+}
+
+// Bucket counts histogram samples at or below UpperBound.
+type Bucket struct {
+	UpperBound float64   `json:"le"`
+	Count      uint64    `json:"count"`
+	Exemplar   *Exemplar `json:"exemplar,omitempty"`
+}
+
+// MetricQuery selects series for Query. Match holds label matchers such as
+// "route=~/v1/.*"; Aggregate ("sum" or "avg") collapses the matching series
+// into one result per combination of the By labels.
+type MetricQuery struct {
+	Namespace string
+	Name      string
+	Match     []string
+	Aggregate string
+	By        []string
+}
+
+// SeriesResult is one series, or one aggregated group, matched by Query.
+type SeriesResult struct {
+	Namespace string            `json:"namespace,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Summary   Summary           `json:"summary"`
+	Series    int               `json:"series,omitempty"`
+	Value     float64           `json:"value,omitempty"`
+}
+
+// Metrics calls the metrics collector.
+type Metrics struct {
+	b *base
+}
+
+// NewMetrics returns a client for the metrics collector at baseURL.
+func NewMetrics(baseURL string, opts ...Option) (*Metrics, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Metrics{b: b}, nil
+}
+
+// IngestMetric records a sample and returns the series' updated summary.
+// Counters and histograms would double count a repeated sample, so it is
+// only retried when the collector declined it outright (429 or 503).
+func (c *Metrics) IngestMetric(ctx context.Context, sample MetricSample) (Summary, error) {
+	var out Summary
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/metrics/ingest", body: sample}, &out)
+	return out, err
+}
+
+// Summaries returns every series' summary keyed by "namespace.name{labels}".
+func (c *Metrics) Summaries(ctx context.Context) (map[string]Summary, error) {
+	var out map[string]Summary
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/metrics/summary", idempotent: true}, &out)
+	return out, err
+}
+
+// Query returns the series selected by q, fetching every page.
+func (c *Metrics) Query(ctx context.Context, q MetricQuery) ([]SeriesResult, error) {
+	return all[SeriesResult](ctx, c.b, queryCall(q))
+}
+
+// QueryPage returns one page of the series selected by q.
+func (c *Metrics) QueryPage(ctx context.Context, q MetricQuery, opts PageOptions) (Page[SeriesResult], error) {
+	return page[SeriesResult](ctx, c.b, queryCall(q), opts)
+}
+
+func queryCall(q MetricQuery) call {
+	query := url.Values{}
+	setIf(query, "namespace", q.Namespace)
+	setIf(query, "name", q.Name)
+	setIf(query, "agg", q.Aggregate)
+	setIf(query, "by", strings.Join(q.By, ","))
+	for _, match := range q.Match {
+		query.Add("match", match)
+	}
+	return call{method: http.MethodGet, path: "/metrics/query", query: query, idempotent: true}
+}
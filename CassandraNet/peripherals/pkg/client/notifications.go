@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Notification channels supported by the notification service.
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelInApp   = "in_app"
+)
+
+// Notification asks the service to render Template with Data and deliver it
+// to Recipient over Channel.
+type Notification struct {
+	Channel   string         `json:"channel"`
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// Delivery is a rendered notification as sent.
+type Delivery struct {
+	ID        string    `json:"id,omitempty"`
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Template  string    `json:"template,omitempty"`
+	Body      string    `json:"body"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// InboxItem is an in-app notification and when its recipient read it,
+// zero while unread.
+type InboxItem struct {
+	Delivery
+	ReadAt time.Time `json:"read_at,omitzero"`
+}
+
+// EngagementStats totals how recipients engaged with one template's
+// deliveries. Opened and Clicked count emails opened, or with a link
+// followed, at least once, and Opens and Clicks every time; Read counts
+// in-app notifications read. Rates are fractions of Emails or InApp.
+type EngagementStats struct {
+	Template  string  `json:"template"`
+	Sent      int     `json:"sent"`
+	Emails    int     `json:"emails"`
+	Opened    int     `json:"opened"`
+	Clicked   int     `json:"clicked"`
+	Opens     int     `json:"opens"`
+	Clicks    int     `json:"clicks"`
+	InApp     int     `json:"in_app"`
+	Read      int     `json:"read"`
+	OpenRate  float64 `json:"open_rate"`
+	ClickRate float64 `json:"click_rate"`
+	ReadRate  float64 `json:"read_rate"`
+}
+
+// Suppression stops notifications over Channel to Recipient.
+type Suppression struct {
+	Channel   string    `json:"channel"`
+	Recipient string    `json:"recipient"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+}
+
+// SuppressionChange is one change a suppression list import made, or would
+// make: Action is "add", "update" or "remove".
+type SuppressionChange struct {
+	Action string `json:"action"`
+	Suppression
+	PreviousReason string `json:"previous_reason,omitempty"`
+}
+
+// ImportReport counts the changes a suppression list import made, or with
+// DryRun would make. Changes lists the first of them; Truncated is set when
+// there were more.
+type ImportReport struct {
+	DryRun    bool                `json:"dry_run"`
+	Added     int                 `json:"added"`
+	Updated   int                 `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Removed   int                 `json:"removed"`
+	Changes   []SuppressionChange `json:"changes"`
+	Truncated bool                `json:"truncated,omitempty"`
+}
+
+// SuppressionImport configures ImportSuppressions. Format is "csv" or
+// "ndjson" (the default). Channel is the channel of CSV rows without one
+// and, when set, the only one allowed. Replace removes the suppressions the
+// list lacks, within Channel when set, and DryRun reports the changes
+// without making them.
+type SuppressionImport struct {
+	Format  string
+	Channel string
+	Replace bool
+	DryRun  bool
+}
+
+// Notifications calls the notification service.
+type Notifications struct {
+	b *base
+}
+
+// NewNotifications returns a client for the notification service at baseURL.
+func NewNotifications(baseURL string, opts ...Option) (*Notifications, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifications{b: b}, nil
+}
+
+// Notify renders and sends a notification. It is only retried when the
+// service declined it outright (429 or 503), so recipients are not notified
+// twice.
+func (c *Notifications) Notify(ctx context.Context, n Notification) (Delivery, error) {
+	var out Delivery
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/notify", body: n}, &out)
+	return out, err
+}
+
+var recentNotificationsCall = call{method: http.MethodGet, path: "/notifications/recent", idempotent: true}
+
+// Recent returns the most recently sent notifications, fetching every page.
+func (c *Notifications) Recent(ctx context.Context) ([]Delivery, error) {
+	return all[Delivery](ctx, c.b, recentNotificationsCall)
+}
+
+// RecentPage returns one page of the most recently sent notifications.
+func (c *Notifications) RecentPage(ctx context.Context, opts PageOptions) (Page[Delivery], error) {
+	return page[Delivery](ctx, c.b, recentNotificationsCall, opts)
+}
+
+// Stream streams the in-app notifications sent to recipient, calling fn
+// with each until ctx is cancelled, fn returns an error, or the service
+// ends the stream. A non-empty lastEventID resumes after that event.
+func (c *Notifications) Stream(ctx context.Context, recipient, lastEventID string, fn func(Event[Delivery]) error) error {
+	return streamValues(ctx, c.b, "/notifications/stream", url.Values{"recipient": {recipient}}, lastEventID, "notification", fn)
+}
+
+// Inbox returns the in-app notifications to recipient still in the
+// service's history, oldest first, fetching every page.
+func (c *Notifications) Inbox(ctx context.Context, recipient string) ([]InboxItem, error) {
+	return all[InboxItem](ctx, c.b, call{method: http.MethodGet, path: "/notifications/inbox", query: url.Values{"recipient": {recipient}}, idempotent: true})
+}
+
+// MarkRead marks recipient's in-app notifications ids read and returns how
+// many were unread. IDs that are not in-app notifications to recipient are
+// ignored.
+func (c *Notifications) MarkRead(ctx context.Context, recipient string, ids ...string) (int, error) {
+	var out struct {
+		Read int `json:"read"`
+	}
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   "/notifications/inbox/read",
+		body: struct {
+			Recipient string   `json:"recipient"`
+			IDs       []string `json:"ids"`
+		}{recipient, ids},
+		idempotent: true,
+	}, &out)
+	return out.Read, err
+}
+
+// Engagement returns every template's engagement totals, fetching every
+// page.
+func (c *Notifications) Engagement(ctx context.Context) ([]EngagementStats, error) {
+	return all[EngagementStats](ctx, c.b, call{method: http.MethodGet, path: "/notifications/engagement", idempotent: true})
+}
+
+// TemplateEngagement returns template's engagement totals.
+func (c *Notifications) TemplateEngagement(ctx context.Context, template string) (EngagementStats, error) {
+	var out EngagementStats
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/notifications/engagement/" + url.PathEscape(template), idempotent: true}, &out)
+	return out, err
+}
+
+const suppressionsPath = "/notifications/suppressions"
+
+// Suppress adds sup to the suppression list, or updates its reason, and
+// returns it as stored.
+func (c *Notifications) Suppress(ctx context.Context, sup Suppression) (Suppression, error) {
+	var out Suppression
+	err := c.b.do(ctx, call{method: http.MethodPost, path: suppressionsPath, body: sup, idempotent: true}, &out)
+	return out, err
+}
+
+// Unsuppress removes recipient's suppression on channel.
+func (c *Notifications) Unsuppress(ctx context.Context, channel, recipient string) error {
+	return c.b.do(ctx, call{
+		method:     http.MethodDelete,
+		path:       suppressionsPath,
+		query:      url.Values{"channel": {channel}, "recipient": {recipient}},
+		idempotent: true,
+	}, nil)
+}
+
+// Suppressions returns the suppression list, on channel when it is
+// non-empty, fetching every page.
+func (c *Notifications) Suppressions(ctx context.Context, channel string) ([]Suppression, error) {
+	query := url.Values{}
+	setIf(query, "channel", channel)
+	return all[Suppression](ctx, c.b, call{method: http.MethodGet, path: suppressionsPath, query: query, idempotent: true})
+}
+
+// ExportSuppressions returns the suppression list, on channel when it is
+// non-empty, as format: "csv" or "ndjson" (the default).
+func (c *Notifications) ExportSuppressions(ctx context.Context, format, channel string) ([]byte, error) {
+	query := url.Values{}
+	setIf(query, "format", format)
+	setIf(query, "channel", channel)
+	var out []byte
+	err := c.b.do(ctx, call{method: http.MethodGet, path: suppressionsPath + "/export", query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// ImportSuppressions applies the suppression list in data, as opts
+// describes, and reports the changes. The list is checked in full before
+// anything changes.
+func (c *Notifications) ImportSuppressions(ctx context.Context, data []byte, opts SuppressionImport) (ImportReport, error) {
+	query := url.Values{}
+	setIf(query, "format", opts.Format)
+	setIf(query, "channel", opts.Channel)
+	if opts.Replace {
+		query.Set("replace", "true")
+	}
+	if opts.DryRun {
+		query.Set("dry_run", "true")
+	}
+	var out ImportReport
+	err := c.b.do(ctx, call{method: http.MethodPost, path: suppressionsPath + "/import", query: query, raw: data, idempotent: true}, &out)
+	return out, err
+}
@@ -0,0 +1,300 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Assignment statuses accepted by the orchestration service.
+const (
+	StatusPending    = "pending"
+	StatusAssigned   = "assigned"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+)
+
+// Assignment is a unit of work assigned to an agent.
+type Assignment struct {
+	AssignmentID  string            `json:"assignment_id"`
+	AgentID       string            `json:"agent_id"`
+	WorkloadID    string            `json:"workload_id"`
+	TenantID      string            `json:"tenant_id"`
+	ProjectID     string            `json:"project_id"`
+	Status        string            `json:"status"`
+	StatusMessage string            `json:"status_message,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	// Template names the workload template the assignment was made from,
+	// which supplied RequiredCapabilities, RetryPolicy, and Priority.
+	Template             string       `json:"template,omitempty"`
+	RequiredCapabilities []string     `json:"required_capabilities,omitempty"`
+	RetryPolicy          *RetryPolicy `json:"retry_policy,omitempty"`
+	Priority             int          `json:"priority,omitempty"`
+	// Artifacts holds the outputs the agent attached.
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// QueuePosition is a pending assignment's place in its tenant's queue,
+	// starting at 1.
+	QueuePosition int `json:"queue_position,omitempty"`
+}
+
+// Artifact is an output attached to an assignment: a small JSON Result
+// stored inline (up to 64 KiB), or the URI of a blob stored elsewhere with
+// its ContentType, Size, and hex SHA256 digest when known. Set exactly one
+// of Result and URI.
+type Artifact struct {
+	Name        string          `json:"name"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	URI         string          `json:"uri,omitempty"`
+	ContentType string          `json:"content_type,omitempty"`
+	Size        int64           `json:"size,omitempty"`
+	SHA256      string          `json:"sha256,omitempty"`
+	CreatedAt   time.Time       `json:"created_at,omitzero"`
+}
+
+// AssignmentQuota is a tenant's running and queued assignments against its
+// limits; a limit of 0 means none applies. Creating an assignment past
+// MaxQueued, or starting one past MaxRunning, fails with
+// "orchestration.quota_exceeded".
+type AssignmentQuota struct {
+	TenantID   string `json:"tenant_id"`
+	Running    int    `json:"running"`
+	MaxRunning int    `json:"max_running"`
+	Queued     int    `json:"queued"`
+	MaxQueued  int    `json:"max_queued"`
+}
+
+// RetryPolicy says how often, and how far apart, an agent should attempt
+// an assignment before reporting it failed.
+type RetryPolicy struct {
+	MaxAttempts    int     `json:"max_attempts"`
+	BackoffSeconds float64 `json:"backoff_seconds,omitempty"`
+}
+
+// AssignRequest describes work to assign. An empty TenantID uses the tenant
+// bound to the caller's credentials. Template names a workload template
+// (managed at /workload-templates) that supplies WorkloadID when it is
+// empty and metadata beneath Metadata.
+type AssignRequest struct {
+	AgentID    string            `json:"agent_id"`
+	WorkloadID string            `json:"workload_id"`
+	TenantID   string            `json:"tenant_id"`
+	ProjectID  string            `json:"project_id"`
+	Template   string            `json:"template,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// AgentDrainStatus reports an agent's drain. While Draining, no work can be
+// assigned to or started on the agent ("orchestration.agent_draining");
+// Drained is set once it has no pending or running assignments left.
+type AgentDrainStatus struct {
+	AgentID    string    `json:"agent_id"`
+	Draining   bool      `json:"draining"`
+	Reason     string    `json:"reason,omitempty"`
+	ReassignTo []string  `json:"reassign_to,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	Reassigned int       `json:"reassigned"`
+	Pending    int       `json:"pending"`
+	Running    int       `json:"running"`
+	Drained    bool      `json:"drained"`
+}
+
+// SimulateRequest plans Count assignments (1 by default) of the work in
+// AssignRequest without creating them. AgentID and Agents name the
+// candidate agents; with neither, every agent that has held an assignment
+// of the tenant is one.
+type SimulateRequest struct {
+	AssignRequest
+	Agents []string `json:"agents,omitempty"`
+	Count  int      `json:"count,omitempty"`
+}
+
+// AgentEstimate is one candidate agent's load and when planned work would
+// start on it. Draining agents are not Eligible. The estimates are omitted
+// for agents with work ahead that finished none in the last hour.
+type AgentEstimate struct {
+	AgentID           string    `json:"agent_id"`
+	Eligible          bool      `json:"eligible"`
+	Reason            string    `json:"reason,omitempty"`
+	Pending           int       `json:"pending"`
+	Running           int       `json:"running"`
+	ThroughputPerHour int       `json:"throughput_per_hour"`
+	EstimatedStartAt  time.Time `json:"estimated_start_at"`
+	LastStartAt       time.Time `json:"last_start_at"`
+}
+
+// Simulation reports where planned work would queue and when it would
+// start. Admitted counts the planned assignments the tenant's queued
+// quota would accept. Agents lists eligible agents first, earliest start
+// first.
+type Simulation struct {
+	TenantID             string          `json:"tenant_id"`
+	ProjectID            string          `json:"project_id"`
+	WorkloadID           string          `json:"workload_id"`
+	Template             string          `json:"template,omitempty"`
+	RequiredCapabilities []string        `json:"required_capabilities,omitempty"`
+	Priority             int             `json:"priority,omitempty"`
+	Count                int             `json:"count"`
+	QueuePosition        int             `json:"queue_position"`
+	Admitted             int             `json:"admitted"`
+	Quota                AssignmentQuota `json:"quota"`
+	Agents               []AgentEstimate `json:"agents"`
+	EstimatedStartAt     time.Time       `json:"estimated_start_at"`
+}
+
+// AssignmentFilter narrows ListAssignments; empty fields match everything.
+type AssignmentFilter struct {
+	AgentID   string
+	TenantID  string
+	ProjectID string
+	Status    string
+}
+
+// Orchestration calls the orchestrator.
+type Orchestration struct {
+	b *base
+}
+
+// NewOrchestration returns a client for the orchestrator at baseURL.
+func NewOrchestration(baseURL string, opts ...Option) (*Orchestration, error) {
+	return newOrchestration(baseURL, "", opts)
+}
+
+func newOrchestration(baseURL, prefix string, opts []Option) (*Orchestration, error) {
+	b, err := newBase(baseURL, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Orchestration{b: b}, nil
+}
+
+// AssignWork creates an assignment. Each call creates a new one, so it is
+// only retried when the service declined it outright (429 or 503).
+func (c *Orchestration) AssignWork(ctx context.Context, req AssignRequest) (Assignment, error) {
+	var out Assignment
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/assignments", body: req}, &out)
+	return out, err
+}
+
+// Simulate reports which agents could take the work in req, where it
+// would queue, and when it would start, without creating anything.
+func (c *Orchestration) Simulate(ctx context.Context, req SimulateRequest) (Simulation, error) {
+	var out Simulation
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/assignments/simulate", body: req, idempotent: true}, &out)
+	return out, err
+}
+
+// UpdateStatus moves an assignment to status, with an optional message.
+func (c *Orchestration) UpdateStatus(ctx context.Context, assignmentID, status, message string) (Assignment, error) {
+	var out Assignment
+	err := c.b.do(ctx, call{
+		method: http.MethodPatch,
+		path:   "/assignments/" + url.PathEscape(assignmentID),
+		body: struct {
+			Status        string `json:"status"`
+			StatusMessage string `json:"status_message,omitempty"`
+		}{status, message},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// GetAssignment returns an assignment.
+func (c *Orchestration) GetAssignment(ctx context.Context, assignmentID string) (Assignment, error) {
+	var out Assignment
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/assignments/" + url.PathEscape(assignmentID), idempotent: true}, &out)
+	return out, err
+}
+
+// AttachArtifact attaches artifact to an assignment, replacing its
+// artifact of the same name, and returns the assignment.
+func (c *Orchestration) AttachArtifact(ctx context.Context, assignmentID string, artifact Artifact) (Assignment, error) {
+	var out Assignment
+	err := c.b.do(ctx, call{
+		method:     http.MethodPost,
+		path:       "/assignments/" + url.PathEscape(assignmentID) + "/artifacts",
+		body:       artifact,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Artifact returns an assignment's artifact with name.
+func (c *Orchestration) Artifact(ctx context.Context, assignmentID, name string) (Artifact, error) {
+	var out Artifact
+	err := c.b.do(ctx, call{
+		method:     http.MethodGet,
+		path:       "/assignments/" + url.PathEscape(assignmentID) + "/artifacts/" + url.PathEscape(name),
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Quota reports a tenant's assignments against its quotas. An empty
+// tenantID uses the tenant bound to the caller's credentials.
+func (c *Orchestration) Quota(ctx context.Context, tenantID string) (AssignmentQuota, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	var out AssignmentQuota
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/quotas", query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// ListAssignments returns all assignments matching filter, fetching every
+// page.
+func (c *Orchestration) ListAssignments(ctx context.Context, filter AssignmentFilter) ([]Assignment, error) {
+	return all[Assignment](ctx, c.b, listAssignmentsCall(filter))
+}
+
+// ListAssignmentsPage returns one page of assignments matching filter.
+func (c *Orchestration) ListAssignmentsPage(ctx context.Context, filter AssignmentFilter, opts PageOptions) (Page[Assignment], error) {
+	return page[Assignment](ctx, c.b, listAssignmentsCall(filter), opts)
+}
+
+func listAssignmentsCall(filter AssignmentFilter) call {
+	query := url.Values{}
+	setIf(query, "agent_id", filter.AgentID)
+	setIf(query, "tenant_id", filter.TenantID)
+	setIf(query, "project_id", filter.ProjectID)
+	setIf(query, "status", filter.Status)
+	return call{method: http.MethodGet, path: "/assignments", query: query, idempotent: true}
+}
+
+// DrainAgent stops work being assigned to agentID and moves its pending
+// assignments to the agents in reassignTo, in turn. Draining an agent
+// again updates its reason and targets and moves what is still pending.
+func (c *Orchestration) DrainAgent(ctx context.Context, agentID, reason string, reassignTo []string) (AgentDrainStatus, error) {
+	var out AgentDrainStatus
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   drainPath(agentID),
+		body: struct {
+			Reason     string   `json:"reason,omitempty"`
+			ReassignTo []string `json:"reassign_to,omitempty"`
+		}{reason, reassignTo},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// AgentDrain reports whether agentID is draining and how much of its work
+// remains.
+func (c *Orchestration) AgentDrain(ctx context.Context, agentID string) (AgentDrainStatus, error) {
+	var out AgentDrainStatus
+	err := c.b.do(ctx, call{method: http.MethodGet, path: drainPath(agentID), idempotent: true}, &out)
+	return out, err
+}
+
+// UndrainAgent ends agentID's drain, so work can be assigned to it again.
+func (c *Orchestration) UndrainAgent(ctx context.Context, agentID string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: drainPath(agentID), idempotent: true}, nil)
+}
+
+func drainPath(agentID string) string {
+	return "/agents/" + url.PathEscape(agentID) + "/drain"
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"maps"
+	"net/url"
+	"strconv"
+)
+
+// Page is one page of a list call. A non-empty NextCursor is passed as
+// PageOptions.Cursor to fetch the following page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PageOptions selects one page of a list call: up to Limit items, or the
+// service's default page size when 0, following Cursor, or from the start
+// when empty.
+type PageOptions struct {
+	Limit  int
+	Cursor string
+}
+
+// set adds the page parameters to query. The cursor is sent even when
+// empty, because endpoints that answered with a bare JSON array before
+// they were paged only send the page envelope to requests that name one.
+func (o PageOptions) set(query url.Values) {
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	query.Set("cursor", o.Cursor)
+}
+
+// page runs the list call c for the page selected by opts.
+func page[T any](ctx context.Context, b *base, c call, opts PageOptions) (Page[T], error) {
+	c.query = maps.Clone(c.query)
+	if c.query == nil {
+		c.query = url.Values{}
+	}
+	opts.set(c.query)
+	var out Page[T]
+	err := b.do(ctx, c, &out)
+	return out, err
+}
+
+// all runs the list call c page by page and returns every item.
+func all[T any](ctx context.Context, b *base, c call) ([]T, error) {
+	var items []T
+	opts := PageOptions{}
+	for {
+		p, err := page[T](ctx, b, c, opts)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, p.Items...)
+		if p.NextCursor == "" {
+			return items, nil
+		}
+		opts.Cursor = p.NextCursor
+	}
+}
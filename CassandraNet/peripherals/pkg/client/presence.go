@@ -0,0 +1,178 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Kinds of presence records.
+const (
+	PresencePlayer = "player"
+	PresenceServer = "server"
+)
+
+// Presence statuses.
+const (
+	PresenceOnline  = "online"
+	PresenceOffline = "offline"
+)
+
+// Reasons a presence changed.
+const (
+	PresenceReasonHeartbeat  = "heartbeat"
+	PresenceReasonDisconnect = "disconnect"
+	PresenceReasonExpired    = "expired"
+)
+
+// PresenceRecord is the last known state of a player or game server.
+type PresenceRecord struct {
+	Kind        string            `json:"kind"`
+	ID          string            `json:"id"`
+	TenantID    string            `json:"tenant_id,omitempty"`
+	ProjectID   string            `json:"project_id"`
+	Status      string            `json:"status"`
+	SessionID   string            `json:"session_id,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	OnlineSince time.Time         `json:"online_since,omitzero"`
+	LastSeen    time.Time         `json:"last_seen,omitzero"`
+	ExpiresAt   time.Time         `json:"expires_at,omitzero"`
+	Version     int64             `json:"version"`
+}
+
+// PresenceChange is one record going online, starting a new session, or
+// going offline.
+type PresenceChange struct {
+	Presence PresenceRecord `json:"presence"`
+	Previous string         `json:"previous_status"`
+	Reason   string         `json:"reason"`
+}
+
+// HeartbeatRequest keeps a player or game server online. A zero TTL uses
+// the service's default; a SessionID different from the current one
+// starts a new session; non-nil Metadata replaces the stored metadata.
+type HeartbeatRequest struct {
+	SessionID string            `json:"session_id,omitempty"`
+	TTL       time.Duration     `json:"-"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// PresenceScope names a project and optionally one tenant of it. An empty
+// TenantID uses the tenant bound to the caller's credentials.
+type PresenceScope struct {
+	TenantID  string
+	ProjectID string
+}
+
+func (s PresenceScope) query() url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", s.TenantID)
+	setIf(query, "project_id", s.ProjectID)
+	return query
+}
+
+// Presence calls the presence service.
+type Presence struct {
+	b *base
+}
+
+// NewPresence returns a client for the presence service at baseURL.
+func NewPresence(baseURL string, opts ...Option) (*Presence, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Presence{b: b}, nil
+}
+
+// Heartbeat marks the player or game server of kind with id online until
+// its TTL lapses.
+func (c *Presence) Heartbeat(ctx context.Context, scope PresenceScope, kind, id string, req HeartbeatRequest) (PresenceRecord, error) {
+	body := struct {
+		HeartbeatRequest
+		TTLSeconds int64 `json:"ttl_seconds,omitempty"`
+	}{req, int64(req.TTL / time.Second)}
+	var out PresenceRecord
+	err := c.b.do(ctx, call{method: http.MethodPost, path: presencePath(kind, id) + "/heartbeat", query: scope.query(), body: body, idempotent: true}, &out)
+	return out, err
+}
+
+// Disconnect marks the record of kind with id offline, ending its session.
+func (c *Presence) Disconnect(ctx context.Context, scope PresenceScope, kind, id string) (PresenceRecord, error) {
+	var out PresenceRecord
+	err := c.b.do(ctx, call{method: http.MethodDelete, path: presencePath(kind, id), query: scope.query(), idempotent: true}, &out)
+	return out, err
+}
+
+// Get returns the record of kind with id.
+func (c *Presence) Get(ctx context.Context, scope PresenceScope, kind, id string) (PresenceRecord, error) {
+	var out PresenceRecord
+	err := c.b.do(ctx, call{method: http.MethodGet, path: presencePath(kind, id), query: scope.query(), idempotent: true}, &out)
+	return out, err
+}
+
+// Query returns the presence of up to 100 IDs of kind, in the order given.
+// IDs never seen are reported offline.
+func (c *Presence) Query(ctx context.Context, scope PresenceScope, kind string, ids []string) ([]PresenceRecord, error) {
+	body := struct {
+		Kind string   `json:"kind"`
+		IDs  []string `json:"ids"`
+	}{kind, ids}
+	var out struct {
+		Items []PresenceRecord `json:"items"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/presence/query", query: scope.query(), body: body, idempotent: true}, &out)
+	return out.Items, err
+}
+
+// List returns the scope's records of kind, or of every kind when kind is
+// empty, fetching every page.
+func (c *Presence) List(ctx context.Context, scope PresenceScope, kind string) ([]PresenceRecord, error) {
+	return all[PresenceRecord](ctx, c.b, c.list(scope, kind))
+}
+
+// ListPage returns one page of the scope's records of kind.
+func (c *Presence) ListPage(ctx context.Context, scope PresenceScope, kind string, opts PageOptions) (Page[PresenceRecord], error) {
+	return page[PresenceRecord](ctx, c.b, c.list(scope, kind), opts)
+}
+
+func (c *Presence) list(scope PresenceScope, kind string) call {
+	query := scope.query()
+	setIf(query, "kind", kind)
+	return call{method: http.MethodGet, path: "/presence", query: query, idempotent: true}
+}
+
+// Watch streams presence changes of the scope's records of kind with the
+// given IDs; an empty kind or no IDs watch all. When IDs are given, fn
+// first receives their current state as changes with an empty Reason.
+// Watch returns when ctx is cancelled, fn returns an error, or the stream
+// ends; the server ends streams that fall behind, so callers that need
+// every change should call Watch again.
+func (c *Presence) Watch(ctx context.Context, scope PresenceScope, kind string, ids []string, fn func(PresenceChange) error) error {
+	query := scope.query()
+	setIf(query, "kind", kind)
+	for _, id := range ids {
+		query.Add("id", id)
+	}
+	return c.b.stream(ctx, "/presence/stream", query, "", func(e sseEvent) error {
+		var change PresenceChange
+		var err error
+		if e.name == "presence" {
+			err = json.Unmarshal(e.data, &change.Presence)
+			change.Previous = change.Presence.Status
+		} else {
+			err = json.Unmarshal(e.data, &change)
+		}
+		if err != nil {
+			return fmt.Errorf("client: decode presence %s event: %w", e.name, err)
+		}
+		return fn(change)
+	})
+}
+
+func presencePath(kind, id string) string {
+	return "/presence/" + url.PathEscape(kind) + "s/" + url.PathEscape(id)
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Service names instances register under in cmd/registry.
+const (
+	ServiceGateway       = "gateway"
+	ServiceMessaging     = "messaging-service"
+	ServiceUGC           = "ugc-service"
+	ServiceUGCWorker     = "ugc-worker"
+	ServiceOrchestration = "orchestrator"
+	ServiceNotifications = "notification"
+	ServiceLogs          = "log-pipeline"
+	ServiceMetrics       = "metrics-collector"
+	ServiceConfig        = "config-service"
+	ServiceHealthBoard   = "healthboard"
+	ServiceFeatureFlags  = "feature-flags"
+	ServiceScheduler     = "scheduler"
+	ServicePresence      = "presence"
+)
+
+// ErrNoInstances is returned by Resolve when a service has no registered
+// instance able to take traffic.
+var ErrNoInstances = errors.New("client: no available instance")
+
+// Instance is one registered copy of a service.
+type Instance struct {
+	Service string `json:"service"`
+	ID      string `json:"id"`
+	// URL is the instance's base URL, suitable for the New* constructors.
+	URL string `json:"url"`
+	// Status is the instance's readiness: "ok", "degraded", or "fail".
+	Status        string            `json:"status"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	TTLSeconds    float64           `json:"ttl_seconds"`
+	RegisteredAt  time.Time         `json:"registered_at"`
+	LastHeartbeat time.Time         `json:"last_heartbeat"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+}
+
+// Registry calls the service registry to find service instances:
+//
+//	reg, err := client.NewRegistry("http://localhost:8095", client.WithAPIKey(key))
+//	base, err := reg.Resolve(ctx, client.ServiceUGC)
+//	ugc, err := client.NewUGC(base, client.WithAPIKey(key))
+type Registry struct {
+	b *base
+}
+
+// NewRegistry returns a client for the service registry at baseURL.
+func NewRegistry(baseURL string, opts ...Option) (*Registry, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Registry{b: b}, nil
+}
+
+// Services returns the live instances of every service, keyed by service.
+func (c *Registry) Services(ctx context.Context) (map[string][]Instance, error) {
+	var out map[string][]Instance
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/services", idempotent: true}, &out)
+	return out, err
+}
+
+// Instances returns the live instances of service.
+func (c *Registry) Instances(ctx context.Context, service string) ([]Instance, error) {
+	var out []Instance
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/services/" + url.PathEscape(service), idempotent: true}, &out)
+	return out, err
+}
+
+// Resolve returns the base URL of a random healthy instance of service,
+// falling back to a degraded one when none is healthy.
+func (c *Registry) Resolve(ctx context.Context, service string) (string, error) {
+	instances, err := c.Instances(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	for _, want := range []string{"ok", "degraded"} {
+		var candidates []Instance
+		for _, inst := range instances {
+			if inst.Status == want {
+				candidates = append(candidates, inst)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates[rand.N(len(candidates))].URL, nil
+		}
+	}
+	return "", fmt.Errorf("%w for %s", ErrNoInstances, service)
+}
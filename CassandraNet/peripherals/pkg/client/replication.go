@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ReplicationStatus describes replication to and from a deployment.
+type ReplicationStatus struct {
+	Service string `json:"service"`
+	Region  string `json:"region"`
+	PeerURL string `json:"peer_url,omitempty"`
+	// Kinds lists the mutations the service applies.
+	Kinds  []string          `json:"kinds"`
+	Outbox ReplicationOutbox `json:"outbox"`
+	// Peers lists each origin whose mutations were applied.
+	Peers []ReplicationPeer `json:"peers"`
+}
+
+// ReplicationOutbox describes the mutations waiting for the peer region.
+// The shipping fields describe the answering replica's own sends.
+type ReplicationOutbox struct {
+	Pending int `json:"pending"`
+	// LagSeconds is the age of the oldest pending mutation.
+	LagSeconds       float64    `json:"lag_seconds"`
+	OldestRecordedAt *time.Time `json:"oldest_recorded_at,omitempty"`
+	LastShippedSeq   uint64     `json:"last_shipped_seq"`
+	LastShippedAt    *time.Time `json:"last_shipped_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+	Failures         int        `json:"failures"`
+	RecordFailures   int64      `json:"record_failures"`
+}
+
+// ReplicationPeer describes the mutations applied from one origin region.
+type ReplicationPeer struct {
+	Origin         string    `json:"origin"`
+	LastSeq        uint64    `json:"last_seq"`
+	LastRecordedAt time.Time `json:"last_recorded_at"`
+	LastAppliedAt  time.Time `json:"last_applied_at"`
+	// LagSeconds is how long the last mutation took to arrive.
+	LagSeconds float64 `json:"lag_seconds"`
+	Applied    int64   `json:"applied"`
+	Conflicts  int64   `json:"conflicts"`
+}
+
+// Replication reads a service's cross-region replication status.
+type Replication struct {
+	b *base
+}
+
+// NewReplication returns a client for the replication API at baseURL.
+func NewReplication(baseURL string, opts ...Option) (*Replication, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Replication{b: b}, nil
+}
+
+// Status returns the outbox and the progress of each peer region.
+func (c *Replication) Status(ctx context.Context) (ReplicationStatus, error) {
+	var out ReplicationStatus
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/replication", idempotent: true}, &out)
+	return out, err
+}
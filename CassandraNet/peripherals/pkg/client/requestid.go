@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+)
+
+// RequestIDHeader carries a call's correlation ID. Services reuse it for
+// their log lines and pass it on to the services they call.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose calls send id as their request ID,
+// so several calls, or a call and the caller's own logs, share one.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID set on ctx with WithRequestID, if any.
+// Calls made without one send a new ID, the same for each of their
+// retries; the ID of a failed call is also in Error.RequestID.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ensureRequestID returns ctx with a request ID, generating one when it
+// has none.
+func ensureRequestID(ctx context.Context) context.Context {
+	if RequestID(ctx) != "" {
+		return ctx
+	}
+	return WithRequestID(ctx, rand.Text())
+}
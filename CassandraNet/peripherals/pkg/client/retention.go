@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetentionReport is the outcome of one run of a retention policy.
+type RetentionReport struct {
+	Policy     string    `json:"policy"`
+	Trigger    string    `json:"trigger"`
+	DryRun     bool      `json:"dry_run"`
+	Cutoff     time.Time `json:"cutoff"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Records counts the records removed, or on a dry run the records
+	// that would have been.
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RetentionPolicy describes a registered retention policy.
+type RetentionPolicy struct {
+	Name          string           `json:"name"`
+	Description   string           `json:"description"`
+	MaxAgeSeconds int64            `json:"max_age_seconds"`
+	Enabled       bool             `json:"enabled"`
+	DryRun        bool             `json:"dry_run"`
+	LastReport    *RetentionReport `json:"last_report,omitempty"`
+}
+
+// Retention calls a service's retention API. Each service lists only the
+// policies it registered; the all-in-one binary lists every service's.
+type Retention struct {
+	b *base
+}
+
+// NewRetention returns a client for the retention API at baseURL.
+func NewRetention(baseURL string, opts ...Option) (*Retention, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Retention{b: b}, nil
+}
+
+// Policies returns the registered policies, ordered by name.
+func (c *Retention) Policies(ctx context.Context) ([]RetentionPolicy, error) {
+	var out struct {
+		Items []RetentionPolicy `json:"items"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/retention", idempotent: true}, &out)
+	return out.Items, err
+}
+
+// Reports returns the policy's recent reports, newest first.
+func (c *Retention) Reports(ctx context.Context, name string) ([]RetentionReport, error) {
+	var out struct {
+		Items []RetentionReport `json:"items"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/retention/" + url.PathEscape(name) + "/reports", idempotent: true}, &out)
+	return out.Items, err
+}
+
+// Run runs the policy now and returns its report. A nil dryRun uses the
+// policy's configured mode.
+func (c *Retention) Run(ctx context.Context, name string, dryRun *bool) (RetentionReport, error) {
+	query := url.Values{}
+	if dryRun != nil {
+		query.Set("dry_run", strconv.FormatBool(*dryRun))
+	}
+	var out RetentionReport
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/retention/" + url.PathEscape(name) + "/run", query: query}, &out)
+	return out, err
+}
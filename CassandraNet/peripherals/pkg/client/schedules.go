@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Action types of scheduled jobs.
+const (
+	ScheduleActionHTTP    = "http"
+	ScheduleActionPublish = "publish"
+	ScheduleActionNotify  = "notify"
+)
+
+// Overlap policies of scheduled jobs.
+const (
+	// ScheduleOverlapSkip records a due run as skipped while the previous
+	// run is still going. It is the default.
+	ScheduleOverlapSkip = "skip"
+	// ScheduleOverlapAllow runs alongside the previous run.
+	ScheduleOverlapAllow = "allow"
+)
+
+// Statuses of scheduled runs.
+const (
+	ScheduleRunRunning   = "running"
+	ScheduleRunSucceeded = "succeeded"
+	ScheduleRunFailed    = "failed"
+	ScheduleRunSkipped   = "skipped"
+)
+
+// Schedule is a job the scheduler fires on a cron schedule.
+type Schedule struct {
+	ID          string         `json:"id"`
+	TenantID    string         `json:"tenant_id,omitempty"`
+	ProjectID   string         `json:"project_id"`
+	Name        string         `json:"name,omitempty"`
+	Schedule    string         `json:"schedule"`
+	Timezone    string         `json:"timezone,omitempty"`
+	Action      ScheduleAction `json:"action"`
+	Overlap     string         `json:"overlap"`
+	Paused      bool           `json:"paused"`
+	NextRunAt   time.Time      `json:"next_run_at,omitzero"`
+	LastRunAt   time.Time      `json:"last_run_at,omitzero"`
+	LastStatus  string         `json:"last_status,omitempty"`
+	ActiveRun   string         `json:"active_run,omitempty"`
+	ActiveUntil time.Time      `json:"active_until,omitzero"`
+	Version     int64          `json:"version"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// ScheduleAction is what a job does; set the field matching Type.
+type ScheduleAction struct {
+	Type    string                 `json:"type"`
+	HTTP    *ScheduleHTTPAction    `json:"http,omitempty"`
+	Publish *SchedulePublishAction `json:"publish,omitempty"`
+	Notify  *ScheduleNotifyAction  `json:"notify,omitempty"`
+}
+
+// ScheduleHTTPAction calls URL, with POST when Method is empty. Responses
+// outside 2xx fail the run.
+type ScheduleHTTPAction struct {
+	Method  string            `json:"method,omitempty"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// SchedulePublishAction publishes Payload to a messaging topic in the
+// job's tenant and project.
+type SchedulePublishAction struct {
+	Topic      string            `json:"topic"`
+	Key        string            `json:"key,omitempty"`
+	Payload    string            `json:"payload,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ScheduleNotifyAction sends a notification rendered from Template.
+type ScheduleNotifyAction struct {
+	Channel   string         `json:"channel"`
+	Recipient string         `json:"recipient"`
+	Template  string         `json:"template"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// ScheduleRequest defines a job. Schedule is a five-field cron expression
+// or a macro such as @hourly, read in Timezone (UTC when empty).
+type ScheduleRequest struct {
+	Name     string         `json:"name,omitempty"`
+	Schedule string         `json:"schedule"`
+	Timezone string         `json:"timezone,omitempty"`
+	Action   ScheduleAction `json:"action"`
+	Overlap  string         `json:"overlap,omitempty"`
+	Paused   bool           `json:"paused,omitempty"`
+	// IfVersion, when non-zero, makes the change fail with
+	// "schedules.precondition_failed" unless the stored job has that
+	// version.
+	IfVersion int64 `json:"-"`
+}
+
+// ScheduleScope names a project and optionally one tenant of it. An empty
+// TenantID uses the tenant bound to the caller's credentials.
+type ScheduleScope struct {
+	TenantID  string
+	ProjectID string
+}
+
+func (s ScheduleScope) query() url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", s.TenantID)
+	setIf(query, "project_id", s.ProjectID)
+	return query
+}
+
+// ScheduleRun is one firing of a job.
+type ScheduleRun struct {
+	ID          string    `json:"id"`
+	JobID       string    `json:"job_id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	ProjectID   string    `json:"project_id"`
+	Trigger     string    `json:"trigger"`
+	Status      string    `json:"status"`
+	ScheduledAt time.Time `json:"scheduled_at,omitzero"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+	Detail      string    `json:"detail,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Scheduler calls the scheduler service.
+type Scheduler struct {
+	b *base
+}
+
+// NewScheduler returns a client for the scheduler service at baseURL.
+func NewScheduler(baseURL string, opts ...Option) (*Scheduler, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{b: b}, nil
+}
+
+// PutSchedule creates or replaces the scope's job with id.
+func (c *Scheduler) PutSchedule(ctx context.Context, scope ScheduleScope, id string, req ScheduleRequest) (Schedule, error) {
+	var header http.Header
+	if req.IfVersion != 0 {
+		header = http.Header{"If-Match": {`"` + strconv.FormatInt(req.IfVersion, 10) + `"`}}
+	}
+	var out Schedule
+	err := c.b.do(ctx, call{
+		method:     http.MethodPut,
+		path:       "/schedules/" + url.PathEscape(id),
+		query:      scope.query(),
+		body:       req,
+		header:     header,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// GetSchedule returns the scope's job with id.
+func (c *Scheduler) GetSchedule(ctx context.Context, scope ScheduleScope, id string) (Schedule, error) {
+	var out Schedule
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/schedules/" + url.PathEscape(id), query: scope.query(), idempotent: true}, &out)
+	return out, err
+}
+
+// DeleteSchedule removes the scope's job with id and its run history.
+func (c *Scheduler) DeleteSchedule(ctx context.Context, scope ScheduleScope, id string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: "/schedules/" + url.PathEscape(id), query: scope.query(), idempotent: true}, nil)
+}
+
+// ListSchedules returns the scope's jobs, fetching every page.
+func (c *Scheduler) ListSchedules(ctx context.Context, scope ScheduleScope) ([]Schedule, error) {
+	return all[Schedule](ctx, c.b, call{method: http.MethodGet, path: "/schedules", query: scope.query(), idempotent: true})
+}
+
+// ListSchedulesPage returns one page of the scope's jobs.
+func (c *Scheduler) ListSchedulesPage(ctx context.Context, scope ScheduleScope, opts PageOptions) (Page[Schedule], error) {
+	return page[Schedule](ctx, c.b, call{method: http.MethodGet, path: "/schedules", query: scope.query(), idempotent: true}, opts)
+}
+
+// Trigger starts a run of the job now and returns it while it runs. It
+// fails with "schedules.run_in_progress" when the job skips overlapping
+// runs and its previous run is still going.
+func (c *Scheduler) Trigger(ctx context.Context, scope ScheduleScope, id string) (ScheduleRun, error) {
+	var out ScheduleRun
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/schedules/" + url.PathEscape(id) + "/trigger", query: scope.query()}, &out)
+	return out, err
+}
+
+// Runs returns the job's run history, newest first, fetching every page.
+func (c *Scheduler) Runs(ctx context.Context, scope ScheduleScope, id string) ([]ScheduleRun, error) {
+	return all[ScheduleRun](ctx, c.b, call{method: http.MethodGet, path: "/schedules/" + url.PathEscape(id) + "/runs", query: scope.query(), idempotent: true})
+}
+
+// RunsPage returns one page of the job's run history, newest first.
+func (c *Scheduler) RunsPage(ctx context.Context, scope ScheduleScope, id string, opts PageOptions) (Page[ScheduleRun], error) {
+	return page[ScheduleRun](ctx, c.b, call{method: http.MethodGet, path: "/schedules/" + url.PathEscape(id) + "/runs", query: scope.query(), idempotent: true}, opts)
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Event is a value received from a service's event stream. Passing the ID
+// of the last event handled when streaming again resumes after it, while
+// the service still holds the events that followed; otherwise the new
+// stream starts with the next event.
+type Event[T any] struct {
+	ID    string
+	Value T
+}
+
+// sseEvent is one server-sent event as read off the wire.
+type sseEvent struct {
+	id   string
+	name string
+	data []byte
+}
+
+// stream opens the event stream at path and calls fn with each event until
+// ctx is cancelled, fn returns an error, or the service ends the stream.
+// Streams are not retried: the caller decides whether to stream again.
+func (b *base) stream(ctx context.Context, path string, query url.Values, lastEventID string, fn func(sseEvent) error) error {
+	target := b.url.JoinPath(b.prefix, path)
+	target.RawQuery = query.Encode()
+	req, err := b.newRequest(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(nil, 1<<20)
+	var event sseEvent
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event.data != nil {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			event = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = []byte(strings.TrimPrefix(line, "data: "))
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// streamValues streams path, decoding each event named name as a T.
+func streamValues[T any](ctx context.Context, b *base, path string, query url.Values, lastEventID, name string, fn func(Event[T]) error) error {
+	return b.stream(ctx, path, query, lastEventID, func(e sseEvent) error {
+		if e.name != name {
+			return nil
+		}
+		var v T
+		if err := json.Unmarshal(e.data, &v); err != nil {
+			return fmt.Errorf("client: decode %s event: %w", name, err)
+		}
+		return fn(Event[T]{ID: e.id, Value: v})
+	})
+}
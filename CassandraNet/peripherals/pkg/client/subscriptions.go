@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Subscription starts accepted by PutSubscription.
+const (
+	SubscriptionStartLatest   = "latest"
+	SubscriptionStartEarliest = "earliest"
+)
+
+// Subscription is a named reader of a topic. Each subscription receives
+// every message in its scope; the consumers pulling one share its
+// messages. InFlight counts messages delivered and not yet acknowledged.
+type Subscription struct {
+	TenantID           string    `json:"tenant_id,omitempty"`
+	ProjectID          string    `json:"project_id,omitempty"`
+	Topic              string    `json:"topic"`
+	Name               string    `json:"name"`
+	AckDeadlineSeconds int       `json:"ack_deadline_seconds"`
+	InFlight           int       `json:"in_flight"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	LastPulledAt       time.Time `json:"last_pulled_at,omitzero"`
+}
+
+// SubscriptionOptions selects a subscription's scope, which may be empty
+// as for pulls, and, when creating it, its ack deadline (30 seconds when
+// zero) and where it starts: SubscriptionStartLatest, the default, or
+// SubscriptionStartEarliest to receive the messages already pending.
+type SubscriptionOptions struct {
+	TenantID    string
+	ProjectID   string
+	AckDeadline time.Duration
+	Start       string
+}
+
+func subscriptionPath(topic, name string, rest ...string) string {
+	path := "/topics/" + url.PathEscape(topic) + "/subscriptions/" + url.PathEscape(name)
+	for _, segment := range rest {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+func scopeQuery(tenantID, projectID string) url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	setIf(query, "project_id", projectID)
+	return query
+}
+
+// PutSubscription creates the subscription name to topic, or updates the
+// ack deadline of an existing one, which keeps its position.
+func (c *Messaging) PutSubscription(ctx context.Context, topic, name string, opts SubscriptionOptions) (Subscription, error) {
+	var out Subscription
+	err := c.b.do(ctx, call{
+		method: http.MethodPut,
+		path:   subscriptionPath(topic, name),
+		query:  scopeQuery(opts.TenantID, opts.ProjectID),
+		body: struct {
+			AckDeadlineSeconds int    `json:"ack_deadline_seconds,omitempty"`
+			Start              string `json:"start,omitempty"`
+		}{int(opts.AckDeadline / time.Second), opts.Start},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Subscription returns the subscription name to topic in the scope of
+// tenantID and projectID. A missing one returns an error with code
+// "messaging.not_found".
+func (c *Messaging) Subscription(ctx context.Context, topic, name, tenantID, projectID string) (Subscription, error) {
+	var out Subscription
+	err := c.b.do(ctx, call{method: http.MethodGet, path: subscriptionPath(topic, name), query: scopeQuery(tenantID, projectID), idempotent: true}, &out)
+	return out, err
+}
+
+// Subscriptions returns the subscriptions to topic in the scope of tenantID
+// and projectID.
+func (c *Messaging) Subscriptions(ctx context.Context, topic, tenantID, projectID string) ([]Subscription, error) {
+	var out Page[Subscription]
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/topics/" + url.PathEscape(topic) + "/subscriptions", query: scopeQuery(tenantID, projectID), idempotent: true}, &out)
+	return out.Items, err
+}
+
+// DeleteSubscription removes the subscription name to topic. The topic's
+// messages stay pending.
+func (c *Messaging) DeleteSubscription(ctx context.Context, topic, name, tenantID, projectID string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: subscriptionPath(topic, name), query: scopeQuery(tenantID, projectID)}, nil)
+}
+
+// PullSubscription delivers up to limit messages (10 when zero) of the
+// subscription name to topic. Messages not acknowledged with
+// AckSubscription within the subscription's ack deadline are delivered
+// again. Like publishing, a pull is only retried when the service declined
+// it outright, since the messages of a lost response wait out the ack
+// deadline.
+func (c *Messaging) PullSubscription(ctx context.Context, topic, name string, limit int, opts SubscriptionOptions) ([]Message, error) {
+	query := scopeQuery(opts.TenantID, opts.ProjectID)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out Page[messageWire]
+	if err := c.b.do(ctx, call{method: http.MethodGet, path: subscriptionPath(topic, name, "messages"), query: query}, &out); err != nil {
+		return nil, err
+	}
+	messages := make([]Message, 0, len(out.Items))
+	for _, wire := range out.Items {
+		message, err := wire.message()
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// AckSubscription acknowledges the subscription's delivery of messageID.
+// The message stays pending on the topic for other subscriptions. An ack
+// after the message was acknowledged, or for one not delivered to the
+// subscription, returns an error with code "messaging.not_found".
+func (c *Messaging) AckSubscription(ctx context.Context, topic, name, messageID string, opts SubscriptionOptions) error {
+	return c.b.do(ctx, call{method: http.MethodPost, path: subscriptionPath(topic, name, "messages", messageID, "ack"), query: scopeQuery(opts.TenantID, opts.ProjectID), idempotent: true}, nil)
+}
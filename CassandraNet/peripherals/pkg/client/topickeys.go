@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Attributes the messaging service sets on messages whose payload it
+// encrypted to their topic's key.
+const (
+	AttrEncryption      = "encryption"
+	AttrEncryptionKeyID = "encryption_key_id"
+)
+
+// TopicKeyAlgorithm is the scheme of topic keys: X25519, HKDF-SHA256, and
+// AES-256-GCM.
+const TopicKeyAlgorithm = "x25519-hkdf-sha256-aes256gcm"
+
+const topicKeyInfo = "cassandra messaging topic key"
+
+// TopicKey is a public key registered for a topic. Payloads published to
+// the topic are stored encrypted to it.
+type TopicKey struct {
+	TenantID  string    `json:"tenant_id"`
+	Topic     string    `json:"topic"`
+	Algorithm string    `json:"algorithm"`
+	PublicKey []byte    `json:"public_key"`
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func topicKeyPath(topic string) string {
+	return "/topics/" + url.PathEscape(topic) + "/key"
+}
+
+// PutTopicKey registers key as tenantID's key for topic, replacing any
+// earlier one; an empty tenantID uses the tenant bound to the caller's
+// credentials. Generate the key pair with ecdh.X25519().GenerateKey and
+// keep the private key with the consumers.
+func (c *Messaging) PutTopicKey(ctx context.Context, topic, tenantID string, key *ecdh.PublicKey) (TopicKey, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	var out TopicKey
+	err := c.b.do(ctx, call{
+		method: http.MethodPut,
+		path:   topicKeyPath(topic),
+		query:  query,
+		body: struct {
+			Algorithm string `json:"algorithm"`
+			PublicKey []byte `json:"public_key"`
+		}{TopicKeyAlgorithm, key.Bytes()},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// TopicKey returns tenantID's key for topic. A topic without one returns
+// an error with code "messaging.not_found".
+func (c *Messaging) TopicKey(ctx context.Context, topic, tenantID string) (TopicKey, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	var out TopicKey
+	err := c.b.do(ctx, call{method: http.MethodGet, path: topicKeyPath(topic), query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// DeleteTopicKey removes tenantID's key for topic. Messages stored while
+// it was registered stay encrypted to it.
+func (c *Messaging) DeleteTopicKey(ctx context.Context, topic, tenantID string) error {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	return c.b.do(ctx, call{method: http.MethodDelete, path: topicKeyPath(topic), query: query}, nil)
+}
+
+// OpenPayload returns m's payload, decrypting it with key when the service
+// encrypted it to its topic's key. Look up the private key by m's
+// AttrEncryptionKeyID when the topic's key has changed.
+func OpenPayload(key *ecdh.PrivateKey, m Message) ([]byte, error) {
+	switch m.Attributes[AttrEncryption] {
+	case "":
+		return m.Payload, nil
+	case TopicKeyAlgorithm:
+	default:
+		return nil, fmt.Errorf("client: unsupported payload encryption %q", m.Attributes[AttrEncryption])
+	}
+	size := len(key.PublicKey().Bytes())
+	if len(m.Payload) < size {
+		return nil, errors.New("client: encrypted payload too short")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(m.Payload[:size])
+	if err != nil {
+		return nil, fmt.Errorf("client: open payload: %w", err)
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("client: open payload: %w", err)
+	}
+	salt := append(append([]byte(nil), m.Payload[:size]...), key.PublicKey().Bytes()...)
+	secret, err := hkdf.Key(sha256.New, shared, salt, topicKeyInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("client: open payload: %w", err)
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("client: open payload: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("client: open payload: %w", err)
+	}
+	plaintext, err := aead.Open(nil, make([]byte, aead.NonceSize()), m.Payload[size:], nil)
+	if err != nil {
+		return nil, errors.New("client: open payload: wrong key or corrupted payload")
+	}
+	return plaintext, nil
+}
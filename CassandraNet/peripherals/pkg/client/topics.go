@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Topic holds the settings of a created topic. RetentionSeconds, when
+// positive, replaces the service's message retention for the topic;
+// MaxMessageBytes bounds payloads; and DefaultPriority and, when positive,
+// MessageTTLSeconds apply to messages published without a priority or a
+// TTL.
+type Topic struct {
+	Name              string    `json:"name"`
+	RetentionSeconds  int       `json:"retention_seconds"`
+	MaxMessageBytes   int       `json:"max_message_bytes"`
+	DefaultPriority   string    `json:"default_priority"`
+	MessageTTLSeconds int       `json:"message_ttl_seconds"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// TopicSettings configures a topic in PutTopic. Zero values select the
+// service's retention, a 1 MiB payload bound, PriorityNormal, and no TTL.
+type TopicSettings struct {
+	Retention       time.Duration
+	MaxMessageBytes int
+	DefaultPriority string
+	MessageTTL      time.Duration
+}
+
+// PutTopic creates the topic name, or replaces the settings of an existing
+// one.
+func (c *Messaging) PutTopic(ctx context.Context, name string, settings TopicSettings) (Topic, error) {
+	var out Topic
+	err := c.b.do(ctx, call{
+		method: http.MethodPut,
+		path:   "/topics/" + url.PathEscape(name),
+		body: struct {
+			RetentionSeconds  int    `json:"retention_seconds,omitempty"`
+			MaxMessageBytes   int    `json:"max_message_bytes,omitempty"`
+			DefaultPriority   string `json:"default_priority,omitempty"`
+			MessageTTLSeconds int    `json:"message_ttl_seconds,omitempty"`
+		}{int(settings.Retention / time.Second), settings.MaxMessageBytes, settings.DefaultPriority, int(settings.MessageTTL / time.Second)},
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Topic returns the settings of the topic name. A topic that was not
+// created returns an error with code "messaging.not_found".
+func (c *Messaging) Topic(ctx context.Context, name string) (Topic, error) {
+	var out Topic
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/topics/" + url.PathEscape(name), idempotent: true}, &out)
+	return out, err
+}
+
+// Topics returns every created topic, fetching every page.
+func (c *Messaging) Topics(ctx context.Context) ([]Topic, error) {
+	return all[Topic](ctx, c.b, call{method: http.MethodGet, path: "/topics", idempotent: true})
+}
+
+// TopicsPage returns one page of the created topics, ordered by name.
+func (c *Messaging) TopicsPage(ctx context.Context, opts PageOptions) (Page[Topic], error) {
+	return page[Topic](ctx, c.b, call{method: http.MethodGet, path: "/topics", idempotent: true}, opts)
+}
+
+// DeleteTopic removes the topic name. Its pending messages stay until they
+// are acknowledged or expire.
+func (c *Messaging) DeleteTopic(ctx context.Context, name string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: "/topics/" + url.PathEscape(name)}, nil)
+}
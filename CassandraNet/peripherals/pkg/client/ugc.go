@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Moderation states of submitted content.
+const (
+	StatePending  = "pending"
+	StateApproved = "approved"
+	StateRejected = "rejected"
+	StateArchived = "archived"
+)
+
+// Content is the metadata of a submitted content item.
+type Content struct {
+	ContentID   string            `json:"content_id"`
+	TenantID    string            `json:"tenant_id"`
+	ProjectID   string            `json:"project_id"`
+	Filename    string            `json:"filename"`
+	MimeType    string            `json:"mime_type"`
+	SizeBytes   uint64            `json:"size_bytes"`
+	State       string            `json:"state"`
+	Reason      string            `json:"reason,omitempty"`
+	SubmittedAt time.Time         `json:"submitted_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	// Media describes the bytes uploaded with UploadData, if any.
+	Media *Media `json:"media,omitempty"`
+}
+
+// Processing states of uploaded content bytes.
+const (
+	MediaPending   = "pending"
+	MediaProcessed = "processed"
+	MediaFailed    = "failed"
+)
+
+// Media is what processing found in a content item's uploaded bytes.
+// Content whose declared MimeType the DetectedType contradicts is rejected.
+type Media struct {
+	Status       string    `json:"status"`
+	SizeBytes    uint64    `json:"size_bytes"`
+	DetectedType string    `json:"detected_type,omitempty"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	Thumbnail    bool      `json:"thumbnail,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+	ProcessedAt  time.Time `json:"processed_at,omitzero"`
+}
+
+// SubmitRequest describes content to register for moderation. ContentID,
+// ProjectID, and Filename are required; an empty TenantID uses the tenant
+// bound to the caller's credentials.
+type SubmitRequest struct {
+	ContentID  string            `json:"content_id"`
+	TenantID   string            `json:"tenant_id"`
+	ProjectID  string            `json:"project_id"`
+	Filename   string            `json:"filename"`
+	MimeType   string            `json:"mime_type"`
+	SizeBytes  uint64            `json:"size_bytes"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ReviewRequest is a moderation decision.
+type ReviewRequest struct {
+	State  string `json:"state"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ContentFilter narrows ListContent; empty fields match everything.
+type ContentFilter struct {
+	TenantID  string
+	ProjectID string
+	State     string
+}
+
+// StatsQuery selects the moderation activity ModerationStats reports.
+// From and To are inclusive days (YYYY-MM-DD), defaulting to the last
+// seven days. An empty TenantID reports every tenant the caller may read.
+type StatsQuery struct {
+	TenantID  string
+	ProjectID string
+	From      string
+	To        string
+}
+
+// TenantStats is one tenant's moderation activity, or every tenant's in
+// ModerationStats.Total. Submitted and States count content submitted in
+// the range by its current state; Approved, Rejected, and the rates count
+// decisions made in the range.
+type TenantStats struct {
+	TenantID             string         `json:"tenant_id,omitempty"`
+	Submitted            int            `json:"submitted"`
+	States               map[string]int `json:"states"`
+	Approved             int            `json:"approved"`
+	Rejected             int            `json:"rejected"`
+	ApprovalRate         float64        `json:"approval_rate"`
+	RejectionRate        float64        `json:"rejection_rate"`
+	AverageReviewSeconds float64        `json:"average_review_seconds"`
+}
+
+// ModerationStats reports moderation activity over a range of days.
+type ModerationStats struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Total   TenantStats   `json:"total"`
+	Tenants []TenantStats `json:"tenants"`
+}
+
+// UGC calls the UGC metadata service.
+type UGC struct {
+	b *base
+}
+
+// NewUGC returns a client for the UGC service at baseURL.
+func NewUGC(baseURL string, opts ...Option) (*UGC, error) {
+	return newUGC(baseURL, "", opts)
+}
+
+func newUGC(baseURL, prefix string, opts []Option) (*UGC, error) {
+	b, err := newBase(baseURL, prefix, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &UGC{b: b}, nil
+}
+
+// SubmitContent registers content in the pending state. Resubmitting a
+// ContentID replaces the record, so failed submissions are retried.
+func (c *UGC) SubmitContent(ctx context.Context, req SubmitRequest) (Content, error) {
+	var out Content
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/content", body: req, idempotent: true}, &out)
+	return out, err
+}
+
+// Review records a moderation decision for a content item.
+func (c *UGC) Review(ctx context.Context, contentID string, req ReviewRequest) (Content, error) {
+	var out Content
+	err := c.b.do(ctx, call{
+		method:     http.MethodPost,
+		path:       "/content/" + url.PathEscape(contentID) + "/review",
+		body:       req,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// ListContent returns all content matching filter, fetching every page.
+func (c *UGC) ListContent(ctx context.Context, filter ContentFilter) ([]Content, error) {
+	return all[Content](ctx, c.b, listContentCall(filter))
+}
+
+// ListContentPage returns one page of content matching filter.
+func (c *UGC) ListContentPage(ctx context.Context, filter ContentFilter, opts PageOptions) (Page[Content], error) {
+	return page[Content](ctx, c.b, listContentCall(filter), opts)
+}
+
+func listContentCall(filter ContentFilter) call {
+	query := url.Values{}
+	setIf(query, "tenant_id", filter.TenantID)
+	setIf(query, "project_id", filter.ProjectID)
+	setIf(query, "state", filter.State)
+	return call{method: http.MethodGet, path: "/content", query: query, idempotent: true}
+}
+
+// ModerationStats reports submissions, decisions, and review times over
+// the days q selects, per tenant and in total.
+func (c *UGC) ModerationStats(ctx context.Context, q StatsQuery) (ModerationStats, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", q.TenantID)
+	setIf(query, "project_id", q.ProjectID)
+	setIf(query, "from", q.From)
+	setIf(query, "to", q.To)
+	var out ModerationStats
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/content/stats", query: query, idempotent: true}, &out)
+	return out, err
+}
+
+// UploadData stores data as the bytes of a pending content item and
+// returns the content with its media pending. Processing sniffs the type,
+// reads image dimensions, and renders a thumbnail afterwards.
+func (c *UGC) UploadData(ctx context.Context, contentID string, data []byte) (Content, error) {
+	var out Content
+	err := c.b.do(ctx, call{
+		method:     http.MethodPut,
+		path:       "/content/" + url.PathEscape(contentID) + "/data",
+		raw:        data,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Data returns the bytes uploaded for a content item.
+func (c *UGC) Data(ctx context.Context, contentID string) ([]byte, error) {
+	var out []byte
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/content/" + url.PathEscape(contentID) + "/data", idempotent: true}, &out)
+	return out, err
+}
+
+// Thumbnail returns the PNG thumbnail of a processed image.
+func (c *UGC) Thumbnail(ctx context.Context, contentID string) ([]byte, error) {
+	var out []byte
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/content/" + url.PathEscape(contentID) + "/thumbnail", idempotent: true}, &out)
+	return out, err
+}
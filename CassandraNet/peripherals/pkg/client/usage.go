@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Meters of billable usage.
+const (
+	MeterMessagesPublished = "messages_published"
+	MeterNotificationsSent = "notifications_sent"
+	MeterUGCModerated      = "ugc_moderated"
+	MeterLogBytes          = "log_bytes"
+)
+
+// UsageTotal is a tenant's usage of one meter on one UTC day.
+type UsageTotal struct {
+	TenantID string `json:"tenant_id"`
+	Day      string `json:"day"`
+	Meter    string `json:"meter"`
+	Quantity int64  `json:"quantity"`
+}
+
+// UsageQuery selects daily totals. Empty fields match every tenant or
+// meter; From and To are inclusive days (YYYY-MM-DD), defaulting to the
+// current month so far. An empty TenantID uses the tenant bound to the
+// caller's credentials, if any.
+type UsageQuery struct {
+	TenantID string
+	Meter    string
+	From     string
+	To       string
+}
+
+func (q UsageQuery) query() url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", q.TenantID)
+	setIf(query, "meter", q.Meter)
+	setIf(query, "from", q.From)
+	setIf(query, "to", q.To)
+	return query
+}
+
+// QuotaStatus is a tenant's usage against one quota in the current day or
+// month.
+type QuotaStatus struct {
+	TenantID    string `json:"tenant_id"`
+	Meter       string `json:"meter"`
+	Period      string `json:"period"`
+	PeriodStart string `json:"period_start"`
+	Limit       int64  `json:"limit"`
+	Used        int64  `json:"used"`
+	Remaining   int64  `json:"remaining"`
+	Exceeded    bool   `json:"exceeded"`
+}
+
+// Usage calls a service's usage API. Services sharing a storage backend
+// report the same totals, so any of them will do, such as the gateway's
+// /messaging prefix or the all-in-one binary's root.
+type Usage struct {
+	b *base
+}
+
+// NewUsage returns a client for the usage API at baseURL.
+func NewUsage(baseURL string, opts ...Option) (*Usage, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{b: b}, nil
+}
+
+// Totals returns the daily totals matching q, ordered by tenant, day, and
+// meter, fetching every page.
+func (c *Usage) Totals(ctx context.Context, q UsageQuery) ([]UsageTotal, error) {
+	return all[UsageTotal](ctx, c.b, call{method: http.MethodGet, path: "/usage", query: q.query(), idempotent: true})
+}
+
+// TotalsPage returns one page of the daily totals matching q.
+func (c *Usage) TotalsPage(ctx context.Context, q UsageQuery, opts PageOptions) (Page[UsageTotal], error) {
+	return page[UsageTotal](ctx, c.b, call{method: http.MethodGet, path: "/usage", query: q.query(), idempotent: true}, opts)
+}
+
+// Quotas returns the tenant's usage against each quota that applies to it.
+func (c *Usage) Quotas(ctx context.Context, tenantID string) ([]QuotaStatus, error) {
+	query := url.Values{}
+	setIf(query, "tenant_id", tenantID)
+	var out struct {
+		Items []QuotaStatus `json:"items"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/usage/quotas", query: query, idempotent: true}, &out)
+	return out.Items, err
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statuses of webhook deliveries.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookAllEvents selects every event a service offers.
+const WebhookAllEvents = "*"
+
+// Headers sent with every webhook delivery.
+const (
+	WebhookHeaderID        = "Webhook-Id"
+	WebhookHeaderEvent     = "Webhook-Event"
+	WebhookHeaderTimestamp = "Webhook-Timestamp"
+	WebhookHeaderSignature = "Webhook-Signature"
+)
+
+// ErrInvalidWebhookSignature is returned by VerifyWebhook for a delivery
+// that was not signed with the secret or whose timestamp is too old.
+var ErrInvalidWebhookSignature = errors.New("client: invalid webhook signature")
+
+// Webhook is a subscription that delivers a service's events to URL. Secret
+// is only returned when the subscription is created or replaced.
+type Webhook struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	ProjectID   string    `json:"project_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Secret      string    `json:"secret,omitempty"`
+	Disabled    bool      `json:"disabled"`
+	Version     int64     `json:"version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookRequest defines a subscription. Events lists event names, or
+// WebhookAllEvents. An empty Secret generates one for a new subscription
+// and keeps the current one when replacing.
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"`
+	// IfVersion, when non-zero, makes the change fail with
+	// "webhooks.precondition_failed" unless the stored subscription has
+	// that version.
+	IfVersion int64 `json:"-"`
+}
+
+// WebhookScope names a project and optionally one tenant of it. An empty
+// TenantID uses the tenant bound to the caller's credentials.
+type WebhookScope struct {
+	TenantID  string
+	ProjectID string
+}
+
+func (s WebhookScope) query() url.Values {
+	query := url.Values{}
+	setIf(query, "tenant_id", s.TenantID)
+	setIf(query, "project_id", s.ProjectID)
+	return query
+}
+
+// WebhookDelivery is one event on its way to a subscription, with every
+// attempt made so far.
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	SubscriptionID string           `json:"subscription_id"`
+	TenantID       string           `json:"tenant_id,omitempty"`
+	ProjectID      string           `json:"project_id"`
+	EventID        string           `json:"event_id"`
+	Event          string           `json:"event"`
+	Payload        json.RawMessage  `json:"payload"`
+	Status         string           `json:"status"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at,omitzero"`
+	History        []WebhookAttempt `json:"history,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+// WebhookAttempt is one try at sending a delivery.
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Webhooks calls a service's webhooks API. Each service delivers its own
+// events, so baseURL is the owning service's address, such as the
+// gateway's /ugc prefix, or the all-in-one binary's root for every event.
+type Webhooks struct {
+	b *base
+}
+
+// NewWebhooks returns a client for the webhooks API at baseURL.
+func NewWebhooks(baseURL string, opts ...Option) (*Webhooks, error) {
+	b, err := newBase(baseURL, "", opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhooks{b: b}, nil
+}
+
+// PutWebhook creates or replaces the scope's subscription with id.
+func (c *Webhooks) PutWebhook(ctx context.Context, scope WebhookScope, id string, req WebhookRequest) (Webhook, error) {
+	var header http.Header
+	if req.IfVersion != 0 {
+		header = http.Header{"If-Match": {`"` + strconv.FormatInt(req.IfVersion, 10) + `"`}}
+	}
+	var out Webhook
+	err := c.b.do(ctx, call{
+		method:     http.MethodPut,
+		path:       "/webhooks/" + url.PathEscape(id),
+		query:      scope.query(),
+		body:       req,
+		header:     header,
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// GetWebhook returns the scope's subscription with id, without its secret.
+func (c *Webhooks) GetWebhook(ctx context.Context, scope WebhookScope, id string) (Webhook, error) {
+	var out Webhook
+	err := c.b.do(ctx, call{method: http.MethodGet, path: "/webhooks/" + url.PathEscape(id), query: scope.query(), idempotent: true}, &out)
+	return out, err
+}
+
+// DeleteWebhook removes the scope's subscription with id and its
+// deliveries.
+func (c *Webhooks) DeleteWebhook(ctx context.Context, scope WebhookScope, id string) error {
+	return c.b.do(ctx, call{method: http.MethodDelete, path: "/webhooks/" + url.PathEscape(id), query: scope.query(), idempotent: true}, nil)
+}
+
+// ListWebhooks returns the scope's subscriptions, fetching every page.
+func (c *Webhooks) ListWebhooks(ctx context.Context, scope WebhookScope) ([]Webhook, error) {
+	return all[Webhook](ctx, c.b, call{method: http.MethodGet, path: "/webhooks", query: scope.query(), idempotent: true})
+}
+
+// ListWebhooksPage returns one page of the scope's subscriptions.
+func (c *Webhooks) ListWebhooksPage(ctx context.Context, scope WebhookScope, opts PageOptions) (Page[Webhook], error) {
+	return page[Webhook](ctx, c.b, call{method: http.MethodGet, path: "/webhooks", query: scope.query(), idempotent: true}, opts)
+}
+
+// Deliveries returns the subscription's deliveries with status, or all of
+// them when status is empty, newest first, fetching every page.
+func (c *Webhooks) Deliveries(ctx context.Context, scope WebhookScope, id, status string) ([]WebhookDelivery, error) {
+	return all[WebhookDelivery](ctx, c.b, c.deliveries(scope, id, status))
+}
+
+// DeliveriesPage returns one page of the subscription's deliveries.
+func (c *Webhooks) DeliveriesPage(ctx context.Context, scope WebhookScope, id, status string, opts PageOptions) (Page[WebhookDelivery], error) {
+	return page[WebhookDelivery](ctx, c.b, c.deliveries(scope, id, status), opts)
+}
+
+func (c *Webhooks) deliveries(scope WebhookScope, id, status string) call {
+	query := scope.query()
+	setIf(query, "status", status)
+	return call{method: http.MethodGet, path: "/webhooks/" + url.PathEscape(id) + "/deliveries", query: query, idempotent: true}
+}
+
+// GetDelivery returns one of the subscription's deliveries.
+func (c *Webhooks) GetDelivery(ctx context.Context, scope WebhookScope, id, deliveryID string) (WebhookDelivery, error) {
+	var out WebhookDelivery
+	err := c.b.do(ctx, call{
+		method:     http.MethodGet,
+		path:       "/webhooks/" + url.PathEscape(id) + "/deliveries/" + url.PathEscape(deliveryID),
+		query:      scope.query(),
+		idempotent: true,
+	}, &out)
+	return out, err
+}
+
+// Redrive sends a failed delivery again, with a fresh set of attempts. It
+// fails with "webhooks.not_failed" unless the delivery has failed.
+func (c *Webhooks) Redrive(ctx context.Context, scope WebhookScope, id, deliveryID string) (WebhookDelivery, error) {
+	var out WebhookDelivery
+	err := c.b.do(ctx, call{
+		method: http.MethodPost,
+		path:   "/webhooks/" + url.PathEscape(id) + "/deliveries/" + url.PathEscape(deliveryID) + "/redrive",
+		query:  scope.query(),
+	}, &out)
+	return out, err
+}
+
+// RedriveFailed sends every failed delivery of the subscription again and
+// returns how many there were.
+func (c *Webhooks) RedriveFailed(ctx context.Context, scope WebhookScope, id string) (int, error) {
+	var out struct {
+		Redriven int `json:"redriven"`
+	}
+	err := c.b.do(ctx, call{method: http.MethodPost, path: "/webhooks/" + url.PathEscape(id) + "/redrive", query: scope.query()}, &out)
+	return out.Redriven, err
+}
+
+// VerifyWebhook checks a received delivery's Webhook-Signature against the
+// subscription's secret, given the request's header and raw body. When
+// tolerance is positive, deliveries timestamped further than it from now
+// are rejected, which stops replays.
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(WebhookHeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	if tolerance > 0 {
+		skew := time.Since(time.Unix(timestamp, 0))
+		if skew > tolerance || skew < -tolerance {
+			return ErrInvalidWebhookSignature
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	want := "v1=" + hex.EncodeToString(mac.Sum(nil))
+	for _, got := range strings.Split(header.Get(WebhookHeaderSignature), ",") {
+		if hmac.Equal([]byte(strings.TrimSpace(got)), []byte(want)) {
+			return nil
+		}
+	}
+	return ErrInvalidWebhookSignature
+}